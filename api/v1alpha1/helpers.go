@@ -2,6 +2,7 @@ package v1alpha1
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
 	"time"
 
@@ -17,6 +18,75 @@ const (
 
 	// VirtualMachineKind is the kind string for VirtualMachine resources.
 	VirtualMachineKind = "VirtualMachine"
+
+	// VirtualMachineStackKind is the kind string for VirtualMachineStack resources.
+	VirtualMachineStackKind = "VirtualMachineStack"
+)
+
+// Standard labels set by foundry.
+const (
+	// LabelStack is the name of the VirtualMachineStack a VM belongs to.
+	LabelStack = GroupName + "/stack"
+)
+
+// Standard annotations understood by foundry.
+const (
+	// AnnotationOwner records who owns a VM, e.g. a user name or team.
+	AnnotationOwner = GroupName + "/owner"
+
+	// AnnotationNote is a free-form note about a VM, e.g. what it is for.
+	AnnotationNote = GroupName + "/note"
+
+	// AnnotationClonedFrom records the VM a VM was cloned from.
+	AnnotationClonedFrom = GroupName + "/cloned-from"
+
+	// AnnotationShutdownTimeout overrides how long 'foundry shutdown-all'
+	// waits for the VM to shut down before forcing it off (e.g., "300s").
+	AnnotationShutdownTimeout = GroupName + "/shutdown-timeout"
+
+	// AnnotationResourceUID records the UID of the Kubernetes VirtualMachine
+	// resource a VM was created for by foundry-controller. The controller only
+	// updates and destroys VMs carrying the UID of their resource.
+	AnnotationResourceUID = GroupName + "/resource-uid"
+
+	// AnnotationDefaultUser is the login user of the VM's boot image (e.g.
+	// "fedora"), copied from the image metadata at creation. 'foundry ssh'
+	// logs in as this user.
+	AnnotationDefaultUser = GroupName + "/default-user"
+
+	// AnnotationOSVariant is the libosinfo short ID of the VM's boot image OS
+	// (e.g. "fedora43"), copied from the image metadata at creation.
+	AnnotationOSVariant = GroupName + "/os-variant"
+
+	// AnnotationBootImagePath is the path of the image backing the VM's boot
+	// disk, recorded at creation. The VM is not started if the image is
+	// missing from it.
+	AnnotationBootImagePath = GroupName + "/boot-image-path"
+
+	// AnnotationBootImageFingerprint is the fingerprint of the image backing
+	// the VM's boot disk (see storage.Manager.ImageFingerprint), recorded at
+	// creation. The VM is not started if the image was replaced since.
+	AnnotationBootImageFingerprint = GroupName + "/boot-image-fingerprint"
+
+	// AnnotationMACStrategy is the strategy that derives the MAC addresses
+	// of the VM's interfaces that don't set one (e.g. "ip-derived"; see
+	// naming.MACStrategy), recorded at creation. Interfaces added later use
+	// the same strategy.
+	AnnotationMACStrategy = GroupName + "/mac-strategy"
+
+	// AnnotationMACOUI is the OUI of the MACs generated by the oui-prefixed
+	// MAC strategy.
+	AnnotationMACOUI = GroupName + "/mac-oui"
+
+	// AnnotationInterfaceNameStrategy is the strategy that derives the tap
+	// interface names of the VM's interfaces (e.g. "ip-derived"; see
+	// naming.InterfaceNameStrategy), recorded at creation. VMs without it
+	// use ip-derived names.
+	AnnotationInterfaceNameStrategy = GroupName + "/interface-name-strategy"
+
+	// AnnotationBackup set to "true" opts a VM into the scheduled backups of
+	// 'foundry serve --backup-dir'.
+	AnnotationBackup = GroupName + "/backup"
 )
 
 // NewVirtualMachine creates a new VirtualMachine with TypeMeta and ObjectMeta defaults.
@@ -37,10 +107,10 @@ func NewVirtualMachine(name string) *VirtualMachine {
 		},
 		Spec: VirtualMachineSpec{
 			CPUMode:     "host-model",
-			StoragePool: "foundry-vms",
+			StoragePool: GetHostDefaults().StoragePool,
 			Autostart:   &autostart,
 			BootDisk: BootDiskSpec{
-				ImagePool: "foundry-images",
+				ImagePool: GetHostDefaults().ImagePool,
 				Format:    "qcow2",
 			},
 		},
@@ -70,6 +140,115 @@ func (vm *VirtualMachine) IsAutostart() bool {
 	return *vm.Spec.Autostart
 }
 
+// IsDiscard returns true if guest discard requests reach the disk volumes.
+// Handles nil pointer by returning default value (true).
+func (vm *VirtualMachine) IsDiscard() bool {
+	if vm.Spec.Discard == nil {
+		return true // default
+	}
+	return *vm.Spec.Discard
+}
+
+// IsGuestAgent returns true if the VM has a QEMU guest agent channel.
+// Handles nil pointer by returning default value (true).
+func (vm *VirtualMachine) IsGuestAgent() bool {
+	if vm.Spec.GuestAgent == nil {
+		return true // default
+	}
+	return *vm.Spec.GuestAgent
+}
+
+// GetCloudInitTransport returns the cloud-init transport with default
+// fallback, or empty if cloud-init is not configured.
+func (vm *VirtualMachine) GetCloudInitTransport() string {
+	if vm.Spec.CloudInit == nil {
+		return ""
+	}
+	if vm.Spec.CloudInit.Transport == "" {
+		return CloudInitTransportISO
+	}
+	return vm.Spec.CloudInit.Transport
+}
+
+// GetCloudInitDatasource returns the cloud-init datasource with default
+// fallback, or empty if cloud-init is not configured.
+func (vm *VirtualMachine) GetCloudInitDatasource() string {
+	if vm.Spec.CloudInit == nil {
+		return ""
+	}
+	if vm.Spec.CloudInit.Datasource == "" {
+		return CloudInitDatasourceNoCloud
+	}
+	return vm.Spec.CloudInit.Datasource
+}
+
+// HasCloudInitISO returns true if the VM's cloud-init seed is an ISO volume.
+func (vm *VirtualMachine) HasCloudInitISO() bool {
+	return vm.GetCloudInitTransport() == CloudInitTransportISO
+}
+
+// GetCloudInitSeedURL returns the URL of the VM's NoCloud seed with the http
+// transport: the seed URL followed by the VM name and a trailing slash, as
+// cloud-init appends the file names to it. Empty for other transports.
+func (vm *VirtualMachine) GetCloudInitSeedURL() string {
+	if vm.GetCloudInitTransport() != CloudInitTransportHTTP {
+		return ""
+	}
+	return strings.TrimSuffix(vm.Spec.CloudInit.SeedURL, "/") + "/" + url.PathEscape(vm.Name) + "/"
+}
+
+// GetFirmware returns the firmware with default fallback.
+func (vm *VirtualMachine) GetFirmware() string {
+	if vm.Spec.Firmware == "" {
+		return "efi"
+	}
+	return vm.Spec.Firmware
+}
+
+// IsSecureBoot returns true if UEFI Secure Boot is explicitly enabled.
+func (vm *VirtualMachine) IsSecureBoot() bool {
+	return vm.Spec.SecureBoot != nil && *vm.Spec.SecureBoot
+}
+
+// GetMachineType returns the machine type: the configured one, q35 if
+// Secure Boot needs it, or empty for libvirt's default.
+func (vm *VirtualMachine) GetMachineType() string {
+	if vm.Spec.MachineType == "" && vm.IsSecureBoot() {
+		return "q35"
+	}
+	return vm.Spec.MachineType
+}
+
+// GetGraphicsListen returns the address the display listens on with default
+// fallback, or empty if the VM has no display.
+func (vm *VirtualMachine) GetGraphicsListen() string {
+	if vm.Spec.Graphics == nil {
+		return ""
+	}
+	if vm.Spec.Graphics.Listen == "" {
+		return "127.0.0.1"
+	}
+	return vm.Spec.Graphics.Listen
+}
+
+// GetMaxVCPUs returns the maximum number of vCPUs, which is never less than
+// the number of vCPUs.
+func (vm *VirtualMachine) GetMaxVCPUs() int {
+	if vm.Spec.MaxVCPUs < vm.Spec.VCPUs {
+		return vm.Spec.VCPUs
+	}
+	return vm.Spec.MaxVCPUs
+}
+
+// GetMaxMemoryMiB returns the maximum memory in MiB, which is never less than
+// the memory.
+func (vm *VirtualMachine) GetMaxMemoryMiB() int {
+	if vm.Spec.MaxMemoryGiB*1024 < vm.GetMemoryMiB() {
+		return vm.GetMemoryMiB()
+	}
+	return vm.Spec.MaxMemoryGiB * 1024
+}
+
 // GetCPUMode returns the CPU mode with default fallback.
 func (vm *VirtualMachine) GetCPUMode() string {
 	if vm.Spec.CPUMode == "" {
@@ -78,10 +257,19 @@ func (vm *VirtualMachine) GetCPUMode() string {
 	return vm.Spec.CPUMode
 }
 
+// GetMemoryMiB returns the memory to allocate in MiB, from whichever of
+// MemoryMiB and MemoryGiB is set.
+func (vm *VirtualMachine) GetMemoryMiB() int {
+	if vm.Spec.MemoryMiB > 0 {
+		return vm.Spec.MemoryMiB
+	}
+	return vm.Spec.MemoryGiB * 1024
+}
+
 // GetStoragePool returns the storage pool with default fallback.
 func (vm *VirtualMachine) GetStoragePool() string {
 	if vm.Spec.StoragePool == "" {
-		return "foundry-vms"
+		return GetHostDefaults().StoragePool
 	}
 	return vm.Spec.StoragePool
 }
@@ -94,14 +282,84 @@ func (vm *VirtualMachine) GetBootDiskFormat() string {
 	return vm.Spec.BootDisk.Format
 }
 
+// GetBus returns the disk bus with default fallback.
+func (d *DiskTuningSpec) GetBus() string {
+	if d.Bus == "" {
+		return "virtio"
+	}
+	return d.Bus
+}
+
+// GetCache returns the disk cache mode with default fallback.
+func (d *DiskTuningSpec) GetCache() string {
+	if d.Cache == "" {
+		return "none"
+	}
+	return d.Cache
+}
+
+// GetBridgeType returns the bridge type with default fallback.
+func (n *NetworkInterfaceSpec) GetBridgeType() string {
+	if n.BridgeType == "" {
+		return BridgeTypeLinux
+	}
+	return n.BridgeType
+}
+
+// GetInterfaceQueues returns the number of virtio-net queue pairs of an
+// interface, which defaults to the VM's vCPU count.
+func (vm *VirtualMachine) GetInterfaceQueues(iface *NetworkInterfaceSpec) int {
+	if iface.Queues == 0 {
+		return vm.Spec.VCPUs
+	}
+	return iface.Queues
+}
+
+// GetMode returns the macvtap mode with default fallback.
+func (m *MacvtapSpec) GetMode() string {
+	if m.Mode == "" {
+		return MacvtapModeBridge
+	}
+	return m.Mode
+}
+
+// IsDiskDiscard returns true if guest discard requests reach the volume of
+// a disk, which defaults to the VM-wide setting.
+func (vm *VirtualMachine) IsDiskDiscard(d *DiskTuningSpec) bool {
+	if d.Discard == nil {
+		return vm.IsDiscard()
+	}
+	return *d.Discard
+}
+
 // GetBootDiskImagePool returns the boot disk image pool with default fallback.
 func (vm *VirtualMachine) GetBootDiskImagePool() string {
 	if vm.Spec.BootDisk.ImagePool == "" {
-		return "foundry-images"
+		return GetHostDefaults().ImagePool
 	}
 	return vm.Spec.BootDisk.ImagePool
 }
 
+// GetOwner returns the owner recorded in the owner annotation, if any.
+func (vm *VirtualMachine) GetOwner() string {
+	return vm.Annotations[AnnotationOwner]
+}
+
+// GetDefaultUser returns the login user recorded in the default-user
+// annotation, if any.
+func (vm *VirtualMachine) GetDefaultUser() string {
+	return vm.Annotations[AnnotationDefaultUser]
+}
+
+// GetOSVariant returns the OS variant of the spec, or else the one recorded
+// from the boot image in the os-variant annotation, if any.
+func (vm *VirtualMachine) GetOSVariant() string {
+	if vm.Spec.OSVariant != "" {
+		return vm.Spec.OSVariant
+	}
+	return vm.Annotations[AnnotationOSVariant]
+}
+
 // GetName returns the VM name from metadata.
 func (vm *VirtualMachine) GetName() string {
 	return vm.Name
@@ -178,6 +436,65 @@ func (vm *VirtualMachine) GetCloudInitVolumeName() string {
 	return fmt.Sprintf("%s_cloudinit.iso", vm.Name)
 }
 
+// InheritNetworkDefaults fills the fields of spec.networkDefaults that the
+// spec does not set from defaults, e.g. the defaults of the CLI config.
+func (vm *VirtualMachine) InheritNetworkDefaults(defaults *NetworkDefaultsSpec) {
+	if defaults == nil {
+		return
+	}
+	if vm.Spec.NetworkDefaults == nil {
+		vm.Spec.NetworkDefaults = &NetworkDefaultsSpec{}
+	}
+	nd := vm.Spec.NetworkDefaults
+	if len(nd.DNSServers) == 0 {
+		nd.DNSServers = append([]string(nil), defaults.DNSServers...)
+	}
+	if len(nd.SearchDomains) == 0 {
+		nd.SearchDomains = append([]string(nil), defaults.SearchDomains...)
+	}
+	if nd.GatewayMetricPolicy == "" {
+		nd.GatewayMetricPolicy = defaults.GatewayMetricPolicy
+	}
+	if len(nd.DNSServers) == 0 && len(nd.SearchDomains) == 0 && nd.GatewayMetricPolicy == "" {
+		vm.Spec.NetworkDefaults = nil
+	}
+}
+
+// GetGatewayMetricPolicy returns the gateway metric policy with default
+// fallback.
+func (vm *VirtualMachine) GetGatewayMetricPolicy() string {
+	if vm.Spec.NetworkDefaults == nil || vm.Spec.NetworkDefaults.GatewayMetricPolicy == "" {
+		return GatewayMetricPolicySingle
+	}
+	return vm.Spec.NetworkDefaults.GatewayMetricPolicy
+}
+
+// AddSSHAuthorizedKey adds key to the cloud-init authorized keys, enabling
+// cloud-init if it is not configured. A key that is already present (ignoring
+// its comment) is not added again. Returns whether the key was added.
+func (vm *VirtualMachine) AddSSHAuthorizedKey(key string) bool {
+	if vm.Spec.CloudInit == nil {
+		vm.Spec.CloudInit = &CloudInitSpec{}
+	}
+	for _, existing := range vm.Spec.CloudInit.SSHAuthorizedKeys {
+		if sshKeyData(existing) == sshKeyData(key) {
+			return false
+		}
+	}
+	vm.Spec.CloudInit.SSHAuthorizedKeys = append(vm.Spec.CloudInit.SSHAuthorizedKeys, key)
+	return true
+}
+
+// sshKeyData returns the type and key data of an authorized key, without
+// its comment.
+func sshKeyData(key string) string {
+	fields := strings.Fields(key)
+	if len(fields) > 2 {
+		fields = fields[:2]
+	}
+	return strings.Join(fields, " ")
+}
+
 // Normalize sanitizes user input to consistent formats.
 // This is called automatically before validation.
 func (vm *VirtualMachine) Normalize() {
@@ -191,13 +508,11 @@ func (vm *VirtualMachine) Normalize() {
 
 	// Note: Bridge names are NOT normalized - they must match hypervisor config exactly
 
-	// Set default storage pool if not specified
+	// Set default storage and image pools if not specified
 	if vm.Spec.StoragePool == "" {
-		vm.Spec.StoragePool = "foundry-vms"
+		vm.Spec.StoragePool = GetHostDefaults().StoragePool
 	}
-
-	// Set default image pool if not specified
 	if vm.Spec.BootDisk.ImagePool == "" {
-		vm.Spec.BootDisk.ImagePool = "foundry-images"
+		vm.Spec.BootDisk.ImagePool = GetHostDefaults().ImagePool
 	}
 }
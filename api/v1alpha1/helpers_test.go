@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -153,6 +154,99 @@ func TestIsAutostart(t *testing.T) {
 	}
 }
 
+func TestIsDiscard(t *testing.T) {
+	tests := []struct {
+		name     string
+		discard  *bool
+		expected bool
+	}{
+		{name: "nil pointer defaults to true", discard: nil, expected: true},
+		{name: "explicit true", discard: boolPtr(true), expected: true},
+		{name: "explicit false", discard: boolPtr(false), expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &VirtualMachine{Spec: VirtualMachineSpec{Discard: tt.discard}}
+			if got := vm.IsDiscard(); got != tt.expected {
+				t.Errorf("Expected IsDiscard() = %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCloudInitTransport(t *testing.T) {
+	tests := []struct {
+		name      string
+		cloudInit *CloudInitSpec
+		transport string
+		iso       bool
+		seedURL   string
+	}{
+		{name: "no cloud-init"},
+		{name: "default", cloudInit: &CloudInitSpec{}, transport: "iso", iso: true},
+		{name: "http", cloudInit: &CloudInitSpec{Transport: "http", SeedURL: "http://169.254.169.254:8775/"},
+			transport: "http", seedURL: "http://169.254.169.254:8775/web-1/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &VirtualMachine{ObjectMeta: ObjectMeta{Name: "web-1"}, Spec: VirtualMachineSpec{CloudInit: tt.cloudInit}}
+			if got := vm.GetCloudInitTransport(); got != tt.transport {
+				t.Errorf("GetCloudInitTransport() = %q, want %q", got, tt.transport)
+			}
+			if got := vm.HasCloudInitISO(); got != tt.iso {
+				t.Errorf("HasCloudInitISO() = %v, want %v", got, tt.iso)
+			}
+			if got := vm.GetCloudInitSeedURL(); got != tt.seedURL {
+				t.Errorf("GetCloudInitSeedURL() = %q, want %q", got, tt.seedURL)
+			}
+		})
+	}
+}
+
+func TestIsGuestAgent(t *testing.T) {
+	tests := []struct {
+		name       string
+		guestAgent *bool
+		expected   bool
+	}{
+		{name: "nil pointer defaults to true", guestAgent: nil, expected: true},
+		{name: "explicit true", guestAgent: boolPtr(true), expected: true},
+		{name: "explicit false", guestAgent: boolPtr(false), expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &VirtualMachine{Spec: VirtualMachineSpec{GuestAgent: tt.guestAgent}}
+			if got := vm.IsGuestAgent(); got != tt.expected {
+				t.Errorf("Expected IsGuestAgent() = %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestGetGraphicsListen(t *testing.T) {
+	tests := []struct {
+		name     string
+		graphics *GraphicsSpec
+		expected string
+	}{
+		{name: "no display", graphics: nil, expected: ""},
+		{name: "default loopback", graphics: &GraphicsSpec{Type: GraphicsTypeVNC}, expected: "127.0.0.1"},
+		{name: "explicit address", graphics: &GraphicsSpec{Type: GraphicsTypeSPICE, Listen: "0.0.0.0"}, expected: "0.0.0.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &VirtualMachine{Spec: VirtualMachineSpec{Graphics: tt.graphics}}
+			if got := vm.GetGraphicsListen(); got != tt.expected {
+				t.Errorf("Expected GetGraphicsListen() = %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
 func TestGetCPUMode(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -190,6 +284,52 @@ func TestGetCPUMode(t *testing.T) {
 	}
 }
 
+func TestGetMemoryMiB(t *testing.T) {
+	tests := []struct {
+		name      string
+		memoryGiB int
+		memoryMiB int
+		expected  int
+	}{
+		{name: "GiB", memoryGiB: 4, expected: 4096},
+		{name: "MiB", memoryMiB: 1536, expected: 1536},
+		{name: "unset", expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &VirtualMachine{
+				Spec: VirtualMachineSpec{
+					MemoryGiB: tt.memoryGiB,
+					MemoryMiB: tt.memoryMiB,
+				},
+			}
+			if got := vm.GetMemoryMiB(); got != tt.expected {
+				t.Errorf("Expected GetMemoryMiB() = %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestGetMaximums(t *testing.T) {
+	vm := &VirtualMachine{Spec: VirtualMachineSpec{VCPUs: 2, MemoryMiB: 1536}}
+	if got := vm.GetMaxVCPUs(); got != 2 {
+		t.Errorf("Expected GetMaxVCPUs() = 2 without maxVCPUs, got %d", got)
+	}
+	if got := vm.GetMaxMemoryMiB(); got != 1536 {
+		t.Errorf("Expected GetMaxMemoryMiB() = 1536 without maxMemoryGiB, got %d", got)
+	}
+
+	vm.Spec.MaxVCPUs = 8
+	vm.Spec.MaxMemoryGiB = 4
+	if got := vm.GetMaxVCPUs(); got != 8 {
+		t.Errorf("Expected GetMaxVCPUs() = 8, got %d", got)
+	}
+	if got := vm.GetMaxMemoryMiB(); got != 4096 {
+		t.Errorf("Expected GetMaxMemoryMiB() = 4096, got %d", got)
+	}
+}
+
 func TestGetStoragePool(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -445,6 +585,68 @@ func TestGetCloudInitVolumeName(t *testing.T) {
 	}
 }
 
+func TestInheritNetworkDefaults(t *testing.T) {
+	defaults := &NetworkDefaultsSpec{
+		DNSServers:          []string{"10.0.0.53"},
+		SearchDomains:       []string{"example.com"},
+		GatewayMetricPolicy: GatewayMetricPolicyOrdered,
+	}
+
+	vm := &VirtualMachine{}
+	vm.InheritNetworkDefaults(defaults)
+	if !reflect.DeepEqual(vm.Spec.NetworkDefaults, defaults) {
+		t.Errorf("NetworkDefaults = %+v, want %+v", vm.Spec.NetworkDefaults, defaults)
+	}
+	vm.Spec.NetworkDefaults.DNSServers[0] = "10.9.9.9"
+	if defaults.DNSServers[0] != "10.0.0.53" {
+		t.Error("InheritNetworkDefaults() must copy the defaults")
+	}
+
+	// Fields set in the spec win
+	vm = &VirtualMachine{Spec: VirtualMachineSpec{NetworkDefaults: &NetworkDefaultsSpec{DNSServers: []string{"10.1.0.53"}}}}
+	vm.InheritNetworkDefaults(defaults)
+	want := &NetworkDefaultsSpec{
+		DNSServers:          []string{"10.1.0.53"},
+		SearchDomains:       []string{"example.com"},
+		GatewayMetricPolicy: GatewayMetricPolicyOrdered,
+	}
+	if !reflect.DeepEqual(vm.Spec.NetworkDefaults, want) {
+		t.Errorf("NetworkDefaults = %+v, want %+v", vm.Spec.NetworkDefaults, want)
+	}
+
+	// Nothing to inherit leaves the spec alone
+	vm = &VirtualMachine{}
+	vm.InheritNetworkDefaults(&NetworkDefaultsSpec{})
+	if vm.Spec.NetworkDefaults != nil {
+		t.Errorf("NetworkDefaults = %+v, want nil", vm.Spec.NetworkDefaults)
+	}
+	if got := vm.GetGatewayMetricPolicy(); got != GatewayMetricPolicySingle {
+		t.Errorf("GetGatewayMetricPolicy() = %q, want %q", got, GatewayMetricPolicySingle)
+	}
+}
+
+func TestAddSSHAuthorizedKey(t *testing.T) {
+	vm := &VirtualMachine{}
+
+	if !vm.AddSSHAuthorizedKey("ssh-ed25519 AAAAkey1 alice@laptop") {
+		t.Error("expected the key to be added")
+	}
+	if vm.Spec.CloudInit == nil || len(vm.Spec.CloudInit.SSHAuthorizedKeys) != 1 {
+		t.Fatalf("CloudInit = %+v, want one key", vm.Spec.CloudInit)
+	}
+
+	// The same key under another comment is not added twice
+	if vm.AddSSHAuthorizedKey("ssh-ed25519 AAAAkey1 alice@desktop") {
+		t.Error("expected the duplicate key to be skipped")
+	}
+	if !vm.AddSSHAuthorizedKey("ssh-ed25519 AAAAkey2") {
+		t.Error("expected a different key to be added")
+	}
+	if got := len(vm.Spec.CloudInit.SSHAuthorizedKeys); got != 2 {
+		t.Errorf("keys = %d, want 2", got)
+	}
+}
+
 func TestNormalize(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,73 @@
+package v1alpha1
+
+// Built-in defaults of spec.storagePool and spec.bootDisk.imagePool, unless
+// changed with SetHostDefaults.
+const (
+	DefaultStoragePool = "foundry-vms"
+	DefaultImagePool   = "foundry-images"
+)
+
+// HostDefaults fill in what VM specs leave unset, from the configuration of
+// the host foundry runs on (/etc/foundry/config.yaml).
+type HostDefaults struct {
+	// StoragePool and ImagePool replace DefaultStoragePool and
+	// DefaultImagePool.
+	StoragePool string
+	ImagePool   string
+
+	// Bridge is attached to network interfaces that name no bridge,
+	// network, macvtap device or SR-IOV VF.
+	Bridge string
+
+	// DNSServers are used as spec.networkDefaults.dnsServers when a VM sets
+	// none.
+	DNSServers []string
+}
+
+// hostDefaults holds the defaults set by SetHostDefaults.
+var hostDefaults HostDefaults
+
+// SetHostDefaults sets the defaults applied to VMs loaded from now on. Empty
+// pool names keep the built-in defaults.
+func SetHostDefaults(defaults HostDefaults) {
+	hostDefaults = defaults
+}
+
+// GetHostDefaults returns the defaults set by SetHostDefaults, with the
+// built-in pool names filled in.
+func GetHostDefaults() HostDefaults {
+	defaults := hostDefaults
+	if defaults.StoragePool == "" {
+		defaults.StoragePool = DefaultStoragePool
+	}
+	if defaults.ImagePool == "" {
+		defaults.ImagePool = DefaultImagePool
+	}
+	return defaults
+}
+
+// ApplyHostDefaults fills in the storage pools, interface bridges and DNS
+// servers the spec leaves unset from the host defaults.
+func (vm *VirtualMachine) ApplyHostDefaults() {
+	defaults := GetHostDefaults()
+
+	if vm.Spec.StoragePool == "" {
+		vm.Spec.StoragePool = defaults.StoragePool
+	}
+	if vm.Spec.BootDisk.ImagePool == "" {
+		vm.Spec.BootDisk.ImagePool = defaults.ImagePool
+	}
+
+	if defaults.Bridge != "" {
+		for i := range vm.Spec.NetworkInterfaces {
+			iface := &vm.Spec.NetworkInterfaces[i]
+			if iface.Bridge == "" && iface.Network == "" && iface.Macvtap == nil && iface.SRIOV == nil {
+				iface.Bridge = defaults.Bridge
+			}
+		}
+	}
+
+	if len(defaults.DNSServers) > 0 {
+		vm.InheritNetworkDefaults(&NetworkDefaultsSpec{DNSServers: defaults.DNSServers})
+	}
+}
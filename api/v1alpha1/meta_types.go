@@ -40,6 +40,13 @@ type ObjectMeta struct {
 	// +optional
 	Name string `json:"name,omitempty" yaml:"name,omitempty"`
 
+	// GenerateName is a prefix used to generate a unique name when Name is
+	// omitted. A random suffix is appended and checked against existing
+	// resources; the final name is stored in Name.
+	// More info: https://kubernetes.io/docs/reference/using-api/api-concepts/#generated-values
+	// +optional
+	GenerateName string `json:"generateName,omitempty" yaml:"generateName,omitempty"`
+
 	// Labels are key/value pairs attached to objects.
 	// Labels can be used to organize and to select subsets of objects.
 	// More info: https://kubernetes.io/docs/concepts/overview/working-with-objects/labels
@@ -131,6 +138,50 @@ func (t *Time) UnmarshalYAML(node *yaml.Node) error {
 	return nil
 }
 
+// Duration is a wrapper around time.Duration that serializes as a Go duration
+// string (e.g., "2h", "90m").
+// Matches k8s.io/apimachinery/pkg/apis/meta/v1.Duration behavior.
+//
+// +k8s:deepcopy-gen=true
+type Duration struct {
+	time.Duration `json:"-" yaml:"-"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+// Parses a duration string such as "2h45m".
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
 // Condition contains details for the current condition of this object.
 // Matches k8s.io/apimachinery/pkg/apis/meta/v1.Condition for future compatibility.
 //
@@ -226,6 +277,16 @@ func (in *Time) DeepCopy() *Time {
 	return out
 }
 
+// DeepCopy creates a deep copy of Duration.
+func (in *Duration) DeepCopy() *Duration {
+	if in == nil {
+		return nil
+	}
+	out := new(Duration)
+	*out = *in
+	return out
+}
+
 // DeepCopy creates a deep copy of Condition.
 func (in *Condition) DeepCopy() *Condition {
 	if in == nil {
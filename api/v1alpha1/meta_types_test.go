@@ -233,6 +233,47 @@ func TestTime_YAML_RoundTrip(t *testing.T) {
 	}
 }
 
+func TestDuration_RoundTrip(t *testing.T) {
+	original := Duration{Duration: 2*time.Hour + 30*time.Minute}
+
+	data, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("json.Marshal error = %v", err)
+	}
+	if string(data) != `"2h30m0s"` {
+		t.Errorf("json.Marshal = %s, want \"2h30m0s\"", data)
+	}
+	var fromJSON Duration
+	if err := json.Unmarshal(data, &fromJSON); err != nil {
+		t.Fatalf("json.Unmarshal error = %v", err)
+	}
+	if fromJSON != original {
+		t.Errorf("JSON round trip = %v, want %v", fromJSON, original)
+	}
+
+	data, err = yaml.Marshal(original)
+	if err != nil {
+		t.Fatalf("yaml.Marshal error = %v", err)
+	}
+	var fromYAML Duration
+	if err := yaml.Unmarshal(data, &fromYAML); err != nil {
+		t.Fatalf("yaml.Unmarshal error = %v", err)
+	}
+	if fromYAML != original {
+		t.Errorf("YAML round trip = %v, want %v", fromYAML, original)
+	}
+}
+
+func TestDuration_UnmarshalInvalid(t *testing.T) {
+	var d Duration
+	if err := json.Unmarshal([]byte(`"two hours"`), &d); err == nil {
+		t.Error("json.Unmarshal of invalid duration succeeded")
+	}
+	if err := yaml.Unmarshal([]byte("two hours"), &d); err == nil {
+		t.Error("yaml.Unmarshal of invalid duration succeeded")
+	}
+}
+
 func TestTypeMeta_DeepCopy(t *testing.T) {
 	tests := []struct {
 		name  string
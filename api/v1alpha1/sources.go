@@ -0,0 +1,10 @@
+package v1alpha1
+
+import "embed"
+
+// Sources holds the Go source files that define the API types. Their doc
+// comments and kubebuilder markers are the field documentation shown by
+// 'foundry explain', so it never drifts from the types.
+//
+//go:embed meta_types.go virtualmachine_types.go stack_types.go
+var Sources embed.FS
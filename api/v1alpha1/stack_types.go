@@ -0,0 +1,84 @@
+package v1alpha1
+
+// VirtualMachineStack is a group of related VMs created from one template,
+// e.g. web-01 to web-03 with consecutive IP addresses.
+//
+// 'foundry stack up' creates or updates its VMs and 'foundry stack down'
+// destroys them. Each VM is labeled with the stack name (see LabelStack).
+//
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=stack;stacks
+type VirtualMachineStack struct {
+	// TypeMeta contains the API version and kind.
+	TypeMeta `json:",inline" yaml:",inline"`
+
+	// ObjectMeta contains metadata like name, labels, annotations.
+	// The name identifies the stack.
+	ObjectMeta `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+	// Spec defines the VMs of the stack.
+	Spec VirtualMachineStackSpec `json:"spec" yaml:"spec"`
+}
+
+// VirtualMachineStackSpec defines the VMs of a VirtualMachineStack.
+//
+// +k8s:deepcopy-gen=true
+type VirtualMachineStackSpec struct {
+	// Names is the pattern of the VM names. A numeric range in braces is
+	// expanded to one VM per number, zero-padded to the width of the range
+	// start (e.g., "web-{01..03}" is web-01, web-02 and web-03).
+	Names string `json:"names" yaml:"names"`
+
+	// Template is the VM each name is created from. Static IPv4 and IPv6
+	// addresses of its network interfaces are advanced by one for each
+	// VM, so the first VM gets the template's addresses. "{name}" in
+	// spec.cloudInit.fqdn is replaced with the VM name.
+	Template VirtualMachineTemplate `json:"template" yaml:"template"`
+}
+
+// VirtualMachineTemplate is the template of the VMs of a VirtualMachineStack.
+//
+// +k8s:deepcopy-gen=true
+type VirtualMachineTemplate struct {
+	// ObjectMeta holds the labels and annotations given to every VM. Its
+	// name is ignored.
+	// +optional
+	ObjectMeta `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+	// Spec is the spec of every VM.
+	Spec VirtualMachineSpec `json:"spec" yaml:"spec"`
+}
+
+// DeepCopy creates a deep copy of VirtualMachineStack.
+func (in *VirtualMachineStack) DeepCopy() *VirtualMachineStack {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualMachineStack)
+	out.TypeMeta = *in.TypeMeta.DeepCopy()
+	out.ObjectMeta = *in.ObjectMeta.DeepCopy()
+	out.Spec = *in.Spec.DeepCopy()
+	return out
+}
+
+// DeepCopy creates a deep copy of VirtualMachineStackSpec.
+func (in *VirtualMachineStackSpec) DeepCopy() *VirtualMachineStackSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualMachineStackSpec)
+	out.Names = in.Names
+	out.Template = *in.Template.DeepCopy()
+	return out
+}
+
+// DeepCopy creates a deep copy of VirtualMachineTemplate.
+func (in *VirtualMachineTemplate) DeepCopy() *VirtualMachineTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualMachineTemplate)
+	out.ObjectMeta = *in.ObjectMeta.DeepCopy()
+	out.Spec = *in.Spec.DeepCopy()
+	return out
+}
@@ -37,6 +37,13 @@ type VirtualMachineSpec struct {
 	// +kubebuilder:validation:Minimum=1
 	VCPUs int `json:"vcpus" yaml:"vcpus"`
 
+	// MaxVCPUs is the number of vCPUs the VM can be given while running.
+	// vCPUs up to it can be hotplugged with 'foundry apply' or 'foundry vm
+	// set-resources'. Defaults to VCPUs, which allows no hotplug.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxVCPUs int `json:"maxVCPUs,omitempty" yaml:"maxVCPUs,omitempty"`
+
 	// CPUMode defines the CPU model exposure mode.
 	// Valid values: "host-model" (default), "host-passthrough".
 	// +optional
@@ -44,12 +51,65 @@ type VirtualMachineSpec struct {
 	// +kubebuilder:default=host-model
 	CPUMode string `json:"cpuMode,omitempty" yaml:"cpuMode,omitempty"`
 
+	// Firmware is the firmware the VM boots with.
+	// Valid values: "efi" (default, UEFI), "bios" (legacy BIOS).
+	// +optional
+	// +kubebuilder:validation:Enum=efi;bios
+	// +kubebuilder:default=efi
+	Firmware string `json:"firmware,omitempty" yaml:"firmware,omitempty"`
+
+	// SecureBoot enables UEFI Secure Boot with the distribution's keys
+	// enrolled when true, or asks for firmware without it when false. Unset
+	// leaves the choice to libvirt. Secure Boot requires efi firmware and the
+	// q35 machine type, which it selects if MachineType is not set.
+	// +optional
+	SecureBoot *bool `json:"secureBoot,omitempty" yaml:"secureBoot,omitempty"`
+
+	// TPM adds an emulated TPM 2.0 device, backed by swtpm on the host, as
+	// Windows 11 and measured-boot guests need. Its state lives with the
+	// domain and is removed when the VM is destroyed.
+	// +optional
+	TPM bool `json:"tpm,omitempty" yaml:"tpm,omitempty"`
+
+	// MachineType is the emulated chipset.
+	// Valid values: "q35" (PCIe), "pc" (i440FX). Defaults to libvirt's
+	// default machine type.
+	// +optional
+	// +kubebuilder:validation:Enum=q35;pc
+	MachineType string `json:"machineType,omitempty" yaml:"machineType,omitempty"`
+
+	// OSVariant is the guest operating system as a libosinfo short ID (e.g.
+	// "fedora43", "ubuntu24.04") or full libosinfo ID URI. It is recorded in the domain metadata so virt-manager and other
+	// libvirt tools pick suitable device defaults. Defaults to the OS variant
+	// recorded for the boot image.
+	// +optional
+	OSVariant string `json:"osVariant,omitempty" yaml:"osVariant,omitempty"`
+
 	// MemoryGiB is the amount of memory to allocate in gibibytes (GiB).
+	// Exactly one of MemoryGiB and MemoryMiB is required.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MemoryGiB int `json:"memoryGiB,omitempty" yaml:"memoryGiB,omitempty"`
+
+	// MemoryMiB is the amount of memory to allocate in mebibytes (MiB), for
+	// sizes that are not a whole number of GiB.
+	// Mutually exclusive with MemoryGiB.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MemoryMiB int `json:"memoryMiB,omitempty" yaml:"memoryMiB,omitempty"`
+
+	// MaxMemoryGiB is the memory the VM can be given while running, in
+	// gibibytes. The VM boots with this much memory and the balloon driver
+	// hands all but MemoryGiB/MemoryMiB back to the host; raising the memory
+	// up to it takes effect without a restart. Defaults to the memory, which
+	// allows no growth.
+	// +optional
 	// +kubebuilder:validation:Minimum=1
-	MemoryGiB int `json:"memoryGiB" yaml:"memoryGiB"`
+	MaxMemoryGiB int `json:"maxMemoryGiB,omitempty" yaml:"maxMemoryGiB,omitempty"`
 
 	// StoragePool is the libvirt storage pool to use for VM disks.
-	// Defaults to "foundry-vms" if not specified.
+	// Defaults to "foundry-vms", or storage.vmsPool of the host config, if
+	// not specified.
 	// +optional
 	// +kubebuilder:default=foundry-vms
 	StoragePool string `json:"storagePool,omitempty" yaml:"storagePool,omitempty"`
@@ -66,6 +126,12 @@ type VirtualMachineSpec struct {
 	// +kubebuilder:validation:MinItems=1
 	NetworkInterfaces []NetworkInterfaceSpec `json:"networkInterfaces" yaml:"networkInterfaces"`
 
+	// NetworkDefaults are DNS and routing settings shared by the network
+	// interfaces. Unset fields are taken from defaults.networkDefaults in the
+	// foundry CLI config.
+	// +optional
+	NetworkDefaults *NetworkDefaultsSpec `json:"networkDefaults,omitempty" yaml:"networkDefaults,omitempty"`
+
 	// CloudInit defines cloud-init configuration for VM provisioning.
 	// +optional
 	CloudInit *CloudInitSpec `json:"cloudInit,omitempty" yaml:"cloudInit,omitempty"`
@@ -75,6 +141,72 @@ type VirtualMachineSpec struct {
 	// +optional
 	// +kubebuilder:default=true
 	Autostart *bool `json:"autostart,omitempty" yaml:"autostart,omitempty"`
+
+	// StartupOrder orders the start of autostart VMs on host boot: VMs with
+	// a lower order start first, VMs with the same order together. VMs with
+	// an order are started by 'foundry autostart' (see its --install-unit)
+	// instead of libvirt, which starts VMs in no particular order. Zero, the
+	// default, leaves the VM to libvirt, which starts it before any ordered VM.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	StartupOrder int `json:"startupOrder,omitempty" yaml:"startupOrder,omitempty"`
+
+	// StartupDelay is how long 'foundry autostart' waits after starting the
+	// VM before starting VMs with a higher StartupOrder (e.g., "30s"), giving
+	// the services it provides time to come up.
+	// +optional
+	StartupDelay *Duration `json:"startupDelay,omitempty" yaml:"startupDelay,omitempty"`
+
+	// Discard passes TRIM/discard requests from the guest through to the
+	// disk volumes and turns writes of zeroes into discards, so thin-provisioned
+	// qcow2 volumes shrink when the guest deletes data.
+	// Defaults to true.
+	// +optional
+	// +kubebuilder:default=true
+	Discard *bool `json:"discard,omitempty" yaml:"discard,omitempty"`
+
+	// IOThreads is the number of dedicated I/O threads of the VM. Disks are
+	// pinned to them with their ioThread setting.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	IOThreads int `json:"ioThreads,omitempty" yaml:"ioThreads,omitempty"`
+
+	// GuestAgent adds the virtio-serial channel (org.qemu.guest_agent.0) the
+	// QEMU guest agent connects to, enabling address reporting, filesystem
+	// freezes for snapshots and commands run in the guest. The guest needs
+	// qemu-guest-agent installed.
+	// Defaults to true.
+	// +optional
+	// +kubebuilder:default=true
+	GuestAgent *bool `json:"guestAgent,omitempty" yaml:"guestAgent,omitempty"`
+
+	// TTL is how long the VM may exist, counted from its creation. Once it
+	// has expired the VM and its storage are destroyed by 'foundry reap' or
+	// the daemon (e.g., "2h", "30m").
+	// +optional
+	TTL *Duration `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+
+	// Ephemeral VMs are destroyed, including their storage, by 'foundry reap'
+	// or the daemon once they shut down.
+	// +optional
+	Ephemeral bool `json:"ephemeral,omitempty" yaml:"ephemeral,omitempty"`
+
+	// SMBIOS sets SMBIOS/DMI strings the guest reads from its firmware tables,
+	// e.g. for licensing, inventory agents or cloud-init datasources.
+	// +optional
+	SMBIOS *SMBIOSSpec `json:"smbios,omitempty" yaml:"smbios,omitempty"`
+
+	// Graphics adds a VNC or SPICE display, for guests and installers that
+	// need a screen rather than the serial console. Without it the VM is
+	// headless.
+	// +optional
+	Graphics *GraphicsSpec `json:"graphics,omitempty" yaml:"graphics,omitempty"`
+
+	// HostDevices are host PCI devices (e.g. GPUs or NICs) and mediated
+	// devices (e.g. vGPU slices) passed through to the VM. 'foundry host
+	// devices' lists candidates on the hypervisor.
+	// +optional
+	HostDevices []HostDeviceSpec `json:"hostDevices,omitempty" yaml:"hostDevices,omitempty"`
 }
 
 // BootDiskSpec defines the boot disk configuration.
@@ -94,13 +226,16 @@ type BootDiskSpec struct {
 	Image string `json:"image,omitempty" yaml:"image,omitempty"`
 
 	// ImagePool is the storage pool containing the base image.
-	// Defaults to "foundry-images" if not specified.
+	// Defaults to "foundry-images", or storage.imagesPool of the host
+	// config, if not specified.
 	// Only used when Image is a volume name without pool prefix.
 	// +optional
 	// +kubebuilder:default=foundry-images
 	ImagePool string `json:"imagePool,omitempty" yaml:"imagePool,omitempty"`
 
-	// Format is the disk format to use.
+	// Format is the disk format to use. It applies to the data disks too.
+	// qcow2 boot disks are thin overlays on the image; raw boot disks are
+	// full copies of it. Logical (LVM) pools only hold raw volumes.
 	// Valid values: "qcow2" (default), "raw".
 	// +optional
 	// +kubebuilder:validation:Enum=qcow2;raw
@@ -111,6 +246,9 @@ type BootDiskSpec struct {
 	// Mutually exclusive with Image.
 	// +optional
 	Empty bool `json:"empty,omitempty" yaml:"empty,omitempty"`
+
+	// DiskTuningSpec sets the bus and driver options of the boot disk.
+	DiskTuningSpec `json:",inline" yaml:",inline"`
 }
 
 // DataDiskSpec defines an additional data disk configuration.
@@ -124,26 +262,181 @@ type DataDiskSpec struct {
 	// SizeGB is the size of the data disk in gigabytes.
 	// +kubebuilder:validation:Minimum=1
 	SizeGB int `json:"sizeGB" yaml:"sizeGB"`
+
+	// DiskTuningSpec sets the bus and driver options of the data disk.
+	DiskTuningSpec `json:",inline" yaml:",inline"`
+}
+
+// DiskTuningSpec defines how a disk is attached to the guest and how QEMU
+// performs its I/O.
+//
+// +k8s:deepcopy-gen=true
+type DiskTuningSpec struct {
+	// Bus is the bus the disk is attached to. scsi disks share a
+	// virtio-scsi controller; sata suits guests without virtio drivers.
+	// Valid values: "virtio" (default), "scsi", "sata".
+	// +optional
+	// +kubebuilder:validation:Enum=virtio;scsi;sata
+	// +kubebuilder:default=virtio
+	Bus string `json:"bus,omitempty" yaml:"bus,omitempty"`
+
+	// Cache is the host page cache mode. writeback is faster but can lose
+	// writes the guest believes are on disk if the host crashes; unsafe
+	// also ignores guest flushes and suits throwaway VMs only.
+	// Valid values: "none" (default), "writeback", "unsafe".
+	// +optional
+	// +kubebuilder:validation:Enum=none;writeback;unsafe
+	// +kubebuilder:default=none
+	Cache string `json:"cache,omitempty" yaml:"cache,omitempty"`
+
+	// IO is the QEMU I/O mode. native uses Linux AIO and requires cache
+	// "none"; threads uses a thread pool. Unset leaves the choice to QEMU.
+	// Valid values: "native", "threads".
+	// +optional
+	// +kubebuilder:validation:Enum=native;threads
+	IO string `json:"io,omitempty" yaml:"io,omitempty"`
+
+	// Discard overrides spec.discard for this disk.
+	// +optional
+	Discard *bool `json:"discard,omitempty" yaml:"discard,omitempty"`
+
+	// IOThread pins the disk to one of the VM's I/O threads (1 to
+	// spec.ioThreads), taking its I/O off the main QEMU thread.
+	// Only virtio disks can be pinned.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	IOThread int `json:"ioThread,omitempty" yaml:"ioThread,omitempty"`
+
+	// IOTune caps the I/O rate of the disk, so one VM cannot starve the
+	// others on the host's storage.
+	// +optional
+	IOTune *DiskIOTuneSpec `json:"ioTune,omitempty" yaml:"ioTune,omitempty"`
+}
+
+// DiskIOTuneSpec defines the I/O rate limits of a disk. Zero means no limit.
+// A total limit cannot be combined with a read or write limit of the same
+// kind.
+//
+// +k8s:deepcopy-gen=true
+type DiskIOTuneSpec struct {
+	// TotalIOPS limits read and write operations per second.
+	// +optional
+	TotalIOPS int `json:"totalIOPS,omitempty" yaml:"totalIOPS,omitempty"`
+
+	// ReadIOPS limits read operations per second.
+	// +optional
+	ReadIOPS int `json:"readIOPS,omitempty" yaml:"readIOPS,omitempty"`
+
+	// WriteIOPS limits write operations per second.
+	// +optional
+	WriteIOPS int `json:"writeIOPS,omitempty" yaml:"writeIOPS,omitempty"`
+
+	// TotalBytesPerSec limits read and write throughput in bytes per second.
+	// +optional
+	TotalBytesPerSec int `json:"totalBytesPerSec,omitempty" yaml:"totalBytesPerSec,omitempty"`
+
+	// ReadBytesPerSec limits read throughput in bytes per second.
+	// +optional
+	ReadBytesPerSec int `json:"readBytesPerSec,omitempty" yaml:"readBytesPerSec,omitempty"`
+
+	// WriteBytesPerSec limits write throughput in bytes per second.
+	// +optional
+	WriteBytesPerSec int `json:"writeBytesPerSec,omitempty" yaml:"writeBytesPerSec,omitempty"`
 }
 
 // NetworkInterfaceSpec defines a network interface configuration.
 //
 // +k8s:deepcopy-gen=true
 type NetworkInterfaceSpec struct {
-	// IP is the IP address with CIDR notation (e.g., "10.250.250.10/24").
+	// IP is the IPv4 address with CIDR notation (e.g., "10.250.250.10/24").
 	// Used to derive MAC address and interface name deterministically.
-	IP string `json:"ip" yaml:"ip"`
+	// Required unless DHCP or IPv6 is set.
+	// +optional
+	IP string `json:"ip,omitempty" yaml:"ip,omitempty"`
+
+	// Gateway is the IPv4 default gateway address.
+	// Required when IP is set.
+	// +optional
+	Gateway string `json:"gateway,omitempty" yaml:"gateway,omitempty"`
+
+	// IPv6 is the IPv6 address with CIDR notation (e.g., "2001:db8::10/64").
+	// Set together with IP for dual-stack interfaces, or alone for IPv6-only
+	// interfaces, whose MAC address and interface name are derived from a
+	// hash of this address.
+	// +optional
+	IPv6 string `json:"ipv6,omitempty" yaml:"ipv6,omitempty"`
+
+	// IPv6Gateway is the IPv6 default gateway address. Used for the IPv6
+	// default route when DefaultRoute is set.
+	// +optional
+	IPv6Gateway string `json:"ipv6Gateway,omitempty" yaml:"ipv6Gateway,omitempty"`
+
+	// DHCP configures the interface's IPv4 address by DHCP instead of a
+	// static IP. Mutually exclusive with IP, Gateway and DefaultRoute.
+	// +optional
+	DHCP bool `json:"dhcp,omitempty" yaml:"dhcp,omitempty"`
+
+	// MACAddress is the interface's MAC address. By default it is derived
+	// from IP (or IPv6); for DHCP interfaces a random address is generated
+	// when the VM is created and recorded here, as are the addresses of
+	// every interface under the random-persisted and oui-prefixed naming
+	// strategies.
+	// +optional
+	MACAddress string `json:"macAddress,omitempty" yaml:"macAddress,omitempty"`
+
+	// MTU is the interface's MTU in bytes, set on the host side of the
+	// interface and in the guest's network-config, e.g. 9000 for jumbo
+	// frames. SR-IOV VFs only have it set in the guest.
+	// Defaults to that of the bridge or network (usually 1500).
+	// +optional
+	// +kubebuilder:validation:Minimum=68
+	// +kubebuilder:validation:Maximum=65535
+	MTU int `json:"mtu,omitempty" yaml:"mtu,omitempty"`
+
+	// Bridge is the host bridge to attach the interface to.
+	// Exactly one of Bridge, Network, Macvtap and SRIOV must be set.
+	// +optional
+	Bridge string `json:"bridge,omitempty" yaml:"bridge,omitempty"`
+
+	// BridgeType is the kind of Bridge: linux or openvswitch.
+	// Defaults to linux.
+	// +optional
+	// +kubebuilder:validation:Enum=linux;openvswitch
+	BridgeType string `json:"bridgeType,omitempty" yaml:"bridgeType,omitempty"`
+
+	// Network is the libvirt network to attach the interface to (e.g.,
+	// "default" for the NAT network most hosts have). libvirt networks may
+	// also be isolated or routed; see 'virsh net-list'.
+	// Exactly one of Bridge, Network, Macvtap and SRIOV must be set.
+	// +optional
+	Network string `json:"network,omitempty" yaml:"network,omitempty"`
 
-	// Gateway is the default gateway IP address.
-	Gateway string `json:"gateway" yaml:"gateway"`
+	// Macvtap attaches the interface directly to a host network device
+	// through a macvtap device, without a bridge.
+	// Exactly one of Bridge, Network, Macvtap and SRIOV must be set.
+	// +optional
+	Macvtap *MacvtapSpec `json:"macvtap,omitempty" yaml:"macvtap,omitempty"`
 
-	// Bridge is the bridge name to attach the interface to.
-	Bridge string `json:"bridge" yaml:"bridge"`
+	// SRIOV passes an SR-IOV virtual function of a host network device
+	// through to the VM, for near line-rate networking.
+	// Exactly one of Bridge, Network, Macvtap and SRIOV must be set.
+	// +optional
+	SRIOV *SRIOVSpec `json:"sriov,omitempty" yaml:"sriov,omitempty"`
 
 	// DNSServers is the list of DNS server IP addresses.
 	// +optional
 	DNSServers []string `json:"dnsServers,omitempty" yaml:"dnsServers,omitempty"`
 
+	// SearchDomains are DNS search domains of the interface, searched before
+	// those of the network defaults.
+	// +optional
+	SearchDomains []string `json:"searchDomains,omitempty" yaml:"searchDomains,omitempty"`
+
+	// Routes are static routes through the interface, in addition to the
+	// default route.
+	// +optional
+	Routes []RouteSpec `json:"routes,omitempty" yaml:"routes,omitempty"`
+
 	// DefaultRoute determines if this interface should have the default route.
 	// Only one interface should have this set to true.
 	// Defaults to false.
@@ -157,12 +450,217 @@ type NetworkInterfaceSpec struct {
 	// Defaults to false.
 	// +optional
 	PXEBoot bool `json:"pxeBoot,omitempty" yaml:"pxeBoot,omitempty"`
+
+	// Queues is the number of virtio-net queue pairs of the interface, served
+	// by vhost on the host, so that several vCPUs can move its traffic at
+	// once. Set 1 for a single queue. SR-IOV VFs have their own queues.
+	// Defaults to the number of vCPUs.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=256
+	Queues int `json:"queues,omitempty" yaml:"queues,omitempty"`
+
+	// VLAN is the 802.1Q VLAN the interface is a member of on the host: its
+	// traffic is tagged with this ID and the guest sees it untagged. Set on
+	// openvswitch bridges, libvirt networks that support VLANs and SR-IOV
+	// VFs; Linux bridges need VLAN filtering set up on the host instead.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=4094
+	VLAN int `json:"vlan,omitempty" yaml:"vlan,omitempty"`
+
+	// Bandwidth shapes the traffic of the interface on the host.
+	// +optional
+	Bandwidth *BandwidthSpec `json:"bandwidth,omitempty" yaml:"bandwidth,omitempty"`
+}
+
+// RouteSpec defines a static route of a network interface.
+//
+// +k8s:deepcopy-gen=true
+type RouteSpec struct {
+	// To is the destination network in CIDR notation, e.g. "10.0.0.0/8".
+	To string `json:"to" yaml:"to"`
+
+	// Via is the gateway address, of the same IP family as To.
+	Via string `json:"via" yaml:"via"`
+
+	// Metric is the route's priority; lower metrics are preferred.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Metric int `json:"metric,omitempty" yaml:"metric,omitempty"`
+}
+
+// Bridge types of NetworkInterfaceSpec.
+const (
+	// BridgeTypeLinux is a Linux kernel bridge.
+	BridgeTypeLinux = "linux"
+
+	// BridgeTypeOpenVSwitch is an Open vSwitch bridge.
+	BridgeTypeOpenVSwitch = "openvswitch"
+)
+
+// Macvtap modes of MacvtapSpec.
+const (
+	// MacvtapModeBridge lets VMs on the same device reach each other
+	// directly; none of them can reach the host through it.
+	MacvtapModeBridge = "bridge"
+
+	// MacvtapModePrivate isolates the VMs on the same device from each
+	// other.
+	MacvtapModePrivate = "private"
+)
+
+// MacvtapSpec attaches a network interface to a host device through macvtap.
+//
+// +k8s:deepcopy-gen=true
+type MacvtapSpec struct {
+	// Device is the host network device, e.g. "eno1".
+	Device string `json:"device" yaml:"device"`
+
+	// Mode is the macvtap mode: bridge or private.
+	// Defaults to bridge.
+	// +optional
+	// +kubebuilder:validation:Enum=bridge;private
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
+}
+
+// SRIOVSpec selects an SR-IOV virtual function (VF) of a host network device
+// (the physical function, PF) to pass through as a network interface.
+//
+// +k8s:deepcopy-gen=true
+type SRIOVSpec struct {
+	// PF is the host network device whose VF is used, e.g. "enp1s0f0".
+	PF string `json:"pf" yaml:"pf"`
+
+	// VF is the index of the virtual function of PF, from 0.
+	// +kubebuilder:validation:Minimum=0
+	VF int `json:"vf" yaml:"vf"`
+
+	// PCIAddress is the host PCI address of the VF. It is looked up from PF
+	// and VF when the VM is created and recorded here, so the VM keeps its
+	// VF if the host's VFs are renumbered.
+	// +optional
+	PCIAddress string `json:"pciAddress,omitempty" yaml:"pciAddress,omitempty"`
+}
+
+// BandwidthSpec defines the traffic shaping of a network interface, seen
+// from the VM: inbound is traffic to the guest, outbound traffic from it.
+//
+// +k8s:deepcopy-gen=true
+type BandwidthSpec struct {
+	// Inbound limits the traffic the guest receives.
+	// +optional
+	Inbound *BandwidthLimitSpec `json:"inbound,omitempty" yaml:"inbound,omitempty"`
+
+	// Outbound limits the traffic the guest sends.
+	// +optional
+	Outbound *BandwidthLimitSpec `json:"outbound,omitempty" yaml:"outbound,omitempty"`
+}
+
+// BandwidthLimitSpec defines a traffic rate limit in one direction.
+//
+// +k8s:deepcopy-gen=true
+type BandwidthLimitSpec struct {
+	// Average is the sustained rate in KiB per second.
+	// +kubebuilder:validation:Minimum=1
+	Average int `json:"average" yaml:"average"`
+
+	// Peak is the rate bursts may reach in KiB per second.
+	// Defaults to Average.
+	// +optional
+	Peak int `json:"peak,omitempty" yaml:"peak,omitempty"`
+
+	// Burst is how many KiB may be sent at the peak rate.
+	// +optional
+	Burst int `json:"burst,omitempty" yaml:"burst,omitempty"`
 }
 
+// Gateway metric policies of NetworkDefaultsSpec.
+const (
+	// GatewayMetricPolicySingle gives only interfaces with DefaultRoute a
+	// default route.
+	GatewayMetricPolicySingle = "single"
+
+	// GatewayMetricPolicyOrdered gives every interface with a gateway a
+	// default route, preferred in interface order.
+	GatewayMetricPolicyOrdered = "ordered"
+)
+
+// NetworkDefaultsSpec defines settings inherited by network interfaces.
+//
+// +k8s:deepcopy-gen=true
+type NetworkDefaultsSpec struct {
+	// DNSServers are used by static interfaces that do not set their own
+	// dnsServers. DHCP interfaces use the DNS servers of the DHCP server.
+	// +optional
+	DNSServers []string `json:"dnsServers,omitempty" yaml:"dnsServers,omitempty"`
+
+	// SearchDomains are the DNS search domains of the interfaces that use
+	// DNSServers.
+	// +optional
+	SearchDomains []string `json:"searchDomains,omitempty" yaml:"searchDomains,omitempty"`
+
+	// GatewayMetricPolicy decides which static interfaces get a default
+	// route. "single" (the default) routes only through interfaces with
+	// defaultRoute. "ordered" routes through every interface with a gateway,
+	// with route metrics 100, 200, ... so that interfaces with defaultRoute
+	// are preferred, then earlier interfaces over later ones.
+	// +optional
+	// +kubebuilder:validation:Enum=single;ordered
+	// +kubebuilder:default=single
+	GatewayMetricPolicy string `json:"gatewayMetricPolicy,omitempty" yaml:"gatewayMetricPolicy,omitempty"`
+}
+
+// Cloud-init transports of CloudInitSpec.
+const (
+	// CloudInitTransportISO attaches the NoCloud seed to the VM as an ISO
+	// volume in a CDROM drive.
+	CloudInitTransportISO = "iso"
+
+	// CloudInitTransportHTTP has the guest fetch the NoCloud seed over HTTP
+	// from the seed server of 'foundry serve' (--seed-listen). The seed URL
+	// is passed to cloud-init in the SMBIOS system serial
+	// (ds=nocloud-net;s=<seedURL>/<vm-name>/), so no CDROM is attached.
+	CloudInitTransportHTTP = "http"
+)
+
+// Cloud-init datasources of CloudInitSpec.
+const (
+	// CloudInitDatasourceNoCloud is the NoCloud datasource: user-data,
+	// meta-data and network-config on a volume labeled CIDATA.
+	CloudInitDatasourceNoCloud = "nocloud"
+
+	// CloudInitDatasourceConfigDrive is the OpenStack config drive:
+	// openstack/latest/{user_data,meta_data.json,network_data.json} on a
+	// volume labeled config-2, for images that only support config drives.
+	CloudInitDatasourceConfigDrive = "configdrive"
+)
+
 // CloudInitSpec defines cloud-init configuration.
 //
 // +k8s:deepcopy-gen=true
 type CloudInitSpec struct {
+	// Datasource is the format of the seed ISO: nocloud (the default) or
+	// configdrive. The config drive requires the iso transport.
+	// +optional
+	// +kubebuilder:validation:Enum=nocloud;configdrive
+	// +kubebuilder:default=nocloud
+	Datasource string `json:"datasource,omitempty" yaml:"datasource,omitempty"`
+
+	// Transport is how the seed reaches the guest: iso (the default), or
+	// http for images that cannot mount a CDROM.
+	// +optional
+	// +kubebuilder:validation:Enum=iso;http
+	// +kubebuilder:default=iso
+	Transport string `json:"transport,omitempty" yaml:"transport,omitempty"`
+
+	// SeedURL is the base URL of the seed server the guest fetches its seed
+	// from with the http transport, e.g. "http://169.254.169.254:8775". The
+	// VM's seed is served under <seedURL>/<vm-name>/. Required by, and only
+	// used with, the http transport.
+	// +optional
+	SeedURL string `json:"seedURL,omitempty" yaml:"seedURL,omitempty"`
+
 	// RawUserData allows providing complete custom user-data content.
 	// When set, this overrides the generated user-data from other fields.
 	// Must be valid cloud-init format (e.g., start with #cloud-config).
@@ -192,6 +690,104 @@ type CloudInitSpec struct {
 	// Ignored if RawUserData is set.
 	// +optional
 	SSHPasswordAuth bool `json:"sshPasswordAuth,omitempty" yaml:"sshPasswordAuth,omitempty"`
+
+	// FSTrim enables the guest's fstrim.timer, which discards unused blocks
+	// of mounted filesystems weekly so that freed space is returned to the
+	// host (see Discard). Requires a systemd-based guest.
+	// Ignored if RawUserData is set.
+	// +optional
+	FSTrim bool `json:"fstrim,omitempty" yaml:"fstrim,omitempty"`
+
+	// UserDataExtra is a YAML mapping of additional cloud-config keys (e.g.,
+	// packages, runcmd, write_files, users) merged into the generated
+	// user-data. Lists are appended to generated lists of the same key; any
+	// other key that foundry also generates is rejected.
+	// Mutually exclusive with RawUserData and UserDataFile.
+	// +optional
+	UserDataExtra string `json:"userDataExtra,omitempty" yaml:"userDataExtra,omitempty"`
+
+	// UserDataFile is the path to a file holding the same content as
+	// UserDataExtra, relative to the configuration file. It is read when the
+	// configuration is loaded and its content stored in UserDataExtra.
+	// Mutually exclusive with RawUserData and UserDataExtra. VMs created
+	// through the REST API or the controller cannot use it.
+	// +optional
+	UserDataFile string `json:"userDataFile,omitempty" yaml:"userDataFile,omitempty"`
+}
+
+// SMBIOSSpec defines SMBIOS/DMI strings exposed to the guest.
+//
+// +k8s:deepcopy-gen=true
+type SMBIOSSpec struct {
+	// Serial is the system serial number (dmidecode -s system-serial-number,
+	// /sys/class/dmi/id/product_serial). It is also set as the chassis serial.
+	// +optional
+	Serial string `json:"serial,omitempty" yaml:"serial,omitempty"`
+
+	// AssetTag is the chassis asset tag (dmidecode -s chassis-asset-tag,
+	// /sys/class/dmi/id/chassis_asset_tag).
+	// +optional
+	AssetTag string `json:"assetTag,omitempty" yaml:"assetTag,omitempty"`
+
+	// OEMStrings are free-form strings in the SMBIOS type 11 table
+	// (dmidecode -t 11).
+	// +optional
+	OEMStrings []string `json:"oemStrings,omitempty" yaml:"oemStrings,omitempty"`
+}
+
+// Graphics types of GraphicsSpec.
+const (
+	// GraphicsTypeVNC is a VNC display.
+	GraphicsTypeVNC = "vnc"
+
+	// GraphicsTypeSPICE is a SPICE display.
+	GraphicsTypeSPICE = "spice"
+)
+
+// GraphicsSpec defines a remote display.
+//
+// +k8s:deepcopy-gen=true
+type GraphicsSpec struct {
+	// Type is the display protocol: vnc or spice.
+	// +kubebuilder:validation:Enum=vnc;spice
+	Type string `json:"type" yaml:"type"`
+
+	// Listen is the hypervisor address the display listens on. Defaults to
+	// 127.0.0.1, which is only reachable from the hypervisor itself (e.g.,
+	// through an SSH tunnel); 0.0.0.0 listens on every address.
+	// +optional
+	Listen string `json:"listen,omitempty" yaml:"listen,omitempty"`
+
+	// Port is the TCP port of the display. If not set, libvirt picks a free
+	// port from 5900 up each time the VM starts; 'foundry vm display' shows it.
+	// +optional
+	// +kubebuilder:validation:Minimum=5900
+	// +kubebuilder:validation:Maximum=65535
+	Port int `json:"port,omitempty" yaml:"port,omitempty"`
+
+	// Password is required from clients to connect. It is stored in plain
+	// text in the domain definition. VNC passwords are limited to 8
+	// characters.
+	// +optional
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+}
+
+// HostDeviceSpec defines a host device passed through to the VM. Exactly one
+// of PCIAddress and MdevUUID is set.
+//
+// +k8s:deepcopy-gen=true
+type HostDeviceSpec struct {
+	// PCIAddress is the host address of a PCI device, e.g. "0000:01:00.0".
+	// libvirt detaches it from its host driver while the VM runs (managed
+	// mode), so every device in its IOMMU group must be free to detach
+	// ('foundry doctor --passthrough' checks this).
+	// +optional
+	PCIAddress string `json:"pciAddress,omitempty" yaml:"pciAddress,omitempty"`
+
+	// MdevUUID is the UUID of a mediated device created on the host, e.g. a
+	// vGPU slice.
+	// +optional
+	MdevUUID string `json:"mdevUUID,omitempty" yaml:"mdevUUID,omitempty"`
 }
 
 // VirtualMachineStatus defines the observed state of a VirtualMachine.
@@ -323,17 +919,66 @@ func (in *VirtualMachineSpec) DeepCopy() *VirtualMachineSpec {
 		}
 	}
 
+	// Deep copy NetworkDefaults
+	if in.NetworkDefaults != nil {
+		out.NetworkDefaults = in.NetworkDefaults.DeepCopy()
+	}
+
 	// Deep copy CloudInit
 	if in.CloudInit != nil {
 		out.CloudInit = in.CloudInit.DeepCopy()
 	}
 
+	// Deep copy SecureBoot pointer
+	if in.SecureBoot != nil {
+		secureBoot := *in.SecureBoot
+		out.SecureBoot = &secureBoot
+	}
+
 	// Deep copy Autostart pointer
 	if in.Autostart != nil {
 		autostart := *in.Autostart
 		out.Autostart = &autostart
 	}
 
+	// Deep copy Discard pointer
+	if in.Discard != nil {
+		discard := *in.Discard
+		out.Discard = &discard
+	}
+
+	// Deep copy GuestAgent pointer
+	if in.GuestAgent != nil {
+		guestAgent := *in.GuestAgent
+		out.GuestAgent = &guestAgent
+	}
+
+	// Deep copy StartupDelay pointer
+	if in.StartupDelay != nil {
+		out.StartupDelay = in.StartupDelay.DeepCopy()
+	}
+
+	// Deep copy TTL pointer
+	if in.TTL != nil {
+		out.TTL = in.TTL.DeepCopy()
+	}
+
+	// Deep copy SMBIOS
+	if in.SMBIOS != nil {
+		out.SMBIOS = in.SMBIOS.DeepCopy()
+	}
+
+	// Deep copy Graphics
+	if in.Graphics != nil {
+		out.Graphics = in.Graphics.DeepCopy()
+	}
+
+	// Deep copy HostDevices slice
+	if in.HostDevices != nil {
+		out.HostDevices = make([]HostDeviceSpec, len(in.HostDevices))
+		copy(out.HostDevices, in.HostDevices)
+	}
+
 	return out
 }
 
@@ -344,6 +989,7 @@ func (in *BootDiskSpec) DeepCopy() *BootDiskSpec {
 	}
 	out := new(BootDiskSpec)
 	*out = *in
+	out.DiskTuningSpec = *in.DiskTuningSpec.DeepCopy()
 	return out
 }
 
@@ -354,6 +1000,25 @@ func (in *DataDiskSpec) DeepCopy() *DataDiskSpec {
 	}
 	out := new(DataDiskSpec)
 	*out = *in
+	out.DiskTuningSpec = *in.DiskTuningSpec.DeepCopy()
+	return out
+}
+
+// DeepCopy creates a deep copy of DiskTuningSpec.
+func (in *DiskTuningSpec) DeepCopy() *DiskTuningSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DiskTuningSpec)
+	*out = *in
+	if in.Discard != nil {
+		discard := *in.Discard
+		out.Discard = &discard
+	}
+	if in.IOTune != nil {
+		ioTune := *in.IOTune
+		out.IOTune = &ioTune
+	}
 	return out
 }
 
@@ -371,6 +1036,72 @@ func (in *NetworkInterfaceSpec) DeepCopy() *NetworkInterfaceSpec {
 		copy(out.DNSServers, in.DNSServers)
 	}
 
+	// Deep copy SearchDomains and Routes slices
+	if in.SearchDomains != nil {
+		out.SearchDomains = make([]string, len(in.SearchDomains))
+		copy(out.SearchDomains, in.SearchDomains)
+	}
+	if in.Routes != nil {
+		out.Routes = make([]RouteSpec, len(in.Routes))
+		copy(out.Routes, in.Routes)
+	}
+
+	// Deep copy Macvtap and SRIOV
+	if in.Macvtap != nil {
+		macvtap := *in.Macvtap
+		out.Macvtap = &macvtap
+	}
+	if in.SRIOV != nil {
+		sriov := *in.SRIOV
+		out.SRIOV = &sriov
+	}
+
+	// Deep copy Bandwidth
+	if in.Bandwidth != nil {
+		out.Bandwidth = in.Bandwidth.DeepCopy()
+	}
+
+	return out
+}
+
+// DeepCopy creates a deep copy of BandwidthSpec.
+func (in *BandwidthSpec) DeepCopy() *BandwidthSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(BandwidthSpec)
+	*out = *in
+	if in.Inbound != nil {
+		inbound := *in.Inbound
+		out.Inbound = &inbound
+	}
+	if in.Outbound != nil {
+		outbound := *in.Outbound
+		out.Outbound = &outbound
+	}
+	return out
+}
+
+// DeepCopy creates a deep copy of NetworkDefaultsSpec.
+func (in *NetworkDefaultsSpec) DeepCopy() *NetworkDefaultsSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkDefaultsSpec)
+	*out = *in
+
+	// Deep copy DNSServers slice
+	if in.DNSServers != nil {
+		out.DNSServers = make([]string, len(in.DNSServers))
+		copy(out.DNSServers, in.DNSServers)
+	}
+
+	// Deep copy SearchDomains slice
+	if in.SearchDomains != nil {
+		out.SearchDomains = make([]string, len(in.SearchDomains))
+		copy(out.SearchDomains, in.SearchDomains)
+	}
+
 	return out
 }
 
@@ -391,6 +1122,43 @@ func (in *CloudInitSpec) DeepCopy() *CloudInitSpec {
 	return out
 }
 
+// DeepCopy creates a deep copy of SMBIOSSpec.
+func (in *SMBIOSSpec) DeepCopy() *SMBIOSSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SMBIOSSpec)
+	*out = *in
+
+	// Deep copy OEMStrings slice
+	if in.OEMStrings != nil {
+		out.OEMStrings = make([]string, len(in.OEMStrings))
+		copy(out.OEMStrings, in.OEMStrings)
+	}
+
+	return out
+}
+
+// DeepCopy creates a deep copy of GraphicsSpec.
+func (in *GraphicsSpec) DeepCopy() *GraphicsSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(GraphicsSpec)
+	*out = *in
+	return out
+}
+
+// DeepCopy creates a deep copy of HostDeviceSpec.
+func (in *HostDeviceSpec) DeepCopy() *HostDeviceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(HostDeviceSpec)
+	*out = *in
+	return out
+}
+
 // DeepCopy creates a deep copy of VirtualMachineStatus.
 func (in *VirtualMachineStatus) DeepCopy() *VirtualMachineStatus {
 	if in == nil {
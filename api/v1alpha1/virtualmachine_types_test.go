@@ -160,7 +160,9 @@ func TestVirtualMachineSpec_DeepCopy(t *testing.T) {
 		CloudInit: &CloudInitSpec{
 			FQDN: "test.example.com",
 		},
-		Autostart: &autostart,
+		Autostart:    &autostart,
+		Discard:      boolPtr(true),
+		StartupDelay: &Duration{Duration: 30 * time.Second},
 	}
 
 	copy := spec.DeepCopy()
@@ -189,6 +191,16 @@ func TestVirtualMachineSpec_DeepCopy(t *testing.T) {
 	if *spec.Autostart == false {
 		t.Error("Modifying copy.Autostart affected original")
 	}
+
+	*copy.Discard = false
+	if !*spec.Discard {
+		t.Error("Modifying copy.Discard affected original")
+	}
+
+	copy.StartupDelay.Duration = time.Minute
+	if spec.StartupDelay.Duration != 30*time.Second {
+		t.Error("Modifying copy.StartupDelay affected original")
+	}
 }
 
 func TestVirtualMachineSpec_DeepCopy_NilPointers(t *testing.T) {
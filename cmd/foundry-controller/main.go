@@ -0,0 +1,146 @@
+// Command foundry-controller reconciles VirtualMachine custom resources in a
+// Kubernetes cluster against the libvirt host it runs on.
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	"github.com/jbweber/foundry/internal/controller"
+	"github.com/jbweber/foundry/internal/hostconfig"
+	"github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+)
+
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+var rootCmd = &cobra.Command{
+	Use:   "foundry-controller",
+	Short: "Reconcile VirtualMachine resources against the local libvirt host",
+	Long: `foundry-controller watches VirtualMachine resources (foundry.cofront.xyz/v1alpha1)
+in a Kubernetes cluster and manages their VMs on the libvirt host it runs on.
+
+Run one controller per hypervisor, e.g. as a DaemonSet with access to the
+libvirt socket. Each controller handles the resources labelled with its --host
+(default: the host name):
+
+  metadata:
+    labels:
+      foundry.cofront.xyz/host: hv1
+
+A resource maps to the libvirt VM of the same name, so names must be unique
+per host across namespaces. For each resource the controller:
+  - creates the VM if it is missing and applies spec changes like
+    'foundry apply'
+  - recreates missing volumes of a shut off VM and starts it if autostart is
+    enabled, like 'foundry serve --watch-dir'
+  - writes the VM's phase, conditions and addresses to the status subresource
+  - destroys the VM and its storage when the resource is deleted
+
+A VM that exists but was not created for the resource is never changed or
+destroyed; the resource is marked Failed instead.
+
+The cluster is reached with the in-cluster service account or $KUBECONFIG.
+Storage pools, the connection URI and the other host defaults are read from
+/etc/foundry/config.yaml, or the file given with --config, as by foundry.`,
+	Version: fmt.Sprintf("%s (commit: %s)", version, commit),
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		connectURI, _ := cmd.Flags().GetString("connect")
+		configPath, _ := cmd.Flags().GetString("config")
+		host, _ := cmd.Flags().GetString("host")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		resync, _ := cmd.Flags().GetDuration("resync-interval")
+		metricsAddr, _ := cmd.Flags().GetString("metrics-bind-address")
+		probeAddr, _ := cmd.Flags().GetString("health-probe-bind-address")
+		logLevel, _ := cmd.Flags().GetString("log-level")
+		logFormat, _ := cmd.Flags().GetString("log-format")
+
+		logger, err := logging.New(os.Stderr, logLevel, logFormat)
+		if err != nil {
+			return err
+		}
+		slog.SetDefault(logger)
+
+		if connectURI != "" {
+			libvirt.SetDefaultURI(connectURI)
+		}
+		var hostConfig *hostconfig.Config
+		if configPath != "" {
+			hostConfig, err = hostconfig.Load(configPath)
+		} else {
+			hostConfig, err = hostconfig.LoadDefault()
+		}
+		if err != nil {
+			return err
+		}
+		hostConfig.Apply()
+		if host == "" {
+			if host, err = os.Hostname(); err != nil {
+				return fmt.Errorf("failed to determine host name (set --host): %w", err)
+			}
+		}
+
+		ctrl.SetLogger(logr.FromSlogHandler(logger.Handler()))
+
+		config, err := ctrl.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load Kubernetes config: %w", err)
+		}
+
+		opts := ctrl.Options{
+			Metrics:                metricsserver.Options{BindAddress: metricsAddr},
+			HealthProbeBindAddress: probeAddr,
+		}
+		if namespace != "" {
+			opts.Cache = cache.Options{DefaultNamespaces: map[string]cache.Config{namespace: {}}}
+		}
+		mgr, err := ctrl.NewManager(config, opts)
+		if err != nil {
+			return fmt.Errorf("failed to create manager: %w", err)
+		}
+
+		if err := controller.NewReconciler(mgr.GetClient(), host, resync).SetupWithManager(mgr); err != nil {
+			return fmt.Errorf("failed to set up controller: %w", err)
+		}
+		if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+			return fmt.Errorf("failed to add health check: %w", err)
+		}
+		if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+			return fmt.Errorf("failed to add ready check: %w", err)
+		}
+
+		fmt.Printf("Reconciling VirtualMachines labelled %s=%s\n", controller.HostLabel, host)
+		return mgr.Start(logging.NewContext(ctrl.SetupSignalHandler(), logger))
+	},
+}
+
+func init() {
+	rootCmd.Flags().StringP("connect", "c", "", "Libvirt connection URI (default $FOUNDRY_CONNECT or qemu:///system)")
+	rootCmd.Flags().String("config", "", "Host config file (default "+hostconfig.DefaultPath+")")
+	rootCmd.Flags().String("host", "", "Reconcile resources whose "+controller.HostLabel+" label has this value (default: host name)")
+	rootCmd.Flags().String("namespace", "", "Only watch resources in this namespace (default: all namespaces)")
+	rootCmd.Flags().Duration("resync-interval", controller.DefaultResyncInterval, "How often each resource is reconciled when nothing changed")
+	rootCmd.Flags().String("metrics-bind-address", "0", "Address of the metrics endpoint (0 disables it)")
+	rootCmd.Flags().String("health-probe-bind-address", ":8081", "Address of the /healthz and /readyz endpoints")
+	rootCmd.Flags().String("log-level", "info", "Minimum level of log records (debug, info, warn or error)")
+	rootCmd.Flags().String("log-format", logging.FormatText, "Log record format (text or json)")
+}
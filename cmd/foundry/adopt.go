@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+var adoptCmd = &cobra.Command{
+	Use:   "adopt <domain-name>",
+	Short: "Bring an existing libvirt domain under foundry's management",
+	Long: `Adopt a shut off libvirt domain that was not created by foundry, so that
+foundry commands can manage it from now on.
+
+A spec is reverse-engineered from the domain's XML on a best-effort basis:
+vCPUs, memory, firmware, machine type, CPU mode, the virtio disks and the
+bridge and network interfaces. Interfaces keep their MAC addresses and are
+described as DHCP interfaces. The boot disk is the disk that boots first;
+data disks are named vdb, vdc, ... in order.
+
+The disks are copied into volumes named the foundry way (<vm>_boot.qcow2,
+<vm>_data-<device>.qcow2) in the storage pool, and the domain is redefined to
+use them. The rest of the domain XML, such as CD-ROMs, other interfaces and
+graphics, is kept but not managed; it is listed as warnings. The original
+volumes are kept unless --delete-source is given.
+
+The domain's disks must be volumes of a storage pool; add their directory with
+'foundry pool add' first if needed. Review the adopted spec with
+'foundry get <vm> --export'.
+
+Examples:
+  foundry adopt legacy-db
+  foundry adopt legacy-db --storage-pool fast --delete-source`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		pool, _ := cmd.Flags().GetString("storage-pool")
+		deleteSource, _ := cmd.Flags().GetBool("delete-source")
+
+		fmt.Printf("Adopting domain %s...\n", name)
+
+		opts := vm.AdoptOptions{StoragePool: pool, DeleteSources: deleteSource}
+		result, err := vm.Adopt(cmd.Context(), name, opts)
+		if err != nil {
+			return fmt.Errorf("failed to adopt domain: %w", err)
+		}
+
+		for _, disk := range result.Disks {
+			if disk.Copied {
+				fmt.Printf("  %s: %s copied to %s\n", disk.Device, disk.Source, disk.Volume)
+			} else {
+				fmt.Printf("  %s: %s\n", disk.Device, disk.Volume)
+			}
+		}
+		for _, warning := range result.Warnings {
+			fmt.Printf("  Warning: %s\n", warning)
+		}
+
+		fmt.Printf("✓ Domain %s adopted\n", name)
+		fmt.Printf("  Review its spec with 'foundry get %s --export'.\n", name)
+		return nil
+	},
+}
+
+func init() {
+	adoptCmd.Flags().String("storage-pool", "", "Storage pool to copy the disks into (default foundry-vms)")
+	adoptCmd.Flags().Bool("delete-source", false, "Delete the original volumes once they have been copied")
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// commandAliases maps alternate command paths, for habits carried over from
+// docker and kubectl, to the canonical commands they run. Each alias is a
+// real command, so it is listed in help and shell completions; it shares the
+// flags of its target.
+var commandAliases = []struct {
+	alias  string
+	target string
+}{
+	{"ps", "list"},
+	{"rm", "destroy"},
+	{"images", "image list"},
+	{"pools", "pool list"},
+
+	// Verbs on the commands that manage one kind of object
+	{"image ls", "image list"},
+	{"image rm", "image delete"},
+	{"pool ls", "pool list"},
+	{"pool rm", "pool delete"},
+	{"snapshot ls", "snapshot list"},
+	{"snapshot rm", "snapshot delete"},
+	{"context ls", "context list"},
+	{"context rm", "context delete"},
+
+	// Noun-verb forms of the VM commands
+	{"vm list", "list"},
+	{"vm ls", "list"},
+	{"vm get", "get"},
+	{"vm create", "create"},
+	{"vm apply", "apply"},
+	{"vm clone", "clone"},
+	{"vm adopt", "adopt"},
+	{"vm migrate", "migrate"},
+	{"vm destroy", "destroy"},
+	{"vm rm", "destroy"},
+	{"vm console", "console"},
+	{"vm ssh", "ssh"},
+}
+
+// registerAliases adds the commands of commandAliases to root. It must run
+// after every command is registered; it panics on an alias that does not
+// resolve, like cobra does for invalid command definitions.
+func registerAliases(root *cobra.Command) {
+	for _, a := range commandAliases {
+		target := findCommand(root, strings.Fields(a.target))
+		if target == nil {
+			panic(fmt.Sprintf("alias %q: command %q not found", a.alias, a.target))
+		}
+
+		path := strings.Fields(a.alias)
+		parent := findCommand(root, path[:len(path)-1])
+		name := path[len(path)-1]
+		if parent == nil {
+			panic(fmt.Sprintf("alias %q: command %q not found", a.alias, strings.Join(path[:len(path)-1], " ")))
+		}
+		if findCommand(parent, []string{name}) != nil {
+			panic(fmt.Sprintf("alias %q: command already exists", a.alias))
+		}
+
+		parent.AddCommand(aliasCommand(name, target))
+	}
+}
+
+// aliasCommand returns a command named name that runs target.
+func aliasCommand(name string, target *cobra.Command) *cobra.Command {
+	short := fmt.Sprintf("Alias for '%s'", target.CommandPath())
+	long := short + "."
+	if target.Long != "" {
+		long += "\n\n" + target.Long
+	}
+
+	alias := &cobra.Command{
+		Use:               name + strings.TrimPrefix(target.Use, target.Name()),
+		Short:             short,
+		Long:              long,
+		Args:              target.Args,
+		ValidArgs:         target.ValidArgs,
+		ValidArgsFunction: target.ValidArgsFunction,
+		PreRunE:           target.PreRunE,
+		RunE:              target.RunE,
+	}
+	// The flags are shared, so completions registered for them carry over
+	alias.Flags().AddFlagSet(target.Flags())
+	return alias
+}
+
+// findCommand returns the subcommand of cmd at path, matching names exactly.
+func findCommand(cmd *cobra.Command, path []string) *cobra.Command {
+	for _, name := range path {
+		var next *cobra.Command
+		for _, sub := range cmd.Commands() {
+			if sub.Name() == name {
+				next = sub
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		cmd = next
+	}
+	return cmd
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+var annotateCmd = &cobra.Command{
+	Use:   "annotate <vm-name> key=value... | key-...",
+	Short: "Set or remove annotations on a VM",
+	Long: `Record ownership and notes on a VM as annotations in its stored metadata.
+
+key=value sets an annotation, key- removes it. "owner", "note" and
+"shutdown-timeout" are short for the standard foundry.cofront.xyz/owner,
+foundry.cofront.xyz/note and foundry.cofront.xyz/shutdown-timeout keys; any
+other key (optionally with a DNS prefix, e.g. example.com/team) is stored as
+given. shutdown-timeout overrides how long 'foundry shutdown-all' waits for the
+VM (e.g. 300s).
+
+Annotations are shown by 'foundry get -o yaml' and in the OWNER column of
+'foundry list -o wide', and can be filtered on with 'foundry list --owner' and
+'foundry list --annotation'. They are kept when the VM is re-applied from a
+config file that does not set them.
+
+Examples:
+  foundry annotate my-vm owner=jane note="temp for testing"
+  foundry annotate my-vm ticket=OPS-123
+  foundry annotate db-1 shutdown-timeout=300s
+  foundry annotate my-vm note-`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+
+		set, remove, err := vm.ParseAnnotations(args[1:])
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		vmObj, err := vm.Annotate(ctx, vmName, set, remove)
+		if err != nil {
+			return fmt.Errorf("failed to annotate VM: %w", err)
+		}
+
+		fmt.Printf("✓ VM %s annotated\n", vmName)
+		keys := make([]string, 0, len(vmObj.Annotations))
+		for key := range vmObj.Annotations {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("  %s=%s\n", key, vmObj.Annotations[key])
+		}
+		return nil
+	},
+}
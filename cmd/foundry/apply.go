@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/loader"
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply <config.yaml|dir>",
+	Short: "Create or update VMs from a configuration file or directory",
+	Long: `Create a VM from a configuration file, or update an existing one to match it.
+
+If the VM already exists, its desired spec is compared with the spec stored
+when it was created (or last applied) and these changes are applied in place:
+- vCPUs and memory (live when lowering, otherwise on the next restart)
+- adding and removing data disks (removed disks' volumes are deleted)
+- autostart
+- discard (on the next restart)
+
+Changes to the boot disk, network interfaces, cloud-init, CPU mode or storage
+pool cannot be applied to an existing VM and are rejected without changing
+anything; destroy and recreate the VM instead.
+
+Like 'foundry create', apply accepts a file with several "---" separated VMs
+or a directory of *.yaml and *.yml files. Each VM is applied in turn, failures
+do not stop the others, and a summary is printed at the end. Like create, it
+renders the files as templates with --values and --set.
+
+--print-xml prints the domain XML apply would submit to libvirt, without
+changing anything: the definition of a new VM, or the redefinition of an
+existing one (keeping its UUID, MAC addresses and metadata). It takes a
+single VM.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configPath := args[0]
+
+		docs, err := loadConfigs(cmd, configPath)
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+
+		printXML, _ := cmd.Flags().GetBool("print-xml")
+		if printXML && len(docs) != 1 {
+			return fmt.Errorf("--print-xml takes a single VM, found %d", len(docs))
+		}
+
+		if len(docs) == 1 {
+			if docs[0].Err != nil {
+				return fmt.Errorf("failed to load configuration: %w", docs[0].Err)
+			}
+			if printXML {
+				return printApplyXML(cmd, docs[0].VM)
+			}
+			return applyVM(cmd, docs[0].VM, configPath)
+		}
+		return runBatch("Applied", docs, func(doc loader.Document) error {
+			return applyVM(cmd, doc.VM, doc.Source)
+		})
+	},
+}
+
+// applyVM creates or updates the VM in config and prints what changed.
+func applyVM(cmd *cobra.Command, config *v1alpha1.VirtualMachine, source string) error {
+	if err := addMyKey(cmd, config); err != nil {
+		return err
+	}
+	if err := addNetworkDefaults(config); err != nil {
+		return err
+	}
+	if err := confirmWarnings(cmd, config); err != nil {
+		return err
+	}
+
+	fmt.Printf("Applying config: %s\n", source)
+
+	ctx := cmd.Context()
+	result, err := vm.ApplyFromConfig(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to apply config: %w", err)
+	}
+
+	switch {
+	case result.Created:
+		fmt.Printf("✓ VM %s created\n", result.VMName)
+	case len(result.Changes) == 0:
+		fmt.Printf("✓ VM %s unchanged\n", result.VMName)
+	default:
+		for _, change := range result.Changes {
+			fmt.Printf("  %s\n", change)
+		}
+		fmt.Printf("✓ VM %s updated (generation %d)\n", result.VMName, result.Generation)
+		if result.RestartRequired {
+			fmt.Println("  Some changes take effect after the VM is restarted")
+		}
+	}
+	return nil
+}
+
+// printApplyXML prints the domain XML applying config would submit.
+func printApplyXML(cmd *cobra.Command, config *v1alpha1.VirtualMachine) error {
+	if err := addMyKey(cmd, config); err != nil {
+		return err
+	}
+	if err := addNetworkDefaults(config); err != nil {
+		return err
+	}
+
+	domainXML, err := vm.ApplyXML(cmd.Context(), config)
+	if err != nil {
+		return fmt.Errorf("failed to generate domain XML: %w", err)
+	}
+	fmt.Println(strings.TrimRight(domainXML, "\n"))
+	return nil
+}
+
+func init() {
+	applyCmd.Flags().BoolP("yes", "y", false, "Continue without asking when the configuration has warnings")
+	applyCmd.Flags().Bool("print-xml", false, "Print the domain XML that would be submitted without changing anything")
+	applyCmd.Flags().Bool("with-my-key", false, "Authorize your default SSH public key (~/.ssh/id_*.pub) in the VM")
+	addValuesFlags(applyCmd)
+}
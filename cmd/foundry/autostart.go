@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/systemd"
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+var autostartCmd = &cobra.Command{
+	Use:   "autostart",
+	Short: "Start autostart VMs in their startup order",
+	Long: `Start the autostart VMs that have a spec.startupOrder, lowest order first.
+
+VMs with the same order are started together. Before the next order is started,
+foundry waits for the longest spec.startupDelay among the VMs it just started,
+e.g. to give a database time to come up before the applications using it:
+
+  spec:
+    startupOrder: 10
+    startupDelay: 30s
+
+libvirt does not autostart VMs with a startup order, since it cannot start them
+in order; VMs without one are still autostarted by libvirt as soon as it starts.
+VMs that are already running are left alone.
+
+--install-unit writes a systemd unit that runs this command when the host
+boots, after libvirt is started, so the order is kept even when 'foundry
+serve' is not running:
+
+  foundry autostart --install-unit
+  systemctl daemon-reload
+  systemctl enable foundry-autostart`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if installUnit, _ := cmd.Flags().GetBool("install-unit"); installUnit {
+			unitPath, _ := cmd.Flags().GetString("unit-path")
+			return installAutostartUnit(unitPath)
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		results, err := vm.StartOrdered(ctx)
+		for _, r := range results {
+			switch {
+			case r.Err != nil:
+				fmt.Printf("✗ VM %s: %v\n", r.Name, r.Err)
+			case r.Started:
+				fmt.Printf("✓ VM %s started (order %d)\n", r.Name, r.Order)
+			default:
+				fmt.Printf("VM %s already running (order %d)\n", r.Name, r.Order)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to start VMs: %w", err)
+		}
+		if len(results) == 0 {
+			fmt.Println("No autostart VMs with a startup order")
+		}
+		return nil
+	},
+}
+
+func init() {
+	autostartCmd.Flags().Bool("install-unit", false, "Write a systemd unit running this command at host boot and exit")
+	autostartCmd.Flags().String("unit-path", systemd.DefaultAutostartUnitPath, "Where --install-unit writes the unit (- for stdout)")
+}
+
+// installAutostartUnit writes a systemd unit running "foundry autostart" when
+// the host boots.
+func installAutostartUnit(unitPath string) error {
+	execPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to determine foundry binary path: %w", err)
+	}
+
+	unitArgs := []string{"autostart"}
+	if connectURI != "" {
+		unitArgs = append(unitArgs, "--connect", connectURI)
+	}
+
+	unit, err := systemd.GenerateAutostartUnit(systemd.AutostartUnitOptions{
+		ExecPath: execPath,
+		Args:     unitArgs,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate unit: %w", err)
+	}
+
+	if unitPath == "-" {
+		fmt.Print(unit)
+		return nil
+	}
+
+	if err := systemd.InstallUnit(unitPath, unit); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Installed %s\n", unitPath)
+	fmt.Println("\nTo start VMs in their startup order when the host boots:")
+	fmt.Println("  systemctl daemon-reload")
+	fmt.Println("  systemctl enable foundry-autostart")
+	return nil
+}
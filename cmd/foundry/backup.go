@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/backup"
+	"github.com/jbweber/foundry/internal/output"
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+// Backup management commands
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Back up and restore VMs",
+	Long: `Back up VMs into a directory, list their backups and restore them.
+
+A backup holds the VM's spec (vm.yaml), its libvirt domain XML (domain.xml)
+and a copy of each of its volumes: the boot disk, data disks and cloud-init
+ISO, flattened so they do not need the base image. Backups are kept in
+<dir>/<vm>/<id>, where the ID is the UTC time the backup was taken.
+
+The first backup of a VM is full; the next ones are incremental and only
+store the 4 MiB blocks of each disk image that changed since the previous
+backup. Every --full-every backups a new full backup starts a new chain.
+Restoring an incremental backup reads its chain back to the full backup.
+
+The directory comes from --dir, or defaults.backupDir in the CLI config.
+
+Running VMs are backed up without stopping them: their disks are switched to
+temporary overlays with an external snapshot (quiesced through the guest
+agent when the VM has one), the frozen volumes are copied, and the overlays
+are committed back. VMs annotated with foundry.cofront.xyz/backup=true are
+also backed up periodically by 'foundry serve --backup-dir'.`,
+}
+
+func init() {
+	backupCmd.AddCommand(backupCreateCmd)
+	backupCmd.AddCommand(backupListCmd)
+	backupCmd.AddCommand(backupRestoreCmd)
+
+	backupCmd.PersistentFlags().String("dir", "", "Directory holding the backups (default defaults.backupDir from the CLI config)")
+
+	backupCreateCmd.Flags().Bool("full", false, "Take a full backup even if an incremental one is possible")
+	backupCreateCmd.Flags().Int("full-every", 7, "Start a new chain with a full backup once a chain has this many backups (0 never)")
+	backupCreateCmd.Flags().Int("keep", 0, "Delete all but the newest N backups and the backups they need (0 keeps all)")
+
+	backupRestoreCmd.Flags().String("id", "", "ID of the backup to restore (default the latest)")
+	backupRestoreCmd.Flags().Bool("start", false, "Start the VM once restored")
+}
+
+// backupDir returns the backup directory from --dir or the CLI config.
+func backupDir(cmd *cobra.Command) (string, error) {
+	dir, _ := cmd.Flags().GetString("dir")
+	if dir != "" {
+		return dir, nil
+	}
+	cfg, _, err := loadClientConfig()
+	if err != nil {
+		return "", err
+	}
+	if cfg.Defaults.BackupDir == "" {
+		return "", fmt.Errorf("no backup directory: use --dir or set defaults.backupDir in the CLI config")
+	}
+	return cfg.Defaults.BackupDir, nil
+}
+
+var backupCreateCmd = &cobra.Command{
+	Use:   "create <vm-name>",
+	Short: "Back up a VM",
+	Long: `Back up a VM, running or not.
+
+The backup is incremental on top of the VM's latest backup, unless --full is
+given, the VM has no backup yet or the latest chain has --full-every backups.
+With --keep, older backups are then deleted, except those the newest N need
+to be restored.
+
+Examples:
+  foundry backup create my-vm --dir /backup
+  foundry backup create my-vm --full
+  foundry backup create my-vm --keep 14 --full-every 7`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		dir, err := backupDir(cmd)
+		if err != nil {
+			return err
+		}
+		opts := vm.BackupOptions{Dir: dir}
+		opts.Full, _ = cmd.Flags().GetBool("full")
+		opts.FullEvery, _ = cmd.Flags().GetInt("full-every")
+		opts.Keep, _ = cmd.Flags().GetInt("keep")
+
+		// Ctrl+C stops the copy; the disks of a running VM are still thawed
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+
+		fmt.Printf("Backing up VM %s to %s...\n", vmName, dir)
+		result, err := vm.BackupVM(ctx, vmName, opts)
+		if err != nil {
+			return fmt.Errorf("failed to back up VM: %w", err)
+		}
+
+		m := result.Manifest
+		for _, disk := range m.Disks {
+			fmt.Printf("  %-40s %10.1f MiB (%.1f MiB stored)\n", disk.Volume, mib(disk.Size), mib(disk.Stored))
+		}
+		fmt.Printf("✓ %s backup %s of VM %s created\n", m.Kind, m.ID, vmName)
+		for _, id := range result.Pruned {
+			fmt.Printf("  Deleted old backup %s\n", id)
+		}
+		return nil
+	},
+}
+
+var backupListCmd = &cobra.Command{
+	Use:   "list [vm-name]",
+	Short: "List backups",
+	Long: `List the backups of a VM, or of every VM, oldest first.
+
+Shows each backup's ID, kind (full or incremental), parent, creation time,
+the size of its disk images and how much of them it stores.
+
+Examples:
+  foundry backup list
+  foundry backup list my-vm -o json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Create printer (validates the format before reading anything)
+		printer, err := newOutputPrinter()
+		if err != nil {
+			return err
+		}
+
+		dir, err := backupDir(cmd)
+		if err != nil {
+			return err
+		}
+		repo := backup.NewRepository(dir)
+
+		vmNames := args
+		if len(vmNames) == 0 {
+			if vmNames, err = repo.VMs(); err != nil {
+				return err
+			}
+		}
+		manifests := []backup.Manifest{}
+		for _, name := range vmNames {
+			list, err := repo.List(name)
+			if err != nil {
+				return err
+			}
+			manifests = append(manifests, list...)
+		}
+
+		if !printer.Tabular() {
+			return printList(printer, manifests)
+		}
+		if len(manifests) == 0 {
+			fmt.Println("No backups found")
+			return nil
+		}
+
+		table := &output.Table{
+			Columns: []output.Column{
+				{Name: "VM"}, {Name: "ID"}, {Name: "KIND"}, {Name: "PARENT"},
+				{Name: "CREATED"}, {Name: "SIZE"}, {Name: "STORED"},
+			},
+			Footer: []string{fmt.Sprintf("Total: %d backup(s)", len(manifests))},
+		}
+		for _, m := range manifests {
+			var size int64
+			for _, disk := range m.Disks {
+				size += disk.Size
+			}
+			table.Rows = append(table.Rows, []string{
+				m.VM, m.ID, string(m.Kind), m.Parent,
+				m.Created.Local().Format("2006-01-02 15:04:05"),
+				fmt.Sprintf("%.1f MiB", mib(size)),
+				fmt.Sprintf("%.1f MiB", mib(m.StoredSize())),
+			})
+		}
+		fmt.Print(printer.FormatTable(table))
+		return nil
+	},
+}
+
+var backupRestoreCmd = &cobra.Command{
+	Use:   "restore <vm-name>",
+	Short: "Restore a VM from a backup",
+	Long: `Recreate a VM from its latest backup, or the backup given with --id.
+
+The VM's volumes are created and filled with the backed up disk images, and
+the domain is defined from the backed up domain XML with the backed up spec.
+The VM must not exist: destroy it first to roll it back.
+
+Examples:
+  foundry backup restore my-vm
+  foundry backup restore my-vm --id 20261017-020000 --start`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		dir, err := backupDir(cmd)
+		if err != nil {
+			return err
+		}
+		opts := vm.RestoreOptions{Dir: dir}
+		opts.ID, _ = cmd.Flags().GetString("id")
+		opts.Start, _ = cmd.Flags().GetBool("start")
+
+		fmt.Printf("Restoring VM %s from %s...\n", vmName, dir)
+		m, err := vm.RestoreVM(cmd.Context(), vmName, opts)
+		if err != nil {
+			return fmt.Errorf("failed to restore VM: %w", err)
+		}
+
+		fmt.Printf("✓ VM %s restored from %s backup %s\n", vmName, m.Kind, m.ID)
+		return nil
+	},
+}
+
+// mib converts a size in bytes to MiB.
+func mib(size int64) float64 {
+	return float64(size) / (1024 * 1024)
+}
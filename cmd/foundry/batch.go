@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jbweber/foundry/internal/loader"
+)
+
+// runBatch runs fn for each VM configuration loaded from a multi-document
+// file or a directory. Failures do not stop the remaining configurations;
+// once all have run a summary is printed and an error listing the failed
+// documents is returned.
+func runBatch(verb string, docs []loader.Document, fn func(doc loader.Document) error) error {
+	var failed []string
+	for _, doc := range docs {
+		err := doc.Err
+		if err == nil {
+			err = fn(doc)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "✗ %s: %v\n", doc.Source, err)
+			failed = append(failed, doc.Source)
+		}
+	}
+
+	fmt.Printf("\n%s %d of %d VM(s)\n", verb, len(docs)-len(failed), len(docs))
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d configuration(s) failed:\n  %s", len(failed), len(docs), strings.Join(failed, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+var cloneCmd = &cobra.Command{
+	Use:   "clone <source-vm> <new-vm>",
+	Short: "Create a new VM from an existing VM's spec and disks",
+	Long: `Clone a shut off VM into a new VM with its own addresses.
+
+The new VM gets the source's stored spec and a copy of its disks. By default
+the clone's disks are qcow2 overlays backed by the source's disks, which is
+fast and saves space; the source must then stay shut off until the clone's
+disks are flattened with 'foundry disk flatten'. --full copies the disks
+instead, so the clone is independent of the source.
+
+MAC addresses are regenerated and the clone gets a new cloud-init instance-id
+(its name), so cloud-init applies the new hostname and network configuration on
+first boot. A hostname derived from the source's name is renamed.
+
+Static addresses cannot be shared with the source: give the clone new IPv4
+addresses with --ip (one per network interface, in order), or change any part
+of the spec with --patch. The patch is a partial VirtualMachine in YAML merged
+into the source's spec like a JSON merge patch: mappings are merged, lists
+replace the source's, and null removes a field. Disk sizes cannot be changed;
+grow them afterwards with 'foundry disk resize'.
+
+Examples:
+  foundry clone web-1 web-2 --ip 10.0.0.12/24
+  foundry clone web-1 web-2 --full --patch web-2-patch.yaml`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		source := args[0]
+		name := args[1]
+
+		full, _ := cmd.Flags().GetBool("full")
+		ips, _ := cmd.Flags().GetStringSlice("ip")
+		patchFile, _ := cmd.Flags().GetString("patch")
+
+		opts := vm.CloneOptions{Full: full, IPs: ips}
+		if patchFile != "" {
+			patch, err := os.ReadFile(patchFile)
+			if err != nil {
+				return fmt.Errorf("failed to read patch: %w", err)
+			}
+			opts.Patch = patch
+		}
+
+		fmt.Printf("Cloning VM %s to %s...\n", source, name)
+
+		ctx := cmd.Context()
+		result, err := vm.Clone(ctx, source, name, opts)
+		if err != nil {
+			return fmt.Errorf("failed to clone VM: %w", err)
+		}
+
+		fmt.Printf("✓ VM %s cloned to %s successfully!\n", source, result.VMName)
+		if !full {
+			fmt.Printf("  Keep %s shut off until the disks of %s are flattened ('foundry disk flatten').\n", source, result.VMName)
+		}
+		return nil
+	},
+}
+
+func init() {
+	cloneCmd.Flags().Bool("full", false, "Copy the source's disks instead of backing the clone's disks by them")
+	cloneCmd.Flags().StringSlice("ip", nil, "New IPv4 address (CIDR) of a network interface, in interface order (repeatable)")
+	cloneCmd.Flags().String("patch", "", "YAML file with a partial VirtualMachine merged into the clone's spec")
+}
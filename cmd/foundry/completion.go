@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/hostcache"
+	"github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// completionTimeout bounds how long a completion waits for the hypervisor,
+// so that an unreachable one does not hang the shell.
+const completionTimeout = 3 * time.Second
+
+func init() {
+	// Commands whose first argument is a VM
+	for _, cmd := range []*cobra.Command{
+		getCmd, destroyCmd, annotateCmd, cloneCmd, migrateCmd, consoleCmd, sshCmd,
+		backupCreateCmd, backupListCmd, benchDiskCmd, eventsCmd,
+		diskFlattenCmd, diskResizeCmd, diskAttachCmd, diskDetachCmd,
+		nicAttachCmd, nicDetachCmd,
+		snapshotCreateCmd, snapshotListCmd, snapshotRevertCmd, snapshotDeleteCmd,
+		vmFlattenCmd, vmExportCmd, vmDisplayCmd, vmXMLCmd, vmDisksCmd, vmSetResourcesCmd, vmResizeCmd, vmSetLimitsCmd,
+	} {
+		cmd.ValidArgsFunction = completeVMNames
+	}
+
+	for _, cmd := range []*cobra.Command{imageDeleteCmd, imageInfoCmd, imageCheckCmd} {
+		cmd.ValidArgsFunction = completeImageNames
+	}
+
+	for _, cmd := range []*cobra.Command{poolInfoCmd, poolVolumesCmd, poolRefreshCmd, poolDeleteCmd} {
+		cmd.ValidArgsFunction = completePoolNames
+	}
+	_ = adoptCmd.RegisterFlagCompletionFunc("storage-pool", completePoolFlag)
+	_ = doctorCmd.RegisterFlagCompletionFunc("pool", completePoolFlag)
+
+	for _, cmd := range []*cobra.Command{contextUseCmd, contextSetCmd, contextDeleteCmd, contextRefreshCmd} {
+		cmd.ValidArgsFunction = completeContextNames
+	}
+}
+
+// completeVMNames completes the first argument with the names of the VMs.
+func completeVMNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return completeFirstArg(cmd, args, toComplete, func(names *hostcache.Names) []string { return names.VMs })
+}
+
+// completeImageNames completes the first argument with the names of the base
+// images.
+func completeImageNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return completeFirstArg(cmd, args, toComplete, func(names *hostcache.Names) []string { return names.Images })
+}
+
+// completePoolNames completes the first argument with the names of the
+// storage pools.
+func completePoolNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return completeFirstArg(cmd, args, toComplete, func(names *hostcache.Names) []string { return names.Pools })
+}
+
+// completePoolFlag completes a flag value with the names of the storage
+// pools, whatever arguments precede it.
+func completePoolFlag(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return completePoolNames(cmd, nil, toComplete)
+}
+
+// completeContextNames completes the first argument with the names of the
+// contexts in the CLI config.
+func completeContextNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	cfg, _, err := loadClientConfig()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, c := range cfg.Contexts {
+		names = append(names, c.Name)
+	}
+	return filterPrefix(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeFirstArg completes the first argument with the names pick returns.
+// Later arguments are not completed.
+func completeFirstArg(cmd *cobra.Command, args []string, toComplete string, pick func(*hostcache.Names) []string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	names := completionNames(cmd)
+	if names == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return filterPrefix(pick(names), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// filterPrefix returns the names starting with prefix.
+func filterPrefix(names []string, prefix string) []string {
+	var matches []string
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
+
+// completionNames returns the names of the objects on the hypervisor this
+// invocation connects to. They are cached for hostcache.NamesTTL, so that
+// pressing tab repeatedly connects once. Returns nil if they cannot be
+// fetched; completion must never fail loudly.
+func completionNames(cmd *cobra.Command) *hostcache.Names {
+	// Completions run without the root command's PersistentPreRunE, and
+	// anything logged would garble the shell's output
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+	if err := configureConnection(); err != nil {
+		return nil
+	}
+	if err := configureHost(); err != nil {
+		return nil
+	}
+	uri := libvirt.DefaultURI()
+
+	dir, err := hostcache.DefaultDir()
+	if err == nil {
+		if names, err := hostcache.LoadNames(dir, uri); err == nil && names.Fresh(time.Now()) {
+			return names
+		}
+	}
+
+	names, err := fetchNames(cmd.Context(), uri)
+	if err != nil {
+		return nil
+	}
+	if dir != "" {
+		_ = hostcache.SaveNames(dir, names)
+	}
+	return names
+}
+
+// fetchNames lists the VMs, base images and storage pools of the hypervisor
+// at uri.
+func fetchNames(ctx context.Context, uri string) (*hostcache.Names, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, completionTimeout)
+	defer cancel()
+
+	client, err := libvirt.ConnectWithContext(ctx, uri, completionTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = client.Close() }()
+	lv := client.Libvirt()
+
+	names := &hostcache.Names{URI: uri, FetchedAt: time.Now().UTC()}
+
+	domains, _, err := lv.ConnectListAllDomains(1, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, domain := range domains {
+		names.VMs = append(names.VMs, domain.Name)
+	}
+	slices.Sort(names.VMs)
+
+	pools, _, err := lv.ConnectListAllStoragePools(1, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, pool := range pools {
+		names.Pools = append(names.Pools, pool.Name)
+	}
+	slices.Sort(names.Pools)
+
+	// A host without the images pool simply has no images to complete
+	names.Images, _ = storage.NewManager(lv).ImageNames(ctx)
+
+	return names, nil
+}
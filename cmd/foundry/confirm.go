@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/loader"
+)
+
+// confirmWarnings prints the configuration's warnings and asks whether to
+// continue. Without a terminal to ask on, it refuses unless --yes was given.
+func confirmWarnings(cmd *cobra.Command, config *v1alpha1.VirtualMachine) error {
+	warnings := loader.Warnings(config)
+	if len(warnings) == 0 {
+		return nil
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	if yes, _ := cmd.Flags().GetBool("yes"); yes {
+		return nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("configuration has warnings; re-run with --yes to continue anyway")
+	}
+
+	if !askYesNo("Continue anyway?") {
+		return fmt.Errorf("aborted")
+	}
+	return nil
+}
+
+// askYesNo asks question on the terminal and reports whether the answer was
+// yes.
+func askYesNo(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
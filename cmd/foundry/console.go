@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/jbweber/foundry/internal/libvirt"
+)
+
+var consoleCmd = &cobra.Command{
+	Use:   "console <vm-name>",
+	Short: "Attach to a VM's serial console",
+	Long: `Attach to the serial console of a running VM.
+
+The terminal is switched to raw mode so keystrokes, including Ctrl+C, are
+passed to the guest. Press the escape sequence (Ctrl+] by default) to detach;
+the VM keeps running.
+
+Only one session can be attached to a console at a time; --force disconnects
+an existing session. Consoles are opened through the local libvirt socket, so
+run this command on the hypervisor.
+
+Examples:
+  foundry console my-vm
+  foundry console my-vm --escape '^a'`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		force, _ := cmd.Flags().GetBool("force")
+		escapeFlag, _ := cmd.Flags().GetString("escape")
+
+		escape, err := parseEscape(escapeFlag)
+		if err != nil {
+			return err
+		}
+
+		console, err := libvirt.OpenConsole("", vmName, force, 0)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := console.Close(); closeErr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to close console: %v\n", closeErr)
+			}
+		}()
+
+		fmt.Printf("Connected to VM %s\n", vmName)
+		fmt.Printf("Escape character is %s\n", escapeFlag)
+
+		stdin := int(os.Stdin.Fd())
+		if term.IsTerminal(stdin) {
+			state, err := term.MakeRaw(stdin)
+			if err != nil {
+				return fmt.Errorf("failed to set terminal to raw mode: %w", err)
+			}
+			defer func() {
+				_ = term.Restore(stdin, state)
+				fmt.Println()
+			}()
+		}
+
+		if err := console.Attach(os.Stdin, os.Stdout, escape); err != nil {
+			return fmt.Errorf("console session failed: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	consoleCmd.Flags().Bool("force", false, "Disconnect any existing console session")
+	consoleCmd.Flags().String("escape", "^]", "Escape sequence to detach, as ^ followed by a character")
+}
+
+// parseEscape converts a caret notation escape sequence (e.g., "^]") to the
+// control character it produces.
+func parseEscape(s string) (byte, error) {
+	if len(s) != 2 || s[0] != '^' || s[1] < '@' || s[1] > '_' && (s[1] < 'a' || s[1] > 'z') {
+		return 0, fmt.Errorf("invalid escape sequence %q: must be ^ followed by a character such as ] or a", s)
+	}
+	return s[1] & 0x1f, nil
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/clientconfig"
+	"github.com/jbweber/foundry/internal/hostcache"
+	"github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/storage"
+	"github.com/jbweber/foundry/internal/timing"
+)
+
+// Context management commands
+var contextCmd = &cobra.Command{
+	Use:   "context",
+	Short: "Manage connection contexts",
+	Long: `Manage named contexts for the hypervisors foundry talks to.
+
+A context stores a libvirt connection URI and, for daemon mode, the API server
+URL and credentials (bearer token or client certificate). Contexts are kept in
+~/.config/foundry/config.yaml (override with FOUNDRY_CONFIG), which is only
+readable by its owner.
+
+The connection used by a command is chosen in this order:
+  1. --connect
+  2. --context
+  3. FOUNDRY_CONNECT
+  4. the current context (foundry context use)
+  5. the local hypervisor (qemu:///system)
+
+For contexts connecting to a remote hypervisor, foundry caches its host name,
+libvirt version, capabilities and storage pools in ~/.cache/foundry (override
+with FOUNDRY_CACHE_DIR) for an hour, or the context's --cache-ttl, so that
+commands don't rediscover them over the network each time. Run
+'foundry context refresh' after changing the hypervisor outside foundry.`,
+}
+
+func init() {
+	contextCmd.AddCommand(contextListCmd)
+	contextCmd.AddCommand(contextCurrentCmd)
+	contextCmd.AddCommand(contextUseCmd)
+	contextCmd.AddCommand(contextSetCmd)
+	contextCmd.AddCommand(contextDeleteCmd)
+	contextCmd.AddCommand(contextRefreshCmd)
+
+	contextSetCmd.Flags().String("connect", "", "Libvirt connection URI")
+	contextSetCmd.Flags().String("server", "", "Foundry API server URL")
+	contextSetCmd.Flags().String("token", "", "Bearer token for the API server")
+	contextSetCmd.Flags().String("token-file", "", "Read the bearer token from a file")
+	contextSetCmd.Flags().String("certificate-authority", "", "CA file for verifying the API server")
+	contextSetCmd.Flags().String("client-certificate", "", "Client certificate file for mTLS")
+	contextSetCmd.Flags().String("client-key", "", "Client key file for mTLS")
+	contextSetCmd.Flags().String("cache-ttl", "", "How long to cache hypervisor facts for remote connections, e.g. 30m (0 disables, default 1h)")
+}
+
+// loadClientConfig loads the CLI config file and returns it with its path.
+func loadClientConfig() (*clientconfig.Config, string, error) {
+	path, err := clientconfig.DefaultPath()
+	if err != nil {
+		return nil, "", err
+	}
+	cfg, err := clientconfig.Load(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return cfg, path, nil
+}
+
+// configureConnection selects the libvirt connection URI for this invocation
+// from --connect, --context, FOUNDRY_CONNECT and the current context.
+func configureConnection() error {
+	if connectURI != "" {
+		libvirt.SetDefaultURI(connectURI)
+		return nil
+	}
+	if contextName == "" && os.Getenv(libvirt.ConnectEnvVar) != "" {
+		return nil
+	}
+
+	cfg, _, err := loadClientConfig()
+	if err != nil {
+		return err
+	}
+	current, err := cfg.Resolve(contextName)
+	if err != nil {
+		return err
+	}
+	if current != nil && current.Connect != "" {
+		libvirt.SetDefaultURI(current.Connect)
+		return setupContextCache(current)
+	}
+	return nil
+}
+
+// contextCache identifies the cache of the context this invocation connects
+// through, when it is cached.
+var contextCache struct {
+	dir  string
+	name string
+}
+
+// contextCacheTTL returns how long the cache of a context is used.
+func contextCacheTTL(c *clientconfig.Context) (time.Duration, error) {
+	if c.CacheTTL == "" {
+		return hostcache.DefaultTTL, nil
+	}
+	ttl, err := time.ParseDuration(c.CacheTTL)
+	if err != nil {
+		return 0, fmt.Errorf("context %s has an invalid cacheTTL %q: %w", c.Name, c.CacheTTL, err)
+	}
+	return ttl, nil
+}
+
+// setupContextCache uses the cached facts of a remote context, or arranges
+// for them to be refreshed over the first connection the command makes once
+// they have expired. A broken cache only costs the round trips it saves, so
+// its problems are warnings.
+func setupContextCache(c *clientconfig.Context) error {
+	if !libvirt.IsRemote(c.Connect) {
+		return nil
+	}
+	ttl, err := contextCacheTTL(c)
+	if err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	dir, err := hostcache.DefaultDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return nil
+	}
+	contextCache.dir, contextCache.name = dir, c.Name
+
+	entry, err := hostcache.Load(dir, c.Name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if entry.Fresh(c.Connect, ttl, time.Now()) {
+		storage.SetKnownPools(entry.Pools)
+		return nil
+	}
+
+	var once sync.Once
+	libvirt.SetRemoteConnectHook(func(uri string, client *libvirt.Client) {
+		if uri != c.Connect {
+			return
+		}
+		once.Do(func() {
+			if _, err := refreshContextCache(dir, c.Name, uri, client); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to refresh cache of context %s: %v\n", c.Name, err)
+			}
+		})
+	})
+	return nil
+}
+
+// refreshContextCache fetches the facts of a context's hypervisor over client
+// and caches them.
+func refreshContextCache(dir, name, uri string, client *libvirt.Client) (*hostcache.Entry, error) {
+	defer timing.Start("refresh context cache")()
+
+	entry, err := hostcache.Fetch(client.Libvirt(), uri)
+	if err != nil {
+		return nil, err
+	}
+	if err := hostcache.Save(dir, name, entry); err != nil {
+		return nil, err
+	}
+	storage.SetKnownPools(entry.Pools)
+	return entry, nil
+}
+
+// invalidateContextCache drops the cache of the context in use after a
+// command changed what it holds, e.g. deleted a pool.
+func invalidateContextCache() {
+	if contextCache.name == "" {
+		return
+	}
+	if err := hostcache.Remove(contextCache.dir, contextCache.name); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+var contextListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List contexts",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, _, err := loadClientConfig()
+		if err != nil {
+			return err
+		}
+
+		if len(cfg.Contexts) == 0 {
+			fmt.Println("No contexts configured")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		if !noHeaders {
+			_, _ = fmt.Fprintln(w, "CURRENT\tNAME\tCONNECT\tSERVER\tAUTH")
+		}
+		for _, c := range cfg.Contexts {
+			current := ""
+			if c.Name == cfg.CurrentContext {
+				current = "*"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", current, c.Name, orDash(c.Connect), orDash(c.Server), contextAuth(c))
+		}
+		return w.Flush()
+	},
+}
+
+var contextCurrentCmd = &cobra.Command{
+	Use:   "current",
+	Short: "Show the current context",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, _, err := loadClientConfig()
+		if err != nil {
+			return err
+		}
+		if cfg.CurrentContext == "" {
+			return fmt.Errorf("no current context set")
+		}
+		fmt.Println(cfg.CurrentContext)
+		return nil
+	},
+}
+
+var contextUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Short: "Set the current context",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		cfg, path, err := loadClientConfig()
+		if err != nil {
+			return err
+		}
+		if _, err := cfg.Get(name); err != nil {
+			return err
+		}
+
+		cfg.CurrentContext = name
+		if err := cfg.Save(path); err != nil {
+			return err
+		}
+
+		fmt.Printf("✓ Switched to context %s\n", name)
+		return nil
+	},
+}
+
+var contextSetCmd = &cobra.Command{
+	Use:   "set <name>",
+	Short: "Create or update a context",
+	Long: `Create a context, or update the given fields of an existing one.
+
+Examples:
+  # Manage a remote hypervisor over SSH
+  foundry context set hv1 --connect qemu+ssh://root@hv1/system
+
+  # Store API credentials for a foundry daemon
+  foundry context set hv1 --server https://hv1:8443 \
+    --certificate-authority ca.pem --token-file hv1.token`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		cfg, path, err := loadClientConfig()
+		if err != nil {
+			return err
+		}
+
+		ctx := clientconfig.Context{Name: name}
+		if existing, err := cfg.Get(name); err == nil {
+			ctx = *existing
+		}
+
+		if cmd.Flags().Changed("token") && cmd.Flags().Changed("token-file") {
+			return fmt.Errorf("--token and --token-file are mutually exclusive")
+		}
+		if tokenFile, _ := cmd.Flags().GetString("token-file"); tokenFile != "" {
+			data, err := os.ReadFile(tokenFile)
+			if err != nil {
+				return fmt.Errorf("failed to read token file: %w", err)
+			}
+			ctx.Token = strings.TrimSpace(string(data))
+		}
+
+		stringFields := map[string]*string{
+			"connect":               &ctx.Connect,
+			"server":                &ctx.Server,
+			"token":                 &ctx.Token,
+			"certificate-authority": &ctx.CertificateAuthority,
+			"client-certificate":    &ctx.ClientCertificate,
+			"client-key":            &ctx.ClientKey,
+			"cache-ttl":             &ctx.CacheTTL,
+		}
+		for flag, field := range stringFields {
+			if !cmd.Flags().Changed(flag) {
+				continue
+			}
+			value, _ := cmd.Flags().GetString(flag)
+			if isFileFlag(flag) && value != "" {
+				// Store absolute paths so the context works from any directory
+				if value, err = filepath.Abs(value); err != nil {
+					return fmt.Errorf("failed to resolve --%s: %w", flag, err)
+				}
+			}
+			*field = value
+		}
+
+		if _, err := contextCacheTTL(&ctx); err != nil {
+			return err
+		}
+
+		cfg.Set(ctx)
+		if cfg.CurrentContext == "" {
+			cfg.CurrentContext = name
+		}
+		if err := cfg.Save(path); err != nil {
+			return err
+		}
+
+		fmt.Printf("✓ Context %s saved to %s\n", name, path)
+		return nil
+	},
+}
+
+var contextDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a context",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		cfg, path, err := loadClientConfig()
+		if err != nil {
+			return err
+		}
+		if err := cfg.Delete(name); err != nil {
+			return err
+		}
+		if err := cfg.Save(path); err != nil {
+			return err
+		}
+		if dir, err := hostcache.DefaultDir(); err == nil {
+			if err := hostcache.Remove(dir, name); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+
+		fmt.Printf("✓ Context %s deleted\n", name)
+		return nil
+	},
+}
+
+var contextRefreshCmd = &cobra.Command{
+	Use:   "refresh [name]",
+	Short: "Refresh the cached hypervisor facts of a context",
+	Long: `Fetch the host name, libvirt version, capabilities and storage pools of a
+context's hypervisor again and cache them, e.g. after pools were changed
+outside foundry. Defaults to the current context.
+
+Example:
+  foundry context refresh
+  foundry context refresh hv1`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, _, err := loadClientConfig()
+		if err != nil {
+			return err
+		}
+		name := ""
+		if len(args) == 1 {
+			name = args[0]
+		}
+		c, err := cfg.Resolve(name)
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			return fmt.Errorf("no current context set")
+		}
+		if !libvirt.IsRemote(c.Connect) {
+			return fmt.Errorf("context %s does not connect to a remote hypervisor, so nothing is cached for it", c.Name)
+		}
+		dir, err := hostcache.DefaultDir()
+		if err != nil {
+			return err
+		}
+
+		// Refresh explicitly rather than through the connect hook
+		libvirt.SetRemoteConnectHook(nil)
+		client, err := libvirt.Connect(c.Connect, 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("failed to connect to libvirt: %w", err)
+		}
+		defer func() {
+			if closeErr := client.Close(); closeErr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to close libvirt connection: %v\n", closeErr)
+			}
+		}()
+
+		entry, err := refreshContextCache(dir, c.Name, c.Connect, client)
+		if err != nil {
+			return fmt.Errorf("failed to refresh cache of context %s: %w", c.Name, err)
+		}
+
+		fmt.Printf("✓ Refreshed cache of context %s\n", c.Name)
+		fmt.Printf("  Hypervisor: %s (%s, libvirt %s)\n", entry.Hostname, orDash(entry.Arch), entry.LibvirtVersion)
+		fmt.Printf("  Pools:      %s\n", orDash(strings.Join(entry.Pools, ", ")))
+		return nil
+	},
+}
+
+// isFileFlag reports whether a context flag holds a file path.
+func isFileFlag(flag string) bool {
+	return flag == "certificate-authority" || flag == "client-certificate" || flag == "client-key"
+}
+
+// contextAuth summarizes the API credentials configured for a context.
+func contextAuth(c clientconfig.Context) string {
+	var methods []string
+	if c.Token != "" {
+		methods = append(methods, "token")
+	}
+	if c.ClientCertificate != "" {
+		methods = append(methods, "mtls")
+	}
+	if len(methods) == 0 {
+		return "-"
+	}
+	return strings.Join(methods, "+")
+}
+
+// orDash returns s, or "-" if it is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+// Disk management commands
+var diskCmd = &cobra.Command{
+	Use:   "disk",
+	Short: "Manage VM disks",
+	Long: `Manage the disks attached to virtual machines.
+
+Operations act on a disk by its target device name (e.g., vda, vdb) as shown
+in the VM's domain XML.`,
+}
+
+func init() {
+	diskCmd.AddCommand(diskFlattenCmd)
+	diskCmd.AddCommand(diskResizeCmd)
+	diskCmd.AddCommand(diskAttachCmd)
+	diskCmd.AddCommand(diskDetachCmd)
+
+	diskAttachCmd.Flags().Int("size-gb", 0, "Size of the new data disk in GB (required)")
+	_ = diskAttachCmd.MarkFlagRequired("size-gb")
+}
+
+var diskFlattenCmd = &cobra.Command{
+	Use:   "flatten <vm-name> <device>",
+	Short: "Flatten a disk's backing chain into a standalone image",
+	Long: `Flatten a running VM's disk so it no longer depends on its base image.
+
+Boot disks are created as qcow2 overlays backed by an image in the
+foundry-images pool. Flattening copies the backing data into the overlay using
+a libvirt block pull while the VM keeps running, after which the base image
+can be updated or deleted without affecting this VM.
+
+The VM must be running. Progress is reported until the block job completes.
+Interrupting the command (Ctrl+C) aborts the block job; the disk remains valid
+and still backed by its base image.
+
+Examples:
+  foundry disk flatten my-vm vda`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		device := args[1]
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+
+		fmt.Printf("Flattening disk %s of VM %s...\n", device, vmName)
+
+		reported := false
+		progress := func(p vm.BlockJobProgress) {
+			fmt.Printf("\r  %s: %5.1f%%", p.Device, p.Percent())
+			reported = true
+		}
+
+		err := vm.FlattenDisk(ctx, vmName, device, progress)
+		if reported {
+			fmt.Println()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to flatten disk: %w", err)
+		}
+
+		fmt.Printf("✓ Disk %s flattened successfully\n", device)
+		return nil
+	},
+}
+
+var diskResizeCmd = &cobra.Command{
+	Use:   "resize <vm-name> <device> <new-size-gb>",
+	Short: "Grow a VM's boot or data disk",
+	Long: `Grow a VM's boot disk (vda) or one of its data disks to a new size in GB.
+
+Running VMs are resized live and the guest sees the new size immediately;
+stopped VMs have their volume resized. Disks cannot be shrunk. The stored VM
+spec is updated with the new size.
+
+Only the disk grows: partitions and filesystems inside the guest must be
+extended separately (cloud images usually grow the root filesystem on boot).
+
+Examples:
+  foundry disk resize my-vm vda 50
+  foundry disk resize my-vm vdb 200`,
+	Args: cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		device := args[1]
+		sizeGB, err := strconv.Atoi(args[2])
+		if err != nil || sizeGB <= 0 {
+			return fmt.Errorf("invalid size %q: must be a positive number of GB", args[2])
+		}
+
+		fmt.Printf("Resizing disk %s of VM %s to %dGB...\n", device, vmName, sizeGB)
+
+		ctx := cmd.Context()
+		if err := vm.ResizeDisk(ctx, vmName, device, sizeGB); err != nil {
+			return fmt.Errorf("failed to resize disk: %w", err)
+		}
+
+		fmt.Printf("✓ Disk %s resized to %dGB\n", device, sizeGB)
+		return nil
+	},
+}
+
+var diskAttachCmd = &cobra.Command{
+	Use:   "attach <vm-name> <device>",
+	Short: "Add a new data disk to a VM",
+	Long: `Create an empty data disk and attach it to a VM at a virtio device
+(vdb, vdc, ...).
+
+Running VMs get the disk hotplugged and the guest sees it immediately; stopped
+VMs have it on their next start. The disk is added to the stored VM spec like
+a spec.dataDisks entry. The guest still has to partition, format and mount it.
+
+Examples:
+  foundry disk attach my-vm vdc --size-gb 100`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		device := args[1]
+		sizeGB, _ := cmd.Flags().GetInt("size-gb")
+		if sizeGB <= 0 {
+			return fmt.Errorf("invalid --size-gb %d: must be a positive number of GB", sizeGB)
+		}
+
+		fmt.Printf("Attaching %dGB disk %s to VM %s...\n", sizeGB, device, vmName)
+
+		ctx := cmd.Context()
+		if err := vm.AttachDisk(ctx, vmName, device, sizeGB); err != nil {
+			return fmt.Errorf("failed to attach disk: %w", err)
+		}
+
+		fmt.Printf("✓ Disk %s attached\n", device)
+		return nil
+	},
+}
+
+var diskDetachCmd = &cobra.Command{
+	Use:   "detach <vm-name> <device>",
+	Short: "Remove a data disk from a VM and delete it",
+	Long: `Detach a data disk from a VM and delete its volume. All data on the disk is
+lost.
+
+Running VMs have the disk unplugged; the guest must release it (unmount its
+filesystems first) before the volume can be deleted. If the guest has not
+released it within 30 seconds the volume is kept and the command fails. The
+disk is removed from the stored VM spec. The boot disk cannot be detached.
+
+Examples:
+  foundry disk detach my-vm vdc`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		device := args[1]
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+
+		fmt.Printf("Detaching disk %s from VM %s...\n", device, vmName)
+
+		if err := vm.DetachDisk(ctx, vmName, device); err != nil {
+			return fmt.Errorf("failed to detach disk: %w", err)
+		}
+
+		fmt.Printf("✓ Disk %s detached and deleted\n", device)
+		return nil
+	},
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/doctor"
+	"github.com/jbweber/foundry/internal/libvirt"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the local host for problems",
+	Long: `Check the local hypervisor host for problems that would stop VMs from
+starting, and explain how to fix them.
+
+Checks read the host directly, so run doctor on the hypervisor itself.
+
+By default doctor checks that:
+  - the libvirt daemon is reachable
+  - KVM is available (/dev/kvm), and whether nested virtualization is enabled
+  - the storage pools (foundry's default pools, or each --pool) are running,
+    writable, reachable by the user QEMU runs as, and have at least
+    --min-free-gb free
+  - the bridges the defined VMs attach to, and each --bridge, exist
+
+--passthrough checks PCI passthrough instead: that the IOMMU is enabled, that
+the vfio-pci driver is loaded, and for each --device that its IOMMU group can
+be assigned to a VM (every device in the group is bound to vfio-pci, unbound,
+or a bridge). The device's NUMA node is reported so the VM can be placed on
+it.
+
+Each check passes, warns or fails. Use -o json or -o yaml for
+machine-readable results. Exits with an error if any check fails.
+
+Examples:
+  foundry doctor
+  foundry doctor --bridge br0 --bridge br-storage -o json
+  foundry doctor --passthrough
+  foundry doctor --passthrough --device 0000:01:00.0 --device 0000:01:00.1`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		passthrough, _ := cmd.Flags().GetBool("passthrough")
+		devices, _ := cmd.Flags().GetStringArray("device")
+
+		opts := doctor.HostOptions{}
+		opts.Pools, _ = cmd.Flags().GetStringArray("pool")
+		opts.Bridges, _ = cmd.Flags().GetStringArray("bridge")
+		opts.MinFreeGB, _ = cmd.Flags().GetUint64("min-free-gb")
+
+		if len(devices) > 0 && !passthrough {
+			return fmt.Errorf("--device requires --passthrough")
+		}
+
+		printer, err := newOutputPrinter()
+		if err != nil {
+			return err
+		}
+		if err := libvirt.RequireLocal("doctor"); err != nil {
+			return err
+		}
+
+		var results []doctor.Result
+		if passthrough {
+			results = doctor.CheckPassthrough(devices)
+		} else {
+			results = doctor.CheckHost(cmd.Context(), opts)
+		}
+
+		if printer.Tabular() {
+			printDoctorResults(results)
+		} else if err := printList(printer, results); err != nil {
+			return err
+		}
+
+		if doctor.Failed(results) {
+			return fmt.Errorf("some checks failed")
+		}
+		return nil
+	},
+}
+
+func init() {
+	doctorCmd.Flags().StringArray("pool", nil, "Storage pool to check (repeatable, default foundry's default pools)")
+	doctorCmd.Flags().StringArray("bridge", nil, "Bridge to check in addition to those of the defined VMs (repeatable)")
+	doctorCmd.Flags().Uint64("min-free-gb", doctor.DefaultMinFreeGB, "Warn when a pool has less free space (GB)")
+	doctorCmd.Flags().Bool("passthrough", false, "Check PCI passthrough readiness instead of the host")
+	doctorCmd.Flags().StringArray("device", nil, "PCI address of a device to check for passthrough (repeatable)")
+}
+
+// printDoctorResults prints check results with remediation for problems.
+func printDoctorResults(results []doctor.Result) {
+	for _, r := range results {
+		mark := "✓"
+		switch r.Status {
+		case doctor.StatusWarn:
+			mark = "!"
+		case doctor.StatusFail:
+			mark = "✗"
+		}
+		fmt.Printf("%s %s: %s\n", mark, r.Name, r.Message)
+		if r.Remediation != "" {
+			fmt.Printf("    fix: %s\n", r.Remediation)
+		}
+	}
+}
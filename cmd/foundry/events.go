@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/history"
+	"github.com/jbweber/foundry/internal/output"
+)
+
+var eventsCmd = &cobra.Command{
+	Use:   "events <vm-name>",
+	Short: "Show the history of a VM",
+	Long: `Show what was done to a VM and by whom, oldest first.
+
+foundry records when a VM is created, started, stopped and destroyed, when
+data disks are attached and detached and when snapshots are taken, reverted
+to or deleted, with the user who did it (the user who ran sudo, under sudo,
+and the authenticated caller for changes made through 'foundry serve').
+Only changes made through foundry on this host are recorded.
+
+The history is kept in /var/lib/foundry/events when run as root and
+~/.local/state/foundry/events otherwise (override with $FOUNDRY_EVENTS_DIR),
+one file per VM and libvirt connection: with --connect, the history of the
+VM on that hypervisor is shown. It is kept when the VM is destroyed, so the
+history of a destroyed VM can still be shown.
+
+Examples:
+  foundry events my-vm
+  foundry events my-vm --tail 10
+  foundry events my-vm -o json`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		tail, _ := cmd.Flags().GetInt("tail")
+
+		// Create printer (validates the format)
+		printer, err := newOutputPrinter()
+		if err != nil {
+			return err
+		}
+
+		dir, err := history.DefaultDir()
+		if err != nil {
+			return err
+		}
+		events, err := history.List(dir, history.Connection(), vmName)
+		if err != nil {
+			return err
+		}
+		if tail > 0 && len(events) > tail {
+			events = events[len(events)-tail:]
+		}
+
+		if !printer.Tabular() {
+			return printList(printer, events)
+		}
+		if len(events) == 0 {
+			fmt.Printf("No events recorded for VM %s\n", vmName)
+			return nil
+		}
+
+		table := &output.Table{
+			Columns: []output.Column{{Name: "TIME"}, {Name: "TYPE"}, {Name: "ACTOR"}, {Name: "MESSAGE"}},
+		}
+		for _, ev := range events {
+			table.Rows = append(table.Rows, []string{
+				ev.Time.Local().Format(time.DateTime),
+				ev.Type,
+				ev.Actor,
+				orDash(ev.Message),
+			})
+		}
+		fmt.Print(printer.FormatTable(table))
+		return nil
+	},
+}
+
+func init() {
+	eventsCmd.Flags().Int("tail", 0, "Show only the last N events")
+}
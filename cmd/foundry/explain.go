@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/explain"
+)
+
+var explainCmd = &cobra.Command{
+	Use:   "explain <resource[.field...]>",
+	Short: "Describe configuration fields",
+	Long: `Describe the fields of a foundry configuration, like kubectl explain.
+
+Shows a field's type, description, default and allowed values, followed by
+its nested fields. Name the resource (virtualmachine or vm,
+virtualmachinestack or stack) followed by the path to a field using the
+YAML field names. List fields are explained by their element type.
+
+Examples:
+  foundry explain vm
+  foundry explain vm.spec.bootDisk
+  foundry explain vm.spec.networkInterfaces.ipv6
+  foundry explain vm.spec --recursive
+  foundry explain stack.spec.template`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		recursive, _ := cmd.Flags().GetBool("recursive")
+
+		resource, field, err := explain.Lookup(args[0])
+		if err != nil {
+			return err
+		}
+		return explain.Render(os.Stdout, resource, field, recursive)
+	},
+}
+
+func init() {
+	explainCmd.Flags().Bool("recursive", false, "List all nested fields as a tree")
+}
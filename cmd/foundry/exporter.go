@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/metrics"
+	"github.com/jbweber/foundry/internal/server"
+)
+
+// defaultExporterAddr is where 'foundry exporter' listens by default.
+const defaultExporterAddr = "127.0.0.1:9177"
+
+var exporterCmd = &cobra.Command{
+	Use:   "exporter",
+	Short: "Serve VM metrics for Prometheus",
+	Long: `Serve the metrics of the VMs on this host for Prometheus at /metrics.
+
+At every scrape the statistics of the foundry VMs are read from libvirt:
+  foundry_vm_phase                          1 for the VM's current phase
+  foundry_vm_vcpus                          vCPUs of a running VM
+  foundry_vm_cpu_seconds_total              CPU time used
+  foundry_vm_memory_bytes                   memory assigned by the balloon driver
+  foundry_vm_memory_rss_bytes               host memory used by the VM's process
+  foundry_vm_disk_{read,written}_bytes_total, foundry_vm_disk_{reads,writes}_total
+                                            I/O per disk (label device)
+  foundry_vm_network_{receive,transmit}_{bytes,packets,errors}_total
+                                            I/O per interface (label interface)
+  foundry_libvirt_up                        0 if libvirt could not be queried
+
+Domains foundry does not manage are left out. 'foundry serve' serves the same
+metrics at /metrics along with counters of the VM creations it does.
+
+The exporter is unauthenticated and only listens on localhost by default;
+use --listen :9177 to let a Prometheus server on another host scrape it.
+/healthz and /readyz are served for supervision, as by 'foundry serve'.
+
+Examples:
+  foundry exporter
+  foundry exporter --listen :9177`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		listen, _ := cmd.Flags().GetString("listen")
+
+		srv := server.New(server.Options{
+			Addr: listen,
+			ReadyChecks: map[string]server.Check{
+				"libvirt": checkLibvirt,
+			},
+		})
+		srv.Handle("GET /metrics", metrics.Handler(metrics.NewRegistry(metrics.NewDomainCollector(cmd.Context()))))
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		return srv.Run(ctx)
+	},
+}
+
+func init() {
+	exporterCmd.Flags().String("listen", defaultExporterAddr, "Address to listen on")
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Roll back VM creations that were interrupted",
+	Long: `Remove the volumes and domains left behind by VM creations that never
+finished, e.g. because foundry was killed or the host crashed mid-create.
+
+Every creation journals the resources it creates until the VM is started, in
+/var/lib/foundry/journal when run as root and ~/.local/state/foundry/journal
+otherwise (override with $FOUNDRY_JOURNAL_DIR). Journals left by processes
+that are no longer running are rolled back: the domain is destroyed and
+undefined and the volumes are deleted. Creations still in progress are left
+alone, as are those on another libvirt connection than --connect and VMs
+created again under the same name since.
+
+'foundry serve' rolls back interrupted creations when it starts.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rolledBack, err := vm.GC(cmd.Context())
+		for _, r := range rolledBack {
+			fmt.Printf("✓ Rolled back creation of VM %s\n", r.VM)
+			for _, res := range r.Removed {
+				fmt.Printf("  - removed %s\n", res)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to roll back interrupted creations: %w", err)
+		}
+		if len(rolledBack) == 0 {
+			fmt.Println("No interrupted creations to roll back")
+		}
+		return nil
+	},
+}
@@ -1,12 +1,10 @@
 package main
 
 import (
-	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
 
-	"github.com/jbweber/foundry/internal/output"
 	"github.com/jbweber/foundry/internal/vm"
 )
 
@@ -15,34 +13,60 @@ var getCmd = &cobra.Command{
 	Short: "Get details about a VM",
 	Long: `Get detailed information about a specific virtual machine.
 
-Displays the full VirtualMachine resource including spec and status.
+Displays the VirtualMachine spec and status stored in the domain metadata,
+refreshed with live status from libvirt (phase, domain UUID, addresses, MACs
+and interface names). The stored status is updated when the VM is created,
+started or stopped, so the transition times of its conditions tell when it
+last changed state.
+
+With --export, only the stored spec is printed (as YAML unless -o json is
+given), without status, foundry-populated metadata or annotations that only
+hold on this host, so it can be saved and re-applied as a config file on this
+or another host:
+
+  foundry get my-vm --export > my-vm.yaml
+  foundry --connect qemu+ssh://root@hv2/system apply -f my-vm.yaml
 
 Output formats:
   -o table  Human-readable table (default)
   -o yaml   Full YAML resource definition
-  -o json   Full JSON resource definition`,
+  -o json   Full JSON resource definition
+  -o jsonpath=TEMPLATE     Fields selected by a JSONPath template
+  -o go-template=TEMPLATE  Output of a Go template
+
+Examples:
+  foundry get my-vm --export > my-vm.yaml
+  foundry get my-vm -o jsonpath='{.status.addresses[0].address}'
+  foundry get my-vm -o go-template='{{.status.phase}}'`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		vmName := args[0]
+		export, _ := cmd.Flags().GetBool("export")
 
-		// Validate output format
-		if err := output.ValidateFormat(outputFormat); err != nil {
-			return err
+		// Exports are YAML unless another structured format was asked for
+		if export {
+			if !cmd.Flag("output").Changed {
+				outputFormat = "yaml"
+			} else if outputFormat == "table" || outputFormat == "wide" {
+				return fmt.Errorf("--export prints a config file, use -o yaml or -o json")
+			}
 		}
 
-		ctx := context.Background()
-		vmObj, err := vm.GetVM(ctx, vmName)
+		// Create formatter (validates the format before connecting)
+		formatter, err := newOutputFormatter()
 		if err != nil {
-			return fmt.Errorf("failed to get VM: %w", err)
+			return err
 		}
 
-		// Create formatter
-		formatter, err := output.NewFormatter(output.Options{
-			Format:    output.Format(outputFormat),
-			NoHeaders: noHeaders,
-		})
+		ctx := cmd.Context()
+		vmObj, err := vm.Get(ctx, vmName)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to get VM: %w", err)
+		}
+		if export {
+			if vmObj, err = vm.ExportSpec(vmObj); err != nil {
+				return err
+			}
 		}
 
 		// Format and print
@@ -55,3 +79,7 @@ Output formats:
 		return nil
 	},
 }
+
+func init() {
+	getCmd.Flags().Bool("export", false, "Print only the stored spec, ready to re-apply as a config file")
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/host"
+	"github.com/jbweber/foundry/internal/output"
+)
+
+// Host inspection commands
+var hostCmd = &cobra.Command{
+	Use:   "host",
+	Short: "Inspect the hypervisor host",
+	Long:  `Inspect the hypervisor host foundry is connected to.`,
+}
+
+func init() {
+	hostCmd.AddCommand(hostInfoCmd)
+	hostCmd.AddCommand(hostDevicesCmd)
+
+	hostDevicesCmd.Flags().Bool("all", false, "List every PCI device, including bridges and devices outside an IOMMU group")
+}
+
+var hostInfoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Show the host's capacity and what VMs are allocated",
+	Long: `Show the CPUs, memory and storage pools of the hypervisor host and how much
+of them its VMs are allocated, for capacity planning.
+
+vCPUs and memory are summed over every defined domain, including those not
+managed by foundry, and over the running ones. RATIO is what the defined
+domains are allocated per host CPU or byte of memory: above 1.00 the host is
+overcommitted if they all run at once. For each storage pool, PROVISIONED is
+the total capacity of its volumes; thin-provisioned volumes only allocate
+what is written, so above a RATIO of 1.00 the pool can fill up before its
+volumes do.
+
+Example:
+  foundry host info
+  foundry host info -o json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Create printer (validates the format before connecting)
+		printer, err := newOutputPrinter()
+		if err != nil {
+			return err
+		}
+
+		capacity, err := host.GetCapacity(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		if !printer.Tabular() {
+			return printObject(printer, capacity)
+		}
+
+		const gib = 1024 * 1024 * 1024
+		fmt.Printf("Host: %s, %d CPUs, %d NUMA node(s), %.1f GiB memory\n",
+			capacity.Model, capacity.CPUs, capacity.NUMANodes, float64(capacity.Memory)/gib)
+
+		var phases []string
+		for _, phase := range []v1alpha1.VMPhase{
+			v1alpha1.VMPhasePending, v1alpha1.VMPhaseCreating, v1alpha1.VMPhaseRunning,
+			v1alpha1.VMPhaseStopping, v1alpha1.VMPhaseStopped, v1alpha1.VMPhaseFailed,
+		} {
+			if n := capacity.VMs[phase]; n > 0 {
+				phases = append(phases, fmt.Sprintf("%d %s", n, phase))
+			}
+		}
+		vms := "none"
+		if len(phases) > 0 {
+			vms = strings.Join(phases, ", ")
+		}
+		if capacity.OtherDomains > 0 {
+			vms += fmt.Sprintf(" (and %d domain(s) not managed by foundry)", capacity.OtherDomains)
+		}
+		fmt.Printf("VMs: %s\n\n", vms)
+
+		resources := &output.Table{
+			Columns: []output.Column{{Name: "RESOURCE"}, {Name: "HOST"}, {Name: "DEFINED"}, {Name: "RUNNING"}, {Name: "RATIO"}},
+			Rows: [][]string{
+				{
+					"vCPUs",
+					fmt.Sprint(capacity.CPUs),
+					fmt.Sprint(capacity.VCPUs.Defined),
+					fmt.Sprint(capacity.VCPUs.Running),
+					fmt.Sprintf("%.2f", capacity.VCPURatio),
+				},
+				{
+					"Memory",
+					fmt.Sprintf("%.1fGiB", float64(capacity.Memory)/gib),
+					fmt.Sprintf("%.1fGiB", float64(capacity.AllocatedMemory.Defined)/gib),
+					fmt.Sprintf("%.1fGiB", float64(capacity.AllocatedMemory.Running)/gib),
+					fmt.Sprintf("%.2f", capacity.MemoryRatio),
+				},
+			},
+		}
+		fmt.Print(printer.FormatTable(resources))
+
+		if len(capacity.Pools) == 0 {
+			return nil
+		}
+		fmt.Println()
+		pools := &output.Table{
+			Columns: []output.Column{
+				{Name: "POOL"}, {Name: "STATE"}, {Name: "CAPACITY"}, {Name: "ALLOCATED"}, {Name: "AVAILABLE"},
+				{Name: "VOLUMES"}, {Name: "PROVISIONED"}, {Name: "RATIO"},
+			},
+		}
+		for _, pool := range capacity.Pools {
+			pools.Rows = append(pools.Rows, []string{
+				pool.Name,
+				pool.State,
+				fmt.Sprintf("%.1fGB", pool.CapacityGB()),
+				fmt.Sprintf("%.1fGB", pool.AllocationGB()),
+				fmt.Sprintf("%.1fGB", pool.AvailableGB()),
+				fmt.Sprint(pool.Volumes),
+				fmt.Sprintf("%.1fGB", pool.ProvisionedGB()),
+				fmt.Sprintf("%.2f", pool.Ratio),
+			})
+		}
+		fmt.Print(printer.FormatTable(pools))
+		return nil
+	},
+}
+
+var hostDevicesCmd = &cobra.Command{
+	Use:   "devices",
+	Short: "List devices that can be passed through to VMs",
+	Long: `List the host's PCI devices that can be passed through to VMs, and the
+mediated devices (e.g. vGPUs) created on it.
+
+A PCI device is a candidate when it is in an IOMMU group and is not a
+bridge. Every device in an IOMMU group must be passed through together;
+run 'foundry doctor --passthrough --device <address>' to check one.
+Use the ADDRESS or UUID in spec.hostDevices:
+
+  hostDevices:
+    - pciAddress: "0000:01:00.0"
+    - mdevUUID: "4b20d080-1b54-4048-85b3-a6a62d165c01"
+
+Example:
+  foundry host devices
+  foundry host devices --all -o wide`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		all, _ := cmd.Flags().GetBool("all")
+
+		// Create printer (validates the format before connecting)
+		printer, err := newOutputPrinter()
+		if err != nil {
+			return err
+		}
+
+		devices, err := host.ListDevices(cmd.Context())
+		if err != nil {
+			return err
+		}
+		if !all {
+			var candidates []host.PCIDevice
+			for _, dev := range devices.PCI {
+				if dev.Candidate() {
+					candidates = append(candidates, dev)
+				}
+			}
+			devices.PCI = candidates
+		}
+
+		if !printer.Tabular() {
+			return printObject(printer, devices)
+		}
+		if len(devices.PCI) == 0 && len(devices.Mdevs) == 0 {
+			fmt.Println("No passthrough devices found (is the IOMMU enabled? see 'foundry doctor --passthrough')")
+			return nil
+		}
+
+		if len(devices.PCI) > 0 {
+			table := &output.Table{
+				Columns: []output.Column{
+					{Name: "ADDRESS"}, {Name: "IOMMU GROUP"}, {Name: "DRIVER"}, {Name: "DEVICE"},
+					{Name: "CLASS", Wide: true}, {Name: "NUMA", Wide: true}, {Name: "MDEV TYPES", Wide: true},
+				},
+				Footer: []string{fmt.Sprintf("Total: %d device(s)", len(devices.PCI))},
+			}
+			for _, dev := range devices.PCI {
+				group := "-"
+				if dev.IOMMUGroup >= 0 {
+					group = fmt.Sprint(dev.IOMMUGroup)
+				}
+				numa := "-"
+				if dev.NUMANode >= 0 {
+					numa = fmt.Sprint(dev.NUMANode)
+				}
+				var mdevTypes []string
+				for _, t := range dev.MdevTypes {
+					mdevTypes = append(mdevTypes, fmt.Sprintf("%s (%d available)", t.ID, t.Available))
+				}
+				table.Rows = append(table.Rows, []string{
+					dev.Address,
+					group,
+					orDash(dev.Driver),
+					strings.TrimSpace(dev.Vendor + " " + dev.Product),
+					dev.Class,
+					numa,
+					orDash(strings.Join(mdevTypes, ", ")),
+				})
+			}
+			fmt.Print(printer.FormatTable(table))
+		}
+
+		if len(devices.Mdevs) > 0 {
+			if len(devices.PCI) > 0 {
+				fmt.Println()
+			}
+			table := &output.Table{
+				Columns: []output.Column{{Name: "MDEV UUID"}, {Name: "TYPE"}, {Name: "PARENT"}},
+				Footer:  []string{fmt.Sprintf("Total: %d mediated device(s)", len(devices.Mdevs))},
+			}
+			for _, mdev := range devices.Mdevs {
+				table.Rows = append(table.Rows, []string{mdev.UUID, mdev.Type, orDash(mdev.Parent)})
+			}
+			fmt.Print(printer.FormatTable(table))
+		}
+		return nil
+	},
+}
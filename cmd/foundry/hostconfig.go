@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/jbweber/foundry/internal/hostconfig"
+)
+
+// configureHost applies the host config, /etc/foundry/config.yaml or
+// --config. It must follow configureConnection, whose connection takes
+// precedence over the host config's.
+func configureHost() error {
+	var cfg *hostconfig.Config
+	var err error
+	if hostConfigPath != "" {
+		cfg, err = hostconfig.Load(hostConfigPath)
+	} else {
+		cfg, err = hostconfig.LoadDefault()
+	}
+	if err != nil {
+		return err
+	}
+
+	// The DNS servers of the CLI config's network defaults take precedence
+	// over the host's; addNetworkDefaults fills them in
+	clientCfg, _, err := loadClientConfig()
+	if err != nil {
+		return err
+	}
+	if nd := clientCfg.Defaults.NetworkDefaults; nd != nil && len(nd.DNSServers) > 0 {
+		cfg.Network.DNSServers = nil
+	}
+
+	cfg.Apply()
+	return nil
+}
@@ -2,16 +2,27 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/catalog"
+	"github.com/jbweber/foundry/internal/hostconfig"
+	"github.com/jbweber/foundry/internal/labels"
 	"github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/loader"
+	"github.com/jbweber/foundry/internal/logging"
 	"github.com/jbweber/foundry/internal/output"
 	"github.com/jbweber/foundry/internal/storage"
+	"github.com/jbweber/foundry/internal/timing"
 	"github.com/jbweber/foundry/internal/vm"
 )
 
@@ -22,10 +33,28 @@ var (
 	// Global flags for output formatting
 	outputFormat string
 	noHeaders    bool
+
+	// Global flags for selecting the hypervisor
+	connectURI  string
+	contextName string
+
+	// Global flag for the host config file
+	hostConfigPath string
+
+	// Global flag for printing step durations
+	debugTimings bool
+
+	// Global flags for logging
+	logLevel  string
+	logFormat string
 )
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	registerAliases(rootCmd)
+
+	err := rootCmd.Execute()
+	timing.Print(os.Stderr)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -37,50 +66,323 @@ var rootCmd = &cobra.Command{
 	Long: `Foundry is a CLI tool for managing libvirt VMs with simple YAML configuration.
 
 It provides commands to create, destroy, and list virtual machines using
-declarative configuration files.`,
+declarative configuration files.
+
+By default foundry manages the local hypervisor (qemu:///system). Use
+--connect, --context or the FOUNDRY_CONNECT environment variable to manage a
+remote one, e.g. qemu+ssh://root@hv1/system, qemu+tcp://hv1/system or
+qemu+tls://hv1/system.
+
+Host-wide defaults (storage pool names and paths, the connection URI, the
+default bridge and DNS servers of new VMs, and image catalog mirrors) are read
+from /etc/foundry/config.yaml, or the file given with --config.`,
 	Version: fmt.Sprintf("%s (commit: %s)", version, commit),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		logger, err := logging.New(os.Stderr, logLevel, logFormat)
+		if err != nil {
+			return err
+		}
+		slog.SetDefault(logger)
+		cmd.SetContext(logging.NewContext(cmd.Context(), logger))
+
+		if debugTimings {
+			timing.Enable()
+		}
+		if err := configureNaming(); err != nil {
+			return err
+		}
+		if err := configureConnection(); err != nil {
+			return err
+		}
+		return configureHost()
+	},
 }
 
 func init() {
 	// Global persistent flags for output formatting
-	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "table", "Output format (table|yaml|json)")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "table", "Output format (table|wide|yaml|json|jsonpath=TEMPLATE|go-template=TEMPLATE)")
 	rootCmd.PersistentFlags().BoolVar(&noHeaders, "no-headers", false, "Omit headers in table output")
 
+	// Global persistent flag for the libvirt connection
+	rootCmd.PersistentFlags().StringVarP(&connectURI, "connect", "c", "", "Libvirt connection URI (default $FOUNDRY_CONNECT or qemu:///system)")
+	rootCmd.PersistentFlags().StringVar(&contextName, "context", "", "Name of the context to use (see foundry context)")
+
+	// Global persistent flag for the host config
+	rootCmd.PersistentFlags().StringVar(&hostConfigPath, "config", "", "Host config file (default "+hostconfig.DefaultPath+")")
+
+	// Global persistent flags for logging
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Minimum level of log records (debug|info|warn|error)")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", logging.FormatText, "Log record format (text|json)")
+
+	// Global persistent flag for diagnosing slow commands
+	rootCmd.PersistentFlags().BoolVar(&debugTimings, "debug-timings", false, "Print how long each step (connect, pool ensure, volume creates, define, start) took")
+
 	// Subcommands will be added here
 	rootCmd.AddCommand(createCmd)
+	rootCmd.AddCommand(applyCmd)
+	rootCmd.AddCommand(stackCmd)
+	rootCmd.AddCommand(cloneCmd)
+	rootCmd.AddCommand(adoptCmd)
+	rootCmd.AddCommand(migrateCmd)
 	rootCmd.AddCommand(destroyCmd)
+	rootCmd.AddCommand(reapCmd)
+	rootCmd.AddCommand(gcCmd)
+	rootCmd.AddCommand(shutdownAllCmd)
+	rootCmd.AddCommand(autostartCmd)
+	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(getCmd)
+	rootCmd.AddCommand(eventsCmd)
+	rootCmd.AddCommand(annotateCmd)
 	rootCmd.AddCommand(testConnCmd)
 	rootCmd.AddCommand(imageCmd)
 	rootCmd.AddCommand(poolCmd)
 	rootCmd.AddCommand(storageCmd)
+	rootCmd.AddCommand(diskCmd)
+	rootCmd.AddCommand(nicCmd)
+	rootCmd.AddCommand(benchCmd)
+	rootCmd.AddCommand(snapshotCmd)
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(consoleCmd)
+	rootCmd.AddCommand(sshCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(exporterCmd)
+	rootCmd.AddCommand(contextCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(hostCmd)
+	rootCmd.AddCommand(explainCmd)
+	rootCmd.AddCommand(vmCmd)
 }
 
 var createCmd = &cobra.Command{
-	Use:   "create <config.yaml>",
-	Short: "Create a VM from a configuration file",
+	Use:   "create <config.yaml|dir>",
+	Short: "Create VMs from a configuration file or directory",
 	Long: `Create a new virtual machine from a YAML configuration file.
 
 The configuration file defines the VM's resources (CPU, memory, disk),
-network settings, and cloud-init configuration.`,
+network settings, and cloud-init configuration.
+
+A file may hold several VMs as YAML documents separated by "---", and a
+directory creates the VMs of all its *.yaml and *.yml files in name order.
+Each VM is created in turn; a VM that fails to load or create does not stop
+the others, and a summary is printed at the end. The command fails if any VM
+failed.
+
+If metadata.generateName is set instead of metadata.name, a unique name is
+generated from that prefix and printed once the VM is created.
+
+With --dry-run the configuration is validated and the domain XML, cloud-init
+files and volumes that would be created are printed, without connecting to
+libvirt. --print-xml prints only the domain XML, for debugging device
+definitions or feeding to 'virsh define'; it takes a single VM. MAC addresses
+that are generated rather than configured differ from those of the VM
+eventually created.
+
+For disposable VMs, --ttl destroys the VM (including its storage) once the
+duration has passed and --rm destroys it once it shuts down. Both override the
+configuration (spec.ttl, spec.ephemeral) and are enforced by 'foundry reap' or
+'foundry serve'.
+
+--with-my-key adds your default SSH public key (~/.ssh/id_ed25519.pub,
+id_ecdsa.pub or id_rsa.pub) to spec.cloudInit.sshAuthorizedKeys, so you can
+log in to the new VM. Set defaults.withMyKey: true in the foundry config file
+to do this by default.
+
+Before anything is created, preflight checks verify that the VM's bridges and
+networks exist and that its storage pool and the host have room for it;
+--skip-preflight creates it regardless.
+
+With --ensure, creating a VM that already exists succeeds without doing
+anything if its stored spec matches the configuration, and fails listing the
+differences otherwise (use 'foundry apply' to change it). This makes create
+safe to run repeatedly from configuration management.
+
+With --values and --set, each configuration file is rendered as a Go template
+before it is loaded, so one file can make many similar VMs: "{{ .ip }}" is
+replaced with the value of ip. --set key=value overrides the values files, and
+a dotted key (env.name=prod) sets a nested value. Referencing a value that is
+not set is an error. Files are used as is without either flag.
+
+Examples:
+  foundry create web.yaml
+  foundry create web.tmpl.yaml --values prod.yaml --set name=web-2 --set ip=10.0.0.5
+  foundry create web.yaml --ensure
+  foundry create web.yaml --print-xml
+  foundry create ci-runner.yaml --ttl 2h --rm
+  foundry create scratch.yaml --with-my-key
+  foundry create cluster/`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		configPath := args[0]
-		fmt.Printf("Creating VM from config: %s\n", configPath)
 
-		ctx := context.Background()
-		if err := vm.Create(ctx, configPath); err != nil {
-			return fmt.Errorf("failed to create VM: %w", err)
+		docs, err := loadConfigs(cmd, configPath)
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		if printXML, _ := cmd.Flags().GetBool("print-xml"); printXML {
+			if dryRun {
+				return fmt.Errorf("--print-xml and --dry-run are mutually exclusive")
+			}
+			if len(docs) != 1 {
+				return fmt.Errorf("--print-xml takes a single VM, found %d", len(docs))
+			}
 		}
 
-		fmt.Println("✓ VM created successfully!")
-		return nil
+		if len(docs) == 1 {
+			if docs[0].Err != nil {
+				return fmt.Errorf("failed to load configuration: %w", docs[0].Err)
+			}
+			return createVM(cmd, docs[0].VM, configPath, dryRun)
+		}
+
+		verb := "Created"
+		if dryRun {
+			verb = "Planned"
+		}
+		return runBatch(verb, docs, func(doc loader.Document) error {
+			return createVM(cmd, doc.VM, doc.Source, dryRun)
+		})
 	},
 }
 
+// createVM creates the VM in config, applying the command line overrides,
+// or prints its plan with --dry-run or its domain XML with --print-xml.
+func createVM(cmd *cobra.Command, config *v1alpha1.VirtualMachine, source string, dryRun bool) error {
+	if cmd.Flags().Changed("ttl") {
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+		if ttl <= 0 {
+			return fmt.Errorf("--ttl must be greater than 0")
+		}
+		config.Spec.TTL = &v1alpha1.Duration{Duration: ttl}
+	}
+	if rm, _ := cmd.Flags().GetBool("rm"); rm {
+		config.Spec.Ephemeral = true
+	}
+	if err := addMyKey(cmd, config); err != nil {
+		return err
+	}
+	if err := addNetworkDefaults(config); err != nil {
+		return err
+	}
+	if err := confirmWarnings(cmd, config); err != nil {
+		return err
+	}
+
+	if dryRun {
+		plan, err := vm.PlanFromConfig(config)
+		if err != nil {
+			return fmt.Errorf("failed to plan VM: %w", err)
+		}
+		printCreatePlan(plan)
+		return nil
+	}
+	if printXML, _ := cmd.Flags().GetBool("print-xml"); printXML {
+		plan, err := vm.PlanFromConfig(config)
+		if err != nil {
+			return fmt.Errorf("failed to plan VM: %w", err)
+		}
+		fmt.Println(strings.TrimRight(plan.DomainXML, "\n"))
+		return nil
+	}
+
+	fmt.Printf("Creating VM from config: %s\n", source)
+
+	// Print each step as it completes
+	events := make(chan vm.CreateEvent, 8)
+	printed := make(chan struct{})
+	go func() {
+		defer close(printed)
+		for ev := range events {
+			printCreateEvent(ev)
+		}
+	}()
+
+	opts := []vm.CreateOption{vm.WithProgress(events)}
+	if skip, _ := cmd.Flags().GetBool("skip-preflight"); skip {
+		opts = append(opts, vm.SkipPreflight())
+	}
+	if ensure, _ := cmd.Flags().GetBool("ensure"); ensure {
+		opts = append(opts, vm.Ensure())
+	}
+
+	result, err := vm.CreateFromConfig(cmd.Context(), config, opts...)
+	close(events)
+	<-printed
+	if errors.Is(err, vm.ErrPreflight) {
+		return fmt.Errorf("failed to create VM: %w (use --skip-preflight to create it anyway)", err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create VM: %w", err)
+	}
+
+	if result.Existed {
+		fmt.Printf("✓ VM %s already exists as configured\n", result.VMName)
+		return nil
+	}
+	fmt.Printf("✓ VM %s created successfully!\n", result.VMName)
+	return nil
+}
+
+func init() {
+	createCmd.Flags().Bool("dry-run", false, "Print the generated domain XML, cloud-init files and volumes without creating anything")
+	createCmd.Flags().Bool("print-xml", false, "Print the domain XML that would be defined without creating anything")
+	createCmd.Flags().Duration("ttl", 0, "Destroy the VM once this long has passed since creation (e.g. 2h)")
+	createCmd.Flags().Bool("rm", false, "Destroy the VM once it shuts down")
+	createCmd.Flags().BoolP("yes", "y", false, "Continue without asking when the configuration has warnings")
+	createCmd.Flags().Bool("with-my-key", false, "Authorize your default SSH public key (~/.ssh/id_*.pub) in the VM")
+	createCmd.Flags().Bool("ensure", false, "Succeed without changes if the VM already exists with the same spec")
+	addValuesFlags(createCmd)
+	createCmd.Flags().Bool("skip-preflight", false, "Create the VM even if its bridges, pool space or host CPUs and memory fail the preflight checks")
+}
+
+// printCreateEvent prints a step of a VM creation.
+func printCreateEvent(ev vm.CreateEvent) {
+	switch ev := ev.(type) {
+	case vm.VolumeCreated:
+		fmt.Printf("  ✓ Volume %s/%s created\n", ev.Pool, ev.Volume)
+	case vm.DomainDefined:
+		fmt.Println("  ✓ Domain defined")
+	case vm.Started:
+		fmt.Println("  ✓ VM started")
+	case vm.CleanupStarted:
+		fmt.Println("  ✗ Creation failed, removing what was created")
+	}
+}
+
+// printCreatePlan prints the artifacts of a create dry run.
+func printCreatePlan(plan *vm.CreatePlan) {
+	fmt.Printf("# VM: %s\n\n", plan.VMName)
+
+	fmt.Println("# Volumes")
+	for _, v := range plan.Volumes {
+		line := fmt.Sprintf("%s/%s (%s, %dGB)", v.Pool, v.Spec.Name, v.Spec.Format, v.Spec.CapacityGB)
+		if v.Spec.BackingVolume != "" {
+			line += " backed by " + v.Spec.BackingVolume
+		}
+		if v.Spec.SourceVolume != "" {
+			line += " copied from " + v.Spec.SourceVolume
+		}
+		fmt.Println(line)
+	}
+
+	fmt.Println("\n# Domain XML")
+	fmt.Println(strings.TrimRight(plan.DomainXML, "\n"))
+
+	if plan.UserData == "" {
+		fmt.Println("\n# cloud-init: not configured")
+		return
+	}
+	fmt.Println("\n# cloud-init user-data")
+	fmt.Println(strings.TrimRight(plan.UserData, "\n"))
+	fmt.Println("\n# cloud-init meta-data")
+	fmt.Println(strings.TrimRight(plan.MetaData, "\n"))
+	fmt.Println("\n# cloud-init network-config")
+	fmt.Println(strings.TrimRight(plan.NetworkConfig, "\n"))
+}
+
 var destroyCmd = &cobra.Command{
-	Use:   "destroy <vm-name>",
+	Use:   "destroy <vm-name> | -l <selector> --all",
 	Short: "Destroy a VM",
 	Long: `Destroy a virtual machine by name.
 
@@ -88,18 +390,146 @@ This will:
 - Gracefully shutdown the VM if running (5s timeout)
 - Force destroy if still running
 - Undefine the domain (with NVRAM cleanup)
-- Delete all storage volumes`,
-	Args: cobra.ExactArgs(1),
+- Delete all storage volumes
+- Verify no domain, volumes ({vm-name}_*) or tap interfaces remain
+
+If anything is left behind it is reported and the command fails. Use
+--force-clean to remove leftover volumes and tap interfaces automatically;
+it can also be re-run for a VM that is already gone to clean up its volumes.
+
+With -l, every VM whose labels match the selector is destroyed in turn
+instead; --all is required to confirm this. A VM that fails to be destroyed
+does not stop the others, and a summary is printed at the end. Selectors are
+comma-separated terms: key=value, key!=value, key in (a,b), key notin (a,b),
+key (label set) and !key (label not set).
+
+Examples:
+  foundry destroy my-vm
+  foundry destroy -l team=ci --all`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		vmName := args[0]
-		fmt.Printf("Destroying VM: %s\n", vmName)
+		forceClean, _ := cmd.Flags().GetBool("force-clean")
+		all, _ := cmd.Flags().GetBool("all")
+
+		if !cmd.Flags().Changed("selector") {
+			if all {
+				return fmt.Errorf("--all destroys the VMs matching --selector; set one")
+			}
+			if len(args) != 1 {
+				return fmt.Errorf("specify the VM to destroy or a --selector")
+			}
+			return destroyVM(cmd.Context(), args[0], forceClean)
+		}
 
-		ctx := context.Background()
-		if err := vm.Destroy(ctx, vmName); err != nil {
-			return fmt.Errorf("failed to destroy VM: %w", err)
+		if len(args) > 0 {
+			return fmt.Errorf("specify either a VM name or --selector, not both")
+		}
+		selector, err := parseSelector(cmd)
+		if err != nil {
+			return err
+		}
+		if len(selector) == 0 {
+			return fmt.Errorf("--selector is empty; it would match every VM")
+		}
+		if !all {
+			return fmt.Errorf("-l destroys every VM matching %q; re-run with --all to confirm", selector)
 		}
 
-		fmt.Println("✓ VM destroyed successfully!")
+		ctx := cmd.Context()
+		vms, err := vm.ListVMs(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list VMs: %w", err)
+		}
+		vms = vm.FilterByLabels(vms, selector)
+		if len(vms) == 0 {
+			fmt.Printf("No VMs match %q\n", selector)
+			return nil
+		}
+
+		var failed []string
+		for _, v := range vms {
+			if err := destroyVM(ctx, v.Name, forceClean); err != nil {
+				fmt.Fprintf(os.Stderr, "✗ %s: %v\n", v.Name, err)
+				failed = append(failed, v.Name)
+			}
+		}
+		fmt.Printf("\nDestroyed %d of %d VM(s)\n", len(vms)-len(failed), len(vms))
+		if len(failed) > 0 {
+			return fmt.Errorf("%d of %d VM(s) failed:\n  %s", len(failed), len(vms), strings.Join(failed, "\n  "))
+		}
+		return nil
+	},
+}
+
+// destroyVM destroys the named VM and reports what was left behind.
+func destroyVM(ctx context.Context, vmName string, forceClean bool) error {
+	fmt.Printf("Destroying VM: %s\n", vmName)
+
+	report, err := vm.Destroy(ctx, vmName, vm.DestroyOptions{ForceClean: forceClean})
+	if report != nil {
+		for _, item := range report.Cleaned {
+			fmt.Printf("  Removed leftover %s\n", item)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to destroy VM: %w", err)
+	}
+
+	if !report.Clean() {
+		fmt.Fprintln(os.Stderr, "Resources left behind:")
+		for _, item := range report.Leftovers() {
+			fmt.Fprintf(os.Stderr, "  - %s\n", item)
+		}
+		if forceClean {
+			return fmt.Errorf("VM %s destroyed but cleanup is incomplete", vmName)
+		}
+		return fmt.Errorf("VM %s destroyed but cleanup is incomplete (re-run with --force-clean)", vmName)
+	}
+
+	fmt.Println("✓ VM destroyed successfully!")
+	return nil
+}
+
+// parseSelector parses the --selector flag of cmd.
+func parseSelector(cmd *cobra.Command) (labels.Selector, error) {
+	value, _ := cmd.Flags().GetString("selector")
+	selector, err := labels.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --selector: %w", err)
+	}
+	return selector, nil
+}
+
+func init() {
+	destroyCmd.Flags().Bool("force-clean", false, "Remove volumes and tap interfaces left behind after destroy")
+	destroyCmd.Flags().StringP("selector", "l", "", "Destroy the VMs whose labels match this selector (e.g. team=ci); requires --all")
+	destroyCmd.Flags().Bool("all", false, "Confirm destroying every VM matching --selector")
+}
+
+var reapCmd = &cobra.Command{
+	Use:   "reap",
+	Short: "Destroy expired and stopped ephemeral VMs",
+	Long: `Destroy VMs that are no longer wanted, including their storage:
+  - VMs whose TTL (spec.ttl or create --ttl) has expired
+  - ephemeral VMs (spec.ephemeral or create --rm) that have shut down
+
+'foundry serve' reaps periodically; without the daemon, run this command from
+cron or a systemd timer, e.g.:
+
+  */5 * * * * foundry reap`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		reaped, err := vm.Reap(ctx)
+		for _, r := range reaped {
+			fmt.Printf("✓ VM %s destroyed (%s)\n", r.Name, r.Reason)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to reap VMs: %w", err)
+		}
+		if len(reaped) == 0 {
+			fmt.Println("No VMs to reap")
+		}
 		return nil
 	},
 }
@@ -113,28 +543,76 @@ Shows VM name, phase, IP address, CPUs, memory, and age.
 
 Output formats:
   -o table  Human-readable table (default)
+  -o wide   Table with boot image, CPU mode, networks, autostart and owner
   -o yaml   Full YAML resource definitions
-  -o json   Full JSON resource definitions`,
+  -o json   Full JSON resource definitions
+  -o jsonpath=TEMPLATE     Fields selected by a JSONPath template
+  -o go-template=TEMPLATE  Output of a Go template
+
+Templates see a VirtualMachineList, so iterate over .items:
+  foundry list -o jsonpath='{range .items[*]}{.metadata.name}{"\t"}{.status.phase}{"\n"}{end}'
+
+-l/--selector shows only VMs whose labels (metadata.labels) match a selector
+of comma-separated terms: key=value, key!=value, key in (a,b),
+key notin (a,b), key (label set) and !key (label not set).
+
+--owner and --annotation show only VMs with matching annotations (see
+'foundry annotate'). "owner" and "note" are short for the standard
+foundry.cofront.xyz/owner and foundry.cofront.xyz/note keys.
+
+-w/--watch keeps running after the list is printed and prints each VM again
+when it is added, deleted or its phase, addresses or spec change, until
+interrupted (Ctrl+C). Changes are picked up from libvirt's lifecycle events as
+they happen and by listing the VMs every few seconds, which catches addresses
+leased over DHCP and works where events are unavailable.
+
+Examples:
+  foundry list -w
+  foundry list -l env=prod
+  foundry list -l 'env in (prod,staging),!experimental'
+  foundry list --owner jane
+  foundry list --annotation ticket=OPS-123`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Validate output format
-		if err := output.ValidateFormat(outputFormat); err != nil {
+		// Create formatter (validates the format before connecting)
+		formatter, err := newOutputFormatter()
+		if err != nil {
 			return err
 		}
 
-		ctx := context.Background()
-		vms, err := vm.ListVMs(ctx)
+		labelSelector, err := parseSelector(cmd)
 		if err != nil {
-			return fmt.Errorf("failed to list VMs: %w", err)
+			return err
 		}
-
-		// Create formatter
-		formatter, err := output.NewFormatter(output.Options{
-			Format:    output.Format(outputFormat),
-			NoHeaders: noHeaders,
-		})
+		annotations, err := cmd.Flags().GetStringToString("annotation")
 		if err != nil {
 			return err
 		}
+		selector := make(map[string]string, len(annotations)+1)
+		for key, value := range annotations {
+			selector[key] = value
+		}
+		if cmd.Flags().Changed("owner") {
+			owner, _ := cmd.Flags().GetString("owner")
+			selector["owner"] = owner
+		}
+
+		filter := func(vms []*v1alpha1.VirtualMachine) []*v1alpha1.VirtualMachine {
+			if len(selector) > 0 {
+				vms = vm.FilterByAnnotations(vms, selector)
+			}
+			return vm.FilterByLabels(vms, labelSelector)
+		}
+
+		if watch, _ := cmd.Flags().GetBool("watch"); watch {
+			return watchVMs(cmd, filter)
+		}
+
+		ctx := cmd.Context()
+		vms, err := vm.ListVMs(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list VMs: %w", err)
+		}
+		vms = filter(vms)
 
 		// Format and print
 		result, err := formatter.FormatVMList(vms)
@@ -147,6 +625,138 @@ Output formats:
 	},
 }
 
+func init() {
+	listCmd.Flags().StringP("selector", "l", "", "Only list VMs whose labels match this selector (e.g. env=prod,tier!=db)")
+	listCmd.Flags().String("owner", "", "Only list VMs owned by this owner")
+	listCmd.Flags().StringToString("annotation", nil, "Only list VMs with this annotation (key=value, repeatable)")
+	listCmd.Flags().BoolP("watch", "w", false, "After listing the VMs, print them again as they change until interrupted")
+}
+
+// watchVMs lists the VMs that filter keeps and prints each change to them
+// until interrupted. Tables get their header once and a row per change;
+// other formats print each changed VM.
+func watchVMs(cmd *cobra.Command, filter func([]*v1alpha1.VirtualMachine) []*v1alpha1.VirtualMachine) error {
+	format, tmpl, err := output.ParseFormat(outputFormat)
+	if err != nil {
+		return err
+	}
+	// Rows after the first listing have no header of their own
+	rows, err := output.NewFormatter(output.Options{Format: format, NoHeaders: true, Template: tmpl})
+	if err != nil {
+		return err
+	}
+	first, err := newOutputFormatter()
+	if err != nil {
+		return err
+	}
+	tabular := format == output.FormatTable || format == output.FormatWide
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+	defer stop()
+
+	listed := false
+	var printErr error
+	err = vm.WatchVMs(ctx, func(changes []vm.WatchEvent) {
+		var vms []*v1alpha1.VirtualMachine
+		for _, change := range changes {
+			changed := change.VM
+			if change.Type == vm.WatchDeleted {
+				// Show the deletion in the PHASE column
+				changed = changed.DeepCopy()
+				changed.Status.Phase = "Deleted"
+			}
+			vms = append(vms, changed)
+		}
+		vms = filter(vms)
+
+		formatter := rows
+		if !listed {
+			formatter = first
+			listed = true
+		} else if len(vms) == 0 {
+			return
+		}
+
+		if tabular {
+			result, err := formatter.FormatVMList(vms)
+			if err != nil {
+				printErr = err
+				stop()
+				return
+			}
+			fmt.Print(result)
+			return
+		}
+		for _, changed := range vms {
+			result, err := formatter.FormatVM(changed)
+			if err != nil {
+				printErr = err
+				stop()
+				return
+			}
+			if format == output.FormatYAML {
+				fmt.Print("---\n")
+			}
+			fmt.Print(result)
+		}
+	})
+	if printErr != nil {
+		return fmt.Errorf("failed to format output: %w", printErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to watch VMs: %w", err)
+	}
+	return nil
+}
+
+// newOutputFormatter creates the formatter selected by the global --output
+// and --no-headers flags.
+func newOutputFormatter() (output.Formatter, error) {
+	format, tmpl, err := output.ParseFormat(outputFormat)
+	if err != nil {
+		return nil, err
+	}
+	return output.NewFormatter(output.Options{
+		Format:    format,
+		NoHeaders: noHeaders,
+		Template:  tmpl,
+	})
+}
+
+// newOutputPrinter creates the printer for resources other than VMs selected
+// by the global --output and --no-headers flags.
+func newOutputPrinter() (*output.Printer, error) {
+	format, tmpl, err := output.ParseFormat(outputFormat)
+	if err != nil {
+		return nil, err
+	}
+	return output.NewPrinter(output.Options{
+		Format:    format,
+		NoHeaders: noHeaders,
+		Template:  tmpl,
+	})
+}
+
+// printObject prints a single resource in a structured output format.
+func printObject(printer *output.Printer, obj interface{}) error {
+	result, err := printer.FormatObject(obj)
+	if err != nil {
+		return fmt.Errorf("failed to format output: %w", err)
+	}
+	fmt.Print(result)
+	return nil
+}
+
+// printList prints a list of resources in a structured output format.
+func printList(printer *output.Printer, items interface{}) error {
+	result, err := printer.FormatList(items)
+	if err != nil {
+		return fmt.Errorf("failed to format output: %w", err)
+	}
+	fmt.Print(result)
+	return nil
+}
+
 var testConnCmd = &cobra.Command{
 	Use:   "test-conn",
 	Short: "Test libvirt connection",
@@ -217,16 +827,39 @@ quick VM creation without duplicating disk space.`,
 }
 
 func init() {
+	imageImportCmd.Flags().String("sha256", "", "Expected SHA-256 checksum of the image (URL imports)")
+	imageImportCmd.Flags().String("sha512", "", "Expected SHA-512 checksum of the image (URL imports)")
+	imageImportCmd.Flags().String("default-user", "", "Login user created by the image's cloud-init (e.g. fedora, ubuntu), used by 'foundry ssh'")
+	imageImportCmd.Flags().String("os-variant", "", "libosinfo short ID of the image's OS (e.g. fedora43, ubuntu24.04), recorded by VMs created from it")
+	imageImportCmd.Flags().StringToString("label", nil, "Label to record with the image (key=value, repeatable)")
+	imageImportCmd.Flags().String("compress", "", "Rewrite the image as a compressed qcow2 (zlib or zstd) before importing it")
+	imageImportCmd.Flags().Bool("sparsify", false, "Rewrite the image as a qcow2 without its zeroed clusters before importing it")
+	imageListCmd.Flags().StringToString("label", nil, "Only list images with this label (key=value, repeatable)")
+	imagePullCmd.Flags().String("name", "", "Image name to import as (default: <alias>.qcow2)")
+	imageDeleteCmd.Flags().Bool("force", false, "Delete the image even if VM volumes are backed by it")
+
 	imageCmd.AddCommand(imageImportCmd)
+	imageCmd.AddCommand(imagePullCmd)
+	imageCmd.AddCommand(imageCatalogCmd)
 	imageCmd.AddCommand(imageListCmd)
 	imageCmd.AddCommand(imageDeleteCmd)
 	imageCmd.AddCommand(imageInfoCmd)
+	imageCmd.AddCommand(imageCheckCmd)
 }
 
 var imageImportCmd = &cobra.Command{
-	Use:   "import <source-path> <name>",
+	Use:   "import <source-path|url> <name>",
 	Short: "Import an image into the foundry-images pool",
-	Long: `Import a base OS image from a local file into the foundry-images pool.
+	Long: `Import a base OS image from a local file or HTTP(S) URL into the
+foundry-images pool.
+
+URLs are downloaded with progress reporting. An interrupted download is kept
+in ~/.cache/foundry/downloads and resumed when the command is re-run. Use
+--sha256 or --sha512 to verify the download before it is imported.
+
+--default-user records the login user the image's cloud-init creates (e.g.
+fedora, ubuntu, debian or cloud-user). VMs created from the image remember it
+and 'foundry ssh' logs in as that user.
 
 The image file must be in QCOW2 or bootable RAW format. The image name must
 include the correct file extension (.qcow2 or .raw) matching the actual format.
@@ -238,6 +871,17 @@ The tool validates that:
 
 This ensures only valid, bootable OS images are imported.
 
+The image's source, checksum and import time are recorded with it, along
+with the --default-user, --os-variant and --label values given, and shown by
+'foundry image info'. VMs created from the image record its default user and
+OS variant.
+
+To keep the foundry-images pool small, --compress zlib|zstd and --sparsify
+rewrite the image with qemu-img (which must be installed) before importing
+it: --sparsify drops the clusters that hold only zeros and --compress also
+compresses the rest. The rewritten image is a qcow2, so the image name must
+end in .qcow2 even for a RAW source. The sizes before and after are printed.
+
 Examples:
   # Import a QCOW2 image
   foundry image import /path/to/fedora-43.qcow2 fedora-43.qcow2
@@ -245,6 +889,20 @@ Examples:
   # Import a bootable RAW image
   foundry image import /path/to/ubuntu-24.04.raw ubuntu-24.04.raw
 
+  # Download and import an image, verifying its checksum
+  foundry image import https://example.com/fedora-43.qcow2 fedora-43.qcow2 \
+    --sha256 3f5a...e9c1
+
+  # Record the image's login user for 'foundry ssh'
+  foundry image import /path/to/noble.img noble.qcow2 --default-user ubuntu
+
+  # Record the image's OS and labels
+  foundry image import /path/to/noble.img noble.qcow2 --os-variant ubuntu24.04 \
+    --label team=infra --label channel=stable
+
+  # Import a RAW image as a compressed qcow2
+  foundry image import /path/to/disk.raw disk.qcow2 --compress zstd
+
   # This will fail - extension required
   foundry image import /path/to/fedora.qcow2 fedora
 
@@ -255,10 +913,16 @@ Examples:
 		sourcePath := args[0]
 		imageName := args[1]
 
+		if osVariant, _ := cmd.Flags().GetString("os-variant"); osVariant != "" {
+			if _, err := libvirt.OSInfoID(osVariant); err != nil {
+				return err
+			}
+		}
+
 		fmt.Printf("Importing image from %s as %s...\n", sourcePath, imageName)
 
 		// Connect to libvirt
-		ctx := context.Background()
+		ctx := cmd.Context()
 		client, err := libvirt.Connect("", 5*time.Second)
 		if err != nil {
 			return fmt.Errorf("failed to connect to libvirt: %w", err)
@@ -277,6 +941,15 @@ Examples:
 			return fmt.Errorf("failed to ensure default pools: %w", err)
 		}
 
+		// An image being imported already has its volume, so check this first
+		inProgress, err := mgr.ImportInProgress(ctx, imageName)
+		if err != nil {
+			return err
+		}
+		if inProgress {
+			return fmt.Errorf("image %s: %w", imageName, storage.ErrImportInProgress)
+		}
+
 		// Check if image already exists
 		exists, err := mgr.ImageExists(ctx, imageName)
 		if err != nil {
@@ -286,8 +959,31 @@ Examples:
 			return fmt.Errorf("image %s already exists", imageName)
 		}
 
+		importOpts := storage.ImportOptions{Report: printRewriteReport}
+		importOpts.Compression, _ = cmd.Flags().GetString("compress")
+		importOpts.Sparsify, _ = cmd.Flags().GetBool("sparsify")
+		importOpts.Metadata.DefaultUser, _ = cmd.Flags().GetString("default-user")
+		importOpts.Metadata.OSVariant, _ = cmd.Flags().GetString("os-variant")
+		importOpts.Metadata.Labels, err = cmd.Flags().GetStringToString("label")
+		if err != nil {
+			return err
+		}
+
 		// Import the image
-		if err := mgr.ImportImage(ctx, sourcePath, imageName); err != nil {
+		if strings.HasPrefix(sourcePath, "http://") || strings.HasPrefix(sourcePath, "https://") {
+			sha256sum, _ := cmd.Flags().GetString("sha256")
+			sha512sum, _ := cmd.Flags().GetString("sha512")
+			err = mgr.ImportImageFromURL(ctx, sourcePath, imageName, storage.URLImportOptions{
+				SHA256:        sha256sum,
+				SHA512:        sha512sum,
+				Progress:      printDownloadProgress,
+				ImportOptions: importOpts,
+			})
+			fmt.Println()
+		} else {
+			err = mgr.ImportImageWithOptions(ctx, sourcePath, imageName, importOpts)
+		}
+		if err != nil {
 			return fmt.Errorf("failed to import image: %w", err)
 		}
 
@@ -296,15 +992,141 @@ Examples:
 	},
 }
 
+// printDownloadProgress prints image download progress on a single line.
+func printDownloadProgress(p storage.DownloadProgress) {
+	const mib = 1024 * 1024
+	if p.Total > 0 {
+		fmt.Printf("\r  %.1f / %.1f MiB (%5.1f%%)", float64(p.Downloaded)/mib, float64(p.Total)/mib, p.Percent())
+		return
+	}
+	fmt.Printf("\r  %.1f MiB", float64(p.Downloaded)/mib)
+}
+
+// printRewriteReport prints how much rewriting an image on import saved.
+func printRewriteReport(r storage.RewriteReport) {
+	const mib = 1024 * 1024
+	saved := 0.0
+	if r.Before > 0 {
+		saved = 100 * (1 - float64(r.After)/float64(r.Before))
+	}
+	fmt.Printf("  Rewritten: %.1f MiB -> %.1f MiB (%.0f%% smaller)\n", float64(r.Before)/mib, float64(r.After)/mib, saved)
+}
+
+var imagePullCmd = &cobra.Command{
+	Use:   "pull <alias>",
+	Short: "Download a well-known cloud image into the foundry-images pool",
+	Long: `Download a well-known distribution cloud image by alias and import it into
+the foundry-images pool.
+
+The image is verified against the checksum file its distribution publishes
+before it is imported, and the distribution's default login user is recorded
+for 'foundry ssh'. Run 'foundry image catalog' to list available aliases.
+
+Examples:
+  # Pull Fedora 43 as fedora-43.qcow2
+  foundry image pull fedora-43
+
+  # Pull Debian 12 under a different name
+  foundry image pull debian-12 --name bookworm.qcow2`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		alias := args[0]
+		name, _ := cmd.Flags().GetString("name")
+
+		// Fail on unknown aliases before connecting to libvirt
+		if _, err := catalog.Lookup(alias); err != nil {
+			return err
+		}
+
+		// Connect to libvirt
+		ctx := cmd.Context()
+		client, err := libvirt.Connect("", 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("failed to connect to libvirt: %w", err)
+		}
+		defer func() {
+			if closeErr := client.Close(); closeErr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to close libvirt connection: %v\n", closeErr)
+			}
+		}()
+
+		// Create storage manager
+		mgr := storage.NewManager(client.Libvirt())
+
+		// Ensure default pools exist
+		if err := mgr.EnsureDefaultPools(ctx); err != nil {
+			return fmt.Errorf("failed to ensure default pools: %w", err)
+		}
+
+		fmt.Printf("Pulling %s...\n", alias)
+		imageName, err := catalog.Pull(ctx, mgr, alias, catalog.PullOptions{
+			Name:     name,
+			Progress: printDownloadProgress,
+		})
+		fmt.Println()
+		if err != nil {
+			return fmt.Errorf("failed to pull image: %w", err)
+		}
+
+		fmt.Printf("✓ Image %s pulled successfully\n", imageName)
+		return nil
+	},
+}
+
+var imageCatalogCmd = &cobra.Command{
+	Use:   "catalog",
+	Short: "List well-known images available to pull",
+	Long: `List the distribution cloud images that can be downloaded by alias with
+'foundry image pull'.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printer, err := newOutputPrinter()
+		if err != nil {
+			return err
+		}
+
+		images := catalog.List()
+		if !printer.Tabular() {
+			return printList(printer, images)
+		}
+
+		table := &output.Table{
+			Columns: []output.Column{{Name: "ALIAS"}, {Name: "DESCRIPTION"}, {Name: "USER"}, {Name: "OS", Wide: true}, {Name: "URL"}, {Name: "CHECKSUM", Wide: true}},
+		}
+		for _, image := range images {
+			table.Rows = append(table.Rows, []string{image.Alias, image.Description, image.DefaultUser, image.OSVariant, image.URL, image.ChecksumURL})
+		}
+		fmt.Print(printer.FormatTable(table))
+		return nil
+	},
+}
+
 var imageListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all images in the foundry-images pool",
 	Long: `List all base OS images stored in the foundry-images pool.
 
-Shows image name, format, size, and path for each image.`,
+Shows image name, format, size, OS variant and path for each image; -o wide
+adds the allocated size, default user and import time. --label only lists
+images with the given labels.
+
+Example:
+  foundry image list
+  foundry image list --label team=infra -o wide`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		// Create printer (validates the format before connecting)
+		printer, err := newOutputPrinter()
+		if err != nil {
+			return err
+		}
+
+		selector, err := cmd.Flags().GetStringToString("label")
+		if err != nil {
+			return err
+		}
+
 		// Connect to libvirt
-		ctx := context.Background()
+		ctx := cmd.Context()
 		client, err := libvirt.Connect("", 5*time.Second)
 		if err != nil {
 			return fmt.Errorf("failed to connect to libvirt: %w", err)
@@ -324,31 +1146,55 @@ Shows image name, format, size, and path for each image.`,
 		}
 
 		// List images
-		images, err := mgr.ListImages(ctx)
+		volumes, err := mgr.ListImages(ctx)
 		if err != nil {
 			return fmt.Errorf("failed to list images: %w", err)
 		}
 
+		images := make([]imageDetails, 0, len(volumes))
+		for _, volume := range volumes {
+			meta, err := mgr.GetImageMetadata(ctx, volume.Name)
+			if err != nil {
+				return fmt.Errorf("failed to get image metadata: %w", err)
+			}
+			if !hasLabels(meta.Labels, selector) {
+				continue
+			}
+			images = append(images, imageDetails{VolumeInfo: volume, ImageMetadata: *meta})
+		}
+
+		if !printer.Tabular() {
+			return printList(printer, images)
+		}
 		if len(images) == 0 {
 			fmt.Println("No images found in foundry-images pool")
 			return nil
 		}
 
-		// Print table header
-		fmt.Printf("%-30s %-10s %10s  %s\n", "NAME", "FORMAT", "SIZE", "PATH")
-		fmt.Println(strings.Repeat("-", 100))
-
-		// Print each image
+		table := &output.Table{
+			Columns: []output.Column{
+				{Name: "NAME"}, {Name: "FORMAT"}, {Name: "SIZE"}, {Name: "ALLOCATED", Wide: true}, {Name: "OS"},
+				{Name: "USER", Wide: true}, {Name: "IMPORTED", Wide: true}, {Name: "PATH"},
+			},
+			Footer: []string{fmt.Sprintf("Total: %d image(s)", len(images))},
+		}
 		for _, img := range images {
-			fmt.Printf("%-30s %-10s %8.1fGB  %s\n",
+			imported := ""
+			if !img.ImportedAt.IsZero() {
+				imported = img.ImportedAt.Local().Format(time.DateTime)
+			}
+			table.Rows = append(table.Rows, []string{
 				img.Name,
-				img.Format,
-				img.CapacityGB(),
+				string(img.Format),
+				fmt.Sprintf("%.1fGB", img.CapacityGB()),
+				fmt.Sprintf("%.1fGB", img.AllocationGB()),
+				img.OSVariant,
+				img.DefaultUser,
+				imported,
 				img.Path,
-			)
+			})
 		}
-
-		fmt.Printf("\nTotal: %d image(s)\n", len(images))
+		fmt.Print(printer.FormatTable(table))
 		return nil
 	},
 }
@@ -358,19 +1204,23 @@ var imageDeleteCmd = &cobra.Command{
 	Short: "Delete an image from the foundry-images pool",
 	Long: `Delete a base OS image from the foundry-images pool.
 
-Warning: This will permanently delete the image. VMs that use this image
-as a backing file may become unusable.
+VM disks are qcow2 overlays on their image, so an image is not deleted while
+any volume's backing chain includes it (the VMs using it, and their linked
+clones, are listed). --force deletes it anyway: the dependent VMs will no
+longer start.
 
 Example:
-  foundry image delete fedora-43`,
+  foundry image delete fedora-43
+  foundry image delete fedora-43 --force`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		imageName := args[0]
+		force, _ := cmd.Flags().GetBool("force")
 
 		fmt.Printf("Deleting image %s...\n", imageName)
 
 		// Connect to libvirt
-		ctx := context.Background()
+		ctx := cmd.Context()
 		client, err := libvirt.Connect("", 5*time.Second)
 		if err != nil {
 			return fmt.Errorf("failed to connect to libvirt: %w", err)
@@ -399,7 +1249,10 @@ Example:
 		}
 
 		// Delete the image
-		if err := mgr.DeleteImage(ctx, imageName, false); err != nil {
+		if err := mgr.DeleteImage(ctx, imageName, force); err != nil {
+			if errors.Is(err, storage.ErrImageInUse) {
+				return fmt.Errorf("failed to delete image: %w (use --force to delete it anyway)", err)
+			}
 			return fmt.Errorf("failed to delete image: %w", err)
 		}
 
@@ -408,21 +1261,47 @@ Example:
 	},
 }
 
+// hasLabels reports whether labels include every key/value of selector.
+func hasLabels(labels, selector map[string]string) bool {
+	for key, value := range selector {
+		if v, ok := labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// imageDetails is the structured output of 'foundry image info' and
+// 'foundry image list'.
+type imageDetails struct {
+	storage.VolumeInfo    `yaml:",inline"`
+	storage.ImageMetadata `yaml:",inline"`
+}
+
 var imageInfoCmd = &cobra.Command{
 	Use:   "info <name>",
 	Short: "Show detailed information about an image",
 	Long: `Display detailed information about a base OS image in the foundry-images pool.
 
-Shows image name, format, capacity, allocation, path, and other metadata.
+Shows image name, format, capacity, allocation, path, and the recorded
+metadata: default login user, OS variant, labels, and where and when the
+image was imported from, with its checksum.
 
 Example:
-  foundry image info fedora-43`,
+  foundry image info fedora-43
+  foundry image info fedora-43 -o json`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		imageName := args[0]
 
+		// Create printer (validates the format before connecting)
+		printer, err := newOutputPrinter()
+		if err != nil {
+			return err
+		}
+
 		// Connect to libvirt
-		ctx := context.Background()
+		ctx := cmd.Context()
 		client, err := libvirt.Connect("", 5*time.Second)
 		if err != nil {
 			return fmt.Errorf("failed to connect to libvirt: %w", err)
@@ -468,6 +1347,15 @@ Example:
 			return fmt.Errorf("image %s not found", imageName)
 		}
 
+		meta, err := mgr.GetImageMetadata(ctx, imageName)
+		if err != nil {
+			return fmt.Errorf("failed to get image metadata: %w", err)
+		}
+
+		if !printer.Tabular() {
+			return printObject(printer, imageDetails{VolumeInfo: *imageInfo, ImageMetadata: *meta})
+		}
+
 		// Print image details
 		fmt.Printf("Image: %s\n", imageInfo.Name)
 		fmt.Printf("Pool: %s\n", imageInfo.Pool)
@@ -475,8 +1363,127 @@ Example:
 		fmt.Printf("Type: %s\n", imageInfo.Type)
 		fmt.Printf("Capacity: %.2f GB (%d bytes)\n", imageInfo.CapacityGB(), imageInfo.Capacity)
 		fmt.Printf("Allocation: %.2f GB (%d bytes)\n", imageInfo.AllocationGB(), imageInfo.Allocation)
+		fmt.Printf("Saved: %.2f GB (%.0f%%)\n", imageInfo.SavedGB(), imageInfo.SavedPercent())
 		fmt.Printf("Path: %s\n", imageInfo.Path)
+		defaultUser := meta.DefaultUser
+		if defaultUser == "" {
+			defaultUser = "(unknown)"
+		}
+		fmt.Printf("Default user: %s\n", defaultUser)
+		if meta.OSVariant != "" {
+			fmt.Printf("OS variant: %s\n", meta.OSVariant)
+		}
+		if len(meta.Labels) > 0 {
+			keys := make([]string, 0, len(meta.Labels))
+			for key := range meta.Labels {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			fmt.Println("Labels:")
+			for _, key := range keys {
+				fmt.Printf("  %s=%s\n", key, meta.Labels[key])
+			}
+		}
+		if meta.Source != "" {
+			fmt.Printf("Source: %s\n", meta.Source)
+		}
+		if meta.Checksum != "" {
+			fmt.Printf("Checksum: %s\n", meta.Checksum)
+		}
+		if !meta.ImportedAt.IsZero() {
+			fmt.Printf("Imported: %s\n", meta.ImportedAt.Local().Format(time.RFC3339))
+		}
+
+		return nil
+	},
+}
+
+var imageCheckCmd = &cobra.Command{
+	Use:   "check <name>",
+	Short: "Check an image for corruption",
+	Long: `Check the consistency of a base OS image with qemu-img check.
+
+Reports corruptions and leaked clusters, and for qcow2 images how many
+clusters are allocated, compressed and fragmented. Leaked clusters waste
+space but are harmless; corruptions make the command fail.
+
+qemu-img must be installed and reads the image file directly, so the
+foundry-images pool must be on this host.
+
+Example:
+  foundry image check fedora-43.qcow2
+  foundry image check fedora-43.qcow2 -o json`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		imageName := args[0]
+
+		// Create printer (validates the format before connecting)
+		printer, err := newOutputPrinter()
+		if err != nil {
+			return err
+		}
 
+		// Connect to libvirt
+		ctx := cmd.Context()
+		client, err := libvirt.Connect("", 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("failed to connect to libvirt: %w", err)
+		}
+		defer func() {
+			if closeErr := client.Close(); closeErr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to close libvirt connection: %v\n", closeErr)
+			}
+		}()
+
+		// Create storage manager
+		mgr := storage.NewManager(client.Libvirt())
+
+		// Ensure default pools exist
+		if err := mgr.EnsureDefaultPools(ctx); err != nil {
+			return fmt.Errorf("failed to ensure default pools: %w", err)
+		}
+
+		// Check if image exists
+		exists, err := mgr.ImageExists(ctx, imageName)
+		if err != nil {
+			return fmt.Errorf("failed to check if image exists: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("image %s not found", imageName)
+		}
+
+		check, err := mgr.CheckImage(ctx, imageName)
+		if err != nil {
+			return fmt.Errorf("failed to check image: %w", err)
+		}
+
+		if !printer.Tabular() {
+			if err := printObject(printer, check); err != nil {
+				return err
+			}
+		} else {
+			fmt.Printf("Image: %s\n", imageName)
+			fmt.Printf("Format: %s\n", check.Format)
+			fmt.Printf("Corruptions: %d\n", check.Corruptions)
+			fmt.Printf("Leaked clusters: %d\n", check.Leaks)
+			if check.TotalClusters > 0 {
+				fmt.Printf("Allocated clusters: %d/%d (%.0f%%)\n", check.AllocatedClusters, check.TotalClusters,
+					100*float64(check.AllocatedClusters)/float64(check.TotalClusters))
+			}
+			if check.AllocatedClusters > 0 {
+				fmt.Printf("Compressed clusters: %d (%.0f%%)\n", check.CompressedClusters,
+					100*float64(check.CompressedClusters)/float64(check.AllocatedClusters))
+				fmt.Printf("Fragmented clusters: %d (%.0f%%)\n", check.FragmentedClusters,
+					100*float64(check.FragmentedClusters)/float64(check.AllocatedClusters))
+			}
+			if check.ImageEndOffset > 0 {
+				fmt.Printf("Size on disk: %.2f GB\n", float64(check.ImageEndOffset)/(1024*1024*1024))
+			}
+		}
+
+		if !check.OK() {
+			return fmt.Errorf("image %s has %d corruptions", imageName, check.Corruptions)
+		}
 		return nil
 	},
 }
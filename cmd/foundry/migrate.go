@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate <vm-name> --to <uri>",
+	Short: "Move a VM to another hypervisor",
+	Long: `Move a VM to the hypervisor at the --to connection URI.
+
+A running VM is live migrated and keeps running. The migration is
+peer-to-peer: the libvirt daemon of the source host connects to the --to URI
+itself, so the URI must work from the source host (e.g., root there needs
+ssh access to the destination for qemu+ssh://). A stopped VM is migrated
+offline.
+
+Unless --shared-storage is given, the VM's volumes are copied to the same
+storage pool on the destination, flattened so they do not need the base
+image, and deleted from the source afterwards; for a running VM libvirt
+copies the disks while it runs. With --shared-storage the destination must
+see the volumes at the same paths, and nothing is copied.
+
+The stored spec and autostart are set on the destination, and the VM is
+undefined on the source. VMs with snapshots cannot be migrated.
+
+Examples:
+  foundry migrate web-1 --to qemu+ssh://root@hv2/system
+  foundry migrate web-1 --to qemu+tls://hv2/system --shared-storage
+  foundry migrate db-1 --to qemu+ssh://root@hv2/system --bandwidth 200`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		opts := vm.MigrateOptions{}
+		opts.To, _ = cmd.Flags().GetString("to")
+		opts.SharedStorage, _ = cmd.Flags().GetBool("shared-storage")
+		opts.Bandwidth, _ = cmd.Flags().GetUint64("bandwidth")
+
+		// Ctrl+C aborts the migration; the VM stays on the source
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+
+		fmt.Printf("Migrating VM %s to %s...\n", vmName, opts.To)
+		result, err := vm.MigrateVM(ctx, vmName, opts)
+		if err != nil {
+			return fmt.Errorf("failed to migrate VM: %w", err)
+		}
+
+		kind := "offline"
+		if result.Live {
+			kind = "live"
+		}
+		fmt.Printf("✓ VM %s migrated to %s (%s, %d volume(s) copied)\n", vmName, opts.To, kind, len(result.Volumes))
+		return nil
+	},
+}
+
+func init() {
+	migrateCmd.Flags().String("to", "", "Connection URI of the destination hypervisor (e.g., qemu+ssh://root@hv2/system)")
+	migrateCmd.Flags().Bool("shared-storage", false, "The hosts share the VM's storage: migrate without copying the volumes")
+	migrateCmd.Flags().Uint64("bandwidth", 0, "Maximum migration bandwidth in MiB/s (0 is libvirt's default)")
+	_ = migrateCmd.MarkFlagRequired("to")
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/sshkey"
+)
+
+// addMyKey adds the user's default SSH public key to the configuration's
+// cloud-init keys when --with-my-key is given or, without the flag, when
+// defaults.withMyKey is set in the CLI config.
+func addMyKey(cmd *cobra.Command, config *v1alpha1.VirtualMachine) error {
+	withMyKey, _ := cmd.Flags().GetBool("with-my-key")
+	if !cmd.Flags().Changed("with-my-key") {
+		cfg, _, err := loadClientConfig()
+		if err != nil {
+			return err
+		}
+		withMyKey = cfg.Defaults.WithMyKey
+	}
+	if !withMyKey {
+		return nil
+	}
+
+	if ci := config.Spec.CloudInit; ci != nil && ci.RawUserData != "" {
+		fmt.Fprintln(os.Stderr, "Warning: not adding your SSH key; spec.cloudInit.rawUserData replaces the generated user-data")
+		return nil
+	}
+
+	key, err := sshkey.DefaultPublicKey()
+	if err != nil {
+		return fmt.Errorf("--with-my-key: %w", err)
+	}
+	config.AddSSHAuthorizedKey(key)
+	return nil
+}
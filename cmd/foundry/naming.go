@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jbweber/foundry/internal/naming"
+)
+
+// configureNaming sets the naming strategy of new VMs from naming in the CLI
+// config.
+func configureNaming() error {
+	cfg, path, err := loadClientConfig()
+	if err != nil {
+		return err
+	}
+	if err := cfg.Naming.Validate(); err != nil {
+		return fmt.Errorf("invalid naming strategy in %s: %w", path, err)
+	}
+	naming.SetDefaultStrategy(cfg.Naming)
+	return nil
+}
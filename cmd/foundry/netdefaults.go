@@ -0,0 +1,16 @@
+package main
+
+import (
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+// addNetworkDefaults fills the network defaults the configuration does not
+// set from defaults.networkDefaults in the CLI config.
+func addNetworkDefaults(config *v1alpha1.VirtualMachine) error {
+	cfg, _, err := loadClientConfig()
+	if err != nil {
+		return err
+	}
+	config.InheritNetworkDefaults(cfg.Defaults.NetworkDefaults)
+	return nil
+}
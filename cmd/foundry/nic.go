@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+// Network interface management commands
+var nicCmd = &cobra.Command{
+	Use:   "nic",
+	Short: "Manage VM network interfaces",
+	Long: `Add network interfaces to and remove them from virtual machines.
+
+Interfaces are identified by their IP address, MAC address or host tap
+interface name (as shown by 'foundry get <vm> -o yaml').`,
+}
+
+func init() {
+	nicCmd.AddCommand(nicAttachCmd)
+	nicCmd.AddCommand(nicDetachCmd)
+
+	nicAttachCmd.Flags().String("ip", "", "IPv4 address in CIDR notation (e.g. 10.250.250.20/24)")
+	nicAttachCmd.Flags().String("gateway", "", "IPv4 gateway (required with --ip)")
+	nicAttachCmd.Flags().String("ipv6", "", "IPv6 address in CIDR notation")
+	nicAttachCmd.Flags().String("ipv6-gateway", "", "IPv6 gateway")
+	nicAttachCmd.Flags().Bool("dhcp", false, "Configure IPv4 by DHCP instead of --ip")
+	nicAttachCmd.Flags().String("bridge", "", "Host bridge to attach the interface to")
+	nicAttachCmd.Flags().String("bridge-type", "", "Kind of --bridge: linux (default) or openvswitch")
+	nicAttachCmd.Flags().String("network", "", "libvirt network to attach the interface to")
+	nicAttachCmd.Flags().String("macvtap", "", "Host network device to attach the interface to through macvtap")
+	nicAttachCmd.Flags().String("macvtap-mode", "", "macvtap mode: bridge (default) or private")
+	nicAttachCmd.Flags().String("sriov-pf", "", "SR-IOV network device whose virtual function to pass through")
+	nicAttachCmd.Flags().Int("sriov-vf", 0, "Index of the virtual function of --sriov-pf")
+	nicAttachCmd.Flags().Int("vlan", 0, "VLAN ID (1-4094) to put the interface in")
+	nicAttachCmd.Flags().Int("mtu", 0, "Interface MTU (default: that of the bridge or network)")
+	nicAttachCmd.Flags().Int("queues", 0, "Number of virtio-net queues (default: the VM's vCPU count)")
+	nicAttachCmd.Flags().String("mac", "", "MAC address (default: derived from --ip, or random for --dhcp)")
+	nicAttachCmd.Flags().StringSlice("dns", nil, "DNS server addresses")
+}
+
+var nicAttachCmd = &cobra.Command{
+	Use:   "attach <vm-name>",
+	Short: "Add a network interface to a VM",
+	Long: `Add a network interface to a VM, attached to a host bridge or libvirt network.
+
+The interface is validated like a spec.networkInterfaces entry; its MAC address
+and tap interface name are derived from its IP as for interfaces created with
+the VM (DHCP interfaces get a random MAC address). Running VMs get the
+interface hotplugged; stopped VMs have it on their next start. The interface
+is added to the stored VM spec and the cloud-init network-config is rewritten.
+
+cloud-init only applies network-config on the first boot of an instance, so a
+running guest has to configure the new interface itself (or re-run cloud-init
+with 'cloud-init clean' and a reboot).
+
+Examples:
+  foundry nic attach my-vm --bridge br1 --ip 10.1.0.20/24 --gateway 10.1.0.1
+  foundry nic attach my-vm --network default --dhcp
+  foundry nic attach my-vm --bridge br2 --dhcp --mac 52:54:00:12:34:56 --mtu 9000
+  foundry nic attach my-vm --bridge ovsbr0 --bridge-type openvswitch --vlan 100 --dhcp
+  foundry nic attach my-vm --macvtap eno1 --dhcp
+  foundry nic attach my-vm --sriov-pf enp1s0f0 --sriov-vf 3 --dhcp`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+
+		var iface v1alpha1.NetworkInterfaceSpec
+		iface.IP, _ = cmd.Flags().GetString("ip")
+		iface.Gateway, _ = cmd.Flags().GetString("gateway")
+		iface.IPv6, _ = cmd.Flags().GetString("ipv6")
+		iface.IPv6Gateway, _ = cmd.Flags().GetString("ipv6-gateway")
+		iface.DHCP, _ = cmd.Flags().GetBool("dhcp")
+		iface.Bridge, _ = cmd.Flags().GetString("bridge")
+		iface.BridgeType, _ = cmd.Flags().GetString("bridge-type")
+		iface.Network, _ = cmd.Flags().GetString("network")
+		iface.VLAN, _ = cmd.Flags().GetInt("vlan")
+		iface.MTU, _ = cmd.Flags().GetInt("mtu")
+		iface.Queues, _ = cmd.Flags().GetInt("queues")
+		iface.MACAddress, _ = cmd.Flags().GetString("mac")
+		if device, _ := cmd.Flags().GetString("macvtap"); device != "" {
+			mode, _ := cmd.Flags().GetString("macvtap-mode")
+			iface.Macvtap = &v1alpha1.MacvtapSpec{Device: device, Mode: mode}
+		}
+		if pf, _ := cmd.Flags().GetString("sriov-pf"); pf != "" {
+			vf, _ := cmd.Flags().GetInt("sriov-vf")
+			iface.SRIOV = &v1alpha1.SRIOVSpec{PF: pf, VF: vf}
+		}
+		iface.DNSServers, _ = cmd.Flags().GetStringSlice("dns")
+
+		fmt.Printf("Attaching network interface to VM %s...\n", vmName)
+
+		ctx := cmd.Context()
+		nic, err := vm.AttachNIC(ctx, vmName, iface)
+		if err != nil {
+			return fmt.Errorf("failed to attach network interface: %w", err)
+		}
+
+		fmt.Printf("✓ Interface %s (%s) attached\n", nic.InterfaceName, nic.MACAddress)
+		return nil
+	},
+}
+
+var nicDetachCmd = &cobra.Command{
+	Use:   "detach <vm-name> <ip|mac|interface>",
+	Short: "Remove a network interface from a VM",
+	Long: `Remove a network interface from a VM.
+
+Running VMs have the interface unplugged. The interface is removed from the
+stored VM spec and the cloud-init network-config is rewritten. A VM's last
+interface cannot be removed.
+
+Examples:
+  foundry nic detach my-vm 10.1.0.20
+  foundry nic detach my-vm be:ef:0a:01:00:14`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		id := args[1]
+
+		fmt.Printf("Detaching network interface %s from VM %s...\n", id, vmName)
+
+		ctx := cmd.Context()
+		if err := vm.DetachNIC(ctx, vmName, id); err != nil {
+			return fmt.Errorf("failed to detach network interface: %w", err)
+		}
+
+		fmt.Printf("✓ Interface %s detached\n", id)
+		return nil
+	},
+}
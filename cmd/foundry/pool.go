@@ -1,15 +1,14 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"os"
-	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/output"
 	"github.com/jbweber/foundry/internal/storage"
 )
 
@@ -26,6 +25,7 @@ two default pools: foundry-images (base OS images) and foundry-vms (VM disks).`,
 func init() {
 	poolCmd.AddCommand(poolListCmd)
 	poolCmd.AddCommand(poolInfoCmd)
+	poolCmd.AddCommand(poolVolumesCmd)
 	poolCmd.AddCommand(poolRefreshCmd)
 	poolCmd.AddCommand(poolAddCmd)
 	poolCmd.AddCommand(poolDeleteCmd)
@@ -36,9 +36,16 @@ var poolListCmd = &cobra.Command{
 	Short: "List all storage pools",
 	Long: `List all storage pools with their state and capacity information.
 
-Shows pool name, type, state, and storage capacity/usage for each pool.`,
+Shows pool name, type, state, and storage capacity/usage for each pool;
+-o wide adds the path and autostart setting.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		ctx := context.Background()
+		// Create printer (validates the format before connecting)
+		printer, err := newOutputPrinter()
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
 		client, err := libvirt.Connect("", 5*time.Second)
 		if err != nil {
 			return fmt.Errorf("failed to connect to libvirt: %w", err)
@@ -55,36 +62,41 @@ Shows pool name, type, state, and storage capacity/usage for each pool.`,
 			return fmt.Errorf("failed to list pools: %w", err)
 		}
 
+		if !printer.Tabular() {
+			return printList(printer, pools)
+		}
 		if len(pools) == 0 {
 			fmt.Println("No storage pools found")
 			return nil
 		}
 
-		// Print table header
-		fmt.Printf("%-20s %-10s %-10s %12s %12s %12s\n",
-			"NAME", "TYPE", "STATE", "CAPACITY", "ALLOCATED", "AVAILABLE")
-		fmt.Println(strings.Repeat("-", 88))
-
-		// Print each pool
+		table := &output.Table{
+			Columns: []output.Column{
+				{Name: "NAME"}, {Name: "TYPE"}, {Name: "STATE"},
+				{Name: "CAPACITY"}, {Name: "ALLOCATED"}, {Name: "AVAILABLE"},
+				{Name: "PATH", Wide: true}, {Name: "AUTOSTART", Wide: true},
+			},
+			Footer: []string{fmt.Sprintf("Total: %d pool(s)", len(pools)), "* Default pools"},
+		}
 		for _, pool := range pools {
 			// Mark default pools
 			name := pool.Name
-			if pool.Name == storage.DefaultImagesPool || pool.Name == storage.DefaultVMsPool {
+			if storage.IsDefaultPool(pool.Name) {
 				name = pool.Name + " *"
 			}
 
-			fmt.Printf("%-20s %-10s %-10s %10.1fGB %10.1fGB %10.1fGB\n",
+			table.Rows = append(table.Rows, []string{
 				name,
-				pool.Type,
+				string(pool.Type),
 				pool.State,
-				pool.CapacityGB(),
-				pool.AllocationGB(),
-				pool.AvailableGB(),
-			)
+				fmt.Sprintf("%.1fGB", pool.CapacityGB()),
+				fmt.Sprintf("%.1fGB", pool.AllocationGB()),
+				fmt.Sprintf("%.1fGB", pool.AvailableGB()),
+				pool.Path,
+				fmt.Sprint(pool.Autostart),
+			})
 		}
-
-		fmt.Printf("\nTotal: %d pool(s)\n", len(pools))
-		fmt.Println("* Default pools")
+		fmt.Print(printer.FormatTable(table))
 		return nil
 	},
 }
@@ -97,12 +109,19 @@ var poolInfoCmd = &cobra.Command{
 Shows pool name, type, path, state, UUID, and capacity/allocation details.
 
 Example:
-  foundry pool info foundry-images`,
+  foundry pool info foundry-images
+  foundry pool info foundry-images -o yaml`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		poolName := args[0]
 
-		ctx := context.Background()
+		// Create printer (validates the format before connecting)
+		printer, err := newOutputPrinter()
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
 		client, err := libvirt.Connect("", 5*time.Second)
 		if err != nil {
 			return fmt.Errorf("failed to connect to libvirt: %w", err)
@@ -125,6 +144,10 @@ Example:
 			return fmt.Errorf("failed to list volumes: %w", err)
 		}
 
+		if !printer.Tabular() {
+			return printObject(printer, poolDetails{PoolInfo: *poolInfo, Volumes: len(volumes)})
+		}
+
 		// Print pool details
 		fmt.Printf("Pool: %s\n", poolInfo.Name)
 		fmt.Printf("Type: %s\n", poolInfo.Type)
@@ -132,6 +155,9 @@ Example:
 		if poolInfo.Path != "" {
 			fmt.Printf("Path: %s\n", poolInfo.Path)
 		}
+		if poolInfo.Source != "" {
+			fmt.Printf("Source: %s\n", poolInfo.Source)
+		}
 		fmt.Printf("UUID: %s\n", poolInfo.UUID)
 		fmt.Printf("Capacity: %.2f GB (%d bytes)\n", poolInfo.CapacityGB(), poolInfo.Capacity)
 		fmt.Printf("Allocated: %.2f GB (%d bytes)\n", poolInfo.AllocationGB(), poolInfo.Allocation)
@@ -149,6 +175,90 @@ Example:
 	},
 }
 
+// poolDetails is the structured output of pool info.
+type poolDetails struct {
+	storage.PoolInfo `yaml:",inline"`
+
+	// Volumes is the number of volumes in the pool.
+	Volumes int `json:"volumes" yaml:"volumes"`
+}
+
+var poolVolumesCmd = &cobra.Command{
+	Use:   "volumes <name>",
+	Short: "List the volumes in a pool",
+	Long: `List the volumes in a storage pool with their capacity and allocation.
+
+SAVED is the part of a volume's capacity that is not allocated on the host.
+Thin-provisioned qcow2 volumes only allocate what the guest writes, and with
+discard enabled (the default, see spec.discard) space the guest frees is
+returned as well, once the guest trims its filesystems (cloudInit.fstrim).
+-o wide adds the volume path.
+
+Example:
+  foundry pool volumes foundry-vms
+  foundry pool volumes foundry-vms -o wide`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		poolName := args[0]
+
+		// Create printer (validates the format before connecting)
+		printer, err := newOutputPrinter()
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		client, err := libvirt.Connect("", 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("failed to connect to libvirt: %w", err)
+		}
+		defer func() {
+			if closeErr := client.Close(); closeErr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to close libvirt connection: %v\n", closeErr)
+			}
+		}()
+
+		mgr := storage.NewManager(client.Libvirt())
+		volumes, err := mgr.ListVolumes(ctx, poolName)
+		if err != nil {
+			return fmt.Errorf("failed to list volumes: %w", err)
+		}
+
+		if !printer.Tabular() {
+			return printList(printer, volumes)
+		}
+		if len(volumes) == 0 {
+			fmt.Printf("No volumes found in pool %s\n", poolName)
+			return nil
+		}
+
+		var capacity, saved uint64
+		table := &output.Table{
+			Columns: []output.Column{
+				{Name: "NAME"}, {Name: "FORMAT"},
+				{Name: "CAPACITY"}, {Name: "ALLOCATED"}, {Name: "SAVED"},
+				{Name: "PATH", Wide: true},
+			},
+		}
+		for _, vol := range volumes {
+			capacity += vol.Capacity
+			saved += vol.Saved()
+			table.Rows = append(table.Rows, []string{
+				vol.Name,
+				string(vol.Format),
+				fmt.Sprintf("%.1fGB", vol.CapacityGB()),
+				fmt.Sprintf("%.1fGB", vol.AllocationGB()),
+				fmt.Sprintf("%.1fGB (%.0f%%)", vol.SavedGB(), vol.SavedPercent()),
+				vol.Path,
+			})
+		}
+		total := storage.VolumeInfo{Capacity: capacity, Allocation: capacity - saved}
+		table.Footer = []string{fmt.Sprintf("Total: %d volume(s), %.1fGB saved (%.0f%%)", len(volumes), total.SavedGB(), total.SavedPercent())}
+		fmt.Print(printer.FormatTable(table))
+		return nil
+	},
+}
+
 var poolRefreshCmd = &cobra.Command{
 	Use:   "refresh <name>",
 	Short: "Refresh a storage pool",
@@ -163,7 +273,7 @@ Example:
 	RunE: func(cmd *cobra.Command, args []string) error {
 		poolName := args[0]
 
-		ctx := context.Background()
+		ctx := cmd.Context()
 		client, err := libvirt.Connect("", 5*time.Second)
 		if err != nil {
 			return fmt.Errorf("failed to connect to libvirt: %w", err)
@@ -185,32 +295,55 @@ Example:
 }
 
 var poolAddCmd = &cobra.Command{
-	Use:   "add <name> <type> <path>",
+	Use:   "add <name> <type> [path]",
 	Short: "Create a new storage pool",
 	Long: `Create a new storage pool with the specified name, type, and path.
 
-Currently only 'dir' (directory-based) pools are supported.
+Supported pool types:
+  dir      A directory on the host (path is the directory)
+  logical  An LVM volume group; volumes are logical volumes. Takes no path.
+           With --source-device, a new volume group is created on the
+           devices (refusing devices that already hold data); without, the
+           volume group named --source-name (default: the pool name) must
+           already exist.
+  fs       A filesystem on --source-device, mounted at path. The device
+           must already hold a filesystem (--source-format, default auto).
+  netfs    An NFS export (--source-host and --source-path), mounted at path.
+
+Logical pools only hold raw volumes: VMs on them need bootDisk.format: raw,
+and their boot disks are full copies of the image instead of qcow2 overlays.
 
 The pool will be:
   - Created and started immediately
   - Set to autostart on boot
-  - Owned by the qemu user (typically uid/gid 107)
+  - Owned by the qemu user (typically uid/gid 107), except logical pools
 
 Example:
-  foundry pool add my-pool dir /var/lib/libvirt/images/my-pool`,
-	Args: cobra.ExactArgs(3),
+  foundry pool add my-pool dir /var/lib/libvirt/images/my-pool
+  foundry pool add vg-vms logical --source-device /dev/sdb --source-device /dev/sdc
+  foundry pool add fast fs /var/lib/libvirt/fast --source-device /dev/nvme1n1p1 --source-format xfs
+  foundry pool add shared netfs /var/lib/libvirt/shared --source-host nfs.example.com --source-path /exports/vms`,
+	Args: cobra.RangeArgs(2, 3),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		poolName := args[0]
-		poolTypeStr := args[1]
-		poolPath := args[2]
-
-		// Validate pool type
-		poolType := storage.PoolType(poolTypeStr)
-		if poolType != storage.PoolTypeDir {
-			return fmt.Errorf("unsupported pool type: %s (only 'dir' is currently supported)", poolTypeStr)
+		spec := storage.PoolSpec{
+			Name: args[0],
+			Type: storage.PoolType(args[1]),
+		}
+		if len(args) == 3 {
+			spec.Path = args[2]
+		}
+		spec.SourceDevices, _ = cmd.Flags().GetStringSlice("source-device")
+		spec.SourceName, _ = cmd.Flags().GetString("source-name")
+		spec.SourceHost, _ = cmd.Flags().GetString("source-host")
+		spec.SourcePath, _ = cmd.Flags().GetString("source-path")
+		spec.SourceFormat, _ = cmd.Flags().GetString("source-format")
+
+		// Validate the spec before connecting
+		if err := spec.Validate(); err != nil {
+			return err
 		}
 
-		ctx := context.Background()
+		ctx := cmd.Context()
 		client, err := libvirt.Connect("", 5*time.Second)
 		if err != nil {
 			return fmt.Errorf("failed to connect to libvirt: %w", err)
@@ -223,17 +356,30 @@ Example:
 
 		mgr := storage.NewManager(client.Libvirt())
 
-		fmt.Printf("Creating pool %s (type: %s, path: %s)...\n", poolName, poolType, poolPath)
+		if spec.Path != "" {
+			fmt.Printf("Creating pool %s (type: %s, path: %s)...\n", spec.Name, spec.Type, spec.Path)
+		} else {
+			fmt.Printf("Creating pool %s (type: %s)...\n", spec.Name, spec.Type)
+		}
 
-		if err := mgr.CreatePool(ctx, poolName, poolType, poolPath); err != nil {
+		if err := mgr.CreatePool(ctx, spec); err != nil {
 			return fmt.Errorf("failed to create pool: %w", err)
 		}
 
-		fmt.Printf("✓ Pool %s created successfully\n", poolName)
+		invalidateContextCache()
+		fmt.Printf("✓ Pool %s created successfully\n", spec.Name)
 		return nil
 	},
 }
 
+func init() {
+	poolAddCmd.Flags().StringSlice("source-device", nil, "Source block device: physical volume (logical, repeatable) or device to mount (fs)")
+	poolAddCmd.Flags().String("source-name", "", "Volume group name (logical, default: the pool name)")
+	poolAddCmd.Flags().String("source-host", "", "NFS server (netfs)")
+	poolAddCmd.Flags().String("source-path", "", "Exported directory on the NFS server (netfs)")
+	poolAddCmd.Flags().String("source-format", "", "Filesystem type (fs: default auto, netfs: default nfs)")
+}
+
 var poolDeleteCmd = &cobra.Command{
 	Use:   "delete <name>",
 	Short: "Delete a storage pool",
@@ -255,7 +401,7 @@ Example:
 		poolName := args[0]
 		force, _ := cmd.Flags().GetBool("force")
 
-		ctx := context.Background()
+		ctx := cmd.Context()
 		client, err := libvirt.Connect("", 5*time.Second)
 		if err != nil {
 			return fmt.Errorf("failed to connect to libvirt: %w", err)
@@ -287,6 +433,7 @@ Example:
 			return fmt.Errorf("failed to delete pool: %w", err)
 		}
 
+		invalidateContextCache()
 		fmt.Printf("✓ Pool %s deleted successfully\n", poolName)
 		return nil
 	},
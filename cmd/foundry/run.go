@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/loader"
+	"github.com/jbweber/foundry/internal/runner"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run <config.yaml> -- <command> [args...]",
+	Short: "Run a command in a throwaway VM",
+	Long: `Create a VM, run a command in it over SSH, then destroy the VM.
+
+The VM is created from the configuration file, foundry waits until it accepts
+SSH connections on the address of its first network interface, runs the
+command with its output streamed to the terminal, and destroys the VM
+(including its storage) again. foundry exits with the command's exit status,
+so this can be used as a test-runner backend in CI.
+
+The ssh client from PATH is used with your SSH agent and --identity; the
+configuration must authorize the matching public key (cloudInit.sshAuthorizedKeys),
+or --with-my-key adds your default public key.
+Host keys are not checked since every VM is new. The command is interpreted
+by the remote login shell.
+
+Combine with metadata.generateName so concurrent runs get unique VMs.
+
+Examples:
+  foundry run ci-runner.yaml -- make test
+  foundry run ci-runner.yaml --user fedora -- 'cd /src && ./run-tests.sh'`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		dash := cmd.ArgsLenAtDash()
+		if dash != 1 || len(args) < 2 {
+			return fmt.Errorf("usage: foundry run <config.yaml> -- <command> [args...]")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configPath := args[0]
+		command := args[1:]
+
+		opts := runner.Options{
+			Stdin:  os.Stdin,
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+		}
+		opts.User, _ = cmd.Flags().GetString("user")
+		opts.IdentityFile, _ = cmd.Flags().GetString("identity")
+		opts.ReadyTimeout, _ = cmd.Flags().GetDuration("timeout")
+		opts.Keep, _ = cmd.Flags().GetBool("keep")
+
+		config, err := loader.LoadFromFile(cmd.Context(), configPath)
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		if err := addMyKey(cmd, config); err != nil {
+			return err
+		}
+		if err := addNetworkDefaults(config); err != nil {
+			return err
+		}
+		if err := confirmWarnings(cmd, config); err != nil {
+			return err
+		}
+
+		// Interrupting the run still destroys the VM
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		code, err := runner.Run(ctx, config, command, opts)
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			os.Exit(code)
+		}
+		return nil
+	},
+}
+
+func init() {
+	runCmd.Flags().String("user", runner.DefaultUser, "SSH user to run the command as")
+	runCmd.Flags().StringP("identity", "i", "", "SSH private key file")
+	runCmd.Flags().Duration("timeout", runner.DefaultReadyTimeout, "How long to wait for the VM to accept SSH connections")
+	runCmd.Flags().Bool("keep", false, "Keep the VM after the command finishes (for debugging)")
+	runCmd.Flags().BoolP("yes", "y", false, "Continue without asking when the configuration has warnings")
+	runCmd.Flags().Bool("with-my-key", false, "Authorize your default SSH public key (~/.ssh/id_*.pub) in the VM")
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/api"
+	"github.com/jbweber/foundry/internal/auth"
+	"github.com/jbweber/foundry/internal/cloudinit"
+	"github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metrics"
+	"github.com/jbweber/foundry/internal/server"
+	"github.com/jbweber/foundry/internal/systemd"
+	"github.com/jbweber/foundry/internal/vm"
+	"github.com/jbweber/foundry/internal/webhook"
+)
+
+var serveCmd = &cobra.Command{
+	Use:     "serve",
+	Aliases: []string{"daemon"},
+	Short:   "Run foundry as a daemon",
+	Long: `Run foundry as a long-running daemon on the hypervisor.
+
+The daemon serves health endpoints for supervision:
+  /healthz  Liveness - 200 while the process is serving requests
+  /readyz   Readiness - 200 only if libvirt is reachable
+
+and a REST API for managing VMs and images under /api/v1alpha1 (the OpenAPI
+description is at /api/v1alpha1/openapi.json):
+  GET    /vms                 List VMs
+  POST   /vms                 Create a VM from a VirtualMachine (JSON or YAML)
+  GET    /vms/{name}          Get a VM
+  DELETE /vms/{name}          Destroy a VM and its storage
+  POST   /vms/{name}/start    Start a VM
+  POST   /vms/{name}/stop     Stop a VM (?force=true, ?timeout=2m)
+  GET    /images              List images
+  POST   /images              Download an image ({"url", "name", "sha256"})
+  DELETE /images/{name}       Delete an image
+
+When started by systemd with Type=notify, foundry reports readiness via
+sd_notify once it is listening and pings the watchdog if WatchdogSec is set.
+
+Authentication:
+  By default the daemon only accepts connections from localhost. To expose it
+  on other addresses, configure TLS (--tls-cert, --tls-key) and an auth file
+  (--auth-config) mapping bearer tokens and client certificate common names
+  (verified against --client-ca) to a role:
+
+    tokens:
+      - name: ci
+        token: <random secret>
+        role: admin          # any request
+    clients:
+      - commonName: monitoring.example.com
+        role: read-only      # GET/HEAD only
+
+  Every authenticated request is written to the audit log. The auth file must
+  be mode 0600.
+
+Webhooks:
+  With --webhook-config, VM lifecycle events (created, destroyed, started,
+  stopped, crashed) are POSTed as JSON to each configured endpoint:
+
+    endpoints:
+      - name: chatops
+        url: https://hooks.example.com/foundry
+        secret: <random secret>     # optional, signs requests
+        events: [crashed, stopped]  # optional, default all
+
+  Failed deliveries are retried with exponential backoff. With a secret, each
+  request carries X-Foundry-Signature: sha256=<HMAC-SHA256 of the body>. The
+  webhook file must be mode 0600.
+
+Metrics:
+  GET /metrics serves Prometheus metrics: the CPU time, memory, disk and
+  network I/O of each VM, read from libvirt at every scrape as by 'foundry
+  exporter', and counters of the VM creations done by the daemon, their
+  failures and the cleanups of failed or interrupted creations. It requires
+  the same authentication as the API; a read-only role suffices.
+
+Interrupted creations:
+  On startup, VM creations interrupted by a crash or kill are rolled back,
+  like 'foundry gc'.
+
+Reaping:
+  Every --reap-interval (default 1m, 0 disables) VMs whose TTL has expired
+  and ephemeral VMs that have shut down are destroyed, like 'foundry reap'.
+
+Reconciling:
+  With --watch-dir, the daemon keeps the VMs defined in a directory (or file)
+  of VirtualMachine configs, as accepted by 'foundry apply', in their desired
+  state. Every --reconcile-interval (default 30s) the configs are re-read and
+  for each VM:
+    - a missing VM is created and spec changes are applied
+    - missing volumes of a shut off VM are recreated (a missing boot disk is
+      recreated from its image)
+    - a shut off or crashed VM with autostart enabled is started, so set
+      spec.autostart: false for VMs that should stay stopped
+    - the phase and observed generation in its stored status are updated
+  VMs not defined in the directory are left alone, and removing a config does
+  not destroy its VM.
+
+Backups:
+  With --backup-dir, VMs annotated with foundry.cofront.xyz/backup=true are
+  backed up every --backup-interval (default 24h), like 'foundry backup
+  create': incrementally, with a full backup every --backup-full-every
+  (default 7) backups, keeping the newest --backup-keep (default 7) backups
+  and the backups they need.
+
+Cloud-init seed:
+  With --seed-listen, the NoCloud seed of VMs using the http cloud-init
+  transport (spec.cloudInit.transport: http) is served on a separate address
+  for guests that cannot mount the seed ISO:
+    GET /{vm}/user-data, /{vm}/meta-data, /{vm}/network-config, /{vm}/vendor-data
+  The VMs' spec.cloudInit.seedURL must point at this address. The seed is
+  unauthenticated and holds password hashes and SSH keys, so listen on an
+  address only the VMs can reach, e.g. 169.254.169.254:8775 on the VM bridge.
+
+Use --install-unit to write a systemd service unit that runs this command with
+the same flags, then enable it:
+
+  foundry serve --listen 127.0.0.1:8080 --install-unit
+  systemctl daemon-reload
+  systemctl enable --now foundry`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		listen, _ := cmd.Flags().GetString("listen")
+		installUnit, _ := cmd.Flags().GetBool("install-unit")
+		tlsCert, _ := cmd.Flags().GetString("tls-cert")
+		tlsKey, _ := cmd.Flags().GetString("tls-key")
+		clientCA, _ := cmd.Flags().GetString("client-ca")
+		authConfig, _ := cmd.Flags().GetString("auth-config")
+		webhookConfig, _ := cmd.Flags().GetString("webhook-config")
+		reapInterval, _ := cmd.Flags().GetDuration("reap-interval")
+		watchDir, _ := cmd.Flags().GetString("watch-dir")
+		reconcileInterval, _ := cmd.Flags().GetDuration("reconcile-interval")
+		seedListen, _ := cmd.Flags().GetString("seed-listen")
+		backupDir, _ := cmd.Flags().GetString("backup-dir")
+		backupInterval, _ := cmd.Flags().GetDuration("backup-interval")
+
+		if installUnit {
+			unitPath, _ := cmd.Flags().GetString("unit-path")
+			return installServeUnit(cmd, unitPath)
+		}
+
+		opts := server.Options{
+			Addr: listen,
+			ReadyChecks: map[string]server.Check{
+				"libvirt": checkLibvirt,
+			},
+		}
+
+		if tlsCert != "" || tlsKey != "" {
+			tlsConfig, err := auth.ServerTLSConfig(tlsCert, tlsKey, clientCA)
+			if err != nil {
+				return err
+			}
+			opts.TLSConfig = tlsConfig
+		} else if clientCA != "" {
+			return fmt.Errorf("--client-ca requires --tls-cert and --tls-key")
+		}
+
+		if authConfig != "" {
+			cfg, err := auth.LoadConfig(authConfig)
+			if err != nil {
+				return err
+			}
+			opts.Auth = auth.NewAuthenticator(cfg)
+		}
+
+		// Never expose an unauthenticated API beyond localhost
+		if !isLoopbackAddr(listen) && (opts.Auth == nil || opts.TLSConfig == nil) {
+			return fmt.Errorf("listening on %s requires --auth-config and TLS (--tls-cert, --tls-key)", listen)
+		}
+
+		var notifier *webhook.Notifier
+		if webhookConfig != "" {
+			cfg, err := webhook.LoadConfig(webhookConfig)
+			if err != nil {
+				return err
+			}
+			notifier = webhook.New(cfg, webhook.Options{Logger: logging.FromContext(cmd.Context())})
+		}
+
+		srv := server.New(opts)
+		srv.Handle("/api/", api.NewHandler())
+		srv.Handle("GET /metrics", metrics.Handler(metrics.NewDaemonRegistry(metrics.NewDomainCollector(cmd.Context()))))
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		rollBackInterrupted(ctx)
+
+		if notifier != nil {
+			go notifier.Run(ctx)
+			go forwardLifecycleEvents(ctx, notifier)
+		}
+
+		if reapInterval > 0 {
+			go runReaper(ctx, reapInterval)
+		}
+
+		if watchDir != "" {
+			if reconcileInterval <= 0 {
+				return fmt.Errorf("--reconcile-interval must be greater than 0")
+			}
+			go runReconciler(ctx, watchDir, reconcileInterval)
+		}
+
+		if backupDir != "" {
+			if backupInterval <= 0 {
+				return fmt.Errorf("--backup-interval must be greater than 0")
+			}
+			opts := vm.BackupOptions{Dir: backupDir}
+			opts.FullEvery, _ = cmd.Flags().GetInt("backup-full-every")
+			opts.Keep, _ = cmd.Flags().GetInt("backup-keep")
+			go runBackups(ctx, opts, backupInterval)
+		}
+
+		if seedListen != "" {
+			seedLn, err := net.Listen("tcp", seedListen)
+			if err != nil {
+				return fmt.Errorf("failed to listen for the cloud-init seed: %w", err)
+			}
+			go runSeedServer(ctx, seedLn)
+		}
+
+		return srv.Run(ctx)
+	},
+}
+
+func init() {
+	serveCmd.Flags().String("listen", server.DefaultAddr, "Address to listen on")
+	serveCmd.Flags().Bool("install-unit", false, "Write a systemd service unit for this command and exit")
+	serveCmd.Flags().String("unit-path", systemd.DefaultUnitPath, "Where --install-unit writes the unit (- for stdout)")
+	serveCmd.Flags().String("tls-cert", "", "TLS certificate file (PEM)")
+	serveCmd.Flags().String("tls-key", "", "TLS private key file (PEM)")
+	serveCmd.Flags().String("client-ca", "", "CA bundle for verifying client certificates (enables mTLS)")
+	serveCmd.Flags().String("auth-config", "", "Auth config file mapping tokens and client certificates to roles")
+	serveCmd.Flags().String("webhook-config", "", "Webhook config file listing endpoints to notify of VM lifecycle events")
+	serveCmd.Flags().Duration("reap-interval", time.Minute, "How often to destroy expired and stopped ephemeral VMs (0 disables)")
+	serveCmd.Flags().String("watch-dir", "", "Directory or file of VM configs to keep reconciled")
+	serveCmd.Flags().Duration("reconcile-interval", 30*time.Second, "How often to reconcile the VMs in --watch-dir")
+	serveCmd.Flags().String("seed-listen", "", "Address to serve the cloud-init seed of VMs with the http transport on")
+	serveCmd.Flags().String("backup-dir", "", "Directory to back up VMs annotated with foundry.cofront.xyz/backup=true into")
+	serveCmd.Flags().Duration("backup-interval", 24*time.Hour, "How often to back up the annotated VMs")
+	serveCmd.Flags().Int("backup-full-every", 7, "Take a full backup once a chain has this many backups (0 never)")
+	serveCmd.Flags().Int("backup-keep", 7, "Backups to keep per VM, with the backups they need (0 keeps all)")
+}
+
+// isLoopbackAddr reports whether a listen address only accepts local
+// connections.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// checkLibvirt verifies the libvirt daemon is reachable.
+func checkLibvirt(ctx context.Context) error {
+	client, err := libvirt.ConnectWithContext(ctx, "", 2*time.Second)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := client.Close(); closeErr != nil {
+			logging.FromContext(ctx).Warn("Failed to close libvirt connection", "error", closeErr)
+		}
+	}()
+
+	return client.Ping()
+}
+
+// forwardLifecycleEvents sends every VM lifecycle event to the webhook
+// notifier until ctx is cancelled.
+func forwardLifecycleEvents(ctx context.Context, notifier *webhook.Notifier) {
+	host, _ := os.Hostname()
+	err := vm.WatchLifecycle(ctx, func(ev vm.LifecycleEvent) {
+		notifier.Notify(webhook.Event{
+			Type:      string(ev.Type),
+			VM:        ev.VMName,
+			Reason:    ev.Reason,
+			Host:      host,
+			Timestamp: ev.Time,
+		})
+	})
+	if err != nil {
+		logging.FromContext(ctx).Warn("Stopped watching VM lifecycle events", "error", err)
+	}
+}
+
+// rollBackInterrupted rolls back VM creations interrupted before the daemon
+// started, so that their leftovers do not get in the way of new ones.
+func rollBackInterrupted(ctx context.Context) {
+	logger := logging.FromContext(ctx)
+
+	rolledBack, err := vm.GC(ctx)
+	for _, r := range rolledBack {
+		logger.Info("Rolled back interrupted creation of VM", "vm", r.VM)
+	}
+	if err != nil {
+		logger.Warn("Rolling back interrupted creations failed", "error", err)
+	}
+}
+
+// runReaper destroys expired and stopped ephemeral VMs every interval until
+// ctx is cancelled.
+func runReaper(ctx context.Context, interval time.Duration) {
+	logger := logging.FromContext(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reaped, err := vm.Reap(ctx)
+			for _, r := range reaped {
+				logger.Info("Reaped VM", "vm", r.Name, "reason", r.Reason)
+			}
+			if err != nil {
+				logger.Warn("Reaping VMs failed", "error", err)
+			}
+		}
+	}
+}
+
+// runReconciler reconciles the VMs defined in dir right away and then every
+// interval until ctx is cancelled.
+func runReconciler(ctx context.Context, dir string, interval time.Duration) {
+	logger := logging.FromContext(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		actions, err := vm.Reconcile(ctx, dir)
+		for _, a := range actions {
+			logger.Info("Reconciled VM", "vm", a.VMName, "action", a.Action)
+		}
+		if err != nil {
+			logger.Warn("Reconciling VMs failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runBackups backs up the annotated VMs every interval until ctx is
+// cancelled.
+func runBackups(ctx context.Context, opts vm.BackupOptions, interval time.Duration) {
+	logger := logging.FromContext(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			results, err := vm.BackupAnnotated(ctx, opts)
+			for _, r := range results {
+				logger.Info("Backed up VM", "vm", r.Manifest.VM, "kind", r.Manifest.Kind, "backup", r.Manifest.ID)
+			}
+			if err != nil {
+				logger.Warn("Backing up VMs failed", "error", err)
+			}
+		}
+	}
+}
+
+// runSeedServer serves the cloud-init seed of VMs with the http transport on
+// ln until ctx is cancelled.
+func runSeedServer(ctx context.Context, ln net.Listener) {
+	seed := &http.Server{
+		Handler: cloudinit.NewSeedHandler(func(ctx context.Context, name string) (*v1alpha1.VirtualMachine, error) {
+			got, err := vm.Get(ctx, name)
+			if vm.IsNotFound(err) {
+				return nil, fmt.Errorf("VM %s %w", name, cloudinit.ErrNotFound)
+			}
+			return got, err
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = seed.Shutdown(shutdownCtx)
+	}()
+
+	logger := logging.FromContext(ctx)
+	logger.Info("Serving cloud-init seed", "address", ln.Addr().String())
+	if err := seed.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Warn("Cloud-init seed server stopped", "error", err)
+	}
+}
+
+// installServeUnit writes a systemd unit running "foundry serve" with the
+// current serve flags and connection URI.
+func installServeUnit(cmd *cobra.Command, unitPath string) error {
+	execPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to determine foundry binary path: %w", err)
+	}
+
+	listen, _ := cmd.Flags().GetString("listen")
+	unitArgs := []string{"serve", "--listen", listen}
+	for _, name := range []string{"tls-cert", "tls-key", "client-ca", "auth-config", "webhook-config", "watch-dir", "backup-dir"} {
+		if value, _ := cmd.Flags().GetString(name); value != "" {
+			abs, err := filepath.Abs(value)
+			if err != nil {
+				return fmt.Errorf("failed to resolve --%s: %w", name, err)
+			}
+			unitArgs = append(unitArgs, "--"+name, abs)
+		}
+	}
+	if seedListen, _ := cmd.Flags().GetString("seed-listen"); seedListen != "" {
+		unitArgs = append(unitArgs, "--seed-listen", seedListen)
+	}
+	if cmd.Flags().Changed("reap-interval") {
+		reapInterval, _ := cmd.Flags().GetDuration("reap-interval")
+		unitArgs = append(unitArgs, "--reap-interval", reapInterval.String())
+	}
+	if cmd.Flags().Changed("reconcile-interval") {
+		reconcileInterval, _ := cmd.Flags().GetDuration("reconcile-interval")
+		unitArgs = append(unitArgs, "--reconcile-interval", reconcileInterval.String())
+	}
+	if cmd.Flags().Changed("backup-interval") {
+		backupInterval, _ := cmd.Flags().GetDuration("backup-interval")
+		unitArgs = append(unitArgs, "--backup-interval", backupInterval.String())
+	}
+	for _, name := range []string{"backup-full-every", "backup-keep"} {
+		if cmd.Flags().Changed(name) {
+			value, _ := cmd.Flags().GetInt(name)
+			unitArgs = append(unitArgs, "--"+name, strconv.Itoa(value))
+		}
+	}
+	if connectURI != "" {
+		unitArgs = append(unitArgs, "--connect", connectURI)
+	}
+
+	unit, err := systemd.GenerateUnit(systemd.UnitOptions{
+		ExecPath:    execPath,
+		Args:        unitArgs,
+		WatchdogSec: 30 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate unit: %w", err)
+	}
+
+	if unitPath == "-" {
+		fmt.Print(unit)
+		return nil
+	}
+
+	if err := systemd.InstallUnit(unitPath, unit); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Installed %s\n", unitPath)
+	fmt.Println("\nTo start foundry now and on boot:")
+	fmt.Println("  systemctl daemon-reload")
+	fmt.Println("  systemctl enable --now foundry")
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/systemd"
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+var shutdownAllCmd = &cobra.Command{
+	Use:   "shutdown-all",
+	Short: "Gracefully shut down all running VMs",
+	Long: `Ask every running foundry VM to shut down at once and wait for them, forcing
+off any VM still running after its timeout. Run it before rebooting the
+hypervisor so guests are not stopped uncleanly.
+
+Each VM gets --timeout (default 2m) to shut down. Give a VM more or less time
+with its shutdown-timeout annotation:
+
+  foundry annotate db-1 shutdown-timeout=5m
+
+Domains not created by foundry are left alone.
+
+--install-unit writes a systemd unit that runs this command when the host
+shuts down or reboots, before libvirt is stopped:
+
+  foundry shutdown-all --timeout 2m --install-unit
+  systemctl daemon-reload
+  systemctl enable --now foundry-shutdown
+
+systemd waits for the unit a little longer than --timeout; annotated timeouts
+beyond that are cut short. Disable libvirt-guests.service if it is enabled, so
+the two do not compete.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		if timeout < 0 {
+			return fmt.Errorf("--timeout must not be negative")
+		}
+
+		if installUnit, _ := cmd.Flags().GetBool("install-unit"); installUnit {
+			unitPath, _ := cmd.Flags().GetString("unit-path")
+			return installShutdownUnit(timeout, unitPath)
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		results, err := vm.ShutdownAll(ctx, timeout)
+		for _, r := range results {
+			switch {
+			case r.Err != nil:
+				fmt.Printf("✗ VM %s: %v\n", r.Name, r.Err)
+			case r.Forced:
+				fmt.Printf("! VM %s forced off after %v\n", r.Name, r.Timeout)
+			default:
+				fmt.Printf("✓ VM %s shut down (%v)\n", r.Name, r.Elapsed.Round(time.Second))
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to shut down VMs: %w", err)
+		}
+		if len(results) == 0 {
+			fmt.Println("No running VMs")
+		}
+		return nil
+	},
+}
+
+func init() {
+	shutdownAllCmd.Flags().Duration("timeout", 2*time.Minute, "How long each VM may take to shut down before it is forced off")
+	shutdownAllCmd.Flags().Bool("install-unit", false, "Write a systemd unit running this command at host shutdown and exit")
+	shutdownAllCmd.Flags().String("unit-path", systemd.DefaultShutdownUnitPath, "Where --install-unit writes the unit (- for stdout)")
+}
+
+// installShutdownUnit writes a systemd unit running "foundry shutdown-all"
+// with timeout when the host shuts down.
+func installShutdownUnit(timeout time.Duration, unitPath string) error {
+	execPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to determine foundry binary path: %w", err)
+	}
+
+	unitArgs := []string{"shutdown-all", "--timeout", timeout.String()}
+	if connectURI != "" {
+		unitArgs = append(unitArgs, "--connect", connectURI)
+	}
+
+	unit, err := systemd.GenerateShutdownUnit(systemd.ShutdownUnitOptions{
+		ExecPath: execPath,
+		Args:     unitArgs,
+		Timeout:  timeout,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate unit: %w", err)
+	}
+
+	if unitPath == "-" {
+		fmt.Print(unit)
+		return nil
+	}
+
+	if err := systemd.InstallUnit(unitPath, unit); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Installed %s\n", unitPath)
+	fmt.Println("\nTo shut down VMs gracefully when the host shuts down:")
+	fmt.Println("  systemctl daemon-reload")
+	fmt.Println("  systemctl enable --now foundry-shutdown")
+	return nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/output"
+	"github.com/jbweber/foundry/internal/snapshot"
+)
+
+// Snapshot management commands
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Manage VM snapshots",
+	Long: `Create, list, revert and delete snapshots of virtual machines.
+
+By default snapshots are internal: they are stored inside the VM's qcow2
+volumes and, when taken of a running VM, include its memory so reverting
+resumes the VM where it was. Use --disk-only for external snapshots, which
+freeze the current volumes and redirect writes to new overlay files.
+
+All writable disks of the VM must be qcow2. The cloud-init ISO is never
+included in snapshots.`,
+}
+
+func init() {
+	snapshotCmd.AddCommand(snapshotCreateCmd)
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotRevertCmd)
+	snapshotCmd.AddCommand(snapshotDeleteCmd)
+
+	snapshotCreateCmd.Flags().String("description", "", "Description of the snapshot")
+	snapshotCreateCmd.Flags().Bool("disk-only", false, "Create an external disk-only snapshot")
+	snapshotCreateCmd.Flags().Bool("quiesce", false, "Freeze guest filesystems while taking a disk-only snapshot (requires the guest agent)")
+
+	snapshotRevertCmd.Flags().Bool("running", false, "Start the VM after reverting")
+	snapshotRevertCmd.Flags().Bool("paused", false, "Leave the VM paused after reverting")
+
+	snapshotDeleteCmd.Flags().Bool("children", false, "Also delete snapshots taken after this one")
+}
+
+var snapshotCreateCmd = &cobra.Command{
+	Use:   "create <vm-name> [snapshot-name]",
+	Short: "Create a snapshot of a VM",
+	Long: `Create a snapshot of a VM.
+
+If no snapshot name is given, libvirt names the snapshot after the current
+Unix time.
+
+Internal snapshots of running VMs include memory and briefly pause the VM
+while it is saved. Disk-only snapshots are taken without pausing; add
+--quiesce to have the QEMU guest agent flush and freeze filesystems first.
+
+Examples:
+  foundry snapshot create my-vm before-upgrade --description "pre dnf upgrade"
+  foundry snapshot create my-vm nightly --disk-only --quiesce`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		opts := snapshot.CreateOptions{}
+		if len(args) == 2 {
+			opts.Name = args[1]
+		}
+		opts.Description, _ = cmd.Flags().GetString("description")
+		opts.DiskOnly, _ = cmd.Flags().GetBool("disk-only")
+		opts.Quiesce, _ = cmd.Flags().GetBool("quiesce")
+
+		ctx := cmd.Context()
+		client, err := libvirt.Connect("", 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("failed to connect to libvirt: %w", err)
+		}
+		defer func() {
+			if closeErr := client.Close(); closeErr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to close libvirt connection: %v\n", closeErr)
+			}
+		}()
+
+		mgr := snapshot.NewManager(client.Libvirt())
+		name, err := mgr.Create(ctx, vmName, opts)
+		if err != nil {
+			return fmt.Errorf("failed to create snapshot: %w", err)
+		}
+
+		fmt.Printf("✓ Snapshot %s of VM %s created\n", name, vmName)
+		return nil
+	},
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:   "list <vm-name>",
+	Short: "List the snapshots of a VM",
+	Long: `List the snapshots of a VM, oldest first.
+
+Shows the snapshot name, creation time, the VM state it was taken in, its
+kind (internal or external) and parent. The current snapshot, which new
+snapshots descend from, is marked with *.
+
+Example:
+  foundry snapshot list my-vm
+  foundry snapshot list my-vm -o json`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+
+		// Create printer (validates the format before connecting)
+		printer, err := newOutputPrinter()
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		client, err := libvirt.Connect("", 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("failed to connect to libvirt: %w", err)
+		}
+		defer func() {
+			if closeErr := client.Close(); closeErr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to close libvirt connection: %v\n", closeErr)
+			}
+		}()
+
+		mgr := snapshot.NewManager(client.Libvirt())
+		snaps, err := mgr.List(ctx, vmName)
+		if err != nil {
+			return fmt.Errorf("failed to list snapshots: %w", err)
+		}
+
+		if !printer.Tabular() {
+			return printList(printer, snaps)
+		}
+		if len(snaps) == 0 {
+			fmt.Printf("No snapshots found for VM %s\n", vmName)
+			return nil
+		}
+
+		table := &output.Table{
+			Columns: []output.Column{
+				{Name: "NAME"}, {Name: "CREATED"}, {Name: "STATE"},
+				{Name: "KIND"}, {Name: "PARENT"}, {Name: "DESCRIPTION"},
+			},
+			Footer: []string{fmt.Sprintf("Total: %d snapshot(s)", len(snaps)), "* Current snapshot"},
+		}
+		for _, s := range snaps {
+			name := s.Name
+			if s.Current {
+				name += " *"
+			}
+			created := ""
+			if !s.Created.IsZero() {
+				created = s.Created.Format("2006-01-02 15:04:05")
+			}
+
+			table.Rows = append(table.Rows, []string{name, created, s.State, string(s.Kind), s.Parent, s.Description})
+		}
+		fmt.Print(printer.FormatTable(table))
+		return nil
+	},
+}
+
+var snapshotRevertCmd = &cobra.Command{
+	Use:   "revert <vm-name> <snapshot-name>",
+	Short: "Revert a VM to a snapshot",
+	Long: `Revert a VM to a snapshot, discarding all changes made since.
+
+The VM returns to the state the snapshot was taken in: running (with its
+memory restored) or shut off. Use --running or --paused to override.
+
+Reverting to external snapshots requires libvirt 9.7 or newer.
+
+Examples:
+  foundry snapshot revert my-vm before-upgrade
+  foundry snapshot revert my-vm nightly --running`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		name := args[1]
+		opts := snapshot.RevertOptions{}
+		opts.Running, _ = cmd.Flags().GetBool("running")
+		opts.Paused, _ = cmd.Flags().GetBool("paused")
+
+		ctx := cmd.Context()
+		client, err := libvirt.Connect("", 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("failed to connect to libvirt: %w", err)
+		}
+		defer func() {
+			if closeErr := client.Close(); closeErr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to close libvirt connection: %v\n", closeErr)
+			}
+		}()
+
+		mgr := snapshot.NewManager(client.Libvirt())
+		if err := mgr.Revert(ctx, vmName, name, opts); err != nil {
+			return fmt.Errorf("failed to revert snapshot: %w", err)
+		}
+
+		fmt.Printf("✓ VM %s reverted to snapshot %s\n", vmName, name)
+		return nil
+	},
+}
+
+var snapshotDeleteCmd = &cobra.Command{
+	Use:   "delete <vm-name> <snapshot-name>",
+	Short: "Delete a snapshot of a VM",
+	Long: `Delete a snapshot of a VM.
+
+The VM's current state is not affected. Snapshots taken after this one are
+kept and re-parented unless --children is given. Deleting an external
+snapshot merges its overlay back into the underlying volume.
+
+Examples:
+  foundry snapshot delete my-vm before-upgrade
+  foundry snapshot delete my-vm base --children`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		name := args[1]
+		children, _ := cmd.Flags().GetBool("children")
+
+		ctx := cmd.Context()
+		client, err := libvirt.Connect("", 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("failed to connect to libvirt: %w", err)
+		}
+		defer func() {
+			if closeErr := client.Close(); closeErr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to close libvirt connection: %v\n", closeErr)
+			}
+		}()
+
+		mgr := snapshot.NewManager(client.Libvirt())
+		if err := mgr.Delete(ctx, vmName, name, children); err != nil {
+			return fmt.Errorf("failed to delete snapshot: %w", err)
+		}
+
+		fmt.Printf("✓ Snapshot %s of VM %s deleted\n", name, vmName)
+		return nil
+	},
+}
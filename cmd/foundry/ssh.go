@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/runner"
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+var sshCmd = &cobra.Command{
+	Use:   "ssh <vm-name> [-- <command> [args...]]",
+	Short: "Open an SSH session to a VM",
+	Long: `Connect to a VM over SSH, running a command if given or a login shell
+otherwise.
+
+foundry connects to the static address of the VM's first network interface,
+or the first address libvirt reports for it. The login user is --user if
+given, otherwise the default user of the VM's boot image (recorded by
+'foundry image pull' or 'foundry image import --default-user' and copied to
+the VM's foundry.cofront.xyz/default-user annotation at creation), and root
+if neither is known.
+
+The ssh client from PATH is used with your SSH agent and --identity. Host
+keys are not checked or recorded, since VMs are routinely recreated with the
+same address.
+
+Examples:
+  foundry ssh my-vm
+  foundry ssh my-vm -- sudo dnf -y update
+  foundry ssh my-vm --user admin`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		dash := cmd.ArgsLenAtDash()
+		if len(args) < 1 || dash > 1 || dash == -1 && len(args) != 1 {
+			return fmt.Errorf("usage: foundry ssh <vm-name> [-- <command> [args...]]")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		command := args[1:]
+
+		opts := runner.SSHOptions{
+			Stdin:  os.Stdin,
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+		}
+		opts.User, _ = cmd.Flags().GetString("user")
+		opts.IdentityFile, _ = cmd.Flags().GetString("identity")
+
+		ctx := cmd.Context()
+		vmObj, err := vm.Get(ctx, vmName)
+		if err != nil {
+			return fmt.Errorf("failed to get VM: %w", err)
+		}
+
+		code, err := runner.SSH(ctx, vmObj, command, opts)
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			os.Exit(code)
+		}
+		return nil
+	},
+}
+
+func init() {
+	sshCmd.Flags().String("user", "", "SSH user (default: the boot image's default user, or root)")
+	sshCmd.Flags().StringP("identity", "i", "", "SSH private key file")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/loader"
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+// Stack commands
+var stackCmd = &cobra.Command{
+	Use:   "stack",
+	Short: "Manage groups of VMs created from one template",
+	Long: `Create and destroy a VirtualMachineStack: a group of related VMs defined by
+one template, such as web-01 to web-03 with consecutive IP addresses.
+
+  apiVersion: foundry.cofront.xyz/v1alpha1
+  kind: VirtualMachineStack
+  metadata:
+    name: web
+  spec:
+    names: web-{01..03}
+    template:
+      spec:
+        vcpus: 2
+        ...
+
+Each VM gets the next static address of each interface and the label
+foundry.cofront.xyz/stack=<stack name>. See 'foundry explain stack'.`,
+}
+
+var stackUpCmd = &cobra.Command{
+	Use:   "up <stack.yaml>",
+	Short: "Create or update the VMs of a stack",
+	Long: `Create the VMs of a stack, or update existing ones to match it like
+'foundry apply'.
+
+Before anything is changed, every existing VM with a name of the stack must
+already belong to it. If a VM fails, the VMs created by this run are destroyed
+again; VMs that existed before keep the changes applied to them.
+
+VMs of the stack that are no longer in it (e.g. after shortening its name
+range) are left alone unless --prune is given.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		prune, _ := cmd.Flags().GetBool("prune")
+
+		stack, vms, err := loader.LoadStackFromFile(cmd.Context(), args[0])
+		if err != nil {
+			return fmt.Errorf("failed to load stack: %w", err)
+		}
+		for _, config := range vms {
+			if err := addMyKey(cmd, config); err != nil {
+				return err
+			}
+			if err := addNetworkDefaults(config); err != nil {
+				return err
+			}
+		}
+		// The VMs share the template, so they share its warnings too
+		if err := confirmWarnings(cmd, vms[0]); err != nil {
+			return err
+		}
+
+		fmt.Printf("Bringing up stack %s (%d VMs)\n", stack.Name, len(vms))
+
+		result, err := vm.StackUp(cmd.Context(), stack.Name, vms, vm.StackUpOptions{Prune: prune})
+		if err != nil {
+			return fmt.Errorf("failed to bring up stack %s: %w", stack.Name, err)
+		}
+
+		for _, applied := range result.Applied {
+			switch {
+			case applied.Created:
+				fmt.Printf("  %s: created\n", applied.VMName)
+			case len(applied.Changes) == 0:
+				fmt.Printf("  %s: unchanged\n", applied.VMName)
+			case applied.RestartRequired:
+				fmt.Printf("  %s: updated (restart required)\n", applied.VMName)
+			default:
+				fmt.Printf("  %s: updated\n", applied.VMName)
+			}
+		}
+		for _, name := range result.Pruned {
+			fmt.Printf("  %s: destroyed\n", name)
+		}
+		fmt.Printf("✓ Stack %s is up\n", stack.Name)
+		return nil
+	},
+}
+
+var stackDownCmd = &cobra.Command{
+	Use:   "down <stack.yaml>",
+	Short: "Destroy the VMs of a stack",
+	Long: `Destroy every VM labeled as part of the stack, including VMs that were
+removed from its name range since they were created. VMs with a name of the
+stack that do not belong to it are left alone.
+
+A VM that fails to destroy does not stop the others.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stack, _, err := loader.LoadStackFromFile(cmd.Context(), args[0])
+		if err != nil {
+			return fmt.Errorf("failed to load stack: %w", err)
+		}
+
+		fmt.Printf("Tearing down stack %s\n", stack.Name)
+
+		destroyed, err := vm.StackDown(cmd.Context(), stack.Name)
+		for _, name := range destroyed {
+			fmt.Printf("  %s: destroyed\n", name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(destroyed) == 0 {
+			fmt.Printf("Stack %s has no VMs\n", stack.Name)
+			return nil
+		}
+		fmt.Printf("✓ Stack %s is down\n", stack.Name)
+		return nil
+	},
+}
+
+func init() {
+	stackCmd.AddCommand(stackUpCmd)
+	stackCmd.AddCommand(stackDownCmd)
+
+	stackUpCmd.Flags().Bool("prune", false, "Destroy VMs of the stack that are no longer in it")
+	stackUpCmd.Flags().BoolP("yes", "y", false, "Continue without asking when the configuration has warnings")
+	stackUpCmd.Flags().Bool("with-my-key", false, "Authorize your default SSH public key (~/.ssh/id_*.pub) in the VMs")
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -34,7 +33,7 @@ var storageStatusCmd = &cobra.Command{
 Shows a summary of total storage across all pools, followed by detailed
 information for each pool including volume counts and usage percentage.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		ctx := context.Background()
+		ctx := cmd.Context()
 		client, err := libvirt.Connect("", 5*time.Second)
 		if err != nil {
 			return fmt.Errorf("failed to connect to libvirt: %w", err)
@@ -119,7 +118,7 @@ information for each pool including volume counts and usage percentage.`,
 
 			// Mark default pools
 			name := pool.Name
-			if pool.Name == storage.DefaultImagesPool || pool.Name == storage.DefaultVMsPool {
+			if storage.IsDefaultPool(pool.Name) {
 				name = pool.Name + " *"
 			}
 
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/jbweber/foundry/internal/loader"
+)
+
+// loadConfigs loads the VMs of path, rendering its files with the values of
+// --values and --set if either is given.
+func loadConfigs(cmd *cobra.Command, path string) ([]loader.Document, error) {
+	files, _ := cmd.Flags().GetStringArray("values")
+	assignments, _ := cmd.Flags().GetStringArray("set")
+
+	values, err := loader.LoadValues(files, assignments)
+	if err != nil {
+		return nil, err
+	}
+	return loader.LoadAllWithValues(cmd.Context(), path, values)
+}
+
+// addValuesFlags adds the --values and --set flags read by loadConfigs.
+func addValuesFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray("values", nil, "Render the configuration as a template with the values of this YAML file (repeatable)")
+	cmd.Flags().StringArray("set", nil, "Render the configuration as a template with this key=value (repeatable, overrides --values)")
+}
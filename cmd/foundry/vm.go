@@ -0,0 +1,507 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/output"
+	"github.com/jbweber/foundry/internal/storage"
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+// VM commands
+var vmCmd = &cobra.Command{
+	Use:   "vm",
+	Short: "Manage virtual machines",
+	Long: `Commands for a single virtual machine, including noun-verb forms of the
+top-level VM commands (e.g. 'foundry vm list' for 'foundry list').`,
+}
+
+func init() {
+	vmCmd.AddCommand(vmDisplayCmd)
+	vmCmd.AddCommand(vmSetResourcesCmd)
+	vmCmd.AddCommand(vmResizeCmd)
+	vmCmd.AddCommand(vmSetLimitsCmd)
+	vmCmd.AddCommand(vmFlattenCmd)
+	vmCmd.AddCommand(vmExportCmd)
+	vmCmd.AddCommand(vmXMLCmd)
+	vmCmd.AddCommand(vmDisksCmd)
+
+	vmXMLCmd.Flags().Bool("inactive", false, "Print the persistent definition used for the next boot instead of the live one")
+
+	vmDisplayCmd.Flags().Bool("uri", false, "Print only the connection URI")
+
+	vmExportCmd.Flags().Bool("compress", false, "Compress the disk images with gzip")
+	vmExportCmd.Flags().Bool("sparse", false, "Write blocks of zeros in the disk images as holes")
+
+	vmSetResourcesCmd.Flags().Int("vcpus", 0, "Number of vCPUs")
+	vmSetResourcesCmd.Flags().Int("memory-gib", 0, "Memory in GiB")
+
+	vmResizeCmd.Flags().Int("vcpus", 0, "Number of vCPUs")
+	vmResizeCmd.Flags().Int("memory-gib", 0, "Memory in GiB")
+	vmResizeCmd.Flags().Bool("restart", false, "Restart the VM without asking when the change cannot be made live")
+	vmResizeCmd.Flags().Duration("timeout", vm.DefaultStopTimeout, "How long the VM may take to shut down before it is forced off")
+
+	vmSetLimitsCmd.Flags().String("disk", "", "Disk device whose I/O limits to set (e.g. vda, vdb)")
+	vmSetLimitsCmd.Flags().Int("total-iops", 0, "Read and write operations per second")
+	vmSetLimitsCmd.Flags().Int("read-iops", 0, "Read operations per second")
+	vmSetLimitsCmd.Flags().Int("write-iops", 0, "Write operations per second")
+	vmSetLimitsCmd.Flags().Int("total-bps", 0, "Read and write bytes per second")
+	vmSetLimitsCmd.Flags().Int("read-bps", 0, "Read bytes per second")
+	vmSetLimitsCmd.Flags().Int("write-bps", 0, "Write bytes per second")
+	vmSetLimitsCmd.Flags().String("nic", "", "Network interface (IP, MAC address or interface name) whose bandwidth to set")
+	vmSetLimitsCmd.Flags().String("inbound", "", "Traffic to the guest as average[,peak[,burst]] in KiB/s (burst in KiB)")
+	vmSetLimitsCmd.Flags().String("outbound", "", "Traffic from the guest as average[,peak[,burst]] in KiB/s (burst in KiB)")
+}
+
+var vmFlattenCmd = &cobra.Command{
+	Use:   "flatten <vm-name>",
+	Short: "Detach all of a VM's disks from their backing images",
+	Long: `Flatten every disk of a VM so that it no longer depends on its base image.
+
+Boot disks are qcow2 overlays on an image in the foundry-images pool, and the
+disks of linked clones are overlays on the disks of their source VM.
+Flattening collapses each backing chain into a standalone volume, after which
+the image can be deleted and the VM's volumes copied to another host.
+
+Running VMs are flattened live with a block pull per disk, as with
+'foundry disk flatten'; stopped VMs have their volumes copied into standalone
+ones. Disks without a backing file are left alone. Interrupting the command
+(Ctrl+C) aborts a running block job; the disk remains valid and still backed
+by its base image.
+
+Examples:
+  foundry vm flatten my-vm`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+
+		fmt.Printf("Flattening disks of VM %s...\n", vmName)
+
+		reported := false
+		progress := func(p vm.BlockJobProgress) {
+			fmt.Printf("\r  %s: %5.1f%%", p.Device, p.Percent())
+			reported = true
+		}
+
+		flattened, err := vm.FlattenVM(ctx, vmName, progress)
+		if reported {
+			fmt.Println()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to flatten VM: %w", err)
+		}
+
+		if len(flattened) == 0 {
+			fmt.Printf("✓ VM %s has no disks with a backing image\n", vmName)
+			return nil
+		}
+		fmt.Printf("✓ Flattened %s of VM %s\n", strings.Join(flattened, ", "), vmName)
+		return nil
+	},
+}
+
+var vmExportCmd = &cobra.Command{
+	Use:   "export <vm-name> [path]",
+	Short: "Export a VM's spec, domain XML and disks",
+	Long: `Export a stopped VM to a directory or an archive, to back it up or move it
+to another host.
+
+The export holds the VM's spec ready to re-apply (vm.yaml, as with
+'foundry get --export'), its libvirt domain XML (domain.xml) and a copy of
+each of its volumes: the boot disk, data disks and cloud-init ISO. Disks
+backed by a base image are exported flattened, so the export does not need
+the image.
+
+-o/--output selects the layout: dir writes a new directory, ova a tar
+archive of the same files. Without -o, paths ending in .ova are archives. The
+path defaults to ./<vm-name> (or ./<vm-name>.ova) and must not exist.
+
+--compress gzips the disk images (adding a .gz suffix); --sparse leaves
+blocks of zeros out of them as holes, which saves space in directories.
+
+The VM must be shut off, so that its disks are consistent.
+
+Examples:
+  foundry vm export my-vm
+  foundry vm export my-vm /backup/my-vm.ova --compress
+  foundry vm export my-vm /backup/my-vm -o dir --sparse`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		compress, _ := cmd.Flags().GetBool("compress")
+		sparse, _ := cmd.Flags().GetBool("sparse")
+
+		// The layout comes from -o, or the path's extension
+		format := vm.ExportFormatDir
+		if cmd.Flag("output").Changed {
+			format = vm.ExportFormat(outputFormat)
+			if format != vm.ExportFormatDir && format != vm.ExportFormatOVA {
+				return fmt.Errorf("invalid output %q for export (must be dir or ova)", outputFormat)
+			}
+		} else if len(args) > 1 && strings.HasSuffix(args[1], ".ova") {
+			format = vm.ExportFormatOVA
+		}
+
+		dest := vmName
+		if format == vm.ExportFormatOVA {
+			dest += ".ova"
+		}
+		if len(args) > 1 {
+			dest = args[1]
+		}
+
+		fmt.Printf("Exporting VM %s to %s...\n", vmName, dest)
+
+		opts := vm.ExportOptions{Format: format, Compress: compress, Sparse: sparse}
+		result, err := vm.ExportVM(cmd.Context(), vmName, dest, opts)
+		if err != nil {
+			return fmt.Errorf("failed to export VM: %w", err)
+		}
+
+		for _, file := range result.Files {
+			fmt.Printf("  %-40s %10.1f MiB\n", file.Name, float64(file.Size)/(1024*1024))
+		}
+		fmt.Printf("✓ VM %s exported to %s\n", vmName, result.Path)
+		return nil
+	},
+}
+
+var vmDisplayCmd = &cobra.Command{
+	Use:   "display <vm-name>",
+	Short: "Show how to connect to a VM's display",
+	Long: `Show the connection URI of the VNC or SPICE display of a running VM
+(see spec.graphics), for remote-viewer, virt-viewer or a VNC client.
+
+With a remote connection the display is reached on the hypervisor's host
+name. Displays listening on the hypervisor's loopback address, the default,
+are only reachable through an SSH tunnel; the command to open one is printed.
+
+Examples:
+  foundry vm display my-vm
+  remote-viewer "$(foundry vm display my-vm --uri)"`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		uriOnly, _ := cmd.Flags().GetBool("uri")
+
+		display, err := vm.Display(cmd.Context(), vmName)
+		if err != nil {
+			return err
+		}
+
+		if uriOnly {
+			fmt.Println(display.URI)
+			return nil
+		}
+
+		fmt.Printf("Type:     %s\n", display.Type)
+		fmt.Printf("URI:      %s\n", display.URI)
+		if display.PasswordRequired {
+			fmt.Println("Password: required (spec.graphics.password)")
+		}
+		if display.TunnelVia != "" {
+			fmt.Printf("\nThe display listens on the hypervisor's loopback address. Open a tunnel first:\n")
+			fmt.Printf("  ssh -N -L %d:%s:%d %s\n", display.Port, display.Host, display.Port, display.TunnelVia)
+		}
+		return nil
+	},
+}
+
+var vmXMLCmd = &cobra.Command{
+	Use:   "xml <vm-name>",
+	Short: "Print a VM's libvirt domain XML",
+	Long: `Print the libvirt domain XML of a VM, for debugging device definitions.
+
+For a running VM this is the live definition, including the device addresses,
+ports and paths libvirt assigned at boot. --inactive prints the persistent
+definition instead, which takes effect on the next boot and differs from the
+live one after changes that need a restart.
+
+To see the XML a configuration would produce before creating or changing a
+VM, use 'foundry create --print-xml' or 'foundry apply --print-xml'.
+
+Examples:
+  foundry vm xml my-vm
+  foundry vm xml my-vm --inactive`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		inactive, _ := cmd.Flags().GetBool("inactive")
+
+		domainXML, err := vm.DomainXML(cmd.Context(), vmName, inactive)
+		if err != nil {
+			return err
+		}
+		fmt.Println(strings.TrimRight(domainXML, "\n"))
+		return nil
+	},
+}
+
+var vmDisksCmd = &cobra.Command{
+	Use:   "disks <vm-name>",
+	Short: "List a VM's disks and the volumes behind them",
+	Long: `List the disks of a VM with the storage pools and volumes holding them,
+for capacity management.
+
+For each disk the bus and device it is attached to, its role (boot, data or
+cloudinit; empty for disks attached outside foundry), its capacity and the
+space allocated on the host are shown, with the image or volume it is an
+overlay on. Files outside every storage pool show only their path. For a
+running VM the live definition is used, so hot-plugged disks are included.
+-o wide adds the volume paths.
+
+Examples:
+  foundry vm disks my-vm
+  foundry vm disks my-vm -o wide
+  foundry vm disks my-vm -o json`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+
+		// Create printer (validates the format before connecting)
+		printer, err := newOutputPrinter()
+		if err != nil {
+			return err
+		}
+
+		disks, err := vm.ListVolumes(cmd.Context(), vmName)
+		if err != nil {
+			return err
+		}
+
+		if !printer.Tabular() {
+			return printList(printer, disks)
+		}
+
+		var capacity, allocation uint64
+		table := &output.Table{
+			Columns: []output.Column{
+				{Name: "DEVICE"}, {Name: "BUS"}, {Name: "TYPE"},
+				{Name: "POOL"}, {Name: "VOLUME"}, {Name: "FORMAT"},
+				{Name: "CAPACITY"}, {Name: "ALLOCATED"}, {Name: "BACKING"},
+				{Name: "PATH", Wide: true},
+			},
+		}
+		for _, disk := range disks {
+			capacity += disk.Capacity
+			allocation += disk.Allocation
+			backing := disk.BackingVolume
+			if backing == "" {
+				backing = disk.Backing
+			}
+			table.Rows = append(table.Rows, []string{
+				disk.Device,
+				disk.Bus,
+				orDash(string(disk.Type)),
+				orDash(disk.Pool),
+				orDash(disk.Name),
+				orDash(string(disk.Format)),
+				fmt.Sprintf("%.1fGB", disk.CapacityGB()),
+				fmt.Sprintf("%.1fGB", disk.AllocationGB()),
+				orDash(backing),
+				orDash(disk.Path),
+			})
+		}
+		total := storage.VolumeInfo{Capacity: capacity, Allocation: allocation}
+		table.Footer = []string{fmt.Sprintf("Total: %d disk(s), %.1fGB capacity, %.1fGB allocated", len(disks), total.CapacityGB(), total.AllocationGB())}
+		fmt.Print(printer.FormatTable(table))
+		return nil
+	},
+}
+
+var vmSetResourcesCmd = &cobra.Command{
+	Use:   "set-resources <vm-name>",
+	Short: "Change the vCPUs and memory of a VM",
+	Long: `Change the vCPUs and memory of a VM without editing its configuration.
+
+The stored spec and the domain definition are updated like 'foundry apply'
+would. A running VM is changed live when the new values are within the
+spec.maxVCPUs and spec.maxMemoryGiB it booted with: vCPUs are hotplugged and
+memory is returned or handed back through the balloon driver. Otherwise the
+change takes effect after the VM is restarted.
+
+Examples:
+  foundry vm set-resources my-vm --vcpus 4
+  foundry vm set-resources my-vm --vcpus 8 --memory-gib 16`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		vcpus, _ := cmd.Flags().GetInt("vcpus")
+		memoryGiB, _ := cmd.Flags().GetInt("memory-gib")
+
+		result, err := vm.SetResources(cmd.Context(), vmName, vcpus, memoryGiB)
+		if err != nil {
+			return fmt.Errorf("failed to set resources: %w", err)
+		}
+
+		if len(result.Changes) == 0 {
+			fmt.Printf("✓ VM %s unchanged\n", result.VMName)
+			return nil
+		}
+		for _, change := range result.Changes {
+			fmt.Printf("  %s\n", change)
+		}
+		fmt.Printf("✓ VM %s updated (generation %d)\n", result.VMName, result.Generation)
+		if result.RestartRequired {
+			fmt.Println("  Some changes take effect after the VM is restarted")
+		}
+		return nil
+	},
+}
+
+var vmResizeCmd = &cobra.Command{
+	Use:   "resize <vm-name>",
+	Short: "Change the vCPUs and memory of a VM, restarting it if needed",
+	Long: `Change the vCPUs and memory of a VM, live if possible and with a restart
+otherwise.
+
+A running VM is changed live when the new values are within the
+spec.maxVCPUs and spec.maxMemoryGiB it booted with. Otherwise the new values
+are stored and, after asking (or right away with --restart), the VM is shut
+down and started again with them. Values beyond the maximums raise the
+maximums. A stopped VM is simply redefined and picks the values up when it
+is next started.
+
+The stored spec is updated like 'foundry apply' would, so the generation and
+observed generation advance together.
+
+Examples:
+  foundry vm resize my-vm --vcpus 4
+  foundry vm resize my-vm --vcpus 16 --memory-gib 64 --restart`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+		opts := vm.ResizeOptions{}
+		opts.VCPUs, _ = cmd.Flags().GetInt("vcpus")
+		opts.MemoryGiB, _ = cmd.Flags().GetInt("memory-gib")
+		opts.Stop.Timeout, _ = cmd.Flags().GetDuration("timeout")
+		opts.Restart, _ = cmd.Flags().GetBool("restart")
+		if !opts.Restart && term.IsTerminal(int(os.Stdin.Fd())) {
+			opts.ConfirmRestart = func() bool {
+				return askYesNo(fmt.Sprintf("VM %s must be restarted for the change to take effect. Restart it now?", vmName))
+			}
+		}
+
+		result, err := vm.Resize(cmd.Context(), vmName, opts)
+		if err != nil {
+			return fmt.Errorf("failed to resize VM: %w", err)
+		}
+
+		if len(result.Changes) == 0 {
+			fmt.Printf("✓ VM %s unchanged\n", result.VMName)
+			return nil
+		}
+		for _, change := range result.Changes {
+			fmt.Printf("  %s\n", change)
+		}
+		switch {
+		case result.Restarted:
+			fmt.Printf("✓ VM %s resized and restarted (generation %d)\n", result.VMName, result.Generation)
+		case result.RestartRequired:
+			fmt.Printf("✓ VM %s updated (generation %d)\n", result.VMName, result.Generation)
+			fmt.Println("  The change takes effect after the VM is restarted (re-run with --restart)")
+		default:
+			fmt.Printf("✓ VM %s resized (generation %d)\n", result.VMName, result.Generation)
+		}
+		return nil
+	},
+}
+
+var vmSetLimitsCmd = &cobra.Command{
+	Use:   "set-limits <vm-name>",
+	Short: "Change the disk I/O limits and network bandwidth of a VM",
+	Long: `Change the I/O limits of a disk (spec ioTune) and the traffic shaping of a
+network interface (spec bandwidth) of a VM without editing its configuration.
+
+--disk selects the disk whose limits are replaced by the --*-iops and --*-bps
+flags given; --disk alone removes its limits. --nic selects the interface whose
+shaping is replaced by --inbound and --outbound; --nic alone removes it.
+
+The stored spec and the domain definition are updated like 'foundry apply'
+would, and a running VM has the limits changed live.
+
+Examples:
+  foundry vm set-limits my-vm --disk vda --total-iops 500 --total-bps 104857600
+  foundry vm set-limits my-vm --nic 10.0.0.10 --inbound 10240,20480,1024 --outbound 10240
+  foundry vm set-limits my-vm --disk vdb`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vmName := args[0]
+
+		var opts vm.LimitsOptions
+		opts.Disk, _ = cmd.Flags().GetString("disk")
+		opts.IOTune.TotalIOPS, _ = cmd.Flags().GetInt("total-iops")
+		opts.IOTune.ReadIOPS, _ = cmd.Flags().GetInt("read-iops")
+		opts.IOTune.WriteIOPS, _ = cmd.Flags().GetInt("write-iops")
+		opts.IOTune.TotalBytesPerSec, _ = cmd.Flags().GetInt("total-bps")
+		opts.IOTune.ReadBytesPerSec, _ = cmd.Flags().GetInt("read-bps")
+		opts.IOTune.WriteBytesPerSec, _ = cmd.Flags().GetInt("write-bps")
+		if opts.Disk == "" && opts.IOTune != (v1alpha1.DiskIOTuneSpec{}) {
+			return fmt.Errorf("I/O limits require --disk")
+		}
+
+		opts.NIC, _ = cmd.Flags().GetString("nic")
+		inbound, _ := cmd.Flags().GetString("inbound")
+		outbound, _ := cmd.Flags().GetString("outbound")
+		if opts.NIC == "" && (inbound != "" || outbound != "") {
+			return fmt.Errorf("--inbound and --outbound require --nic")
+		}
+		var err error
+		if opts.Bandwidth.Inbound, err = parseBandwidthLimit(inbound); err != nil {
+			return fmt.Errorf("invalid --inbound: %w", err)
+		}
+		if opts.Bandwidth.Outbound, err = parseBandwidthLimit(outbound); err != nil {
+			return fmt.Errorf("invalid --outbound: %w", err)
+		}
+
+		result, err := vm.SetLimits(cmd.Context(), vmName, opts)
+		if err != nil {
+			return fmt.Errorf("failed to set limits: %w", err)
+		}
+
+		if len(result.Changes) == 0 {
+			fmt.Printf("✓ VM %s unchanged\n", result.VMName)
+			return nil
+		}
+		for _, change := range result.Changes {
+			fmt.Printf("  %s\n", change)
+		}
+		fmt.Printf("✓ VM %s updated (generation %d)\n", result.VMName, result.Generation)
+		if result.RestartRequired {
+			fmt.Println("  Some changes take effect after the VM is restarted")
+		}
+		return nil
+	},
+}
+
+// parseBandwidthLimit parses a traffic limit given as average[,peak[,burst]],
+// or returns nil for an empty value.
+func parseBandwidthLimit(value string) (*v1alpha1.BandwidthLimitSpec, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parts := strings.Split(value, ",")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("%q is not average[,peak[,burst]]", value)
+	}
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%q is not a non-negative number", part)
+		}
+		numbers[i] = n
+	}
+	return &v1alpha1.BandwidthLimitSpec{Average: numbers[0], Peak: numbers[1], Burst: numbers[2]}, nil
+}
@@ -0,0 +1,323 @@
+// Package api implements the REST API served by 'foundry serve'.
+//
+// The API exposes VM lifecycle and image management under /api/v1alpha1.
+// Request and response bodies are JSON; VMs use the VirtualMachine format of
+// config files, so a VM can also be created from a YAML config. Errors are
+// returned as {"error": "..."} with a matching status code. The OpenAPI
+// description is served at /api/v1alpha1/openapi.json.
+package api
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/loader"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/storage"
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+// Prefix is the path all API endpoints are served under.
+const Prefix = "/api/v1alpha1"
+
+// maxBodySize bounds request bodies.
+const maxBodySize = 1 << 20
+
+var (
+	// ErrNotFound is returned by a backend for a VM or image that does not
+	// exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is returned by a backend for a VM or image that already
+	// exists.
+	ErrConflict = errors.New("already exists")
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// ImageImport describes an image to download into the images pool.
+type ImageImport struct {
+	// URL is the http or https URL to download the image from.
+	URL string `json:"url"`
+
+	// Name is the image name, with a .qcow2 or .raw extension.
+	Name string `json:"name"`
+
+	// SHA256 is the expected hex-encoded SHA-256 of the image, if known.
+	SHA256 string `json:"sha256,omitempty"`
+
+	// SHA512 is the expected hex-encoded SHA-512 of the image, if known.
+	SHA512 string `json:"sha512,omitempty"`
+
+	// DefaultUser is the login user the image's cloud-init creates, if known.
+	DefaultUser string `json:"defaultUser,omitempty"`
+
+	// OSVariant is the libosinfo short ID of the image's OS, if known.
+	OSVariant string `json:"osVariant,omitempty"`
+
+	// Labels are recorded with the image.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// backend defines the operations the API exposes. The libvirt implementation
+// uses the vm and storage packages; tests use a fake.
+type backend interface {
+	ListVMs(ctx context.Context) ([]*v1alpha1.VirtualMachine, error)
+	GetVM(ctx context.Context, name string) (*v1alpha1.VirtualMachine, error)
+	CreateVM(ctx context.Context, desired *v1alpha1.VirtualMachine) (string, error)
+	DestroyVM(ctx context.Context, name string) error
+	StartVM(ctx context.Context, name string) error
+	StopVM(ctx context.Context, name string, opts vm.StopOptions) error
+	ListImages(ctx context.Context) ([]storage.VolumeInfo, error)
+	ImportImage(ctx context.Context, image ImageImport) error
+	DeleteImage(ctx context.Context, name string, force bool) error
+}
+
+// Handler serves the API.
+type Handler struct {
+	mux     *http.ServeMux
+	backend backend
+}
+
+// NewHandler returns a Handler managing the VMs and images of the libvirt
+// host foundry is connected to. Mount it at Prefix or a parent path.
+func NewHandler() *Handler {
+	return newHandler(libvirtBackend{})
+}
+
+func newHandler(b backend) *Handler {
+	h := &Handler{mux: http.NewServeMux(), backend: b}
+	h.mux.HandleFunc("GET "+Prefix+"/openapi.json", h.handleOpenAPI)
+	h.mux.HandleFunc("GET "+Prefix+"/vms", h.handleListVMs)
+	h.mux.HandleFunc("POST "+Prefix+"/vms", h.handleCreateVM)
+	h.mux.HandleFunc("GET "+Prefix+"/vms/{name}", h.handleGetVM)
+	h.mux.HandleFunc("DELETE "+Prefix+"/vms/{name}", h.handleDestroyVM)
+	h.mux.HandleFunc("POST "+Prefix+"/vms/{name}/start", h.handleStartVM)
+	h.mux.HandleFunc("POST "+Prefix+"/vms/{name}/stop", h.handleStopVM)
+	h.mux.HandleFunc("GET "+Prefix+"/images", h.handleListImages)
+	h.mux.HandleFunc("POST "+Prefix+"/images", h.handleImportImage)
+	h.mux.HandleFunc("DELETE "+Prefix+"/images/{name}", h.handleDeleteImage)
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPISpec)
+}
+
+func (h *Handler) handleListVMs(w http.ResponseWriter, r *http.Request) {
+	vms, err := h.backend.ListVMs(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if vms == nil {
+		vms = []*v1alpha1.VirtualMachine{}
+	}
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{"items": vms})
+}
+
+// handleCreateVM creates a VM from a VirtualMachine in the request body, in
+// JSON or YAML, and returns the created VM.
+func (h *Handler) handleCreateVM(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		writeErrorStatus(w, r, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err))
+		return
+	}
+
+	// JSON is YAML, so both are loaded like a config file, except that the
+	// sender cannot have files on the daemon's host read
+	desired, err := loader.LoadUntrustedYAML(r.Context(), data)
+	if err != nil {
+		writeErrorStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	name, err := h.backend.CreateVM(r.Context(), desired)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	created, err := h.backend.GetVM(r.Context(), name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", Prefix+"/vms/"+name)
+	writeJSON(w, r, http.StatusCreated, created)
+}
+
+func (h *Handler) handleGetVM(w http.ResponseWriter, r *http.Request) {
+	got, err := h.backend.GetVM(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, got)
+}
+
+func (h *Handler) handleDestroyVM(w http.ResponseWriter, r *http.Request) {
+	if err := h.backend.DestroyVM(r.Context(), r.PathValue("name")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleStartVM(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := h.backend.StartVM(r.Context(), name); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	h.writeVM(w, r, name)
+}
+
+// handleStopVM shuts a VM down. The query parameters force=true and
+// timeout=<duration> map to vm.StopOptions.
+func (h *Handler) handleStopVM(w http.ResponseWriter, r *http.Request) {
+	var opts vm.StopOptions
+	query := r.URL.Query()
+	if value := query.Get("force"); value != "" {
+		force, err := strconv.ParseBool(value)
+		if err != nil {
+			writeErrorStatus(w, r, http.StatusBadRequest, fmt.Errorf("invalid force %q", value))
+			return
+		}
+		opts.Force = force
+	}
+	if value := query.Get("timeout"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			writeErrorStatus(w, r, http.StatusBadRequest, fmt.Errorf("invalid timeout %q", value))
+			return
+		}
+		opts.Timeout = timeout
+	}
+
+	name := r.PathValue("name")
+	if err := h.backend.StopVM(r.Context(), name, opts); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	h.writeVM(w, r, name)
+}
+
+// writeVM responds with the current state of the VM named name.
+func (h *Handler) writeVM(w http.ResponseWriter, r *http.Request, name string) {
+	got, err := h.backend.GetVM(r.Context(), name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, got)
+}
+
+func (h *Handler) handleListImages(w http.ResponseWriter, r *http.Request) {
+	images, err := h.backend.ListImages(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if images == nil {
+		images = []storage.VolumeInfo{}
+	}
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{"items": images})
+}
+
+// handleImportImage downloads an image into the images pool. The request
+// returns once the image has been imported.
+func (h *Handler) handleImportImage(w http.ResponseWriter, r *http.Request) {
+	var image ImageImport
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&image); err != nil {
+		writeErrorStatus(w, r, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if image.URL == "" || image.Name == "" {
+		writeErrorStatus(w, r, http.StatusBadRequest, errors.New("url and name are required"))
+		return
+	}
+
+	if err := h.backend.ImportImage(r.Context(), image); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	images, err := h.backend.ListImages(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	for _, info := range images {
+		if info.Name == image.Name {
+			w.Header().Set("Location", Prefix+"/images/"+image.Name)
+			writeJSON(w, r, http.StatusCreated, info)
+			return
+		}
+	}
+	writeError(w, r, fmt.Errorf("image %s missing after import", image.Name))
+}
+
+// handleDeleteImage deletes an image. The query parameter force=true deletes
+// it even if VM volumes are backed by it.
+func (h *Handler) handleDeleteImage(w http.ResponseWriter, r *http.Request) {
+	var force bool
+	if value := r.URL.Query().Get("force"); value != "" {
+		var err error
+		if force, err = strconv.ParseBool(value); err != nil {
+			writeErrorStatus(w, r, http.StatusBadRequest, fmt.Errorf("invalid force %q", value))
+			return
+		}
+	}
+
+	if err := h.backend.DeleteImage(r.Context(), r.PathValue("name"), force); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJSON writes v as a JSON response with the given status.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.FromContext(r.Context()).Warn("Failed to write API response", "error", err)
+	}
+}
+
+// writeError writes err as a JSON error response, with a status code derived
+// from the backend error.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeErrorStatus(w, r, http.StatusNotFound, err)
+	case errors.Is(err, ErrConflict), errors.Is(err, storage.ErrImportInProgress), errors.Is(err, storage.ErrImageInUse):
+		writeErrorStatus(w, r, http.StatusConflict, err)
+	default:
+		writeErrorStatus(w, r, http.StatusInternalServerError, err)
+	}
+}
+
+// writeErrorStatus writes err as a JSON error response with the given status.
+func writeErrorStatus(w http.ResponseWriter, r *http.Request, status int, err error) {
+	writeJSON(w, r, status, map[string]string{"error": err.Error()})
+}
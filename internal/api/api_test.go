@@ -0,0 +1,428 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/storage"
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+// fakeBackend is an in-memory backend.
+type fakeBackend struct {
+	vms      map[string]*v1alpha1.VirtualMachine
+	images   map[string]storage.VolumeInfo
+	stops    []vm.StopOptions
+	imported []ImageImport
+
+	// importing holds the names of images with an import in progress
+	importing map[string]bool
+
+	// inUse holds the names of images VM volumes are backed by
+	inUse map[string]bool
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{
+		vms:    make(map[string]*v1alpha1.VirtualMachine),
+		images: make(map[string]storage.VolumeInfo),
+	}
+}
+
+func (b *fakeBackend) ListVMs(_ context.Context) ([]*v1alpha1.VirtualMachine, error) {
+	var vms []*v1alpha1.VirtualMachine
+	for _, v := range b.vms {
+		vms = append(vms, v)
+	}
+	return vms, nil
+}
+
+func (b *fakeBackend) GetVM(_ context.Context, name string) (*v1alpha1.VirtualMachine, error) {
+	v, ok := b.vms[name]
+	if !ok {
+		return nil, fmt.Errorf("VM %s %w", name, ErrNotFound)
+	}
+	return v, nil
+}
+
+func (b *fakeBackend) CreateVM(_ context.Context, desired *v1alpha1.VirtualMachine) (string, error) {
+	if _, ok := b.vms[desired.Name]; ok {
+		return "", fmt.Errorf("VM %s %w", desired.Name, ErrConflict)
+	}
+	desired.Status.Phase = v1alpha1.VMPhaseRunning
+	b.vms[desired.Name] = desired
+	return desired.Name, nil
+}
+
+func (b *fakeBackend) DestroyVM(_ context.Context, name string) error {
+	if _, ok := b.vms[name]; !ok {
+		return fmt.Errorf("VM %s %w", name, ErrNotFound)
+	}
+	delete(b.vms, name)
+	return nil
+}
+
+func (b *fakeBackend) StartVM(_ context.Context, name string) error {
+	v, ok := b.vms[name]
+	if !ok {
+		return fmt.Errorf("VM %s %w", name, ErrNotFound)
+	}
+	v.Status.Phase = v1alpha1.VMPhaseRunning
+	return nil
+}
+
+func (b *fakeBackend) StopVM(_ context.Context, name string, opts vm.StopOptions) error {
+	v, ok := b.vms[name]
+	if !ok {
+		return fmt.Errorf("VM %s %w", name, ErrNotFound)
+	}
+	b.stops = append(b.stops, opts)
+	v.Status.Phase = v1alpha1.VMPhaseStopped
+	return nil
+}
+
+func (b *fakeBackend) ListImages(_ context.Context) ([]storage.VolumeInfo, error) {
+	var images []storage.VolumeInfo
+	for _, info := range b.images {
+		images = append(images, info)
+	}
+	return images, nil
+}
+
+func (b *fakeBackend) ImportImage(_ context.Context, image ImageImport) error {
+	if b.importing[image.Name] {
+		return fmt.Errorf("image %s: %w", image.Name, storage.ErrImportInProgress)
+	}
+	if _, ok := b.images[image.Name]; ok {
+		return fmt.Errorf("image %s %w", image.Name, ErrConflict)
+	}
+	b.imported = append(b.imported, image)
+	b.images[image.Name] = storage.VolumeInfo{Name: image.Name, Pool: storage.DefaultImagesPool}
+	return nil
+}
+
+func (b *fakeBackend) DeleteImage(_ context.Context, name string, force bool) error {
+	if _, ok := b.images[name]; !ok {
+		return fmt.Errorf("image %s %w", name, ErrNotFound)
+	}
+	if b.inUse[name] && !force {
+		return fmt.Errorf("%w: %s is the backing image of web-1", storage.ErrImageInUse, name)
+	}
+	delete(b.images, name)
+	return nil
+}
+
+const testVMYAML = `apiVersion: foundry.cofront.xyz/v1alpha1
+kind: VirtualMachine
+metadata:
+  name: web-1
+spec:
+  vcpus: 2
+  memoryGiB: 4
+  bootDisk:
+    sizeGB: 20
+    image: fedora-43.qcow2
+  networkInterfaces:
+    - ip: 10.20.30.40/24
+      gateway: 10.20.30.1
+      bridge: br0
+`
+
+// do sends a request to h and returns the response.
+func do(t *testing.T, h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+// decode decodes a JSON response body into v.
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("failed to decode response %q: %v", rec.Body.String(), err)
+	}
+}
+
+func TestCreateVM(t *testing.T) {
+	backend := newFakeBackend()
+	h := newHandler(backend)
+
+	rec := do(t, h, http.MethodPost, Prefix+"/vms", testVMYAML)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	if got := rec.Header().Get("Location"); got != Prefix+"/vms/web-1" {
+		t.Errorf("Location = %q", got)
+	}
+
+	var created v1alpha1.VirtualMachine
+	decode(t, rec, &created)
+	if created.Name != "web-1" || created.Spec.VCPUs != 2 || created.Status.Phase != v1alpha1.VMPhaseRunning {
+		t.Errorf("created = %+v", created)
+	}
+
+	// Creating it again conflicts
+	rec = do(t, h, http.MethodPost, Prefix+"/vms", testVMYAML)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("second create status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestCreateVM_Invalid(t *testing.T) {
+	backend := newFakeBackend()
+	h := newHandler(backend)
+
+	rec := do(t, h, http.MethodPost, Prefix+"/vms", strings.Replace(testVMYAML, "vcpus: 2", "vcpus: 0", 1))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	var body map[string]string
+	decode(t, rec, &body)
+	if !strings.Contains(body["error"], "vcpus") {
+		t.Errorf("error = %q, want validation error", body["error"])
+	}
+	if len(backend.vms) != 0 {
+		t.Error("expected an invalid VM not to be created")
+	}
+}
+
+func TestCreateVM_RejectsUserDataFile(t *testing.T) {
+	backend := newFakeBackend()
+	h := newHandler(backend)
+
+	secret := filepath.Join(t.TempDir(), "shadow")
+	if err := os.WriteFile(secret, []byte("root:$6$hash\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	body := testVMYAML + "  cloudInit:\n    userDataFile: " + secret + "\n"
+
+	rec := do(t, h, http.MethodPost, Prefix+"/vms", body)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if strings.Contains(rec.Body.String(), "root:") {
+		t.Errorf("response %q leaks the file content", rec.Body.String())
+	}
+	if len(backend.vms) != 0 {
+		t.Error("expected a VM referring to a host file not to be created")
+	}
+}
+
+func TestListAndGetVM(t *testing.T) {
+	backend := newFakeBackend()
+	backend.vms["web-1"] = v1alpha1.NewVirtualMachine("web-1")
+	h := newHandler(backend)
+
+	rec := do(t, h, http.MethodGet, Prefix+"/vms", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list status = %d", rec.Code)
+	}
+	var list struct {
+		Items []v1alpha1.VirtualMachine `json:"items"`
+	}
+	decode(t, rec, &list)
+	if len(list.Items) != 1 || list.Items[0].Name != "web-1" {
+		t.Errorf("items = %+v, want web-1", list.Items)
+	}
+
+	rec = do(t, h, http.MethodGet, Prefix+"/vms/web-1", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get status = %d", rec.Code)
+	}
+
+	rec = do(t, h, http.MethodGet, Prefix+"/vms/missing", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("get missing status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestListVMs_Empty(t *testing.T) {
+	rec := do(t, newHandler(newFakeBackend()), http.MethodGet, Prefix+"/vms", "")
+	if strings.TrimSpace(rec.Body.String()) != `{"items":[]}` {
+		t.Errorf("body = %s, want an empty list", rec.Body.String())
+	}
+}
+
+func TestDestroyVM(t *testing.T) {
+	backend := newFakeBackend()
+	backend.vms["web-1"] = v1alpha1.NewVirtualMachine("web-1")
+	h := newHandler(backend)
+
+	if rec := do(t, h, http.MethodDelete, Prefix+"/vms/web-1", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if _, ok := backend.vms["web-1"]; ok {
+		t.Error("expected the VM to be destroyed")
+	}
+	if rec := do(t, h, http.MethodDelete, Prefix+"/vms/web-1", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("second destroy status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestStartStopVM(t *testing.T) {
+	backend := newFakeBackend()
+	backend.vms["web-1"] = v1alpha1.NewVirtualMachine("web-1")
+	h := newHandler(backend)
+
+	rec := do(t, h, http.MethodPost, Prefix+"/vms/web-1/stop?force=true&timeout=10s", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("stop status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var got v1alpha1.VirtualMachine
+	decode(t, rec, &got)
+	if got.Status.Phase != v1alpha1.VMPhaseStopped {
+		t.Errorf("phase after stop = %q, want Stopped", got.Status.Phase)
+	}
+	want := vm.StopOptions{Force: true, Timeout: 10 * time.Second}
+	if len(backend.stops) != 1 || backend.stops[0] != want {
+		t.Errorf("stop options = %+v, want %+v", backend.stops, want)
+	}
+
+	rec = do(t, h, http.MethodPost, Prefix+"/vms/web-1/start", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("start status = %d: %s", rec.Code, rec.Body.String())
+	}
+	decode(t, rec, &got)
+	if got.Status.Phase != v1alpha1.VMPhaseRunning {
+		t.Errorf("phase after start = %q, want Running", got.Status.Phase)
+	}
+
+	if rec := do(t, h, http.MethodPost, Prefix+"/vms/missing/start", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("start missing status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestStopVM_InvalidQuery(t *testing.T) {
+	backend := newFakeBackend()
+	backend.vms["web-1"] = v1alpha1.NewVirtualMachine("web-1")
+	h := newHandler(backend)
+
+	for _, query := range []string{"force=maybe", "timeout=soon", "timeout=-1s"} {
+		if rec := do(t, h, http.MethodPost, Prefix+"/vms/web-1/stop?"+query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+	if len(backend.stops) != 0 {
+		t.Error("expected the VM not to be stopped")
+	}
+}
+
+func TestImages(t *testing.T) {
+	backend := newFakeBackend()
+	h := newHandler(backend)
+
+	body := `{"url": "https://example.com/fedora-43.qcow2", "name": "fedora-43.qcow2", "sha256": "abc", "labels": {"team": "infra"}}`
+	rec := do(t, h, http.MethodPost, Prefix+"/images", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("import status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var image storage.VolumeInfo
+	decode(t, rec, &image)
+	if image.Name != "fedora-43.qcow2" {
+		t.Errorf("imported image = %+v", image)
+	}
+	want := ImageImport{URL: "https://example.com/fedora-43.qcow2", Name: "fedora-43.qcow2", SHA256: "abc", Labels: map[string]string{"team": "infra"}}
+	if len(backend.imported) != 1 || !reflect.DeepEqual(backend.imported[0], want) {
+		t.Errorf("imported = %+v, want %+v", backend.imported, want)
+	}
+
+	if rec := do(t, h, http.MethodPost, Prefix+"/images", body); rec.Code != http.StatusConflict {
+		t.Errorf("second import status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	rec = do(t, h, http.MethodGet, Prefix+"/images", "")
+	var list struct {
+		Items []storage.VolumeInfo `json:"items"`
+	}
+	decode(t, rec, &list)
+	if len(list.Items) != 1 {
+		t.Errorf("images = %+v, want one", list.Items)
+	}
+
+	backend.inUse = map[string]bool{"fedora-43.qcow2": true}
+	if rec := do(t, h, http.MethodDelete, Prefix+"/images/fedora-43.qcow2", ""); rec.Code != http.StatusConflict {
+		t.Errorf("delete of image in use status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if rec := do(t, h, http.MethodDelete, Prefix+"/images/fedora-43.qcow2?force=maybe", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("delete with invalid force status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := do(t, h, http.MethodDelete, Prefix+"/images/fedora-43.qcow2?force=true", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("delete status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if rec := do(t, h, http.MethodDelete, Prefix+"/images/fedora-43.qcow2", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("second delete status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestImportImage_InProgress(t *testing.T) {
+	backend := newFakeBackend()
+	backend.importing = map[string]bool{"fedora-43.qcow2": true}
+	h := newHandler(backend)
+
+	body := `{"url": "https://example.com/fedora-43.qcow2", "name": "fedora-43.qcow2"}`
+	rec := do(t, h, http.MethodPost, Prefix+"/images", body)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("import status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if !strings.Contains(rec.Body.String(), "import in progress") {
+		t.Errorf("import error = %s, want import in progress", rec.Body.String())
+	}
+}
+
+func TestImportImage_InvalidBody(t *testing.T) {
+	backend := newFakeBackend()
+	h := newHandler(backend)
+
+	for _, body := range []string{`not json`, `{"name": "fedora-43.qcow2"}`, `{"url": "https://x", "name": "a.qcow2", "path": "/etc"}`} {
+		if rec := do(t, h, http.MethodPost, Prefix+"/images", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+	if len(backend.imported) != 0 {
+		t.Error("expected nothing to be imported")
+	}
+}
+
+func TestBackendError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeError(rec, httptest.NewRequest(http.MethodGet, Prefix+"/vms", nil), errors.New("libvirt is down"))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	rec := do(t, newHandler(newFakeBackend()), http.MethodGet, Prefix+"/openapi.json", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+
+	var spec struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	decode(t, rec, &spec)
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("openapi = %q, want 3.x", spec.OpenAPI)
+	}
+	for _, path := range []string{"/vms", "/vms/{name}", "/vms/{name}/start", "/vms/{name}/stop", "/images", "/images/{name}"} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("spec is missing path %s", path)
+		}
+	}
+}
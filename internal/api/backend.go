@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/storage"
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+// libvirtBackend manages the VMs and images of the libvirt host foundry is
+// connected to.
+type libvirtBackend struct{}
+
+// ListVMs returns all VMs with their live status.
+func (libvirtBackend) ListVMs(ctx context.Context) ([]*v1alpha1.VirtualMachine, error) {
+	return vm.ListVMs(ctx)
+}
+
+// GetVM returns the VM named name with its live status.
+func (libvirtBackend) GetVM(ctx context.Context, name string) (*v1alpha1.VirtualMachine, error) {
+	got, err := vm.Get(ctx, name)
+	if vm.IsNotFound(err) {
+		return nil, fmt.Errorf("VM %s %w", name, ErrNotFound)
+	}
+	return got, err
+}
+
+// CreateVM creates desired and returns the name of the created VM.
+func (b libvirtBackend) CreateVM(ctx context.Context, desired *v1alpha1.VirtualMachine) (string, error) {
+	if desired.Name != "" {
+		if _, err := b.GetVM(ctx, desired.Name); err == nil {
+			return "", fmt.Errorf("VM %s %w", desired.Name, ErrConflict)
+		}
+	}
+
+	result, err := vm.CreateFromConfig(ctx, desired)
+	if err != nil {
+		return "", err
+	}
+	return result.VMName, nil
+}
+
+// DestroyVM destroys the VM named name and its storage.
+func (libvirtBackend) DestroyVM(ctx context.Context, name string) error {
+	_, err := vm.Destroy(ctx, name, vm.DestroyOptions{})
+	if vm.IsNotFound(err) {
+		return fmt.Errorf("VM %s %w", name, ErrNotFound)
+	}
+	return err
+}
+
+// StartVM starts the VM named name.
+func (libvirtBackend) StartVM(ctx context.Context, name string) error {
+	err := vm.Start(ctx, name)
+	if vm.IsNotFound(err) {
+		return fmt.Errorf("VM %s %w", name, ErrNotFound)
+	}
+	return err
+}
+
+// StopVM stops the VM named name.
+func (libvirtBackend) StopVM(ctx context.Context, name string, opts vm.StopOptions) error {
+	err := vm.Stop(ctx, name, opts)
+	if vm.IsNotFound(err) {
+		return fmt.Errorf("VM %s %w", name, ErrNotFound)
+	}
+	return err
+}
+
+// ListImages returns the images in the images pool.
+func (libvirtBackend) ListImages(ctx context.Context) ([]storage.VolumeInfo, error) {
+	var images []storage.VolumeInfo
+	err := withStorage(ctx, func(mgr *storage.Manager) error {
+		var err error
+		images, err = mgr.ListImages(ctx)
+		return err
+	})
+	return images, err
+}
+
+// ImportImage downloads an image into the images pool.
+func (libvirtBackend) ImportImage(ctx context.Context, image ImageImport) error {
+	return withStorage(ctx, func(mgr *storage.Manager) error {
+		// An image being imported already has its volume, so check this first
+		inProgress, err := mgr.ImportInProgress(ctx, image.Name)
+		if err != nil {
+			return err
+		}
+		if inProgress {
+			return fmt.Errorf("image %s: %w", image.Name, storage.ErrImportInProgress)
+		}
+
+		exists, err := mgr.ImageExists(ctx, image.Name)
+		if err != nil {
+			return fmt.Errorf("failed to check if image exists: %w", err)
+		}
+		if exists {
+			return fmt.Errorf("image %s %w", image.Name, ErrConflict)
+		}
+
+		logging.FromContext(ctx).Info("Importing image", "image", image.Name, "url", image.URL)
+		if err := mgr.ImportImageFromURL(ctx, image.URL, image.Name, storage.URLImportOptions{
+			SHA256: image.SHA256,
+			SHA512: image.SHA512,
+			ImportOptions: storage.ImportOptions{Metadata: storage.ImageMetadata{
+				DefaultUser: image.DefaultUser,
+				OSVariant:   image.OSVariant,
+				Labels:      image.Labels,
+			}},
+		}); err != nil {
+			return fmt.Errorf("failed to import image: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeleteImage deletes an image from the images pool, unless VM volumes are
+// backed by it and force is false.
+func (libvirtBackend) DeleteImage(ctx context.Context, name string, force bool) error {
+	return withStorage(ctx, func(mgr *storage.Manager) error {
+		exists, err := mgr.ImageExists(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to check if image exists: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("image %s %w", name, ErrNotFound)
+		}
+
+		if err := mgr.DeleteImage(ctx, name, force); err != nil {
+			return fmt.Errorf("failed to delete image: %w", err)
+		}
+		return nil
+	})
+}
+
+// withStorage connects to libvirt, ensures the default pools exist and calls
+// fn with a storage manager.
+func withStorage(ctx context.Context, fn func(mgr *storage.Manager) error) error {
+	client, err := libvirt.ConnectWithContext(ctx, "", 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			logging.FromContext(ctx).Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	mgr := storage.NewManager(client.Libvirt())
+	if err := mgr.EnsureDefaultPools(ctx); err != nil {
+		return fmt.Errorf("failed to ensure default pools: %w", err)
+	}
+	return fn(mgr)
+}
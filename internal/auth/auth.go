@@ -0,0 +1,207 @@
+// Package auth provides authentication and authorization for the daemon
+// mode API: static bearer tokens and mutual TLS client certificates, each
+// mapped to a role, plus per-request audit logging.
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Role determines what an authenticated caller may do.
+type Role string
+
+const (
+	// RoleReadOnly may only perform safe (read) requests.
+	RoleReadOnly Role = "read-only"
+
+	// RoleAdmin may perform any request.
+	RoleAdmin Role = "admin"
+)
+
+// Allows reports whether the role may perform a request with the given method.
+func (r Role) Allows(method string) bool {
+	switch r {
+	case RoleAdmin:
+		return true
+	case RoleReadOnly:
+		return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+	default:
+		return false
+	}
+}
+
+// Valid reports whether r is a known role.
+func (r Role) Valid() bool {
+	return r == RoleReadOnly || r == RoleAdmin
+}
+
+// Token grants a role to callers presenting a static bearer token.
+type Token struct {
+	// Name identifies the token holder in audit logs.
+	Name string `yaml:"name"`
+
+	// Token is the secret bearer token.
+	Token string `yaml:"token"`
+
+	// Role is the role granted to the holder.
+	Role Role `yaml:"role"`
+}
+
+// Client grants a role to callers presenting a TLS client certificate,
+// verified against the server's client CA, with a matching common name.
+type Client struct {
+	// CommonName is the certificate subject CN.
+	CommonName string `yaml:"commonName"`
+
+	// Role is the role granted to the client.
+	Role Role `yaml:"role"`
+}
+
+// Config is the daemon's auth configuration file.
+//
+// Example:
+//
+//	tokens:
+//	  - name: ci
+//	    token: 3c1f0a...
+//	    role: admin
+//	clients:
+//	  - commonName: monitoring.example.com
+//	    role: read-only
+type Config struct {
+	Tokens  []Token  `yaml:"tokens"`
+	Clients []Client `yaml:"clients"`
+}
+
+// LoadConfig loads an auth configuration file.
+// The file holds secrets, so it is rejected if other users can read it.
+func LoadConfig(path string) (*Config, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat auth config: %w", err)
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("auth config %s must not be accessible by group or others (mode %04o, want 0600)", path, info.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read auth config: %w", err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse auth config: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid auth config: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// Validate checks the configuration for missing fields, unknown roles and
+// duplicate identities.
+func (c *Config) Validate() error {
+	if len(c.Tokens) == 0 && len(c.Clients) == 0 {
+		return errors.New("at least one token or client must be configured")
+	}
+
+	names := make(map[string]bool)
+	for i, t := range c.Tokens {
+		if t.Name == "" {
+			return fmt.Errorf("tokens[%d]: name is required", i)
+		}
+		if len(t.Token) < 16 {
+			return fmt.Errorf("tokens[%d] (%s): token must be at least 16 characters", i, t.Name)
+		}
+		if !t.Role.Valid() {
+			return fmt.Errorf("tokens[%d] (%s): invalid role %q (must be %s or %s)", i, t.Name, t.Role, RoleReadOnly, RoleAdmin)
+		}
+		if names[t.Name] {
+			return fmt.Errorf("tokens[%d]: duplicate name %q", i, t.Name)
+		}
+		names[t.Name] = true
+	}
+
+	commonNames := make(map[string]bool)
+	for i, cl := range c.Clients {
+		if cl.CommonName == "" {
+			return fmt.Errorf("clients[%d]: commonName is required", i)
+		}
+		if !cl.Role.Valid() {
+			return fmt.Errorf("clients[%d] (%s): invalid role %q (must be %s or %s)", i, cl.CommonName, cl.Role, RoleReadOnly, RoleAdmin)
+		}
+		if commonNames[cl.CommonName] {
+			return fmt.Errorf("clients[%d]: duplicate commonName %q", i, cl.CommonName)
+		}
+		commonNames[cl.CommonName] = true
+	}
+
+	return nil
+}
+
+// Identity is an authenticated caller.
+type Identity struct {
+	// Name is the token name or certificate common name.
+	Name string
+
+	// Method is how the caller authenticated ("token" or "mtls").
+	Method string
+
+	// Role is the caller's role.
+	Role Role
+}
+
+// ErrUnauthenticated is returned when a request carries no valid credentials.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Authenticator authenticates requests against a Config.
+type Authenticator struct {
+	cfg *Config
+}
+
+// NewAuthenticator creates an Authenticator for cfg.
+func NewAuthenticator(cfg *Config) *Authenticator {
+	return &Authenticator{cfg: cfg}
+}
+
+// Authenticate identifies the caller of r.
+//
+// A bearer token in the Authorization header takes precedence; otherwise a
+// verified TLS client certificate is matched by common name. Certificates are
+// only considered if the TLS stack verified them against the client CA.
+func (a *Authenticator) Authenticate(r *http.Request) (Identity, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			return Identity{}, fmt.Errorf("%w: unsupported authorization scheme", ErrUnauthenticated)
+		}
+		for _, t := range a.cfg.Tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+				return Identity{Name: t.Name, Method: "token", Role: t.Role}, nil
+			}
+		}
+		return Identity{}, fmt.Errorf("%w: invalid token", ErrUnauthenticated)
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		for _, cl := range a.cfg.Clients {
+			if cl.CommonName == cn {
+				return Identity{Name: cn, Method: "mtls", Role: cl.Role}, nil
+			}
+		}
+		return Identity{}, fmt.Errorf("%w: client certificate %q is not authorized", ErrUnauthenticated, cn)
+	}
+
+	return Identity{}, fmt.Errorf("%w: no credentials provided", ErrUnauthenticated)
+}
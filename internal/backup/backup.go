@@ -0,0 +1,350 @@
+// Package backup stores VM backups in a directory.
+//
+// Each backup holds a VM's spec, its domain XML and a copy of each of its disk
+// images. A full backup stores the images whole; an incremental backup only
+// stores the blocks of each image that changed since its parent backup, and is
+// read back through its chain of parents down to the last full backup.
+//
+// Layout of a backup directory:
+//
+//	<dir>/<vm>/<id>/backup.yaml       manifest (see Manifest)
+//	<dir>/<vm>/<id>/<file>            files of the backup, e.g. the VM spec
+//	<dir>/<vm>/<id>/<volume>          disk image; blocks not stored are holes
+//	<dir>/<vm>/<id>/<volume>.blocks   SHA-256 of every block of the image
+//
+// Backups are written into a hidden staging directory and renamed into place
+// once complete, so an interrupted backup never shows up in the list.
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Kind is the kind of a backup.
+type Kind string
+
+const (
+	// KindFull backups store every block of the disk images.
+	KindFull Kind = "full"
+
+	// KindIncremental backups store the blocks that changed since their
+	// parent.
+	KindIncremental Kind = "incremental"
+)
+
+// BlockSize is the granularity at which incremental backups detect changes.
+const BlockSize = 4 << 20
+
+const (
+	// ManifestFile is the name of the manifest in a backup's directory.
+	ManifestFile = "backup.yaml"
+
+	indexSuffix  = ".blocks"
+	stagingAffix = ".partial"
+)
+
+// ErrNotFound is returned when a VM has no backup with the requested ID.
+var ErrNotFound = errors.New("backup not found")
+
+// Manifest describes a backup.
+type Manifest struct {
+	ID      string    `json:"id" yaml:"id"`                             // Unique within the VM, sortable by time
+	VM      string    `json:"vm" yaml:"vm"`                             // Name of the VM backed up
+	Kind    Kind      `json:"kind" yaml:"kind"`                         // Full or incremental
+	Parent  string    `json:"parent,omitempty" yaml:"parent,omitempty"` // ID of the parent of an incremental backup
+	Created time.Time `json:"created" yaml:"created"`                   // When the backup was taken
+	Files   []string  `json:"files,omitempty" yaml:"files,omitempty"`   // Files stored alongside the disks
+	Disks   []Disk    `json:"disks" yaml:"disks"`                       // Disk images, in the order written
+}
+
+// Disk is a disk image of a backup.
+type Disk struct {
+	Device string `json:"device,omitempty" yaml:"device,omitempty"` // Target device (e.g., vda), empty for the cloud-init ISO
+	Volume string `json:"volume" yaml:"volume"`                     // Volume the image was copied from
+	Format string `json:"format" yaml:"format"`                     // Format of the image (qcow2, raw)
+	Size   int64  `json:"size" yaml:"size"`                         // Size of the image in bytes
+	Stored int64  `json:"stored" yaml:"stored"`                     // Bytes of changed blocks stored in this backup
+}
+
+// StoredSize returns the bytes of disk blocks stored in the backup.
+func (m *Manifest) StoredSize() int64 {
+	var total int64
+	for _, disk := range m.Disks {
+		total += disk.Stored
+	}
+	return total
+}
+
+// disk returns the disk of the backup copied from volume, or nil.
+func (m *Manifest) disk(volume string) *Disk {
+	for i := range m.Disks {
+		if m.Disks[i].Volume == volume {
+			return &m.Disks[i]
+		}
+	}
+	return nil
+}
+
+// Repository is a directory of VM backups.
+type Repository struct {
+	dir string
+
+	// now returns the current time; replaced in tests.
+	now func() time.Time
+}
+
+// NewRepository returns the repository of backups in dir. The directory is
+// created by the first backup.
+func NewRepository(dir string) *Repository {
+	return &Repository{dir: dir, now: time.Now}
+}
+
+// Dir returns the directory holding the backup with the given ID of a VM.
+func (r *Repository) Dir(vmName, id string) string {
+	return filepath.Join(r.dir, vmName, id)
+}
+
+// VMs returns the names of the VMs with backups, sorted.
+func (r *Repository) VMs() ([]string, error) {
+	entries, err := os.ReadDir(r.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// List returns the backups of a VM, oldest first.
+func (r *Repository) List(vmName string) ([]Manifest, error) {
+	entries, err := os.ReadDir(filepath.Join(r.dir, vmName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backups of VM '%s': %w", vmName, err)
+	}
+
+	var manifests []Manifest
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		m, err := r.readManifest(vmName, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, *m)
+	}
+
+	sort.Slice(manifests, func(i, j int) bool {
+		if !manifests[i].Created.Equal(manifests[j].Created) {
+			return manifests[i].Created.Before(manifests[j].Created)
+		}
+		return manifests[i].ID < manifests[j].ID
+	})
+	return manifests, nil
+}
+
+// Get returns the backup of a VM with the given ID, or its latest backup if
+// id is empty. It returns an error wrapping ErrNotFound if there is none.
+func (r *Repository) Get(vmName, id string) (*Manifest, error) {
+	if id != "" {
+		m, err := r.readManifest(vmName, id)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: VM '%s' has no backup %s", ErrNotFound, vmName, id)
+		}
+		return m, err
+	}
+
+	manifests, err := r.List(vmName)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("%w: VM '%s' has no backups", ErrNotFound, vmName)
+	}
+	return &manifests[len(manifests)-1], nil
+}
+
+// Chain returns a backup followed by its parents, down to the full backup it
+// is based on.
+func (r *Repository) Chain(m *Manifest) ([]Manifest, error) {
+	chain := []Manifest{*m}
+	for seen := map[string]bool{m.ID: true}; chain[len(chain)-1].Kind == KindIncremental; {
+		parentID := chain[len(chain)-1].Parent
+		if seen[parentID] {
+			return nil, fmt.Errorf("backup %s of VM '%s' has a cycle in its parents", m.ID, m.VM)
+		}
+		seen[parentID] = true
+
+		parent, err := r.readManifest(m.VM, parentID)
+		if err != nil {
+			return nil, fmt.Errorf("parent %s of backup %s is unreadable: %w", parentID, m.ID, err)
+		}
+		chain = append(chain, *parent)
+	}
+	return chain, nil
+}
+
+// ReadFile returns the contents of a file stored in a backup.
+func (r *Repository) ReadFile(m *Manifest, name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(r.Dir(m.VM, m.ID), name))
+}
+
+// ReadDisk writes the disk image copied from volume in a backup to w. Blocks
+// that an incremental backup did not store are read from its parents, and
+// every block is checked against the backup's index.
+func (r *Repository) ReadDisk(m *Manifest, volume string, w io.Writer) error {
+	disk := m.disk(volume)
+	if disk == nil {
+		return fmt.Errorf("backup %s of VM '%s' has no disk %s", m.ID, m.VM, volume)
+	}
+
+	chain, err := r.Chain(m)
+	if err != nil {
+		return err
+	}
+
+	// The index of the volume in each backup of the chain; the chain ends at
+	// the first backup without the volume
+	var indexes [][]byte
+	for _, link := range chain {
+		if link.disk(volume) == nil {
+			break
+		}
+		index, err := os.ReadFile(r.indexPath(&link, volume))
+		if err != nil {
+			return fmt.Errorf("failed to read block index of %s in backup %s: %w", volume, link.ID, err)
+		}
+		indexes = append(indexes, index)
+	}
+
+	files := make([]*os.File, len(indexes))
+	defer func() {
+		for _, f := range files {
+			if f != nil {
+				_ = f.Close()
+			}
+		}
+	}()
+
+	buf := make([]byte, BlockSize)
+	for i, offset := 0, int64(0); offset < disk.Size; i, offset = i+1, offset+BlockSize {
+		want := blockHash(indexes[0], i)
+		if want == nil {
+			return fmt.Errorf("block index of %s in backup %s is truncated", volume, m.ID)
+		}
+
+		// The block is stored in the oldest backup since it last changed
+		link := 0
+		for link+1 < len(indexes) && chain[link].Kind == KindIncremental && bytes.Equal(blockHash(indexes[link+1], i), want) {
+			link++
+		}
+
+		if files[link] == nil {
+			f, err := os.Open(filepath.Join(r.Dir(m.VM, chain[link].ID), volume))
+			if err != nil {
+				return fmt.Errorf("failed to open %s in backup %s: %w", volume, chain[link].ID, err)
+			}
+			files[link] = f
+		}
+
+		block := buf[:min(BlockSize, disk.Size-offset)]
+		if _, err := files[link].ReadAt(block, offset); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read %s in backup %s: %w", volume, chain[link].ID, err)
+		}
+		sum := sha256.Sum256(block)
+		if !bytes.Equal(sum[:], want) {
+			return fmt.Errorf("block %d of %s in backup %s is corrupt", i, volume, chain[link].ID)
+		}
+		if _, err := w.Write(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prune deletes the backups of a VM except the newest keep backups and the
+// parents they need to be restored. It returns the IDs of the deleted
+// backups, oldest first. keep must be positive.
+func (r *Repository) Prune(vmName string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, fmt.Errorf("invalid number of backups to keep: %d", keep)
+	}
+
+	manifests, err := r.List(vmName)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make(map[string]string, len(manifests))
+	for _, m := range manifests {
+		parents[m.ID] = m.Parent
+	}
+	kept := make(map[string]bool)
+	for i := max(len(manifests)-keep, 0); i < len(manifests); i++ {
+		for id := manifests[i].ID; id != "" && !kept[id]; id = parents[id] {
+			kept[id] = true
+		}
+	}
+
+	var deleted []string
+	for _, m := range manifests {
+		if kept[m.ID] {
+			continue
+		}
+		if err := os.RemoveAll(r.Dir(vmName, m.ID)); err != nil {
+			return deleted, fmt.Errorf("failed to delete backup %s: %w", m.ID, err)
+		}
+		deleted = append(deleted, m.ID)
+	}
+	return deleted, nil
+}
+
+// readManifest reads the manifest of a backup.
+func (r *Repository) readManifest(vmName, id string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(r.Dir(vmName, id), ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest of backup %s: %w", id, err)
+	}
+	return &m, nil
+}
+
+// indexPath returns the path of the block index of volume in a backup.
+func (r *Repository) indexPath(m *Manifest, volume string) string {
+	return filepath.Join(r.Dir(m.VM, m.ID), volume+indexSuffix)
+}
+
+// blockHash returns the hash of block i in an index, or nil if the index has
+// no such block.
+func blockHash(index []byte, i int) []byte {
+	start := i * sha256.Size
+	if start+sha256.Size > len(index) {
+		return nil
+	}
+	return index[start : start+sha256.Size]
+}
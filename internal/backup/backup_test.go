@@ -0,0 +1,240 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestRepository returns a repository in a temporary directory whose clock
+// advances a minute per backup.
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+	repo := NewRepository(t.TempDir())
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	repo.now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+	return repo
+}
+
+// testImage returns an image of two and a half blocks: a block of ones, a
+// block of zeros and half a block of twos.
+func testImage() []byte {
+	image := bytes.Repeat([]byte{1}, BlockSize)
+	image = append(image, make([]byte, BlockSize)...)
+	return append(image, bytes.Repeat([]byte{2}, BlockSize/2)...)
+}
+
+// writeBackup writes a backup of the "web" VM holding image as web_boot.qcow2.
+func writeBackup(t *testing.T, repo *Repository, parent *Manifest, image []byte) *Manifest {
+	t.Helper()
+	w, err := repo.Create("web", parent)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	defer w.Abort()
+
+	if err := w.WriteFile("vm.yaml", []byte("name: web\n")); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := w.WriteDisk("vda", "web_boot.qcow2", "qcow2", bytes.NewReader(image)); err != nil {
+		t.Fatalf("WriteDisk() error = %v", err)
+	}
+	m, err := w.Commit()
+	if err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	return m
+}
+
+// readDisk reads back web_boot.qcow2 from a backup.
+func readDisk(t *testing.T, repo *Repository, m *Manifest) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := repo.ReadDisk(m, "web_boot.qcow2", &buf); err != nil {
+		t.Fatalf("ReadDisk(%s) error = %v", m.ID, err)
+	}
+	return buf.Bytes()
+}
+
+func TestRepository_FullAndIncremental(t *testing.T) {
+	repo := newTestRepository(t)
+
+	image := testImage()
+	full := writeBackup(t, repo, nil, image)
+	if full.Kind != KindFull || full.Disks[0].Size != int64(len(image)) || full.Disks[0].Stored != int64(len(image)) {
+		t.Errorf("full backup = %+v", full)
+	}
+
+	// Change the last block and grow the image by a block
+	changed := append([]byte(nil), image...)
+	changed[len(changed)-1] = 3
+	changed = append(changed, bytes.Repeat([]byte{4}, BlockSize)...)
+	incr := writeBackup(t, repo, full, changed)
+	if incr.Kind != KindIncremental || incr.Parent != full.ID {
+		t.Errorf("incremental backup = %+v", incr)
+	}
+	// The old last block, now a whole block, and the new half block changed
+	if want := int64(BlockSize + BlockSize/2); incr.Disks[0].Stored != want {
+		t.Errorf("incremental stored %d bytes, want %d", incr.Disks[0].Stored, want)
+	}
+
+	// Unchanged blocks are holes in the incremental's image
+	info, err := os.Stat(filepath.Join(repo.Dir("web", incr.ID), "web_boot.qcow2"))
+	if err != nil || info.Size() != int64(len(changed)) {
+		t.Fatalf("incremental image: %v, %v", info, err)
+	}
+
+	if got := readDisk(t, repo, full); !bytes.Equal(got, image) {
+		t.Error("full backup does not read back the image")
+	}
+	if got := readDisk(t, repo, incr); !bytes.Equal(got, changed) {
+		t.Error("incremental backup does not read back the changed image")
+	}
+
+	// A second incremental without changes stores nothing
+	incr2 := writeBackup(t, repo, incr, changed)
+	if incr2.StoredSize() != 0 {
+		t.Errorf("unchanged incremental stored %d bytes", incr2.StoredSize())
+	}
+	if got := readDisk(t, repo, incr2); !bytes.Equal(got, changed) {
+		t.Error("second incremental does not read back the image")
+	}
+	chain, err := repo.Chain(incr2)
+	if err != nil || len(chain) != 3 || chain[2].ID != full.ID {
+		t.Errorf("Chain() = %v, %v", chain, err)
+	}
+
+	data, err := repo.ReadFile(incr2, "vm.yaml")
+	if err != nil || string(data) != "name: web\n" {
+		t.Errorf("ReadFile() = %q, %v", data, err)
+	}
+}
+
+func TestRepository_Create_Private(t *testing.T) {
+	repo := newTestRepository(t)
+	m := writeBackup(t, repo, nil, testImage())
+
+	// Backups hold guest disks and cloud-init secrets
+	err := filepath.WalkDir(filepath.Dir(repo.Dir("web", m.ID)), func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if perm := info.Mode().Perm(); perm&0o077 != 0 {
+			t.Errorf("%s has mode %o, want no group or other access", path, perm)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkDir() error = %v", err)
+	}
+}
+
+func TestRepository_ReadDisk_Corrupt(t *testing.T) {
+	repo := newTestRepository(t)
+	m := writeBackup(t, repo, nil, testImage())
+
+	path := filepath.Join(repo.Dir("web", m.ID), "web_boot.qcow2")
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte{9}, 10); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	if err := repo.ReadDisk(m, "web_boot.qcow2", &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Errorf("ReadDisk() error = %v, want corrupt block", err)
+	}
+}
+
+func TestRepository_ListAndGet(t *testing.T) {
+	repo := newTestRepository(t)
+
+	if _, err := repo.Get("web", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() without backups error = %v, want ErrNotFound", err)
+	}
+
+	first := writeBackup(t, repo, nil, testImage())
+	second := writeBackup(t, repo, first, testImage())
+
+	// An interrupted backup is not listed
+	w, err := repo.Create("web", nil)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	defer w.Abort()
+
+	manifests, err := repo.List("web")
+	if err != nil || len(manifests) != 2 || manifests[0].ID != first.ID || manifests[1].ID != second.ID {
+		t.Fatalf("List() = %v, %v", manifests, err)
+	}
+	latest, err := repo.Get("web", "")
+	if err != nil || latest.ID != second.ID {
+		t.Errorf("Get(latest) = %v, %v", latest, err)
+	}
+	if _, err := repo.Get("web", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(missing) error = %v, want ErrNotFound", err)
+	}
+
+	vms, err := repo.VMs()
+	if err != nil || len(vms) != 1 || vms[0] != "web" {
+		t.Errorf("VMs() = %v, %v", vms, err)
+	}
+}
+
+func TestRepository_Create_SameSecond(t *testing.T) {
+	repo := newTestRepository(t)
+	repo.now = func() time.Time { return time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC) }
+
+	first := writeBackup(t, repo, nil, testImage())
+	second := writeBackup(t, repo, nil, testImage())
+	if first.ID != "20261017-120000" || second.ID != "20261017-120000-2" {
+		t.Errorf("IDs = %s, %s", first.ID, second.ID)
+	}
+	if _, err := repo.Create("../web", nil); err == nil {
+		t.Error("Create() with a path as VM name expected error")
+	}
+}
+
+func TestRepository_Prune(t *testing.T) {
+	repo := newTestRepository(t)
+
+	// full1 <- incr1, full2 <- incr2 <- incr3
+	full1 := writeBackup(t, repo, nil, testImage())
+	writeBackup(t, repo, full1, testImage())
+	full2 := writeBackup(t, repo, nil, testImage())
+	incr2 := writeBackup(t, repo, full2, testImage())
+	incr3 := writeBackup(t, repo, incr2, testImage())
+
+	// Keeping the newest backup keeps its chain
+	deleted, err := repo.Prune("web", 1)
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if len(deleted) != 2 || deleted[0] != full1.ID {
+		t.Errorf("Prune() deleted %v, want the first chain", deleted)
+	}
+	manifests, _ := repo.List("web")
+	if len(manifests) != 3 {
+		t.Errorf("%d backups left, want 3", len(manifests))
+	}
+	if got := readDisk(t, repo, incr3); !bytes.Equal(got, testImage()) {
+		t.Error("kept backup no longer reads back")
+	}
+
+	if _, err := repo.Prune("web", 0); err == nil {
+		t.Error("Prune(0) expected error")
+	}
+}
@@ -0,0 +1,186 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// idFormat is the layout of backup IDs, from the time the backup was taken.
+const idFormat = "20060102-150405"
+
+// Writer writes a new backup. Files and disks are written into a staging
+// directory; Commit moves the backup into place and Abort discards it.
+type Writer struct {
+	repo     *Repository
+	manifest Manifest
+	parent   *Manifest
+	staging  string
+	done     bool
+}
+
+// Create starts a new backup of a VM. With a parent the backup is
+// incremental and only stores the disk blocks that changed since the parent;
+// without one it is a full backup.
+func (r *Repository) Create(vmName string, parent *Manifest) (*Writer, error) {
+	if vmName == "" || vmName != filepath.Base(vmName) || vmName[0] == '.' {
+		return nil, fmt.Errorf("invalid VM name %q", vmName)
+	}
+	vmDir := filepath.Join(r.dir, vmName)
+	if err := os.MkdirAll(vmDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	// IDs come from the time; backups taken within the same second get a
+	// suffix
+	created := r.now().UTC().Truncate(time.Second)
+	base := created.Format(idFormat)
+	id := base
+	for n := 2; ; n++ {
+		if _, err := os.Stat(filepath.Join(vmDir, id)); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+
+	staging := filepath.Join(vmDir, "."+id+stagingAffix)
+	if err := os.Mkdir(staging, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	w := &Writer{
+		repo: r,
+		manifest: Manifest{
+			ID:      id,
+			VM:      vmName,
+			Kind:    KindFull,
+			Created: created,
+		},
+		staging: staging,
+	}
+	if parent != nil {
+		w.parent = parent
+		w.manifest.Kind = KindIncremental
+		w.manifest.Parent = parent.ID
+	}
+	return w, nil
+}
+
+// ID returns the ID of the backup being written.
+func (w *Writer) ID() string {
+	return w.manifest.ID
+}
+
+// WriteFile stores a file in the backup.
+func (w *Writer) WriteFile(name string, data []byte) error {
+	if err := os.WriteFile(filepath.Join(w.staging, name), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	w.manifest.Files = append(w.manifest.Files, name)
+	return nil
+}
+
+// WriteDisk stores the disk image copied from volume, read from src. Blocks
+// of zeros are left as holes, and an incremental backup skips the blocks
+// whose hash matches the parent's.
+func (w *Writer) WriteDisk(device, volume, format string, src io.Reader) error {
+	var parentIndex []byte
+	if w.parent != nil && w.parent.disk(volume) != nil {
+		index, err := os.ReadFile(w.repo.indexPath(w.parent, volume))
+		if err != nil {
+			return fmt.Errorf("failed to read block index of %s in backup %s: %w", volume, w.parent.ID, err)
+		}
+		parentIndex = index
+	}
+
+	f, err := os.OpenFile(filepath.Join(w.staging, volume), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", volume, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	disk := Disk{Device: device, Volume: volume, Format: format}
+	var index bytes.Buffer
+	buf := make([]byte, BlockSize)
+	for i := 0; ; i++ {
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			block := buf[:n]
+			sum := sha256.Sum256(block)
+			index.Write(sum[:])
+
+			changed := !bytes.Equal(blockHash(parentIndex, i), sum[:])
+			if changed && !isZero(block) {
+				if _, err := f.WriteAt(block, disk.Size); err != nil {
+					return fmt.Errorf("failed to write %s: %w", volume, err)
+				}
+			}
+			if changed {
+				disk.Stored += int64(n)
+			}
+			disk.Size += int64(n)
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", volume, err)
+		}
+	}
+
+	// Trailing holes don't extend the file
+	if err := f.Truncate(disk.Size); err != nil {
+		return fmt.Errorf("failed to write %s: %w", volume, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", volume, err)
+	}
+	if err := os.WriteFile(filepath.Join(w.staging, volume+indexSuffix), index.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("failed to write block index of %s: %w", volume, err)
+	}
+
+	w.manifest.Disks = append(w.manifest.Disks, disk)
+	return nil
+}
+
+// Commit writes the manifest and moves the backup into place.
+func (w *Writer) Commit() (*Manifest, error) {
+	data, err := yaml.Marshal(&w.manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(w.staging, ManifestFile), data, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := os.Rename(w.staging, w.repo.Dir(w.manifest.VM, w.manifest.ID)); err != nil {
+		return nil, fmt.Errorf("failed to move backup into place: %w", err)
+	}
+	w.done = true
+
+	m := w.manifest
+	return &m, nil
+}
+
+// Abort discards a backup that was not committed. It is safe to call after
+// Commit, so it can be deferred.
+func (w *Writer) Abort() {
+	if w.done {
+		return
+	}
+	w.done = true
+	_ = os.RemoveAll(w.staging)
+}
+
+var zeroBlock [BlockSize]byte
+
+// isZero reports whether a block only holds zeros.
+func isZero(block []byte) bool {
+	return bytes.Equal(block, zeroBlock[:len(block)])
+}
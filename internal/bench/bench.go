@@ -0,0 +1,185 @@
+// Package bench defines the disk benchmark run by 'foundry bench disk': the
+// disk settings compared, the fio job run in the guest and the parsing and
+// reporting of its results.
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// DefaultRuntime is how long each fio job runs.
+const DefaultRuntime = 10 * time.Second
+
+// DiskConfig is a disk bus and host cache mode to benchmark.
+type DiskConfig struct {
+	// Bus is the disk bus: virtio (virtio-blk) or scsi (virtio-scsi).
+	Bus string
+
+	// Cache is the host cache mode, e.g. none or writeback.
+	Cache string
+}
+
+// String returns the config as bus:cache.
+func (c DiskConfig) String() string {
+	return c.Bus + ":" + c.Cache
+}
+
+// DefaultDiskConfigs are the configurations compared when none are given.
+// virtio with cache=none is what foundry uses for VM disks.
+var DefaultDiskConfigs = []DiskConfig{
+	{Bus: "virtio", Cache: "none"},
+	{Bus: "virtio", Cache: "writeback"},
+	{Bus: "scsi", Cache: "none"},
+	{Bus: "scsi", Cache: "writeback"},
+}
+
+var (
+	validBuses  = []string{"virtio", "scsi"}
+	validCaches = []string{"none", "writeback", "writethrough", "directsync", "unsafe"}
+)
+
+// ParseDiskConfig parses a bus:cache pair such as "scsi:writeback".
+func ParseDiskConfig(s string) (DiskConfig, error) {
+	bus, cache, ok := strings.Cut(s, ":")
+	if !ok {
+		return DiskConfig{}, fmt.Errorf("invalid disk config %q: want bus:cache, e.g. virtio:none", s)
+	}
+	if !contains(validBuses, bus) {
+		return DiskConfig{}, fmt.Errorf("invalid bus %q in %q: must be one of %s", bus, s, strings.Join(validBuses, ", "))
+	}
+	if !contains(validCaches, cache) {
+		return DiskConfig{}, fmt.Errorf("invalid cache mode %q in %q: must be one of %s", cache, s, strings.Join(validCaches, ", "))
+	}
+	return DiskConfig{Bus: bus, Cache: cache}, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// FioArgs returns the fio arguments of the benchmark against device: 4k random
+// reads and writes at queue depth 32, then 1M sequential reads and writes at
+// queue depth 8, each for runtime with the guest page cache bypassed.
+func FioArgs(device string, runtime time.Duration) []string {
+	args := []string{
+		"--output-format=json",
+		"--filename=" + device,
+		"--direct=1",
+		"--ioengine=libaio",
+		"--time_based",
+		fmt.Sprintf("--runtime=%ds", int(runtime.Seconds())),
+	}
+	for _, job := range fioJobs {
+		args = append(args,
+			"--name="+job.name,
+			"--rw="+job.rw,
+			"--bs="+job.bs,
+			fmt.Sprintf("--iodepth=%d", job.iodepth),
+			"--stonewall",
+		)
+	}
+	return args
+}
+
+// fioJobs are the jobs of the benchmark, run one after another.
+var fioJobs = []struct {
+	name, rw, bs string
+	iodepth      int
+}{
+	{"randread", "randread", "4k", 32},
+	{"randwrite", "randwrite", "4k", 32},
+	{"seqread", "read", "1M", 8},
+	{"seqwrite", "write", "1M", 8},
+}
+
+// Result is the outcome of the benchmark for one disk config.
+type Result struct {
+	Config DiskConfig
+
+	// RandReadIOPS and RandWriteIOPS are the 4k random IOPS.
+	RandReadIOPS  float64
+	RandWriteIOPS float64
+
+	// RandReadLatency and RandWriteLatency are the mean 4k random latencies.
+	RandReadLatency  time.Duration
+	RandWriteLatency time.Duration
+
+	// SeqReadMiBps and SeqWriteMiBps are the 1M sequential throughputs.
+	SeqReadMiBps  float64
+	SeqWriteMiBps float64
+}
+
+// fioOutput is the part of fio's JSON output the benchmark reads.
+type fioOutput struct {
+	Jobs []struct {
+		Name  string   `json:"jobname"`
+		Read  fioStats `json:"read"`
+		Write fioStats `json:"write"`
+	} `json:"jobs"`
+}
+
+type fioStats struct {
+	IOPS float64 `json:"iops"`
+	// BW is in KiB/s.
+	BW    float64 `json:"bw"`
+	LatNS struct {
+		Mean float64 `json:"mean"`
+	} `json:"lat_ns"`
+}
+
+// ParseFioOutput reads the results of the benchmark from fio's JSON output.
+func ParseFioOutput(config DiskConfig, data []byte) (Result, error) {
+	var out fioOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return Result{}, fmt.Errorf("failed to parse fio output: %w", err)
+	}
+
+	result := Result{Config: config}
+	seen := make(map[string]bool)
+	for _, job := range out.Jobs {
+		switch job.Name {
+		case "randread":
+			result.RandReadIOPS = job.Read.IOPS
+			result.RandReadLatency = time.Duration(job.Read.LatNS.Mean)
+		case "randwrite":
+			result.RandWriteIOPS = job.Write.IOPS
+			result.RandWriteLatency = time.Duration(job.Write.LatNS.Mean)
+		case "seqread":
+			result.SeqReadMiBps = job.Read.BW / 1024
+		case "seqwrite":
+			result.SeqWriteMiBps = job.Write.BW / 1024
+		default:
+			continue
+		}
+		seen[job.Name] = true
+	}
+	for _, job := range fioJobs {
+		if !seen[job.name] {
+			return Result{}, fmt.Errorf("fio output has no %s job", job.name)
+		}
+	}
+	return result, nil
+}
+
+// PrintResults writes a comparison table of results to w.
+func PrintResults(w io.Writer, results []Result) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "CONFIG\t4K READ IOPS\t4K WRITE IOPS\t4K READ LAT\t4K WRITE LAT\tSEQ READ\tSEQ WRITE")
+	for _, r := range results {
+		_, _ = fmt.Fprintf(tw, "%s\t%.0f\t%.0f\t%v\t%v\t%.0f MiB/s\t%.0f MiB/s\n",
+			r.Config, r.RandReadIOPS, r.RandWriteIOPS,
+			r.RandReadLatency.Round(time.Microsecond), r.RandWriteLatency.Round(time.Microsecond),
+			r.SeqReadMiBps, r.SeqWriteMiBps)
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,102 @@
+package bench
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fioJSON is trimmed fio --output-format=json output of the benchmark.
+const fioJSON = `{
+  "fio version": "fio-3.36",
+  "jobs": [
+    {"jobname": "randread", "read": {"iops": 45210.5, "bw": 180842, "lat_ns": {"mean": 707000.0}}, "write": {"iops": 0, "bw": 0, "lat_ns": {"mean": 0}}},
+    {"jobname": "randwrite", "read": {"iops": 0, "bw": 0, "lat_ns": {"mean": 0}}, "write": {"iops": 30120.2, "bw": 120480, "lat_ns": {"mean": 1062000.0}}},
+    {"jobname": "seqread", "read": {"iops": 1800, "bw": 1843200, "lat_ns": {"mean": 4400000.0}}, "write": {"iops": 0, "bw": 0, "lat_ns": {"mean": 0}}},
+    {"jobname": "seqwrite", "read": {"iops": 0, "bw": 0, "lat_ns": {"mean": 0}}, "write": {"iops": 900, "bw": 921600, "lat_ns": {"mean": 8800000.0}}}
+  ]
+}`
+
+func TestParseFioOutput(t *testing.T) {
+	config := DiskConfig{Bus: "virtio", Cache: "none"}
+	result, err := ParseFioOutput(config, []byte(fioJSON))
+	if err != nil {
+		t.Fatalf("ParseFioOutput() error = %v", err)
+	}
+
+	want := Result{
+		Config:           config,
+		RandReadIOPS:     45210.5,
+		RandWriteIOPS:    30120.2,
+		RandReadLatency:  707 * time.Microsecond,
+		RandWriteLatency: 1062 * time.Microsecond,
+		SeqReadMiBps:     1800,
+		SeqWriteMiBps:    900,
+	}
+	if result != want {
+		t.Errorf("ParseFioOutput() = %+v, want %+v", result, want)
+	}
+}
+
+func TestParseFioOutput_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"not JSON", "fio: file not found", "failed to parse"},
+		{"missing job", `{"jobs": [{"jobname": "randread"}]}`, "no randwrite job"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFioOutput(DiskConfig{}, []byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseDiskConfig(t *testing.T) {
+	config, err := ParseDiskConfig("scsi:writeback")
+	if err != nil {
+		t.Fatalf("ParseDiskConfig() error = %v", err)
+	}
+	if config != (DiskConfig{Bus: "scsi", Cache: "writeback"}) || config.String() != "scsi:writeback" {
+		t.Errorf("ParseDiskConfig() = %+v", config)
+	}
+
+	for _, s := range []string{"virtio", "ide:none", "virtio:fast"} {
+		if _, err := ParseDiskConfig(s); err == nil {
+			t.Errorf("ParseDiskConfig(%q) expected error", s)
+		}
+	}
+}
+
+func TestFioArgs(t *testing.T) {
+	args := strings.Join(FioArgs("/dev/vdz", 15*time.Second), " ")
+	for _, want := range []string{"--filename=/dev/vdz", "--runtime=15s", "--direct=1", "--name=randread --rw=randread --bs=4k --iodepth=32 --stonewall", "--name=seqwrite --rw=write --bs=1M"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("FioArgs() = %s, want %q", args, want)
+		}
+	}
+}
+
+func TestPrintResults(t *testing.T) {
+	var buf bytes.Buffer
+	PrintResults(&buf, []Result{{
+		Config:          DiskConfig{Bus: "virtio", Cache: "none"},
+		RandReadIOPS:    45210,
+		RandReadLatency: 707 * time.Microsecond,
+		SeqReadMiBps:    1800,
+	}})
+
+	out := buf.String()
+	for _, want := range []string{"CONFIG", "virtio:none", "45210", "707µs", "1800 MiB/s"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
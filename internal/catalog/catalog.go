@@ -0,0 +1,149 @@
+// Package catalog maps well-known distribution aliases (e.g., "fedora-43")
+// to upstream cloud images, so base images can be pulled by name instead of
+// by URL.
+//
+// Checksums are not pinned: each entry names the checksum file its
+// distribution publishes next to the image, which is fetched at pull time and
+// used to verify the download.
+package catalog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Image is a cloud image available by alias.
+type Image struct {
+	// Alias is the short name the image is pulled by, e.g. "fedora-43".
+	Alias string `json:"alias" yaml:"alias"`
+
+	// Description is a human-readable name of the image.
+	Description string `json:"description" yaml:"description"`
+
+	// URL is where the image is downloaded from.
+	URL string `json:"url" yaml:"url"`
+
+	// ChecksumURL is the upstream checksum file listing the image's digest.
+	ChecksumURL string `json:"checksumURL" yaml:"checksumURL"`
+
+	// ChecksumAlgorithm is the digest algorithm of ChecksumURL: "sha256" or
+	// "sha512".
+	ChecksumAlgorithm string `json:"checksumAlgorithm" yaml:"checksumAlgorithm"`
+
+	// DefaultUser is the login user the image's cloud-init creates. It is
+	// recorded with the image when pulled.
+	DefaultUser string `json:"defaultUser" yaml:"defaultUser"`
+
+	// OSVariant is the libosinfo short ID of the image's operating system.
+	// It is recorded with the image when pulled.
+	OSVariant string `json:"osVariant" yaml:"osVariant"`
+}
+
+// ImageName returns the name the image is imported as by default, e.g.
+// "fedora-43.qcow2".
+func (i Image) ImageName() string {
+	return i.Alias + ".qcow2"
+}
+
+// images are the known images, x86_64 only.
+var images = []Image{
+	{
+		Alias:             "fedora-43",
+		Description:       "Fedora Cloud 43",
+		URL:               "https://download.fedoraproject.org/pub/fedora/linux/releases/43/Cloud/x86_64/images/Fedora-Cloud-Base-Generic-43-1.6.x86_64.qcow2",
+		ChecksumURL:       "https://download.fedoraproject.org/pub/fedora/linux/releases/43/Cloud/x86_64/images/Fedora-Cloud-43-1.6-x86_64-CHECKSUM",
+		ChecksumAlgorithm: "sha256",
+		DefaultUser:       "fedora",
+		OSVariant:         "fedora43",
+	},
+	{
+		Alias:             "ubuntu-24.04",
+		Description:       "Ubuntu 24.04 LTS (Noble Numbat)",
+		URL:               "https://cloud-images.ubuntu.com/releases/24.04/release/ubuntu-24.04-server-cloudimg-amd64.img",
+		ChecksumURL:       "https://cloud-images.ubuntu.com/releases/24.04/release/SHA256SUMS",
+		ChecksumAlgorithm: "sha256",
+		DefaultUser:       "ubuntu",
+		OSVariant:         "ubuntu24.04",
+	},
+	{
+		Alias:             "debian-12",
+		Description:       "Debian 12 (Bookworm) generic cloud",
+		URL:               "https://cloud.debian.org/images/cloud/bookworm/latest/debian-12-genericcloud-amd64.qcow2",
+		ChecksumURL:       "https://cloud.debian.org/images/cloud/bookworm/latest/SHA512SUMS",
+		ChecksumAlgorithm: "sha512",
+		DefaultUser:       "debian",
+		OSVariant:         "debian12",
+	},
+	{
+		Alias:             "rocky-9",
+		Description:       "Rocky Linux 9 generic cloud",
+		URL:               "https://dl.rockylinux.org/pub/rocky/9/images/x86_64/Rocky-9-GenericCloud-Base.latest.x86_64.qcow2",
+		ChecksumURL:       "https://dl.rockylinux.org/pub/rocky/9/images/x86_64/Rocky-9-GenericCloud-Base.latest.x86_64.qcow2.CHECKSUM",
+		ChecksumAlgorithm: "sha256",
+		DefaultUser:       "rocky",
+		OSVariant:         "rocky9",
+	},
+}
+
+// mirrors maps upstream URL prefixes to the mirrors replacing them.
+var mirrors map[string]string
+
+// SetMirrors downloads images from mirrors instead of upstream (e.g., from
+// the host config): a URL starting with a key of mirrors has that prefix
+// replaced with its value, e.g.
+// "https://cloud.debian.org/images/" -> "https://mirror.example.com/debian/".
+// The longest matching prefix wins. nil restores the upstream URLs.
+func SetMirrors(m map[string]string) {
+	mirrors = m
+}
+
+// mirrored returns the image with its URLs pointing at the configured
+// mirrors.
+func mirrored(image Image) Image {
+	image.URL = mirrorURL(image.URL)
+	image.ChecksumURL = mirrorURL(image.ChecksumURL)
+	return image
+}
+
+// mirrorURL replaces the longest upstream prefix of rawURL with its mirror.
+func mirrorURL(rawURL string) string {
+	var match string
+	for prefix := range mirrors {
+		if strings.HasPrefix(rawURL, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+	if match == "" {
+		return rawURL
+	}
+	return mirrors[match] + strings.TrimPrefix(rawURL, match)
+}
+
+// List returns the known images sorted by alias, with the URLs of the
+// configured mirrors.
+func List() []Image {
+	var list []Image
+	for _, image := range images {
+		list = append(list, mirrored(image))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Alias < list[j].Alias })
+	return list
+}
+
+// Lookup returns the image with the given alias, with the URLs of the
+// configured mirrors.
+func Lookup(alias string) (Image, error) {
+	alias = strings.ToLower(strings.TrimSpace(alias))
+	for _, image := range images {
+		if image.Alias == alias {
+			return mirrored(image), nil
+		}
+	}
+
+	var aliases []string
+	for _, image := range List() {
+		aliases = append(aliases, image.Alias)
+	}
+	return Image{}, fmt.Errorf("unknown image alias %q (known: %s)", alias, strings.Join(aliases, ", "))
+}
@@ -0,0 +1,108 @@
+package catalog
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jbweber/foundry/internal/libvirt"
+)
+
+func TestLookup(t *testing.T) {
+	for _, alias := range []string{"fedora-43", "ubuntu-24.04", "debian-12", "rocky-9", " Fedora-43 "} {
+		image, err := Lookup(alias)
+		if err != nil {
+			t.Errorf("Lookup(%q) error = %v", alias, err)
+			continue
+		}
+		if image.Alias != strings.ToLower(strings.TrimSpace(alias)) {
+			t.Errorf("Lookup(%q) = %q", alias, image.Alias)
+		}
+	}
+
+	_, err := Lookup("windows-11")
+	if err == nil || !strings.Contains(err.Error(), "known: debian-12, fedora-43, rocky-9, ubuntu-24.04") {
+		t.Errorf("Lookup() error = %v, want the known aliases listed", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	list := List()
+	if len(list) != len(images) {
+		t.Fatalf("List() returned %d images, want %d", len(list), len(images))
+	}
+	for i := 1; i < len(list); i++ {
+		if list[i-1].Alias >= list[i].Alias {
+			t.Errorf("List() not sorted: %q before %q", list[i-1].Alias, list[i].Alias)
+		}
+	}
+
+	// Sorting must not reorder the catalog itself
+	list[0], list[1] = list[1], list[0]
+	if images[0].Alias != "fedora-43" {
+		t.Error("List() exposed the catalog slice")
+	}
+}
+
+func TestCatalogEntries(t *testing.T) {
+	for _, image := range images {
+		t.Run(image.Alias, func(t *testing.T) {
+			for _, raw := range []string{image.URL, image.ChecksumURL} {
+				u, err := url.Parse(raw)
+				if err != nil || u.Scheme != "https" || u.Host == "" {
+					t.Errorf("URL %q must be an absolute https URL", raw)
+				}
+			}
+			if image.ChecksumAlgorithm != "sha256" && image.ChecksumAlgorithm != "sha512" {
+				t.Errorf("ChecksumAlgorithm = %q", image.ChecksumAlgorithm)
+			}
+			if image.Description == "" {
+				t.Error("Description is empty")
+			}
+			if image.DefaultUser == "" {
+				t.Error("DefaultUser is empty")
+			}
+			if _, err := libvirt.OSInfoID(image.OSVariant); err != nil {
+				t.Errorf("OSVariant: %v", err)
+			}
+			if image.ImageName() != image.Alias+".qcow2" {
+				t.Errorf("ImageName() = %q", image.ImageName())
+			}
+		})
+	}
+}
+
+func TestLookup_Mirrors(t *testing.T) {
+	SetMirrors(map[string]string{
+		"https://cloud.debian.org/":                     "https://mirror.example.com/",
+		"https://cloud.debian.org/images/cloud/":        "https://debian.example.com/cloud/",
+		"https://download.fedoraproject.org/pub/fedora": "https://fedora.example.com",
+	})
+	t.Cleanup(func() { SetMirrors(nil) })
+
+	debian, err := Lookup("debian-12")
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	// The longest prefix wins
+	if debian.URL != "https://debian.example.com/cloud/bookworm/latest/debian-12-genericcloud-amd64.qcow2" {
+		t.Errorf("URL = %s", debian.URL)
+	}
+	if debian.ChecksumURL != "https://debian.example.com/cloud/bookworm/latest/SHA512SUMS" {
+		t.Errorf("ChecksumURL = %s", debian.ChecksumURL)
+	}
+
+	rocky, err := Lookup("rocky-9")
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	if !strings.HasPrefix(rocky.URL, "https://dl.rockylinux.org/") {
+		t.Errorf("URL = %s, want the upstream URL without a mirror", rocky.URL)
+	}
+
+	for _, image := range List() {
+		if image.Alias == "fedora-43" && !strings.HasPrefix(image.URL, "https://fedora.example.com/linux/releases/43/") {
+			t.Errorf("List() fedora-43 URL = %s, want the mirror", image.URL)
+		}
+	}
+}
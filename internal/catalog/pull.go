@@ -0,0 +1,195 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// maxChecksumFileSize bounds how much of a checksum file is read.
+const maxChecksumFileSize = 1 << 20
+
+// bsdChecksumLine matches BSD-style checksum lines as published by Fedora
+// and Rocky Linux, e.g. "SHA256 (image.qcow2) = 3f5a...".
+var bsdChecksumLine = regexp.MustCompile(`^(SHA\d+) \((.+)\) = ([0-9a-fA-F]+)$`)
+
+// PullOptions configures Pull.
+type PullOptions struct {
+	// Name is the image name to import as. Defaults to Image.ImageName().
+	Name string
+
+	// Progress, if non-nil, is called periodically while downloading.
+	Progress func(storage.DownloadProgress)
+
+	// HTTPClient is used for downloads. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// imageImporter imports images into the foundry-images pool.
+type imageImporter interface {
+	ImportInProgress(ctx context.Context, imageName string) (bool, error)
+	ImageExists(ctx context.Context, imageName string) (bool, error)
+	ImportImageFromURL(ctx context.Context, rawURL, imageName string, opts storage.URLImportOptions) error
+}
+
+// Pull downloads the image with the given alias, verifies it against its
+// upstream checksum and imports it into the foundry-images pool, recording
+// its default user and OS variant. Returns the name the image was imported as.
+func Pull(ctx context.Context, mgr *storage.Manager, alias string, opts PullOptions) (string, error) {
+	return pullWithDeps(ctx, mgr, alias, opts)
+}
+
+// pullWithDeps pulls an image with injected dependencies.
+func pullWithDeps(ctx context.Context, importer imageImporter, alias string, opts PullOptions) (string, error) {
+	logger := logging.FromContext(ctx)
+
+	image, err := Lookup(alias)
+	if err != nil {
+		return "", err
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = image.ImageName()
+	}
+
+	// An image being imported already has its volume, so check this first
+	inProgress, err := importer.ImportInProgress(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if inProgress {
+		return "", fmt.Errorf("image %s: %w", name, storage.ErrImportInProgress)
+	}
+
+	exists, err := importer.ImageExists(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if image exists: %w", err)
+	}
+	if exists {
+		return "", fmt.Errorf("image %s already exists", name)
+	}
+
+	logger.Info("Fetching checksum", "url", image.ChecksumURL)
+	sum, err := fetchChecksum(ctx, opts.HTTPClient, image)
+	if err != nil {
+		return "", err
+	}
+
+	importOpts := storage.URLImportOptions{
+		Progress:   opts.Progress,
+		HTTPClient: opts.HTTPClient,
+		ImportOptions: storage.ImportOptions{Metadata: storage.ImageMetadata{
+			DefaultUser: image.DefaultUser,
+			OSVariant:   image.OSVariant,
+		}},
+	}
+	switch image.ChecksumAlgorithm {
+	case "sha256":
+		importOpts.SHA256 = sum
+	case "sha512":
+		importOpts.SHA512 = sum
+	default:
+		return "", fmt.Errorf("unsupported checksum algorithm %q for %s", image.ChecksumAlgorithm, image.Alias)
+	}
+
+	logger.Info("Downloading image", "image", name, "description", image.Description, "url", image.URL)
+	if err := importer.ImportImageFromURL(ctx, image.URL, name, importOpts); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// fetchChecksum downloads the image's checksum file and returns its digest.
+func fetchChecksum(ctx context.Context, client *http.Client, image Image) (string, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, image.ChecksumURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch checksum file: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch checksum file %s: %s", image.ChecksumURL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxChecksumFileSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read checksum file: %w", err)
+	}
+
+	sum, err := parseChecksum(data, path.Base(image.URL), image.ChecksumAlgorithm)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", image.ChecksumURL, err)
+	}
+	return sum, nil
+}
+
+// parseChecksum returns the digest for fileName from a checksum file in BSD
+// ("SHA256 (file) = hex") or GNU coreutils ("hex  file") format. Lines that
+// are neither, such as PGP signature armor, are ignored.
+//
+// A checksum file covering a single image may list it under a versioned name
+// rather than the "latest" name it is downloaded by; if fileName is not found
+// and the file has exactly one digest, that digest is used.
+func parseChecksum(data []byte, fileName, algorithm string) (string, error) {
+	hexLen := map[string]int{"sha256": 64, "sha512": 128}[algorithm]
+	if hexLen == 0 {
+		return "", fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+
+	var sums []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		var name, sum string
+		if m := bsdChecksumLine.FindStringSubmatch(line); m != nil {
+			if !strings.EqualFold(m[1], algorithm) {
+				continue
+			}
+			name, sum = m[2], m[3]
+		} else if fields := strings.Fields(line); len(fields) == 2 {
+			sum, name = fields[0], strings.TrimPrefix(fields[1], "*")
+		} else {
+			continue
+		}
+
+		if len(sum) != hexLen {
+			continue
+		}
+		if _, err := hex.DecodeString(sum); err != nil {
+			continue
+		}
+
+		sum = strings.ToLower(sum)
+		if name == fileName {
+			return sum, nil
+		}
+		sums = append(sums, sum)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read checksum file: %w", err)
+	}
+
+	if len(sums) == 1 {
+		return sums[0], nil
+	}
+	return "", fmt.Errorf("no %s checksum for %s", algorithm, fileName)
+}
@@ -0,0 +1,223 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+var (
+	testSHA256 = strings.Repeat("ab", 32)
+	testSHA512 = strings.Repeat("cd", 64)
+)
+
+// fakeImporter records image imports.
+type fakeImporter struct {
+	existing  map[string]bool
+	importing map[string]bool
+	existsErr error
+	importErr error
+
+	imported []string
+	urls     []string
+	opts     []storage.URLImportOptions
+}
+
+func (f *fakeImporter) ImportInProgress(ctx context.Context, imageName string) (bool, error) {
+	return f.importing[imageName], nil
+}
+
+func (f *fakeImporter) ImageExists(ctx context.Context, imageName string) (bool, error) {
+	return f.existing[imageName], f.existsErr
+}
+
+func (f *fakeImporter) ImportImageFromURL(ctx context.Context, rawURL, imageName string, opts storage.URLImportOptions) error {
+	f.imported = append(f.imported, imageName)
+	f.urls = append(f.urls, rawURL)
+	f.opts = append(f.opts, opts)
+	return f.importErr
+}
+
+// useTestCatalog replaces the catalog with images served by a test server
+// that publishes checksums files.
+func useTestCatalog(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/SHA256SUMS":
+			_, _ = w.Write([]byte(testSHA256 + " *test-cloud.img\n"))
+		case "/SHA512SUMS":
+			_, _ = w.Write([]byte(testSHA512 + "  other.qcow2\n" + strings.Repeat("ef", 64) + "  test-cloud.qcow2\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	saved := images
+	images = []Image{
+		{Alias: "test-1", Description: "Test 1", URL: srv.URL + "/test-cloud.img", ChecksumURL: srv.URL + "/SHA256SUMS", ChecksumAlgorithm: "sha256", DefaultUser: "tester", OSVariant: "fedora43"},
+		{Alias: "test-2", Description: "Test 2", URL: srv.URL + "/other.qcow2", ChecksumURL: srv.URL + "/SHA512SUMS", ChecksumAlgorithm: "sha512"},
+		{Alias: "test-3", Description: "Test 3", URL: srv.URL + "/test-cloud.img", ChecksumURL: srv.URL + "/missing", ChecksumAlgorithm: "sha256"},
+	}
+	t.Cleanup(func() { images = saved })
+	return srv
+}
+
+func TestPullWithDeps(t *testing.T) {
+	srv := useTestCatalog(t)
+	importer := &fakeImporter{}
+
+	name, err := pullWithDeps(context.Background(), importer, "test-1", PullOptions{})
+	if err != nil {
+		t.Fatalf("pullWithDeps() error = %v", err)
+	}
+	if name != "test-1.qcow2" {
+		t.Errorf("name = %q, want test-1.qcow2", name)
+	}
+	if len(importer.imported) != 1 || importer.urls[0] != srv.URL+"/test-cloud.img" {
+		t.Fatalf("imports = %v from %v", importer.imported, importer.urls)
+	}
+	if importer.opts[0].SHA256 != testSHA256 || importer.opts[0].SHA512 != "" {
+		t.Errorf("import options = %+v, want the published sha256", importer.opts[0])
+	}
+	if meta := importer.opts[0].Metadata; meta.DefaultUser != "tester" || meta.OSVariant != "fedora43" {
+		t.Errorf("metadata = %+v, want default user tester and OS variant fedora43", meta)
+	}
+}
+
+func TestPullWithDeps_SHA512AndName(t *testing.T) {
+	useTestCatalog(t)
+	importer := &fakeImporter{}
+
+	name, err := pullWithDeps(context.Background(), importer, "test-2", PullOptions{Name: "custom.qcow2"})
+	if err != nil {
+		t.Fatalf("pullWithDeps() error = %v", err)
+	}
+	if name != "custom.qcow2" || importer.imported[0] != "custom.qcow2" {
+		t.Errorf("imported as %v, want custom.qcow2", importer.imported)
+	}
+	if importer.opts[0].SHA512 != testSHA512 || importer.opts[0].SHA256 != "" {
+		t.Errorf("import options = %+v, want the published sha512", importer.opts[0])
+	}
+}
+
+func TestPullWithDeps_Errors(t *testing.T) {
+	useTestCatalog(t)
+
+	tests := []struct {
+		name     string
+		alias    string
+		importer *fakeImporter
+		wantErr  string
+	}{
+		{name: "unknown alias", alias: "nope", importer: &fakeImporter{}, wantErr: "unknown image alias"},
+		{name: "already exists", alias: "test-1", importer: &fakeImporter{existing: map[string]bool{"test-1.qcow2": true}}, wantErr: "already exists"},
+		{name: "import in progress", alias: "test-1", importer: &fakeImporter{importing: map[string]bool{"test-1.qcow2": true}}, wantErr: "import in progress"},
+		{name: "exists check fails", alias: "test-1", importer: &fakeImporter{existsErr: errors.New("boom")}, wantErr: "failed to check if image exists"},
+		{name: "checksum file missing", alias: "test-3", importer: &fakeImporter{}, wantErr: "404"},
+		{name: "import fails", alias: "test-1", importer: &fakeImporter{importErr: errors.New("checksum mismatch")}, wantErr: "checksum mismatch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := pullWithDeps(context.Background(), tt.importer, tt.alias, PullOptions{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("pullWithDeps() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseChecksum(t *testing.T) {
+	sha256A := strings.Repeat("a", 64)
+	sha256B := strings.Repeat("B", 64)
+	sha512A := strings.Repeat("c", 128)
+
+	tests := []struct {
+		name      string
+		data      string
+		fileName  string
+		algorithm string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "GNU binary marker",
+			data:      sha256A + " *image.img\n" + strings.Repeat("f", 64) + " *other.img\n",
+			fileName:  "image.img",
+			algorithm: "sha256",
+			want:      sha256A,
+		},
+		{
+			name: "BSD with PGP armor",
+			data: "-----BEGIN PGP SIGNED MESSAGE-----\nHash: SHA256\n\n" +
+				"# Fedora-Cloud-Base-Generic-43-1.6.x86_64.qcow2: 123 bytes\n" +
+				"SHA256 (Fedora-Cloud-Base-Generic-43-1.6.x86_64.qcow2) = " + sha256B + "\n" +
+				"SHA256 (Fedora-Cloud-Base-Generic-43-1.6.x86_64.raw.xz) = " + sha256A + "\n" +
+				"-----BEGIN PGP SIGNATURE-----\n",
+			fileName:  "Fedora-Cloud-Base-Generic-43-1.6.x86_64.qcow2",
+			algorithm: "sha256",
+			want:      strings.ToLower(sha256B),
+		},
+		{
+			name:      "single entry under a versioned name",
+			data:      "SHA256 (Rocky-9-GenericCloud-Base-9.6-20250531.0.x86_64.qcow2) = " + sha256A + "\n",
+			fileName:  "Rocky-9-GenericCloud-Base.latest.x86_64.qcow2",
+			algorithm: "sha256",
+			want:      sha256A,
+		},
+		{
+			name:      "sha512",
+			data:      sha512A + "  debian-12-genericcloud-amd64.qcow2\n",
+			fileName:  "debian-12-genericcloud-amd64.qcow2",
+			algorithm: "sha512",
+			want:      sha512A,
+		},
+		{
+			name:      "wrong digest length ignored",
+			data:      sha256A + "  debian-12-genericcloud-amd64.qcow2\n",
+			fileName:  "debian-12-genericcloud-amd64.qcow2",
+			algorithm: "sha512",
+			wantErr:   true,
+		},
+		{
+			name:      "other algorithm ignored",
+			data:      "SHA1 (image.img) = " + strings.Repeat("a", 40) + "\n",
+			fileName:  "image.img",
+			algorithm: "sha256",
+			wantErr:   true,
+		},
+		{
+			name:      "ambiguous",
+			data:      sha256A + "  one.img\n" + sha256A + "  two.img\n",
+			fileName:  "image.img",
+			algorithm: "sha256",
+			wantErr:   true,
+		},
+		{
+			name:      "unsupported algorithm",
+			data:      sha256A + "  image.img\n",
+			fileName:  "image.img",
+			algorithm: "md5",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseChecksum([]byte(tt.data), tt.fileName, tt.algorithm)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseChecksum() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseChecksum() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
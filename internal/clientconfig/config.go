@@ -0,0 +1,177 @@
+// Package clientconfig manages the CLI's per-user configuration: named
+// contexts holding the libvirt connection and API credentials for each
+// hypervisor foundry talks to.
+package clientconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/naming"
+)
+
+// EnvVar overrides the config file location.
+const EnvVar = "FOUNDRY_CONFIG"
+
+// Context holds how to reach one hypervisor.
+type Context struct {
+	// Name identifies the context.
+	Name string `yaml:"name"`
+
+	// Connect is the libvirt connection URI (e.g., qemu+ssh://root@hv1/system).
+	Connect string `yaml:"connect,omitempty"`
+
+	// Server is the URL of a foundry daemon API (e.g., https://hv1:8443).
+	Server string `yaml:"server,omitempty"`
+
+	// Token is the bearer token for the API.
+	Token string `yaml:"token,omitempty"`
+
+	// CertificateAuthority is a PEM file used to verify the API server.
+	CertificateAuthority string `yaml:"certificateAuthority,omitempty"`
+
+	// ClientCertificate and ClientKey are PEM files for mTLS authentication.
+	ClientCertificate string `yaml:"clientCertificate,omitempty"`
+	ClientKey         string `yaml:"clientKey,omitempty"`
+
+	// CacheTTL is how long facts about a remote hypervisor (storage pools,
+	// capabilities) are cached between commands, e.g. "30m". "0" disables
+	// the cache; empty uses the default of one hour.
+	CacheTTL string `yaml:"cacheTTL,omitempty"`
+}
+
+// Config is the CLI configuration file.
+type Config struct {
+	// CurrentContext is the context used when none is given explicitly.
+	CurrentContext string `yaml:"currentContext,omitempty"`
+
+	// Contexts are the configured contexts.
+	Contexts []Context `yaml:"contexts,omitempty"`
+
+	// Defaults are used when the corresponding command-line flags are not
+	// given.
+	Defaults Defaults `yaml:"defaults,omitempty"`
+
+	// Naming selects how VMs created from now on derive the MAC addresses
+	// and tap interface names of their interfaces. Each VM records the
+	// strategy it was created with and keeps it.
+	Naming naming.Strategy `yaml:"naming,omitempty"`
+}
+
+// Defaults holds default values for command-line flags.
+type Defaults struct {
+	// WithMyKey injects the user's default SSH public key into VMs on
+	// create, apply and run, like --with-my-key.
+	WithMyKey bool `yaml:"withMyKey,omitempty"`
+
+	// NetworkDefaults are inherited by the spec.networkDefaults of VMs on
+	// create, apply and run; fields the spec sets take precedence.
+	NetworkDefaults *v1alpha1.NetworkDefaultsSpec `yaml:"networkDefaults,omitempty"`
+
+	// BackupDir is the directory 'foundry backup' keeps backups in, like
+	// --dir.
+	BackupDir string `yaml:"backupDir,omitempty"`
+}
+
+// DefaultPath returns the config file location: $FOUNDRY_CONFIG, else
+// $XDG_CONFIG_HOME/foundry/config.yaml.
+func DefaultPath() (string, error) {
+	if path := os.Getenv(EnvVar); path != "" {
+		return path, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine config directory: %w", err)
+	}
+	return filepath.Join(configDir, "foundry", "config.yaml"), nil
+}
+
+// Load reads the config file at path. A missing file yields an empty config.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Save writes the config to path. The file may hold tokens, so it is only
+// readable by the owner.
+func (c *Config) Save(path string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config %s: %w", path, err)
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(path, 0600); err != nil {
+		return fmt.Errorf("failed to set config permissions: %w", err)
+	}
+	return nil
+}
+
+// Get returns the named context.
+func (c *Config) Get(name string) (*Context, error) {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == name {
+			return &c.Contexts[i], nil
+		}
+	}
+	return nil, fmt.Errorf("context %q not found", name)
+}
+
+// Set adds ctx, or replaces the existing context with the same name.
+func (c *Config) Set(ctx Context) {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == ctx.Name {
+			c.Contexts[i] = ctx
+			return
+		}
+	}
+	c.Contexts = append(c.Contexts, ctx)
+}
+
+// Delete removes the named context, clearing CurrentContext if it pointed
+// at it.
+func (c *Config) Delete(name string) error {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == name {
+			c.Contexts = append(c.Contexts[:i], c.Contexts[i+1:]...)
+			if c.CurrentContext == name {
+				c.CurrentContext = ""
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("context %q not found", name)
+}
+
+// Resolve returns the context to use: name if non-empty, else the current
+// context. Returns nil (and no error) if neither is set.
+func (c *Config) Resolve(name string) (*Context, error) {
+	if name == "" {
+		name = c.CurrentContext
+	}
+	if name == "" {
+		return nil, nil
+	}
+	return c.Get(name)
+}
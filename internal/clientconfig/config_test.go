@@ -0,0 +1,115 @@
+package clientconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad_MissingFile(t *testing.T) {
+	cfg, err := Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.Contexts) != 0 || cfg.CurrentContext != "" {
+		t.Errorf("expected empty config, got %+v", cfg)
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "foundry", "config.yaml")
+
+	cfg := &Config{CurrentContext: "hv1", Defaults: Defaults{WithMyKey: true}}
+	cfg.Set(Context{Name: "hv1", Connect: "qemu+ssh://root@hv1/system", Server: "https://hv1:8443", Token: "secret-token-value"})
+	cfg.Set(Context{Name: "hv2", Connect: "qemu+tls://hv2/system"})
+
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat config: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("config mode = %04o, want 0600", info.Mode().Perm())
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.CurrentContext != "hv1" || len(loaded.Contexts) != 2 || !loaded.Defaults.WithMyKey {
+		t.Fatalf("unexpected config after round trip: %+v", loaded)
+	}
+	hv1, err := loaded.Get("hv1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if hv1.Token != "secret-token-value" || hv1.Server != "https://hv1:8443" {
+		t.Errorf("unexpected hv1 context: %+v", hv1)
+	}
+}
+
+func TestSet_ReplacesExisting(t *testing.T) {
+	cfg := &Config{}
+	cfg.Set(Context{Name: "hv1", Connect: "qemu+tcp://old/system"})
+	cfg.Set(Context{Name: "hv1", Connect: "qemu+tcp://new/system"})
+
+	if len(cfg.Contexts) != 1 || cfg.Contexts[0].Connect != "qemu+tcp://new/system" {
+		t.Errorf("Set() did not replace context: %+v", cfg.Contexts)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	cfg := &Config{CurrentContext: "hv1"}
+	cfg.Set(Context{Name: "hv1"})
+	cfg.Set(Context{Name: "hv2"})
+
+	if err := cfg.Delete("hv1"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if cfg.CurrentContext != "" {
+		t.Errorf("CurrentContext = %q, want cleared", cfg.CurrentContext)
+	}
+	if len(cfg.Contexts) != 1 || cfg.Contexts[0].Name != "hv2" {
+		t.Errorf("unexpected contexts after delete: %+v", cfg.Contexts)
+	}
+	if err := cfg.Delete("hv1"); err == nil {
+		t.Error("Delete() of missing context should fail")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	cfg := &Config{}
+	cfg.Set(Context{Name: "hv1"})
+	cfg.Set(Context{Name: "hv2"})
+
+	ctx, err := cfg.Resolve("")
+	if err != nil || ctx != nil {
+		t.Errorf("Resolve(\"\") with no current context = (%v, %v), want (nil, nil)", ctx, err)
+	}
+
+	cfg.CurrentContext = "hv1"
+	if ctx, _ := cfg.Resolve(""); ctx == nil || ctx.Name != "hv1" {
+		t.Errorf("Resolve(\"\") = %v, want hv1", ctx)
+	}
+	if ctx, _ := cfg.Resolve("hv2"); ctx == nil || ctx.Name != "hv2" {
+		t.Errorf("Resolve(hv2) = %v, want hv2", ctx)
+	}
+	if _, err := cfg.Resolve("hv3"); err == nil {
+		t.Error("Resolve() of unknown context should fail")
+	}
+}
+
+func TestDefaultPath_EnvOverride(t *testing.T) {
+	t.Setenv(EnvVar, "/tmp/custom-foundry.yaml")
+
+	path, err := DefaultPath()
+	if err != nil {
+		t.Fatalf("DefaultPath() error = %v", err)
+	}
+	if path != "/tmp/custom-foundry.yaml" {
+		t.Errorf("DefaultPath() = %q", path)
+	}
+}
@@ -0,0 +1,212 @@
+package cloudinit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/naming"
+)
+
+// Config drive file paths and volume label.
+//
+// See https://cloudinit.readthedocs.io/en/latest/reference/datasources/configdrive.html
+const (
+	configDriveLabel       = "config-2"
+	configDriveUserData    = "openstack/latest/user_data"
+	configDriveMetaData    = "openstack/latest/meta_data.json"
+	configDriveNetworkData = "openstack/latest/network_data.json"
+)
+
+// ConfigDriveMetaData represents the OpenStack meta_data.json structure.
+type ConfigDriveMetaData struct {
+	UUID     string `json:"uuid"`
+	Name     string `json:"name"`
+	Hostname string `json:"hostname"`
+}
+
+// NetworkData represents the OpenStack network_data.json structure.
+type NetworkData struct {
+	Links    []NetworkDataLink    `json:"links"`
+	Networks []NetworkDataNetwork `json:"networks"`
+	Services []NetworkDataService `json:"services"`
+}
+
+// NetworkDataLink is a network interface, identified by its MAC address.
+type NetworkDataLink struct {
+	ID                 string `json:"id"`
+	Type               string `json:"type"`
+	EthernetMACAddress string `json:"ethernet_mac_address"`
+	MTU                int    `json:"mtu,omitempty"`
+}
+
+// NetworkDataNetwork is an address configuration of a link: ipv4, ipv6 or
+// ipv4_dhcp.
+type NetworkDataNetwork struct {
+	ID             string             `json:"id"`
+	Type           string             `json:"type"`
+	Link           string             `json:"link"`
+	IPAddress      string             `json:"ip_address,omitempty"`
+	Netmask        string             `json:"netmask,omitempty"`
+	Routes         []NetworkDataRoute `json:"routes,omitempty"`
+	DNSNameservers []string           `json:"dns_nameservers,omitempty"`
+	DNSSearch      []string           `json:"dns_search,omitempty"`
+}
+
+// NetworkDataRoute is a static route of a network.
+type NetworkDataRoute struct {
+	Network string `json:"network"`
+	Netmask string `json:"netmask"`
+	Gateway string `json:"gateway"`
+	Metric  int    `json:"metric,omitempty"`
+}
+
+// NetworkDataService is a network service, e.g. a DNS server.
+type NetworkDataService struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+}
+
+// GenerateConfigDriveMetaData generates the config drive meta_data.json
+// content. Like the NoCloud meta-data, the instance ID (uuid) is the VM
+// name, so cloud-init re-runs when the VM is recreated.
+func GenerateConfigDriveMetaData(vm *v1alpha1.VirtualMachine) (string, error) {
+	if vm == nil {
+		return "", fmt.Errorf("VM configuration cannot be nil")
+	}
+
+	data, err := json.MarshalIndent(ConfigDriveMetaData{
+		UUID:     vm.Name,
+		Name:     vm.Name,
+		Hostname: vm.Name,
+	}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal meta_data.json: %w", err)
+	}
+	return string(data) + "\n", nil
+}
+
+// GenerateConfigDriveNetworkData generates the config drive
+// network_data.json content: the same interfaces, addresses, default routes
+// and DNS settings as GenerateNetworkConfig, with links matched by MAC
+// address.
+func GenerateConfigDriveNetworkData(vm *v1alpha1.VirtualMachine) (string, error) {
+	if vm == nil {
+		return "", fmt.Errorf("VM configuration cannot be nil")
+	}
+
+	if len(vm.Spec.NetworkInterfaces) == 0 {
+		return "", fmt.Errorf("at least one network interface is required")
+	}
+
+	networkData := NetworkData{
+		Links:    []NetworkDataLink{},
+		Networks: []NetworkDataNetwork{},
+		Services: []NetworkDataService{},
+	}
+
+	metrics := defaultRouteMetrics(vm)
+	for i, iface := range vm.Spec.NetworkInterfaces {
+		linkID := fmt.Sprintf("interface%d", i)
+
+		// Use the configured MAC address, or derive it from the IP
+		macAddr, err := naming.InterfaceMAC(iface.IP, iface.IPv6, iface.MACAddress)
+		if err != nil {
+			return "", fmt.Errorf("failed to calculate MAC address for %s: %w", linkID, err)
+		}
+		networkData.Links = append(networkData.Links, NetworkDataLink{
+			ID:                 linkID,
+			Type:               "phy",
+			EthernetMACAddress: macAddr,
+			MTU:                iface.MTU,
+		})
+
+		var networks []NetworkDataNetwork
+		metric, hasDefaultRoute := metrics[i]
+		if iface.DHCP {
+			networks = append(networks, NetworkDataNetwork{Type: "ipv4_dhcp"})
+		} else if iface.IP != "" {
+			network, err := staticNetwork("ipv4", iface.IP)
+			if err != nil {
+				return "", fmt.Errorf("invalid IP for %s: %w", linkID, err)
+			}
+			if hasDefaultRoute {
+				network.Routes = []NetworkDataRoute{{Network: "0.0.0.0", Netmask: "0.0.0.0", Gateway: iface.Gateway, Metric: metric}}
+			}
+			networks = append(networks, network)
+		}
+		if iface.IPv6 != "" {
+			network, err := staticNetwork("ipv6", iface.IPv6)
+			if err != nil {
+				return "", fmt.Errorf("invalid IPv6 for %s: %w", linkID, err)
+			}
+			if hasDefaultRoute && iface.IPv6Gateway != "" {
+				network.Routes = []NetworkDataRoute{{Network: "::", Netmask: "::", Gateway: iface.IPv6Gateway, Metric: metric}}
+			}
+			networks = append(networks, network)
+		}
+
+		// Static routes go on the network of their IP family
+		for _, route := range iface.Routes {
+			r, err := staticRoute(route)
+			if err != nil {
+				return "", fmt.Errorf("invalid route for %s: %w", linkID, err)
+			}
+			for j := range networks {
+				if strings.HasPrefix(networks[j].Type, "ipv6") == (net.ParseIP(r.Network).To4() == nil) {
+					networks[j].Routes = append(networks[j].Routes, r)
+					break
+				}
+			}
+		}
+
+		// DNS settings apply to the interface, so they go on its first network
+		if ns := interfaceNameservers(vm, iface); ns != nil && len(networks) > 0 {
+			networks[0].DNSNameservers = ns.Addresses
+			networks[0].DNSSearch = ns.Search
+		}
+
+		for _, network := range networks {
+			network.ID = fmt.Sprintf("network%d", len(networkData.Networks))
+			network.Link = linkID
+			networkData.Networks = append(networkData.Networks, network)
+		}
+	}
+
+	data, err := json.MarshalIndent(networkData, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal network_data.json: %w", err)
+	}
+	return string(data) + "\n", nil
+}
+
+// staticRoute converts a static route to its network_data.json form, with
+// the prefix of its destination as a netmask.
+func staticRoute(route v1alpha1.RouteSpec) (NetworkDataRoute, error) {
+	_, ipNet, err := net.ParseCIDR(route.To)
+	if err != nil {
+		return NetworkDataRoute{}, err
+	}
+	return NetworkDataRoute{
+		Network: ipNet.IP.String(),
+		Netmask: net.IP(ipNet.Mask).String(),
+		Gateway: route.Via,
+		Metric:  route.Metric,
+	}, nil
+}
+
+// staticNetwork returns a static network of type typ for an address in CIDR
+// notation, with the prefix as a netmask.
+func staticNetwork(typ, cidr string) (NetworkDataNetwork, error) {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return NetworkDataNetwork{}, err
+	}
+	return NetworkDataNetwork{
+		Type:      typ,
+		IPAddress: ip.String(),
+		Netmask:   net.IP(ipNet.Mask).String(),
+	}, nil
+}
@@ -0,0 +1,173 @@
+package cloudinit
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/kdomanski/iso9660"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+// testConfigDriveVM returns a VM with a config drive, a static dual-stack
+// interface and a DHCP interface.
+func testConfigDriveVM() *v1alpha1.VirtualMachine {
+	return &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "cd-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{
+					IP:           "10.55.22.22/24",
+					Gateway:      "10.55.22.1",
+					IPv6:         "2001:db8::22/64",
+					IPv6Gateway:  "2001:db8::1",
+					DNSServers:   []string{"10.55.22.53"},
+					DefaultRoute: true,
+				},
+				{DHCP: true, MACAddress: "be:ee:00:00:00:01", MTU: 9000,
+					Routes: []v1alpha1.RouteSpec{{To: "172.16.0.0/12", Via: "192.168.1.1", Metric: 10}}},
+			},
+			CloudInit: &v1alpha1.CloudInitSpec{
+				FQDN:       "cd-vm.example.com",
+				Datasource: v1alpha1.CloudInitDatasourceConfigDrive,
+			},
+		},
+	}
+}
+
+func TestGenerateConfigDriveMetaData(t *testing.T) {
+	content, err := GenerateConfigDriveMetaData(testConfigDriveVM())
+	if err != nil {
+		t.Fatalf("GenerateConfigDriveMetaData() error = %v", err)
+	}
+
+	var got ConfigDriveMetaData
+	if err := json.Unmarshal([]byte(content), &got); err != nil {
+		t.Fatalf("meta_data.json is not valid JSON: %v", err)
+	}
+	want := ConfigDriveMetaData{UUID: "cd-vm", Name: "cd-vm", Hostname: "cd-vm"}
+	if got != want {
+		t.Errorf("meta_data.json = %+v, want %+v", got, want)
+	}
+
+	if _, err := GenerateConfigDriveMetaData(nil); err == nil {
+		t.Error("GenerateConfigDriveMetaData(nil) expected error")
+	}
+}
+
+func TestGenerateConfigDriveNetworkData(t *testing.T) {
+	content, err := GenerateConfigDriveNetworkData(testConfigDriveVM())
+	if err != nil {
+		t.Fatalf("GenerateConfigDriveNetworkData() error = %v", err)
+	}
+
+	var got NetworkData
+	if err := json.Unmarshal([]byte(content), &got); err != nil {
+		t.Fatalf("network_data.json is not valid JSON: %v", err)
+	}
+
+	wantLinks := []NetworkDataLink{
+		{ID: "interface0", Type: "phy", EthernetMACAddress: "be:ef:0a:37:16:16"},
+		{ID: "interface1", Type: "phy", EthernetMACAddress: "be:ee:00:00:00:01", MTU: 9000},
+	}
+	if !reflect.DeepEqual(got.Links, wantLinks) {
+		t.Errorf("links = %+v, want %+v", got.Links, wantLinks)
+	}
+
+	wantNetworks := []NetworkDataNetwork{
+		{
+			ID: "network0", Type: "ipv4", Link: "interface0",
+			IPAddress: "10.55.22.22", Netmask: "255.255.255.0",
+			Routes:         []NetworkDataRoute{{Network: "0.0.0.0", Netmask: "0.0.0.0", Gateway: "10.55.22.1"}},
+			DNSNameservers: []string{"10.55.22.53"},
+		},
+		{
+			ID: "network1", Type: "ipv6", Link: "interface0",
+			IPAddress: "2001:db8::22", Netmask: "ffff:ffff:ffff:ffff::",
+			Routes: []NetworkDataRoute{{Network: "::", Netmask: "::", Gateway: "2001:db8::1"}},
+		},
+		{
+			ID: "network2", Type: "ipv4_dhcp", Link: "interface1",
+			Routes: []NetworkDataRoute{{Network: "172.16.0.0", Netmask: "255.240.0.0", Gateway: "192.168.1.1", Metric: 10}},
+		},
+	}
+	if !reflect.DeepEqual(got.Networks, wantNetworks) {
+		t.Errorf("networks = %+v, want %+v", got.Networks, wantNetworks)
+	}
+
+	noNICs := testConfigDriveVM()
+	noNICs.Spec.NetworkInterfaces = nil
+	if _, err := GenerateConfigDriveNetworkData(noNICs); err == nil {
+		t.Error("GenerateConfigDriveNetworkData() without interfaces expected error")
+	}
+}
+
+func TestGenerateISO_ConfigDrive(t *testing.T) {
+	vm := testConfigDriveVM()
+	isoBytes, err := GenerateISO(vm)
+	if err != nil {
+		t.Fatalf("GenerateISO() error = %v", err)
+	}
+
+	img, err := iso9660.OpenImage(bytes.NewReader(isoBytes))
+	if err != nil {
+		t.Fatalf("failed to open ISO image: %v", err)
+	}
+	label, err := img.Label()
+	if err != nil {
+		t.Fatalf("failed to get volume label: %v", err)
+	}
+	if label != "config-2" {
+		t.Errorf("ISO volume identifier = %q, want config-2", label)
+	}
+
+	root, err := img.RootDir()
+	if err != nil {
+		t.Fatalf("failed to get root directory: %v", err)
+	}
+	latest := isoDir(t, isoDir(t, root, "openstack"), "latest")
+	children, err := latest.GetChildren()
+	if err != nil {
+		t.Fatalf("failed to list openstack/latest: %v", err)
+	}
+
+	userData, _ := GenerateUserData(vm)
+	metaData, _ := GenerateConfigDriveMetaData(vm)
+	networkData, _ := GenerateConfigDriveNetworkData(vm)
+	want := map[string]string{
+		"user_data":         userData,
+		"meta_data.json":    metaData,
+		"network_data.json": networkData,
+	}
+	for _, child := range children {
+		content, err := readISOFile(child)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", child.Name(), err)
+		}
+		if content != want[child.Name()] {
+			t.Errorf("openstack/latest/%s = %q, want %q", child.Name(), content, want[child.Name()])
+		}
+		delete(want, child.Name())
+	}
+	for name := range want {
+		t.Errorf("openstack/latest/%s missing", name)
+	}
+}
+
+// isoDir returns the child directory name of dir.
+func isoDir(t *testing.T, dir *iso9660.File, name string) *iso9660.File {
+	t.Helper()
+	children, err := dir.GetChildren()
+	if err != nil {
+		t.Fatalf("failed to list directory: %v", err)
+	}
+	for _, child := range children {
+		if child.Name() == name && child.IsDir() {
+			return child
+		}
+	}
+	t.Fatalf("directory %s not found", name)
+	return nil
+}
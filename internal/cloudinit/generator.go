@@ -1,13 +1,15 @@
 // Package cloudinit provides cloud-init configuration generation for VM provisioning.
 //
 // This package generates cloud-init configuration files (user-data, meta-data, network-config)
-// following the official cloud-init NoCloud datasource specification.
+// following the official cloud-init NoCloud datasource specification, and
+// their OpenStack config drive equivalents (see configdrive.go).
 //
 // See https://cloudinit.readthedocs.io/en/latest/reference/datasources/nocloud.html
 package cloudinit
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
 	"go.yaml.in/yaml/v3"
@@ -21,12 +23,13 @@ import (
 //
 // See https://cloudinit.readthedocs.io/en/latest/explanation/format.html#cloud-config-data
 type UserData struct {
-	Hostname          string    `yaml:"hostname"`
-	FQDN              string    `yaml:"fqdn"`
-	SSHAuthorizedKeys []string  `yaml:"ssh_authorized_keys,omitempty"`
-	Chpasswd          *Chpasswd `yaml:"chpasswd,omitempty"`
-	SSHPasswordAuth   bool      `yaml:"ssh_pwauth"`
-	Output            *Output   `yaml:"output,omitempty"`
+	Hostname          string     `yaml:"hostname"`
+	FQDN              string     `yaml:"fqdn"`
+	SSHAuthorizedKeys []string   `yaml:"ssh_authorized_keys,omitempty"`
+	Chpasswd          *Chpasswd  `yaml:"chpasswd,omitempty"`
+	SSHPasswordAuth   bool       `yaml:"ssh_pwauth"`
+	Output            *Output    `yaml:"output,omitempty"`
+	RunCmd            [][]string `yaml:"runcmd,omitempty"`
 }
 
 // Chpasswd configures user password settings.
@@ -59,7 +62,9 @@ type NetworkConfig struct {
 // EthernetConfig represents a single ethernet interface configuration.
 type EthernetConfig struct {
 	Match       MatchConfig   `yaml:"match"`
-	Addresses   []string      `yaml:"addresses"`
+	DHCP4       bool          `yaml:"dhcp4,omitempty"`
+	Addresses   []string      `yaml:"addresses,omitempty"`
+	MTU         int           `yaml:"mtu,omitempty"`
 	Routes      []RouteConfig `yaml:"routes,omitempty"`
 	Nameservers *Nameservers  `yaml:"nameservers,omitempty"`
 }
@@ -71,13 +76,15 @@ type MatchConfig struct {
 
 // RouteConfig represents a static route.
 type RouteConfig struct {
-	To  string `yaml:"to"`
-	Via string `yaml:"via"`
+	To     string `yaml:"to"`
+	Via    string `yaml:"via"`
+	Metric int    `yaml:"metric,omitempty"`
 }
 
 // Nameservers represents DNS server configuration.
 type Nameservers struct {
-	Addresses []string `yaml:"addresses"`
+	Addresses []string `yaml:"addresses,omitempty"`
+	Search    []string `yaml:"search,omitempty"`
 }
 
 // GenerateUserData generates the user-data YAML content from VM configuration.
@@ -134,6 +141,11 @@ func GenerateUserData(vm *v1alpha1.VirtualMachine) (string, error) {
 
 		// Set SSH password authentication
 		userData.SSHPasswordAuth = vm.Spec.CloudInit.SSHPasswordAuth
+
+		// Trim free space weekly so discarded blocks are returned to the volume
+		if vm.Spec.CloudInit.FSTrim {
+			userData.RunCmd = append(userData.RunCmd, []string{"systemctl", "enable", "--now", "fstrim.timer"})
+		}
 	}
 
 	// Marshal to YAML
@@ -142,10 +154,68 @@ func GenerateUserData(vm *v1alpha1.VirtualMachine) (string, error) {
 		return "", fmt.Errorf("failed to marshal user-data to YAML: %w", err)
 	}
 
+	// Merge additional cloud-config keys
+	if vm.Spec.CloudInit != nil && vm.Spec.CloudInit.UserDataExtra != "" {
+		yamlBytes, err = mergeUserDataExtra(yamlBytes, vm.Spec.CloudInit.UserDataExtra)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	// Prepend #cloud-config header (required by cloud-init spec)
 	return "#cloud-config\n" + string(yamlBytes), nil
 }
 
+// mergeUserDataExtra merges the cloud-config keys in extra into the generated
+// user-data YAML. Keys missing from generated are appended in order, lists
+// are appended to generated lists of the same key, and any other key present
+// in both is an error since silently overriding e.g. the hostname would
+// break the VM.
+func mergeUserDataExtra(generated []byte, extra string) ([]byte, error) {
+	var base, add yaml.Node
+	if err := yaml.Unmarshal(generated, &base); err != nil {
+		return nil, fmt.Errorf("failed to parse generated user-data: %w", err)
+	}
+	if err := yaml.Unmarshal([]byte(extra), &add); err != nil {
+		return nil, fmt.Errorf("invalid userDataExtra: %w", err)
+	}
+	if len(add.Content) == 0 {
+		return generated, nil
+	}
+
+	baseMap, addMap := base.Content[0], add.Content[0]
+	if addMap.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("invalid userDataExtra: must be a YAML mapping of cloud-config keys")
+	}
+
+	for i := 0; i+1 < len(addMap.Content); i += 2 {
+		key, value := addMap.Content[i], addMap.Content[i+1]
+
+		var existing *yaml.Node
+		for j := 0; j+1 < len(baseMap.Content); j += 2 {
+			if baseMap.Content[j].Value == key.Value {
+				existing = baseMap.Content[j+1]
+				break
+			}
+		}
+
+		switch {
+		case existing == nil:
+			baseMap.Content = append(baseMap.Content, key, value)
+		case existing.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode:
+			existing.Content = append(existing.Content, value.Content...)
+		default:
+			return nil, fmt.Errorf("userDataExtra key %q conflicts with user-data generated by foundry", key.Value)
+		}
+	}
+
+	merged, err := yaml.Marshal(&base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal user-data to YAML: %w", err)
+	}
+	return merged, nil
+}
+
 // validateUserData validates that the provided user-data is in a valid cloud-init format.
 //
 // Cloud-init supports multiple formats:
@@ -222,39 +292,61 @@ func GenerateNetworkConfig(vm *v1alpha1.VirtualMachine) (string, error) {
 		Ethernets: make(map[string]EthernetConfig),
 	}
 
+	metrics := defaultRouteMetrics(vm)
 	for i, iface := range vm.Spec.NetworkInterfaces {
 		ethName := fmt.Sprintf("eth%d", i)
 
-		// Calculate MAC address from IP
-		macAddr, err := naming.MACFromIP(iface.IP)
+		// Use the configured MAC address, or derive it from the IP
+		macAddr, err := naming.InterfaceMAC(iface.IP, iface.IPv6, iface.MACAddress)
 		if err != nil {
-			return "", fmt.Errorf("failed to calculate MAC address for %s: %w", iface.IP, err)
+			return "", fmt.Errorf("failed to calculate MAC address for %s: %w", ethName, err)
 		}
 
 		ethConfig := EthernetConfig{
 			Match: MatchConfig{
 				MACAddress: macAddr,
 			},
-			Addresses: []string{iface.IP},
+			MTU: iface.MTU,
+		}
+		if iface.DHCP {
+			ethConfig.DHCP4 = true
+		} else if iface.IP != "" {
+			ethConfig.Addresses = append(ethConfig.Addresses, iface.IP)
+		}
+		if iface.IPv6 != "" {
+			ethConfig.Addresses = append(ethConfig.Addresses, iface.IPv6)
 		}
 
-		// Add default route if this interface should have one
-		if iface.DefaultRoute {
-			ethConfig.Routes = []RouteConfig{
-				{
-					To:  "0.0.0.0/0",
-					Via: iface.Gateway,
-				},
+		// Add default routes if this interface should have them
+		if metric, ok := metrics[i]; ok {
+			if iface.IP != "" {
+				ethConfig.Routes = append(ethConfig.Routes, RouteConfig{
+					To:     "0.0.0.0/0",
+					Via:    iface.Gateway,
+					Metric: metric,
+				})
+			}
+			if iface.IPv6Gateway != "" {
+				ethConfig.Routes = append(ethConfig.Routes, RouteConfig{
+					To:     "::/0",
+					Via:    iface.IPv6Gateway,
+					Metric: metric,
+				})
 			}
 		}
 
-		// Add DNS servers if configured
-		if len(iface.DNSServers) > 0 {
-			ethConfig.Nameservers = &Nameservers{
-				Addresses: iface.DNSServers,
-			}
+		// Add the interface's static routes
+		for _, route := range iface.Routes {
+			ethConfig.Routes = append(ethConfig.Routes, RouteConfig{
+				To:     route.To,
+				Via:    route.Via,
+				Metric: route.Metric,
+			})
 		}
 
+		// Add DNS servers if configured, or inherited from the network defaults
+		ethConfig.Nameservers = interfaceNameservers(vm, iface)
+
 		networkConfig.Ethernets[ethName] = ethConfig
 	}
 
@@ -265,3 +357,57 @@ func GenerateNetworkConfig(vm *v1alpha1.VirtualMachine) (string, error) {
 
 	return string(yamlBytes), nil
 }
+
+// defaultRouteMetrics returns the interfaces that get a default route, by
+// index, with the metric of their routes. With the single gateway metric
+// policy these are the interfaces with DefaultRoute, without a metric. With
+// the ordered policy every static interface with a gateway gets one, ranked
+// DefaultRoute interfaces first and then by position.
+func defaultRouteMetrics(vm *v1alpha1.VirtualMachine) map[int]int {
+	metrics := make(map[int]int)
+	if vm.GetGatewayMetricPolicy() != v1alpha1.GatewayMetricPolicyOrdered {
+		for i, iface := range vm.Spec.NetworkInterfaces {
+			if iface.DefaultRoute && !iface.DHCP {
+				metrics[i] = 0
+			}
+		}
+		return metrics
+	}
+
+	var ranked []int
+	for _, preferred := range []bool{true, false} {
+		for i, iface := range vm.Spec.NetworkInterfaces {
+			hasGateway := iface.Gateway != "" || iface.IPv6Gateway != ""
+			if iface.DHCP || !hasGateway || iface.DefaultRoute != preferred {
+				continue
+			}
+			ranked = append(ranked, i)
+		}
+	}
+	for rank, i := range ranked {
+		metrics[i] = 100 * (rank + 1)
+	}
+	return metrics
+}
+
+// interfaceNameservers returns the DNS settings of an interface: its own DNS
+// servers, or those of the VM's network defaults, and its own search domains
+// followed by the default ones. DHCP interfaces inherit nothing, the DHCP
+// server provides both.
+func interfaceNameservers(vm *v1alpha1.VirtualMachine, iface v1alpha1.NetworkInterfaceSpec) *Nameservers {
+	ns := &Nameservers{Addresses: iface.DNSServers, Search: slices.Clone(iface.SearchDomains)}
+	if nd := vm.Spec.NetworkDefaults; nd != nil && !iface.DHCP {
+		if len(ns.Addresses) == 0 {
+			ns.Addresses = nd.DNSServers
+		}
+		for _, domain := range nd.SearchDomains {
+			if !slices.Contains(ns.Search, domain) {
+				ns.Search = append(ns.Search, domain)
+			}
+		}
+	}
+	if len(ns.Addresses) == 0 && len(ns.Search) == 0 {
+		return nil
+	}
+	return ns
+}
@@ -1,6 +1,7 @@
 package cloudinit
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 
@@ -397,6 +398,133 @@ packages:
 	}
 }
 
+func TestGenerateUserData_Extra(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "test-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			CloudInit: &v1alpha1.CloudInitSpec{
+				SSHAuthorizedKeys: []string{testSSHKeyEd25519},
+				UserDataExtra: `packages:
+  - nginx
+runcmd:
+  - systemctl enable --now nginx
+ssh_authorized_keys:
+  - ` + testSSHKeyRSA + `
+write_files:
+  - path: /etc/motd
+    content: managed by foundry
+`,
+			},
+		},
+	}
+
+	content, err := GenerateUserData(vm)
+	if err != nil {
+		t.Fatalf("GenerateUserData() error = %v", err)
+	}
+	if !strings.HasPrefix(content, "#cloud-config\n") {
+		t.Error("user-data must start with '#cloud-config'")
+	}
+
+	var merged struct {
+		Hostname          string   `yaml:"hostname"`
+		SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys"`
+		Packages          []string `yaml:"packages"`
+		Runcmd            []string `yaml:"runcmd"`
+		WriteFiles        []struct {
+			Path    string `yaml:"path"`
+			Content string `yaml:"content"`
+		} `yaml:"write_files"`
+	}
+	if err := yaml.Unmarshal([]byte(content), &merged); err != nil {
+		t.Fatalf("failed to parse merged user-data: %v\n%s", err, content)
+	}
+
+	if merged.Hostname != "test-vm" {
+		t.Errorf("hostname = %q, want generated hostname kept", merged.Hostname)
+	}
+	if len(merged.SSHAuthorizedKeys) != 2 || merged.SSHAuthorizedKeys[0] != testSSHKeyEd25519 || merged.SSHAuthorizedKeys[1] != testSSHKeyRSA {
+		t.Errorf("ssh_authorized_keys = %v, want generated key followed by extra key", merged.SSHAuthorizedKeys)
+	}
+	if len(merged.Packages) != 1 || merged.Packages[0] != "nginx" {
+		t.Errorf("packages = %v", merged.Packages)
+	}
+	if len(merged.Runcmd) != 1 || len(merged.WriteFiles) != 1 || merged.WriteFiles[0].Path != "/etc/motd" {
+		t.Errorf("runcmd = %v, write_files = %v", merged.Runcmd, merged.WriteFiles)
+	}
+
+	// Generated keys keep their position ahead of the extra keys
+	if strings.Index(content, "hostname:") > strings.Index(content, "packages:") {
+		t.Errorf("extra keys should follow the generated ones:\n%s", content)
+	}
+}
+
+func TestGenerateUserData_ExtraConflicts(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra string
+		want  string
+	}{
+		{name: "scalar override", extra: "hostname: other\n", want: `key "hostname" conflicts`},
+		{name: "list onto scalar", extra: "ssh_pwauth: [true]\n", want: `key "ssh_pwauth" conflicts`},
+		{name: "not a mapping", extra: "- packages\n", want: "must be a YAML mapping"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &v1alpha1.VirtualMachine{
+				ObjectMeta: v1alpha1.ObjectMeta{Name: "test-vm"},
+				Spec: v1alpha1.VirtualMachineSpec{
+					CloudInit: &v1alpha1.CloudInitSpec{UserDataExtra: tt.extra},
+				},
+			}
+			_, err := GenerateUserData(vm)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("GenerateUserData() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateUserData_FSTrim(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "test-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			CloudInit: &v1alpha1.CloudInitSpec{
+				FSTrim:        true,
+				UserDataExtra: "runcmd:\n  - systemctl enable --now nginx\n",
+			},
+		},
+	}
+
+	content, err := GenerateUserData(vm)
+	if err != nil {
+		t.Fatalf("GenerateUserData() error = %v", err)
+	}
+
+	var parsed struct {
+		Runcmd []interface{} `yaml:"runcmd"`
+	}
+	if err := yaml.Unmarshal([]byte(content), &parsed); err != nil {
+		t.Fatalf("failed to parse user-data: %v\n%s", err, content)
+	}
+	if len(parsed.Runcmd) != 2 {
+		t.Fatalf("runcmd = %v, want fstrim.timer and the extra command", parsed.Runcmd)
+	}
+	if !strings.Contains(content, "fstrim.timer") {
+		t.Errorf("expected fstrim.timer to be enabled:\n%s", content)
+	}
+
+	vm.Spec.CloudInit = &v1alpha1.CloudInitSpec{}
+	content, err = GenerateUserData(vm)
+	if err != nil {
+		t.Fatalf("GenerateUserData() error = %v", err)
+	}
+	if strings.Contains(content, "runcmd") {
+		t.Errorf("expected no runcmd without fstrim:\n%s", content)
+	}
+}
+
 func TestGenerateMetaData(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -931,3 +1059,264 @@ func TestGenerateAll(t *testing.T) {
 		t.Errorf("network-config MAC mismatch: got %q", eth0.Match.MACAddress)
 	}
 }
+
+func TestGenerateNetworkConfig_DHCP(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "test-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{
+					Bridge:     "br0",
+					DHCP:       true,
+					MACAddress: "be:ee:01:02:03:04",
+					MTU:        9000,
+					DNSServers: []string{"10.0.0.53"},
+				},
+			},
+		},
+	}
+
+	content, err := GenerateNetworkConfig(vm)
+	if err != nil {
+		t.Fatalf("GenerateNetworkConfig() error = %v", err)
+	}
+
+	var config NetworkConfig
+	if err := yaml.Unmarshal([]byte(content), &config); err != nil {
+		t.Fatalf("failed to parse network-config: %v", err)
+	}
+	eth := config.Ethernets["eth0"]
+	if !eth.DHCP4 {
+		t.Error("expected dhcp4: true")
+	}
+	if eth.Match.MACAddress != "be:ee:01:02:03:04" {
+		t.Errorf("match.macaddress = %q", eth.Match.MACAddress)
+	}
+	if eth.MTU != 9000 {
+		t.Errorf("mtu = %d, want 9000", eth.MTU)
+	}
+	if len(eth.Addresses) != 0 || len(eth.Routes) != 0 {
+		t.Errorf("expected no static addresses or routes, got %v %v", eth.Addresses, eth.Routes)
+	}
+	if eth.Nameservers == nil || len(eth.Nameservers.Addresses) != 1 {
+		t.Errorf("expected nameservers to be kept, got %v", eth.Nameservers)
+	}
+	if strings.Contains(content, "addresses: []") {
+		t.Errorf("expected addresses to be omitted:\n%s", content)
+	}
+}
+
+func TestGenerateNetworkConfig_IPv6(t *testing.T) {
+	tests := []struct {
+		name          string
+		iface         v1alpha1.NetworkInterfaceSpec
+		wantMAC       string
+		wantAddresses []string
+		wantRoutes    []RouteConfig
+	}{
+		{
+			name: "dual-stack",
+			iface: v1alpha1.NetworkInterfaceSpec{
+				IP:           "10.0.0.10/24",
+				Gateway:      "10.0.0.1",
+				IPv6:         "2001:db8::10/64",
+				IPv6Gateway:  "2001:db8::1",
+				DefaultRoute: true,
+			},
+			wantMAC:       "be:ef:0a:00:00:0a",
+			wantAddresses: []string{"10.0.0.10/24", "2001:db8::10/64"},
+			wantRoutes: []RouteConfig{
+				{To: "0.0.0.0/0", Via: "10.0.0.1"},
+				{To: "::/0", Via: "2001:db8::1"},
+			},
+		},
+		{
+			name: "IPv6 only",
+			iface: v1alpha1.NetworkInterfaceSpec{
+				IPv6:         "2001:db8::10/64",
+				IPv6Gateway:  "2001:db8::1",
+				DefaultRoute: true,
+			},
+			wantMAC:       "be:e6:9b:26:2f:e9",
+			wantAddresses: []string{"2001:db8::10/64"},
+			wantRoutes:    []RouteConfig{{To: "::/0", Via: "2001:db8::1"}},
+		},
+		{
+			name: "IPv6 without default route",
+			iface: v1alpha1.NetworkInterfaceSpec{
+				IPv6:        "2001:db8::10/64",
+				IPv6Gateway: "2001:db8::1",
+			},
+			wantMAC:       "be:e6:9b:26:2f:e9",
+			wantAddresses: []string{"2001:db8::10/64"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &v1alpha1.VirtualMachine{
+				ObjectMeta: v1alpha1.ObjectMeta{Name: "test-vm"},
+				Spec: v1alpha1.VirtualMachineSpec{
+					NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{tt.iface},
+				},
+			}
+
+			content, err := GenerateNetworkConfig(vm)
+			if err != nil {
+				t.Fatalf("GenerateNetworkConfig() error = %v", err)
+			}
+
+			var config NetworkConfig
+			if err := yaml.Unmarshal([]byte(content), &config); err != nil {
+				t.Fatalf("failed to parse network-config: %v", err)
+			}
+			eth := config.Ethernets["eth0"]
+			if eth.Match.MACAddress != tt.wantMAC {
+				t.Errorf("match.macaddress = %q, want %q", eth.Match.MACAddress, tt.wantMAC)
+			}
+			if !reflect.DeepEqual(eth.Addresses, tt.wantAddresses) {
+				t.Errorf("addresses = %v, want %v", eth.Addresses, tt.wantAddresses)
+			}
+			if !reflect.DeepEqual(eth.Routes, tt.wantRoutes) {
+				t.Errorf("routes = %v, want %v", eth.Routes, tt.wantRoutes)
+			}
+		})
+	}
+}
+
+func TestGenerateNetworkConfig_NetworkDefaults(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "test-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{IP: "10.0.0.10/24", Gateway: "10.0.0.1", Bridge: "br0"},
+				{IP: "10.1.0.10/24", Gateway: "10.1.0.1", Bridge: "br1", DNSServers: []string{"10.1.0.53"},
+					SearchDomains: []string{"lab.example.com", "example.com"}},
+				{Bridge: "br2", DHCP: true, MACAddress: "be:ee:01:02:03:04"},
+				{Bridge: "br3", DHCP: true, MACAddress: "be:ee:01:02:03:05", SearchDomains: []string{"dmz.example.com"}},
+			},
+			NetworkDefaults: &v1alpha1.NetworkDefaultsSpec{
+				DNSServers:    []string{"10.0.0.53", "10.0.0.54"},
+				SearchDomains: []string{"example.com"},
+			},
+		},
+	}
+
+	content, err := GenerateNetworkConfig(vm)
+	if err != nil {
+		t.Fatalf("GenerateNetworkConfig() error = %v", err)
+	}
+	var config NetworkConfig
+	if err := yaml.Unmarshal([]byte(content), &config); err != nil {
+		t.Fatalf("failed to parse network-config: %v", err)
+	}
+
+	want := map[string]*Nameservers{
+		// Inherits both
+		"eth0": {Addresses: []string{"10.0.0.53", "10.0.0.54"}, Search: []string{"example.com"}},
+		// Overrides the DNS servers, searches its own domains first
+		"eth1": {Addresses: []string{"10.1.0.53"}, Search: []string{"lab.example.com", "example.com"}},
+		// DHCP provides its own
+		"eth2": nil,
+		// Unless configured
+		"eth3": {Search: []string{"dmz.example.com"}},
+	}
+	for name, ns := range want {
+		if got := config.Ethernets[name].Nameservers; !reflect.DeepEqual(got, ns) {
+			t.Errorf("%s nameservers = %+v, want %+v", name, got, ns)
+		}
+	}
+}
+
+func TestGenerateNetworkConfig_StaticRoutes(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "test-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{IP: "10.0.0.10/24", Gateway: "10.0.0.1", Bridge: "br0", DefaultRoute: true},
+				{
+					IP: "10.1.0.10/24", IPv6: "2001:db8:1::10/64", Bridge: "br1",
+					Routes: []v1alpha1.RouteSpec{
+						{To: "10.20.0.0/16", Via: "10.1.0.1"},
+						{To: "2001:db8:20::/48", Via: "2001:db8:1::1", Metric: 50},
+					},
+				},
+			},
+		},
+	}
+
+	content, err := GenerateNetworkConfig(vm)
+	if err != nil {
+		t.Fatalf("GenerateNetworkConfig() error = %v", err)
+	}
+	var config NetworkConfig
+	if err := yaml.Unmarshal([]byte(content), &config); err != nil {
+		t.Fatalf("failed to parse network-config: %v", err)
+	}
+
+	want := []RouteConfig{
+		{To: "10.20.0.0/16", Via: "10.1.0.1"},
+		{To: "2001:db8:20::/48", Via: "2001:db8:1::1", Metric: 50},
+	}
+	if got := config.Ethernets["eth1"].Routes; !reflect.DeepEqual(got, want) {
+		t.Errorf("eth1 routes = %+v, want %+v", got, want)
+	}
+	if got := config.Ethernets["eth0"].Routes; len(got) != 1 || got[0].To != "0.0.0.0/0" {
+		t.Errorf("eth0 routes = %+v, want only the default route", got)
+	}
+}
+
+func TestGenerateNetworkConfig_GatewayMetricPolicy(t *testing.T) {
+	newVM := func(policy string) *v1alpha1.VirtualMachine {
+		return &v1alpha1.VirtualMachine{
+			ObjectMeta: v1alpha1.ObjectMeta{Name: "test-vm"},
+			Spec: v1alpha1.VirtualMachineSpec{
+				NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+					{IP: "10.0.0.10/24", Gateway: "10.0.0.1", Bridge: "br0"},
+					{IP: "10.1.0.10/24", Gateway: "10.1.0.1", Bridge: "br1", DefaultRoute: true},
+					{Bridge: "br2", DHCP: true, MACAddress: "be:ee:01:02:03:04"},
+					{IP: "10.2.0.10/24", Gateway: "10.2.0.1", IPv6: "2001:db8::10/64", IPv6Gateway: "2001:db8::1", Bridge: "br3"},
+				},
+				NetworkDefaults: &v1alpha1.NetworkDefaultsSpec{GatewayMetricPolicy: policy},
+			},
+		}
+	}
+
+	tests := []struct {
+		policy string
+		want   map[string][]RouteConfig
+	}{
+		{
+			policy: "",
+			want: map[string][]RouteConfig{
+				"eth1": {{To: "0.0.0.0/0", Via: "10.1.0.1"}},
+			},
+		},
+		{
+			policy: v1alpha1.GatewayMetricPolicyOrdered,
+			want: map[string][]RouteConfig{
+				"eth0": {{To: "0.0.0.0/0", Via: "10.0.0.1", Metric: 200}},
+				"eth1": {{To: "0.0.0.0/0", Via: "10.1.0.1", Metric: 100}},
+				"eth3": {{To: "0.0.0.0/0", Via: "10.2.0.1", Metric: 300}, {To: "::/0", Via: "2001:db8::1", Metric: 300}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run("policy "+tt.policy, func(t *testing.T) {
+			content, err := GenerateNetworkConfig(newVM(tt.policy))
+			if err != nil {
+				t.Fatalf("GenerateNetworkConfig() error = %v", err)
+			}
+			var config NetworkConfig
+			if err := yaml.Unmarshal([]byte(content), &config); err != nil {
+				t.Fatalf("failed to parse network-config: %v", err)
+			}
+			for name, eth := range config.Ethernets {
+				if !reflect.DeepEqual(eth.Routes, tt.want[name]) {
+					t.Errorf("%s routes = %v, want %v", name, eth.Routes, tt.want[name])
+				}
+			}
+		})
+	}
+}
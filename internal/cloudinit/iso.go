@@ -10,16 +10,26 @@ import (
 	"github.com/jbweber/foundry/api/v1alpha1"
 )
 
-// GenerateISO creates a cloud-init NoCloud ISO image from the VM configuration.
+// GenerateISO creates a cloud-init seed ISO image from the VM configuration,
+// in the format of its datasource.
 //
-// The generated ISO contains three files in the root directory:
+// A NoCloud ISO (the default) contains three files in the root directory:
 //   - user-data: Cloud-config YAML with hostname, SSH keys, passwords
 //   - meta-data: Instance metadata (instance-id, local-hostname)
 //   - network-config: Netplan v2 network configuration
 //
-// The ISO volume label is set to "CIDATA" as required by the cloud-init NoCloud datasource.
+// and is labeled "CIDATA" as required by the cloud-init NoCloud datasource.
+// A config drive ISO contains the same user-data, metadata and network
+// configuration as openstack/latest/user_data, meta_data.json and
+// network_data.json, and is labeled "config-2".
 //
 // See https://cloudinit.readthedocs.io/en/latest/reference/datasources/nocloud.html
+// and https://cloudinit.readthedocs.io/en/latest/reference/datasources/configdrive.html
+//
+// The ISO9660 image is written in Go, without genisoimage, xorriso or mkisofs,
+// so it works on minimal hypervisor hosts and on macOS and Windows clients.
+// File names are lowercase ISO9660 names, which Linux mounts as written; the
+// files are staged in a temporary directory ($TMPDIR) while the image is built.
 //
 // Returns the ISO image as a byte slice, ready to be uploaded to libvirt storage.
 func GenerateISO(vm *v1alpha1.VirtualMachine) ([]byte, error) {
@@ -27,20 +37,9 @@ func GenerateISO(vm *v1alpha1.VirtualMachine) ([]byte, error) {
 		return nil, fmt.Errorf("VM configuration cannot be nil")
 	}
 
-	// Generate the three cloud-init files
-	userData, err := GenerateUserData(vm)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate user-data: %w", err)
-	}
-
-	metaData, err := GenerateMetaData(vm)
+	label, files, err := seedFiles(vm)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate meta-data: %w", err)
-	}
-
-	networkConfig, err := GenerateNetworkConfig(vm)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate network-config: %w", err)
+		return nil, err
 	}
 
 	// Create a new ISO9660 image writer
@@ -55,29 +54,68 @@ func GenerateISO(vm *v1alpha1.VirtualMachine) ([]byte, error) {
 		_ = writer.Cleanup()
 	}()
 
-	// Add the three cloud-init files to the root directory
+	// Add the cloud-init files
 	// AddFile takes an io.Reader, so wrap the strings in bytes.NewReader
-	if err := writer.AddFile(bytes.NewReader([]byte(userData)), "user-data"); err != nil {
-		return nil, fmt.Errorf("failed to add user-data: %w", err)
-	}
-
-	if err := writer.AddFile(bytes.NewReader([]byte(metaData)), "meta-data"); err != nil {
-		return nil, fmt.Errorf("failed to add meta-data: %w", err)
-	}
-
-	if err := writer.AddFile(bytes.NewReader([]byte(networkConfig)), "network-config"); err != nil {
-		return nil, fmt.Errorf("failed to add network-config: %w", err)
+	for _, file := range files {
+		if err := writer.AddFile(bytes.NewReader([]byte(file.content)), file.path); err != nil {
+			return nil, fmt.Errorf("failed to add %s: %w", file.path, err)
+		}
 	}
 
 	// Create an in-memory buffer to hold the ISO image
 	var buf bytes.Buffer
 
 	// Write the ISO image to the buffer
-	// The volume identifier "CIDATA" is passed here (required by cloud-init NoCloud datasource)
-	// This must be uppercase per the NoCloud specification
-	if err := writer.WriteTo(&buf, "CIDATA"); err != nil {
+	// The volume identifier is the one the datasource looks for
+	if err := writer.WriteTo(&buf, label); err != nil {
 		return nil, fmt.Errorf("failed to write ISO image: %w", err)
 	}
 
 	return buf.Bytes(), nil
 }
+
+// seedFile is a file of a cloud-init seed ISO.
+type seedFile struct {
+	path    string
+	content string
+}
+
+// seedFiles returns the volume label and files of the seed ISO of a VM's
+// datasource.
+func seedFiles(vm *v1alpha1.VirtualMachine) (string, []seedFile, error) {
+	userData, err := GenerateUserData(vm)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate user-data: %w", err)
+	}
+
+	if vm.GetCloudInitDatasource() == v1alpha1.CloudInitDatasourceConfigDrive {
+		metaData, err := GenerateConfigDriveMetaData(vm)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to generate meta_data.json: %w", err)
+		}
+		networkData, err := GenerateConfigDriveNetworkData(vm)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to generate network_data.json: %w", err)
+		}
+		return configDriveLabel, []seedFile{
+			{configDriveUserData, userData},
+			{configDriveMetaData, metaData},
+			{configDriveNetworkData, networkData},
+		}, nil
+	}
+
+	metaData, err := GenerateMetaData(vm)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate meta-data: %w", err)
+	}
+	networkConfig, err := GenerateNetworkConfig(vm)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate network-config: %w", err)
+	}
+	// The label must be uppercase per the NoCloud specification
+	return "CIDATA", []seedFile{
+		{"user-data", userData},
+		{"meta-data", metaData},
+		{"network-config", networkConfig},
+	}, nil
+}
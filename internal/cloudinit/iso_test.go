@@ -443,3 +443,33 @@ func TestGenerateISO_FileNamesExact(t *testing.T) {
 		}
 	}
 }
+
+func TestGenerateISO_NoExternalTools(t *testing.T) {
+	// Minimal hypervisor hosts have no genisoimage, xorriso or mkisofs; with
+	// nothing on PATH any attempt to run one would fail
+	t.Setenv("PATH", t.TempDir())
+
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{
+			Name: "minimal-host-vm",
+		},
+		Spec: v1alpha1.VirtualMachineSpec{
+			VCPUs:     1,
+			MemoryGiB: 1,
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{
+					IP:           "10.0.0.1/24",
+					Gateway:      "10.0.0.254",
+					Bridge:       "br0",
+					DefaultRoute: true,
+				},
+			},
+		},
+	}
+
+	isoBytes, err := GenerateISO(vm)
+	if err != nil {
+		t.Fatalf("GenerateISO() without external tools error: %v", err)
+	}
+	verifyISOStructure(t, isoBytes, vm)
+}
@@ -0,0 +1,129 @@
+package cloudinit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/logging"
+)
+
+// ErrNotFound is returned by a SeedLookup for a VM that does not exist.
+var ErrNotFound = errors.New("not found")
+
+// SeedLookup returns the VM named name, or an error wrapping ErrNotFound. The
+// VM's status should list the addresses it currently has, e.g. from DHCP.
+type SeedLookup func(ctx context.Context, name string) (*v1alpha1.VirtualMachine, error)
+
+// NewSeedHandler returns an HTTP handler serving the NoCloud seed of VMs
+// with the http cloud-init transport, for the nocloud-net datasource:
+//
+//	GET /{vm}/user-data
+//	GET /{vm}/meta-data
+//	GET /{vm}/network-config
+//	GET /{vm}/vendor-data    (always empty)
+//
+// The seed is generated from the VM's stored spec on every request, so it
+// follows spec changes without rewriting anything. VMs with other transports
+// are not served.
+//
+// The seed is not authenticated, as guests fetch it before they have any
+// credentials, and holds the VM's password hash and SSH keys. A VM's seed is
+// only served to requests from one of the VM's configured or discovered
+// addresses; still, only serve it on an address reachable from the VMs'
+// network alone, e.g. a link-local address on the VM bridge.
+func NewSeedHandler(lookup SeedLookup) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{vm}/{file}", func(w http.ResponseWriter, r *http.Request) {
+		serveSeed(w, r, lookup)
+	})
+	return mux
+}
+
+// serveSeed writes one file of the seed of a VM.
+func serveSeed(w http.ResponseWriter, r *http.Request, lookup SeedLookup) {
+	name, file := r.PathValue("vm"), r.PathValue("file")
+
+	var generate func(*v1alpha1.VirtualMachine) (string, error)
+	switch file {
+	case "user-data":
+		generate = GenerateUserData
+	case "meta-data":
+		generate = GenerateMetaData
+	case "network-config":
+		generate = GenerateNetworkConfig
+	case "vendor-data":
+		generate = func(*v1alpha1.VirtualMachine) (string, error) { return "", nil }
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	vm, err := lookup(r.Context(), name)
+	if errors.Is(err, ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Seed: failed to look up VM", "vm", name, "error", err)
+		http.Error(w, "failed to look up VM", http.StatusInternalServerError)
+		return
+	}
+	if vm.GetCloudInitTransport() != v1alpha1.CloudInitTransportHTTP {
+		http.NotFound(w, r)
+		return
+	}
+	if !requestFromVM(r, vm) {
+		// Look like a missing VM, so names cannot be probed either
+		logging.FromContext(r.Context()).Warn("Seed: refused request from another address", "vm", name, "file", file, "remote", r.RemoteAddr)
+		http.NotFound(w, r)
+		return
+	}
+
+	content, err := generate(vm)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Seed: failed to generate file", "vm", name, "file", file, "error", err)
+		http.Error(w, "failed to generate "+file, http.StatusInternalServerError)
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("Seed: served file", "vm", name, "file", file, "remote", r.RemoteAddr)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(content))
+}
+
+// requestFromVM reports whether r comes from one of vm's addresses: the static
+// IPs of its spec or the addresses listed in its status.
+func requestFromVM(r *http.Request, vm *v1alpha1.VirtualMachine) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	remote = remote.Unmap().WithZone("")
+
+	var addresses []string
+	for _, iface := range vm.Spec.NetworkInterfaces {
+		addresses = append(addresses, iface.IP, iface.IPv6)
+	}
+	for _, addr := range vm.Status.Addresses {
+		if addr.Type == "InternalIP" || addr.Type == "ExternalIP" {
+			addresses = append(addresses, addr.Address)
+		}
+	}
+	for _, address := range addresses {
+		if prefix, err := netip.ParsePrefix(address); err == nil {
+			address = prefix.Addr().String()
+		}
+		if addr, err := netip.ParseAddr(address); err == nil && addr.Unmap() == remote {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package cloudinit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+func TestSeedHandler(t *testing.T) {
+	vms := map[string]*v1alpha1.VirtualMachine{
+		"web": {
+			ObjectMeta: v1alpha1.ObjectMeta{Name: "web"},
+			Spec: v1alpha1.VirtualMachineSpec{
+				NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+					{IP: "10.0.0.10/24", Gateway: "10.0.0.1", DefaultRoute: true},
+				},
+				CloudInit: &v1alpha1.CloudInitSpec{
+					FQDN:      "web.example.com",
+					Transport: v1alpha1.CloudInitTransportHTTP,
+					SeedURL:   "http://169.254.169.254:8775",
+				},
+			},
+			// The test client connects from the loopback address
+			Status: v1alpha1.VirtualMachineStatus{
+				Addresses: []v1alpha1.VMAddress{{Type: "InternalIP", Address: "127.0.0.1"}},
+			},
+		},
+		"other": {
+			ObjectMeta: v1alpha1.ObjectMeta{Name: "other"},
+			Spec: v1alpha1.VirtualMachineSpec{
+				NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{{IP: "10.0.0.20/24", Gateway: "10.0.0.1"}},
+				CloudInit:         &v1alpha1.CloudInitSpec{Transport: v1alpha1.CloudInitTransportHTTP},
+			},
+		},
+		"iso": {
+			ObjectMeta: v1alpha1.ObjectMeta{Name: "iso"},
+			Spec:       v1alpha1.VirtualMachineSpec{CloudInit: &v1alpha1.CloudInitSpec{FQDN: "iso.example.com"}},
+		},
+	}
+	lookup := func(_ context.Context, name string) (*v1alpha1.VirtualMachine, error) {
+		if name == "broken" {
+			return nil, errors.New("connection lost")
+		}
+		vm, ok := vms[name]
+		if !ok {
+			return nil, fmt.Errorf("VM %s %w", name, ErrNotFound)
+		}
+		return vm, nil
+	}
+	srv := httptest.NewServer(NewSeedHandler(lookup))
+	defer srv.Close()
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/web/user-data", http.StatusOK, "#cloud-config"},
+		{"/web/meta-data", http.StatusOK, "local-hostname: web"},
+		{"/web/network-config", http.StatusOK, "10.0.0.10/24"},
+		{"/web/vendor-data", http.StatusOK, ""},
+		{"/web/passwd", http.StatusNotFound, ""},
+		{"/missing/user-data", http.StatusNotFound, ""},
+		{"/other/user-data", http.StatusNotFound, ""},
+		{"/iso/user-data", http.StatusNotFound, ""},
+		{"/broken/user-data", http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + tt.path)
+			if err != nil {
+				t.Fatalf("GET %s error = %v", tt.path, err)
+			}
+			defer func() { _ = resp.Body.Close() }()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("GET %s status = %d, want %d", tt.path, resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("GET %s body = %q, want it to contain %q", tt.path, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRequestFromVM(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		Spec: v1alpha1.VirtualMachineSpec{
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{IP: "10.0.0.10/24", IPv6: "fe80::10/64"},
+				{DHCP: true},
+			},
+		},
+		Status: v1alpha1.VirtualMachineStatus{
+			Addresses: []v1alpha1.VMAddress{
+				{Type: "InternalIP", Address: "192.168.122.57"},
+				{Type: "Hostname", Address: "web.example.com"},
+			},
+		},
+	}
+
+	tests := []struct {
+		remoteAddr string
+		want       bool
+	}{
+		{"10.0.0.10:40000", true},
+		{"[::ffff:10.0.0.10]:40000", true},
+		{"[fe80::10%br0]:40000", true},
+		{"192.168.122.57:40000", true},
+		{"10.0.0.11:40000", false},
+		{"192.168.122.58:40000", false},
+		{"web.example.com:40000", false},
+		{"garbage", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/web/user-data", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if got := requestFromVM(r, vm); got != tt.want {
+			t.Errorf("requestFromVM(%s) = %v, want %v", tt.remoteAddr, got, tt.want)
+		}
+	}
+}
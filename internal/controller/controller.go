@@ -0,0 +1,320 @@
+// Package controller reconciles VirtualMachine custom resources in a
+// Kubernetes cluster against the local libvirt host.
+//
+// One controller runs on each hypervisor and handles the resources whose
+// host label names that hypervisor. A resource maps to the libvirt VM of the
+// same name: the VM is created or updated like 'foundry apply', restarted
+// like 'foundry serve --watch-dir', and destroyed with its storage when the
+// resource is deleted. The VM's live state is written to the resource's
+// status subresource.
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/loader"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/status"
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+const (
+	// HostLabel selects the hypervisor a VirtualMachine resource runs on. Its
+	// value is the --host of the controller on that hypervisor.
+	HostLabel = v1alpha1.GroupName + "/host"
+
+	// Finalizer keeps a VirtualMachine resource around until its VM has been
+	// destroyed.
+	Finalizer = v1alpha1.GroupName + "/vm"
+
+	// DefaultResyncInterval is how often a resource is reconciled when nothing
+	// changed, refreshing its status and restarting its VM if it stopped.
+	DefaultResyncInterval = 30 * time.Second
+)
+
+// GroupVersionKind identifies VirtualMachine resources.
+var GroupVersionKind = schema.GroupVersionKind{
+	Group:   v1alpha1.GroupName,
+	Version: v1alpha1.Version,
+	Kind:    v1alpha1.VirtualMachineKind,
+}
+
+// vmBackend defines the VM operations the controller drives. The libvirt
+// implementation uses the vm package; tests use a fake.
+type vmBackend interface {
+	// Get returns the VM with its live status, or nil if it does not exist.
+	Get(ctx context.Context, name string) (*v1alpha1.VirtualMachine, error)
+
+	// Reconcile creates, updates or starts the VM to match desired.
+	Reconcile(ctx context.Context, desired *v1alpha1.VirtualMachine) ([]string, error)
+
+	// Destroy destroys the VM and its storage.
+	Destroy(ctx context.Context, name string) error
+}
+
+// Reconciler reconciles VirtualMachine resources labelled for one host.
+type Reconciler struct {
+	client client.Client
+	host   string
+	resync time.Duration
+	vms    vmBackend
+}
+
+// NewReconciler returns a Reconciler for the resources whose HostLabel is
+// host, using c to read and update them. Resources are reconciled again every
+// resync; zero uses DefaultResyncInterval.
+func NewReconciler(c client.Client, host string, resync time.Duration) *Reconciler {
+	if resync <= 0 {
+		resync = DefaultResyncInterval
+	}
+	return &Reconciler{client: c, host: host, resync: resync, vms: libvirtBackend{}}
+}
+
+// SetupWithManager registers the Reconciler with mgr.
+//
+// Only spec, label and deletion changes trigger a reconcile; status updates
+// made by the Reconciler itself do not.
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	onHost := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetLabels()[HostLabel] == r.host
+	})
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("virtualmachine").
+		For(newObject(), builder.WithPredicates(onHost, predicate.Or(predicate.GenerationChangedPredicate{}, predicate.LabelChangedPredicate{}))).
+		Complete(r)
+}
+
+// Reconcile brings the VM of one VirtualMachine resource to its desired state
+// and records the VM's state in the resource's status.
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	obj := newObject()
+	if err := r.client.Get(ctx, req.NamespacedName, obj); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	// The host label may have been changed since the event was queued
+	if obj.GetLabels()[HostLabel] != r.host {
+		return ctrl.Result{}, nil
+	}
+
+	if !obj.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, r.finalize(ctx, obj)
+	}
+
+	if controllerutil.AddFinalizer(obj, Finalizer) {
+		if err := r.client.Update(ctx, obj); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to add finalizer: %w", err)
+		}
+	}
+
+	desired, err := toVirtualMachine(ctx, obj)
+	if err != nil {
+		// An invalid spec is not retried until the resource changes
+		logging.FromContext(ctx).Error("Invalid VirtualMachine spec", "resource", req.NamespacedName.String(), "error", err)
+		return ctrl.Result{}, r.updateStatus(ctx, obj, nil, err)
+	}
+
+	observed, reconcileErr := r.reconcileVM(ctx, obj, desired)
+	if err := r.updateStatus(ctx, obj, observed, reconcileErr); err != nil {
+		return ctrl.Result{}, err
+	}
+	if reconcileErr != nil {
+		return ctrl.Result{}, reconcileErr
+	}
+	return ctrl.Result{RequeueAfter: r.resync}, nil
+}
+
+// reconcileVM creates, updates or starts the resource's VM and returns its
+// observed state. A VM of the same name not created for this resource is
+// left alone.
+func (r *Reconciler) reconcileVM(ctx context.Context, obj *unstructured.Unstructured, desired *v1alpha1.VirtualMachine) (*v1alpha1.VirtualMachine, error) {
+	existing, err := r.vms.Get(ctx, desired.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && !ownedBy(existing, obj) {
+		return existing, fmt.Errorf("VM '%s' already exists on host %s and was not created for this resource", desired.Name, r.host)
+	}
+
+	actions, err := r.vms.Reconcile(ctx, desired)
+	for _, action := range actions {
+		logging.FromContext(ctx).Info(action, "resource", obj.GetNamespace()+"/"+obj.GetName())
+	}
+	if err != nil {
+		return existing, err
+	}
+
+	observed, err := r.vms.Get(ctx, desired.Name)
+	if err != nil {
+		return existing, fmt.Errorf("failed to get VM status: %w", err)
+	}
+	return observed, nil
+}
+
+// finalize destroys the VM of a deleted resource and removes the finalizer.
+func (r *Reconciler) finalize(ctx context.Context, obj *unstructured.Unstructured) error {
+	logger := logging.FromContext(ctx)
+
+	if !controllerutil.ContainsFinalizer(obj, Finalizer) {
+		return nil
+	}
+
+	existing, err := r.vms.Get(ctx, obj.GetName())
+	if err != nil {
+		return err
+	}
+	switch {
+	case existing == nil:
+	case !ownedBy(existing, obj):
+		logger.Info("VM was not created for this resource, leaving it", "resource", obj.GetNamespace()+"/"+obj.GetName())
+	default:
+		logger.Info("Destroying VM", "resource", obj.GetNamespace()+"/"+obj.GetName())
+		if err := r.vms.Destroy(ctx, obj.GetName()); err != nil {
+			return fmt.Errorf("failed to destroy VM: %w", err)
+		}
+	}
+
+	controllerutil.RemoveFinalizer(obj, Finalizer)
+	if err := r.client.Update(ctx, obj); err != nil {
+		return fmt.Errorf("failed to remove finalizer: %w", err)
+	}
+	return nil
+}
+
+// updateStatus writes the observed VM state (nil if unknown) and the error of
+// the last reconcile, if any, to the resource's status. The status is only
+// written if it changed.
+func (r *Reconciler) updateStatus(ctx context.Context, obj *unstructured.Unstructured, observed *v1alpha1.VirtualMachine, reconcileErr error) error {
+	var current v1alpha1.VirtualMachineStatus
+	if raw, ok := obj.Object["status"]; ok {
+		if err := convert(raw, &current); err != nil {
+			return fmt.Errorf("failed to read status: %w", err)
+		}
+	}
+
+	// Conditions are set one by one to keep their transition times
+	vm := &v1alpha1.VirtualMachine{Status: *current.DeepCopy()}
+	vm.Generation = obj.GetGeneration()
+	if observed != nil {
+		conditions := vm.Status.Conditions
+		vm.Status = *observed.Status.DeepCopy()
+		vm.Status.Conditions = conditions
+		for _, c := range observed.Status.Conditions {
+			status.SetCondition(vm, c.Type, c.Status, c.Reason, c.Message)
+		}
+	}
+	switch {
+	case reconcileErr != nil:
+		status.MarkFailed(vm, "ReconcileFailed", reconcileErr.Error())
+	case observed == nil:
+		vm.SetPhase(v1alpha1.VMPhasePending)
+	}
+	vm.Status.ObservedGeneration = obj.GetGeneration()
+
+	if reflect.DeepEqual(vm.Status, current) {
+		return nil
+	}
+
+	var raw map[string]interface{}
+	if err := convert(vm.Status, &raw); err != nil {
+		return fmt.Errorf("failed to encode status: %w", err)
+	}
+	obj.Object["status"] = raw
+	if err := r.client.Status().Update(ctx, obj); err != nil {
+		return fmt.Errorf("failed to update status: %w", err)
+	}
+	return nil
+}
+
+// toVirtualMachine converts a resource to the VM it describes, validated and
+// with defaults applied like a config file. The VM is annotated with the
+// resource's UID; the resource's Kubernetes-managed metadata is dropped.
+func toVirtualMachine(ctx context.Context, obj *unstructured.Unstructured) (*v1alpha1.VirtualMachine, error) {
+	data, err := json.Marshal(map[string]interface{}{
+		"apiVersion": obj.GetAPIVersion(),
+		"kind":       obj.GetKind(),
+		"metadata": map[string]interface{}{
+			"name":        obj.GetName(),
+			"labels":      obj.GetLabels(),
+			"annotations": obj.GetAnnotations(),
+		},
+		"spec": obj.Object["spec"],
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode resource: %w", err)
+	}
+
+	// JSON is YAML, so the resource is loaded like a config file, except that
+	// whoever can create resources cannot have files on the host read
+	desired, err := loader.LoadUntrustedYAML(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	if desired.Annotations == nil {
+		desired.Annotations = make(map[string]string)
+	}
+	desired.Annotations[v1alpha1.AnnotationResourceUID] = string(obj.GetUID())
+	return desired, nil
+}
+
+// ownedBy reports whether vm was created for the resource obj.
+func ownedBy(vm *v1alpha1.VirtualMachine, obj *unstructured.Unstructured) bool {
+	return vm.Annotations[v1alpha1.AnnotationResourceUID] == string(obj.GetUID())
+}
+
+// newObject returns an empty VirtualMachine resource.
+func newObject() *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(GroupVersionKind)
+	return obj
+}
+
+// convert copies in to out through their JSON encoding.
+func convert(in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// libvirtBackend drives VMs on the libvirt host foundry is connected to.
+type libvirtBackend struct{}
+
+// Get returns the VM named name, or nil if there is none.
+func (libvirtBackend) Get(ctx context.Context, name string) (*v1alpha1.VirtualMachine, error) {
+	vms, err := vm.ListVMs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vms {
+		if v.Name == name {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+// Reconcile creates, updates or starts the VM to match desired.
+func (libvirtBackend) Reconcile(ctx context.Context, desired *v1alpha1.VirtualMachine) ([]string, error) {
+	return vm.ReconcileVM(ctx, desired)
+}
+
+// Destroy destroys the VM and its storage, including any left behind.
+func (libvirtBackend) Destroy(ctx context.Context, name string) error {
+	_, err := vm.Destroy(ctx, name, vm.DestroyOptions{ForceClean: true})
+	return err
+}
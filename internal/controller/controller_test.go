@@ -0,0 +1,305 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+// fakeBackend is an in-memory vmBackend.
+type fakeBackend struct {
+	vms          map[string]*v1alpha1.VirtualMachine
+	reconciled   []*v1alpha1.VirtualMachine
+	destroyed    []string
+	reconcileErr error
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{vms: make(map[string]*v1alpha1.VirtualMachine)}
+}
+
+func (b *fakeBackend) Get(_ context.Context, name string) (*v1alpha1.VirtualMachine, error) {
+	vm, ok := b.vms[name]
+	if !ok {
+		return nil, nil
+	}
+	return vm.DeepCopy(), nil
+}
+
+func (b *fakeBackend) Reconcile(_ context.Context, desired *v1alpha1.VirtualMachine) ([]string, error) {
+	b.reconciled = append(b.reconciled, desired)
+	if b.reconcileErr != nil {
+		return nil, b.reconcileErr
+	}
+	vm := desired.DeepCopy()
+	vm.Status.Phase = v1alpha1.VMPhaseRunning
+	vm.Status.Conditions = []v1alpha1.Condition{{Type: v1alpha1.ConditionReady, Status: v1alpha1.ConditionTrue, Reason: "Running"}}
+	vm.Status.Addresses = []v1alpha1.VMAddress{{Type: "InternalIP", Address: "10.20.30.40"}}
+	b.vms[vm.Name] = vm
+	return []string{"created"}, nil
+}
+
+func (b *fakeBackend) Destroy(_ context.Context, name string) error {
+	b.destroyed = append(b.destroyed, name)
+	delete(b.vms, name)
+	return nil
+}
+
+// testObject returns a VirtualMachine resource for host hv1.
+func testObject() *unstructured.Unstructured {
+	obj := newObject()
+	obj.SetName("web-1")
+	obj.SetNamespace("default")
+	obj.SetUID("uid-1")
+	obj.SetGeneration(3)
+	obj.SetLabels(map[string]string{HostLabel: "hv1"})
+	obj.Object["spec"] = map[string]interface{}{
+		"vcpus":     int64(2),
+		"memoryGiB": int64(4),
+		"bootDisk": map[string]interface{}{
+			"sizeGB": int64(20),
+			"image":  "fedora-43.qcow2",
+		},
+		"networkInterfaces": []interface{}{
+			map[string]interface{}{
+				"ip":      "10.20.30.40/24",
+				"gateway": "10.20.30.1",
+				"bridge":  "br0",
+			},
+		},
+	}
+	return obj
+}
+
+// newTestReconciler returns a Reconciler for host hv1 backed by a fake
+// cluster holding objs.
+func newTestReconciler(t *testing.T, backend *fakeBackend, objs ...client.Object) (*Reconciler, client.Client) {
+	t.Helper()
+	c := fake.NewClientBuilder().WithObjects(objs...).WithStatusSubresource(newObject()).Build()
+	r := NewReconciler(c, "hv1", 0)
+	r.vms = backend
+	return r, c
+}
+
+func reconcileRequest() ctrl.Request {
+	return ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web-1"}}
+}
+
+// getObject fetches the test resource from c.
+func getObject(t *testing.T, c client.Client) *unstructured.Unstructured {
+	t.Helper()
+	obj := newObject()
+	if err := c.Get(context.Background(), reconcileRequest().NamespacedName, obj); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	return obj
+}
+
+func TestReconcile_CreatesVM(t *testing.T) {
+	backend := newFakeBackend()
+	r, c := newTestReconciler(t, backend, testObject())
+
+	result, err := r.Reconcile(context.Background(), reconcileRequest())
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if result.RequeueAfter != DefaultResyncInterval {
+		t.Errorf("RequeueAfter = %v, want %v", result.RequeueAfter, DefaultResyncInterval)
+	}
+
+	if len(backend.reconciled) != 1 {
+		t.Fatalf("reconciled %d VMs, want 1", len(backend.reconciled))
+	}
+	desired := backend.reconciled[0]
+	if desired.Name != "web-1" || desired.Spec.VCPUs != 2 || desired.Spec.MemoryGiB != 4 {
+		t.Errorf("desired VM = %+v", desired)
+	}
+	if desired.Annotations[v1alpha1.AnnotationResourceUID] != "uid-1" {
+		t.Errorf("desired VM annotations = %v, want resource UID", desired.Annotations)
+	}
+	if desired.Generation != 0 || desired.ResourceVersion != "" {
+		t.Error("expected Kubernetes-managed metadata to be dropped")
+	}
+
+	obj := getObject(t, c)
+	if got := obj.GetFinalizers(); len(got) != 1 || got[0] != Finalizer {
+		t.Errorf("finalizers = %v, want [%s]", got, Finalizer)
+	}
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	if phase != string(v1alpha1.VMPhaseRunning) {
+		t.Errorf("status.phase = %q, want Running", phase)
+	}
+	observed, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if observed != 3 {
+		t.Errorf("status.observedGeneration = %d, want 3", observed)
+	}
+}
+
+func TestReconcile_UnchangedStatusNotRewritten(t *testing.T) {
+	backend := newFakeBackend()
+	r, c := newTestReconciler(t, backend, testObject())
+
+	if _, err := r.Reconcile(context.Background(), reconcileRequest()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	before := getObject(t, c).GetResourceVersion()
+
+	if _, err := r.Reconcile(context.Background(), reconcileRequest()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if after := getObject(t, c).GetResourceVersion(); after != before {
+		t.Errorf("resourceVersion changed from %s to %s, want status left alone", before, after)
+	}
+}
+
+func TestReconcile_OtherHost(t *testing.T) {
+	backend := newFakeBackend()
+	obj := testObject()
+	obj.SetLabels(map[string]string{HostLabel: "hv2"})
+	r, _ := newTestReconciler(t, backend, obj)
+
+	if _, err := r.Reconcile(context.Background(), reconcileRequest()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(backend.reconciled) != 0 {
+		t.Error("expected a resource of another host to be ignored")
+	}
+}
+
+func TestReconcile_RefusesUnownedVM(t *testing.T) {
+	backend := newFakeBackend()
+	backend.vms["web-1"] = v1alpha1.NewVirtualMachine("web-1")
+	r, c := newTestReconciler(t, backend, testObject())
+
+	_, err := r.Reconcile(context.Background(), reconcileRequest())
+	if err == nil || !strings.Contains(err.Error(), "was not created for this resource") {
+		t.Fatalf("Reconcile() error = %v, want unowned VM error", err)
+	}
+	if len(backend.reconciled) != 0 {
+		t.Error("expected an unowned VM to be left alone")
+	}
+
+	phase, _, _ := unstructured.NestedString(getObject(t, c).Object, "status", "phase")
+	if phase != string(v1alpha1.VMPhaseFailed) {
+		t.Errorf("status.phase = %q, want Failed", phase)
+	}
+}
+
+func TestReconcile_InvalidSpec(t *testing.T) {
+	backend := newFakeBackend()
+	obj := testObject()
+	obj.Object["spec"].(map[string]interface{})["vcpus"] = int64(0)
+	r, c := newTestReconciler(t, backend, obj)
+
+	// Invalid specs are not retried until the resource changes
+	result, err := r.Reconcile(context.Background(), reconcileRequest())
+	if err != nil || result.RequeueAfter != 0 {
+		t.Fatalf("Reconcile() = (%+v, %v), want no requeue", result, err)
+	}
+	if len(backend.reconciled) != 0 {
+		t.Error("expected an invalid spec not to be reconciled")
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(getObject(t, c).Object, "status", "conditions")
+	if len(conditions) != 1 {
+		t.Fatalf("status.conditions = %v, want a Ready condition", conditions)
+	}
+	if msg := conditions[0].(map[string]interface{})["message"]; !strings.Contains(msg.(string), "vcpus") {
+		t.Errorf("condition message = %q, want validation error", msg)
+	}
+}
+
+func TestReconcile_RejectsUserDataFile(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "shadow")
+	if err := os.WriteFile(secret, []byte("root:$6$hash\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	backend := newFakeBackend()
+	obj := testObject()
+	obj.Object["spec"].(map[string]interface{})["cloudInit"] = map[string]interface{}{"userDataFile": secret}
+	r, c := newTestReconciler(t, backend, obj)
+
+	if _, err := r.Reconcile(context.Background(), reconcileRequest()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(backend.reconciled) != 0 {
+		t.Error("expected a spec referring to a host file not to be reconciled")
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(getObject(t, c).Object, "status", "conditions")
+	if len(conditions) != 1 {
+		t.Fatalf("status.conditions = %v, want a Ready condition", conditions)
+	}
+	msg := conditions[0].(map[string]interface{})["message"].(string)
+	if !strings.Contains(msg, "userDataFile") || strings.Contains(msg, "root:") {
+		t.Errorf("condition message = %q, want userDataFile rejected without the file content", msg)
+	}
+}
+
+func TestReconcile_ReconcileError(t *testing.T) {
+	backend := newFakeBackend()
+	backend.reconcileErr = errors.New("image not found")
+	r, c := newTestReconciler(t, backend, testObject())
+
+	if _, err := r.Reconcile(context.Background(), reconcileRequest()); err == nil {
+		t.Fatal("expected reconcile error to be returned for a retry")
+	}
+	phase, _, _ := unstructured.NestedString(getObject(t, c).Object, "status", "phase")
+	if phase != string(v1alpha1.VMPhaseFailed) {
+		t.Errorf("status.phase = %q, want Failed", phase)
+	}
+}
+
+func TestReconcile_DeletionDestroysVM(t *testing.T) {
+	backend := newFakeBackend()
+	r, c := newTestReconciler(t, backend, testObject())
+	ctx := context.Background()
+
+	if _, err := r.Reconcile(ctx, reconcileRequest()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	// The finalizer keeps the resource until the VM is destroyed
+	if err := c.Delete(ctx, getObject(t, c)); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := r.Reconcile(ctx, reconcileRequest()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if len(backend.destroyed) != 1 || backend.destroyed[0] != "web-1" {
+		t.Errorf("destroyed = %v, want [web-1]", backend.destroyed)
+	}
+	if err := c.Get(ctx, reconcileRequest().NamespacedName, newObject()); err == nil {
+		t.Error("expected the resource to be gone once the finalizer was removed")
+	}
+}
+
+func TestReconcile_DeletionKeepsUnownedVM(t *testing.T) {
+	backend := newFakeBackend()
+	obj := testObject()
+	obj.SetFinalizers([]string{Finalizer})
+	r, c := newTestReconciler(t, backend, obj)
+	ctx := context.Background()
+
+	backend.vms["web-1"] = v1alpha1.NewVirtualMachine("web-1")
+	if err := c.Delete(ctx, getObject(t, c)); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := r.Reconcile(ctx, reconcileRequest()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(backend.destroyed) != 0 {
+		t.Errorf("destroyed = %v, want an unowned VM kept", backend.destroyed)
+	}
+}
@@ -0,0 +1,43 @@
+// Package doctor inspects the local hypervisor host for problems that would
+// make VMs fail to start, reporting each finding with remediation guidance.
+package doctor
+
+// Status is the outcome of a single check.
+type Status string
+
+const (
+	// StatusPass means the check found no problem.
+	StatusPass Status = "pass"
+
+	// StatusWarn means the check found something that may cause problems.
+	StatusWarn Status = "warn"
+
+	// StatusFail means the check found a problem that will cause failures.
+	StatusFail Status = "fail"
+)
+
+// Result is the outcome of a check.
+type Result struct {
+	// Name identifies what was checked.
+	Name string `json:"name" yaml:"name"`
+
+	// Status is the outcome of the check.
+	Status Status `json:"status" yaml:"status"`
+
+	// Message describes what was found.
+	Message string `json:"message" yaml:"message"`
+
+	// Remediation explains how to fix a warning or failure. Empty when the
+	// check passed.
+	Remediation string `json:"remediation,omitempty" yaml:"remediation,omitempty"`
+}
+
+// Failed reports whether any of results failed.
+func Failed(results []Result) bool {
+	for _, r := range results {
+		if r.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
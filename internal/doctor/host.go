@@ -0,0 +1,447 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/digitalocean/go-libvirt"
+	"libvirt.org/go/libvirtxml"
+
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// hostRoot is where the host's root filesystem is mounted.
+const hostRoot = "/"
+
+// DefaultMinFreeGB is the free space of a pool below which CheckHost warns.
+const DefaultMinFreeGB = 20
+
+// HostOptions configures CheckHost.
+type HostOptions struct {
+	// Pools are the storage pools to check. Defaults to foundry's default
+	// pools.
+	Pools []string
+
+	// Bridges are checked in addition to the bridges of the defined domains.
+	Bridges []string
+
+	// MinFreeGB is the free space of a pool below which a warning is
+	// reported. Defaults to DefaultMinFreeGB.
+	MinFreeGB uint64
+}
+
+// LibvirtClient is the subset of the libvirt API the host checks use to
+// find the bridges of the defined domains.
+type LibvirtClient interface {
+	ConnectListAllDomains(NeedResults int32, Flags libvirt.ConnectListAllDomainsFlags) (rDomains []libvirt.Domain, rRet uint32, err error)
+	DomainGetXMLDesc(Dom libvirt.Domain, Flags libvirt.DomainXMLFlags) (rXML string, err error)
+}
+
+// poolInspector looks up storage pools.
+type poolInspector interface {
+	GetPoolInfo(ctx context.Context, name string) (*storage.PoolInfo, error)
+}
+
+// qemuUser is the account QEMU processes run as.
+type qemuUser struct {
+	name string
+	uid  int
+	gids []int
+}
+
+// lookupQemuUser resolves a user name to a qemuUser. It is a variable so
+// tests can resolve users that do not exist on the test host.
+var lookupQemuUser = func(name string) (*qemuUser, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid %q of user %s", u.Uid, name)
+	}
+	groups, err := u.GroupIds()
+	if err != nil {
+		groups = []string{u.Gid}
+	}
+	qu := &qemuUser{name: name, uid: uid}
+	for _, group := range groups {
+		if gid, err := strconv.Atoi(group); err == nil {
+			qu.gids = append(qu.gids, gid)
+		}
+	}
+	return qu, nil
+}
+
+// CheckHost checks that the local host can run VMs: libvirt is reachable,
+// KVM is available, the storage pools are running, writable, reachable by
+// the QEMU user and have free space, and the bridges VMs attach to exist.
+// Nested virtualization is reported too.
+func CheckHost(ctx context.Context, opts HostOptions) []Result {
+	client, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return checkHostWithDeps(ctx, hostRoot, opts, nil, nil, err)
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			logging.FromContext(ctx).Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	lv := client.Libvirt()
+	return checkHostWithDeps(ctx, hostRoot, opts, lv, storage.NewManager(lv), nil)
+}
+
+// checkHostWithDeps runs the host checks against the filesystem mounted at
+// root. connErr is the error connecting to libvirt; the checks that need
+// libvirt are skipped if it is set.
+func checkHostWithDeps(ctx context.Context, root string, opts HostOptions, lv LibvirtClient, pools poolInspector, connErr error) []Result {
+	if len(opts.Pools) == 0 {
+		opts.Pools = []string{storage.ImagesPool(), storage.VMsPool()}
+	}
+	if opts.MinFreeGB == 0 {
+		opts.MinFreeGB = DefaultMinFreeGB
+	}
+
+	results := []Result{
+		checkLibvirt(connErr),
+		checkKVM(root),
+		checkNestedVirt(root),
+	}
+
+	bridges := make(map[string][]string)
+	for _, bridge := range opts.Bridges {
+		bridges[bridge] = nil
+	}
+
+	if connErr == nil {
+		qemu, result := resolveQemuUser(root)
+		results = append(results, result)
+		for _, pool := range opts.Pools {
+			results = append(results, checkPool(ctx, root, pools, pool, opts.MinFreeGB, qemu)...)
+		}
+
+		if err := addDomainBridges(lv, bridges); err != nil {
+			results = append(results, Result{
+				Name:    "bridges",
+				Status:  StatusWarn,
+				Message: fmt.Sprintf("failed to read the bridges of the defined domains: %v", err),
+			})
+		}
+	}
+
+	names := make([]string, 0, len(bridges))
+	for name := range bridges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		results = append(results, checkBridge(root, name, bridges[name]))
+	}
+	return results
+}
+
+// checkLibvirt reports whether the libvirt daemon could be reached.
+func checkLibvirt(connErr error) Result {
+	result := Result{Name: "libvirt"}
+	if connErr != nil {
+		result.Status = StatusFail
+		result.Message = connErr.Error()
+		result.Remediation = "install libvirt and start the daemon, e.g. 'systemctl enable --now libvirtd' " +
+			"(or virtqemud.socket), and run foundry as root or a member of the libvirt group"
+		return result
+	}
+	result.Status = StatusPass
+	result.Message = "reachable"
+	return result
+}
+
+// checkKVM checks that /dev/kvm exists and can be opened.
+func checkKVM(root string) Result {
+	result := Result{Name: "KVM"}
+
+	path := filepath.Join(root, "dev", "kvm")
+	if _, err := os.Stat(path); err != nil {
+		result.Status = StatusFail
+		result.Message = "/dev/kvm does not exist"
+		result.Remediation = "enable VT-x (Intel) or AMD-V (AMD) in the firmware settings and load the kvm_intel " +
+			"or kvm_amd module; inside a VM, enable nested virtualization on its host"
+		return result
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		result.Status = StatusWarn
+		result.Message = fmt.Sprintf("/dev/kvm is not accessible: %v", err)
+		result.Remediation = "check that /dev/kvm is owned by the kvm group with mode 0660 and that the QEMU user is in it"
+		return result
+	}
+	_ = f.Close()
+
+	result.Status = StatusPass
+	result.Message = "/dev/kvm is available"
+	return result
+}
+
+// checkNestedVirt reports whether the KVM module allows VMs to run VMs
+// themselves. Nested virtualization is optional, so it is only a warning.
+func checkNestedVirt(root string) Result {
+	result := Result{Name: "nested virtualization"}
+
+	for _, module := range []string{"kvm_intel", "kvm_amd"} {
+		data, err := os.ReadFile(filepath.Join(root, "sys", "module", module, "parameters", "nested"))
+		if err != nil {
+			continue
+		}
+		switch strings.TrimSpace(string(data)) {
+		case "Y", "y", "1":
+			result.Status = StatusPass
+			result.Message = fmt.Sprintf("enabled (%s)", module)
+		default:
+			result.Status = StatusWarn
+			result.Message = fmt.Sprintf("disabled (%s); VMs cannot run VMs themselves", module)
+			result.Remediation = fmt.Sprintf("add 'options %s nested=1' to /etc/modprobe.d/kvm.conf and reload the module "+
+				"while no VMs run (or reboot)", module)
+		}
+		return result
+	}
+
+	result.Status = StatusWarn
+	result.Message = "neither kvm_intel nor kvm_amd is loaded"
+	return result
+}
+
+// qemuConfUserPattern matches the user setting of qemu.conf.
+var qemuConfUserPattern = regexp.MustCompile(`(?m)^\s*user\s*=\s*"([^"]*)"`)
+
+// resolveQemuUser finds the user QEMU runs as: the user set in
+// /etc/libvirt/qemu.conf, or the distribution default (qemu on Fedora and
+// RHEL, libvirt-qemu on Debian and Ubuntu). A nil user means the access
+// checks cannot be run.
+func resolveQemuUser(root string) (*qemuUser, Result) {
+	result := Result{Name: "QEMU user"}
+
+	candidates := []string{"qemu", "libvirt-qemu"}
+	if data, err := os.ReadFile(filepath.Join(root, "etc", "libvirt", "qemu.conf")); err == nil {
+		if m := qemuConfUserPattern.FindSubmatch(data); m != nil {
+			candidates = []string{strings.TrimPrefix(string(m[1]), "+")}
+		}
+	}
+
+	for _, name := range candidates {
+		if name == "root" || name == "0" {
+			result.Status = StatusPass
+			result.Message = "QEMU runs as root"
+			return nil, result
+		}
+		qu, err := lookupQemuUser(name)
+		if err != nil {
+			continue
+		}
+		result.Status = StatusPass
+		result.Message = fmt.Sprintf("QEMU runs as %s (uid %d)", qu.name, qu.uid)
+		return qu, result
+	}
+
+	result.Status = StatusWarn
+	result.Message = fmt.Sprintf("none of the users QEMU may run as exists (%s)", strings.Join(candidates, ", "))
+	result.Remediation = "set user in /etc/libvirt/qemu.conf to the account QEMU should run as"
+	return nil, result
+}
+
+// checkPool checks that a storage pool is running, that its directory is
+// writable and can be entered by the QEMU user, and that it has free space.
+func checkPool(ctx context.Context, root string, pools poolInspector, name string, minFreeGB uint64, qemu *qemuUser) []Result {
+	result := Result{Name: "pool " + name}
+
+	info, err := pools.GetPoolInfo(ctx, name)
+	if err != nil {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("pool is not defined: %v", err)
+		result.Remediation = fmt.Sprintf("create it with 'foundry pool create %s ...'", name)
+		if storage.IsDefaultPool(name) {
+			result.Status = StatusWarn
+			result.Message = "pool is not defined yet"
+			result.Remediation = "foundry defines it on first use, e.g. by 'foundry image import' or 'foundry create'"
+		}
+		return []Result{result}
+	}
+
+	if info.State != "running" {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("pool is %s", info.State)
+		result.Remediation = fmt.Sprintf("start it with 'virsh pool-start %s' and 'virsh pool-autostart %s'", name, name)
+		return []Result{result}
+	}
+
+	// Only directory-like pools hold volumes as files in their path
+	var path string
+	switch info.Type {
+	case storage.PoolTypeDir, storage.PoolTypeFS, storage.PoolTypeNFS:
+		path = info.Path
+	}
+
+	results := []Result{checkPoolWritable(root, result.Name, path)}
+	if qemu != nil && path != "" {
+		results = append(results, checkQemuAccess(root, result.Name, path, qemu))
+	}
+	return append(results, checkPoolSpace(result.Name, info, minFreeGB))
+}
+
+// checkPoolWritable checks that a file can be created in the pool directory.
+func checkPoolWritable(root, name, path string) Result {
+	result := Result{Name: name, Status: StatusPass, Message: "running"}
+	if path == "" {
+		return result
+	}
+
+	f, err := os.CreateTemp(filepath.Join(root, path), ".foundry-doctor-*")
+	if err != nil {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("%s is not writable: %v", path, errors.Unwrap(err))
+		result.Remediation = fmt.Sprintf("check the ownership and permissions of %s, and its SELinux label ('restorecon -R %s')", path, path)
+		return result
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+
+	result.Message = fmt.Sprintf("running, %s is writable", path)
+	return result
+}
+
+// checkQemuAccess checks that the QEMU user can enter every directory on the
+// way to the pool directory, which it needs to open the VMs' volumes.
+func checkQemuAccess(root, name, path string, qemu *qemuUser) Result {
+	result := Result{Name: name}
+
+	for dir := path; ; dir = filepath.Dir(dir) {
+		info, err := os.Stat(filepath.Join(root, dir))
+		if err != nil {
+			result.Status = StatusFail
+			result.Message = fmt.Sprintf("failed to check access of %s: %v", dir, errors.Unwrap(err))
+			return result
+		}
+		if !canSearch(info, qemu) {
+			result.Status = StatusFail
+			result.Message = fmt.Sprintf("QEMU user %s cannot enter %s", qemu.name, dir)
+			result.Remediation = fmt.Sprintf("allow it to, e.g. with 'chmod o+x %s' or 'setfacl -m u:%s:x %s'", dir, qemu.name, dir)
+			return result
+		}
+		if dir == "/" || dir == "." {
+			break
+		}
+	}
+
+	result.Status = StatusPass
+	result.Message = fmt.Sprintf("QEMU user %s can reach %s", qemu.name, path)
+	return result
+}
+
+// canSearch reports whether the mode bits of a directory let u enter it.
+// ACLs are not considered.
+func canSearch(info os.FileInfo, u *qemuUser) bool {
+	uid, gid, ok := fileOwner(info)
+	if !ok {
+		return true
+	}
+	mode := info.Mode().Perm()
+	if uid == u.uid {
+		return mode&0o100 != 0
+	}
+	for _, g := range u.gids {
+		if g == gid {
+			return mode&0o010 != 0
+		}
+	}
+	return mode&0o001 != 0
+}
+
+// checkPoolSpace warns when a pool has less than minFreeGB of free space,
+// and fails when it is full.
+func checkPoolSpace(name string, info *storage.PoolInfo, minFreeGB uint64) Result {
+	result := Result{Name: name, Status: StatusPass}
+	result.Message = fmt.Sprintf("%.1f GB free of %.1f GB", info.AvailableGB(), info.CapacityGB())
+
+	switch {
+	case info.Available == 0:
+		result.Status = StatusFail
+		result.Message = "no free space"
+	case info.AvailableGB() < float64(minFreeGB):
+		result.Status = StatusWarn
+		result.Message = fmt.Sprintf("only %s", result.Message)
+	default:
+		return result
+	}
+	result.Remediation = "free space with 'foundry cleanup' and 'foundry image delete', or grow the filesystem"
+	return result
+}
+
+// addDomainBridges adds the bridges the interfaces of the defined domains
+// attach to, with the names of the domains using them.
+func addDomainBridges(lv LibvirtClient, bridges map[string][]string) error {
+	domains, _, err := lv.ConnectListAllDomains(1, 0)
+	if err != nil {
+		return fmt.Errorf("failed to list domains: %w", err)
+	}
+	for _, dom := range domains {
+		xmlDesc, err := lv.DomainGetXMLDesc(dom, libvirt.DomainXMLInactive)
+		if err != nil {
+			return fmt.Errorf("failed to get XML of domain %s: %w", dom.Name, err)
+		}
+		var def libvirtxml.Domain
+		if err := def.Unmarshal(xmlDesc); err != nil {
+			return fmt.Errorf("failed to parse XML of domain %s: %w", dom.Name, err)
+		}
+		if def.Devices == nil {
+			continue
+		}
+		for _, iface := range def.Devices.Interfaces {
+			if iface.Source == nil || iface.Source.Bridge == nil || iface.Source.Bridge.Bridge == "" {
+				continue
+			}
+			bridge := iface.Source.Bridge.Bridge
+			if users := bridges[bridge]; len(users) == 0 || users[len(users)-1] != dom.Name {
+				bridges[bridge] = append(users, dom.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// checkBridge checks that a network interface exists and is a bridge.
+func checkBridge(root, name string, domains []string) Result {
+	result := Result{Name: "bridge " + name}
+	usedBy := ""
+	if len(domains) > 0 {
+		usedBy = fmt.Sprintf(" (used by %s)", strings.Join(domains, ", "))
+	}
+
+	ifacePath := filepath.Join(root, "sys", "class", "net", name)
+	if _, err := os.Stat(ifacePath); err != nil {
+		result.Status = StatusFail
+		result.Message = "bridge does not exist" + usedBy
+		result.Remediation = fmt.Sprintf("create it, e.g. 'nmcli connection add type bridge ifname %s con-name %s' "+
+			"and add the uplink as a port, or change the VMs to an existing bridge", name, name)
+		return result
+	}
+	if _, err := os.Stat(filepath.Join(ifacePath, "bridge")); err != nil {
+		result.Status = StatusFail
+		result.Message = "interface exists but is not a bridge" + usedBy
+		result.Remediation = "attach VMs to a Linux bridge that has this interface as a port"
+		return result
+	}
+
+	result.Status = StatusPass
+	result.Message = "exists" + usedBy
+	return result
+}
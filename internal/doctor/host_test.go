@@ -0,0 +1,217 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// fakeHostLibvirt returns domains with one bridged interface each.
+type fakeHostLibvirt struct {
+	bridges map[string]string // domain name -> bridge
+}
+
+func (f *fakeHostLibvirt) ConnectListAllDomains(int32, libvirt.ConnectListAllDomainsFlags) ([]libvirt.Domain, uint32, error) {
+	var domains []libvirt.Domain
+	for name := range f.bridges {
+		domains = append(domains, libvirt.Domain{Name: name})
+	}
+	return domains, uint32(len(domains)), nil
+}
+
+func (f *fakeHostLibvirt) DomainGetXMLDesc(dom libvirt.Domain, _ libvirt.DomainXMLFlags) (string, error) {
+	return fmt.Sprintf(`<domain type="kvm"><name>%s</name><devices>
+<interface type="bridge"><source bridge="%s"/></interface>
+</devices></domain>`, dom.Name, f.bridges[dom.Name]), nil
+}
+
+// fakePools returns pool infos by name.
+type fakePools map[string]*storage.PoolInfo
+
+func (f fakePools) GetPoolInfo(_ context.Context, name string) (*storage.PoolInfo, error) {
+	info, ok := f[name]
+	if !ok {
+		return nil, errors.New("pool not found")
+	}
+	return info, nil
+}
+
+// newFakeHost builds a host filesystem with KVM, nested virtualization, a
+// br0 bridge, an eth0 interface and the default pool directories.
+func newFakeHost(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, dir := range []string{
+		"dev",
+		"sys/module/kvm_intel/parameters",
+		"sys/class/net/br0/bridge",
+		"sys/class/net/eth0",
+		"etc/libvirt",
+		storage.DefaultImagesPath,
+		storage.DefaultVMsPath,
+	} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"dev/kvm":                                "",
+		"sys/module/kvm_intel/parameters/nested": "Y\n",
+		"etc/libvirt/qemu.conf":                  "#user = \"root\"\nuser = \"qemu\"\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prev := lookupQemuUser
+	lookupQemuUser = func(name string) (*qemuUser, error) {
+		if name != "qemu" {
+			return nil, fmt.Errorf("unknown user %s", name)
+		}
+		return &qemuUser{name: "qemu", uid: 107, gids: []int{107}}, nil
+	}
+	t.Cleanup(func() { lookupQemuUser = prev })
+	return root
+}
+
+// defaultPools returns running default pools with free GB of free space.
+func defaultPools(free uint64) fakePools {
+	return fakePools{
+		storage.DefaultImagesPool: {Name: storage.DefaultImagesPool, Type: storage.PoolTypeDir, Path: storage.DefaultImagesPath,
+			State: "running", Capacity: 500 << 30, Available: free << 30},
+		storage.DefaultVMsPool: {Name: storage.DefaultVMsPool, Type: storage.PoolTypeDir, Path: storage.DefaultVMsPath,
+			State: "running", Capacity: 500 << 30, Available: free << 30},
+	}
+}
+
+// findResults returns the results named name.
+func findResults(results []Result, name string) []Result {
+	var found []Result
+	for _, r := range results {
+		if r.Name == name {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+func TestCheckHost_Healthy(t *testing.T) {
+	root := newFakeHost(t)
+	lv := &fakeHostLibvirt{bridges: map[string]string{"web-1": "br0"}}
+
+	results := checkHostWithDeps(context.Background(), root, HostOptions{}, lv, defaultPools(100), nil)
+	for _, r := range results {
+		if r.Status != StatusPass {
+			t.Errorf("%s: %s %s", r.Name, r.Status, r.Message)
+		}
+	}
+
+	for _, name := range []string{"libvirt", "KVM", "nested virtualization", "QEMU user", "bridge br0"} {
+		if len(findResults(results, name)) != 1 {
+			t.Errorf("missing result %q in %+v", name, results)
+		}
+	}
+	if got := findResults(results, "pool foundry-vms"); len(got) != 3 {
+		t.Errorf("pool foundry-vms results = %+v, want writable, access and space", got)
+	}
+	if got := findResults(results, "bridge br0")[0].Message; !strings.Contains(got, "used by web-1") {
+		t.Errorf("bridge message = %q, want the domains using it", got)
+	}
+}
+
+func TestCheckHost_Problems(t *testing.T) {
+	root := newFakeHost(t)
+	if err := os.WriteFile(filepath.Join(root, "sys/module/kvm_intel/parameters/nested"), []byte("N\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "dev/kvm")); err != nil {
+		t.Fatal(err)
+	}
+	// The QEMU user cannot enter the VMs pool directory
+	if err := os.Chmod(filepath.Join(root, storage.DefaultVMsPath), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	pools := defaultPools(5)
+	pools[storage.DefaultImagesPool].State = "inactive"
+	lv := &fakeHostLibvirt{bridges: map[string]string{"web-1": "br1", "web-2": "eth0"}}
+
+	results := checkHostWithDeps(context.Background(), root, HostOptions{Bridges: []string{"br0"}}, lv, pools, nil)
+
+	tests := []struct {
+		name    string
+		status  Status
+		message string
+	}{
+		{"KVM", StatusFail, "/dev/kvm does not exist"},
+		{"nested virtualization", StatusWarn, "disabled (kvm_intel)"},
+		{"pool foundry-images", StatusFail, "pool is inactive"},
+		{"bridge br0", StatusPass, "exists"},
+		{"bridge br1", StatusFail, "does not exist (used by web-1)"},
+		{"bridge eth0", StatusFail, "is not a bridge"},
+	}
+	for _, tt := range tests {
+		got := findResults(results, tt.name)
+		if len(got) != 1 || got[0].Status != tt.status || !strings.Contains(got[0].Message, tt.message) {
+			t.Errorf("%s = %+v, want %s %q", tt.name, got, tt.status, tt.message)
+		}
+	}
+
+	var access, space *Result
+	for _, r := range findResults(results, "pool foundry-vms") {
+		switch {
+		case strings.Contains(r.Message, "QEMU user"):
+			access = &r
+		case strings.Contains(r.Message, "GB free"):
+			space = &r
+		}
+	}
+	if os.Getuid() != 107 && (access == nil || access.Status != StatusFail || !strings.Contains(access.Message, "cannot enter "+storage.DefaultVMsPath)) {
+		t.Errorf("access = %+v, want the pool directory to be unreachable", access)
+	}
+	if space == nil || space.Status != StatusWarn || !strings.Contains(space.Message, "only 5.0 GB free") {
+		t.Errorf("space = %+v, want a low space warning", space)
+	}
+	if !Failed(results) {
+		t.Error("Failed() = false, want true")
+	}
+}
+
+func TestCheckHost_LibvirtUnreachable(t *testing.T) {
+	root := newFakeHost(t)
+
+	results := checkHostWithDeps(context.Background(), root, HostOptions{Bridges: []string{"br0"}}, nil, nil, errors.New("connection refused"))
+
+	if got := findResults(results, "libvirt"); len(got) != 1 || got[0].Status != StatusFail || got[0].Remediation == "" {
+		t.Errorf("libvirt = %+v, want a failure with remediation", got)
+	}
+	if len(findResults(results, "pool foundry-vms")) != 0 {
+		t.Error("pools are checked without libvirt")
+	}
+	if got := findResults(results, "bridge br0"); len(got) != 1 || got[0].Status != StatusPass {
+		t.Errorf("bridge br0 = %+v, want it checked without libvirt", got)
+	}
+}
+
+func TestCheckPool_NotDefined(t *testing.T) {
+	root := newFakeHost(t)
+
+	results := checkPool(context.Background(), root, fakePools{}, storage.DefaultVMsPool, DefaultMinFreeGB, nil)
+	if len(results) != 1 || results[0].Status != StatusWarn {
+		t.Errorf("default pool = %+v, want a warning", results)
+	}
+	results = checkPool(context.Background(), root, fakePools{}, "fast", DefaultMinFreeGB, nil)
+	if len(results) != 1 || results[0].Status != StatusFail {
+		t.Errorf("other pool = %+v, want a failure", results)
+	}
+}
@@ -0,0 +1,215 @@
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// sysfsRoot is where sysfs is mounted.
+const sysfsRoot = "/sys"
+
+// pciAddressPattern matches a PCI address with an optional domain, e.g.
+// "0000:01:00.0" or "01:00.0".
+var pciAddressPattern = regexp.MustCompile(`^([0-9a-f]{4}:)?[0-9a-f]{2}:[0-9a-f]{2}\.[0-7]$`)
+
+// assignableDrivers are the drivers a device may be bound to while another
+// device in its IOMMU group is assigned to a VM.
+var assignableDrivers = map[string]bool{
+	"vfio-pci": true,
+	"pci-stub": true,
+}
+
+// pciClassBridge is the PCI class code prefix of PCI-to-PCI bridges, which
+// may share an IOMMU group with assigned devices while bound to a host driver.
+const pciClassBridge = "0x0604"
+
+// NormalizePCIAddress returns address in the full "dddd:bb:ss.f" form used by
+// sysfs, adding the default domain if it is missing.
+func NormalizePCIAddress(address string) (string, error) {
+	address = strings.ToLower(strings.TrimSpace(address))
+	if !pciAddressPattern.MatchString(address) {
+		return "", fmt.Errorf("invalid PCI address %q (expected e.g. 0000:01:00.0)", address)
+	}
+	if strings.Count(address, ":") == 1 {
+		address = "0000:" + address
+	}
+	return address, nil
+}
+
+// CheckPassthrough checks that the host can assign the given PCI devices to
+// VMs: the IOMMU is enabled, vfio-pci is available, and every device's IOMMU
+// group contains only devices that are safe to detach from the host.
+//
+// Host-wide checks are always run; devices may be empty.
+func CheckPassthrough(devices []string) []Result {
+	return checkPassthroughWithRoot(sysfsRoot, devices)
+}
+
+// checkPassthroughWithRoot runs the passthrough checks against a sysfs tree
+// mounted at root.
+func checkPassthroughWithRoot(root string, devices []string) []Result {
+	results := []Result{
+		checkIOMMUEnabled(root),
+		checkVFIODriver(root),
+	}
+	for _, device := range devices {
+		results = append(results, checkDevice(root, device)...)
+	}
+	return results
+}
+
+// checkIOMMUEnabled checks that the kernel created IOMMU groups, which it
+// only does when an IOMMU is present and enabled.
+func checkIOMMUEnabled(root string) Result {
+	result := Result{Name: "IOMMU"}
+
+	groups, err := os.ReadDir(filepath.Join(root, "kernel", "iommu_groups"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("failed to read IOMMU groups: %v", err)
+		return result
+	}
+	if len(groups) == 0 {
+		result.Status = StatusFail
+		result.Message = "IOMMU is not enabled"
+		result.Remediation = "enable VT-d (Intel) or AMD-Vi (AMD) in the firmware settings, add intel_iommu=on " +
+			"(or amd_iommu=on) and iommu=pt to the kernel command line, and reboot"
+		return result
+	}
+
+	result.Status = StatusPass
+	result.Message = fmt.Sprintf("enabled (%d IOMMU groups)", len(groups))
+	return result
+}
+
+// checkVFIODriver checks that the vfio-pci driver is loaded.
+func checkVFIODriver(root string) Result {
+	result := Result{Name: "vfio-pci driver"}
+
+	if _, err := os.Stat(filepath.Join(root, "bus", "pci", "drivers", "vfio-pci")); err != nil {
+		result.Status = StatusFail
+		result.Message = "vfio-pci driver is not loaded"
+		result.Remediation = "run 'modprobe vfio-pci' and add vfio-pci to /etc/modules-load.d/ to load it at boot"
+		return result
+	}
+
+	result.Status = StatusPass
+	result.Message = "loaded"
+	return result
+}
+
+// checkDevice checks a single device: that it exists, that its IOMMU group is
+// viable for assignment, and which NUMA node it is attached to.
+func checkDevice(root, device string) []Result {
+	address, err := NormalizePCIAddress(device)
+	if err != nil {
+		return []Result{{Name: "device " + device, Status: StatusFail, Message: err.Error()}}
+	}
+	name := "device " + address
+
+	devicePath := filepath.Join(root, "bus", "pci", "devices", address)
+	if _, err := os.Stat(devicePath); err != nil {
+		return []Result{{
+			Name:        name,
+			Status:      StatusFail,
+			Message:     "device not found",
+			Remediation: "check the address with 'lspci -D'",
+		}}
+	}
+
+	groupLink, err := os.Readlink(filepath.Join(devicePath, "iommu_group"))
+	if err != nil {
+		return []Result{{
+			Name:        name,
+			Status:      StatusFail,
+			Message:     "device is not in an IOMMU group",
+			Remediation: "enable the IOMMU (see the IOMMU check above)",
+		}}
+	}
+	group := filepath.Base(groupLink)
+
+	return []Result{
+		checkIOMMUGroup(root, name, address, group),
+		checkNUMANode(devicePath, name),
+	}
+}
+
+// checkIOMMUGroup checks that every other device in the IOMMU group is bound
+// to a VFIO-compatible driver, unbound, or a bridge. VFIO only allows a device
+// to be assigned when its whole group is isolated from host drivers.
+func checkIOMMUGroup(root, name, address, group string) Result {
+	result := Result{Name: name}
+
+	members, err := os.ReadDir(filepath.Join(root, "kernel", "iommu_groups", group, "devices"))
+	if err != nil {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("failed to read IOMMU group %s: %v", group, err)
+		return result
+	}
+
+	var blocking []string
+	for _, member := range members {
+		memberPath := filepath.Join(root, "bus", "pci", "devices", member.Name())
+		driver := pciDriver(memberPath)
+		if driver == "" || assignableDrivers[driver] {
+			continue
+		}
+		if member.Name() != address && isPCIBridge(memberPath) {
+			continue
+		}
+		blocking = append(blocking, fmt.Sprintf("%s (%s)", member.Name(), driver))
+	}
+	sort.Strings(blocking)
+
+	if len(blocking) > 0 {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("IOMMU group %s has devices bound to host drivers: %s", group, strings.Join(blocking, ", "))
+		result.Remediation = "bind every device in the group to vfio-pci, e.g. 'driverctl set-override <address> vfio-pci', " +
+			"or move the device to a slot with its own IOMMU group"
+		return result
+	}
+
+	result.Status = StatusPass
+	result.Message = fmt.Sprintf("IOMMU group %s is assignable (%d device(s))", group, len(members))
+	return result
+}
+
+// checkNUMANode reports the NUMA node a device is attached to, so VMs using
+// it can be pinned to the same node.
+func checkNUMANode(devicePath, name string) Result {
+	result := Result{Name: name, Status: StatusPass}
+
+	data, err := os.ReadFile(filepath.Join(devicePath, "numa_node"))
+	node := strings.TrimSpace(string(data))
+	if err != nil || node == "-1" || node == "" {
+		result.Message = "no NUMA affinity"
+		return result
+	}
+
+	result.Message = fmt.Sprintf("attached to NUMA node %s", node)
+	return result
+}
+
+// pciDriver returns the name of the driver bound to the device at devicePath,
+// or "" if none is bound.
+func pciDriver(devicePath string) string {
+	link, err := os.Readlink(filepath.Join(devicePath, "driver"))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(link)
+}
+
+// isPCIBridge reports whether the device at devicePath is a PCI bridge.
+func isPCIBridge(devicePath string) bool {
+	class, err := os.ReadFile(filepath.Join(devicePath, "class"))
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(strings.TrimSpace(string(class)), pciClassBridge)
+}
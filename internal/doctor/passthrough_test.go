@@ -0,0 +1,168 @@
+package doctor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSysfs builds a minimal sysfs tree for passthrough checks.
+type fakeSysfs struct {
+	t    *testing.T
+	root string
+}
+
+func newFakeSysfs(t *testing.T) *fakeSysfs {
+	t.Helper()
+	root := t.TempDir()
+	for _, dir := range []string{"kernel/iommu_groups", "bus/pci/devices", "bus/pci/drivers/vfio-pci"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &fakeSysfs{t: t, root: root}
+}
+
+// addDevice adds a PCI device in an IOMMU group, bound to driver ("" for
+// none).
+func (f *fakeSysfs) addDevice(address, group, driver, class, numaNode string) {
+	f.t.Helper()
+	devicePath := filepath.Join(f.root, "bus/pci/devices", address)
+	groupDevices := filepath.Join(f.root, "kernel/iommu_groups", group, "devices")
+	for _, dir := range []string{devicePath, groupDevices} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+
+	links := map[string]string{
+		filepath.Join(devicePath, "iommu_group"): "../../../../kernel/iommu_groups/" + group,
+		filepath.Join(groupDevices, address):     "../../../../bus/pci/devices/" + address,
+	}
+	if driver != "" {
+		links[filepath.Join(devicePath, "driver")] = "../../../../bus/pci/drivers/" + driver
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+
+	files := map[string]string{"class": class + "\n", "numa_node": numaNode + "\n"}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(devicePath, name), []byte(content), 0o644); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+}
+
+func TestNormalizePCIAddress(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "0000:01:00.0", want: "0000:01:00.0"},
+		{input: "01:00.1", want: "0000:01:00.1"},
+		{input: " 0000:3B:00.0 ", want: "0000:3b:00.0"},
+		{input: "01:00", wantErr: true},
+		{input: "0000:01:00.8", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := NormalizePCIAddress(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizePCIAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizePCIAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPassthrough_AssignableGroup(t *testing.T) {
+	sysfs := newFakeSysfs(t)
+	sysfs.addDevice("0000:01:00.0", "14", "vfio-pci", "0x030000", "1")
+	sysfs.addDevice("0000:01:00.1", "14", "vfio-pci", "0x040300", "1")
+	sysfs.addDevice("0000:00:01.0", "14", "pcieport", pciClassBridge+"00", "1")
+
+	results := checkPassthroughWithRoot(sysfs.root, []string{"01:00.0"})
+
+	if Failed(results) {
+		t.Fatalf("expected all checks to pass, got %+v", results)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %+v", results)
+	}
+	if !strings.Contains(results[2].Message, "IOMMU group 14 is assignable") {
+		t.Errorf("group result = %q", results[2].Message)
+	}
+	if results[3].Message != "attached to NUMA node 1" {
+		t.Errorf("NUMA result = %q", results[3].Message)
+	}
+}
+
+func TestCheckPassthrough_GroupMemberOnHostDriver(t *testing.T) {
+	sysfs := newFakeSysfs(t)
+	sysfs.addDevice("0000:01:00.0", "14", "vfio-pci", "0x030000", "-1")
+	sysfs.addDevice("0000:01:00.1", "14", "snd_hda_intel", "0x040300", "-1")
+
+	results := checkPassthroughWithRoot(sysfs.root, []string{"0000:01:00.0"})
+
+	if !Failed(results) {
+		t.Fatal("expected a failure")
+	}
+	group := results[2]
+	if group.Status != StatusFail || !strings.Contains(group.Message, "0000:01:00.1 (snd_hda_intel)") {
+		t.Errorf("group result = %+v", group)
+	}
+	if group.Remediation == "" {
+		t.Error("expected remediation guidance")
+	}
+	if results[3].Message != "no NUMA affinity" {
+		t.Errorf("NUMA result = %q", results[3].Message)
+	}
+}
+
+func TestCheckPassthrough_DeviceOnHostDriver(t *testing.T) {
+	sysfs := newFakeSysfs(t)
+	sysfs.addDevice("0000:01:00.0", "14", "nvidia", pciClassBridge+"00", "0")
+
+	results := checkPassthroughWithRoot(sysfs.root, []string{"0000:01:00.0"})
+
+	// The device itself is never excused as a bridge
+	if results[2].Status != StatusFail {
+		t.Errorf("expected group check to fail, got %+v", results[2])
+	}
+}
+
+func TestCheckPassthrough_HostNotReady(t *testing.T) {
+	root := t.TempDir()
+
+	results := checkPassthroughWithRoot(root, []string{"0000:01:00.0", "bogus"})
+
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %+v", results)
+	}
+	for _, r := range results {
+		if r.Status != StatusFail {
+			t.Errorf("%s: expected failure, got %+v", r.Name, r)
+		}
+	}
+	if !strings.Contains(results[0].Remediation, "intel_iommu=on") {
+		t.Errorf("IOMMU remediation = %q", results[0].Remediation)
+	}
+	if !strings.Contains(results[1].Remediation, "modprobe vfio-pci") {
+		t.Errorf("vfio remediation = %q", results[1].Remediation)
+	}
+	if results[2].Message != "device not found" {
+		t.Errorf("device result = %+v", results[2])
+	}
+	if !strings.Contains(results[3].Message, "invalid PCI address") {
+		t.Errorf("bogus device result = %+v", results[3])
+	}
+}
@@ -0,0 +1,155 @@
+package explain
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"strings"
+	"sync"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+// sourceDocs holds the documentation of the API types, keyed by Go type name.
+type sourceDocs struct {
+	types map[string]typeDoc
+}
+
+// typeDoc documents a struct type and its fields, keyed by Go field name.
+type typeDoc struct {
+	description string
+	fields      map[string]fieldDoc
+}
+
+// fieldDoc is the documentation of a field, split into prose and markers.
+type fieldDoc struct {
+	description  string
+	optional     bool
+	defaultValue string
+	enum         []string
+	constraints  []string
+}
+
+var (
+	docsOnce   sync.Once
+	cachedDocs *sourceDocs
+	docsErr    error
+)
+
+// loadDocs parses the embedded API sources once.
+func loadDocs() (*sourceDocs, error) {
+	docsOnce.Do(func() {
+		cachedDocs, docsErr = parseDocs(v1alpha1.Sources)
+	})
+	return cachedDocs, docsErr
+}
+
+// parseDocs extracts type and field documentation from the Go files in fsys.
+func parseDocs(fsys fs.FS) (*sourceDocs, error) {
+	docs := &sourceDocs{types: make(map[string]typeDoc)}
+
+	paths, err := fs.Glob(fsys, "*.go")
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	for _, path := range paths {
+		src, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read API source %s: %w", path, err)
+		}
+		file, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse API source %s: %w", path, err)
+		}
+
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				structType, ok := typeSpec.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+
+				doc := gen.Doc
+				if typeSpec.Doc != nil {
+					doc = typeSpec.Doc
+				}
+				td := typeDoc{
+					description: parseComment(doc).description,
+					fields:      make(map[string]fieldDoc),
+				}
+				for _, field := range structType.Fields.List {
+					fd := parseComment(field.Doc)
+					for _, name := range fieldNames(field) {
+						td.fields[name] = fd
+					}
+				}
+				docs.types[typeSpec.Name.Name] = td
+			}
+		}
+	}
+
+	return docs, nil
+}
+
+// fieldNames returns the Go names of a struct field declaration; embedded
+// fields are named after their type.
+func fieldNames(field *ast.Field) []string {
+	if len(field.Names) == 0 {
+		expr := field.Type
+		if star, ok := expr.(*ast.StarExpr); ok {
+			expr = star.X
+		}
+		if ident, ok := expr.(*ast.Ident); ok {
+			return []string{ident.Name}
+		}
+		return nil
+	}
+
+	names := make([]string, 0, len(field.Names))
+	for _, name := range field.Names {
+		names = append(names, name.Name)
+	}
+	return names
+}
+
+// parseComment splits a doc comment into its description and the
+// +optional and +kubebuilder markers understood by explain.
+func parseComment(group *ast.CommentGroup) fieldDoc {
+	var fd fieldDoc
+	if group == nil {
+		return fd
+	}
+
+	var lines []string
+	for _, line := range strings.Split(group.Text(), "\n") {
+		marker, ok := strings.CutPrefix(strings.TrimSpace(line), "+")
+		if !ok {
+			lines = append(lines, line)
+			continue
+		}
+
+		key, value, _ := strings.Cut(marker, "=")
+		switch {
+		case key == "optional":
+			fd.optional = true
+		case key == "kubebuilder:default":
+			fd.defaultValue = value
+		case key == "kubebuilder:validation:Enum":
+			fd.enum = strings.Split(value, ";")
+		case strings.HasPrefix(key, "kubebuilder:validation:"):
+			fd.constraints = append(fd.constraints, strings.TrimPrefix(key, "kubebuilder:validation:")+": "+value)
+		}
+	}
+
+	fd.description = strings.TrimSpace(strings.Join(lines, "\n"))
+	return fd
+}
@@ -0,0 +1,207 @@
+// Package explain documents the fields of the foundry API types, in the style
+// of kubectl explain.
+//
+// Field names and types come from the Go types in api/v1alpha1 by
+// reflection; descriptions, defaults and validation rules come from the doc
+// comments and kubebuilder markers in their embedded sources.
+package explain
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+// Field describes a field of an API type, or the resource itself.
+type Field struct {
+	// Name is the field's JSON name, or the kind for the resource itself.
+	Name string
+
+	// Type is the field's type as written in YAML: string, integer,
+	// boolean, Object, []Object, map[string]string and so on.
+	Type string
+
+	// Description is the field's doc comment without markers.
+	Description string
+
+	// Required is true if the field must be set.
+	Required bool
+
+	// Default is the value used when the field is not set, if any.
+	Default string
+
+	// Enum lists the allowed values, if restricted.
+	Enum []string
+
+	// Constraints are other validation rules, e.g. "Minimum: 1".
+	Constraints []string
+
+	// Fields are the nested fields of Object types.
+	Fields []*Field
+}
+
+// Resource is an API resource that can be explained.
+type Resource struct {
+	// Kind is the resource's kind, e.g. VirtualMachine.
+	Kind string
+
+	// APIVersion is the resource's group and version.
+	APIVersion string
+
+	// Names are the names the resource is looked up by (lowercase kind,
+	// plural and short names).
+	Names []string
+
+	typ reflect.Type
+}
+
+// resources are the explainable resources.
+var resources = []Resource{
+	{
+		Kind:       v1alpha1.VirtualMachineKind,
+		APIVersion: v1alpha1.GroupName + "/" + v1alpha1.Version,
+		Names:      []string{"virtualmachine", "virtualmachines", "vm", "vms"},
+		typ:        reflect.TypeOf(v1alpha1.VirtualMachine{}),
+	},
+	{
+		Kind:       v1alpha1.VirtualMachineStackKind,
+		APIVersion: v1alpha1.GroupName + "/" + v1alpha1.Version,
+		Names:      []string{"virtualmachinestack", "virtualmachinestacks", "stack", "stacks"},
+		typ:        reflect.TypeOf(v1alpha1.VirtualMachineStack{}),
+	},
+}
+
+// jsonMarshaler is implemented by types with a custom (string) encoding,
+// such as Time and Duration.
+var jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// Lookup resolves a path like "vm.spec.bootDisk" to its resource and field.
+// The first element names the resource; the rest are JSON field names. List
+// fields are traversed into their element type.
+func Lookup(path string) (*Resource, *Field, error) {
+	parts := strings.Split(strings.TrimSpace(path), ".")
+	resource, err := findResource(parts[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	docs, err := loadDocs()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	field := &Field{
+		Name:        resource.Kind,
+		Type:        "Object",
+		Description: docs.types[resource.typ.Name()].description,
+		Fields:      structFields(resource.typ, docs),
+	}
+	for i, name := range parts[1:] {
+		child := findField(field.Fields, name)
+		if child == nil {
+			return nil, nil, fmt.Errorf("field %q does not exist in %s", name, strings.Join(parts[:i+1], "."))
+		}
+		field = child
+	}
+
+	return resource, field, nil
+}
+
+// findResource returns the resource called name.
+func findResource(name string) (*Resource, error) {
+	name = strings.ToLower(name)
+	for i := range resources {
+		for _, n := range resources[i].Names {
+			if n == name {
+				return &resources[i], nil
+			}
+		}
+	}
+	var known []string
+	for _, resource := range resources {
+		known = append(known, resource.Names...)
+	}
+	return nil, fmt.Errorf("unknown resource %q (known: %s)", name, strings.Join(known, ", "))
+}
+
+// findField returns the field called name from fields, or nil.
+func findField(fields []*Field, name string) *Field {
+	for _, f := range fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// structFields describes the JSON fields of struct type t, flattening inline
+// embedded structs.
+func structFields(t reflect.Type, docs *sourceDocs) []*Field {
+	var fields []*Field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" && sf.Anonymous {
+			fields = append(fields, structFields(sf.Type, docs)...)
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+
+		doc := docs.types[t.Name()].fields[sf.Name]
+		field := &Field{
+			Name:        name,
+			Description: doc.description,
+			Required:    !doc.optional && !strings.Contains(opts, "omitempty"),
+			Default:     doc.defaultValue,
+			Enum:        doc.enum,
+			Constraints: doc.constraints,
+		}
+		field.Type, field.Fields = describeType(sf.Type, docs)
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// describeType returns the YAML type name of t and, for objects and lists of
+// objects, their fields.
+func describeType(t reflect.Type, docs *sourceDocs) (string, []*Field) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Implements(jsonMarshaler) || reflect.PointerTo(t).Implements(jsonMarshaler) {
+		return "string", nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return "Object", structFields(t, docs)
+	case reflect.Slice, reflect.Array:
+		elem, fields := describeType(t.Elem(), docs)
+		return "[]" + elem, fields
+	case reflect.Map:
+		key, _ := describeType(t.Key(), docs)
+		elem, fields := describeType(t.Elem(), docs)
+		return "map[" + key + "]" + elem, fields
+	case reflect.Bool:
+		return "boolean", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer", nil
+	case reflect.Float32, reflect.Float64:
+		return "number", nil
+	default:
+		return t.Kind().String(), nil
+	}
+}
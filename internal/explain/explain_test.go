@@ -0,0 +1,254 @@
+package explain
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		path         string
+		wantName     string
+		wantType     string
+		wantRequired bool
+		wantDefault  string
+		wantEnum     []string
+		wantDesc     string
+	}{
+		{path: "vm", wantName: "VirtualMachine", wantType: "Object", wantDesc: "VirtualMachine represents"},
+		{path: "VirtualMachines", wantName: "VirtualMachine", wantType: "Object"},
+		{path: "vm.kind", wantName: "kind", wantType: "string"},
+		{path: "vm.metadata.labels", wantName: "labels", wantType: "map[string]string"},
+		{path: "vm.metadata.creationTimestamp", wantName: "creationTimestamp", wantType: "string"},
+		{path: "vm.spec", wantName: "spec", wantType: "Object", wantRequired: true},
+		{path: "vm.spec.ttl", wantName: "ttl", wantType: "string"},
+		{path: "vm.spec.vcpus", wantName: "vcpus", wantType: "integer", wantRequired: true},
+		{
+			path:        "vm.spec.bootDisk.format",
+			wantName:    "format",
+			wantType:    "string",
+			wantDefault: "qcow2",
+			wantEnum:    []string{"qcow2", "raw"},
+			wantDesc:    "Format is the disk format to use.",
+		},
+		{path: "vm.spec.storagePool", wantName: "storagePool", wantType: "string", wantDefault: "foundry-vms"},
+		{path: "vm.spec.dataDisks", wantName: "dataDisks", wantType: "[]Object"},
+		{path: "vm.spec.dataDisks.device", wantName: "device", wantType: "string", wantRequired: true},
+		{path: "vm.spec.networkInterfaces.network", wantName: "network", wantType: "string"},
+		{path: "vm.spec.networkInterfaces.dnsServers", wantName: "dnsServers", wantType: "[]string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resource, field, err := Lookup(tt.path)
+			if err != nil {
+				t.Fatalf("Lookup() error = %v", err)
+			}
+			if resource.Kind != "VirtualMachine" {
+				t.Errorf("Kind = %q", resource.Kind)
+			}
+			if field.Name != tt.wantName || field.Type != tt.wantType {
+				t.Errorf("field = %s <%s>, want %s <%s>", field.Name, field.Type, tt.wantName, tt.wantType)
+			}
+			if field.Required != tt.wantRequired {
+				t.Errorf("Required = %v, want %v", field.Required, tt.wantRequired)
+			}
+			if field.Default != tt.wantDefault {
+				t.Errorf("Default = %q, want %q", field.Default, tt.wantDefault)
+			}
+			if !reflect.DeepEqual(field.Enum, tt.wantEnum) {
+				t.Errorf("Enum = %v, want %v", field.Enum, tt.wantEnum)
+			}
+			if !strings.HasPrefix(field.Description, tt.wantDesc) {
+				t.Errorf("Description = %q, want prefix %q", field.Description, tt.wantDesc)
+			}
+			if strings.Contains(field.Description, "+optional") || strings.Contains(field.Description, "+kubebuilder") {
+				t.Errorf("Description contains markers: %q", field.Description)
+			}
+		})
+	}
+}
+
+func TestLookup_Stack(t *testing.T) {
+	resource, field, err := Lookup("stack.spec.template.spec.vcpus")
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	if resource.Kind != "VirtualMachineStack" {
+		t.Errorf("Kind = %q", resource.Kind)
+	}
+	if field.Name != "vcpus" || field.Type != "integer" || !field.Required {
+		t.Errorf("field = %s <%s> required=%v", field.Name, field.Type, field.Required)
+	}
+
+	_, field, err = Lookup("stack.spec.names")
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	if !strings.Contains(field.Description, "zero-padded") {
+		t.Errorf("Description = %q", field.Description)
+	}
+}
+
+func TestLookup_Errors(t *testing.T) {
+	tests := []struct {
+		path    string
+		wantErr string
+	}{
+		{path: "pod.spec", wantErr: `unknown resource "pod"`},
+		{path: "vm.spec.nope", wantErr: `field "nope" does not exist in vm.spec`},
+		{path: "vm.spec.vcpus.more", wantErr: `field "more" does not exist in vm.spec.vcpus`},
+		{path: "vm..spec", wantErr: `field "" does not exist in vm`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			_, _, err := Lookup(tt.path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Lookup() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLookup_InlineTypeMeta(t *testing.T) {
+	_, field, err := Lookup("vm")
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+
+	var names []string
+	for _, f := range field.Fields {
+		names = append(names, f.Name)
+	}
+	want := []string{"kind", "apiVersion", "metadata", "spec", "status"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("fields = %v, want %v", names, want)
+	}
+}
+
+func TestParseComment(t *testing.T) {
+	src := `package p
+
+type T struct {
+	// Mode is the mode.
+	// Valid values: "a", "b".
+	// +optional
+	// +kubebuilder:validation:Enum=a;b
+	// +kubebuilder:default=a
+	// +kubebuilder:validation:MinLength=1
+	Mode string
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	field := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec).Type.(*ast.StructType).Fields.List[0]
+
+	fd := parseComment(field.Doc)
+
+	if fd.description != "Mode is the mode.\nValid values: \"a\", \"b\"." {
+		t.Errorf("description = %q", fd.description)
+	}
+	if !fd.optional {
+		t.Error("expected optional")
+	}
+	if fd.defaultValue != "a" {
+		t.Errorf("default = %q", fd.defaultValue)
+	}
+	if !reflect.DeepEqual(fd.enum, []string{"a", "b"}) {
+		t.Errorf("enum = %v", fd.enum)
+	}
+	if !reflect.DeepEqual(fd.constraints, []string{"MinLength: 1"}) {
+		t.Errorf("constraints = %v", fd.constraints)
+	}
+}
+
+func TestParseDocs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"types.go": {Data: []byte(`package p
+
+// Outer is documented.
+type Outer struct {
+	// Inner is embedded.
+	Inner ` + "`json:\",inline\"`" + `
+
+	// A and B share a comment.
+	A, B int
+}
+`)},
+	}
+
+	docs, err := parseDocs(fsys)
+	if err != nil {
+		t.Fatalf("parseDocs() error = %v", err)
+	}
+	outer := docs.types["Outer"]
+	if outer.description != "Outer is documented." {
+		t.Errorf("type description = %q", outer.description)
+	}
+	for _, name := range []string{"Inner", "A", "B"} {
+		if outer.fields[name].description == "" {
+			t.Errorf("field %s has no description", name)
+		}
+	}
+
+	if _, err := parseDocs(fstest.MapFS{"bad.go": {Data: []byte("not go")}}); err == nil {
+		t.Error("expected parse error")
+	}
+}
+
+func TestRender(t *testing.T) {
+	resource, field, err := Lookup("vm.spec.bootDisk")
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+
+	var out strings.Builder
+	if err := Render(&out, resource, field, false); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	got := out.String()
+
+	for _, want := range []string{
+		"KIND:     VirtualMachine\n",
+		"VERSION:  foundry.cofront.xyz/v1alpha1\n",
+		"FIELD:    bootDisk <Object>\n",
+		"DESCRIPTION:\n     BootDisk defines the primary boot disk configuration.\n",
+		"   sizeGB\t<integer> -required-\n",
+		"     Minimum: 1\n",
+		"     Default: qcow2\n",
+		"     Allowed values: qcow2, raw\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestRender_Recursive(t *testing.T) {
+	resource, field, err := Lookup("vm.spec")
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+
+	var out strings.Builder
+	if err := Render(&out, resource, field, true); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	got := out.String()
+
+	if !strings.Contains(got, "   bootDisk\t<Object> -required-\n      sizeGB\t<integer> -required-\n") {
+		t.Errorf("expected nested tree:\n%s", got)
+	}
+	if strings.Contains(got, "Default:") {
+		t.Errorf("recursive output should list names and types only:\n%s", got)
+	}
+}
@@ -0,0 +1,78 @@
+package explain
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Render writes the documentation of field in the layout of kubectl explain:
+// the field's own description followed by its nested fields. With recursive,
+// nested fields are listed as an indented tree of names and types instead.
+func Render(w io.Writer, resource *Resource, field *Field, recursive bool) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "KIND:     %s\n", resource.Kind)
+	fmt.Fprintf(&b, "VERSION:  %s\n\n", resource.APIVersion)
+	if field.Name != resource.Kind {
+		fmt.Fprintf(&b, "FIELD:    %s <%s>\n\n", field.Name, field.Type)
+	}
+
+	b.WriteString("DESCRIPTION:\n")
+	writeDetails(&b, field, "     ")
+
+	if len(field.Fields) > 0 {
+		b.WriteString("\nFIELDS:\n")
+		if recursive {
+			writeTree(&b, field.Fields, "   ")
+		} else {
+			for i, f := range field.Fields {
+				if i > 0 {
+					b.WriteString("\n")
+				}
+				fmt.Fprintf(&b, "   %s\t<%s>%s\n", f.Name, f.Type, requiredSuffix(f))
+				writeDetails(&b, f, "     ")
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeDetails writes a field's description, default and validation rules.
+func writeDetails(b *strings.Builder, f *Field, indent string) {
+	description := f.Description
+	if description == "" {
+		description = "<empty>"
+	}
+	for _, line := range strings.Split(description, "\n") {
+		b.WriteString(strings.TrimRight(indent+line, " ") + "\n")
+	}
+
+	if f.Default != "" {
+		fmt.Fprintf(b, "%sDefault: %s\n", indent, f.Default)
+	}
+	if len(f.Enum) > 0 {
+		fmt.Fprintf(b, "%sAllowed values: %s\n", indent, strings.Join(f.Enum, ", "))
+	}
+	for _, c := range f.Constraints {
+		fmt.Fprintf(b, "%s%s\n", indent, c)
+	}
+}
+
+// writeTree writes the names and types of fields and their nested fields.
+func writeTree(b *strings.Builder, fields []*Field, indent string) {
+	for _, f := range fields {
+		fmt.Fprintf(b, "%s%s\t<%s>%s\n", indent, f.Name, f.Type, requiredSuffix(f))
+		writeTree(b, f.Fields, indent+"   ")
+	}
+}
+
+// requiredSuffix marks required fields like kubectl explain does.
+func requiredSuffix(f *Field) string {
+	if f.Required {
+		return " -required-"
+	}
+	return ""
+}
@@ -0,0 +1,207 @@
+// Package history keeps an audit log of what was done to each VM: when it
+// was created, started, stopped or destroyed, when disks were attached and
+// snapshots taken, and by whom (see 'foundry events').
+//
+// Each VM has one file of JSON lines named after it, in a directory named
+// after the libvirt connection of its hypervisor, appended to as events
+// happen. VMs of the same name on different hypervisors thus have separate
+// histories. The file is kept when the VM is destroyed, so the history of a
+// VM outlives it and continues if a VM of the same name is created again.
+package history
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/jbweber/foundry/internal/auth"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+)
+
+// EnvVar overrides the history directory.
+const EnvVar = "FOUNDRY_EVENTS_DIR"
+
+// SystemDir is the history directory when running as root.
+const SystemDir = "/var/lib/foundry/events"
+
+// localConnection is the connection of the local hypervisor, used when no
+// connection URI is configured.
+const localConnection = "qemu:///system"
+
+// Event types.
+const (
+	TypeCreated          = "Created"
+	TypeStarted          = "Started"
+	TypeStopped          = "Stopped"
+	TypeDestroyed        = "Destroyed"
+	TypeDiskAttached     = "DiskAttached"
+	TypeDiskDetached     = "DiskDetached"
+	TypeSnapshotTaken    = "SnapshotTaken"
+	TypeSnapshotReverted = "SnapshotReverted"
+	TypeSnapshotDeleted  = "SnapshotDeleted"
+)
+
+// Event is something done to a VM.
+type Event struct {
+	// Time is when it was done.
+	Time time.Time `json:"time" yaml:"time"`
+
+	// VM is the name of the VM.
+	VM string `json:"vm" yaml:"vm"`
+
+	// Connection is the libvirt connection URI of the VM's hypervisor.
+	Connection string `json:"connection" yaml:"connection"`
+
+	// Type is one of the Type constants.
+	Type string `json:"type" yaml:"type"`
+
+	// Actor is the user who did it: the authenticated caller for changes
+	// made through 'foundry serve', else the user running foundry.
+	Actor string `json:"actor" yaml:"actor"`
+
+	// Message describes it, e.g. the disk attached.
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// DefaultDir returns the history directory: $FOUNDRY_EVENTS_DIR, else
+// SystemDir for root and $XDG_STATE_HOME/foundry/events (by default
+// ~/.local/state/foundry/events) for other users.
+func DefaultDir() (string, error) {
+	if dir := os.Getenv(EnvVar); dir != "" {
+		return dir, nil
+	}
+	if os.Geteuid() == 0 {
+		return SystemDir, nil
+	}
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to determine history directory: %w", err)
+		}
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateHome, "foundry", "events"), nil
+}
+
+// Actor returns the user running foundry. Under sudo it is the user who ran
+// sudo rather than root.
+func Actor() string {
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" && os.Geteuid() == 0 {
+		return sudoUser
+	}
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return "uid " + strconv.Itoa(os.Geteuid())
+}
+
+// Connection returns the libvirt connection foundry uses: the URI of
+// --connect or $FOUNDRY_CONNECT, else qemu:///system.
+func Connection() string {
+	if uri := foundrylibvirt.DefaultURI(); uri != "" {
+		return uri
+	}
+	return localConnection
+}
+
+// path returns the history file of a VM on a connection.
+func path(dir, connection, vm string) string {
+	return filepath.Join(dir, url.PathEscape(connection), url.PathEscape(vm)+".jsonl")
+}
+
+// Append adds an event to the history of its VM. A zero Time is set to now,
+// an empty Connection to Connection() and an empty Actor to Actor().
+func Append(dir string, ev Event) error {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	if ev.Connection == "" {
+		ev.Connection = Connection()
+	}
+	if ev.Actor == "" {
+		ev.Actor = Actor()
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	file := path(dir, ev.Connection, ev.VM)
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	// A single write of a line to a file opened for appending is not
+	// interleaved with those of other processes
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history of VM %s: %w", ev.VM, err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write history of VM %s: %w", ev.VM, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write history of VM %s: %w", ev.VM, err)
+	}
+	return nil
+}
+
+// List returns the history of a VM on a connection, oldest first. A VM
+// without history has no events. Lines that cannot be parsed, such as one
+// cut short by a crash, are skipped.
+func List(dir, connection, vm string) ([]Event, error) {
+	f, err := os.Open(path(dir, connection, vm))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history of VM %s: %w", vm, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			continue
+		}
+		events = append(events, ev)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history of VM %s: %w", vm, err)
+	}
+	return events, nil
+}
+
+// Record adds an event of the given type to the history of vm on the
+// default connection, in the default directory. The actor is the identity
+// authenticated by 'foundry serve' for the request of ctx, if any, else
+// Actor(). Failing to record never fails the operation recorded, so errors
+// are only logged.
+func Record(ctx context.Context, vm, eventType, message string) {
+	logger := logging.FromContext(ctx)
+
+	dir, err := DefaultDir()
+	if err != nil {
+		logger.Warn("Not recording VM event", "vm", vm, "event", eventType, "error", err)
+		return
+	}
+	ev := Event{VM: vm, Type: eventType, Message: message}
+	if id, ok := auth.IdentityFromContext(ctx); ok {
+		ev.Actor = id.Name
+	}
+	if err := Append(dir, ev); err != nil {
+		logger.Warn("Failed to record VM event", "vm", vm, "event", eventType, "error", err)
+	}
+}
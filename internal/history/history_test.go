@@ -0,0 +1,92 @@
+package history
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jbweber/foundry/internal/auth"
+)
+
+func TestAppendList(t *testing.T) {
+	dir := t.TempDir()
+	created := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, ev := range []Event{
+		{VM: "web-1", Type: TypeCreated, Time: created, Actor: "alice"},
+		{VM: "web-2", Type: TypeCreated},
+		{VM: "web-1", Type: TypeDiskAttached, Message: "Data disk vdb (50GB) attached"},
+		// A VM of the same name on another hypervisor
+		{VM: "web-1", Connection: "qemu+ssh://hv2/system", Type: TypeDestroyed},
+	} {
+		if err := Append(dir, ev); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	events, err := List(dir, Connection(), "web-1")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("List() = %+v, want 2 events", events)
+	}
+	if got := events[0]; got.Type != TypeCreated || !got.Time.Equal(created) || got.Actor != "alice" {
+		t.Errorf("first event = %+v", got)
+	}
+	if got := events[1]; got.Type != TypeDiskAttached || got.Time.IsZero() || got.Connection != Connection() || got.Actor != Actor() || got.Message == "" {
+		t.Errorf("second event = %+v, want time, connection and actor filled in", got)
+	}
+
+	events, err = List(dir, "qemu+ssh://hv2/system", "web-1")
+	if err != nil || len(events) != 1 || events[0].Type != TypeDestroyed {
+		t.Errorf("List() of the other hypervisor = %+v, %v, want its event only", events, err)
+	}
+}
+
+func TestList_SkipsTruncatedLine(t *testing.T) {
+	dir := t.TempDir()
+	if err := Append(dir, Event{VM: "web-1", Type: TypeStarted}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	f, err := os.OpenFile(path(dir, Connection(), "web-1"), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"vm":"web-1","ty`)
+	_ = f.Close()
+
+	events, err := List(dir, Connection(), "web-1")
+	if err != nil || len(events) != 1 {
+		t.Errorf("List() = %+v, %v, want the complete event", events, err)
+	}
+}
+
+func TestList_NoHistory(t *testing.T) {
+	events, err := List(filepath.Join(t.TempDir(), "missing"), Connection(), "web-1")
+	if err != nil || len(events) != 0 {
+		t.Errorf("List() = %+v, %v, want no events", events, err)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(EnvVar, dir)
+
+	Record(context.Background(), "web-1", TypeStopped, "")
+	// Through the API, the caller did it rather than the daemon's user
+	Record(auth.NewContext(context.Background(), auth.Identity{Name: "ci-pipeline", Method: "token"}), "web-1", TypeStarted, "")
+
+	events, err := List(dir, Connection(), "web-1")
+	if err != nil || len(events) != 2 {
+		t.Fatalf("List() = %+v, %v, want the recorded events", events, err)
+	}
+	if events[0].Type != TypeStopped || events[0].Actor != Actor() {
+		t.Errorf("first event = %+v, want stopped by %s", events[0], Actor())
+	}
+	if events[1].Type != TypeStarted || events[1].Actor != "ci-pipeline" {
+		t.Errorf("second event = %+v, want started by ci-pipeline", events[1])
+	}
+}
@@ -0,0 +1,196 @@
+package host
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/status"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// CapacityClient defines the libvirt operations needed to report the host's
+// capacity. *libvirt.Libvirt satisfies it.
+type CapacityClient interface {
+	NodeGetInfo() (rModel [32]int8, rMemory uint64, rCpus int32, rMhz int32, rNodes int32, rSockets int32, rCores int32, rThreads int32, err error)
+	ConnectListAllDomains(NeedResults int32, Flags libvirt.ConnectListAllDomainsFlags) ([]libvirt.Domain, uint32, error)
+	DomainGetInfo(Dom libvirt.Domain) (rState uint8, rMaxMem uint64, rMemory uint64, rNrVirtCPU uint16, rCPUTime uint64, err error)
+	metadata.LibvirtClient
+}
+
+// poolLister defines the storage operations needed to report the capacity
+// of the host's pools. *storage.Manager satisfies it.
+type poolLister interface {
+	ListPools(ctx context.Context) ([]storage.PoolInfo, error)
+	ListVolumes(ctx context.Context, poolName string) ([]storage.VolumeInfo, error)
+}
+
+// Capacity is what the hypervisor host has and what its VMs are allocated.
+type Capacity struct {
+	// Model is the host's CPU architecture, e.g. "x86_64".
+	Model string `json:"model" yaml:"model"`
+
+	// CPUs is the number of logical CPUs and NUMANodes the number of NUMA
+	// nodes of the host.
+	CPUs      int `json:"cpus" yaml:"cpus"`
+	NUMANodes int `json:"numaNodes" yaml:"numaNodes"`
+
+	// Memory is the host's memory in bytes.
+	Memory uint64 `json:"memory" yaml:"memory"`
+
+	// VCPUs and AllocatedMemory (in bytes) are assigned to the host's VMs.
+	VCPUs           Allocation `json:"vcpus" yaml:"vcpus"`
+	AllocatedMemory Allocation `json:"allocatedMemory" yaml:"allocatedMemory"`
+
+	// VCPURatio and MemoryRatio are the vCPUs and memory of every defined VM
+	// per host CPU and byte of host memory; above 1 the host is overcommitted
+	// if all VMs run at once.
+	VCPURatio   float64 `json:"vcpuRatio" yaml:"vcpuRatio"`
+	MemoryRatio float64 `json:"memoryRatio" yaml:"memoryRatio"`
+
+	// VMs counts the foundry VMs by phase. OtherDomains counts the domains
+	// not managed by foundry, whose resources are allocated all the same.
+	VMs          map[v1alpha1.VMPhase]int `json:"vms" yaml:"vms"`
+	OtherDomains int                      `json:"otherDomains" yaml:"otherDomains"`
+
+	// Pools are the host's storage pools.
+	Pools []PoolCapacity `json:"pools" yaml:"pools"`
+}
+
+// Allocation is a resource assigned to the VMs defined on the host, and to
+// those of them that are running.
+type Allocation struct {
+	Defined uint64 `json:"defined" yaml:"defined"`
+	Running uint64 `json:"running" yaml:"running"`
+}
+
+// PoolCapacity is a storage pool and the capacity of its volumes.
+type PoolCapacity struct {
+	storage.PoolInfo `yaml:",inline"`
+
+	// Volumes is the number of volumes in the pool.
+	Volumes int `json:"volumes" yaml:"volumes"`
+
+	// Provisioned is the total capacity of the pool's volumes in bytes.
+	// Thin-provisioned volumes only allocate what is written, so it can
+	// exceed the pool's capacity.
+	Provisioned uint64 `json:"provisioned" yaml:"provisioned"`
+
+	// Ratio is Provisioned per byte of pool capacity; above 1 the pool
+	// fills up before its volumes do.
+	Ratio float64 `json:"ratio" yaml:"ratio"`
+}
+
+// ProvisionedGB returns the total capacity of the pool's volumes in GB.
+func (p *PoolCapacity) ProvisionedGB() float64 {
+	return float64(p.Provisioned) / (1024 * 1024 * 1024)
+}
+
+// GetCapacity returns the CPUs, memory and storage of the hypervisor host and
+// how much of them its VMs are allocated.
+func GetCapacity(ctx context.Context) (*Capacity, error) {
+	client, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			logging.FromContext(ctx).Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	return getCapacityWithDeps(ctx, client.Libvirt(), storage.NewManager(client.Libvirt()))
+}
+
+// getCapacityWithDeps returns the host's capacity with injected
+// dependencies.
+func getCapacityWithDeps(ctx context.Context, lv CapacityClient, pl poolLister) (*Capacity, error) {
+	logger := logging.FromContext(ctx)
+
+	model, memoryKiB, cpus, _, nodes, _, _, _, err := lv.NodeGetInfo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host info: %w", err)
+	}
+	capacity := &Capacity{
+		Model:     modelString(model),
+		CPUs:      int(cpus),
+		NUMANodes: int(nodes),
+		Memory:    memoryKiB * 1024,
+		VMs:       make(map[v1alpha1.VMPhase]int),
+		Pools:     []PoolCapacity{},
+	}
+
+	domains, _, err := lv.ConnectListAllDomains(1, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domains: %w", err)
+	}
+	mc := metadata.NewClient(lv)
+	for _, domain := range domains {
+		state, maxMemKiB, _, vcpus, _, err := lv.DomainGetInfo(domain)
+		if err != nil {
+			// The domain may have been undefined since it was listed
+			logger.Warn("Failed to get domain info", "domain", domain.Name, "error", err)
+			continue
+		}
+
+		capacity.VCPUs.Defined += uint64(vcpus)
+		capacity.AllocatedMemory.Defined += maxMemKiB * 1024
+		phase := status.PhaseForDomainState(int32(state))
+		if phase == v1alpha1.VMPhaseRunning {
+			capacity.VCPUs.Running += uint64(vcpus)
+			capacity.AllocatedMemory.Running += maxMemKiB * 1024
+		}
+
+		if _, err := mc.Load(domain); err != nil {
+			capacity.OtherDomains++
+			continue
+		}
+		capacity.VMs[phase]++
+	}
+	capacity.VCPURatio = ratio(capacity.VCPUs.Defined, uint64(capacity.CPUs))
+	capacity.MemoryRatio = ratio(capacity.AllocatedMemory.Defined, capacity.Memory)
+
+	pools, err := pl.ListPools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, pool := range pools {
+		pc := PoolCapacity{PoolInfo: pool}
+		// Inactive pools have no volumes to list
+		if volumes, err := pl.ListVolumes(ctx, pool.Name); err == nil {
+			pc.Volumes = len(volumes)
+			for _, vol := range volumes {
+				pc.Provisioned += vol.Capacity
+			}
+		}
+		pc.Ratio = ratio(pc.Provisioned, pc.Capacity)
+		capacity.Pools = append(capacity.Pools, pc)
+	}
+
+	return capacity, nil
+}
+
+// ratio returns allocated per unit of capacity, or 0 without capacity.
+func ratio(allocated, capacity uint64) float64 {
+	if capacity == 0 {
+		return 0
+	}
+	return float64(allocated) / float64(capacity)
+}
+
+// modelString converts the NUL-terminated CPU model of NodeGetInfo.
+func modelString(model [32]int8) string {
+	b := make([]byte, 0, len(model))
+	for _, c := range model {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	return string(b)
+}
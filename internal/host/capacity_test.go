@@ -0,0 +1,131 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+const gib = 1024 * 1024 * 1024
+
+// fakeDomain is a domain served by fakeCapacityLibvirt.
+type fakeDomain struct {
+	state     uint8
+	vcpus     uint16
+	memoryKiB uint64
+	foundry   bool
+}
+
+// fakeCapacityLibvirt serves a host with 8 CPUs and 16 GiB of memory.
+type fakeCapacityLibvirt struct {
+	domains map[string]fakeDomain
+}
+
+func (f *fakeCapacityLibvirt) NodeGetInfo() (rModel [32]int8, rMemory uint64, rCpus int32, rMhz int32, rNodes int32, rSockets int32, rCores int32, rThreads int32, err error) {
+	for i, c := range "x86_64" {
+		rModel[i] = int8(c)
+	}
+	return rModel, 16 * 1024 * 1024, 8, 3000, 1, 1, 4, 2, nil
+}
+
+func (f *fakeCapacityLibvirt) ConnectListAllDomains(NeedResults int32, Flags libvirt.ConnectListAllDomainsFlags) ([]libvirt.Domain, uint32, error) {
+	var domains []libvirt.Domain
+	for name := range f.domains {
+		domains = append(domains, libvirt.Domain{Name: name})
+	}
+	// A domain undefined between listing and inspection
+	domains = append(domains, libvirt.Domain{Name: "vanished"})
+	return domains, uint32(len(domains)), nil
+}
+
+func (f *fakeCapacityLibvirt) DomainGetInfo(Dom libvirt.Domain) (rState uint8, rMaxMem uint64, rMemory uint64, rNrVirtCPU uint16, rCPUTime uint64, err error) {
+	d, ok := f.domains[Dom.Name]
+	if !ok {
+		return 0, 0, 0, 0, 0, fmt.Errorf("domain not found: %s", Dom.Name)
+	}
+	return d.state, d.memoryKiB, d.memoryKiB, d.vcpus, 0, nil
+}
+
+func (f *fakeCapacityLibvirt) DomainGetMetadata(Dom libvirt.Domain, Type int32, URI libvirt.OptString, Flags libvirt.DomainModificationImpact) (string, error) {
+	if !f.domains[Dom.Name].foundry {
+		return "", fmt.Errorf("metadata not found")
+	}
+	return fmt.Sprintf("<metadata xmlns=%q>metadata:\n  name: %s\n</metadata>", metadata.MetadataNamespace, Dom.Name), nil
+}
+
+func (f *fakeCapacityLibvirt) DomainSetMetadata(Dom libvirt.Domain, Type int32, Metadata libvirt.OptString, Key libvirt.OptString, URI libvirt.OptString, Flags libvirt.DomainModificationImpact) error {
+	return fmt.Errorf("read-only")
+}
+
+// fakePools serves pools and their volumes; pools without volumes are
+// inactive.
+type fakePools struct {
+	pools   []storage.PoolInfo
+	volumes map[string][]storage.VolumeInfo
+}
+
+func (f *fakePools) ListPools(ctx context.Context) ([]storage.PoolInfo, error) {
+	return f.pools, nil
+}
+
+func (f *fakePools) ListVolumes(ctx context.Context, poolName string) ([]storage.VolumeInfo, error) {
+	volumes, ok := f.volumes[poolName]
+	if !ok {
+		return nil, fmt.Errorf("pool %s is not active", poolName)
+	}
+	return volumes, nil
+}
+
+func TestGetCapacityWithDeps(t *testing.T) {
+	lv := &fakeCapacityLibvirt{domains: map[string]fakeDomain{
+		"web":   {state: 1, vcpus: 4, memoryKiB: 8 * 1024 * 1024, foundry: true},
+		"db":    {state: 5, vcpus: 2, memoryKiB: 4 * 1024 * 1024, foundry: true},
+		"other": {state: 1, vcpus: 2, memoryKiB: 2 * 1024 * 1024},
+	}}
+	pools := &fakePools{
+		pools: []storage.PoolInfo{
+			{Name: "foundry-vms", State: "running", Capacity: 100 * gib},
+			{Name: "offline", State: "inactive"},
+		},
+		volumes: map[string][]storage.VolumeInfo{
+			"foundry-vms": {{Name: "web_boot.qcow2", Capacity: 80 * gib}, {Name: "db_boot.qcow2", Capacity: 60 * gib}},
+		},
+	}
+
+	got, err := getCapacityWithDeps(context.Background(), lv, pools)
+	if err != nil {
+		t.Fatalf("getCapacityWithDeps() error = %v", err)
+	}
+
+	if got.Model != "x86_64" || got.CPUs != 8 || got.NUMANodes != 1 || got.Memory != 16*gib {
+		t.Errorf("host = %s, %d CPUs, %d NUMA nodes, %d bytes", got.Model, got.CPUs, got.NUMANodes, got.Memory)
+	}
+	if got.VCPUs != (Allocation{Defined: 8, Running: 6}) {
+		t.Errorf("VCPUs = %+v, want 8 defined, 6 running", got.VCPUs)
+	}
+	if got.AllocatedMemory != (Allocation{Defined: 14 * gib, Running: 10 * gib}) {
+		t.Errorf("AllocatedMemory = %+v, want 14 GiB defined, 10 GiB running", got.AllocatedMemory)
+	}
+	if got.VCPURatio != 1 || got.MemoryRatio != 0.875 {
+		t.Errorf("ratios = %v vCPU, %v memory, want 1 and 0.875", got.VCPURatio, got.MemoryRatio)
+	}
+	if got.VMs[v1alpha1.VMPhaseRunning] != 1 || got.VMs[v1alpha1.VMPhaseStopped] != 1 || got.OtherDomains != 1 {
+		t.Errorf("VMs = %v, other domains = %d, want 1 running, 1 stopped, 1 other", got.VMs, got.OtherDomains)
+	}
+
+	if len(got.Pools) != 2 {
+		t.Fatalf("Pools = %+v, want 2", got.Pools)
+	}
+	if vms := got.Pools[0]; vms.Volumes != 2 || vms.Provisioned != 140*gib || vms.Ratio != 1.4 {
+		t.Errorf("foundry-vms = %+v, want 2 volumes, 140 GiB provisioned, ratio 1.4", vms)
+	}
+	if offline := got.Pools[1]; offline.Volumes != 0 || offline.Ratio != 0 {
+		t.Errorf("offline = %+v, want no volumes", offline)
+	}
+}
@@ -0,0 +1,185 @@
+// Package host inspects the hypervisor host through libvirt, so it works
+// over remote connections as well as locally.
+package host
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/digitalocean/go-libvirt"
+	"libvirt.org/go/libvirtxml"
+
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+)
+
+// LibvirtClient defines the libvirt operations needed to inspect the host.
+// *libvirt.Libvirt satisfies it.
+type LibvirtClient interface {
+	ConnectListAllNodeDevices(NeedResults int32, Flags uint32) ([]libvirt.NodeDevice, uint32, error)
+	NodeDeviceGetXMLDesc(Name string, Flags uint32) (string, error)
+}
+
+// PCIDevice is a PCI device of the host.
+type PCIDevice struct {
+	// Address is the PCI address, e.g. "0000:01:00.0".
+	Address string `json:"address" yaml:"address"`
+
+	// Vendor and Product name the device.
+	Vendor  string `json:"vendor,omitempty" yaml:"vendor,omitempty"`
+	Product string `json:"product,omitempty" yaml:"product,omitempty"`
+
+	// Class is the PCI class code, e.g. "0x030000" for a VGA controller.
+	Class string `json:"class,omitempty" yaml:"class,omitempty"`
+
+	// Driver is the host driver bound to the device, e.g. "vfio-pci", or
+	// empty if none is.
+	Driver string `json:"driver,omitempty" yaml:"driver,omitempty"`
+
+	// IOMMUGroup is the device's IOMMU group, or -1 if the IOMMU is off.
+	// Every device in a group is passed through together.
+	IOMMUGroup int `json:"iommuGroup" yaml:"iommuGroup"`
+
+	// NUMANode is the NUMA node the device is attached to, or -1.
+	NUMANode int `json:"numaNode" yaml:"numaNode"`
+
+	// MdevTypes are the mediated device types the device can be split into,
+	// e.g. vGPU profiles.
+	MdevTypes []MdevType `json:"mdevTypes,omitempty" yaml:"mdevTypes,omitempty"`
+}
+
+// MdevType is a type of mediated device a PCI device supports.
+type MdevType struct {
+	ID        string `json:"id" yaml:"id"`
+	Name      string `json:"name,omitempty" yaml:"name,omitempty"`
+	Available uint   `json:"available" yaml:"available"`
+}
+
+// MdevDevice is a mediated device created on the host.
+type MdevDevice struct {
+	UUID string `json:"uuid" yaml:"uuid"`
+	Type string `json:"type" yaml:"type"`
+
+	// Parent is the PCI address of the device it is carved from.
+	Parent string `json:"parent,omitempty" yaml:"parent,omitempty"`
+}
+
+// Devices are the host devices that can be passed through to VMs.
+type Devices struct {
+	PCI   []PCIDevice  `json:"pci" yaml:"pci"`
+	Mdevs []MdevDevice `json:"mdevs" yaml:"mdevs"`
+}
+
+// pciClassBridge is the PCI base class of bridges, which are never passed
+// through.
+const pciClassBridge = "0x06"
+
+// Candidate reports whether the device can be passed through: it is in an
+// IOMMU group and is not a bridge.
+func (d PCIDevice) Candidate() bool {
+	return d.IOMMUGroup >= 0 && !strings.HasPrefix(d.Class, pciClassBridge)
+}
+
+// ListDevices returns the PCI and mediated devices of the hypervisor host.
+func ListDevices(ctx context.Context) (*Devices, error) {
+	client, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			logging.FromContext(ctx).Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	return listDevicesWithDeps(client.Libvirt())
+}
+
+// listDevicesWithDeps returns the host's devices with injected dependencies.
+func listDevicesWithDeps(lv LibvirtClient) (*Devices, error) {
+	flags := libvirt.ConnectListNodeDevicesCapPciDev | libvirt.ConnectListNodeDevicesCapMdev
+	nodeDevices, _, err := lv.ConnectListAllNodeDevices(1, uint32(flags))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list host devices: %w", err)
+	}
+
+	// Mediated devices name their parent by node device name
+	addresses := make(map[string]string)
+	devices := &Devices{PCI: []PCIDevice{}, Mdevs: []MdevDevice{}}
+	var mdevs []libvirtxml.NodeDevice
+	for _, nodeDevice := range nodeDevices {
+		xmlDesc, err := lv.NodeDeviceGetXMLDesc(nodeDevice.Name, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get host device %s: %w", nodeDevice.Name, err)
+		}
+		var def libvirtxml.NodeDevice
+		if err := def.Unmarshal(xmlDesc); err != nil {
+			return nil, fmt.Errorf("failed to parse host device %s: %w", nodeDevice.Name, err)
+		}
+
+		switch {
+		case def.Capability.PCI != nil:
+			dev := pciDevice(&def)
+			addresses[def.Name] = dev.Address
+			devices.PCI = append(devices.PCI, dev)
+		case def.Capability.MDev != nil:
+			mdevs = append(mdevs, def)
+		}
+	}
+
+	for _, def := range mdevs {
+		mdev := MdevDevice{UUID: def.Capability.MDev.UUID, Parent: addresses[def.Parent]}
+		if def.Capability.MDev.Type != nil {
+			mdev.Type = def.Capability.MDev.Type.ID
+		}
+		devices.Mdevs = append(devices.Mdevs, mdev)
+	}
+
+	sort.Slice(devices.PCI, func(i, j int) bool { return devices.PCI[i].Address < devices.PCI[j].Address })
+	sort.Slice(devices.Mdevs, func(i, j int) bool { return devices.Mdevs[i].UUID < devices.Mdevs[j].UUID })
+	return devices, nil
+}
+
+// pciDevice converts the node device of a PCI device.
+func pciDevice(def *libvirtxml.NodeDevice) PCIDevice {
+	pci := def.Capability.PCI
+	dev := PCIDevice{
+		Address:    pciAddress(pci),
+		Vendor:     pci.Vendor.Name,
+		Product:    pci.Product.Name,
+		Class:      pci.Class,
+		IOMMUGroup: -1,
+		NUMANode:   -1,
+	}
+	if def.Driver != nil {
+		dev.Driver = def.Driver.Name
+	}
+	if pci.IOMMUGroup != nil {
+		dev.IOMMUGroup = pci.IOMMUGroup.Number
+	}
+	if pci.NUMA != nil {
+		dev.NUMANode = pci.NUMA.Node
+	}
+	for _, sub := range pci.Capabilities {
+		if sub.MDevTypes == nil {
+			continue
+		}
+		for _, t := range sub.MDevTypes.Types {
+			dev.MdevTypes = append(dev.MdevTypes, MdevType{ID: t.ID, Name: t.Name, Available: t.AvailableInstances})
+		}
+	}
+	return dev
+}
+
+// pciAddress formats the address of a PCI device as "dddd:bb:ss.f".
+func pciAddress(pci *libvirtxml.NodeDevicePCICapability) string {
+	value := func(v *uint) uint {
+		if v == nil {
+			return 0
+		}
+		return *v
+	}
+	return fmt.Sprintf("%04x:%02x:%02x.%x", value(pci.Domain), value(pci.Bus), value(pci.Slot), value(pci.Function))
+}
@@ -0,0 +1,176 @@
+package host
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+)
+
+// fakeLibvirt serves node device XML by device name.
+type fakeLibvirt struct {
+	devices map[string]string
+	err     error
+}
+
+func (f *fakeLibvirt) ConnectListAllNodeDevices(NeedResults int32, Flags uint32) ([]libvirt.NodeDevice, uint32, error) {
+	if f.err != nil {
+		return nil, 0, f.err
+	}
+	var devices []libvirt.NodeDevice
+	for name := range f.devices {
+		devices = append(devices, libvirt.NodeDevice{Name: name})
+	}
+	return devices, uint32(len(devices)), nil
+}
+
+func (f *fakeLibvirt) NodeDeviceGetXMLDesc(Name string, Flags uint32) (string, error) {
+	xml, ok := f.devices[Name]
+	if !ok {
+		return "", fmt.Errorf("no device %s", Name)
+	}
+	return xml, nil
+}
+
+const gpuXML = `<device>
+  <name>pci_0000_01_00_0</name>
+  <parent>pci_0000_00_01_0</parent>
+  <driver><name>vfio-pci</name></driver>
+  <capability type='pci'>
+    <class>0x030000</class>
+    <domain>0</domain>
+    <bus>1</bus>
+    <slot>0</slot>
+    <function>0</function>
+    <product id='0x1eb8'>TU104GL [Tesla T4]</product>
+    <vendor id='0x10de'>NVIDIA Corporation</vendor>
+    <capability type='mdev_types'>
+      <type id='nvidia-222'>
+        <name>GRID T4-1B</name>
+        <deviceAPI>vfio-pci</deviceAPI>
+        <availableInstances>15</availableInstances>
+      </type>
+    </capability>
+    <iommuGroup number='14'>
+      <address domain='0x0000' bus='0x01' slot='0x00' function='0x0'/>
+    </iommuGroup>
+    <numa node='0'/>
+  </capability>
+</device>`
+
+const bridgeXML = `<device>
+  <name>pci_0000_00_01_0</name>
+  <driver><name>pcieport</name></driver>
+  <capability type='pci'>
+    <class>0x060400</class>
+    <domain>0</domain>
+    <bus>0</bus>
+    <slot>1</slot>
+    <function>0</function>
+    <product id='0x1901'>Xeon E3-1200 PCIe Controller</product>
+    <vendor id='0x8086'>Intel Corporation</vendor>
+    <iommuGroup number='2'>
+      <address domain='0x0000' bus='0x00' slot='0x01' function='0x0'/>
+    </iommuGroup>
+  </capability>
+</device>`
+
+const nicXML = `<device>
+  <name>pci_0000_3b_00_1</name>
+  <driver><name>ixgbe</name></driver>
+  <capability type='pci'>
+    <class>0x020000</class>
+    <domain>0</domain>
+    <bus>59</bus>
+    <slot>0</slot>
+    <function>1</function>
+    <product id='0x10fb'>82599ES 10-Gigabit SFI/SFP+ Network Connection</product>
+    <vendor id='0x8086'>Intel Corporation</vendor>
+  </capability>
+</device>`
+
+const mdevXML = `<device>
+  <name>mdev_4b20d080_1b54_4048_85b3_a6a62d165c01</name>
+  <parent>pci_0000_01_00_0</parent>
+  <driver><name>nvidia-vgpu-vfio</name></driver>
+  <capability type='mdev'>
+    <type id='nvidia-222'/>
+    <uuid>4b20d080-1b54-4048-85b3-a6a62d165c01</uuid>
+    <iommuGroup number='20'/>
+  </capability>
+</device>`
+
+func TestListDevicesWithDeps(t *testing.T) {
+	lv := &fakeLibvirt{devices: map[string]string{
+		"pci_0000_01_00_0":                          gpuXML,
+		"pci_0000_00_01_0":                          bridgeXML,
+		"pci_0000_3b_00_1":                          nicXML,
+		"mdev_4b20d080_1b54_4048_85b3_a6a62d165c01": mdevXML,
+	}}
+
+	devices, err := listDevicesWithDeps(lv)
+	if err != nil {
+		t.Fatalf("listDevicesWithDeps() error = %v", err)
+	}
+
+	if len(devices.PCI) != 3 {
+		t.Fatalf("got %d PCI devices, want 3", len(devices.PCI))
+	}
+	wantAddresses := []string{"0000:00:01.0", "0000:01:00.0", "0000:3b:00.1"}
+	for i, want := range wantAddresses {
+		if devices.PCI[i].Address != want {
+			t.Errorf("PCI[%d].Address = %q, want %q", i, devices.PCI[i].Address, want)
+		}
+	}
+
+	gpu := devices.PCI[1]
+	if gpu.Vendor != "NVIDIA Corporation" || gpu.Product != "TU104GL [Tesla T4]" {
+		t.Errorf("GPU = %q %q", gpu.Vendor, gpu.Product)
+	}
+	if gpu.Driver != "vfio-pci" || gpu.IOMMUGroup != 14 || gpu.NUMANode != 0 {
+		t.Errorf("GPU driver/group/numa = %q/%d/%d, want vfio-pci/14/0", gpu.Driver, gpu.IOMMUGroup, gpu.NUMANode)
+	}
+	if len(gpu.MdevTypes) != 1 || gpu.MdevTypes[0] != (MdevType{ID: "nvidia-222", Name: "GRID T4-1B", Available: 15}) {
+		t.Errorf("GPU mdev types = %+v", gpu.MdevTypes)
+	}
+
+	nic := devices.PCI[2]
+	if nic.IOMMUGroup != -1 || nic.NUMANode != -1 {
+		t.Errorf("NIC group/numa = %d/%d, want -1/-1", nic.IOMMUGroup, nic.NUMANode)
+	}
+
+	if len(devices.Mdevs) != 1 {
+		t.Fatalf("got %d mdevs, want 1", len(devices.Mdevs))
+	}
+	want := MdevDevice{UUID: "4b20d080-1b54-4048-85b3-a6a62d165c01", Type: "nvidia-222", Parent: "0000:01:00.0"}
+	if devices.Mdevs[0] != want {
+		t.Errorf("mdev = %+v, want %+v", devices.Mdevs[0], want)
+	}
+}
+
+func TestListDevicesWithDeps_Error(t *testing.T) {
+	lv := &fakeLibvirt{err: errors.New("connection lost")}
+	if _, err := listDevicesWithDeps(lv); err == nil {
+		t.Error("listDevicesWithDeps() expected error")
+	}
+}
+
+func TestPCIDevice_Candidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		device PCIDevice
+		want   bool
+	}{
+		{"GPU", PCIDevice{Class: "0x030000", IOMMUGroup: 14}, true},
+		{"bridge", PCIDevice{Class: "0x060400", IOMMUGroup: 2}, false},
+		{"no IOMMU group", PCIDevice{Class: "0x020000", IOMMUGroup: -1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.device.Candidate(); got != tt.want {
+				t.Errorf("Candidate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package host
+
+import (
+	"fmt"
+
+	"github.com/digitalocean/go-libvirt"
+	"libvirt.org/go/libvirtxml"
+)
+
+// VFAddress returns the PCI address of virtual function vf of the SR-IOV
+// network device pf, e.g. "0000:01:10.6".
+//
+// The PF is found among the host's network devices; its parent PCI device
+// lists its VFs in index order.
+func VFAddress(lv LibvirtClient, pf string, vf int) (string, error) {
+	nodeDevices, _, err := lv.ConnectListAllNodeDevices(1, uint32(libvirt.ConnectListNodeDevicesCapNet))
+	if err != nil {
+		return "", fmt.Errorf("failed to list host network devices: %w", err)
+	}
+
+	parent := ""
+	for _, nodeDevice := range nodeDevices {
+		def, err := nodeDeviceDef(lv, nodeDevice.Name)
+		if err != nil {
+			return "", err
+		}
+		if def.Capability.Net != nil && def.Capability.Net.Interface == pf {
+			parent = def.Parent
+			break
+		}
+	}
+	if parent == "" {
+		return "", fmt.Errorf("network device %s not found on the host", pf)
+	}
+
+	def, err := nodeDeviceDef(lv, parent)
+	if err != nil {
+		return "", err
+	}
+	if def.Capability.PCI == nil {
+		return "", fmt.Errorf("network device %s is not a PCI device", pf)
+	}
+	var vfs []libvirtxml.NodeDevicePCIAddress
+	for _, sub := range def.Capability.PCI.Capabilities {
+		if sub.VirtFunctions != nil {
+			vfs = sub.VirtFunctions.Address
+		}
+	}
+	if len(vfs) == 0 {
+		return "", fmt.Errorf("network device %s has no SR-IOV virtual functions (enable them with sriov_numvfs)", pf)
+	}
+	if vf >= len(vfs) {
+		return "", fmt.Errorf("network device %s has %d virtual functions, VF %d does not exist", pf, len(vfs), vf)
+	}
+
+	address := vfs[vf]
+	return pciAddress(&libvirtxml.NodeDevicePCICapability{
+		Domain:   address.Domain,
+		Bus:      address.Bus,
+		Slot:     address.Slot,
+		Function: address.Function,
+	}), nil
+}
+
+// nodeDeviceDef gets and parses the definition of the named node device.
+func nodeDeviceDef(lv LibvirtClient, name string) (*libvirtxml.NodeDevice, error) {
+	xmlDesc, err := lv.NodeDeviceGetXMLDesc(name, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host device %s: %w", name, err)
+	}
+	var def libvirtxml.NodeDevice
+	if err := def.Unmarshal(xmlDesc); err != nil {
+		return nil, fmt.Errorf("failed to parse host device %s: %w", name, err)
+	}
+	return &def, nil
+}
@@ -0,0 +1,77 @@
+package host
+
+import (
+	"strings"
+	"testing"
+)
+
+const pfXML = `<device>
+  <name>pci_0000_01_00_0</name>
+  <driver><name>ixgbe</name></driver>
+  <capability type='pci'>
+    <class>0x020000</class>
+    <domain>0</domain>
+    <bus>1</bus>
+    <slot>0</slot>
+    <function>0</function>
+    <capability type='virt_functions' maxCount='63'>
+      <address domain='0x0000' bus='0x01' slot='0x10' function='0x0'/>
+      <address domain='0x0000' bus='0x01' slot='0x10' function='0x2'/>
+      <address domain='0x0000' bus='0x01' slot='0x10' function='0x4'/>
+    </capability>
+  </capability>
+</device>`
+
+const pfNetXML = `<device>
+  <name>net_enp1s0f0_a0_36_9f_12_34_56</name>
+  <parent>pci_0000_01_00_0</parent>
+  <capability type='net'>
+    <interface>enp1s0f0</interface>
+    <address>a0:36:9f:12:34:56</address>
+  </capability>
+</device>`
+
+const plainNetXML = `<device>
+  <name>net_eno1_3c_ec_ef_00_00_01</name>
+  <parent>pci_0000_3b_00_1</parent>
+  <capability type='net'>
+    <interface>eno1</interface>
+    <address>3c:ec:ef:00:00:01</address>
+  </capability>
+</device>`
+
+func TestVFAddress(t *testing.T) {
+	lv := &fakeLibvirt{devices: map[string]string{
+		"pci_0000_01_00_0":               pfXML,
+		"net_enp1s0f0_a0_36_9f_12_34_56": pfNetXML,
+		"pci_0000_3b_00_1":               nicXML,
+		"net_eno1_3c_ec_ef_00_00_01":     plainNetXML,
+	}}
+
+	address, err := VFAddress(lv, "enp1s0f0", 2)
+	if err != nil {
+		t.Fatalf("VFAddress() error = %v", err)
+	}
+	if address != "0000:01:10.4" {
+		t.Errorf("VFAddress() = %q, want 0000:01:10.4", address)
+	}
+
+	tests := []struct {
+		name    string
+		pf      string
+		vf      int
+		wantErr string
+	}{
+		{"unknown device", "enp9s0", 0, "not found on the host"},
+		{"no VFs", "eno1", 0, "has no SR-IOV virtual functions"},
+		{"VF out of range", "enp1s0f0", 3, "VF 3 does not exist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VFAddress(lv, tt.pf, tt.vf)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("VFAddress() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+// Package hostcache caches facts about the hypervisor of each CLI context
+// (host name, libvirt version, capabilities and storage pools), so that
+// commands run over high-latency remote connections don't rediscover them
+// on every invocation.
+package hostcache
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"go.yaml.in/yaml/v3"
+	"libvirt.org/go/libvirtxml"
+)
+
+// EnvVar overrides the cache directory.
+const EnvVar = "FOUNDRY_CACHE_DIR"
+
+// DefaultTTL is how long a cache entry is used before it is refreshed, for
+// contexts that don't set their own.
+const DefaultTTL = time.Hour
+
+// LibvirtClient defines the libvirt operations needed to fill the cache.
+// *libvirt.Libvirt satisfies it.
+type LibvirtClient interface {
+	ConnectGetHostname() (string, error)
+	ConnectGetLibVersion() (uint64, error)
+	ConnectGetCapabilities() (string, error)
+	ConnectListAllStoragePools(NeedResults int32, Flags libvirt.ConnectListAllStoragePoolsFlags) ([]libvirt.StoragePool, uint32, error)
+}
+
+// Entry is what is cached for one context.
+type Entry struct {
+	// URI is the connection URI the entry was fetched over. An entry for
+	// another URI (the context was repointed) is not used.
+	URI string `json:"uri" yaml:"uri"`
+
+	// FetchedAt is when the entry was fetched.
+	FetchedAt time.Time `json:"fetchedAt" yaml:"fetchedAt"`
+
+	// Hostname is the hypervisor's host name.
+	Hostname string `json:"hostname" yaml:"hostname"`
+
+	// LibvirtVersion is the libvirt version, e.g. "10.1.0".
+	LibvirtVersion string `json:"libvirtVersion" yaml:"libvirtVersion"`
+
+	// Arch and CPUModel describe the host CPU from its capabilities.
+	Arch     string `json:"arch,omitempty" yaml:"arch,omitempty"`
+	CPUModel string `json:"cpuModel,omitempty" yaml:"cpuModel,omitempty"`
+
+	// Pools are the names of the storage pools defined on the hypervisor.
+	Pools []string `json:"pools" yaml:"pools"`
+}
+
+// Fresh reports whether the entry was fetched over uri less than ttl
+// before now. A zero or negative ttl disables the cache.
+func (e *Entry) Fresh(uri string, ttl time.Duration, now time.Time) bool {
+	return e != nil && e.URI == uri && ttl > 0 && now.Sub(e.FetchedAt) < ttl
+}
+
+// Fetch queries the hypervisor for a new entry.
+func Fetch(lv LibvirtClient, uri string) (*Entry, error) {
+	hostname, err := lv.ConnectGetHostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+	version, err := lv.ConnectGetLibVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get libvirt version: %w", err)
+	}
+	capsXML, err := lv.ConnectGetCapabilities()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get capabilities: %w", err)
+	}
+	var caps libvirtxml.Caps
+	if err := caps.Unmarshal(capsXML); err != nil {
+		return nil, fmt.Errorf("failed to parse capabilities: %w", err)
+	}
+	pools, _, err := lv.ConnectListAllStoragePools(1, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pools: %w", err)
+	}
+
+	entry := &Entry{
+		URI:            uri,
+		FetchedAt:      time.Now().UTC(),
+		Hostname:       hostname,
+		LibvirtVersion: fmt.Sprintf("%d.%d.%d", version/1000000, (version/1000)%1000, version%1000),
+		Pools:          []string{},
+	}
+	if caps.Host.CPU != nil {
+		entry.Arch = caps.Host.CPU.Arch
+		entry.CPUModel = caps.Host.CPU.Model
+	}
+	for _, pool := range pools {
+		entry.Pools = append(entry.Pools, pool.Name)
+	}
+	sort.Strings(entry.Pools)
+	return entry, nil
+}
+
+// DefaultDir returns the cache directory: $FOUNDRY_CACHE_DIR, else
+// $XDG_CACHE_HOME/foundry.
+func DefaultDir() (string, error) {
+	if dir := os.Getenv(EnvVar); dir != "" {
+		return dir, nil
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine cache directory: %w", err)
+	}
+	return filepath.Join(cacheDir, "foundry"), nil
+}
+
+// path returns the file caching the named context.
+func path(dir, contextName string) string {
+	return filepath.Join(dir, "contexts", url.PathEscape(contextName)+".yaml")
+}
+
+// Load reads the cached entry of a context. A missing entry yields nil.
+func Load(dir, contextName string) (*Entry, error) {
+	data, err := os.ReadFile(path(dir, contextName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache of context %s: %w", contextName, err)
+	}
+
+	var entry Entry
+	if err := yaml.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse cache of context %s: %w", contextName, err)
+	}
+	return &entry, nil
+}
+
+// Save writes the cached entry of a context.
+func Save(dir, contextName string, entry *Entry) error {
+	data, err := yaml.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache: %w", err)
+	}
+	file := path(dir, contextName)
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		return fmt.Errorf("failed to write cache of context %s: %w", contextName, err)
+	}
+	return nil
+}
+
+// Remove deletes the cached entry of a context, if any.
+func Remove(dir, contextName string) error {
+	if err := os.Remove(path(dir, contextName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove cache of context %s: %w", contextName, err)
+	}
+	return nil
+}
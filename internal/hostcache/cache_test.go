@@ -0,0 +1,122 @@
+package hostcache
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+)
+
+// fakeLibvirt answers the queries of Fetch.
+type fakeLibvirt struct {
+	poolsErr error
+}
+
+func (f *fakeLibvirt) ConnectGetHostname() (string, error) { return "hv1", nil }
+
+func (f *fakeLibvirt) ConnectGetLibVersion() (uint64, error) { return 10001002, nil }
+
+func (f *fakeLibvirt) ConnectGetCapabilities() (string, error) {
+	return `<capabilities><host><cpu><arch>x86_64</arch><model>Skylake-Client-IBRS</model></cpu></host></capabilities>`, nil
+}
+
+func (f *fakeLibvirt) ConnectListAllStoragePools(NeedResults int32, Flags libvirt.ConnectListAllStoragePoolsFlags) ([]libvirt.StoragePool, uint32, error) {
+	if f.poolsErr != nil {
+		return nil, 0, f.poolsErr
+	}
+	return []libvirt.StoragePool{{Name: "foundry-vms"}, {Name: "foundry-images"}}, 2, nil
+}
+
+func TestFetch(t *testing.T) {
+	entry, err := Fetch(&fakeLibvirt{}, "qemu+ssh://root@hv1/system")
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if entry.URI != "qemu+ssh://root@hv1/system" || entry.Hostname != "hv1" || entry.LibvirtVersion != "10.1.2" {
+		t.Errorf("Fetch() = %+v", entry)
+	}
+	if entry.Arch != "x86_64" || entry.CPUModel != "Skylake-Client-IBRS" {
+		t.Errorf("Fetch() arch/model = %q/%q", entry.Arch, entry.CPUModel)
+	}
+	if len(entry.Pools) != 2 || entry.Pools[0] != "foundry-images" || entry.Pools[1] != "foundry-vms" {
+		t.Errorf("Fetch() pools = %v, want sorted pool names", entry.Pools)
+	}
+
+	if _, err := Fetch(&fakeLibvirt{poolsErr: errors.New("connection lost")}, ""); err == nil {
+		t.Error("Fetch() expected error")
+	}
+}
+
+func TestEntry_Fresh(t *testing.T) {
+	now := time.Now()
+	entry := &Entry{URI: "qemu+ssh://root@hv1/system", FetchedAt: now.Add(-10 * time.Minute)}
+
+	tests := []struct {
+		name  string
+		entry *Entry
+		uri   string
+		ttl   time.Duration
+		want  bool
+	}{
+		{"within ttl", entry, "qemu+ssh://root@hv1/system", time.Hour, true},
+		{"expired", entry, "qemu+ssh://root@hv1/system", 5 * time.Minute, false},
+		{"other uri", entry, "qemu+ssh://root@hv2/system", time.Hour, false},
+		{"disabled", entry, "qemu+ssh://root@hv1/system", 0, false},
+		{"missing", nil, "qemu+ssh://root@hv1/system", time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.entry.Fresh(tt.uri, tt.ttl, now); got != tt.want {
+				t.Errorf("Fresh() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveLoadRemove(t *testing.T) {
+	dir := t.TempDir()
+
+	entry, err := Load(dir, "hv1")
+	if err != nil || entry != nil {
+		t.Fatalf("Load() of missing entry = %v, %v, want nil", entry, err)
+	}
+
+	saved := &Entry{
+		URI:            "qemu+ssh://root@hv1/system",
+		FetchedAt:      time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Hostname:       "hv1",
+		LibvirtVersion: "10.1.2",
+		Pools:          []string{"foundry-images", "foundry-vms"},
+	}
+	// Context names are user-chosen and may not be valid file names
+	if err := Save(dir, "team/hv1", saved); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	info, err := os.Stat(path(dir, "team/hv1"))
+	if err != nil {
+		t.Fatalf("failed to stat cache: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("cache mode = %04o, want 0600", info.Mode().Perm())
+	}
+
+	loaded, err := Load(dir, "team/hv1")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.URI != saved.URI || !loaded.FetchedAt.Equal(saved.FetchedAt) || len(loaded.Pools) != 2 {
+		t.Errorf("Load() = %+v, want %+v", loaded, saved)
+	}
+
+	if err := Remove(dir, "team/hv1"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := Remove(dir, "team/hv1"); err != nil {
+		t.Errorf("Remove() of missing entry error = %v", err)
+	}
+	if entry, _ := Load(dir, "team/hv1"); entry != nil {
+		t.Error("entry still cached after Remove()")
+	}
+}
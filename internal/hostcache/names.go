@@ -0,0 +1,90 @@
+package hostcache
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// NamesTTL is how long the names cached for shell completion are used. It is
+// short since VMs come and go, but long enough that pressing tab repeatedly
+// connects once.
+const NamesTTL = 30 * time.Second
+
+// Names are the names of the objects on a hypervisor, cached per connection
+// URI for shell completion.
+type Names struct {
+	// URI is the connection URI the names were fetched over ("" for the
+	// local hypervisor).
+	URI string `json:"uri" yaml:"uri"`
+
+	// FetchedAt is when the names were fetched.
+	FetchedAt time.Time `json:"fetchedAt" yaml:"fetchedAt"`
+
+	// VMs, Images and Pools are the sorted names of the VMs, base images
+	// and storage pools.
+	VMs    []string `json:"vms" yaml:"vms"`
+	Images []string `json:"images" yaml:"images"`
+	Pools  []string `json:"pools" yaml:"pools"`
+}
+
+// Fresh reports whether the names were fetched less than NamesTTL before
+// now.
+func (n *Names) Fresh(now time.Time) bool {
+	return n != nil && now.Sub(n.FetchedAt) < NamesTTL
+}
+
+// namesPath returns the file caching the names of the hypervisor at uri.
+func namesPath(dir, uri string) string {
+	if uri == "" {
+		uri = "local"
+	}
+	return filepath.Join(dir, "names", url.PathEscape(uri)+".yaml")
+}
+
+// LoadNames reads the cached names of the hypervisor at uri. Missing names
+// yield nil.
+func LoadNames(dir, uri string) (*Names, error) {
+	data, err := os.ReadFile(namesPath(dir, uri))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached names: %w", err)
+	}
+
+	var names Names
+	if err := yaml.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("failed to parse cached names: %w", err)
+	}
+	return &names, nil
+}
+
+// SaveNames writes the cached names of the hypervisor at names.URI.
+func SaveNames(dir string, names *Names) error {
+	data, err := yaml.Marshal(names)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cached names: %w", err)
+	}
+	file := namesPath(dir, names.URI)
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		return fmt.Errorf("failed to write cached names: %w", err)
+	}
+	return nil
+}
+
+// RemoveNames deletes the cached names of the hypervisor at uri, if any.
+func RemoveNames(dir, uri string) error {
+	if err := os.Remove(namesPath(dir, uri)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove cached names: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package hostcache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNames_Fresh(t *testing.T) {
+	now := time.Now()
+
+	var missing *Names
+	if missing.Fresh(now) {
+		t.Error("nil names are fresh")
+	}
+	if !(&Names{FetchedAt: now.Add(-10 * time.Second)}).Fresh(now) {
+		t.Error("names fetched 10s ago are not fresh")
+	}
+	if (&Names{FetchedAt: now.Add(-NamesTTL)}).Fresh(now) {
+		t.Error("names fetched NamesTTL ago are fresh")
+	}
+}
+
+func TestSaveLoadRemoveNames(t *testing.T) {
+	dir := t.TempDir()
+	uri := "qemu+ssh://root@hv1/system"
+
+	names, err := LoadNames(dir, uri)
+	if err != nil || names != nil {
+		t.Fatalf("LoadNames() of missing names = %v, %v, want nil", names, err)
+	}
+
+	saved := &Names{
+		URI:       uri,
+		FetchedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		VMs:       []string{"db-01", "web-01"},
+		Images:    []string{"fedora-43"},
+		Pools:     []string{"foundry-images", "foundry-vms"},
+	}
+	if err := SaveNames(dir, saved); err != nil {
+		t.Fatalf("SaveNames() error = %v", err)
+	}
+	// The local hypervisor is cached apart from remote ones
+	if err := SaveNames(dir, &Names{VMs: []string{"local-vm"}}); err != nil {
+		t.Fatalf("SaveNames() error = %v", err)
+	}
+
+	loaded, err := LoadNames(dir, uri)
+	if err != nil {
+		t.Fatalf("LoadNames() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, saved) {
+		t.Errorf("LoadNames() = %+v, want %+v", loaded, saved)
+	}
+	local, err := LoadNames(dir, "")
+	if err != nil || local == nil || !reflect.DeepEqual(local.VMs, []string{"local-vm"}) {
+		t.Errorf("LoadNames(local) = %+v, %v", local, err)
+	}
+
+	if err := RemoveNames(dir, uri); err != nil {
+		t.Fatalf("RemoveNames() error = %v", err)
+	}
+	if names, err := LoadNames(dir, uri); err != nil || names != nil {
+		t.Errorf("LoadNames() after remove = %v, %v, want nil", names, err)
+	}
+	if err := RemoveNames(dir, uri); err != nil {
+		t.Errorf("RemoveNames() of missing names error = %v", err)
+	}
+}
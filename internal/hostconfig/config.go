@@ -0,0 +1,161 @@
+// Package hostconfig loads the host-wide configuration of a foundry
+// installation, /etc/foundry/config.yaml: the names and paths of the default
+// storage pools, the libvirt connection, network defaults of new VMs and
+// mirrors of the image catalog.
+//
+// Unlike the per-user CLI config (see clientconfig), the host config applies
+// to every user and to 'foundry serve' and foundry-controller.
+package hostconfig
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/catalog"
+	"github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// DefaultPath is the location of the host config.
+const DefaultPath = "/etc/foundry/config.yaml"
+
+// Config is the host config file.
+type Config struct {
+	// Connect is the libvirt connection URI used when none is given with
+	// --connect, $FOUNDRY_CONNECT or a context.
+	Connect string `yaml:"connect,omitempty"`
+
+	// Storage configures the default storage pools.
+	Storage Storage `yaml:"storage,omitempty"`
+
+	// Network holds network defaults of new VMs.
+	Network Network `yaml:"network,omitempty"`
+
+	// Catalog configures the image catalog of 'foundry image pull'.
+	Catalog Catalog `yaml:"catalog,omitempty"`
+}
+
+// Storage configures the default storage pools, which foundry creates as
+// directory pools when missing. Empty fields keep the built-in defaults.
+type Storage struct {
+	// ImagesPool and ImagesPath are the name and directory of the pool for
+	// base images (default foundry-images in
+	// /var/lib/libvirt/images/foundry/images).
+	ImagesPool string `yaml:"imagesPool,omitempty"`
+	ImagesPath string `yaml:"imagesPath,omitempty"`
+
+	// VMsPool and VMsPath are the name and directory of the pool for VM
+	// disks (default foundry-vms in /var/lib/libvirt/images/foundry/vms).
+	VMsPool string `yaml:"vmsPool,omitempty"`
+	VMsPath string `yaml:"vmsPath,omitempty"`
+}
+
+// Network holds network defaults of new VMs. Fields a VM spec sets take
+// precedence.
+type Network struct {
+	// Bridge is attached to network interfaces that name no bridge,
+	// network, macvtap device or SR-IOV VF.
+	Bridge string `yaml:"bridge,omitempty"`
+
+	// DNSServers are used by static interfaces when neither they nor
+	// spec.networkDefaults set any.
+	DNSServers []string `yaml:"dnsServers,omitempty"`
+}
+
+// Catalog configures the image catalog.
+type Catalog struct {
+	// Mirrors maps upstream URL prefixes to the mirrors images are
+	// downloaded from instead, e.g.
+	// "https://cloud.debian.org/images/": "https://mirror.example.com/debian/".
+	Mirrors map[string]string `yaml:"mirrors,omitempty"`
+}
+
+// Load reads the host config at path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read host config %s: %w", path, err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse host config %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid host config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// LoadDefault reads the host config at DefaultPath. A missing file yields an
+// empty config.
+func LoadDefault() (*Config, error) {
+	cfg, err := Load(DefaultPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	return cfg, err
+}
+
+// Validate checks the config for values foundry cannot use.
+func (c *Config) Validate() error {
+	for field, path := range map[string]string{
+		"storage.imagesPath": c.Storage.ImagesPath,
+		"storage.vmsPath":    c.Storage.VMsPath,
+	} {
+		if path != "" && !filepath.IsAbs(path) {
+			return fmt.Errorf("%s %q must be an absolute path", field, path)
+		}
+	}
+	if c.Storage.ImagesPool != "" && c.Storage.ImagesPool == c.Storage.VMsPool {
+		return fmt.Errorf("storage.imagesPool and storage.vmsPool must differ")
+	}
+
+	for i, server := range c.Network.DNSServers {
+		if net.ParseIP(server) == nil {
+			return fmt.Errorf("network.dnsServers[%d] %q is not an IP address", i, server)
+		}
+	}
+
+	for upstream, mirror := range c.Catalog.Mirrors {
+		for _, rawURL := range []string{upstream, mirror} {
+			u, err := url.Parse(rawURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("catalog.mirrors: %q is not an http or https URL", rawURL)
+			}
+		}
+	}
+	return nil
+}
+
+// Apply makes the config the default of this process: the storage pools,
+// the network defaults VMs are loaded with and the catalog mirrors. Connect
+// is used only if no connection URI was set otherwise (see
+// libvirt.DefaultURI), so Apply must come after the command line is
+// handled.
+func (c *Config) Apply() {
+	storage.SetDefaultPools(storage.DefaultPools{
+		ImagesPool: c.Storage.ImagesPool,
+		ImagesPath: c.Storage.ImagesPath,
+		VMsPool:    c.Storage.VMsPool,
+		VMsPath:    c.Storage.VMsPath,
+	})
+	v1alpha1.SetHostDefaults(v1alpha1.HostDefaults{
+		StoragePool: c.Storage.VMsPool,
+		ImagePool:   c.Storage.ImagesPool,
+		Bridge:      c.Network.Bridge,
+		DNSServers:  c.Network.DNSServers,
+	})
+	catalog.SetMirrors(c.Catalog.Mirrors)
+
+	if c.Connect != "" && libvirt.DefaultURI() == "" {
+		libvirt.SetDefaultURI(c.Connect)
+	}
+}
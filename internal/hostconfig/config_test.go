@@ -0,0 +1,129 @@
+package hostconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/catalog"
+	"github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfig(t, `
+connect: qemu+ssh://root@hv1/system
+storage:
+  imagesPool: images
+  imagesPath: /srv/foundry/images
+  vmsPool: vms
+  vmsPath: /srv/foundry/vms
+network:
+  bridge: br0
+  dnsServers: [10.0.0.53, "2001:db8::53"]
+catalog:
+  mirrors:
+    https://cloud.debian.org/images/: https://mirror.example.com/debian/
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Connect != "qemu+ssh://root@hv1/system" || cfg.Storage.VMsPath != "/srv/foundry/vms" || cfg.Network.Bridge != "br0" ||
+		len(cfg.Network.DNSServers) != 2 || cfg.Catalog.Mirrors["https://cloud.debian.org/images/"] != "https://mirror.example.com/debian/" {
+		t.Errorf("Load() = %+v", cfg)
+	}
+}
+
+func TestLoad_Missing(t *testing.T) {
+	_, err := Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Load() error = %v, want not exist", err)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{name: "relative path", config: "storage:\n  vmsPath: vms\n", wantErr: "storage.vmsPath \"vms\" must be an absolute path"},
+		{name: "same pool", config: "storage:\n  imagesPool: pool\n  vmsPool: pool\n", wantErr: "must differ"},
+		{name: "bad dns", config: "network:\n  dnsServers: [dns.example.com]\n", wantErr: "is not an IP address"},
+		{name: "bad mirror", config: "catalog:\n  mirrors:\n    https://cloud.debian.org/: mirror.example.com\n", wantErr: "is not an http or https URL"},
+		{name: "bad yaml", config: "storage: [\n", wantErr: "failed to parse host config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, tt.config))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	t.Setenv(libvirt.ConnectEnvVar, "")
+	t.Cleanup(func() {
+		(&Config{}).Apply()
+		libvirt.SetDefaultURI("")
+	})
+
+	cfg := &Config{
+		Connect: "qemu+ssh://root@hv1/system",
+		Storage: Storage{ImagesPool: "images", VMsPool: "vms", VMsPath: "/srv/foundry/vms"},
+		Network: Network{Bridge: "br0", DNSServers: []string{"10.0.0.53"}},
+		Catalog: Catalog{Mirrors: map[string]string{"https://cloud.debian.org/": "https://mirror.example.com/"}},
+	}
+	cfg.Apply()
+
+	if pools := storage.GetDefaultPools(); pools.ImagesPool != "images" || pools.VMsPool != "vms" ||
+		pools.VMsPath != "/srv/foundry/vms" || pools.ImagesPath != storage.DefaultImagesPath {
+		t.Errorf("default pools = %+v", pools)
+	}
+	if libvirt.DefaultURI() != "qemu+ssh://root@hv1/system" {
+		t.Errorf("DefaultURI() = %q", libvirt.DefaultURI())
+	}
+	if image, _ := catalog.Lookup("debian-12"); !strings.HasPrefix(image.URL, "https://mirror.example.com/") {
+		t.Errorf("catalog URL = %s, want the mirror", image.URL)
+	}
+
+	vm := &v1alpha1.VirtualMachine{Spec: v1alpha1.VirtualMachineSpec{
+		NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{{IP: "10.0.0.10/24"}, {Network: "default"}},
+	}}
+	vm.ApplyHostDefaults()
+	if vm.Spec.StoragePool != "vms" || vm.Spec.BootDisk.ImagePool != "images" {
+		t.Errorf("pools = %s, %s", vm.Spec.StoragePool, vm.Spec.BootDisk.ImagePool)
+	}
+	if vm.Spec.NetworkInterfaces[0].Bridge != "br0" || vm.Spec.NetworkInterfaces[1].Bridge != "" {
+		t.Errorf("bridges = %q, %q", vm.Spec.NetworkInterfaces[0].Bridge, vm.Spec.NetworkInterfaces[1].Bridge)
+	}
+	if vm.Spec.NetworkDefaults == nil || len(vm.Spec.NetworkDefaults.DNSServers) != 1 {
+		t.Errorf("networkDefaults = %+v", vm.Spec.NetworkDefaults)
+	}
+}
+
+func TestApply_KeepsConnection(t *testing.T) {
+	t.Setenv(libvirt.ConnectEnvVar, "qemu+tcp://hv2/system")
+	t.Cleanup(func() { libvirt.SetDefaultURI("") })
+
+	(&Config{Connect: "qemu+ssh://root@hv1/system"}).Apply()
+	if libvirt.DefaultURI() != "qemu+tcp://hv2/system" {
+		t.Errorf("DefaultURI() = %q, want $%s", libvirt.DefaultURI(), libvirt.ConnectEnvVar)
+	}
+}
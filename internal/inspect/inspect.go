@@ -0,0 +1,129 @@
+// Package inspect discovers the addresses a running VM actually uses.
+//
+// The stored spec only knows static addresses; addresses handed out by DHCP
+// or configured inside the guest are found by asking libvirt, which has three
+// sources:
+//   - Agent: the QEMU guest agent reports the addresses of every guest
+//     interface. Requires qemu-guest-agent in the guest.
+//   - Lease: the dnsmasq leases of libvirt-managed networks. Only covers
+//     interfaces attached to a libvirt network.
+//   - ARP: the host's ARP table. Covers bridged interfaces, but only once the
+//     host has exchanged traffic with the guest.
+//
+// All sources are queried and their results merged, so whatever any of them
+// knows is reported.
+package inspect
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/digitalocean/go-libvirt"
+)
+
+// LibvirtClient defines the minimal libvirt operations needed for address
+// discovery.
+//
+// This interface is defined on the consumer side (this package) following the
+// same pattern as storage.LibvirtClient. *libvirt.Libvirt satisfies it
+// implicitly.
+type LibvirtClient interface {
+	DomainInterfaceAddresses(Dom libvirt.Domain, Source uint32, Flags uint32) ([]libvirt.DomainInterface, error)
+}
+
+// Source is where an address was discovered.
+type Source string
+
+const (
+	// SourceAgent addresses are reported by the QEMU guest agent.
+	SourceAgent Source = "agent"
+
+	// SourceLease addresses are DHCP leases of a libvirt network.
+	SourceLease Source = "lease"
+
+	// SourceARP addresses are entries of the host's ARP table.
+	SourceARP Source = "arp"
+)
+
+// sources are queried in this order; the agent is the most complete and
+// accurate, ARP entries may be stale.
+var sources = []struct {
+	source Source
+	flag   libvirt.DomainInterfaceAddressesSource
+}{
+	{SourceAgent, libvirt.DomainInterfaceAddressesSrcAgent},
+	{SourceLease, libvirt.DomainInterfaceAddressesSrcLease},
+	{SourceARP, libvirt.DomainInterfaceAddressesSrcArp},
+}
+
+// Address is an IP address discovered on a VM interface.
+type Address struct {
+	// MACAddress is the MAC address of the interface, lower case.
+	MACAddress string
+
+	// IP is the address without prefix length.
+	IP string
+
+	// Prefix is the prefix length, if the source reports one.
+	Prefix uint32
+
+	// Source is where the address was discovered.
+	Source Source
+}
+
+// Addresses returns the IP addresses of a running domain. If macs is not
+// empty only addresses of interfaces with these MAC addresses are returned,
+// which leaves out interfaces created inside the guest (e.g. container
+// bridges). Loopback and link-local addresses are never returned.
+//
+// Sources that are unavailable, such as the guest agent of a guest without
+// one, are skipped; an error is only returned if every source failed.
+func Addresses(lv LibvirtClient, domain libvirt.Domain, macs []string) ([]Address, error) {
+	wanted := make(map[string]bool, len(macs))
+	for _, mac := range macs {
+		wanted[strings.ToLower(mac)] = true
+	}
+
+	var addresses []Address
+	seen := make(map[string]bool)
+	var errs []string
+	for _, s := range sources {
+		ifaces, err := lv.DomainInterfaceAddresses(domain, uint32(s.flag), 0)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", s.source, err))
+			continue
+		}
+
+		for _, iface := range ifaces {
+			mac := ""
+			if len(iface.Hwaddr) > 0 {
+				mac = strings.ToLower(iface.Hwaddr[0])
+			}
+			if len(wanted) > 0 && !wanted[mac] {
+				continue
+			}
+			for _, addr := range iface.Addrs {
+				ip := net.ParseIP(addr.Addr)
+				if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+					continue
+				}
+				if seen[ip.String()] {
+					continue
+				}
+				seen[ip.String()] = true
+				addresses = append(addresses, Address{
+					MACAddress: mac,
+					IP:         ip.String(),
+					Prefix:     addr.Prefix,
+					Source:     s.source,
+				})
+			}
+		}
+	}
+
+	if len(errs) == len(sources) {
+		return nil, fmt.Errorf("failed to discover addresses: %s", strings.Join(errs, "; "))
+	}
+	return addresses, nil
+}
@@ -0,0 +1,97 @@
+package inspect
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+)
+
+// mockLibvirtClient returns canned interfaces per address source.
+type mockLibvirtClient struct {
+	ifaces map[libvirt.DomainInterfaceAddressesSource][]libvirt.DomainInterface
+	errs   map[libvirt.DomainInterfaceAddressesSource]error
+}
+
+func (m *mockLibvirtClient) DomainInterfaceAddresses(_ libvirt.Domain, source uint32, _ uint32) ([]libvirt.DomainInterface, error) {
+	src := libvirt.DomainInterfaceAddressesSource(source)
+	if err := m.errs[src]; err != nil {
+		return nil, err
+	}
+	return m.ifaces[src], nil
+}
+
+func iface(mac string, addrs ...string) libvirt.DomainInterface {
+	i := libvirt.DomainInterface{Name: "eth0", Hwaddr: libvirt.OptString{mac}}
+	for _, a := range addrs {
+		i.Addrs = append(i.Addrs, libvirt.DomainIPAddr{Addr: a, Prefix: 24})
+	}
+	return i
+}
+
+func TestAddresses(t *testing.T) {
+	lv := &mockLibvirtClient{
+		ifaces: map[libvirt.DomainInterfaceAddressesSource][]libvirt.DomainInterface{
+			libvirt.DomainInterfaceAddressesSrcAgent: {
+				iface("00:00:00:00:00:00", "127.0.0.1", "::1"),
+				iface("BE:EF:0A:00:00:0A", "10.0.0.10", "fe80::1"),
+				iface("02:42:ac:11:00:01", "172.17.0.1"),
+			},
+			libvirt.DomainInterfaceAddressesSrcLease: {
+				iface("52:54:00:12:34:56", "192.168.122.50"),
+			},
+			libvirt.DomainInterfaceAddressesSrcArp: {
+				iface("be:ef:0a:00:00:0a", "10.0.0.10"),
+			},
+		},
+	}
+
+	got, err := Addresses(lv, libvirt.Domain{Name: "test-vm"}, []string{"be:ef:0a:00:00:0a", "52:54:00:12:34:56"})
+	if err != nil {
+		t.Fatalf("Addresses() error = %v", err)
+	}
+	want := []Address{
+		{MACAddress: "be:ef:0a:00:00:0a", IP: "10.0.0.10", Prefix: 24, Source: SourceAgent},
+		{MACAddress: "52:54:00:12:34:56", IP: "192.168.122.50", Prefix: 24, Source: SourceLease},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Addresses() = %+v, want %+v", got, want)
+	}
+
+	// Without MACs every guest interface is reported
+	got, err = Addresses(lv, libvirt.Domain{Name: "test-vm"}, nil)
+	if err != nil {
+		t.Fatalf("Addresses() error = %v", err)
+	}
+	if len(got) != 3 || got[1].IP != "172.17.0.1" {
+		t.Errorf("Addresses() = %+v, want 3 addresses including 172.17.0.1", got)
+	}
+}
+
+func TestAddresses_SourceErrors(t *testing.T) {
+	// No guest agent: the other sources still count
+	lv := &mockLibvirtClient{
+		ifaces: map[libvirt.DomainInterfaceAddressesSource][]libvirt.DomainInterface{
+			libvirt.DomainInterfaceAddressesSrcArp: {iface("be:ef:0a:00:00:0a", "10.0.0.10")},
+		},
+		errs: map[libvirt.DomainInterfaceAddressesSource]error{
+			libvirt.DomainInterfaceAddressesSrcAgent: fmt.Errorf("guest agent is not responding"),
+		},
+	}
+	got, err := Addresses(lv, libvirt.Domain{Name: "test-vm"}, nil)
+	if err != nil {
+		t.Fatalf("Addresses() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Source != SourceARP {
+		t.Errorf("Addresses() = %+v, want the ARP address", got)
+	}
+
+	// Every source failing is an error
+	lv.errs[libvirt.DomainInterfaceAddressesSrcLease] = fmt.Errorf("no network")
+	lv.errs[libvirt.DomainInterfaceAddressesSrcArp] = fmt.Errorf("unsupported")
+	if _, err := Addresses(lv, libvirt.Domain{Name: "test-vm"}, nil); err == nil || !strings.Contains(err.Error(), "agent: guest agent is not responding") {
+		t.Errorf("Addresses() error = %v, want error naming each source", err)
+	}
+}
@@ -0,0 +1,208 @@
+// Package journal records the resources created while a VM is being created,
+// so that a creation interrupted by a crash or kill can be rolled back later
+// (see 'foundry gc').
+//
+// Each creation in progress has one JSON file named after the VM. The file is
+// written as resources are created and removed once the creation has
+// finished, successfully or after cleaning up; a file that outlives its
+// process marks an incomplete creation.
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EnvVar overrides the journal directory.
+const EnvVar = "FOUNDRY_JOURNAL_DIR"
+
+// SystemDir is the journal directory when running as root.
+const SystemDir = "/var/lib/foundry/journal"
+
+// Resource kinds.
+const (
+	KindVolume = "volume"
+	KindDomain = "domain"
+)
+
+// Resource is a resource created for a VM.
+type Resource struct {
+	// Kind is KindVolume or KindDomain.
+	Kind string `json:"kind"`
+
+	// Pool is the storage pool of a volume.
+	Pool string `json:"pool,omitempty"`
+
+	// Name is the name of the volume or domain.
+	Name string `json:"name"`
+
+	// UUID is the UUID of a domain, which tells it apart from a domain of
+	// the same name defined later.
+	UUID string `json:"uuid,omitempty"`
+}
+
+// String returns the resource as "volume pool/name" or "domain name".
+func (r Resource) String() string {
+	if r.Pool != "" {
+		return r.Kind + " " + r.Pool + "/" + r.Name
+	}
+	return r.Kind + " " + r.Name
+}
+
+// Entry is the journal of one creation.
+type Entry struct {
+	// VM is the name of the VM being created.
+	VM string `json:"vm"`
+
+	// PID is the process creating the VM, and Hostname the host it runs on.
+	PID      int    `json:"pid"`
+	Hostname string `json:"hostname"`
+
+	// URI is the libvirt connection URI the VM is created on; empty for
+	// the default local connection.
+	URI string `json:"uri,omitempty"`
+
+	// StartedAt is when the first resource was created.
+	StartedAt time.Time `json:"startedAt"`
+
+	// Resources are the resources created so far, in creation order.
+	Resources []Resource `json:"resources"`
+}
+
+// DefaultDir returns the journal directory: $FOUNDRY_JOURNAL_DIR, else
+// SystemDir for root and $XDG_STATE_HOME/foundry/journal (by default
+// ~/.local/state/foundry/journal) for other users.
+func DefaultDir() (string, error) {
+	if dir := os.Getenv(EnvVar); dir != "" {
+		return dir, nil
+	}
+	if os.Geteuid() == 0 {
+		return SystemDir, nil
+	}
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to determine journal directory: %w", err)
+		}
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateHome, "foundry", "journal"), nil
+}
+
+// path returns the journal file of a VM.
+func path(dir, vm string) string {
+	return filepath.Join(dir, url.PathEscape(vm)+".json")
+}
+
+// Journal records the resources of one creation. Nothing is written until
+// the first resource is recorded. It is safe for concurrent use.
+type Journal struct {
+	dir string
+	uri string
+
+	mu    sync.Mutex
+	entry *Entry
+}
+
+// New returns a journal writing to dir for a creation on the libvirt
+// connection uri.
+func New(dir, uri string) *Journal {
+	return &Journal{dir: dir, uri: uri}
+}
+
+// Record adds a resource created for vm and writes the journal. All the
+// resources of a journal must belong to the same VM.
+func (j *Journal) Record(vm string, r Resource) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.entry == nil {
+		hostname, _ := os.Hostname()
+		j.entry = &Entry{VM: vm, PID: os.Getpid(), Hostname: hostname, URI: j.uri, StartedAt: time.Now().UTC()}
+	} else if j.entry.VM != vm {
+		return fmt.Errorf("journal of VM %s cannot record a resource of VM %s", j.entry.VM, vm)
+	}
+	j.entry.Resources = append(j.entry.Resources, r)
+	return Save(j.dir, j.entry)
+}
+
+// Close removes the journal: the creation finished and no longer needs to
+// be rolled back.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.entry == nil {
+		return nil
+	}
+	return Remove(j.dir, j.entry.VM)
+}
+
+// Save writes an entry, replacing the file atomically so a crash never
+// leaves a truncated journal.
+func Save(dir string, entry *Entry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	file := path(dir, entry.VM)
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write journal of VM %s: %w", entry.VM, err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return fmt.Errorf("failed to write journal of VM %s: %w", entry.VM, err)
+	}
+	return nil
+}
+
+// List returns the entries in dir, sorted by VM name. A missing directory
+// holds no entries.
+func List(dir string) ([]Entry, error) {
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal directory: %w", err)
+	}
+
+	var entries []Entry
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read journal %s: %w", f.Name(), err)
+		}
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse journal %s: %w", f.Name(), err)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, k int) bool { return entries[i].VM < entries[k].VM })
+	return entries, nil
+}
+
+// Remove deletes the journal of a VM, if any.
+func Remove(dir, vm string) error {
+	if err := os.Remove(path(dir, vm)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove journal of VM %s: %w", vm, err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	dir := t.TempDir()
+	j := New(dir, "qemu+ssh://hv2/system")
+
+	// Nothing is written before the first resource
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	boot := Resource{Kind: KindVolume, Pool: "foundry-vms", Name: "web-1_boot.qcow2"}
+	domain := Resource{Kind: KindDomain, Name: "web-1", UUID: "8f2c8a51-4e59-4a9e-9d3c-2d5b0f1e7a10"}
+	for _, r := range []Resource{boot, domain} {
+		if err := j.Record("web-1", r); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	if err := j.Record("web-2", boot); err == nil {
+		t.Error("Record() of another VM error = nil")
+	}
+
+	entries, err := List(dir)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("List() = %+v, want one entry", entries)
+	}
+	got := entries[0]
+	if got.VM != "web-1" || got.PID != os.Getpid() || got.URI != "qemu+ssh://hv2/system" || got.StartedAt.IsZero() {
+		t.Errorf("entry = %+v", got)
+	}
+	if !reflect.DeepEqual(got.Resources, []Resource{boot, domain}) {
+		t.Errorf("resources = %+v, want boot volume and domain", got.Resources)
+	}
+
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if entries, _ := List(dir); len(entries) != 0 {
+		t.Errorf("List() after Close() = %+v, want none", entries)
+	}
+}
+
+func TestList_MissingDir(t *testing.T) {
+	entries, err := List(filepath.Join(t.TempDir(), "missing"))
+	if err != nil || len(entries) != 0 {
+		t.Errorf("List() = %+v, %v, want no entries", entries, err)
+	}
+}
+
+func TestDefaultDir(t *testing.T) {
+	t.Setenv(EnvVar, "/tmp/journal")
+	if dir, err := DefaultDir(); err != nil || dir != "/tmp/journal" {
+		t.Errorf("DefaultDir() = %q, %v, want the %s override", dir, err, EnvVar)
+	}
+}
+
+func TestResource_String(t *testing.T) {
+	if got := (Resource{Kind: KindVolume, Pool: "foundry-vms", Name: "web-1_boot.qcow2"}).String(); got != "volume foundry-vms/web-1_boot.qcow2" {
+		t.Errorf("String() = %q", got)
+	}
+	if got := (Resource{Kind: KindDomain, Name: "web-1"}).String(); got != "domain web-1" {
+		t.Errorf("String() = %q", got)
+	}
+}
@@ -0,0 +1,178 @@
+// Package labels parses label selectors and matches them against the labels
+// of VMs, in the syntax of Kubernetes equality- and set-based selectors:
+//
+//	env=prod,tier!=db
+//	env in (prod,staging),!experimental
+package labels
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Operator is how a requirement compares a label.
+type Operator string
+
+const (
+	// Equals requires the label to have the value.
+	Equals Operator = "="
+
+	// NotEquals requires the label to be missing or have another value.
+	NotEquals Operator = "!="
+
+	// In requires the label to have one of the values.
+	In Operator = "in"
+
+	// NotIn requires the label to be missing or have none of the values.
+	NotIn Operator = "notin"
+
+	// Exists requires the label to be set.
+	Exists Operator = "exists"
+
+	// DoesNotExist requires the label not to be set.
+	DoesNotExist Operator = "!"
+)
+
+// Requirement is one comma-separated term of a selector.
+type Requirement struct {
+	Key      string
+	Operator Operator
+	Values   []string
+}
+
+// Selector matches labels that satisfy all of its requirements. An empty
+// selector matches everything.
+type Selector []Requirement
+
+var (
+	keyPattern   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+	valuePattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?)?$`)
+	setPattern   = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+)
+
+// Parse parses a selector such as "env=prod,tier!=db". Terms are key=value
+// (or key==value), key!=value, key in (v1,v2), key notin (v1,v2), key and
+// !key.
+func Parse(s string) (Selector, error) {
+	var selector Selector
+	for _, term := range splitTerms(s) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			return nil, fmt.Errorf("invalid selector %q: empty term", s)
+		}
+		req, err := parseRequirement(term)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", s, err)
+		}
+		selector = append(selector, req)
+	}
+	return selector, nil
+}
+
+// splitTerms splits s at the commas outside parentheses.
+func splitTerms(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	var terms []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, s[start:])
+}
+
+// parseRequirement parses a single selector term.
+func parseRequirement(term string) (Requirement, error) {
+	var req Requirement
+	switch {
+	case setPattern.MatchString(term):
+		m := setPattern.FindStringSubmatch(term)
+		req = Requirement{Key: m[1], Operator: Operator(m[2])}
+		for _, value := range strings.Split(m[3], ",") {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				return Requirement{}, fmt.Errorf("invalid label value \"\" in %q", term)
+			}
+			req.Values = append(req.Values, value)
+		}
+	case strings.HasPrefix(term, "!"):
+		req = Requirement{Key: strings.TrimSpace(term[1:]), Operator: DoesNotExist}
+	case strings.Contains(term, "!="):
+		key, value, _ := strings.Cut(term, "!=")
+		req = Requirement{Key: strings.TrimSpace(key), Operator: NotEquals, Values: []string{strings.TrimSpace(value)}}
+	case strings.Contains(term, "="):
+		key, value, _ := strings.Cut(term, "=")
+		value = strings.TrimPrefix(value, "=")
+		req = Requirement{Key: strings.TrimSpace(key), Operator: Equals, Values: []string{strings.TrimSpace(value)}}
+	default:
+		req = Requirement{Key: term, Operator: Exists}
+	}
+
+	if !keyPattern.MatchString(req.Key) {
+		return Requirement{}, fmt.Errorf("invalid label key %q in %q", req.Key, term)
+	}
+	for _, value := range req.Values {
+		if !valuePattern.MatchString(value) {
+			return Requirement{}, fmt.Errorf("invalid label value %q in %q", value, term)
+		}
+	}
+	return req, nil
+}
+
+// Matches reports whether labels satisfy every requirement of s.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, req := range s {
+		if !req.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches reports whether labels satisfy r.
+func (r Requirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	switch r.Operator {
+	case Equals, In:
+		return ok && slices.Contains(r.Values, value)
+	case NotEquals, NotIn:
+		return !ok || !slices.Contains(r.Values, value)
+	case Exists:
+		return ok
+	case DoesNotExist:
+		return !ok
+	default:
+		return false
+	}
+}
+
+// String returns the selector in the syntax Parse accepts.
+func (s Selector) String() string {
+	terms := make([]string, 0, len(s))
+	for _, req := range s {
+		switch req.Operator {
+		case Equals, NotEquals:
+			terms = append(terms, req.Key+string(req.Operator)+req.Values[0])
+		case In, NotIn:
+			terms = append(terms, fmt.Sprintf("%s %s (%s)", req.Key, req.Operator, strings.Join(req.Values, ",")))
+		case Exists:
+			terms = append(terms, req.Key)
+		case DoesNotExist:
+			terms = append(terms, "!"+req.Key)
+		}
+	}
+	return strings.Join(terms, ",")
+}
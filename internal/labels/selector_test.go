@@ -0,0 +1,92 @@
+package labels
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     string
+	}{
+		{"", ""},
+		{"env=prod", "env=prod"},
+		{"env==prod", "env=prod"},
+		{" env = prod , tier!=db ", "env=prod,tier!=db"},
+		{"env in (prod, staging),!experimental", "env in (prod,staging),!experimental"},
+		{"env notin (dev),team", "env notin (dev),team"},
+		{"app.example.com/role=web", "app.example.com/role=web"},
+		{"env=", "env="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			selector, err := Parse(tt.selector)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := selector.String(); got != tt.want {
+				t.Errorf("Parse().String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		selector string
+		wantErr  string
+	}{
+		{"env=prod,", "empty term"},
+		{"=prod", `invalid label key ""`},
+		{"env=pr od", `invalid label value "pr od"`},
+		{"-env", `invalid label key "-env"`},
+		{"env in (prod,)", `invalid label value ""`},
+		{"!", `invalid label key ""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			_, err := Parse(tt.selector)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSelector_Matches(t *testing.T) {
+	labels := map[string]string{"env": "prod", "team": "ci"}
+
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{"", true},
+		{"env=prod", true},
+		{"env=staging", false},
+		{"env=prod,team=ci", true},
+		{"env=prod,team=web", false},
+		{"env!=staging", true},
+		{"tier!=db", true},
+		{"env in (prod,staging)", true},
+		{"env in (dev)", false},
+		{"tier in (db)", false},
+		{"env notin (dev)", true},
+		{"env notin (prod)", false},
+		{"team", true},
+		{"tier", false},
+		{"!tier", true},
+		{"!team", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			selector, err := Parse(tt.selector)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := selector.Matches(labels); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,10 +3,16 @@ package libvirt
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
 	"time"
 
 	"github.com/digitalocean/go-libvirt"
 	"github.com/digitalocean/go-libvirt/socket/dialers"
+
+	"github.com/jbweber/foundry/internal/timing"
 )
 
 // Client wraps a go-libvirt connection and provides high-level operations
@@ -15,23 +21,173 @@ type Client struct {
 	libvirt *libvirt.Libvirt
 }
 
-// Connect establishes a connection to the local libvirt daemon.
+const (
+	// DefaultSocketPath is the local libvirt socket used for qemu:///system.
+	DefaultSocketPath = "/var/run/libvirt/libvirt-sock"
+
+	// ConnectEnvVar is the environment variable holding the default
+	// connection URI, used when no URI is passed explicitly.
+	ConnectEnvVar = "FOUNDRY_CONNECT"
+)
+
+// ErrNoLocalHypervisor is returned when no connection URI is configured and
+// foundry runs on a platform without a local hypervisor (see LocalHypervisor).
+var ErrNoLocalHypervisor = fmt.Errorf("foundry cannot manage a local hypervisor on %s; connect to a remote one with --connect (e.g., qemu+ssh://root@hv1/system), $%s or a context", runtime.GOOS, ConnectEnvVar)
+
+// defaultURI overrides ConnectEnvVar when set (e.g., from the CLI --connect flag).
+var defaultURI string
+
+// remoteConnectHook is called with each new remote connection.
+var remoteConnectHook func(uri string, client *Client)
+
+// SetRemoteConnectHook registers a function called with each new connection
+// to a remote hypervisor, before Connect returns it. The CLI uses it to
+// refresh its per-context cache over a connection the command opens anyway.
+func SetRemoteConnectHook(hook func(uri string, client *Client)) {
+	remoteConnectHook = hook
+}
+
+// SetDefaultURI sets the connection URI used when Connect is called with an
+// empty URI. It takes precedence over the FOUNDRY_CONNECT environment variable.
+func SetDefaultURI(uri string) {
+	defaultURI = uri
+}
+
+// DefaultURI returns the connection URI used when Connect is called with an
+// empty URI: the value from SetDefaultURI, else $FOUNDRY_CONNECT, else "" (the
+// local qemu:///system socket).
+func DefaultURI() string {
+	if defaultURI != "" {
+		return defaultURI
+	}
+	return os.Getenv(ConnectEnvVar)
+}
+
+// IsRemote reports whether uri (or the default URI if empty) connects to a
+// libvirt daemon over the network rather than a local Unix socket.
+func IsRemote(uri string) bool {
+	if uri == "" {
+		uri = DefaultURI()
+	}
+	if uri == "" || strings.HasPrefix(uri, "/") {
+		return false
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	return !isLocalURI(u)
+}
+
+// RemoteHost returns the host name of the hypervisor uri (or the default URI
+// if empty) connects to, or "" for local connections.
+func RemoteHost(uri string) string {
+	if uri == "" {
+		uri = DefaultURI()
+	}
+	if !IsRemote(uri) {
+		return ""
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// isLocalURI reports whether a parsed libvirt URI uses the Unix socket
+// transport (e.g., qemu:///system or qemu+unix:///system).
+func isLocalURI(u *url.URL) bool {
+	scheme := strings.SplitN(u.Scheme, "+", 2)
+	if len(scheme) > 1 {
+		return scheme[1] == "unix"
+	}
+	return u.Host == ""
+}
+
+// RequireLocal returns an error unless foundry runs on the hypervisor it
+// manages: on Linux, with a local connection. feature names what needs the
+// hypervisor host in the error, e.g. "doctor".
+func RequireLocal(feature string) error {
+	if !LocalHypervisor {
+		return fmt.Errorf("%s runs on the hypervisor host, and foundry cannot manage a hypervisor on %s", feature, runtime.GOOS)
+	}
+	if IsRemote("") {
+		return fmt.Errorf("%s checks the local host; run it on the hypervisor instead of with a remote connection", feature)
+	}
+	return nil
+}
+
+// Connect establishes a connection to a libvirt daemon.
 // It returns a Client that must be closed via Close() when done.
 //
-// If socketPath is empty, defaults to "/var/run/libvirt/libvirt-sock" (qemu:///system)
-// If timeout is zero, defaults to 5 seconds.
+// uri may be:
+//   - empty: use DefaultURI(), falling back to the local qemu:///system socket
+//   - an absolute socket path (e.g., "/var/run/libvirt/libvirt-sock")
+//   - a libvirt URI: qemu:///system, qemu+unix:///system?socket=/path,
+//     qemu+ssh://user@host/system, qemu+tcp://host/system,
+//     qemu+tls://host/system (plus the query options libvirt supports,
+//     such as keyfile, pkipath and no_verify)
+//
+// If timeout is zero, defaults to 5 seconds. The timeout applies to local
+// socket connections; remote transports use their own dial timeouts.
 //
-// This matches the Ansible implementation which uses the default
-// local qemu:///system connection (UNIX domain socket).
-func Connect(socketPath string, timeout time.Duration) (*Client, error) {
+// With no URI configured this matches the Ansible implementation which uses
+// the default local qemu:///system connection (UNIX domain socket). Outside
+// Linux there is no default connection and ErrNoLocalHypervisor is returned.
+func Connect(uri string, timeout time.Duration) (*Client, error) {
 	// Set defaults
-	if socketPath == "" {
-		socketPath = "/var/run/libvirt/libvirt-sock"
+	if uri == "" {
+		uri = DefaultURI()
+	}
+	if uri == "" && !LocalHypervisor {
+		return nil, ErrNoLocalHypervisor
 	}
 	if timeout == 0 {
 		timeout = 5 * time.Second
 	}
 
+	// Plain socket paths (and the default) use the local dialer directly
+	if uri == "" || strings.HasPrefix(uri, "/") {
+		socketPath := uri
+		if socketPath == "" {
+			socketPath = DefaultSocketPath
+		}
+		return connectLocal(socketPath, libvirt.QEMUSystem, timeout)
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid libvirt URI %q: %w", uri, err)
+	}
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("invalid libvirt URI %q: missing scheme (e.g., qemu+ssh://host/system)", uri)
+	}
+
+	if isLocalURI(u) {
+		socketPath := u.Query().Get("socket")
+		if socketPath == "" {
+			socketPath = DefaultSocketPath
+		}
+		return connectLocal(socketPath, libvirt.RemoteURI(u), timeout)
+	}
+
+	// Remote transports (ssh, libssh, tcp, tls) are handled by go-libvirt,
+	// which parses the URI options the same way libvirt does
+	l, err := libvirt.ConnectToURI(u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt at %s: %w", u.Redacted(), err)
+	}
+
+	client := &Client{libvirt: l}
+	if remoteConnectHook != nil {
+		remoteConnectHook(uri, client)
+	}
+	return client, nil
+}
+
+// connectLocal connects to libvirt over a local Unix socket.
+func connectLocal(socketPath string, uri libvirt.ConnectURI, timeout time.Duration) (*Client, error) {
 	// Create local dialer with options
 	dialer := dialers.NewLocal(
 		dialers.WithSocket(socketPath),
@@ -40,7 +196,7 @@ func Connect(socketPath string, timeout time.Duration) (*Client, error) {
 
 	// Create libvirt client and connect
 	l := libvirt.NewWithDialer(dialer)
-	if err := l.Connect(); err != nil {
+	if err := l.ConnectToURI(uri); err != nil {
 		return nil, fmt.Errorf("failed to connect to libvirt at %s: %w", socketPath, err)
 	}
 
@@ -48,7 +204,11 @@ func Connect(socketPath string, timeout time.Duration) (*Client, error) {
 }
 
 // ConnectWithContext establishes a connection with context support for cancellation.
-func ConnectWithContext(ctx context.Context, socketPath string, timeout time.Duration) (*Client, error) {
+//
+// uri is interpreted as in Connect.
+func ConnectWithContext(ctx context.Context, uri string, timeout time.Duration) (*Client, error) {
+	defer timing.Start("connect")()
+
 	// Create a channel for the connection result
 	type result struct {
 		client *Client
@@ -58,7 +218,7 @@ func ConnectWithContext(ctx context.Context, socketPath string, timeout time.Dur
 
 	// Attempt connection in a goroutine
 	go func() {
-		c, err := Connect(socketPath, timeout)
+		c, err := Connect(uri, timeout)
 		resultCh <- result{client: c, err: err}
 	}()
 
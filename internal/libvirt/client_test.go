@@ -2,6 +2,7 @@ package libvirt
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 )
@@ -159,3 +160,128 @@ func TestLibvirt_Accessor(t *testing.T) {
 		t.Fatal("got version 0, expected non-zero")
 	}
 }
+
+// TestDefaultURI tests precedence between SetDefaultURI and FOUNDRY_CONNECT.
+func TestDefaultURI(t *testing.T) {
+	t.Cleanup(func() { SetDefaultURI("") })
+
+	t.Setenv(ConnectEnvVar, "")
+	SetDefaultURI("")
+	if got := DefaultURI(); got != "" {
+		t.Errorf("DefaultURI() = %q, want empty", got)
+	}
+
+	t.Setenv(ConnectEnvVar, "qemu+tcp://env-host/system")
+	if got := DefaultURI(); got != "qemu+tcp://env-host/system" {
+		t.Errorf("DefaultURI() = %q, want env value", got)
+	}
+
+	SetDefaultURI("qemu+ssh://root@flag-host/system")
+	if got := DefaultURI(); got != "qemu+ssh://root@flag-host/system" {
+		t.Errorf("DefaultURI() = %q, want flag value to win over env", got)
+	}
+}
+
+// TestIsRemote tests detection of remote connection URIs.
+func TestIsRemote(t *testing.T) {
+	t.Setenv(ConnectEnvVar, "")
+
+	tests := []struct {
+		uri  string
+		want bool
+	}{
+		{"", false},
+		{"/var/run/libvirt/libvirt-sock", false},
+		{"qemu:///system", false},
+		{"qemu+unix:///system?socket=/tmp/sock", false},
+		{"qemu+ssh://root@hv1/system", true},
+		{"qemu+libssh2://root@hv1/system", true},
+		{"qemu+tcp://hv1/system", true},
+		{"qemu+tls://hv1:16514/system", true},
+		{"qemu://hv1/system", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			if got := IsRemote(tt.uri); got != tt.want {
+				t.Errorf("IsRemote(%q) = %v, want %v", tt.uri, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoteHost(t *testing.T) {
+	t.Setenv(ConnectEnvVar, "")
+
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{"", ""},
+		{"qemu:///system", ""},
+		{"qemu+unix:///system?socket=/tmp/sock", ""},
+		{"qemu+ssh://root@hv1/system", "hv1"},
+		{"qemu+tls://hv1.example.com:16514/system", "hv1.example.com"},
+		{"qemu+tcp://[fd00::1]/system", "fd00::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			if got := RemoteHost(tt.uri); got != tt.want {
+				t.Errorf("RemoteHost(%q) = %q, want %q", tt.uri, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRequireLocal tests that host-local features refuse remote connections.
+func TestRequireLocal(t *testing.T) {
+	t.Cleanup(func() { SetDefaultURI("") })
+	t.Setenv(ConnectEnvVar, "")
+
+	SetDefaultURI("")
+	if err := RequireLocal("doctor"); (err == nil) != LocalHypervisor {
+		t.Errorf("RequireLocal() = %v with the default connection, want an error only without a local hypervisor", err)
+	}
+
+	SetDefaultURI("qemu+ssh://root@hv1/system")
+	if err := RequireLocal("doctor"); err == nil {
+		t.Error("RequireLocal() should fail with a remote connection")
+	}
+}
+
+// TestConnect_InvalidURI tests that malformed URIs are rejected before dialing.
+func TestConnect_InvalidURI(t *testing.T) {
+	tests := []struct {
+		name        string
+		uri         string
+		expectError string
+	}{
+		{"missing scheme", "hv1/system", "missing scheme"},
+		{"unsupported transport", "qemu+carrier-pigeon://hv1/system", "unsupported libvirt transport"},
+		{"unparseable", "qemu+ssh://[::1/system", "invalid libvirt URI"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Connect(tt.uri, 100*time.Millisecond)
+			if err == nil {
+				t.Fatalf("expected error for %q, got nil", tt.uri)
+			}
+			if !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+// TestConnect_UnixURI tests that qemu+unix URIs honor the socket option.
+func TestConnect_UnixURI(t *testing.T) {
+	_, err := Connect("qemu+unix:///system?socket=/nonexistent/socket", 100*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected error connecting to nonexistent socket, got nil")
+	}
+	if !strings.Contains(err.Error(), "/nonexistent/socket") {
+		t.Errorf("expected error to mention socket path, got %v", err)
+	}
+}
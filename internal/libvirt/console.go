@@ -0,0 +1,458 @@
+package libvirt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/digitalocean/go-libvirt/socket"
+	"github.com/digitalocean/go-libvirt/socket/dialers"
+)
+
+// Remote protocol identifiers used by the console session. go-libvirt keeps
+// these in an internal package.
+const (
+	remoteProgram = 0x20008086
+
+	procConnectOpen        = 1
+	procDomainLookupByName = 23
+	procAuthList           = 66
+	procAuthPolkit         = 70
+	procDomainOpenConsole  = 201
+
+	authNone   = 0
+	authPolkit = 2
+
+	// maxConsoleChunk bounds the data sent in a single stream packet.
+	maxConsoleChunk = 64 * 1024
+)
+
+// DefaultConsoleEscape is the byte that detaches from a console: Ctrl+],
+// as with virsh console.
+const DefaultConsoleEscape = 0x1d
+
+// Console is an interactive session on a domain's serial console.
+//
+// go-libvirt's DomainOpenConsole can only receive console output, so a
+// Console speaks the libvirt remote protocol itself over a dedicated
+// connection: reads return guest output and writes are sent to the guest as
+// stream packets.
+type Console struct {
+	sock *socket.Socket
+
+	mu      sync.Mutex
+	serial  int32
+	pending map[int32]chan rpcReply
+
+	// stream is the serial of the console stream; output packets carrying it
+	// are written to out.
+	stream    int32
+	out       *io.PipeWriter
+	in        *io.PipeReader
+	closeOnce sync.Once
+}
+
+type rpcReply struct {
+	status  uint32
+	payload []byte
+}
+
+// OpenConsole connects to the serial console of the running domain vmName.
+//
+// uri is resolved like Connect. Consoles are only supported over the local
+// Unix socket. If force is true, an existing console session on the domain is
+// disconnected; otherwise opening fails while another session is attached.
+func OpenConsole(uri, vmName string, force bool, timeout time.Duration) (*Console, error) {
+	socketPath, connectURI, err := localSocket(uri)
+	if err != nil {
+		return nil, err
+	}
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+
+	dialer := dialers.NewLocal(
+		dialers.WithSocket(socketPath),
+		dialers.WithLocalTimeout(timeout),
+	)
+	return openConsole(dialer, connectURI, vmName, force)
+}
+
+// localSocket resolves uri to a local socket path and the URI to open on it.
+func localSocket(uri string) (string, libvirt.ConnectURI, error) {
+	if uri == "" {
+		uri = DefaultURI()
+	}
+	if uri == "" && !LocalHypervisor {
+		return "", "", ErrNoLocalHypervisor
+	}
+	if uri == "" || strings.HasPrefix(uri, "/") {
+		if uri == "" {
+			uri = DefaultSocketPath
+		}
+		return uri, libvirt.QEMUSystem, nil
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid libvirt URI %q: %w", uri, err)
+	}
+	if !isLocalURI(u) {
+		return "", "", fmt.Errorf("console is only supported on local connections (got %s); run it on the hypervisor", u.Redacted())
+	}
+
+	socketPath := u.Query().Get("socket")
+	if socketPath == "" {
+		socketPath = DefaultSocketPath
+	}
+	return socketPath, libvirt.RemoteURI(u), nil
+}
+
+// openConsole performs the connection handshake over dialer and opens the
+// console stream of vmName.
+func openConsole(dialer socket.Dialer, uri libvirt.ConnectURI, vmName string, force bool) (*Console, error) {
+	pr, pw := io.Pipe()
+	c := &Console{
+		pending: make(map[int32]chan rpcReply),
+		out:     pw,
+		in:      pr,
+	}
+	c.sock = socket.New(dialer, c)
+
+	if err := c.sock.Connect(); err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	go func() {
+		<-c.sock.Disconnected()
+		c.failPending()
+		pw.CloseWithError(errors.New("libvirt connection closed"))
+	}()
+
+	if err := c.open(uri, vmName, force); err != nil {
+		_ = c.sock.Disconnect()
+		return nil, err
+	}
+	return c, nil
+}
+
+// open authenticates, opens the connection and starts the console stream.
+func (c *Console) open(uri libvirt.ConnectURI, vmName string, force bool) error {
+	// libvirt requires an auth-list call before opening, even without auth
+	reply, err := c.call(procAuthList, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list auth types: %w", err)
+	}
+	d := &xdrDecoder{buf: reply}
+	var auths []uint32
+	for n := d.uint32(); n > 0 && d.err == nil; n-- {
+		auths = append(auths, d.uint32())
+	}
+	if d.err != nil {
+		return fmt.Errorf("invalid auth list reply: %w", d.err)
+	}
+	if !slices.Contains(auths, authNone) {
+		if !slices.Contains(auths, authPolkit) {
+			return fmt.Errorf("unsupported libvirt authentication types %v", auths)
+		}
+		if _, err := c.call(procAuthPolkit, nil); err != nil {
+			return fmt.Errorf("polkit authentication failed: %w", err)
+		}
+	}
+
+	var e xdrEncoder
+	e.optString(string(uri))
+	e.uint32(0)
+	if _, err := c.call(procConnectOpen, e.bytes()); err != nil {
+		return fmt.Errorf("failed to open connection: %w", err)
+	}
+
+	e = xdrEncoder{}
+	e.string(vmName)
+	domain, err := c.call(procDomainLookupByName, e.bytes())
+	if err != nil {
+		return fmt.Errorf("VM %s not found: %w", vmName, err)
+	}
+
+	var flags libvirt.DomainConsoleFlags
+	if force {
+		flags |= libvirt.DomainConsoleForce
+	}
+
+	// The lookup reply is the encoded domain, passed back verbatim,
+	// followed by the device name (NULL for the first console) and flags
+	e = xdrEncoder{}
+	e.raw(domain)
+	e.optString("")
+	e.uint32(uint32(flags))
+
+	serial := c.nextSerial()
+	c.mu.Lock()
+	c.stream = serial
+	c.mu.Unlock()
+	if _, err := c.callSerial(serial, procDomainOpenConsole, e.bytes()); err != nil {
+		return fmt.Errorf("failed to open console: %w", err)
+	}
+
+	return nil
+}
+
+// Read reads console output from the guest. It returns io.EOF when the
+// console is closed, e.g. because the VM shut down.
+func (c *Console) Read(p []byte) (int, error) {
+	return c.in.Read(p)
+}
+
+// Write sends input to the guest.
+func (c *Console) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), maxConsoleChunk)]
+		if err := c.sock.SendPacket(c.stream, procDomainOpenConsole, remoteProgram, chunk, socket.Stream, socket.StatusContinue); err != nil {
+			return written, fmt.Errorf("failed to write to console: %w", err)
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// Close ends the console session and the connection.
+func (c *Console) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		// Unblock output still waiting for a reader, then finish the stream
+		// (best effort, the daemon may already be gone) and hang up; libvirt
+		// releases the console when the connection closes
+		c.in.Close()
+		_ = c.sock.SendPacket(c.stream, procDomainOpenConsole, remoteProgram, nil, socket.Stream, socket.StatusOK)
+		err = c.sock.Disconnect()
+	})
+	return err
+}
+
+// Attach connects in and out to the console until the escape byte is read
+// from in, in reaches EOF, or the console closes. Bytes read from in before
+// the escape byte are still sent to the guest.
+func (c *Console) Attach(in io.Reader, out io.Writer, escape byte) error {
+	outDone := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(out, c)
+		outDone <- err
+	}()
+
+	inDone := make(chan error, 1)
+	go func() {
+		inDone <- copyUntilEscape(c, in, escape)
+	}()
+
+	select {
+	case err := <-outDone:
+		return err
+	case err := <-inDone:
+		return err
+	}
+}
+
+// copyUntilEscape copies src to dst until the escape byte or EOF.
+func copyUntilEscape(dst io.Writer, src io.Reader, escape byte) error {
+	buf := make([]byte, 1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			data := buf[:n]
+			i := bytes.IndexByte(data, escape)
+			if i >= 0 {
+				data = data[:i]
+			}
+			if len(data) > 0 {
+				if _, werr := dst.Write(data); werr != nil {
+					return werr
+				}
+			}
+			if i >= 0 {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Route implements socket.Router, dispatching replies to waiting calls and
+// console stream data to readers.
+func (c *Console) Route(h *socket.Header, buf []byte) {
+	c.mu.Lock()
+	stream := c.stream
+	c.mu.Unlock()
+
+	switch {
+	case h.Type == socket.Reply:
+		c.mu.Lock()
+		ch, ok := c.pending[h.Serial]
+		delete(c.pending, h.Serial)
+		c.mu.Unlock()
+		if ok {
+			ch <- rpcReply{status: h.Status, payload: buf}
+		}
+
+	case h.Type == socket.Stream && h.Serial == stream && stream != 0:
+		switch h.Status {
+		case socket.StatusContinue:
+			// Blocks until the data is read, applying backpressure
+			_, _ = c.out.Write(buf)
+		case socket.StatusOK:
+			c.out.Close()
+		default:
+			c.out.CloseWithError(decodeRemoteError(buf))
+		}
+	}
+}
+
+func (c *Console) nextSerial() int32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.serial++
+	return c.serial
+}
+
+// call makes a remote procedure call and waits for its reply.
+func (c *Console) call(proc uint32, payload []byte) ([]byte, error) {
+	return c.callSerial(c.nextSerial(), proc, payload)
+}
+
+func (c *Console) callSerial(serial int32, proc uint32, payload []byte) ([]byte, error) {
+	ch := make(chan rpcReply, 1)
+	c.mu.Lock()
+	c.pending[serial] = ch
+	c.mu.Unlock()
+
+	if err := c.sock.SendPacket(serial, proc, remoteProgram, payload, socket.Call, socket.StatusOK); err != nil {
+		c.mu.Lock()
+		delete(c.pending, serial)
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	reply, ok := <-ch
+	if !ok {
+		return nil, errors.New("libvirt connection closed")
+	}
+	if reply.status != socket.StatusOK {
+		return nil, decodeRemoteError(reply.payload)
+	}
+	return reply.payload, nil
+}
+
+// failPending unblocks calls waiting for replies on a closed connection.
+func (c *Console) failPending() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for serial, ch := range c.pending {
+		close(ch)
+		delete(c.pending, serial)
+	}
+}
+
+// decodeRemoteError extracts the message of a remote_error payload, which
+// starts with the error code and domain followed by the optional message.
+func decodeRemoteError(buf []byte) error {
+	d := &xdrDecoder{buf: buf}
+	d.uint32() // code
+	d.uint32() // domain
+	msg := d.optString()
+	if d.err != nil || msg == "" {
+		return errors.New("libvirt returned an unknown error")
+	}
+	return errors.New(msg)
+}
+
+// xdrEncoder encodes the few XDR types the console protocol needs.
+type xdrEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *xdrEncoder) uint32(v uint32) {
+	_ = binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *xdrEncoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf.WriteString(s)
+	e.buf.Write(make([]byte, pad(len(s))))
+}
+
+// optString encodes a remote_string; an empty string is encoded as NULL.
+func (e *xdrEncoder) optString(s string) {
+	if s == "" {
+		e.uint32(0)
+		return
+	}
+	e.uint32(1)
+	e.string(s)
+}
+
+func (e *xdrEncoder) raw(b []byte) {
+	e.buf.Write(b)
+}
+
+func (e *xdrEncoder) bytes() []byte {
+	return e.buf.Bytes()
+}
+
+// xdrDecoder decodes XDR values, recording the first error.
+type xdrDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *xdrDecoder) uint32() uint32 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) < 4 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	v := binary.BigEndian.Uint32(d.buf)
+	d.buf = d.buf[4:]
+	return v
+}
+
+// optString decodes a remote_string; NULL is decoded as an empty string.
+func (d *xdrDecoder) optString() string {
+	if d.uint32() == 0 {
+		return ""
+	}
+	return d.string()
+}
+
+func (d *xdrDecoder) string() string {
+	n := int(d.uint32())
+	if d.err != nil {
+		return ""
+	}
+	if len(d.buf) < n+pad(n) {
+		d.err = io.ErrUnexpectedEOF
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n+pad(n):]
+	return s
+}
+
+// pad returns the XDR padding after n bytes of opaque data.
+func pad(n int) int {
+	return (4 - n%4) % 4
+}
@@ -0,0 +1,285 @@
+package libvirt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/digitalocean/go-libvirt/socket"
+)
+
+// fakeConsoleServer speaks enough of the libvirt remote protocol to open a
+// console on the domain "test-vm".
+type fakeConsoleServer struct {
+	conn net.Conn
+
+	// consoleFlags receives the flags of the open-console call.
+	consoleFlags chan uint32
+	// input receives data written to the console.
+	input chan []byte
+	// finished is closed when the client finishes the stream.
+	finished chan struct{}
+}
+
+// pipeDialer hands out one end of an in-memory connection.
+type pipeDialer struct {
+	conn net.Conn
+}
+
+func (d pipeDialer) Dial() (net.Conn, error) {
+	return d.conn, nil
+}
+
+func newFakeConsoleServer(t *testing.T) (*fakeConsoleServer, socket.Dialer) {
+	t.Helper()
+	client, server := net.Pipe()
+	s := &fakeConsoleServer{
+		conn:         server,
+		consoleFlags: make(chan uint32, 1),
+		input:        make(chan []byte, 10),
+		finished:     make(chan struct{}),
+	}
+	go s.serve()
+	t.Cleanup(func() { _ = server.Close() })
+	return s, pipeDialer{conn: client}
+}
+
+func (s *fakeConsoleServer) serve() {
+	for {
+		var length uint32
+		if err := binary.Read(s.conn, binary.BigEndian, &length); err != nil {
+			return
+		}
+		packet := make([]byte, length-4)
+		if _, err := io.ReadFull(s.conn, packet); err != nil {
+			return
+		}
+		var h socket.Header
+		_ = binary.Read(bytes.NewReader(packet[:24]), binary.BigEndian, &h)
+		payload := packet[24:]
+
+		if h.Type == socket.Stream {
+			if h.Status == socket.StatusContinue {
+				s.input <- payload
+			} else {
+				close(s.finished)
+			}
+			continue
+		}
+
+		switch h.Procedure {
+		case procAuthList:
+			var e xdrEncoder
+			e.uint32(1)
+			e.uint32(authNone)
+			s.send(h, socket.Reply, socket.StatusOK, e.bytes())
+		case procConnectOpen:
+			s.send(h, socket.Reply, socket.StatusOK, nil)
+		case procDomainLookupByName:
+			d := &xdrDecoder{buf: payload}
+			name := d.string()
+			if name != "test-vm" {
+				s.send(h, socket.Reply, socket.StatusError, remoteError("Domain not found: no domain with matching name '"+name+"'"))
+				continue
+			}
+			var e xdrEncoder
+			e.string(name)
+			e.raw(make([]byte, 16)) // UUID
+			e.uint32(1)             // ID
+			s.send(h, socket.Reply, socket.StatusOK, e.bytes())
+		case procDomainOpenConsole:
+			s.consoleFlags <- binary.BigEndian.Uint32(payload[len(payload)-4:])
+			s.send(h, socket.Reply, socket.StatusOK, nil)
+			s.send(h, socket.Stream, socket.StatusContinue, []byte("login: "))
+		}
+	}
+}
+
+// send writes a packet answering h.
+func (s *fakeConsoleServer) send(h socket.Header, typ, status uint32, payload []byte) {
+	h.Type = typ
+	h.Status = status
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.BigEndian, uint32(28+len(payload)))
+	_ = binary.Write(&buf, binary.BigEndian, h)
+	buf.Write(payload)
+	_, _ = s.conn.Write(buf.Bytes())
+}
+
+// closeStream ends the console stream as libvirt does when the VM stops.
+func (s *fakeConsoleServer) closeStream(serial int32) {
+	s.send(socket.Header{Program: remoteProgram, Version: 1, Procedure: procDomainOpenConsole, Serial: serial}, socket.Stream, socket.StatusOK, nil)
+}
+
+func remoteError(msg string) []byte {
+	var e xdrEncoder
+	e.uint32(42) // code
+	e.uint32(10) // domain
+	e.optString(msg)
+	return e.bytes()
+}
+
+func readWithTimeout(t *testing.T, r io.Reader, n int) string {
+	t.Helper()
+	done := make(chan string, 1)
+	go func() {
+		buf := make([]byte, n)
+		read, _ := io.ReadFull(r, buf)
+		done <- string(buf[:read])
+	}()
+	select {
+	case s := <-done:
+		return s
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out reading console")
+		return ""
+	}
+}
+
+func TestOpenConsole(t *testing.T) {
+	server, dialer := newFakeConsoleServer(t)
+
+	c, err := openConsole(dialer, libvirt.QEMUSystem, "test-vm", false)
+	if err != nil {
+		t.Fatalf("openConsole() error = %v", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	if flags := <-server.consoleFlags; flags != 0 {
+		t.Errorf("console flags = %d, want 0", flags)
+	}
+
+	if got := readWithTimeout(t, c, len("login: ")); got != "login: " {
+		t.Errorf("Read() = %q, want %q", got, "login: ")
+	}
+
+	if _, err := c.Write([]byte("root\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if got := <-server.input; string(got) != "root\n" {
+		t.Errorf("server received %q, want %q", got, "root\n")
+	}
+
+	server.closeStream(c.stream)
+	if _, err := c.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("Read() after stream end error = %v, want EOF", err)
+	}
+}
+
+func TestOpenConsole_Force(t *testing.T) {
+	server, dialer := newFakeConsoleServer(t)
+
+	c, err := openConsole(dialer, libvirt.QEMUSystem, "test-vm", true)
+	if err != nil {
+		t.Fatalf("openConsole() error = %v", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	if flags := <-server.consoleFlags; flags != uint32(libvirt.DomainConsoleForce) {
+		t.Errorf("console flags = %d, want %d", flags, libvirt.DomainConsoleForce)
+	}
+}
+
+func TestOpenConsole_VMNotFound(t *testing.T) {
+	_, dialer := newFakeConsoleServer(t)
+
+	_, err := openConsole(dialer, libvirt.QEMUSystem, "missing", false)
+	if err == nil {
+		t.Fatal("expected error for missing VM")
+	}
+	if !strings.Contains(err.Error(), "VM missing not found") || !strings.Contains(err.Error(), "no domain with matching name") {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestConsole_Attach(t *testing.T) {
+	server, dialer := newFakeConsoleServer(t)
+
+	c, err := openConsole(dialer, libvirt.QEMUSystem, "test-vm", false)
+	if err != nil {
+		t.Fatalf("openConsole() error = %v", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	in := strings.NewReader("ls\n\x1dnot sent")
+	if err := c.Attach(in, io.Discard, DefaultConsoleEscape); err != nil {
+		t.Fatalf("Attach() error = %v", err)
+	}
+
+	if got := <-server.input; string(got) != "ls\n" {
+		t.Errorf("server received %q, want %q", got, "ls\n")
+	}
+
+	if err := c.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	select {
+	case <-server.finished:
+	case <-time.After(2 * time.Second):
+		t.Error("stream was not finished on close")
+	}
+}
+
+func TestCopyUntilEscape(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"escape ends copy", "abc\x1ddef", "abc"},
+		{"escape first", "\x1dabc", ""},
+		{"EOF without escape", "abc", "abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := copyUntilEscape(&out, strings.NewReader(tt.input), DefaultConsoleEscape); err != nil {
+				t.Fatalf("copyUntilEscape() error = %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("copied %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalSocket(t *testing.T) {
+	t.Setenv(ConnectEnvVar, "")
+
+	tests := []struct {
+		uri        string
+		wantSocket string
+		wantURI    libvirt.ConnectURI
+		wantErr    string
+	}{
+		{uri: "", wantSocket: DefaultSocketPath, wantURI: libvirt.QEMUSystem},
+		{uri: "/run/libvirt/custom-sock", wantSocket: "/run/libvirt/custom-sock", wantURI: libvirt.QEMUSystem},
+		{uri: "qemu+unix:///system?socket=/tmp/sock", wantSocket: "/tmp/sock", wantURI: "qemu:///system"},
+		{uri: "qemu+ssh://root@hv1/system", wantErr: "only supported on local connections"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			socketPath, uri, err := localSocket(tt.uri)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("localSocket() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("localSocket() error = %v", err)
+			}
+			if socketPath != tt.wantSocket || uri != tt.wantURI {
+				t.Errorf("localSocket() = %q, %q; want %q, %q", socketPath, uri, tt.wantSocket, tt.wantURI)
+			}
+		})
+	}
+}
@@ -11,9 +11,12 @@
 //
 // Connection Management:
 //
-// The package establishes connections to the local libvirt daemon via Unix socket:
+// The package connects to the local libvirt daemon via Unix socket by default,
+// or to a remote daemon using a libvirt URI (qemu+ssh, qemu+tcp, qemu+tls).
+// An empty URI resolves to the one set with SetDefaultURI (the CLI --connect
+// flag), then $FOUNDRY_CONNECT, then the local qemu:///system socket:
 //
-//	client, err := libvirt.Connect()
+//	client, err := libvirt.Connect("qemu+ssh://root@hv1/system", 0)
 //	if err != nil {
 //	    return err
 //	}
@@ -48,6 +51,16 @@
 //	    return err
 //	}
 //
+// Golden Domain XML:
+//
+// TestGoldenDomainXML renders the domain XML of a matrix of spec
+// permutations (firmware, machine types, NIC types, cdroms and individual
+// features) and compares it with the fixtures in testdata/domain. After an
+// intended change to the generated XML, regenerate the fixtures and review
+// their diff along with the code:
+//
+//	go generate ./internal/libvirt
+//
 // Consumer-Side Interfaces:
 //
 // This package does not define interfaces. Instead, consumers (internal/vm,
@@ -58,3 +71,5 @@
 // See internal/vm/interfaces.go, internal/storage/types.go, and
 // internal/metadata/storage.go for examples of consumer-side interfaces.
 package libvirt
+
+//go:generate go test -run TestGoldenDomainXML -update .
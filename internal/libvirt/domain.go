@@ -2,6 +2,7 @@ package libvirt
 
 import (
 	"fmt"
+	"strings"
 
 	"libvirt.org/go/libvirtxml"
 
@@ -12,14 +13,19 @@ import (
 const (
 	// BaseStoragePath is the default base path for VM storage
 	BaseStoragePath = "/var/lib/libvirt/images"
+
+	// GuestAgentChannel is the name of the virtio-serial channel the QEMU
+	// guest agent connects to
+	GuestAgentChannel = "org.qemu.guest_agent.0"
+
+	// SpiceAgentChannel is the name of the virtio-serial channel the SPICE
+	// agent (spice-vdagent) connects to
+	SpiceAgentChannel = "com.redhat.spice.0"
 )
 
 // GetStoragePool returns the storage pool name, using default if not set.
 func GetStoragePool(vm *v1alpha1.VirtualMachine) string {
-	if vm.Spec.StoragePool == "" {
-		return "foundry-vms"
-	}
-	return vm.Spec.StoragePool
+	return vm.GetStoragePool()
 }
 
 // GetBootVolumeName returns the volume name for the boot disk.
@@ -40,6 +46,288 @@ func GetCloudInitVolumeName(vm *v1alpha1.VirtualMachine) string {
 	return naming.VolumeNameCloudInit(vm.Name)
 }
 
+// interfaceNameStrategy returns the interface name strategy recorded on the
+// VM; VMs without one use ip-derived names.
+func interfaceNameStrategy(vm *v1alpha1.VirtualMachine) naming.InterfaceNameStrategy {
+	return naming.InterfaceNameStrategy(vm.Annotations[v1alpha1.AnnotationInterfaceNameStrategy])
+}
+
+// diskDriver returns the driver for a boot or data disk volume, in the VM's
+// disk format with the disk's cache and I/O modes. Unless discard is
+// disabled, guest TRIM and zeroed writes are passed down to the volume so
+// thin-provisioned volumes shrink when the guest frees space.
+func diskDriver(vm *v1alpha1.VirtualMachine, tuning *v1alpha1.DiskTuningSpec) *libvirtxml.DomainDiskDriver {
+	driver := &libvirtxml.DomainDiskDriver{
+		Name:  "qemu",
+		Type:  vm.GetBootDiskFormat(),
+		Cache: tuning.GetCache(),
+		IO:    tuning.IO,
+	}
+	if vm.IsDiskDiscard(tuning) {
+		driver.Discard = "unmap"
+		driver.DetectZeros = "unmap"
+	}
+	if tuning.IOThread > 0 {
+		ioThread := uint(tuning.IOThread)
+		driver.IOThread = &ioThread
+	}
+	return driver
+}
+
+// diskIOTune returns the I/O limits of a disk, or nil for none.
+func diskIOTune(ioTune *v1alpha1.DiskIOTuneSpec) *libvirtxml.DomainDiskIOTune {
+	if ioTune == nil || *ioTune == (v1alpha1.DiskIOTuneSpec{}) {
+		return nil
+	}
+	return &libvirtxml.DomainDiskIOTune{
+		TotalIopsSec:  uint64(ioTune.TotalIOPS),
+		ReadIopsSec:   uint64(ioTune.ReadIOPS),
+		WriteIopsSec:  uint64(ioTune.WriteIOPS),
+		TotalBytesSec: uint64(ioTune.TotalBytesPerSec),
+		ReadBytesSec:  uint64(ioTune.ReadBytesPerSec),
+		WriteBytesSec: uint64(ioTune.WriteBytesPerSec),
+	}
+}
+
+// interfaceBandwidth returns the traffic shaping of an interface, or nil for
+// none.
+func interfaceBandwidth(bandwidth *v1alpha1.BandwidthSpec) *libvirtxml.DomainInterfaceBandwidth {
+	if bandwidth == nil || (bandwidth.Inbound == nil && bandwidth.Outbound == nil) {
+		return nil
+	}
+	params := func(limit *v1alpha1.BandwidthLimitSpec) *libvirtxml.DomainInterfaceBandwidthParams {
+		if limit == nil {
+			return nil
+		}
+		p := &libvirtxml.DomainInterfaceBandwidthParams{Average: &limit.Average}
+		if limit.Peak > 0 {
+			p.Peak = &limit.Peak
+		}
+		if limit.Burst > 0 {
+			p.Burst = &limit.Burst
+		}
+		return p
+	}
+	return &libvirtxml.DomainInterfaceBandwidth{
+		Inbound:  params(bandwidth.Inbound),
+		Outbound: params(bandwidth.Outbound),
+	}
+}
+
+// hasSCSIDisk returns true if any boot or data disk is on the scsi bus,
+// which needs a virtio-scsi controller.
+func hasSCSIDisk(vm *v1alpha1.VirtualMachine) bool {
+	if vm.Spec.BootDisk.GetBus() == "scsi" {
+		return true
+	}
+	for i := range vm.Spec.DataDisks {
+		if vm.Spec.DataDisks[i].GetBus() == "scsi" {
+			return true
+		}
+	}
+	return false
+}
+
+// cloudInitDevice returns the target device of the cloud-init CD-ROM: sda,
+// or the first sdX whose name and SATA unit are free when disks are on the
+// sata bus. libvirt derives a SATA disk's unit from the letters of its
+// target device, so a sata boot disk (vda) would otherwise clash with sda.
+func cloudInitDevice(vm *v1alpha1.VirtualMachine) string {
+	used := make(map[string]bool)
+	mark := func(device, bus string) {
+		used[device] = true
+		if bus == "sata" && len(device) > 2 {
+			used["sd"+device[2:]] = true
+		}
+	}
+	mark("vda", vm.Spec.BootDisk.GetBus())
+	for i := range vm.Spec.DataDisks {
+		mark(vm.Spec.DataDisks[i].Device, vm.Spec.DataDisks[i].GetBus())
+	}
+
+	for letter := 'a'; letter <= 'z'; letter++ {
+		if device := "sd" + string(letter); !used[device] {
+			return device
+		}
+	}
+	return "sdz"
+}
+
+// smbiosSpec returns the SMBIOS strings exposed to a VM, or nil for none.
+// With the http cloud-init transport the system serial carries the NoCloud
+// seed URL, which cloud-init reads from /sys/class/dmi/id/product_serial.
+func smbiosSpec(vm *v1alpha1.VirtualMachine) *v1alpha1.SMBIOSSpec {
+	seedURL := vm.GetCloudInitSeedURL()
+	if seedURL == "" {
+		return vm.Spec.SMBIOS
+	}
+
+	smbios := &v1alpha1.SMBIOSSpec{}
+	if vm.Spec.SMBIOS != nil {
+		smbios = vm.Spec.SMBIOS.DeepCopy()
+	}
+	smbios.Serial = "ds=nocloud-net;s=" + seedURL
+	return smbios
+}
+
+// smbiosSysInfo returns the sysinfo tables of the SMBIOS strings of a VM. The
+// serial is set on both the system and the chassis, as guests read either.
+func smbiosSysInfo(spec *v1alpha1.SMBIOSSpec) *libvirtxml.DomainSysInfoSMBIOS {
+	smbios := &libvirtxml.DomainSysInfoSMBIOS{}
+	var chassis []libvirtxml.DomainSysInfoEntry
+	if spec.Serial != "" {
+		smbios.System = &libvirtxml.DomainSysInfoSystem{
+			Entry: []libvirtxml.DomainSysInfoEntry{{Name: "serial", Value: spec.Serial}},
+		}
+		chassis = append(chassis, libvirtxml.DomainSysInfoEntry{Name: "serial", Value: spec.Serial})
+	}
+	if spec.AssetTag != "" {
+		chassis = append(chassis, libvirtxml.DomainSysInfoEntry{Name: "asset", Value: spec.AssetTag})
+	}
+	if len(chassis) > 0 {
+		smbios.Chassis = &libvirtxml.DomainSysInfoChassis{Entry: chassis}
+	}
+	if len(spec.OEMStrings) > 0 {
+		smbios.OEMStrings = &libvirtxml.DomainSysInfoOEMStrings{Entry: spec.OEMStrings}
+	}
+	return smbios
+}
+
+// domainOS returns the OS element of a VM: its machine type and firmware.
+// UEFI firmware and its NVRAM are picked by libvirt's firmware
+// autoselection, constrained by the Secure Boot setting.
+func domainOS(vm *v1alpha1.VirtualMachine) *libvirtxml.DomainOS {
+	osDef := &libvirtxml.DomainOS{
+		Type: &libvirtxml.DomainOSType{
+			Arch:    "x86_64",
+			Machine: vm.GetMachineType(),
+			Type:    "hvm",
+		},
+		BIOS: &libvirtxml.DomainBIOS{
+			UseSerial: "yes",
+		},
+	}
+	if vm.GetFirmware() != "efi" {
+		return osDef
+	}
+
+	osDef.Firmware = "efi"
+	if vm.Spec.SecureBoot != nil {
+		enabled := "no"
+		if *vm.Spec.SecureBoot {
+			enabled = "yes"
+			osDef.Loader = &libvirtxml.DomainLoader{Secure: "yes"}
+		}
+		osDef.FirmwareInfo = &libvirtxml.DomainOSFirmwareInfo{
+			Features: []libvirtxml.DomainOSFirmwareFeature{
+				{Name: "secure-boot", Enabled: enabled},
+				{Name: "enrolled-keys", Enabled: enabled},
+			},
+		}
+	}
+	return osDef
+}
+
+// addGraphics adds the display of a VM with a video card to show on, and a
+// tablet so the pointer follows the client's mouse. SPICE displays also get
+// the channel the spice-vdagent in the guest uses for clipboard sharing and
+// resizing.
+func addGraphics(devices *libvirtxml.DomainDeviceList, vm *v1alpha1.VirtualMachine) {
+	spec := vm.Spec.Graphics
+	listeners := []libvirtxml.DomainGraphicListener{
+		{Address: &libvirtxml.DomainGraphicListenerAddress{Address: vm.GetGraphicsListen()}},
+	}
+	autoPort := "no"
+	if spec.Port == 0 {
+		autoPort = "yes"
+	}
+
+	var graphic libvirtxml.DomainGraphic
+	switch spec.Type {
+	case v1alpha1.GraphicsTypeSPICE:
+		graphic.Spice = &libvirtxml.DomainGraphicSpice{
+			Port:      spec.Port,
+			AutoPort:  autoPort,
+			Passwd:    spec.Password,
+			Listeners: listeners,
+		}
+		devices.Channels = append(devices.Channels, libvirtxml.DomainChannel{
+			Source: &libvirtxml.DomainChardevSource{
+				SpiceVMC: &libvirtxml.DomainChardevSourceSpiceVMC{},
+			},
+			Target: &libvirtxml.DomainChannelTarget{
+				VirtIO: &libvirtxml.DomainChannelTargetVirtIO{Name: SpiceAgentChannel},
+			},
+		})
+	default:
+		graphic.VNC = &libvirtxml.DomainGraphicVNC{
+			Port:      spec.Port,
+			AutoPort:  autoPort,
+			Passwd:    spec.Password,
+			Listeners: listeners,
+		}
+	}
+
+	devices.Graphics = []libvirtxml.DomainGraphic{graphic}
+	devices.Videos = []libvirtxml.DomainVideo{
+		{Model: libvirtxml.DomainVideoModel{Type: "virtio", Heads: 1, Primary: "yes"}},
+	}
+	devices.Inputs = []libvirtxml.DomainInput{{Type: "tablet", Bus: "usb"}}
+}
+
+// addHostDevices passes the VM's host devices through. PCI devices are
+// managed: libvirt detaches them from their host driver when the VM starts
+// and reattaches them when it stops.
+func addHostDevices(devices *libvirtxml.DomainDeviceList, vm *v1alpha1.VirtualMachine) error {
+	for i, dev := range vm.Spec.HostDevices {
+		if dev.MdevUUID != "" {
+			devices.Hostdevs = append(devices.Hostdevs, libvirtxml.DomainHostdev{
+				SubsysMDev: &libvirtxml.DomainHostdevSubsysMDev{
+					Model: "vfio-pci",
+					Source: &libvirtxml.DomainHostdevSubsysMDevSource{
+						Address: &libvirtxml.DomainAddressMDev{UUID: strings.ToLower(dev.MdevUUID)},
+					},
+				},
+			})
+			continue
+		}
+
+		address, err := parsePCIAddress(dev.PCIAddress)
+		if err != nil {
+			return fmt.Errorf("host device %d: %w", i, err)
+		}
+		devices.Hostdevs = append(devices.Hostdevs, libvirtxml.DomainHostdev{
+			Managed: "yes",
+			SubsysPCI: &libvirtxml.DomainHostdevSubsysPCI{
+				Source: &libvirtxml.DomainHostdevSubsysPCISource{Address: address},
+			},
+		})
+	}
+	return nil
+}
+
+// parsePCIAddress parses a host PCI address in "dddd:bb:ss.f" form, or
+// "bb:ss.f" in PCI domain 0.
+func parsePCIAddress(address string) (*libvirtxml.DomainAddressPCI, error) {
+	var domain, bus, slot, function uint
+	if strings.Count(address, ":") == 1 {
+		address = "0000:" + address
+	}
+	if n, err := fmt.Sscanf(address, "%x:%x:%x.%x", &domain, &bus, &slot, &function); err != nil || n != 4 {
+		return nil, fmt.Errorf("invalid PCI address %q", address)
+	}
+	return &libvirtxml.DomainAddressPCI{Domain: &domain, Bus: &bus, Slot: &slot, Function: &function}, nil
+}
+
+// pciRootModel returns the model of the root PCI controller, which depends
+// on the machine type.
+func pciRootModel(vm *v1alpha1.VirtualMachine) string {
+	if vm.GetMachineType() == "q35" {
+		return "pcie-root"
+	}
+	return "pci-root"
+}
+
 // GenerateDomainXML generates libvirt domain XML from VM configuration
 func GenerateDomainXML(vm *v1alpha1.VirtualMachine) (string, error) {
 	// Get CPU mode with default
@@ -48,27 +336,42 @@ func GenerateDomainXML(vm *v1alpha1.VirtualMachine) (string, error) {
 		cpuMode = "host-model"
 	}
 
+	// Keep the unit the memory was specified in
+	memory := &libvirtxml.DomainMemory{
+		Value: uint(vm.Spec.MemoryGiB),
+		Unit:  "GiB",
+	}
+	if vm.Spec.MemoryMiB > 0 {
+		memory = &libvirtxml.DomainMemory{
+			Value: uint(vm.Spec.MemoryMiB),
+			Unit:  "MiB",
+		}
+	}
+
+	// With a higher maximum the VM boots with the maximum and the balloon
+	// returns the rest, so memory can be raised live up to it
+	var currentMemory *libvirtxml.DomainCurrentMemory
+	if vm.GetMaxMemoryMiB() > vm.GetMemoryMiB() {
+		currentMemory = &libvirtxml.DomainCurrentMemory{Value: memory.Value, Unit: memory.Unit}
+		memory = &libvirtxml.DomainMemory{Value: uint(vm.Spec.MaxMemoryGiB), Unit: "GiB"}
+	}
+
+	// vCPUs above the current count are present but offline until hotplugged
+	vcpu := &libvirtxml.DomainVCPU{
+		Placement: "static",
+		Value:     uint(vm.GetMaxVCPUs()),
+	}
+	if vm.GetMaxVCPUs() > vm.Spec.VCPUs {
+		vcpu.Current = uint(vm.Spec.VCPUs)
+	}
+
 	domain := &libvirtxml.Domain{
-		Type: "kvm",
-		Name: vm.Name,
-		Memory: &libvirtxml.DomainMemory{
-			Value: uint(vm.Spec.MemoryGiB),
-			Unit:  "GiB",
-		},
-		VCPU: &libvirtxml.DomainVCPU{
-			Placement: "static",
-			Value:     uint(vm.Spec.VCPUs),
-		},
-		OS: &libvirtxml.DomainOS{
-			Firmware: "efi",
-			Type: &libvirtxml.DomainOSType{
-				Arch: "x86_64",
-				Type: "hvm",
-			},
-			BIOS: &libvirtxml.DomainBIOS{
-				UseSerial: "yes",
-			},
-		},
+		Type:          "kvm",
+		Name:          vm.Name,
+		Memory:        memory,
+		CurrentMemory: currentMemory,
+		VCPU:          vcpu,
+		OS:            domainOS(vm),
 		Features: &libvirtxml.DomainFeatureList{
 			ACPI: &libvirtxml.DomainFeature{},
 			APIC: &libvirtxml.DomainFeatureAPIC{},
@@ -96,7 +399,7 @@ func GenerateDomainXML(vm *v1alpha1.VirtualMachine) (string, error) {
 				{
 					Type:  "pci",
 					Index: func() *uint { i := uint(0); return &i }(),
-					Model: "pci-root",
+					Model: pciRootModel(vm),
 				},
 			},
 			MemBalloon: &libvirtxml.DomainMemBalloon{
@@ -115,6 +418,54 @@ func GenerateDomainXML(vm *v1alpha1.VirtualMachine) (string, error) {
 		},
 	}
 
+	// Record the guest OS for libvirt tools that tune devices by it
+	osInfo, err := osInfoMetadata(vm)
+	if err != nil {
+		return "", err
+	}
+	domain.Metadata = osInfo
+
+	// Secure Boot firmware relies on System Management Mode
+	if vm.IsSecureBoot() {
+		domain.Features.SMM = &libvirtxml.DomainFeatureSMM{State: "on"}
+	}
+
+	// Emulated TPM 2.0 backed by swtpm; the CRB interface needs q35
+	if vm.Spec.TPM {
+		model := "tpm-tis"
+		if vm.GetMachineType() == "q35" {
+			model = "tpm-crb"
+		}
+		domain.Devices.TPMs = []libvirtxml.DomainTPM{{
+			Model: model,
+			Backend: &libvirtxml.DomainTPMBackend{
+				Emulator: &libvirtxml.DomainTPMBackendEmulator{Version: "2.0"},
+			},
+		}}
+	}
+
+	// Expose the configured SMBIOS strings to the guest, and point
+	// cloud-init at the seed server with the http transport
+	if smbios := smbiosSpec(vm); smbios != nil {
+		domain.SysInfo = []libvirtxml.DomainSysInfo{{SMBIOS: smbiosSysInfo(smbios)}}
+		domain.OS.SMBios = &libvirtxml.DomainSMBios{Mode: "sysinfo"}
+	}
+
+	// Dedicated I/O threads that virtio disks are pinned to
+	if vm.Spec.IOThreads > 0 {
+		domain.IOThreads = uint(vm.Spec.IOThreads)
+	}
+
+	// scsi disks are attached to a virtio-scsi controller
+	if hasSCSIDisk(vm) {
+		index := uint(0)
+		domain.Devices.Controllers = append(domain.Devices.Controllers, libvirtxml.DomainController{
+			Type:  "scsi",
+			Index: &index,
+			Model: "virtio-scsi",
+		})
+	}
+
 	// Determine boot order based on PXE boot configuration
 	// If any interface has PXEBoot enabled, network boots first (order 1),
 	// then disk (order 2). Otherwise, disk boots first (order 1).
@@ -134,11 +485,7 @@ func GenerateDomainXML(vm *v1alpha1.VirtualMachine) (string, error) {
 	// Add boot disk (volume-based)
 	bootDisk := libvirtxml.DomainDisk{
 		Device: "disk",
-		Driver: &libvirtxml.DomainDiskDriver{
-			Name:  "qemu",
-			Type:  "qcow2",
-			Cache: "none",
-		},
+		Driver: diskDriver(vm, &vm.Spec.BootDisk.DiskTuningSpec),
 		Source: &libvirtxml.DomainDiskSource{
 			Volume: &libvirtxml.DomainDiskSourceVolume{
 				Pool:   GetStoragePool(vm),
@@ -147,8 +494,9 @@ func GenerateDomainXML(vm *v1alpha1.VirtualMachine) (string, error) {
 		},
 		Target: &libvirtxml.DomainDiskTarget{
 			Dev: "vda",
-			Bus: "virtio",
+			Bus: vm.Spec.BootDisk.GetBus(),
 		},
+		IOTune: diskIOTune(vm.Spec.BootDisk.IOTune),
 		Boot: &libvirtxml.DomainDeviceBoot{
 			Order: diskBootOrder,
 		},
@@ -159,11 +507,7 @@ func GenerateDomainXML(vm *v1alpha1.VirtualMachine) (string, error) {
 	for _, dataDisk := range vm.Spec.DataDisks {
 		disk := libvirtxml.DomainDisk{
 			Device: "disk",
-			Driver: &libvirtxml.DomainDiskDriver{
-				Name:  "qemu",
-				Type:  "qcow2",
-				Cache: "none",
-			},
+			Driver: diskDriver(vm, &dataDisk.DiskTuningSpec),
 			Source: &libvirtxml.DomainDiskSource{
 				Volume: &libvirtxml.DomainDiskSourceVolume{
 					Pool:   GetStoragePool(vm),
@@ -172,14 +516,15 @@ func GenerateDomainXML(vm *v1alpha1.VirtualMachine) (string, error) {
 			},
 			Target: &libvirtxml.DomainDiskTarget{
 				Dev: dataDisk.Device,
-				Bus: "virtio",
+				Bus: dataDisk.GetBus(),
 			},
+			IOTune: diskIOTune(dataDisk.IOTune),
 		}
 		domain.Devices.Disks = append(domain.Devices.Disks, disk)
 	}
 
 	// Add cloud-init ISO if configured (volume-based)
-	if vm.Spec.CloudInit != nil {
+	if vm.HasCloudInitISO() {
 		cdrom := libvirtxml.DomainDisk{
 			Device: "cdrom",
 			Driver: &libvirtxml.DomainDiskDriver{
@@ -193,7 +538,7 @@ func GenerateDomainXML(vm *v1alpha1.VirtualMachine) (string, error) {
 				},
 			},
 			Target: &libvirtxml.DomainDiskTarget{
-				Dev: "sda",
+				Dev: cloudInitDevice(vm),
 				Bus: "sata",
 			},
 			ReadOnly: &libvirtxml.DomainDiskReadOnly{},
@@ -202,34 +547,91 @@ func GenerateDomainXML(vm *v1alpha1.VirtualMachine) (string, error) {
 	}
 
 	// Add network interfaces
-	for _, iface := range vm.Spec.NetworkInterfaces {
-		// Calculate MAC address from IP
-		macAddr, err := naming.MACFromIP(iface.IP)
+	for i, iface := range vm.Spec.NetworkInterfaces {
+		// Use the configured MAC address, or derive it from the IP
+		macAddr, err := naming.InterfaceMAC(iface.IP, iface.IPv6, iface.MACAddress)
 		if err != nil {
-			return "", fmt.Errorf("failed to calculate MAC address for %s: %w", iface.IP, err)
+			return "", fmt.Errorf("failed to calculate MAC address for interface %d: %w", i, err)
 		}
 
-		// Calculate interface name from IP
-		ifaceName, err := naming.InterfaceNameFromIP(iface.IP)
+		// Derive the interface name the way the VM's naming strategy does
+		ifaceName, err := naming.InterfaceNameWithStrategy(interfaceNameStrategy(vm), iface.IP, iface.IPv6, iface.MACAddress)
 		if err != nil {
-			return "", fmt.Errorf("failed to calculate interface name for %s: %w", iface.IP, err)
+			return "", fmt.Errorf("failed to calculate interface name for interface %d: %w", i, err)
 		}
 
 		netIface := libvirtxml.DomainInterface{
 			MAC: &libvirtxml.DomainInterfaceMAC{
 				Address: macAddr,
 			},
-			Source: &libvirtxml.DomainInterfaceSource{
-				Bridge: &libvirtxml.DomainInterfaceSourceBridge{
-					Bridge: iface.Bridge,
-				},
-			},
+			Source: &libvirtxml.DomainInterfaceSource{},
 			Model: &libvirtxml.DomainInterfaceModel{
 				Type: "virtio",
 			},
 			Target: &libvirtxml.DomainInterfaceTarget{
 				Dev: ifaceName,
 			},
+			Bandwidth: interfaceBandwidth(iface.Bandwidth),
+		}
+		if iface.MTU > 0 {
+			netIface.MTU = &libvirtxml.DomainInterfaceMTU{Size: uint(iface.MTU)}
+		}
+
+		// Spread the traffic of multi-vCPU guests over several queues
+		if queues := vm.GetInterfaceQueues(&iface); queues > 1 {
+			netIface.Driver = &libvirtxml.DomainInterfaceDriver{Name: "vhost", Queues: uint(queues)}
+		}
+
+		// Attach to a host bridge or a libvirt-managed network, directly to a
+		// host device through macvtap, or pass an SR-IOV VF through. libvirt
+		// names macvtap devices itself, and VFs have neither a host device
+		// nor an emulated model.
+		switch {
+		case iface.SRIOV != nil:
+			if iface.SRIOV.PCIAddress == "" {
+				return "", fmt.Errorf("interface %d: the PCI address of VF %d of %s is not known (set sriov.pciAddress)", i, iface.SRIOV.VF, iface.SRIOV.PF)
+			}
+			address, err := parsePCIAddress(iface.SRIOV.PCIAddress)
+			if err != nil {
+				return "", fmt.Errorf("interface %d: VF %d of %s: %w", i, iface.SRIOV.VF, iface.SRIOV.PF, err)
+			}
+			netIface.Managed = "yes"
+			netIface.Source.Hostdev = &libvirtxml.DomainInterfaceSourceHostdev{
+				PCI: &libvirtxml.DomainHostdevSubsysPCISource{Address: address},
+			}
+			netIface.Model = nil
+			netIface.Target = nil
+			netIface.MTU = nil
+			netIface.Driver = nil
+		case iface.Macvtap != nil:
+			netIface.Source.Direct = &libvirtxml.DomainInterfaceSourceDirect{
+				Dev:  iface.Macvtap.Device,
+				Mode: iface.Macvtap.GetMode(),
+			}
+			netIface.Target = nil
+		case iface.Network != "":
+			netIface.Source.Network = &libvirtxml.DomainInterfaceSourceNetwork{
+				Network: iface.Network,
+			}
+		default:
+			netIface.Source.Bridge = &libvirtxml.DomainInterfaceSourceBridge{
+				Bridge: iface.Bridge,
+			}
+			if iface.GetBridgeType() == v1alpha1.BridgeTypeOpenVSwitch {
+				netIface.VirtualPort = &libvirtxml.DomainInterfaceVirtualPort{
+					Params: &libvirtxml.DomainInterfaceVirtualPortParams{
+						OpenVSwitch: &libvirtxml.DomainInterfaceVirtualPortParamsOpenVSwitch{},
+					},
+				}
+			}
+		}
+
+		// Tag the interface's traffic on the host; Linux bridges cannot do
+		// this through libvirt
+		if iface.VLAN > 0 && !(iface.Bridge != "" && iface.GetBridgeType() == v1alpha1.BridgeTypeLinux) {
+			netIface.VLan = &libvirtxml.DomainInterfaceVLan{
+				Tags: []libvirtxml.DomainInterfaceVLanTag{{ID: uint(iface.VLAN)}},
+			}
 		}
 
 		// Add boot order if PXE boot is enabled for this interface
@@ -265,6 +667,30 @@ func GenerateDomainXML(vm *v1alpha1.VirtualMachine) (string, error) {
 		},
 	}
 
+	// Add the channel the QEMU guest agent connects to; libvirt picks the
+	// socket path
+	if vm.IsGuestAgent() {
+		domain.Devices.Channels = []libvirtxml.DomainChannel{
+			{
+				Source: &libvirtxml.DomainChardevSource{
+					UNIX: &libvirtxml.DomainChardevSourceUNIX{Mode: "bind"},
+				},
+				Target: &libvirtxml.DomainChannelTarget{
+					VirtIO: &libvirtxml.DomainChannelTargetVirtIO{Name: GuestAgentChannel},
+				},
+			},
+		}
+	}
+
+	// Add the display; without it the VM is headless
+	if vm.Spec.Graphics != nil {
+		addGraphics(domain.Devices, vm)
+	}
+
+	if err := addHostDevices(domain.Devices, vm); err != nil {
+		return "", err
+	}
+
 	// Marshal to XML
 	xml, err := domain.Marshal()
 	if err != nil {
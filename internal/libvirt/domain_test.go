@@ -1,6 +1,7 @@
 package libvirt
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 
@@ -1056,3 +1057,619 @@ func TestGenerateDomainXML_PXEBoot(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateDomainXML_DHCPInterface(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "dhcp-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			VCPUs:     2,
+			MemoryGiB: 4,
+			BootDisk: v1alpha1.BootDiskSpec{
+				SizeGB: 20,
+				Image:  "fedora-43.qcow2",
+			},
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{Bridge: "br0", DHCP: true, MACAddress: "be:ee:0a:0b:0c:0d"},
+			},
+		},
+	}
+
+	xmlStr, err := GenerateDomainXML(vm)
+	if err != nil {
+		t.Fatalf("GenerateDomainXML() error = %v", err)
+	}
+
+	var domain libvirtxml.Domain
+	if err := domain.Unmarshal(xmlStr); err != nil {
+		t.Fatalf("failed to parse domain XML: %v", err)
+	}
+	iface := domain.Devices.Interfaces[0]
+	if iface.MAC.Address != "be:ee:0a:0b:0c:0d" {
+		t.Errorf("MAC = %q", iface.MAC.Address)
+	}
+	if iface.Target.Dev != "vm0a0b0c0d" {
+		t.Errorf("target dev = %q, want vm0a0b0c0d", iface.Target.Dev)
+	}
+
+	// Without a MAC there is nothing to derive the interface from
+	vm.Spec.NetworkInterfaces[0].MACAddress = ""
+	if _, err := GenerateDomainXML(vm); err == nil {
+		t.Error("expected error for DHCP interface without MAC address")
+	}
+}
+
+func TestGenerateDomainXML_IPv6OnlyInterface(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "ipv6-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			VCPUs:     2,
+			MemoryGiB: 4,
+			BootDisk: v1alpha1.BootDiskSpec{
+				SizeGB: 20,
+				Image:  "fedora-43.qcow2",
+			},
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{IPv6: "2001:db8::10/64", IPv6Gateway: "2001:db8::1", Bridge: "br0"},
+			},
+		},
+	}
+
+	xmlStr, err := GenerateDomainXML(vm)
+	if err != nil {
+		t.Fatalf("GenerateDomainXML() error = %v", err)
+	}
+
+	var domain libvirtxml.Domain
+	if err := domain.Unmarshal(xmlStr); err != nil {
+		t.Fatalf("failed to parse domain XML: %v", err)
+	}
+	iface := domain.Devices.Interfaces[0]
+	if iface.MAC.Address != "be:e6:9b:26:2f:e9" {
+		t.Errorf("MAC = %q", iface.MAC.Address)
+	}
+	if iface.Target.Dev != "vm9b262fe9" {
+		t.Errorf("target dev = %q, want vm9b262fe9", iface.Target.Dev)
+	}
+}
+
+func TestGenerateDomainXML_NetworkSource(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "nat-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			VCPUs:     2,
+			MemoryGiB: 4,
+			BootDisk: v1alpha1.BootDiskSpec{
+				SizeGB: 20,
+				Image:  "fedora-43.qcow2",
+			},
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{Network: "default", DHCP: true, MACAddress: "be:ee:0a:0b:0c:0d"},
+				{Bridge: "br0", IP: "10.0.0.10/24", Gateway: "10.0.0.1"},
+			},
+		},
+	}
+
+	xmlStr, err := GenerateDomainXML(vm)
+	if err != nil {
+		t.Fatalf("GenerateDomainXML() error = %v", err)
+	}
+	if !strings.Contains(xmlStr, `<interface type="network">`) || !strings.Contains(xmlStr, `<source network="default"></source>`) {
+		t.Errorf("expected a network interface on 'default':\n%s", xmlStr)
+	}
+
+	var domain libvirtxml.Domain
+	if err := domain.Unmarshal(xmlStr); err != nil {
+		t.Fatalf("failed to parse domain XML: %v", err)
+	}
+	nat, bridged := domain.Devices.Interfaces[0], domain.Devices.Interfaces[1]
+	if nat.Source.Network == nil || nat.Source.Network.Network != "default" || nat.Source.Bridge != nil {
+		t.Errorf("interface 0 source = %+v, want network default", nat.Source)
+	}
+	if bridged.Source.Bridge == nil || bridged.Source.Bridge.Bridge != "br0" || bridged.Source.Network != nil {
+		t.Errorf("interface 1 source = %+v, want bridge br0", bridged.Source)
+	}
+}
+
+func TestGenerateDomainXML_MemoryMiB(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "small-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			VCPUs:     1,
+			MemoryMiB: 1536,
+			BootDisk: v1alpha1.BootDiskSpec{
+				SizeGB: 20,
+				Image:  "fedora-43.qcow2",
+			},
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{Bridge: "br0", IP: "10.0.0.10/24", Gateway: "10.0.0.1"},
+			},
+		},
+	}
+
+	xmlStr, err := GenerateDomainXML(vm)
+	if err != nil {
+		t.Fatalf("GenerateDomainXML() error = %v", err)
+	}
+	if !strings.Contains(xmlStr, `<memory unit="MiB">1536</memory>`) {
+		t.Errorf("expected 1536 MiB of memory:\n%s", xmlStr)
+	}
+}
+
+func TestGenerateDomainXML_Maximums(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "hotplug-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			VCPUs:     2,
+			MemoryMiB: 1536,
+			BootDisk: v1alpha1.BootDiskSpec{
+				SizeGB: 20,
+				Image:  "fedora-43.qcow2",
+			},
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{Bridge: "br0", IP: "10.0.0.10/24", Gateway: "10.0.0.1"},
+			},
+		},
+	}
+
+	xmlStr, err := GenerateDomainXML(vm)
+	if err != nil {
+		t.Fatalf("GenerateDomainXML() error = %v", err)
+	}
+	if strings.Contains(xmlStr, "<currentMemory") || strings.Contains(xmlStr, "current=") {
+		t.Errorf("expected no current values without maximums:\n%s", xmlStr)
+	}
+
+	vm.Spec.MaxVCPUs = 8
+	vm.Spec.MaxMemoryGiB = 4
+	xmlStr, err = GenerateDomainXML(vm)
+	if err != nil {
+		t.Fatalf("GenerateDomainXML() error = %v", err)
+	}
+	for _, want := range []string{
+		`<memory unit="GiB">4</memory>`,
+		`<currentMemory unit="MiB">1536</currentMemory>`,
+		`<vcpu placement="static" current="2">8</vcpu>`,
+	} {
+		if !strings.Contains(xmlStr, want) {
+			t.Errorf("expected %s:\n%s", want, xmlStr)
+		}
+	}
+}
+
+func TestGenerateDomainXML_Discard(t *testing.T) {
+	newVM := func() *v1alpha1.VirtualMachine {
+		return &v1alpha1.VirtualMachine{
+			ObjectMeta: v1alpha1.ObjectMeta{Name: "discard-vm"},
+			Spec: v1alpha1.VirtualMachineSpec{
+				VCPUs:     1,
+				MemoryGiB: 2,
+				BootDisk: v1alpha1.BootDiskSpec{
+					SizeGB: 20,
+					Image:  "fedora-43.qcow2",
+				},
+				DataDisks: []v1alpha1.DataDiskSpec{
+					{Device: "vdb", SizeGB: 50},
+				},
+				NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+					{Bridge: "br0", IP: "10.0.0.10/24", Gateway: "10.0.0.1"},
+				},
+			},
+		}
+	}
+
+	vm := newVM()
+	xmlStr, err := GenerateDomainXML(vm)
+	if err != nil {
+		t.Fatalf("GenerateDomainXML() error = %v", err)
+	}
+	if got := strings.Count(xmlStr, `discard="unmap" detect_zeroes="unmap"`); got != 2 {
+		t.Errorf("expected discard on boot and data disk, found %d:\n%s", got, xmlStr)
+	}
+
+	vm = newVM()
+	disabled := false
+	vm.Spec.Discard = &disabled
+	xmlStr, err = GenerateDomainXML(vm)
+	if err != nil {
+		t.Fatalf("GenerateDomainXML() error = %v", err)
+	}
+	if strings.Contains(xmlStr, "discard=") || strings.Contains(xmlStr, "detect_zeroes=") {
+		t.Errorf("expected no discard with discard: false:\n%s", xmlStr)
+	}
+}
+
+func TestGenerateDomainXML_TPM(t *testing.T) {
+	tests := []struct {
+		machineType string
+		wantModel   string
+	}{
+		{machineType: "", wantModel: `<tpm model="tpm-tis">`},
+		{machineType: "pc", wantModel: `<tpm model="tpm-tis">`},
+		{machineType: "q35", wantModel: `<tpm model="tpm-crb">`},
+	}
+	for _, tt := range tests {
+		vm := &v1alpha1.VirtualMachine{
+			ObjectMeta: v1alpha1.ObjectMeta{Name: "tpm-vm"},
+			Spec: v1alpha1.VirtualMachineSpec{
+				VCPUs:       1,
+				MemoryGiB:   2,
+				MachineType: tt.machineType,
+				TPM:         true,
+				BootDisk:    v1alpha1.BootDiskSpec{SizeGB: 20, Image: "win11.qcow2"},
+				NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+					{Bridge: "br0", IP: "10.0.0.10/24", Gateway: "10.0.0.1"},
+				},
+			},
+		}
+		xmlStr, err := GenerateDomainXML(vm)
+		if err != nil {
+			t.Fatalf("GenerateDomainXML() error = %v", err)
+		}
+		if !strings.Contains(xmlStr, tt.wantModel) || !strings.Contains(xmlStr, `<backend type="emulator" version="2.0">`) {
+			t.Errorf("machine type %q: expected %s with an emulated TPM 2.0:\n%s", tt.machineType, tt.wantModel, xmlStr)
+		}
+	}
+}
+
+func TestGenerateDomainXML_SMBIOS(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "smbios-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			VCPUs:     1,
+			MemoryGiB: 2,
+			BootDisk: v1alpha1.BootDiskSpec{
+				SizeGB: 20,
+				Image:  "fedora-43.qcow2",
+			},
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{Bridge: "br0", IP: "10.0.0.10/24", Gateway: "10.0.0.1"},
+			},
+		},
+	}
+
+	xmlStr, err := GenerateDomainXML(vm)
+	if err != nil {
+		t.Fatalf("GenerateDomainXML() error = %v", err)
+	}
+	if strings.Contains(xmlStr, "<sysinfo") || strings.Contains(xmlStr, "<smbios") {
+		t.Errorf("expected no sysinfo without spec.smbios:\n%s", xmlStr)
+	}
+
+	vm.Spec.SMBIOS = &v1alpha1.SMBIOSSpec{
+		Serial:     "SN-1234",
+		AssetTag:   "rack-7",
+		OEMStrings: []string{"license=abc", "io.systemd.credential:hostname=smbios-vm"},
+	}
+	xmlStr, err = GenerateDomainXML(vm)
+	if err != nil {
+		t.Fatalf("GenerateDomainXML() error = %v", err)
+	}
+
+	var domain libvirtxml.Domain
+	if err := domain.Unmarshal(xmlStr); err != nil {
+		t.Fatalf("failed to parse generated XML: %v", err)
+	}
+	if domain.OS.SMBios == nil || domain.OS.SMBios.Mode != "sysinfo" {
+		t.Errorf("expected <smbios mode=\"sysinfo\"/>:\n%s", xmlStr)
+	}
+	if len(domain.SysInfo) != 1 || domain.SysInfo[0].SMBIOS == nil {
+		t.Fatalf("expected one SMBIOS sysinfo:\n%s", xmlStr)
+	}
+	smbios := domain.SysInfo[0].SMBIOS
+	if smbios.System == nil || len(smbios.System.Entry) != 1 || smbios.System.Entry[0] != (libvirtxml.DomainSysInfoEntry{Name: "serial", Value: "SN-1234"}) {
+		t.Errorf("system entries = %+v, want serial SN-1234", smbios.System)
+	}
+	wantChassis := []libvirtxml.DomainSysInfoEntry{{Name: "serial", Value: "SN-1234"}, {Name: "asset", Value: "rack-7"}}
+	if smbios.Chassis == nil || !reflect.DeepEqual(smbios.Chassis.Entry, wantChassis) {
+		t.Errorf("chassis entries = %+v, want %+v", smbios.Chassis, wantChassis)
+	}
+	if smbios.OEMStrings == nil || !reflect.DeepEqual(smbios.OEMStrings.Entry, vm.Spec.SMBIOS.OEMStrings) {
+		t.Errorf("OEM strings = %+v, want %v", smbios.OEMStrings, vm.Spec.SMBIOS.OEMStrings)
+	}
+}
+
+func TestGenerateDomainXML_GuestAgent(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "agent-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			VCPUs:     1,
+			MemoryGiB: 2,
+			BootDisk: v1alpha1.BootDiskSpec{
+				SizeGB: 20,
+				Image:  "fedora-43.qcow2",
+			},
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{Bridge: "br0", IP: "10.0.0.10/24", Gateway: "10.0.0.1"},
+			},
+		},
+	}
+
+	xmlStr, err := GenerateDomainXML(vm)
+	if err != nil {
+		t.Fatalf("GenerateDomainXML() error = %v", err)
+	}
+	var domain libvirtxml.Domain
+	if err := domain.Unmarshal(xmlStr); err != nil {
+		t.Fatalf("failed to parse generated XML: %v", err)
+	}
+	channels := domain.Devices.Channels
+	if len(channels) != 1 || channels[0].Source == nil || channels[0].Source.UNIX == nil ||
+		channels[0].Target == nil || channels[0].Target.VirtIO == nil || channels[0].Target.VirtIO.Name != GuestAgentChannel {
+		t.Errorf("expected a virtio guest agent channel by default:\n%s", xmlStr)
+	}
+
+	disabled := false
+	vm.Spec.GuestAgent = &disabled
+	xmlStr, err = GenerateDomainXML(vm)
+	if err != nil {
+		t.Fatalf("GenerateDomainXML() error = %v", err)
+	}
+	if strings.Contains(xmlStr, "<channel") {
+		t.Errorf("expected no channel with guestAgent: false:\n%s", xmlStr)
+	}
+}
+
+func TestGenerateDomainXML_Graphics(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "display-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			VCPUs:     1,
+			MemoryGiB: 2,
+			BootDisk: v1alpha1.BootDiskSpec{
+				SizeGB: 20,
+				Image:  "fedora-43.qcow2",
+			},
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{Bridge: "br0", IP: "10.0.0.10/24", Gateway: "10.0.0.1"},
+			},
+		},
+	}
+
+	xmlStr, err := GenerateDomainXML(vm)
+	if err != nil {
+		t.Fatalf("GenerateDomainXML() error = %v", err)
+	}
+	if strings.Contains(xmlStr, "<graphics") || strings.Contains(xmlStr, "<video") {
+		t.Errorf("expected a headless domain without spec.graphics:\n%s", xmlStr)
+	}
+
+	vm.Spec.Graphics = &v1alpha1.GraphicsSpec{Type: v1alpha1.GraphicsTypeVNC, Password: "s3cret"}
+	xmlStr, err = GenerateDomainXML(vm)
+	if err != nil {
+		t.Fatalf("GenerateDomainXML() error = %v", err)
+	}
+	var domain libvirtxml.Domain
+	if err := domain.Unmarshal(xmlStr); err != nil {
+		t.Fatalf("failed to parse generated XML: %v", err)
+	}
+	if len(domain.Devices.Graphics) != 1 || domain.Devices.Graphics[0].VNC == nil {
+		t.Fatalf("expected one VNC display:\n%s", xmlStr)
+	}
+	vnc := domain.Devices.Graphics[0].VNC
+	if vnc.AutoPort != "yes" || vnc.Passwd != "s3cret" {
+		t.Errorf("VNC = %+v, want autoport and password", vnc)
+	}
+	if len(vnc.Listeners) != 1 || vnc.Listeners[0].Address == nil || vnc.Listeners[0].Address.Address != "127.0.0.1" {
+		t.Errorf("VNC listeners = %+v, want 127.0.0.1", vnc.Listeners)
+	}
+	if len(domain.Devices.Videos) != 1 || domain.Devices.Videos[0].Model.Type != "virtio" {
+		t.Errorf("expected a virtio video card:\n%s", xmlStr)
+	}
+	if len(domain.Devices.Inputs) != 1 || domain.Devices.Inputs[0].Type != "tablet" {
+		t.Errorf("expected a tablet input:\n%s", xmlStr)
+	}
+
+	vm.Spec.Graphics = &v1alpha1.GraphicsSpec{Type: v1alpha1.GraphicsTypeSPICE, Listen: "0.0.0.0", Port: 5930}
+	xmlStr, err = GenerateDomainXML(vm)
+	if err != nil {
+		t.Fatalf("GenerateDomainXML() error = %v", err)
+	}
+	domain = libvirtxml.Domain{}
+	if err := domain.Unmarshal(xmlStr); err != nil {
+		t.Fatalf("failed to parse generated XML: %v", err)
+	}
+	if len(domain.Devices.Graphics) != 1 || domain.Devices.Graphics[0].Spice == nil {
+		t.Fatalf("expected one SPICE display:\n%s", xmlStr)
+	}
+	spice := domain.Devices.Graphics[0].Spice
+	if spice.Port != 5930 || spice.AutoPort != "no" {
+		t.Errorf("SPICE = %+v, want fixed port 5930", spice)
+	}
+	var agent, vdagent bool
+	for _, ch := range domain.Devices.Channels {
+		if ch.Target != nil && ch.Target.VirtIO != nil {
+			agent = agent || ch.Target.VirtIO.Name == GuestAgentChannel
+			vdagent = vdagent || ch.Target.VirtIO.Name == SpiceAgentChannel && ch.Source != nil && ch.Source.SpiceVMC != nil
+		}
+	}
+	if !agent || !vdagent {
+		t.Errorf("expected guest agent and SPICE agent channels:\n%s", xmlStr)
+	}
+}
+
+func TestGenerateDomainXML_Firmware(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		name        string
+		firmware    string
+		secureBoot  *bool
+		machineType string
+		wantOS      libvirtxml.DomainOS
+		wantPCIRoot string
+		wantSMM     bool
+	}{
+		{
+			name: "default UEFI",
+			wantOS: libvirtxml.DomainOS{
+				Firmware: "efi",
+				Type:     &libvirtxml.DomainOSType{Arch: "x86_64", Type: "hvm"},
+				BIOS:     &libvirtxml.DomainBIOS{UseSerial: "yes"},
+			},
+			wantPCIRoot: "pci-root",
+		},
+		{
+			name:        "legacy BIOS on pc",
+			firmware:    "bios",
+			machineType: "pc",
+			wantOS: libvirtxml.DomainOS{
+				Type: &libvirtxml.DomainOSType{Arch: "x86_64", Machine: "pc", Type: "hvm"},
+				BIOS: &libvirtxml.DomainBIOS{UseSerial: "yes"},
+			},
+			wantPCIRoot: "pci-root",
+		},
+		{
+			name:       "Secure Boot selects q35",
+			secureBoot: &enabled,
+			wantOS: libvirtxml.DomainOS{
+				Firmware: "efi",
+				FirmwareInfo: &libvirtxml.DomainOSFirmwareInfo{Features: []libvirtxml.DomainOSFirmwareFeature{
+					{Name: "secure-boot", Enabled: "yes"},
+					{Name: "enrolled-keys", Enabled: "yes"},
+				}},
+				Type:   &libvirtxml.DomainOSType{Arch: "x86_64", Machine: "q35", Type: "hvm"},
+				Loader: &libvirtxml.DomainLoader{Secure: "yes"},
+				BIOS:   &libvirtxml.DomainBIOS{UseSerial: "yes"},
+			},
+			wantPCIRoot: "pcie-root",
+			wantSMM:     true,
+		},
+		{
+			name:        "Secure Boot disabled on q35",
+			secureBoot:  &disabled,
+			machineType: "q35",
+			wantOS: libvirtxml.DomainOS{
+				Firmware: "efi",
+				FirmwareInfo: &libvirtxml.DomainOSFirmwareInfo{Features: []libvirtxml.DomainOSFirmwareFeature{
+					{Name: "secure-boot", Enabled: "no"},
+					{Name: "enrolled-keys", Enabled: "no"},
+				}},
+				Type: &libvirtxml.DomainOSType{Arch: "x86_64", Machine: "q35", Type: "hvm"},
+				BIOS: &libvirtxml.DomainBIOS{UseSerial: "yes"},
+			},
+			wantPCIRoot: "pcie-root",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &v1alpha1.VirtualMachine{
+				ObjectMeta: v1alpha1.ObjectMeta{Name: "firmware-vm"},
+				Spec: v1alpha1.VirtualMachineSpec{
+					VCPUs:       1,
+					MemoryGiB:   2,
+					Firmware:    tt.firmware,
+					SecureBoot:  tt.secureBoot,
+					MachineType: tt.machineType,
+					BootDisk:    v1alpha1.BootDiskSpec{SizeGB: 20, Image: "fedora-43.qcow2"},
+					NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+						{Bridge: "br0", IP: "10.0.0.10/24", Gateway: "10.0.0.1"},
+					},
+				},
+			}
+
+			xmlStr, err := GenerateDomainXML(vm)
+			if err != nil {
+				t.Fatalf("GenerateDomainXML() error = %v", err)
+			}
+			var domain libvirtxml.Domain
+			if err := domain.Unmarshal(xmlStr); err != nil {
+				t.Fatalf("failed to parse generated XML: %v", err)
+			}
+
+			if !reflect.DeepEqual(*domain.OS, tt.wantOS) {
+				t.Errorf("OS = %+v, want %+v\n%s", *domain.OS, tt.wantOS, xmlStr)
+			}
+			if got := domain.Devices.Controllers[0].Model; got != tt.wantPCIRoot {
+				t.Errorf("root controller model = %q, want %q", got, tt.wantPCIRoot)
+			}
+			if gotSMM := domain.Features.SMM != nil && domain.Features.SMM.State == "on"; gotSMM != tt.wantSMM {
+				t.Errorf("SMM = %v, want %v", gotSMM, tt.wantSMM)
+			}
+		})
+	}
+}
+
+func TestGenerateDomainXML_HostDevices(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "gpu-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			VCPUs:     4,
+			MemoryGiB: 8,
+			BootDisk: v1alpha1.BootDiskSpec{
+				SizeGB: 20,
+				Image:  "fedora-43.qcow2",
+			},
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{Bridge: "br0", IP: "10.0.0.10/24", Gateway: "10.0.0.1"},
+			},
+			HostDevices: []v1alpha1.HostDeviceSpec{
+				{PCIAddress: "0000:41:00.0"},
+				{PCIAddress: "0a:1f.7"},
+				{MdevUUID: "4B20D080-1B54-4048-85B3-A6A62D165C01"},
+			},
+		},
+	}
+
+	xmlStr, err := GenerateDomainXML(vm)
+	if err != nil {
+		t.Fatalf("GenerateDomainXML() error = %v", err)
+	}
+	var domain libvirtxml.Domain
+	if err := domain.Unmarshal(xmlStr); err != nil {
+		t.Fatalf("failed to parse generated XML: %v", err)
+	}
+	hostdevs := domain.Devices.Hostdevs
+	if len(hostdevs) != 3 {
+		t.Fatalf("expected 3 host devices:\n%s", xmlStr)
+	}
+
+	wantPCI := [][4]uint{{0, 0x41, 0, 0}, {0, 0x0a, 0x1f, 7}}
+	for i, want := range wantPCI {
+		dev := hostdevs[i]
+		if dev.Managed != "yes" || dev.SubsysPCI == nil || dev.SubsysPCI.Source == nil || dev.SubsysPCI.Source.Address == nil {
+			t.Fatalf("host device %d = %+v, want a managed PCI device", i, dev)
+		}
+		addr := dev.SubsysPCI.Source.Address
+		if got := [4]uint{*addr.Domain, *addr.Bus, *addr.Slot, *addr.Function}; got != want {
+			t.Errorf("host device %d address = %v, want %v", i, got, want)
+		}
+	}
+
+	mdev := hostdevs[2].SubsysMDev
+	if mdev == nil || mdev.Model != "vfio-pci" || mdev.Source.Address.UUID != "4b20d080-1b54-4048-85b3-a6a62d165c01" {
+		t.Errorf("mediated device = %+v", hostdevs[2])
+	}
+}
+
+func TestGenerateDomainXML_InvalidHostDevice(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "gpu-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			VCPUs:       1,
+			MemoryGiB:   1,
+			BootDisk:    v1alpha1.BootDiskSpec{SizeGB: 20, Image: "fedora-43.qcow2"},
+			HostDevices: []v1alpha1.HostDeviceSpec{{PCIAddress: "gpu0"}},
+		},
+	}
+	if _, err := GenerateDomainXML(vm); err == nil || !strings.Contains(err.Error(), "invalid PCI address") {
+		t.Errorf("GenerateDomainXML() error = %v, want invalid PCI address", err)
+	}
+}
+
+func TestGenerateDomainXML_SRIOVWithoutAddress(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "sriov-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			VCPUs:     1,
+			MemoryGiB: 2,
+			BootDisk:  v1alpha1.BootDiskSpec{SizeGB: 20, Image: "fedora.qcow2"},
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{IP: "10.0.0.10/24", Gateway: "10.0.0.1", SRIOV: &v1alpha1.SRIOVSpec{PF: "enp1s0f0", VF: 3}},
+			},
+		},
+	}
+	_, err := GenerateDomainXML(vm)
+	if err == nil || !strings.Contains(err.Error(), "PCI address of VF 3 of enp1s0f0 is not known") {
+		t.Errorf("GenerateDomainXML() error = %v, want the VF address to be required", err)
+	}
+}
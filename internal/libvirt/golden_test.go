@@ -0,0 +1,356 @@
+package libvirt
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+// update rewrites the golden domain XML fixtures instead of checking them.
+// go generate ./internal/libvirt runs the golden test with it.
+var update = flag.Bool("update", false, "rewrite the golden domain XML fixtures in testdata/domain")
+
+// goldenDir holds one fixture per golden case, named after the case.
+const goldenDir = "testdata/domain"
+
+// goldenVariant is one value of a dimension of the golden matrix, applied to
+// the base spec.
+type goldenVariant struct {
+	name  string
+	apply func(vm *v1alpha1.VirtualMachine)
+}
+
+// goldenCase is a spec whose domain XML is checked against a fixture.
+type goldenCase struct {
+	name string
+	vm   *v1alpha1.VirtualMachine
+}
+
+// goldenBaseVM returns the spec every golden case starts from: a UEFI VM
+// with a backed boot disk, one static bridge interface and cloud-init.
+func goldenBaseVM() *v1alpha1.VirtualMachine {
+	return &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "golden-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			VCPUs:     2,
+			MemoryGiB: 4,
+			BootDisk: v1alpha1.BootDiskSpec{
+				SizeGB: 20,
+				Image:  "fedora-43.qcow2",
+			},
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{IP: "10.20.30.40/24", Gateway: "10.20.30.1", Bridge: "br0", DefaultRoute: true},
+			},
+			CloudInit: &v1alpha1.CloudInitSpec{FQDN: "golden-vm.example.com"},
+		},
+	}
+}
+
+var (
+	goldenFirmware = []goldenVariant{
+		{"firmware-efi", func(vm *v1alpha1.VirtualMachine) {}},
+		{"firmware-secure-boot", func(vm *v1alpha1.VirtualMachine) { vm.Spec.SecureBoot = boolPtr(true) }},
+		{"firmware-insecure-boot", func(vm *v1alpha1.VirtualMachine) { vm.Spec.SecureBoot = boolPtr(false) }},
+		{"firmware-bios", func(vm *v1alpha1.VirtualMachine) { vm.Spec.Firmware = "bios" }},
+	}
+
+	goldenMachine = []goldenVariant{
+		{"machine-default", func(vm *v1alpha1.VirtualMachine) {}},
+		{"machine-q35", func(vm *v1alpha1.VirtualMachine) { vm.Spec.MachineType = "q35" }},
+		{"machine-pc", func(vm *v1alpha1.VirtualMachine) { vm.Spec.MachineType = "pc" }},
+	}
+
+	goldenNIC = []goldenVariant{
+		{"nic-bridge", func(vm *v1alpha1.VirtualMachine) {}},
+		{"nic-network", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.NetworkInterfaces[0].Bridge = ""
+			vm.Spec.NetworkInterfaces[0].Network = "default"
+		}},
+		{"nic-dhcp", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.NetworkInterfaces[0] = v1alpha1.NetworkInterfaceSpec{DHCP: true, MACAddress: "be:ee:3f:a1:07:c2", Bridge: "br0"}
+		}},
+		{"nic-ipv6-only", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.NetworkInterfaces[0] = v1alpha1.NetworkInterfaceSpec{IPv6: "2001:db8::10/64", IPv6Gateway: "2001:db8::1", Bridge: "br0", DefaultRoute: true}
+		}},
+		{"nic-pxe", func(vm *v1alpha1.VirtualMachine) { vm.Spec.NetworkInterfaces[0].PXEBoot = true }},
+		{"nic-multiple", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.NetworkInterfaces = append(vm.Spec.NetworkInterfaces,
+				v1alpha1.NetworkInterfaceSpec{IP: "10.99.0.40/24", Network: "storage"})
+		}},
+	}
+
+	goldenCDROM = []goldenVariant{
+		{"cdrom-cloud-init", func(vm *v1alpha1.VirtualMachine) {}},
+		{"cdrom-none", func(vm *v1alpha1.VirtualMachine) { vm.Spec.CloudInit = nil }},
+	}
+
+	// goldenFeatures are checked one at a time on the base spec.
+	goldenFeatures = []goldenVariant{
+		{"feature-data-disks", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.DataDisks = []v1alpha1.DataDiskSpec{{Device: "vdb", SizeGB: 100}, {Device: "vdc", SizeGB: 200}}
+		}},
+		{"feature-empty-boot-disk", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.BootDisk = v1alpha1.BootDiskSpec{SizeGB: 20, Empty: true}
+		}},
+		{"feature-raw-disks-lvm-pool", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.StoragePool = "vg-vms"
+			vm.Spec.BootDisk.Format = "raw"
+			vm.Spec.DataDisks = []v1alpha1.DataDiskSpec{{Device: "vdb", SizeGB: 100}}
+		}},
+		{"feature-no-discard", func(vm *v1alpha1.VirtualMachine) { vm.Spec.Discard = boolPtr(false) }},
+		{"feature-no-guest-agent", func(vm *v1alpha1.VirtualMachine) { vm.Spec.GuestAgent = boolPtr(false) }},
+		{"feature-hotplug-maximums", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.MaxVCPUs = 8
+			vm.Spec.MaxMemoryGiB = 16
+		}},
+		{"feature-memory-mib", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.MemoryGiB = 0
+			vm.Spec.MemoryMiB = 1536
+		}},
+		{"feature-host-passthrough", func(vm *v1alpha1.VirtualMachine) { vm.Spec.CPUMode = "host-passthrough" }},
+		{"feature-smbios", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.SMBIOS = &v1alpha1.SMBIOSSpec{Serial: "SN-0042", AssetTag: "ASSET-7"}
+		}},
+		{"feature-vnc", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.Graphics = &v1alpha1.GraphicsSpec{Type: v1alpha1.GraphicsTypeVNC}
+		}},
+		{"feature-spice", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.Graphics = &v1alpha1.GraphicsSpec{Type: "spice", Listen: "0.0.0.0", Port: 5930, Password: "change-me"}
+		}},
+		{"feature-cloud-init-http", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.CloudInit.Transport = v1alpha1.CloudInitTransportHTTP
+			vm.Spec.CloudInit.SeedURL = "http://169.254.169.254:8775"
+			vm.Spec.SMBIOS = &v1alpha1.SMBIOSSpec{AssetTag: "ASSET-7"}
+		}},
+		{"feature-os-variant", func(vm *v1alpha1.VirtualMachine) { vm.Spec.OSVariant = "fedora43" }},
+		{"feature-host-devices", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.HostDevices = []v1alpha1.HostDeviceSpec{
+				{PCIAddress: "0000:01:00.0"},
+				{MdevUUID: "4b20d080-1b54-4048-85b3-a6a62d165c01"},
+			}
+		}},
+		{"feature-disk-tuning", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.IOThreads = 2
+			vm.Spec.BootDisk.DiskTuningSpec = v1alpha1.DiskTuningSpec{IO: "native", IOThread: 1}
+			vm.Spec.DataDisks = []v1alpha1.DataDiskSpec{
+				{Device: "vdb", SizeGB: 100, DiskTuningSpec: v1alpha1.DiskTuningSpec{Bus: "scsi", Cache: "writeback", Discard: boolPtr(false)}},
+				{Device: "vdc", SizeGB: 200, DiskTuningSpec: v1alpha1.DiskTuningSpec{IO: "threads", IOThread: 2}},
+			}
+		}},
+		{"feature-tpm", func(vm *v1alpha1.VirtualMachine) { vm.Spec.TPM = true }},
+		{"feature-limits", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.BootDisk.IOTune = &v1alpha1.DiskIOTuneSpec{ReadIOPS: 2000, WriteIOPS: 1000, TotalBytesPerSec: 104857600}
+			vm.Spec.NetworkInterfaces[0].Bandwidth = &v1alpha1.BandwidthSpec{
+				Inbound:  &v1alpha1.BandwidthLimitSpec{Average: 10240, Peak: 20480, Burst: 1024},
+				Outbound: &v1alpha1.BandwidthLimitSpec{Average: 5120},
+			}
+		}},
+		{"feature-macvtap-sriov", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.NetworkInterfaces[0].Bridge = ""
+			vm.Spec.NetworkInterfaces[0].Macvtap = &v1alpha1.MacvtapSpec{Device: "eno1", Mode: v1alpha1.MacvtapModePrivate}
+			vm.Spec.NetworkInterfaces = append(vm.Spec.NetworkInterfaces, v1alpha1.NetworkInterfaceSpec{
+				IP:    "10.1.0.10/24",
+				SRIOV: &v1alpha1.SRIOVSpec{PF: "enp1s0f0", VF: 3, PCIAddress: "0000:01:10.6"},
+			})
+		}},
+		{"feature-vlan", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.NetworkInterfaces[0].BridgeType = v1alpha1.BridgeTypeOpenVSwitch
+			vm.Spec.NetworkInterfaces[0].VLAN = 100
+			vm.Spec.NetworkInterfaces = append(vm.Spec.NetworkInterfaces,
+				v1alpha1.NetworkInterfaceSpec{IP: "10.1.0.10/24", Network: "trunk", VLAN: 200},
+				v1alpha1.NetworkInterfaceSpec{IP: "10.2.0.10/24", Bridge: "br1", VLAN: 300},
+			)
+		}},
+		{"feature-mtu", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.NetworkInterfaces[0].MTU = 9000
+			vm.Spec.NetworkInterfaces[0].MACAddress = "52:54:00:aa:bb:cc"
+		}},
+		{"feature-queues", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.NetworkInterfaces[0].Queues = 8
+			vm.Spec.NetworkInterfaces = append(vm.Spec.NetworkInterfaces,
+				v1alpha1.NetworkInterfaceSpec{IP: "10.1.0.10/24", Bridge: "br1", Queues: 1})
+		}},
+		{"feature-sata-boot-disk", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.BootDisk.Bus = "sata"
+			vm.Spec.BootDisk.Cache = "unsafe"
+		}},
+	}
+
+	// goldenExcluded are matrix combinations the loader rejects, so their
+	// XML is never generated.
+	goldenExcluded = map[string]string{
+		"firmware-secure-boot_machine-pc": "Secure Boot requires q35",
+	}
+)
+
+// goldenMatrix returns a case for every combination of one variant from
+// each dimension, named after its variants, except the excluded ones.
+func goldenMatrix(dimensions ...[]goldenVariant) []goldenCase {
+	cases := []goldenCase{{vm: goldenBaseVM()}}
+	for _, dimension := range dimensions {
+		var next []goldenCase
+		for _, c := range cases {
+			for _, variant := range dimension {
+				vm := c.vm.DeepCopy()
+				variant.apply(vm)
+				name := variant.name
+				if c.name != "" {
+					name = c.name + "_" + variant.name
+				}
+				next = append(next, goldenCase{name: name, vm: vm})
+			}
+		}
+		cases = next
+	}
+
+	var kept []goldenCase
+	for _, c := range cases {
+		if _, excluded := goldenExcluded[c.name]; !excluded {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// goldenCases returns every golden case: firmware by machine type, NIC
+// types by cdroms, and each feature on its own.
+func goldenCases() []goldenCase {
+	var cases []goldenCase
+	cases = append(cases, goldenMatrix(goldenFirmware, goldenMachine)...)
+	cases = append(cases, goldenMatrix(goldenNIC, goldenCDROM)...)
+	cases = append(cases, goldenMatrix(goldenFeatures)...)
+	return cases
+}
+
+// TestGoldenDomainXML checks the domain XML of every golden case against
+// its fixture in testdata/domain. After an intended change to the XML, run
+// 'go generate ./internal/libvirt' and review the fixture diff.
+func TestGoldenDomainXML(t *testing.T) {
+	cases := goldenCases()
+	want := make(map[string]bool, len(cases))
+
+	for _, c := range cases {
+		file := filepath.Join(goldenDir, c.name+".xml")
+		want[filepath.Base(file)] = true
+
+		t.Run(c.name, func(t *testing.T) {
+			got, err := GenerateDomainXML(c.vm)
+			if err != nil {
+				t.Fatalf("GenerateDomainXML() error = %v", err)
+			}
+			got += "\n"
+
+			if *update {
+				if err := os.MkdirAll(goldenDir, 0755); err != nil {
+					t.Fatalf("failed to create %s: %v", goldenDir, err)
+				}
+				if err := os.WriteFile(file, []byte(got), 0644); err != nil {
+					t.Fatalf("failed to write fixture: %v", err)
+				}
+				return
+			}
+
+			fixture, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("missing fixture %s (run 'go generate ./internal/libvirt'): %v", file, err)
+			}
+			if string(fixture) != got {
+				t.Errorf("domain XML differs from %s (run 'go generate ./internal/libvirt' if intended):\n%s",
+					file, lineDiff(string(fixture), got))
+			}
+		})
+	}
+
+	// Fixtures of removed cases would otherwise linger unchecked
+	entries, err := os.ReadDir(goldenDir)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", goldenDir, err)
+	}
+	for _, entry := range entries {
+		if want[entry.Name()] {
+			continue
+		}
+		path := filepath.Join(goldenDir, entry.Name())
+		if *update {
+			if err := os.Remove(path); err != nil {
+				t.Errorf("failed to remove stale fixture: %v", err)
+			}
+			continue
+		}
+		t.Errorf("stale fixture %s has no golden case (run 'go generate ./internal/libvirt')", path)
+	}
+}
+
+func TestGoldenMatrix(t *testing.T) {
+	cases := goldenMatrix(goldenFirmware, goldenMachine)
+	if len(cases) != len(goldenFirmware)*len(goldenMachine)-1 {
+		t.Errorf("got %d cases, want every combination but the excluded one", len(cases))
+	}
+
+	names := make([]string, 0, len(cases))
+	for _, c := range cases {
+		names = append(names, c.name)
+	}
+	sort.Strings(names)
+	for i := 1; i < len(names); i++ {
+		if names[i] == names[i-1] {
+			t.Errorf("duplicate case %s", names[i])
+		}
+	}
+
+	// Variants are applied to copies of the base spec
+	for _, c := range cases {
+		if c.name == "firmware-efi_machine-default" && (c.vm.Spec.MachineType != "" || c.vm.Spec.Firmware != "") {
+			t.Errorf("base case was modified by other variants: %+v", c.vm.Spec)
+		}
+	}
+}
+
+// lineDiff returns the lines that differ between want and got, prefixed
+// with - and + like a unified diff, with the line numbers in want.
+func lineDiff(want, got string) string {
+	a := strings.Split(want, "\n")
+	b := strings.Split(got, "\n")
+
+	// Longest common subsequence table
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(&out, "%4d - %s\n", i+1, a[i])
+			i++
+		default:
+			fmt.Fprintf(&out, "%4d + %s\n", i+1, b[j])
+			j++
+		}
+	}
+	return out.String()
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,7 @@
+//go:build linux
+
+package libvirt
+
+// LocalHypervisor reports whether foundry can manage a hypervisor on the host
+// it runs on, through the local libvirt socket.
+const LocalHypervisor = true
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package libvirt
+
+// LocalHypervisor reports whether foundry can manage a hypervisor on the host
+// it runs on, through the local libvirt socket. Outside Linux foundry is only
+// a client of remote hypervisors.
+const LocalHypervisor = false
@@ -0,0 +1,133 @@
+package libvirt
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"libvirt.org/go/libvirtxml"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+// OSInfoNamespace is the XML namespace of the libosinfo element in domain
+// metadata, as written by virt-install and read by virt-manager.
+const OSInfoNamespace = "http://libosinfo.org/xmlns/libvirt/domain/1.0"
+
+// osVariants maps the libosinfo short IDs of common guest operating systems
+// to their libosinfo IDs. Other operating systems can be given by full ID.
+var osVariants = map[string]string{
+	"almalinux8":      "http://almalinux.org/almalinux/8",
+	"almalinux9":      "http://almalinux.org/almalinux/9",
+	"alpinelinux3.20": "http://alpinelinux.org/alpinelinux/3.20",
+	"alpinelinux3.21": "http://alpinelinux.org/alpinelinux/3.21",
+	"centos-stream9":  "http://centos.org/centos-stream/9",
+	"centos-stream10": "http://centos.org/centos-stream/10",
+	"debian11":        "http://debian.org/debian/11",
+	"debian12":        "http://debian.org/debian/12",
+	"debian13":        "http://debian.org/debian/13",
+	"fedora41":        "http://fedoraproject.org/fedora/41",
+	"fedora42":        "http://fedoraproject.org/fedora/42",
+	"fedora43":        "http://fedoraproject.org/fedora/43",
+	"freebsd14.2":     "http://freebsd.org/freebsd/14.2",
+	"freebsd14.3":     "http://freebsd.org/freebsd/14.3",
+	"linux2022":       "http://libosinfo.org/linux/2022",
+	"linux2024":       "http://libosinfo.org/linux/2024",
+	"opensuse15.6":    "http://opensuse.org/opensuse/15.6",
+	"rhel8.10":        "http://redhat.com/rhel/8.10",
+	"rhel9.6":         "http://redhat.com/rhel/9.6",
+	"rhel10.0":        "http://redhat.com/rhel/10.0",
+	"rocky8":          "http://rockylinux.org/rocky/8",
+	"rocky9":          "http://rockylinux.org/rocky/9",
+	"rocky10":         "http://rockylinux.org/rocky/10",
+	"ubuntu22.04":     "http://ubuntu.com/ubuntu/22.04",
+	"ubuntu24.04":     "http://ubuntu.com/ubuntu/24.04",
+	"ubuntu25.04":     "http://ubuntu.com/ubuntu/25.04",
+	"win10":           "http://microsoft.com/win/10",
+	"win11":           "http://microsoft.com/win/11",
+	"win2k19":         "http://microsoft.com/win/2k19",
+	"win2k22":         "http://microsoft.com/win/2k22",
+	"win2k25":         "http://microsoft.com/win/2k25",
+}
+
+// OSVariants returns the known libosinfo short IDs, sorted.
+func OSVariants() []string {
+	variants := make([]string, 0, len(osVariants))
+	for variant := range osVariants {
+		variants = append(variants, variant)
+	}
+	sort.Strings(variants)
+	return variants
+}
+
+// OSInfoID returns the libosinfo ID of an OS variant given as a known short
+// ID (e.g. "fedora43") or as a full libosinfo ID URI, which is returned as
+// is.
+func OSInfoID(variant string) (string, error) {
+	if id, ok := osVariants[variant]; ok {
+		return id, nil
+	}
+	if strings.Contains(variant, "://") {
+		u, err := url.Parse(variant)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "", fmt.Errorf("OS variant %q is not a valid libosinfo ID", variant)
+		}
+		return variant, nil
+	}
+	return "", fmt.Errorf("unknown OS variant %q (use a libosinfo ID such as http://fedoraproject.org/fedora/43, or one of: %s)",
+		variant, strings.Join(OSVariants(), ", "))
+}
+
+// osInfoMetadata returns the domain metadata recording the OS variant of a
+// VM, or nil if it has none. An unknown OS variant in the spec is an error;
+// one recorded from the boot image is only dropped, as it was never
+// validated against this table.
+func osInfoMetadata(vm *v1alpha1.VirtualMachine) (*libvirtxml.DomainMetadata, error) {
+	variant := vm.GetOSVariant()
+	if variant == "" {
+		return nil, nil
+	}
+	id, err := OSInfoID(variant)
+	if err != nil {
+		if vm.Spec.OSVariant != "" {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return &libvirtxml.DomainMetadata{XML: osInfoElement(id)}, nil
+}
+
+// osInfoElement returns the libosinfo metadata element for a libosinfo ID.
+func osInfoElement(id string) string {
+	return fmt.Sprintf(`<libosinfo:libosinfo xmlns:libosinfo=%q><libosinfo:os id=%q/></libosinfo:libosinfo>`, OSInfoNamespace, id)
+}
+
+// osInfoElementPattern matches a libosinfo metadata element as libvirt
+// formats it, whatever its namespace prefix. It does not match the os
+// element nested in it.
+var osInfoElementPattern = regexp.MustCompile(`(?s)\s*<(?:[A-Za-z_][\w.-]*:)?libosinfo[\s>/].*?</(?:[A-Za-z_][\w.-]*:)?libosinfo>`)
+
+// MergeOSInfoMetadata returns the metadata of an existing domain with its
+// libosinfo element replaced by the one generated for vm, or removed if vm
+// has no OS variant. Other metadata, such as the stored foundry spec, is
+// kept. Redefining a domain uses it so a changed OS variant takes effect.
+func MergeOSInfoMetadata(existing *libvirtxml.DomainMetadata, vm *v1alpha1.VirtualMachine) (*libvirtxml.DomainMetadata, error) {
+	generated, err := osInfoMetadata(vm)
+	if err != nil {
+		return nil, err
+	}
+
+	inner := ""
+	if existing != nil {
+		inner = osInfoElementPattern.ReplaceAllString(existing.XML, "")
+	}
+	if generated != nil {
+		inner += generated.XML
+	}
+	if strings.TrimSpace(inner) == "" {
+		return nil, nil
+	}
+	return &libvirtxml.DomainMetadata{XML: inner}, nil
+}
@@ -0,0 +1,88 @@
+package libvirt
+
+import (
+	"strings"
+	"testing"
+
+	"libvirt.org/go/libvirtxml"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+func TestOSInfoID(t *testing.T) {
+	tests := []struct {
+		variant string
+		want    string
+		wantErr string
+	}{
+		{variant: "fedora43", want: "http://fedoraproject.org/fedora/43"},
+		{variant: "ubuntu24.04", want: "http://ubuntu.com/ubuntu/24.04"},
+		{variant: "http://example.org/myos/1", want: "http://example.org/myos/1"},
+		{variant: "Fedora43", wantErr: "unknown OS variant"},
+		{variant: "https://", wantErr: "not a valid libosinfo ID"},
+	}
+	for _, tt := range tests {
+		got, err := OSInfoID(tt.variant)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("OSInfoID(%q) error = %v, want %q", tt.variant, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("OSInfoID(%q) = %q, %v, want %q", tt.variant, got, err, tt.want)
+		}
+	}
+}
+
+func TestOSInfoMetadata_FromImage(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{ObjectMeta: v1alpha1.ObjectMeta{
+		Annotations: map[string]string{v1alpha1.AnnotationOSVariant: "debian12"},
+	}}
+	meta, err := osInfoMetadata(vm)
+	if err != nil || meta == nil || !strings.Contains(meta.XML, `id="http://debian.org/debian/12"`) {
+		t.Errorf("osInfoMetadata() = %+v, %v, want the image's OS variant", meta, err)
+	}
+
+	// An unknown variant recorded from the image is dropped, not an error
+	vm.Annotations[v1alpha1.AnnotationOSVariant] = "someos1"
+	if meta, err := osInfoMetadata(vm); meta != nil || err != nil {
+		t.Errorf("osInfoMetadata() = %+v, %v, want no metadata", meta, err)
+	}
+
+	vm.Spec.OSVariant = "someos1"
+	if _, err := osInfoMetadata(vm); err == nil {
+		t.Error("osInfoMetadata() error = nil, want the unknown spec variant rejected")
+	}
+}
+
+func TestMergeOSInfoMetadata(t *testing.T) {
+	foundry := `<foundry:metadata xmlns:foundry="http://foundry.cofront.xyz/v1alpha1">spec: {}</foundry:metadata>`
+	existing := &libvirtxml.DomainMetadata{XML: "\n    " + foundry +
+		"\n    " + osInfoElement("http://fedoraproject.org/fedora/42") + "\n  "}
+
+	vm := &v1alpha1.VirtualMachine{Spec: v1alpha1.VirtualMachineSpec{OSVariant: "fedora43"}}
+	merged, err := MergeOSInfoMetadata(existing, vm)
+	if err != nil {
+		t.Fatalf("MergeOSInfoMetadata() error = %v", err)
+	}
+	if !strings.Contains(merged.XML, foundry) {
+		t.Errorf("merged = %q, want the foundry metadata kept", merged.XML)
+	}
+	if strings.Contains(merged.XML, "fedora/42") || strings.Count(merged.XML, "fedora/43") != 1 {
+		t.Errorf("merged = %q, want only the new OS variant", merged.XML)
+	}
+
+	// Without an OS variant the element is removed
+	merged, err = MergeOSInfoMetadata(existing, &v1alpha1.VirtualMachine{})
+	if err != nil {
+		t.Fatalf("MergeOSInfoMetadata() error = %v", err)
+	}
+	if strings.Contains(merged.XML, "libosinfo") || !strings.Contains(merged.XML, foundry) {
+		t.Errorf("merged = %q, want only the foundry metadata", merged.XML)
+	}
+
+	if merged, err := MergeOSInfoMetadata(nil, &v1alpha1.VirtualMachine{}); merged != nil || err != nil {
+		t.Errorf("MergeOSInfoMetadata(nil) = %+v, %v, want nil", merged, err)
+	}
+}
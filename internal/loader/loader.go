@@ -3,34 +3,205 @@
 package loader
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/google/uuid"
 	"go.yaml.in/yaml/v3"
 
 	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/doctor"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/sshkey"
 )
 
 // LoadFromFile loads a VirtualMachine resource from a YAML file.
 // The file must be in the foundry.cofront.xyz/v1alpha1 format.
-func LoadFromFile(path string) (*v1alpha1.VirtualMachine, error) {
+func LoadFromFile(ctx context.Context, path string) (*v1alpha1.VirtualMachine, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
 	}
 
-	return LoadFromYAML(data)
+	return loadYAML(ctx, data, filepath.Dir(path))
 }
 
 // LoadFromYAML loads a VirtualMachine resource from YAML bytes.
 // The YAML must be in the foundry.cofront.xyz/v1alpha1 format.
-func LoadFromYAML(data []byte) (*v1alpha1.VirtualMachine, error) {
+// A relative spec.cloudInit.userDataFile is resolved against the working
+// directory.
+func LoadFromYAML(ctx context.Context, data []byte) (*v1alpha1.VirtualMachine, error) {
+	return loadYAML(ctx, data, "")
+}
+
+// LoadUntrustedYAML loads a VirtualMachine resource from YAML bytes that come
+// from someone other than the user running foundry, such as an API request
+// body or a Kubernetes resource. It never reads files: a
+// spec.cloudInit.userDataFile would let the sender read any file foundry can
+// read on the host, and a file path in spec.bootDisk.image would attach one
+// to the VM, so both are rejected.
+func LoadUntrustedYAML(ctx context.Context, data []byte) (*v1alpha1.VirtualMachine, error) {
 	var vm v1alpha1.VirtualMachine
 	if err := yaml.Unmarshal(data, &vm); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal YAML: %w", err)
 	}
+	if vm.Spec.CloudInit != nil && vm.Spec.CloudInit.UserDataFile != "" {
+		return nil, fmt.Errorf("validation failed: spec.cloudInit.userDataFile refers to a file on the host and is not allowed here; put the user data in spec.cloudInit.userDataExtra")
+	}
+	if image := vm.Spec.BootDisk.Image; strings.Contains(image, "/") || strings.HasPrefix(image, ".") {
+		return nil, fmt.Errorf("validation failed: spec.bootDisk.image %q refers to a file on the host and is not allowed here; use an image name or pool:volume", image)
+	}
+
+	return loadVM(ctx, &vm, "")
+}
+
+// Document is a VirtualMachine loaded by LoadAll, or the error loading it.
+type Document struct {
+	// Source identifies the document: its file, followed by #<n> if the
+	// file contains several documents (e.g., "vms/web.yaml#2").
+	Source string
+
+	// VM is the loaded VirtualMachine. It may be set even if Err is, e.g.
+	// for a duplicate name.
+	VM *v1alpha1.VirtualMachine
+
+	// Err is the error loading or validating the document.
+	Err error
+}
+
+// LoadAll loads every VirtualMachine in path, which is either a YAML file
+// with one or more documents separated by "---", or a directory whose
+// *.yaml and *.yml files (not subdirectories) are loaded in name order.
+//
+// A document that fails to load does not stop the others from loading; its
+// error is returned in its Document. VM names must be unique across all
+// documents. An error is returned only if path itself cannot be read.
+func LoadAll(ctx context.Context, path string) ([]Document, error) {
+	return LoadAllWithValues(ctx, path, nil)
+}
+
+// LoadAllWithValues is LoadAll, rendering each file with values first (see
+// Render). Files are not rendered if values is nil.
+func LoadAllWithValues(ctx context.Context, path string, values Values) ([]Document, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory %s: %w", path, err)
+		}
+		files = nil
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+				continue
+			}
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no YAML files found in %s", path)
+		}
+	}
+
+	var docs []Document
+	for _, file := range files {
+		docs = append(docs, loadDocuments(ctx, file, values)...)
+	}
 
+	// Later documents would otherwise update the VM created by earlier ones
+	seen := make(map[string]string)
+	for i := range docs {
+		doc := &docs[i]
+		if doc.Err != nil || doc.VM.Name == "" {
+			continue
+		}
+		if first, ok := seen[doc.VM.Name]; ok {
+			doc.Err = fmt.Errorf("duplicate VM name %s (also in %s)", doc.VM.Name, first)
+			continue
+		}
+		seen[doc.VM.Name] = doc.Source
+	}
+
+	warnSharedSSHKeys(ctx, docs)
+
+	return docs, nil
+}
+
+// loadDocuments loads each YAML document in a file, after rendering it with
+// values unless they are nil. Empty documents are skipped; a syntax error
+// ends the file since the rest cannot be parsed.
+func loadDocuments(ctx context.Context, path string, values Values) []Document {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []Document{{Source: path, Err: fmt.Errorf("failed to read file %s: %w", path, err)}}
+	}
+	if values != nil {
+		if data, err = Render(filepath.Base(path), data, values); err != nil {
+			return []Document{{Source: path, Err: err}}
+		}
+	}
+
+	var docs []Document
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var node yaml.Node
+		err := decoder.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			docs = append(docs, Document{Err: fmt.Errorf("failed to unmarshal YAML: %w", err)})
+			break
+		}
+		if len(node.Content) == 0 || node.Content[0].Tag == "!!null" {
+			continue
+		}
+
+		var vm v1alpha1.VirtualMachine
+		if err := node.Decode(&vm); err != nil {
+			docs = append(docs, Document{Err: fmt.Errorf("failed to unmarshal YAML: %w", err)})
+			continue
+		}
+		loaded, err := loadVM(ctx, &vm, filepath.Dir(path))
+		docs = append(docs, Document{VM: loaded, Err: err})
+	}
+
+	for i := range docs {
+		docs[i].Source = path
+		if len(docs) > 1 {
+			docs[i].Source = fmt.Sprintf("%s#%d", path, i+1)
+		}
+	}
+	return docs
+}
+
+// loadYAML loads a VirtualMachine resource from YAML bytes, resolving
+// relative file references against baseDir.
+func loadYAML(ctx context.Context, data []byte, baseDir string) (*v1alpha1.VirtualMachine, error) {
+	var vm v1alpha1.VirtualMachine
+	if err := yaml.Unmarshal(data, &vm); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal YAML: %w", err)
+	}
+
+	return loadVM(ctx, &vm, baseDir)
+}
+
+// loadVM checks the type of an unmarshaled VirtualMachine, then inlines
+// referenced files, applies defaults and validates it.
+func loadVM(ctx context.Context, vm *v1alpha1.VirtualMachine, baseDir string) (*v1alpha1.VirtualMachine, error) {
 	// Validate that apiVersion and kind are present
 	if vm.APIVersion == "" {
 		return nil, fmt.Errorf("missing required field: apiVersion")
@@ -50,15 +221,86 @@ func LoadFromYAML(data []byte) (*v1alpha1.VirtualMachine, error) {
 		return nil, fmt.Errorf("unsupported kind: %s (expected: %s)", vm.Kind, v1alpha1.VirtualMachineKind)
 	}
 
+	// Inline referenced files so the stored spec is self-contained
+	if err := inlineUserDataFile(vm, baseDir); err != nil {
+		return nil, err
+	}
+
 	// Set defaults for fields that may be omitted
-	applyDefaults(&vm)
+	applyDefaults(vm)
 
 	// Validate the spec
-	if err := validateSpec(&vm); err != nil {
+	if err := validateSpec(vm); err != nil {
 		return nil, fmt.Errorf("validation failed: %w", err)
 	}
 
-	return &vm, nil
+	dedupeSSHKeys(ctx, vm)
+
+	return vm, nil
+}
+
+// dedupeSSHKeys normalizes the whitespace of the authorized keys of a valid
+// VM and removes keys listed more than once, which would otherwise be
+// injected repeatedly. Keys are compared by their key data, so the same key
+// under another comment is a duplicate too; the first occurrence is kept.
+func dedupeSSHKeys(ctx context.Context, vm *v1alpha1.VirtualMachine) {
+	if vm.Spec.CloudInit == nil || len(vm.Spec.CloudInit.SSHAuthorizedKeys) == 0 {
+		return
+	}
+
+	var keys []string
+	seen := make(map[string]string)
+	for _, key := range vm.Spec.CloudInit.SSHAuthorizedKeys {
+		key = sshkey.Normalize(key)
+		if first, ok := seen[sshkey.Data(key)]; ok {
+			if sshkey.Comment(first) != sshkey.Comment(key) {
+				logging.FromContext(ctx).Warn("SSH key is the same key as an earlier one; keeping the first", "vm", vm.Name, "key", keyLabel(key), "first", keyLabel(first))
+			} else {
+				logging.FromContext(ctx).Warn("SSH key is listed more than once", "vm", vm.Name, "key", keyLabel(key))
+			}
+			continue
+		}
+		seen[sshkey.Data(key)] = key
+		keys = append(keys, key)
+	}
+	vm.Spec.CloudInit.SSHAuthorizedKeys = keys
+}
+
+// warnSharedSSHKeys warns about keys that the loaded documents list under
+// different comments, which usually means one key is labelled as belonging
+// to different users.
+func warnSharedSSHKeys(ctx context.Context, docs []Document) {
+	type use struct{ key, source string }
+	first := make(map[string]use)
+	for _, doc := range docs {
+		if doc.Err != nil || doc.VM.Spec.CloudInit == nil {
+			continue
+		}
+		for _, key := range doc.VM.Spec.CloudInit.SSHAuthorizedKeys {
+			data := sshkey.Data(key)
+			prev, ok := first[data]
+			if !ok {
+				first[data] = use{key: key, source: doc.Source}
+				continue
+			}
+			if sshkey.Comment(prev.key) != sshkey.Comment(key) {
+				logging.FromContext(ctx).Warn("SSH key is the same key as one in another document", "source", doc.Source, "key", keyLabel(key), "other", keyLabel(prev.key), "otherSource", prev.source)
+			}
+		}
+	}
+}
+
+// keyLabel names a key in messages by its comment, or by the end of its key
+// data if it has none.
+func keyLabel(key string) string {
+	if comment := sshkey.Comment(key); comment != "" {
+		return comment
+	}
+	data := sshkey.Data(key)
+	if len(data) > 12 {
+		data = "..." + data[len(data)-12:]
+	}
+	return data
 }
 
 // SaveToFile saves a VirtualMachine resource to a YAML file.
@@ -78,21 +320,72 @@ func SaveToFile(vm *v1alpha1.VirtualMachine, path string) error {
 	return nil
 }
 
+// inlineUserDataFile reads spec.cloudInit.userDataFile into
+// spec.cloudInit.userDataExtra.
+func inlineUserDataFile(vm *v1alpha1.VirtualMachine, baseDir string) error {
+	ci := vm.Spec.CloudInit
+	if ci == nil || ci.UserDataFile == "" {
+		return nil
+	}
+	if ci.UserDataExtra != "" {
+		return fmt.Errorf("validation failed: spec.cloudInit cannot specify both userDataExtra and userDataFile")
+	}
+
+	path := ci.UserDataFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read spec.cloudInit.userDataFile: %w", err)
+	}
+
+	ci.UserDataExtra = string(data)
+	ci.UserDataFile = ""
+	return nil
+}
+
+// Memory sizes outside these bounds are most likely a unit mix-up.
+const (
+	maxPlausibleMemoryGiB = 1024
+	minPlausibleMemoryMiB = 256
+)
+
+// Warnings returns problems with a valid VirtualMachine that are probably
+// mistakes, such as memory sizes that suggest the wrong unit was used.
+func Warnings(vm *v1alpha1.VirtualMachine) []string {
+	var warnings []string
+
+	if vm.Spec.MemoryGiB > maxPlausibleMemoryGiB {
+		warnings = append(warnings, fmt.Sprintf(
+			"spec.memoryGiB is %d (more than 1 TiB of memory); did you mean memoryMiB: %d?",
+			vm.Spec.MemoryGiB, vm.Spec.MemoryGiB))
+	}
+	if vm.Spec.MemoryMiB > maxPlausibleMemoryGiB*1024 {
+		warnings = append(warnings, fmt.Sprintf(
+			"spec.memoryMiB is %d (more than 1 TiB of memory)", vm.Spec.MemoryMiB))
+	}
+	if vm.Spec.MemoryMiB > 0 && vm.Spec.MemoryMiB < minPlausibleMemoryMiB {
+		warnings = append(warnings, fmt.Sprintf(
+			"spec.memoryMiB is only %d MiB, too little to boot most cloud images; did you mean memoryGiB: %d?",
+			vm.Spec.MemoryMiB, vm.Spec.MemoryMiB))
+	}
+
+	return warnings
+}
+
 // applyDefaults sets default values for optional fields.
 func applyDefaults(vm *v1alpha1.VirtualMachine) {
 	// Apply defaults from helpers
 	if vm.Spec.CPUMode == "" {
 		vm.Spec.CPUMode = "host-model"
 	}
-	if vm.Spec.StoragePool == "" {
-		vm.Spec.StoragePool = "foundry-vms"
-	}
 	if vm.Spec.BootDisk.Format == "" {
 		vm.Spec.BootDisk.Format = "qcow2"
 	}
-	if vm.Spec.BootDisk.ImagePool == "" {
-		vm.Spec.BootDisk.ImagePool = "foundry-images"
-	}
+
+	// Storage pools, bridges and DNS servers of the host config
+	vm.ApplyHostDefaults()
 	if vm.Spec.Autostart == nil {
 		autostart := true
 		vm.Spec.Autostart = &autostart
@@ -103,8 +396,14 @@ func applyDefaults(vm *v1alpha1.VirtualMachine) {
 		vm.Status.Phase = v1alpha1.VMPhasePending
 	}
 
-	// Normalize name to lowercase
+	// Normalize name and name prefix to lowercase
 	vm.Name = strings.ToLower(vm.Name)
+	vm.GenerateName = strings.ToLower(vm.GenerateName)
+
+	// Normalize MAC addresses to lowercase
+	for i := range vm.Spec.NetworkInterfaces {
+		vm.Spec.NetworkInterfaces[i].MACAddress = strings.ToLower(vm.Spec.NetworkInterfaces[i].MACAddress)
+	}
 
 	// Normalize FQDN to lowercase
 	if vm.Spec.CloudInit != nil && vm.Spec.CloudInit.FQDN != "" {
@@ -114,9 +413,9 @@ func applyDefaults(vm *v1alpha1.VirtualMachine) {
 
 // validateSpec validates the VirtualMachine spec for required fields and consistency.
 func validateSpec(vm *v1alpha1.VirtualMachine) error {
-	// Validate metadata.name
-	if vm.Name == "" {
-		return fmt.Errorf("metadata.name is required")
+	// Validate metadata.name; with generateName the name is chosen at creation
+	if vm.Name == "" && vm.GenerateName == "" {
+		return fmt.Errorf("metadata.name or metadata.generateName is required")
 	}
 
 	// Validate VCPUs
@@ -125,10 +424,189 @@ func validateSpec(vm *v1alpha1.VirtualMachine) error {
 	}
 
 	// Validate memory
-	if vm.Spec.MemoryGiB <= 0 {
+	if vm.Spec.MemoryGiB != 0 && vm.Spec.MemoryMiB != 0 {
+		return fmt.Errorf("spec.memoryGiB and spec.memoryMiB are mutually exclusive")
+	}
+	if vm.Spec.MemoryMiB < 0 {
+		return fmt.Errorf("spec.memoryMiB must be greater than 0")
+	}
+	if vm.Spec.MemoryMiB == 0 && vm.Spec.MemoryGiB <= 0 {
 		return fmt.Errorf("spec.memoryGiB must be greater than 0")
 	}
 
+	// Validate hotplug maximums
+	if vm.Spec.MaxVCPUs != 0 && vm.Spec.MaxVCPUs < vm.Spec.VCPUs {
+		return fmt.Errorf("spec.maxVCPUs (%d) must not be less than spec.vcpus (%d)", vm.Spec.MaxVCPUs, vm.Spec.VCPUs)
+	}
+	if vm.Spec.MaxMemoryGiB < 0 {
+		return fmt.Errorf("spec.maxMemoryGiB must be greater than 0")
+	}
+	if vm.Spec.MaxMemoryGiB != 0 && vm.Spec.MaxMemoryGiB*1024 < vm.GetMemoryMiB() {
+		return fmt.Errorf("spec.maxMemoryGiB (%dGiB) must not be less than the memory (%dMiB)", vm.Spec.MaxMemoryGiB, vm.GetMemoryMiB())
+	}
+
+	// Validate SSH keys
+	if ci := vm.Spec.CloudInit; ci != nil {
+		for i, key := range ci.SSHAuthorizedKeys {
+			if err := sshkey.Validate(strings.TrimSpace(key)); err != nil {
+				return fmt.Errorf("spec.cloudInit.sshAuthorizedKeys[%d]: %w", i, err)
+			}
+		}
+	}
+
+	// Validate the cloud-init transport
+	if ci := vm.Spec.CloudInit; ci != nil {
+		switch ci.Transport {
+		case "", v1alpha1.CloudInitTransportISO:
+			if ci.SeedURL != "" {
+				return fmt.Errorf("spec.cloudInit.seedURL requires transport %s", v1alpha1.CloudInitTransportHTTP)
+			}
+		case v1alpha1.CloudInitTransportHTTP:
+			if ci.SeedURL == "" {
+				return fmt.Errorf("spec.cloudInit.seedURL is required with transport %s", v1alpha1.CloudInitTransportHTTP)
+			}
+			u, err := url.Parse(ci.SeedURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("spec.cloudInit.seedURL %q must be an http or https URL", ci.SeedURL)
+			}
+			// A ';' would end the seed URL cloud-init reads from the serial
+			if strings.Contains(ci.SeedURL, ";") {
+				return fmt.Errorf("spec.cloudInit.seedURL must not contain ';'")
+			}
+			if vm.Spec.SMBIOS != nil && vm.Spec.SMBIOS.Serial != "" {
+				return fmt.Errorf("spec.smbios.serial cannot be set with cloud-init transport %s, which passes the seed URL in the serial", v1alpha1.CloudInitTransportHTTP)
+			}
+		default:
+			return fmt.Errorf("spec.cloudInit.transport must be %s or %s, got %q",
+				v1alpha1.CloudInitTransportISO, v1alpha1.CloudInitTransportHTTP, ci.Transport)
+		}
+	}
+
+	// Validate the cloud-init datasource
+	if ci := vm.Spec.CloudInit; ci != nil {
+		switch ci.Datasource {
+		case "", v1alpha1.CloudInitDatasourceNoCloud:
+		case v1alpha1.CloudInitDatasourceConfigDrive:
+			if vm.GetCloudInitTransport() != v1alpha1.CloudInitTransportISO {
+				return fmt.Errorf("spec.cloudInit.datasource %s requires transport %s", ci.Datasource, v1alpha1.CloudInitTransportISO)
+			}
+		default:
+			return fmt.Errorf("spec.cloudInit.datasource must be %s or %s, got %q",
+				v1alpha1.CloudInitDatasourceNoCloud, v1alpha1.CloudInitDatasourceConfigDrive, ci.Datasource)
+		}
+	}
+
+	// Validate extra user-data
+	if ci := vm.Spec.CloudInit; ci != nil && ci.UserDataExtra != "" {
+		if ci.RawUserData != "" {
+			return fmt.Errorf("spec.cloudInit cannot specify both rawUserData and userDataExtra")
+		}
+		var extra map[string]interface{}
+		if err := yaml.Unmarshal([]byte(ci.UserDataExtra), &extra); err != nil {
+			return fmt.Errorf("spec.cloudInit.userDataExtra must be a YAML mapping: %w", err)
+		}
+	}
+
+	// Validate TTL
+	if vm.Spec.TTL != nil && vm.Spec.TTL.Duration <= 0 {
+		return fmt.Errorf("spec.ttl must be greater than 0")
+	}
+
+	// Validate startup ordering
+	if vm.Spec.StartupOrder < 0 {
+		return fmt.Errorf("spec.startupOrder must not be negative")
+	}
+	if vm.Spec.StartupDelay != nil && vm.Spec.StartupDelay.Duration < 0 {
+		return fmt.Errorf("spec.startupDelay must not be negative")
+	}
+
+	// Validate firmware and machine type
+	switch vm.Spec.Firmware {
+	case "", "efi", "bios":
+	default:
+		return fmt.Errorf("spec.firmware %q is invalid (must be efi or bios)", vm.Spec.Firmware)
+	}
+	switch vm.Spec.MachineType {
+	case "", "q35", "pc":
+	default:
+		return fmt.Errorf("spec.machineType %q is invalid (must be q35 or pc)", vm.Spec.MachineType)
+	}
+	if vm.IsSecureBoot() {
+		if vm.GetFirmware() != "efi" {
+			return fmt.Errorf("spec.secureBoot requires firmware efi")
+		}
+		if vm.Spec.MachineType == "pc" {
+			return fmt.Errorf("spec.secureBoot requires machineType q35")
+		}
+	}
+
+	// Validate the OS variant
+	if vm.Spec.OSVariant != "" {
+		if _, err := foundrylibvirt.OSInfoID(vm.Spec.OSVariant); err != nil {
+			return fmt.Errorf("spec.osVariant: %w", err)
+		}
+	}
+
+	// Validate SMBIOS strings
+	if smbios := vm.Spec.SMBIOS; smbios != nil {
+		if smbios.Serial == "" && smbios.AssetTag == "" && len(smbios.OEMStrings) == 0 {
+			return fmt.Errorf("spec.smbios must set serial, assetTag or oemStrings")
+		}
+		for i, s := range smbios.OEMStrings {
+			if s == "" {
+				return fmt.Errorf("spec.smbios.oemStrings[%d] must not be empty", i)
+			}
+		}
+	}
+
+	// Validate display
+	if graphics := vm.Spec.Graphics; graphics != nil {
+		switch graphics.Type {
+		case v1alpha1.GraphicsTypeVNC, v1alpha1.GraphicsTypeSPICE:
+		case "":
+			return fmt.Errorf("spec.graphics.type is required (vnc or spice)")
+		default:
+			return fmt.Errorf("spec.graphics.type %q is invalid (must be vnc or spice)", graphics.Type)
+		}
+		if graphics.Listen != "" && net.ParseIP(graphics.Listen) == nil {
+			return fmt.Errorf("spec.graphics.listen %q is not a valid IP address", graphics.Listen)
+		}
+		if graphics.Port != 0 && (graphics.Port < 5900 || graphics.Port > 65535) {
+			return fmt.Errorf("spec.graphics.port %d is invalid (must be between 5900 and 65535)", graphics.Port)
+		}
+		if graphics.Type == v1alpha1.GraphicsTypeVNC && len(graphics.Password) > 8 {
+			return fmt.Errorf("spec.graphics.password is too long for VNC (at most 8 characters)")
+		}
+	}
+
+	// Validate host devices
+	hostDevicesSeen := make(map[string]bool)
+	for i, dev := range vm.Spec.HostDevices {
+		var key string
+		switch {
+		case dev.PCIAddress != "" && dev.MdevUUID != "":
+			return fmt.Errorf("spec.hostDevices[%d] sets both pciAddress and mdevUUID", i)
+		case dev.PCIAddress != "":
+			address, err := doctor.NormalizePCIAddress(dev.PCIAddress)
+			if err != nil {
+				return fmt.Errorf("spec.hostDevices[%d].pciAddress: %w", i, err)
+			}
+			key = address
+		case dev.MdevUUID != "":
+			id, err := uuid.Parse(dev.MdevUUID)
+			if err != nil {
+				return fmt.Errorf("spec.hostDevices[%d].mdevUUID %q is not a valid UUID", i, dev.MdevUUID)
+			}
+			key = id.String()
+		default:
+			return fmt.Errorf("spec.hostDevices[%d] requires pciAddress or mdevUUID", i)
+		}
+		if hostDevicesSeen[key] {
+			return fmt.Errorf("spec.hostDevices[%d] %s is duplicated", i, key)
+		}
+		hostDevicesSeen[key] = true
+	}
+
 	// Validate boot disk
 	if vm.Spec.BootDisk.SizeGB <= 0 {
 		return fmt.Errorf("spec.bootDisk.sizeGB must be greater than 0")
@@ -141,6 +619,17 @@ func validateSpec(vm *v1alpha1.VirtualMachine) error {
 	if vm.Spec.BootDisk.Image != "" && vm.Spec.BootDisk.Empty {
 		return fmt.Errorf("spec.bootDisk cannot specify both 'image' and 'empty: true'")
 	}
+	if format := vm.Spec.BootDisk.Format; format != "" && format != "qcow2" && format != "raw" {
+		return fmt.Errorf("spec.bootDisk.format must be qcow2 or raw, got %q", format)
+	}
+
+	// Validate disk tuning
+	if vm.Spec.IOThreads < 0 {
+		return fmt.Errorf("spec.ioThreads must not be negative")
+	}
+	if err := validateDiskTuning("spec.bootDisk", &vm.Spec.BootDisk.DiskTuningSpec, vm.Spec.IOThreads); err != nil {
+		return err
+	}
 
 	// Validate data disks
 	devicesSeen := make(map[string]bool)
@@ -155,6 +644,9 @@ func validateSpec(vm *v1alpha1.VirtualMachine) error {
 			return fmt.Errorf("spec.dataDisks[%d].device %q is duplicated", i, disk.Device)
 		}
 		devicesSeen[disk.Device] = true
+		if err := validateDiskTuning(fmt.Sprintf("spec.dataDisks[%d]", i), &disk.DiskTuningSpec, vm.Spec.IOThreads); err != nil {
+			return err
+		}
 	}
 
 	// Validate network interfaces
@@ -163,21 +655,290 @@ func validateSpec(vm *v1alpha1.VirtualMachine) error {
 	}
 
 	ipsSeen := make(map[string]bool)
+	macsSeen := make(map[string]bool)
+	vfsSeen := make(map[string]bool)
 	for i, iface := range vm.Spec.NetworkInterfaces {
-		if iface.IP == "" {
-			return fmt.Errorf("spec.networkInterfaces[%d].ip is required", i)
+		if iface.DHCP {
+			if iface.IP != "" || iface.Gateway != "" {
+				return fmt.Errorf("spec.networkInterfaces[%d] cannot specify ip or gateway with dhcp", i)
+			}
+			if iface.DefaultRoute {
+				return fmt.Errorf("spec.networkInterfaces[%d].defaultRoute cannot be used with dhcp (the DHCP server provides routes)", i)
+			}
+		} else if iface.IP != "" {
+			if ip, _, err := net.ParseCIDR(iface.IP); err == nil && ip.To4() == nil {
+				return fmt.Errorf("spec.networkInterfaces[%d].ip %q is an IPv6 address; use ipv6", i, iface.IP)
+			}
+			if iface.Gateway == "" {
+				return fmt.Errorf("spec.networkInterfaces[%d].gateway is required", i)
+			}
+			if ipsSeen[iface.IP] {
+				return fmt.Errorf("spec.networkInterfaces[%d].ip %q is duplicated", i, iface.IP)
+			}
+			ipsSeen[iface.IP] = true
+		} else if iface.IPv6 == "" {
+			return fmt.Errorf("spec.networkInterfaces[%d].ip is required (or set ipv6 or dhcp: true)", i)
+		} else if iface.Gateway != "" {
+			return fmt.Errorf("spec.networkInterfaces[%d].gateway requires ip", i)
+		}
+		if iface.IPv6 != "" {
+			ip, _, err := net.ParseCIDR(iface.IPv6)
+			if err != nil || ip.To4() != nil {
+				return fmt.Errorf("spec.networkInterfaces[%d].ipv6 %q must be an IPv6 address in CIDR notation", i, iface.IPv6)
+			}
+			if ipsSeen[ip.String()] {
+				return fmt.Errorf("spec.networkInterfaces[%d].ipv6 %q is duplicated", i, iface.IPv6)
+			}
+			ipsSeen[ip.String()] = true
+		}
+		if iface.IPv6Gateway != "" {
+			if iface.IPv6 == "" {
+				return fmt.Errorf("spec.networkInterfaces[%d].ipv6Gateway requires ipv6", i)
+			}
+			if gw := net.ParseIP(iface.IPv6Gateway); gw == nil || gw.To4() != nil {
+				return fmt.Errorf("spec.networkInterfaces[%d].ipv6Gateway %q is not an IPv6 address", i, iface.IPv6Gateway)
+			}
+		} else if iface.DefaultRoute && iface.IP == "" {
+			return fmt.Errorf("spec.networkInterfaces[%d].defaultRoute requires ipv6Gateway for IPv6-only interfaces", i)
+		}
+		if err := validateInterfaceSource(fmt.Sprintf("spec.networkInterfaces[%d]", i), &iface); err != nil {
+			return err
+		}
+		if err := validateBandwidth(fmt.Sprintf("spec.networkInterfaces[%d]", i), iface.Bandwidth); err != nil {
+			return err
+		}
+		if iface.SRIOV != nil {
+			vf := fmt.Sprintf("%s/%d", iface.SRIOV.PF, iface.SRIOV.VF)
+			if vfsSeen[vf] {
+				return fmt.Errorf("spec.networkInterfaces[%d].sriov: VF %d of %s is duplicated", i, iface.SRIOV.VF, iface.SRIOV.PF)
+			}
+			vfsSeen[vf] = true
+		}
+		for j, domain := range iface.SearchDomains {
+			if domain == "" || strings.ContainsAny(domain, " \t") {
+				return fmt.Errorf("spec.networkInterfaces[%d].searchDomains[%d] %q is not a domain name", i, j, domain)
+			}
+		}
+		for j, route := range iface.Routes {
+			if err := validateRoute(fmt.Sprintf("spec.networkInterfaces[%d].routes[%d]", i, j), &iface, route); err != nil {
+				return err
+			}
+		}
+		if iface.Queues < 0 || iface.Queues > 256 {
+			return fmt.Errorf("spec.networkInterfaces[%d].queues %d is invalid (must be 1-256)", i, iface.Queues)
+		}
+		if iface.Queues != 0 && iface.SRIOV != nil {
+			return fmt.Errorf("spec.networkInterfaces[%d].queues is not supported on sriov interfaces", i)
+		}
+		if iface.MTU != 0 && (iface.MTU < 68 || iface.MTU > 65535) {
+			return fmt.Errorf("spec.networkInterfaces[%d].mtu %d is invalid (must be 68-65535)", i, iface.MTU)
+		}
+		if iface.MTU != 0 && iface.MTU < 1280 && iface.IPv6 != "" {
+			return fmt.Errorf("spec.networkInterfaces[%d].mtu %d is below the IPv6 minimum of 1280", i, iface.MTU)
+		}
+		if iface.SRIOV != nil && iface.Bandwidth != nil {
+			return fmt.Errorf("spec.networkInterfaces[%d].bandwidth is not supported on sriov interfaces", i)
+		}
+		if iface.MACAddress != "" {
+			hw, err := net.ParseMAC(iface.MACAddress)
+			if err != nil || len(hw) != 6 {
+				return fmt.Errorf("spec.networkInterfaces[%d].macAddress %q is not a valid MAC address", i, iface.MACAddress)
+			}
+			if hw[0]&0x01 != 0 {
+				return fmt.Errorf("spec.networkInterfaces[%d].macAddress %q is a multicast address", i, iface.MACAddress)
+			}
+			if macsSeen[hw.String()] {
+				return fmt.Errorf("spec.networkInterfaces[%d].macAddress %q is duplicated", i, iface.MACAddress)
+			}
+			macsSeen[hw.String()] = true
+		}
+	}
+
+	// Validate network defaults
+	if nd := vm.Spec.NetworkDefaults; nd != nil {
+		for i, server := range nd.DNSServers {
+			if net.ParseIP(server) == nil {
+				return fmt.Errorf("spec.networkDefaults.dnsServers[%d] %q is not an IP address", i, server)
+			}
+		}
+		for i, domain := range nd.SearchDomains {
+			if domain == "" || strings.ContainsAny(domain, " \t") {
+				return fmt.Errorf("spec.networkDefaults.searchDomains[%d] %q is not a domain name", i, domain)
+			}
+		}
+		switch nd.GatewayMetricPolicy {
+		case "", v1alpha1.GatewayMetricPolicySingle, v1alpha1.GatewayMetricPolicyOrdered:
+		default:
+			return fmt.Errorf("spec.networkDefaults.gatewayMetricPolicy %q is invalid (must be %s or %s)",
+				nd.GatewayMetricPolicy, v1alpha1.GatewayMetricPolicySingle, v1alpha1.GatewayMetricPolicyOrdered)
+		}
+	}
+
+	return nil
+}
+
+// validateDiskTuning validates the bus and driver options of the disk at
+// field, given the number of I/O threads of the VM.
+func validateDiskTuning(field string, tuning *v1alpha1.DiskTuningSpec, ioThreads int) error {
+	switch tuning.Bus {
+	case "", "virtio", "scsi", "sata":
+	default:
+		return fmt.Errorf("%s.bus must be virtio, scsi or sata, got %q", field, tuning.Bus)
+	}
+	switch tuning.Cache {
+	case "", "none", "writeback", "unsafe":
+	default:
+		return fmt.Errorf("%s.cache must be none, writeback or unsafe, got %q", field, tuning.Cache)
+	}
+	switch tuning.IO {
+	case "", "threads":
+	case "native":
+		// Linux AIO needs O_DIRECT, which only cache mode none uses
+		if tuning.GetCache() != "none" {
+			return fmt.Errorf("%s.io native requires cache none, got %q", field, tuning.Cache)
+		}
+	default:
+		return fmt.Errorf("%s.io must be native or threads, got %q", field, tuning.IO)
+	}
+	if tuning.IOThread != 0 {
+		if tuning.GetBus() != "virtio" {
+			return fmt.Errorf("%s.ioThread requires bus virtio", field)
+		}
+		if tuning.IOThread < 1 || tuning.IOThread > ioThreads {
+			return fmt.Errorf("%s.ioThread must be between 1 and spec.ioThreads (%d), got %d", field, ioThreads, tuning.IOThread)
+		}
+	}
+	if t := tuning.IOTune; t != nil {
+		if t.TotalIOPS < 0 || t.ReadIOPS < 0 || t.WriteIOPS < 0 ||
+			t.TotalBytesPerSec < 0 || t.ReadBytesPerSec < 0 || t.WriteBytesPerSec < 0 {
+			return fmt.Errorf("%s.ioTune limits must not be negative", field)
+		}
+		// QEMU rejects a total limit together with a read or write one
+		if t.TotalIOPS > 0 && (t.ReadIOPS > 0 || t.WriteIOPS > 0) {
+			return fmt.Errorf("%s.ioTune.totalIOPS cannot be combined with readIOPS or writeIOPS", field)
+		}
+		if t.TotalBytesPerSec > 0 && (t.ReadBytesPerSec > 0 || t.WriteBytesPerSec > 0) {
+			return fmt.Errorf("%s.ioTune.totalBytesPerSec cannot be combined with readBytesPerSec or writeBytesPerSec", field)
+		}
+	}
+	return nil
+}
+
+// validateInterfaceSource validates what the network interface at field is
+// attached to: exactly one of a bridge, a libvirt network, a macvtap device
+// or an SR-IOV VF.
+func validateInterfaceSource(field string, iface *v1alpha1.NetworkInterfaceSpec) error {
+	var sources []string
+	if iface.Bridge != "" {
+		sources = append(sources, "bridge")
+	}
+	if iface.Network != "" {
+		sources = append(sources, "network")
+	}
+	if iface.Macvtap != nil {
+		sources = append(sources, "macvtap")
+	}
+	if iface.SRIOV != nil {
+		sources = append(sources, "sriov")
+	}
+	switch {
+	case len(sources) == 0:
+		return fmt.Errorf("%s: one of bridge, network, macvtap or sriov is required", field)
+	case len(sources) > 1:
+		return fmt.Errorf("%s: %s and %s are mutually exclusive", field, sources[0], sources[1])
+	}
+
+	switch iface.BridgeType {
+	case "", v1alpha1.BridgeTypeLinux, v1alpha1.BridgeTypeOpenVSwitch:
+	default:
+		return fmt.Errorf("%s.bridgeType %q is invalid (must be %s or %s)", field, iface.BridgeType, v1alpha1.BridgeTypeLinux, v1alpha1.BridgeTypeOpenVSwitch)
+	}
+	if iface.BridgeType != "" && iface.Bridge == "" {
+		return fmt.Errorf("%s.bridgeType requires bridge", field)
+	}
+	if iface.VLAN < 0 || iface.VLAN > 4094 {
+		return fmt.Errorf("%s.vlan %d is invalid (must be 1-4094)", field, iface.VLAN)
+	}
+	if iface.VLAN != 0 && iface.Macvtap != nil {
+		return fmt.Errorf("%s.vlan is not supported on macvtap interfaces", field)
+	}
+
+	if m := iface.Macvtap; m != nil {
+		if m.Device == "" {
+			return fmt.Errorf("%s.macvtap.device is required", field)
 		}
-		if iface.Gateway == "" {
-			return fmt.Errorf("spec.networkInterfaces[%d].gateway is required", i)
+		switch m.Mode {
+		case "", v1alpha1.MacvtapModeBridge, v1alpha1.MacvtapModePrivate:
+		default:
+			return fmt.Errorf("%s.macvtap.mode %q is invalid (must be %s or %s)", field, m.Mode, v1alpha1.MacvtapModeBridge, v1alpha1.MacvtapModePrivate)
 		}
-		if iface.Bridge == "" {
-			return fmt.Errorf("spec.networkInterfaces[%d].bridge is required", i)
+	}
+	if s := iface.SRIOV; s != nil {
+		if s.PF == "" {
+			return fmt.Errorf("%s.sriov.pf is required", field)
+		}
+		if s.VF < 0 {
+			return fmt.Errorf("%s.sriov.vf must not be negative", field)
 		}
-		if ipsSeen[iface.IP] {
-			return fmt.Errorf("spec.networkInterfaces[%d].ip %q is duplicated", i, iface.IP)
+		if s.PCIAddress != "" {
+			if _, err := doctor.NormalizePCIAddress(s.PCIAddress); err != nil {
+				return fmt.Errorf("%s.sriov.pciAddress: %w", field, err)
+			}
 		}
-		ipsSeen[iface.IP] = true
 	}
+	return nil
+}
 
+// validateRoute validates the static route at field of an interface: the
+// interface must have an address of the route's IP family.
+func validateRoute(field string, iface *v1alpha1.NetworkInterfaceSpec, route v1alpha1.RouteSpec) error {
+	_, to, err := net.ParseCIDR(route.To)
+	if err != nil {
+		return fmt.Errorf("%s.to %q must be a network in CIDR notation", field, route.To)
+	}
+	via := net.ParseIP(route.Via)
+	if via == nil {
+		return fmt.Errorf("%s.via %q is not an IP address", field, route.Via)
+	}
+	ipv4 := to.IP.To4() != nil
+	if (via.To4() != nil) != ipv4 {
+		return fmt.Errorf("%s.via %q is not of the same IP family as to %q", field, route.Via, route.To)
+	}
+	if route.Metric < 0 {
+		return fmt.Errorf("%s.metric must not be negative", field)
+	}
+	if ipv4 && iface.IP == "" && !iface.DHCP {
+		return fmt.Errorf("%s is an IPv4 route on an interface without IPv4", field)
+	}
+	if !ipv4 && iface.IPv6 == "" {
+		return fmt.Errorf("%s is an IPv6 route on an interface without ipv6", field)
+	}
+	return nil
+}
+
+// validateBandwidth validates the traffic shaping of the interface at field.
+func validateBandwidth(field string, bandwidth *v1alpha1.BandwidthSpec) error {
+	if bandwidth == nil {
+		return nil
+	}
+	directions := []struct {
+		name  string
+		limit *v1alpha1.BandwidthLimitSpec
+	}{{"inbound", bandwidth.Inbound}, {"outbound", bandwidth.Outbound}}
+	for _, d := range directions {
+		direction, limit := d.name, d.limit
+		if limit == nil {
+			continue
+		}
+		if limit.Average <= 0 {
+			return fmt.Errorf("%s.bandwidth.%s.average must be greater than 0", field, direction)
+		}
+		if limit.Peak != 0 && limit.Peak < limit.Average {
+			return fmt.Errorf("%s.bandwidth.%s.peak (%d) must not be less than average (%d)", field, direction, limit.Peak, limit.Average)
+		}
+		if limit.Burst < 0 {
+			return fmt.Errorf("%s.bandwidth.%s.burst must not be negative", field, direction)
+		}
+	}
 	return nil
 }
@@ -1,11 +1,17 @@
 package loader
 
 import (
+	"bytes"
+	"context"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/logging"
 )
 
 func TestLoadFromYAML_Valid(t *testing.T) {
@@ -26,7 +32,7 @@ spec:
       bridge: br0
 `
 
-	vm, err := LoadFromYAML([]byte(yaml))
+	vm, err := LoadFromYAML(context.Background(), []byte(yaml))
 	if err != nil {
 		t.Fatalf("LoadFromYAML() error = %v", err)
 	}
@@ -63,6 +69,44 @@ spec:
 	}
 }
 
+func TestLoadFromYAML_HostDefaults(t *testing.T) {
+	v1alpha1.SetHostDefaults(v1alpha1.HostDefaults{StoragePool: "vms", ImagePool: "images", Bridge: "br0", DNSServers: []string{"10.0.0.53"}})
+	t.Cleanup(func() { v1alpha1.SetHostDefaults(v1alpha1.HostDefaults{}) })
+
+	yaml := `
+apiVersion: foundry.cofront.xyz/v1alpha1
+kind: VirtualMachine
+metadata:
+  name: test-vm
+spec:
+  vcpus: 2
+  memoryGiB: 4
+  bootDisk:
+    sizeGB: 50
+    image: fedora-43.qcow2
+  networkInterfaces:
+    - ip: 10.0.0.1/24
+      gateway: 10.0.0.254
+    - ip: 10.1.0.1/24
+      gateway: 10.1.0.254
+      bridge: br1
+`
+
+	vm, err := LoadFromYAML(context.Background(), []byte(yaml))
+	if err != nil {
+		t.Fatalf("LoadFromYAML() error = %v", err)
+	}
+	if vm.Spec.StoragePool != "vms" || vm.Spec.BootDisk.ImagePool != "images" {
+		t.Errorf("pools = %s, %s, want the host defaults", vm.Spec.StoragePool, vm.Spec.BootDisk.ImagePool)
+	}
+	if vm.Spec.NetworkInterfaces[0].Bridge != "br0" || vm.Spec.NetworkInterfaces[1].Bridge != "br1" {
+		t.Errorf("bridges = %s, %s, want br0, br1", vm.Spec.NetworkInterfaces[0].Bridge, vm.Spec.NetworkInterfaces[1].Bridge)
+	}
+	if vm.Spec.NetworkDefaults == nil || len(vm.Spec.NetworkDefaults.DNSServers) != 1 || vm.Spec.NetworkDefaults.DNSServers[0] != "10.0.0.53" {
+		t.Errorf("networkDefaults = %+v, want the host DNS servers", vm.Spec.NetworkDefaults)
+	}
+}
+
 func TestLoadFromYAML_MissingAPIVersion(t *testing.T) {
 	yaml := `
 kind: VirtualMachine
@@ -80,7 +124,7 @@ spec:
       bridge: br0
 `
 
-	_, err := LoadFromYAML([]byte(yaml))
+	_, err := LoadFromYAML(context.Background(), []byte(yaml))
 	if err == nil {
 		t.Error("Expected error for missing apiVersion")
 	}
@@ -103,7 +147,7 @@ spec:
       bridge: br0
 `
 
-	_, err := LoadFromYAML([]byte(yaml))
+	_, err := LoadFromYAML(context.Background(), []byte(yaml))
 	if err == nil {
 		t.Error("Expected error for missing kind")
 	}
@@ -127,7 +171,7 @@ spec:
       bridge: br0
 `
 
-	_, err := LoadFromYAML([]byte(yaml))
+	_, err := LoadFromYAML(context.Background(), []byte(yaml))
 	if err == nil {
 		t.Error("Expected error for wrong apiVersion")
 	}
@@ -151,7 +195,7 @@ spec:
       bridge: br0
 `
 
-	_, err := LoadFromYAML([]byte(yaml))
+	_, err := LoadFromYAML(context.Background(), []byte(yaml))
 	if err == nil {
 		t.Error("Expected error for wrong kind")
 	}
@@ -160,7 +204,7 @@ spec:
 func TestLoadFromYAML_InvalidYAML(t *testing.T) {
 	yaml := `{invalid yaml content`
 
-	_, err := LoadFromYAML([]byte(yaml))
+	_, err := LoadFromYAML(context.Background(), []byte(yaml))
 	if err == nil {
 		t.Error("Expected error for invalid YAML")
 	}
@@ -191,7 +235,7 @@ spec:
 		t.Fatalf("Failed to write test file: %v", err)
 	}
 
-	vm, err := LoadFromFile(yamlPath)
+	vm, err := LoadFromFile(context.Background(), yamlPath)
 	if err != nil {
 		t.Fatalf("LoadFromFile() error = %v", err)
 	}
@@ -202,12 +246,187 @@ spec:
 }
 
 func TestLoadFromFile_NonExistent(t *testing.T) {
-	_, err := LoadFromFile("/non/existent/file.yaml")
+	_, err := LoadFromFile(context.Background(), "/non/existent/file.yaml")
 	if err == nil {
 		t.Error("Expected error for non-existent file")
 	}
 }
 
+// testVMYAML returns a minimal valid VirtualMachine document named name.
+func testVMYAML(name, ip string) string {
+	return `apiVersion: foundry.cofront.xyz/v1alpha1
+kind: VirtualMachine
+metadata:
+  name: ` + name + `
+spec:
+  vcpus: 2
+  memoryGiB: 4
+  bootDisk:
+    sizeGB: 50
+    image: fedora-43.qcow2
+  networkInterfaces:
+    - ip: ` + ip + `
+      gateway: 10.0.0.254
+      bridge: br0
+`
+}
+
+func TestLoadAll_MultiDocument(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vms.yaml")
+	content := "---\n" + testVMYAML("web-1", "10.0.0.1/24") +
+		"---\n" + testVMYAML("web-2", "10.0.0.2/24") +
+		"---\n# only a comment\n" +
+		"---\n" + strings.Replace(testVMYAML("web-3", "10.0.0.3/24"), "vcpus: 2", "vcpus: 0", 1) +
+		"---\n" + testVMYAML("web-1", "10.0.0.4/24")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	docs, err := LoadAll(context.Background(), path)
+	if err != nil {
+		t.Fatalf("LoadAll() error = %v", err)
+	}
+	if len(docs) != 4 {
+		t.Fatalf("LoadAll() returned %d documents, want 4 (empty documents skipped)", len(docs))
+	}
+
+	for i, name := range []string{"web-1", "web-2"} {
+		if docs[i].Err != nil || docs[i].VM.Name != name {
+			t.Errorf("document %d = %+v, want %s", i+1, docs[i], name)
+		}
+	}
+	if want := path + "#2"; docs[1].Source != want {
+		t.Errorf("Source = %q, want %q", docs[1].Source, want)
+	}
+	if docs[2].Err == nil || !strings.Contains(docs[2].Err.Error(), "validation failed") {
+		t.Errorf("document 3 error = %v, want validation error", docs[2].Err)
+	}
+	if docs[3].Err == nil || !strings.Contains(docs[3].Err.Error(), "duplicate VM name web-1") {
+		t.Errorf("document 4 error = %v, want duplicate name error", docs[3].Err)
+	}
+}
+
+func TestLoadAll_Directory(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"b.yaml":       testVMYAML("vm-b", "10.0.0.2/24"),
+		"a.yml":        testVMYAML("vm-a", "10.0.0.1/24"),
+		"c.yaml":       "spec: [",
+		"README.md":    "not a config",
+		"sub/d.yaml":   testVMYAML("vm-d", "10.0.0.4/24"),
+		"userdata.txt": "packages: [nginx]",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	docs, err := LoadAll(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("LoadAll() error = %v", err)
+	}
+	if len(docs) != 3 {
+		t.Fatalf("LoadAll() returned %d documents, want 3: %+v", len(docs), docs)
+	}
+	if docs[0].VM == nil || docs[0].VM.Name != "vm-a" || docs[1].VM == nil || docs[1].VM.Name != "vm-b" {
+		t.Errorf("documents not loaded in file name order: %+v", docs)
+	}
+	if docs[0].Source != filepath.Join(dir, "a.yml") {
+		t.Errorf("Source = %q, want the file path", docs[0].Source)
+	}
+	if docs[2].Err == nil || !strings.Contains(docs[2].Err.Error(), "failed to unmarshal YAML") {
+		t.Errorf("c.yaml error = %v, want YAML error", docs[2].Err)
+	}
+}
+
+const (
+	testKeyData = "AAAAC3NzaC1lZDI1NTE5AAAAIHV0ZXN0a2V5ZGF0YWZvcmZvdW5kcnl0ZXN0cw=="
+	testKeyRSA  = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQC7 ops@bastion"
+)
+
+// captureLog returns a context whose logger writes to the returned buffer.
+func captureLog() (context.Context, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return logging.NewContext(context.Background(), slog.New(slog.NewTextHandler(&buf, nil))), &buf
+}
+
+// testVMYAMLWithKeys returns testVMYAML with cloud-init authorized keys.
+func testVMYAMLWithKeys(name, ip string, keys ...string) string {
+	content := testVMYAML(name, ip) + "  cloudInit:\n    sshAuthorizedKeys:\n"
+	for _, key := range keys {
+		content += "      - \"" + key + "\"\n"
+	}
+	return content
+}
+
+func TestLoadFromYAML_SSHKeys(t *testing.T) {
+	ctx, logs := captureLog()
+
+	vm, err := LoadFromYAML(ctx, []byte(testVMYAMLWithKeys("test-vm", "10.0.0.1/24",
+		"ssh-ed25519  "+testKeyData+"   alice@laptop ",
+		testKeyRSA,
+		"ssh-ed25519 "+testKeyData+" alice@desktop",
+		testKeyRSA,
+	)))
+	if err != nil {
+		t.Fatalf("LoadFromYAML() error = %v", err)
+	}
+	want := []string{"ssh-ed25519 " + testKeyData + " alice@laptop", testKeyRSA}
+	got := vm.Spec.CloudInit.SSHAuthorizedKeys
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("SSHAuthorizedKeys = %q, want %q", got, want)
+	}
+	for _, warning := range []string{`key=alice@desktop first=alice@laptop`, `msg="SSH key is listed more than once" vm=test-vm key=ops@bastion`} {
+		if !strings.Contains(logs.String(), warning) {
+			t.Errorf("log missing %q:\n%s", warning, logs.String())
+		}
+	}
+
+	_, err = LoadFromYAML(context.Background(), []byte(testVMYAMLWithKeys("test-vm", "10.0.0.1/24", testKeyRSA, "ssh-ed25519 not-base64!")))
+	if err == nil || !strings.Contains(err.Error(), "sshAuthorizedKeys[1]") {
+		t.Errorf("LoadFromYAML() error = %v, want sshAuthorizedKeys[1] error", err)
+	}
+}
+
+func TestLoadAll_SharedSSHKeys(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.yaml": testVMYAMLWithKeys("vm-a", "10.0.0.1/24", "ssh-ed25519 "+testKeyData+" alice@laptop", testKeyRSA),
+		"b.yaml": testVMYAMLWithKeys("vm-b", "10.0.0.2/24", "ssh-ed25519 "+testKeyData+" bob@desktop", testKeyRSA),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, logs := captureLog()
+	if _, err := LoadAll(ctx, dir); err != nil {
+		t.Fatalf("LoadAll() error = %v", err)
+	}
+	if want := "b.yaml key=bob@desktop other=alice@laptop otherSource=" + filepath.Join(dir, "a.yaml"); !strings.Contains(logs.String(), want) {
+		t.Errorf("log missing %q:\n%s", want, logs.String())
+	}
+	// The same key under the same comment is a shared key, not a mistake
+	if strings.Contains(logs.String(), "ops@bastion") {
+		t.Errorf("unexpected warning for a shared key:\n%s", logs.String())
+	}
+}
+
+func TestLoadAll_Errors(t *testing.T) {
+	if _, err := LoadAll(context.Background(), "/non/existent/vms"); err == nil {
+		t.Error("expected error for non-existent path")
+	}
+	if _, err := LoadAll(context.Background(), t.TempDir()); err == nil || !strings.Contains(err.Error(), "no YAML files") {
+		t.Errorf("LoadAll() error = %v, want no YAML files error", err)
+	}
+}
+
 func TestSaveToFile(t *testing.T) {
 	tmpDir := t.TempDir()
 	yamlPath := filepath.Join(tmpDir, "vm.yaml")
@@ -236,7 +455,7 @@ func TestSaveToFile(t *testing.T) {
 	}
 
 	// Load it back and verify
-	loaded, err := LoadFromFile(yamlPath)
+	loaded, err := LoadFromFile(context.Background(), yamlPath)
 	if err != nil {
 		t.Fatalf("Failed to load saved file: %v", err)
 	}
@@ -275,7 +494,7 @@ func TestSaveToFile_MissingAPIVersion(t *testing.T) {
 	}
 
 	// Load it back and verify TypeMeta was set
-	loaded, err := LoadFromFile(yamlPath)
+	loaded, err := LoadFromFile(context.Background(), yamlPath)
 	if err != nil {
 		t.Fatalf("Failed to load saved file: %v", err)
 	}
@@ -378,6 +597,235 @@ func TestValidateSpec_MissingName(t *testing.T) {
 	}
 }
 
+func TestLoadFromYAML_GenerateName(t *testing.T) {
+	yaml := `
+apiVersion: foundry.cofront.xyz/v1alpha1
+kind: VirtualMachine
+metadata:
+  generateName: CI-Runner-
+spec:
+  vcpus: 2
+  memoryGiB: 4
+  bootDisk:
+    sizeGB: 50
+    image: fedora-43.qcow2
+  networkInterfaces:
+    - ip: 10.0.0.1/24
+      gateway: 10.0.0.254
+      bridge: br0
+`
+
+	vm, err := LoadFromYAML(context.Background(), []byte(yaml))
+	if err != nil {
+		t.Fatalf("LoadFromYAML() error = %v", err)
+	}
+	if vm.Name != "" {
+		t.Errorf("Name = %q, want it left for generation at create time", vm.Name)
+	}
+	if vm.GenerateName != "ci-runner-" {
+		t.Errorf("GenerateName = %q, want lowercased %q", vm.GenerateName, "ci-runner-")
+	}
+}
+
+func TestLoadFromYAML_TTL(t *testing.T) {
+	base := `
+apiVersion: foundry.cofront.xyz/v1alpha1
+kind: VirtualMachine
+metadata:
+  name: scratch
+spec:
+  vcpus: 2
+  memoryGiB: 4
+  bootDisk:
+    sizeGB: 50
+    image: fedora-43.qcow2
+  networkInterfaces:
+    - ip: 10.0.0.1/24
+      gateway: 10.0.0.254
+      bridge: br0
+`
+
+	vm, err := LoadFromYAML(context.Background(), []byte(base+"  ttl: 2h30m\n  ephemeral: true\n"))
+	if err != nil {
+		t.Fatalf("LoadFromYAML() error = %v", err)
+	}
+	if vm.Spec.TTL == nil || vm.Spec.TTL.Duration != 150*time.Minute {
+		t.Errorf("TTL = %v, want 2h30m", vm.Spec.TTL)
+	}
+	if !vm.Spec.Ephemeral {
+		t.Error("Ephemeral = false, want true")
+	}
+
+	for _, ttl := range []string{"0s", "-1h", "two hours"} {
+		if _, err := LoadFromYAML(context.Background(), []byte(base+"  ttl: "+ttl+"\n")); err == nil {
+			t.Errorf("LoadFromYAML() with ttl %q succeeded, want error", ttl)
+		}
+	}
+}
+
+func TestLoadUntrustedYAML_RejectsUserDataFile(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("root:$6$hash\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config := `
+apiVersion: foundry.cofront.xyz/v1alpha1
+kind: VirtualMachine
+metadata:
+  name: web
+spec:
+  vcpus: 2
+  memoryGiB: 4
+  bootDisk:
+    sizeGB: 50
+    image: fedora-43.qcow2
+  networkInterfaces:
+    - ip: 10.0.0.1/24
+      gateway: 10.0.0.254
+      bridge: br0
+  cloudInit:
+    userDataFile: ` + secret + `
+`
+	vm, err := LoadUntrustedYAML(context.Background(), []byte(config))
+	if err == nil || !strings.Contains(err.Error(), "userDataFile") {
+		t.Fatalf("LoadUntrustedYAML() = %+v, %v, want userDataFile rejected", vm, err)
+	}
+	if strings.Contains(err.Error(), "root:") {
+		t.Errorf("error %q leaks the file content", err)
+	}
+
+	// Without the file reference the same spec loads
+	vm, err = LoadUntrustedYAML(context.Background(), []byte(strings.Replace(config, "userDataFile: "+secret, `userDataExtra: "packages: [nginx]"`, 1)))
+	if err != nil || vm.Spec.CloudInit.UserDataExtra != "packages: [nginx]" {
+		t.Errorf("LoadUntrustedYAML() = %+v, %v, want the inline user data", vm, err)
+	}
+}
+
+func TestLoadUntrustedYAML_RejectsImageFile(t *testing.T) {
+	config := `
+apiVersion: foundry.cofront.xyz/v1alpha1
+kind: VirtualMachine
+metadata:
+  name: web
+spec:
+  vcpus: 2
+  memoryGiB: 4
+  bootDisk:
+    sizeGB: 50
+    image: IMAGE
+  networkInterfaces:
+    - ip: 10.0.0.1/24
+      gateway: 10.0.0.254
+      bridge: br0
+`
+	tests := []struct {
+		image   string
+		wantErr bool
+	}{
+		{image: "/etc/shadow", wantErr: true},
+		{image: "../../var/lib/secret.qcow2", wantErr: true},
+		{image: "./disk.qcow2", wantErr: true},
+		{image: ".hidden.qcow2", wantErr: true},
+		{image: "fedora-43.qcow2"},
+		{image: "images:fedora-43.qcow2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			vm, err := LoadUntrustedYAML(context.Background(), []byte(strings.Replace(config, "IMAGE", tt.image, 1)))
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "spec.bootDisk.image") {
+					t.Errorf("LoadUntrustedYAML() = %+v, %v, want image rejected", vm, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("LoadUntrustedYAML() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadFromFile_UserDataFile(t *testing.T) {
+	dir := t.TempDir()
+	extra := "packages:\n  - nginx\n"
+	if err := os.WriteFile(filepath.Join(dir, "extra.yaml"), []byte(extra), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := `
+apiVersion: foundry.cofront.xyz/v1alpha1
+kind: VirtualMachine
+metadata:
+  name: web
+spec:
+  vcpus: 2
+  memoryGiB: 4
+  bootDisk:
+    sizeGB: 50
+    image: fedora-43.qcow2
+  networkInterfaces:
+    - ip: 10.0.0.1/24
+      gateway: 10.0.0.254
+      bridge: br0
+  cloudInit:
+    userDataFile: extra.yaml
+`
+	path := filepath.Join(dir, "vm.yaml")
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	vm, err := LoadFromFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("LoadFromFile() error = %v", err)
+	}
+	if vm.Spec.CloudInit.UserDataExtra != extra {
+		t.Errorf("UserDataExtra = %q, want file content %q", vm.Spec.CloudInit.UserDataExtra, extra)
+	}
+	if vm.Spec.CloudInit.UserDataFile != "" {
+		t.Errorf("UserDataFile = %q, want it cleared once inlined", vm.Spec.CloudInit.UserDataFile)
+	}
+}
+
+func TestLoadFromYAML_UserDataExtraInvalid(t *testing.T) {
+	base := `
+apiVersion: foundry.cofront.xyz/v1alpha1
+kind: VirtualMachine
+metadata:
+  name: web
+spec:
+  vcpus: 2
+  memoryGiB: 4
+  bootDisk:
+    sizeGB: 50
+    image: fedora-43.qcow2
+  networkInterfaces:
+    - ip: 10.0.0.1/24
+      gateway: 10.0.0.254
+      bridge: br0
+  cloudInit:
+`
+	tests := []struct {
+		name      string
+		cloudInit string
+		want      string
+	}{
+		{"not a mapping", "    userDataExtra: \"- nginx\"\n", "must be a YAML mapping"},
+		{"with raw user-data", "    rawUserData: \"#cloud-config\"\n    userDataExtra: \"packages: [nginx]\"\n", "both rawUserData and userDataExtra"},
+		{"with user-data file", "    userDataFile: extra.yaml\n    userDataExtra: \"packages: [nginx]\"\n", "both userDataExtra and userDataFile"},
+		{"missing file", "    userDataFile: /nonexistent/extra.yaml\n", "failed to read spec.cloudInit.userDataFile"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadFromYAML(context.Background(), []byte(base+tt.cloudInit))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadFromYAML() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
 func TestValidateSpec_InvalidVCPUs(t *testing.T) {
 	vm := &v1alpha1.VirtualMachine{
 		ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
@@ -399,32 +847,574 @@ func TestValidateSpec_InvalidVCPUs(t *testing.T) {
 	}
 }
 
-func TestValidateSpec_InvalidMemory(t *testing.T) {
-	vm := &v1alpha1.VirtualMachine{
-		ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
-		Spec: v1alpha1.VirtualMachineSpec{
-			VCPUs:     2,
-			MemoryGiB: 0,
-			BootDisk: v1alpha1.BootDiskSpec{
-				SizeGB: 50,
-				Image:  "fedora-43.qcow2",
-			},
-			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
-				{IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0"},
+func TestValidateSpec_Startup(t *testing.T) {
+	newVM := func() *v1alpha1.VirtualMachine {
+		return &v1alpha1.VirtualMachine{
+			ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+			Spec: v1alpha1.VirtualMachineSpec{
+				VCPUs:     2,
+				MemoryGiB: 4,
+				BootDisk: v1alpha1.BootDiskSpec{
+					SizeGB: 50,
+					Image:  "fedora-43.qcow2",
+				},
+				NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+					{IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0"},
+				},
+				StartupOrder: 10,
+				StartupDelay: &v1alpha1.Duration{Duration: 30 * time.Second},
 			},
-		},
+		}
 	}
 
-	if err := validateSpec(vm); err == nil {
-		t.Error("Expected error for invalid memory")
+	if err := validateSpec(newVM()); err != nil {
+		t.Errorf("validateSpec() error = %v", err)
+	}
+
+	vm := newVM()
+	vm.Spec.StartupOrder = -1
+	if err := validateSpec(vm); err == nil || !strings.Contains(err.Error(), "startupOrder") {
+		t.Errorf("validateSpec() error = %v, want startupOrder error", err)
+	}
+
+	vm = newVM()
+	vm.Spec.StartupDelay.Duration = -time.Second
+	if err := validateSpec(vm); err == nil || !strings.Contains(err.Error(), "startupDelay") {
+		t.Errorf("validateSpec() error = %v, want startupDelay error", err)
 	}
 }
 
-func TestValidateSpec_InvalidBootDiskSize(t *testing.T) {
-	vm := &v1alpha1.VirtualMachine{
-		ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
-		Spec: v1alpha1.VirtualMachineSpec{
-			VCPUs:     2,
+func TestValidateSpec_SMBIOS(t *testing.T) {
+	newVM := func() *v1alpha1.VirtualMachine {
+		return &v1alpha1.VirtualMachine{
+			ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+			Spec: v1alpha1.VirtualMachineSpec{
+				VCPUs:     2,
+				MemoryGiB: 4,
+				BootDisk: v1alpha1.BootDiskSpec{
+					SizeGB: 50,
+					Image:  "fedora-43.qcow2",
+				},
+				NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+					{IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0"},
+				},
+				SMBIOS: &v1alpha1.SMBIOSSpec{
+					Serial:     "ds=nocloud",
+					OEMStrings: []string{"io.systemd.credential:hostname=test"},
+				},
+			},
+		}
+	}
+
+	if err := validateSpec(newVM()); err != nil {
+		t.Errorf("validateSpec() error = %v", err)
+	}
+
+	vm := newVM()
+	vm.Spec.SMBIOS = &v1alpha1.SMBIOSSpec{}
+	if err := validateSpec(vm); err == nil || !strings.Contains(err.Error(), "spec.smbios") {
+		t.Errorf("validateSpec() error = %v, want spec.smbios error", err)
+	}
+
+	vm = newVM()
+	vm.Spec.SMBIOS.OEMStrings = append(vm.Spec.SMBIOS.OEMStrings, "")
+	if err := validateSpec(vm); err == nil || !strings.Contains(err.Error(), "oemStrings[1]") {
+		t.Errorf("validateSpec() error = %v, want oemStrings[1] error", err)
+	}
+}
+
+func TestValidateSpec_OSVariant(t *testing.T) {
+	tests := []struct {
+		variant string
+		wantErr bool
+	}{
+		{variant: "fedora43"},
+		{variant: "http://example.org/myos/1"},
+		{variant: "fedora99", wantErr: true},
+		{variant: "ftp://example.org/myos/1", wantErr: true},
+	}
+	for _, tt := range tests {
+		vm := &v1alpha1.VirtualMachine{
+			ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+			Spec: v1alpha1.VirtualMachineSpec{
+				VCPUs:     2,
+				MemoryGiB: 4,
+				OSVariant: tt.variant,
+				BootDisk: v1alpha1.BootDiskSpec{
+					SizeGB: 50,
+					Image:  "fedora-43.qcow2",
+				},
+				NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+					{IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0"},
+				},
+			},
+		}
+		err := validateSpec(vm)
+		if tt.wantErr && (err == nil || !strings.Contains(err.Error(), "spec.osVariant")) {
+			t.Errorf("validateSpec(%s) error = %v, want spec.osVariant error", tt.variant, err)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("validateSpec(%s) error = %v", tt.variant, err)
+		}
+	}
+}
+
+func TestValidateSpec_DiskTuning(t *testing.T) {
+	tests := []struct {
+		name      string
+		ioThreads int
+		boot      v1alpha1.DiskTuningSpec
+		data      v1alpha1.DiskTuningSpec
+		wantErr   string
+	}{
+		{name: "defaults"},
+		{name: "tuned", ioThreads: 2, boot: v1alpha1.DiskTuningSpec{IO: "native", IOThread: 1}, data: v1alpha1.DiskTuningSpec{Bus: "scsi", Cache: "writeback", IO: "threads"}},
+		{name: "sata boot disk", boot: v1alpha1.DiskTuningSpec{Bus: "sata"}},
+		{name: "unknown bus", data: v1alpha1.DiskTuningSpec{Bus: "ide"}, wantErr: "spec.dataDisks[0].bus"},
+		{name: "unknown cache", boot: v1alpha1.DiskTuningSpec{Cache: "directsync"}, wantErr: "spec.bootDisk.cache"},
+		{name: "unknown io", boot: v1alpha1.DiskTuningSpec{IO: "io_uring"}, wantErr: "spec.bootDisk.io"},
+		{name: "native io with writeback", data: v1alpha1.DiskTuningSpec{Cache: "writeback", IO: "native"}, wantErr: "requires cache none"},
+		{name: "iothread without iothreads", boot: v1alpha1.DiskTuningSpec{IOThread: 1}, wantErr: "spec.bootDisk.ioThread"},
+		{name: "iothread out of range", ioThreads: 1, data: v1alpha1.DiskTuningSpec{IOThread: 2}, wantErr: "spec.dataDisks[0].ioThread"},
+		{name: "iothread on scsi", ioThreads: 1, data: v1alpha1.DiskTuningSpec{Bus: "scsi", IOThread: 1}, wantErr: "requires bus virtio"},
+		{name: "negative iothreads", ioThreads: -1, wantErr: "spec.ioThreads"},
+		{name: "io limits", data: v1alpha1.DiskTuningSpec{IOTune: &v1alpha1.DiskIOTuneSpec{ReadIOPS: 100, WriteIOPS: 50, TotalBytesPerSec: 1 << 20}}},
+		{name: "negative io limit", boot: v1alpha1.DiskTuningSpec{IOTune: &v1alpha1.DiskIOTuneSpec{WriteIOPS: -1}}, wantErr: "spec.bootDisk.ioTune"},
+		{name: "total and read iops", data: v1alpha1.DiskTuningSpec{IOTune: &v1alpha1.DiskIOTuneSpec{TotalIOPS: 100, ReadIOPS: 50}}, wantErr: "totalIOPS cannot be combined"},
+		{name: "total and write bps", data: v1alpha1.DiskTuningSpec{IOTune: &v1alpha1.DiskIOTuneSpec{TotalBytesPerSec: 100, WriteBytesPerSec: 50}}, wantErr: "totalBytesPerSec cannot be combined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &v1alpha1.VirtualMachine{
+				ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+				Spec: v1alpha1.VirtualMachineSpec{
+					VCPUs:     2,
+					MemoryGiB: 4,
+					IOThreads: tt.ioThreads,
+					BootDisk: v1alpha1.BootDiskSpec{
+						SizeGB:         50,
+						Image:          "fedora-43.qcow2",
+						DiskTuningSpec: tt.boot,
+					},
+					DataDisks: []v1alpha1.DataDiskSpec{
+						{Device: "vdb", SizeGB: 10, DiskTuningSpec: tt.data},
+					},
+					NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+						{IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0"},
+					},
+				},
+			}
+			err := validateSpec(vm)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("validateSpec() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("validateSpec() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSpec_InterfaceRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		iface   v1alpha1.NetworkInterfaceSpec
+		wantErr string
+	}{
+		{name: "ipv4 and ipv6 routes", iface: v1alpha1.NetworkInterfaceSpec{
+			IP: "10.0.0.1/24", Gateway: "10.0.0.254", IPv6: "2001:db8::1/64", Bridge: "br0",
+			Routes: []v1alpha1.RouteSpec{{To: "10.20.0.0/16", Via: "10.0.0.254", Metric: 100}, {To: "2001:db8:20::/48", Via: "2001:db8::fe"}},
+		}},
+		{name: "route on dhcp interface", iface: v1alpha1.NetworkInterfaceSpec{
+			DHCP: true, Bridge: "br0", Routes: []v1alpha1.RouteSpec{{To: "10.20.0.0/16", Via: "10.0.0.254"}},
+		}},
+		{name: "search domains", iface: v1alpha1.NetworkInterfaceSpec{
+			DHCP: true, Bridge: "br0", SearchDomains: []string{"lab.example.com"},
+		}},
+		{name: "invalid destination", iface: v1alpha1.NetworkInterfaceSpec{
+			IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0", Routes: []v1alpha1.RouteSpec{{To: "10.20.0.0", Via: "10.0.0.254"}},
+		}, wantErr: "routes[0].to \"10.20.0.0\" must be a network in CIDR notation"},
+		{name: "invalid gateway", iface: v1alpha1.NetworkInterfaceSpec{
+			IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0", Routes: []v1alpha1.RouteSpec{{To: "10.20.0.0/16", Via: "gw"}},
+		}, wantErr: "routes[0].via \"gw\" is not an IP address"},
+		{name: "mixed families", iface: v1alpha1.NetworkInterfaceSpec{
+			IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0", Routes: []v1alpha1.RouteSpec{{To: "10.20.0.0/16", Via: "2001:db8::fe"}},
+		}, wantErr: "routes[0].via \"2001:db8::fe\" is not of the same IP family"},
+		{name: "negative metric", iface: v1alpha1.NetworkInterfaceSpec{
+			IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0", Routes: []v1alpha1.RouteSpec{{To: "10.20.0.0/16", Via: "10.0.0.254", Metric: -1}},
+		}, wantErr: "routes[0].metric must not be negative"},
+		{name: "ipv6 route without ipv6", iface: v1alpha1.NetworkInterfaceSpec{
+			IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0", Routes: []v1alpha1.RouteSpec{{To: "2001:db8:20::/48", Via: "2001:db8::fe"}},
+		}, wantErr: "routes[0] is an IPv6 route on an interface without ipv6"},
+		{name: "invalid search domain", iface: v1alpha1.NetworkInterfaceSpec{
+			DHCP: true, Bridge: "br0", SearchDomains: []string{"lab example"},
+		}, wantErr: "searchDomains[0] \"lab example\" is not a domain name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &v1alpha1.VirtualMachine{
+				ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+				Spec: v1alpha1.VirtualMachineSpec{
+					VCPUs:             2,
+					MemoryGiB:         4,
+					BootDisk:          v1alpha1.BootDiskSpec{SizeGB: 50, Image: "fedora-43.qcow2"},
+					NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{tt.iface},
+				},
+			}
+			err := validateSpec(vm)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("validateSpec() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), "spec.networkInterfaces[0]."+tt.wantErr)) {
+				t.Errorf("validateSpec() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSpec_Bandwidth(t *testing.T) {
+	tests := []struct {
+		name      string
+		bandwidth *v1alpha1.BandwidthSpec
+		wantErr   string
+	}{
+		{name: "none"},
+		{name: "both directions", bandwidth: &v1alpha1.BandwidthSpec{
+			Inbound:  &v1alpha1.BandwidthLimitSpec{Average: 1000, Peak: 2000, Burst: 100},
+			Outbound: &v1alpha1.BandwidthLimitSpec{Average: 500},
+		}},
+		{name: "missing average", bandwidth: &v1alpha1.BandwidthSpec{Inbound: &v1alpha1.BandwidthLimitSpec{Peak: 2000}}, wantErr: "inbound.average"},
+		{name: "peak below average", bandwidth: &v1alpha1.BandwidthSpec{Outbound: &v1alpha1.BandwidthLimitSpec{Average: 1000, Peak: 500}}, wantErr: "outbound.peak"},
+		{name: "negative burst", bandwidth: &v1alpha1.BandwidthSpec{Outbound: &v1alpha1.BandwidthLimitSpec{Average: 1000, Burst: -1}}, wantErr: "outbound.burst"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &v1alpha1.VirtualMachine{
+				ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+				Spec: v1alpha1.VirtualMachineSpec{
+					VCPUs:     2,
+					MemoryGiB: 4,
+					BootDisk: v1alpha1.BootDiskSpec{
+						SizeGB: 50,
+						Image:  "fedora-43.qcow2",
+					},
+					NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+						{IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0", Bandwidth: tt.bandwidth},
+					},
+				},
+			}
+			err := validateSpec(vm)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("validateSpec() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), "spec.networkInterfaces[0].bandwidth."+tt.wantErr)) {
+				t.Errorf("validateSpec() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSpec_CloudInitTransport(t *testing.T) {
+	newVM := func() *v1alpha1.VirtualMachine {
+		return &v1alpha1.VirtualMachine{
+			ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+			Spec: v1alpha1.VirtualMachineSpec{
+				VCPUs:     2,
+				MemoryGiB: 4,
+				BootDisk: v1alpha1.BootDiskSpec{
+					SizeGB: 50,
+					Image:  "fedora-43.qcow2",
+				},
+				NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+					{IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0"},
+				},
+				CloudInit: &v1alpha1.CloudInitSpec{
+					Transport: v1alpha1.CloudInitTransportHTTP,
+					SeedURL:   "http://169.254.169.254:8775",
+				},
+			},
+		}
+	}
+
+	if err := validateSpec(newVM()); err != nil {
+		t.Errorf("validateSpec() error = %v", err)
+	}
+	configDrive := newVM()
+	configDrive.Spec.CloudInit = &v1alpha1.CloudInitSpec{Datasource: v1alpha1.CloudInitDatasourceConfigDrive}
+	if err := validateSpec(configDrive); err != nil {
+		t.Errorf("validateSpec() of config drive error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(vm *v1alpha1.VirtualMachine)
+		wantErr string
+	}{
+		{"unknown transport", func(vm *v1alpha1.VirtualMachine) { vm.Spec.CloudInit.Transport = "floppy" }, "spec.cloudInit.transport"},
+		{"missing seed URL", func(vm *v1alpha1.VirtualMachine) { vm.Spec.CloudInit.SeedURL = "" }, "seedURL is required"},
+		{"seed URL with iso", func(vm *v1alpha1.VirtualMachine) { vm.Spec.CloudInit.Transport = v1alpha1.CloudInitTransportISO }, "requires transport http"},
+		{"seed URL not http", func(vm *v1alpha1.VirtualMachine) { vm.Spec.CloudInit.SeedURL = "ftp://10.0.0.254/" }, "http or https URL"},
+		{"seed URL with semicolon", func(vm *v1alpha1.VirtualMachine) { vm.Spec.CloudInit.SeedURL = "http://10.0.0.254/;x" }, "';'"},
+		{"smbios serial", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.SMBIOS = &v1alpha1.SMBIOSSpec{Serial: "SN-1"}
+		}, "spec.smbios.serial"},
+		{"config drive over http", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.CloudInit.Datasource = v1alpha1.CloudInitDatasourceConfigDrive
+		}, "requires transport iso"},
+		{"unknown datasource", func(vm *v1alpha1.VirtualMachine) {
+			vm.Spec.CloudInit = &v1alpha1.CloudInitSpec{Datasource: "ec2"}
+		}, "spec.cloudInit.datasource"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := newVM()
+			tt.modify(vm)
+			if err := validateSpec(vm); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateSpec() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSpec_Maximums(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			VCPUs:        2,
+			MaxVCPUs:     8,
+			MemoryMiB:    1536,
+			MaxMemoryGiB: 4,
+			BootDisk: v1alpha1.BootDiskSpec{
+				SizeGB: 50,
+				Image:  "fedora-43.qcow2",
+			},
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0"},
+			},
+		},
+	}
+	if err := validateSpec(vm); err != nil {
+		t.Errorf("validateSpec() error = %v", err)
+	}
+
+	vm.Spec.MaxVCPUs = 1
+	if err := validateSpec(vm); err == nil || !strings.Contains(err.Error(), "spec.maxVCPUs") {
+		t.Errorf("validateSpec() error = %v, want spec.maxVCPUs error", err)
+	}
+
+	vm.Spec.MaxVCPUs = 0
+	vm.Spec.MemoryMiB = 6144
+	if err := validateSpec(vm); err == nil || !strings.Contains(err.Error(), "spec.maxMemoryGiB") {
+		t.Errorf("validateSpec() error = %v, want spec.maxMemoryGiB error", err)
+	}
+}
+
+func TestValidateSpec_Graphics(t *testing.T) {
+	newVM := func(graphics *v1alpha1.GraphicsSpec) *v1alpha1.VirtualMachine {
+		return &v1alpha1.VirtualMachine{
+			ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+			Spec: v1alpha1.VirtualMachineSpec{
+				VCPUs:     2,
+				MemoryGiB: 4,
+				BootDisk: v1alpha1.BootDiskSpec{
+					SizeGB: 50,
+					Image:  "fedora-43.qcow2",
+				},
+				NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+					{IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0"},
+				},
+				Graphics: graphics,
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		graphics *v1alpha1.GraphicsSpec
+		wantErr  string
+	}{
+		{name: "vnc defaults", graphics: &v1alpha1.GraphicsSpec{Type: "vnc"}},
+		{name: "spice with everything", graphics: &v1alpha1.GraphicsSpec{Type: "spice", Listen: "0.0.0.0", Port: 5930, Password: "a-long-password"}},
+		{name: "missing type", graphics: &v1alpha1.GraphicsSpec{}, wantErr: "spec.graphics.type is required"},
+		{name: "invalid type", graphics: &v1alpha1.GraphicsSpec{Type: "rdp"}, wantErr: "spec.graphics.type \"rdp\""},
+		{name: "invalid listen", graphics: &v1alpha1.GraphicsSpec{Type: "vnc", Listen: "localhost"}, wantErr: "spec.graphics.listen"},
+		{name: "port too low", graphics: &v1alpha1.GraphicsSpec{Type: "vnc", Port: 22}, wantErr: "spec.graphics.port 22"},
+		{name: "vnc password too long", graphics: &v1alpha1.GraphicsSpec{Type: "vnc", Password: "a-long-password"}, wantErr: "spec.graphics.password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSpec(newVM(tt.graphics))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateSpec() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateSpec() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSpec_HostDevices(t *testing.T) {
+	newVM := func(devices []v1alpha1.HostDeviceSpec) *v1alpha1.VirtualMachine {
+		return &v1alpha1.VirtualMachine{
+			ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+			Spec: v1alpha1.VirtualMachineSpec{
+				VCPUs:     2,
+				MemoryGiB: 4,
+				BootDisk: v1alpha1.BootDiskSpec{
+					SizeGB: 50,
+					Image:  "fedora-43.qcow2",
+				},
+				NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+					{IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0"},
+				},
+				HostDevices: devices,
+			},
+		}
+	}
+	const mdev = "4b20d080-1b54-4048-85b3-a6a62d165c01"
+
+	tests := []struct {
+		name    string
+		devices []v1alpha1.HostDeviceSpec
+		wantErr string
+	}{
+		{name: "pci and mdev", devices: []v1alpha1.HostDeviceSpec{{PCIAddress: "0000:01:00.0"}, {PCIAddress: "02:00.1"}, {MdevUUID: mdev}}},
+		{name: "empty", devices: []v1alpha1.HostDeviceSpec{{}}, wantErr: "requires pciAddress or mdevUUID"},
+		{name: "both", devices: []v1alpha1.HostDeviceSpec{{PCIAddress: "0000:01:00.0", MdevUUID: mdev}}, wantErr: "sets both"},
+		{name: "invalid pci address", devices: []v1alpha1.HostDeviceSpec{{PCIAddress: "1:0"}}, wantErr: "spec.hostDevices[0].pciAddress"},
+		{name: "invalid mdev uuid", devices: []v1alpha1.HostDeviceSpec{{MdevUUID: "gpu-1"}}, wantErr: "not a valid UUID"},
+		{name: "duplicated with default domain", devices: []v1alpha1.HostDeviceSpec{{PCIAddress: "0000:01:00.0"}, {PCIAddress: "01:00.0"}}, wantErr: "spec.hostDevices[1] 0000:01:00.0 is duplicated"},
+		{name: "duplicated mdev", devices: []v1alpha1.HostDeviceSpec{{MdevUUID: mdev}, {MdevUUID: strings.ToUpper(mdev)}}, wantErr: "is duplicated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSpec(newVM(tt.devices))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateSpec() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateSpec() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSpec_InvalidMemory(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			VCPUs:     2,
+			MemoryGiB: 0,
+			BootDisk: v1alpha1.BootDiskSpec{
+				SizeGB: 50,
+				Image:  "fedora-43.qcow2",
+			},
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0"},
+			},
+		},
+	}
+
+	if err := validateSpec(vm); err == nil {
+		t.Error("Expected error for invalid memory")
+	}
+}
+
+func TestValidateSpec_Memory(t *testing.T) {
+	tests := []struct {
+		name      string
+		memoryGiB int
+		memoryMiB int
+		wantErr   string
+	}{
+		{name: "GiB", memoryGiB: 4},
+		{name: "MiB", memoryMiB: 1536},
+		{name: "neither", wantErr: "spec.memoryGiB must be greater than 0"},
+		{name: "both", memoryGiB: 4, memoryMiB: 4096, wantErr: "mutually exclusive"},
+		{name: "negative MiB", memoryMiB: -1, wantErr: "spec.memoryMiB must be greater than 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &v1alpha1.VirtualMachine{
+				ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+				Spec: v1alpha1.VirtualMachineSpec{
+					VCPUs:     2,
+					MemoryGiB: tt.memoryGiB,
+					MemoryMiB: tt.memoryMiB,
+					BootDisk: v1alpha1.BootDiskSpec{
+						SizeGB: 50,
+						Image:  "fedora-43.qcow2",
+					},
+					NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+						{IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0"},
+					},
+				},
+			}
+
+			err := validateSpec(vm)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateSpec() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateSpec() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	tests := []struct {
+		name      string
+		memoryGiB int
+		memoryMiB int
+		want      string
+	}{
+		{name: "typical GiB", memoryGiB: 8},
+		{name: "typical MiB", memoryMiB: 1536},
+		{name: "1 TiB", memoryGiB: 1024},
+		{name: "GiB that look like MiB", memoryGiB: 4096, want: "did you mean memoryMiB: 4096?"},
+		{name: "huge MiB", memoryMiB: 2 * 1024 * 1024, want: "more than 1 TiB"},
+		{name: "MiB that look like GiB", memoryMiB: 8, want: "did you mean memoryGiB: 8?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &v1alpha1.VirtualMachine{
+				Spec: v1alpha1.VirtualMachineSpec{MemoryGiB: tt.memoryGiB, MemoryMiB: tt.memoryMiB},
+			}
+
+			warnings := Warnings(vm)
+			if tt.want == "" {
+				if len(warnings) != 0 {
+					t.Errorf("Warnings() = %v, want none", warnings)
+				}
+				return
+			}
+			if len(warnings) != 1 || !strings.Contains(warnings[0], tt.want) {
+				t.Errorf("Warnings() = %v, want %q", warnings, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSpec_InvalidBootDiskSize(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			VCPUs:     2,
 			MemoryGiB: 4,
 			BootDisk: v1alpha1.BootDiskSpec{
 				SizeGB: 0,
@@ -484,6 +1474,33 @@ func TestValidateSpec_BootDiskBothImageAndEmpty(t *testing.T) {
 	}
 }
 
+func TestValidateSpec_BootDiskFormat(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			VCPUs:     2,
+			MemoryGiB: 4,
+			BootDisk: v1alpha1.BootDiskSpec{
+				SizeGB: 50,
+				Image:  "fedora-43.qcow2",
+				Format: "raw",
+			},
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0"},
+			},
+		},
+	}
+
+	if err := validateSpec(vm); err != nil {
+		t.Errorf("validateSpec() of raw boot disk error = %v", err)
+	}
+
+	vm.Spec.BootDisk.Format = "vmdk"
+	if err := validateSpec(vm); err == nil || !strings.Contains(err.Error(), "spec.bootDisk.format") {
+		t.Errorf("validateSpec() error = %v, want spec.bootDisk.format error", err)
+	}
+}
+
 func TestValidateSpec_DuplicateDataDiskDevice(t *testing.T) {
 	vm := &v1alpha1.VirtualMachine{
 		ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
@@ -629,3 +1646,458 @@ func TestValidateSpec_DuplicateIP(t *testing.T) {
 		t.Error("Expected error for duplicate IP")
 	}
 }
+
+func TestValidateSpec_DHCP(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifaces  []v1alpha1.NetworkInterfaceSpec
+		wantErr string
+	}{
+		{
+			name:   "dhcp only",
+			ifaces: []v1alpha1.NetworkInterfaceSpec{{Bridge: "br0", DHCP: true}},
+		},
+		{
+			name: "dhcp with mac and static interface",
+			ifaces: []v1alpha1.NetworkInterfaceSpec{
+				{IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0", DefaultRoute: true},
+				{Bridge: "br1", DHCP: true, MACAddress: "be:ee:01:02:03:04"},
+			},
+		},
+		{
+			name:    "dhcp with ip",
+			ifaces:  []v1alpha1.NetworkInterfaceSpec{{IP: "10.0.0.1/24", Bridge: "br0", DHCP: true}},
+			wantErr: "cannot specify ip or gateway with dhcp",
+		},
+		{
+			name:    "dhcp with default route",
+			ifaces:  []v1alpha1.NetworkInterfaceSpec{{Bridge: "br0", DHCP: true, DefaultRoute: true}},
+			wantErr: "defaultRoute cannot be used with dhcp",
+		},
+		{
+			name:    "dhcp without bridge",
+			ifaces:  []v1alpha1.NetworkInterfaceSpec{{DHCP: true}},
+			wantErr: "one of bridge, network, macvtap or sriov is required",
+		},
+		{
+			name: "duplicate vf",
+			ifaces: []v1alpha1.NetworkInterfaceSpec{
+				{DHCP: true, SRIOV: &v1alpha1.SRIOVSpec{PF: "enp1s0f0", VF: 1}},
+				{DHCP: true, SRIOV: &v1alpha1.SRIOVSpec{PF: "enp1s0f0", VF: 1}},
+			},
+			wantErr: "VF 1 of enp1s0f0 is duplicated",
+		},
+		{
+			name:    "invalid mac",
+			ifaces:  []v1alpha1.NetworkInterfaceSpec{{Bridge: "br0", DHCP: true, MACAddress: "not-a-mac"}},
+			wantErr: "not a valid MAC address",
+		},
+		{
+			name:    "multicast mac",
+			ifaces:  []v1alpha1.NetworkInterfaceSpec{{Bridge: "br0", DHCP: true, MACAddress: "01:00:5e:00:00:01"}},
+			wantErr: "multicast",
+		},
+		{
+			name: "duplicate mac",
+			ifaces: []v1alpha1.NetworkInterfaceSpec{
+				{Bridge: "br0", DHCP: true, MACAddress: "be:ee:01:02:03:04"},
+				{Bridge: "br1", DHCP: true, MACAddress: "BE:EE:01:02:03:04"},
+			},
+			wantErr: "duplicated",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &v1alpha1.VirtualMachine{
+				ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+				Spec: v1alpha1.VirtualMachineSpec{
+					VCPUs:     2,
+					MemoryGiB: 4,
+					BootDisk: v1alpha1.BootDiskSpec{
+						SizeGB: 50,
+						Image:  "fedora-43.qcow2",
+					},
+					NetworkInterfaces: tt.ifaces,
+				},
+			}
+
+			err := validateSpec(vm)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSpec_IPv6(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifaces  []v1alpha1.NetworkInterfaceSpec
+		wantErr string
+	}{
+		{
+			name: "dual-stack",
+			ifaces: []v1alpha1.NetworkInterfaceSpec{{
+				IP: "10.0.0.1/24", Gateway: "10.0.0.254", IPv6: "2001:db8::1/64", IPv6Gateway: "2001:db8::fe",
+				Bridge: "br0", DefaultRoute: true,
+			}},
+		},
+		{
+			name:   "IPv6 only",
+			ifaces: []v1alpha1.NetworkInterfaceSpec{{IPv6: "2001:db8::1/64", IPv6Gateway: "2001:db8::fe", Bridge: "br0", DefaultRoute: true}},
+		},
+		{
+			name:   "DHCP with static IPv6",
+			ifaces: []v1alpha1.NetworkInterfaceSpec{{DHCP: true, IPv6: "2001:db8::1/64", Bridge: "br0"}},
+		},
+		{
+			name:    "IPv6 in ip",
+			ifaces:  []v1alpha1.NetworkInterfaceSpec{{IP: "2001:db8::1/64", Gateway: "2001:db8::fe", Bridge: "br0"}},
+			wantErr: "use ipv6",
+		},
+		{
+			name:    "IPv4 in ipv6",
+			ifaces:  []v1alpha1.NetworkInterfaceSpec{{IPv6: "10.0.0.1/24", Bridge: "br0"}},
+			wantErr: "must be an IPv6 address",
+		},
+		{
+			name:    "ipv6 without prefix length",
+			ifaces:  []v1alpha1.NetworkInterfaceSpec{{IPv6: "2001:db8::1", Bridge: "br0"}},
+			wantErr: "CIDR notation",
+		},
+		{
+			name:    "IPv4 gateway without ip",
+			ifaces:  []v1alpha1.NetworkInterfaceSpec{{IPv6: "2001:db8::1/64", Gateway: "10.0.0.254", Bridge: "br0"}},
+			wantErr: "gateway requires ip",
+		},
+		{
+			name:    "ipv6Gateway without ipv6",
+			ifaces:  []v1alpha1.NetworkInterfaceSpec{{IP: "10.0.0.1/24", Gateway: "10.0.0.254", IPv6Gateway: "2001:db8::fe", Bridge: "br0"}},
+			wantErr: "ipv6Gateway requires ipv6",
+		},
+		{
+			name:    "invalid ipv6Gateway",
+			ifaces:  []v1alpha1.NetworkInterfaceSpec{{IPv6: "2001:db8::1/64", IPv6Gateway: "10.0.0.254", Bridge: "br0"}},
+			wantErr: "is not an IPv6 address",
+		},
+		{
+			name:    "IPv6-only default route without gateway",
+			ifaces:  []v1alpha1.NetworkInterfaceSpec{{IPv6: "2001:db8::1/64", Bridge: "br0", DefaultRoute: true}},
+			wantErr: "requires ipv6Gateway",
+		},
+		{
+			name: "duplicate ipv6",
+			ifaces: []v1alpha1.NetworkInterfaceSpec{
+				{IPv6: "2001:db8::1/64", Bridge: "br0"},
+				{IPv6: "2001:0db8::0001/64", Bridge: "br1"},
+			},
+			wantErr: "duplicated",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &v1alpha1.VirtualMachine{
+				ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+				Spec: v1alpha1.VirtualMachineSpec{
+					VCPUs:     2,
+					MemoryGiB: 4,
+					BootDisk: v1alpha1.BootDiskSpec{
+						SizeGB: 50,
+						Image:  "fedora-43.qcow2",
+					},
+					NetworkInterfaces: tt.ifaces,
+				},
+			}
+
+			err := validateSpec(vm)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSpec_NetworkSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		iface   v1alpha1.NetworkInterfaceSpec
+		wantErr string
+	}{
+		{
+			name:  "bridge",
+			iface: v1alpha1.NetworkInterfaceSpec{IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0"},
+		},
+		{
+			name:  "libvirt network",
+			iface: v1alpha1.NetworkInterfaceSpec{DHCP: true, Network: "default"},
+		},
+		{
+			name:    "neither",
+			iface:   v1alpha1.NetworkInterfaceSpec{IP: "10.0.0.1/24", Gateway: "10.0.0.254"},
+			wantErr: "one of bridge, network, macvtap or sriov is required",
+		},
+		{
+			name:    "both",
+			iface:   v1alpha1.NetworkInterfaceSpec{DHCP: true, Bridge: "br0", Network: "default"},
+			wantErr: "bridge and network are mutually exclusive",
+		},
+		{
+			name:  "macvtap",
+			iface: v1alpha1.NetworkInterfaceSpec{DHCP: true, Macvtap: &v1alpha1.MacvtapSpec{Device: "eno1", Mode: "private"}},
+		},
+		{
+			name:  "sriov",
+			iface: v1alpha1.NetworkInterfaceSpec{DHCP: true, SRIOV: &v1alpha1.SRIOVSpec{PF: "enp1s0f0", VF: 2, PCIAddress: "0000:01:10.4"}},
+		},
+		{
+			name:    "bridge and macvtap",
+			iface:   v1alpha1.NetworkInterfaceSpec{DHCP: true, Bridge: "br0", Macvtap: &v1alpha1.MacvtapSpec{Device: "eno1"}},
+			wantErr: "bridge and macvtap are mutually exclusive",
+		},
+		{
+			name:    "macvtap without device",
+			iface:   v1alpha1.NetworkInterfaceSpec{DHCP: true, Macvtap: &v1alpha1.MacvtapSpec{}},
+			wantErr: "macvtap.device is required",
+		},
+		{
+			name:    "invalid macvtap mode",
+			iface:   v1alpha1.NetworkInterfaceSpec{DHCP: true, Macvtap: &v1alpha1.MacvtapSpec{Device: "eno1", Mode: "vepa"}},
+			wantErr: "macvtap.mode \"vepa\" is invalid",
+		},
+		{
+			name:    "sriov without pf",
+			iface:   v1alpha1.NetworkInterfaceSpec{DHCP: true, SRIOV: &v1alpha1.SRIOVSpec{VF: 1}},
+			wantErr: "sriov.pf is required",
+		},
+		{
+			name:    "negative vf",
+			iface:   v1alpha1.NetworkInterfaceSpec{DHCP: true, SRIOV: &v1alpha1.SRIOVSpec{PF: "enp1s0f0", VF: -1}},
+			wantErr: "sriov.vf must not be negative",
+		},
+		{
+			name:    "invalid vf address",
+			iface:   v1alpha1.NetworkInterfaceSpec{DHCP: true, SRIOV: &v1alpha1.SRIOVSpec{PF: "enp1s0f0", PCIAddress: "vf0"}},
+			wantErr: "sriov.pciAddress",
+		},
+		{
+			name:  "vlan on openvswitch",
+			iface: v1alpha1.NetworkInterfaceSpec{DHCP: true, Bridge: "ovsbr0", BridgeType: "openvswitch", VLAN: 100},
+		},
+		{
+			name:  "vlan on sriov",
+			iface: v1alpha1.NetworkInterfaceSpec{DHCP: true, SRIOV: &v1alpha1.SRIOVSpec{PF: "enp1s0f0"}, VLAN: 4094},
+		},
+		{
+			name:    "invalid bridge type",
+			iface:   v1alpha1.NetworkInterfaceSpec{DHCP: true, Bridge: "br0", BridgeType: "ovs"},
+			wantErr: "bridgeType \"ovs\" is invalid",
+		},
+		{
+			name:    "bridge type without bridge",
+			iface:   v1alpha1.NetworkInterfaceSpec{DHCP: true, Network: "default", BridgeType: "openvswitch"},
+			wantErr: "bridgeType requires bridge",
+		},
+		{
+			name:    "vlan out of range",
+			iface:   v1alpha1.NetworkInterfaceSpec{DHCP: true, Bridge: "br0", VLAN: 4095},
+			wantErr: "vlan 4095 is invalid",
+		},
+		{
+			name:    "vlan on macvtap",
+			iface:   v1alpha1.NetworkInterfaceSpec{DHCP: true, Macvtap: &v1alpha1.MacvtapSpec{Device: "eno1"}, VLAN: 10},
+			wantErr: "vlan is not supported on macvtap",
+		},
+		{
+			name:  "multiqueue",
+			iface: v1alpha1.NetworkInterfaceSpec{DHCP: true, Bridge: "br0", Queues: 4},
+		},
+		{
+			name:    "too many queues",
+			iface:   v1alpha1.NetworkInterfaceSpec{DHCP: true, Bridge: "br0", Queues: 257},
+			wantErr: "queues 257 is invalid",
+		},
+		{
+			name:    "queues on sriov",
+			iface:   v1alpha1.NetworkInterfaceSpec{DHCP: true, SRIOV: &v1alpha1.SRIOVSpec{PF: "enp1s0f0"}, Queues: 4},
+			wantErr: "queues is not supported on sriov interfaces",
+		},
+		{
+			name:  "jumbo frames",
+			iface: v1alpha1.NetworkInterfaceSpec{DHCP: true, Bridge: "br0", MTU: 9000},
+		},
+		{
+			name:    "mtu too small",
+			iface:   v1alpha1.NetworkInterfaceSpec{DHCP: true, Bridge: "br0", MTU: 60},
+			wantErr: "mtu 60 is invalid",
+		},
+		{
+			name:    "mtu below the ipv6 minimum",
+			iface:   v1alpha1.NetworkInterfaceSpec{DHCP: true, Bridge: "br0", IPv6: "2001:db8::10/64", MTU: 1000},
+			wantErr: "below the IPv6 minimum",
+		},
+		{
+			name: "sriov with bandwidth",
+			iface: v1alpha1.NetworkInterfaceSpec{DHCP: true, SRIOV: &v1alpha1.SRIOVSpec{PF: "enp1s0f0"},
+				Bandwidth: &v1alpha1.BandwidthSpec{Inbound: &v1alpha1.BandwidthLimitSpec{Average: 1000}}},
+			wantErr: "not supported on sriov interfaces",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &v1alpha1.VirtualMachine{
+				ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+				Spec: v1alpha1.VirtualMachineSpec{
+					VCPUs:     2,
+					MemoryGiB: 4,
+					BootDisk: v1alpha1.BootDiskSpec{
+						SizeGB: 50,
+						Image:  "fedora-43.qcow2",
+					},
+					NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{tt.iface},
+				},
+			}
+
+			err := validateSpec(vm)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSpec_NetworkDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults v1alpha1.NetworkDefaultsSpec
+		wantErr  string
+	}{
+		{
+			name: "valid",
+			defaults: v1alpha1.NetworkDefaultsSpec{
+				DNSServers:          []string{"10.0.0.53", "2001:db8::53"},
+				SearchDomains:       []string{"example.com"},
+				GatewayMetricPolicy: v1alpha1.GatewayMetricPolicyOrdered,
+			},
+		},
+		{
+			name:     "invalid DNS server",
+			defaults: v1alpha1.NetworkDefaultsSpec{DNSServers: []string{"dns.example.com"}},
+			wantErr:  "dnsServers[0]",
+		},
+		{
+			name:     "empty search domain",
+			defaults: v1alpha1.NetworkDefaultsSpec{SearchDomains: []string{""}},
+			wantErr:  "searchDomains[0]",
+		},
+		{
+			name:     "unknown policy",
+			defaults: v1alpha1.NetworkDefaultsSpec{GatewayMetricPolicy: "random"},
+			wantErr:  "gatewayMetricPolicy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &v1alpha1.VirtualMachine{
+				ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+				Spec: v1alpha1.VirtualMachineSpec{
+					VCPUs:     2,
+					MemoryGiB: 4,
+					BootDisk: v1alpha1.BootDiskSpec{
+						SizeGB: 50,
+						Image:  "fedora-43.qcow2",
+					},
+					NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+						{IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0"},
+					},
+					NetworkDefaults: &tt.defaults,
+				},
+			}
+
+			err := validateSpec(vm)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateSpec() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateSpec() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSpec_Firmware(t *testing.T) {
+	enabled := true
+	tests := []struct {
+		name        string
+		firmware    string
+		secureBoot  *bool
+		machineType string
+		wantErr     string
+	}{
+		{name: "defaults"},
+		{name: "bios on pc", firmware: "bios", machineType: "pc"},
+		{name: "secure boot", secureBoot: &enabled},
+		{name: "secure boot on q35", secureBoot: &enabled, machineType: "q35"},
+		{name: "unknown firmware", firmware: "coreboot", wantErr: "spec.firmware"},
+		{name: "unknown machine type", machineType: "microvm", wantErr: "spec.machineType"},
+		{name: "secure boot with bios", firmware: "bios", secureBoot: &enabled, wantErr: "requires firmware efi"},
+		{name: "secure boot on pc", machineType: "pc", secureBoot: &enabled, wantErr: "requires machineType q35"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &v1alpha1.VirtualMachine{
+				ObjectMeta: v1alpha1.ObjectMeta{Name: "test"},
+				Spec: v1alpha1.VirtualMachineSpec{
+					VCPUs:       2,
+					MemoryGiB:   4,
+					Firmware:    tt.firmware,
+					SecureBoot:  tt.secureBoot,
+					MachineType: tt.machineType,
+					BootDisk: v1alpha1.BootDiskSpec{
+						SizeGB: 50,
+						Image:  "fedora-43.qcow2",
+					},
+					NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+						{IP: "10.0.0.1/24", Gateway: "10.0.0.254", Bridge: "br0"},
+					},
+				},
+			}
+
+			err := validateSpec(vm)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateSpec() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateSpec() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/labels"
+)
+
+// maxStackSize is the most VMs a stack may have, which guards against a
+// typo like "web-{1..100000}".
+const maxStackSize = 256
+
+// namesPattern matches a name pattern with a numeric range, e.g.
+// "web-{01..03}".
+var namesPattern = regexp.MustCompile(`^([^{}]*)\{(\d+)\.\.(\d+)\}([^{}]*)$`)
+
+// LoadStackFromFile loads a VirtualMachineStack from a YAML file and expands
+// it into its VMs. See expandStack.
+func LoadStackFromFile(ctx context.Context, path string) (*v1alpha1.VirtualMachineStack, []*v1alpha1.VirtualMachine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+
+	return loadStackYAML(ctx, data, filepath.Dir(path))
+}
+
+// LoadStackFromYAML loads a VirtualMachineStack from YAML bytes and expands
+// it into its VMs. See expandStack.
+func LoadStackFromYAML(ctx context.Context, data []byte) (*v1alpha1.VirtualMachineStack, []*v1alpha1.VirtualMachine, error) {
+	return loadStackYAML(ctx, data, "")
+}
+
+// loadStackYAML loads a VirtualMachineStack from YAML bytes, resolving
+// relative file references against baseDir.
+func loadStackYAML(ctx context.Context, data []byte, baseDir string) (*v1alpha1.VirtualMachineStack, []*v1alpha1.VirtualMachine, error) {
+	var stack v1alpha1.VirtualMachineStack
+	if err := yaml.Unmarshal(data, &stack); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal YAML: %w", err)
+	}
+
+	if stack.APIVersion == "" {
+		return nil, nil, fmt.Errorf("missing required field: apiVersion")
+	}
+	expectedAPIVersion := v1alpha1.GroupName + "/" + v1alpha1.Version
+	if stack.APIVersion != expectedAPIVersion {
+		return nil, nil, fmt.Errorf("unsupported apiVersion: %s (expected: %s)", stack.APIVersion, expectedAPIVersion)
+	}
+	if stack.Kind != v1alpha1.VirtualMachineStackKind {
+		return nil, nil, fmt.Errorf("unsupported kind: %s (expected: %s)", stack.Kind, v1alpha1.VirtualMachineStackKind)
+	}
+
+	vms, err := expandStack(ctx, &stack, baseDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &stack, vms, nil
+}
+
+// expandStack returns the VMs of a stack, in name order, resolving relative
+// file references against baseDir. VM i (counting from 0) is a copy of the
+// template with:
+//   - the i-th name of spec.names
+//   - the static IPv4 and IPv6 addresses of each interface advanced by i
+//   - "{name}" in spec.cloudInit.fqdn replaced with the VM name
+//   - the label LabelStack set to the stack name
+//
+// Each VM is validated like a VirtualMachine document. An address advanced
+// out of its subnet, or onto the subnet's broadcast address or gateway, is
+// an error.
+func expandStack(ctx context.Context, stack *v1alpha1.VirtualMachineStack, baseDir string) ([]*v1alpha1.VirtualMachine, error) {
+	if stack.Name == "" {
+		return nil, fmt.Errorf("missing required field: metadata.name")
+	}
+	// The name is the value of each VM's stack label
+	if _, err := labels.Parse(v1alpha1.LabelStack + "=" + stack.Name); err != nil {
+		return nil, fmt.Errorf("invalid stack name %q: must be a valid label value", stack.Name)
+	}
+
+	names, err := expandNames(stack.Spec.Names)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, iface := range stack.Spec.Template.Spec.NetworkInterfaces {
+		if iface.MACAddress != "" {
+			return nil, fmt.Errorf("spec.template.spec.networkInterfaces[%d].macAddress cannot be set in a stack; each VM needs its own", i)
+		}
+	}
+
+	vms := make([]*v1alpha1.VirtualMachine, 0, len(names))
+	for i, name := range names {
+		meta := stack.Spec.Template.ObjectMeta.DeepCopy()
+		vm := &v1alpha1.VirtualMachine{
+			TypeMeta: v1alpha1.TypeMeta{
+				APIVersion: stack.APIVersion,
+				Kind:       v1alpha1.VirtualMachineKind,
+			},
+			ObjectMeta: v1alpha1.ObjectMeta{
+				Name:        name,
+				Labels:      meta.Labels,
+				Annotations: meta.Annotations,
+			},
+			Spec: *stack.Spec.Template.Spec.DeepCopy(),
+		}
+		if vm.Labels == nil {
+			vm.Labels = make(map[string]string)
+		}
+		vm.Labels[v1alpha1.LabelStack] = stack.Name
+
+		for j := range vm.Spec.NetworkInterfaces {
+			iface := &vm.Spec.NetworkInterfaces[j]
+			field := fmt.Sprintf("spec.template.spec.networkInterfaces[%d]", j)
+			if iface.IP, err = advanceAddress(field+".ip", iface.IP, iface.Gateway, i); err != nil {
+				return nil, fmt.Errorf("VM %s: %w", name, err)
+			}
+			if iface.IPv6, err = advanceAddress(field+".ipv6", iface.IPv6, iface.IPv6Gateway, i); err != nil {
+				return nil, fmt.Errorf("VM %s: %w", name, err)
+			}
+		}
+		if vm.Spec.CloudInit != nil {
+			vm.Spec.CloudInit.FQDN = strings.ReplaceAll(vm.Spec.CloudInit.FQDN, "{name}", name)
+		}
+
+		loaded, err := loadVM(ctx, vm, baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("VM %s: %w", name, err)
+		}
+		vms = append(vms, loaded)
+	}
+
+	return vms, nil
+}
+
+// expandNames expands a name pattern like "web-{01..03}" into its names. A
+// pattern without a range is a single name.
+func expandNames(pattern string) ([]string, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("missing required field: spec.names")
+	}
+
+	m := namesPattern.FindStringSubmatch(pattern)
+	if m == nil {
+		if strings.ContainsAny(pattern, "{}") {
+			return nil, fmt.Errorf("invalid spec.names %q: expected a single range like {01..03}", pattern)
+		}
+		return []string{pattern}, nil
+	}
+
+	prefix, startText, endText, suffix := m[1], m[2], m[3], m[4]
+	start, err := strconv.Atoi(startText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec.names %q: %w", pattern, err)
+	}
+	end, err := strconv.Atoi(endText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec.names %q: %w", pattern, err)
+	}
+	if end < start {
+		return nil, fmt.Errorf("invalid spec.names %q: range end %d is before start %d", pattern, end, start)
+	}
+	if end-start+1 > maxStackSize {
+		return nil, fmt.Errorf("invalid spec.names %q: %d VMs exceeds the maximum of %d", pattern, end-start+1, maxStackSize)
+	}
+
+	names := make([]string, 0, end-start+1)
+	for n := start; n <= end; n++ {
+		names = append(names, fmt.Sprintf("%s%0*d%s", prefix, len(startText), n, suffix))
+	}
+	return names, nil
+}
+
+// advanceAddress advances the address of a CIDR like "10.0.0.10/24" by n
+// addresses within its subnet. Empty and invalid CIDRs are returned as is,
+// leaving them to validation.
+func advanceAddress(field, cidr, gateway string, n int) (string, error) {
+	if cidr == "" || n == 0 {
+		return cidr, nil
+	}
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return cidr, nil
+	}
+
+	addr := prefix.Addr()
+	for range n {
+		addr = addr.Next()
+	}
+	subnet := prefix.Masked()
+	if !addr.IsValid() || !subnet.Contains(addr) {
+		return "", fmt.Errorf("%s %s advanced by %d is outside %s", field, cidr, n, subnet)
+	}
+	if addr.Is4() && prefix.Bits() < 31 && !subnet.Contains(addr.Next()) {
+		return "", fmt.Errorf("%s %s advanced by %d is the broadcast address of %s", field, cidr, n, subnet)
+	}
+	if gw, err := netip.ParseAddr(gateway); err == nil && gw == addr {
+		return "", fmt.Errorf("%s %s advanced by %d is the gateway %s", field, cidr, n, gateway)
+	}
+	return netip.PrefixFrom(addr, prefix.Bits()).String(), nil
+}
@@ -0,0 +1,216 @@
+package loader
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+const testStackYAML = `
+apiVersion: foundry.cofront.xyz/v1alpha1
+kind: VirtualMachineStack
+metadata:
+  name: web
+spec:
+  names: web-{01..03}
+  template:
+    metadata:
+      labels:
+        role: web
+    spec:
+      vcpus: 2
+      memoryGiB: 4
+      bootDisk:
+        sizeGB: 20
+        image: fedora-43.qcow2
+      networkInterfaces:
+        - ip: 10.0.0.10/24
+          gateway: 10.0.0.1
+          ipv6: 2001:db8::10/64
+          bridge: br0
+      cloudInit:
+        fqdn: "{name}.example.com"
+`
+
+func TestLoadStackFromYAML(t *testing.T) {
+	stack, vms, err := LoadStackFromYAML(context.Background(), []byte(testStackYAML))
+	if err != nil {
+		t.Fatalf("LoadStackFromYAML() error = %v", err)
+	}
+	if stack.Name != "web" {
+		t.Errorf("stack name = %q, want web", stack.Name)
+	}
+	if len(vms) != 3 {
+		t.Fatalf("got %d VMs, want 3", len(vms))
+	}
+
+	want := []struct {
+		name, ip, ipv6, fqdn string
+	}{
+		{"web-01", "10.0.0.10/24", "2001:db8::10/64", "web-01.example.com"},
+		{"web-02", "10.0.0.11/24", "2001:db8::11/64", "web-02.example.com"},
+		{"web-03", "10.0.0.12/24", "2001:db8::12/64", "web-03.example.com"},
+	}
+	for i, vm := range vms {
+		iface := vm.Spec.NetworkInterfaces[0]
+		if vm.Name != want[i].name || iface.IP != want[i].ip || iface.IPv6 != want[i].ipv6 {
+			t.Errorf("VM %d = %s %s %s, want %s %s %s", i, vm.Name, iface.IP, iface.IPv6, want[i].name, want[i].ip, want[i].ipv6)
+		}
+		if iface.Gateway != "10.0.0.1" {
+			t.Errorf("VM %d gateway = %q, want 10.0.0.1", i, iface.Gateway)
+		}
+		if vm.Spec.CloudInit.FQDN != want[i].fqdn {
+			t.Errorf("VM %d fqdn = %q, want %q", i, vm.Spec.CloudInit.FQDN, want[i].fqdn)
+		}
+		if vm.Kind != v1alpha1.VirtualMachineKind {
+			t.Errorf("VM %d kind = %q", i, vm.Kind)
+		}
+		if vm.Labels[v1alpha1.LabelStack] != "web" || vm.Labels["role"] != "web" {
+			t.Errorf("VM %d labels = %v", i, vm.Labels)
+		}
+		// Defaults are applied to each VM
+		if vm.Spec.StoragePool != "foundry-vms" {
+			t.Errorf("VM %d storagePool = %q, want default", i, vm.Spec.StoragePool)
+		}
+	}
+
+	// VMs must not share the template's maps
+	vms[0].Labels["role"] = "changed"
+	if vms[1].Labels["role"] != "web" || stack.Spec.Template.Labels["role"] != "web" {
+		t.Error("VM labels share a map")
+	}
+}
+
+func TestExpandNames(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"db", []string{"db"}},
+		{"web-{01..03}", []string{"web-01", "web-02", "web-03"}},
+		{"node{8..10}", []string{"node8", "node9", "node10"}},
+		{"{1..2}-worker", []string{"1-worker", "2-worker"}},
+		{"app-{001..001}", []string{"app-001"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, err := expandNames(tt.pattern)
+			if err != nil {
+				t.Fatalf("expandNames() error = %v", err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expandNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandNames_Invalid(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr string
+	}{
+		{"", "spec.names"},
+		{"web-{3..1}", "before start"},
+		{"web-{1..3}-{1..2}", "single range"},
+		{"web-{a..c}", "single range"},
+		{"web-{1..1000}", "exceeds the maximum"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			_, err := expandNames(tt.pattern)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expandNames() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAdvanceAddress(t *testing.T) {
+	tests := []struct {
+		cidr    string
+		gateway string
+		n       int
+		want    string
+		wantErr string
+	}{
+		{cidr: "10.0.0.10/24", n: 0, want: "10.0.0.10/24"},
+		{cidr: "10.0.0.10/24", n: 5, want: "10.0.0.15/24"},
+		{cidr: "10.0.0.250/23", n: 10, want: "10.0.1.4/23"},
+		{cidr: "2001:db8::ff/64", n: 1, want: "2001:db8::100/64"},
+		{cidr: "", n: 3, want: ""},
+		{cidr: "10.0.0.253/24", n: 2, wantErr: "broadcast address"},
+		{cidr: "10.0.0.253/24", n: 3, wantErr: "outside 10.0.0.0/24"},
+		{cidr: "10.0.0.10/24", gateway: "10.0.0.12", n: 2, wantErr: "is the gateway"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cidr, func(t *testing.T) {
+			got, err := advanceAddress("ip", tt.cidr, tt.gateway, tt.n)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("advanceAddress() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("advanceAddress() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("advanceAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadStackFromYAML_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		edit    func(string) string
+		wantErr string
+	}{
+		{
+			name: "wrong kind",
+			edit: func(s string) string {
+				return strings.Replace(s, "kind: VirtualMachineStack", "kind: VirtualMachine", 1)
+			},
+			wantErr: "unsupported kind: VirtualMachine",
+		},
+		{
+			name:    "missing name",
+			edit:    func(s string) string { return strings.Replace(s, "  name: web\n", "", 1) },
+			wantErr: "metadata.name",
+		},
+		{
+			name:    "invalid name",
+			edit:    func(s string) string { return strings.Replace(s, "  name: web\n", "  name: web stack\n", 1) },
+			wantErr: "invalid stack name",
+		},
+		{
+			name: "mac address",
+			edit: func(s string) string {
+				return strings.Replace(s, "bridge: br0", "bridge: br0\n          macAddress: 52:54:00:00:00:01", 1)
+			},
+			wantErr: "macAddress cannot be set",
+		},
+		{
+			name:    "addresses run out",
+			edit:    func(s string) string { return strings.Replace(s, "10.0.0.10/24", "10.0.0.253/24", 1) },
+			wantErr: "VM web-03: spec.template.spec.networkInterfaces[0].ip 10.0.0.253/24 advanced by 2 is the broadcast address",
+		},
+		{
+			name:    "invalid template",
+			edit:    func(s string) string { return strings.Replace(s, "vcpus: 2", "vcpus: 0", 1) },
+			wantErr: "VM web-01: validation failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := LoadStackFromYAML(context.Background(), []byte(tt.edit(testStackYAML)))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadStackFromYAML() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package loader
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Values are the variables a configuration file is rendered with, such as
+// {"ip": "10.0.0.5", "env": {"name": "prod"}}.
+type Values map[string]any
+
+// LoadValues merges the values of YAML files and key=value assignments, in
+// that order: later files override earlier ones and assignments override
+// files. A dotted key like env.name=prod sets a nested value. Nested maps
+// are merged key by key.
+//
+// Returns nil if there are no files or assignments, so that configurations
+// are only rendered when values were given.
+func LoadValues(files, assignments []string) (Values, error) {
+	if len(files) == 0 && len(assignments) == 0 {
+		return nil, nil
+	}
+
+	values := Values{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read values file %s: %w", file, err)
+		}
+		var fileValues map[string]any
+		if err := yaml.Unmarshal(data, &fileValues); err != nil {
+			return nil, fmt.Errorf("failed to parse values file %s: %w", file, err)
+		}
+		mergeValues(values, fileValues)
+	}
+
+	for _, assignment := range assignments {
+		key, value, ok := strings.Cut(assignment, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid value %q: expected key=value", assignment)
+		}
+		parts := strings.Split(key, ".")
+		if slices.Contains(parts, "") {
+			return nil, fmt.Errorf("invalid value %q: empty key segment", assignment)
+		}
+		var nested any = value
+		for i := len(parts) - 1; i > 0; i-- {
+			nested = map[string]any{parts[i]: nested}
+		}
+		mergeValues(values, map[string]any{parts[0]: nested})
+	}
+
+	return values, nil
+}
+
+// mergeValues merges src into dst, recursing into maps present in both.
+func mergeValues(dst, src map[string]any) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]any)
+		dstMap, dstIsMap := dst[key].(map[string]any)
+		if srcIsMap && dstIsMap {
+			mergeValues(dstMap, srcMap)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// Render renders a configuration file as a Go template with values, e.g.
+// "ip: {{ .ip }}/24". Referencing a value that is not set is an error.
+func Render(name string, data []byte, values Values) ([]byte, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, map[string]any(values)); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+	return out.Bytes(), nil
+}
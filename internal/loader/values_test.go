@@ -0,0 +1,129 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadValues(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	prod := filepath.Join(dir, "prod.yaml")
+	if err := os.WriteFile(base, []byte("vcpus: 2\nenv:\n  name: dev\n  domain: example.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(prod, []byte("vcpus: 8\nenv:\n  name: prod\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := LoadValues([]string{base, prod}, []string{"ip=10.0.0.5", "env.domain=prod.example.com", "note=a=b"})
+	if err != nil {
+		t.Fatalf("LoadValues() error = %v", err)
+	}
+
+	want := Values{
+		"vcpus": 8,
+		"ip":    "10.0.0.5",
+		"note":  "a=b",
+		"env":   map[string]any{"name": "prod", "domain": "prod.example.com"},
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("LoadValues() = %v, want %v", values, want)
+	}
+}
+
+func TestLoadValues_None(t *testing.T) {
+	values, err := LoadValues(nil, nil)
+	if err != nil || values != nil {
+		t.Errorf("LoadValues() = %v, %v, want nil", values, err)
+	}
+}
+
+func TestLoadValues_Invalid(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       []string
+		assignments []string
+		wantErr     string
+	}{
+		{name: "missing file", files: []string{"/nonexistent/values.yaml"}, wantErr: "failed to read values file"},
+		{name: "no equals", assignments: []string{"ip"}, wantErr: "expected key=value"},
+		{name: "empty key", assignments: []string{"=10.0.0.5"}, wantErr: "expected key=value"},
+		{name: "empty segment", assignments: []string{"env..name=prod"}, wantErr: "empty key segment"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadValues(tt.files, tt.assignments)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadValues() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	values := Values{"ip": "10.0.0.5", "env": map[string]any{"name": "prod"}}
+
+	out, err := Render("vm.yaml", []byte("ip: {{ .ip }}/24\nenv: {{ .env.name }}\n"), values)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if string(out) != "ip: 10.0.0.5/24\nenv: prod\n" {
+		t.Errorf("Render() = %q", out)
+	}
+
+	if _, err := Render("vm.yaml", []byte("ip: {{ .gateway }}\n"), values); err == nil || !strings.Contains(err.Error(), `map has no entry for key "gateway"`) {
+		t.Errorf("Render() error = %v, want missing key", err)
+	}
+	if _, err := Render("vm.yaml", []byte("ip: {{ .ip \n"), values); err == nil || !strings.Contains(err.Error(), "failed to parse template") {
+		t.Errorf("Render() error = %v, want parse error", err)
+	}
+}
+
+func TestLoadAllWithValues(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "vm.yaml")
+	config := `
+apiVersion: foundry.cofront.xyz/v1alpha1
+kind: VirtualMachine
+metadata:
+  name: {{ .name }}
+spec:
+  vcpus: 2
+  memoryGiB: 4
+  bootDisk:
+    sizeGB: 50
+    image: fedora-43.qcow2
+  networkInterfaces:
+    - ip: {{ .ip }}/24
+      gateway: 10.0.0.1
+      bridge: br0
+`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	docs, err := LoadAllWithValues(context.Background(), path, Values{"name": "web-2", "ip": "10.0.0.5"})
+	if err != nil {
+		t.Fatalf("LoadAllWithValues() error = %v", err)
+	}
+	if len(docs) != 1 || docs[0].Err != nil {
+		t.Fatalf("LoadAllWithValues() = %+v", docs)
+	}
+	if vm := docs[0].VM; vm.Name != "web-2" || vm.Spec.NetworkInterfaces[0].IP != "10.0.0.5/24" {
+		t.Errorf("VM = %s %s, want web-2 10.0.0.5/24", vm.Name, vm.Spec.NetworkInterfaces[0].IP)
+	}
+
+	// A missing value fails the file's document
+	docs, err = LoadAllWithValues(context.Background(), path, Values{"name": "web-2"})
+	if err != nil {
+		t.Fatalf("LoadAllWithValues() error = %v", err)
+	}
+	if len(docs) != 1 || docs[0].Err == nil || !strings.Contains(docs[0].Err.Error(), `"ip"`) {
+		t.Errorf("LoadAllWithValues() = %+v, want a missing ip error", docs)
+	}
+}
@@ -0,0 +1,85 @@
+// Package logging sets up foundry's structured logging (log/slog) and passes
+// loggers to library code through contexts.
+//
+// Library functions do not write to a global logger: they log to the logger
+// of the context they are given, which callers set with NewContext:
+//
+//	logger, err := logging.New(os.Stderr, "debug", "json")
+//	ctx = logging.NewContext(ctx, logger)
+//	vm.Create(ctx, config)
+//
+// Code handed no logger (e.g., tests) logs to slog.Default().
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Formats accepted by New.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ParseLevel parses a log level name: debug, info, warn (or warning) or
+// error, in any case.
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("invalid log level %q (must be debug, info, warn or error)", name)
+	}
+}
+
+// New returns a logger writing records of at least the named level to w, as
+// logfmt-style text or one JSON object per line.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(format) {
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q (must be %s or %s)", format, FormatText, FormatJSON)
+	}
+}
+
+// Discard returns a logger that drops every record.
+func Discard() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx carrying logger.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or slog.Default() if it
+// carries none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok && logger != nil {
+			return logger
+		}
+	}
+	return slog.Default()
+}
@@ -0,0 +1,93 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    slog.Level
+		wantErr bool
+	}{
+		{name: "debug", want: slog.LevelDebug},
+		{name: "INFO", want: slog.LevelInfo},
+		{name: "warn", want: slog.LevelWarn},
+		{name: "Warning", want: slog.LevelWarn},
+		{name: "error", want: slog.LevelError},
+		{name: "verbose", wantErr: true},
+		{name: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLevel(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLevel(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseLevel(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "json")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	logger.Debug("Hidden")
+	logger.Info("Creating volume", "vm", "web-1", "volume", "web-1_boot.qcow2")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("logged %d lines, want 1: %s", len(lines), buf.String())
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("record is not JSON: %v", err)
+	}
+	if record["level"] != "INFO" || record["msg"] != "Creating volume" || record["vm"] != "web-1" || record["volume"] != "web-1_boot.qcow2" {
+		t.Errorf("record = %v", record)
+	}
+}
+
+func TestNew_Text(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "warn", "text")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	logger.Info("Hidden")
+	logger.Warn("Failed to delete volume", "volume", "web-1_boot.qcow2")
+
+	out := buf.String()
+	if strings.Contains(out, "Hidden") || !strings.Contains(out, `level=WARN msg="Failed to delete volume" volume=web-1_boot.qcow2`) {
+		t.Errorf("output = %q", out)
+	}
+
+	if _, err := New(&buf, "info", "xml"); err == nil {
+		t.Error("New() with an unknown format expected error")
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if FromContext(context.Background()) != slog.Default() {
+		t.Error("FromContext() without a logger should return slog.Default()")
+	}
+
+	logger := Discard()
+	ctx := NewContext(context.Background(), logger)
+	if FromContext(ctx) != logger {
+		t.Error("FromContext() does not return the context's logger")
+	}
+}
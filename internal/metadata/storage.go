@@ -157,6 +157,25 @@ func (c *Client) Update(domain libvirt.Domain, vm *v1alpha1.VirtualMachine) erro
 	return c.Store(domain, vm)
 }
 
+// UpdateStatus rewrites the status stored for a domain. The stored VM is
+// loaded and passed to update, which changes its status; the spec and
+// generation are stored back unchanged, since a status change is not a
+// change to the VM.
+func (c *Client) UpdateStatus(domain libvirt.Domain, update func(vm *v1alpha1.VirtualMachine)) error {
+	vm, err := c.Load(domain)
+	if err != nil {
+		return err
+	}
+
+	generation := vm.Generation
+	spec := vm.Spec.DeepCopy()
+	update(vm)
+	vm.Generation = generation
+	vm.Spec = *spec
+
+	return c.Store(domain, vm)
+}
+
 // Delete removes Foundry metadata from a domain.
 // This is typically called during VM destruction cleanup.
 func (c *Client) Delete(domain libvirt.Domain) error {
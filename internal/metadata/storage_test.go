@@ -567,6 +567,56 @@ func TestUpdate_StoreError(t *testing.T) {
 	}
 }
 
+func TestUpdateStatus_KeepsSpecAndGeneration(t *testing.T) {
+	mock := &mockLibvirtClient{}
+	domain := libvirt.Domain{}
+	vm := newTestVM("test-vm")
+	vm.Generation = 3
+
+	client := NewClient(mock)
+	if err := client.Store(domain, vm); err != nil {
+		t.Fatalf("Store() failed: %v", err)
+	}
+	mock.getMetadataValue = mock.lastSetMetadata
+
+	err := client.UpdateStatus(domain, func(vm *v1alpha1.VirtualMachine) {
+		vm.Status.Phase = v1alpha1.VMPhaseStopped
+		vm.Status.ObservedGeneration = vm.Generation
+		vm.Generation = 99
+		vm.Spec.VCPUs = 99
+	})
+	if err != nil {
+		t.Fatalf("UpdateStatus() failed: %v", err)
+	}
+
+	mock.getMetadataValue = mock.lastSetMetadata
+	loaded, err := client.Load(domain)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if loaded.Status.Phase != v1alpha1.VMPhaseStopped || loaded.Status.ObservedGeneration != 3 {
+		t.Errorf("Status = %+v, want phase Stopped and observedGeneration 3", loaded.Status)
+	}
+	if loaded.Generation != 3 || loaded.Spec.VCPUs != 2 {
+		t.Errorf("generation = %d, vcpus = %d, want the stored 3 and 2", loaded.Generation, loaded.Spec.VCPUs)
+	}
+}
+
+func TestUpdateStatus_LoadError(t *testing.T) {
+	mock := &mockLibvirtClient{getMetadataError: errors.New("no metadata")}
+
+	called := false
+	err := NewClient(mock).UpdateStatus(libvirt.Domain{}, func(vm *v1alpha1.VirtualMachine) {
+		called = true
+	})
+	if err == nil {
+		t.Fatal("Expected error from UpdateStatus(), got nil")
+	}
+	if called || mock.setMetadataCalls != 0 {
+		t.Error("UpdateStatus() must not store anything when the VM cannot be loaded")
+	}
+}
+
 func TestDelete_Success(t *testing.T) {
 	mock := &mockLibvirtClient{}
 	domain := libvirt.Domain{}
@@ -0,0 +1,230 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/prometheus/client_golang/prometheus"
+
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/status"
+)
+
+// StatsClient defines the libvirt operations needed to collect VM metrics.
+// *libvirt.Libvirt satisfies it.
+type StatsClient interface {
+	ConnectGetAllDomainStats(Doms []libvirt.Domain, Stats uint32, Flags uint32) ([]libvirt.DomainStatsRecord, error)
+	metadata.LibvirtClient
+}
+
+// domainStats are the groups of domain statistics collected.
+const domainStats = libvirt.DomainStatsState | libvirt.DomainStatsCPUTotal | libvirt.DomainStatsBalloon |
+	libvirt.DomainStatsVCPU | libvirt.DomainStatsInterface | libvirt.DomainStatsBlock
+
+var (
+	libvirtUpDesc = prometheus.NewDesc("foundry_libvirt_up",
+		"Whether libvirt could be queried for VM statistics.", nil, nil)
+	phaseDesc = prometheus.NewDesc("foundry_vm_phase",
+		"The phase of the VM; 1 for its current phase.", []string{"vm", "phase"}, nil)
+	vcpusDesc = prometheus.NewDesc("foundry_vm_vcpus",
+		"vCPUs of the running VM.", []string{"vm"}, nil)
+	cpuDesc = prometheus.NewDesc("foundry_vm_cpu_seconds_total",
+		"CPU time used by the VM.", []string{"vm"}, nil)
+	memoryDesc = prometheus.NewDesc("foundry_vm_memory_bytes",
+		"Memory currently assigned to the VM by the balloon driver.", []string{"vm"}, nil)
+	memoryRSSDesc = prometheus.NewDesc("foundry_vm_memory_rss_bytes",
+		"Host memory used by the VM's process.", []string{"vm"}, nil)
+	diskReadBytesDesc = prometheus.NewDesc("foundry_vm_disk_read_bytes_total",
+		"Bytes read from the VM's disk.", []string{"vm", "device"}, nil)
+	diskWrittenBytesDesc = prometheus.NewDesc("foundry_vm_disk_written_bytes_total",
+		"Bytes written to the VM's disk.", []string{"vm", "device"}, nil)
+	diskReadsDesc = prometheus.NewDesc("foundry_vm_disk_reads_total",
+		"Read requests to the VM's disk.", []string{"vm", "device"}, nil)
+	diskWritesDesc = prometheus.NewDesc("foundry_vm_disk_writes_total",
+		"Write requests to the VM's disk.", []string{"vm", "device"}, nil)
+	netReceiveBytesDesc = prometheus.NewDesc("foundry_vm_network_receive_bytes_total",
+		"Bytes received on the VM's network interface.", []string{"vm", "interface"}, nil)
+	netTransmitBytesDesc = prometheus.NewDesc("foundry_vm_network_transmit_bytes_total",
+		"Bytes transmitted on the VM's network interface.", []string{"vm", "interface"}, nil)
+	netReceivePacketsDesc = prometheus.NewDesc("foundry_vm_network_receive_packets_total",
+		"Packets received on the VM's network interface.", []string{"vm", "interface"}, nil)
+	netTransmitPacketsDesc = prometheus.NewDesc("foundry_vm_network_transmit_packets_total",
+		"Packets transmitted on the VM's network interface.", []string{"vm", "interface"}, nil)
+	netReceiveErrorsDesc = prometheus.NewDesc("foundry_vm_network_receive_errors_total",
+		"Receive errors on the VM's network interface.", []string{"vm", "interface"}, nil)
+	netTransmitErrorsDesc = prometheus.NewDesc("foundry_vm_network_transmit_errors_total",
+		"Transmit errors on the VM's network interface.", []string{"vm", "interface"}, nil)
+)
+
+// deviceMetrics are the per disk or interface statistics collected, by the
+// field following "block.<n>." or "net.<n>.".
+var (
+	diskMetrics = map[string]*prometheus.Desc{
+		"rd.bytes": diskReadBytesDesc,
+		"wr.bytes": diskWrittenBytesDesc,
+		"rd.reqs":  diskReadsDesc,
+		"wr.reqs":  diskWritesDesc,
+	}
+	netMetrics = map[string]*prometheus.Desc{
+		"rx.bytes": netReceiveBytesDesc,
+		"tx.bytes": netTransmitBytesDesc,
+		"rx.pkts":  netReceivePacketsDesc,
+		"tx.pkts":  netTransmitPacketsDesc,
+		"rx.errs":  netReceiveErrorsDesc,
+		"tx.errs":  netTransmitErrorsDesc,
+	}
+)
+
+// DomainCollector collects the metrics of the foundry VMs from libvirt at
+// every scrape. Domains foundry does not manage are left out.
+type DomainCollector struct {
+	ctx     context.Context
+	connect func(ctx context.Context) (StatsClient, func(), error)
+}
+
+// NewDomainCollector returns a collector connecting to libvirt for every
+// scrape. ctx carries the logger and bounds the connections.
+func NewDomainCollector(ctx context.Context) *DomainCollector {
+	return &DomainCollector{ctx: ctx, connect: connectStats}
+}
+
+// connectStats connects to libvirt and returns the client and a function
+// closing the connection.
+func connectStats(ctx context.Context) (StatsClient, func(), error) {
+	client, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	return client.Libvirt(), func() {
+		if err := client.Close(); err != nil {
+			logging.FromContext(ctx).Warn("Failed to close libvirt connection", "error", err)
+		}
+	}, nil
+}
+
+// Describe implements prometheus.Collector.
+func (c *DomainCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{libvirtUpDesc, phaseDesc, vcpusDesc, cpuDesc, memoryDesc, memoryRSSDesc} {
+		ch <- desc
+	}
+	for _, desc := range diskMetrics {
+		ch <- desc
+	}
+	for _, desc := range netMetrics {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector. If libvirt cannot be queried,
+// only foundry_libvirt_up is reported, as 0.
+func (c *DomainCollector) Collect(ch chan<- prometheus.Metric) {
+	logger := logging.FromContext(c.ctx)
+
+	lv, closeClient, err := c.connect(c.ctx)
+	if err != nil {
+		logger.Warn("Failed to collect VM metrics", "error", err)
+		ch <- prometheus.MustNewConstMetric(libvirtUpDesc, prometheus.GaugeValue, 0)
+		return
+	}
+	defer closeClient()
+
+	if err := collectDomains(lv, ch); err != nil {
+		logger.Warn("Failed to collect VM metrics", "error", err)
+		ch <- prometheus.MustNewConstMetric(libvirtUpDesc, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(libvirtUpDesc, prometheus.GaugeValue, 1)
+}
+
+// collectDomains sends the metrics of every foundry VM to ch.
+func collectDomains(lv StatsClient, ch chan<- prometheus.Metric) error {
+	records, err := lv.ConnectGetAllDomainStats(nil, uint32(domainStats), 0)
+	if err != nil {
+		return fmt.Errorf("failed to get domain statistics: %w", err)
+	}
+
+	mc := metadata.NewClient(lv)
+	for _, record := range records {
+		if _, err := mc.Load(record.Dom); err != nil {
+			continue
+		}
+		collectDomain(record, ch)
+	}
+	return nil
+}
+
+// collectDomain sends the metrics of one VM to ch. A stopped VM only has a
+// phase.
+func collectDomain(record libvirt.DomainStatsRecord, ch chan<- prometheus.Metric) {
+	vm := record.Dom.Name
+	fields := make(map[string]libvirt.TypedParamValue, len(record.Params))
+	for _, p := range record.Params {
+		fields[p.Field] = p.Value
+	}
+	number := func(field string) (float64, bool) {
+		v, ok := fields[field]
+		if !ok {
+			return 0, false
+		}
+		return paramNumber(v)
+	}
+
+	if state, ok := number("state.state"); ok {
+		current := status.PhaseForDomainState(int32(state))
+		ch <- prometheus.MustNewConstMetric(phaseDesc, prometheus.GaugeValue, 1, vm, string(current))
+	}
+	if vcpus, ok := number("vcpu.current"); ok {
+		ch <- prometheus.MustNewConstMetric(vcpusDesc, prometheus.GaugeValue, vcpus, vm)
+	}
+	if ns, ok := number("cpu.time"); ok {
+		ch <- prometheus.MustNewConstMetric(cpuDesc, prometheus.CounterValue, ns/1e9, vm)
+	}
+	if kib, ok := number(libvirt.DomainStatsBalloonCurrent); ok {
+		ch <- prometheus.MustNewConstMetric(memoryDesc, prometheus.GaugeValue, kib*1024, vm)
+	}
+	if kib, ok := number("balloon.rss"); ok {
+		ch <- prometheus.MustNewConstMetric(memoryRSSDesc, prometheus.GaugeValue, kib*1024, vm)
+	}
+
+	collectDevices(vm, "block", diskMetrics, fields, number, ch)
+	collectDevices(vm, "net", netMetrics, fields, number, ch)
+}
+
+// collectDevices sends the metrics of the disks ("block") or network
+// interfaces ("net") of a VM to ch, labelled with the device name.
+func collectDevices(vm, prefix string, descs map[string]*prometheus.Desc, fields map[string]libvirt.TypedParamValue, number func(string) (float64, bool), ch chan<- prometheus.Metric) {
+	count, _ := number(prefix + ".count")
+	for i := 0; i < int(count); i++ {
+		field := prefix + "." + strconv.Itoa(i) + "."
+		name, ok := fields[field+"name"].I.(string)
+		if !ok || name == "" {
+			continue
+		}
+		for stat, desc := range descs {
+			if value, ok := number(field + stat); ok {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, vm, name)
+			}
+		}
+	}
+}
+
+// paramNumber returns the value of a numeric typed parameter.
+func paramNumber(v libvirt.TypedParamValue) (float64, bool) {
+	switch n := v.I.(type) {
+	case int32:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
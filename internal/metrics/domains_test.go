@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/jbweber/foundry/internal/metadata"
+)
+
+// fakeStats serves the statistics of a running foundry VM "web", a stopped
+// foundry VM "db" and a running domain "other" foundry does not manage.
+type fakeStats struct {
+	err error
+}
+
+func param(field string, value libvirt.TypedParamValue) libvirt.TypedParam {
+	return libvirt.TypedParam{Field: field, Value: value}
+}
+
+func (f *fakeStats) ConnectGetAllDomainStats(Doms []libvirt.Domain, Stats uint32, Flags uint32) ([]libvirt.DomainStatsRecord, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	ull := func(v uint64) libvirt.TypedParamValue { return *libvirt.NewTypedParamValueUllong(v) }
+	str := func(v string) libvirt.TypedParamValue { return *libvirt.NewTypedParamValueString(v) }
+	return []libvirt.DomainStatsRecord{
+		{Dom: libvirt.Domain{Name: "web"}, Params: []libvirt.TypedParam{
+			param("state.state", *libvirt.NewTypedParamValueInt(1)),
+			param("cpu.time", ull(90_500_000_000)),
+			param("vcpu.current", *libvirt.NewTypedParamValueUint(4)),
+			param("balloon.current", ull(4*1024*1024)),
+			param("balloon.rss", ull(1024*1024)),
+			param("block.count", *libvirt.NewTypedParamValueUint(2)),
+			param("block.0.name", str("vda")),
+			param("block.0.rd.bytes", ull(1000)),
+			param("block.0.wr.bytes", ull(2000)),
+			param("block.0.rd.reqs", ull(10)),
+			param("block.0.wr.reqs", ull(20)),
+			param("block.1.name", str("sda")),
+			param("block.1.rd.bytes", ull(500)),
+			param("net.count", *libvirt.NewTypedParamValueUint(1)),
+			param("net.0.name", str("vnet0")),
+			param("net.0.rx.bytes", ull(3000)),
+			param("net.0.tx.bytes", ull(4000)),
+		}},
+		{Dom: libvirt.Domain{Name: "db"}, Params: []libvirt.TypedParam{
+			param("state.state", *libvirt.NewTypedParamValueInt(5)),
+		}},
+		{Dom: libvirt.Domain{Name: "other"}, Params: []libvirt.TypedParam{
+			param("state.state", *libvirt.NewTypedParamValueInt(1)),
+			param("cpu.time", ull(1)),
+		}},
+	}, nil
+}
+
+func (f *fakeStats) DomainGetMetadata(Dom libvirt.Domain, Type int32, URI libvirt.OptString, Flags libvirt.DomainModificationImpact) (string, error) {
+	if Dom.Name == "other" {
+		return "", fmt.Errorf("metadata not found")
+	}
+	return fmt.Sprintf("<metadata xmlns=%q>metadata:\n  name: %s\n</metadata>", metadata.MetadataNamespace, Dom.Name), nil
+}
+
+func (f *fakeStats) DomainSetMetadata(Dom libvirt.Domain, Type int32, Metadata libvirt.OptString, Key libvirt.OptString, URI libvirt.OptString, Flags libvirt.DomainModificationImpact) error {
+	return fmt.Errorf("read-only")
+}
+
+// newFakeCollector returns a collector served by lv, or failing to connect
+// if lv is nil.
+func newFakeCollector(lv StatsClient) *DomainCollector {
+	return &DomainCollector{ctx: context.Background(), connect: func(ctx context.Context) (StatsClient, func(), error) {
+		if lv == nil {
+			return nil, nil, fmt.Errorf("connection refused")
+		}
+		return lv, func() {}, nil
+	}}
+}
+
+func TestDomainCollector(t *testing.T) {
+	want := `
+# HELP foundry_libvirt_up Whether libvirt could be queried for VM statistics.
+# TYPE foundry_libvirt_up gauge
+foundry_libvirt_up 1
+# HELP foundry_vm_cpu_seconds_total CPU time used by the VM.
+# TYPE foundry_vm_cpu_seconds_total counter
+foundry_vm_cpu_seconds_total{vm="web"} 90.5
+# HELP foundry_vm_disk_read_bytes_total Bytes read from the VM's disk.
+# TYPE foundry_vm_disk_read_bytes_total counter
+foundry_vm_disk_read_bytes_total{device="sda",vm="web"} 500
+foundry_vm_disk_read_bytes_total{device="vda",vm="web"} 1000
+# HELP foundry_vm_disk_writes_total Write requests to the VM's disk.
+# TYPE foundry_vm_disk_writes_total counter
+foundry_vm_disk_writes_total{device="vda",vm="web"} 20
+# HELP foundry_vm_memory_bytes Memory currently assigned to the VM by the balloon driver.
+# TYPE foundry_vm_memory_bytes gauge
+foundry_vm_memory_bytes{vm="web"} 4.294967296e+09
+# HELP foundry_vm_network_transmit_bytes_total Bytes transmitted on the VM's network interface.
+# TYPE foundry_vm_network_transmit_bytes_total counter
+foundry_vm_network_transmit_bytes_total{interface="vnet0",vm="web"} 4000
+# HELP foundry_vm_phase The phase of the VM; 1 for its current phase.
+# TYPE foundry_vm_phase gauge
+foundry_vm_phase{phase="Running",vm="web"} 1
+foundry_vm_phase{phase="Stopped",vm="db"} 1
+# HELP foundry_vm_vcpus vCPUs of the running VM.
+# TYPE foundry_vm_vcpus gauge
+foundry_vm_vcpus{vm="web"} 4
+`
+	err := testutil.CollectAndCompare(newFakeCollector(&fakeStats{}), strings.NewReader(want),
+		"foundry_libvirt_up", "foundry_vm_cpu_seconds_total", "foundry_vm_disk_read_bytes_total",
+		"foundry_vm_disk_writes_total", "foundry_vm_memory_bytes", "foundry_vm_network_transmit_bytes_total",
+		"foundry_vm_phase", "foundry_vm_vcpus")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDomainCollector_LibvirtDown(t *testing.T) {
+	for name, c := range map[string]*DomainCollector{
+		"connect": newFakeCollector(nil),
+		"stats":   newFakeCollector(&fakeStats{err: fmt.Errorf("connection lost")}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			want := `
+# HELP foundry_libvirt_up Whether libvirt could be queried for VM statistics.
+# TYPE foundry_libvirt_up gauge
+foundry_libvirt_up 0
+`
+			if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestNewRegistry(t *testing.T) {
+	gather := func(t *testing.T, reg *prometheus.Registry) map[string]bool {
+		t.Helper()
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("Gather() error = %v", err)
+		}
+		names := make(map[string]bool)
+		for _, f := range families {
+			names[f.GetName()] = true
+		}
+		return names
+	}
+
+	names := gather(t, NewDaemonRegistry(newFakeCollector(&fakeStats{})))
+	for _, name := range []string{"foundry_vm_creates_total", "foundry_vm_create_failures_total", "foundry_vm_cleanup_attempts_total", "foundry_vm_phase", "go_goroutines"} {
+		if !names[name] {
+			t.Errorf("daemon metric %s not registered", name)
+		}
+	}
+
+	// The exporter creates no VMs, so it serves no counters of creations
+	names = gather(t, NewRegistry(nil))
+	for _, name := range []string{"foundry_vm_creates_total", "foundry_vm_phase"} {
+		if names[name] {
+			t.Errorf("NewRegistry(nil) serves %s", name)
+		}
+	}
+	if !names["go_goroutines"] {
+		t.Error("NewRegistry(nil) does not serve the Go runtime metrics")
+	}
+}
@@ -0,0 +1,63 @@
+// Package metrics exposes foundry's metrics in the Prometheus format for
+// 'foundry serve' and 'foundry exporter': counters of the VM creations done
+// by the process and, read from libvirt at every scrape, the CPU, memory,
+// disk and network usage of each VM.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Counters of the operations done by this process. They start at zero
+// whenever it starts; Prometheus handles the reset.
+var (
+	// VMCreates counts the VM creations attempted, including clones.
+	VMCreates = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "foundry_vm_creates_total",
+		Help: "VM creations attempted.",
+	})
+
+	// VMCreateFailures counts the VM creations that failed.
+	VMCreateFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "foundry_vm_create_failures_total",
+		Help: "VM creations that failed.",
+	})
+
+	// CleanupAttempts counts the attempts to remove what a failed or
+	// interrupted VM creation left behind.
+	CleanupAttempts = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "foundry_vm_cleanup_attempts_total",
+		Help: "Attempts to remove the resources of failed or interrupted VM creations.",
+	})
+)
+
+// NewRegistry returns a registry of the Go runtime and process metrics and,
+// if domains is not nil, the VM metrics it collects.
+func NewRegistry(domains prometheus.Collector) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if domains != nil {
+		reg.MustRegister(domains)
+	}
+	return reg
+}
+
+// NewDaemonRegistry returns NewRegistry(domains) with the counters added, for
+// a process that creates VMs for long enough to be scraped.
+func NewDaemonRegistry(domains prometheus.Collector) *prometheus.Registry {
+	reg := NewRegistry(domains)
+	reg.MustRegister(VMCreates, VMCreateFailures, CleanupAttempts)
+	return reg
+}
+
+// Handler serves the metrics of reg in the Prometheus text format.
+func Handler(reg *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
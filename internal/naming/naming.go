@@ -7,6 +7,8 @@
 package naming
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"fmt"
 	"net"
 	"strings"
@@ -74,6 +76,114 @@ func InterfaceNameFromIP(ip string) (string, error) {
 		ipv4[0], ipv4[1], ipv4[2], ipv4[3]), nil
 }
 
+// MACFromIPv6 calculates a deterministic MAC address from an IPv6 address,
+// for interfaces without an IPv4 address. An IPv6 address does not fit in a
+// MAC, so the last four octets are taken from its SHA-256 hash; the be:e6:
+// prefix keeps these apart from the be:ef: addresses derived by MACFromIP.
+//
+// Example: IP 2001:db8::10 → MAC be:e6:XX:XX:XX:XX
+func MACFromIPv6(ip string) (string, error) {
+	sum, err := ipv6Hash(ip)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("be:e6:%02x:%02x:%02x:%02x", sum[0], sum[1], sum[2], sum[3]), nil
+}
+
+// InterfaceNameFromIPv6 calculates a deterministic tap interface name from an
+// IPv6 address, using the same hash octets as MACFromIPv6.
+func InterfaceNameFromIPv6(ip string) (string, error) {
+	sum, err := ipv6Hash(ip)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("vm%02x%02x%02x%02x", sum[0], sum[1], sum[2], sum[3]), nil
+}
+
+// ipv6Hash returns the SHA-256 hash of an IPv6 address in its 16-byte form,
+// so different spellings of the same address hash alike.
+func ipv6Hash(ip string) ([sha256.Size]byte, error) {
+	// Parse IP (handles both "2001:db8::1" and "2001:db8::1/64")
+	ipStr := ip
+	if strings.Contains(ip, "/") {
+		ipAddr, _, err := net.ParseCIDR(ip)
+		if err != nil {
+			return [sha256.Size]byte{}, fmt.Errorf("invalid IP/CIDR: %w", err)
+		}
+		ipStr = ipAddr.String()
+	}
+
+	parsedIP := net.ParseIP(ipStr)
+	if parsedIP == nil {
+		return [sha256.Size]byte{}, fmt.Errorf("invalid IP address: %s", ipStr)
+	}
+	if parsedIP.To4() != nil {
+		return [sha256.Size]byte{}, fmt.Errorf("not an IPv6 address: %s", ipStr)
+	}
+
+	return sha256.Sum256(parsedIP.To16()), nil
+}
+
+// RandomMAC returns a random locally administered unicast MAC address for
+// interfaces without a static IP. The be:ee: prefix keeps it apart from the
+// be:ef: addresses derived from IPs by MACFromIP.
+//
+// Example: be:ee:3f:a1:07:c2
+func RandomMAC() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("be:ee:%02x:%02x:%02x:%02x", b[0], b[1], b[2], b[3])
+}
+
+// InterfaceNameFromMAC calculates a deterministic tap interface name from a
+// MAC address, using its last four octets like InterfaceNameFromIP.
+//
+// Example: MAC be:ee:3f:a1:07:c2 → vm3fa107c2
+func InterfaceNameFromMAC(mac string) (string, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return "", fmt.Errorf("invalid MAC address: %w", err)
+	}
+	if len(hw) != 6 {
+		return "", fmt.Errorf("not a 48-bit MAC address: %s", mac)
+	}
+	return fmt.Sprintf("vm%02x%02x%02x%02x", hw[2], hw[3], hw[4], hw[5]), nil
+}
+
+// InterfaceMAC returns the MAC address of a network interface: mac if set,
+// otherwise derived from its IPv4 address ip, or from its IPv6 address ipv6
+// for IPv6-only interfaces.
+func InterfaceMAC(ip, ipv6, mac string) (string, error) {
+	switch {
+	case mac != "":
+		hw, err := net.ParseMAC(mac)
+		if err != nil {
+			return "", fmt.Errorf("invalid MAC address: %w", err)
+		}
+		return hw.String(), nil
+	case ip == "" && ipv6 != "":
+		return MACFromIPv6(ipv6)
+	default:
+		return MACFromIP(ip)
+	}
+}
+
+// InterfaceName returns the tap interface name of a network interface:
+// derived from its IPv4 address ip if set, otherwise from mac, or from its
+// IPv6 address ipv6.
+func InterfaceName(ip, ipv6, mac string) (string, error) {
+	switch {
+	case ip != "":
+		return InterfaceNameFromIP(ip)
+	case mac != "":
+		return InterfaceNameFromMAC(mac)
+	case ipv6 != "":
+		return InterfaceNameFromIPv6(ipv6)
+	default:
+		return "", fmt.Errorf("interface has neither an IP nor a MAC address")
+	}
+}
+
 // VolumeNameBoot returns the volume name for a VM's boot disk.
 // Format: {vmName}_boot.qcow2
 func VolumeNameBoot(vmName string) string {
@@ -91,3 +201,48 @@ func VolumeNameData(vmName, device string) string {
 func VolumeNameCloudInit(vmName string) string {
 	return fmt.Sprintf("%s_cloudinit.iso", vmName)
 }
+
+// VMNameFromVolume returns the name of the VM a volume belongs to, from a
+// boot, data disk or cloud-init volume name. ok is false for volumes not
+// named after a VM.
+func VMNameFromVolume(volumeName string) (vmName string, ok bool) {
+	if name, found := strings.CutSuffix(volumeName, "_boot.qcow2"); found && name != "" {
+		return name, true
+	}
+	if name, found := strings.CutSuffix(volumeName, "_cloudinit.iso"); found && name != "" {
+		return name, true
+	}
+	if strings.HasSuffix(volumeName, ".qcow2") {
+		if i := strings.LastIndex(volumeName, "_data-"); i > 0 {
+			return volumeName[:i], true
+		}
+	}
+	return "", false
+}
+
+// generateNameAlphabet omits vowels and easily confused characters so that
+// generated suffixes never spell words, matching Kubernetes.
+const generateNameAlphabet = "bcdfghjklmnpqrstvwxz2456789"
+
+// GenerateNameSuffixLength is the number of random characters GenerateName
+// appends to the prefix.
+const GenerateNameSuffixLength = 5
+
+// MaxGeneratedNameLength bounds generated names; longer prefixes are
+// truncated so the random suffix always fits.
+const MaxGeneratedNameLength = 63
+
+// GenerateName returns prefix followed by a random suffix, in the style of
+// Kubernetes metadata.generateName (e.g., "web-" → "web-x7k2p").
+func GenerateName(prefix string) string {
+	if limit := MaxGeneratedNameLength - GenerateNameSuffixLength; len(prefix) > limit {
+		prefix = prefix[:limit]
+	}
+
+	b := make([]byte, GenerateNameSuffixLength)
+	_, _ = rand.Read(b)
+	for i := range b {
+		b[i] = generateNameAlphabet[int(b[i])%len(generateNameAlphabet)]
+	}
+	return prefix + string(b)
+}
@@ -1,6 +1,10 @@
 package naming
 
-import "testing"
+import (
+	"net"
+	"strings"
+	"testing"
+)
 
 func TestMACFromIP(t *testing.T) {
 	tests := []struct {
@@ -103,6 +107,115 @@ func TestInterfaceNameFromIP(t *testing.T) {
 	}
 }
 
+func TestRandomMAC(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		mac := RandomMAC()
+		hw, err := net.ParseMAC(mac)
+		if err != nil {
+			t.Fatalf("RandomMAC() = %q is not a valid MAC: %v", mac, err)
+		}
+		if !strings.HasPrefix(mac, "be:ee:") {
+			t.Errorf("RandomMAC() = %q, want be:ee: prefix", mac)
+		}
+		if hw[0]&0x01 != 0 || hw[0]&0x02 == 0 {
+			t.Errorf("RandomMAC() = %q, want a locally administered unicast address", mac)
+		}
+		seen[mac] = true
+	}
+	if len(seen) < 95 {
+		t.Errorf("RandomMAC() produced only %d distinct addresses in 100 calls", len(seen))
+	}
+}
+
+func TestMACFromIPv6(t *testing.T) {
+	mac, err := MACFromIPv6("2001:db8::10/64")
+	if err != nil {
+		t.Fatalf("MACFromIPv6() error = %v", err)
+	}
+	if mac != "be:e6:9b:26:2f:e9" {
+		t.Errorf("MACFromIPv6() = %q", mac)
+	}
+
+	// Different spellings of one address get the same MAC
+	if other, _ := MACFromIPv6("2001:0db8:0:0::0010"); other != mac {
+		t.Errorf("MACFromIPv6() = %q for the expanded form, want %q", other, mac)
+	}
+	if other, _ := MACFromIPv6("2001:db8::11"); other == mac {
+		t.Error("MACFromIPv6() returned the same MAC for different addresses")
+	}
+
+	for _, invalid := range []string{"10.0.0.1", "10.0.0.1/24", "not-an-ip", "2001:db8::/129"} {
+		if _, err := MACFromIPv6(invalid); err == nil {
+			t.Errorf("MACFromIPv6(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestInterfaceNameFromIPv6(t *testing.T) {
+	name, err := InterfaceNameFromIPv6("2001:db8::10")
+	if err != nil {
+		t.Fatalf("InterfaceNameFromIPv6() error = %v", err)
+	}
+	if name != "vm9b262fe9" {
+		t.Errorf("InterfaceNameFromIPv6() = %q", name)
+	}
+	if _, err := InterfaceNameFromIPv6("10.0.0.1"); err == nil {
+		t.Error("InterfaceNameFromIPv6() accepted an IPv4 address")
+	}
+}
+
+func TestInterfaceName(t *testing.T) {
+	tests := []struct {
+		name    string
+		ip      string
+		ipv6    string
+		mac     string
+		want    string
+		wantErr bool
+	}{
+		{name: "static IP", ip: "10.20.30.40/24", want: "vm0a141e28"},
+		{name: "dual-stack", ip: "10.20.30.40/24", ipv6: "2001:db8::10/64", want: "vm0a141e28"},
+		{name: "IPv6 only", ipv6: "2001:db8::10/64", want: "vm9b262fe9"},
+		{name: "IPv6 only with MAC", ipv6: "2001:db8::10/64", mac: "be:ee:3f:a1:07:c2", want: "vm3fa107c2"},
+		{name: "static IP with MAC override", ip: "10.20.30.40/24", mac: "52:54:00:12:34:56", want: "vm0a141e28"},
+		{name: "DHCP", mac: "be:ee:3f:a1:07:c2", want: "vm3fa107c2"},
+		{name: "DHCP uppercase MAC", mac: "BE:EE:3F:A1:07:C2", want: "vm3fa107c2"},
+		{name: "neither", wantErr: true},
+		{name: "invalid MAC", mac: "not-a-mac", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := InterfaceName(tt.ip, tt.ipv6, tt.mac)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InterfaceName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("InterfaceName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterfaceMAC(t *testing.T) {
+	if got, _ := InterfaceMAC("10.55.22.22/24", "", ""); got != "be:ef:0a:37:16:16" {
+		t.Errorf("InterfaceMAC() derived = %q", got)
+	}
+	if got, _ := InterfaceMAC("10.55.22.22/24", "2001:db8::10/64", ""); got != "be:ef:0a:37:16:16" {
+		t.Errorf("InterfaceMAC() dual-stack = %q, want derived from IPv4", got)
+	}
+	if got, _ := InterfaceMAC("", "2001:db8::10/64", ""); got != "be:e6:9b:26:2f:e9" {
+		t.Errorf("InterfaceMAC() IPv6 only = %q", got)
+	}
+	if got, _ := InterfaceMAC("10.55.22.22/24", "", "BE:EE:00:11:22:33"); got != "be:ee:00:11:22:33" {
+		t.Errorf("InterfaceMAC() explicit = %q, want normalized lowercase", got)
+	}
+	if _, err := InterfaceMAC("", "", "zz"); err == nil {
+		t.Error("InterfaceMAC() with invalid MAC succeeded")
+	}
+}
+
 func TestVolumeNameBoot(t *testing.T) {
 	tests := []struct {
 		vmName string
@@ -142,6 +255,30 @@ func TestVolumeNameData(t *testing.T) {
 	}
 }
 
+func TestVMNameFromVolume(t *testing.T) {
+	tests := []struct {
+		volume string
+		want   string
+		wantOK bool
+	}{
+		{VolumeNameBoot("web-server"), "web-server", true},
+		{VolumeNameData("web-server", "vdb"), "web-server", true},
+		{VolumeNameData("db_data-1", "vdc"), "db_data-1", true},
+		{VolumeNameCloudInit("web-server"), "web-server", true},
+		{"fedora-43.qcow2", "", false},
+		{"_boot.qcow2", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.volume, func(t *testing.T) {
+			got, ok := VMNameFromVolume(tt.volume)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("VMNameFromVolume() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
 func TestVolumeNameCloudInit(t *testing.T) {
 	tests := []struct {
 		vmName string
@@ -160,3 +297,24 @@ func TestVolumeNameCloudInit(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateName(t *testing.T) {
+	name := GenerateName("web-")
+	if !strings.HasPrefix(name, "web-") || len(name) != len("web-")+GenerateNameSuffixLength {
+		t.Errorf("GenerateName(\"web-\") = %q", name)
+	}
+	for _, c := range strings.TrimPrefix(name, "web-") {
+		if !strings.ContainsRune(generateNameAlphabet, c) {
+			t.Errorf("suffix of %q contains %q", name, c)
+		}
+	}
+
+	if GenerateName("ci-") == GenerateName("ci-") {
+		t.Error("GenerateName returned the same name twice")
+	}
+
+	long := GenerateName(strings.Repeat("a", 100))
+	if len(long) != MaxGeneratedNameLength {
+		t.Errorf("len(GenerateName(long prefix)) = %d, want %d", len(long), MaxGeneratedNameLength)
+	}
+}
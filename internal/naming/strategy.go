@@ -0,0 +1,196 @@
+package naming
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// MACStrategy selects how MAC addresses are derived for interfaces that do
+// not configure one.
+type MACStrategy string
+
+const (
+	// MACStrategyIPDerived derives the MAC from the interface's IP address
+	// (see MACFromIP and MACFromIPv6) each time it is needed, and gives DHCP
+	// interfaces a random one recorded in the spec. This is the default,
+	// and the scheme homestead-managed hosts expect.
+	MACStrategyIPDerived MACStrategy = "ip-derived"
+
+	// MACStrategyRandomPersisted gives every interface a random MAC (see
+	// RandomMAC), recorded in the spec when the interface is created.
+	MACStrategyRandomPersisted MACStrategy = "random-persisted"
+
+	// MACStrategyOUIPrefixed gives every interface a MAC under a configured
+	// OUI, recorded in the spec when the interface is created (see
+	// MACWithOUI).
+	MACStrategyOUIPrefixed MACStrategy = "oui-prefixed"
+)
+
+// InterfaceNameStrategy selects how tap interface names are derived.
+type InterfaceNameStrategy string
+
+const (
+	// InterfaceNameStrategyIPDerived derives the name from the interface's
+	// IPv4 address, falling back to its MAC and IPv6 address (see
+	// InterfaceName). This is the default.
+	InterfaceNameStrategyIPDerived InterfaceNameStrategy = "ip-derived"
+
+	// InterfaceNameStrategyMACDerived derives the name from the interface's
+	// MAC address (see InterfaceNameFromMAC), so that names follow MACs
+	// generated by the other MAC strategies.
+	InterfaceNameStrategyMACDerived InterfaceNameStrategy = "mac-derived"
+)
+
+// Strategy configures how MAC addresses and interface names are derived.
+// The zero value is the ip-derived default for both.
+type Strategy struct {
+	// MAC is the MAC address strategy.
+	MAC MACStrategy `json:"mac,omitempty" yaml:"mac,omitempty"`
+
+	// OUI is the three-octet prefix of MACs generated by the oui-prefixed
+	// strategy, e.g. "52:54:00".
+	OUI string `json:"oui,omitempty" yaml:"oui,omitempty"`
+
+	// InterfaceName is the interface name strategy.
+	InterfaceName InterfaceNameStrategy `json:"interfaceName,omitempty" yaml:"interfaceName,omitempty"`
+}
+
+// defaultStrategy is the strategy for VMs that don't record their own.
+var defaultStrategy Strategy
+
+// SetDefaultStrategy sets the strategy recorded on VMs created from now on
+// (e.g., from the CLI config). VMs keep the strategy they were created with.
+func SetDefaultStrategy(s Strategy) {
+	defaultStrategy = s
+}
+
+// DefaultStrategy returns the strategy set by SetDefaultStrategy, with the
+// ip-derived defaults filled in.
+func DefaultStrategy() Strategy {
+	return defaultStrategy.WithDefaults()
+}
+
+// WithDefaults returns the strategy with the ip-derived defaults filled in.
+func (s Strategy) WithDefaults() Strategy {
+	if s.MAC == "" {
+		s.MAC = MACStrategyIPDerived
+	}
+	if s.InterfaceName == "" {
+		s.InterfaceName = InterfaceNameStrategyIPDerived
+	}
+	return s
+}
+
+// Validate checks that the strategies are known and that the OUI is set
+// exactly when the oui-prefixed strategy needs it.
+func (s Strategy) Validate() error {
+	switch s.MAC {
+	case "", MACStrategyIPDerived, MACStrategyRandomPersisted:
+		if s.OUI != "" {
+			return fmt.Errorf("naming.oui is only used by the %s MAC strategy", MACStrategyOUIPrefixed)
+		}
+	case MACStrategyOUIPrefixed:
+		if _, err := parseOUI(s.OUI); err != nil {
+			return fmt.Errorf("naming.oui: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown MAC strategy %q (want %s, %s or %s)",
+			s.MAC, MACStrategyIPDerived, MACStrategyRandomPersisted, MACStrategyOUIPrefixed)
+	}
+
+	switch s.InterfaceName {
+	case "", InterfaceNameStrategyIPDerived, InterfaceNameStrategyMACDerived:
+	default:
+		return fmt.Errorf("unknown interface name strategy %q (want %s or %s)",
+			s.InterfaceName, InterfaceNameStrategyIPDerived, InterfaceNameStrategyMACDerived)
+	}
+	return nil
+}
+
+// GenerateMAC returns the MAC address to record for a new interface that
+// does not configure one, or "" if the strategy derives it from the IP
+// address whenever it is needed. dhcp reports whether the interface gets
+// its IPv4 address by DHCP.
+func (s Strategy) GenerateMAC(ip, ipv6 string, dhcp bool) (string, error) {
+	switch s.MAC {
+	case MACStrategyRandomPersisted:
+		return RandomMAC(), nil
+	case MACStrategyOUIPrefixed:
+		if dhcp {
+			ip = ""
+		}
+		return MACWithOUI(s.OUI, ip, ipv6)
+	default:
+		if dhcp {
+			return RandomMAC(), nil
+		}
+		return "", nil
+	}
+}
+
+// MACWithOUI returns a MAC address under oui (e.g. "52:54:00") whose last
+// three octets are those of the IPv4 address ip, else taken from the hash
+// of the IPv6 address ipv6 like MACFromIPv6, else random.
+//
+// Example: OUI 52:54:00, IP 10.55.22.22 → MAC 52:54:00:37:16:16
+func MACWithOUI(oui, ip, ipv6 string) (string, error) {
+	prefix, err := parseOUI(oui)
+	if err != nil {
+		return "", err
+	}
+
+	var suffix [3]byte
+	switch {
+	case ip != "":
+		ipMAC, err := MACFromIP(ip)
+		if err != nil {
+			return "", err
+		}
+		hw, _ := net.ParseMAC(ipMAC)
+		copy(suffix[:], hw[3:])
+	case ipv6 != "":
+		sum, err := ipv6Hash(ipv6)
+		if err != nil {
+			return "", err
+		}
+		copy(suffix[:], sum[:3])
+	default:
+		_, _ = rand.Read(suffix[:])
+	}
+	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x",
+		prefix[0], prefix[1], prefix[2], suffix[0], suffix[1], suffix[2]), nil
+}
+
+// parseOUI parses a three-octet OUI such as "52:54:00". Multicast OUIs are
+// rejected, as interfaces need unicast addresses.
+func parseOUI(oui string) ([3]byte, error) {
+	var prefix [3]byte
+	if oui == "" {
+		return prefix, fmt.Errorf("OUI is required by the %s MAC strategy", MACStrategyOUIPrefixed)
+	}
+	hw, err := net.ParseMAC(strings.TrimSuffix(oui, ":") + ":00:00:00")
+	if err != nil || len(hw) != 6 {
+		return prefix, fmt.Errorf("invalid OUI %q (want three octets, e.g. 52:54:00)", oui)
+	}
+	if hw[0]&0x01 != 0 {
+		return prefix, fmt.Errorf("OUI %q is a multicast prefix", oui)
+	}
+	copy(prefix[:], hw[:3])
+	return prefix, nil
+}
+
+// InterfaceNameWithStrategy returns the tap interface name of a network
+// interface under strategy; an empty strategy is ip-derived. mac is the
+// interface's configured or generated MAC address, if any.
+func InterfaceNameWithStrategy(strategy InterfaceNameStrategy, ip, ipv6, mac string) (string, error) {
+	if strategy != InterfaceNameStrategyMACDerived {
+		return InterfaceName(ip, ipv6, mac)
+	}
+	mac, err := InterfaceMAC(ip, ipv6, mac)
+	if err != nil {
+		return "", err
+	}
+	return InterfaceNameFromMAC(mac)
+}
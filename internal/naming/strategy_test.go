@@ -0,0 +1,107 @@
+package naming
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStrategy_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy Strategy
+		wantErr  string
+	}{
+		{name: "zero value"},
+		{name: "random", strategy: Strategy{MAC: MACStrategyRandomPersisted, InterfaceName: InterfaceNameStrategyMACDerived}},
+		{name: "oui", strategy: Strategy{MAC: MACStrategyOUIPrefixed, OUI: "52:54:00"}},
+		{name: "oui missing", strategy: Strategy{MAC: MACStrategyOUIPrefixed}, wantErr: "OUI is required"},
+		{name: "oui invalid", strategy: Strategy{MAC: MACStrategyOUIPrefixed, OUI: "52:54"}, wantErr: "invalid OUI"},
+		{name: "oui multicast", strategy: Strategy{MAC: MACStrategyOUIPrefixed, OUI: "01:00:5e"}, wantErr: "multicast"},
+		{name: "oui without strategy", strategy: Strategy{OUI: "52:54:00"}, wantErr: "only used by"},
+		{name: "unknown MAC strategy", strategy: Strategy{MAC: "sequential"}, wantErr: "unknown MAC strategy"},
+		{name: "unknown name strategy", strategy: Strategy{InterfaceName: "random"}, wantErr: "unknown interface name strategy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.strategy.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStrategy_GenerateMAC(t *testing.T) {
+	ipDerived := Strategy{}.WithDefaults()
+	if mac, _ := ipDerived.GenerateMAC("10.55.22.22/24", "", false); mac != "" {
+		t.Errorf("ip-derived static GenerateMAC() = %q, want derived on demand", mac)
+	}
+	if mac, _ := ipDerived.GenerateMAC("", "", true); !strings.HasPrefix(mac, "be:ee:") {
+		t.Errorf("ip-derived DHCP GenerateMAC() = %q, want random", mac)
+	}
+
+	random := Strategy{MAC: MACStrategyRandomPersisted}
+	if mac, _ := random.GenerateMAC("10.55.22.22/24", "", false); !strings.HasPrefix(mac, "be:ee:") {
+		t.Errorf("random-persisted GenerateMAC() = %q, want random", mac)
+	}
+
+	oui := Strategy{MAC: MACStrategyOUIPrefixed, OUI: "52:54:00"}
+	tests := []struct {
+		name string
+		ip   string
+		ipv6 string
+		dhcp bool
+		want string
+	}{
+		{name: "IPv4", ip: "10.55.22.22/24", want: "52:54:00:37:16:16"},
+		{name: "IPv6 only", ipv6: "2001:db8::10/64", want: "52:54:00:9b:26:2f"},
+		{name: "DHCP with IPv6", ipv6: "2001:db8::10/64", dhcp: true, want: "52:54:00:9b:26:2f"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mac, err := oui.GenerateMAC(tt.ip, tt.ipv6, tt.dhcp)
+			if err != nil {
+				t.Fatalf("GenerateMAC() error = %v", err)
+			}
+			if mac != tt.want {
+				t.Errorf("GenerateMAC() = %q, want %q", mac, tt.want)
+			}
+		})
+	}
+	if mac, _ := oui.GenerateMAC("", "", true); !strings.HasPrefix(mac, "52:54:00:") || len(mac) != 17 {
+		t.Errorf("oui-prefixed DHCP GenerateMAC() = %q, want random under the OUI", mac)
+	}
+}
+
+func TestInterfaceNameWithStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy InterfaceNameStrategy
+		ip       string
+		mac      string
+		want     string
+	}{
+		{name: "default", ip: "10.20.30.40/24", mac: "52:54:00:12:34:56", want: "vm0a141e28"},
+		{name: "ip-derived", strategy: InterfaceNameStrategyIPDerived, ip: "10.20.30.40/24", mac: "52:54:00:12:34:56", want: "vm0a141e28"},
+		{name: "mac-derived", strategy: InterfaceNameStrategyMACDerived, ip: "10.20.30.40/24", mac: "52:54:00:12:34:56", want: "vm00123456"},
+		{name: "mac-derived from IP", strategy: InterfaceNameStrategyMACDerived, ip: "10.20.30.40/24", want: "vm0a141e28"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := InterfaceNameWithStrategy(tt.strategy, tt.ip, "", tt.mac)
+			if err != nil {
+				t.Fatalf("InterfaceNameWithStrategy() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("InterfaceNameWithStrategy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,11 @@
 // Package output provides formatters for displaying Foundry resources
-// in various formats (table, YAML, JSON).
+// in various formats (table, wide table, YAML, JSON, JSONPath and Go
+// templates).
 package output
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/jbweber/foundry/api/v1alpha1"
 )
@@ -14,10 +16,16 @@ type Format string
 const (
 	// FormatTable is a human-readable table format.
 	FormatTable Format = "table"
+	// FormatWide is a table with additional columns.
+	FormatWide Format = "wide"
 	// FormatYAML is a YAML format for declarative configs.
 	FormatYAML Format = "yaml"
 	// FormatJSON is a JSON format for machine consumption.
 	FormatJSON Format = "json"
+	// FormatJSONPath renders a JSONPath template (-o jsonpath=TEMPLATE).
+	FormatJSONPath Format = "jsonpath"
+	// FormatGoTemplate renders a Go template (-o go-template=TEMPLATE).
+	FormatGoTemplate Format = "go-template"
 )
 
 // Formatter formats Foundry resources for output.
@@ -35,6 +43,8 @@ type Options struct {
 	Format Format
 	// NoHeaders omits headers in table format.
 	NoHeaders bool
+	// Template is the template for the jsonpath and go-template formats.
+	Template string
 }
 
 // NewFormatter creates a new Formatter based on the specified format.
@@ -42,22 +52,51 @@ func NewFormatter(opts Options) (Formatter, error) {
 	switch opts.Format {
 	case FormatTable:
 		return &TableFormatter{NoHeaders: opts.NoHeaders}, nil
+	case FormatWide:
+		return &TableFormatter{NoHeaders: opts.NoHeaders, Wide: true}, nil
 	case FormatYAML:
 		return &YAMLFormatter{}, nil
 	case FormatJSON:
 		return &JSONFormatter{}, nil
+	case FormatJSONPath:
+		return NewJSONPathFormatter(opts.Template)
+	case FormatGoTemplate:
+		return NewGoTemplateFormatter(opts.Template)
 	default:
-		return nil, fmt.Errorf("unsupported output format: %s (supported: table, yaml, json)", opts.Format)
+		return nil, fmt.Errorf("unsupported output format: %s (supported: table, wide, yaml, json, jsonpath, go-template)", opts.Format)
 	}
 }
 
-// ValidateFormat checks if a format string is valid.
-func ValidateFormat(format string) error {
-	f := Format(format)
+// ParseFormat splits an --output value into its format and template.
+// Template formats take the template after '=', e.g.
+// "jsonpath={.status.phase}" or "go-template={{.status.phase}}".
+func ParseFormat(value string) (Format, string, error) {
+	name, tmpl, hasTemplate := strings.Cut(value, "=")
+	f := Format(name)
+
 	switch f {
-	case FormatTable, FormatYAML, FormatJSON:
-		return nil
+	case FormatTable, FormatWide, FormatYAML, FormatJSON:
+		if hasTemplate {
+			return "", "", fmt.Errorf("invalid format: %s (%s does not take a template)", value, name)
+		}
+		return f, "", nil
+	case FormatJSONPath, FormatGoTemplate:
+		if !hasTemplate || tmpl == "" {
+			return "", "", fmt.Errorf("invalid format: %s (use %s=TEMPLATE)", value, name)
+		}
+		return f, tmpl, nil
 	default:
-		return fmt.Errorf("invalid format: %s (valid formats: table, yaml, json)", format)
+		return "", "", fmt.Errorf("invalid format: %s (valid formats: table, wide, yaml, json, jsonpath=TEMPLATE, go-template=TEMPLATE)", value)
+	}
+}
+
+// ValidateFormat checks if a format string is valid, including that any
+// template parses.
+func ValidateFormat(format string) error {
+	f, tmpl, err := ParseFormat(format)
+	if err != nil {
+		return err
 	}
+	_, err = NewFormatter(Options{Format: f, Template: tmpl})
+	return err
 }
@@ -161,6 +161,34 @@ func TestTableFormatter_FormatVMList(t *testing.T) {
 	}
 }
 
+func TestTableFormatter_Wide(t *testing.T) {
+	vm := createTestVM("vm1", v1alpha1.VMPhaseRunning, "10.0.0.1")
+	vm.Spec.BootDisk.Image = "fedora-43.qcow2"
+	vm.Spec.NetworkInterfaces = []v1alpha1.NetworkInterfaceSpec{
+		{Bridge: "br0"},
+		{Network: "default"},
+	}
+	vm.Annotations = map[string]string{v1alpha1.AnnotationOwner: "jane"}
+
+	narrow, err := (&TableFormatter{}).FormatVMList([]*v1alpha1.VirtualMachine{vm})
+	if err != nil {
+		t.Fatalf("FormatVMList() error = %v", err)
+	}
+	if strings.Contains(narrow, "IMAGE") || strings.Contains(narrow, "fedora-43.qcow2") {
+		t.Errorf("table output has wide columns:\n%s", narrow)
+	}
+
+	wide, err := (&TableFormatter{Wide: true}).FormatVMList([]*v1alpha1.VirtualMachine{vm})
+	if err != nil {
+		t.Fatalf("FormatVMList() error = %v", err)
+	}
+	for _, want := range []string{"IMAGE", "CPU MODE", "NETWORKS", "AUTOSTART", "OWNER", "fedora-43.qcow2", "host-model", "br0,network:default", "true", "jane"} {
+		if !strings.Contains(wide, want) {
+			t.Errorf("wide output missing %q:\n%s", want, wide)
+		}
+	}
+}
+
 func TestYAMLFormatter_FormatVM(t *testing.T) {
 	vm := createTestVM("test-vm", v1alpha1.VMPhaseRunning, "10.0.0.1")
 
@@ -344,6 +372,10 @@ func TestNewFormatter(t *testing.T) {
 			name: "table format",
 			opts: Options{Format: FormatTable},
 		},
+		{
+			name: "wide format",
+			opts: Options{Format: FormatWide},
+		},
 		{
 			name: "yaml format",
 			opts: Options{Format: FormatYAML},
@@ -441,3 +473,81 @@ func TestFormatAge(t *testing.T) {
 		})
 	}
 }
+
+func TestGoTemplateFormatter(t *testing.T) {
+	f, err := NewGoTemplateFormatter(`{{.metadata.name}} {{(index .status.addresses 0).address}}`)
+	if err != nil {
+		t.Fatalf("NewGoTemplateFormatter() error = %v", err)
+	}
+
+	got, err := f.FormatVM(createTestVM("web-1", v1alpha1.VMPhaseRunning, "10.0.0.5"))
+	if err != nil {
+		t.Fatalf("FormatVM() error = %v", err)
+	}
+	if got != "web-1 10.0.0.5" {
+		t.Errorf("FormatVM() = %q, want %q", got, "web-1 10.0.0.5")
+	}
+
+	f, err = NewGoTemplateFormatter(`{{range .items}}{{.metadata.name}},{{end}}`)
+	if err != nil {
+		t.Fatalf("NewGoTemplateFormatter() error = %v", err)
+	}
+	got, err = f.FormatVMList([]*v1alpha1.VirtualMachine{
+		createTestVM("vm-1", v1alpha1.VMPhaseRunning, ""),
+		createTestVM("vm-2", v1alpha1.VMPhaseRunning, ""),
+	})
+	if err != nil {
+		t.Fatalf("FormatVMList() error = %v", err)
+	}
+	if got != "vm-1,vm-2," {
+		t.Errorf("FormatVMList() = %q, want %q", got, "vm-1,vm-2,")
+	}
+
+	if _, err := NewGoTemplateFormatter(`{{.metadata.name`); err == nil {
+		t.Error("expected error for invalid template")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		value        string
+		wantFormat   Format
+		wantTemplate string
+		wantErr      bool
+	}{
+		{value: "table", wantFormat: FormatTable},
+		{value: "wide", wantFormat: FormatWide},
+		{value: "json", wantFormat: FormatJSON},
+		{value: "jsonpath={.metadata.name}", wantFormat: FormatJSONPath, wantTemplate: "{.metadata.name}"},
+		{value: "go-template={{.metadata.name}}", wantFormat: FormatGoTemplate, wantTemplate: "{{.metadata.name}}"},
+		{value: "jsonpath={.a=b}", wantFormat: FormatJSONPath, wantTemplate: "{.a=b}"},
+		{value: "jsonpath", wantErr: true},
+		{value: "jsonpath=", wantErr: true},
+		{value: "yaml=x", wantErr: true},
+		{value: "xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			format, tmpl, err := ParseFormat(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if format != tt.wantFormat || tmpl != tt.wantTemplate {
+				t.Errorf("ParseFormat() = (%q, %q), want (%q, %q)", format, tmpl, tt.wantFormat, tt.wantTemplate)
+			}
+		})
+	}
+}
+
+func TestValidateFormat_Templates(t *testing.T) {
+	if err := ValidateFormat("jsonpath={.status.phase}"); err != nil {
+		t.Errorf("ValidateFormat() error = %v", err)
+	}
+	if err := ValidateFormat("jsonpath={.status.phase"); err == nil {
+		t.Error("expected error for unparseable jsonpath template")
+	}
+	if err := ValidateFormat("go-template={{.status.phase"); err == nil {
+		t.Error("expected error for unparseable go-template")
+	}
+}
@@ -0,0 +1,530 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPathTemplate is a parsed kubectl-style JSONPath template such as
+// "{.metadata.name}" or "{range .items[*]}{.metadata.name}{"\n"}{end}".
+//
+// Supported syntax:
+//   - Literal text outside braces, and string literals: {"\n"}
+//   - Paths from the current object (. or @) or the root ($): {.status.phase}
+//   - Fields, including quoted keys: .metadata.name, ['name']
+//   - Array indexes (negative counts from the end) and wildcards: [0], [-1], [*], .*
+//   - Filters comparing a field to a literal: [?(@.type=="InternalIP")], [?(@.gateway)]
+//   - Loops: {range .items[*]}...{end}
+//
+// Missing fields produce no output rather than an error, matching
+// kubectl get. Multiple results from one expression are joined with spaces.
+type jsonPathTemplate struct {
+	nodes []jsonPathNode
+}
+
+// jsonPathNode is one element of a parsed template.
+type jsonPathNode struct {
+	// text is literal output (for text and string literal nodes).
+	text string
+
+	// path is set for expression and range nodes.
+	path *jsonPath
+
+	// isRange marks a {range} node; body is rendered once per selected value.
+	isRange bool
+	body    []jsonPathNode
+}
+
+// jsonPath is a parsed path expression.
+type jsonPath struct {
+	// fromRoot is true for paths starting with $ (evaluated against the
+	// document root even inside a range).
+	fromRoot bool
+
+	segments []jsonPathSegment
+}
+
+// jsonPathSegmentKind identifies how a path segment selects values.
+type jsonPathSegmentKind int
+
+const (
+	segmentField jsonPathSegmentKind = iota
+	segmentIndex
+	segmentWildcard
+	segmentFilter
+)
+
+// jsonPathSegment is one step of a path.
+type jsonPathSegment struct {
+	kind  jsonPathSegmentKind
+	field string
+	index int
+
+	// Filter segments compare the value at filterPath with filterValue using
+	// filterOp ("==", "!=", or "" for an existence check).
+	filterPath  *jsonPath
+	filterOp    string
+	filterValue string
+}
+
+// parseJSONPath parses a JSONPath template.
+func parseJSONPath(template string) (*jsonPathTemplate, error) {
+	if strings.TrimSpace(template) == "" {
+		return nil, fmt.Errorf("jsonpath template is empty")
+	}
+
+	tokens, err := splitJSONPathTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, _, err := parseJSONPathNodes(tokens, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jsonPathTemplate{nodes: nodes}, nil
+}
+
+// jsonPathToken is literal text or the contents of a {...} action.
+type jsonPathToken struct {
+	text     string
+	isAction bool
+}
+
+// splitJSONPathTemplate splits a template into literal text and {...} actions.
+func splitJSONPathTemplate(template string) ([]jsonPathToken, error) {
+	var tokens []jsonPathToken
+	var text strings.Builder
+
+	for i := 0; i < len(template); i++ {
+		if template[i] != '{' {
+			text.WriteByte(template[i])
+			continue
+		}
+
+		end, err := findActionEnd(template, i+1)
+		if err != nil {
+			return nil, err
+		}
+		if text.Len() > 0 {
+			tokens = append(tokens, jsonPathToken{text: text.String()})
+			text.Reset()
+		}
+		tokens = append(tokens, jsonPathToken{text: strings.TrimSpace(template[i+1 : end]), isAction: true})
+		i = end
+	}
+
+	if text.Len() > 0 {
+		tokens = append(tokens, jsonPathToken{text: text.String()})
+	}
+	return tokens, nil
+}
+
+// findActionEnd returns the index of the '}' closing an action starting at
+// start, skipping braces inside quoted strings.
+func findActionEnd(template string, start int) (int, error) {
+	var quote byte
+	for i := start; i < len(template); i++ {
+		c := template[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '}':
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unclosed action in jsonpath template: %q", template[start-1:])
+}
+
+// parseJSONPathNodes parses tokens until the end of input or, inside a
+// range, until the matching {end}. It returns the tokens after {end}
+// (non-nil even if empty), or nil if the input ran out first.
+func parseJSONPathNodes(tokens []jsonPathToken, inRange bool) ([]jsonPathNode, []jsonPathToken, error) {
+	var nodes []jsonPathNode
+
+	for len(tokens) > 0 {
+		tok := tokens[0]
+		tokens = tokens[1:]
+
+		if !tok.isAction {
+			nodes = append(nodes, jsonPathNode{text: tok.text})
+			continue
+		}
+
+		switch {
+		case tok.text == "end":
+			if !inRange {
+				return nil, nil, fmt.Errorf("unexpected {end} in jsonpath template")
+			}
+			// A non-nil (possibly empty) remainder signals {end} was found
+			return nodes, append([]jsonPathToken{}, tokens...), nil
+
+		case strings.HasPrefix(tok.text, "range "):
+			path, err := parsePath(strings.TrimSpace(strings.TrimPrefix(tok.text, "range ")))
+			if err != nil {
+				return nil, nil, err
+			}
+			body, rest, err := parseJSONPathNodes(tokens, true)
+			if err != nil {
+				return nil, nil, err
+			}
+			if rest == nil {
+				return nil, nil, fmt.Errorf("{range} without matching {end} in jsonpath template")
+			}
+			nodes = append(nodes, jsonPathNode{path: path, isRange: true, body: body})
+			tokens = rest
+
+		case strings.HasPrefix(tok.text, `"`) || strings.HasPrefix(tok.text, "'"):
+			literal, err := unquoteLiteral(tok.text)
+			if err != nil {
+				return nil, nil, err
+			}
+			nodes = append(nodes, jsonPathNode{text: literal})
+
+		default:
+			path, err := parsePath(tok.text)
+			if err != nil {
+				return nil, nil, err
+			}
+			nodes = append(nodes, jsonPathNode{path: path})
+		}
+	}
+
+	return nodes, nil, nil
+}
+
+// unquoteLiteral decodes a single- or double-quoted string literal.
+func unquoteLiteral(s string) (string, error) {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		s = `"` + strings.ReplaceAll(s[1:len(s)-1], `"`, `\"`) + `"`
+	}
+	literal, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid string literal %s in jsonpath template", s)
+	}
+	return literal, nil
+}
+
+// parsePath parses a path expression such as ".status.addresses[0].address".
+func parsePath(expr string) (*jsonPath, error) {
+	path := &jsonPath{}
+	rest := expr
+
+	switch {
+	case strings.HasPrefix(rest, "$"):
+		path.fromRoot = true
+		rest = rest[1:]
+	case strings.HasPrefix(rest, "@"):
+		rest = rest[1:]
+	case !strings.HasPrefix(rest, ".") && !strings.HasPrefix(rest, "["):
+		return nil, fmt.Errorf("invalid jsonpath expression %q (must start with '.', '$' or '@')", expr)
+	}
+
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			if strings.HasPrefix(rest, ".") {
+				return nil, fmt.Errorf("recursive descent (..) is not supported in jsonpath expression %q", expr)
+			}
+			if rest == "" {
+				// A lone "." refers to the current object
+				return path, nil
+			}
+			if rest[0] == '*' {
+				path.segments = append(path.segments, jsonPathSegment{kind: segmentWildcard})
+				rest = rest[1:]
+				continue
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty field name in jsonpath expression %q", expr)
+			}
+			path.segments = append(path.segments, jsonPathSegment{kind: segmentField, field: rest[:end]})
+			rest = rest[end:]
+
+		case '[':
+			end, err := findBracketEnd(rest)
+			if err != nil {
+				return nil, fmt.Errorf("%w in jsonpath expression %q", err, expr)
+			}
+			seg, err := parseBracket(strings.TrimSpace(rest[1:end]))
+			if err != nil {
+				return nil, fmt.Errorf("%w in jsonpath expression %q", err, expr)
+			}
+			path.segments = append(path.segments, seg)
+			rest = rest[end+1:]
+
+		default:
+			return nil, fmt.Errorf("unexpected %q in jsonpath expression %q", rest[0], expr)
+		}
+	}
+
+	return path, nil
+}
+
+// findBracketEnd returns the index of the ']' closing the bracket at s[0],
+// skipping quoted strings and nested brackets.
+func findBracketEnd(s string) (int, error) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unclosed '['")
+}
+
+// parseBracket parses the contents of a [...] segment.
+func parseBracket(content string) (jsonPathSegment, error) {
+	switch {
+	case content == "*":
+		return jsonPathSegment{kind: segmentWildcard}, nil
+
+	case strings.HasPrefix(content, "?"):
+		return parseFilter(content)
+
+	case strings.HasPrefix(content, "'") || strings.HasPrefix(content, `"`):
+		field, err := unquoteLiteral(content)
+		if err != nil {
+			return jsonPathSegment{}, err
+		}
+		return jsonPathSegment{kind: segmentField, field: field}, nil
+
+	default:
+		index, err := strconv.Atoi(content)
+		if err != nil {
+			return jsonPathSegment{}, fmt.Errorf("unsupported index [%s] (use a number, *, 'key' or ?(filter))", content)
+		}
+		return jsonPathSegment{kind: segmentIndex, index: index}, nil
+	}
+}
+
+// parseFilter parses a filter such as ?(@.type=="InternalIP").
+func parseFilter(content string) (jsonPathSegment, error) {
+	inner := strings.TrimSpace(strings.TrimPrefix(content, "?"))
+	if !strings.HasPrefix(inner, "(") || !strings.HasSuffix(inner, ")") {
+		return jsonPathSegment{}, fmt.Errorf("invalid filter [%s] (expected ?(...))", content)
+	}
+	inner = strings.TrimSpace(inner[1 : len(inner)-1])
+
+	seg := jsonPathSegment{kind: segmentFilter}
+	left := inner
+	for _, op := range []string{"==", "!="} {
+		if idx := strings.Index(inner, op); idx >= 0 {
+			left = strings.TrimSpace(inner[:idx])
+			right := strings.TrimSpace(inner[idx+len(op):])
+			if strings.HasPrefix(right, `"`) || strings.HasPrefix(right, "'") {
+				value, err := unquoteLiteral(right)
+				if err != nil {
+					return jsonPathSegment{}, err
+				}
+				right = value
+			}
+			seg.filterOp = op
+			seg.filterValue = right
+			break
+		}
+	}
+
+	if !strings.HasPrefix(left, "@") {
+		return jsonPathSegment{}, fmt.Errorf("invalid filter [%s] (left side must start with @)", content)
+	}
+	path, err := parsePath(left)
+	if err != nil {
+		return jsonPathSegment{}, err
+	}
+	seg.filterPath = path
+	return seg, nil
+}
+
+// execute renders the template against data, which must be a generic JSON
+// value (maps, slices and scalars as produced by encoding/json).
+func (t *jsonPathTemplate) execute(data interface{}) (string, error) {
+	var out strings.Builder
+	if err := executeNodes(&out, t.nodes, data, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// executeNodes renders nodes with current as the object that relative paths
+// start from.
+func executeNodes(out *strings.Builder, nodes []jsonPathNode, root, current interface{}) error {
+	for _, node := range nodes {
+		switch {
+		case node.path == nil:
+			out.WriteString(node.text)
+
+		case node.isRange:
+			for _, item := range node.path.eval(root, current) {
+				if err := executeNodes(out, node.body, root, item); err != nil {
+					return err
+				}
+			}
+
+		default:
+			values := node.path.eval(root, current)
+			for i, value := range values {
+				if i > 0 {
+					out.WriteByte(' ')
+				}
+				text, err := formatJSONValue(value)
+				if err != nil {
+					return err
+				}
+				out.WriteString(text)
+			}
+		}
+	}
+	return nil
+}
+
+// eval returns the values selected by the path.
+func (p *jsonPath) eval(root, current interface{}) []interface{} {
+	start := current
+	if p.fromRoot {
+		start = root
+	}
+
+	values := []interface{}{start}
+	for _, seg := range p.segments {
+		var next []interface{}
+		for _, value := range values {
+			next = append(next, seg.apply(root, value)...)
+		}
+		values = next
+	}
+	return values
+}
+
+// apply returns the values selected by one segment from value.
+func (s jsonPathSegment) apply(root, value interface{}) []interface{} {
+	switch s.kind {
+	case segmentField:
+		if obj, ok := value.(map[string]interface{}); ok {
+			if field, exists := obj[s.field]; exists {
+				return []interface{}{field}
+			}
+		}
+		return nil
+
+	case segmentIndex:
+		arr, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		index := s.index
+		if index < 0 {
+			index += len(arr)
+		}
+		if index < 0 || index >= len(arr) {
+			return nil
+		}
+		return []interface{}{arr[index]}
+
+	case segmentWildcard:
+		switch v := value.(type) {
+		case []interface{}:
+			return v
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			result := make([]interface{}, 0, len(keys))
+			for _, k := range keys {
+				result = append(result, v[k])
+			}
+			return result
+		}
+		return nil
+
+	case segmentFilter:
+		arr, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		var result []interface{}
+		for _, item := range arr {
+			if s.matches(root, item) {
+				result = append(result, item)
+			}
+		}
+		return result
+	}
+
+	return nil
+}
+
+// matches reports whether item satisfies a filter segment.
+func (s jsonPathSegment) matches(root, item interface{}) bool {
+	values := s.filterPath.eval(root, item)
+	if s.filterOp == "" {
+		return len(values) > 0 && values[0] != nil
+	}
+
+	matched := false
+	for _, value := range values {
+		text, err := formatJSONValue(value)
+		if err == nil && text == s.filterValue {
+			matched = true
+			break
+		}
+	}
+	if s.filterOp == "!=" {
+		return !matched
+	}
+	return matched
+}
+
+// formatJSONValue renders a generic JSON value for output: scalars as plain
+// text, objects and arrays as compact JSON.
+func formatJSONValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("failed to format value: %w", err)
+		}
+		return string(data), nil
+	}
+}
@@ -0,0 +1,111 @@
+package output
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+// jsonPathTestVM returns a VM with several addresses for path tests.
+func jsonPathTestVM() *v1alpha1.VirtualMachine {
+	vm := createTestVM("web-1", v1alpha1.VMPhaseRunning, "10.0.0.5")
+	vm.Status.Addresses = append(vm.Status.Addresses,
+		v1alpha1.VMAddress{Type: "InternalIP", Address: "10.0.1.5"},
+		v1alpha1.VMAddress{Type: "Hostname", Address: "web-1.example.com"},
+	)
+	vm.Labels = map[string]string{"tier": "web", "env": "prod"}
+	return vm
+}
+
+func TestJSONPathFormatter_FormatVM(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"field", "{.metadata.name}", "web-1"},
+		{"first address", "{.status.addresses[0].address}", "10.0.0.5"},
+		{"last address", "{.status.addresses[-1].address}", "web-1.example.com"},
+		{"wildcard", "{.status.addresses[*].type}", "InternalIP InternalIP Hostname"},
+		{"filter", `{.status.addresses[?(@.type=="InternalIP")].address}`, "10.0.0.5 10.0.1.5"},
+		{"filter not equal", `{.status.addresses[?(@.type!="InternalIP")].address}`, "web-1.example.com"},
+		{"number", "{.spec.vcpus}", "2"},
+		{"quoted key", "{.metadata.labels['tier']}", "web"},
+		{"map wildcard sorted by key", "{.metadata.labels.*}", "prod web"},
+		{"literal text", "name={.metadata.name} phase={.status.phase}", "name=web-1 phase=Running"},
+		{"string literal", `{.metadata.name}{"\n"}`, "web-1\n"},
+		{"missing field", "{.spec.nope}", ""},
+		{"index out of range", "{.status.addresses[9].address}", ""},
+		{"object as JSON", "{.metadata.labels}", `{"env":"prod","tier":"web"}`},
+		{"range", `{range .status.addresses[*]}{.type}={.address};{end}`, "InternalIP=10.0.0.5;InternalIP=10.0.1.5;Hostname=web-1.example.com;"},
+		{"root inside range", `{range .status.addresses[*]}{$.metadata.name} {end}`, "web-1 web-1 web-1 "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewJSONPathFormatter(tt.template)
+			if err != nil {
+				t.Fatalf("NewJSONPathFormatter(%q) error = %v", tt.template, err)
+			}
+			got, err := f.FormatVM(jsonPathTestVM())
+			if err != nil {
+				t.Fatalf("FormatVM() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("FormatVM() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONPathFormatter_FormatVMList(t *testing.T) {
+	vms := []*v1alpha1.VirtualMachine{
+		createTestVM("vm-1", v1alpha1.VMPhaseRunning, "10.0.0.1"),
+		createTestVM("vm-2", v1alpha1.VMPhaseStopped, "10.0.0.2"),
+	}
+
+	f, err := NewJSONPathFormatter(`{range .items[*]}{.metadata.name}{"\t"}{.status.addresses[0].address}{"\n"}{end}`)
+	if err != nil {
+		t.Fatalf("NewJSONPathFormatter() error = %v", err)
+	}
+
+	got, err := f.FormatVMList(vms)
+	if err != nil {
+		t.Fatalf("FormatVMList() error = %v", err)
+	}
+	if want := "vm-1\t10.0.0.1\nvm-2\t10.0.0.2\n"; got != want {
+		t.Errorf("FormatVMList() = %q, want %q", got, want)
+	}
+
+	f, _ = NewJSONPathFormatter("{.kind}")
+	if got, _ := f.FormatVMList(nil); got != "VirtualMachineList" {
+		t.Errorf("kind = %q, want VirtualMachineList", got)
+	}
+}
+
+func TestNewJSONPathFormatter_Errors(t *testing.T) {
+	tests := []struct {
+		template string
+		wantErr  string
+	}{
+		{"", "empty"},
+		{"{.metadata.name", "unclosed action"},
+		{"{metadata.name}", "must start with"},
+		{"{..name}", "recursive descent"},
+		{"{.items[abc]}", "unsupported index"},
+		{"{.items[0}", "unclosed '['"},
+		{"{range .items[*]}{.name}", "without matching {end}"},
+		{"{.name}{end}", "unexpected {end}"},
+		{"{.items[?(.type)]}", "must start with @"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			_, err := NewJSONPathFormatter(tt.template)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewJSONPathFormatter(%q) error = %v, want %q", tt.template, err, tt.wantErr)
+			}
+		})
+	}
+}
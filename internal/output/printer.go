@@ -0,0 +1,166 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Table is tabular output for resources other than VirtualMachines, such as
+// images, pools and snapshots.
+type Table struct {
+	// Columns are the table's columns.
+	Columns []Column
+
+	// Rows hold one cell per column.
+	Rows [][]string
+
+	// Footer lines are printed after the rows, e.g. totals and legends.
+	Footer []string
+}
+
+// Column is a table column.
+type Column struct {
+	// Name is the column header.
+	Name string
+
+	// Wide columns are only shown with -o wide.
+	Wide bool
+}
+
+// Printer formats resources other than VirtualMachines in the format
+// selected by the global --output flag. Commands describe their table output
+// as a Table; the other formats are derived from the resource itself.
+type Printer struct {
+	opts       Options
+	jsonPath   *jsonPathTemplate
+	goTemplate *GoTemplateFormatter
+}
+
+// NewPrinter creates a Printer, validating any template.
+func NewPrinter(opts Options) (*Printer, error) {
+	p := &Printer{opts: opts}
+
+	var err error
+	switch opts.Format {
+	case FormatTable, FormatWide, FormatYAML, FormatJSON:
+	case FormatJSONPath:
+		p.jsonPath, err = parseJSONPath(opts.Template)
+	case FormatGoTemplate:
+		p.goTemplate, err = NewGoTemplateFormatter(opts.Template)
+	default:
+		err = fmt.Errorf("unsupported output format: %s (supported: table, wide, yaml, json, jsonpath, go-template)", opts.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Tabular reports whether the output is a table (-o table or -o wide) that
+// the command describes with a Table, rather than the resource itself.
+func (p *Printer) Tabular() bool {
+	return p.opts.Format == FormatTable || p.opts.Format == FormatWide
+}
+
+// FormatTable renders t with tab-aligned columns. Wide columns are only
+// included for -o wide; headers and footer are left out with --no-headers.
+func (p *Printer) FormatTable(t *Table) string {
+	var shown []int
+	for i, col := range t.Columns {
+		if !col.Wide || p.opts.Format == FormatWide {
+			shown = append(shown, i)
+		}
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	if !p.opts.NoHeaders {
+		_, _ = fmt.Fprintln(w, strings.Join(selectCells(headerCells(t.Columns), shown), "\t"))
+	}
+	for _, row := range t.Rows {
+		_, _ = fmt.Fprintln(w, strings.Join(selectCells(row, shown), "\t"))
+	}
+	_ = w.Flush()
+
+	if !p.opts.NoHeaders && len(t.Footer) > 0 {
+		buf.WriteString("\n")
+		for _, line := range t.Footer {
+			buf.WriteString(line + "\n")
+		}
+	}
+	return buf.String()
+}
+
+// FormatObject formats a single resource as YAML, JSON or through a
+// template. Templates see the resource's JSON form.
+func (p *Printer) FormatObject(obj interface{}) (string, error) {
+	return p.format(obj, obj)
+}
+
+// FormatList formats a list of resources: a JSON array or YAML sequence, or
+// for templates an object with the list under .items, as for VMs.
+func (p *Printer) FormatList(items interface{}) (string, error) {
+	// Empty lists are [] rather than null
+	if v := reflect.ValueOf(items); v.Kind() == reflect.Slice && v.IsNil() {
+		items = reflect.MakeSlice(v.Type(), 0, 0).Interface()
+	}
+	return p.format(items, map[string]interface{}{"items": items})
+}
+
+// format marshals obj for YAML and JSON and renders templates with
+// templateData.
+func (p *Printer) format(obj, templateData interface{}) (string, error) {
+	switch p.opts.Format {
+	case FormatYAML:
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal to YAML: %w", err)
+		}
+		return string(data), nil
+	case FormatJSON:
+		data, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal to JSON: %w", err)
+		}
+		return string(data) + "\n", nil
+	case FormatJSONPath, FormatGoTemplate:
+		data, err := toGeneric(templateData)
+		if err != nil {
+			return "", err
+		}
+		if p.jsonPath != nil {
+			return p.jsonPath.execute(data)
+		}
+		return p.goTemplate.execute(data)
+	default:
+		return "", fmt.Errorf("format %s is rendered as a table", p.opts.Format)
+	}
+}
+
+// headerCells returns the column names.
+func headerCells(columns []Column) []string {
+	cells := make([]string, len(columns))
+	for i, col := range columns {
+		cells[i] = col.Name
+	}
+	return cells
+}
+
+// selectCells returns the cells at the given indexes; missing cells are
+// shown as "-".
+func selectCells(cells []string, indexes []int) []string {
+	selected := make([]string, len(indexes))
+	for i, index := range indexes {
+		selected[i] = "-"
+		if index < len(cells) && cells[index] != "" {
+			selected[i] = cells[index]
+		}
+	}
+	return selected
+}
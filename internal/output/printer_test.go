@@ -0,0 +1,159 @@
+package output
+
+import (
+	"strings"
+	"testing"
+)
+
+type testImage struct {
+	Name string `json:"name" yaml:"name"`
+	Size uint64 `json:"size" yaml:"size"`
+}
+
+func testTable() *Table {
+	return &Table{
+		Columns: []Column{{Name: "NAME"}, {Name: "SIZE"}, {Name: "PATH", Wide: true}},
+		Rows: [][]string{
+			{"fedora-43.qcow2", "5.0GB", "/images/fedora-43.qcow2"},
+			{"empty.raw", "", "/images/empty.raw"},
+		},
+		Footer: []string{"Total: 2 image(s)"},
+	}
+}
+
+func TestPrinter_FormatTable(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      Options
+		want      []string
+		wantNot   []string
+		wantLines int
+	}{
+		{
+			name:      "table",
+			opts:      Options{Format: FormatTable},
+			want:      []string{"NAME", "fedora-43.qcow2  5.0GB\n", "empty.raw        -\n", "\nTotal: 2 image(s)\n"},
+			wantNot:   []string{"PATH", "/images"},
+			wantLines: 5,
+		},
+		{
+			name:      "wide",
+			opts:      Options{Format: FormatWide},
+			want:      []string{"PATH", "/images/fedora-43.qcow2"},
+			wantLines: 5,
+		},
+		{
+			name:      "no headers",
+			opts:      Options{Format: FormatTable, NoHeaders: true},
+			wantNot:   []string{"NAME", "Total"},
+			wantLines: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPrinter(tt.opts)
+			if err != nil {
+				t.Fatalf("NewPrinter() error = %v", err)
+			}
+			if !p.Tabular() {
+				t.Error("expected tabular output")
+			}
+
+			got := p.FormatTable(testTable())
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("output missing %q:\n%s", want, got)
+				}
+			}
+			for _, notWant := range tt.wantNot {
+				if strings.Contains(got, notWant) {
+					t.Errorf("output contains %q:\n%s", notWant, got)
+				}
+			}
+			if lines := strings.Count(got, "\n"); lines != tt.wantLines {
+				t.Errorf("output has %d lines, want %d:\n%s", lines, tt.wantLines, got)
+			}
+		})
+	}
+}
+
+func TestPrinter_FormatObject(t *testing.T) {
+	image := testImage{Name: "fedora-43.qcow2", Size: 5}
+
+	tests := []struct {
+		format   string
+		want     string
+		wantList string
+	}{
+		{format: "json", want: "{\n  \"name\": \"fedora-43.qcow2\",\n  \"size\": 5\n}\n", wantList: "[\n  {\n    \"name\": \"fedora-43.qcow2\",\n    \"size\": 5\n  }\n]\n"},
+		{format: "yaml", want: "name: fedora-43.qcow2\nsize: 5\n", wantList: "- name: fedora-43.qcow2\n  size: 5\n"},
+		{format: "jsonpath={.name}", want: "fedora-43.qcow2", wantList: "fedora-43.qcow2"},
+		{format: "go-template={{.size}}", want: "5", wantList: "5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			format, tmpl, err := ParseFormat(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := NewPrinter(Options{Format: format, Template: tmpl})
+			if err != nil {
+				t.Fatalf("NewPrinter() error = %v", err)
+			}
+			if p.Tabular() {
+				t.Error("expected structured output")
+			}
+
+			got, err := p.FormatObject(image)
+			if err != nil {
+				t.Fatalf("FormatObject() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("FormatObject() = %q, want %q", got, tt.want)
+			}
+
+			// List templates address the items under .items
+			if strings.HasPrefix(tt.format, "jsonpath") {
+				p, _ = NewPrinter(Options{Format: FormatJSONPath, Template: "{.items[0].name}"})
+			} else if strings.HasPrefix(tt.format, "go-template") {
+				p, _ = NewPrinter(Options{Format: FormatGoTemplate, Template: "{{(index .items 0).size}}"})
+			}
+			got, err = p.FormatList([]testImage{image})
+			if err != nil {
+				t.Fatalf("FormatList() error = %v", err)
+			}
+			if got != tt.wantList {
+				t.Errorf("FormatList() = %q, want %q", got, tt.wantList)
+			}
+		})
+	}
+}
+
+func TestPrinter_FormatList_Empty(t *testing.T) {
+	p, err := NewPrinter(Options{Format: FormatJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var images []testImage
+	got, err := p.FormatList(images)
+	if err != nil {
+		t.Fatalf("FormatList() error = %v", err)
+	}
+	if got != "[]\n" {
+		t.Errorf("FormatList() = %q, want an empty array", got)
+	}
+}
+
+func TestNewPrinter_Errors(t *testing.T) {
+	for _, opts := range []Options{
+		{Format: "xml"},
+		{Format: FormatJSONPath, Template: "{.name"},
+		{Format: FormatGoTemplate, Template: "{{.name"},
+	} {
+		if _, err := NewPrinter(opts); err == nil {
+			t.Errorf("NewPrinter(%+v) expected error", opts)
+		}
+	}
+}
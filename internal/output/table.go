@@ -3,6 +3,7 @@ package output
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"text/tabwriter"
 	"time"
 
@@ -13,6 +14,10 @@ import (
 type TableFormatter struct {
 	// NoHeaders omits the header row.
 	NoHeaders bool
+
+	// Wide adds the boot image, CPU mode, network attachments, autostart and
+	// owner columns.
+	Wide bool
 }
 
 // FormatVM formats a single VirtualMachine as a table row.
@@ -31,7 +36,11 @@ func (f *TableFormatter) FormatVMList(vms []*v1alpha1.VirtualMachine) (string, e
 
 	// Write header unless NoHeaders is set
 	if !f.NoHeaders {
-		_, _ = fmt.Fprintln(w, "NAME\tPHASE\tIP\tVCPUs\tMEMORY\tAGE")
+		header := "NAME\tPHASE\tIP\tVCPUs\tMEMORY\tAGE"
+		if f.Wide {
+			header += "\tIMAGE\tCPU MODE\tNETWORKS\tAUTOSTART\tOWNER"
+		}
+		_, _ = fmt.Fprintln(w, header)
 	}
 
 	// Write each VM as a row
@@ -50,6 +59,9 @@ func (f *TableFormatter) FormatVMList(vms []*v1alpha1.VirtualMachine) (string, e
 
 		vcpus := fmt.Sprintf("%d", vm.Spec.VCPUs)
 		memory := fmt.Sprintf("%d GiB", vm.Spec.MemoryGiB)
+		if vm.Spec.MemoryMiB > 0 {
+			memory = fmt.Sprintf("%d MiB", vm.Spec.MemoryMiB)
+		}
 
 		// Calculate age from creation timestamp
 		age := "-"
@@ -57,14 +69,45 @@ func (f *TableFormatter) FormatVMList(vms []*v1alpha1.VirtualMachine) (string, e
 			age = formatAge(time.Since(vm.CreationTimestamp.Time))
 		}
 
-		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
-			name, phase, ip, vcpus, memory, age)
+		row := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s", name, phase, ip, vcpus, memory, age)
+		if f.Wide {
+			row += "\t" + strings.Join(wideColumns(vm), "\t")
+		}
+		_, _ = fmt.Fprintln(w, row)
 	}
 
 	_ = w.Flush()
 	return buf.String(), nil
 }
 
+// wideColumns returns the extra -o wide columns of a VM.
+func wideColumns(vm *v1alpha1.VirtualMachine) []string {
+	image := vm.Spec.BootDisk.Image
+	if image == "" {
+		image = "-"
+	}
+
+	var networks []string
+	for _, iface := range vm.Spec.NetworkInterfaces {
+		if iface.Network != "" {
+			networks = append(networks, "network:"+iface.Network)
+		} else {
+			networks = append(networks, iface.Bridge)
+		}
+	}
+	network := strings.Join(networks, ",")
+	if network == "" {
+		network = "-"
+	}
+
+	owner := vm.GetOwner()
+	if owner == "" {
+		owner = "-"
+	}
+
+	return []string{image, vm.GetCPUMode(), network, fmt.Sprint(vm.IsAutostart()), owner}
+}
+
 // formatAge formats a duration as a human-readable age string.
 // Examples: "5s", "2m", "3h", "4d", "2w", "1y"
 func formatAge(d time.Duration) string {
@@ -0,0 +1,131 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+// JSONPathFormatter renders resources through a JSONPath template, for
+// extracting single fields in scripts:
+//
+//	foundry get my-vm -o jsonpath='{.status.addresses[0].address}'
+//
+// Templates see the JSON form of resources (field names as in -o json).
+// Lists are rendered as a VirtualMachineList object, so templates iterate
+// over .items as with kubectl.
+type JSONPathFormatter struct {
+	tmpl *jsonPathTemplate
+}
+
+// NewJSONPathFormatter parses a JSONPath template.
+func NewJSONPathFormatter(text string) (*JSONPathFormatter, error) {
+	tmpl, err := parseJSONPath(text)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONPathFormatter{tmpl: tmpl}, nil
+}
+
+// FormatVM renders the template for a single VirtualMachine.
+func (f *JSONPathFormatter) FormatVM(vm *v1alpha1.VirtualMachine) (string, error) {
+	data, err := toGeneric(vm)
+	if err != nil {
+		return "", err
+	}
+	return f.tmpl.execute(data)
+}
+
+// FormatVMList renders the template for a VirtualMachineList.
+func (f *JSONPathFormatter) FormatVMList(vms []*v1alpha1.VirtualMachine) (string, error) {
+	data, err := toGeneric(vmListObject(vms))
+	if err != nil {
+		return "", err
+	}
+	return f.tmpl.execute(data)
+}
+
+// GoTemplateFormatter renders resources through a Go text/template:
+//
+//	foundry get my-vm -o go-template='{{.status.phase}}'
+//
+// Like JSONPathFormatter, templates see the JSON form of resources and lists
+// are rendered as a VirtualMachineList object with .items.
+type GoTemplateFormatter struct {
+	tmpl *template.Template
+}
+
+// NewGoTemplateFormatter parses a Go template.
+func NewGoTemplateFormatter(text string) (*GoTemplateFormatter, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("go-template is empty")
+	}
+	tmpl, err := template.New("output").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid go-template: %w", err)
+	}
+	return &GoTemplateFormatter{tmpl: tmpl}, nil
+}
+
+// FormatVM renders the template for a single VirtualMachine.
+func (f *GoTemplateFormatter) FormatVM(vm *v1alpha1.VirtualMachine) (string, error) {
+	data, err := toGeneric(vm)
+	if err != nil {
+		return "", err
+	}
+	return f.execute(data)
+}
+
+// FormatVMList renders the template for a VirtualMachineList.
+func (f *GoTemplateFormatter) FormatVMList(vms []*v1alpha1.VirtualMachine) (string, error) {
+	data, err := toGeneric(vmListObject(vms))
+	if err != nil {
+		return "", err
+	}
+	return f.execute(data)
+}
+
+func (f *GoTemplateFormatter) execute(data interface{}) (string, error) {
+	var out strings.Builder
+	if err := f.tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to execute go-template: %w", err)
+	}
+	return out.String(), nil
+}
+
+// vmListObject wraps VMs in a Kubernetes-style VirtualMachineList object.
+func vmListObject(vms []*v1alpha1.VirtualMachine) map[string]interface{} {
+	for _, vm := range vms {
+		v1alpha1.SetDefaultAPIVersion(vm)
+	}
+	if vms == nil {
+		vms = []*v1alpha1.VirtualMachine{}
+	}
+	return map[string]interface{}{
+		"apiVersion": v1alpha1.GroupName + "/" + v1alpha1.Version,
+		"kind":       "VirtualMachineList",
+		"items":      vms,
+	}
+}
+
+// toGeneric converts a resource to its generic JSON form (maps, slices and
+// scalars) so templates address fields by their JSON names.
+func toGeneric(v interface{}) (interface{}, error) {
+	if vm, ok := v.(*v1alpha1.VirtualMachine); ok {
+		v1alpha1.SetDefaultAPIVersion(vm)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal resource: %w", err)
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal resource: %w", err)
+	}
+	return generic, nil
+}
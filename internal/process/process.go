@@ -0,0 +1,20 @@
+// Package process tells whether a process recorded by foundry, such as the
+// holder of a creation journal or an image import lock, is still running.
+package process
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Running reports whether the process pid is running on this host. A
+// process of another user, which may not be signalled, is running too.
+func Running(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
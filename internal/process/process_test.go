@@ -0,0 +1,25 @@
+package process
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestRunning(t *testing.T) {
+	if !Running(os.Getpid()) {
+		t.Error("Running(self) = false")
+	}
+	// PID 1 is running but belongs to root
+	if !Running(1) {
+		t.Error("Running(1) = false")
+	}
+
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("cannot run a process: %v", err)
+	}
+	if Running(cmd.Process.Pid) {
+		t.Errorf("Running(%d) of an exited process = true", cmd.Process.Pid)
+	}
+}
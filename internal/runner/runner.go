@@ -0,0 +1,238 @@
+// Package runner runs a single command in a throwaway VM.
+//
+// A VM is created from a configuration, the command is run over SSH once the
+// VM accepts connections, and the VM is destroyed again - making foundry
+// usable as a backend for test runners and CI jobs.
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"time"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/vm"
+)
+
+const (
+	// DefaultUser is the SSH user when none is given.
+	DefaultUser = "root"
+
+	// DefaultReadyTimeout is how long to wait for SSH to become available.
+	DefaultReadyTimeout = 5 * time.Minute
+
+	// sshUnavailable is the exit status of ssh itself failing, e.g. because
+	// the connection was refused or authentication failed.
+	sshUnavailable = 255
+)
+
+// pollInterval is how often SSH readiness is checked.
+var pollInterval = 2 * time.Second
+
+// Options configures Run.
+type Options struct {
+	// User is the SSH user. Defaults to DefaultUser.
+	User string
+
+	// IdentityFile is an SSH private key to use in addition to the agent.
+	IdentityFile string
+
+	// ReadyTimeout bounds the wait for SSH. Defaults to DefaultReadyTimeout.
+	ReadyTimeout time.Duration
+
+	// Keep leaves the VM running after the command instead of destroying it.
+	Keep bool
+
+	// Stdin, Stdout and Stderr are connected to the remote command.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// vmLifecycle creates and destroys VMs.
+type vmLifecycle interface {
+	Create(ctx context.Context, config *v1alpha1.VirtualMachine) (string, error)
+	Destroy(ctx context.Context, name string) error
+}
+
+// commandRunner runs a command over SSH and returns its exit status.
+type commandRunner interface {
+	Run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) (int, error)
+}
+
+// Run creates a VM from config, runs command in it over SSH once it is
+// reachable, streams the output and destroys the VM.
+//
+// The command is passed to ssh, so the remote login shell interprets it.
+// Returns the command's exit status. An error is returned if the VM could not
+// be created or never became reachable; the VM is destroyed in that case too.
+func Run(ctx context.Context, config *v1alpha1.VirtualMachine, command []string, opts Options) (int, error) {
+	return runWithDeps(ctx, config, command, opts, libvirtVMs{}, sshCommand{})
+}
+
+// runWithDeps runs a command in a throwaway VM with injected dependencies.
+func runWithDeps(ctx context.Context, config *v1alpha1.VirtualMachine, command []string, opts Options, vms vmLifecycle, runner commandRunner) (code int, err error) {
+	logger := logging.FromContext(ctx)
+
+	if len(command) == 0 {
+		return 0, fmt.Errorf("no command given")
+	}
+	if opts.User == "" {
+		opts.User = DefaultUser
+	}
+	if opts.ReadyTimeout == 0 {
+		opts.ReadyTimeout = DefaultReadyTimeout
+	}
+
+	addr, err := sshAddress(config)
+	if err != nil {
+		return 0, err
+	}
+
+	name, err := vms.Create(ctx, config)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create VM: %w", err)
+	}
+
+	if opts.Keep {
+		logger.Info("Keeping VM after the command", "vm", name)
+	} else {
+		defer func() {
+			// The run context may already be cancelled (e.g., Ctrl+C);
+			// the VM must still be removed
+			logger.Info("Destroying VM", "vm", name)
+			if destroyErr := vms.Destroy(context.Background(), name); destroyErr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to destroy VM '%s': %w", name, destroyErr))
+			}
+		}()
+	}
+
+	sshArgs := sshArgs(opts, addr)
+
+	logger.Info("Waiting for SSH", "vm", name, "address", addr)
+	if err := waitForSSH(ctx, runner, sshArgs, opts.ReadyTimeout); err != nil {
+		return 0, fmt.Errorf("VM '%s' did not become reachable: %w", name, err)
+	}
+
+	logger.Info("Running command on VM", "vm", name)
+	code, err = runner.Run(ctx, append(append(sshArgs, "--"), command...), opts.Stdin, opts.Stdout, opts.Stderr)
+	if err != nil {
+		return 0, fmt.Errorf("failed to run command: %w", err)
+	}
+	return code, nil
+}
+
+// sshAddress returns the address of the VM's first network interface,
+// preferring its IPv4 address.
+func sshAddress(config *v1alpha1.VirtualMachine) (string, error) {
+	if len(config.Spec.NetworkInterfaces) == 0 {
+		return "", fmt.Errorf("VM has no network interface with an IP address to connect to")
+	}
+	iface := config.Spec.NetworkInterfaces[0]
+	ip := iface.IP
+	if ip == "" {
+		ip = iface.IPv6
+	}
+	if ip == "" && iface.DHCP {
+		return "", fmt.Errorf("VM's first network interface uses DHCP; run needs a static ip to connect to")
+	}
+	if ip == "" {
+		return "", fmt.Errorf("VM has no network interface with an IP address to connect to")
+	}
+	if parsed, _, err := net.ParseCIDR(ip); err == nil {
+		ip = parsed.String()
+	}
+	return ip, nil
+}
+
+// sshArgs returns the ssh arguments for connecting to addr. Host keys are not
+// checked or recorded since every VM is new and thrown away.
+func sshArgs(opts Options, addr string) []string {
+	args := []string{
+		"-o", "BatchMode=yes",
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		"-o", "LogLevel=ERROR",
+		"-o", "ConnectTimeout=5",
+		"-l", opts.User,
+	}
+	if opts.IdentityFile != "" {
+		args = append(args, "-i", opts.IdentityFile)
+	}
+	return append(args, addr)
+}
+
+// waitForSSH runs "true" over SSH until it succeeds or timeout passes. This
+// also waits for cloud-init to install the authorized keys, which happens
+// after sshd starts accepting connections.
+func waitForSSH(ctx context.Context, runner commandRunner, sshArgs []string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	probe := append(append([]string{}, sshArgs...), "--", "true")
+	for {
+		code, err := runner.Run(ctx, probe, nil, io.Discard, io.Discard)
+		if err == nil && code == 0 {
+			return nil
+		}
+		if err == nil && code != sshUnavailable {
+			return fmt.Errorf("readiness check exited with status %d", code)
+		}
+		if errors.Is(err, exec.ErrNotFound) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out after %s", timeout)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// libvirtVMs creates and destroys VMs on the configured hypervisor.
+type libvirtVMs struct{}
+
+func (libvirtVMs) Create(ctx context.Context, config *v1alpha1.VirtualMachine) (string, error) {
+	result, err := vm.CreateFromConfig(ctx, config)
+	if err != nil {
+		return "", err
+	}
+	return result.VMName, nil
+}
+
+func (libvirtVMs) Destroy(ctx context.Context, name string) error {
+	report, err := vm.Destroy(ctx, name, vm.DestroyOptions{ForceClean: true})
+	if err != nil {
+		return err
+	}
+	if !report.Clean() {
+		logging.FromContext(ctx).Warn("VM left resources behind", "vm", name, "leftovers", report.Leftovers())
+	}
+	return nil
+}
+
+// sshCommand runs ssh from PATH.
+type sshCommand struct{}
+
+func (sshCommand) Run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	cmd := exec.CommandContext(ctx, "ssh", args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ssh: %w", err)
+	}
+	return 0, nil
+}
@@ -0,0 +1,196 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+type fakeVMs struct {
+	createErr  error
+	created    []string
+	destroyed  []string
+	destroyErr error
+}
+
+func (f *fakeVMs) Create(ctx context.Context, config *v1alpha1.VirtualMachine) (string, error) {
+	if f.createErr != nil {
+		return "", f.createErr
+	}
+	f.created = append(f.created, config.Name)
+	return config.Name, nil
+}
+
+func (f *fakeVMs) Destroy(ctx context.Context, name string) error {
+	f.destroyed = append(f.destroyed, name)
+	return f.destroyErr
+}
+
+// fakeSSH fails the first unavailable probes, then returns exitCode for the
+// command.
+type fakeSSH struct {
+	unavailable int
+	exitCode    int
+	probes      int
+	commands    [][]string
+	output      string
+}
+
+func (f *fakeSSH) Run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	if args[len(args)-1] == "true" {
+		f.probes++
+		if f.probes <= f.unavailable {
+			return sshUnavailable, nil
+		}
+		return 0, nil
+	}
+	f.commands = append(f.commands, args)
+	_, _ = io.WriteString(stdout, f.output)
+	return f.exitCode, nil
+}
+
+func testConfig() *v1alpha1.VirtualMachine {
+	return &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{Name: "ci-vm"},
+		Spec: v1alpha1.VirtualMachineSpec{
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{{IP: "10.0.0.10/24"}},
+		},
+	}
+}
+
+func init() {
+	pollInterval = time.Millisecond
+}
+
+func TestRunWithDeps(t *testing.T) {
+	vms := &fakeVMs{}
+	ssh := &fakeSSH{unavailable: 2, exitCode: 3, output: "hello\n"}
+	var stdout strings.Builder
+
+	code, err := runWithDeps(context.Background(), testConfig(), []string{"make", "test"},
+		Options{User: "fedora", Stdout: &stdout}, vms, ssh)
+	if err != nil {
+		t.Fatalf("runWithDeps() error = %v", err)
+	}
+	if code != 3 {
+		t.Errorf("exit code = %d, want 3", code)
+	}
+	if stdout.String() != "hello\n" {
+		t.Errorf("stdout = %q, want command output", stdout.String())
+	}
+	if ssh.probes != 3 {
+		t.Errorf("probes = %d, want 3", ssh.probes)
+	}
+
+	if len(ssh.commands) != 1 {
+		t.Fatalf("commands = %v, want 1", ssh.commands)
+	}
+	got := strings.Join(ssh.commands[0], " ")
+	if !strings.Contains(got, "-l fedora") || !strings.HasSuffix(got, "10.0.0.10 -- make test") {
+		t.Errorf("ssh args = %q", got)
+	}
+
+	if len(vms.destroyed) != 1 || vms.destroyed[0] != "ci-vm" {
+		t.Errorf("destroyed = %v, want [ci-vm]", vms.destroyed)
+	}
+}
+
+func TestRunWithDeps_Keep(t *testing.T) {
+	vms := &fakeVMs{}
+
+	if _, err := runWithDeps(context.Background(), testConfig(), []string{"true"}, Options{Keep: true}, vms, &fakeSSH{}); err != nil {
+		t.Fatalf("runWithDeps() error = %v", err)
+	}
+	if len(vms.destroyed) != 0 {
+		t.Errorf("destroyed = %v, want VM kept", vms.destroyed)
+	}
+}
+
+func TestRunWithDeps_NotReachable(t *testing.T) {
+	vms := &fakeVMs{}
+	ssh := &fakeSSH{unavailable: 1 << 30}
+
+	_, err := runWithDeps(context.Background(), testConfig(), []string{"true"},
+		Options{ReadyTimeout: 20 * time.Millisecond}, vms, ssh)
+	if err == nil || !strings.Contains(err.Error(), "did not become reachable") {
+		t.Fatalf("runWithDeps() error = %v, want reachability error", err)
+	}
+	if len(ssh.commands) != 0 {
+		t.Error("command ran although the VM was not reachable")
+	}
+	if len(vms.destroyed) != 1 {
+		t.Errorf("destroyed = %v, want the VM destroyed", vms.destroyed)
+	}
+}
+
+func TestRunWithDeps_CreateFails(t *testing.T) {
+	vms := &fakeVMs{createErr: errors.New("boot volume already exists")}
+
+	_, err := runWithDeps(context.Background(), testConfig(), []string{"true"}, Options{}, vms, &fakeSSH{})
+	if err == nil || !strings.Contains(err.Error(), "failed to create VM") {
+		t.Fatalf("runWithDeps() error = %v", err)
+	}
+	if len(vms.destroyed) != 0 {
+		t.Errorf("destroyed = %v, want nothing to destroy", vms.destroyed)
+	}
+}
+
+func TestRunWithDeps_DestroyFails(t *testing.T) {
+	vms := &fakeVMs{destroyErr: errors.New("permission denied")}
+
+	code, err := runWithDeps(context.Background(), testConfig(), []string{"true"}, Options{}, vms, &fakeSSH{})
+	if err == nil || !strings.Contains(err.Error(), "failed to destroy VM 'ci-vm'") {
+		t.Fatalf("runWithDeps() error = %v, want destroy error", err)
+	}
+	if code != 0 {
+		t.Errorf("exit code = %d, want the command's status", code)
+	}
+}
+
+func TestRunWithDeps_NoAddress(t *testing.T) {
+	config := testConfig()
+	config.Spec.NetworkInterfaces = nil
+	vms := &fakeVMs{}
+
+	if _, err := runWithDeps(context.Background(), config, []string{"true"}, Options{}, vms, &fakeSSH{}); err == nil {
+		t.Fatal("expected error for VM without an address")
+	}
+	if len(vms.created) != 0 {
+		t.Error("VM was created although it cannot be reached")
+	}
+}
+
+func TestSSHAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		iface   v1alpha1.NetworkInterfaceSpec
+		want    string
+		wantErr bool
+	}{
+		{name: "IPv4", iface: v1alpha1.NetworkInterfaceSpec{IP: "10.0.0.10/24"}, want: "10.0.0.10"},
+		{name: "dual-stack prefers IPv4", iface: v1alpha1.NetworkInterfaceSpec{IP: "10.0.0.10/24", IPv6: "2001:db8::10/64"}, want: "10.0.0.10"},
+		{name: "IPv6 only", iface: v1alpha1.NetworkInterfaceSpec{IPv6: "2001:db8::10/64"}, want: "2001:db8::10"},
+		{name: "DHCP with IPv6", iface: v1alpha1.NetworkInterfaceSpec{DHCP: true, IPv6: "2001:db8::10/64"}, want: "2001:db8::10"},
+		{name: "DHCP", iface: v1alpha1.NetworkInterfaceSpec{DHCP: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig()
+			config.Spec.NetworkInterfaces = []v1alpha1.NetworkInterfaceSpec{tt.iface}
+
+			got, err := sshAddress(config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sshAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("sshAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+// SSHOptions configures SSH.
+type SSHOptions struct {
+	// User is the SSH user. Defaults to the VM's default-user annotation,
+	// recorded from its boot image, then DefaultUser.
+	User string
+
+	// IdentityFile is an SSH private key to use in addition to the agent.
+	IdentityFile string
+
+	// Stdin, Stdout and Stderr are connected to the remote session.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// SSH opens an SSH session to an existing VM, running command if given or a
+// login shell otherwise. Returns the exit status of the session.
+func SSH(ctx context.Context, config *v1alpha1.VirtualMachine, command []string, opts SSHOptions) (int, error) {
+	return sshWithDeps(ctx, config, command, opts, sshCommand{})
+}
+
+// sshWithDeps opens an SSH session with an injected command runner.
+func sshWithDeps(ctx context.Context, config *v1alpha1.VirtualMachine, command []string, opts SSHOptions, runner commandRunner) (int, error) {
+	addr, err := loginAddress(config)
+	if err != nil {
+		return 0, err
+	}
+
+	args := []string{
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		"-o", "LogLevel=ERROR",
+		"-l", loginUser(config, opts.User),
+	}
+	if opts.IdentityFile != "" {
+		args = append(args, "-i", opts.IdentityFile)
+	}
+	args = append(args, addr)
+	if len(command) > 0 {
+		args = append(append(args, "--"), command...)
+	}
+
+	code, err := runner.Run(ctx, args, opts.Stdin, opts.Stdout, opts.Stderr)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to VM '%s': %w", config.Name, err)
+	}
+	return code, nil
+}
+
+// loginUser returns the user to log in to a VM as: user if set, otherwise the
+// default user recorded for the VM's boot image, otherwise DefaultUser.
+func loginUser(config *v1alpha1.VirtualMachine, user string) string {
+	if user != "" {
+		return user
+	}
+	if user := config.GetDefaultUser(); user != "" {
+		return user
+	}
+	return DefaultUser
+}
+
+// loginAddress returns the address to connect to: the static address of the
+// VM's first network interface, or else the first address reported in its
+// status (e.g. leased over DHCP).
+func loginAddress(config *v1alpha1.VirtualMachine) (string, error) {
+	addr, err := sshAddress(config)
+	if err == nil {
+		return addr, nil
+	}
+	for _, status := range config.Status.Addresses {
+		if status.Address != "" {
+			return status.Address, nil
+		}
+	}
+	return "", err
+}
@@ -0,0 +1,74 @@
+package runner
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+func TestSSHWithDeps(t *testing.T) {
+	config := testConfig()
+	ssh := &fakeSSH{exitCode: 3}
+
+	code, err := sshWithDeps(context.Background(), config, []string{"uptime"}, SSHOptions{IdentityFile: "/keys/id", Stdout: io.Discard}, ssh)
+	if err != nil {
+		t.Fatalf("sshWithDeps() error = %v", err)
+	}
+	if code != 3 {
+		t.Errorf("code = %d, want 3", code)
+	}
+	args := strings.Join(ssh.commands[0], " ")
+	if !strings.Contains(args, "-l root -i /keys/id 10.0.0.10 -- uptime") {
+		t.Errorf("ssh args = %s", args)
+	}
+	if strings.Contains(args, "BatchMode") {
+		t.Errorf("interactive session uses batch mode: %s", args)
+	}
+}
+
+func TestSSHWithDeps_LoginShell(t *testing.T) {
+	ssh := &fakeSSH{}
+	if _, err := sshWithDeps(context.Background(), testConfig(), nil, SSHOptions{Stdout: io.Discard}, ssh); err != nil {
+		t.Fatalf("sshWithDeps() error = %v", err)
+	}
+	if args := ssh.commands[0]; args[len(args)-1] != "10.0.0.10" {
+		t.Errorf("ssh args = %v, want the address last", args)
+	}
+}
+
+func TestSSHWithDeps_StatusAddress(t *testing.T) {
+	config := testConfig()
+	config.Spec.NetworkInterfaces = []v1alpha1.NetworkInterfaceSpec{{DHCP: true}}
+
+	ssh := &fakeSSH{}
+	_, err := sshWithDeps(context.Background(), config, nil, SSHOptions{Stdout: io.Discard}, ssh)
+	if err == nil {
+		t.Fatal("expected error without any address")
+	}
+
+	config.Status.Addresses = []v1alpha1.VMAddress{{Type: "InternalIP", Address: "192.168.122.50"}}
+	if _, err := sshWithDeps(context.Background(), config, nil, SSHOptions{Stdout: io.Discard}, ssh); err != nil {
+		t.Fatalf("sshWithDeps() error = %v", err)
+	}
+	if args := ssh.commands[0]; args[len(args)-1] != "192.168.122.50" {
+		t.Errorf("ssh args = %v, want the leased address", args)
+	}
+}
+
+func TestLoginUser(t *testing.T) {
+	config := testConfig()
+	if got := loginUser(config, ""); got != DefaultUser {
+		t.Errorf("loginUser() = %q, want %q", got, DefaultUser)
+	}
+
+	config.Annotations = map[string]string{v1alpha1.AnnotationDefaultUser: "fedora"}
+	if got := loginUser(config, ""); got != "fedora" {
+		t.Errorf("loginUser() = %q, want the image's default user", got)
+	}
+	if got := loginUser(config, "admin"); got != "admin" {
+		t.Errorf("loginUser() = %q, want the explicit user", got)
+	}
+}
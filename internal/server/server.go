@@ -0,0 +1,242 @@
+// Package server implements the HTTP server used in daemon mode, including
+// liveness/readiness endpoints and systemd notification integration.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jbweber/foundry/internal/auth"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/systemd"
+)
+
+const (
+	// DefaultAddr is the default listen address. The API is only exposed on
+	// localhost unless explicitly configured otherwise.
+	DefaultAddr = "127.0.0.1:8080"
+
+	// defaultShutdownTimeout bounds how long in-flight requests may take to
+	// finish on shutdown.
+	defaultShutdownTimeout = 10 * time.Second
+
+	// checkTimeout bounds each readiness check.
+	checkTimeout = 5 * time.Second
+)
+
+// Check is a readiness check. It returns nil if the dependency it checks
+// (e.g., the libvirt daemon) is usable.
+type Check func(ctx context.Context) error
+
+// Options configures a Server.
+type Options struct {
+	// Addr is the TCP address to listen on. Defaults to DefaultAddr.
+	Addr string
+
+	// ReadyChecks are run by /readyz, keyed by name.
+	ReadyChecks map[string]Check
+
+	// ShutdownTimeout bounds graceful shutdown. Defaults to 10 seconds.
+	ShutdownTimeout time.Duration
+
+	// TLSConfig enables HTTPS (and mTLS if it verifies client certificates).
+	TLSConfig *tls.Config
+
+	// Auth, if set, authenticates and authorizes every request except the
+	// health endpoints, and audit-logs each one.
+	Auth *auth.Authenticator
+}
+
+// Server is the foundry daemon HTTP server.
+//
+// It always serves:
+//   - /healthz: liveness, 200 while the process is able to serve requests
+//   - /readyz: readiness, 200 only if every ready check passes and the
+//     server is not shutting down
+//
+// Additional handlers (e.g., the API) are registered with Handle. The health
+// endpoints never require authentication so probes keep working.
+type Server struct {
+	opts     Options
+	mux      *http.ServeMux
+	draining atomic.Bool
+}
+
+// New creates a Server with the health endpoints registered.
+func New(opts Options) *Server {
+	if opts.Addr == "" {
+		opts.Addr = DefaultAddr
+	}
+	if opts.ShutdownTimeout == 0 {
+		opts.ShutdownTimeout = defaultShutdownTimeout
+	}
+
+	s := &Server{
+		opts: opts,
+		mux:  http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /healthz", s.handleHealthz)
+	s.mux.HandleFunc("GET /readyz", s.handleReadyz)
+	return s
+}
+
+// Handle registers a handler for the given pattern (see http.ServeMux).
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Handler returns the server's root HTTP handler, including authentication
+// if configured.
+func (s *Server) Handler() http.Handler {
+	if s.opts.Auth != nil {
+		return s.opts.Auth.Middleware(s.mux, "/healthz", "/readyz")
+	}
+	return s.mux
+}
+
+// Addr returns the configured listen address.
+func (s *Server) Addr() string {
+	return s.opts.Addr
+}
+
+// Run listens on the configured address and serves until ctx is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.opts.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.opts.Addr, err)
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves on ln until ctx is cancelled, then shuts down gracefully.
+//
+// Once the listener is accepting connections systemd is notified that the
+// service is ready, and if the systemd watchdog is enabled it is pinged for as
+// long as the server runs. On shutdown /readyz starts failing immediately so
+// load balancers stop routing new requests.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	logger := logging.FromContext(ctx)
+
+	httpServer := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		// Requests log to the logger Serve was given
+		BaseContext: func(net.Listener) context.Context {
+			return logging.NewContext(context.Background(), logger)
+		},
+	}
+
+	if s.opts.TLSConfig != nil {
+		ln = tls.NewListener(ln, s.opts.TLSConfig)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.Serve(ln)
+	}()
+
+	logger.Info("Listening", "address", ln.Addr().String())
+	if _, err := systemd.Notify(systemd.StateReady); err != nil {
+		logger.Warn("Failed to notify systemd", "error", err)
+	}
+
+	watchdogCtx, stopWatchdog := context.WithCancel(ctx)
+	defer stopWatchdog()
+	if interval, ok := systemd.WatchdogInterval(); ok {
+		go runWatchdog(watchdogCtx, interval)
+	}
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	logger.Info("Shutting down")
+	s.draining.Store(true)
+	if _, err := systemd.Notify(systemd.StateStopping); err != nil {
+		logger.Warn("Failed to notify systemd", "error", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.opts.ShutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down cleanly: %w", err)
+	}
+
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server failed: %w", err)
+	}
+	return nil
+}
+
+// runWatchdog pings the systemd watchdog until ctx is cancelled.
+func runWatchdog(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := systemd.Notify(systemd.StateWatchdog); err != nil {
+				logging.FromContext(ctx).Warn("Failed to ping systemd watchdog", "error", err)
+			}
+		}
+	}
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz runs all ready checks and reports each result, in the style of
+// the Kubernetes API server's verbose readyz output.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	ready := true
+
+	if s.draining.Load() {
+		ready = false
+		b.WriteString("[-]shutdown: server is shutting down\n")
+	}
+
+	names := make([]string, 0, len(s.opts.ReadyChecks))
+	for name := range s.opts.ReadyChecks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		err := s.opts.ReadyChecks[name](ctx)
+		cancel()
+
+		if err != nil {
+			ready = false
+			fmt.Fprintf(&b, "[-]%s failed: %v\n", name, err)
+		} else {
+			fmt.Fprintf(&b, "[+]%s ok\n", name)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if ready {
+		b.WriteString("readyz check passed\n")
+		w.WriteHeader(http.StatusOK)
+	} else {
+		b.WriteString("readyz check failed\n")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_, _ = fmt.Fprint(w, b.String())
+}
@@ -0,0 +1,57 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jbweber/foundry/internal/history"
+)
+
+// TestMain keeps the events recorded by the tests out of the real history.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "foundry-events-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	_ = os.Setenv(history.EnvVar, dir)
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestManager_History(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(history.EnvVar, dir)
+
+	_, mgr := newTestManager()
+	ctx := context.Background()
+	if _, err := mgr.Create(ctx, "test-vm", CreateOptions{Name: "base"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := mgr.Revert(ctx, "test-vm", "base", RevertOptions{}); err != nil {
+		t.Fatalf("Revert() error = %v", err)
+	}
+	// Failures are not recorded
+	if err := mgr.Revert(ctx, "test-vm", "missing", RevertOptions{}); err == nil {
+		t.Fatal("Revert() of a missing snapshot succeeded")
+	}
+	if err := mgr.Delete(ctx, "test-vm", "base", false); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	events, err := history.List(dir, history.Connection(), "test-vm")
+	if err != nil {
+		t.Fatalf("history.List() error = %v", err)
+	}
+	var got []string
+	for _, ev := range events {
+		got = append(got, ev.Type+" "+ev.Message)
+	}
+	want := []string{"SnapshotTaken Snapshot base taken", "SnapshotReverted Reverted to snapshot base", "SnapshotDeleted Snapshot base deleted"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,131 @@
+package snapshot
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/digitalocean/go-libvirt"
+	libvirtxml "libvirt.org/go/libvirtxml"
+)
+
+// mockLibvirtClient is a mock implementation of LibvirtClient for testing.
+type mockLibvirtClient struct {
+	domains   map[string]string // domain name -> domain XML
+	snapshots map[string][]*mockSnapshot
+	current   string
+
+	// Recorded calls
+	createXML   string
+	createFlags uint32
+	revertFlags uint32
+	deleteFlags libvirt.DomainSnapshotDeleteFlags
+	reverted    string
+	deleted     string
+	refreshed   []string
+}
+
+type mockSnapshot struct {
+	name string
+	xml  string
+}
+
+func newMockLibvirtClient() *mockLibvirtClient {
+	return &mockLibvirtClient{
+		domains:   make(map[string]string),
+		snapshots: make(map[string][]*mockSnapshot),
+	}
+}
+
+func (m *mockLibvirtClient) DomainLookupByName(name string) (libvirt.Domain, error) {
+	if _, ok := m.domains[name]; !ok {
+		return libvirt.Domain{}, fmt.Errorf("domain not found: %s", name)
+	}
+	return libvirt.Domain{Name: name}, nil
+}
+
+func (m *mockLibvirtClient) DomainGetXMLDesc(dom libvirt.Domain, _ libvirt.DomainXMLFlags) (string, error) {
+	return m.domains[dom.Name], nil
+}
+
+func (m *mockLibvirtClient) DomainSnapshotCreateXML(dom libvirt.Domain, xmlDesc string, flags uint32) (libvirt.DomainSnapshot, error) {
+	m.createXML = xmlDesc
+	m.createFlags = flags
+
+	var desc libvirtxml.DomainSnapshot
+	if err := xml.Unmarshal([]byte(xmlDesc), &desc); err != nil {
+		return libvirt.DomainSnapshot{}, err
+	}
+	if desc.Name == "" {
+		desc.Name = "1700000000"
+	}
+	m.snapshots[dom.Name] = append(m.snapshots[dom.Name], &mockSnapshot{name: desc.Name, xml: xmlDesc})
+	m.current = desc.Name
+
+	return libvirt.DomainSnapshot{Name: desc.Name, Dom: dom}, nil
+}
+
+func (m *mockLibvirtClient) DomainListAllSnapshots(dom libvirt.Domain, _ int32, _ uint32) ([]libvirt.DomainSnapshot, int32, error) {
+	var snaps []libvirt.DomainSnapshot
+	for _, s := range m.snapshots[dom.Name] {
+		snaps = append(snaps, libvirt.DomainSnapshot{Name: s.name, Dom: dom})
+	}
+	return snaps, int32(len(snaps)), nil
+}
+
+func (m *mockLibvirtClient) DomainSnapshotLookupByName(dom libvirt.Domain, name string, _ uint32) (libvirt.DomainSnapshot, error) {
+	if m.find(dom.Name, name) == nil {
+		return libvirt.DomainSnapshot{}, fmt.Errorf("snapshot not found: %s", name)
+	}
+	return libvirt.DomainSnapshot{Name: name, Dom: dom}, nil
+}
+
+func (m *mockLibvirtClient) DomainSnapshotGetXMLDesc(snap libvirt.DomainSnapshot, _ uint32) (string, error) {
+	s := m.find(snap.Dom.Name, snap.Name)
+	if s == nil {
+		return "", fmt.Errorf("snapshot not found: %s", snap.Name)
+	}
+	return s.xml, nil
+}
+
+func (m *mockLibvirtClient) DomainSnapshotIsCurrent(snap libvirt.DomainSnapshot, _ uint32) (int32, error) {
+	if snap.Name == m.current {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (m *mockLibvirtClient) DomainRevertToSnapshot(snap libvirt.DomainSnapshot, flags uint32) error {
+	m.reverted = snap.Name
+	m.revertFlags = flags
+	m.current = snap.Name
+	return nil
+}
+
+func (m *mockLibvirtClient) DomainSnapshotDelete(snap libvirt.DomainSnapshot, flags libvirt.DomainSnapshotDeleteFlags) error {
+	m.deleted = snap.Name
+	m.deleteFlags = flags
+	return nil
+}
+
+func (m *mockLibvirtClient) StorageVolLookupByPath(path string) (libvirt.StorageVol, error) {
+	return libvirt.StorageVol{Pool: "foundry-vms", Name: path[strings.LastIndex(path, "/")+1:], Key: path}, nil
+}
+
+func (m *mockLibvirtClient) StoragePoolLookupByVolume(vol libvirt.StorageVol) (libvirt.StoragePool, error) {
+	return libvirt.StoragePool{Name: vol.Pool}, nil
+}
+
+func (m *mockLibvirtClient) StoragePoolRefresh(pool libvirt.StoragePool, _ uint32) error {
+	m.refreshed = append(m.refreshed, pool.Name)
+	return nil
+}
+
+func (m *mockLibvirtClient) find(domain, name string) *mockSnapshot {
+	for _, s := range m.snapshots[domain] {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+// Package snapshot manages libvirt domain snapshots of foundry VMs.
+//
+// Two kinds of snapshots are supported:
+//   - Internal: stored inside the VM's qcow2 volumes. Taken while the VM is
+//     running they also capture memory, so reverting resumes the VM exactly
+//     where it was.
+//   - External (disk-only): libvirt freezes the current volumes and redirects
+//     writes to new qcow2 overlay files created next to them. Only disk state
+//     is captured; with Quiesce the guest agent flushes filesystems first.
+//
+// Both kinds require the VM's disks to be qcow2. Read-only disks such as the
+// cloud-init ISO are excluded from snapshots.
+package snapshot
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	libvirtxml "libvirt.org/go/libvirtxml"
+
+	"github.com/jbweber/foundry/internal/history"
+	"github.com/jbweber/foundry/internal/logging"
+)
+
+// LibvirtClient defines the minimal libvirt operations needed for snapshot management.
+//
+// This interface is defined on the consumer side (this package) following the
+// same pattern as storage.LibvirtClient. *libvirt.Libvirt satisfies it
+// implicitly:
+//
+//	client, err := libvirt.Connect("", 5*time.Second)
+//	if err != nil {
+//	    return err
+//	}
+//	defer client.Close()
+//
+//	mgr := snapshot.NewManager(client.Libvirt())
+type LibvirtClient interface {
+	DomainLookupByName(Name string) (libvirt.Domain, error)
+	DomainGetXMLDesc(Dom libvirt.Domain, Flags libvirt.DomainXMLFlags) (string, error)
+	DomainSnapshotCreateXML(Dom libvirt.Domain, XMLDesc string, Flags uint32) (libvirt.DomainSnapshot, error)
+	DomainListAllSnapshots(Dom libvirt.Domain, NeedResults int32, Flags uint32) ([]libvirt.DomainSnapshot, int32, error)
+	DomainSnapshotLookupByName(Dom libvirt.Domain, Name string, Flags uint32) (libvirt.DomainSnapshot, error)
+	DomainSnapshotGetXMLDesc(Snap libvirt.DomainSnapshot, Flags uint32) (string, error)
+	DomainSnapshotIsCurrent(Snap libvirt.DomainSnapshot, Flags uint32) (int32, error)
+	DomainRevertToSnapshot(Snap libvirt.DomainSnapshot, Flags uint32) error
+	DomainSnapshotDelete(Snap libvirt.DomainSnapshot, Flags libvirt.DomainSnapshotDeleteFlags) error
+	StorageVolLookupByPath(Path string) (libvirt.StorageVol, error)
+	StoragePoolLookupByVolume(Vol libvirt.StorageVol) (libvirt.StoragePool, error)
+	StoragePoolRefresh(Pool libvirt.StoragePool, Flags uint32) error
+}
+
+// Kind is where snapshot data is stored.
+type Kind string
+
+const (
+	// KindInternal snapshots live inside the VM's qcow2 volumes.
+	KindInternal Kind = "internal"
+
+	// KindExternal snapshots redirect writes to new qcow2 overlay files.
+	KindExternal Kind = "external"
+)
+
+// CreateOptions configures a new snapshot.
+type CreateOptions struct {
+	// Name of the snapshot. If empty, libvirt names it after the current
+	// Unix time.
+	Name string
+
+	// Description is an optional human-readable note.
+	Description string
+
+	// DiskOnly creates an external, disk-only snapshot instead of an
+	// internal one.
+	DiskOnly bool
+
+	// Quiesce asks the guest agent to freeze filesystems while the snapshot
+	// is taken. Only valid with DiskOnly on a running VM.
+	Quiesce bool
+}
+
+// RevertOptions configures a revert.
+type RevertOptions struct {
+	// Running starts the VM after reverting, regardless of the state the
+	// snapshot was taken in.
+	Running bool
+
+	// Paused leaves the VM paused after reverting.
+	Paused bool
+}
+
+// Info describes an existing snapshot.
+type Info struct {
+	Name        string    `json:"name" yaml:"name"`
+	Description string    `json:"description,omitempty" yaml:"description,omitempty"`
+	Created     time.Time `json:"created" yaml:"created"`
+	// State is the VM state when the snapshot was taken (e.g., "running",
+	// "shutoff", "disk-snapshot").
+	State   string `json:"state" yaml:"state"`
+	Kind    Kind   `json:"kind" yaml:"kind"`
+	Parent  string `json:"parent,omitempty" yaml:"parent,omitempty"`
+	Current bool   `json:"current" yaml:"current"`
+}
+
+// Manager creates, lists, reverts and deletes VM snapshots.
+type Manager struct {
+	client LibvirtClient
+}
+
+// NewManager creates a new snapshot manager.
+// Accepts any type implementing LibvirtClient (both *libvirt.Libvirt and test mocks).
+func NewManager(client LibvirtClient) *Manager {
+	return &Manager{
+		client: client,
+	}
+}
+
+// Create takes a snapshot of a VM and returns its name.
+func (m *Manager) Create(ctx context.Context, vmName string, opts CreateOptions) (string, error) {
+	if opts.Quiesce && !opts.DiskOnly {
+		return "", errors.New("quiesce is only supported for disk-only snapshots")
+	}
+
+	domain, err := m.client.DomainLookupByName(vmName)
+	if err != nil {
+		return "", fmt.Errorf("VM %s not found: %w", vmName, err)
+	}
+
+	disks, err := m.domainDisks(domain)
+	if err != nil {
+		return "", err
+	}
+
+	kind := KindInternal
+	var flags libvirt.DomainSnapshotCreateFlags
+	if opts.DiskOnly {
+		kind = KindExternal
+		flags |= libvirt.DomainSnapshotCreateDiskOnly | libvirt.DomainSnapshotCreateAtomic
+	}
+	if opts.Quiesce {
+		flags |= libvirt.DomainSnapshotCreateQuiesce
+	}
+
+	snapshotXML, err := generateSnapshotXML(opts, kind, disks)
+	if err != nil {
+		return "", err
+	}
+
+	snap, err := m.client.DomainSnapshotCreateXML(domain, snapshotXML, uint32(flags))
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot: %w", err)
+	}
+
+	if opts.DiskOnly {
+		// The overlays are new files next to the volumes; refresh their pools
+		// so they become volumes and are cleaned up when the VM is destroyed.
+		m.refreshPools(ctx, disks)
+	}
+
+	history.Record(ctx, vmName, history.TypeSnapshotTaken, fmt.Sprintf("Snapshot %s taken", snap.Name))
+	return snap.Name, nil
+}
+
+// List returns the snapshots of a VM, parents before children.
+func (m *Manager) List(_ context.Context, vmName string) ([]Info, error) {
+	domain, err := m.client.DomainLookupByName(vmName)
+	if err != nil {
+		return nil, fmt.Errorf("VM %s not found: %w", vmName, err)
+	}
+
+	snaps, _, err := m.client.DomainListAllSnapshots(domain, 1, uint32(libvirt.DomainSnapshotListTopological))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	infos := make([]Info, 0, len(snaps))
+	for _, snap := range snaps {
+		info, err := m.info(snap)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, *info)
+	}
+
+	return infos, nil
+}
+
+// Revert restores a VM to a snapshot. Changes made since the snapshot are
+// lost.
+func (m *Manager) Revert(ctx context.Context, vmName, name string, opts RevertOptions) error {
+	if opts.Running && opts.Paused {
+		return errors.New("running and paused are mutually exclusive")
+	}
+
+	snap, err := m.lookup(vmName, name)
+	if err != nil {
+		return err
+	}
+
+	var flags libvirt.DomainSnapshotRevertFlags
+	if opts.Running {
+		flags |= libvirt.DomainSnapshotRevertRunning
+	}
+	if opts.Paused {
+		flags |= libvirt.DomainSnapshotRevertPaused
+	}
+
+	if err := m.client.DomainRevertToSnapshot(snap, uint32(flags)); err != nil {
+		return fmt.Errorf("failed to revert to snapshot %s: %w", name, err)
+	}
+
+	history.Record(ctx, vmName, history.TypeSnapshotReverted, fmt.Sprintf("Reverted to snapshot %s", name))
+	return nil
+}
+
+// Delete removes a snapshot. If children is true, snapshots descending from
+// it are removed too; otherwise they are re-parented by libvirt.
+func (m *Manager) Delete(ctx context.Context, vmName, name string, children bool) error {
+	snap, err := m.lookup(vmName, name)
+	if err != nil {
+		return err
+	}
+
+	var flags libvirt.DomainSnapshotDeleteFlags
+	if children {
+		flags |= libvirt.DomainSnapshotDeleteChildren
+	}
+
+	if err := m.client.DomainSnapshotDelete(snap, flags); err != nil {
+		return fmt.Errorf("failed to delete snapshot %s: %w", name, err)
+	}
+
+	history.Record(ctx, vmName, history.TypeSnapshotDeleted, fmt.Sprintf("Snapshot %s deleted", name))
+	return nil
+}
+
+// lookup finds a snapshot of a VM by name.
+func (m *Manager) lookup(vmName, name string) (libvirt.DomainSnapshot, error) {
+	domain, err := m.client.DomainLookupByName(vmName)
+	if err != nil {
+		return libvirt.DomainSnapshot{}, fmt.Errorf("VM %s not found: %w", vmName, err)
+	}
+
+	snap, err := m.client.DomainSnapshotLookupByName(domain, name, 0)
+	if err != nil {
+		return libvirt.DomainSnapshot{}, fmt.Errorf("snapshot %s of VM %s not found: %w", name, vmName, err)
+	}
+
+	return snap, nil
+}
+
+// info reads the description of a snapshot.
+func (m *Manager) info(snap libvirt.DomainSnapshot) (*Info, error) {
+	snapXML, err := m.client.DomainSnapshotGetXMLDesc(snap, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get XML of snapshot %s: %w", snap.Name, err)
+	}
+
+	var desc libvirtxml.DomainSnapshot
+	if err := xml.Unmarshal([]byte(snapXML), &desc); err != nil {
+		return nil, fmt.Errorf("failed to parse XML of snapshot %s: %w", snap.Name, err)
+	}
+
+	info := &Info{
+		Name:        snap.Name,
+		Description: desc.Description,
+		State:       desc.State,
+		Kind:        snapshotKind(&desc),
+	}
+	if desc.Parent != nil {
+		info.Parent = desc.Parent.Name
+	}
+	if secs, err := strconv.ParseInt(desc.CreationTime, 10, 64); err == nil {
+		info.Created = time.Unix(secs, 0)
+	}
+
+	current, err := m.client.DomainSnapshotIsCurrent(snap, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check whether snapshot %s is current: %w", snap.Name, err)
+	}
+	info.Current = current == 1
+
+	return info, nil
+}
+
+// domainDisks returns the disks of a domain, checking that every writable
+// disk is qcow2.
+func (m *Manager) domainDisks(domain libvirt.Domain) ([]libvirtxml.DomainDisk, error) {
+	domainXML, err := m.client.DomainGetXMLDesc(domain, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain XML: %w", err)
+	}
+
+	var desc libvirtxml.Domain
+	if err := xml.Unmarshal([]byte(domainXML), &desc); err != nil {
+		return nil, fmt.Errorf("failed to parse domain XML: %w", err)
+	}
+	if desc.Devices == nil {
+		return nil, nil
+	}
+
+	for _, disk := range desc.Devices.Disks {
+		if excluded(disk) {
+			continue
+		}
+		format := ""
+		if disk.Driver != nil {
+			format = disk.Driver.Type
+		}
+		if format != "qcow2" {
+			return nil, fmt.Errorf("disk %s is %q, snapshots require qcow2 disks", diskTarget(disk), format)
+		}
+	}
+
+	return desc.Devices.Disks, nil
+}
+
+// refreshPools refreshes the storage pools holding the snapshotted disks.
+func (m *Manager) refreshPools(ctx context.Context, disks []libvirtxml.DomainDisk) {
+	logger := logging.FromContext(ctx)
+
+	refreshed := make(map[string]bool)
+	for _, disk := range disks {
+		if excluded(disk) || disk.Source == nil || disk.Source.File == nil {
+			continue
+		}
+		vol, err := m.client.StorageVolLookupByPath(disk.Source.File.File)
+		if err != nil {
+			logger.Warn("Disk is not a storage volume", "device", diskTarget(disk), "error", err)
+			continue
+		}
+		if refreshed[vol.Pool] {
+			continue
+		}
+		pool, err := m.client.StoragePoolLookupByVolume(vol)
+		if err != nil {
+			logger.Warn("Failed to find pool of disk", "device", diskTarget(disk), "error", err)
+			continue
+		}
+		if err := m.client.StoragePoolRefresh(pool, 0); err != nil {
+			logger.Warn("Failed to refresh pool", "pool", pool.Name, "error", err)
+			continue
+		}
+		refreshed[vol.Pool] = true
+	}
+}
+
+// generateSnapshotXML builds the snapshot description, listing every disk
+// with the kind of snapshot to take of it.
+func generateSnapshotXML(opts CreateOptions, kind Kind, disks []libvirtxml.DomainDisk) (string, error) {
+	desc := &libvirtxml.DomainSnapshot{
+		Name:        opts.Name,
+		Description: opts.Description,
+	}
+
+	if len(disks) > 0 {
+		desc.Disks = &libvirtxml.DomainSnapshotDisks{}
+		for _, disk := range disks {
+			snapshot := string(kind)
+			if excluded(disk) {
+				snapshot = "no"
+			}
+			desc.Disks.Disks = append(desc.Disks.Disks, libvirtxml.DomainSnapshotDisk{
+				Name:     diskTarget(disk),
+				Snapshot: snapshot,
+			})
+		}
+	}
+
+	out, err := desc.Marshal()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate snapshot XML: %w", err)
+	}
+	return out, nil
+}
+
+// snapshotKind reports whether any disk of a snapshot is external.
+func snapshotKind(desc *libvirtxml.DomainSnapshot) Kind {
+	if desc.Memory != nil && desc.Memory.Snapshot == "external" {
+		return KindExternal
+	}
+	if desc.Disks != nil {
+		for _, disk := range desc.Disks.Disks {
+			if disk.Snapshot == "external" {
+				return KindExternal
+			}
+		}
+	}
+	return KindInternal
+}
+
+// excluded reports whether a disk is left out of snapshots: cdroms and
+// read-only disks such as the cloud-init ISO.
+func excluded(disk libvirtxml.DomainDisk) bool {
+	return disk.Device == "cdrom" || disk.Device == "floppy" || disk.ReadOnly != nil
+}
+
+func diskTarget(disk libvirtxml.DomainDisk) string {
+	if disk.Target == nil {
+		return ""
+	}
+	return disk.Target.Dev
+}
@@ -0,0 +1,267 @@
+package snapshot
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+)
+
+// testDomainXML has a qcow2 boot disk, a qcow2 data disk and a cloud-init ISO,
+// like VMs created by foundry.
+const testDomainXML = `<domain type="kvm">
+  <name>test-vm</name>
+  <devices>
+    <disk type="file" device="disk">
+      <driver name="qemu" type="qcow2"/>
+      <source file="/var/lib/libvirt/images/foundry-vms/test-vm_boot"/>
+      <target dev="vda" bus="virtio"/>
+    </disk>
+    <disk type="file" device="disk">
+      <driver name="qemu" type="qcow2"/>
+      <source file="/var/lib/libvirt/images/foundry-vms/test-vm_data-vdb"/>
+      <target dev="vdb" bus="virtio"/>
+    </disk>
+    <disk type="file" device="cdrom">
+      <driver name="qemu" type="raw"/>
+      <source file="/var/lib/libvirt/images/foundry-vms/test-vm_cloudinit.iso"/>
+      <target dev="sda" bus="sata"/>
+      <readonly/>
+    </disk>
+  </devices>
+</domain>`
+
+func newTestManager() (*mockLibvirtClient, *Manager) {
+	mock := newMockLibvirtClient()
+	mock.domains["test-vm"] = testDomainXML
+	return mock, NewManager(mock)
+}
+
+func TestManager_Create(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      CreateOptions
+		wantFlags libvirt.DomainSnapshotCreateFlags
+		wantDisk  string
+	}{
+		{
+			name:      "internal",
+			opts:      CreateOptions{Name: "before-upgrade", Description: "pre dnf upgrade"},
+			wantFlags: 0,
+			wantDisk:  `<disk name="vda" snapshot="internal">`,
+		},
+		{
+			name:      "disk-only",
+			opts:      CreateOptions{Name: "nightly", DiskOnly: true},
+			wantFlags: libvirt.DomainSnapshotCreateDiskOnly | libvirt.DomainSnapshotCreateAtomic,
+			wantDisk:  `<disk name="vda" snapshot="external">`,
+		},
+		{
+			name:      "disk-only quiesced",
+			opts:      CreateOptions{Name: "nightly", DiskOnly: true, Quiesce: true},
+			wantFlags: libvirt.DomainSnapshotCreateDiskOnly | libvirt.DomainSnapshotCreateAtomic | libvirt.DomainSnapshotCreateQuiesce,
+			wantDisk:  `<disk name="vdb" snapshot="external">`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, mgr := newTestManager()
+
+			name, err := mgr.Create(context.Background(), "test-vm", tt.opts)
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			if name != tt.opts.Name {
+				t.Errorf("Create() = %q, want %q", name, tt.opts.Name)
+			}
+			if mock.createFlags != uint32(tt.wantFlags) {
+				t.Errorf("flags = %d, want %d", mock.createFlags, tt.wantFlags)
+			}
+			if !strings.Contains(mock.createXML, tt.wantDisk) {
+				t.Errorf("snapshot XML missing %s:\n%s", tt.wantDisk, mock.createXML)
+			}
+			if !strings.Contains(mock.createXML, `<disk name="sda" snapshot="no">`) {
+				t.Errorf("cloud-init ISO not excluded:\n%s", mock.createXML)
+			}
+
+			// Overlays of disk-only snapshots are picked up by refreshing the pool once
+			wantRefreshed := 0
+			if tt.opts.DiskOnly {
+				wantRefreshed = 1
+			}
+			if len(mock.refreshed) != wantRefreshed {
+				t.Errorf("refreshed pools %v, want %d refresh(es)", mock.refreshed, wantRefreshed)
+			}
+		})
+	}
+}
+
+func TestManager_Create_GeneratedName(t *testing.T) {
+	_, mgr := newTestManager()
+
+	name, err := mgr.Create(context.Background(), "test-vm", CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if name == "" {
+		t.Error("Create() returned empty name")
+	}
+}
+
+func TestManager_Create_Errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		vmName    string
+		domainXML string
+		opts      CreateOptions
+		wantErr   string
+	}{
+		{
+			name:    "VM not found",
+			vmName:  "missing",
+			wantErr: "not found",
+		},
+		{
+			name:    "quiesce without disk-only",
+			vmName:  "test-vm",
+			opts:    CreateOptions{Quiesce: true},
+			wantErr: "only supported for disk-only",
+		},
+		{
+			name:   "raw disk",
+			vmName: "test-vm",
+			domainXML: `<domain><name>test-vm</name><devices>
+  <disk type="file" device="disk"><driver name="qemu" type="raw"/><target dev="vda"/></disk>
+</devices></domain>`,
+			wantErr: `disk vda is "raw"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, mgr := newTestManager()
+			if tt.domainXML != "" {
+				mock.domains["test-vm"] = tt.domainXML
+			}
+
+			_, err := mgr.Create(context.Background(), tt.vmName, tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Create() error = %v, want %q", err, tt.wantErr)
+			}
+			if mock.createXML != "" {
+				t.Error("snapshot was created despite error")
+			}
+		})
+	}
+}
+
+func TestManager_List(t *testing.T) {
+	mock, mgr := newTestManager()
+	mock.snapshots["test-vm"] = []*mockSnapshot{
+		{name: "base", xml: `<domainsnapshot>
+  <name>base</name>
+  <description>fresh install</description>
+  <state>shutoff</state>
+  <creationTime>1700000000</creationTime>
+  <disks><disk name="vda" snapshot="internal"/></disks>
+</domainsnapshot>`},
+		{name: "nightly", xml: `<domainsnapshot>
+  <name>nightly</name>
+  <state>disk-snapshot</state>
+  <creationTime>1700086400</creationTime>
+  <parent><name>base</name></parent>
+  <memory snapshot="no"/>
+  <disks><disk name="vda" snapshot="external"/></disks>
+</domainsnapshot>`},
+	}
+	mock.current = "nightly"
+
+	infos, err := mgr.List(context.Background(), "test-vm")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("List() returned %d snapshots, want 2", len(infos))
+	}
+
+	base := infos[0]
+	if base.Name != "base" || base.Description != "fresh install" || base.State != "shutoff" ||
+		base.Kind != KindInternal || base.Parent != "" || base.Current {
+		t.Errorf("base = %+v", base)
+	}
+	if !base.Created.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("base.Created = %v", base.Created)
+	}
+
+	nightly := infos[1]
+	if nightly.Kind != KindExternal || nightly.Parent != "base" || !nightly.Current {
+		t.Errorf("nightly = %+v", nightly)
+	}
+}
+
+func TestManager_Revert(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      RevertOptions
+		wantFlags libvirt.DomainSnapshotRevertFlags
+		wantErr   bool
+	}{
+		{name: "snapshot state", opts: RevertOptions{}, wantFlags: 0},
+		{name: "running", opts: RevertOptions{Running: true}, wantFlags: libvirt.DomainSnapshotRevertRunning},
+		{name: "paused", opts: RevertOptions{Paused: true}, wantFlags: libvirt.DomainSnapshotRevertPaused},
+		{name: "running and paused", opts: RevertOptions{Running: true, Paused: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, mgr := newTestManager()
+			if _, err := mgr.Create(context.Background(), "test-vm", CreateOptions{Name: "base"}); err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+
+			err := mgr.Revert(context.Background(), "test-vm", "base", tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Revert() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if mock.reverted != "base" || mock.revertFlags != uint32(tt.wantFlags) {
+				t.Errorf("reverted %q with flags %d, want base with %d", mock.reverted, mock.revertFlags, tt.wantFlags)
+			}
+		})
+	}
+}
+
+func TestManager_Revert_NotFound(t *testing.T) {
+	_, mgr := newTestManager()
+
+	err := mgr.Revert(context.Background(), "test-vm", "missing", RevertOptions{})
+	if err == nil || !strings.Contains(err.Error(), "snapshot missing of VM test-vm not found") {
+		t.Errorf("Revert() error = %v", err)
+	}
+}
+
+func TestManager_Delete(t *testing.T) {
+	for _, children := range []bool{false, true} {
+		mock, mgr := newTestManager()
+		if _, err := mgr.Create(context.Background(), "test-vm", CreateOptions{Name: "base"}); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+
+		if err := mgr.Delete(context.Background(), "test-vm", "base", children); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+
+		var want libvirt.DomainSnapshotDeleteFlags
+		if children {
+			want = libvirt.DomainSnapshotDeleteChildren
+		}
+		if mock.deleted != "base" || mock.deleteFlags != want {
+			t.Errorf("children=%v: deleted %q with flags %d, want base with %d", children, mock.deleted, mock.deleteFlags, want)
+		}
+	}
+}
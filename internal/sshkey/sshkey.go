@@ -0,0 +1,104 @@
+// Package sshkey locates and checks SSH public keys, such as the invoking
+// user's default key that 'foundry create --with-my-key' injects into a VM.
+package sshkey
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultKeyFiles are the public keys looked for in ~/.ssh, in order of
+// preference.
+var defaultKeyFiles = []string{"id_ed25519.pub", "id_ecdsa.pub", "id_rsa.pub"}
+
+// keyTypes are the public key algorithms accepted in authorized_keys.
+var keyTypes = map[string]bool{
+	"ssh-ed25519":                        true,
+	"ssh-rsa":                            true,
+	"ecdsa-sha2-nistp256":                true,
+	"ecdsa-sha2-nistp384":                true,
+	"ecdsa-sha2-nistp521":                true,
+	"sk-ssh-ed25519@openssh.com":         true,
+	"sk-ecdsa-sha2-nistp256@openssh.com": true,
+}
+
+// DefaultPublicKey returns the current user's default SSH public key: the
+// first of ~/.ssh/id_ed25519.pub, id_ecdsa.pub and id_rsa.pub that exists.
+func DefaultPublicKey() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine home directory: %w", err)
+	}
+	return defaultPublicKeyIn(filepath.Join(home, ".ssh"))
+}
+
+// defaultPublicKeyIn returns the first default public key found in dir.
+func defaultPublicKeyIn(dir string) (string, error) {
+	for _, name := range defaultKeyFiles {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read SSH public key: %w", err)
+		}
+
+		key := strings.TrimSpace(string(data))
+		if err := Validate(key); err != nil {
+			return "", fmt.Errorf("%s: %w", path, err)
+		}
+		return key, nil
+	}
+	return "", fmt.Errorf("no SSH public key found in %s (looked for %s); create one with ssh-keygen",
+		dir, strings.Join(defaultKeyFiles, ", "))
+}
+
+// Normalize returns key with surrounding whitespace removed and its type, key
+// data and comment separated by single spaces.
+func Normalize(key string) string {
+	return strings.Join(strings.Fields(key), " ")
+}
+
+// Data returns the base64 key data of a key, which identifies it regardless
+// of its comment.
+func Data(key string) string {
+	fields := strings.Fields(key)
+	if len(fields) < 2 {
+		return ""
+	}
+	return fields[1]
+}
+
+// Comment returns the comment of a key, usually naming its owner (e.g.,
+// "alice@laptop"), or "" if it has none.
+func Comment(key string) string {
+	fields := strings.Fields(key)
+	if len(fields) < 3 {
+		return ""
+	}
+	return strings.Join(fields[2:], " ")
+}
+
+// Validate checks that key is a single public key in authorized_keys format:
+// "<type> <base64 blob> [comment]".
+func Validate(key string) error {
+	if strings.ContainsAny(key, "\r\n") {
+		return fmt.Errorf("SSH public key must be a single line")
+	}
+	fields := strings.Fields(key)
+	if len(fields) < 2 {
+		return fmt.Errorf("SSH public key must have a type and key data")
+	}
+	if !keyTypes[fields[0]] {
+		return fmt.Errorf("unsupported SSH public key type %q", fields[0])
+	}
+	if _, err := base64.StdEncoding.DecodeString(fields[1]); err != nil {
+		return fmt.Errorf("SSH public key data is not valid base64")
+	}
+	return nil
+}
@@ -117,6 +117,12 @@ func MarkCloudInitReady(vm *v1alpha1.VirtualMachine) {
 	SetCondition(vm, v1alpha1.ConditionCloudInitReady, v1alpha1.ConditionTrue, "CloudInitGenerated", "Cloud-init ISO created and attached")
 }
 
+// MarkCloudInitServed marks the cloud-init condition as True for a seed the
+// guest fetches over HTTP instead of from an ISO.
+func MarkCloudInitServed(vm *v1alpha1.VirtualMachine, url string) {
+	SetCondition(vm, v1alpha1.ConditionCloudInitReady, v1alpha1.ConditionTrue, "CloudInitServed", "Cloud-init seed served at "+url)
+}
+
 // MarkCloudInitFailed marks the cloud-init condition as False.
 func MarkCloudInitFailed(vm *v1alpha1.VirtualMachine, err error) {
 	SetCondition(vm, v1alpha1.ConditionCloudInitReady, v1alpha1.ConditionFalse, "CloudInitFailed", err.Error())
@@ -330,6 +330,24 @@ func TestMarkCloudInitReady(t *testing.T) {
 	}
 }
 
+func TestMarkCloudInitServed(t *testing.T) {
+	vm := v1alpha1.NewVirtualMachine("test-vm")
+
+	MarkCloudInitServed(vm, "http://10.0.0.1:8090/")
+
+	if !IsConditionTrue(vm, v1alpha1.ConditionCloudInitReady) {
+		t.Error("Expected CloudInitReady condition to be True")
+	}
+
+	cond := GetCondition(vm, v1alpha1.ConditionCloudInitReady)
+	if cond.Reason != "CloudInitServed" {
+		t.Errorf("Expected reason 'CloudInitServed', got %s", cond.Reason)
+	}
+	if cond.Message != "Cloud-init seed served at http://10.0.0.1:8090/" {
+		t.Errorf("Expected the seed URL in the message, got %s", cond.Message)
+	}
+}
+
 func TestMarkCloudInitFailed(t *testing.T) {
 	vm := v1alpha1.NewVirtualMachine("test-vm")
 	testErr := errors.New("cloud-init generation failed")
@@ -68,6 +68,29 @@ func TransitionToFailed(vm *v1alpha1.VirtualMachine, reason, message string) {
 	SetCondition(vm, v1alpha1.ConditionReady, v1alpha1.ConditionFalse, reason, message)
 }
 
+// PhaseForDomainState maps a libvirt domain state to the VM phase it
+// corresponds to. Blocked, paused and suspended VMs count as running.
+func PhaseForDomainState(state int32) v1alpha1.VMPhase {
+	switch state {
+	case 0: // no state
+		return v1alpha1.VMPhasePending
+	case 1: // running
+		return v1alpha1.VMPhaseRunning
+	case 2, 3: // blocked, paused
+		return v1alpha1.VMPhaseRunning // Still counts as running
+	case 4: // shutdown (in progress)
+		return v1alpha1.VMPhaseStopping
+	case 5: // shutoff
+		return v1alpha1.VMPhaseStopped
+	case 6: // crashed
+		return v1alpha1.VMPhaseFailed
+	case 7: // pmsuspended
+		return v1alpha1.VMPhaseRunning
+	default:
+		return v1alpha1.VMPhasePending // Use Pending for unknown states
+	}
+}
+
 // IsTerminal returns true if the phase is terminal (Stopped or Failed).
 // Terminal phases mean the VM is not running and won't transition automatically.
 func IsTerminal(phase v1alpha1.VMPhase) bool {
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	libvirtxml "libvirt.org/go/libvirtxml"
+
+	"github.com/jbweber/foundry/internal/naming"
+)
+
+// ErrImageInUse is returned when deleting an image that volumes are still
+// backed by.
+var ErrImageInUse = errors.New("image in use")
+
+// BackingDependent is a volume whose qcow2 backing chain includes an image.
+type BackingDependent struct {
+	Pool   string `json:"pool" yaml:"pool"`                 // Pool of the volume
+	Volume string `json:"volume" yaml:"volume"`             // Volume name
+	VM     string `json:"vm,omitempty" yaml:"vm,omitempty"` // VM the volume belongs to, from its name
+	Path   string `json:"path" yaml:"path"`                 // Full path to the volume
+	Parent string `json:"parent" yaml:"parent"`             // Path of the volume's backing file
+}
+
+// ImageDependents returns the volumes, in every active pool, whose backing
+// chain includes the image imageName: overlays on the image itself and
+// overlays on those, such as the disks of linked clones. Volumes are sorted
+// by pool and name.
+func (m *Manager) ImageDependents(ctx context.Context, imageName string) ([]BackingDependent, error) {
+	imagePath, err := m.GetImagePath(ctx, imageName)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes, err := m.backedVolumes()
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk the chains from the image, one layer of overlays at a time
+	chain := map[string]bool{imagePath: true}
+	var dependents []BackingDependent
+	for added := true; added; {
+		added = false
+		for _, vol := range volumes {
+			if chain[vol.Parent] && !chain[vol.Path] {
+				chain[vol.Path] = true
+				dependents = append(dependents, vol)
+				added = true
+			}
+		}
+	}
+
+	sort.Slice(dependents, func(i, j int) bool {
+		if dependents[i].Pool != dependents[j].Pool {
+			return dependents[i].Pool < dependents[j].Pool
+		}
+		return dependents[i].Volume < dependents[j].Volume
+	})
+	return dependents, nil
+}
+
+// backedVolumes returns the volumes of every active pool that have a backing
+// file. Pools and volumes that cannot be read are skipped.
+func (m *Manager) backedVolumes() ([]BackingDependent, error) {
+	pools, _, err := m.client.ConnectListAllStoragePools(1, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pools: %w", err)
+	}
+
+	var backed []BackingDependent
+	for _, pool := range pools {
+		volumes, _, err := m.client.StoragePoolListAllVolumes(pool, 1, 0)
+		if err != nil {
+			// Inactive pools have no volumes to list
+			continue
+		}
+
+		for _, vol := range volumes {
+			xmlDesc, err := m.client.StorageVolGetXMLDesc(vol, 0)
+			if err != nil {
+				continue
+			}
+			var volDef libvirtxml.StorageVolume
+			if err := volDef.Unmarshal(xmlDesc); err != nil {
+				continue
+			}
+			if volDef.BackingStore == nil || volDef.BackingStore.Path == "" {
+				continue
+			}
+
+			path, err := m.client.StorageVolGetPath(vol)
+			if err != nil {
+				continue
+			}
+			vmName, _ := naming.VMNameFromVolume(vol.Name)
+			backed = append(backed, BackingDependent{
+				Pool:   pool.Name,
+				Volume: vol.Name,
+				VM:     vmName,
+				Path:   path,
+				Parent: volDef.BackingStore.Path,
+			})
+		}
+	}
+	return backed, nil
+}
+
+// dependentNames returns the VMs owning dependents, or pool/volume for
+// volumes that belong to no VM, without duplicates.
+func dependentNames(dependents []BackingDependent) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, dep := range dependents {
+		name := dep.VM
+		if name == "" {
+			name = dep.Pool + "/" + dep.Volume
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// checkImageUnused returns an error wrapping ErrImageInUse, naming the
+// dependent VMs, if any volume is backed by imageName.
+func (m *Manager) checkImageUnused(ctx context.Context, imageName string) error {
+	dependents, err := m.ImageDependents(ctx, imageName)
+	if err != nil {
+		return fmt.Errorf("failed to check volumes backed by image %s: %w", imageName, err)
+	}
+	if len(dependents) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is the backing image of %d volume(s) of: %s",
+		ErrImageInUse, imageName, len(dependents), strings.Join(dependentNames(dependents), ", "))
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// setupBackingChain creates the fedora-43.qcow2 image, web's boot disk backed
+// by it, the boot disk of web's linked clone backed by that, and db's boot
+// disk backed by another image.
+func setupBackingChain(t *testing.T) *Manager {
+	t.Helper()
+	ctx := context.Background()
+	mgr := NewManager(newMockLibvirtClient())
+	if err := mgr.EnsureDefaultPools(ctx); err != nil {
+		t.Fatalf("EnsureDefaultPools() error = %v", err)
+	}
+
+	create := func(pool string, spec VolumeSpec) string {
+		t.Helper()
+		if err := mgr.CreateVolume(ctx, pool, spec); err != nil {
+			t.Fatalf("CreateVolume(%s) error = %v", spec.Name, err)
+		}
+		path, err := mgr.GetVolumePath(ctx, pool, spec.Name)
+		if err != nil {
+			t.Fatalf("GetVolumePath(%s) error = %v", spec.Name, err)
+		}
+		return path
+	}
+
+	image := create(DefaultImagesPool, VolumeSpec{Name: "fedora-43.qcow2", Type: VolumeTypeBaseImage, Format: VolumeFormatQCOW2, CapacityGB: 5})
+	other := create(DefaultImagesPool, VolumeSpec{Name: "debian-12.qcow2", Type: VolumeTypeBaseImage, Format: VolumeFormatQCOW2, CapacityGB: 5})
+	webBoot := create(DefaultVMsPool, VolumeSpec{Name: "web_boot.qcow2", Type: VolumeTypeBoot, Format: VolumeFormatQCOW2, CapacityGB: 20, BackingVolume: image})
+	create(DefaultVMsPool, VolumeSpec{Name: "web-clone_boot.qcow2", Type: VolumeTypeBoot, Format: VolumeFormatQCOW2, CapacityGB: 20, BackingVolume: webBoot})
+	create(DefaultVMsPool, VolumeSpec{Name: "web_data-vdb.qcow2", Type: VolumeTypeData, Format: VolumeFormatQCOW2, CapacityGB: 20})
+	create(DefaultVMsPool, VolumeSpec{Name: "db_boot.qcow2", Type: VolumeTypeBoot, Format: VolumeFormatQCOW2, CapacityGB: 20, BackingVolume: other})
+	return mgr
+}
+
+func TestManager_ImageDependents(t *testing.T) {
+	mgr := setupBackingChain(t)
+
+	dependents, err := mgr.ImageDependents(context.Background(), "fedora-43.qcow2")
+	if err != nil {
+		t.Fatalf("ImageDependents() error = %v", err)
+	}
+	var got []string
+	for _, dep := range dependents {
+		got = append(got, dep.VM+":"+dep.Volume)
+	}
+	want := "web-clone:web-clone_boot.qcow2 web:web_boot.qcow2"
+	if strings.Join(got, " ") != want {
+		t.Errorf("ImageDependents() = %v, want %s", got, want)
+	}
+
+	if _, err := mgr.ImageDependents(context.Background(), "missing.qcow2"); err == nil {
+		t.Error("ImageDependents() of a missing image expected error")
+	}
+}
+
+func TestManager_DeleteImage_InUse(t *testing.T) {
+	ctx := context.Background()
+	mgr := setupBackingChain(t)
+
+	err := mgr.DeleteImage(ctx, "fedora-43.qcow2", false)
+	if !errors.Is(err, ErrImageInUse) {
+		t.Fatalf("DeleteImage() error = %v, want ErrImageInUse", err)
+	}
+	if !strings.Contains(err.Error(), "web-clone, web") {
+		t.Errorf("DeleteImage() error = %v, want the dependent VMs listed", err)
+	}
+	if exists, _ := mgr.ImageExists(ctx, "fedora-43.qcow2"); !exists {
+		t.Fatal("DeleteImage() deleted an image in use")
+	}
+
+	if err := mgr.DeleteImage(ctx, "fedora-43.qcow2", true); err != nil {
+		t.Fatalf("DeleteImage(force) error = %v", err)
+	}
+	if exists, _ := mgr.ImageExists(ctx, "fedora-43.qcow2"); exists {
+		t.Error("DeleteImage(force) did not delete the image")
+	}
+}
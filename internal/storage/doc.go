@@ -12,6 +12,11 @@
 //   - foundry-images: Base OS images shared across VMs
 //   - foundry-vms: VM-specific volumes (boot disks, data disks, cloud-init ISOs)
 //
+// Further pools can be directories (dir), LVM volume groups (logical),
+// mounted block device filesystems (fs) or NFS exports (netfs). Logical pools
+// only hold raw volumes; raw volumes cannot have a backing volume, so they are
+// created as copies of their image instead (VolumeSpec.SourceVolume).
+//
 // Volume Naming Convention:
 //
 // Volumes follow a predictable naming pattern (see internal/naming package):
@@ -26,6 +31,9 @@
 //   - RAW: MBR signature 0x55aa at offset 510
 //   - Rejects format mismatches (e.g., RAW file with .qcow2 extension)
 //
+// The same detection sets the backing format of new qcow2 overlays, since
+// modern qemu refuses backing files whose format is not given explicitly.
+//
 // Consumer-Side Interface:
 //
 // The LibvirtClient interface is defined by consumers (e.g., internal/vm)
@@ -0,0 +1,390 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// progressInterval limits how often download progress is reported.
+const progressInterval = 250 * time.Millisecond
+
+// DownloadProgress reports the progress of an image download.
+type DownloadProgress struct {
+	// Downloaded is the number of bytes on disk so far, including any
+	// bytes from a resumed partial download.
+	Downloaded int64
+
+	// Total is the full size in bytes, or -1 if the server did not report it.
+	Total int64
+}
+
+// Percent returns the completion percentage (0-100), or -1 if the total
+// size is unknown.
+func (p DownloadProgress) Percent() float64 {
+	if p.Total <= 0 {
+		return -1
+	}
+	return float64(p.Downloaded) / float64(p.Total) * 100
+}
+
+// URLImportOptions configures ImportImageFromURL.
+type URLImportOptions struct {
+	// SHA256 is the expected hex-encoded SHA-256 of the image. If set, the
+	// download is verified before it is imported.
+	SHA256 string
+
+	// SHA512 is the expected hex-encoded SHA-512 of the image, for sources
+	// that only publish SHA-512 sums. Verified like SHA256.
+	SHA512 string
+
+	// DownloadDir is where partial downloads are kept so an interrupted
+	// download can be resumed. Defaults to $XDG_CACHE_HOME/foundry/downloads.
+	DownloadDir string
+
+	// Progress, if non-nil, is called periodically while downloading.
+	Progress func(DownloadProgress)
+
+	// HTTPClient is used for the download. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// ImportOptions rewrites the downloaded image before it is imported.
+	ImportOptions
+}
+
+// ImportImageFromURL downloads a base image over HTTP(S) and imports it into
+// the foundry-images pool.
+//
+// The image is streamed to a partial file in opts.DownloadDir, keyed by image
+// name and URL. If a partial file from an earlier attempt exists, the download
+// resumes from where it stopped using an HTTP Range request guarded by
+// If-Range, so it restarts if the remote file changed or the server does not
+// support ranges. Once complete, the file is checked against opts.SHA256 (if
+// set), validated, rewritten as configured by opts.ImportOptions and imported
+// exactly like ImportImage, then removed. The import lock is taken before
+// downloading, so a concurrent import of the same image name fails fast with
+// ErrImportInProgress.
+func (m *Manager) ImportImageFromURL(ctx context.Context, rawURL, imageName string, opts URLImportOptions) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid image URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q (must be http or https)", u.Scheme)
+	}
+
+	// Fail fast on a bad name instead of after a long download. The name
+	// also names the partial file, so it must not leave the download directory
+	if imageName == "" || imageName != filepath.Base(imageName) || imageName[0] == '.' {
+		return fmt.Errorf("invalid image name %q", imageName)
+	}
+	ext := filepath.Ext(imageName)
+	if ext != ".qcow2" && ext != ".raw" {
+		return fmt.Errorf("image name must have .qcow2 or .raw extension (got: %q)", imageName)
+	}
+	if err := opts.validate(imageName); err != nil {
+		return err
+	}
+
+	checks := []checksum{
+		{algorithm: "sha256", expected: opts.SHA256, newHash: sha256.New},
+		{algorithm: "sha512", expected: opts.SHA512, newHash: sha512.New},
+	}
+	for i := range checks {
+		c := &checks[i]
+		c.expected = strings.ToLower(strings.TrimSpace(c.expected))
+		if c.expected == "" {
+			continue
+		}
+		if decoded, err := hex.DecodeString(c.expected); err != nil || len(decoded) != c.newHash().Size() {
+			return fmt.Errorf("invalid %s checksum %q", c.algorithm, c.expected)
+		}
+	}
+
+	release, err := m.lockImageImport(ctx, imageName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	downloadDir := opts.DownloadDir
+	if downloadDir == "" {
+		downloadDir, err = defaultDownloadDir()
+		if err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(downloadDir, 0755); err != nil {
+		return fmt.Errorf("failed to create download directory: %w", err)
+	}
+
+	partPath := partialPath(downloadDir, u.String(), imageName)
+	if err := downloadFile(ctx, u.String(), partPath, opts); err != nil {
+		return err
+	}
+
+	for _, c := range checks {
+		if c.expected == "" {
+			continue
+		}
+		actualSum, err := fileDigest(partPath, c.newHash())
+		if err != nil {
+			return err
+		}
+		if actualSum != c.expected {
+			// A corrupt partial file would otherwise be resumed forever
+			removePartial(partPath)
+			return fmt.Errorf("checksum mismatch: expected %s %s, got %s", c.algorithm, c.expected, actualSum)
+		}
+	}
+
+	if err := m.importImage(ctx, partPath, u.Redacted(), imageName, opts.ImportOptions); err != nil {
+		return err
+	}
+
+	removePartial(partPath)
+	return nil
+}
+
+// partialPath returns the partial download file for imageName fetched from
+// rawURL. Keying it by URL keeps downloads of the same name from different
+// sources from being spliced together.
+func partialPath(downloadDir, rawURL, imageName string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(downloadDir, imageName+"."+hex.EncodeToString(sum[:8])+".part")
+}
+
+// partialMeta is stored next to a partial download and records what it was
+// downloaded from, so a resume only continues the same remote file.
+type partialMeta struct {
+	URL string `json:"url"`
+
+	// Validator is the strong ETag or Last-Modified date of the remote file,
+	// sent as If-Range when resuming.
+	Validator string `json:"validator"`
+}
+
+// metaPath returns the sidecar file holding the partialMeta of path.
+func metaPath(path string) string {
+	return path + ".json"
+}
+
+// readPartialMeta returns the validator to resume path from rawURL with, or
+// "" if the partial file cannot be safely resumed.
+func readPartialMeta(path, rawURL string) string {
+	data, err := os.ReadFile(metaPath(path))
+	if err != nil {
+		return ""
+	}
+	var meta partialMeta
+	if err := json.Unmarshal(data, &meta); err != nil || meta.URL != rawURL {
+		return ""
+	}
+	return meta.Validator
+}
+
+// writePartialMeta records the validator of the remote file being downloaded
+// to path. Without a validator the sidecar is removed, so the download is not
+// resumed.
+func writePartialMeta(path, rawURL string, header http.Header) error {
+	validator := header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		// If-Range only accepts strong ETags
+		validator = header.Get("Last-Modified")
+	}
+	if validator == "" {
+		if err := os.Remove(metaPath(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove download metadata: %w", err)
+		}
+		return nil
+	}
+	data, err := json.Marshal(partialMeta{URL: rawURL, Validator: validator})
+	if err != nil {
+		return fmt.Errorf("failed to encode download metadata: %w", err)
+	}
+	if err := os.WriteFile(metaPath(path), data, 0644); err != nil {
+		return fmt.Errorf("failed to write download metadata: %w", err)
+	}
+	return nil
+}
+
+// removePartial removes a partial download and its metadata.
+func removePartial(path string) {
+	_ = os.Remove(path)
+	_ = os.Remove(metaPath(path))
+}
+
+// defaultDownloadDir returns the directory used for partial image downloads.
+func defaultDownloadDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine cache directory: %w", err)
+	}
+	return filepath.Join(cacheDir, "foundry", "downloads"), nil
+}
+
+// downloadFile downloads rawURL into path, resuming from the existing size of
+// path when the server supports range requests and the remote file still
+// matches the validator recorded for the partial file.
+func downloadFile(ctx context.Context, rawURL, path string, opts URLImportOptions) error {
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var offset int64
+	validator := readPartialMeta(path, rawURL)
+	if info, err := os.Stat(path); err == nil && validator != "" {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	total := int64(-1)
+	flags := os.O_CREATE | os.O_WRONLY
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Full content - start over even if a partial file exists
+		offset = 0
+		flags |= os.O_TRUNC
+		if resp.ContentLength >= 0 {
+			total = resp.ContentLength
+		}
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+		total = parseContentRangeTotal(resp.Header.Get("Content-Range"))
+	case http.StatusRequestedRangeNotSatisfiable:
+		if offset == 0 {
+			return fmt.Errorf("failed to download %s: %s", rawURL, resp.Status)
+		}
+		if resp.Header.Get("Content-Range") == fmt.Sprintf("bytes */%d", offset) {
+			// The partial file already holds the whole image
+			return nil
+		}
+		// The partial file does not match the remote file; start over
+		_ = resp.Body.Close()
+		removePartial(path)
+		return downloadFile(ctx, rawURL, path, opts)
+	default:
+		return fmt.Errorf("failed to download %s: %s", rawURL, resp.Status)
+	}
+
+	if offset == 0 {
+		if err := writePartialMeta(path, rawURL, resp.Header); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open download file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	pw := &progressWriter{
+		downloaded: offset,
+		total:      total,
+		report:     opts.Progress,
+	}
+	if _, err := io.Copy(f, io.TeeReader(resp.Body, pw)); err != nil {
+		return fmt.Errorf("download interrupted after %d bytes (re-run to resume): %w", pw.downloaded, err)
+	}
+	pw.flush()
+
+	if total >= 0 && pw.downloaded != total {
+		return fmt.Errorf("download incomplete: got %d of %d bytes (re-run to resume)", pw.downloaded, total)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write download file: %w", err)
+	}
+	return nil
+}
+
+// parseContentRangeTotal extracts the total size from a Content-Range header
+// such as "bytes 100-999/1000". Returns -1 if the total is unknown.
+func parseContentRangeTotal(header string) int64 {
+	idx := strings.LastIndex(header, "/")
+	if idx < 0 {
+		return -1
+	}
+	total, err := strconv.ParseInt(header[idx+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return total
+}
+
+// checksum is an expected digest of a downloaded image.
+type checksum struct {
+	algorithm string
+	expected  string
+	newHash   func() hash.Hash
+}
+
+// fileDigest returns the hex-encoded digest of a file computed with h.
+func fileDigest(path string, h hash.Hash) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file for checksum: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to compute checksum: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// progressWriter counts bytes written and reports progress at most every
+// progressInterval.
+type progressWriter struct {
+	downloaded int64
+	total      int64
+	report     func(DownloadProgress)
+	last       time.Time
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.downloaded += int64(len(p))
+	if w.report != nil && time.Since(w.last) >= progressInterval {
+		w.flush()
+	}
+	return len(p), nil
+}
+
+// flush reports the current progress unconditionally.
+func (w *progressWriter) flush() {
+	if w.report == nil {
+		return
+	}
+	w.last = time.Now()
+	w.report(DownloadProgress{Downloaded: w.downloaded, Total: w.total})
+}
@@ -0,0 +1,377 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testQCOW2Image returns a small fake QCOW2 image.
+func testQCOW2Image() []byte {
+	data := []byte{0x51, 0x46, 0x49, 0xfb, 0x00, 0x00, 0x00, 0x03}
+	data = append(data, bytes.Repeat([]byte{0xab}, 4096)...)
+	return data
+}
+
+// newImageServer serves data at /image.qcow2 with range support and records
+// the Range header of each request. The ETag is derived from data.
+func newImageServer(t *testing.T, data []byte, ranges *[]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ranges != nil {
+			*ranges = append(*ranges, r.Header.Get("Range"))
+		}
+		if r.URL.Path != "/image.qcow2" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", imageETag(data))
+		http.ServeContent(w, r, "image.qcow2", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newImportManager(t *testing.T) (*Manager, *mockLibvirtClient) {
+	t.Helper()
+	mockClient := newMockLibvirtClient()
+	mgr := NewManager(mockClient)
+	if err := mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath}); err != nil {
+		t.Fatalf("CreatePool() error = %v", err)
+	}
+	return mgr, mockClient
+}
+
+// imageETag returns the ETag newImageServer serves data with.
+func imageETag(data []byte) string {
+	return `"` + sha256Hex(data)[:16] + `"`
+}
+
+// assertNoPartial fails the test if downloadDir still holds any partial
+// download files.
+func assertNoPartial(t *testing.T, downloadDir string) {
+	t.Helper()
+	entries, err := os.ReadDir(downloadDir)
+	if err != nil {
+		t.Fatalf("failed to read download directory: %v", err)
+	}
+	for _, e := range entries {
+		t.Errorf("unexpected file %s left in download directory", e.Name())
+	}
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestManager_ImportImageFromURL(t *testing.T) {
+	data := testQCOW2Image()
+	srv := newImageServer(t, data, nil)
+	mgr, mockClient := newImportManager(t)
+	downloadDir := t.TempDir()
+
+	var reports []DownloadProgress
+	err := mgr.ImportImageFromURL(context.Background(), srv.URL+"/image.qcow2", "fedora-43.qcow2", URLImportOptions{
+		SHA256:      sha256Hex(data),
+		DownloadDir: downloadDir,
+		Progress:    func(p DownloadProgress) { reports = append(reports, p) },
+	})
+	if err != nil {
+		t.Fatalf("ImportImageFromURL() error = %v", err)
+	}
+
+	vol := mockClient.volumes[DefaultImagesPool]["fedora-43.qcow2"]
+	if vol == nil {
+		t.Fatal("expected image volume to be created")
+	}
+	if !bytes.Equal(vol.data, data) {
+		t.Errorf("uploaded %d bytes, want %d", len(vol.data), len(data))
+	}
+
+	if len(reports) == 0 {
+		t.Fatal("expected progress reports")
+	}
+	last := reports[len(reports)-1]
+	if last.Downloaded != int64(len(data)) || last.Total != int64(len(data)) || last.Percent() != 100 {
+		t.Errorf("final progress = %+v", last)
+	}
+
+	assertNoPartial(t, downloadDir)
+}
+
+func TestManager_ImportImageFromURL_InProgress(t *testing.T) {
+	var ranges []string
+	srv := newImageServer(t, testQCOW2Image(), &ranges)
+	mgr, _ := newImportManager(t)
+	ctx := context.Background()
+
+	release, err := mgr.lockImageImport(ctx, "fedora-43.qcow2")
+	if err != nil {
+		t.Fatalf("lockImageImport() error = %v", err)
+	}
+	defer release()
+
+	err = mgr.ImportImageFromURL(ctx, srv.URL+"/image.qcow2", "fedora-43.qcow2", URLImportOptions{DownloadDir: t.TempDir()})
+	if !errors.Is(err, ErrImportInProgress) {
+		t.Fatalf("ImportImageFromURL() error = %v, want ErrImportInProgress", err)
+	}
+	if len(ranges) != 0 {
+		t.Errorf("made %d requests, want none before failing", len(ranges))
+	}
+}
+
+func TestManager_ImportImageFromURL_Resume(t *testing.T) {
+	data := testQCOW2Image()
+	changed := append(append([]byte{}, data[:1000]...), bytes.Repeat([]byte{0xcd}, 2000)...)
+
+	tests := []struct {
+		name       string
+		partial    []byte
+		meta       *partialMeta // nil writes no metadata
+		otherURL   bool
+		wantRanges []string
+	}{
+		{
+			name:       "same remote file",
+			partial:    data[:1000],
+			meta:       &partialMeta{Validator: imageETag(data)},
+			wantRanges: []string{"bytes=1000-"},
+		},
+		{
+			name:       "remote file changed",
+			partial:    changed[:1000],
+			meta:       &partialMeta{Validator: imageETag(changed)},
+			wantRanges: []string{"bytes=1000-"}, // If-Range fails, so the server sends it all
+		},
+		{
+			name:       "no validator",
+			partial:    bytes.Repeat([]byte{0xcd}, 1000),
+			wantRanges: []string{""},
+		},
+		{
+			name:       "different URL",
+			partial:    bytes.Repeat([]byte{0xcd}, 1000),
+			meta:       &partialMeta{Validator: imageETag(data)},
+			otherURL:   true,
+			wantRanges: []string{""},
+		},
+		{
+			name:       "already complete",
+			partial:    data,
+			meta:       &partialMeta{Validator: imageETag(data)},
+			wantRanges: []string{fmt.Sprintf("bytes=%d-", len(data))},
+		},
+		{
+			name:       "larger than remote file",
+			partial:    append(append([]byte{}, data...), 0xcd, 0xcd),
+			meta:       &partialMeta{Validator: imageETag(data)},
+			wantRanges: []string{fmt.Sprintf("bytes=%d-", len(data)+2), ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ranges []string
+			srv := newImageServer(t, data, &ranges)
+			mgr, mockClient := newImportManager(t)
+			downloadDir := t.TempDir()
+			rawURL := srv.URL + "/image.qcow2"
+
+			// Simulate an interrupted earlier download
+			partPath := partialPath(downloadDir, rawURL, "fedora-43.qcow2")
+			if err := os.WriteFile(partPath, tt.partial, 0644); err != nil {
+				t.Fatalf("failed to write partial file: %v", err)
+			}
+			if tt.meta != nil {
+				tt.meta.URL = rawURL
+				if tt.otherURL {
+					tt.meta.URL = srv.URL + "/other.qcow2"
+				}
+				metaData, _ := json.Marshal(tt.meta)
+				if err := os.WriteFile(metaPath(partPath), metaData, 0644); err != nil {
+					t.Fatalf("failed to write partial metadata: %v", err)
+				}
+			}
+
+			err := mgr.ImportImageFromURL(context.Background(), rawURL, "fedora-43.qcow2", URLImportOptions{
+				DownloadDir: downloadDir,
+			})
+			if err != nil {
+				t.Fatalf("ImportImageFromURL() error = %v", err)
+			}
+
+			if !slices.Equal(ranges, tt.wantRanges) {
+				t.Errorf("Range headers = %q, want %q", ranges, tt.wantRanges)
+			}
+			if !bytes.Equal(mockClient.volumes[DefaultImagesPool]["fedora-43.qcow2"].data, data) {
+				t.Error("imported image does not match source")
+			}
+			assertNoPartial(t, downloadDir)
+		})
+	}
+}
+
+func TestPartialPath(t *testing.T) {
+	a := partialPath("/dl", "https://a.example/image.qcow2", "fedora-43.qcow2")
+	b := partialPath("/dl", "https://b.example/image.qcow2", "fedora-43.qcow2")
+	if a == b {
+		t.Errorf("partial files of different URLs collide: %s", a)
+	}
+	if filepath.Dir(a) != "/dl" || !strings.HasPrefix(filepath.Base(a), "fedora-43.qcow2.") {
+		t.Errorf("partialPath() = %s, want fedora-43.qcow2.*.part in /dl", a)
+	}
+}
+
+func TestManager_ImportImageFromURL_ChecksumMismatch(t *testing.T) {
+	data := testQCOW2Image()
+	srv := newImageServer(t, data, nil)
+	mgr, mockClient := newImportManager(t)
+	downloadDir := t.TempDir()
+
+	err := mgr.ImportImageFromURL(context.Background(), srv.URL+"/image.qcow2", "fedora-43.qcow2", URLImportOptions{
+		SHA256:      strings.Repeat("0", 64),
+		DownloadDir: downloadDir,
+	})
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+	if _, ok := mockClient.volumes[DefaultImagesPool]["fedora-43.qcow2"]; ok {
+		t.Error("image should not be imported on checksum mismatch")
+	}
+	assertNoPartial(t, downloadDir)
+}
+
+func TestManager_ImportImageFromURL_Errors(t *testing.T) {
+	srv := newImageServer(t, testQCOW2Image(), nil)
+
+	tests := []struct {
+		name      string
+		url       string
+		imageName string
+		sha256    string
+		errMsg    string
+	}{
+		{
+			name:      "unsupported scheme",
+			url:       "ftp://example.com/image.qcow2",
+			imageName: "fedora-43.qcow2",
+			errMsg:    "unsupported URL scheme",
+		},
+		{
+			name:      "path in name",
+			url:       srv.URL + "/image.qcow2",
+			imageName: "../fedora-43.qcow2",
+			errMsg:    "invalid image name",
+		},
+		{
+			name:      "hidden name",
+			url:       srv.URL + "/image.qcow2",
+			imageName: ".qcow2",
+			errMsg:    "invalid image name",
+		},
+		{
+			name:      "missing extension",
+			url:       srv.URL + "/image.qcow2",
+			imageName: "fedora-43",
+			errMsg:    "must have .qcow2 or .raw extension",
+		},
+		{
+			name:      "malformed checksum",
+			url:       srv.URL + "/image.qcow2",
+			imageName: "fedora-43.qcow2",
+			sha256:    "not-a-checksum",
+			errMsg:    "invalid sha256",
+		},
+		{
+			name:      "not found",
+			url:       srv.URL + "/missing.qcow2",
+			imageName: "fedora-43.qcow2",
+			errMsg:    "404",
+		},
+		{
+			name:      "format mismatch",
+			url:       srv.URL + "/image.qcow2",
+			imageName: "fedora-43.raw",
+			errMsg:    "format mismatch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr, _ := newImportManager(t)
+			err := mgr.ImportImageFromURL(context.Background(), tt.url, tt.imageName, URLImportOptions{
+				SHA256:      tt.sha256,
+				DownloadDir: t.TempDir(),
+			})
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("expected error containing %q, got %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestParseContentRangeTotal(t *testing.T) {
+	tests := []struct {
+		header string
+		want   int64
+	}{
+		{"bytes 100-999/1000", 1000},
+		{"bytes 0-0/*", -1},
+		{"", -1},
+	}
+
+	for _, tt := range tests {
+		if got := parseContentRangeTotal(tt.header); got != tt.want {
+			t.Errorf("parseContentRangeTotal(%q) = %d, want %d", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestManager_ImportImageFromURL_SHA512(t *testing.T) {
+	data := testQCOW2Image()
+	srv := newImageServer(t, data, nil)
+	sum := sha512.Sum512(data)
+
+	mgr, mockClient := newImportManager(t)
+	err := mgr.ImportImageFromURL(context.Background(), srv.URL+"/image.qcow2", "debian-12.qcow2", URLImportOptions{
+		SHA512:      hex.EncodeToString(sum[:]),
+		DownloadDir: t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("ImportImageFromURL() error = %v", err)
+	}
+	if _, ok := mockClient.volumes[DefaultImagesPool]["debian-12.qcow2"]; !ok {
+		t.Error("image was not imported")
+	}
+
+	mgr, _ = newImportManager(t)
+	err = mgr.ImportImageFromURL(context.Background(), srv.URL+"/image.qcow2", "debian-12.qcow2", URLImportOptions{
+		SHA512:      strings.Repeat("0", 128),
+		DownloadDir: t.TempDir(),
+	})
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch: expected sha512") {
+		t.Fatalf("expected sha512 checksum mismatch, got %v", err)
+	}
+
+	err = mgr.ImportImageFromURL(context.Background(), srv.URL+"/image.qcow2", "debian-12.qcow2", URLImportOptions{
+		SHA512:      sha256Hex(data),
+		DownloadDir: t.TempDir(),
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid sha512") {
+		t.Fatalf("expected invalid sha512 error for a sha256 digest, got %v", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 )
 
 // Magic bytes and signatures for disk image format detection
@@ -71,3 +72,36 @@ func DetectImageFormat(filePath string) (VolumeFormat, error) {
 
 	return "", fmt.Errorf("unsupported or invalid image: not qcow2 and missing boot sector signature (0x55aa at offset 510)")
 }
+
+// formatHeaderSize is how much of a volume detectBackingFormat reads.
+const formatHeaderSize = 512
+
+// detectBackingFormat returns the format of the backing volume at path from
+// its magic bytes: qcow2 if it starts with the qcow2 magic, raw otherwise.
+// Volumes that cannot be read (e.g., files outside any pool) fall back to
+// the format their extension suggests.
+func (m *Manager) detectBackingFormat(path string) VolumeFormat {
+	vol, err := m.client.StorageVolLookupByPath(path)
+	if err != nil {
+		return backingFormatFromPath(path)
+	}
+	var buf bytes.Buffer
+	if err := m.client.StorageVolDownload(vol, &buf, 0, formatHeaderSize, 0); err != nil || buf.Len() < len(qcow2Magic) {
+		return backingFormatFromPath(path)
+	}
+	if bytes.HasPrefix(buf.Bytes(), qcow2Magic) {
+		return VolumeFormatQCOW2
+	}
+	return VolumeFormatRaw
+}
+
+// backingFormatFromPath guesses the format of a backing volume from its
+// file extension: raw for .raw and .img, qcow2 otherwise.
+func backingFormatFromPath(path string) VolumeFormat {
+	switch filepath.Ext(path) {
+	case ".raw", ".img":
+		return VolumeFormatRaw
+	default:
+		return VolumeFormatQCOW2
+	}
+}
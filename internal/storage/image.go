@@ -1,28 +1,59 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/jbweber/foundry/internal/logging"
 )
 
 // ImportImage imports a base image from a local file into the foundry-images pool.
+//
+// Imports of the same image name exclude each other: while one runs, others
+// fail with ErrImportInProgress instead of writing to the same volume.
 func (m *Manager) ImportImage(ctx context.Context, filePath, imageName string) error {
-	// Check that the file exists
-	info, err := os.Stat(filePath)
+	return m.ImportImageWithOptions(ctx, filePath, imageName, ImportOptions{})
+}
+
+// ImportImageWithOptions imports a base image like ImportImage, rewriting it
+// first as configured by opts (e.g., compressed).
+func (m *Manager) ImportImageWithOptions(ctx context.Context, filePath, imageName string, opts ImportOptions) error {
+	release, err := m.lockImageImport(ctx, imageName)
 	if err != nil {
-		return fmt.Errorf("failed to stat image file: %w", err)
+		return err
 	}
+	defer release()
 
-	// Get file size in GB (rounded up)
-	sizeGB := uint64(info.Size()/(1024*1024*1024)) + 1
+	source, err := filepath.Abs(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve image file path: %w", err)
+	}
+	return m.importImage(ctx, filePath, source, imageName, opts)
+}
+
+// importImage imports a base image from a local file with the import lock of
+// imageName held. source is recorded as the image's origin.
+func (m *Manager) importImage(ctx context.Context, filePath, source, imageName string, opts ImportOptions) error {
+	// Check that the file exists
+	if _, err := os.Stat(filePath); err != nil {
+		return fmt.Errorf("failed to stat image file: %w", err)
+	}
 
 	// Validate image name has required extension
 	ext := filepath.Ext(imageName)
 	if ext != ".qcow2" && ext != ".raw" {
 		return fmt.Errorf("image name must have .qcow2 or .raw extension (got: %q)", imageName)
 	}
+	if err := opts.validate(imageName); err != nil {
+		return err
+	}
 
 	// Detect actual format from file content
 	detectedFormat, err := DetectImageFormat(filePath)
@@ -30,6 +61,16 @@ func (m *Manager) ImportImage(ctx context.Context, filePath, imageName string) e
 		return fmt.Errorf("failed to detect image format: %w", err)
 	}
 
+	// Rewritten images are converted to qcow2 whatever their source format
+	if opts.rewrites() {
+		rewritten, err := rewriteImage(ctx, filePath, detectedFormat, opts)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = os.Remove(rewritten) }()
+		filePath, detectedFormat = rewritten, VolumeFormatQCOW2
+	}
+
 	// Determine expected format from image name extension
 	var expectedFormat VolumeFormat
 	if ext == ".qcow2" {
@@ -44,6 +85,13 @@ func (m *Manager) ImportImage(ctx context.Context, filePath, imageName string) e
 			detectedFormat, imageName, expectedFormat)
 	}
 
+	// Get file size in GB (rounded up)
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat image file: %w", err)
+	}
+	sizeGB := uint64(info.Size()/(1024*1024*1024)) + 1
+
 	// Read the image file
 	data, err := os.ReadFile(filePath)
 	if err != nil {
@@ -61,17 +109,27 @@ func (m *Manager) ImportImage(ctx context.Context, filePath, imageName string) e
 		CapacityGB: sizeGB,
 	}
 
-	if err := m.CreateVolume(ctx, DefaultImagesPool, spec); err != nil {
+	if err := m.CreateVolume(ctx, ImagesPool(), spec); err != nil {
 		return fmt.Errorf("failed to create image volume: %w", err)
 	}
 
 	// Upload the image data to the volume
-	if err := m.WriteVolumeData(ctx, DefaultImagesPool, imageName, data); err != nil {
+	if err := m.WriteVolumeData(ctx, ImagesPool(), imageName, data); err != nil {
 		// Clean up the volume if upload fails
-		_ = m.DeleteVolume(ctx, DefaultImagesPool, imageName)
+		_ = m.DeleteVolume(ctx, ImagesPool(), imageName)
 		return fmt.Errorf("failed to upload image data: %w", err)
 	}
 
+	// The image is usable without its metadata, so a failure is not fatal
+	meta := opts.Metadata
+	sum := sha256.Sum256(data)
+	meta.Source = source
+	meta.Checksum = "sha256:" + hex.EncodeToString(sum[:])
+	meta.ImportedAt = time.Now().UTC().Truncate(time.Second)
+	if err := m.SetImageMetadata(ctx, imageName, meta); err != nil {
+		logging.FromContext(ctx).Warn("Failed to record image metadata", "image", imageName, "error", err)
+	}
+
 	return nil
 }
 
@@ -81,30 +139,112 @@ func (m *Manager) PullImage(ctx context.Context, url, imageName, checksum string
 	return fmt.Errorf("pull image is not yet implemented")
 }
 
-// ListImages lists all base images in the foundry-images pool.
+// ListImages lists all base images in the foundry-images pool. Image
+// metadata and import lock volumes are not listed.
 func (m *Manager) ListImages(ctx context.Context) ([]VolumeInfo, error) {
-	return m.ListVolumes(ctx, DefaultImagesPool)
+	volumes, err := m.ListVolumes(ctx, ImagesPool())
+	if err != nil {
+		return nil, err
+	}
+
+	var images []VolumeInfo
+	for _, volume := range volumes {
+		if !isImageMetadataVolume(volume.Name) && !isImportLockVolume(volume.Name) {
+			images = append(images, volume)
+		}
+	}
+	return images, nil
+}
+
+// ImageNames returns the names of the base images in the foundry-images
+// pool, sorted. Unlike ListImages it makes no call per image.
+func (m *Manager) ImageNames(_ context.Context) ([]string, error) {
+	pool, err := m.client.StoragePoolLookupByName(ImagesPool())
+	if err != nil {
+		return nil, fmt.Errorf("pool not found: %w", err)
+	}
+	volumes, _, err := m.client.StoragePoolListAllVolumes(pool, 1, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+
+	names := []string{}
+	for _, volume := range volumes {
+		if !isImageMetadataVolume(volume.Name) && !isImportLockVolume(volume.Name) {
+			names = append(names, volume.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
 }
 
 // DeleteImage deletes a base image from the foundry-images pool.
-// If force is true, the image is deleted even if it's being used as a backing file.
+// Unless force is true, images that volumes are backed by (see
+// ImageDependents) are not deleted: the error wraps ErrImageInUse and names
+// the dependent VMs.
 func (m *Manager) DeleteImage(ctx context.Context, imageName string, force bool) error {
-	// TODO: If force is false, check if the image is being used as a backing file
-	// This would require iterating through all VMs and checking their backing stores
-	// For now, we just delete the image regardless of force flag
+	if !force {
+		if err := m.checkImageUnused(ctx, imageName); err != nil {
+			return err
+		}
+	}
 
-	// Note: force parameter is reserved for future use when we implement backing file checks
-	_ = force
+	if err := m.DeleteVolume(ctx, ImagesPool(), imageName); err != nil {
+		return err
+	}
 
-	return m.DeleteVolume(ctx, DefaultImagesPool, imageName)
+	// Remove the image's metadata along with it
+	metadataVolume := imageMetadataVolume(imageName)
+	if exists, _ := m.VolumeExists(ctx, ImagesPool(), metadataVolume); exists {
+		if err := m.DeleteVolume(ctx, ImagesPool(), metadataVolume); err != nil {
+			return fmt.Errorf("failed to delete image metadata: %w", err)
+		}
+	}
+	return nil
 }
 
 // GetImagePath gets the full filesystem path for a base image.
 func (m *Manager) GetImagePath(ctx context.Context, imageName string) (string, error) {
-	return m.GetVolumePath(ctx, DefaultImagesPool, imageName)
+	return m.GetVolumePath(ctx, ImagesPool(), imageName)
 }
 
 // ImageExists checks if a base image exists in the foundry-images pool.
 func (m *Manager) ImageExists(ctx context.Context, imageName string) (bool, error) {
-	return m.VolumeExists(ctx, DefaultImagesPool, imageName)
+	return m.VolumeExists(ctx, ImagesPool(), imageName)
+}
+
+// imageFingerprintSize is how much of an image ImageFingerprint hashes.
+const imageFingerprintSize = 1024 * 1024
+
+// ImageFingerprint returns "sha256:<hex>" of the first MiB of an image and its
+// capacity. The start of an image holds its header (for qcow2, its size and
+// cluster tables), so the fingerprint changes when the image is replaced,
+// while computing it stays cheap over remote connections.
+func (m *Manager) ImageFingerprint(_ context.Context, imageName string) (string, error) {
+	pool, err := m.client.StoragePoolLookupByName(ImagesPool())
+	if err != nil {
+		return "", fmt.Errorf("pool not found: %w", err)
+	}
+	vol, err := m.client.StorageVolLookupByName(pool, imageName)
+	if err != nil {
+		return "", fmt.Errorf("volume not found: %w", err)
+	}
+	_, capacity, _, err := m.client.StorageVolGetInfo(vol)
+	if err != nil {
+		return "", fmt.Errorf("failed to get volume info: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := m.client.StorageVolDownload(vol, &buf, 0, imageFingerprintSize, 0); err != nil {
+		return "", fmt.Errorf("failed to read image %s: %w", imageName, err)
+	}
+	data := buf.Bytes()
+	if len(data) > imageFingerprintSize {
+		data = data[:imageFingerprintSize]
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d\n", capacity)
+	hash.Write(data)
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
 }
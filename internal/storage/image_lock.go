@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	libvirtxml "libvirt.org/go/libvirtxml"
+
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/process"
+)
+
+// ErrImportInProgress is returned when an image is imported while another
+// import of the same image name has not finished.
+var ErrImportInProgress = errors.New("import in progress")
+
+// importLockSuffix is appended to an image name to form the name of the
+// volume that marks an import of it as in progress, e.g.
+// "fedora-43.qcow2.import.lock".
+const importLockSuffix = ".import.lock"
+
+// importLockExpiry is how long an import lock taken on another host is
+// honored. Locks taken on this host are released as soon as their process
+// is gone.
+const importLockExpiry = 24 * time.Hour
+
+// importLockGrace is how long a lock volume that cannot be read is taken to
+// be still being written by its importer. Past it, the importer died between
+// creating and writing the lock, and the lock is stale.
+const importLockGrace = time.Minute
+
+// importLocks tracks the images being imported by this process, so that
+// imports running on different Managers (e.g. concurrent daemon requests)
+// exclude each other without a round trip to libvirt.
+var importLocks = struct {
+	mu   sync.Mutex
+	held map[string]bool
+}{held: make(map[string]bool)}
+
+// importLock is the content of an import lock volume.
+type importLock struct {
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// stale reports whether the import holding the lock can no longer be
+// running: its process is gone, or it was started on another host longer
+// than importLockExpiry ago.
+func (l importLock) stale(now time.Time) bool {
+	if host, err := os.Hostname(); err == nil && l.Host == host {
+		return !process.Running(l.PID)
+	}
+	return now.Sub(l.StartedAt) > importLockExpiry
+}
+
+// same reports whether l and other were written by the same import.
+func (l importLock) same(other importLock) bool {
+	return l.Host == other.Host && l.PID == other.PID && l.StartedAt.Equal(other.StartedAt)
+}
+
+func (l importLock) String() string {
+	return fmt.Sprintf("started %s by pid %d on %s", l.StartedAt.Format(time.RFC3339), l.PID, l.Host)
+}
+
+// importLockVolume returns the name of the lock volume of an image.
+func importLockVolume(imageName string) string {
+	return imageName + importLockSuffix
+}
+
+// isImportLockVolume reports whether a volume is an import lock.
+func isImportLockVolume(volumeName string) bool {
+	return strings.HasSuffix(volumeName, importLockSuffix)
+}
+
+// ImportInProgress reports whether an import of imageName is running, in
+// this process or, through its lock volume, in any other.
+func (m *Manager) ImportInProgress(ctx context.Context, imageName string) (bool, error) {
+	importLocks.mu.Lock()
+	held := importLocks.held[imageName]
+	importLocks.mu.Unlock()
+	if held {
+		return true, nil
+	}
+
+	exists, err := m.VolumeExists(ctx, ImagesPool(), importLockVolume(imageName))
+	if err != nil {
+		return false, fmt.Errorf("failed to check import lock: %w", err)
+	}
+	if !exists {
+		return false, nil
+	}
+	lock, err := m.readImportLock(ctx, imageName)
+	if err != nil {
+		// A lock being written is still a lock, until it is too old
+		return !m.abandonedImportLock(imageName, time.Now()), nil
+	}
+	return !lock.stale(time.Now()), nil
+}
+
+// lockImageImport takes the import lock of imageName, failing with
+// ErrImportInProgress if it is held. The lock is held in this process and as
+// a volume in the foundry-images pool, which every foundry process connected
+// to the same hypervisor sees. The returned function releases it.
+func (m *Manager) lockImageImport(ctx context.Context, imageName string) (func(), error) {
+	importLocks.mu.Lock()
+	if importLocks.held[imageName] {
+		importLocks.mu.Unlock()
+		return nil, fmt.Errorf("image %s: %w in this process", imageName, ErrImportInProgress)
+	}
+	importLocks.held[imageName] = true
+	importLocks.mu.Unlock()
+
+	releaseLocal := func() {
+		importLocks.mu.Lock()
+		delete(importLocks.held, imageName)
+		importLocks.mu.Unlock()
+	}
+
+	if err := m.createImportLock(ctx, imageName); err != nil {
+		releaseLocal()
+		return nil, err
+	}
+
+	return func() {
+		// The lock must go even if the import was cancelled
+		if err := m.DeleteVolume(context.WithoutCancel(ctx), ImagesPool(), importLockVolume(imageName)); err != nil {
+			logging.FromContext(ctx).Warn("Failed to release import lock", "image", imageName, "error", err)
+		}
+		releaseLocal()
+	}, nil
+}
+
+// createImportLock creates the lock volume of imageName. Creating a volume
+// that exists fails, so only one process can create it. A stale lock left by
+// an import that died is replaced.
+func (m *Manager) createImportLock(ctx context.Context, imageName string) error {
+	hostname, _ := os.Hostname()
+	data, err := json.Marshal(importLock{Host: hostname, PID: os.Getpid(), StartedAt: time.Now().UTC()})
+	if err != nil {
+		return fmt.Errorf("failed to encode import lock: %w", err)
+	}
+
+	volumeName := importLockVolume(imageName)
+	spec := VolumeSpec{
+		Name:   volumeName,
+		Type:   VolumeTypeMetadata,
+		Format: VolumeFormatRaw,
+	}
+	if err := m.CreateVolume(ctx, ImagesPool(), spec); err != nil {
+		exists, existsErr := m.VolumeExists(ctx, ImagesPool(), volumeName)
+		if existsErr != nil || !exists {
+			return fmt.Errorf("failed to create import lock: %w", err)
+		}
+
+		lock, readErr := m.readImportLock(ctx, imageName)
+		switch {
+		case readErr != nil && !m.abandonedImportLock(imageName, time.Now()):
+			return fmt.Errorf("image %s: %w (lock volume %s/%s cannot be read yet; delete it if no import is running)", imageName, ErrImportInProgress, ImagesPool(), volumeName)
+		case readErr == nil && !lock.stale(time.Now()):
+			return fmt.Errorf("image %s: %w (%s)", imageName, ErrImportInProgress, lock)
+		}
+
+		// Another importer that found the same stale lock may have replaced
+		// it since; its lock must not be deleted. A lock it has created but
+		// not written yet cannot be read and is new, which counts as held
+		// too.
+		current, currentErr := m.readImportLock(ctx, imageName)
+		if readErr != nil {
+			if currentErr == nil || !m.abandonedImportLock(imageName, time.Now()) {
+				return fmt.Errorf("image %s: %w", imageName, ErrImportInProgress)
+			}
+		} else if currentErr != nil || !current.same(*lock) {
+			return fmt.Errorf("image %s: %w", imageName, ErrImportInProgress)
+		}
+
+		description := "never written"
+		if lock != nil {
+			description = lock.String()
+		}
+		logging.FromContext(ctx).Warn("Replacing stale import lock", "image", imageName, "lock", description)
+		if err := m.DeleteVolume(ctx, ImagesPool(), volumeName); err != nil {
+			return fmt.Errorf("failed to remove stale import lock: %w", err)
+		}
+		if err := m.CreateVolume(ctx, ImagesPool(), spec); err != nil {
+			// Another process replaced it first
+			return fmt.Errorf("image %s: %w", imageName, ErrImportInProgress)
+		}
+	}
+
+	if err := m.WriteVolumeData(ctx, ImagesPool(), volumeName, data); err != nil {
+		_ = m.DeleteVolume(ctx, ImagesPool(), volumeName)
+		return fmt.Errorf("failed to write import lock: %w", err)
+	}
+	return nil
+}
+
+// abandonedImportLock reports whether the lock volume of imageName was last
+// written longer than importLockGrace before now. It reports false if libvirt
+// does not report when the volume was written.
+func (m *Manager) abandonedImportLock(imageName string, now time.Time) bool {
+	pool, err := m.client.StoragePoolLookupByName(ImagesPool())
+	if err != nil {
+		return false
+	}
+	vol, err := m.client.StorageVolLookupByName(pool, importLockVolume(imageName))
+	if err != nil {
+		return false
+	}
+	xmlDesc, err := m.client.StorageVolGetXMLDesc(vol, 0)
+	if err != nil {
+		return false
+	}
+	var volDef libvirtxml.StorageVolume
+	if err := volDef.Unmarshal(xmlDesc); err != nil {
+		return false
+	}
+	if volDef.Target == nil || volDef.Target.Timestamps == nil {
+		return false
+	}
+
+	// Timestamps are seconds since the epoch, with a fraction
+	seconds, _, _ := strings.Cut(volDef.Target.Timestamps.Mtime, ".")
+	mtime, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return false
+	}
+	return now.Sub(time.Unix(mtime, 0)) > importLockGrace
+}
+
+// readImportLock returns the content of the lock volume of imageName.
+func (m *Manager) readImportLock(ctx context.Context, imageName string) (*importLock, error) {
+	data, err := m.ReadVolumeData(ctx, ImagesPool(), importLockVolume(imageName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read import lock: %w", err)
+	}
+
+	// The volume may be padded beyond the JSON document
+	var lock importLock
+	if err := json.Unmarshal(bytes.TrimRight(data, "\x00"), &lock); err != nil {
+		return nil, fmt.Errorf("failed to decode import lock of %s: %w", imageName, err)
+	}
+	return &lock, nil
+}
@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+)
+
+// newImportLockManager returns a manager with an empty images pool and the
+// path of a qcow2 file to import.
+func newImportLockManager(t *testing.T) (*Manager, string) {
+	t.Helper()
+	mgr := NewManager(newMockLibvirtClient())
+	if err := mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath}); err != nil {
+		t.Fatalf("CreatePool() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "image.qcow2")
+	data := append([]byte{0x51, 0x46, 0x49, 0xfb, 0x00, 0x00, 0x00, 0x03}, make([]byte, 504)...)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to create QCOW2 test file: %v", err)
+	}
+	return mgr, path
+}
+
+// writeImportLock leaves an import lock volume as another process would.
+func writeImportLock(t *testing.T, mgr *Manager, imageName string, lock importLock) {
+	t.Helper()
+	ctx := context.Background()
+	data, err := json.Marshal(lock)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if err := mgr.CreateVolume(ctx, DefaultImagesPool, VolumeSpec{
+		Name:   importLockVolume(imageName),
+		Type:   VolumeTypeMetadata,
+		Format: VolumeFormatRaw,
+	}); err != nil {
+		t.Fatalf("CreateVolume() error = %v", err)
+	}
+	if err := mgr.WriteVolumeData(ctx, DefaultImagesPool, importLockVolume(imageName), data); err != nil {
+		t.Fatalf("WriteVolumeData() error = %v", err)
+	}
+}
+
+func TestManager_ImportLock_SameProcess(t *testing.T) {
+	mgr, path := newImportLockManager(t)
+	ctx := context.Background()
+
+	release, err := mgr.lockImageImport(ctx, "fedora-43.qcow2")
+	if err != nil {
+		t.Fatalf("lockImageImport() error = %v", err)
+	}
+
+	// A second manager, like a concurrent daemon request, is excluded
+	other := NewManager(mgr.client)
+	if err := other.ImportImage(ctx, path, "fedora-43.qcow2"); !errors.Is(err, ErrImportInProgress) {
+		t.Errorf("ImportImage() error = %v, want ErrImportInProgress", err)
+	}
+	if inProgress, err := other.ImportInProgress(ctx, "fedora-43.qcow2"); err != nil || !inProgress {
+		t.Errorf("ImportInProgress() = %v, %v, want true", inProgress, err)
+	}
+
+	// Other image names are not affected
+	if err := other.ImportImage(ctx, path, "other.qcow2"); err != nil {
+		t.Errorf("ImportImage(other.qcow2) error = %v", err)
+	}
+
+	// The lock volume is not listed as an image
+	images, err := mgr.ListImages(ctx)
+	if err != nil {
+		t.Fatalf("ListImages() error = %v", err)
+	}
+	if len(images) != 1 || images[0].Name != "other.qcow2" {
+		t.Errorf("ListImages() = %+v, want only other.qcow2", images)
+	}
+
+	release()
+	if exists, _ := mgr.VolumeExists(ctx, DefaultImagesPool, importLockVolume("fedora-43.qcow2")); exists {
+		t.Error("import lock volume not removed on release")
+	}
+	if err := other.ImportImage(ctx, path, "fedora-43.qcow2"); err != nil {
+		t.Errorf("ImportImage() after release error = %v", err)
+	}
+	if exists, _ := mgr.VolumeExists(ctx, DefaultImagesPool, importLockVolume("fedora-43.qcow2")); exists {
+		t.Error("import lock volume left after import")
+	}
+}
+
+func TestManager_ImportLock_OtherProcess(t *testing.T) {
+	tests := []struct {
+		name        string
+		lock        importLock
+		wantBlocked bool
+	}{
+		{
+			name:        "running on another host",
+			lock:        importLock{Host: "other-host", PID: 42, StartedAt: time.Now().Add(-time.Hour)},
+			wantBlocked: true,
+		},
+		{
+			name:        "running on this host",
+			lock:        importLock{Host: hostname(t), PID: os.Getpid(), StartedAt: time.Now()},
+			wantBlocked: true,
+		},
+		{
+			// e.g. the root daemon, seen by an unprivileged CLI
+			name:        "running on this host as another user",
+			lock:        importLock{Host: hostname(t), PID: 1, StartedAt: time.Now().Add(-2 * importLockExpiry)},
+			wantBlocked: true,
+		},
+		{
+			name: "expired on another host",
+			lock: importLock{Host: "other-host", PID: 42, StartedAt: time.Now().Add(-2 * importLockExpiry)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr, path := newImportLockManager(t)
+			ctx := context.Background()
+			writeImportLock(t, mgr, "fedora-43.qcow2", tt.lock)
+
+			inProgress, err := mgr.ImportInProgress(ctx, "fedora-43.qcow2")
+			if err != nil {
+				t.Fatalf("ImportInProgress() error = %v", err)
+			}
+			if inProgress != tt.wantBlocked {
+				t.Errorf("ImportInProgress() = %v, want %v", inProgress, tt.wantBlocked)
+			}
+
+			err = mgr.ImportImage(ctx, path, "fedora-43.qcow2")
+			if tt.wantBlocked {
+				if !errors.Is(err, ErrImportInProgress) {
+					t.Errorf("ImportImage() error = %v, want ErrImportInProgress", err)
+				}
+				if exists, _ := mgr.ImageExists(ctx, "fedora-43.qcow2"); exists {
+					t.Error("blocked import created the image")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ImportImage() error = %v", err)
+			}
+			if exists, _ := mgr.VolumeExists(ctx, DefaultImagesPool, importLockVolume("fedora-43.qcow2")); exists {
+				t.Error("stale import lock left after import")
+			}
+		})
+	}
+}
+
+func TestManager_ImportLock_StaleLockReplacedConcurrently(t *testing.T) {
+	mgr, path := newImportLockManager(t)
+	ctx := context.Background()
+	stale := importLock{Host: "other-host", PID: 42, StartedAt: time.Now().Add(-2 * importLockExpiry)}
+	writeImportLock(t, mgr, "fedora-43.qcow2", stale)
+
+	// Right after the stale lock is read, another importer that found it
+	// stale too replaces it with its own
+	fresh := importLock{Host: "other-host", PID: 43, StartedAt: time.Now()}
+	client := mgr.client.(*mockLibvirtClient)
+	replaced := false
+	client.afterDownload = func(vol libvirt.StorageVol) {
+		if replaced || vol.Name != importLockVolume("fedora-43.qcow2") {
+			return
+		}
+		replaced = true
+		data, _ := json.Marshal(fresh)
+		client.volumes[DefaultImagesPool][vol.Name].data = data
+	}
+
+	if err := mgr.ImportImage(ctx, path, "fedora-43.qcow2"); !errors.Is(err, ErrImportInProgress) {
+		t.Fatalf("ImportImage() error = %v, want ErrImportInProgress", err)
+	}
+	lock, err := mgr.readImportLock(ctx, "fedora-43.qcow2")
+	if err != nil || !lock.same(fresh) {
+		t.Errorf("import lock = %+v, %v, want the other importer's lock kept", lock, err)
+	}
+}
+
+func TestManager_ImportLock_NeverWritten(t *testing.T) {
+	tests := []struct {
+		name        string
+		written     time.Time
+		wantBlocked bool
+	}{
+		{name: "being written", written: time.Now(), wantBlocked: true},
+		{name: "abandoned", written: time.Now().Add(-2 * importLockGrace)},
+		// Without timestamps the age is unknown
+		{name: "unknown age", wantBlocked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr, path := newImportLockManager(t)
+			ctx := context.Background()
+
+			// The importer died between creating and writing its lock
+			volumeName := importLockVolume("fedora-43.qcow2")
+			if err := mgr.CreateVolume(ctx, DefaultImagesPool, VolumeSpec{Name: volumeName, Type: VolumeTypeMetadata, Format: VolumeFormatRaw}); err != nil {
+				t.Fatalf("CreateVolume() error = %v", err)
+			}
+			if !tt.written.IsZero() {
+				vol := mgr.client.(*mockLibvirtClient).volumes[DefaultImagesPool][volumeName]
+				timestamps := fmt.Sprintf("<timestamps><mtime>%d.123456789</mtime></timestamps></target>", tt.written.Unix())
+				vol.xmlDesc = strings.Replace(vol.xmlDesc, "</target>", timestamps, 1)
+			}
+
+			inProgress, err := mgr.ImportInProgress(ctx, "fedora-43.qcow2")
+			if err != nil || inProgress != tt.wantBlocked {
+				t.Errorf("ImportInProgress() = %v, %v, want %v", inProgress, err, tt.wantBlocked)
+			}
+
+			err = mgr.ImportImage(ctx, path, "fedora-43.qcow2")
+			if tt.wantBlocked {
+				if !errors.Is(err, ErrImportInProgress) || !strings.Contains(err.Error(), volumeName) {
+					t.Errorf("ImportImage() error = %v, want ErrImportInProgress naming the lock volume", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ImportImage() error = %v", err)
+			}
+			if exists, _ := mgr.ImageExists(ctx, "fedora-43.qcow2"); !exists {
+				t.Error("import behind an abandoned lock did not create the image")
+			}
+		})
+	}
+}
+
+func hostname(t *testing.T) string {
+	t.Helper()
+	name, err := os.Hostname()
+	if err != nil {
+		t.Skipf("no host name: %v", err)
+	}
+	return name
+}
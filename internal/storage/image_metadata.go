@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// imageMetadataSuffix is appended to an image name to form the name of the
+// volume holding its metadata, e.g. "fedora-43.qcow2.meta.json".
+const imageMetadataSuffix = ".meta.json"
+
+// ImageMetadata is information about a base image that cannot be read from
+// the image itself. It is stored as JSON in a sidecar volume next to the
+// image in the foundry-images pool.
+//
+// The provenance fields (Source, Checksum and ImportedAt) are recorded by
+// the import; the others are given by whoever imports the image.
+type ImageMetadata struct {
+	// DefaultUser is the login user the image's cloud-init creates, e.g.
+	// "fedora" or "ubuntu".
+	DefaultUser string `json:"defaultUser,omitempty" yaml:"defaultUser,omitempty"`
+
+	// OSVariant is the libosinfo short ID of the image's operating system,
+	// e.g. "fedora43" or "ubuntu24.04". VMs created from the image record
+	// it.
+	OSVariant string `json:"osVariant,omitempty" yaml:"osVariant,omitempty"`
+
+	// Labels are arbitrary key/value pairs describing the image.
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+
+	// Source is the URL or absolute file path the image was imported from.
+	Source string `json:"source,omitempty" yaml:"source,omitempty"`
+
+	// Checksum is the digest of the image as imported (after any rewrite),
+	// e.g. "sha256:3f5a...".
+	Checksum string `json:"checksum,omitempty" yaml:"checksum,omitempty"`
+
+	// ImportedAt is when the import completed.
+	ImportedAt time.Time `json:"importedAt,omitzero" yaml:"importedAt,omitempty"`
+}
+
+// imageMetadataVolume returns the name of the sidecar volume of an image.
+func imageMetadataVolume(imageName string) string {
+	return imageName + imageMetadataSuffix
+}
+
+// isImageMetadataVolume reports whether a volume holds image metadata.
+func isImageMetadataVolume(volumeName string) bool {
+	return strings.HasSuffix(volumeName, imageMetadataSuffix)
+}
+
+// SetImageMetadata records metadata for an image, replacing any recorded
+// before.
+func (m *Manager) SetImageMetadata(ctx context.Context, imageName string, meta ImageMetadata) error {
+	exists, err := m.ImageExists(ctx, imageName)
+	if err != nil {
+		return fmt.Errorf("failed to check if image exists: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("image %s not found", imageName)
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("failed to encode image metadata: %w", err)
+	}
+
+	// Volumes can't be truncated through libvirt, so the sidecar is replaced
+	volumeName := imageMetadataVolume(imageName)
+	exists, err = m.VolumeExists(ctx, ImagesPool(), volumeName)
+	if err != nil {
+		return fmt.Errorf("failed to check image metadata volume: %w", err)
+	}
+	if exists {
+		if err := m.DeleteVolume(ctx, ImagesPool(), volumeName); err != nil {
+			return fmt.Errorf("failed to replace image metadata: %w", err)
+		}
+	}
+
+	spec := VolumeSpec{
+		Name:   volumeName,
+		Type:   VolumeTypeMetadata,
+		Format: VolumeFormatRaw,
+	}
+	if err := m.CreateVolume(ctx, ImagesPool(), spec); err != nil {
+		return fmt.Errorf("failed to create image metadata volume: %w", err)
+	}
+	if err := m.WriteVolumeData(ctx, ImagesPool(), volumeName, data); err != nil {
+		_ = m.DeleteVolume(ctx, ImagesPool(), volumeName)
+		return fmt.Errorf("failed to write image metadata: %w", err)
+	}
+
+	return nil
+}
+
+// GetImageMetadata returns the metadata recorded for an image. Images
+// without recorded metadata return empty metadata.
+func (m *Manager) GetImageMetadata(ctx context.Context, imageName string) (*ImageMetadata, error) {
+	volumeName := imageMetadataVolume(imageName)
+	exists, err := m.VolumeExists(ctx, ImagesPool(), volumeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check image metadata volume: %w", err)
+	}
+	if !exists {
+		return &ImageMetadata{}, nil
+	}
+
+	data, err := m.ReadVolumeData(ctx, ImagesPool(), volumeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image metadata: %w", err)
+	}
+
+	// The volume may be padded beyond the JSON document
+	var meta ImageMetadata
+	if err := json.Unmarshal(bytes.TrimRight(data, "\x00"), &meta); err != nil {
+		return nil, fmt.Errorf("failed to decode image metadata of %s: %w", imageName, err)
+	}
+	return &meta, nil
+}
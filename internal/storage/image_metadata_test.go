@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newImageMetadataManager returns a manager with one image in the images pool.
+func newImageMetadataManager(t *testing.T) *Manager {
+	t.Helper()
+	mgr := NewManager(newMockLibvirtClient())
+	ctx := context.Background()
+	if err := mgr.CreatePool(ctx, PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath}); err != nil {
+		t.Fatalf("CreatePool() error = %v", err)
+	}
+	if err := mgr.CreateVolume(ctx, DefaultImagesPool, VolumeSpec{
+		Name:       "fedora-43.qcow2",
+		Type:       VolumeTypeBaseImage,
+		Format:     VolumeFormatQCOW2,
+		CapacityGB: 5,
+	}); err != nil {
+		t.Fatalf("CreateVolume() error = %v", err)
+	}
+	return mgr
+}
+
+func TestManager_ImageMetadata(t *testing.T) {
+	mgr := newImageMetadataManager(t)
+	ctx := context.Background()
+
+	// Images without recorded metadata have empty metadata
+	meta, err := mgr.GetImageMetadata(ctx, "fedora-43.qcow2")
+	if err != nil {
+		t.Fatalf("GetImageMetadata() error = %v", err)
+	}
+	if !reflect.DeepEqual(*meta, ImageMetadata{}) {
+		t.Errorf("GetImageMetadata() = %+v, want empty", meta)
+	}
+
+	// Setting twice replaces the metadata
+	for _, user := range []string{"cloud-user", "fedora"} {
+		if err := mgr.SetImageMetadata(ctx, "fedora-43.qcow2", ImageMetadata{DefaultUser: user}); err != nil {
+			t.Fatalf("SetImageMetadata(%s) error = %v", user, err)
+		}
+	}
+	meta, err = mgr.GetImageMetadata(ctx, "fedora-43.qcow2")
+	if err != nil {
+		t.Fatalf("GetImageMetadata() error = %v", err)
+	}
+	if meta.DefaultUser != "fedora" {
+		t.Errorf("DefaultUser = %q, want fedora", meta.DefaultUser)
+	}
+
+	// The sidecar volume is not listed as an image
+	images, err := mgr.ListImages(ctx)
+	if err != nil {
+		t.Fatalf("ListImages() error = %v", err)
+	}
+	if len(images) != 1 || images[0].Name != "fedora-43.qcow2" {
+		t.Errorf("ListImages() = %+v, want only fedora-43.qcow2", images)
+	}
+
+	// Deleting the image deletes its metadata
+	if err := mgr.DeleteImage(ctx, "fedora-43.qcow2", false); err != nil {
+		t.Fatalf("DeleteImage() error = %v", err)
+	}
+	if exists, _ := mgr.VolumeExists(ctx, DefaultImagesPool, "fedora-43.qcow2.meta.json"); exists {
+		t.Error("image metadata volume was not deleted with the image")
+	}
+}
+
+func TestManager_SetImageMetadata_MissingImage(t *testing.T) {
+	mgr := newImageMetadataManager(t)
+
+	err := mgr.SetImageMetadata(context.Background(), "missing.qcow2", ImageMetadata{DefaultUser: "fedora"})
+	if err == nil {
+		t.Fatal("SetImageMetadata() expected error for missing image")
+	}
+}
+
+func TestManager_ImportImage_RecordsMetadata(t *testing.T) {
+	data := testQCOW2Image()
+	srv := newImageServer(t, data, nil)
+	mgr, _ := newImportManager(t)
+	ctx := context.Background()
+
+	before := time.Now().Add(-time.Second)
+	err := mgr.ImportImageFromURL(ctx, srv.URL+"/image.qcow2", "fedora-43.qcow2", URLImportOptions{
+		DownloadDir: t.TempDir(),
+		ImportOptions: ImportOptions{Metadata: ImageMetadata{
+			DefaultUser: "fedora",
+			OSVariant:   "fedora43",
+			Labels:      map[string]string{"team": "infra"},
+			Source:      "ignored",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("ImportImageFromURL() error = %v", err)
+	}
+
+	meta, err := mgr.GetImageMetadata(ctx, "fedora-43.qcow2")
+	if err != nil {
+		t.Fatalf("GetImageMetadata() error = %v", err)
+	}
+	if meta.DefaultUser != "fedora" || meta.OSVariant != "fedora43" || meta.Labels["team"] != "infra" {
+		t.Errorf("metadata = %+v, want the given user, OS variant and labels", meta)
+	}
+	if meta.Source != srv.URL+"/image.qcow2" {
+		t.Errorf("Source = %q, want the download URL", meta.Source)
+	}
+	if meta.Checksum != "sha256:"+sha256Hex(data) {
+		t.Errorf("Checksum = %q, want the sha256 of the image", meta.Checksum)
+	}
+	if meta.ImportedAt.Before(before) || meta.ImportedAt.After(time.Now()) {
+		t.Errorf("ImportedAt = %v, want the import time", meta.ImportedAt)
+	}
+
+	// Local imports record the absolute path of the file
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "local.qcow2"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+	if err := mgr.ImportImage(ctx, "local.qcow2", "local.qcow2"); err != nil {
+		t.Fatalf("ImportImage() error = %v", err)
+	}
+	meta, err = mgr.GetImageMetadata(ctx, "local.qcow2")
+	if err != nil {
+		t.Fatalf("GetImageMetadata() error = %v", err)
+	}
+	if meta.Source != filepath.Join(dir, "local.qcow2") {
+		t.Errorf("Source = %q, want the absolute file path", meta.Source)
+	}
+}
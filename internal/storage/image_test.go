@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -61,7 +62,7 @@ func TestManager_ImportImage(t *testing.T) {
 			filePath:  qcow2Path,
 			imageName: "fedora-43.qcow2",
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), DefaultImagesPool, PoolTypeDir, DefaultImagesPath)
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
 			},
 			wantErr: false,
 		},
@@ -70,7 +71,7 @@ func TestManager_ImportImage(t *testing.T) {
 			filePath:  rawPath,
 			imageName: "ubuntu-24.04.raw",
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), DefaultImagesPool, PoolTypeDir, DefaultImagesPath)
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
 			},
 			wantErr: false,
 		},
@@ -79,7 +80,7 @@ func TestManager_ImportImage(t *testing.T) {
 			filePath:  qcow2Path,
 			imageName: "fedora-43",
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), DefaultImagesPool, PoolTypeDir, DefaultImagesPath)
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
 			},
 			wantErr: true,
 			errMsg:  "must have .qcow2 or .raw extension",
@@ -89,7 +90,7 @@ func TestManager_ImportImage(t *testing.T) {
 			filePath:  qcow2Path,
 			imageName: "fedora-43.img",
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), DefaultImagesPool, PoolTypeDir, DefaultImagesPath)
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
 			},
 			wantErr: true,
 			errMsg:  "must have .qcow2 or .raw extension",
@@ -99,7 +100,7 @@ func TestManager_ImportImage(t *testing.T) {
 			filePath:  qcow2Path,
 			imageName: "fedora-43.raw",
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), DefaultImagesPool, PoolTypeDir, DefaultImagesPath)
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
 			},
 			wantErr: true,
 			errMsg:  "format mismatch",
@@ -109,7 +110,7 @@ func TestManager_ImportImage(t *testing.T) {
 			filePath:  rawPath,
 			imageName: "ubuntu-24.04.qcow2",
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), DefaultImagesPool, PoolTypeDir, DefaultImagesPath)
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
 			},
 			wantErr: true,
 			errMsg:  "format mismatch",
@@ -119,7 +120,7 @@ func TestManager_ImportImage(t *testing.T) {
 			filePath:  misnamedPath,
 			imageName: "misnamed.raw",
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), DefaultImagesPool, PoolTypeDir, DefaultImagesPath)
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
 			},
 			wantErr: true,
 			errMsg:  "format mismatch",
@@ -129,7 +130,7 @@ func TestManager_ImportImage(t *testing.T) {
 			filePath:  nonBootablePath,
 			imageName: "non-bootable.raw",
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), DefaultImagesPool, PoolTypeDir, DefaultImagesPath)
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
 			},
 			wantErr: true,
 			errMsg:  "unsupported or invalid image",
@@ -139,7 +140,7 @@ func TestManager_ImportImage(t *testing.T) {
 			filePath:  "/nonexistent/image.qcow2",
 			imageName: "fedora-43.qcow2",
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), DefaultImagesPool, PoolTypeDir, DefaultImagesPath)
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
 			},
 			wantErr: true,
 		},
@@ -208,7 +209,7 @@ func TestManager_ListImages(t *testing.T) {
 	mgr := NewManager(mockClient)
 
 	// Create images pool
-	_ = mgr.CreatePool(context.Background(), DefaultImagesPool, PoolTypeDir, DefaultImagesPath)
+	_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
 
 	// Create some images
 	_ = mgr.CreateVolume(context.Background(), DefaultImagesPool, VolumeSpec{
@@ -234,6 +235,29 @@ func TestManager_ListImages(t *testing.T) {
 	}
 }
 
+func TestManager_ImageNames(t *testing.T) {
+	mockClient := newMockLibvirtClient()
+	mgr := NewManager(mockClient)
+
+	_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
+	for _, name := range []string{"ubuntu-24.04", "fedora-43", "fedora-43" + imageMetadataSuffix, "debian-13" + importLockSuffix} {
+		_ = mgr.CreateVolume(context.Background(), DefaultImagesPool, VolumeSpec{
+			Name:       name,
+			Type:       VolumeTypeBaseImage,
+			Format:     VolumeFormatQCOW2,
+			CapacityGB: 1,
+		})
+	}
+
+	names, err := mgr.ImageNames(context.Background())
+	if err != nil {
+		t.Fatalf("ImageNames() error = %v", err)
+	}
+	if strings.Join(names, ",") != "fedora-43,ubuntu-24.04" {
+		t.Errorf("ImageNames() = %v, want [fedora-43 ubuntu-24.04]", names)
+	}
+}
+
 func TestManager_DeleteImage(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -247,7 +271,7 @@ func TestManager_DeleteImage(t *testing.T) {
 			imageName: "test-image",
 			force:     false,
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), DefaultImagesPool, PoolTypeDir, DefaultImagesPath)
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
 				_ = mgr.CreateVolume(context.Background(), DefaultImagesPool, VolumeSpec{
 					Name:       "test-image",
 					Type:       VolumeTypeBaseImage,
@@ -262,7 +286,7 @@ func TestManager_DeleteImage(t *testing.T) {
 			imageName: "nonexistent",
 			force:     false,
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), DefaultImagesPool, PoolTypeDir, DefaultImagesPath)
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
 			},
 			wantErr: true,
 		},
@@ -287,7 +311,7 @@ func TestManager_GetImagePath(t *testing.T) {
 	mgr := NewManager(mockClient)
 
 	// Create images pool and image
-	_ = mgr.CreatePool(context.Background(), DefaultImagesPool, PoolTypeDir, DefaultImagesPath)
+	_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
 	imageName := "fedora-43"
 	_ = mgr.CreateVolume(context.Background(), DefaultImagesPool, VolumeSpec{
 		Name:       imageName,
@@ -311,7 +335,7 @@ func TestManager_ImageExists(t *testing.T) {
 	mgr := NewManager(mockClient)
 
 	// Create images pool and image
-	_ = mgr.CreatePool(context.Background(), DefaultImagesPool, PoolTypeDir, DefaultImagesPath)
+	_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
 	imageName := "fedora-43"
 	_ = mgr.CreateVolume(context.Background(), DefaultImagesPool, VolumeSpec{
 		Name:       imageName,
@@ -339,6 +363,55 @@ func TestManager_ImageExists(t *testing.T) {
 	}
 }
 
+func TestManager_ImageFingerprint(t *testing.T) {
+	mockClient := newMockLibvirtClient()
+	mgr := NewManager(mockClient)
+	ctx := context.Background()
+
+	_ = mgr.CreatePool(ctx, PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
+	for _, name := range []string{"a.qcow2", "b.qcow2"} {
+		_ = mgr.CreateVolume(ctx, DefaultImagesPool, VolumeSpec{
+			Name:       name,
+			Type:       VolumeTypeBaseImage,
+			Format:     VolumeFormatQCOW2,
+			CapacityGB: 10,
+		})
+	}
+	header := make([]byte, 2*imageFingerprintSize)
+	copy(header, []byte{0x51, 0x46, 0x49, 0xfb})
+	mockClient.volumes[DefaultImagesPool]["a.qcow2"].data = header
+	mockClient.volumes[DefaultImagesPool]["b.qcow2"].data = append([]byte(nil), header...)
+
+	a, err := mgr.ImageFingerprint(ctx, "a.qcow2")
+	if err != nil {
+		t.Fatalf("ImageFingerprint() error = %v", err)
+	}
+	if !strings.HasPrefix(a, "sha256:") || len(a) != len("sha256:")+64 {
+		t.Errorf("ImageFingerprint() = %q, want sha256:<hex>", a)
+	}
+
+	// Only the start of the image is hashed
+	mockClient.volumes[DefaultImagesPool]["b.qcow2"].data[imageFingerprintSize] = 1
+	if b, _ := mgr.ImageFingerprint(ctx, "b.qcow2"); b != a {
+		t.Errorf("fingerprint changed by data past the first MiB: %q != %q", b, a)
+	}
+
+	// A different header or capacity is a different image
+	mockClient.volumes[DefaultImagesPool]["b.qcow2"].data[8] = 1
+	if b, _ := mgr.ImageFingerprint(ctx, "b.qcow2"); b == a {
+		t.Error("fingerprint unchanged by a different header")
+	}
+	mockClient.volumes[DefaultImagesPool]["b.qcow2"].data[8] = 0
+	mockClient.volumes[DefaultImagesPool]["b.qcow2"].capacity++
+	if b, _ := mgr.ImageFingerprint(ctx, "b.qcow2"); b == a {
+		t.Error("fingerprint unchanged by a different capacity")
+	}
+
+	if _, err := mgr.ImageFingerprint(ctx, "missing.qcow2"); err == nil {
+		t.Error("ImageFingerprint() of a missing image succeeded")
+	}
+}
+
 func TestManager_PullImage(t *testing.T) {
 	mockClient := newMockLibvirtClient()
 	mgr := NewManager(mockClient)
@@ -6,6 +6,8 @@ import (
 	"io"
 
 	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/internal/timing"
 )
 
 // LibvirtClient defines the minimal libvirt operations needed for storage management.
@@ -48,11 +50,16 @@ type LibvirtClient interface {
 	StoragePoolListAllVolumes(Pool libvirt.StoragePool, NeedResults int32, Flags uint32) ([]libvirt.StorageVol, uint32, error)
 	StoragePoolRefresh(Pool libvirt.StoragePool, Flags uint32) error
 	StorageVolLookupByName(Pool libvirt.StoragePool, Name string) (libvirt.StorageVol, error)
+	StorageVolLookupByPath(Path string) (libvirt.StorageVol, error)
 	StorageVolCreateXML(Pool libvirt.StoragePool, XML string, Flags libvirt.StorageVolCreateFlags) (libvirt.StorageVol, error)
+	StorageVolCreateXMLFrom(Pool libvirt.StoragePool, XML string, Clonevol libvirt.StorageVol, Flags libvirt.StorageVolCreateFlags) (libvirt.StorageVol, error)
 	StorageVolDelete(Vol libvirt.StorageVol, Flags libvirt.StorageVolDeleteFlags) error
 	StorageVolGetPath(Vol libvirt.StorageVol) (string, error)
+	StorageVolGetXMLDesc(Vol libvirt.StorageVol, Flags uint32) (string, error)
 	StorageVolGetInfo(Vol libvirt.StorageVol) (rType int8, rCapacity uint64, rAllocation uint64, err error)
+	StorageVolResize(Vol libvirt.StorageVol, Capacity uint64, Flags libvirt.StorageVolResizeFlags) error
 	StorageVolUpload(Vol libvirt.StorageVol, outStream io.Reader, Offset uint64, Length uint64, Flags libvirt.StorageVolUploadFlags) error
+	StorageVolDownload(Vol libvirt.StorageVol, inStream io.Writer, Offset uint64, Length uint64, Flags libvirt.StorageVolDownloadFlags) error
 	ConnectListAllStoragePools(NeedResults int32, Flags libvirt.ConnectListAllStoragePoolsFlags) ([]libvirt.StoragePool, uint32, error)
 }
 
@@ -69,16 +76,20 @@ func NewManager(client LibvirtClient) *Manager {
 	}
 }
 
-// EnsureDefaultPools ensures that the default foundry-images and foundry-vms pools exist.
+// EnsureDefaultPools ensures that the default images and VMs pools
+// (foundry-images and foundry-vms unless changed with SetDefaultPools) exist.
 // This is called automatically during VM creation if needed.
 func (m *Manager) EnsureDefaultPools(ctx context.Context) error {
-	// Ensure foundry-images pool exists
-	if err := m.EnsurePool(ctx, DefaultImagesPool, PoolTypeDir, DefaultImagesPath); err != nil {
+	defer timing.Start("ensure pools")()
+	pools := GetDefaultPools()
+
+	// Ensure the images pool exists
+	if err := m.EnsurePool(ctx, PoolSpec{Name: pools.ImagesPool, Type: PoolTypeDir, Path: pools.ImagesPath}); err != nil {
 		return fmt.Errorf("failed to ensure images pool: %w", err)
 	}
 
-	// Ensure foundry-vms pool exists
-	if err := m.EnsurePool(ctx, DefaultVMsPool, PoolTypeDir, DefaultVMsPath); err != nil {
+	// Ensure the VMs pool exists
+	if err := m.EnsurePool(ctx, PoolSpec{Name: pools.VMsPool, Type: PoolTypeDir, Path: pools.VMsPath}); err != nil {
 		return fmt.Errorf("failed to ensure VMs pool: %w", err)
 	}
 
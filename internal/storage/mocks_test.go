@@ -12,6 +12,14 @@ import (
 type mockLibvirtClient struct {
 	pools   map[string]*mockPool
 	volumes map[string]map[string]*mockVolume // pool name -> volume name -> volume
+	built   map[string]libvirt.StoragePoolBuildFlags
+
+	// afterDownload, if set, is called after a volume is downloaded.
+	afterDownload func(vol libvirt.StorageVol)
+
+	// cloneErr, if set, is called before a volume is copied and fails the
+	// copy if it returns an error.
+	cloneErr func(name string) error
 }
 
 type mockPool struct {
@@ -30,12 +38,14 @@ type mockVolume struct {
 	capacity  uint64
 	allocated uint64
 	data      []byte
+	xmlDesc   string
 }
 
 func newMockLibvirtClient() *mockLibvirtClient {
 	return &mockLibvirtClient{
 		pools:   make(map[string]*mockPool),
 		volumes: make(map[string]map[string]*mockVolume),
+		built:   make(map[string]libvirt.StoragePoolBuildFlags),
 	}
 }
 
@@ -100,6 +110,7 @@ func (m *mockLibvirtClient) StoragePoolBuild(pool libvirt.StoragePool, flags lib
 	if _, ok := m.pools[pool.Name]; !ok {
 		return fmt.Errorf("storage pool not found: %s", pool.Name)
 	}
+	m.built[pool.Name] = flags
 	return nil
 }
 
@@ -185,6 +196,17 @@ func (m *mockLibvirtClient) StorageVolLookupByName(pool libvirt.StoragePool, nam
 	}, nil
 }
 
+func (m *mockLibvirtClient) StorageVolLookupByPath(path string) (libvirt.StorageVol, error) {
+	for poolName, vols := range m.volumes {
+		for _, vol := range vols {
+			if vol.path == path {
+				return libvirt.StorageVol{Pool: poolName, Name: vol.name}, nil
+			}
+		}
+	}
+	return libvirt.StorageVol{}, fmt.Errorf("storage volume not found: %s", path)
+}
+
 func (m *mockLibvirtClient) StorageVolCreateXML(pool libvirt.StoragePool, xml string, flags libvirt.StorageVolCreateFlags) (libvirt.StorageVol, error) {
 	vols, ok := m.volumes[pool.Name]
 	if !ok {
@@ -208,6 +230,7 @@ func (m *mockLibvirtClient) StorageVolCreateXML(pool libvirt.StoragePool, xml st
 		path:      "/var/lib/libvirt/images/foundry/" + pool.Name + "/" + name,
 		capacity:  100 * 1024 * 1024 * 1024, // 100 GB default
 		allocated: 0,
+		xmlDesc:   xml,
 	}
 	vols[name] = vol
 
@@ -217,6 +240,28 @@ func (m *mockLibvirtClient) StorageVolCreateXML(pool libvirt.StoragePool, xml st
 	}, nil
 }
 
+func (m *mockLibvirtClient) StorageVolCreateXMLFrom(pool libvirt.StoragePool, xml string, clonevol libvirt.StorageVol, flags libvirt.StorageVolCreateFlags) (libvirt.StorageVol, error) {
+	if m.cloneErr != nil {
+		if err := m.cloneErr(extractTagValue(xml, "name")); err != nil {
+			return libvirt.StorageVol{}, err
+		}
+	}
+	source, ok := m.volumes[clonevol.Pool][clonevol.Name]
+	if !ok {
+		return libvirt.StorageVol{}, fmt.Errorf("storage volume not found: %s", clonevol.Name)
+	}
+
+	vol, err := m.StorageVolCreateXML(pool, xml, 0)
+	if err != nil {
+		return libvirt.StorageVol{}, err
+	}
+
+	clone := m.volumes[vol.Pool][vol.Name]
+	clone.data = append([]byte(nil), source.data...)
+	clone.allocated = source.allocated
+	return vol, nil
+}
+
 func (m *mockLibvirtClient) StorageVolDelete(vol libvirt.StorageVol, flags libvirt.StorageVolDeleteFlags) error {
 	vols, ok := m.volumes[vol.Pool]
 	if !ok {
@@ -245,6 +290,20 @@ func (m *mockLibvirtClient) StorageVolGetPath(vol libvirt.StorageVol) (string, e
 	return v.path, nil
 }
 
+func (m *mockLibvirtClient) StorageVolGetXMLDesc(vol libvirt.StorageVol, flags uint32) (string, error) {
+	vols, ok := m.volumes[vol.Pool]
+	if !ok {
+		return "", fmt.Errorf("storage pool not found: %s", vol.Pool)
+	}
+
+	v, ok := vols[vol.Name]
+	if !ok {
+		return "", fmt.Errorf("storage volume not found: %s", vol.Name)
+	}
+
+	return v.xmlDesc, nil
+}
+
 func (m *mockLibvirtClient) StorageVolGetInfo(vol libvirt.StorageVol) (rType int8, rCapacity uint64, rAllocation uint64, err error) {
 	vols, ok := m.volumes[vol.Pool]
 	if !ok {
@@ -259,6 +318,21 @@ func (m *mockLibvirtClient) StorageVolGetInfo(vol libvirt.StorageVol) (rType int
 	return 0, v.capacity, v.allocated, nil
 }
 
+func (m *mockLibvirtClient) StorageVolResize(vol libvirt.StorageVol, capacity uint64, flags libvirt.StorageVolResizeFlags) error {
+	vols, ok := m.volumes[vol.Pool]
+	if !ok {
+		return fmt.Errorf("storage pool not found: %s", vol.Pool)
+	}
+
+	v, ok := vols[vol.Name]
+	if !ok {
+		return fmt.Errorf("storage volume not found: %s", vol.Name)
+	}
+
+	v.capacity = capacity
+	return nil
+}
+
 func (m *mockLibvirtClient) StorageVolUpload(vol libvirt.StorageVol, reader io.Reader, offset uint64, length uint64, flags libvirt.StorageVolUploadFlags) error {
 	vols, ok := m.volumes[vol.Pool]
 	if !ok {
@@ -281,6 +355,24 @@ func (m *mockLibvirtClient) StorageVolUpload(vol libvirt.StorageVol, reader io.R
 	return nil
 }
 
+func (m *mockLibvirtClient) StorageVolDownload(vol libvirt.StorageVol, writer io.Writer, offset uint64, length uint64, flags libvirt.StorageVolDownloadFlags) error {
+	vols, ok := m.volumes[vol.Pool]
+	if !ok {
+		return fmt.Errorf("storage pool not found: %s", vol.Pool)
+	}
+
+	v, ok := vols[vol.Name]
+	if !ok {
+		return fmt.Errorf("storage volume not found: %s", vol.Name)
+	}
+
+	_, err := writer.Write(v.data)
+	if m.afterDownload != nil {
+		m.afterDownload(vol)
+	}
+	return err
+}
+
 func (m *mockLibvirtClient) ConnectListAllStoragePools(needResults int32, flags libvirt.ConnectListAllStoragePoolsFlags) ([]libvirt.StoragePool, uint32, error) {
 	var result []libvirt.StoragePool
 	for name, pool := range m.pools {
@@ -4,39 +4,70 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/digitalocean/go-libvirt"
 	libvirtxml "libvirt.org/go/libvirtxml"
 )
 
+// knownPools holds the names of pools known to exist, e.g. from the CLI's
+// per-context cache, which EnsurePool does not look up again.
+var knownPools = struct {
+	mu    sync.RWMutex
+	names map[string]bool
+}{}
+
+// SetKnownPools records pools known to exist on the hypervisor, saving
+// EnsurePool a round trip to libvirt for each of them. Remote CLIs pass the
+// pools cached for their context; nil clears the set.
+func SetKnownPools(names []string) {
+	knownPools.mu.Lock()
+	defer knownPools.mu.Unlock()
+	knownPools.names = make(map[string]bool, len(names))
+	for _, name := range names {
+		knownPools.names[name] = true
+	}
+}
+
+// isKnownPool reports whether a pool was recorded by SetKnownPools.
+func isKnownPool(name string) bool {
+	knownPools.mu.RLock()
+	defer knownPools.mu.RUnlock()
+	return knownPools.names[name]
+}
+
 // EnsurePool ensures a storage pool exists, creating it if necessary.
 // If the pool already exists, this is a no-op.
-func (m *Manager) EnsurePool(ctx context.Context, name string, poolType PoolType, path string) error {
+func (m *Manager) EnsurePool(ctx context.Context, spec PoolSpec) error {
+	if isKnownPool(spec.Name) {
+		return nil
+	}
+
 	// Check if pool already exists
-	_, err := m.client.StoragePoolLookupByName(name)
+	_, err := m.client.StoragePoolLookupByName(spec.Name)
 	if err == nil {
 		// Pool exists, nothing to do
 		return nil
 	}
 
 	// Pool doesn't exist, create it
-	return m.CreatePool(ctx, name, poolType, path)
+	return m.CreatePool(ctx, spec)
 }
 
 // CreatePool creates a new storage pool.
 // Returns an error if the pool already exists.
-func (m *Manager) CreatePool(ctx context.Context, name string, poolType PoolType, path string) error {
-	// Generate pool XML based on type
-	var poolXML string
-	var err error
-
-	switch poolType {
-	case PoolTypeDir:
-		poolXML, err = generateDirPoolXML(name, path)
-	default:
-		return fmt.Errorf("unsupported pool type: %s", poolType)
+//
+// Building the pool creates the directory or mount point of dir, fs and
+// netfs pools; existing filesystems are never formatted. Logical pools with
+// source devices build a new volume group on them, refusing devices that
+// already hold data; without devices the volume group must already exist.
+func (m *Manager) CreatePool(ctx context.Context, spec PoolSpec) error {
+	if err := spec.Validate(); err != nil {
+		return fmt.Errorf("invalid pool spec: %w", err)
 	}
 
+	// Generate pool XML based on type
+	poolXML, err := generatePoolXML(spec)
 	if err != nil {
 		return fmt.Errorf("failed to generate pool XML: %w", err)
 	}
@@ -47,11 +78,17 @@ func (m *Manager) CreatePool(ctx context.Context, name string, poolType PoolType
 		return fmt.Errorf("failed to define pool: %w", err)
 	}
 
-	// Build the pool (creates the directory structure)
-	if err := m.client.StoragePoolBuild(pool, 0); err != nil {
-		// Try to undefine the pool if build fails
-		_ = m.client.StoragePoolUndefine(pool)
-		return fmt.Errorf("failed to build pool: %w", err)
+	// Build the pool (creates the directory structure or volume group)
+	if spec.Type != PoolTypeLVM || len(spec.SourceDevices) > 0 {
+		var flags libvirt.StoragePoolBuildFlags
+		if spec.Type == PoolTypeLVM {
+			flags = libvirt.StoragePoolBuildNoOverwrite
+		}
+		if err := m.client.StoragePoolBuild(pool, flags); err != nil {
+			// Try to undefine the pool if build fails
+			_ = m.client.StoragePoolUndefine(pool)
+			return fmt.Errorf("failed to build pool: %w", err)
+		}
 	}
 
 	// Start the pool
@@ -76,7 +113,7 @@ func (m *Manager) CreatePool(ctx context.Context, name string, poolType PoolType
 // Returns an error if the pool doesn't exist or if deletion fails.
 func (m *Manager) DeletePool(ctx context.Context, name string, force bool) error {
 	// Prevent deletion of default pools
-	if name == DefaultImagesPool || name == DefaultVMsPool {
+	if IsDefaultPool(name) {
 		return fmt.Errorf("cannot delete default pool: %s", name)
 	}
 
@@ -166,12 +203,10 @@ func (m *Manager) GetPoolInfo(ctx context.Context, name string) (*PoolInfo, erro
 		return nil, fmt.Errorf("failed to parse pool XML: %w", err)
 	}
 
-	// Extract pool type and path
-	poolType := PoolTypeDir // Default to dir
+	// Extract pool type, path and source
+	poolType := PoolType(poolDef.Type)
 	poolPath := ""
-
-	if poolDef.Type == "dir" && poolDef.Target != nil {
-		poolType = PoolTypeDir
+	if poolDef.Target != nil {
 		poolPath = poolDef.Target.Path
 	}
 
@@ -202,6 +237,7 @@ func (m *Manager) GetPoolInfo(ctx context.Context, name string) (*PoolInfo, erro
 		Name:       pool.Name,
 		Type:       poolType,
 		Path:       poolPath,
+		Source:     poolSource(poolDef.Source),
 		UUID:       uuid,
 		State:      stateStr,
 		Capacity:   capacity,
@@ -224,22 +260,88 @@ func (m *Manager) RefreshPool(ctx context.Context, name string) error {
 	return nil
 }
 
-// generateDirPoolXML generates XML for a directory-based storage pool.
-func generateDirPoolXML(name, path string) (string, error) {
-	// Get the QEMU user/group IDs for this system
-	uid, gid, _ := GetQEMUUserGroup()
+// poolTypeOf returns the type of a storage pool.
+func (m *Manager) poolTypeOf(pool libvirt.StoragePool) (PoolType, error) {
+	xmlDesc, err := m.client.StoragePoolGetXMLDesc(pool, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to get pool XML: %w", err)
+	}
+
+	var poolDef libvirtxml.StoragePool
+	if err := poolDef.Unmarshal(xmlDesc); err != nil {
+		return "", fmt.Errorf("failed to parse pool XML: %w", err)
+	}
+	return PoolType(poolDef.Type), nil
+}
+
+// poolSource describes the source of a pool: the NFS export, the volume
+// group and its devices, or the mounted device. Dir pools have none.
+func poolSource(source *libvirtxml.StoragePoolSource) string {
+	if source == nil {
+		return ""
+	}
+	if len(source.Host) > 0 && source.Dir != nil {
+		return source.Host[0].Name + ":" + source.Dir.Path
+	}
+
+	var devices []string
+	for _, device := range source.Device {
+		devices = append(devices, device.Path)
+	}
+	switch {
+	case source.Name != "" && len(devices) > 0:
+		return source.Name + " (" + strings.Join(devices, ",") + ")"
+	case source.Name != "":
+		return source.Name
+	default:
+		return strings.Join(devices, ",")
+	}
+}
 
+// generatePoolXML generates XML for a storage pool of spec.Type.
+func generatePoolXML(spec PoolSpec) (string, error) {
 	pool := &libvirtxml.StoragePool{
-		Type: "dir",
-		Name: name,
-		Target: &libvirtxml.StoragePoolTarget{
-			Path: path,
-			Permissions: &libvirtxml.StoragePoolTargetPermissions{
-				Owner: uid,
-				Group: gid,
-				Mode:  "0755",
-			},
-		},
+		Type: string(spec.Type),
+		Name: spec.Name,
+	}
+
+	switch spec.Type {
+	case PoolTypeDir:
+		pool.Target = ownedTarget(spec.Path)
+	case PoolTypeLVM:
+		vgName := spec.SourceName
+		if vgName == "" {
+			vgName = spec.Name
+		}
+		pool.Source = &libvirtxml.StoragePoolSource{
+			Name:   vgName,
+			Device: sourceDevices(spec.SourceDevices),
+			Format: &libvirtxml.StoragePoolSourceFormat{Type: "lvm2"},
+		}
+		pool.Target = &libvirtxml.StoragePoolTarget{Path: "/dev/" + vgName}
+	case PoolTypeFS:
+		format := spec.SourceFormat
+		if format == "" {
+			format = "auto"
+		}
+		pool.Source = &libvirtxml.StoragePoolSource{
+			Device: sourceDevices(spec.SourceDevices),
+			Format: &libvirtxml.StoragePoolSourceFormat{Type: format},
+		}
+		pool.Target = ownedTarget(spec.Path)
+	case PoolTypeNFS:
+		format := spec.SourceFormat
+		if format == "" {
+			format = "nfs"
+		}
+		pool.Source = &libvirtxml.StoragePoolSource{
+			Host:   []libvirtxml.StoragePoolSourceHost{{Name: spec.SourceHost}},
+			Dir:    &libvirtxml.StoragePoolSourceDir{Path: spec.SourcePath},
+			Format: &libvirtxml.StoragePoolSourceFormat{Type: format},
+		}
+		pool.Target = ownedTarget(spec.Path)
+	default:
+		return "", fmt.Errorf("unsupported pool type: %s", spec.Type)
 	}
 
 	xmlBytes, err := pool.Marshal()
@@ -254,3 +356,28 @@ func generateDirPoolXML(name, path string) (string, error) {
 
 	return xml, nil
 }
+
+// ownedTarget returns the target of a directory-backed pool: path, owned by
+// the QEMU user so volumes created in it are accessible to VMs.
+func ownedTarget(path string) *libvirtxml.StoragePoolTarget {
+	// Get the QEMU user/group IDs for this system
+	uid, gid, _ := GetQEMUUserGroup()
+
+	return &libvirtxml.StoragePoolTarget{
+		Path: path,
+		Permissions: &libvirtxml.StoragePoolTargetPermissions{
+			Owner: uid,
+			Group: gid,
+			Mode:  "0755",
+		},
+	}
+}
+
+// sourceDevices returns the source device elements for paths.
+func sourceDevices(paths []string) []libvirtxml.StoragePoolSourceDevice {
+	var devices []libvirtxml.StoragePoolSourceDevice
+	for _, path := range paths {
+		devices = append(devices, libvirtxml.StoragePoolSourceDevice{Path: path})
+	}
+	return devices
+}
@@ -2,7 +2,10 @@ package storage
 
 import (
 	"context"
+	"strings"
 	"testing"
+
+	"github.com/digitalocean/go-libvirt"
 )
 
 func TestManager_EnsurePool(t *testing.T) {
@@ -32,7 +35,7 @@ func TestManager_EnsurePool(t *testing.T) {
 			setup: func(m *mockLibvirtClient) {
 				// Pre-create the pool
 				mgr := NewManager(m)
-				_ = mgr.CreatePool(context.Background(), "existing-pool", PoolTypeDir, "/var/lib/libvirt/images/existing")
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "existing-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/existing"})
 			},
 			wantErr:   false,
 			checkPool: true,
@@ -45,7 +48,7 @@ func TestManager_EnsurePool(t *testing.T) {
 			tt.setup(mockClient)
 
 			mgr := NewManager(mockClient)
-			err := mgr.EnsurePool(context.Background(), tt.poolName, tt.poolType, tt.path)
+			err := mgr.EnsurePool(context.Background(), PoolSpec{Name: tt.poolName, Type: tt.poolType, Path: tt.path})
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("EnsurePool() error = %v, wantErr %v", err, tt.wantErr)
@@ -63,6 +66,28 @@ func TestManager_EnsurePool(t *testing.T) {
 	}
 }
 
+func TestManager_EnsurePool_KnownPool(t *testing.T) {
+	SetKnownPools([]string{"cached-pool"})
+	defer SetKnownPools(nil)
+
+	mockClient := newMockLibvirtClient()
+	mgr := NewManager(mockClient)
+	if err := mgr.EnsurePool(context.Background(), PoolSpec{Name: "cached-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/cached"}); err != nil {
+		t.Fatalf("EnsurePool() error = %v", err)
+	}
+	// A known pool is trusted without asking libvirt
+	if _, err := mockClient.StoragePoolLookupByName("cached-pool"); err == nil {
+		t.Error("EnsurePool() created a pool known to exist")
+	}
+
+	if err := mgr.EnsurePool(context.Background(), PoolSpec{Name: "other-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/other"}); err != nil {
+		t.Fatalf("EnsurePool() error = %v", err)
+	}
+	if _, err := mockClient.StoragePoolLookupByName("other-pool"); err != nil {
+		t.Error("EnsurePool() did not create an unknown pool")
+	}
+}
+
 func TestManager_CreatePool(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -82,9 +107,9 @@ func TestManager_CreatePool(t *testing.T) {
 		},
 		{
 			name:     "unsupported pool type",
-			poolName: "lvm-pool",
-			poolType: PoolTypeLVM,
-			path:     "/dev/vg0",
+			poolName: "zfs-pool",
+			poolType: PoolTypeZFS,
+			path:     "/tank/vms",
 			setup:    func(m *mockLibvirtClient) {},
 			wantErr:  true,
 		},
@@ -96,7 +121,7 @@ func TestManager_CreatePool(t *testing.T) {
 			tt.setup(mockClient)
 
 			mgr := NewManager(mockClient)
-			err := mgr.CreatePool(context.Background(), tt.poolName, tt.poolType, tt.path)
+			err := mgr.CreatePool(context.Background(), PoolSpec{Name: tt.poolName, Type: tt.poolType, Path: tt.path})
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("CreatePool() error = %v, wantErr %v", err, tt.wantErr)
@@ -105,6 +130,95 @@ func TestManager_CreatePool(t *testing.T) {
 	}
 }
 
+func TestManager_CreatePool_Types(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      PoolSpec
+		wantBuild bool
+		wantFlags libvirt.StoragePoolBuildFlags
+		wantXML   []string
+		wantErr   bool
+	}{
+		{
+			name:      "logical pool on new devices",
+			spec:      PoolSpec{Name: "vg-vms", Type: PoolTypeLVM, SourceDevices: []string{"/dev/sdb", "/dev/sdc"}},
+			wantBuild: true,
+			wantFlags: libvirt.StoragePoolBuildNoOverwrite,
+			wantXML: []string{
+				`<pool type="logical">`, `<name>vg-vms</name>`,
+				`<device path="/dev/sdb"></device>`, `<device path="/dev/sdc"></device>`,
+				`<format type="lvm2"></format>`, `<path>/dev/vg-vms</path>`,
+			},
+		},
+		{
+			name:    "logical pool on existing volume group",
+			spec:    PoolSpec{Name: "vms", Type: PoolTypeLVM, SourceName: "vg0"},
+			wantXML: []string{`<name>vg0</name>`, `<path>/dev/vg0</path>`},
+		},
+		{
+			name:      "fs pool",
+			spec:      PoolSpec{Name: "fast", Type: PoolTypeFS, Path: "/var/lib/libvirt/fast", SourceDevices: []string{"/dev/nvme1n1p1"}, SourceFormat: "xfs"},
+			wantBuild: true,
+			wantXML:   []string{`<pool type="fs">`, `<device path="/dev/nvme1n1p1"></device>`, `<format type="xfs"></format>`, `<path>/var/lib/libvirt/fast</path>`},
+		},
+		{
+			name:      "netfs pool",
+			spec:      PoolSpec{Name: "shared", Type: PoolTypeNFS, Path: "/var/lib/libvirt/shared", SourceHost: "nfs.example.com", SourcePath: "/exports/vms"},
+			wantBuild: true,
+			wantXML:   []string{`<pool type="netfs">`, `<host name="nfs.example.com"></host>`, `<dir path="/exports/vms"></dir>`, `<format type="nfs"></format>`},
+		},
+		{
+			name:    "logical pool with path",
+			spec:    PoolSpec{Name: "vg-vms", Type: PoolTypeLVM, Path: "/dev/vg-vms"},
+			wantErr: true,
+		},
+		{
+			name:    "fs pool without device",
+			spec:    PoolSpec{Name: "fast", Type: PoolTypeFS, Path: "/var/lib/libvirt/fast"},
+			wantErr: true,
+		},
+		{
+			name:    "netfs pool without export",
+			spec:    PoolSpec{Name: "shared", Type: PoolTypeNFS, Path: "/var/lib/libvirt/shared", SourceHost: "nfs.example.com"},
+			wantErr: true,
+		},
+		{
+			name:    "source host on dir pool",
+			spec:    PoolSpec{Name: "dir", Type: PoolTypeDir, Path: "/var/lib/libvirt/dir", SourceHost: "nfs.example.com"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := newMockLibvirtClient()
+			mgr := NewManager(mockClient)
+
+			err := mgr.CreatePool(context.Background(), tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreatePool() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if len(mockClient.pools) != 0 {
+					t.Error("CreatePool() defined a pool for an invalid spec")
+				}
+				return
+			}
+
+			flags, built := mockClient.built[tt.spec.Name]
+			if built != tt.wantBuild || flags != tt.wantFlags {
+				t.Errorf("pool built = %v with flags %d, want %v with flags %d", built, flags, tt.wantBuild, tt.wantFlags)
+			}
+			xml := mockClient.pools[tt.spec.Name].xmlDesc
+			for _, want := range tt.wantXML {
+				if !strings.Contains(xml, want) {
+					t.Errorf("pool XML missing %s:\n%s", want, xml)
+				}
+			}
+		})
+	}
+}
+
 func TestManager_DeletePool(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -119,7 +233,7 @@ func TestManager_DeletePool(t *testing.T) {
 			force:    false,
 			setup: func(m *mockLibvirtClient) {
 				mgr := NewManager(m)
-				_ = mgr.CreatePool(context.Background(), "test-pool", PoolTypeDir, "/var/lib/libvirt/images/test")
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
 			},
 			wantErr: false,
 		},
@@ -129,7 +243,7 @@ func TestManager_DeletePool(t *testing.T) {
 			force:    true,
 			setup: func(m *mockLibvirtClient) {
 				mgr := NewManager(m)
-				_ = mgr.CreatePool(context.Background(), "test-pool", PoolTypeDir, "/var/lib/libvirt/images/test")
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
 				_ = mgr.CreateVolume(context.Background(), "test-pool", VolumeSpec{
 					Name:       "test-vol",
 					Type:       VolumeTypeBoot,
@@ -145,7 +259,7 @@ func TestManager_DeletePool(t *testing.T) {
 			force:    false,
 			setup: func(m *mockLibvirtClient) {
 				mgr := NewManager(m)
-				_ = mgr.CreatePool(context.Background(), DefaultImagesPool, PoolTypeDir, DefaultImagesPath)
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
 			},
 			wantErr: true,
 		},
@@ -155,7 +269,7 @@ func TestManager_DeletePool(t *testing.T) {
 			force:    false,
 			setup: func(m *mockLibvirtClient) {
 				mgr := NewManager(m)
-				_ = mgr.CreatePool(context.Background(), DefaultVMsPool, PoolTypeDir, DefaultVMsPath)
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultVMsPool, Type: PoolTypeDir, Path: DefaultVMsPath})
 			},
 			wantErr: true,
 		},
@@ -188,8 +302,8 @@ func TestManager_ListPools(t *testing.T) {
 	mgr := NewManager(mockClient)
 
 	// Create some pools
-	_ = mgr.CreatePool(context.Background(), "pool1", PoolTypeDir, "/var/lib/libvirt/images/pool1")
-	_ = mgr.CreatePool(context.Background(), "pool2", PoolTypeDir, "/var/lib/libvirt/images/pool2")
+	_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "pool1", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/pool1"})
+	_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "pool2", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/pool2"})
 
 	pools, err := mgr.ListPools(context.Background())
 	if err != nil {
@@ -212,7 +326,7 @@ func TestManager_GetPoolInfo(t *testing.T) {
 			name:     "get info for existing pool",
 			poolName: "test-pool",
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), "test-pool", PoolTypeDir, "/var/lib/libvirt/images/test")
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
 			},
 			wantErr: false,
 		},
@@ -253,6 +367,40 @@ func TestManager_GetPoolInfo(t *testing.T) {
 	}
 }
 
+func TestManager_GetPoolInfo_Types(t *testing.T) {
+	mockClient := newMockLibvirtClient()
+	mgr := NewManager(mockClient)
+	specs := []PoolSpec{
+		{Name: "vg-vms", Type: PoolTypeLVM, SourceDevices: []string{"/dev/sdb"}},
+		{Name: "shared", Type: PoolTypeNFS, Path: "/var/lib/libvirt/shared", SourceHost: "nfs.example.com", SourcePath: "/exports/vms"},
+	}
+	for _, spec := range specs {
+		if err := mgr.CreatePool(context.Background(), spec); err != nil {
+			t.Fatalf("CreatePool(%s) error = %v", spec.Name, err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		wantType   PoolType
+		wantPath   string
+		wantSource string
+	}{
+		{"vg-vms", PoolTypeLVM, "/dev/vg-vms", "vg-vms (/dev/sdb)"},
+		{"shared", PoolTypeNFS, "/var/lib/libvirt/shared", "nfs.example.com:/exports/vms"},
+	}
+	for _, tt := range tests {
+		info, err := mgr.GetPoolInfo(context.Background(), tt.name)
+		if err != nil {
+			t.Fatalf("GetPoolInfo(%s) error = %v", tt.name, err)
+		}
+		if info.Type != tt.wantType || info.Path != tt.wantPath || info.Source != tt.wantSource {
+			t.Errorf("GetPoolInfo(%s) = type %s, path %s, source %s; want %s, %s, %s",
+				tt.name, info.Type, info.Path, info.Source, tt.wantType, tt.wantPath, tt.wantSource)
+		}
+	}
+}
+
 func TestManager_RefreshPool(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -264,7 +412,7 @@ func TestManager_RefreshPool(t *testing.T) {
 			name:     "refresh existing pool",
 			poolName: "test-pool",
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), "test-pool", PoolTypeDir, "/var/lib/libvirt/images/test")
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
 			},
 			wantErr: false,
 		},
@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Compression algorithms for compressed qcow2 images.
+const (
+	CompressionZlib = "zlib"
+	CompressionZstd = "zstd"
+)
+
+// ImportOptions configures how an image is imported. Compression and
+// Sparsify rewrite it with qemu-img before it is imported, to keep the
+// foundry-images pool small. Rewritten images are always qcow2, so the image
+// name must end in .qcow2; the source may be qcow2 or raw.
+type ImportOptions struct {
+	// Compression, if set, compresses the image's clusters with
+	// CompressionZlib or CompressionZstd. Guests read compressed clusters
+	// transparently; clusters they write are stored uncompressed in their
+	// own overlays.
+	Compression string
+
+	// Sparsify drops the clusters of the image that hold only zeros, so they
+	// take no space in the pool.
+	Sparsify bool
+
+	// Report, if non-nil, is called with the image size before and after
+	// rewriting it.
+	Report func(RewriteReport)
+
+	// Metadata is recorded for the image once it is imported, along with
+	// its provenance: the Source, Checksum and ImportedAt fields are set by
+	// the import.
+	Metadata ImageMetadata
+}
+
+// RewriteReport tells how much rewriting an image saved.
+type RewriteReport struct {
+	// Before and After are the image file sizes in bytes.
+	Before int64
+	After  int64
+}
+
+// rewrites reports whether the options rewrite the image.
+func (o ImportOptions) rewrites() bool {
+	return o.Compression != "" || o.Sparsify
+}
+
+// validate checks the options against the name of the imported image.
+func (o ImportOptions) validate(imageName string) error {
+	switch o.Compression {
+	case "", CompressionZlib, CompressionZstd:
+	default:
+		return fmt.Errorf("unsupported compression %q (must be %s or %s)", o.Compression, CompressionZlib, CompressionZstd)
+	}
+	if o.rewrites() && filepath.Ext(imageName) != ".qcow2" {
+		return fmt.Errorf("compressed or sparsified images are qcow2: image name must have .qcow2 extension (got: %q)", imageName)
+	}
+	return nil
+}
+
+// runQemuImg runs qemu-img with args and returns its standard output. It is
+// a variable so tests can run without qemu-img installed.
+var runQemuImg = func(ctx context.Context, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "qemu-img", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("qemu-img is not installed (install qemu-img or qemu-utils): %w", err)
+		}
+		return stdout.Bytes(), fmt.Errorf("qemu-img %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// rewriteImage converts the image at path, of the given format, into a new
+// qcow2 file as configured by opts. The file is created next to path, or in
+// the temporary directory if that is not writable; the caller removes it.
+func rewriteImage(ctx context.Context, path string, format VolumeFormat, opts ImportOptions) (string, error) {
+	out, err := os.CreateTemp(filepath.Dir(path), ".foundry-rewrite-*.qcow2")
+	if err != nil {
+		out, err = os.CreateTemp("", "foundry-rewrite-*.qcow2")
+		if err != nil {
+			return "", fmt.Errorf("failed to create rewritten image file: %w", err)
+		}
+	}
+	outPath := out.Name()
+	_ = out.Close()
+
+	// qemu-img convert never writes zeroed clusters, which sparsifies the
+	// image; compression is on top of that
+	args := []string{"convert", "-f", string(format), "-O", string(VolumeFormatQCOW2)}
+	if opts.Compression != "" {
+		args = append(args, "-c", "-o", "compression_type="+opts.Compression)
+	}
+	args = append(args, path, outPath)
+	if _, err := runQemuImg(ctx, args...); err != nil {
+		_ = os.Remove(outPath)
+		return "", fmt.Errorf("failed to rewrite image: %w", err)
+	}
+
+	if opts.Report != nil {
+		before, err := os.Stat(path)
+		if err != nil {
+			_ = os.Remove(outPath)
+			return "", fmt.Errorf("failed to stat image file: %w", err)
+		}
+		after, err := os.Stat(outPath)
+		if err != nil {
+			_ = os.Remove(outPath)
+			return "", fmt.Errorf("failed to stat rewritten image: %w", err)
+		}
+		opts.Report(RewriteReport{Before: before.Size(), After: after.Size()})
+	}
+	return outPath, nil
+}
+
+// ImageCheck is the result of checking an image with qemu-img check.
+type ImageCheck struct {
+	// Format is the image format.
+	Format string `json:"format" yaml:"format"`
+
+	// Corruptions and Leaks count damaged metadata and clusters allocated
+	// but unused. Leaks waste space but are harmless.
+	Corruptions int `json:"corruptions" yaml:"corruptions"`
+	Leaks       int `json:"leaks" yaml:"leaks"`
+
+	// TotalClusters, AllocatedClusters, CompressedClusters and
+	// FragmentedClusters describe how a qcow2 image is laid out.
+	TotalClusters      int `json:"totalClusters" yaml:"totalClusters"`
+	AllocatedClusters  int `json:"allocatedClusters" yaml:"allocatedClusters"`
+	CompressedClusters int `json:"compressedClusters" yaml:"compressedClusters"`
+	FragmentedClusters int `json:"fragmentedClusters" yaml:"fragmentedClusters"`
+
+	// ImageEndOffset is where the image data ends, i.e. its size on disk
+	// without trailing leaked clusters.
+	ImageEndOffset int64 `json:"imageEndOffset" yaml:"imageEndOffset"`
+}
+
+// OK reports whether the image has no corruptions.
+func (c *ImageCheck) OK() bool {
+	return c.Corruptions == 0
+}
+
+// CheckImage checks the consistency of an image with qemu-img check and
+// reports how its clusters are allocated and compressed. qemu-img reads the
+// image file directly, so the images pool must be on this host.
+func (m *Manager) CheckImage(ctx context.Context, imageName string) (*ImageCheck, error) {
+	path, err := m.GetImagePath(ctx, imageName)
+	if err != nil {
+		return nil, err
+	}
+
+	// qemu-img check exits with 2 or 3 when it finds corruptions or leaks,
+	// but still reports them
+	out, runErr := runQemuImg(ctx, "check", "--output=json", "--force-share", path)
+	var result struct {
+		Format             string `json:"format"`
+		Corruptions        int    `json:"corruptions"`
+		Leaks              int    `json:"leaks"`
+		TotalClusters      int    `json:"total-clusters"`
+		AllocatedClusters  int    `json:"allocated-clusters"`
+		CompressedClusters int    `json:"compressed-clusters"`
+		FragmentedClusters int    `json:"fragmented-clusters"`
+		ImageEndOffset     int64  `json:"image-end-offset"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		if runErr != nil {
+			return nil, runErr
+		}
+		return nil, fmt.Errorf("failed to parse qemu-img check output: %w", err)
+	}
+
+	return &ImageCheck{
+		Format:             result.Format,
+		Corruptions:        result.Corruptions,
+		Leaks:              result.Leaks,
+		TotalClusters:      result.TotalClusters,
+		AllocatedClusters:  result.AllocatedClusters,
+		CompressedClusters: result.CompressedClusters,
+		FragmentedClusters: result.FragmentedClusters,
+		ImageEndOffset:     result.ImageEndOffset,
+	}, nil
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeQemuImg replaces qemu-img for the duration of a test. convert writes
+// a small qcow2 image to its output; other commands print output and fail
+// with err. It returns the arguments of each run.
+func fakeQemuImg(t *testing.T, output string, err error) *[][]string {
+	t.Helper()
+	var calls [][]string
+	prev := runQemuImg
+	runQemuImg = func(ctx context.Context, args ...string) ([]byte, error) {
+		calls = append(calls, args)
+		if args[0] == "convert" {
+			data := append([]byte{0x51, 0x46, 0x49, 0xfb, 0x00, 0x00, 0x00, 0x03}, make([]byte, 56)...)
+			return nil, os.WriteFile(args[len(args)-1], data, 0644)
+		}
+		return []byte(output), err
+	}
+	t.Cleanup(func() { runQemuImg = prev })
+	return &calls
+}
+
+func TestManager_ImportImageWithOptions(t *testing.T) {
+	calls := fakeQemuImg(t, "", nil)
+
+	// A raw source is converted to qcow2
+	rawPath := filepath.Join(t.TempDir(), "ubuntu.raw")
+	raw := make([]byte, 4096)
+	raw[510], raw[511] = 0x55, 0xaa
+	if err := os.WriteFile(rawPath, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mockClient := newMockLibvirtClient()
+	mgr := NewManager(mockClient)
+	_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
+
+	var report RewriteReport
+	err := mgr.ImportImageWithOptions(context.Background(), rawPath, "ubuntu-24.04.qcow2", ImportOptions{
+		Compression: CompressionZstd,
+		Sparsify:    true,
+		Report:      func(r RewriteReport) { report = r },
+	})
+	if err != nil {
+		t.Fatalf("ImportImageWithOptions() error = %v", err)
+	}
+
+	if len(*calls) != 1 {
+		t.Fatalf("qemu-img runs = %v, want one convert", *calls)
+	}
+	args := (*calls)[0]
+	for _, want := range []string{"-f raw", "-O qcow2", "-c", "compression_type=zstd", rawPath} {
+		if !strings.Contains(strings.Join(args, " "), want) {
+			t.Errorf("qemu-img args = %v, want %q", args, want)
+		}
+	}
+	if report.Before != 4096 || report.After != 64 {
+		t.Errorf("report = %+v, want 4096 -> 64 bytes", report)
+	}
+
+	vol := mockClient.volumes[DefaultImagesPool]["ubuntu-24.04.qcow2"]
+	if len(vol.data) != 64 {
+		t.Errorf("uploaded %d bytes, want the rewritten image", len(vol.data))
+	}
+	if _, err := os.Stat(args[len(args)-1]); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("rewritten image left behind: %v", err)
+	}
+}
+
+func TestImportOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      ImportOptions
+		imageName string
+		errMsg    string
+	}{
+		{"no rewrite", ImportOptions{}, "ubuntu.raw", ""},
+		{"sparsify qcow2", ImportOptions{Sparsify: true}, "ubuntu.qcow2", ""},
+		{"compress raw", ImportOptions{Compression: CompressionZlib}, "ubuntu.raw", "must have .qcow2 extension"},
+		{"unknown compression", ImportOptions{Compression: "lz4"}, "ubuntu.qcow2", "unsupported compression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.validate(tt.imageName)
+			if tt.errMsg == "" && err != nil {
+				t.Errorf("validate() error = %v", err)
+			}
+			if tt.errMsg != "" && (err == nil || !strings.Contains(err.Error(), tt.errMsg)) {
+				t.Errorf("validate() error = %v, want %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestManager_CheckImage(t *testing.T) {
+	// qemu-img check fails when it finds leaks but still reports them
+	calls := fakeQemuImg(t, `{"filename": "fedora.qcow2", "format": "qcow2", "leaks": 2, "check-errors": 0,
+		"total-clusters": 81920, "allocated-clusters": 1024, "compressed-clusters": 1000, "fragmented-clusters": 10,
+		"image-end-offset": 67305472}`, errors.New("exit status 3"))
+
+	mockClient := newMockLibvirtClient()
+	mgr := NewManager(mockClient)
+	_ = mgr.CreatePool(context.Background(), PoolSpec{Name: DefaultImagesPool, Type: PoolTypeDir, Path: DefaultImagesPath})
+	_ = mgr.CreateVolume(context.Background(), DefaultImagesPool, VolumeSpec{Name: "fedora.qcow2", Type: VolumeTypeBaseImage, Format: VolumeFormatQCOW2, CapacityGB: 1})
+
+	check, err := mgr.CheckImage(context.Background(), "fedora.qcow2")
+	if err != nil {
+		t.Fatalf("CheckImage() error = %v", err)
+	}
+	want := ImageCheck{Format: "qcow2", Leaks: 2, TotalClusters: 81920, AllocatedClusters: 1024,
+		CompressedClusters: 1000, FragmentedClusters: 10, ImageEndOffset: 67305472}
+	if *check != want {
+		t.Errorf("CheckImage() = %+v, want %+v", *check, want)
+	}
+	if !check.OK() {
+		t.Error("OK() = false, want leaks to be harmless")
+	}
+	if args := (*calls)[0]; !slices.Contains(args, "check") || !strings.HasSuffix(args[len(args)-1], "fedora.qcow2") {
+		t.Errorf("qemu-img args = %v, want a check of the image path", args)
+	}
+
+	fakeQemuImg(t, "", errors.New("qemu-img is not installed"))
+	if _, err := mgr.CheckImage(context.Background(), "fedora.qcow2"); err == nil {
+		t.Error("CheckImage() error = nil, want the qemu-img failure")
+	}
+}
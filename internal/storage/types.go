@@ -7,7 +7,8 @@ type PoolType string
 
 const (
 	PoolTypeDir     PoolType = "dir"     // Directory-based storage
-	PoolTypeLVM     PoolType = "lvm"     // LVM volume group
+	PoolTypeLVM     PoolType = "logical" // LVM volume group
+	PoolTypeFS      PoolType = "fs"      // Filesystem on a block device
 	PoolTypeZFS     PoolType = "zfs"     // ZFS pool
 	PoolTypeNFS     PoolType = "netfs"   // NFS mount
 	PoolTypeCeph    PoolType = "rbd"     // Ceph RBD
@@ -23,6 +24,7 @@ const (
 	VolumeTypeData      VolumeType = "data"       // Data disk volume
 	VolumeTypeCloudInit VolumeType = "cloudinit"  // Cloud-init ISO volume
 	VolumeTypeBaseImage VolumeType = "base-image" // Base OS image volume
+	VolumeTypeMetadata  VolumeType = "metadata"   // Image metadata sidecar volume
 )
 
 // VolumeFormat represents the disk format.
@@ -40,8 +42,17 @@ type VolumeSpec struct {
 	Format        VolumeFormat // Disk format (qcow2, raw)
 	CapacityGB    uint64       // Capacity in GB
 	BackingVolume string       // Optional: backing volume path for qcow2 snapshots (filesystem path, not pool:volume - required because backing images are typically in a different pool like foundry-images)
+	SourceVolume  string       // Optional: path of a volume whose content is copied into the new volume, converted to Format (for raw volumes, which cannot have a backing volume)
+	BackingFormat VolumeFormat // Optional: format of BackingVolume; CreateVolume detects it from the volume's magic bytes if empty
+
+	// qcow2 v3 options
+	LazyRefcounts  bool   // Optional: defer reference count updates, making writes faster at the cost of a repair after a crash
+	ClusterSizeKiB uint64 // Optional: cluster size in KiB, a power of two from 1 to 2048 (qemu's default is 64)
 }
 
+// maxClusterSizeKiB is the largest qcow2 cluster size, 2 MiB.
+const maxClusterSizeKiB = 2048
+
 // Validate checks if the volume spec is valid.
 func (v *VolumeSpec) Validate() error {
 	if v.Name == "" {
@@ -56,27 +67,100 @@ func (v *VolumeSpec) Validate() error {
 	if v.Format != VolumeFormatQCOW2 && v.Format != VolumeFormatRaw {
 		return fmt.Errorf("invalid volume format: %s (must be qcow2 or raw)", v.Format)
 	}
-	if v.CapacityGB == 0 && v.Type != VolumeTypeCloudInit {
+	if v.CapacityGB == 0 && v.Type != VolumeTypeCloudInit && v.Type != VolumeTypeMetadata {
 		return fmt.Errorf("volume capacity must be greater than 0")
 	}
 	if v.BackingVolume != "" && v.Format != VolumeFormatQCOW2 {
 		return fmt.Errorf("backing volumes are only supported for qcow2 format")
 	}
+	if v.BackingVolume != "" && v.SourceVolume != "" {
+		return fmt.Errorf("backing volume and source volume are mutually exclusive")
+	}
+	if v.BackingFormat != "" && v.BackingFormat != VolumeFormatQCOW2 && v.BackingFormat != VolumeFormatRaw {
+		return fmt.Errorf("invalid backing format: %s (must be qcow2 or raw)", v.BackingFormat)
+	}
+	if (v.LazyRefcounts || v.ClusterSizeKiB != 0) && v.Format != VolumeFormatQCOW2 {
+		return fmt.Errorf("lazy refcounts and cluster size are only supported for qcow2 format")
+	}
+	if v.ClusterSizeKiB != 0 && (v.ClusterSizeKiB > maxClusterSizeKiB || v.ClusterSizeKiB&(v.ClusterSizeKiB-1) != 0) {
+		return fmt.Errorf("invalid cluster size: %d KiB (must be a power of two from 1 to %d)", v.ClusterSizeKiB, maxClusterSizeKiB)
+	}
+	return nil
+}
+
+// PoolSpec specifies how to create a storage pool.
+type PoolSpec struct {
+	Name          string   // Pool name
+	Type          PoolType // Pool type (dir, logical, fs, netfs)
+	Path          string   // Target path: the directory (dir) or mount point (fs, netfs); logical pools use /dev/<volume group>
+	SourceDevices []string // Block devices: the physical volumes of a new volume group (logical) or the device to mount (fs)
+	SourceName    string   // Volume group name (logical); defaults to the pool name
+	SourceHost    string   // NFS server (netfs)
+	SourcePath    string   // Exported directory on the NFS server (netfs)
+	SourceFormat  string   // Filesystem type (fs, defaults to auto; netfs, defaults to nfs)
+}
+
+// Validate checks if the pool spec is valid for its type.
+func (p *PoolSpec) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("pool name is required")
+	}
+
+	switch p.Type {
+	case PoolTypeDir:
+		if p.Path == "" {
+			return fmt.Errorf("dir pools require a path")
+		}
+	case PoolTypeLVM:
+		if p.Path != "" {
+			return fmt.Errorf("logical pools do not take a path (volumes are created in /dev/<volume group>)")
+		}
+	case PoolTypeFS:
+		if p.Path == "" {
+			return fmt.Errorf("fs pools require a mount point path")
+		}
+		if len(p.SourceDevices) != 1 {
+			return fmt.Errorf("fs pools require exactly one source device")
+		}
+	case PoolTypeNFS:
+		if p.Path == "" {
+			return fmt.Errorf("netfs pools require a mount point path")
+		}
+		if p.SourceHost == "" || p.SourcePath == "" {
+			return fmt.Errorf("netfs pools require a source host and path")
+		}
+	default:
+		return fmt.Errorf("unsupported pool type: %s (must be dir, logical, fs or netfs)", p.Type)
+	}
+
+	if p.Type != PoolTypeLVM && p.SourceName != "" {
+		return fmt.Errorf("source name is only supported for logical pools")
+	}
+	if p.Type != PoolTypeNFS && (p.SourceHost != "" || p.SourcePath != "") {
+		return fmt.Errorf("source host and path are only supported for netfs pools")
+	}
+	if (p.Type == PoolTypeDir || p.Type == PoolTypeNFS) && len(p.SourceDevices) > 0 {
+		return fmt.Errorf("source devices are only supported for logical and fs pools")
+	}
+	if (p.Type == PoolTypeDir || p.Type == PoolTypeLVM) && p.SourceFormat != "" {
+		return fmt.Errorf("source format is only supported for fs and netfs pools")
+	}
 	return nil
 }
 
 // PoolInfo contains information about a storage pool.
 type PoolInfo struct {
-	Name       string   // Pool name
-	Type       PoolType // Pool type
-	Path       string   // Pool path (for dir-based pools)
-	UUID       string   // Pool UUID
-	State      string   // Pool state (running, stopped, etc.)
-	Autostart  bool     // Whether pool auto-starts on boot
-	Persistent bool     // Whether pool is persistent
-	Capacity   uint64   // Total capacity in bytes
-	Allocation uint64   // Allocated space in bytes
-	Available  uint64   // Available space in bytes
+	Name       string   `json:"name" yaml:"name"`                         // Pool name
+	Type       PoolType `json:"type" yaml:"type"`                         // Pool type
+	Path       string   `json:"path" yaml:"path"`                         // Pool target path (directory, mount point or volume group device directory)
+	Source     string   `json:"source,omitempty" yaml:"source,omitempty"` // Pool source (devices, volume group or NFS export), if any
+	UUID       string   `json:"uuid" yaml:"uuid"`                         // Pool UUID
+	State      string   `json:"state" yaml:"state"`                       // Pool state (running, stopped, etc.)
+	Autostart  bool     `json:"autostart" yaml:"autostart"`               // Whether pool auto-starts on boot
+	Persistent bool     `json:"persistent" yaml:"persistent"`             // Whether pool is persistent
+	Capacity   uint64   `json:"capacity" yaml:"capacity"`                 // Total capacity in bytes
+	Allocation uint64   `json:"allocation" yaml:"allocation"`             // Allocated space in bytes
+	Available  uint64   `json:"available" yaml:"available"`               // Available space in bytes
 }
 
 // CapacityGB returns the pool capacity in GB.
@@ -96,13 +180,14 @@ func (p *PoolInfo) AvailableGB() float64 {
 
 // VolumeInfo contains information about a storage volume.
 type VolumeInfo struct {
-	Name       string       // Volume name
-	Type       VolumeType   // Volume type
-	Format     VolumeFormat // Disk format
-	Path       string       // Full path to volume
-	Pool       string       // Pool name
-	Capacity   uint64       // Capacity in bytes
-	Allocation uint64       // Allocated space in bytes
+	Name       string       `json:"name" yaml:"name"`                           // Volume name
+	Type       VolumeType   `json:"type" yaml:"type"`                           // Volume type
+	Format     VolumeFormat `json:"format" yaml:"format"`                       // Disk format
+	Path       string       `json:"path" yaml:"path"`                           // Full path to volume
+	Pool       string       `json:"pool" yaml:"pool"`                           // Pool name
+	Capacity   uint64       `json:"capacity" yaml:"capacity"`                   // Capacity in bytes
+	Allocation uint64       `json:"allocation" yaml:"allocation"`               // Allocated space in bytes
+	Backing    string       `json:"backing,omitempty" yaml:"backing,omitempty"` // Path of the backing file, if any
 }
 
 // CapacityGB returns the volume capacity in GB.
@@ -115,7 +200,30 @@ func (v *VolumeInfo) AllocationGB() float64 {
 	return float64(v.Allocation) / (1024 * 1024 * 1024)
 }
 
-// Default pool configuration.
+// Saved returns the bytes of the volume's capacity that are not allocated on
+// the host, i.e. what thin provisioning and discard are saving.
+func (v *VolumeInfo) Saved() uint64 {
+	if v.Allocation >= v.Capacity {
+		return 0
+	}
+	return v.Capacity - v.Allocation
+}
+
+// SavedGB returns the unallocated part of the volume's capacity in GB.
+func (v *VolumeInfo) SavedGB() float64 {
+	return float64(v.Saved()) / (1024 * 1024 * 1024)
+}
+
+// SavedPercent returns the unallocated part of the volume's capacity as a
+// percentage of the capacity.
+func (v *VolumeInfo) SavedPercent() float64 {
+	if v.Capacity == 0 {
+		return 0
+	}
+	return float64(v.Saved()) / float64(v.Capacity) * 100
+}
+
+// Default pool configuration, unless changed with SetDefaultPools.
 const (
 	// DefaultImagesPool is the pool name for base OS images.
 	DefaultImagesPool = "foundry-images"
@@ -126,3 +234,60 @@ const (
 	// DefaultVMsPath is the default path for VM disks.
 	DefaultVMsPath = "/var/lib/libvirt/images/foundry/vms"
 )
+
+// DefaultPools are the pools holding base images and VM disks, which
+// EnsureDefaultPools creates.
+type DefaultPools struct {
+	// ImagesPool and ImagesPath are the name and directory of the pool for
+	// base OS images.
+	ImagesPool string
+	ImagesPath string
+
+	// VMsPool and VMsPath are the name and directory of the pool for VM
+	// disks.
+	VMsPool string
+	VMsPath string
+}
+
+// defaultPools holds the pools set by SetDefaultPools.
+var defaultPools DefaultPools
+
+// SetDefaultPools changes the default pools (e.g., from the host config).
+// Empty fields keep the built-in defaults.
+func SetDefaultPools(pools DefaultPools) {
+	defaultPools = pools
+}
+
+// GetDefaultPools returns the default pools, with the built-in defaults
+// filled in.
+func GetDefaultPools() DefaultPools {
+	pools := defaultPools
+	if pools.ImagesPool == "" {
+		pools.ImagesPool = DefaultImagesPool
+	}
+	if pools.ImagesPath == "" {
+		pools.ImagesPath = DefaultImagesPath
+	}
+	if pools.VMsPool == "" {
+		pools.VMsPool = DefaultVMsPool
+	}
+	if pools.VMsPath == "" {
+		pools.VMsPath = DefaultVMsPath
+	}
+	return pools
+}
+
+// ImagesPool returns the name of the pool for base OS images.
+func ImagesPool() string {
+	return GetDefaultPools().ImagesPool
+}
+
+// VMsPool returns the name of the pool for VM disks.
+func VMsPool() string {
+	return GetDefaultPools().VMsPool
+}
+
+// IsDefaultPool reports whether name is one of the default pools.
+func IsDefaultPool(name string) bool {
+	return name == ImagesPool() || name == VMsPool()
+}
@@ -118,6 +118,86 @@ func TestVolumeSpec_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "raw volume copied from source volume",
+			spec: VolumeSpec{
+				Name:         "my-vm_boot",
+				Type:         VolumeTypeBoot,
+				Format:       VolumeFormatRaw,
+				CapacityGB:   50,
+				SourceVolume: "/var/lib/libvirt/images/fedora-43.qcow2",
+			},
+			wantErr: false,
+		},
+		{
+			name: "backing and source volume",
+			spec: VolumeSpec{
+				Name:          "my-vm_boot",
+				Type:          VolumeTypeBoot,
+				Format:        VolumeFormatQCOW2,
+				CapacityGB:    50,
+				BackingVolume: "/var/lib/libvirt/images/fedora-43.qcow2",
+				SourceVolume:  "/var/lib/libvirt/images/fedora-43.qcow2",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid backing format",
+			spec: VolumeSpec{
+				Name:          "my-vm_boot",
+				Type:          VolumeTypeBoot,
+				Format:        VolumeFormatQCOW2,
+				CapacityGB:    50,
+				BackingVolume: "/var/lib/libvirt/images/fedora-43.vmdk",
+				BackingFormat: "vmdk",
+			},
+			wantErr: true,
+		},
+		{
+			name: "qcow2 v3 options",
+			spec: VolumeSpec{
+				Name:           "my-vm_boot",
+				Type:           VolumeTypeBoot,
+				Format:         VolumeFormatQCOW2,
+				CapacityGB:     50,
+				LazyRefcounts:  true,
+				ClusterSizeKiB: 2048,
+			},
+			wantErr: false,
+		},
+		{
+			name: "qcow2 options on raw volume",
+			spec: VolumeSpec{
+				Name:          "my-vm_boot",
+				Type:          VolumeTypeBoot,
+				Format:        VolumeFormatRaw,
+				CapacityGB:    50,
+				LazyRefcounts: true,
+			},
+			wantErr: true,
+		},
+		{
+			name: "cluster size not a power of two",
+			spec: VolumeSpec{
+				Name:           "my-vm_boot",
+				Type:           VolumeTypeBoot,
+				Format:         VolumeFormatQCOW2,
+				CapacityGB:     50,
+				ClusterSizeKiB: 96,
+			},
+			wantErr: true,
+		},
+		{
+			name: "cluster size too large",
+			spec: VolumeSpec{
+				Name:           "my-vm_boot",
+				Type:           VolumeTypeBoot,
+				Format:         VolumeFormatQCOW2,
+				CapacityGB:     50,
+				ClusterSizeKiB: 4096,
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -163,4 +243,18 @@ func TestVolumeInfo_Conversions(t *testing.T) {
 	if got := info.AllocationGB(); got != 25.0 {
 		t.Errorf("AllocationGB() = %v, want 25.0", got)
 	}
+
+	if got := info.SavedGB(); got != 25.0 {
+		t.Errorf("SavedGB() = %v, want 25.0", got)
+	}
+
+	if got := info.SavedPercent(); got != 50.0 {
+		t.Errorf("SavedPercent() = %v, want 50.0", got)
+	}
+
+	// qcow2 metadata can make the allocation exceed the capacity
+	info.Allocation = info.Capacity + 1024
+	if got := info.Saved(); got != 0 {
+		t.Errorf("Saved() = %v, want 0 when fully allocated", got)
+	}
 }
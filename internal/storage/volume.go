@@ -3,15 +3,22 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"path/filepath"
+	"io"
 	"strings"
 
+	"github.com/digitalocean/go-libvirt"
 	libvirtxml "libvirt.org/go/libvirtxml"
+
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/timing"
 )
 
 // CreateVolume creates a new volume in the specified pool.
 func (m *Manager) CreateVolume(_ context.Context, poolName string, spec VolumeSpec) error {
+	defer timing.Start("create volume " + spec.Name)()
+
 	// Validate the volume spec
 	if err := spec.Validate(); err != nil {
 		return fmt.Errorf("invalid volume spec: %w", err)
@@ -23,12 +30,34 @@ func (m *Manager) CreateVolume(_ context.Context, poolName string, spec VolumeSp
 		return fmt.Errorf("pool not found: %w", err)
 	}
 
+	poolType, err := m.checkPoolFormat(pool, spec)
+	if err != nil {
+		return err
+	}
+
+	// Modern qemu refuses backing files without an explicit format
+	if spec.BackingVolume != "" && spec.BackingFormat == "" {
+		spec.BackingFormat = m.detectBackingFormat(spec.BackingVolume)
+	}
+
 	// Generate volume XML
-	volumeXML, err := generateVolumeXML(poolName, spec, m)
+	volumeXML, err := generateVolumeXML(spec, poolType)
 	if err != nil {
 		return fmt.Errorf("failed to generate volume XML: %w", err)
 	}
 
+	// Copy the source volume into the new one, if any
+	if spec.SourceVolume != "" {
+		source, err := m.client.StorageVolLookupByPath(spec.SourceVolume)
+		if err != nil {
+			return fmt.Errorf("source volume not found: %w", err)
+		}
+		if _, err := m.client.StorageVolCreateXMLFrom(pool, volumeXML, source, 0); err != nil {
+			return fmt.Errorf("failed to copy volume %s: %w", spec.SourceVolume, err)
+		}
+		return nil
+	}
+
 	// Create the volume
 	_, err = m.client.StorageVolCreateXML(pool, volumeXML, 0)
 	if err != nil {
@@ -38,8 +67,264 @@ func (m *Manager) CreateVolume(_ context.Context, poolName string, spec VolumeSp
 	return nil
 }
 
+// checkPoolFormat returns the type of pool, checking that it can hold
+// volumes of spec.Format: logical (LVM) pools only hold raw volumes.
+func (m *Manager) checkPoolFormat(pool libvirt.StoragePool, spec VolumeSpec) (PoolType, error) {
+	poolType, err := m.poolTypeOf(pool)
+	if err != nil {
+		return "", err
+	}
+	if poolType == PoolTypeLVM && spec.Format != VolumeFormatRaw {
+		return "", fmt.Errorf("pool %s is a logical (LVM) pool, which only holds raw volumes (not %s)", pool.Name, spec.Format)
+	}
+	return poolType, nil
+}
+
+// CloneVolume creates a new volume in the specified pool holding a full copy
+// of the volume sourceName in sourcePool. The copy does not depend on the
+// source's backing chain: qcow2 overlays are flattened into the new volume.
+func (m *Manager) CloneVolume(_ context.Context, poolName string, spec VolumeSpec, sourcePool, sourceName string) error {
+	defer timing.Start("clone volume " + spec.Name)()
+
+	// Validate the volume spec
+	if err := spec.Validate(); err != nil {
+		return fmt.Errorf("invalid volume spec: %w", err)
+	}
+	if spec.BackingVolume != "" || spec.SourceVolume != "" {
+		return fmt.Errorf("cloned volumes cannot have a backing or source volume")
+	}
+
+	// Look up the pool
+	pool, err := m.client.StoragePoolLookupByName(poolName)
+	if err != nil {
+		return fmt.Errorf("pool not found: %w", err)
+	}
+
+	// Look up the source volume
+	srcPool, err := m.client.StoragePoolLookupByName(sourcePool)
+	if err != nil {
+		return fmt.Errorf("source pool not found: %w", err)
+	}
+	source, err := m.client.StorageVolLookupByName(srcPool, sourceName)
+	if err != nil {
+		return fmt.Errorf("source volume not found: %w", err)
+	}
+
+	poolType, err := m.checkPoolFormat(pool, spec)
+	if err != nil {
+		return err
+	}
+
+	// Generate volume XML
+	volumeXML, err := generateVolumeXML(spec, poolType)
+	if err != nil {
+		return fmt.Errorf("failed to generate volume XML: %w", err)
+	}
+
+	// Create the volume from the source
+	if _, err := m.client.StorageVolCreateXMLFrom(pool, volumeXML, source, 0); err != nil {
+		return fmt.Errorf("failed to clone volume %s: %w", sourceName, err)
+	}
+
+	return nil
+}
+
+// flattenSuffix is appended to a volume's name to name its flattened copy
+// while FlattenVolume replaces it.
+const flattenSuffix = ".flatten"
+
+// FlattenVolume collapses the backing chain of a volume into the volume
+// itself, so that it no longer depends on its base image. It reports whether
+// the volume had a backing chain; volumes without one are left alone.
+//
+// Libvirt cannot rewrite a volume in place or rename one, so the volume is
+// copied to "<name>.flatten" without a backing file (qemu-img convert), the
+// original deleted and the copy copied back under the original name. The
+// original is only deleted once the first copy succeeded. If the copy back
+// fails, the volume is recreated as an overlay of "<name>.flatten", which
+// takes no space and holds the same data, so the volume never goes missing;
+// "<name>.flatten" must then be kept until the volume is flattened again.
+// The volume must not be in use: flatten disks of running VMs with a block
+// pull instead.
+func (m *Manager) FlattenVolume(_ context.Context, poolName, volumeName string) (bool, error) {
+	defer timing.Start("flatten volume " + volumeName)()
+
+	// Look up the pool and volume
+	pool, err := m.client.StoragePoolLookupByName(poolName)
+	if err != nil {
+		return false, fmt.Errorf("pool not found: %w", err)
+	}
+	vol, err := m.client.StorageVolLookupByName(pool, volumeName)
+	if err != nil {
+		return false, fmt.Errorf("volume not found: %w", err)
+	}
+
+	xmlDesc, err := m.client.StorageVolGetXMLDesc(vol, 0)
+	if err != nil {
+		return false, fmt.Errorf("failed to get volume XML: %w", err)
+	}
+	var volDef libvirtxml.StorageVolume
+	if err := volDef.Unmarshal(xmlDesc); err != nil {
+		return false, fmt.Errorf("failed to parse volume XML: %w", err)
+	}
+	if volDef.BackingStore == nil || volDef.BackingStore.Path == "" {
+		return false, nil
+	}
+
+	// Copy the volume, without its backing file, to a temporary volume
+	tmpName := volumeName + flattenSuffix
+	tmpXML, err := flattenedVolumeXML(volDef, tmpName)
+	if err != nil {
+		return false, fmt.Errorf("failed to generate volume XML: %w", err)
+	}
+	tmp, err := m.client.StorageVolCreateXMLFrom(pool, tmpXML, vol, 0)
+	if err != nil {
+		return false, fmt.Errorf("failed to copy volume %s: %w", volumeName, err)
+	}
+
+	// Replace the original with a copy of the flattened volume
+	origXML, err := flattenedVolumeXML(volDef, volumeName)
+	if err != nil {
+		_ = m.client.StorageVolDelete(tmp, 0)
+		return false, fmt.Errorf("failed to generate volume XML: %w", err)
+	}
+	if err := m.client.StorageVolDelete(vol, 0); err != nil {
+		_ = m.client.StorageVolDelete(tmp, 0)
+		return false, fmt.Errorf("failed to delete volume %s: %w", volumeName, err)
+	}
+	if _, err := m.client.StorageVolCreateXMLFrom(pool, origXML, tmp, 0); err != nil {
+		if restoreErr := m.restoreFromFlattened(pool, volDef, volumeName, tmp); restoreErr != nil {
+			return false, fmt.Errorf("failed to copy flattened volume back to %s (its data is kept in %s/%s): %w", volumeName, poolName, tmpName, errors.Join(err, restoreErr))
+		}
+		return false, fmt.Errorf("failed to copy flattened volume back to %s; it was recreated on top of %s/%s, which must be kept: %w", volumeName, poolName, tmpName, err)
+	}
+	if err := m.client.StorageVolDelete(tmp, 0); err != nil {
+		return true, fmt.Errorf("volume flattened but failed to delete %s: %w", tmpName, err)
+	}
+
+	return true, nil
+}
+
+// restoreFromFlattened recreates a volume deleted by FlattenVolume as an
+// overlay of its flattened copy tmp. Creating an overlay copies no data, so
+// it succeeds where copying the flattened volume back failed for lack of
+// space.
+func (m *Manager) restoreFromFlattened(pool libvirt.StoragePool, volDef libvirtxml.StorageVolume, name string, tmp libvirt.StorageVol) error {
+	tmpPath, err := m.client.StorageVolGetPath(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to get path of %s: %w", tmp.Name, err)
+	}
+	backing := &libvirtxml.StorageVolumeBackingStore{Path: tmpPath}
+	if volDef.Target != nil && volDef.Target.Format != nil {
+		backing.Format = &libvirtxml.StorageVolumeTargetFormat{Type: volDef.Target.Format.Type}
+	}
+	volDef.BackingStore = backing
+	xml, err := volumeCopyXML(volDef, name)
+	if err != nil {
+		return fmt.Errorf("failed to generate volume XML: %w", err)
+	}
+	if _, err := m.client.StorageVolCreateXML(pool, xml, 0); err != nil {
+		return fmt.Errorf("failed to recreate volume %s: %w", name, err)
+	}
+	return nil
+}
+
+// flattenedVolumeXML returns the XML of a volume named name with the
+// capacity, format and permissions of volDef but no backing store.
+func flattenedVolumeXML(volDef libvirtxml.StorageVolume, name string) (string, error) {
+	volDef.BackingStore = nil
+	return volumeCopyXML(volDef, name)
+}
+
+// volumeCopyXML returns the XML of a new volume named name with the
+// capacity, format, permissions and backing store of volDef.
+func volumeCopyXML(volDef libvirtxml.StorageVolume, name string) (string, error) {
+	volDef.Name = name
+	volDef.Key = ""
+	volDef.Allocation = nil
+	volDef.Physical = nil
+	if volDef.Target != nil {
+		target := *volDef.Target
+		target.Path = ""
+		volDef.Target = &target
+	}
+
+	xmlBytes, err := volDef.Marshal()
+	if err != nil {
+		return "", err
+	}
+
+	// Clean up the XML: remove standalone attribute
+	xml := string(xmlBytes)
+	xml = strings.TrimPrefix(xml, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	xml = strings.TrimSpace(xml)
+
+	return xml, nil
+}
+
+// exportSuffix is appended to a volume's name to name the flattened copy
+// downloaded when exporting it.
+const exportSuffix = ".export"
+
+// ExportVolume writes the contents of a volume to w, in the volume's format.
+// Volumes with a backing file are first copied into a temporary standalone
+// volume, so the exported image does not depend on the base image; the
+// temporary volume is deleted afterwards.
+//
+// The volume should not be in use while it is exported.
+func (m *Manager) ExportVolume(ctx context.Context, poolName, volumeName string, w io.Writer) error {
+	defer timing.Start("export volume " + volumeName)()
+
+	// Look up the pool and volume
+	pool, err := m.client.StoragePoolLookupByName(poolName)
+	if err != nil {
+		return fmt.Errorf("pool not found: %w", err)
+	}
+	vol, err := m.client.StorageVolLookupByName(pool, volumeName)
+	if err != nil {
+		return fmt.Errorf("volume not found: %w", err)
+	}
+
+	xmlDesc, err := m.client.StorageVolGetXMLDesc(vol, 0)
+	if err != nil {
+		return fmt.Errorf("failed to get volume XML: %w", err)
+	}
+	var volDef libvirtxml.StorageVolume
+	if err := volDef.Unmarshal(xmlDesc); err != nil {
+		return fmt.Errorf("failed to parse volume XML: %w", err)
+	}
+
+	// Download a flattened copy of volumes with a backing file
+	if volDef.BackingStore != nil && volDef.BackingStore.Path != "" {
+		tmpName := volumeName + exportSuffix
+		tmpXML, err := flattenedVolumeXML(volDef, tmpName)
+		if err != nil {
+			return fmt.Errorf("failed to generate volume XML: %w", err)
+		}
+		tmp, err := m.client.StorageVolCreateXMLFrom(pool, tmpXML, vol, 0)
+		if err != nil {
+			return fmt.Errorf("failed to copy volume %s: %w", volumeName, err)
+		}
+		defer func() {
+			if err := m.client.StorageVolDelete(tmp, 0); err != nil {
+				logging.FromContext(ctx).Warn("Failed to delete temporary volume", "pool", poolName, "volume", tmpName, "error", err)
+			}
+		}()
+		vol = tmp
+	}
+
+	// Download the volume; a length of 0 reads to the end
+	if err := m.client.StorageVolDownload(vol, w, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to download volume %s: %w", volumeName, err)
+	}
+
+	return nil
+}
+
 // DeleteVolume deletes a volume from the specified pool.
 func (m *Manager) DeleteVolume(_ context.Context, poolName, volumeName string) error {
+	defer timing.Start("delete volume " + volumeName)()
+
 	// Look up the pool
 	pool, err := m.client.StoragePoolLookupByName(poolName)
 	if err != nil {
@@ -90,19 +375,64 @@ func (m *Manager) ListVolumes(_ context.Context, poolName string) ([]VolumeInfo,
 			continue
 		}
 
-		volumeInfos = append(volumeInfos, VolumeInfo{
+		info := VolumeInfo{
 			Name:       vol.Name,
 			Path:       path,
 			Pool:       poolName,
 			Capacity:   capacity,
 			Allocation: allocation,
-			// Type and Format would require parsing XML, skip for now
-		})
+		}
+		// Format and backing file are only in the volume XML; volumes whose
+		// XML cannot be read are listed without them
+		if xmlDesc, err := m.client.StorageVolGetXMLDesc(vol, 0); err == nil {
+			_ = info.setFromXML(xmlDesc)
+		}
+		volumeInfos = append(volumeInfos, info)
 	}
 
 	return volumeInfos, nil
 }
 
+// ResizeVolume grows a volume to capacityGB.
+//
+// Shrinking is refused: the guest filesystem would be truncated. Resizing to
+// the current capacity is a no-op. The volume must not be in use by a running
+// VM; resize those through the domain (block resize) instead.
+func (m *Manager) ResizeVolume(_ context.Context, poolName, volumeName string, capacityGB uint64) error {
+	// Look up the pool
+	pool, err := m.client.StoragePoolLookupByName(poolName)
+	if err != nil {
+		return fmt.Errorf("pool not found: %w", err)
+	}
+
+	// Look up the volume
+	vol, err := m.client.StorageVolLookupByName(pool, volumeName)
+	if err != nil {
+		return fmt.Errorf("volume not found: %w", err)
+	}
+
+	// Compare against the current capacity
+	_, capacity, _, err := m.client.StorageVolGetInfo(vol)
+	if err != nil {
+		return fmt.Errorf("failed to get volume info: %w", err)
+	}
+
+	newCapacity := capacityGB * 1024 * 1024 * 1024
+	if newCapacity < capacity {
+		return fmt.Errorf("cannot shrink volume %s from %.1fGB to %dGB", volumeName, float64(capacity)/(1024*1024*1024), capacityGB)
+	}
+	if newCapacity == capacity {
+		return nil
+	}
+
+	// Resize the volume
+	if err := m.client.StorageVolResize(vol, newCapacity, 0); err != nil {
+		return fmt.Errorf("failed to resize volume: %w", err)
+	}
+
+	return nil
+}
+
 // GetVolumePath gets the full filesystem path for a volume.
 func (m *Manager) GetVolumePath(_ context.Context, poolName, volumeName string) (string, error) {
 	// Look up the pool
@@ -126,8 +456,58 @@ func (m *Manager) GetVolumePath(_ context.Context, poolName, volumeName string)
 	return path, nil
 }
 
+// GetVolumeInfoByPath returns the volume at path, in whichever pool holds
+// it. Files outside every storage pool are not volumes and return an error.
+func (m *Manager) GetVolumeInfoByPath(_ context.Context, path string) (*VolumeInfo, error) {
+	vol, err := m.client.StorageVolLookupByPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("no storage pool volume at %s: %w", path, err)
+	}
+
+	_, capacity, allocation, err := m.client.StorageVolGetInfo(vol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get volume info: %w", err)
+	}
+
+	info := &VolumeInfo{
+		Name:       vol.Name,
+		Path:       path,
+		Pool:       vol.Pool,
+		Capacity:   capacity,
+		Allocation: allocation,
+	}
+
+	// Format and backing file are only in the volume XML
+	xmlDesc, err := m.client.StorageVolGetXMLDesc(vol, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get volume XML: %w", err)
+	}
+	if err := info.setFromXML(xmlDesc); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// setFromXML fills in the format and backing file of a volume from its XML.
+func (v *VolumeInfo) setFromXML(xmlDesc string) error {
+	var volDef libvirtxml.StorageVolume
+	if err := volDef.Unmarshal(xmlDesc); err != nil {
+		return fmt.Errorf("failed to parse volume XML: %w", err)
+	}
+	if volDef.Target != nil && volDef.Target.Format != nil {
+		v.Format = VolumeFormat(volDef.Target.Format.Type)
+	}
+	if volDef.BackingStore != nil {
+		v.Backing = volDef.BackingStore.Path
+	}
+	return nil
+}
+
 // WriteVolumeData uploads data to a volume (used for cloud-init ISOs).
 func (m *Manager) WriteVolumeData(_ context.Context, poolName, volumeName string, data []byte) error {
+	defer timing.Start("write volume " + volumeName)()
+
 	// Look up the pool
 	pool, err := m.client.StoragePoolLookupByName(poolName)
 	if err != nil {
@@ -149,6 +529,55 @@ func (m *Manager) WriteVolumeData(_ context.Context, poolName, volumeName string
 	return nil
 }
 
+// UploadVolume replaces the contents of a volume with length bytes read
+// from r, streamed so that whole disk images can be written without holding
+// them in memory.
+func (m *Manager) UploadVolume(_ context.Context, poolName, volumeName string, r io.Reader, length uint64) error {
+	defer timing.Start("upload volume " + volumeName)()
+
+	// Look up the pool
+	pool, err := m.client.StoragePoolLookupByName(poolName)
+	if err != nil {
+		return fmt.Errorf("pool not found: %w", err)
+	}
+
+	// Look up the volume
+	vol, err := m.client.StorageVolLookupByName(pool, volumeName)
+	if err != nil {
+		return fmt.Errorf("volume not found: %w", err)
+	}
+
+	if err := m.client.StorageVolUpload(vol, r, 0, length, 0); err != nil {
+		return fmt.Errorf("failed to upload data to volume %s: %w", volumeName, err)
+	}
+
+	return nil
+}
+
+// ReadVolumeData downloads the contents of a volume (used for small metadata
+// volumes; the whole volume is read into memory).
+func (m *Manager) ReadVolumeData(_ context.Context, poolName, volumeName string) ([]byte, error) {
+	// Look up the pool
+	pool, err := m.client.StoragePoolLookupByName(poolName)
+	if err != nil {
+		return nil, fmt.Errorf("pool not found: %w", err)
+	}
+
+	// Look up the volume
+	vol, err := m.client.StorageVolLookupByName(pool, volumeName)
+	if err != nil {
+		return nil, fmt.Errorf("volume not found: %w", err)
+	}
+
+	// Download the volume; a length of 0 reads to the end
+	var buf bytes.Buffer
+	if err := m.client.StorageVolDownload(vol, &buf, 0, 0, 0); err != nil {
+		return nil, fmt.Errorf("failed to download data from volume: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
 // VolumeExists checks if a volume exists in the specified pool.
 func (m *Manager) VolumeExists(_ context.Context, poolName, volumeName string) (bool, error) {
 	// Look up the pool
@@ -167,14 +596,12 @@ func (m *Manager) VolumeExists(_ context.Context, poolName, volumeName string) (
 	return true, nil
 }
 
-// generateVolumeXML generates XML for a storage volume.
-func generateVolumeXML(_ string, spec VolumeSpec, _ *Manager) (string, error) {
+// generateVolumeXML generates XML for a storage volume in a pool of
+// poolType. Volumes in logical pools are block devices, managed by LVM.
+func generateVolumeXML(spec VolumeSpec, poolType PoolType) (string, error) {
 	// Convert capacity from GB to bytes
 	capacityBytes := spec.CapacityGB * 1024 * 1024 * 1024
 
-	// Get the QEMU user/group IDs for this system
-	uid, gid, _ := GetQEMUUserGroup()
-
 	vol := &libvirtxml.StorageVolume{
 		Type: "file",
 		Name: spec.Name,
@@ -186,14 +613,30 @@ func generateVolumeXML(_ string, spec VolumeSpec, _ *Manager) (string, error) {
 			Format: &libvirtxml.StorageVolumeTargetFormat{
 				Type: string(spec.Format),
 			},
-			Permissions: &libvirtxml.StorageVolumeTargetPermissions{
-				Owner: uid,
-				Group: gid,
-				Mode:  "0644",
-			},
 		},
 	}
 
+	if poolType == PoolTypeLVM {
+		vol.Type = "block"
+	} else {
+		// Get the QEMU user/group IDs for this system
+		uid, gid, _ := GetQEMUUserGroup()
+		vol.Target.Permissions = &libvirtxml.StorageVolumeTargetPermissions{
+			Owner: uid,
+			Group: gid,
+			Mode:  "0644",
+		}
+	}
+
+	// qcow2 v3 options; lazy refcounts need the v3 (compat 1.1) format
+	if spec.LazyRefcounts {
+		vol.Target.Compat = "1.1"
+		vol.Target.Features = []libvirtxml.StorageVolumeTargetFeature{{LazyRefcounts: &struct{}{}}}
+	}
+	if spec.ClusterSizeKiB != 0 {
+		vol.Target.ClusterSize = &libvirtxml.StorageVolumeTargetClusterSize{Value: spec.ClusterSizeKiB, Unit: "KiB"}
+	}
+
 	// Add backing store if specified
 	if spec.BackingVolume != "" {
 		// BackingVolume should be a filesystem path (not pool:volume reference).
@@ -201,20 +644,15 @@ func generateVolumeXML(_ string, spec VolumeSpec, _ *Manager) (string, error) {
 		// (e.g., foundry-images) than the volume being created (e.g., foundry-vms).
 		// Libvirt's XML schema requires a filesystem path in the backing store element.
 		// The caller is responsible for resolving pool:volume references to paths.
-		//
-		// Determine the backing file format from the file extension.
-		// We enforce that all image files have .qcow2 or .raw extensions, so we can
-		// reliably determine the format from the path.
-		backingFormat := "qcow2" // default
-		ext := filepath.Ext(spec.BackingVolume)
-		if ext == ".raw" || ext == ".img" {
-			backingFormat = "raw"
+		backingFormat := spec.BackingFormat
+		if backingFormat == "" {
+			backingFormat = backingFormatFromPath(spec.BackingVolume)
 		}
 
 		vol.BackingStore = &libvirtxml.StorageVolumeBackingStore{
 			Path: spec.BackingVolume,
 			Format: &libvirtxml.StorageVolumeTargetFormat{
-				Type: backingFormat,
+				Type: string(backingFormat),
 			},
 		}
 	}
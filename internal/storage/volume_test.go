@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -23,7 +26,7 @@ func TestManager_CreateVolume(t *testing.T) {
 				CapacityGB: 50,
 			},
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), "test-pool", PoolTypeDir, "/var/lib/libvirt/images/test")
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
 			},
 			wantErr: false,
 		},
@@ -38,7 +41,7 @@ func TestManager_CreateVolume(t *testing.T) {
 				BackingVolume: "fedora-43",
 			},
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), "test-pool", PoolTypeDir, "/var/lib/libvirt/images/test")
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
 				// Create backing volume first
 				_ = mgr.CreateVolume(context.Background(), "test-pool", VolumeSpec{
 					Name:       "fedora-43",
@@ -59,7 +62,7 @@ func TestManager_CreateVolume(t *testing.T) {
 				CapacityGB: 100,
 			},
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), "test-pool", PoolTypeDir, "/var/lib/libvirt/images/test")
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
 			},
 			wantErr: false,
 		},
@@ -72,7 +75,7 @@ func TestManager_CreateVolume(t *testing.T) {
 				Format: VolumeFormatRaw,
 			},
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), "test-pool", PoolTypeDir, "/var/lib/libvirt/images/test")
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
 			},
 			wantErr: false,
 		},
@@ -86,7 +89,7 @@ func TestManager_CreateVolume(t *testing.T) {
 				CapacityGB: 50,
 			},
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), "test-pool", PoolTypeDir, "/var/lib/libvirt/images/test")
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
 			},
 			wantErr: true,
 		},
@@ -118,6 +121,101 @@ func TestManager_CreateVolume(t *testing.T) {
 	}
 }
 
+func TestManager_CreateVolume_BackingFormat(t *testing.T) {
+	tests := []struct {
+		name          string
+		baseName      string
+		baseData      []byte
+		backingFormat VolumeFormat
+		want          string
+	}{
+		{
+			name:     "qcow2 magic",
+			baseName: "base.img",
+			baseData: append(append([]byte(nil), qcow2Magic...), 0, 0, 0, 3),
+			want:     `<format type="qcow2">`,
+		},
+		{
+			name:     "raw content",
+			baseName: "base.qcow2",
+			baseData: make([]byte, formatHeaderSize),
+			want:     `<format type="raw">`,
+		},
+		{
+			name:     "unreadable volume falls back to extension",
+			baseName: "base.img",
+			want:     `<format type="raw">`,
+		},
+		{
+			name:          "explicit format",
+			baseName:      "base.img",
+			baseData:      make([]byte, formatHeaderSize),
+			backingFormat: VolumeFormatQCOW2,
+			want:          `<format type="qcow2">`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := newMockLibvirtClient()
+			mgr := NewManager(mockClient)
+			ctx := context.Background()
+			_ = mgr.CreatePool(ctx, PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
+			_ = mgr.CreateVolume(ctx, "test-pool", VolumeSpec{Name: tt.baseName, Type: VolumeTypeBaseImage, Format: VolumeFormatQCOW2, CapacityGB: 5})
+			_ = mgr.WriteVolumeData(ctx, "test-pool", tt.baseName, tt.baseData)
+			basePath, _ := mgr.GetVolumePath(ctx, "test-pool", tt.baseName)
+
+			err := mgr.CreateVolume(ctx, "test-pool", VolumeSpec{
+				Name:          "vm_boot",
+				Type:          VolumeTypeBoot,
+				Format:        VolumeFormatQCOW2,
+				CapacityGB:    20,
+				BackingVolume: basePath,
+				BackingFormat: tt.backingFormat,
+			})
+			if err != nil {
+				t.Fatalf("CreateVolume() error = %v", err)
+			}
+
+			xmlDesc := mockClient.volumes["test-pool"]["vm_boot"].xmlDesc
+			_, backingStore, _ := strings.Cut(xmlDesc, "<backingStore>")
+			if !strings.Contains(backingStore, tt.want) {
+				t.Errorf("volume XML = %s, want backing store with %s", xmlDesc, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_CreateVolume_QCOW2Options(t *testing.T) {
+	mockClient := newMockLibvirtClient()
+	mgr := NewManager(mockClient)
+	ctx := context.Background()
+	_ = mgr.CreatePool(ctx, PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
+
+	err := mgr.CreateVolume(ctx, "test-pool", VolumeSpec{
+		Name:           "vm_boot",
+		Type:           VolumeTypeBoot,
+		Format:         VolumeFormatQCOW2,
+		CapacityGB:     20,
+		LazyRefcounts:  true,
+		ClusterSizeKiB: 128,
+	})
+	if err != nil {
+		t.Fatalf("CreateVolume() error = %v", err)
+	}
+
+	xmlDesc := mockClient.volumes["test-pool"]["vm_boot"].xmlDesc
+	for _, want := range []string{
+		"<compat>1.1</compat>",
+		"<lazy_refcounts></lazy_refcounts>",
+		`<clusterSize unit="KiB">128</clusterSize>`,
+	} {
+		if !strings.Contains(xmlDesc, want) {
+			t.Errorf("volume XML = %s, want it to contain %s", xmlDesc, want)
+		}
+	}
+}
+
 func TestManager_DeleteVolume(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -131,7 +229,7 @@ func TestManager_DeleteVolume(t *testing.T) {
 			poolName:   "test-pool",
 			volumeName: "test-vol",
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), "test-pool", PoolTypeDir, "/var/lib/libvirt/images/test")
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
 				_ = mgr.CreateVolume(context.Background(), "test-pool", VolumeSpec{
 					Name:       "test-vol",
 					Type:       VolumeTypeBoot,
@@ -146,7 +244,7 @@ func TestManager_DeleteVolume(t *testing.T) {
 			poolName:   "test-pool",
 			volumeName: "nonexistent",
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), "test-pool", PoolTypeDir, "/var/lib/libvirt/images/test")
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
 			},
 			wantErr: true,
 		},
@@ -178,7 +276,7 @@ func TestManager_ListVolumes(t *testing.T) {
 	mgr := NewManager(mockClient)
 
 	// Create a pool
-	_ = mgr.CreatePool(context.Background(), "test-pool", PoolTypeDir, "/var/lib/libvirt/images/test")
+	_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
 
 	// Create some volumes
 	_ = mgr.CreateVolume(context.Background(), "test-pool", VolumeSpec{
@@ -202,6 +300,38 @@ func TestManager_ListVolumes(t *testing.T) {
 	if len(volumes) != 2 {
 		t.Errorf("ListVolumes() returned %d volumes, want 2", len(volumes))
 	}
+	for _, vol := range volumes {
+		if vol.Format != VolumeFormatQCOW2 || vol.Backing != "" {
+			t.Errorf("ListVolumes() volume = %+v, want qcow2 without backing file", vol)
+		}
+	}
+}
+
+func TestManager_ListVolumes_Backing(t *testing.T) {
+	mgr := NewManager(newMockLibvirtClient())
+	ctx := context.Background()
+	_ = mgr.CreatePool(ctx, PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
+	_ = mgr.CreateVolume(ctx, "test-pool", VolumeSpec{Name: "base", Type: VolumeTypeBaseImage, Format: VolumeFormatQCOW2, CapacityGB: 5})
+	basePath, _ := mgr.GetVolumePath(ctx, "test-pool", "base")
+	_ = mgr.CreateVolume(ctx, "test-pool", VolumeSpec{Name: "vm_boot", Type: VolumeTypeBoot, Format: VolumeFormatQCOW2, CapacityGB: 20, BackingVolume: basePath})
+
+	volumes, err := mgr.ListVolumes(ctx, "test-pool")
+	if err != nil {
+		t.Fatalf("ListVolumes() error = %v", err)
+	}
+	backing := make(map[string]string)
+	for _, vol := range volumes {
+		backing[vol.Name] = vol.Backing
+	}
+	if backing["vm_boot"] != basePath || backing["base"] != "" {
+		t.Errorf("ListVolumes() backing files = %v, want vm_boot backed by %s", backing, basePath)
+	}
+
+	bootPath, _ := mgr.GetVolumePath(ctx, "test-pool", "vm_boot")
+	info, err := mgr.GetVolumeInfoByPath(ctx, bootPath)
+	if err != nil || info.Backing != basePath {
+		t.Errorf("GetVolumeInfoByPath() = %+v, %v, want backing file %s", info, err, basePath)
+	}
 }
 
 func TestManager_GetVolumePath(t *testing.T) {
@@ -217,7 +347,7 @@ func TestManager_GetVolumePath(t *testing.T) {
 			poolName:   "test-pool",
 			volumeName: "test-vol",
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), "test-pool", PoolTypeDir, "/var/lib/libvirt/images/test")
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
 				_ = mgr.CreateVolume(context.Background(), "test-pool", VolumeSpec{
 					Name:       "test-vol",
 					Type:       VolumeTypeBoot,
@@ -239,7 +369,7 @@ func TestManager_GetVolumePath(t *testing.T) {
 			poolName:   "test-pool",
 			volumeName: "nonexistent",
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), "test-pool", PoolTypeDir, "/var/lib/libvirt/images/test")
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
 			},
 			wantErr: true,
 		},
@@ -264,6 +394,70 @@ func TestManager_GetVolumePath(t *testing.T) {
 	}
 }
 
+func TestManager_ResizeVolume(t *testing.T) {
+	const gib = 1024 * 1024 * 1024
+
+	tests := []struct {
+		name         string
+		volumeName   string
+		capacityGB   uint64
+		wantErr      bool
+		wantCapacity uint64
+	}{
+		{
+			name:         "grow volume",
+			volumeName:   "test-vol",
+			capacityGB:   150,
+			wantCapacity: 150 * gib,
+		},
+		{
+			name:         "same size is a no-op",
+			volumeName:   "test-vol",
+			capacityGB:   100,
+			wantCapacity: 100 * gib,
+		},
+		{
+			name:         "shrink is refused",
+			volumeName:   "test-vol",
+			capacityGB:   50,
+			wantErr:      true,
+			wantCapacity: 100 * gib,
+		},
+		{
+			name:       "volume not found",
+			volumeName: "nonexistent",
+			capacityGB: 150,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := newMockLibvirtClient()
+			mgr := NewManager(mockClient)
+			_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
+			// The mock creates every volume with 100GB capacity
+			_ = mgr.CreateVolume(context.Background(), "test-pool", VolumeSpec{
+				Name:       "test-vol",
+				Type:       VolumeTypeData,
+				Format:     VolumeFormatQCOW2,
+				CapacityGB: 100,
+			})
+
+			err := mgr.ResizeVolume(context.Background(), "test-pool", tt.volumeName, tt.capacityGB)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResizeVolume() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantCapacity != 0 {
+				if got := mockClient.volumes["test-pool"]["test-vol"].capacity; got != tt.wantCapacity {
+					t.Errorf("capacity = %d, want %d", got, tt.wantCapacity)
+				}
+			}
+		})
+	}
+}
+
 func TestManager_WriteVolumeData(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -279,7 +473,7 @@ func TestManager_WriteVolumeData(t *testing.T) {
 			volumeName: "test-vol",
 			data:       []byte("test data"),
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), "test-pool", PoolTypeDir, "/var/lib/libvirt/images/test")
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
 				_ = mgr.CreateVolume(context.Background(), "test-pool", VolumeSpec{
 					Name:   "test-vol",
 					Type:   VolumeTypeCloudInit,
@@ -302,7 +496,7 @@ func TestManager_WriteVolumeData(t *testing.T) {
 			volumeName: "nonexistent",
 			data:       []byte("test data"),
 			setup: func(m *mockLibvirtClient, mgr *Manager) {
-				_ = mgr.CreatePool(context.Background(), "test-pool", PoolTypeDir, "/var/lib/libvirt/images/test")
+				_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
 			},
 			wantErr: true,
 		},
@@ -338,7 +532,7 @@ func TestManager_VolumeExists(t *testing.T) {
 	// Create a pool and volume
 	poolName := "test-pool"
 	volumeName := "test-vol"
-	_ = mgr.CreatePool(context.Background(), poolName, PoolTypeDir, "/var/lib/libvirt/images/test")
+	_ = mgr.CreatePool(context.Background(), PoolSpec{Name: poolName, Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
 	_ = mgr.CreateVolume(context.Background(), poolName, VolumeSpec{
 		Name:       volumeName,
 		Type:       VolumeTypeBoot,
@@ -364,3 +558,230 @@ func TestManager_VolumeExists(t *testing.T) {
 		t.Errorf("VolumeExists() = true, want false")
 	}
 }
+
+func TestManager_CloneVolume(t *testing.T) {
+	mockClient := newMockLibvirtClient()
+	mgr := NewManager(mockClient)
+	_ = mgr.CreatePool(context.Background(), PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
+	_ = mgr.CreateVolume(context.Background(), "test-pool", VolumeSpec{
+		Name:       "src-vol",
+		Type:       VolumeTypeData,
+		Format:     VolumeFormatQCOW2,
+		CapacityGB: 10,
+	})
+	_ = mgr.WriteVolumeData(context.Background(), "test-pool", "src-vol", []byte("disk contents"))
+
+	spec := VolumeSpec{Name: "dst-vol", Type: VolumeTypeData, Format: VolumeFormatQCOW2, CapacityGB: 10}
+	if err := mgr.CloneVolume(context.Background(), "test-pool", spec, "test-pool", "src-vol"); err != nil {
+		t.Fatalf("CloneVolume() error = %v", err)
+	}
+	if got := string(mockClient.volumes["test-pool"]["dst-vol"].data); got != "disk contents" {
+		t.Errorf("cloned data = %q, want %q", got, "disk contents")
+	}
+
+	// Cloning onto an existing volume fails
+	if err := mgr.CloneVolume(context.Background(), "test-pool", spec, "test-pool", "src-vol"); err == nil {
+		t.Error("expected error cloning onto an existing volume")
+	}
+
+	// Missing source
+	spec.Name = "other-vol"
+	if err := mgr.CloneVolume(context.Background(), "test-pool", spec, "test-pool", "missing"); err == nil {
+		t.Error("expected error for missing source volume")
+	}
+
+	// Backing volumes are refused
+	spec.BackingVolume = "/images/base.qcow2"
+	if err := mgr.CloneVolume(context.Background(), "test-pool", spec, "test-pool", "src-vol"); err == nil {
+		t.Error("expected error for backing volume")
+	}
+}
+
+func TestManager_CreateVolume_LogicalPool(t *testing.T) {
+	mockClient := newMockLibvirtClient()
+	mgr := NewManager(mockClient)
+	ctx := context.Background()
+	_ = mgr.CreatePool(ctx, PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
+	_ = mgr.CreatePool(ctx, PoolSpec{Name: "vg-vms", Type: PoolTypeLVM, SourceDevices: []string{"/dev/sdb"}})
+
+	// qcow2 volumes are refused
+	qcow2 := VolumeSpec{Name: "my-vm_boot", Type: VolumeTypeBoot, Format: VolumeFormatQCOW2, CapacityGB: 20}
+	if err := mgr.CreateVolume(ctx, "vg-vms", qcow2); err == nil || !strings.Contains(err.Error(), "only holds raw volumes") {
+		t.Errorf("CreateVolume(qcow2) error = %v, want raw only", err)
+	}
+
+	// Raw volumes are block devices, without file permissions
+	raw := VolumeSpec{Name: "my-vm_data-vdb", Type: VolumeTypeData, Format: VolumeFormatRaw, CapacityGB: 20}
+	if err := mgr.CreateVolume(ctx, "vg-vms", raw); err != nil {
+		t.Fatalf("CreateVolume(raw) error = %v", err)
+	}
+	xml := mockClient.volumes["vg-vms"]["my-vm_data-vdb"].xmlDesc
+	if !strings.Contains(xml, `type="block"`) || strings.Contains(xml, "<permissions>") {
+		t.Errorf("logical volume XML = %s, want a block volume without permissions", xml)
+	}
+
+	// A source volume is copied into the new volume
+	_ = mgr.CreateVolume(ctx, "test-pool", VolumeSpec{Name: "fedora-43", Type: VolumeTypeBaseImage, Format: VolumeFormatQCOW2, CapacityGB: 5})
+	_ = mgr.WriteVolumeData(ctx, "test-pool", "fedora-43", []byte("image contents"))
+	imagePath, _ := mgr.GetVolumePath(ctx, "test-pool", "fedora-43")
+	boot := VolumeSpec{Name: "my-vm_boot", Type: VolumeTypeBoot, Format: VolumeFormatRaw, CapacityGB: 20, SourceVolume: imagePath}
+	if err := mgr.CreateVolume(ctx, "vg-vms", boot); err != nil {
+		t.Fatalf("CreateVolume(source volume) error = %v", err)
+	}
+	if got := string(mockClient.volumes["vg-vms"]["my-vm_boot"].data); got != "image contents" {
+		t.Errorf("copied data = %q, want %q", got, "image contents")
+	}
+
+	boot.Name = "other_boot"
+	boot.SourceVolume = "/missing.qcow2"
+	if err := mgr.CreateVolume(ctx, "vg-vms", boot); err == nil {
+		t.Error("expected error for missing source volume")
+	}
+
+	// Clones follow the same rule
+	if err := mgr.CloneVolume(ctx, "vg-vms", qcow2, "test-pool", "fedora-43"); err == nil {
+		t.Error("expected error cloning a qcow2 volume into a logical pool")
+	}
+}
+
+func TestManager_FlattenVolume(t *testing.T) {
+	mockClient := newMockLibvirtClient()
+	mgr := NewManager(mockClient)
+	ctx := context.Background()
+	_ = mgr.CreatePool(ctx, PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
+	_ = mgr.CreateVolume(ctx, "test-pool", VolumeSpec{Name: "base", Type: VolumeTypeBaseImage, Format: VolumeFormatQCOW2, CapacityGB: 5})
+	basePath, _ := mgr.GetVolumePath(ctx, "test-pool", "base")
+	_ = mgr.CreateVolume(ctx, "test-pool", VolumeSpec{Name: "vm_boot", Type: VolumeTypeBoot, Format: VolumeFormatQCOW2, CapacityGB: 20, BackingVolume: basePath})
+	_ = mgr.WriteVolumeData(ctx, "test-pool", "vm_boot", []byte("disk contents"))
+
+	flattened, err := mgr.FlattenVolume(ctx, "test-pool", "vm_boot")
+	if err != nil || !flattened {
+		t.Fatalf("FlattenVolume() = %v, %v, want true", flattened, err)
+	}
+	vol := mockClient.volumes["test-pool"]["vm_boot"]
+	if strings.Contains(vol.xmlDesc, "backingStore") || !strings.Contains(vol.xmlDesc, `<format type="qcow2">`) {
+		t.Errorf("flattened volume XML = %s, want qcow2 without backing store", vol.xmlDesc)
+	}
+	if string(vol.data) != "disk contents" {
+		t.Errorf("flattened data = %q, want %q", vol.data, "disk contents")
+	}
+	if _, ok := mockClient.volumes["test-pool"]["vm_boot"+flattenSuffix]; ok {
+		t.Error("FlattenVolume() left its temporary volume behind")
+	}
+
+	// Volumes without a backing chain are left alone
+	for _, name := range []string{"vm_boot", "base"} {
+		if flattened, err := mgr.FlattenVolume(ctx, "test-pool", name); err != nil || flattened {
+			t.Errorf("FlattenVolume(%s) = %v, %v, want false", name, flattened, err)
+		}
+	}
+
+	if _, err := mgr.FlattenVolume(ctx, "test-pool", "missing"); err == nil {
+		t.Error("expected error for missing volume")
+	}
+}
+
+func TestManager_FlattenVolume_CopyBackFails(t *testing.T) {
+	mockClient := newMockLibvirtClient()
+	mgr := NewManager(mockClient)
+	ctx := context.Background()
+	_ = mgr.CreatePool(ctx, PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
+	_ = mgr.CreateVolume(ctx, "test-pool", VolumeSpec{Name: "base", Type: VolumeTypeBaseImage, Format: VolumeFormatQCOW2, CapacityGB: 5})
+	basePath, _ := mgr.GetVolumePath(ctx, "test-pool", "base")
+	_ = mgr.CreateVolume(ctx, "test-pool", VolumeSpec{Name: "vm_boot", Type: VolumeTypeBoot, Format: VolumeFormatQCOW2, CapacityGB: 20, BackingVolume: basePath})
+	_ = mgr.WriteVolumeData(ctx, "test-pool", "vm_boot", []byte("disk contents"))
+
+	mockClient.cloneErr = func(name string) error {
+		if name == "vm_boot" {
+			return fmt.Errorf("no space left on device")
+		}
+		return nil
+	}
+	if _, err := mgr.FlattenVolume(ctx, "test-pool", "vm_boot"); err == nil {
+		t.Fatal("FlattenVolume() succeeded, want error")
+	}
+
+	// The volume is still there, on top of the flattened copy holding its data
+	tmp, ok := mockClient.volumes["test-pool"]["vm_boot"+flattenSuffix]
+	if !ok {
+		t.Fatal("FlattenVolume() deleted the flattened copy")
+	}
+	if string(tmp.data) != "disk contents" {
+		t.Errorf("flattened data = %q, want %q", tmp.data, "disk contents")
+	}
+	vol, ok := mockClient.volumes["test-pool"]["vm_boot"]
+	if !ok {
+		t.Fatal("FlattenVolume() left the volume missing")
+	}
+	if !strings.Contains(vol.xmlDesc, "<path>"+tmp.path+"</path>") {
+		t.Errorf("recreated volume XML = %s, want backing store %s", vol.xmlDesc, tmp.path)
+	}
+}
+
+func TestManager_ExportVolume(t *testing.T) {
+	mockClient := newMockLibvirtClient()
+	mgr := NewManager(mockClient)
+	ctx := context.Background()
+	_ = mgr.CreatePool(ctx, PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
+	_ = mgr.CreateVolume(ctx, "test-pool", VolumeSpec{Name: "base", Type: VolumeTypeBaseImage, Format: VolumeFormatQCOW2, CapacityGB: 5})
+	basePath, _ := mgr.GetVolumePath(ctx, "test-pool", "base")
+	_ = mgr.CreateVolume(ctx, "test-pool", VolumeSpec{Name: "vm_boot", Type: VolumeTypeBoot, Format: VolumeFormatQCOW2, CapacityGB: 20, BackingVolume: basePath})
+	_ = mgr.WriteVolumeData(ctx, "test-pool", "vm_boot", []byte("disk contents"))
+
+	var buf bytes.Buffer
+	if err := mgr.ExportVolume(ctx, "test-pool", "vm_boot", &buf); err != nil {
+		t.Fatalf("ExportVolume() error = %v", err)
+	}
+	if buf.String() != "disk contents" {
+		t.Errorf("exported data = %q, want %q", buf.String(), "disk contents")
+	}
+	if _, ok := mockClient.volumes["test-pool"]["vm_boot"+exportSuffix]; ok {
+		t.Error("ExportVolume() left its temporary volume behind")
+	}
+	if vol := mockClient.volumes["test-pool"]["vm_boot"]; !strings.Contains(vol.xmlDesc, "backingStore") {
+		t.Error("ExportVolume() changed the exported volume")
+	}
+
+	if err := mgr.ExportVolume(ctx, "test-pool", "missing", &buf); err == nil {
+		t.Error("expected error for missing volume")
+	}
+}
+
+func TestManager_UploadVolume(t *testing.T) {
+	mgr := NewManager(newMockLibvirtClient())
+	ctx := context.Background()
+	_ = mgr.CreatePool(ctx, PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
+	_ = mgr.CreateVolume(ctx, "test-pool", VolumeSpec{Name: "vm_boot", Type: VolumeTypeBoot, Format: VolumeFormatQCOW2, CapacityGB: 20})
+
+	if err := mgr.UploadVolume(ctx, "test-pool", "vm_boot", strings.NewReader("disk contents"), 13); err != nil {
+		t.Fatalf("UploadVolume() error = %v", err)
+	}
+	data, err := mgr.ReadVolumeData(ctx, "test-pool", "vm_boot")
+	if err != nil || string(data) != "disk contents" {
+		t.Errorf("volume data = %q, %v", data, err)
+	}
+
+	if err := mgr.UploadVolume(ctx, "test-pool", "missing", strings.NewReader(""), 0); err == nil {
+		t.Error("expected error for missing volume")
+	}
+}
+
+func TestManager_GetVolumeInfoByPath(t *testing.T) {
+	mgr := NewManager(newMockLibvirtClient())
+	ctx := context.Background()
+	_ = mgr.CreatePool(ctx, PoolSpec{Name: "test-pool", Type: PoolTypeDir, Path: "/var/lib/libvirt/images/test"})
+	_ = mgr.CreateVolume(ctx, "test-pool", VolumeSpec{Name: "legacy.img", Type: VolumeTypeData, Format: VolumeFormatRaw, CapacityGB: 20})
+	path, _ := mgr.GetVolumePath(ctx, "test-pool", "legacy.img")
+
+	info, err := mgr.GetVolumeInfoByPath(ctx, path)
+	if err != nil {
+		t.Fatalf("GetVolumeInfoByPath() error = %v", err)
+	}
+	if info.Pool != "test-pool" || info.Name != "legacy.img" || info.Format != VolumeFormatRaw || info.Capacity == 0 {
+		t.Errorf("GetVolumeInfoByPath() = %+v", info)
+	}
+
+	if _, err := mgr.GetVolumeInfoByPath(ctx, "/srv/vms/outside.img"); err == nil {
+		t.Error("expected error for a file outside every pool")
+	}
+}
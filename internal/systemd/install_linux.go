@@ -0,0 +1,21 @@
+//go:build linux
+
+package systemd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// InstallUnit writes unit content to path, creating parent directories as
+// needed. The caller is responsible for running "systemctl daemon-reload".
+func InstallUnit(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create unit directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write unit file %s: %w", path, err)
+	}
+	return nil
+}
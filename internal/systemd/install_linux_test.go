@@ -0,0 +1,25 @@
+//go:build linux
+
+package systemd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstallUnit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "system", "foundry.service")
+
+	if err := InstallUnit(path, "[Unit]\n"); err != nil {
+		t.Fatalf("InstallUnit() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read unit: %v", err)
+	}
+	if string(data) != "[Unit]\n" {
+		t.Errorf("unit content = %q", data)
+	}
+}
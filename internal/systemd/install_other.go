@@ -0,0 +1,13 @@
+//go:build !linux
+
+package systemd
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// InstallUnit fails: systemd units can only be installed on a Linux host.
+func InstallUnit(path, content string) error {
+	return fmt.Errorf("cannot install %s on %s: systemd units are installed on the Linux hypervisor (print the unit with --unit-path - instead)", path, runtime.GOOS)
+}
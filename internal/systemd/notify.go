@@ -0,0 +1,74 @@
+// Package systemd provides integration with systemd for daemon mode:
+// sd_notify readiness and watchdog notifications, and unit file generation.
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notification states understood by systemd (see sd_notify(3)).
+const (
+	StateReady     = "READY=1"
+	StateStopping  = "STOPPING=1"
+	StateReloading = "RELOADING=1"
+	StateWatchdog  = "WATCHDOG=1"
+)
+
+// Notify sends a state notification to the service manager via $NOTIFY_SOCKET.
+//
+// Returns false (and no error) if foundry is not running under systemd with
+// Type=notify, so callers can notify unconditionally.
+func Notify(state string) (bool, error) {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return false, nil
+	}
+
+	// A leading "@" denotes an abstract socket
+	if socketPath[0] == '@' {
+		socketPath = "\x00" + socketPath[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to notify socket: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return true, nil
+}
+
+// WatchdogInterval returns how often the service must send StateWatchdog to
+// avoid being restarted, based on $WATCHDOG_USEC and $WATCHDOG_PID.
+//
+// The returned interval is half the configured timeout, as recommended by
+// sd_watchdog_enabled(3). Returns false if the watchdog is not enabled for
+// this process.
+func WatchdogInterval() (time.Duration, bool) {
+	usecStr := os.Getenv("WATCHDOG_USEC")
+	if usecStr == "" {
+		return 0, false
+	}
+
+	usec, err := strconv.ParseInt(usecStr, 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+
+	if pidStr := os.Getenv("WATCHDOG_PID"); pidStr != "" {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil || pid != os.Getpid() {
+			return 0, false
+		}
+	}
+
+	return time.Duration(usec) * time.Microsecond / 2, true
+}
@@ -0,0 +1,89 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNotify_NoSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+
+	sent, err := Notify(StateReady)
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if sent {
+		t.Error("Notify() should not send without NOTIFY_SOCKET")
+	}
+}
+
+func TestNotify_SendsState(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("failed to listen on notify socket: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	t.Setenv("NOTIFY_SOCKET", socketPath)
+
+	sent, err := Notify(StateReady)
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if !sent {
+		t.Fatal("Notify() = false, want true")
+	}
+
+	buf := make([]byte, 64)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("failed to read notification: %v", err)
+	}
+	if got := string(buf[:n]); got != StateReady {
+		t.Errorf("received %q, want %q", got, StateReady)
+	}
+}
+
+func TestNotify_MissingSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+
+	if _, err := Notify(StateReady); err == nil {
+		t.Error("Notify() should fail when the socket does not exist")
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+
+	tests := []struct {
+		name    string
+		usec    string
+		pid     string
+		want    time.Duration
+		enabled bool
+	}{
+		{name: "disabled", usec: "", enabled: false},
+		{name: "enabled", usec: "30000000", want: 15 * time.Second, enabled: true},
+		{name: "enabled for this pid", usec: "10000000", pid: pid, want: 5 * time.Second, enabled: true},
+		{name: "other pid", usec: "10000000", pid: "1", enabled: false},
+		{name: "invalid", usec: "soon", enabled: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+
+			got, enabled := WatchdogInterval()
+			if enabled != tt.enabled || got != tt.want {
+				t.Errorf("WatchdogInterval() = (%v, %v), want (%v, %v)", got, enabled, tt.want, tt.enabled)
+			}
+		})
+	}
+}
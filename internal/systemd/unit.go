@@ -0,0 +1,187 @@
+package systemd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultUnitPath is where the foundry service unit is installed.
+const DefaultUnitPath = "/etc/systemd/system/foundry.service"
+
+// DefaultShutdownUnitPath is where the foundry shutdown hook unit is installed.
+const DefaultShutdownUnitPath = "/etc/systemd/system/foundry-shutdown.service"
+
+// DefaultAutostartUnitPath is where the foundry ordered autostart unit is
+// installed.
+const DefaultAutostartUnitPath = "/etc/systemd/system/foundry-autostart.service"
+
+// shutdownStopMargin is added to the VM shutdown timeout for TimeoutStopSec,
+// leaving time to force off stragglers before systemd kills the hook.
+const shutdownStopMargin = 30 * time.Second
+
+// UnitOptions configures the generated systemd service unit.
+type UnitOptions struct {
+	// ExecPath is the absolute path to the foundry binary.
+	ExecPath string
+
+	// Args are the arguments passed to foundry (e.g., "serve", "--listen", ...).
+	Args []string
+
+	// Description is the unit description. Defaults to "Foundry VM management API".
+	Description string
+
+	// WatchdogSec enables the systemd watchdog with the given timeout.
+	// Zero disables it.
+	WatchdogSec time.Duration
+}
+
+// GenerateUnit renders a Type=notify service unit for running foundry as a
+// daemon on the hypervisor.
+//
+// The unit is ordered after libvirt (both the monolithic libvirtd and the
+// modular virtqemud daemons) and restarts foundry on failure.
+func GenerateUnit(opts UnitOptions) (string, error) {
+	if !filepath.IsAbs(opts.ExecPath) {
+		return "", fmt.Errorf("exec path must be absolute (got: %q)", opts.ExecPath)
+	}
+
+	description := opts.Description
+	if description == "" {
+		description = "Foundry VM management API"
+	}
+
+	execStart := make([]string, 0, len(opts.Args)+1)
+	execStart = append(execStart, quoteArg(opts.ExecPath))
+	for _, arg := range opts.Args {
+		execStart = append(execStart, quoteArg(arg))
+	}
+
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=%s\n", description)
+	b.WriteString("Documentation=https://github.com/jbweber/foundry\n")
+	b.WriteString("Wants=network-online.target\n")
+	b.WriteString("After=network-online.target libvirtd.service virtqemud.service\n")
+	b.WriteString("\n")
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=notify\n")
+	b.WriteString("NotifyAccess=main\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(execStart, " "))
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("RestartSec=5s\n")
+	if opts.WatchdogSec > 0 {
+		fmt.Fprintf(&b, "WatchdogSec=%ds\n", int(opts.WatchdogSec.Seconds()))
+	}
+	b.WriteString("\n")
+	b.WriteString("[Install]\n")
+	b.WriteString("WantedBy=multi-user.target\n")
+
+	return b.String(), nil
+}
+
+// ShutdownUnitOptions configures the generated shutdown hook unit.
+type ShutdownUnitOptions struct {
+	// ExecPath is the absolute path to the foundry binary.
+	ExecPath string
+
+	// Args are the arguments passed to foundry when the host shuts down
+	// (e.g., "shutdown-all", "--timeout", "120s").
+	Args []string
+
+	// Timeout is the longest any VM is given to shut down. systemd is told
+	// to wait a little longer than this for the hook to finish.
+	Timeout time.Duration
+}
+
+// GenerateShutdownUnit renders a oneshot unit that runs foundry when it is
+// stopped, i.e. when the host shuts down or reboots.
+//
+// The unit is ordered after libvirt, so systemd stops it, shutting down the
+// VMs, before libvirt is stopped. It is ordered before the foundry daemon, so
+// the daemon is stopped first and cannot restart autostart VMs behind it.
+func GenerateShutdownUnit(opts ShutdownUnitOptions) (string, error) {
+	if !filepath.IsAbs(opts.ExecPath) {
+		return "", fmt.Errorf("exec path must be absolute (got: %q)", opts.ExecPath)
+	}
+
+	execStop := make([]string, 0, len(opts.Args)+1)
+	execStop = append(execStop, quoteArg(opts.ExecPath))
+	for _, arg := range opts.Args {
+		execStop = append(execStop, quoteArg(arg))
+	}
+
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=Shut down foundry VMs gracefully\n")
+	b.WriteString("Documentation=https://github.com/jbweber/foundry\n")
+	b.WriteString("Wants=network-online.target\n")
+	b.WriteString("After=network-online.target libvirtd.service virtqemud.service\n")
+	b.WriteString("Before=foundry.service\n")
+	b.WriteString("\n")
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=oneshot\n")
+	b.WriteString("RemainAfterExit=yes\n")
+	b.WriteString("ExecStart=/bin/true\n")
+	fmt.Fprintf(&b, "ExecStop=%s\n", strings.Join(execStop, " "))
+	fmt.Fprintf(&b, "TimeoutStopSec=%ds\n", int((opts.Timeout + shutdownStopMargin).Seconds()))
+	b.WriteString("\n")
+	b.WriteString("[Install]\n")
+	b.WriteString("WantedBy=multi-user.target\n")
+
+	return b.String(), nil
+}
+
+// AutostartUnitOptions configures the generated ordered autostart unit.
+type AutostartUnitOptions struct {
+	// ExecPath is the absolute path to the foundry binary.
+	ExecPath string
+
+	// Args are the arguments passed to foundry when the host boots
+	// (e.g., "autostart").
+	Args []string
+}
+
+// GenerateAutostartUnit renders a unit that runs foundry once when the host
+// boots, after libvirt is started.
+//
+// The unit is Type=simple so that startup delays do not hold up the rest of
+// the boot.
+func GenerateAutostartUnit(opts AutostartUnitOptions) (string, error) {
+	if !filepath.IsAbs(opts.ExecPath) {
+		return "", fmt.Errorf("exec path must be absolute (got: %q)", opts.ExecPath)
+	}
+
+	execStart := make([]string, 0, len(opts.Args)+1)
+	execStart = append(execStart, quoteArg(opts.ExecPath))
+	for _, arg := range opts.Args {
+		execStart = append(execStart, quoteArg(arg))
+	}
+
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=Start foundry VMs in startup order\n")
+	b.WriteString("Documentation=https://github.com/jbweber/foundry\n")
+	b.WriteString("Wants=network-online.target\n")
+	b.WriteString("After=network-online.target libvirtd.service virtqemud.service libvirt-guests.service\n")
+	b.WriteString("\n")
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=simple\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(execStart, " "))
+	b.WriteString("\n")
+	b.WriteString("[Install]\n")
+	b.WriteString("WantedBy=multi-user.target\n")
+
+	return b.String(), nil
+}
+
+// quoteArg quotes a command line argument for ExecStart if it contains
+// characters systemd would otherwise interpret.
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\$%;") {
+		return arg
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`, `%`, `%%`)
+	return `"` + r.Replace(arg) + `"`
+}
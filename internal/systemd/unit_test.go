@@ -0,0 +1,121 @@
+package systemd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateUnit(t *testing.T) {
+	unit, err := GenerateUnit(UnitOptions{
+		ExecPath:    "/usr/local/bin/foundry",
+		Args:        []string{"serve", "--listen", "127.0.0.1:8080", "--connect", "qemu+ssh://root@hv1/system"},
+		WatchdogSec: 30 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("GenerateUnit() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"Description=Foundry VM management API\n",
+		"After=network-online.target libvirtd.service virtqemud.service\n",
+		"Type=notify\n",
+		"ExecStart=/usr/local/bin/foundry serve --listen 127.0.0.1:8080 --connect qemu+ssh://root@hv1/system\n",
+		"WatchdogSec=30s\n",
+		"WantedBy=multi-user.target\n",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("unit missing %q:\n%s", want, unit)
+		}
+	}
+}
+
+func TestGenerateUnit_NoWatchdog(t *testing.T) {
+	unit, err := GenerateUnit(UnitOptions{ExecPath: "/usr/bin/foundry", Args: []string{"serve"}})
+	if err != nil {
+		t.Fatalf("GenerateUnit() error = %v", err)
+	}
+	if strings.Contains(unit, "WatchdogSec") {
+		t.Errorf("unit should not enable the watchdog:\n%s", unit)
+	}
+}
+
+func TestGenerateUnit_RelativeExecPath(t *testing.T) {
+	if _, err := GenerateUnit(UnitOptions{ExecPath: "foundry"}); err == nil {
+		t.Error("GenerateUnit() should reject a relative exec path")
+	}
+}
+
+func TestGenerateShutdownUnit(t *testing.T) {
+	unit, err := GenerateShutdownUnit(ShutdownUnitOptions{
+		ExecPath: "/usr/local/bin/foundry",
+		Args:     []string{"shutdown-all", "--timeout", "2m0s"},
+		Timeout:  2 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("GenerateShutdownUnit() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"After=network-online.target libvirtd.service virtqemud.service\n",
+		"Before=foundry.service\n",
+		"Type=oneshot\n",
+		"RemainAfterExit=yes\n",
+		"ExecStop=/usr/local/bin/foundry shutdown-all --timeout 2m0s\n",
+		"TimeoutStopSec=150s\n",
+		"WantedBy=multi-user.target\n",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("unit missing %q:\n%s", want, unit)
+		}
+	}
+
+	if _, err := GenerateShutdownUnit(ShutdownUnitOptions{ExecPath: "foundry"}); err == nil {
+		t.Error("GenerateShutdownUnit() should reject a relative exec path")
+	}
+}
+
+func TestGenerateAutostartUnit(t *testing.T) {
+	unit, err := GenerateAutostartUnit(AutostartUnitOptions{
+		ExecPath: "/usr/local/bin/foundry",
+		Args:     []string{"autostart", "--connect", "qemu:///system"},
+	})
+	if err != nil {
+		t.Fatalf("GenerateAutostartUnit() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"After=network-online.target libvirtd.service virtqemud.service libvirt-guests.service\n",
+		"Type=simple\n",
+		"ExecStart=/usr/local/bin/foundry autostart --connect qemu:///system\n",
+		"WantedBy=multi-user.target\n",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("unit missing %q:\n%s", want, unit)
+		}
+	}
+
+	if _, err := GenerateAutostartUnit(AutostartUnitOptions{ExecPath: "foundry"}); err == nil {
+		t.Error("GenerateAutostartUnit() should reject a relative exec path")
+	}
+}
+
+func TestQuoteArg(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{"serve", "serve"},
+		{"", `""`},
+		{"/opt/my tools/foundry", `"/opt/my tools/foundry"`},
+		{"100%", `"100%%"`},
+		{"$HOME", `"$$HOME"`},
+		{`say "hi"`, `"say \"hi\""`},
+	}
+
+	for _, tt := range tests {
+		if got := quoteArg(tt.arg); got != tt.want {
+			t.Errorf("quoteArg(%q) = %s, want %s", tt.arg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Package timing records how long the steps of a command take, so that
+// 'foundry --debug-timings' can show where the time of a slow create or
+// destroy goes.
+//
+// Recording is off until Enable is called, and then collects steps for the
+// whole process, the same way the standard logger is shared by all packages:
+//
+//	defer timing.Start("define domain")()
+package timing
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Step is a timed step of a command.
+type Step struct {
+	Name     string
+	Duration time.Duration
+}
+
+var (
+	mu      sync.Mutex
+	enabled bool
+	started time.Time
+	steps   []Step
+
+	// now is replaced in tests
+	now = time.Now
+)
+
+// Enable starts recording steps and discards any recorded before.
+func Enable() {
+	mu.Lock()
+	defer mu.Unlock()
+	enabled = true
+	started = now()
+	steps = nil
+}
+
+// Start starts timing a step and returns the function that ends it. Steps
+// are recorded in the order they end. Without Enable nothing is recorded.
+func Start(name string) func() {
+	mu.Lock()
+	on := enabled
+	mu.Unlock()
+	if !on {
+		return func() {}
+	}
+
+	begin := now()
+	return func() {
+		elapsed := now().Sub(begin)
+		mu.Lock()
+		defer mu.Unlock()
+		steps = append(steps, Step{Name: name, Duration: elapsed})
+	}
+}
+
+// Steps returns the recorded steps.
+func Steps() []Step {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]Step(nil), steps...)
+}
+
+// Print writes the recorded steps and the time since Enable to w. Nothing is
+// written unless recording is enabled.
+func Print(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	if !enabled {
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "STEP\tDURATION")
+	for _, step := range steps {
+		_, _ = fmt.Fprintf(tw, "%s\t%v\n", step.Name, round(step.Duration))
+	}
+	_, _ = fmt.Fprintf(tw, "total\t%v\n", round(now().Sub(started)))
+	_ = tw.Flush()
+}
+
+// round shortens a duration for display.
+func round(d time.Duration) time.Duration {
+	if d >= time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,76 @@
+package timing
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock returns a clock advancing by step on every reading.
+func fakeClock(step time.Duration) func() time.Time {
+	t := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		t = t.Add(step)
+		return t
+	}
+}
+
+func reset(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		enabled = false
+		steps = nil
+		now = time.Now
+	})
+}
+
+func TestStart_Disabled(t *testing.T) {
+	reset(t)
+
+	Start("connect")()
+	if got := Steps(); len(got) != 0 {
+		t.Errorf("Steps() = %v, want none while disabled", got)
+	}
+
+	var buf bytes.Buffer
+	Print(&buf)
+	if buf.Len() != 0 {
+		t.Errorf("Print() wrote %q while disabled", buf.String())
+	}
+}
+
+func TestStart_Enabled(t *testing.T) {
+	reset(t)
+	now = fakeClock(250 * time.Millisecond)
+
+	Enable()
+	end := Start("define domain")
+	Start("start domain")()
+	end()
+
+	want := []Step{
+		{Name: "start domain", Duration: 250 * time.Millisecond},
+		{Name: "define domain", Duration: 750 * time.Millisecond},
+	}
+	got := Steps()
+	if len(got) != len(want) {
+		t.Fatalf("Steps() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Steps()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	var buf bytes.Buffer
+	Print(&buf)
+	out := buf.String()
+	for _, line := range []string{"STEP", "start domain   250ms", "define domain  750ms", "total          1.25s"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("Print() output missing %q:\n%s", line, out)
+		}
+	}
+}
@@ -0,0 +1,487 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/digitalocean/go-libvirt"
+	"go.yaml.in/yaml/v3"
+	libvirtxml "libvirt.org/go/libvirtxml"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/loader"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/naming"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// AdoptOptions configures Adopt.
+type AdoptOptions struct {
+	// StoragePool is the pool the VM's disks are copied into. Defaults to
+	// foundry-vms.
+	StoragePool string
+
+	// DeleteSources deletes the original volumes once they have been copied
+	// and the domain uses the copies.
+	DeleteSources bool
+}
+
+// AdoptResult describes an adopted VM.
+type AdoptResult struct {
+	// VM is the spec stored for the VM.
+	VM *v1alpha1.VirtualMachine
+
+	// Disks are the VM's disks and the volumes they now use.
+	Disks []AdoptedDisk
+
+	// Warnings are parts of the domain the spec does not describe. They are
+	// kept in the domain, but foundry does not manage them.
+	Warnings []string
+}
+
+// AdoptedDisk is a disk of an adopted VM.
+type AdoptedDisk struct {
+	Device string // Device in the spec (vda is the boot disk)
+	Source string // Path of the volume the domain used
+	Volume string // Volume the domain uses now, in the spec's storage pool
+	Copied bool   // Whether Source was copied into Volume
+}
+
+// adoptedDisk is a disk of a domain being adopted.
+type adoptedDisk struct {
+	index  int    // Index in the domain's disks
+	device string // Device in the spec
+	pool   string // Pool and volume the domain uses
+	volume string
+	path   string
+	tuning v1alpha1.DiskTuningSpec // Bus and driver options
+}
+
+// Adopt brings an existing libvirt domain that was not created by foundry
+// under foundry's management.
+//
+// A spec is reverse-engineered from the domain's XML on a best-effort basis:
+// vCPUs, memory, firmware, machine type, CPU mode, the virtio, scsi and sata disks and the
+// bridge and network interfaces, which are configured by DHCP and keep their
+// MAC addresses. The disks are copied into volumes named the foundry way
+// (<vm>_boot.<format>, <vm>_data-<device>.<format>) in the VM's storage pool,
+// and the domain is redefined to use them; the rest of the domain XML is
+// kept as it is. Finally the spec is stored in the domain's metadata, so
+// other foundry commands can manage the VM.
+//
+// The domain must be shut off. Its disks must be volumes of a storage pool
+// (add their directory with 'foundry pool add' otherwise).
+func Adopt(ctx context.Context, domainName string, opts AdoptOptions) (*AdoptResult, error) {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	if err := storageMgr.EnsureDefaultPools(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ensure storage pools: %w", err)
+	}
+
+	return adoptWithDeps(ctx, domainName, opts, LibvirtClient.Libvirt(), storageMgr, metaClient)
+}
+
+// adoptWithDeps adopts a domain with injected dependencies.
+// This allows for testing by accepting interfaces instead of concrete types.
+func adoptWithDeps(ctx context.Context, domainName string, opts AdoptOptions, lv LibvirtClient, sm storageManager, mc *metadata.Client) (*AdoptResult, error) {
+	logger := logging.FromContext(ctx)
+
+	// Step 1: Look up the domain, which must not be managed yet
+	domain, err := lv.DomainLookupByName(domainName)
+	if err != nil {
+		return nil, fmt.Errorf("domain '%s' not found: %w", domainName, err)
+	}
+	if stored, err := mc.Load(domain); err == nil && stored.Spec.VCPUs != 0 {
+		return nil, fmt.Errorf("domain '%s' is already managed by foundry", domainName)
+	}
+
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain state: %w", err)
+	}
+	if state != domainStateShutoff && state != domainStateCrashed {
+		return nil, fmt.Errorf("domain '%s' must be shut off to be adopted", domainName)
+	}
+
+	domainXML, err := lv.DomainGetXMLDesc(domain, libvirt.DomainXMLInactive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain XML: %w", err)
+	}
+	var domDef libvirtxml.Domain
+	if err := domDef.Unmarshal(domainXML); err != nil {
+		return nil, fmt.Errorf("failed to parse domain XML: %w", err)
+	}
+	autostart, err := lv.DomainGetAutostart(domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get autostart: %w", err)
+	}
+
+	// Step 2: Reverse-engineer the spec
+	vm, disks, warnings, err := adoptedSpec(&domDef, autostart == 1)
+	if err != nil {
+		return nil, err
+	}
+	if opts.StoragePool != "" {
+		vm.Spec.StoragePool = opts.StoragePool
+	}
+
+	// Step 3: Size the disks from their volumes
+	for i := range disks {
+		disk := &disks[i]
+		if disk.path == "" {
+			if disk.path, err = sm.GetVolumePath(ctx, disk.pool, disk.volume); err != nil {
+				return nil, fmt.Errorf("disk %s: %w", disk.device, err)
+			}
+		}
+		info, err := sm.GetVolumeInfoByPath(ctx, disk.path)
+		if err != nil {
+			return nil, fmt.Errorf("disk %s is not a storage pool volume (add its directory with 'foundry pool add'): %w", disk.device, err)
+		}
+		disk.pool, disk.volume = info.Pool, info.Name
+
+		sizeGB := int((info.Capacity + gib - 1) / gib)
+		if i == 0 {
+			vm.Spec.BootDisk.SizeGB = sizeGB
+		} else {
+			vm.Spec.DataDisks[i-1].SizeGB = sizeGB
+		}
+	}
+
+	// Validate the result like a config file
+	data, err := yaml.Marshal(vm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal adopted spec: %w", err)
+	}
+	if vm, err = loader.LoadFromYAML(ctx, data); err != nil {
+		return nil, fmt.Errorf("invalid adopted spec: %w", err)
+	}
+
+	// Step 4: Copy the disks into volumes named the foundry way
+	result := &AdoptResult{VM: vm, Warnings: warnings}
+	var copied []string
+	cleanup := func() {
+		for _, volume := range copied {
+			if err := sm.DeleteVolume(ctx, getStoragePool(vm), volume); err != nil {
+				logger.Warn("Failed to delete volume", "volume", volume, "error", err)
+			}
+		}
+	}
+	for i, disk := range disks {
+		spec := storage.VolumeSpec{
+			Name:       getBootVolumeName(vm),
+			Type:       storage.VolumeTypeBoot,
+			Format:     getDiskFormat(vm),
+			CapacityGB: uint64(vm.Spec.BootDisk.SizeGB),
+		}
+		if i > 0 {
+			spec = dataVolumeSpec(vm, vm.Spec.DataDisks[i-1])
+		}
+		adopted := AdoptedDisk{Device: disk.device, Source: disk.path, Volume: spec.Name}
+
+		if disk.pool != getStoragePool(vm) || disk.volume != spec.Name {
+			logger.Info("Copying disk", "device", disk.device, "path", disk.path, "pool", getStoragePool(vm), "volume", spec.Name)
+			if err := sm.CloneVolume(ctx, getStoragePool(vm), spec, disk.pool, disk.volume); err != nil {
+				cleanup()
+				return nil, fmt.Errorf("failed to copy disk %s: %w", disk.device, err)
+			}
+			copied = append(copied, spec.Name)
+			adopted.Copied = true
+		}
+
+		// Point the domain's disk at the volume
+		domDisk := &domDef.Devices.Disks[disk.index]
+		domDisk.Source = &libvirtxml.DomainDiskSource{
+			Volume: &libvirtxml.DomainDiskSourceVolume{Pool: getStoragePool(vm), Volume: spec.Name},
+		}
+		domDisk.BackingStore = nil
+		if domDisk.Driver == nil {
+			domDisk.Driver = &libvirtxml.DomainDiskDriver{Name: "qemu"}
+		}
+		domDisk.Driver.Type = string(spec.Format)
+		domDisk.Target.Dev = disk.device
+
+		result.Disks = append(result.Disks, adopted)
+	}
+
+	// Step 5: Redefine the domain and store the spec
+	newXML, err := domDef.Marshal()
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to generate domain XML: %w", err)
+	}
+	logger.Info("Redefining domain", "domain", domainName)
+	domain, err = lv.DomainDefineXML(newXML)
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to redefine domain: %w", err)
+	}
+
+	vm.UpdateObservedGeneration()
+	if err := mc.Store(domain, vm); err != nil {
+		return nil, fmt.Errorf("domain redefined but failed to store VM metadata: %w", err)
+	}
+
+	// Step 6: Delete the originals of copied disks
+	if opts.DeleteSources {
+		for i, disk := range disks {
+			if !result.Disks[i].Copied {
+				continue
+			}
+			if err := sm.DeleteVolume(ctx, disk.pool, disk.volume); err != nil {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("failed to delete original volume %s/%s: %v", disk.pool, disk.volume, err))
+			}
+		}
+	}
+
+	logger.Info("Domain adopted", "domain", domainName)
+	return result, nil
+}
+
+// gib is the size of a GiB in bytes.
+const gib = 1024 * 1024 * 1024
+
+// adoptedSpec reverse-engineers the spec of a VM from its domain, and
+// returns it with the disks it describes (the boot disk first) and warnings
+// about the parts of the domain it leaves out. Disk sizes are left to the
+// caller, which looks up the disks' volumes.
+func adoptedSpec(domDef *libvirtxml.Domain, autostart bool) (*v1alpha1.VirtualMachine, []adoptedDisk, []string, error) {
+	vm := v1alpha1.NewVirtualMachine(domDef.Name)
+	vm.Spec.BootDisk.Empty = true
+	vm.Spec.Autostart = &autostart
+	var warnings []string
+
+	// CPU and memory
+	if domDef.VCPU == nil || domDef.VCPU.Value == 0 {
+		return nil, nil, nil, fmt.Errorf("domain has no vCPUs")
+	}
+	vm.Spec.VCPUs = int(domDef.VCPU.Value)
+	if domDef.VCPU.Current != 0 && domDef.VCPU.Current < domDef.VCPU.Value {
+		vm.Spec.VCPUs = int(domDef.VCPU.Current)
+		vm.Spec.MaxVCPUs = int(domDef.VCPU.Value)
+	}
+
+	if domDef.Memory == nil {
+		return nil, nil, nil, fmt.Errorf("domain has no memory")
+	}
+	maxMiB, err := memoryMiB(domDef.Memory.Value, domDef.Memory.Unit)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	currentMiB := maxMiB
+	if domDef.CurrentMemory != nil {
+		if currentMiB, err = memoryMiB(domDef.CurrentMemory.Value, domDef.CurrentMemory.Unit); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if currentMiB%1024 == 0 {
+		vm.Spec.MemoryGiB = int(currentMiB / 1024)
+	} else {
+		vm.Spec.MemoryMiB = int(currentMiB)
+	}
+	if maxMiB > currentMiB && maxMiB%1024 == 0 {
+		vm.Spec.MaxMemoryGiB = int(maxMiB / 1024)
+	}
+
+	if domDef.CPU != nil {
+		switch domDef.CPU.Mode {
+		case "host-model", "host-passthrough":
+			vm.Spec.CPUMode = domDef.CPU.Mode
+		default:
+			warnings = append(warnings, fmt.Sprintf("CPU mode %q is not described by the spec", domDef.CPU.Mode))
+		}
+	}
+
+	// Firmware and chipset
+	vm.Spec.Firmware = "bios"
+	if domDef.OS != nil {
+		if domDef.OS.Firmware == "efi" || (domDef.OS.Loader != nil && domDef.OS.Loader.Type == "pflash") {
+			vm.Spec.Firmware = "efi"
+		}
+		if domDef.OS.Type != nil {
+			switch machine := domDef.OS.Type.Machine; {
+			case strings.Contains(machine, "q35"):
+				vm.Spec.MachineType = "q35"
+			case machine == "pc" || strings.HasPrefix(machine, "pc-i440fx"):
+				vm.Spec.MachineType = "pc"
+			}
+		}
+	}
+
+	if domDef.Devices == nil {
+		return nil, nil, nil, fmt.Errorf("domain has no devices")
+	}
+
+	// Disks, in order
+	var disks []adoptedDisk
+	discard := false
+	boot := 0
+	for i, disk := range domDef.Devices.Disks {
+		if disk.Device != "" && disk.Device != "disk" {
+			warnings = append(warnings, fmt.Sprintf("%s %s is not adopted", disk.Device, diskTarget(disk)))
+			continue
+		}
+		if disk.Target == nil || !slices.Contains([]string{"virtio", "scsi", "sata"}, disk.Target.Bus) {
+			return nil, nil, nil, fmt.Errorf("disk %s is not a virtio, scsi or sata disk; foundry only manages those", diskTarget(disk))
+		}
+
+		adopted := adoptedDisk{index: i, tuning: adoptedTuning(disk)}
+		switch {
+		case disk.Source != nil && disk.Source.File != nil:
+			adopted.path = disk.Source.File.File
+		case disk.Source != nil && disk.Source.Block != nil:
+			adopted.path = disk.Source.Block.Dev
+		case disk.Source != nil && disk.Source.Volume != nil:
+			adopted.pool, adopted.volume = disk.Source.Volume.Pool, disk.Source.Volume.Volume
+		default:
+			return nil, nil, nil, fmt.Errorf("disk %s is not backed by a file, block device or volume", diskTarget(disk))
+		}
+
+		// The boot disk is the one with the lowest boot order, or the first
+		if disk.Boot != nil && len(disks) > 0 {
+			current := domDef.Devices.Disks[disks[boot].index].Boot
+			if current == nil || disk.Boot.Order < current.Order {
+				boot = len(disks)
+			}
+		}
+		if disk.Driver != nil && disk.Driver.Discard == "unmap" {
+			discard = true
+		}
+		disks = append(disks, adopted)
+	}
+	if len(disks) == 0 {
+		return nil, nil, nil, fmt.Errorf("domain has no disk to boot from")
+	}
+	vm.Spec.Discard = &discard
+	disks = append(append([]adoptedDisk{disks[boot]}, disks[:boot]...), disks[boot+1:]...)
+
+	// virtio device names only order the disks: name them vda (boot), vdb, ...
+	for i := range disks {
+		disks[i].device = "vd" + string(rune('a'+i))
+		if i > 0 {
+			vm.Spec.DataDisks = append(vm.Spec.DataDisks, v1alpha1.DataDiskSpec{Device: disks[i].device, DiskTuningSpec: disks[i].tuning})
+		}
+	}
+	vm.Spec.BootDisk.DiskTuningSpec = disks[0].tuning
+	if driver := domDef.Devices.Disks[disks[0].index].Driver; driver != nil && driver.Type == "raw" {
+		vm.Spec.BootDisk.Format = "raw"
+	}
+
+	// Network interfaces keep their MAC addresses and are configured by DHCP
+	vm.Annotations = map[string]string{v1alpha1.AnnotationMACStrategy: string(naming.MACStrategyRandomPersisted)}
+	recordNamingStrategy(vm)
+	for _, iface := range domDef.Devices.Interfaces {
+		spec := v1alpha1.NetworkInterfaceSpec{DHCP: true}
+		if iface.MAC != nil {
+			spec.MACAddress = iface.MAC.Address
+		}
+		switch {
+		case iface.Source != nil && iface.Source.Bridge != nil:
+			spec.Bridge = iface.Source.Bridge.Bridge
+		case iface.Source != nil && iface.Source.Network != nil:
+			spec.Network = iface.Source.Network.Network
+		case iface.Source != nil && iface.Source.Direct != nil && adoptableMacvtapMode(iface.Source.Direct.Mode):
+			spec.Macvtap = &v1alpha1.MacvtapSpec{Device: iface.Source.Direct.Dev, Mode: iface.Source.Direct.Mode}
+		default:
+			warnings = append(warnings, fmt.Sprintf("interface %s is not a bridge, network or bridge/private macvtap interface and is not adopted", spec.MACAddress))
+			continue
+		}
+		if iface.MTU != nil {
+			spec.MTU = int(iface.MTU.Size)
+		}
+		if iface.Driver != nil && iface.Driver.Queues > 0 {
+			spec.Queues = int(iface.Driver.Queues)
+		}
+		if iface.VirtualPort != nil && iface.VirtualPort.Params != nil && iface.VirtualPort.Params.OpenVSwitch != nil && spec.Bridge != "" {
+			spec.BridgeType = v1alpha1.BridgeTypeOpenVSwitch
+		}
+		if vlan := iface.VLan; vlan != nil {
+			if len(vlan.Tags) == 1 && vlan.Trunk == "" && spec.Macvtap == nil {
+				spec.VLAN = int(vlan.Tags[0].ID)
+			} else {
+				warnings = append(warnings, fmt.Sprintf("VLANs of interface %s are not adopted", spec.MACAddress))
+			}
+		}
+		vm.Spec.NetworkInterfaces = append(vm.Spec.NetworkInterfaces, spec)
+	}
+	if len(vm.Spec.NetworkInterfaces) == 0 {
+		return nil, nil, nil, fmt.Errorf("domain has no bridge, network or macvtap interface")
+	}
+
+	guestAgent := false
+	for _, channel := range domDef.Devices.Channels {
+		if channel.Target != nil && channel.Target.VirtIO != nil && channel.Target.VirtIO.Name == "org.qemu.guest_agent.0" {
+			guestAgent = true
+		}
+	}
+	vm.Spec.GuestAgent = &guestAgent
+
+	return vm, disks, warnings, nil
+}
+
+// diskTarget names a domain disk by its target device, for messages.
+func diskTarget(disk libvirtxml.DomainDisk) string {
+	if disk.Target == nil {
+		return "(no target)"
+	}
+	return disk.Target.Dev
+}
+
+// adoptedTuning returns the bus and driver options of a domain disk that
+// differ from foundry's defaults. Discard is adopted VM-wide instead.
+func adoptedTuning(disk libvirtxml.DomainDisk) v1alpha1.DiskTuningSpec {
+	var tuning v1alpha1.DiskTuningSpec
+	if disk.Target.Bus != "virtio" {
+		tuning.Bus = disk.Target.Bus
+	}
+	if driver := disk.Driver; driver != nil {
+		if slices.Contains([]string{"writeback", "unsafe"}, driver.Cache) {
+			tuning.Cache = driver.Cache
+		}
+		if slices.Contains([]string{"native", "threads"}, driver.IO) {
+			tuning.IO = driver.IO
+		}
+	}
+	return tuning
+}
+
+// memoryMiB converts a libvirt memory size to MiB.
+func memoryMiB(value uint, unit string) (uint64, error) {
+	size := uint64(value)
+	switch unit {
+	case "b", "bytes":
+		return size / (1024 * 1024), nil
+	case "", "k", "KiB":
+		return size / 1024, nil
+	case "M", "MiB":
+		return size, nil
+	case "G", "GiB":
+		return size * 1024, nil
+	default:
+		return 0, fmt.Errorf("unsupported memory unit %q", unit)
+	}
+}
+
+// adoptableMacvtapMode reports whether a macvtap interface of the mode can be
+// expressed in a spec; libvirt defaults to vepa when no mode is set.
+func adoptableMacvtapMode(mode string) bool {
+	return mode == v1alpha1.MacvtapModeBridge || mode == v1alpha1.MacvtapModePrivate
+}
@@ -0,0 +1,301 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+	libvirtxml "libvirt.org/go/libvirtxml"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// legacyDomainXML is a domain created outside foundry: its boot disk is
+// listed after a data disk, and it has a CD-ROM and a user-mode interface.
+const legacyDomainXML = `<domain type='kvm'>
+  <name>legacy</name>
+  <memory unit='KiB'>4194304</memory>
+  <currentMemory unit='KiB'>4194304</currentMemory>
+  <vcpu placement='static'>2</vcpu>
+  <os>
+    <type arch='x86_64' machine='pc-q35-8.2'>hvm</type>
+    <loader readonly='yes' type='pflash'>/usr/share/OVMF/OVMF_CODE.fd</loader>
+  </os>
+  <cpu mode='host-passthrough'/>
+  <devices>
+    <disk type='file' device='disk'>
+      <driver name='qemu' type='qcow2'/>
+      <source file='/var/lib/libvirt/images/legacy-data.qcow2'/>
+      <target dev='vda' bus='virtio'/>
+      <boot order='2'/>
+    </disk>
+    <disk type='file' device='disk'>
+      <driver name='qemu' type='qcow2' discard='unmap'/>
+      <source file='/var/lib/libvirt/images/legacy.qcow2'/>
+      <target dev='vdb' bus='virtio'/>
+      <boot order='1'/>
+    </disk>
+    <disk type='file' device='cdrom'>
+      <target dev='sda' bus='sata'/>
+    </disk>
+    <interface type='bridge'>
+      <mac address='52:54:00:12:34:56'/>
+      <source bridge='br0'/>
+      <model type='virtio'/>
+    </interface>
+    <interface type='user'>
+      <mac address='52:54:00:ab:cd:ef'/>
+    </interface>
+    <channel type='unix'>
+      <target type='virtio' name='org.qemu.guest_agent.0'/>
+    </channel>
+  </devices>
+</domain>`
+
+// newAdoptMocks returns mocks with the shut off legacy domain, without
+// foundry metadata, whose disks are volumes of the default pool.
+func newAdoptMocks(t *testing.T) (*mockLibvirtClient, *mockStorageManager) {
+	t.Helper()
+
+	lv := newMockLibvirtClient()
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		return libvirt.Domain{Name: name}, nil
+	}
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateShutoff, 0, nil
+	}
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		return legacyDomainXML, nil
+	}
+	lv.domainDefineXMLFunc = func(xml string) (libvirt.Domain, error) {
+		return libvirt.Domain{Name: "legacy"}, nil
+	}
+	metadataXML := ""
+	lv.domainGetMetadataFunc = func(dom libvirt.Domain, typ int32, uri libvirt.OptString, flags libvirt.DomainModificationImpact) (string, error) {
+		if metadataXML == "" {
+			return "", errors.New("metadata not found")
+		}
+		return metadataXML, nil
+	}
+	lv.domainSetMetadataFunc = func(dom libvirt.Domain, typ int32, md libvirt.OptString, key libvirt.OptString, uri libvirt.OptString, flags libvirt.DomainModificationImpact) error {
+		metadataXML = md[0]
+		return nil
+	}
+
+	sm := newMockStorageManager()
+	sm.getVolumeInfoByPathFunc = func(ctx context.Context, path string) (*storage.VolumeInfo, error) {
+		name := strings.TrimPrefix(path, "/var/lib/libvirt/images/")
+		capacity := uint64(20 * gib)
+		if name == "legacy-data.qcow2" {
+			capacity = 100*gib + 1
+		}
+		return &storage.VolumeInfo{Name: name, Pool: "default", Path: path, Capacity: capacity}, nil
+	}
+	return lv, sm
+}
+
+func TestAdoptWithDeps(t *testing.T) {
+	lv, sm := newAdoptMocks(t)
+
+	result, err := adoptWithDeps(context.Background(), "legacy", AdoptOptions{DeleteSources: true}, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("adoptWithDeps() error = %v", err)
+	}
+
+	// The spec describes the domain
+	spec := result.VM.Spec
+	if spec.VCPUs != 2 || spec.MemoryGiB != 4 || spec.Firmware != "efi" || spec.MachineType != "q35" || spec.CPUMode != "host-passthrough" {
+		t.Errorf("adopted spec = %+v", spec)
+	}
+	if !spec.BootDisk.Empty || spec.BootDisk.SizeGB != 20 {
+		t.Errorf("boot disk = %+v, want empty 20GB", spec.BootDisk)
+	}
+	if len(spec.DataDisks) != 1 || spec.DataDisks[0].Device != "vdb" || spec.DataDisks[0].SizeGB != 101 {
+		t.Errorf("data disks = %+v, want vdb of 101GB", spec.DataDisks)
+	}
+	if len(spec.NetworkInterfaces) != 1 || spec.NetworkInterfaces[0].Bridge != "br0" ||
+		!spec.NetworkInterfaces[0].DHCP || spec.NetworkInterfaces[0].MACAddress != "52:54:00:12:34:56" {
+		t.Errorf("network interfaces = %+v", spec.NetworkInterfaces)
+	}
+	if !result.VM.IsDiscard() || !result.VM.IsGuestAgent() {
+		t.Error("expected discard and guest agent from the domain")
+	}
+	if len(result.Warnings) != 2 {
+		t.Errorf("warnings = %v, want the CD-ROM and user interface", result.Warnings)
+	}
+
+	// The boot disk is the one that boots first, and disks are copied
+	want := "default/legacy.qcow2 -> foundry-vms/legacy_boot.qcow2 default/legacy-data.qcow2 -> foundry-vms/legacy_data-vdb.qcow2"
+	if got := strings.Join(sm.cloneVolumeCalls, " "); got != want {
+		t.Errorf("CloneVolume calls = %s, want %s", got, want)
+	}
+	if got := strings.Join(sm.deleteVolumeCalls, " "); got != "default/legacy.qcow2 default/legacy-data.qcow2" {
+		t.Errorf("DeleteVolume calls = %s, want the originals", got)
+	}
+
+	// The domain is redefined on the copies
+	if len(lv.domainDefineXMLCalls) != 1 {
+		t.Fatalf("expected the domain to be redefined, got %d defines", len(lv.domainDefineXMLCalls))
+	}
+	var domDef libvirtxml.Domain
+	if err := domDef.Unmarshal(lv.domainDefineXMLCalls[0]); err != nil {
+		t.Fatalf("redefined XML does not parse: %v", err)
+	}
+	disks := domDef.Devices.Disks
+	if disks[1].Source.Volume == nil || disks[1].Source.Volume.Volume != "legacy_boot.qcow2" || disks[1].Target.Dev != "vda" {
+		t.Errorf("boot disk = %+v / %+v", disks[1].Source, disks[1].Target)
+	}
+	if disks[0].Source.Volume == nil || disks[0].Source.Volume.Volume != "legacy_data-vdb.qcow2" || disks[0].Target.Dev != "vdb" {
+		t.Errorf("data disk = %+v / %+v", disks[0].Source, disks[0].Target)
+	}
+	if len(domDef.Devices.Interfaces) != 2 {
+		t.Error("the rest of the domain must be kept")
+	}
+
+	// The spec is stored, so the domain is now managed
+	stored, err := newMockMetadataClient(lv).Load(libvirt.Domain{Name: "legacy"})
+	if err != nil || stored.Spec.VCPUs != 2 {
+		t.Fatalf("stored spec = %+v, %v", stored, err)
+	}
+	if _, err := adoptWithDeps(context.Background(), "legacy", AdoptOptions{}, lv, sm, newMockMetadataClient(lv)); err == nil || !strings.Contains(err.Error(), "already managed") {
+		t.Errorf("adopting twice: error = %v, want already managed", err)
+	}
+}
+
+func TestAdoptWithDeps_DiskTuning(t *testing.T) {
+	lv, sm := newAdoptMocks(t)
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		xml := strings.Replace(legacyDomainXML, "dev='vdb' bus='virtio'", "dev='sdb' bus='sata'", 1)
+		return strings.Replace(xml, "type='qcow2' discard='unmap'", "type='qcow2' cache='writeback' io='threads'", 1), nil
+	}
+
+	result, err := adoptWithDeps(context.Background(), "legacy", AdoptOptions{}, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("adoptWithDeps() error = %v", err)
+	}
+
+	// The sata disk boots first
+	want := v1alpha1.DiskTuningSpec{Bus: "sata", Cache: "writeback", IO: "threads"}
+	if got := result.VM.Spec.BootDisk.DiskTuningSpec; !reflect.DeepEqual(got, want) {
+		t.Errorf("boot disk tuning = %+v, want %+v", got, want)
+	}
+	if got := result.VM.Spec.DataDisks[0].DiskTuningSpec; !reflect.DeepEqual(got, v1alpha1.DiskTuningSpec{}) {
+		t.Errorf("data disk tuning = %+v, want the defaults", got)
+	}
+}
+
+func TestAdoptWithDeps_Macvtap(t *testing.T) {
+	lv, sm := newAdoptMocks(t)
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		xml := strings.Replace(legacyDomainXML, "<interface type='user'>", "<interface type='direct'><source dev='eno1' mode='private'/>", 1)
+		return strings.Replace(xml, "<interface type='bridge'>\n      <mac address='52:54:00:12:34:56'/>\n      <source bridge='br0'/>",
+			"<interface type='direct'>\n      <mac address='52:54:00:12:34:56'/>\n      <source dev='eno2' mode='vepa'/>", 1), nil
+	}
+
+	result, err := adoptWithDeps(context.Background(), "legacy", AdoptOptions{}, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("adoptWithDeps() error = %v", err)
+	}
+
+	// Only the private macvtap interface can be expressed in a spec
+	ifaces := result.VM.Spec.NetworkInterfaces
+	want := &v1alpha1.MacvtapSpec{Device: "eno1", Mode: v1alpha1.MacvtapModePrivate}
+	if len(ifaces) != 1 || !reflect.DeepEqual(ifaces[0].Macvtap, want) || ifaces[0].MACAddress != "52:54:00:ab:cd:ef" {
+		t.Errorf("network interfaces = %+v, want the private macvtap interface", ifaces)
+	}
+	if !strings.Contains(strings.Join(result.Warnings, " "), "52:54:00:12:34:56") {
+		t.Errorf("warnings = %v, want the vepa interface", result.Warnings)
+	}
+}
+
+func TestAdoptWithDeps_InterfaceOptions(t *testing.T) {
+	lv, sm := newAdoptMocks(t)
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		return strings.Replace(legacyDomainXML, "<source bridge='br0'/>",
+			"<source bridge='ovsbr0'/><mtu size='9000'/><driver name='vhost' queues='4'/><vlan><tag id='42'/></vlan><virtualport type='openvswitch'><parameters interfaceid='09b11c53-8b5c-4eeb-8f00-d84eaa0aaa4f'/></virtualport>", 1), nil
+	}
+
+	result, err := adoptWithDeps(context.Background(), "legacy", AdoptOptions{}, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("adoptWithDeps() error = %v", err)
+	}
+	iface := result.VM.Spec.NetworkInterfaces[0]
+	if iface.Bridge != "ovsbr0" || iface.BridgeType != v1alpha1.BridgeTypeOpenVSwitch || iface.VLAN != 42 || iface.MTU != 9000 || iface.Queues != 4 {
+		t.Errorf("network interface = %+v, want VLAN 42, MTU 9000 and 4 queues on openvswitch bridge ovsbr0", iface)
+	}
+}
+
+func TestAdoptWithDeps_Rejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(lv *mockLibvirtClient, sm *mockStorageManager)
+		wantErr string
+	}{
+		{
+			name: "running domain",
+			setup: func(lv *mockLibvirtClient, sm *mockStorageManager) {
+				lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+					return domainStateRunning, 0, nil
+				}
+			},
+			wantErr: "shut off",
+		},
+		{
+			name: "disk outside every pool",
+			setup: func(lv *mockLibvirtClient, sm *mockStorageManager) {
+				sm.getVolumeInfoByPathFunc = func(ctx context.Context, path string) (*storage.VolumeInfo, error) {
+					return nil, errors.New("not found")
+				}
+			},
+			wantErr: "foundry pool add",
+		},
+		{
+			name: "usb disk",
+			setup: func(lv *mockLibvirtClient, sm *mockStorageManager) {
+				lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+					return strings.Replace(legacyDomainXML, "dev='vdb' bus='virtio'", "dev='sdb' bus='usb'", 1), nil
+				}
+			},
+			wantErr: "virtio, scsi or sata",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lv, sm := newAdoptMocks(t)
+			tt.setup(lv, sm)
+
+			_, err := adoptWithDeps(context.Background(), "legacy", AdoptOptions{}, lv, sm, newMockMetadataClient(lv))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("adoptWithDeps() error = %v, want %q", err, tt.wantErr)
+			}
+			if len(sm.cloneVolumeCalls) != 0 || len(lv.domainDefineXMLCalls) != 0 {
+				t.Error("a rejected adoption must not change anything")
+			}
+		})
+	}
+}
+
+func TestAdoptWithDeps_CopyFailureCleansUp(t *testing.T) {
+	lv, sm := newAdoptMocks(t)
+	sm.cloneVolumeFunc = func(ctx context.Context, poolName string, spec storage.VolumeSpec, sourcePool, sourceName string) error {
+		if spec.Name == "legacy_data-vdb.qcow2" {
+			return errors.New("pool full")
+		}
+		return nil
+	}
+
+	if _, err := adoptWithDeps(context.Background(), "legacy", AdoptOptions{}, lv, sm, newMockMetadataClient(lv)); err == nil {
+		t.Fatal("expected error")
+	}
+	if got := strings.Join(sm.deleteVolumeCalls, " "); got != "foundry-vms/legacy_boot.qcow2" {
+		t.Errorf("DeleteVolume calls = %s, want the copied boot disk", got)
+	}
+	if len(lv.domainDefineXMLCalls) != 0 {
+		t.Error("domain redefined after a failed copy")
+	}
+}
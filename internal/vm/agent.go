@@ -0,0 +1,104 @@
+package vm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+)
+
+// agentCommandTimeout bounds each guest agent command, in seconds.
+const agentCommandTimeout = 10
+
+// guestExecPollInterval is how often a command run by guestExec is checked.
+const guestExecPollInterval = time.Second
+
+// guestExecResult is the outcome of a command run in the guest.
+type guestExecResult struct {
+	ExitCode int
+	Stdout   []byte
+	Stderr   []byte
+}
+
+// guestExec runs path with args in the guest through the QEMU guest agent and
+// waits for it to exit, checking every poll. The guest needs a running
+// qemu-guest-agent connected to the org.qemu.guest_agent.0 channel.
+func guestExec(ctx context.Context, lv LibvirtClient, domain libvirt.Domain, path string, args []string, poll time.Duration) (*guestExecResult, error) {
+	var started struct {
+		PID int `json:"pid"`
+	}
+	err := agentCommand(lv, domain, "guest-exec", map[string]interface{}{
+		"path":           path,
+		"arg":            args,
+		"capture-output": true,
+	}, &started)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s in the guest (is qemu-guest-agent running?): %w", path, err)
+	}
+
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	for {
+		var status struct {
+			Exited   bool   `json:"exited"`
+			ExitCode int    `json:"exitcode"`
+			OutData  string `json:"out-data"`
+			ErrData  string `json:"err-data"`
+		}
+		if err := agentCommand(lv, domain, "guest-exec-status", map[string]interface{}{"pid": started.PID}, &status); err != nil {
+			return nil, fmt.Errorf("failed to get status of %s in the guest: %w", path, err)
+		}
+		if status.Exited {
+			stdout, err := base64.StdEncoding.DecodeString(status.OutData)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode output of %s: %w", path, err)
+			}
+			stderr, err := base64.StdEncoding.DecodeString(status.ErrData)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode error output of %s: %w", path, err)
+			}
+			return &guestExecResult{ExitCode: status.ExitCode, Stdout: stdout, Stderr: stderr}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// agentCommand runs a guest agent command and decodes its return value into
+// result.
+func agentCommand(lv LibvirtClient, domain libvirt.Domain, command string, arguments interface{}, result interface{}) error {
+	cmd, err := json.Marshal(map[string]interface{}{
+		"execute":   command,
+		"arguments": arguments,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", command, err)
+	}
+
+	out, err := lv.QEMUDomainAgentCommand(domain, string(cmd), agentCommandTimeout, 0)
+	if err != nil {
+		return err
+	}
+	if len(out) == 0 {
+		return fmt.Errorf("%s returned no result", command)
+	}
+
+	var response struct {
+		Return json.RawMessage `json:"return"`
+	}
+	if err := json.Unmarshal([]byte(out[0]), &response); err != nil {
+		return fmt.Errorf("failed to decode %s result: %w", command, err)
+	}
+	if err := json.Unmarshal(response.Return, result); err != nil {
+		return fmt.Errorf("failed to decode %s result: %w", command, err)
+	}
+	return nil
+}
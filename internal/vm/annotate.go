@@ -0,0 +1,173 @@
+// Package vm provides high-level VM management operations.
+package vm
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/labels"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+)
+
+// annotationKeyPattern matches annotation keys: an optional DNS prefix and a
+// name, as in Kubernetes (e.g. "foundry.cofront.xyz/owner" or "ticket").
+var annotationKeyPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9.-]*[a-z0-9])?/)?[A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?$`)
+
+// annotationShortKeys maps the short names accepted on the command line to
+// the standard annotation keys.
+var annotationShortKeys = map[string]string{
+	"owner":            v1alpha1.AnnotationOwner,
+	"note":             v1alpha1.AnnotationNote,
+	"shutdown-timeout": v1alpha1.AnnotationShutdownTimeout,
+}
+
+// AnnotationKey expands the short names "owner", "note" and
+// "shutdown-timeout" to the standard annotation keys; other keys are
+// returned unchanged.
+func AnnotationKey(key string) string {
+	if full, ok := annotationShortKeys[key]; ok {
+		return full
+	}
+	return key
+}
+
+// ParseAnnotations parses annotate arguments: "key=value" sets an annotation
+// and "key-" removes it. Keys are expanded with AnnotationKey.
+func ParseAnnotations(args []string) (map[string]string, []string, error) {
+	set := make(map[string]string)
+	var remove []string
+
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			trimmed, isRemoval := strings.CutSuffix(arg, "-")
+			if !isRemoval {
+				return nil, nil, fmt.Errorf("invalid annotation %q: expected key=value or key-", arg)
+			}
+			key = trimmed
+		}
+
+		key = AnnotationKey(key)
+		if !annotationKeyPattern.MatchString(key) {
+			return nil, nil, fmt.Errorf("invalid annotation key %q", key)
+		}
+		if ok {
+			set[key] = value
+		} else {
+			remove = append(remove, key)
+		}
+	}
+
+	for _, key := range remove {
+		if _, ok := set[key]; ok {
+			return nil, nil, fmt.Errorf("annotation %q is both set and removed", key)
+		}
+	}
+	return set, remove, nil
+}
+
+// Annotate sets and removes annotations on a VM's stored metadata.
+//
+// Annotations are metadata, not spec: the domain is not redefined and the
+// generation is not bumped. Returns the updated VirtualMachine.
+func Annotate(ctx context.Context, vmName string, set map[string]string, remove []string) (*v1alpha1.VirtualMachine, error) {
+	// Connect to libvirt
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logging.FromContext(ctx).Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	return annotateWithDeps(ctx, vmName, set, remove, LibvirtClient.Libvirt(), metaClient)
+}
+
+// annotateWithDeps annotates a VM with injected dependencies.
+// This allows for testing by accepting interfaces instead of concrete types.
+func annotateWithDeps(_ context.Context, vmName string, set map[string]string, remove []string, lv LibvirtClient, mc *metadata.Client) (*v1alpha1.VirtualMachine, error) {
+	domain, err := lv.DomainLookupByName(vmName)
+	if err != nil {
+		return nil, fmt.Errorf("VM '%s' not found: %w", vmName, err)
+	}
+
+	vm, err := mc.Load(domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", vmName, err)
+	}
+
+	if vm.Annotations == nil {
+		vm.Annotations = make(map[string]string, len(set))
+	}
+	for key, value := range set {
+		vm.Annotations[key] = value
+	}
+	for _, key := range remove {
+		delete(vm.Annotations, key)
+	}
+	if len(vm.Annotations) == 0 {
+		vm.Annotations = nil
+	}
+
+	if err := mc.Store(domain, vm); err != nil {
+		return nil, fmt.Errorf("failed to store annotations: %w", err)
+	}
+	return vm, nil
+}
+
+// FilterByAnnotations returns the VMs whose annotations contain every
+// key/value pair in selector. Keys are expanded with AnnotationKey.
+func FilterByAnnotations(vms []*v1alpha1.VirtualMachine, selector map[string]string) []*v1alpha1.VirtualMachine {
+	filtered := make([]*v1alpha1.VirtualMachine, 0, len(vms))
+	for _, vm := range vms {
+		if matchesAnnotations(vm, selector) {
+			filtered = append(filtered, vm)
+		}
+	}
+	return filtered
+}
+
+// FilterByLabels returns the VMs whose labels match selector.
+func FilterByLabels(vms []*v1alpha1.VirtualMachine, selector labels.Selector) []*v1alpha1.VirtualMachine {
+	filtered := make([]*v1alpha1.VirtualMachine, 0, len(vms))
+	for _, vm := range vms {
+		if selector.Matches(vm.Labels) {
+			filtered = append(filtered, vm)
+		}
+	}
+	return filtered
+}
+
+// matchesAnnotations reports whether vm has every annotation in selector.
+func matchesAnnotations(vm *v1alpha1.VirtualMachine, selector map[string]string) bool {
+	for key, want := range selector {
+		got, ok := vm.Annotations[AnnotationKey(key)]
+		if !ok || got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// inheritAnnotations copies stored annotations that desired does not set, so
+// applying a config file keeps annotations added with 'foundry annotate'.
+func inheritAnnotations(current, desired *v1alpha1.VirtualMachine) {
+	for key, value := range current.Annotations {
+		if _, ok := desired.Annotations[key]; ok {
+			continue
+		}
+		if desired.Annotations == nil {
+			desired.Annotations = make(map[string]string)
+		}
+		desired.Annotations[key] = value
+	}
+}
@@ -0,0 +1,210 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/labels"
+)
+
+func TestParseAnnotations(t *testing.T) {
+	set, remove, err := ParseAnnotations([]string{"owner=jane", "note=temp for testing", "ticket=", "example.com/team-"})
+	if err != nil {
+		t.Fatalf("ParseAnnotations() error = %v", err)
+	}
+
+	wantSet := map[string]string{
+		v1alpha1.AnnotationOwner: "jane",
+		v1alpha1.AnnotationNote:  "temp for testing",
+		"ticket":                 "",
+	}
+	if !reflect.DeepEqual(set, wantSet) {
+		t.Errorf("set = %v, want %v", set, wantSet)
+	}
+	if !reflect.DeepEqual(remove, []string{"example.com/team"}) {
+		t.Errorf("remove = %v", remove)
+	}
+}
+
+func TestParseAnnotations_Errors(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{args: []string{"owner"}, wantErr: "expected key=value or key-"},
+		{args: []string{"=jane"}, wantErr: "invalid annotation key"},
+		{args: []string{"bad key=x"}, wantErr: "invalid annotation key"},
+		{args: []string{"owner=jane", "owner-"}, wantErr: "both set and removed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			_, _, err := ParseAnnotations(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseAnnotations() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAnnotateWithDeps(t *testing.T) {
+	stored := testVMConfig()
+	stored.Generation = 2
+	stored.Annotations = map[string]string{"ticket": "OPS-1", v1alpha1.AnnotationNote: "old"}
+	lv, _ := newApplyMocks(t, stored)
+	mc := newMockMetadataClient(lv)
+
+	vm, err := annotateWithDeps(context.Background(), "test-vm", map[string]string{v1alpha1.AnnotationOwner: "jane"}, []string{v1alpha1.AnnotationNote}, lv, mc)
+	if err != nil {
+		t.Fatalf("annotateWithDeps() error = %v", err)
+	}
+
+	want := map[string]string{"ticket": "OPS-1", v1alpha1.AnnotationOwner: "jane"}
+	if !reflect.DeepEqual(vm.Annotations, want) {
+		t.Errorf("Annotations = %v, want %v", vm.Annotations, want)
+	}
+	if vm.Generation != 2 {
+		t.Errorf("Generation = %d, want 2 (annotations are not spec)", vm.Generation)
+	}
+	if len(lv.domainDefineXMLCalls) != 0 {
+		t.Error("expected domain not to be redefined")
+	}
+
+	// The annotations were persisted
+	reloaded, err := mc.Load(libvirt.Domain{Name: "test-vm"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if reloaded.GetOwner() != "jane" {
+		t.Errorf("stored owner = %q, want jane", reloaded.GetOwner())
+	}
+}
+
+func TestAnnotateWithDeps_RemoveLast(t *testing.T) {
+	stored := testVMConfig()
+	stored.Annotations = map[string]string{v1alpha1.AnnotationOwner: "jane"}
+	lv, _ := newApplyMocks(t, stored)
+
+	vm, err := annotateWithDeps(context.Background(), "test-vm", nil, []string{v1alpha1.AnnotationOwner}, lv, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("annotateWithDeps() error = %v", err)
+	}
+	if vm.Annotations != nil {
+		t.Errorf("Annotations = %v, want nil", vm.Annotations)
+	}
+}
+
+func TestAnnotateWithDeps_NotFound(t *testing.T) {
+	lv := newMockLibvirtClient()
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		return libvirt.Domain{}, errors.New("domain not found")
+	}
+
+	_, err := annotateWithDeps(context.Background(), "missing", map[string]string{"a": "b"}, nil, lv, newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("annotateWithDeps() error = %v, want not found", err)
+	}
+	if len(lv.domainSetMetadataCalls) != 0 {
+		t.Error("expected no metadata updates")
+	}
+}
+
+func TestFilterByAnnotations(t *testing.T) {
+	jane := testVMConfig()
+	jane.Name = "jane-vm"
+	jane.Annotations = map[string]string{v1alpha1.AnnotationOwner: "jane", "env": "dev"}
+	bob := testVMConfig()
+	bob.Name = "bob-vm"
+	bob.Annotations = map[string]string{v1alpha1.AnnotationOwner: "bob"}
+	none := testVMConfig()
+	none.Name = "none-vm"
+	vms := []*v1alpha1.VirtualMachine{jane, bob, none}
+
+	names := func(vms []*v1alpha1.VirtualMachine) []string {
+		var out []string
+		for _, vm := range vms {
+			out = append(out, vm.Name)
+		}
+		return out
+	}
+
+	if got := names(FilterByAnnotations(vms, map[string]string{"owner": "jane"})); !reflect.DeepEqual(got, []string{"jane-vm"}) {
+		t.Errorf("owner=jane matched %v", got)
+	}
+	if got := names(FilterByAnnotations(vms, map[string]string{"owner": "jane", "env": "prod"})); got != nil {
+		t.Errorf("owner=jane,env=prod matched %v", got)
+	}
+	if got := names(FilterByAnnotations(vms, nil)); len(got) != 3 {
+		t.Errorf("empty selector matched %v", got)
+	}
+}
+
+func TestFilterByLabels(t *testing.T) {
+	prod := testVMConfig()
+	prod.Name = "prod-vm"
+	prod.Labels = map[string]string{"env": "prod", "team": "web"}
+	ci := testVMConfig()
+	ci.Name = "ci-vm"
+	ci.Labels = map[string]string{"env": "dev", "team": "ci"}
+	none := testVMConfig()
+	none.Name = "none-vm"
+	vms := []*v1alpha1.VirtualMachine{prod, ci, none}
+
+	tests := []struct {
+		selector string
+		want     []string
+	}{
+		{"env=prod", []string{"prod-vm"}},
+		{"team=ci", []string{"ci-vm"}},
+		{"env!=prod", []string{"ci-vm", "none-vm"}},
+		{"env in (prod,dev),team!=web", []string{"ci-vm"}},
+		{"!env", []string{"none-vm"}},
+		{"", []string{"prod-vm", "ci-vm", "none-vm"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			selector, err := labels.Parse(tt.selector)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			var got []string
+			for _, vm := range FilterByLabels(vms, selector) {
+				got = append(got, vm.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FilterByLabels(%q) = %v, want %v", tt.selector, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyWithDeps_KeepsAnnotations(t *testing.T) {
+	stored := testVMConfig()
+	stored.Generation = 1
+	stored.Annotations = map[string]string{v1alpha1.AnnotationOwner: "jane", "env": "dev"}
+	lv, sm := newApplyMocks(t, stored)
+	mc := newMockMetadataClient(lv)
+
+	desired := testVMConfig()
+	desired.Spec.VCPUs = stored.Spec.VCPUs + 2
+	desired.Annotations = map[string]string{"env": "prod"}
+
+	if _, err := applyWithDeps(context.Background(), desired, lv, sm, mc); err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+
+	reloaded, err := mc.Load(libvirt.Domain{Name: desired.Name})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := map[string]string{v1alpha1.AnnotationOwner: "jane", "env": "prod"}
+	if !reflect.DeepEqual(reloaded.Annotations, want) {
+		t.Errorf("Annotations = %v, want %v", reloaded.Annotations, want)
+	}
+}
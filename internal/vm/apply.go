@@ -0,0 +1,965 @@
+// Package vm provides high-level VM management operations.
+package vm
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/google/uuid"
+	"libvirt.org/go/libvirtxml"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/loader"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/naming"
+	"github.com/jbweber/foundry/internal/status"
+	"github.com/jbweber/foundry/internal/storage"
+	"github.com/jbweber/foundry/internal/timing"
+)
+
+// SpecChange describes a single difference between the stored spec of a VM
+// and the desired spec.
+type SpecChange struct {
+	// Field is the spec field that changed (e.g., "spec.vcpus").
+	Field string
+
+	// From is the current value, or empty if the field is being added.
+	From string
+
+	// To is the desired value, or empty if the field is being removed.
+	To string
+
+	// Supported reports whether apply can make this change to an existing VM.
+	// Unsupported changes require the VM to be destroyed and recreated.
+	Supported bool
+}
+
+// String returns a human-readable description of the change.
+func (c SpecChange) String() string {
+	switch {
+	case c.From == "":
+		return fmt.Sprintf("%s: add %s", c.Field, c.To)
+	case c.To == "":
+		return fmt.Sprintf("%s: remove %s", c.Field, c.From)
+	default:
+		return fmt.Sprintf("%s: %s -> %s", c.Field, c.From, c.To)
+	}
+}
+
+// ApplyResult reports what Apply did.
+type ApplyResult struct {
+	// VMName is the name of the VM.
+	VMName string
+
+	// Created is true if the VM did not exist and was created.
+	Created bool
+
+	// Changes lists the spec changes that were applied.
+	Changes []SpecChange
+
+	// RestartRequired is true if some changes only take effect after the
+	// VM is restarted (e.g., raising vCPUs or memory beyond the boot-time
+	// maximum).
+	RestartRequired bool
+
+	// Generation is the VM's metadata.generation after the apply.
+	Generation int64
+}
+
+// Apply creates or updates a VM from a YAML configuration file.
+//
+// If the VM does not exist it is created exactly like Create. Otherwise the
+// desired spec is compared against the spec stored in the domain metadata and
+// the supported changes are applied in place:
+//   - vCPUs and memory (persistent config; live too when within the current
+//     maximum) and their maximums (next boot)
+//   - adding and removing data disks (volumes are created or deleted)
+//   - autostart, startup order and delay
+//   - discard (takes effect on the next boot)
+//   - ttl and ephemeral (stored in the metadata only)
+//
+// Changes to the boot disk, network interfaces, cloud-init, CPU mode or storage
+// pool cannot be applied to an existing VM; if any are present nothing is
+// changed and an error listing them is returned.
+//
+// On success the VM's metadata.generation is incremented and recorded as the
+// status.observedGeneration.
+func Apply(ctx context.Context, configPath string) (*ApplyResult, error) {
+	// Load and validate configuration
+	vm, err := loader.LoadFromFile(ctx, configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	return ApplyFromConfig(ctx, vm)
+}
+
+// ApplyFromConfig creates or updates a VM from an already-loaded configuration.
+// See Apply() for the full workflow description.
+func ApplyFromConfig(ctx context.Context, vm *v1alpha1.VirtualMachine) (*ApplyResult, error) {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	logger.Debug("Ensuring default storage pools exist")
+	if err := storageMgr.EnsureDefaultPools(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ensure default pools: %w", err)
+	}
+
+	// Journal what is created so a crash mid-creation can be rolled back
+	ctx, endJournal := startJournal(ctx)
+	defer endJournal()
+
+	return applyWithDeps(ctx, vm, LibvirtClient.Libvirt(), storageMgr, metaClient)
+}
+
+// applyWithDeps creates or updates a VM with injected dependencies.
+// This allows for testing by accepting interfaces instead of concrete types.
+func applyWithDeps(ctx context.Context, desired *v1alpha1.VirtualMachine, lv LibvirtClient, sm storageManager, mc *metadata.Client) (*ApplyResult, error) {
+	logger := logging.FromContext(ctx)
+
+	// Apply identifies the VM by name, so a generated name would create a
+	// new VM on every run
+	if desired.Name == "" && desired.GenerateName != "" {
+		return nil, fmt.Errorf("metadata.generateName cannot be used with apply; use 'foundry create'")
+	}
+
+	result := &ApplyResult{VMName: desired.Name}
+
+	// Step 1: Create the VM if it does not exist yet
+	domain, err := lv.DomainLookupByName(desired.Name)
+	if err != nil {
+		logger.Info("VM does not exist, creating it", "vm", desired.Name)
+		if desired.Generation == 0 {
+			desired.Generation = 1
+		}
+		desired.UpdateObservedGeneration()
+		if err := createFromConfigWithDeps(ctx, desired, lv, sm, mc); err != nil {
+			return nil, err
+		}
+		result.Created = true
+		result.Generation = desired.Generation
+		return result, nil
+	}
+
+	// Step 2: Load the stored spec to diff against
+	current, err := mc.Load(domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", desired.Name, err)
+	}
+
+	// Step 3: Work out what changed and refuse changes we cannot make
+	inheritMACAddresses(current, desired)
+	inheritVFAddresses(current, desired)
+	inheritAnnotations(current, desired)
+	changes := diffSpec(current, desired)
+	var unsupported []string
+	for _, change := range changes {
+		if !change.Supported {
+			unsupported = append(unsupported, change.String())
+		}
+	}
+	if len(unsupported) > 0 {
+		return nil, fmt.Errorf("cannot apply changes to existing VM '%s' (grow disks with 'foundry disk resize', otherwise destroy and recreate it):\n  %s",
+			desired.Name, strings.Join(unsupported, "\n  "))
+	}
+	if len(changes) == 0 {
+		logger.Info("VM is up to date", "vm", desired.Name)
+		result.Generation = current.Generation
+		return result, nil
+	}
+	result.Changes = changes
+
+	// Redefining the domain points its disks back at the base volumes, which
+	// would silently discard everything written to external snapshot overlays
+	external, err := lv.DomainSnapshotNum(domain, uint32(libvirt.DomainSnapshotListExternal))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count snapshots: %w", err)
+	}
+	if external > 0 {
+		return nil, fmt.Errorf("VM '%s' has %d external snapshot(s); delete them with 'foundry snapshot delete' before applying changes", desired.Name, external)
+	}
+
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VM state: %w", err)
+	}
+	running := state == domainStateRunning
+
+	added, removed := diffDataDisks(current.Spec.DataDisks, desired.Spec.DataDisks)
+
+	// Step 4: Create volumes for new data disks before they are referenced
+	pool := getStoragePool(desired)
+	for _, disk := range added {
+		volumeName := getDataVolumeName(desired, disk.Device)
+		exists, err := sm.VolumeExists(ctx, pool, volumeName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check data volume %s: %w", disk.Device, err)
+		}
+		if exists {
+			return nil, fmt.Errorf("data volume already exists: %s/%s", pool, volumeName)
+		}
+
+		logger.Info("Creating data disk volume", "vm", desired.Name, "device", disk.Device, "sizeGB", disk.SizeGB)
+		dataSpec := storage.VolumeSpec{
+			Name:       volumeName,
+			Type:       storage.VolumeTypeData,
+			Format:     getDiskFormat(desired),
+			CapacityGB: uint64(disk.SizeGB),
+		}
+		if err := sm.CreateVolume(ctx, pool, dataSpec); err != nil {
+			return nil, fmt.Errorf("failed to create data volume %s: %w", disk.Device, err)
+		}
+	}
+
+	// Step 5: Redefine the persistent domain from the desired spec
+	logger.Info("Updating domain definition", "vm", desired.Name)
+	domainDef, err := redefineDomain(lv, domain, desired)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 6: Apply what we can to the running domain
+	if running {
+		result.RestartRequired = applyLive(ctx, lv, domain, current, desired, domainDef, added, removed)
+	}
+
+	// Step 7: Delete volumes of removed data disks once they are detached
+	for _, disk := range removed {
+		if running && !diskDetached(lv, domain, disk.Device) {
+			// Guests may take a while to release a disk; deleting the volume
+			// under them would fail or corrupt their I/O
+			logger.Warn("Data disk is still attached, keeping its volume (re-run destroy --force-clean or delete it after a restart)", "vm", desired.Name, "device", disk.Device)
+			result.RestartRequired = true
+			continue
+		}
+		logger.Info("Deleting data disk volume", "vm", desired.Name, "device", disk.Device)
+		if err := sm.DeleteVolume(ctx, pool, getDataVolumeName(current, disk.Device)); err != nil {
+			logger.Warn("Failed to delete data volume", "vm", desired.Name, "device", disk.Device, "error", err)
+		}
+	}
+
+	// Step 8: Autostart
+	if libvirtAutostart(current) != libvirtAutostart(desired) {
+		autostartValue := int32(0)
+		if libvirtAutostart(desired) {
+			autostartValue = 1
+		}
+		logger.Debug("Setting autostart", "vm", desired.Name, "autostart", autostartValue)
+		if err := lv.DomainSetAutostart(domain, autostartValue); err != nil {
+			return nil, fmt.Errorf("failed to set autostart: %w", err)
+		}
+	}
+
+	// Step 9: Record the new generation
+	desired.UID = current.UID
+	desired.CreationTimestamp = current.CreationTimestamp
+	desired.Status = current.Status
+	desired.Generation = current.Generation + 1
+	desired.UpdateObservedGeneration()
+	if len(added) > 0 || len(removed) > 0 {
+		status.SetCondition(desired, v1alpha1.ConditionStorageProvisioned, v1alpha1.ConditionTrue, "DataDisksChanged",
+			fmt.Sprintf("%d data disk(s) provisioned", len(desired.Spec.DataDisks)))
+	}
+
+	logger.Debug("Storing VM metadata", "vm", desired.Name)
+	if err := mc.Store(domain, desired); err != nil {
+		return nil, fmt.Errorf("failed to store VM metadata: %w", err)
+	}
+
+	result.Generation = desired.Generation
+	logger.Info("VM updated", "vm", desired.Name, "generation", desired.Generation)
+	return result, nil
+}
+
+// inheritMACAddresses copies the MAC addresses generated at creation to
+// interfaces in desired that do not configure one, matching interfaces by
+// position: those of DHCP interfaces, and under the random-persisted and
+// oui-prefixed strategies those of interfaces with the same addresses.
+// Without this every apply would see a changed interface.
+func inheritMACAddresses(current, desired *v1alpha1.VirtualMachine) {
+	generated := namingStrategy(current).MAC != naming.MACStrategyIPDerived
+	for i := range desired.Spec.NetworkInterfaces {
+		iface := &desired.Spec.NetworkInterfaces[i]
+		if iface.MACAddress != "" || i >= len(current.Spec.NetworkInterfaces) {
+			continue
+		}
+		existing := current.Spec.NetworkInterfaces[i]
+		switch {
+		case iface.DHCP && existing.DHCP:
+			iface.MACAddress = existing.MACAddress
+		case generated && iface.DHCP == existing.DHCP && iface.IP == existing.IP && iface.IPv6 == existing.IPv6:
+			iface.MACAddress = existing.MACAddress
+		}
+	}
+}
+
+// inheritVFAddresses copies the PCI addresses of SR-IOV VFs recorded at
+// creation to interfaces in desired that select the same VF of the same PF,
+// matching interfaces by position.
+func inheritVFAddresses(current, desired *v1alpha1.VirtualMachine) {
+	for i := range min(len(current.Spec.NetworkInterfaces), len(desired.Spec.NetworkInterfaces)) {
+		have, want := current.Spec.NetworkInterfaces[i].SRIOV, desired.Spec.NetworkInterfaces[i].SRIOV
+		if have == nil || want == nil || want.PCIAddress != "" {
+			continue
+		}
+		if have.PF == want.PF && have.VF == want.VF {
+			want.PCIAddress = have.PCIAddress
+		}
+	}
+}
+
+// diffSpec compares the stored spec of a VM against the desired spec.
+func diffSpec(current, desired *v1alpha1.VirtualMachine) []SpecChange {
+	var changes []SpecChange
+
+	if current.Spec.VCPUs != desired.Spec.VCPUs {
+		changes = append(changes, SpecChange{
+			Field:     "spec.vcpus",
+			From:      fmt.Sprint(current.Spec.VCPUs),
+			To:        fmt.Sprint(desired.Spec.VCPUs),
+			Supported: true,
+		})
+	}
+	if current.GetMemoryMiB() != desired.GetMemoryMiB() {
+		change := SpecChange{
+			Field:     "spec.memoryGiB",
+			From:      fmt.Sprint(current.Spec.MemoryGiB),
+			To:        fmt.Sprint(desired.Spec.MemoryGiB),
+			Supported: true,
+		}
+		if current.Spec.MemoryMiB > 0 || desired.Spec.MemoryMiB > 0 {
+			change.Field = "spec.memoryMiB"
+			change.From = fmt.Sprint(current.GetMemoryMiB())
+			change.To = fmt.Sprint(desired.GetMemoryMiB())
+		}
+		changes = append(changes, change)
+	}
+	if current.Spec.MaxVCPUs != desired.Spec.MaxVCPUs {
+		changes = append(changes, SpecChange{
+			Field:     "spec.maxVCPUs",
+			From:      optionalIntString(current.Spec.MaxVCPUs),
+			To:        optionalIntString(desired.Spec.MaxVCPUs),
+			Supported: true,
+		})
+	}
+	if current.Spec.MaxMemoryGiB != desired.Spec.MaxMemoryGiB {
+		changes = append(changes, SpecChange{
+			Field:     "spec.maxMemoryGiB",
+			From:      optionalIntString(current.Spec.MaxMemoryGiB),
+			To:        optionalIntString(desired.Spec.MaxMemoryGiB),
+			Supported: true,
+		})
+	}
+	if autostartEnabled(current) != autostartEnabled(desired) {
+		changes = append(changes, SpecChange{
+			Field:     "spec.autostart",
+			From:      fmt.Sprint(autostartEnabled(current)),
+			To:        fmt.Sprint(autostartEnabled(desired)),
+			Supported: true,
+		})
+	}
+
+	if current.Spec.StartupOrder != desired.Spec.StartupOrder {
+		changes = append(changes, SpecChange{
+			Field:     "spec.startupOrder",
+			From:      fmt.Sprint(current.Spec.StartupOrder),
+			To:        fmt.Sprint(desired.Spec.StartupOrder),
+			Supported: true,
+		})
+	}
+	if durationString(current.Spec.StartupDelay) != durationString(desired.Spec.StartupDelay) {
+		changes = append(changes, SpecChange{
+			Field:     "spec.startupDelay",
+			From:      durationString(current.Spec.StartupDelay),
+			To:        durationString(desired.Spec.StartupDelay),
+			Supported: true,
+		})
+	}
+	if current.IsDiscard() != desired.IsDiscard() {
+		changes = append(changes, SpecChange{
+			Field:     "spec.discard",
+			From:      fmt.Sprint(current.IsDiscard()),
+			To:        fmt.Sprint(desired.IsDiscard()),
+			Supported: true,
+		})
+	}
+
+	if current.Spec.TPM != desired.Spec.TPM {
+		changes = append(changes, SpecChange{
+			Field:     "spec.tpm",
+			From:      fmt.Sprint(current.Spec.TPM),
+			To:        fmt.Sprint(desired.Spec.TPM),
+			Supported: true,
+		})
+	}
+
+	// Disk bus and driver options only change the domain XML
+	if current.Spec.IOThreads != desired.Spec.IOThreads {
+		changes = append(changes, SpecChange{
+			Field:     "spec.ioThreads",
+			From:      fmt.Sprint(current.Spec.IOThreads),
+			To:        fmt.Sprint(desired.Spec.IOThreads),
+			Supported: true,
+		})
+	}
+	if !reflect.DeepEqual(driverTuning(current.Spec.BootDisk.DiskTuningSpec), driverTuning(desired.Spec.BootDisk.DiskTuningSpec)) {
+		changes = append(changes, SpecChange{
+			Field:     "spec.bootDisk",
+			From:      diskTuningString(&current.Spec.BootDisk.DiskTuningSpec),
+			To:        diskTuningString(&desired.Spec.BootDisk.DiskTuningSpec),
+			Supported: true,
+		})
+	}
+	if !reflect.DeepEqual(current.Spec.BootDisk.IOTune, desired.Spec.BootDisk.IOTune) {
+		changes = append(changes, SpecChange{
+			Field:     "spec.bootDisk.ioTune",
+			From:      ioTuneString(current.Spec.BootDisk.IOTune),
+			To:        ioTuneString(desired.Spec.BootDisk.IOTune),
+			Supported: true,
+		})
+	}
+	for _, want := range desired.Spec.DataDisks {
+		for _, have := range current.Spec.DataDisks {
+			if have.Device != want.Device {
+				continue
+			}
+			if !reflect.DeepEqual(driverTuning(have.DiskTuningSpec), driverTuning(want.DiskTuningSpec)) {
+				changes = append(changes, SpecChange{
+					Field:     fmt.Sprintf("spec.dataDisks[%s]", want.Device),
+					From:      diskTuningString(&have.DiskTuningSpec),
+					To:        diskTuningString(&want.DiskTuningSpec),
+					Supported: true,
+				})
+			}
+			if !reflect.DeepEqual(have.IOTune, want.IOTune) {
+				changes = append(changes, SpecChange{
+					Field:     fmt.Sprintf("spec.dataDisks[%s].ioTune", want.Device),
+					From:      ioTuneString(have.IOTune),
+					To:        ioTuneString(want.IOTune),
+					Supported: true,
+				})
+			}
+		}
+	}
+
+	// Traffic shaping of interfaces that are otherwise unchanged
+	for i := range min(len(current.Spec.NetworkInterfaces), len(desired.Spec.NetworkInterfaces)) {
+		have, want := current.Spec.NetworkInterfaces[i].Bandwidth, desired.Spec.NetworkInterfaces[i].Bandwidth
+		if !reflect.DeepEqual(have, want) {
+			changes = append(changes, SpecChange{
+				Field:     fmt.Sprintf("spec.networkInterfaces[%d].bandwidth", i),
+				From:      bandwidthString(have),
+				To:        bandwidthString(want),
+				Supported: true,
+			})
+		}
+	}
+
+	if current.IsGuestAgent() != desired.IsGuestAgent() {
+		changes = append(changes, SpecChange{
+			Field:     "spec.guestAgent",
+			From:      fmt.Sprint(current.IsGuestAgent()),
+			To:        fmt.Sprint(desired.IsGuestAgent()),
+			Supported: true,
+		})
+	}
+	if current.Spec.OSVariant != desired.Spec.OSVariant {
+		changes = append(changes, SpecChange{
+			Field:     "spec.osVariant",
+			From:      optionalString(current.Spec.OSVariant),
+			To:        optionalString(desired.Spec.OSVariant),
+			Supported: true,
+		})
+	}
+	if !reflect.DeepEqual(current.Spec.SMBIOS, desired.Spec.SMBIOS) {
+		changes = append(changes, SpecChange{Field: "spec.smbios", From: "(current)", To: "(changed)", Supported: true})
+	}
+	if !reflect.DeepEqual(current.Spec.Graphics, desired.Spec.Graphics) {
+		from, to := graphicsString(current), graphicsString(desired)
+		if from == to {
+			// Only the password differs
+			to += " (changed)"
+		}
+		changes = append(changes, SpecChange{Field: "spec.graphics", From: from, To: to, Supported: true})
+	}
+	if !reflect.DeepEqual(current.Spec.HostDevices, desired.Spec.HostDevices) {
+		changes = append(changes, SpecChange{
+			Field:     "spec.hostDevices",
+			From:      hostDevicesString(current),
+			To:        hostDevicesString(desired),
+			Supported: true,
+		})
+	}
+
+	// Reaping settings only live in the stored metadata
+	if ttlString(current) != ttlString(desired) {
+		changes = append(changes, SpecChange{Field: "spec.ttl", From: ttlString(current), To: ttlString(desired), Supported: true})
+	}
+	if current.Spec.Ephemeral != desired.Spec.Ephemeral {
+		changes = append(changes, SpecChange{
+			Field:     "spec.ephemeral",
+			From:      fmt.Sprint(current.Spec.Ephemeral),
+			To:        fmt.Sprint(desired.Spec.Ephemeral),
+			Supported: true,
+		})
+	}
+
+	// Data disks are matched by device; resizing one in place is not supported
+	added, removed := diffDataDisks(current.Spec.DataDisks, desired.Spec.DataDisks)
+	for _, disk := range added {
+		changes = append(changes, SpecChange{
+			Field:     "spec.dataDisks",
+			To:        fmt.Sprintf("%s (%dGB)", disk.Device, disk.SizeGB),
+			Supported: true,
+		})
+	}
+	for _, disk := range removed {
+		changes = append(changes, SpecChange{
+			Field:     "spec.dataDisks",
+			From:      fmt.Sprintf("%s (%dGB)", disk.Device, disk.SizeGB),
+			Supported: true,
+		})
+	}
+	for _, want := range desired.Spec.DataDisks {
+		for _, have := range current.Spec.DataDisks {
+			if have.Device == want.Device && have.SizeGB != want.SizeGB {
+				changes = append(changes, SpecChange{
+					Field: fmt.Sprintf("spec.dataDisks[%s].sizeGB", want.Device),
+					From:  fmt.Sprint(have.SizeGB),
+					To:    fmt.Sprint(want.SizeGB),
+				})
+			}
+		}
+	}
+
+	// Everything else is baked into the boot disk, NICs or cloud-init ISO
+	if current.Spec.CPUMode != desired.Spec.CPUMode {
+		changes = append(changes, SpecChange{Field: "spec.cpuMode", From: current.Spec.CPUMode, To: desired.Spec.CPUMode})
+	}
+	if current.GetFirmware() != desired.GetFirmware() {
+		changes = append(changes, SpecChange{Field: "spec.firmware", From: current.GetFirmware(), To: desired.GetFirmware()})
+	}
+	if secureBootString(current) != secureBootString(desired) {
+		changes = append(changes, SpecChange{Field: "spec.secureBoot", From: secureBootString(current), To: secureBootString(desired)})
+	}
+	if current.GetMachineType() != desired.GetMachineType() {
+		changes = append(changes, SpecChange{Field: "spec.machineType", From: current.GetMachineType(), To: desired.GetMachineType()})
+	}
+	if getStoragePool(current) != getStoragePool(desired) {
+		changes = append(changes, SpecChange{Field: "spec.storagePool", From: getStoragePool(current), To: getStoragePool(desired)})
+	}
+	currentBoot, desiredBoot := current.Spec.BootDisk, desired.Spec.BootDisk
+	currentBoot.DiskTuningSpec, desiredBoot.DiskTuningSpec = v1alpha1.DiskTuningSpec{}, v1alpha1.DiskTuningSpec{}
+	if !reflect.DeepEqual(currentBoot, desiredBoot) {
+		changes = append(changes, SpecChange{Field: "spec.bootDisk", From: "(current)", To: "(changed)"})
+	}
+	if !reflect.DeepEqual(withoutBandwidth(current.Spec.NetworkInterfaces), withoutBandwidth(desired.Spec.NetworkInterfaces)) {
+		changes = append(changes, SpecChange{Field: "spec.networkInterfaces", From: "(current)", To: "(changed)"})
+	}
+	if !reflect.DeepEqual(current.Spec.NetworkDefaults, desired.Spec.NetworkDefaults) {
+		changes = append(changes, SpecChange{Field: "spec.networkDefaults", From: "(current)", To: "(changed)"})
+	}
+	if !reflect.DeepEqual(current.Spec.CloudInit, desired.Spec.CloudInit) {
+		changes = append(changes, SpecChange{Field: "spec.cloudInit", From: "(current)", To: "(changed)"})
+	}
+
+	return changes
+}
+
+// secureBootString returns the Secure Boot setting of a VM for display, or
+// "unset".
+func secureBootString(vm *v1alpha1.VirtualMachine) string {
+	if vm.Spec.SecureBoot == nil {
+		return "unset"
+	}
+	return fmt.Sprint(*vm.Spec.SecureBoot)
+}
+
+// graphicsString returns the display of a VM for display, or "none". The
+// password itself is never shown.
+func graphicsString(vm *v1alpha1.VirtualMachine) string {
+	g := vm.Spec.Graphics
+	if g == nil {
+		return "none"
+	}
+	port := "auto"
+	if g.Port != 0 {
+		port = fmt.Sprint(g.Port)
+	}
+	s := fmt.Sprintf("%s on %s", g.Type, net.JoinHostPort(vm.GetGraphicsListen(), port))
+	if g.Password != "" {
+		s += " with password"
+	}
+	return s
+}
+
+// hostDevicesString returns the host devices of a VM for display, or "none".
+func hostDevicesString(vm *v1alpha1.VirtualMachine) string {
+	if len(vm.Spec.HostDevices) == 0 {
+		return "none"
+	}
+	devices := make([]string, len(vm.Spec.HostDevices))
+	for i, dev := range vm.Spec.HostDevices {
+		if dev.MdevUUID != "" {
+			devices[i] = "mdev " + dev.MdevUUID
+		} else {
+			devices[i] = dev.PCIAddress
+		}
+	}
+	return strings.Join(devices, ", ")
+}
+
+// optionalIntString returns an optional number for display, or "unset".
+func optionalIntString(n int) string {
+	if n == 0 {
+		return "unset"
+	}
+	return fmt.Sprint(n)
+}
+
+// optionalString returns an optional string for display, or "unset".
+func optionalString(s string) string {
+	if s == "" {
+		return "unset"
+	}
+	return s
+}
+
+// ttlString returns the TTL of a VM for display, or "none".
+func ttlString(vm *v1alpha1.VirtualMachine) string {
+	return durationString(vm.Spec.TTL)
+}
+
+// durationString returns an optional duration for display, or "none".
+func durationString(d *v1alpha1.Duration) string {
+	if d == nil {
+		return "none"
+	}
+	return d.String()
+}
+
+// diskTuningString returns the bus and driver options of a disk for display.
+func diskTuningString(tuning *v1alpha1.DiskTuningSpec) string {
+	io, discard := tuning.IO, "default"
+	if io == "" {
+		io = "default"
+	}
+	if tuning.Discard != nil {
+		discard = fmt.Sprint(*tuning.Discard)
+	}
+	return fmt.Sprintf("bus=%s cache=%s io=%s discard=%s ioThread=%d", tuning.GetBus(), tuning.GetCache(), io, discard, tuning.IOThread)
+}
+
+// diskTuningChanged returns true if the bus or driver options of the boot
+// disk or a data disk kept by desired differ, or the VM's I/O threads do.
+func diskTuningChanged(current, desired *v1alpha1.VirtualMachine) bool {
+	if current.Spec.IOThreads != desired.Spec.IOThreads ||
+		!reflect.DeepEqual(driverTuning(current.Spec.BootDisk.DiskTuningSpec), driverTuning(desired.Spec.BootDisk.DiskTuningSpec)) {
+		return true
+	}
+	for _, want := range desired.Spec.DataDisks {
+		for _, have := range current.Spec.DataDisks {
+			if have.Device == want.Device && !reflect.DeepEqual(driverTuning(have.DiskTuningSpec), driverTuning(want.DiskTuningSpec)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// driverTuning returns the bus and driver options of a disk without its I/O
+// limits, which can be changed live.
+func driverTuning(tuning v1alpha1.DiskTuningSpec) v1alpha1.DiskTuningSpec {
+	tuning.IOTune = nil
+	return tuning
+}
+
+// ioTuneString returns the I/O limits of a disk for display.
+func ioTuneString(ioTune *v1alpha1.DiskIOTuneSpec) string {
+	if ioTune == nil || *ioTune == (v1alpha1.DiskIOTuneSpec{}) {
+		return "none"
+	}
+	var limits []string
+	for _, limit := range []struct {
+		name  string
+		value int
+	}{
+		{"totalIOPS", ioTune.TotalIOPS}, {"readIOPS", ioTune.ReadIOPS}, {"writeIOPS", ioTune.WriteIOPS},
+		{"totalBytesPerSec", ioTune.TotalBytesPerSec}, {"readBytesPerSec", ioTune.ReadBytesPerSec}, {"writeBytesPerSec", ioTune.WriteBytesPerSec},
+	} {
+		if limit.value > 0 {
+			limits = append(limits, fmt.Sprintf("%s=%d", limit.name, limit.value))
+		}
+	}
+	return strings.Join(limits, " ")
+}
+
+// withoutBandwidth returns a copy of interfaces without their traffic
+// shaping, which can be changed live.
+func withoutBandwidth(interfaces []v1alpha1.NetworkInterfaceSpec) []v1alpha1.NetworkInterfaceSpec {
+	if interfaces == nil {
+		return nil
+	}
+	stripped := make([]v1alpha1.NetworkInterfaceSpec, len(interfaces))
+	for i, iface := range interfaces {
+		iface.Bandwidth = nil
+		stripped[i] = iface
+	}
+	return stripped
+}
+
+// bandwidthString returns the traffic shaping of an interface for display.
+func bandwidthString(bandwidth *v1alpha1.BandwidthSpec) string {
+	if bandwidth == nil || (bandwidth.Inbound == nil && bandwidth.Outbound == nil) {
+		return "none"
+	}
+	limit := func(l *v1alpha1.BandwidthLimitSpec) string {
+		if l == nil {
+			return "none"
+		}
+		return fmt.Sprintf("%d/%d/%d", l.Average, l.Peak, l.Burst)
+	}
+	return fmt.Sprintf("inbound=%s outbound=%s", limit(bandwidth.Inbound), limit(bandwidth.Outbound))
+}
+
+// diffDataDisks returns the data disks present only in desired (added) and
+// only in current (removed), matched by device name.
+func diffDataDisks(current, desired []v1alpha1.DataDiskSpec) (added, removed []v1alpha1.DataDiskSpec) {
+	has := func(disks []v1alpha1.DataDiskSpec, device string) bool {
+		for _, d := range disks {
+			if d.Device == device {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, d := range desired {
+		if !has(current, d.Device) {
+			added = append(added, d)
+		}
+	}
+	for _, d := range current {
+		if !has(desired, d.Device) {
+			removed = append(removed, d)
+		}
+	}
+	return added, removed
+}
+
+// autostartEnabled returns the effective autostart setting (default true).
+func autostartEnabled(vm *v1alpha1.VirtualMachine) bool {
+	return vm.Spec.Autostart == nil || *vm.Spec.Autostart
+}
+
+// libvirtAutostart returns whether libvirt should start the VM on host boot.
+// VMs with a startup order are started by 'foundry autostart' instead.
+func libvirtAutostart(vm *v1alpha1.VirtualMachine) bool {
+	return autostartEnabled(vm) && vm.Spec.StartupOrder == 0
+}
+
+// redefineDomain replaces the persistent definition of domain with one
+// generated from the desired spec. The domain UUID and any existing metadata
+// are carried over so libvirt treats it as an update of the same domain; only
+// the libosinfo element follows the desired OS variant.
+func redefineDomain(lv LibvirtClient, domain libvirt.Domain, desired *v1alpha1.VirtualMachine) (*libvirtxml.Domain, error) {
+	domainDef, newXML, err := redefinedDomain(lv, domain, desired)
+	if err != nil {
+		return nil, err
+	}
+
+	defer timing.Start("redefine domain")()
+	if _, err := lv.DomainDefineXML(newXML); err != nil {
+		return nil, fmt.Errorf("failed to redefine domain: %w", err)
+	}
+
+	return domainDef, nil
+}
+
+// redefinedDomain returns the definition redefineDomain submits for domain,
+// parsed and as XML.
+func redefinedDomain(lv LibvirtClient, domain libvirt.Domain, desired *v1alpha1.VirtualMachine) (*libvirtxml.Domain, string, error) {
+	domainXML, err := foundrylibvirt.GenerateDomainXML(desired)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate domain XML: %w", err)
+	}
+
+	var domainDef libvirtxml.Domain
+	if err := domainDef.Unmarshal(domainXML); err != nil {
+		return nil, "", fmt.Errorf("failed to parse generated domain XML: %w", err)
+	}
+	domainDef.UUID = uuid.UUID(domain.UUID).String()
+
+	currentXML, err := lv.DomainGetXMLDesc(domain, libvirt.DomainXMLInactive)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get domain XML: %w", err)
+	}
+	var currentDef libvirtxml.Domain
+	if err := currentDef.Unmarshal(currentXML); err != nil {
+		return nil, "", fmt.Errorf("failed to parse domain XML: %w", err)
+	}
+	domainDef.Metadata, err = foundrylibvirt.MergeOSInfoMetadata(currentDef.Metadata, desired)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate domain metadata: %w", err)
+	}
+
+	newXML, err := domainDef.Marshal()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to marshal domain XML: %w", err)
+	}
+	return &domainDef, newXML, nil
+}
+
+// applyLive applies changes to a running domain where libvirt allows it.
+// The persistent definition has already been updated, so anything that cannot
+// be changed live takes effect on the next boot. Returns true if a restart is
+// needed for the running VM to match the desired spec.
+func applyLive(ctx context.Context, lv LibvirtClient, domain libvirt.Domain, current, desired *v1alpha1.VirtualMachine, domainDef *libvirtxml.Domain, added, removed []v1alpha1.DataDiskSpec) bool {
+	logger := logging.FromContext(ctx)
+
+	restartRequired := false
+
+	// The running VM booted with the maximums of current.Spec, so only values
+	// up to those can be set live
+	if desired.Spec.VCPUs != current.Spec.VCPUs {
+		if desired.Spec.VCPUs > current.GetMaxVCPUs() {
+			logger.Info("vCPU increase takes effect after restart (raise maxVCPUs to hotplug)", "vm", desired.Name, "vcpus", desired.Spec.VCPUs)
+			restartRequired = true
+		} else if err := lv.DomainSetVcpusFlags(domain, uint32(desired.Spec.VCPUs), uint32(libvirt.DomainAffectLive)); err != nil {
+			logger.Warn("Failed to set vCPUs live (takes effect after restart)", "vm", desired.Name, "error", err)
+			restartRequired = true
+		}
+	}
+
+	if desired.GetMemoryMiB() != current.GetMemoryMiB() {
+		if desired.GetMemoryMiB() > current.GetMaxMemoryMiB() {
+			logger.Info("Memory increase takes effect after restart (raise maxMemoryGiB to grow live)", "vm", desired.Name, "memoryMiB", desired.GetMemoryMiB())
+			restartRequired = true
+		} else {
+			memoryKiB := uint64(desired.GetMemoryMiB()) * 1024
+			if err := lv.DomainSetMemoryFlags(domain, memoryKiB, uint32(libvirt.DomainAffectLive)); err != nil {
+				logger.Warn("Failed to set memory live (takes effect after restart)", "vm", desired.Name, "error", err)
+				restartRequired = true
+			}
+		}
+	}
+
+	if desired.Spec.MaxVCPUs != current.Spec.MaxVCPUs || desired.Spec.MaxMemoryGiB != current.Spec.MaxMemoryGiB {
+		logger.Info("vCPU and memory maximum changes take effect after restart", "vm", desired.Name)
+		restartRequired = true
+	}
+
+	// Disk driver options are read when the disk is opened
+	if desired.IsDiscard() != current.IsDiscard() {
+		logger.Info("Discard change takes effect after restart", "vm", desired.Name)
+		restartRequired = true
+	}
+	if diskTuningChanged(current, desired) {
+		logger.Info("Disk bus and driver changes take effect after restart", "vm", desired.Name)
+		restartRequired = true
+	}
+
+	if desired.IsGuestAgent() != current.IsGuestAgent() {
+		logger.Info("Guest agent channel change takes effect after restart", "vm", desired.Name)
+		restartRequired = true
+	}
+
+	// The TPM cannot be hotplugged
+	if desired.Spec.TPM != current.Spec.TPM {
+		logger.Info("TPM change takes effect after restart", "vm", desired.Name)
+		restartRequired = true
+	}
+
+	// The firmware tables are built when the VM starts
+	if !reflect.DeepEqual(desired.Spec.SMBIOS, current.Spec.SMBIOS) {
+		logger.Info("SMBIOS change takes effect after restart", "vm", desired.Name)
+		restartRequired = true
+	}
+
+	// Display devices cannot be hotplugged
+	if !reflect.DeepEqual(desired.Spec.Graphics, current.Spec.Graphics) {
+		logger.Info("Display change takes effect after restart", "vm", desired.Name)
+		restartRequired = true
+	}
+
+	// Passed-through devices are detached from the host when the VM starts
+	if !reflect.DeepEqual(desired.Spec.HostDevices, current.Spec.HostDevices) {
+		logger.Info("Host device change takes effect after restart", "vm", desired.Name)
+		restartRequired = true
+	}
+
+	// I/O limits and traffic shaping are changed on the running devices
+	if !setLiveLimits(ctx, lv, domain, current, desired) {
+		restartRequired = true
+	}
+
+	for _, disk := range added {
+		diskXML, err := domainDiskXML(domainDef, disk.Device)
+		if err == nil {
+			logger.Info("Attaching data disk", "vm", desired.Name, "device", disk.Device)
+			err = lv.DomainAttachDeviceFlags(domain, diskXML, uint32(libvirt.DomainAffectLive))
+		}
+		if err != nil {
+			logger.Warn("Failed to attach data disk live (takes effect after restart)", "vm", desired.Name, "device", disk.Device, "error", err)
+			restartRequired = true
+		}
+	}
+
+	for _, disk := range removed {
+		liveDisk, err := findDomainDisk(lv, domain, disk.Device)
+		if err != nil {
+			// Not attached to the running VM, nothing to detach
+			continue
+		}
+		diskXML, err := liveDisk.Marshal()
+		if err == nil {
+			logger.Info("Detaching data disk", "vm", desired.Name, "device", disk.Device)
+			err = lv.DomainDetachDeviceFlags(domain, diskXML, uint32(libvirt.DomainAffectLive))
+		}
+		if err != nil {
+			logger.Warn("Failed to detach data disk live (takes effect after restart)", "vm", desired.Name, "device", disk.Device, "error", err)
+			restartRequired = true
+		}
+	}
+
+	return restartRequired
+}
+
+// diskDetached reports whether device is no longer attached to the running domain.
+func diskDetached(lv LibvirtClient, domain libvirt.Domain, device string) bool {
+	_, err := findDomainDisk(lv, domain, device)
+	return err != nil
+}
+
+// domainDiskXML returns the XML of the disk at device in a domain definition.
+func domainDiskXML(domainDef *libvirtxml.Domain, device string) (string, error) {
+	if domainDef.Devices != nil {
+		for i := range domainDef.Devices.Disks {
+			disk := &domainDef.Devices.Disks[i]
+			if disk.Target != nil && disk.Target.Dev == device {
+				return disk.Marshal()
+			}
+		}
+	}
+	return "", fmt.Errorf("disk %s not found in domain definition", device)
+}
@@ -0,0 +1,629 @@
+package vm
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// newApplyMocks returns mocks for a running VM whose stored spec is stored.
+// Metadata written with DomainSetMetadata is returned by later loads.
+func newApplyMocks(t *testing.T, stored *v1alpha1.VirtualMachine) (*mockLibvirtClient, *mockStorageManager) {
+	t.Helper()
+
+	lv := newMockLibvirtClient()
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		return libvirt.Domain{Name: name}, nil
+	}
+	metadataXML := storedMetadataXML(t, stored)
+	lv.domainGetMetadataFunc = func(dom libvirt.Domain, typ int32, uri libvirt.OptString, flags libvirt.DomainModificationImpact) (string, error) {
+		return metadataXML, nil
+	}
+	lv.domainSetMetadataFunc = func(dom libvirt.Domain, typ int32, md libvirt.OptString, key libvirt.OptString, uri libvirt.OptString, flags libvirt.DomainModificationImpact) error {
+		metadataXML = md[0]
+		return nil
+	}
+
+	return lv, newMockStorageManager()
+}
+
+func TestApplyWithDeps_CreatesMissingVM(t *testing.T) {
+	lv := newMockLibvirtClient()
+	sm := newMockStorageManager()
+
+	result, err := applyWithDeps(context.Background(), testVMConfig(), lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+	if !result.Created {
+		t.Error("expected Created = true")
+	}
+	if result.Generation != 1 {
+		t.Errorf("Generation = %d, want 1", result.Generation)
+	}
+	if len(lv.domainCreateCalls) != 1 {
+		t.Errorf("expected VM to be started, got %d DomainCreate calls", len(lv.domainCreateCalls))
+	}
+}
+
+func TestApplyWithDeps_NoChanges(t *testing.T) {
+	stored := testVMConfig()
+	stored.Generation = 3
+	lv, sm := newApplyMocks(t, stored)
+
+	result, err := applyWithDeps(context.Background(), testVMConfig(), lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+	if len(result.Changes) != 0 {
+		t.Errorf("Changes = %v, want none", result.Changes)
+	}
+	if result.Generation != 3 {
+		t.Errorf("Generation = %d, want 3 (unchanged)", result.Generation)
+	}
+	if len(lv.domainDefineXMLCalls) != 0 || len(lv.domainSetMetadataCalls) != 0 {
+		t.Error("expected no domain or metadata updates")
+	}
+}
+
+func TestApplyWithDeps_ResourcesRunning(t *testing.T) {
+	stored := testVMConfig()
+	stored.Generation = 1
+	lv, sm := newApplyMocks(t, stored)
+
+	desired := testVMConfig()
+	desired.Spec.VCPUs = 1     // decrease: applied live
+	desired.Spec.MemoryGiB = 4 // increase: needs a restart
+
+	result, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+
+	if len(result.Changes) != 2 {
+		t.Errorf("Changes = %v, want 2", result.Changes)
+	}
+	if !result.RestartRequired {
+		t.Error("expected RestartRequired for memory increase")
+	}
+	if result.Generation != 2 {
+		t.Errorf("Generation = %d, want 2", result.Generation)
+	}
+
+	if len(lv.domainDefineXMLCalls) != 1 {
+		t.Fatalf("expected domain to be redefined once, got %d", len(lv.domainDefineXMLCalls))
+	}
+	xml := lv.domainDefineXMLCalls[0]
+	if !strings.Contains(xml, ">1</vcpu>") || !strings.Contains(xml, `<memory unit="GiB">4</memory>`) {
+		t.Errorf("redefined XML does not reflect desired resources:\n%s", xml)
+	}
+	if !strings.Contains(xml, "<uuid>") {
+		t.Error("redefined XML must keep the domain UUID")
+	}
+
+	if len(lv.domainSetVcpusFlagsCalls) != 1 || lv.domainSetVcpusFlagsCalls[0] != 1 {
+		t.Errorf("DomainSetVcpusFlags calls = %v, want [1]", lv.domainSetVcpusFlagsCalls)
+	}
+	if len(lv.domainSetMemoryFlagsCalls) != 0 {
+		t.Errorf("memory increase must not be applied live, got %v", lv.domainSetMemoryFlagsCalls)
+	}
+
+	// Stored metadata reflects the new generation
+	loaded, err := newMockMetadataClient(lv).Load(libvirt.Domain{Name: "test-vm"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Generation != 2 || loaded.Status.ObservedGeneration != 2 {
+		t.Errorf("stored generation = %d, observedGeneration = %d, want 2/2", loaded.Generation, loaded.Status.ObservedGeneration)
+	}
+	if loaded.Spec.MemoryGiB != 4 {
+		t.Errorf("stored MemoryGiB = %d, want 4", loaded.Spec.MemoryGiB)
+	}
+}
+
+func TestApplyWithDeps_DataDisks(t *testing.T) {
+	stored := testVMConfig()
+	stored.Spec.DataDisks = []v1alpha1.DataDiskSpec{{Device: "vdb", SizeGB: 50}}
+	lv, sm := newApplyMocks(t, stored)
+
+	// vdb is attached until detached, after which it is gone
+	detached := false
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		if detached {
+			return "<domain type='kvm'><name>test-vm</name></domain>", nil
+		}
+		return `<domain type='kvm'><name>test-vm</name><devices><disk type='volume' device='disk'><source pool='foundry-vms' volume='test-vm_data-vdb.qcow2'/><target dev='vdb' bus='virtio'/></disk></devices></domain>`, nil
+	}
+	lv.domainDetachDeviceFunc = func(dom libvirt.Domain, xml string, flags uint32) error {
+		detached = true
+		return nil
+	}
+
+	var created []storage.VolumeSpec
+	sm.createVolumeFunc = func(ctx context.Context, poolName string, spec storage.VolumeSpec) error {
+		created = append(created, spec)
+		return nil
+	}
+
+	desired := testVMConfig()
+	desired.Spec.DataDisks = []v1alpha1.DataDiskSpec{{Device: "vdc", SizeGB: 10}}
+
+	result, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+	if result.RestartRequired {
+		t.Error("disk changes were applied live, no restart expected")
+	}
+
+	if len(created) != 1 || created[0].Name != "test-vm_data-vdc.qcow2" || created[0].CapacityGB != 10 {
+		t.Errorf("created volumes = %+v, want test-vm_data-vdc.qcow2 (10GB)", created)
+	}
+	if len(lv.domainAttachDeviceCalls) != 1 || !strings.Contains(lv.domainAttachDeviceCalls[0], `dev="vdc"`) {
+		t.Errorf("attach calls = %v, want vdc", lv.domainAttachDeviceCalls)
+	}
+	if len(lv.domainDetachDeviceCalls) != 1 || !strings.Contains(lv.domainDetachDeviceCalls[0], `dev="vdb"`) {
+		t.Errorf("detach calls = %v, want vdb", lv.domainDetachDeviceCalls)
+	}
+	if len(sm.deleteVolumeCalls) != 1 || sm.deleteVolumeCalls[0] != "foundry-vms/test-vm_data-vdb.qcow2" {
+		t.Errorf("deleted volumes = %v, want foundry-vms/test-vm_data-vdb.qcow2", sm.deleteVolumeCalls)
+	}
+}
+
+func TestApplyWithDeps_KeepsVolumeWhileAttached(t *testing.T) {
+	stored := testVMConfig()
+	stored.Spec.DataDisks = []v1alpha1.DataDiskSpec{{Device: "vdb", SizeGB: 50}}
+	lv, sm := newApplyMocks(t, stored)
+
+	// The guest never releases the disk
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		return `<domain type='kvm'><name>test-vm</name><devices><disk type='volume' device='disk'><target dev='vdb' bus='virtio'/></disk></devices></domain>`, nil
+	}
+
+	result, err := applyWithDeps(context.Background(), testVMConfig(), lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+	if !result.RestartRequired {
+		t.Error("expected RestartRequired while the disk is still attached")
+	}
+	if len(sm.deleteVolumeCalls) != 0 {
+		t.Errorf("volume of attached disk must not be deleted, got %v", sm.deleteVolumeCalls)
+	}
+}
+
+func TestApplyWithDeps_Autostart(t *testing.T) {
+	stored := testVMConfig()
+	lv, sm := newApplyMocks(t, stored)
+
+	desired := testVMConfig()
+	disabled := false
+	desired.Spec.Autostart = &disabled
+
+	var autostart []int32
+	lv.domainSetAutostartFunc = func(dom libvirt.Domain, value int32) error {
+		autostart = append(autostart, value)
+		return nil
+	}
+
+	if _, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+	if len(autostart) != 1 || autostart[0] != 0 {
+		t.Errorf("DomainSetAutostart values = %v, want [0]", autostart)
+	}
+}
+
+func TestApplyWithDeps_Discard(t *testing.T) {
+	stored := testVMConfig()
+	lv, sm := newApplyMocks(t, stored)
+
+	desired := testVMConfig()
+	disabled := false
+	desired.Spec.Discard = &disabled
+
+	result, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+	if len(result.Changes) != 1 || result.Changes[0].Field != "spec.discard" {
+		t.Errorf("Changes = %v, want spec.discard", result.Changes)
+	}
+	if !result.RestartRequired {
+		t.Error("expected RestartRequired for a running VM")
+	}
+	if len(lv.domainDefineXMLCalls) != 1 || strings.Contains(lv.domainDefineXMLCalls[0], "discard=") {
+		t.Errorf("expected domain to be redefined without discard, got %v", lv.domainDefineXMLCalls)
+	}
+}
+
+func TestApplyWithDeps_GuestAgent(t *testing.T) {
+	stored := testVMConfig()
+	lv, sm := newApplyMocks(t, stored)
+
+	desired := testVMConfig()
+	disabled := false
+	desired.Spec.GuestAgent = &disabled
+
+	result, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+	if len(result.Changes) != 1 || result.Changes[0].Field != "spec.guestAgent" {
+		t.Errorf("Changes = %v, want spec.guestAgent", result.Changes)
+	}
+	if !result.RestartRequired {
+		t.Error("expected RestartRequired for a running VM")
+	}
+	if len(lv.domainDefineXMLCalls) != 1 || strings.Contains(lv.domainDefineXMLCalls[0], "<channel") {
+		t.Errorf("expected domain to be redefined without the agent channel, got %v", lv.domainDefineXMLCalls)
+	}
+}
+
+func TestApplyWithDeps_HotplugWithinMaximums(t *testing.T) {
+	stored := testVMConfig()
+	stored.Spec.MaxVCPUs = 8
+	stored.Spec.MaxMemoryGiB = 16
+	lv, sm := newApplyMocks(t, stored)
+
+	desired := testVMConfig()
+	desired.Spec.MaxVCPUs = 8
+	desired.Spec.MaxMemoryGiB = 16
+	desired.Spec.VCPUs = 6
+	desired.Spec.MemoryGiB = 12
+
+	result, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+	if result.RestartRequired {
+		t.Error("increases within the maximums must not require a restart")
+	}
+	if len(lv.domainSetVcpusFlagsCalls) != 1 || lv.domainSetVcpusFlagsCalls[0] != 6 {
+		t.Errorf("DomainSetVcpusFlags calls = %v, want [6]", lv.domainSetVcpusFlagsCalls)
+	}
+	if len(lv.domainSetMemoryFlagsCalls) != 1 || lv.domainSetMemoryFlagsCalls[0] != 12*1024*1024 {
+		t.Errorf("DomainSetMemoryFlags calls = %v, want [%d]", lv.domainSetMemoryFlagsCalls, 12*1024*1024)
+	}
+
+	// Raising a maximum only takes effect on the next boot
+	lv, sm = newApplyMocks(t, stored)
+	desired = testVMConfig()
+	desired.Spec.MaxVCPUs = 16
+	desired.Spec.MaxMemoryGiB = 16
+	result, err = applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+	want := SpecChange{Field: "spec.maxVCPUs", From: "8", To: "16", Supported: true}
+	if len(result.Changes) != 1 || result.Changes[0] != want {
+		t.Errorf("Changes = %v, want %v", result.Changes, want)
+	}
+	if !result.RestartRequired {
+		t.Error("expected RestartRequired for a maximum change")
+	}
+}
+
+func TestApplyWithDeps_HostDevices(t *testing.T) {
+	stored := testVMConfig()
+	lv, sm := newApplyMocks(t, stored)
+
+	desired := testVMConfig()
+	desired.Spec.HostDevices = []v1alpha1.HostDeviceSpec{
+		{PCIAddress: "0000:41:00.0"},
+		{MdevUUID: "4b20d080-1b54-4048-85b3-a6a62d165c01"},
+	}
+
+	result, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+	want := SpecChange{Field: "spec.hostDevices", From: "none", To: "0000:41:00.0, mdev 4b20d080-1b54-4048-85b3-a6a62d165c01", Supported: true}
+	if len(result.Changes) != 1 || result.Changes[0] != want {
+		t.Errorf("Changes = %v, want %v", result.Changes, want)
+	}
+	if !result.RestartRequired {
+		t.Error("expected RestartRequired for a running VM")
+	}
+	if len(lv.domainDefineXMLCalls) != 1 || !strings.Contains(lv.domainDefineXMLCalls[0], "<hostdev") {
+		t.Errorf("expected domain to be redefined with host devices, got %v", lv.domainDefineXMLCalls)
+	}
+}
+
+func TestApplyWithDeps_Graphics(t *testing.T) {
+	stored := testVMConfig()
+	lv, sm := newApplyMocks(t, stored)
+
+	desired := testVMConfig()
+	desired.Spec.Graphics = &v1alpha1.GraphicsSpec{Type: v1alpha1.GraphicsTypeVNC, Password: "s3cret"}
+
+	result, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+	want := SpecChange{Field: "spec.graphics", From: "none", To: "vnc on 127.0.0.1:auto with password", Supported: true}
+	if len(result.Changes) != 1 || result.Changes[0] != want {
+		t.Errorf("Changes = %v, want %v", result.Changes, want)
+	}
+	if !result.RestartRequired {
+		t.Error("expected RestartRequired for a running VM")
+	}
+	if len(lv.domainDefineXMLCalls) != 1 || !strings.Contains(lv.domainDefineXMLCalls[0], "<graphics type=\"vnc\"") {
+		t.Errorf("expected domain to be redefined with a VNC display, got %v", lv.domainDefineXMLCalls)
+	}
+}
+
+func TestApplyWithDeps_SMBIOS(t *testing.T) {
+	stored := testVMConfig()
+	lv, sm := newApplyMocks(t, stored)
+
+	desired := testVMConfig()
+	desired.Spec.SMBIOS = &v1alpha1.SMBIOSSpec{Serial: "SN-1234"}
+
+	result, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+	if len(result.Changes) != 1 || result.Changes[0].Field != "spec.smbios" {
+		t.Errorf("Changes = %v, want spec.smbios", result.Changes)
+	}
+	if !result.RestartRequired {
+		t.Error("expected RestartRequired for a running VM")
+	}
+	if len(lv.domainDefineXMLCalls) != 1 || !strings.Contains(lv.domainDefineXMLCalls[0], "SN-1234") {
+		t.Errorf("expected domain to be redefined with the serial, got %v", lv.domainDefineXMLCalls)
+	}
+}
+
+func TestApplyWithDeps_OSVariant(t *testing.T) {
+	stored := testVMConfig()
+	stored.Spec.OSVariant = "fedora42"
+	lv, sm := newApplyMocks(t, stored)
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		return `<domain type="kvm"><name>test-vm</name><metadata>` +
+			`<foundry:metadata xmlns:foundry="http://foundry.cofront.xyz/v1alpha1">spec</foundry:metadata>` +
+			`<libosinfo:libosinfo xmlns:libosinfo="http://libosinfo.org/xmlns/libvirt/domain/1.0"><libosinfo:os id="http://fedoraproject.org/fedora/42"/></libosinfo:libosinfo>` +
+			`</metadata></domain>`, nil
+	}
+
+	desired := testVMConfig()
+	desired.Spec.OSVariant = "fedora43"
+
+	result, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+	want := SpecChange{Field: "spec.osVariant", From: "fedora42", To: "fedora43", Supported: true}
+	if len(result.Changes) != 1 || result.Changes[0] != want {
+		t.Errorf("Changes = %v, want %v", result.Changes, want)
+	}
+	if len(lv.domainDefineXMLCalls) != 1 {
+		t.Fatalf("expected domain to be redefined, got %v", lv.domainDefineXMLCalls)
+	}
+	defined := lv.domainDefineXMLCalls[0]
+	if !strings.Contains(defined, "fedora/43") || strings.Contains(defined, "fedora/42") || !strings.Contains(defined, "foundry:metadata") {
+		t.Errorf("redefined domain = %s, want the new OS variant and the foundry metadata kept", defined)
+	}
+}
+
+func TestApplyWithDeps_DiskTuning(t *testing.T) {
+	stored := testVMConfig()
+	stored.Spec.DataDisks = []v1alpha1.DataDiskSpec{{Device: "vdb", SizeGB: 10}}
+	lv, sm := newApplyMocks(t, stored)
+
+	desired := testVMConfig()
+	desired.Spec.IOThreads = 1
+	desired.Spec.BootDisk.Cache = "writeback"
+	desired.Spec.DataDisks = []v1alpha1.DataDiskSpec{{Device: "vdb", SizeGB: 10, DiskTuningSpec: v1alpha1.DiskTuningSpec{Bus: "scsi"}}}
+
+	result, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+	want := []SpecChange{
+		{Field: "spec.ioThreads", From: "0", To: "1", Supported: true},
+		{Field: "spec.bootDisk", From: "bus=virtio cache=none io=default discard=default ioThread=0", To: "bus=virtio cache=writeback io=default discard=default ioThread=0", Supported: true},
+		{Field: "spec.dataDisks[vdb]", From: "bus=virtio cache=none io=default discard=default ioThread=0", To: "bus=scsi cache=none io=default discard=default ioThread=0", Supported: true},
+	}
+	if !reflect.DeepEqual(result.Changes, want) {
+		t.Errorf("Changes = %v, want %v", result.Changes, want)
+	}
+	if len(lv.domainDefineXMLCalls) != 1 {
+		t.Fatalf("expected domain to be redefined, got %v", lv.domainDefineXMLCalls)
+	}
+	defined := lv.domainDefineXMLCalls[0]
+	if !strings.Contains(defined, `cache="writeback"`) || !strings.Contains(defined, `bus="scsi"`) || !strings.Contains(defined, "<iothreads>1</iothreads>") {
+		t.Errorf("redefined domain = %s, want the new disk options", defined)
+	}
+}
+
+func TestApplyWithDeps_UnsupportedChanges(t *testing.T) {
+	stored := testVMConfig()
+	lv, sm := newApplyMocks(t, stored)
+
+	desired := testVMConfig()
+	desired.Spec.VCPUs = 4
+	desired.Spec.BootDisk.SizeGB = 40
+	desired.Spec.NetworkInterfaces[0].IP = "10.0.0.11/24"
+
+	_, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv))
+	if err == nil {
+		t.Fatal("expected error for unsupported changes")
+	}
+	for _, field := range []string{"spec.bootDisk", "spec.networkInterfaces"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("error %q does not mention %s", err, field)
+		}
+	}
+	if len(lv.domainDefineXMLCalls) != 0 || len(lv.domainSetMetadataCalls) != 0 {
+		t.Error("nothing must be changed when unsupported changes are present")
+	}
+}
+
+func TestApplyWithDeps_FirmwareChangeUnsupported(t *testing.T) {
+	stored := testVMConfig()
+	lv, sm := newApplyMocks(t, stored)
+
+	desired := testVMConfig()
+	desired.Spec.Firmware = "bios"
+
+	_, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "spec.firmware") {
+		t.Fatalf("applyWithDeps() error = %v, want spec.firmware change rejected", err)
+	}
+	if len(lv.domainDefineXMLCalls) != 0 {
+		t.Error("domain must not be redefined")
+	}
+}
+
+func TestApplyWithDeps_RefusesExternalSnapshots(t *testing.T) {
+	stored := testVMConfig()
+	lv, sm := newApplyMocks(t, stored)
+	lv.domainSnapshotNumFunc = func(dom libvirt.Domain, flags uint32) (int32, error) {
+		if flags&uint32(libvirt.DomainSnapshotListExternal) == 0 {
+			t.Errorf("expected external snapshots to be counted, flags = %d", flags)
+		}
+		return 1, nil
+	}
+
+	desired := testVMConfig()
+	desired.Spec.VCPUs = 4
+
+	_, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "external snapshot") {
+		t.Fatalf("applyWithDeps() error = %v, want external snapshot error", err)
+	}
+	if len(lv.domainDefineXMLCalls) != 0 {
+		t.Error("domain must not be redefined while external snapshots exist")
+	}
+}
+
+func TestDiffSpec_DataDiskResizeUnsupported(t *testing.T) {
+	current := testVMConfigWithDataDisks()
+	desired := testVMConfigWithDataDisks()
+	desired.Spec.DataDisks[0].SizeGB = 60
+
+	changes := diffSpec(current, desired)
+	if len(changes) != 1 {
+		t.Fatalf("changes = %v, want 1", changes)
+	}
+	if changes[0].Supported {
+		t.Error("resizing a data disk must not be supported by apply")
+	}
+	if changes[0].Field != "spec.dataDisks[vdb].sizeGB" {
+		t.Errorf("Field = %q", changes[0].Field)
+	}
+}
+
+func TestDiffSpec_ReapSettingsSupported(t *testing.T) {
+	current := testVMConfig()
+	desired := testVMConfig()
+	desired.Spec.TTL = &v1alpha1.Duration{Duration: 2 * time.Hour}
+	desired.Spec.Ephemeral = true
+
+	changes := diffSpec(current, desired)
+	if len(changes) != 2 {
+		t.Fatalf("changes = %v, want 2", changes)
+	}
+	for _, change := range changes {
+		if !change.Supported {
+			t.Errorf("change %s must be supported", change)
+		}
+	}
+	if got := changes[0].String(); got != "spec.ttl: none -> 2h0m0s" {
+		t.Errorf("changes[0] = %q", got)
+	}
+}
+
+func TestDiffSpec_MemoryUnits(t *testing.T) {
+	current := testVMConfig() // 2 GiB
+
+	// Same size in another unit is not a change
+	desired := testVMConfig()
+	desired.Spec.MemoryGiB = 0
+	desired.Spec.MemoryMiB = 2048
+	if changes := diffSpec(current, desired); len(changes) != 0 {
+		t.Errorf("changes = %v, want none", changes)
+	}
+
+	desired.Spec.MemoryMiB = 1536
+	changes := diffSpec(current, desired)
+	if len(changes) != 1 {
+		t.Fatalf("changes = %v, want 1", changes)
+	}
+	if got := changes[0].String(); got != "spec.memoryMiB: 2048 -> 1536" {
+		t.Errorf("changes[0] = %q", got)
+	}
+	if !changes[0].Supported {
+		t.Error("memory change must be supported")
+	}
+}
+
+func TestApplyWithDeps_RejectsGenerateName(t *testing.T) {
+	desired := testVMConfig()
+	desired.Name = ""
+	desired.GenerateName = "ci-"
+	lv, sm := newApplyMocks(t, testVMConfig())
+
+	_, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "generateName cannot be used with apply") {
+		t.Fatalf("expected generateName error, got: %v", err)
+	}
+	if len(sm.createVolumeCalls) > 0 {
+		t.Error("expected no volumes to be created")
+	}
+}
+
+func TestApplyWithDeps_DHCPKeepsGeneratedMAC(t *testing.T) {
+	stored := testVMConfig()
+	stored.Spec.NetworkInterfaces = []v1alpha1.NetworkInterfaceSpec{{Bridge: "br0", DHCP: true, MACAddress: "be:ee:12:34:56:78"}}
+	lv, sm := newApplyMocks(t, stored)
+
+	desired := testVMConfig()
+	desired.Spec.NetworkInterfaces = []v1alpha1.NetworkInterfaceSpec{{Bridge: "br0", DHCP: true}}
+
+	result, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+	if len(result.Changes) != 0 {
+		t.Errorf("expected no changes, got %v", result.Changes)
+	}
+	if got := desired.Spec.NetworkInterfaces[0].MACAddress; got != "be:ee:12:34:56:78" {
+		t.Errorf("MACAddress = %q, want the stored one", got)
+	}
+}
+
+func TestApplyWithDeps_SRIOVKeepsVFAddress(t *testing.T) {
+	stored := testVMConfig()
+	stored.Spec.NetworkInterfaces[0].Bridge = ""
+	stored.Spec.NetworkInterfaces[0].SRIOV = &v1alpha1.SRIOVSpec{PF: "enp1s0f0", VF: 2, PCIAddress: "0000:01:10.4"}
+	lv, sm := newApplyMocks(t, stored)
+
+	desired := testVMConfig()
+	desired.Spec.NetworkInterfaces[0].Bridge = ""
+	desired.Spec.NetworkInterfaces[0].SRIOV = &v1alpha1.SRIOVSpec{PF: "enp1s0f0", VF: 2}
+
+	result, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+	if len(result.Changes) != 0 {
+		t.Errorf("expected no changes, got %v", result.Changes)
+	}
+
+	// Another VF is a changed interface
+	desired = testVMConfig()
+	desired.Spec.NetworkInterfaces[0].Bridge = ""
+	desired.Spec.NetworkInterfaces[0].SRIOV = &v1alpha1.SRIOVSpec{PF: "enp1s0f0", VF: 3}
+	if _, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv)); err == nil || !strings.Contains(err.Error(), "spec.networkInterfaces") {
+		t.Errorf("applyWithDeps() error = %v, want an unsupported interface change", err)
+	}
+}
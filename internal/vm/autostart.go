@@ -0,0 +1,170 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// AutostartResult describes what StartOrdered did with a VM.
+type AutostartResult struct {
+	// Name is the name of the VM.
+	Name string
+
+	// Order is the VM's spec.startupOrder.
+	Order int
+
+	// Started is true if the VM was started, false if it was already running.
+	Started bool
+
+	// Err is set if the VM could not be started.
+	Err error
+}
+
+// StartOrdered starts the autostart VMs that have a spec.startupOrder, in
+// ascending order. VMs with the same order are started together; once they
+// are, the longest spec.startupDelay among them is waited out before the next
+// order is started. VMs that are already running are left alone, and a VM
+// that fails to start does not hold up the others.
+//
+// libvirt does not autostart these VMs itself, so this is meant to run once
+// the host has booted, e.g. from the unit written by 'foundry autostart
+// --install-unit'.
+func StartOrdered(ctx context.Context) ([]AutostartResult, error) {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	return startOrderedWithDeps(ctx, LibvirtClient.Libvirt(), storageMgr, metaClient, sleepContext)
+}
+
+// startOrderedWithDeps starts ordered VMs with injected dependencies, using
+// wait to wait out startup delays.
+func startOrderedWithDeps(ctx context.Context, lv LibvirtClient, sm storageManager, mc *metadata.Client, wait func(context.Context, time.Duration) error) ([]AutostartResult, error) {
+	domains, _, err := lv.ConnectListAllDomains(1, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domains: %w", err)
+	}
+
+	var vms []orderedVM
+	for _, domain := range domains {
+		vm, err := mc.Load(domain)
+		if err != nil {
+			continue
+		}
+		// Stopped ephemeral VMs are left for the reaper
+		if autostartEnabled(vm) && vm.Spec.StartupOrder > 0 && !vm.Spec.Ephemeral {
+			vms = append(vms, orderedVM{vm: vm, domain: domain})
+		}
+	}
+	sort.SliceStable(vms, func(i, j int) bool {
+		if vms[i].vm.Spec.StartupOrder != vms[j].vm.Spec.StartupOrder {
+			return vms[i].vm.Spec.StartupOrder < vms[j].vm.Spec.StartupOrder
+		}
+		return vms[i].vm.Name < vms[j].vm.Name
+	})
+
+	var (
+		results []AutostartResult
+		errs    []error
+	)
+	for start := 0; start < len(vms); {
+		order := vms[start].vm.Spec.StartupOrder
+		end := start
+		for end < len(vms) && vms[end].vm.Spec.StartupOrder == order {
+			end++
+		}
+
+		var delay time.Duration
+		for _, ordered := range vms[start:end] {
+			vm := ordered.vm
+			result := startVM(ctx, lv, sm, ordered.domain, vm)
+			if result.Err != nil {
+				errs = append(errs, fmt.Errorf("VM '%s': %w", vm.Name, result.Err))
+			}
+			if result.Started && vm.Spec.StartupDelay != nil && vm.Spec.StartupDelay.Duration > delay {
+				delay = vm.Spec.StartupDelay.Duration
+			}
+			results = append(results, result)
+		}
+		start = end
+
+		if delay > 0 && start < len(vms) {
+			logging.FromContext(ctx).Info("Waiting before starting VMs with a higher startup order", "delay", delay, "order", order)
+			if err := wait(ctx, delay); err != nil {
+				return results, err
+			}
+		}
+	}
+
+	return results, errors.Join(errs...)
+}
+
+// orderedVM is a VM started by StartOrdered and its domain.
+type orderedVM struct {
+	vm     *v1alpha1.VirtualMachine
+	domain libvirt.Domain
+}
+
+// startVM starts the VM's domain unless it is already running.
+func startVM(ctx context.Context, lv LibvirtClient, sm storageManager, domain libvirt.Domain, vm *v1alpha1.VirtualMachine) AutostartResult {
+	result := AutostartResult{Name: vm.Name, Order: vm.Spec.StartupOrder}
+
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to get state: %w", err)
+		return result
+	}
+	if state == domainStateRunning {
+		return result
+	}
+
+	if err := verifyBootImage(ctx, vm, sm); err != nil {
+		result.Err = err
+		return result
+	}
+
+	logging.FromContext(ctx).Info("Starting VM", "vm", vm.Name, "startupOrder", vm.Spec.StartupOrder)
+	if err := lv.DomainCreate(domain); err != nil {
+		result.Err = fmt.Errorf("failed to start: %w", err)
+		return result
+	}
+	result.Started = true
+	return result
+}
+
+// sleepContext waits for d, or until ctx is cancelled.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,169 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+// newOrderedMocks returns a libvirt mock whose domains are vms, all shut off
+// and with their specs stored. Started domains are recorded in started.
+func newOrderedMocks(t *testing.T, vms ...*v1alpha1.VirtualMachine) (*mockLibvirtClient, *[]string) {
+	t.Helper()
+
+	stored := make(map[string]string)
+	var domains []libvirt.Domain
+	for _, vm := range vms {
+		stored[vm.Name] = storedMetadataXML(t, vm)
+		domains = append(domains, libvirt.Domain{Name: vm.Name})
+	}
+	domains = append(domains, libvirt.Domain{Name: "foreign"})
+
+	var started []string
+	lv := newMockLibvirtClient()
+	lv.connectListAllDomainsFunc = func(needResults int32, flags libvirt.ConnectListAllDomainsFlags) ([]libvirt.Domain, uint32, error) {
+		return domains, uint32(len(domains)), nil
+	}
+	lv.domainGetMetadataFunc = func(dom libvirt.Domain, typ int32, uri libvirt.OptString, flags libvirt.DomainModificationImpact) (string, error) {
+		if md, ok := stored[dom.Name]; ok {
+			return md, nil
+		}
+		return "", errors.New("metadata not found")
+	}
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateShutoff, 0, nil
+	}
+	lv.domainCreateFunc = func(dom libvirt.Domain) error {
+		started = append(started, dom.Name)
+		return nil
+	}
+	return lv, &started
+}
+
+// orderedTestVM returns a VM named name with the given startup order and delay.
+func orderedTestVM(name string, order int, delay time.Duration) *v1alpha1.VirtualMachine {
+	vm := testVMConfig()
+	vm.Name = name
+	vm.Spec.StartupOrder = order
+	if delay > 0 {
+		vm.Spec.StartupDelay = &v1alpha1.Duration{Duration: delay}
+	}
+	return vm
+}
+
+func TestStartOrderedWithDeps(t *testing.T) {
+	disabled := false
+	noAutostart := orderedTestVM("no-autostart", 1, 0)
+	noAutostart.Spec.Autostart = &disabled
+	ephemeral := orderedTestVM("ephemeral", 1, 0)
+	ephemeral.Spec.Ephemeral = true
+
+	lv, started := newOrderedMocks(t,
+		orderedTestVM("app", 20, 0),
+		orderedTestVM("db", 10, 30*time.Second),
+		orderedTestVM("cache", 10, 10*time.Second),
+		orderedTestVM("unordered", 0, 0),
+		orderedTestVM("web", 30, time.Minute),
+		noAutostart,
+		ephemeral,
+	)
+
+	var waits []string
+	wait := func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d.String()+" after "+(*started)[len(*started)-1])
+		return nil
+	}
+
+	results, err := startOrderedWithDeps(context.Background(), lv, newMockStorageManager(), newMockMetadataClient(lv), wait)
+	if err != nil {
+		t.Fatalf("startOrderedWithDeps() error = %v", err)
+	}
+
+	if want := []string{"cache", "db", "app", "web"}; !reflect.DeepEqual(*started, want) {
+		t.Errorf("started = %v, want %v", *started, want)
+	}
+	// The longest delay of an order is waited out; nothing waits on the last order
+	if want := []string{"30s after db"}; !reflect.DeepEqual(waits, want) {
+		t.Errorf("waits = %v, want %v", waits, want)
+	}
+	if len(results) != 4 || !results[0].Started || results[0].Order != 10 {
+		t.Errorf("results = %+v", results)
+	}
+}
+
+func TestStartOrderedWithDeps_AlreadyRunning(t *testing.T) {
+	lv, started := newOrderedMocks(t, orderedTestVM("db", 10, time.Minute), orderedTestVM("app", 20, 0))
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		if dom.Name == "db" {
+			return domainStateRunning, 0, nil
+		}
+		return domainStateShutoff, 0, nil
+	}
+
+	wait := func(ctx context.Context, d time.Duration) error {
+		t.Errorf("unexpected wait of %v for a VM that was already running", d)
+		return nil
+	}
+
+	results, err := startOrderedWithDeps(context.Background(), lv, newMockStorageManager(), newMockMetadataClient(lv), wait)
+	if err != nil {
+		t.Fatalf("startOrderedWithDeps() error = %v", err)
+	}
+	if !reflect.DeepEqual(*started, []string{"app"}) {
+		t.Errorf("started = %v, want [app]", *started)
+	}
+	if results[0].Name != "db" || results[0].Started {
+		t.Errorf("db result = %+v, want not started", results[0])
+	}
+}
+
+func TestStartOrderedWithDeps_ContinuesOnError(t *testing.T) {
+	lv, started := newOrderedMocks(t, orderedTestVM("db", 10, 0), orderedTestVM("app", 20, 0))
+	lv.domainCreateFunc = func(dom libvirt.Domain) error {
+		if dom.Name == "db" {
+			return errors.New("start failed")
+		}
+		*started = append(*started, dom.Name)
+		return nil
+	}
+
+	results, err := startOrderedWithDeps(context.Background(), lv, newMockStorageManager(), newMockMetadataClient(lv), sleepContext)
+	if err == nil {
+		t.Fatal("expected error for the VM that failed to start")
+	}
+	if !reflect.DeepEqual(*started, []string{"app"}) {
+		t.Errorf("started = %v, want [app]", *started)
+	}
+	if results[0].Err == nil {
+		t.Errorf("db result = %+v, want error", results[0])
+	}
+}
+
+func TestLibvirtAutostart(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		name string
+		vm   *v1alpha1.VirtualMachine
+		want bool
+	}{
+		{name: "default", vm: orderedTestVM("vm", 0, 0), want: true},
+		{name: "ordered", vm: orderedTestVM("vm", 10, 0), want: false},
+		{name: "disabled", vm: func() *v1alpha1.VirtualMachine {
+			vm := orderedTestVM("vm", 0, 0)
+			vm.Spec.Autostart = &disabled
+			return vm
+		}(), want: false},
+	}
+
+	for _, tt := range tests {
+		if got := libvirtAutostart(tt.vm); got != tt.want {
+			t.Errorf("%s: libvirtAutostart() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
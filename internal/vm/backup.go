@@ -0,0 +1,615 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"go.yaml.in/yaml/v3"
+	"libvirt.org/go/libvirtxml"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/backup"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// backupOverlaySuffix names the overlays that take a running VM's writes
+// while its volumes are backed up.
+const backupOverlaySuffix = ".backup"
+
+// BackupOptions controls how BackupVM backs up a VM.
+type BackupOptions struct {
+	Dir       string // Directory holding the backups
+	Full      bool   // Take a full backup even if an incremental one is possible
+	FullEvery int    // Take a full backup once the latest chain has this many backups (0 never forces one)
+	Keep      int    // Then delete all but the newest Keep backups and their parents (0 keeps all)
+}
+
+// BackupResult describes a backup taken by BackupVM.
+type BackupResult struct {
+	Manifest *backup.Manifest // The new backup
+	Live     bool             // The VM was running and its disks were frozen with a snapshot
+	Pruned   []string         // IDs of the backups deleted by retention
+}
+
+// BackupVM backs up a VM's spec (see ExportSpec), its inactive domain XML and
+// its volumes (boot, data disks and cloud-init ISO) into opts.Dir, see the
+// backup package for the layout.
+//
+// The backup is incremental, storing only the disk blocks that changed since
+// the VM's latest backup, unless opts.Full is set, the VM has no backup yet
+// or the latest backup's chain has opts.FullEvery backups. Disk images are
+// stored flattened, so backups do not depend on the VM's base image.
+//
+// A running VM keeps running: its disks are switched to temporary overlays
+// with an external snapshot (quiesced through the guest agent when the VM has
+// one), the frozen volumes are copied, and the overlays are committed back
+// into the volumes.
+func BackupVM(ctx context.Context, vmName string, opts BackupOptions) (*BackupResult, error) {
+	logger := logging.FromContext(ctx)
+
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("a backup directory is required")
+	}
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	return backupVMWithDeps(ctx, vmName, opts, backup.NewRepository(opts.Dir), LibvirtClient.Libvirt(), storageMgr, metaClient)
+}
+
+// BackupAnnotated backs up every VM annotated with v1alpha1.AnnotationBackup
+// set to "true", like BackupVM. VMs that cannot be backed up are skipped and
+// reported in the returned error; the others are still backed up.
+func BackupAnnotated(ctx context.Context, opts BackupOptions) ([]BackupResult, error) {
+	logger := logging.FromContext(ctx)
+
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("a backup directory is required")
+	}
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	return backupAnnotatedWithDeps(ctx, opts, backup.NewRepository(opts.Dir), LibvirtClient.Libvirt(), storageMgr, metaClient)
+}
+
+// backupAnnotatedWithDeps backs up the annotated VMs with injected
+// dependencies.
+func backupAnnotatedWithDeps(ctx context.Context, opts BackupOptions, repo *backup.Repository, lv LibvirtClient, sm storageManager, mc *metadata.Client) ([]BackupResult, error) {
+	vms, err := listVMsWithDeps(ctx, lv)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		results []BackupResult
+		errs    []error
+	)
+	for _, vm := range vms {
+		if vm.Annotations[v1alpha1.AnnotationBackup] != "true" {
+			continue
+		}
+		result, err := backupVMWithDeps(ctx, vm.Name, opts, repo, lv, sm, mc)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to back up VM '%s': %w", vm.Name, err))
+			continue
+		}
+		results = append(results, *result)
+	}
+	return results, errors.Join(errs...)
+}
+
+// backupVMWithDeps backs up a VM with injected dependencies.
+// This allows for testing by accepting interfaces instead of concrete types.
+func backupVMWithDeps(ctx context.Context, vmName string, opts BackupOptions, repo *backup.Repository, lv LibvirtClient, sm storageManager, mc *metadata.Client) (result *BackupResult, err error) {
+	logger := logging.FromContext(ctx)
+
+	// Step 1: Look up the domain and its stored spec
+	domain, err := lv.DomainLookupByName(vmName)
+	if err != nil {
+		return nil, fmt.Errorf("VM '%s' not found: %w", vmName, err)
+	}
+
+	vm, err := mc.Load(domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", vmName, err)
+	}
+	spec, err := ExportSpec(vm)
+	if err != nil {
+		return nil, err
+	}
+	specData, err := yaml.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal spec: %w", err)
+	}
+
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VM state: %w", err)
+	}
+	var live bool
+	switch state {
+	case domainStateShutoff, domainStateCrashed:
+	case domainStateRunning, domainStatePaused:
+		live = true
+	default:
+		return nil, fmt.Errorf("VM '%s' cannot be backed up while %s", vmName, stateToString(state))
+	}
+
+	domainXML, err := lv.DomainGetXMLDesc(domain, libvirt.DomainXMLInactive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain XML: %w", err)
+	}
+
+	// Step 2: Back up incrementally on top of the latest backup, unless its
+	// chain is long enough
+	parent, err := backupParent(ctx, repo, vmName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := repo.Create(vmName, parent)
+	if err != nil {
+		return nil, err
+	}
+	defer w.Abort()
+
+	if err := w.WriteFile(ExportSpecFile, specData); err != nil {
+		return nil, err
+	}
+	if err := w.WriteFile(ExportDomainFile, []byte(domainXML)); err != nil {
+		return nil, err
+	}
+
+	// Step 3: Freeze the disks of a running VM; the overlays are committed
+	// back even if the backup fails
+	pool := getStoragePool(vm)
+	disks := backupDisks(ctx, vm, sm)
+	if live {
+		thaw, err := freezeDisks(ctx, w.ID(), domain, vm, domainXML, disks, lv, sm)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if thawErr := thaw(); thawErr != nil {
+				result = nil
+				err = errors.Join(err, thawErr)
+			}
+		}()
+	}
+
+	// Step 4: Copy the volumes
+	for _, disk := range disks {
+		logger.Info("Backing up volume", "vm", vmName, "volume", disk.Volume)
+		err := pipeVolume(
+			func(dst io.Writer) error { return sm.ExportVolume(ctx, pool, disk.Volume, dst) },
+			func(src io.Reader) error { return w.WriteDisk(disk.Device, disk.Volume, disk.Format, src) },
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to back up volume %s: %w", disk.Volume, err)
+		}
+	}
+
+	manifest, err := w.Commit()
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("VM backed up", "vm", vmName, "kind", manifest.Kind, "backup", manifest.ID)
+
+	// Step 5: Apply the retention policy
+	result = &BackupResult{Manifest: manifest, Live: live}
+	if opts.Keep > 0 {
+		pruned, err := repo.Prune(vmName, opts.Keep)
+		result.Pruned = pruned
+		if err != nil {
+			logger.Warn("Failed to prune backups", "vm", vmName, "error", err)
+		}
+	}
+	return result, nil
+}
+
+// backupParent returns the backup a new backup of a VM is an increment of, or
+// nil for a full backup.
+func backupParent(ctx context.Context, repo *backup.Repository, vmName string, opts BackupOptions) (*backup.Manifest, error) {
+	if opts.Full {
+		return nil, nil
+	}
+
+	manifests, err := repo.List(vmName)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifests) == 0 {
+		return nil, nil
+	}
+
+	latest := &manifests[len(manifests)-1]
+	chain, err := repo.Chain(latest)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Taking a full backup, the latest backup is unusable", "vm", vmName, "error", err)
+		return nil, nil
+	}
+	if opts.FullEvery > 0 && len(chain) >= opts.FullEvery {
+		return nil, nil
+	}
+	return latest, nil
+}
+
+// backupDisks returns the volumes of a VM to back up: the boot and data
+// disks, and the cloud-init ISO if it has one.
+func backupDisks(ctx context.Context, vm *v1alpha1.VirtualMachine, sm storageManager) []backup.Disk {
+	format := string(getDiskFormat(vm))
+	disks := []backup.Disk{{Device: "vda", Volume: getBootVolumeName(vm), Format: format}}
+	for _, disk := range vm.Spec.DataDisks {
+		disks = append(disks, backup.Disk{Device: disk.Device, Volume: getDataVolumeName(vm, disk.Device), Format: format})
+	}
+	if exists, err := sm.VolumeExists(ctx, getStoragePool(vm), getCloudInitVolumeName(vm)); err == nil && exists {
+		disks = append(disks, backup.Disk{Volume: getCloudInitVolumeName(vm), Format: string(storage.VolumeFormatRaw)})
+	}
+	return disks
+}
+
+// freezeDisks switches the backed up disks of a running VM to overlays with
+// an external disk-only snapshot, so their volumes stop changing. The
+// returned function commits the overlays back into the volumes, restores the
+// persistent definition to domainXML and deletes the overlays.
+func freezeDisks(ctx context.Context, id string, domain libvirt.Domain, vm *v1alpha1.VirtualMachine, domainXML string, disks []backup.Disk, lv LibvirtClient, sm storageManager) (func() error, error) {
+	logger := logging.FromContext(ctx)
+
+	liveXML, err := lv.DomainGetXMLDesc(domain, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain XML: %w", err)
+	}
+	var domDef libvirtxml.Domain
+	if err := domDef.Unmarshal(liveXML); err != nil {
+		return nil, fmt.Errorf("failed to parse domain XML: %w", err)
+	}
+
+	// The snapshot lists every disk: an overlay next to each backed up
+	// volume, nothing for the others
+	pool := getStoragePool(vm)
+	volumes := make(map[string]string)
+	for _, disk := range disks {
+		if disk.Device != "" {
+			volumes[disk.Device] = disk.Volume
+		}
+	}
+	snap := libvirtxml.DomainSnapshot{
+		Name:        "foundry-backup-" + id,
+		Description: "Temporary snapshot for backup " + id,
+		Disks:       &libvirtxml.DomainSnapshotDisks{},
+	}
+	var frozen []string
+	if domDef.Devices != nil {
+		for _, disk := range domDef.Devices.Disks {
+			target := diskTarget(disk)
+			volume, ok := volumes[target]
+			if !ok {
+				snap.Disks.Disks = append(snap.Disks.Disks, libvirtxml.DomainSnapshotDisk{Name: target, Snapshot: "no"})
+				continue
+			}
+			volumePath, err := sm.GetVolumePath(ctx, pool, volume)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get path of disk %s: %w", target, err)
+			}
+			snap.Disks.Disks = append(snap.Disks.Disks, libvirtxml.DomainSnapshotDisk{
+				Name:     target,
+				Snapshot: "external",
+				Driver:   &libvirtxml.DomainDiskDriver{Type: "qcow2"},
+				Source: &libvirtxml.DomainDiskSource{
+					File: &libvirtxml.DomainDiskSourceFile{File: filepath.Join(filepath.Dir(volumePath), volume+backupOverlaySuffix)},
+				},
+			})
+			frozen = append(frozen, target)
+		}
+	}
+	snapXML, err := snap.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate snapshot XML: %w", err)
+	}
+
+	// Quiesce through the guest agent when the VM has one
+	flags := uint32(libvirt.DomainSnapshotCreateDiskOnly | libvirt.DomainSnapshotCreateAtomic | libvirt.DomainSnapshotCreateNoMetadata)
+	logger.Info("Freezing disks", "vm", vm.Name)
+	if vm.IsGuestAgent() {
+		_, err = lv.DomainSnapshotCreateXML(domain, snapXML, flags|uint32(libvirt.DomainSnapshotCreateQuiesce))
+		if err != nil {
+			logger.Warn("Failed to quiesce the guest, backing up crash-consistent disks", "vm", vm.Name, "error", err)
+		}
+	}
+	if !vm.IsGuestAgent() || err != nil {
+		if _, err := lv.DomainSnapshotCreateXML(domain, snapXML, flags); err != nil {
+			return nil, fmt.Errorf("failed to freeze disks: %w", err)
+		}
+	}
+
+	thaw := func() error {
+		// Finish even if the backup was cancelled: the VM must not be left
+		// running on the overlays
+		ctx := context.WithoutCancel(ctx)
+		var errs []error
+		for _, device := range frozen {
+			if err := commitOverlay(ctx, lv, domain, device); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("VM '%s' is still running on backup overlays: %w", vm.Name, errors.Join(errs...))
+		}
+
+		// The persistent definition followed the overlays
+		if _, err := lv.DomainDefineXML(domainXML); err != nil {
+			return fmt.Errorf("failed to restore definition of VM '%s': %w", vm.Name, err)
+		}
+
+		// The overlays were created by libvirt, outside the storage API
+		if err := sm.RefreshPool(ctx, pool); err != nil {
+			logger.Warn("Failed to refresh pool", "pool", pool, "error", err)
+		}
+		for _, device := range frozen {
+			overlay := volumes[device] + backupOverlaySuffix
+			if err := sm.DeleteVolume(ctx, pool, overlay); err != nil {
+				logger.Warn("Failed to delete backup overlay", "pool", pool, "volume", overlay, "error", err)
+			}
+		}
+		logger.Info("Disks thawed", "vm", vm.Name)
+		return nil
+	}
+	return thaw, nil
+}
+
+// commitOverlay merges the overlay of a running VM's disk into its backing
+// volume with an active block commit, and pivots the disk back to the volume.
+func commitOverlay(ctx context.Context, lv LibvirtClient, domain libvirt.Domain, device string) error {
+	logger := logging.FromContext(ctx)
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events, err := lv.SubscribeEvents(jobCtx, libvirt.DomainEventIDBlockJob, libvirt.OptDomain{domain})
+	if err != nil {
+		logger.Warn("Failed to subscribe to block job events, falling back to polling", "error", err)
+		events = nil
+	}
+
+	flags := libvirt.DomainBlockCommitActive | libvirt.DomainBlockCommitShallow
+	if err := lv.DomainBlockCommit(domain, device, nil, nil, 0, flags); err != nil {
+		return fmt.Errorf("failed to start block commit on %s: %w", device, err)
+	}
+	if err := waitForBlockJob(ctx, lv, domain, device, libvirt.DomainBlockJobTypeActiveCommit, events, nil); err != nil {
+		return err
+	}
+	if err := lv.DomainBlockJobAbort(domain, device, libvirt.DomainBlockJobAbortPivot); err != nil {
+		return fmt.Errorf("failed to pivot %s back to its volume: %w", device, err)
+	}
+	return nil
+}
+
+// RestoreOptions controls how RestoreVM restores a VM.
+type RestoreOptions struct {
+	Dir   string // Directory holding the backups
+	ID    string // Backup to restore (default the latest)
+	Start bool   // Start the VM once restored
+}
+
+// RestoreVM recreates a VM from a backup in opts.Dir: its volumes are created
+// and filled with the backed up disk images, read through the chain of an
+// incremental backup, and the domain is defined from the backed up domain XML
+// with the backed up spec stored.
+//
+// The VM must not exist, nor any of its volumes: destroy it first.
+func RestoreVM(ctx context.Context, vmName string, opts RestoreOptions) (*backup.Manifest, error) {
+	logger := logging.FromContext(ctx)
+
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("a backup directory is required")
+	}
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	return restoreVMWithDeps(ctx, vmName, opts, backup.NewRepository(opts.Dir), LibvirtClient.Libvirt(), storageMgr, metaClient)
+}
+
+// restoreVMWithDeps restores a VM with injected dependencies.
+// This allows for testing by accepting interfaces instead of concrete types.
+func restoreVMWithDeps(ctx context.Context, vmName string, opts RestoreOptions, repo *backup.Repository, lv LibvirtClient, sm storageManager, mc *metadata.Client) (*backup.Manifest, error) {
+	logger := logging.FromContext(ctx)
+
+	// Step 1: Read the backup
+	manifest, err := repo.Get(vmName, opts.ID)
+	if err != nil {
+		return nil, err
+	}
+	specData, err := repo.ReadFile(manifest, ExportSpecFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spec of backup %s: %w", manifest.ID, err)
+	}
+	vm := &v1alpha1.VirtualMachine{}
+	if err := yaml.Unmarshal(specData, vm); err != nil {
+		return nil, fmt.Errorf("failed to parse spec of backup %s: %w", manifest.ID, err)
+	}
+	domainXML, err := repo.ReadFile(manifest, ExportDomainFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read domain XML of backup %s: %w", manifest.ID, err)
+	}
+
+	// Step 2: Check that nothing is in the way
+	if _, err := lv.DomainLookupByName(vmName); err == nil {
+		return nil, fmt.Errorf("VM '%s' already exists; destroy it before restoring it", vmName)
+	}
+	if err := sm.EnsureDefaultPools(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ensure storage pools: %w", err)
+	}
+	pool := getStoragePool(vm)
+	for _, disk := range manifest.Disks {
+		exists, err := sm.VolumeExists(ctx, pool, disk.Volume)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check volume %s: %w", disk.Volume, err)
+		}
+		if exists {
+			return nil, fmt.Errorf("volume %s/%s already exists; destroy VM '%s' before restoring it", pool, disk.Volume, vmName)
+		}
+	}
+
+	// Step 3: Recreate the volumes, removing them again on failure
+	var created []string
+	cleanup := func() {
+		for _, volume := range created {
+			if err := sm.DeleteVolume(ctx, pool, volume); err != nil {
+				logger.Warn("Failed to delete restored volume", "pool", pool, "volume", volume, "error", err)
+			}
+		}
+	}
+	for _, disk := range manifest.Disks {
+		spec, err := restoredVolumeSpec(vm, disk)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+
+		logger.Info("Restoring volume", "vm", vmName, "volume", disk.Volume)
+		if err := sm.CreateVolume(ctx, pool, spec); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("failed to create volume %s: %w", disk.Volume, err)
+		}
+		created = append(created, disk.Volume)
+
+		err = pipeVolume(
+			func(dst io.Writer) error { return repo.ReadDisk(manifest, disk.Volume, dst) },
+			func(src io.Reader) error { return sm.UploadVolume(ctx, pool, disk.Volume, src, uint64(disk.Size)) },
+		)
+		if err != nil {
+			cleanup()
+			return nil, fmt.Errorf("failed to restore volume %s: %w", disk.Volume, err)
+		}
+	}
+
+	// Step 4: Define the domain and store the spec
+	logger.Info("Defining domain", "vm", vmName)
+	domain, err := lv.DomainDefineXML(string(domainXML))
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to define domain: %w", err)
+	}
+
+	autostart := int32(0)
+	if libvirtAutostart(vm) {
+		autostart = 1
+	}
+	if err := lv.DomainSetAutostart(domain, autostart); err != nil {
+		logger.Warn("Failed to set autostart", "vm", vmName, "error", err)
+	}
+
+	if vm.CreationTimestamp.IsZero() {
+		vm.CreationTimestamp = v1alpha1.Time{Time: time.Now()}
+	}
+	vm.UpdateObservedGeneration()
+	if err := mc.Store(domain, vm); err != nil {
+		return nil, fmt.Errorf("domain defined but failed to store VM metadata: %w", err)
+	}
+
+	// Step 5: Start it if asked to
+	if opts.Start {
+		logger.Info("Starting VM", "vm", vmName)
+		if err := lv.DomainCreate(domain); err != nil {
+			return nil, fmt.Errorf("VM restored but failed to start: %w", err)
+		}
+	}
+
+	logger.Info("VM restored", "vm", vmName, "backup", manifest.ID)
+	return manifest, nil
+}
+
+// restoredVolumeSpec returns the spec of the volume to restore a backed up
+// disk into. Disk images hold their own size, so the capacity only has to be
+// valid.
+func restoredVolumeSpec(vm *v1alpha1.VirtualMachine, disk backup.Disk) (storage.VolumeSpec, error) {
+	spec := storage.VolumeSpec{
+		Name:   disk.Volume,
+		Format: storage.VolumeFormat(disk.Format),
+	}
+
+	if disk.Device == "" {
+		spec.Type = storage.VolumeTypeCloudInit
+		spec.CapacityGB = cloudInitCapacityGB(int(disk.Size))
+		return spec, nil
+	}
+
+	sizeGB, _, _, err := diskSpecForDevice(vm, disk.Device)
+	if err != nil {
+		return spec, err
+	}
+	spec.Type = storage.VolumeTypeData
+	if disk.Device == "vda" {
+		spec.Type = storage.VolumeTypeBoot
+	}
+	spec.CapacityGB = uint64(max(sizeGB, 1))
+	return spec, nil
+}
+
+// pipeVolume streams the data written by write to read, and returns the
+// first error of either.
+func pipeVolume(write func(io.Writer) error, read func(io.Reader) error) error {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := write(pw)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	readErr := read(pr)
+	// Unblock the writer if the reader stopped early
+	pr.CloseWithError(readErr)
+	writeErr := <-done
+
+	if readErr != nil {
+		return readErr
+	}
+	return writeErr
+}
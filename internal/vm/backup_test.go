@@ -0,0 +1,277 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/backup"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// liveDomainXML is the live XML of the running test VM with data disks.
+const liveDomainXML = `<domain type='kvm'>
+  <name>test-vm</name>
+  <devices>
+    <disk type='volume' device='disk'><source pool='foundry-vms' volume='test-vm_boot.qcow2'/><target dev='vda' bus='virtio'/></disk>
+    <disk type='volume' device='disk'><source pool='foundry-vms' volume='test-vm_data-vdb.qcow2'/><target dev='vdb' bus='virtio'/></disk>
+    <disk type='volume' device='disk'><source pool='foundry-vms' volume='test-vm_data-vdc.qcow2'/><target dev='vdc' bus='virtio'/></disk>
+    <disk type='volume' device='cdrom'><source pool='foundry-vms' volume='test-vm_cloudinit.iso'/><target dev='sda' bus='sata'/><readonly/></disk>
+  </devices>
+</domain>`
+
+// activeCommitReady returns a subscribe func delivering the ready event of an
+// active commit.
+func activeCommitReady(ctx context.Context, eventID libvirt.DomainEventID, dom libvirt.OptDomain) (<-chan interface{}, error) {
+	ch := make(chan interface{}, 1)
+	ch <- &libvirt.DomainEventCallbackBlockJobMsg{
+		Msg: libvirt.DomainEventBlockJobMsg{
+			Dom:    libvirt.Domain{Name: "test-vm"},
+			Type:   int32(libvirt.DomainBlockJobTypeActiveCommit),
+			Status: int32(libvirt.DomainBlockJobReady),
+		},
+	}
+	return ch, nil
+}
+
+func TestBackupVMWithDeps_Offline(t *testing.T) {
+	lv, sm := newExportMocks(t)
+	repo := backup.NewRepository(t.TempDir())
+	ctx := context.Background()
+	opts := BackupOptions{FullEvery: 2, Keep: 1}
+
+	first, err := backupVMWithDeps(ctx, "test-vm", opts, repo, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("backupVMWithDeps() error = %v", err)
+	}
+	if first.Live || first.Manifest.Kind != backup.KindFull || len(first.Manifest.Disks) != 4 {
+		t.Errorf("first backup = %+v", first.Manifest)
+	}
+	if len(lv.domainSnapshotCreateCalls) != 0 {
+		t.Error("a stopped VM must not be snapshotted")
+	}
+
+	// The next backup is incremental; only the changed disk is stored
+	sm.exportVolumeFunc = func(ctx context.Context, poolName, volumeName string, w io.Writer) error {
+		if volumeName == "test-vm_data-vdb.qcow2" {
+			volumeName = "changed"
+		}
+		_, err := w.Write([]byte(volumeName))
+		return err
+	}
+	second, err := backupVMWithDeps(ctx, "test-vm", opts, repo, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("backupVMWithDeps() error = %v", err)
+	}
+	if second.Manifest.Kind != backup.KindIncremental || second.Manifest.Parent != first.Manifest.ID {
+		t.Errorf("second backup = %+v", second.Manifest)
+	}
+	if second.Manifest.StoredSize() != int64(len("changed")) {
+		t.Errorf("second backup stored %d bytes, want only the changed disk", second.Manifest.StoredSize())
+	}
+	if len(second.Pruned) != 0 {
+		t.Errorf("pruned %v, the chain of the newest backup must be kept", second.Pruned)
+	}
+
+	// The chain is full: a new full backup starts, and the old chain is pruned
+	third, err := backupVMWithDeps(ctx, "test-vm", opts, repo, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("backupVMWithDeps() error = %v", err)
+	}
+	if third.Manifest.Kind != backup.KindFull {
+		t.Errorf("third backup kind = %s, want full", third.Manifest.Kind)
+	}
+	if strings.Join(third.Pruned, " ") != first.Manifest.ID+" "+second.Manifest.ID {
+		t.Errorf("pruned %v, want the first chain", third.Pruned)
+	}
+}
+
+func TestBackupVMWithDeps_Live(t *testing.T) {
+	lv, sm := newExportMocks(t)
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateRunning, 0, nil
+	}
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		if flags&libvirt.DomainXMLInactive != 0 {
+			return "<domain type='kvm'><name>test-vm</name></domain>", nil
+		}
+		return liveDomainXML, nil
+	}
+	lv.subscribeEventsFunc = activeCommitReady
+	repo := backup.NewRepository(t.TempDir())
+
+	result, err := backupVMWithDeps(context.Background(), "test-vm", BackupOptions{}, repo, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("backupVMWithDeps() error = %v", err)
+	}
+	if !result.Live {
+		t.Error("expected a live backup")
+	}
+
+	// Every disk but the cloud-init ISO gets an overlay next to its volume
+	if len(lv.domainSnapshotCreateCalls) != 1 {
+		t.Fatalf("expected one snapshot, got %d", len(lv.domainSnapshotCreateCalls))
+	}
+	snapXML := lv.domainSnapshotCreateCalls[0]
+	for _, want := range []string{
+		"/var/lib/libvirt/images/foundry/foundry-vms/test-vm_boot.qcow2.backup",
+		"/var/lib/libvirt/images/foundry/foundry-vms/test-vm_data-vdc.qcow2.backup",
+		`<disk name="sda" snapshot="no">`,
+	} {
+		if !strings.Contains(snapXML, want) {
+			t.Errorf("snapshot XML lacks %s:\n%s", want, snapXML)
+		}
+	}
+
+	// The overlays are committed back, and deleted
+	if got := strings.Join(lv.domainBlockCommitCalls, " "); got != "vda vdb vdc" {
+		t.Errorf("block commits = %s, want every frozen disk", got)
+	}
+	if len(lv.domainBlockJobAbortCalls) != 3 {
+		t.Errorf("expected a pivot per disk, got %v", lv.domainBlockJobAbortCalls)
+	}
+	if len(lv.domainDefineXMLCalls) != 1 || !strings.Contains(lv.domainDefineXMLCalls[0], "test-vm") {
+		t.Errorf("expected the inactive definition to be restored, got %v", lv.domainDefineXMLCalls)
+	}
+	if got := strings.Join(sm.deleteVolumeCalls, " "); got != "foundry-vms/test-vm_boot.qcow2.backup foundry-vms/test-vm_data-vdb.qcow2.backup foundry-vms/test-vm_data-vdc.qcow2.backup" {
+		t.Errorf("DeleteVolume calls = %s, want the overlays", got)
+	}
+}
+
+func TestBackupVMWithDeps_LiveFailureThaws(t *testing.T) {
+	lv, sm := newExportMocks(t)
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateRunning, 0, nil
+	}
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		return liveDomainXML, nil
+	}
+	lv.subscribeEventsFunc = activeCommitReady
+	sm.exportVolumeFunc = func(ctx context.Context, poolName, volumeName string, w io.Writer) error {
+		return errors.New("download failed")
+	}
+	repo := backup.NewRepository(t.TempDir())
+
+	if _, err := backupVMWithDeps(context.Background(), "test-vm", BackupOptions{}, repo, lv, sm, newMockMetadataClient(lv)); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(lv.domainBlockCommitCalls) != 3 {
+		t.Errorf("block commits = %v, the disks must be thawed after a failure", lv.domainBlockCommitCalls)
+	}
+	if manifests, _ := repo.List("test-vm"); len(manifests) != 0 {
+		t.Errorf("a failed backup was kept: %v", manifests)
+	}
+}
+
+func TestRestoreVMWithDeps(t *testing.T) {
+	lv, sm := newExportMocks(t)
+	repo := backup.NewRepository(t.TempDir())
+	ctx := context.Background()
+
+	taken, err := backupVMWithDeps(ctx, "test-vm", BackupOptions{}, repo, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("backupVMWithDeps() error = %v", err)
+	}
+
+	// The VM still exists
+	if _, err := restoreVMWithDeps(ctx, "test-vm", RestoreOptions{}, repo, lv, sm, newMockMetadataClient(lv)); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("restoring over an existing VM: error = %v", err)
+	}
+
+	// Once destroyed, it is restored from the backup
+	defined := false
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		if !defined {
+			return libvirt.Domain{}, errors.New("domain not found")
+		}
+		return libvirt.Domain{Name: name}, nil
+	}
+	lv.domainDefineXMLFunc = func(xml string) (libvirt.Domain, error) {
+		defined = true
+		return libvirt.Domain{Name: "test-vm"}, nil
+	}
+	sm.volumeExistsFunc = func(ctx context.Context, poolName, volumeName string) (bool, error) {
+		return false, nil
+	}
+	uploaded := make(map[string]string)
+	sm.uploadVolumeFunc = func(ctx context.Context, poolName, volumeName string, r io.Reader, length uint64) error {
+		data, err := io.ReadAll(r)
+		uploaded[volumeName] = string(data)
+		if uint64(len(data)) != length {
+			t.Errorf("uploaded %d bytes to %s, want %d", len(data), volumeName, length)
+		}
+		return err
+	}
+
+	restored, err := restoreVMWithDeps(ctx, "test-vm", RestoreOptions{ID: taken.Manifest.ID, Start: true}, repo, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("restoreVMWithDeps() error = %v", err)
+	}
+	if restored.ID != taken.Manifest.ID {
+		t.Errorf("restored backup %s, want %s", restored.ID, taken.Manifest.ID)
+	}
+
+	var types []string
+	for _, spec := range sm.createVolumeCalls {
+		types = append(types, spec.Name+":"+string(spec.Type))
+	}
+	want := "test-vm_boot.qcow2:boot test-vm_data-vdb.qcow2:data test-vm_data-vdc.qcow2:data test-vm_cloudinit.iso:cloudinit"
+	if strings.Join(types, " ") != want {
+		t.Errorf("created volumes = %v, want %s", types, want)
+	}
+	if uploaded["test-vm_data-vdb.qcow2"] != "test-vm_data-vdb.qcow2" {
+		t.Errorf("uploaded data = %v", uploaded)
+	}
+	if sm.createVolumeCalls[3].Format != storage.VolumeFormatRaw {
+		t.Errorf("cloud-init volume format = %s, want raw", sm.createVolumeCalls[3].Format)
+	}
+
+	stored, err := newMockMetadataClient(lv).Load(libvirt.Domain{Name: "test-vm"})
+	if err != nil || len(stored.Spec.DataDisks) != 2 {
+		t.Fatalf("stored spec = %+v, %v", stored, err)
+	}
+	if _, ok := stored.Annotations[v1alpha1.AnnotationBootImagePath]; ok {
+		t.Error("restored VM keeps the boot image annotation of its flattened disk")
+	}
+	if len(lv.domainCreateCalls) != 1 {
+		t.Error("expected the restored VM to be started")
+	}
+}
+
+func TestRestoreVMWithDeps_UploadFailureCleansUp(t *testing.T) {
+	lv, sm := newExportMocks(t)
+	repo := backup.NewRepository(t.TempDir())
+	ctx := context.Background()
+	if _, err := backupVMWithDeps(ctx, "test-vm", BackupOptions{}, repo, lv, sm, newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("backupVMWithDeps() error = %v", err)
+	}
+
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		return libvirt.Domain{}, errors.New("domain not found")
+	}
+	sm.volumeExistsFunc = func(ctx context.Context, poolName, volumeName string) (bool, error) {
+		return false, nil
+	}
+	sm.uploadVolumeFunc = func(ctx context.Context, poolName, volumeName string, r io.Reader, length uint64) error {
+		if volumeName == "test-vm_data-vdb.qcow2" {
+			return errors.New("pool full")
+		}
+		_, err := io.Copy(io.Discard, r)
+		return err
+	}
+
+	if _, err := restoreVMWithDeps(ctx, "test-vm", RestoreOptions{}, repo, lv, sm, newMockMetadataClient(lv)); err == nil {
+		t.Fatal("expected error")
+	}
+	if got := strings.Join(sm.deleteVolumeCalls, " "); got != "foundry-vms/test-vm_boot.qcow2 foundry-vms/test-vm_data-vdb.qcow2" {
+		t.Errorf("DeleteVolume calls = %s, want the restored volumes", got)
+	}
+	if len(lv.domainDefineXMLCalls) != 0 {
+		t.Error("domain defined after a failed restore")
+	}
+}
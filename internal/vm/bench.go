@@ -0,0 +1,229 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"libvirt.org/go/libvirtxml"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/bench"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+const (
+	// defaultBenchSizeGB is the size of the temporary benchmark disk.
+	defaultBenchSizeGB = 4
+
+	// benchDiskSerial identifies the benchmark disk in the guest, which sees
+	// it as /dev/disk/by-id/*foundry-bench.
+	benchDiskSerial = "foundry-bench"
+)
+
+// BenchDiskOptions configures BenchDisk.
+type BenchDiskOptions struct {
+	// Configs are the disk settings to compare. Defaults to
+	// bench.DefaultDiskConfigs.
+	Configs []bench.DiskConfig
+
+	// SizeGB is the size of the temporary disk. Defaults to 4.
+	SizeGB int
+
+	// Runtime is how long each fio job runs. Defaults to bench.DefaultRuntime.
+	Runtime time.Duration
+
+	// Progress, if non-nil, is called before each config is benchmarked.
+	Progress func(bench.DiskConfig)
+}
+
+// BenchDisk benchmarks disk settings on a running VM. For each config an
+// empty temporary disk is hotplugged with that bus and cache mode, the fio job
+// of the bench package is run against it through the QEMU guest agent, and
+// the disk is unplugged and deleted again.
+//
+// The guest needs qemu-guest-agent and fio installed. The VM's own disks are
+// not touched, but the benchmark competes with the guest's workload.
+func BenchDisk(ctx context.Context, vmName string, opts BenchDiskOptions) ([]bench.Result, error) {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	return benchDiskWithDeps(ctx, vmName, opts, guestExecPollInterval, LibvirtClient.Libvirt(), storageMgr, metaClient)
+}
+
+// benchDiskWithDeps benchmarks disk settings with injected dependencies,
+// checking on fio every poll.
+func benchDiskWithDeps(ctx context.Context, vmName string, opts BenchDiskOptions, poll time.Duration, lv LibvirtClient, sm storageManager, mc *metadata.Client) ([]bench.Result, error) {
+	if len(opts.Configs) == 0 {
+		opts.Configs = bench.DefaultDiskConfigs
+	}
+	if opts.SizeGB <= 0 {
+		opts.SizeGB = defaultBenchSizeGB
+	}
+	if opts.Runtime <= 0 {
+		opts.Runtime = bench.DefaultRuntime
+	}
+
+	domain, err := lv.DomainLookupByName(vmName)
+	if err != nil {
+		return nil, fmt.Errorf("VM '%s' not found: %w", vmName, err)
+	}
+	vm, err := mc.Load(domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", vmName, err)
+	}
+
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VM state: %w", err)
+	}
+	if state != domainStateRunning {
+		return nil, fmt.Errorf("VM '%s' must be running to benchmark disks (state: %s)", vmName, stateToString(state))
+	}
+
+	var results []bench.Result
+	for _, config := range opts.Configs {
+		if opts.Progress != nil {
+			opts.Progress(config)
+		}
+		result, err := benchDiskConfig(ctx, lv, sm, domain, vm, config, opts, poll)
+		if err != nil {
+			return results, fmt.Errorf("benchmark of %s failed: %w", config, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// benchDiskConfig benchmarks one disk config on a temporary disk.
+func benchDiskConfig(ctx context.Context, lv LibvirtClient, sm storageManager, domain libvirt.Domain, vm *v1alpha1.VirtualMachine, config bench.DiskConfig, opts BenchDiskOptions, poll time.Duration) (result bench.Result, err error) {
+	logger := logging.FromContext(ctx)
+
+	pool := getStoragePool(vm)
+	volumeName := vm.Name + "_bench.qcow2"
+	device := "vdz"
+	if config.Bus == "scsi" {
+		device = "sdz"
+	}
+	if _, err := findDomainDisk(lv, domain, device); err == nil {
+		return result, fmt.Errorf("device %s of VM '%s' is already in use", device, vm.Name)
+	}
+
+	logger.Info("Creating benchmark volume", "volume", volumeName, "sizeGB", opts.SizeGB)
+	if err := sm.CreateVolume(ctx, pool, storage.VolumeSpec{
+		Name:       volumeName,
+		Type:       storage.VolumeTypeData,
+		Format:     storage.VolumeFormatQCOW2,
+		CapacityGB: uint64(opts.SizeGB),
+	}); err != nil {
+		return result, fmt.Errorf("failed to create benchmark volume: %w", err)
+	}
+
+	diskXML, err := benchDiskXML(pool, volumeName, device, config)
+	if err != nil {
+		deleteBenchVolume(ctx, sm, pool, volumeName)
+		return result, err
+	}
+
+	logger.Info("Attaching benchmark disk", "device", device, "config", config)
+	if err := lv.DomainAttachDeviceFlags(domain, diskXML, uint32(libvirt.DomainAffectLive)); err != nil {
+		deleteBenchVolume(ctx, sm, pool, volumeName)
+		return result, fmt.Errorf("failed to attach benchmark disk: %w", err)
+	}
+
+	// The disk is removed even if the benchmark was cancelled
+	defer func() {
+		logger.Info("Detaching benchmark disk", "device", device)
+		if detachErr := lv.DomainDetachDeviceFlags(domain, diskXML, uint32(libvirt.DomainAffectLive)); detachErr != nil {
+			logger.Warn("Failed to detach benchmark disk, keeping its volume", "volume", volumeName, "error", detachErr)
+			return
+		}
+		released, _ := waitForDiskDetach(context.Background(), lv, domain, device, diskDetachTimeout)
+		if !released {
+			logger.Warn("Guest has not released benchmark disk, keeping its volume", "device", device, "volume", volumeName)
+			return
+		}
+		deleteBenchVolume(ctx, sm, pool, volumeName)
+	}()
+
+	logger.Info("Running fio in the guest", "config", config)
+	out, err := guestExec(ctx, lv, domain, "/bin/sh", []string{"-c", benchScript(opts.Runtime)}, poll)
+	if err != nil {
+		return result, err
+	}
+	switch {
+	case out.ExitCode == 127:
+		return result, fmt.Errorf("fio is not installed in the guest")
+	case out.ExitCode != 0:
+		return result, fmt.Errorf("fio exited with status %d: %s", out.ExitCode, strings.TrimSpace(string(out.Stderr)))
+	}
+	return bench.ParseFioOutput(config, out.Stdout)
+}
+
+// benchScript returns the shell script run in the guest: it waits for the
+// benchmark disk to appear and runs fio against it.
+func benchScript(runtime time.Duration) string {
+	return fmt.Sprintf(`dev=
+for i in $(seq 30); do
+  dev=$(ls /dev/disk/by-id/*%s 2>/dev/null | head -n 1)
+  [ -n "$dev" ] && break
+  sleep 1
+done
+[ -n "$dev" ] || { echo "benchmark disk did not appear in the guest" >&2; exit 2; }
+command -v fio >/dev/null || exit 127
+exec fio %s`, benchDiskSerial, strings.Join(bench.FioArgs(`"$dev"`, runtime), " "))
+}
+
+// benchDiskXML returns the XML of the temporary benchmark disk.
+func benchDiskXML(pool, volumeName, device string, config bench.DiskConfig) (string, error) {
+	disk := libvirtxml.DomainDisk{
+		Device: "disk",
+		Driver: &libvirtxml.DomainDiskDriver{
+			Name:  "qemu",
+			Type:  "qcow2",
+			Cache: config.Cache,
+		},
+		Source: &libvirtxml.DomainDiskSource{
+			Volume: &libvirtxml.DomainDiskSourceVolume{
+				Pool:   pool,
+				Volume: volumeName,
+			},
+		},
+		Target: &libvirtxml.DomainDiskTarget{
+			Dev: device,
+			Bus: config.Bus,
+		},
+		Serial: benchDiskSerial,
+	}
+	diskXML, err := disk.Marshal()
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal benchmark disk XML: %w", err)
+	}
+	return diskXML, nil
+}
+
+// deleteBenchVolume deletes the temporary benchmark volume.
+func deleteBenchVolume(ctx context.Context, sm storageManager, pool, volumeName string) {
+	if err := sm.DeleteVolume(context.WithoutCancel(ctx), pool, volumeName); err != nil {
+		logging.FromContext(ctx).Warn("Failed to delete benchmark volume", "volume", volumeName, "error", err)
+	}
+}
@@ -0,0 +1,127 @@
+package vm
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/internal/bench"
+)
+
+// benchFioJSON is fio output with all jobs of the benchmark.
+const benchFioJSON = `{"jobs": [
+  {"jobname": "randread", "read": {"iops": 1000, "bw": 4000, "lat_ns": {"mean": 32000}}},
+  {"jobname": "randwrite", "write": {"iops": 500, "bw": 2000, "lat_ns": {"mean": 64000}}},
+  {"jobname": "seqread", "read": {"iops": 100, "bw": 102400}},
+  {"jobname": "seqwrite", "write": {"iops": 50, "bw": 51200}}
+]}`
+
+// newBenchMocks returns mocks for a running foundry VM whose guest agent
+// runs commands with the given exit code and output. Attached disks show up
+// in the live XML until they are detached.
+func newBenchMocks(t *testing.T, exitCode int, stdout string) (*mockLibvirtClient, *mockStorageManager) {
+	t.Helper()
+	lv, sm := newApplyMocks(t, testVMConfig())
+
+	attached := ""
+	lv.domainAttachDeviceFunc = func(dom libvirt.Domain, xml string, flags uint32) error {
+		attached = xml
+		return nil
+	}
+	lv.domainDetachDeviceFunc = func(dom libvirt.Domain, xml string, flags uint32) error {
+		attached = ""
+		return nil
+	}
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		return "<domain type='kvm'><name>test-vm</name><devices>" + attached + "</devices></domain>", nil
+	}
+	lv.agentCommandFunc = func(dom libvirt.Domain, cmd string) (string, error) {
+		if strings.Contains(cmd, `"guest-exec-status"`) {
+			return fmt.Sprintf(`{"return": {"exited": true, "exitcode": %d, "out-data": %q}}`,
+				exitCode, base64.StdEncoding.EncodeToString([]byte(stdout))), nil
+		}
+		return `{"return": {"pid": 42}}`, nil
+	}
+	return lv, sm
+}
+
+func TestBenchDiskWithDeps(t *testing.T) {
+	lv, sm := newBenchMocks(t, 0, benchFioJSON)
+
+	configs := []bench.DiskConfig{{Bus: "virtio", Cache: "none"}, {Bus: "scsi", Cache: "writeback"}}
+	results, err := benchDiskWithDeps(context.Background(), "test-vm", BenchDiskOptions{Configs: configs}, time.Millisecond, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("benchDiskWithDeps() error = %v", err)
+	}
+
+	if len(results) != 2 || results[0].Config != configs[0] || results[1].Config != configs[1] {
+		t.Fatalf("results = %+v, want one per config", results)
+	}
+	if results[0].RandReadIOPS != 1000 || results[1].SeqReadMiBps != 100 {
+		t.Errorf("results = %+v, want parsed fio output", results)
+	}
+
+	if len(lv.domainAttachDeviceCalls) != 2 {
+		t.Fatalf("attached %d disks, want 2", len(lv.domainAttachDeviceCalls))
+	}
+	for i, want := range []string{`bus="virtio"`, `bus="scsi"`} {
+		xml := lv.domainAttachDeviceCalls[i]
+		if !strings.Contains(xml, want) || !strings.Contains(xml, "<serial>foundry-bench</serial>") {
+			t.Errorf("attached disk %d = %s, want %s with the bench serial", i, xml, want)
+		}
+	}
+	if !strings.Contains(lv.domainAttachDeviceCalls[1], `cache="writeback"`) {
+		t.Errorf("attached disk = %s, want cache=writeback", lv.domainAttachDeviceCalls[1])
+	}
+	if len(lv.domainDetachDeviceCalls) != 2 {
+		t.Errorf("detached %d disks, want 2", len(lv.domainDetachDeviceCalls))
+	}
+	if len(sm.createVolumeCalls) != 2 || len(sm.deleteVolumeCalls) != 2 || sm.deleteVolumeCalls[0] != "foundry-vms/test-vm_bench.qcow2" {
+		t.Errorf("created %v, deleted %v, want a temporary volume per config", sm.createVolumeCalls, sm.deleteVolumeCalls)
+	}
+}
+
+func TestBenchDiskWithDeps_FioMissing(t *testing.T) {
+	lv, sm := newBenchMocks(t, 127, "")
+
+	_, err := benchDiskWithDeps(context.Background(), "test-vm", BenchDiskOptions{}, time.Millisecond, lv, sm, newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "fio is not installed") {
+		t.Fatalf("error = %v, want fio missing", err)
+	}
+	// The temporary disk is still cleaned up
+	if len(lv.domainDetachDeviceCalls) != 1 || len(sm.deleteVolumeCalls) != 1 {
+		t.Errorf("detached %d disks and deleted %d volumes, want 1 and 1", len(lv.domainDetachDeviceCalls), len(sm.deleteVolumeCalls))
+	}
+}
+
+func TestBenchDiskWithDeps_NoAgent(t *testing.T) {
+	lv, sm := newBenchMocks(t, 0, benchFioJSON)
+	lv.agentCommandFunc = func(dom libvirt.Domain, cmd string) (string, error) {
+		return "", fmt.Errorf("guest agent is not configured")
+	}
+
+	_, err := benchDiskWithDeps(context.Background(), "test-vm", BenchDiskOptions{}, time.Millisecond, lv, sm, newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "qemu-guest-agent") {
+		t.Fatalf("error = %v, want guest agent error", err)
+	}
+}
+
+func TestBenchDiskWithDeps_StoppedVM(t *testing.T) {
+	lv, sm := newBenchMocks(t, 0, benchFioJSON)
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateShutoff, 0, nil
+	}
+
+	_, err := benchDiskWithDeps(context.Background(), "test-vm", BenchDiskOptions{}, time.Millisecond, lv, sm, newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "must be running") {
+		t.Fatalf("error = %v, want must be running", err)
+	}
+	if len(sm.createVolumeCalls) != 0 {
+		t.Error("expected no volume to be created")
+	}
+}
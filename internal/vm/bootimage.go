@@ -0,0 +1,72 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// recordBootImage annotates the VM with the path and fingerprint of the image
+// backing its new boot disk, so that verifyBootImage can check the image is
+// still there before the VM is started. Failing to fingerprint the image only
+// loses that check, so it is not an error.
+func recordBootImage(ctx context.Context, vm *v1alpha1.VirtualMachine, sm storageManager, imageName, path string) {
+	if vm.Annotations == nil {
+		vm.Annotations = make(map[string]string)
+	}
+	vm.Annotations[v1alpha1.AnnotationBootImagePath] = path
+	delete(vm.Annotations, v1alpha1.AnnotationBootImageFingerprint)
+
+	fingerprint, err := sm.ImageFingerprint(ctx, imageName)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Failed to fingerprint image", "image", imageName, "error", err)
+		return
+	}
+	vm.Annotations[v1alpha1.AnnotationBootImageFingerprint] = fingerprint
+}
+
+// verifyBootImage checks that the image backing the VM's boot disk is still
+// at the path recorded at creation and has not been replaced, so that a VM
+// whose base image was moved, renamed or re-imported fails with a clear error
+// instead of qemu failing to open the disk or booting from a different image.
+// VMs without a recorded image (created from a file path, cloned, or created
+// by older versions) are not checked.
+func verifyBootImage(ctx context.Context, vm *v1alpha1.VirtualMachine, sm storageManager) error {
+	path := vm.Annotations[v1alpha1.AnnotationBootImagePath]
+	if path == "" {
+		return nil
+	}
+
+	volumes, err := sm.ListVolumes(ctx, storage.ImagesPool())
+	if err != nil {
+		return fmt.Errorf("failed to list images: %w", err)
+	}
+	var image *storage.VolumeInfo
+	for i := range volumes {
+		if volumes[i].Path == path {
+			image = &volumes[i]
+			break
+		}
+	}
+	if image == nil {
+		return fmt.Errorf("the boot disk of VM '%s' is backed by %s, which no longer exists; restore the image under its original name (%s) before starting the VM",
+			vm.Name, path, vm.Spec.BootDisk.Image)
+	}
+
+	want := vm.Annotations[v1alpha1.AnnotationBootImageFingerprint]
+	if want == "" {
+		return nil
+	}
+	got, err := sm.ImageFingerprint(ctx, image.Name)
+	if err != nil {
+		return fmt.Errorf("failed to verify boot image %s: %w", image.Name, err)
+	}
+	if got != want {
+		return fmt.Errorf("image %s backing the boot disk of VM '%s' was replaced since the VM was created (fingerprint %s, recorded %s); the boot disk would read corrupt data from it",
+			image.Name, vm.Name, got, want)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package vm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+const testImagePath = "/var/lib/libvirt/images/foundry/foundry-images/fedora-43.qcow2"
+
+// testImageVMConfig returns a VM booting from the image fedora-43.qcow2.
+func testImageVMConfig() *v1alpha1.VirtualMachine {
+	vm := testVMConfig()
+	vm.Spec.BootDisk.Image = "fedora-43.qcow2"
+	vm.Spec.BootDisk.Empty = false
+	return vm
+}
+
+// newBootImageStorage returns a storage mock whose images pool holds images,
+// a map of image name to path.
+func newBootImageStorage(images map[string]string) *mockStorageManager {
+	sm := newMockStorageManager()
+	sm.listVolumesFunc = func(ctx context.Context, poolName string) ([]storage.VolumeInfo, error) {
+		var volumes []storage.VolumeInfo
+		if poolName == storage.DefaultImagesPool {
+			for name, path := range images {
+				volumes = append(volumes, storage.VolumeInfo{Name: name, Pool: poolName, Path: path})
+			}
+		}
+		return volumes, nil
+	}
+	return sm
+}
+
+func TestCreateFromConfigWithDeps_RecordsBootImage(t *testing.T) {
+	vm := testImageVMConfig()
+	lv := newMockLibvirtClient()
+	sm := newMockStorageManager()
+
+	if err := createFromConfigWithDeps(context.Background(), vm, lv, sm, newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("createFromConfigWithDeps() error = %v", err)
+	}
+	if got := vm.Annotations[v1alpha1.AnnotationBootImagePath]; got != testImagePath {
+		t.Errorf("boot image path = %q, want %q", got, testImagePath)
+	}
+	if got := vm.Annotations[v1alpha1.AnnotationBootImageFingerprint]; got != "sha256:fedora-43.qcow2" {
+		t.Errorf("boot image fingerprint = %q, want sha256:fedora-43.qcow2", got)
+	}
+}
+
+func TestNewCloneSpec_DropsBootImage(t *testing.T) {
+	src := testImageVMConfig()
+	src.Annotations = map[string]string{
+		v1alpha1.AnnotationBootImagePath:        testImagePath,
+		v1alpha1.AnnotationBootImageFingerprint: "sha256:fedora-43.qcow2",
+	}
+
+	clone, err := newCloneSpec(context.Background(), src, "clone-vm", CloneOptions{IPs: []string{"10.0.0.11/24"}})
+	if err != nil {
+		t.Fatalf("newCloneSpec() error = %v", err)
+	}
+	for _, key := range []string{v1alpha1.AnnotationBootImagePath, v1alpha1.AnnotationBootImageFingerprint} {
+		if _, ok := clone.Annotations[key]; ok {
+			t.Errorf("clone has annotation %s", key)
+		}
+	}
+}
+
+func TestVerifyBootImage(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		images      map[string]string
+		wantErr     string
+	}{
+		{
+			name:   "nothing recorded",
+			images: map[string]string{},
+		},
+		{
+			name: "unchanged",
+			annotations: map[string]string{
+				v1alpha1.AnnotationBootImagePath:        testImagePath,
+				v1alpha1.AnnotationBootImageFingerprint: "sha256:fedora-43.qcow2",
+			},
+			images: map[string]string{"fedora-43.qcow2": testImagePath},
+		},
+		{
+			name:        "path recorded without fingerprint",
+			annotations: map[string]string{v1alpha1.AnnotationBootImagePath: testImagePath},
+			images:      map[string]string{"fedora-43.qcow2": testImagePath},
+		},
+		{
+			name: "image renamed",
+			annotations: map[string]string{
+				v1alpha1.AnnotationBootImagePath:        testImagePath,
+				v1alpha1.AnnotationBootImageFingerprint: "sha256:fedora-43.qcow2",
+			},
+			images:  map[string]string{"fedora.qcow2": "/var/lib/libvirt/images/foundry/foundry-images/fedora.qcow2"},
+			wantErr: "no longer exists",
+		},
+		{
+			name: "image replaced",
+			annotations: map[string]string{
+				v1alpha1.AnnotationBootImagePath:        testImagePath,
+				v1alpha1.AnnotationBootImageFingerprint: "sha256:an-older-import",
+			},
+			images:  map[string]string{"fedora-43.qcow2": testImagePath},
+			wantErr: "was replaced",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := testImageVMConfig()
+			vm.Annotations = tt.annotations
+
+			err := verifyBootImage(context.Background(), vm, newBootImageStorage(tt.images))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("verifyBootImage() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("verifyBootImage() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStartWithDeps_BootImageMissing(t *testing.T) {
+	stored := testImageVMConfig()
+	stored.Name = "test-vm"
+	stored.Annotations = map[string]string{v1alpha1.AnnotationBootImagePath: testImagePath}
+	lv, _ := newApplyMocks(t, stored)
+	lv.domainGetStateFunc = newPowerMock(domainStateShutoff).domainGetStateFunc
+
+	err := startWithDeps(context.Background(), "test-vm", lv, newBootImageStorage(map[string]string{}), newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "no longer exists") {
+		t.Errorf("startWithDeps() error = %v, want boot image error", err)
+	}
+	if len(lv.domainCreateCalls) != 0 {
+		t.Error("VM started despite a missing boot image")
+	}
+}
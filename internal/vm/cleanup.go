@@ -0,0 +1,204 @@
+// Package vm provides high-level VM management operations.
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/digitalocean/go-libvirt"
+	"libvirt.org/go/libvirtxml"
+
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// vmVolumePools returns the pools searched for volumes belonging to a VM.
+func vmVolumePools() []string {
+	return []string{storage.VMsPool(), storage.ImagesPool()}
+}
+
+// DestroyOptions configures VM destruction.
+type DestroyOptions struct {
+	// ForceClean removes any volumes or tap interfaces still present after
+	// the domain has been destroyed and undefined.
+	ForceClean bool
+}
+
+// LeftoverVolume identifies a storage volume that survived VM destruction.
+type LeftoverVolume struct {
+	Pool string
+	Name string
+}
+
+// DestroyReport describes what was left behind after destroying a VM.
+//
+// An empty report (Clean returns true) means the domain is gone, no volume
+// matching the VM's naming convention remains, and none of its tap interfaces
+// linger on the host.
+type DestroyReport struct {
+	// VMName is the name of the destroyed VM.
+	VMName string
+
+	// DomainRemains is true if libvirt still knows about the domain, meaning
+	// it would still show up in list and get.
+	DomainRemains bool
+
+	// Volumes are volumes named "{vmName}_*" still present in the foundry pools.
+	Volumes []LeftoverVolume
+
+	// Interfaces are tap interfaces of the VM still present on the host.
+	Interfaces []string
+
+	// Cleaned lists the resources removed by a force-clean pass.
+	Cleaned []string
+}
+
+// Clean reports whether nothing was left behind.
+func (r *DestroyReport) Clean() bool {
+	return !r.DomainRemains && len(r.Volumes) == 0 && len(r.Interfaces) == 0
+}
+
+// Leftovers returns a human-readable description of each leftover resource.
+func (r *DestroyReport) Leftovers() []string {
+	var items []string
+	if r.DomainRemains {
+		items = append(items, fmt.Sprintf("domain %s", r.VMName))
+	}
+	for _, vol := range r.Volumes {
+		items = append(items, fmt.Sprintf("volume %s/%s", vol.Pool, vol.Name))
+	}
+	for _, iface := range r.Interfaces {
+		items = append(items, fmt.Sprintf("interface %s", iface))
+	}
+	return items
+}
+
+// hostLinks abstracts the host network interfaces checked after destroy.
+// This allows for testing without touching real network devices.
+type hostLinks interface {
+	// LinkExists reports whether a network interface with the given name exists
+	LinkExists(name string) (bool, error)
+
+	// DeleteLink removes a network interface
+	DeleteLink(name string) error
+}
+
+// domainInterfaceNames returns the tap device names from a domain's XML.
+//
+// It must be called before the domain is undefined, since the tap names are
+// only recorded in the domain definition.
+func domainInterfaceNames(lv LibvirtClient, domain libvirt.Domain) ([]string, error) {
+	xmlDesc, err := lv.DomainGetXMLDesc(domain, libvirt.DomainXMLInactive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain XML: %w", err)
+	}
+
+	var domainDef libvirtxml.Domain
+	if err := domainDef.Unmarshal(xmlDesc); err != nil {
+		return nil, fmt.Errorf("failed to parse domain XML: %w", err)
+	}
+
+	var names []string
+	if domainDef.Devices != nil {
+		for _, iface := range domainDef.Devices.Interfaces {
+			if iface.Target != nil && iface.Target.Dev != "" {
+				names = append(names, iface.Target.Dev)
+			}
+		}
+	}
+	return names, nil
+}
+
+// findVMVolumes returns all volumes named "{vmName}_*" in the foundry pools.
+// Pools that cannot be listed are logged and skipped.
+func findVMVolumes(ctx context.Context, sm storageManager, vmName string) []LeftoverVolume {
+	logger := logging.FromContext(ctx)
+
+	var found []LeftoverVolume
+	vmPrefix := vmName + "_"
+
+	for _, poolName := range vmVolumePools() {
+		volumes, err := sm.ListVolumes(ctx, poolName)
+		if err != nil {
+			logger.Warn("Failed to list volumes", "pool", poolName, "error", err)
+			continue
+		}
+		for _, vol := range volumes {
+			if strings.HasPrefix(vol.Name, vmPrefix) {
+				found = append(found, LeftoverVolume{Pool: poolName, Name: vol.Name})
+			}
+		}
+	}
+	return found
+}
+
+// verifyDestroyedWithDeps checks that nothing belonging to vmName survived
+// destruction: the domain, volumes following the naming convention, and the
+// given tap interfaces (skipped if links is nil).
+func verifyDestroyedWithDeps(ctx context.Context, vmName string, interfaces []string, lv LibvirtClient, sm storageManager, links hostLinks) *DestroyReport {
+	logger := logging.FromContext(ctx)
+
+	logger.Debug("Verifying VM was fully removed", "vm", vmName)
+	report := &DestroyReport{VMName: vmName}
+
+	if _, err := lv.DomainLookupByName(vmName); err == nil {
+		report.DomainRemains = true
+	}
+
+	report.Volumes = findVMVolumes(ctx, sm, vmName)
+
+	if links == nil {
+		return report
+	}
+
+	for _, name := range interfaces {
+		exists, err := links.LinkExists(name)
+		if err != nil {
+			logger.Warn("Failed to check interface", "interface", name, "error", err)
+			continue
+		}
+		if exists {
+			report.Interfaces = append(report.Interfaces, name)
+		}
+	}
+
+	return report
+}
+
+// forceCleanWithDeps removes leftover volumes and interfaces recorded in the
+// report, then re-verifies. A domain that still exists is not touched here;
+// it is reported so the caller can decide what to do.
+func forceCleanWithDeps(ctx context.Context, report *DestroyReport, lv LibvirtClient, sm storageManager, links hostLinks) (*DestroyReport, error) {
+	logger := logging.FromContext(ctx)
+
+	var errs []error
+	var cleaned []string
+
+	for _, vol := range report.Volumes {
+		logger.Info("Force-cleaning volume", "pool", vol.Pool, "volume", vol.Name)
+		if err := sm.DeleteVolume(ctx, vol.Pool, vol.Name); err != nil {
+			errs = append(errs, fmt.Errorf("volume %s/%s: %w", vol.Pool, vol.Name, err))
+			continue
+		}
+		cleaned = append(cleaned, fmt.Sprintf("volume %s/%s", vol.Pool, vol.Name))
+	}
+
+	for _, name := range report.Interfaces {
+		logger.Info("Force-cleaning interface", "interface", name)
+		if err := links.DeleteLink(name); err != nil {
+			errs = append(errs, fmt.Errorf("interface %s: %w", name, err))
+			continue
+		}
+		cleaned = append(cleaned, fmt.Sprintf("interface %s", name))
+	}
+
+	after := verifyDestroyedWithDeps(ctx, report.VMName, report.Interfaces, lv, sm, links)
+	after.Cleaned = cleaned
+
+	if len(errs) > 0 {
+		return after, fmt.Errorf("force-clean incomplete: %w", errors.Join(errs...))
+	}
+	return after, nil
+}
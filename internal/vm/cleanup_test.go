@@ -0,0 +1,264 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+const domainXMLWithInterfaces = `<domain type='kvm'>
+  <name>test-vm</name>
+  <devices>
+    <interface type='bridge'>
+      <mac address='be:ef:0a:37:16:16'/>
+      <source bridge='br0'/>
+      <target dev='vm0a371616'/>
+      <model type='virtio'/>
+    </interface>
+    <interface type='bridge'>
+      <mac address='be:ef:0a:37:17:16'/>
+      <source bridge='br1'/>
+      <target dev='vm0a371716'/>
+      <model type='virtio'/>
+    </interface>
+  </devices>
+</domain>`
+
+// destroyScenario wires mocks that behave like a real host: the domain
+// disappears once undefined, and deleted volumes stop being listed.
+type destroyScenario struct {
+	lv    *mockLibvirtClient
+	sm    *mockStorageManager
+	links *mockHostLinks
+
+	// volumes maps pool name to the volumes present in it
+	volumes map[string][]string
+
+	// undefined is set once the domain has been undefined
+	undefined bool
+
+	// stuckVolumes fail to delete
+	stuckVolumes map[string]bool
+}
+
+func newDestroyScenario(links ...string) *destroyScenario {
+	s := &destroyScenario{
+		lv:    newMockLibvirtClient(),
+		sm:    newMockStorageManager(),
+		links: newMockHostLinks(links...),
+		volumes: map[string][]string{
+			"foundry-vms":    {"test-vm_boot.qcow2", "test-vm_cloudinit.iso", "other-vm_boot.qcow2"},
+			"foundry-images": {"fedora-43.qcow2"},
+		},
+		stuckVolumes: make(map[string]bool),
+	}
+
+	s.lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		if s.undefined {
+			return libvirt.Domain{}, fmt.Errorf("domain not found: %s", name)
+		}
+		return libvirt.Domain{Name: name}, nil
+	}
+	s.lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateShutoff, 0, nil
+	}
+	s.lv.domainUndefineFlagsFunc = func(dom libvirt.Domain, flags libvirt.DomainUndefineFlagsValues) error {
+		s.undefined = true
+		return nil
+	}
+	s.lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		return domainXMLWithInterfaces, nil
+	}
+
+	s.sm.listVolumesFunc = func(ctx context.Context, poolName string) ([]storage.VolumeInfo, error) {
+		var infos []storage.VolumeInfo
+		for _, name := range s.volumes[poolName] {
+			infos = append(infos, storage.VolumeInfo{Name: name, Pool: poolName})
+		}
+		return infos, nil
+	}
+	s.sm.deleteVolumeFunc = func(ctx context.Context, poolName, volumeName string) error {
+		if s.stuckVolumes[volumeName] {
+			return errors.New("volume is busy")
+		}
+		var kept []string
+		for _, name := range s.volumes[poolName] {
+			if name != volumeName {
+				kept = append(kept, name)
+			}
+		}
+		s.volumes[poolName] = kept
+		return nil
+	}
+
+	return s
+}
+
+func TestDestroyAndVerify_Clean(t *testing.T) {
+	s := newDestroyScenario("br0", "br1")
+
+	report, err := destroyAndVerifyWithDeps(context.Background(), "test-vm", DestroyOptions{}, s.lv, s.sm, s.links)
+	if err != nil {
+		t.Fatalf("destroyAndVerifyWithDeps() error = %v", err)
+	}
+	if !report.Clean() {
+		t.Errorf("expected clean report, got leftovers %v", report.Leftovers())
+	}
+	if got := s.volumes["foundry-vms"]; !reflect.DeepEqual(got, []string{"other-vm_boot.qcow2"}) {
+		t.Errorf("unexpected remaining volumes: %v", got)
+	}
+}
+
+func TestDestroyAndVerify_ReportsLeftovers(t *testing.T) {
+	s := newDestroyScenario("vm0a371716")
+	s.stuckVolumes["test-vm_boot.qcow2"] = true
+
+	report, err := destroyAndVerifyWithDeps(context.Background(), "test-vm", DestroyOptions{}, s.lv, s.sm, s.links)
+	if err != nil {
+		t.Fatalf("destroyAndVerifyWithDeps() error = %v", err)
+	}
+	if report.Clean() {
+		t.Fatal("expected leftovers to be reported")
+	}
+
+	wantVolumes := []LeftoverVolume{{Pool: "foundry-vms", Name: "test-vm_boot.qcow2"}}
+	if !reflect.DeepEqual(report.Volumes, wantVolumes) {
+		t.Errorf("Volumes = %v, want %v", report.Volumes, wantVolumes)
+	}
+	if !reflect.DeepEqual(report.Interfaces, []string{"vm0a371716"}) {
+		t.Errorf("Interfaces = %v, want [vm0a371716]", report.Interfaces)
+	}
+	if report.DomainRemains {
+		t.Error("domain should not be reported as remaining")
+	}
+	if len(s.links.deleteLinkCalls) != 0 {
+		t.Error("interfaces should not be removed without ForceClean")
+	}
+
+	leftovers := strings.Join(report.Leftovers(), ", ")
+	if leftovers != "volume foundry-vms/test-vm_boot.qcow2, interface vm0a371716" {
+		t.Errorf("Leftovers() = %q", leftovers)
+	}
+}
+
+func TestDestroyAndVerify_DomainRemains(t *testing.T) {
+	s := newDestroyScenario()
+	s.lv.domainUndefineFlagsFunc = func(dom libvirt.Domain, flags libvirt.DomainUndefineFlagsValues) error {
+		// Undefine "succeeds" but the domain is still defined
+		return nil
+	}
+
+	report, err := destroyAndVerifyWithDeps(context.Background(), "test-vm", DestroyOptions{}, s.lv, s.sm, s.links)
+	if err != nil {
+		t.Fatalf("destroyAndVerifyWithDeps() error = %v", err)
+	}
+	if !report.DomainRemains || report.Clean() {
+		t.Error("expected domain to be reported as remaining")
+	}
+}
+
+func TestDestroyAndVerify_ForceClean(t *testing.T) {
+	s := newDestroyScenario("vm0a371616")
+	// Fails during destroy, succeeds on the force-clean pass
+	attempts := 0
+	s.stuckVolumes["test-vm_cloudinit.iso"] = true
+	origDelete := s.sm.deleteVolumeFunc
+	s.sm.deleteVolumeFunc = func(ctx context.Context, poolName, volumeName string) error {
+		if volumeName == "test-vm_cloudinit.iso" {
+			attempts++
+			if attempts > 1 {
+				delete(s.stuckVolumes, volumeName)
+			}
+		}
+		return origDelete(ctx, poolName, volumeName)
+	}
+
+	report, err := destroyAndVerifyWithDeps(context.Background(), "test-vm", DestroyOptions{ForceClean: true}, s.lv, s.sm, s.links)
+	if err != nil {
+		t.Fatalf("destroyAndVerifyWithDeps() error = %v", err)
+	}
+	if !report.Clean() {
+		t.Errorf("expected clean report after force-clean, got %v", report.Leftovers())
+	}
+
+	wantCleaned := []string{"volume foundry-vms/test-vm_cloudinit.iso", "interface vm0a371616"}
+	if !reflect.DeepEqual(report.Cleaned, wantCleaned) {
+		t.Errorf("Cleaned = %v, want %v", report.Cleaned, wantCleaned)
+	}
+}
+
+func TestDestroyAndVerify_ForceCleanFailure(t *testing.T) {
+	s := newDestroyScenario("vm0a371616")
+	s.links.deleteLinkErr = errors.New("operation not permitted")
+
+	report, err := destroyAndVerifyWithDeps(context.Background(), "test-vm", DestroyOptions{ForceClean: true}, s.lv, s.sm, s.links)
+	if err == nil || !strings.Contains(err.Error(), "operation not permitted") {
+		t.Fatalf("expected force-clean error, got %v", err)
+	}
+	if report == nil || !reflect.DeepEqual(report.Interfaces, []string{"vm0a371616"}) {
+		t.Errorf("expected report with remaining interface, got %+v", report)
+	}
+}
+
+func TestDestroyAndVerify_ForceCleanMissingDomain(t *testing.T) {
+	s := newDestroyScenario()
+	s.undefined = true
+
+	report, err := destroyAndVerifyWithDeps(context.Background(), "test-vm", DestroyOptions{ForceClean: true}, s.lv, s.sm, s.links)
+	if err != nil {
+		t.Fatalf("destroyAndVerifyWithDeps() error = %v", err)
+	}
+	if !report.Clean() {
+		t.Errorf("expected clean report, got %v", report.Leftovers())
+	}
+	if len(report.Cleaned) != 2 {
+		t.Errorf("expected 2 volumes cleaned, got %v", report.Cleaned)
+	}
+	if len(s.lv.domainUndefineFlagsCalls) != 0 {
+		t.Error("should not attempt to undefine a missing domain")
+	}
+}
+
+func TestDestroyAndVerify_MissingDomainWithoutForceClean(t *testing.T) {
+	s := newDestroyScenario()
+	s.undefined = true
+
+	_, err := destroyAndVerifyWithDeps(context.Background(), "test-vm", DestroyOptions{}, s.lv, s.sm, s.links)
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestDomainInterfaceNames(t *testing.T) {
+	lv := newMockLibvirtClient()
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		return domainXMLWithInterfaces, nil
+	}
+
+	names, err := domainInterfaceNames(lv, libvirt.Domain{Name: "test-vm"})
+	if err != nil {
+		t.Fatalf("domainInterfaceNames() error = %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"vm0a371616", "vm0a371716"}) {
+		t.Errorf("domainInterfaceNames() = %v", names)
+	}
+}
+
+func TestDestroyAndVerify_NilLinksSkipsInterfaces(t *testing.T) {
+	s := newDestroyScenario()
+
+	report, err := destroyAndVerifyWithDeps(context.Background(), "test-vm", DestroyOptions{ForceClean: true}, s.lv, s.sm, nil)
+	if err != nil {
+		t.Fatalf("destroyAndVerifyWithDeps() error = %v", err)
+	}
+	if !report.Clean() {
+		t.Errorf("expected clean report, got %v", report.Leftovers())
+	}
+}
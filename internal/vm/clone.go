@@ -0,0 +1,352 @@
+// Package vm provides high-level VM management operations.
+package vm
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/digitalocean/go-libvirt"
+	"go.yaml.in/yaml/v3"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/loader"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// CloneOptions configures Clone.
+type CloneOptions struct {
+	// Full copies the source's disks into standalone volumes. By default the
+	// clone's disks are qcow2 overlays backed by the source's disks.
+	Full bool
+
+	// IPs replace the IPv4 addresses (CIDR notation) of the clone's network
+	// interfaces, in order.
+	IPs []string
+
+	// Patch is a partial VirtualMachine in YAML merged into the clone like a
+	// JSON merge patch: mappings are merged, lists and other values replace
+	// the source's, and null removes a field. Applied after IPs.
+	Patch []byte
+}
+
+// Clone creates a new VM named name from the stored spec and disks of the VM
+// source.
+//
+// The source must be shut off so its disks are consistent. With linked clones
+// (the default) the source's disks become read-only backing files of the
+// clone's: the source must stay shut off until the clone's disks have been
+// flattened with 'foundry disk flatten'. Full clones (opts.Full) copy the
+// disks and do not depend on the source.
+//
+// MAC addresses are regenerated, and the clone gets a fresh cloud-init ISO
+// whose instance-id is the new name, so cloud-init configures the copied
+// guest as a new instance. Static addresses must be changed with opts.IPs or
+// opts.Patch; the clone may not reuse the source's addresses.
+func Clone(ctx context.Context, source, name string, opts CloneOptions) (*CreateResult, error) {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	// Journal what is created so a crash mid-creation can be rolled back
+	ctx, endJournal := startJournal(ctx)
+	defer endJournal()
+
+	if err := cloneWithDeps(ctx, source, name, opts, LibvirtClient.Libvirt(), storageMgr, metaClient); err != nil {
+		return nil, err
+	}
+	return &CreateResult{VMName: name}, nil
+}
+
+// cloneWithDeps clones a VM with injected dependencies.
+// This allows for testing by accepting interfaces instead of concrete types.
+func cloneWithDeps(ctx context.Context, source, name string, opts CloneOptions, lv LibvirtClient, sm storageManager, mc *metadata.Client) error {
+	// Step 1: Load the source's stored spec
+	domain, err := lv.DomainLookupByName(source)
+	if err != nil {
+		return fmt.Errorf("VM '%s' not found: %w", source, err)
+	}
+	src, err := mc.Load(domain)
+	if err != nil {
+		return fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", source, err)
+	}
+
+	// Step 2: The source's disks must not change while they are copied or
+	// linked to, and must hold all of its data
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		return fmt.Errorf("failed to get VM state: %w", err)
+	}
+	if state != domainStateShutoff {
+		return fmt.Errorf("VM '%s' must be shut off to be cloned", source)
+	}
+	external, err := lv.DomainSnapshotNum(domain, uint32(libvirt.DomainSnapshotListExternal))
+	if err != nil {
+		return fmt.Errorf("failed to count snapshots: %w", err)
+	}
+	if external > 0 {
+		return fmt.Errorf("VM '%s' has %d external snapshot(s); delete them with 'foundry snapshot delete' before cloning", source, external)
+	}
+
+	// Step 3: Build and validate the clone's spec
+	clone, err := newCloneSpec(ctx, src, name, opts)
+	if err != nil {
+		return err
+	}
+
+	// Step 4: Create the clone with disks derived from the source's
+	logging.FromContext(ctx).Info("Cloning VM", "vm", source, "clone", name)
+	return createWithDisks(ctx, clone, lv, sm, mc, cloneDisks(src, opts.Full))
+}
+
+// newCloneSpec derives the spec of a clone named name from the stored spec
+// of src, applying the new addresses and patch of opts.
+func newCloneSpec(ctx context.Context, src *v1alpha1.VirtualMachine, name string, opts CloneOptions) (*v1alpha1.VirtualMachine, error) {
+	clone := src.DeepCopy()
+	clone.ObjectMeta = v1alpha1.ObjectMeta{
+		Name:        name,
+		Labels:      clone.Labels,
+		Annotations: clone.Annotations,
+	}
+	if clone.Annotations == nil {
+		clone.Annotations = make(map[string]string)
+	}
+	clone.Annotations[v1alpha1.AnnotationClonedFrom] = src.Name
+	// The clone's boot disk is backed by the source's, or by nothing for a
+	// full clone, not by the source's image
+	delete(clone.Annotations, v1alpha1.AnnotationBootImagePath)
+	delete(clone.Annotations, v1alpha1.AnnotationBootImageFingerprint)
+	clone.Status = v1alpha1.VirtualMachineStatus{}
+	v1alpha1.SetDefaultAPIVersion(clone)
+
+	// MAC addresses are regenerated under the source's naming strategy:
+	// derived from the new IPs, or random for DHCP interfaces by default
+	for i := range clone.Spec.NetworkInterfaces {
+		clone.Spec.NetworkInterfaces[i].MACAddress = ""
+	}
+
+	// The hostname follows the VM name when it was derived from it
+	if ci := clone.Spec.CloudInit; ci != nil {
+		if ci.FQDN == src.Name {
+			ci.FQDN = name
+		} else if domain, ok := strings.CutPrefix(ci.FQDN, src.Name+"."); ok {
+			ci.FQDN = name + "." + domain
+		}
+	}
+
+	if len(opts.IPs) > len(clone.Spec.NetworkInterfaces) {
+		return nil, fmt.Errorf("%d IPs given but VM '%s' has %d network interface(s)", len(opts.IPs), src.Name, len(clone.Spec.NetworkInterfaces))
+	}
+	for i, ip := range opts.IPs {
+		iface := &clone.Spec.NetworkInterfaces[i]
+		iface.IP = ip
+		iface.DHCP = false
+	}
+
+	if len(opts.Patch) > 0 {
+		patched, err := patchVM(clone, opts.Patch)
+		if err != nil {
+			return nil, err
+		}
+		clone = patched
+	}
+
+	// Validate the result like a config file
+	data, err := yaml.Marshal(clone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal clone spec: %w", err)
+	}
+	clone, err = loader.LoadFromYAML(ctx, data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clone spec: %w", err)
+	}
+	if clone.Name != name {
+		return nil, fmt.Errorf("the patch cannot change metadata.name")
+	}
+
+	if err := checkCloneAddresses(src, clone); err != nil {
+		return nil, err
+	}
+	if err := checkCloneDisks(src, clone); err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+// patchVM applies a YAML merge patch to vm.
+func patchVM(vm *v1alpha1.VirtualMachine, patch []byte) (*v1alpha1.VirtualMachine, error) {
+	var patchDoc map[string]interface{}
+	if err := yaml.Unmarshal(patch, &patchDoc); err != nil {
+		return nil, fmt.Errorf("failed to parse patch: %w", err)
+	}
+
+	data, err := yaml.Marshal(vm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal VM: %w", err)
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal VM: %w", err)
+	}
+
+	data, err = yaml.Marshal(mergePatch(doc, patchDoc))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal patched VM: %w", err)
+	}
+	var patched v1alpha1.VirtualMachine
+	if err := yaml.Unmarshal(data, &patched); err != nil {
+		return nil, fmt.Errorf("failed to apply patch: %w", err)
+	}
+	return &patched, nil
+}
+
+// mergePatch merges patch into doc following JSON merge patch (RFC 7386)
+// semantics.
+func mergePatch(doc, patch map[string]interface{}) map[string]interface{} {
+	if doc == nil {
+		doc = make(map[string]interface{})
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(doc, key)
+			continue
+		}
+		if patchMap, ok := value.(map[string]interface{}); ok {
+			docMap, _ := doc[key].(map[string]interface{})
+			doc[key] = mergePatch(docMap, patchMap)
+			continue
+		}
+		doc[key] = value
+	}
+	return doc
+}
+
+// checkCloneAddresses refuses clones that would reuse a static address of
+// the source.
+func checkCloneAddresses(src, clone *v1alpha1.VirtualMachine) error {
+	used := make(map[string]bool)
+	for _, iface := range src.Spec.NetworkInterfaces {
+		for _, addr := range []string{iface.IP, iface.IPv6} {
+			if ip := addressOf(addr); ip != "" {
+				used[ip] = true
+			}
+		}
+	}
+
+	for i, iface := range clone.Spec.NetworkInterfaces {
+		for _, addr := range []string{iface.IP, iface.IPv6} {
+			if ip := addressOf(addr); ip != "" && used[ip] {
+				return fmt.Errorf("network interface %d would reuse address %s of VM '%s'; set new addresses with --ip or a patch", i, ip, src.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// addressOf returns the address of a CIDR, or "" if cidr is empty or invalid.
+func addressOf(cidr string) string {
+	ip, _, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// checkCloneDisks refuses disk size changes: the clone's disks start as
+// copies of the source's, so grow them afterwards with 'foundry disk resize'.
+func checkCloneDisks(src, clone *v1alpha1.VirtualMachine) error {
+	if clone.Spec.BootDisk.SizeGB != src.Spec.BootDisk.SizeGB {
+		return fmt.Errorf("the boot disk size cannot be changed while cloning; use 'foundry disk resize' afterwards")
+	}
+	for _, disk := range clone.Spec.DataDisks {
+		for _, srcDisk := range src.Spec.DataDisks {
+			if srcDisk.Device == disk.Device && srcDisk.SizeGB != disk.SizeGB {
+				return fmt.Errorf("data disk %s size cannot be changed while cloning; use 'foundry disk resize' afterwards", disk.Device)
+			}
+		}
+	}
+	return nil
+}
+
+// cloneDisks returns a diskCreator that creates the clone's boot disk and the
+// data disks it shares with src from src's volumes: linked qcow2 overlays, or
+// full copies with full. Data disks src does not have are created empty.
+func cloneDisks(src *v1alpha1.VirtualMachine, full bool) diskCreator {
+	return func(ctx context.Context, vm *v1alpha1.VirtualMachine, sm storageManager) (bool, error) {
+		srcDataDisks := make(map[string]bool)
+		for _, disk := range src.Spec.DataDisks {
+			srcDataDisks[disk.Device] = true
+		}
+
+		bootSpec := storage.VolumeSpec{
+			Name:       getBootVolumeName(vm),
+			Type:       storage.VolumeTypeBoot,
+			Format:     getDiskFormat(vm),
+			CapacityGB: uint64(vm.Spec.BootDisk.SizeGB),
+		}
+		if err := cloneVolume(ctx, sm, getStoragePool(src), getBootVolumeName(src), getStoragePool(vm), bootSpec, full); err != nil {
+			return false, fmt.Errorf("failed to clone boot volume: %w", err)
+		}
+		emitProgress(ctx, VolumeCreated{VM: vm.Name, Pool: getStoragePool(vm), Volume: bootSpec.Name})
+
+		for _, disk := range vm.Spec.DataDisks {
+			dataSpec := storage.VolumeSpec{
+				Name:       getDataVolumeName(vm, disk.Device),
+				Type:       storage.VolumeTypeData,
+				Format:     getDiskFormat(vm),
+				CapacityGB: uint64(disk.SizeGB),
+			}
+
+			var err error
+			if srcDataDisks[disk.Device] {
+				err = cloneVolume(ctx, sm, getStoragePool(src), getDataVolumeName(src, disk.Device), getStoragePool(vm), dataSpec, full)
+			} else {
+				logging.FromContext(ctx).Info("Creating data disk volume", "vm", vm.Name, "device", disk.Device, "sizeGB", disk.SizeGB)
+				err = sm.CreateVolume(ctx, getStoragePool(vm), dataSpec)
+			}
+			if err != nil {
+				return true, fmt.Errorf("failed to create data volume %s: %w", disk.Device, err)
+			}
+			emitProgress(ctx, VolumeCreated{VM: vm.Name, Pool: getStoragePool(vm), Volume: dataSpec.Name})
+		}
+
+		return true, nil
+	}
+}
+
+// cloneVolume creates spec from a source volume: a full copy, or an overlay
+// backed by the source.
+func cloneVolume(ctx context.Context, sm storageManager, sourcePool, sourceName, pool string, spec storage.VolumeSpec, full bool) error {
+	logger := logging.FromContext(ctx)
+
+	// Raw volumes cannot be overlays, so they are always copied
+	if full || spec.Format == storage.VolumeFormatRaw {
+		logger.Info("Copying volume", "pool", sourcePool, "volume", sourceName, "to", spec.Name)
+		return sm.CloneVolume(ctx, pool, spec, sourcePool, sourceName)
+	}
+
+	backing, err := sm.GetVolumePath(ctx, sourcePool, sourceName)
+	if err != nil {
+		return err
+	}
+	logger.Info("Creating volume", "volume", spec.Name, "backing", backing)
+	spec.BackingVolume = backing
+	return sm.CreateVolume(ctx, pool, spec)
+}
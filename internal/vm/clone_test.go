@@ -0,0 +1,239 @@
+package vm
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// newCloneMocks returns mocks for a shut off source VM named "test-vm" whose
+// stored spec is src. Only the source domain exists.
+func newCloneMocks(t *testing.T, src *v1alpha1.VirtualMachine) (*mockLibvirtClient, *mockStorageManager) {
+	t.Helper()
+
+	lv, sm := newApplyMocks(t, src)
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		if name != src.Name {
+			return libvirt.Domain{}, libvirt.Error{Code: uint32(libvirt.ErrNoDomain)}
+		}
+		return libvirt.Domain{Name: name}, nil
+	}
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateShutoff, 0, nil
+	}
+	return lv, sm
+}
+
+func TestNewCloneSpec(t *testing.T) {
+	src := testVMConfigWithCloudInit()
+	src.Generation = 4
+	src.UID = "source-uid"
+	src.Annotations = map[string]string{v1alpha1.AnnotationOwner: "jane"}
+	src.Spec.NetworkInterfaces[0].MACAddress = "be:ef:00:00:00:01"
+	src.Spec.NetworkInterfaces = append(src.Spec.NetworkInterfaces, v1alpha1.NetworkInterfaceSpec{
+		Bridge:     "br1",
+		DHCP:       true,
+		MACAddress: "be:ef:00:00:00:02",
+	})
+	src.Status.Phase = v1alpha1.VMPhaseStopped
+
+	clone, err := newCloneSpec(context.Background(), src, "clone-vm", CloneOptions{IPs: []string{"10.0.0.11/24"}})
+	if err != nil {
+		t.Fatalf("newCloneSpec() error = %v", err)
+	}
+
+	if clone.Name != "clone-vm" || clone.UID != "" || clone.Generation != 0 {
+		t.Errorf("metadata not reset: name=%q uid=%q generation=%d", clone.Name, clone.UID, clone.Generation)
+	}
+	wantAnnotations := map[string]string{v1alpha1.AnnotationOwner: "jane", v1alpha1.AnnotationClonedFrom: "test-vm"}
+	if !reflect.DeepEqual(clone.Annotations, wantAnnotations) {
+		t.Errorf("Annotations = %v, want %v", clone.Annotations, wantAnnotations)
+	}
+	if clone.Status.Phase == v1alpha1.VMPhaseStopped {
+		t.Error("source status was copied")
+	}
+	if clone.Spec.CloudInit.FQDN != "clone-vm.example.com" {
+		t.Errorf("FQDN = %q, want clone-vm.example.com", clone.Spec.CloudInit.FQDN)
+	}
+	if got := clone.Spec.NetworkInterfaces[0].IP; got != "10.0.0.11/24" {
+		t.Errorf("IP = %q, want 10.0.0.11/24", got)
+	}
+	for i, iface := range clone.Spec.NetworkInterfaces {
+		if iface.MACAddress != "" {
+			t.Errorf("interface %d kept MAC %s", i, iface.MACAddress)
+		}
+	}
+
+	// The source is untouched
+	if src.Spec.NetworkInterfaces[0].IP != "10.0.0.10/24" || src.Name != "test-vm" {
+		t.Error("source spec was modified")
+	}
+}
+
+func TestNewCloneSpec_Patch(t *testing.T) {
+	src := testVMConfigWithDataDisks()
+	patch := []byte(`
+spec:
+  vcpus: 4
+  networkInterfaces:
+    - bridge: br0
+      ip: 10.0.0.20/24
+      gateway: 10.0.0.1
+      defaultRoute: true
+  autostart: null
+`)
+
+	clone, err := newCloneSpec(context.Background(), src, "clone-vm", CloneOptions{Patch: patch})
+	if err != nil {
+		t.Fatalf("newCloneSpec() error = %v", err)
+	}
+	if clone.Spec.VCPUs != 4 {
+		t.Errorf("VCPUs = %d, want 4", clone.Spec.VCPUs)
+	}
+	if clone.GetMemoryMiB() != src.GetMemoryMiB() {
+		t.Errorf("memory = %d MiB, want %d (unpatched fields are kept)", clone.GetMemoryMiB(), src.GetMemoryMiB())
+	}
+	if got := clone.Spec.NetworkInterfaces[0].IP; got != "10.0.0.20/24" {
+		t.Errorf("IP = %q, want 10.0.0.20/24", got)
+	}
+	if len(clone.Spec.DataDisks) != len(src.Spec.DataDisks) {
+		t.Errorf("DataDisks = %v, want %v", clone.Spec.DataDisks, src.Spec.DataDisks)
+	}
+}
+
+func TestNewCloneSpec_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    CloneOptions
+		wantErr string
+	}{
+		{name: "reused static IP", wantErr: "would reuse address 10.0.0.10"},
+		{name: "reused IP with another prefix", opts: CloneOptions{IPs: []string{"10.0.0.10/16"}}, wantErr: "would reuse address"},
+		{name: "too many IPs", opts: CloneOptions{IPs: []string{"10.0.0.11/24", "10.0.0.12/24"}}, wantErr: "2 IPs given"},
+		{name: "invalid patch", opts: CloneOptions{IPs: []string{"10.0.0.11/24"}, Patch: []byte("spec: [")}, wantErr: "failed to parse patch"},
+		{name: "renamed by patch", opts: CloneOptions{IPs: []string{"10.0.0.11/24"}, Patch: []byte("metadata:\n  name: other\n")}, wantErr: "cannot change metadata.name"},
+		{name: "boot disk resized", opts: CloneOptions{IPs: []string{"10.0.0.11/24"}, Patch: []byte("spec:\n  bootDisk:\n    sizeGB: 40\n")}, wantErr: "boot disk size cannot be changed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newCloneSpec(context.Background(), testVMConfig(), "clone-vm", tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("newCloneSpec() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCloneWithDeps_Linked(t *testing.T) {
+	src := testVMConfigWithDataDisks()
+	lv, sm := newCloneMocks(t, src)
+
+	opts := CloneOptions{
+		IPs:   []string{"10.0.0.11/24"},
+		Patch: []byte("spec:\n  dataDisks:\n    - device: vdb\n      sizeGB: 50\n    - device: vdz\n      sizeGB: 5\n"),
+	}
+	if err := cloneWithDeps(context.Background(), "test-vm", "clone-vm", opts, lv, sm, newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("cloneWithDeps() error = %v", err)
+	}
+
+	wantVolumes := []storage.VolumeSpec{
+		{
+			Name:          "clone-vm_boot.qcow2",
+			Type:          storage.VolumeTypeBoot,
+			Format:        storage.VolumeFormatQCOW2,
+			CapacityGB:    20,
+			BackingVolume: "/var/lib/libvirt/images/foundry/foundry-vms/test-vm_boot.qcow2",
+		},
+		{
+			Name:          "clone-vm_data-vdb.qcow2",
+			Type:          storage.VolumeTypeData,
+			Format:        storage.VolumeFormatQCOW2,
+			CapacityGB:    50,
+			BackingVolume: "/var/lib/libvirt/images/foundry/foundry-vms/test-vm_data-vdb.qcow2",
+		},
+		{
+			Name:       "clone-vm_data-vdz.qcow2",
+			Type:       storage.VolumeTypeData,
+			Format:     storage.VolumeFormatQCOW2,
+			CapacityGB: 5,
+		},
+	}
+	if !reflect.DeepEqual(sm.createVolumeCalls, wantVolumes) {
+		t.Errorf("created volumes = %+v\nwant %+v", sm.createVolumeCalls, wantVolumes)
+	}
+	if len(sm.cloneVolumeCalls) != 0 {
+		t.Errorf("unexpected full copies: %v", sm.cloneVolumeCalls)
+	}
+	if len(lv.domainDefineXMLCalls) != 1 || !strings.Contains(lv.domainDefineXMLCalls[0], "<name>clone-vm</name>") {
+		t.Errorf("expected clone-vm to be defined, got %v", lv.domainDefineXMLCalls)
+	}
+}
+
+func TestCloneWithDeps_Full(t *testing.T) {
+	src := testVMConfigWithDataDisks()
+	lv, sm := newCloneMocks(t, src)
+
+	opts := CloneOptions{Full: true, IPs: []string{"10.0.0.11/24"}}
+	if err := cloneWithDeps(context.Background(), "test-vm", "clone-vm", opts, lv, sm, newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("cloneWithDeps() error = %v", err)
+	}
+
+	want := []string{"foundry-vms/test-vm_boot.qcow2 -> foundry-vms/clone-vm_boot.qcow2"}
+	for _, disk := range src.Spec.DataDisks {
+		want = append(want, "foundry-vms/test-vm_data-"+disk.Device+".qcow2 -> foundry-vms/clone-vm_data-"+disk.Device+".qcow2")
+	}
+	if !reflect.DeepEqual(sm.cloneVolumeCalls, want) {
+		t.Errorf("cloned volumes = %v, want %v", sm.cloneVolumeCalls, want)
+	}
+	for _, spec := range sm.createVolumeCalls {
+		if spec.Type != storage.VolumeTypeCloudInit {
+			t.Errorf("unexpected volume created: %+v", spec)
+		}
+	}
+}
+
+func TestCloneWithDeps_SourceRunning(t *testing.T) {
+	lv, sm := newCloneMocks(t, testVMConfig())
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateRunning, 0, nil
+	}
+
+	err := cloneWithDeps(context.Background(), "test-vm", "clone-vm", CloneOptions{IPs: []string{"10.0.0.11/24"}}, lv, sm, newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "must be shut off") {
+		t.Errorf("cloneWithDeps() error = %v, want shut off error", err)
+	}
+	if len(sm.createVolumeCalls) != 0 {
+		t.Error("expected no volumes to be created")
+	}
+}
+
+func TestCloneWithDeps_CleansUpOnFailure(t *testing.T) {
+	lv, sm := newCloneMocks(t, testVMConfig())
+	lv.domainDefineXMLFunc = func(xml string) (libvirt.Domain, error) {
+		return libvirt.Domain{}, libvirt.Error{Code: uint32(libvirt.ErrInternalError), Message: "define failed"}
+	}
+
+	err := cloneWithDeps(context.Background(), "test-vm", "clone-vm", CloneOptions{IPs: []string{"10.0.0.11/24"}}, lv, sm, newMockMetadataClient(lv))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	found := false
+	for _, call := range sm.deleteVolumeCalls {
+		if call == "foundry-vms/clone-vm_boot.qcow2" {
+			found = true
+		}
+		if strings.Contains(call, "test-vm") {
+			t.Errorf("source volume deleted: %s", call)
+		}
+	}
+	if !found {
+		t.Errorf("expected clone boot volume cleanup, got %v", sm.deleteVolumeCalls)
+	}
+}
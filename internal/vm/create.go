@@ -4,26 +4,34 @@ package vm
 import (
 	"context"
 	"fmt"
-	"log"
 	"strings"
+	"time"
 
 	"github.com/digitalocean/go-libvirt"
+	"github.com/google/uuid"
 
 	"github.com/jbweber/foundry/api/v1alpha1"
 	"github.com/jbweber/foundry/internal/cloudinit"
+	"github.com/jbweber/foundry/internal/history"
 	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
 	"github.com/jbweber/foundry/internal/loader"
+	"github.com/jbweber/foundry/internal/logging"
 	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/metrics"
 	"github.com/jbweber/foundry/internal/naming"
+	"github.com/jbweber/foundry/internal/status"
 	"github.com/jbweber/foundry/internal/storage"
+	"github.com/jbweber/foundry/internal/timing"
 )
 
 // Helper functions for volume naming
 func getStoragePool(vm *v1alpha1.VirtualMachine) string {
-	if vm.Spec.StoragePool == "" {
-		return "foundry-vms"
-	}
-	return vm.Spec.StoragePool
+	return vm.GetStoragePool()
+}
+
+// getDiskFormat returns the volume format of the VM's boot and data disks.
+func getDiskFormat(vm *v1alpha1.VirtualMachine) storage.VolumeFormat {
+	return storage.VolumeFormat(vm.GetBootDiskFormat())
 }
 
 func getBootVolumeName(vm *v1alpha1.VirtualMachine) string {
@@ -40,7 +48,7 @@ func getCloudInitVolumeName(vm *v1alpha1.VirtualMachine) string {
 
 // parseImageReference parses an image reference and returns the pool and volume names.
 // Supports three formats:
-//   - Volume name only: "fedora-43.qcow2" -> uses ImagePool (or "foundry-images" default)
+//   - Volume name only: "fedora-43.qcow2" -> uses ImagePool (or the default image pool)
 //   - Pool:volume format: "foundry-images:fedora-43.qcow2" -> explicit pool and volume
 //   - File path: "/var/lib/libvirt/images/fedora.qcow2" -> returns empty strings (backward compat)
 //
@@ -72,7 +80,7 @@ func parseImageReference(bootDisk v1alpha1.BootDiskSpec) (string, string, bool,
 	// Just a volume name - use ImagePool (or default)
 	imagePool := bootDisk.ImagePool
 	if imagePool == "" {
-		imagePool = "foundry-images"
+		imagePool = v1alpha1.GetHostDefaults().ImagePool
 	}
 	return imagePool, bootDisk.Image, false, nil
 }
@@ -82,61 +90,184 @@ func parseImageReference(bootDisk v1alpha1.BootDiskSpec) (string, string, bool,
 // This orchestrates the entire VM creation process:
 //  1. Load and validate configuration
 //  2. Connect to libvirt
-//  3. Pre-flight checks (VM exists, disk space, etc.)
+//  3. Pre-flight checks (VM exists, bridges and networks exist, pool space,
+//     host vCPUs and memory; see ErrPreflight)
 //  4. Create storage (directories, disks, cloud-init ISO)
 //  5. Define domain in libvirt
 //  6. Set autostart and start VM
 //
 // On any failure, attempts to clean up partially created resources.
 //
+// If the configuration sets metadata.generateName instead of metadata.name,
+// a unique name is generated; the final name is returned in the result.
+//
+// Pass WithProgress to be told about each step as it completes,
+// SkipPreflight to create the VM even if the host checks of step 3 fail, and
+// Ensure to succeed without doing anything if the VM already exists as
+// configured.
+//
 // Returns an error if any step fails.
-func Create(ctx context.Context, configPath string) error {
+func Create(ctx context.Context, configPath string, opts ...CreateOption) (*CreateResult, error) {
 	// Load and validate configuration
-	vm, err := loader.LoadFromFile(configPath)
+	vm, err := loader.LoadFromFile(ctx, configPath)
 	if err != nil {
-		return fmt.Errorf("failed to load configuration: %w", err)
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
 	}
 
-	return CreateFromConfig(ctx, vm)
+	return CreateFromConfig(ctx, vm, opts...)
+}
+
+// CreateResult describes a VM created by Create.
+type CreateResult struct {
+	// VMName is the name of the created VM. It differs from the configured
+	// name only when the name was generated from metadata.generateName.
+	VMName string
+
+	// Existed is true if, with Ensure, the VM already existed with the same
+	// spec and nothing was done.
+	Existed bool
 }
 
 // CreateFromConfig creates a VM from an already-loaded configuration.
 //
 // This is useful for testing and for callers that already have a config object.
 // See Create() for the full workflow description.
-func CreateFromConfig(ctx context.Context, vm *v1alpha1.VirtualMachine) error {
+func CreateFromConfig(ctx context.Context, vm *v1alpha1.VirtualMachine, opts ...CreateOption) (*CreateResult, error) {
+	ctx = withCreateOptions(ctx, opts)
+	logger := logging.FromContext(ctx)
+
 	// Connect to libvirt
-	log.Printf("Connecting to libvirt...")
+	logger.Debug("Connecting to libvirt")
 	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
 	if err != nil {
-		return fmt.Errorf("failed to connect to libvirt: %w", err)
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
 	}
 	defer func() {
 		if err := LibvirtClient.Close(); err != nil {
-			log.Printf("Warning: failed to close libvirt connection: %v", err)
+			logger.Warn("Failed to close libvirt connection", "error", err)
 		}
 	}()
 
 	// Create storage manager
-	log.Printf("Initializing storage manager...")
+	logger.Debug("Initializing storage manager")
 	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
 
 	// Create metadata client
 	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
 
 	// Ensure default pools exist
-	log.Printf("Ensuring default storage pools exist...")
+	logger.Debug("Ensuring default storage pools exist")
 	if err := storageMgr.EnsureDefaultPools(ctx); err != nil {
-		return fmt.Errorf("failed to ensure default pools: %w", err)
+		return nil, fmt.Errorf("failed to ensure default pools: %w", err)
 	}
 
+	// With Ensure, a VM that already exists as configured is left alone
+	if createOptionsFrom(ctx).ensure {
+		existed, err := existsUnchanged(ctx, vm, LibvirtClient.Libvirt(), metaClient)
+		if err != nil {
+			return nil, err
+		}
+		if existed {
+			return &CreateResult{VMName: vm.Name, Existed: true}, nil
+		}
+	}
+
+	// Journal what is created so a crash mid-creation can be rolled back
+	ctx, endJournal := startJournal(ctx)
+	defer endJournal()
+
 	// Delegate to internal function with dependencies
-	return createFromConfigWithDeps(ctx, vm, LibvirtClient.Libvirt(), storageMgr, metaClient)
+	if err := createFromConfigWithDeps(ctx, vm, LibvirtClient.Libvirt(), storageMgr, metaClient); err != nil {
+		return nil, err
+	}
+	return &CreateResult{VMName: vm.Name}, nil
 }
 
+// cloudInitCapacityGB returns the capacity of the volume holding a cloud-init
+// ISO of the given size, rounded up to whole GB.
+func cloudInitCapacityGB(isoSize int) uint64 {
+	// Calculate ISO size in bytes and round up to nearest MB for capacity
+	isoSizeBytes := uint64(isoSize)
+	isoSizeMB := (isoSizeBytes + 1024*1024 - 1) / (1024 * 1024) // Round up
+	isoSizeGB := (isoSizeMB + 1024 - 1) / 1024                  // Round up to nearest GB
+	if isoSizeGB == 0 {
+		isoSizeGB = 1 // Minimum 1 GB for small ISOs
+	}
+	return isoSizeGB
+}
+
+// maxGenerateNameAttempts bounds how many generated names are tried before
+// giving up on finding one that is not in use.
+const maxGenerateNameAttempts = 10
+
+// resolveGeneratedName sets vm.Name from vm.GenerateName when no name is
+// configured, retrying until the name collides with neither an existing
+// domain nor an existing boot volume.
+func resolveGeneratedName(ctx context.Context, vm *v1alpha1.VirtualMachine, lv LibvirtClient, sm storageManager) error {
+	if vm.Name != "" || vm.GenerateName == "" {
+		return nil
+	}
+
+	for attempt := 0; attempt < maxGenerateNameAttempts; attempt++ {
+		name := naming.GenerateName(vm.GenerateName)
+		if _, err := lv.DomainLookupByName(name); err == nil {
+			continue
+		}
+		exists, err := sm.VolumeExists(ctx, getStoragePool(vm), naming.VolumeNameBoot(name))
+		if err != nil {
+			return fmt.Errorf("failed to check boot volume: %w", err)
+		}
+		if exists {
+			continue
+		}
+
+		vm.Name = name
+		logging.FromContext(ctx).Info("Generated VM name", "vm", name, "prefix", vm.GenerateName)
+		return nil
+	}
+
+	return fmt.Errorf("failed to generate a unique name with prefix '%s' after %d attempts", vm.GenerateName, maxGenerateNameAttempts)
+}
+
+// diskCreator creates the boot and data disk volumes of a new VM. It reports
+// whether any volume was created, so that a failure is cleaned up.
+type diskCreator func(ctx context.Context, vm *v1alpha1.VirtualMachine, sm storageManager) (bool, error)
+
 // createFromConfigWithDeps creates a VM with injected dependencies.
 // This allows for testing by accepting interfaces instead of concrete types.
 func createFromConfigWithDeps(ctx context.Context, vm *v1alpha1.VirtualMachine, lv LibvirtClient, sm storageManager, mc *metadata.Client) error {
+	return createWithDisks(ctx, vm, lv, sm, mc, createDiskVolumes)
+}
+
+// createWithDisks creates a VM whose disk volumes are created by createDisks,
+// counting the creation and its failure in the metrics.
+func createWithDisks(ctx context.Context, vm *v1alpha1.VirtualMachine, lv LibvirtClient, sm storageManager, mc *metadata.Client, createDisks diskCreator) error {
+	metrics.VMCreates.Inc()
+	if err := provisionWithDisks(ctx, vm, lv, sm, mc, createDisks); err != nil {
+		metrics.VMCreateFailures.Inc()
+		return err
+	}
+	return nil
+}
+
+// provisionWithDisks does the steps of createWithDisks.
+func provisionWithDisks(ctx context.Context, vm *v1alpha1.VirtualMachine, lv LibvirtClient, sm storageManager, mc *metadata.Client, createDisks diskCreator) error {
+	logger := logging.FromContext(ctx)
+
+	// Resolve metadata.generateName before anything is named after the VM
+	if err := resolveGeneratedName(ctx, vm, lv, sm); err != nil {
+		return err
+	}
+	if vm.CreationTimestamp.IsZero() {
+		vm.CreationTimestamp = v1alpha1.Time{Time: time.Now()}
+	}
+	if err := assignMACAddresses(vm); err != nil {
+		return err
+	}
+	if err := resolveVFAddresses(vm, lv); err != nil {
+		return err
+	}
+
 	// State tracking for cleanup
 	var (
 		domainDefined  bool
@@ -147,12 +278,15 @@ func createFromConfigWithDeps(ctx context.Context, vm *v1alpha1.VirtualMachine,
 	var createErr error
 	defer func() {
 		if createErr != nil {
+			status.MarkFailed(vm, "CreateFailed", createErr.Error())
+			emitProgress(ctx, CleanupStarted{VM: vm.Name, Err: createErr})
+			metrics.CleanupAttempts.Inc()
 			cleanupWithDeps(ctx, vm, sm, lv, domainDefined, storageCreated)
 		}
 	}()
 
 	// Step 1: Check if VM already exists
-	log.Printf("Checking if VM '%s' already exists...", vm.Name)
+	logger.Debug("Checking if VM already exists", "vm", vm.Name)
 	_, err := lv.DomainLookupByName(vm.Name)
 	if err == nil {
 		createErr = fmt.Errorf("VM '%s' already exists", vm.Name)
@@ -161,7 +295,7 @@ func createFromConfigWithDeps(ctx context.Context, vm *v1alpha1.VirtualMachine,
 	// Note: DomainLookupByName returns error if not found (which is what we want)
 
 	// Step 2: Check if boot volume already exists (pre-flight check)
-	log.Printf("Checking if boot volume already exists...")
+	logger.Debug("Checking if boot volume already exists", "vm", vm.Name)
 	exists, createErr := sm.VolumeExists(ctx, getStoragePool(vm), getBootVolumeName(vm))
 	if createErr != nil {
 		return fmt.Errorf("failed to check boot volume: %w", createErr)
@@ -171,107 +305,37 @@ func createFromConfigWithDeps(ctx context.Context, vm *v1alpha1.VirtualMachine,
 		return createErr
 	}
 
-	// Step 3: Parse image reference and get backing image path (if specified)
-	var backingVolume string
-	if vm.Spec.BootDisk.Image != "" && !vm.Spec.BootDisk.Empty {
-		imagePool, imageName, isFilePath, parseErr := parseImageReference(vm.Spec.BootDisk)
-		if parseErr != nil {
-			createErr = parseErr
-			return fmt.Errorf("failed to parse image reference: %w", createErr)
+	// Check that the host can run the VM before creating anything
+	if !createOptionsFrom(ctx).skipPreflight {
+		if createErr = preflight(ctx, vm, lv, sm); createErr != nil {
+			return createErr
 		}
-
-		if isFilePath {
-			// File path - use as-is for backward compatibility
-			backingVolume = vm.Spec.BootDisk.Image
-			log.Printf("Using backing image (file): %s", backingVolume)
-		} else {
-			// Pool-based image - verify it exists and get path
-			log.Printf("Checking if backing image exists: %s:%s", imagePool, imageName)
-			imageExists, checkErr := sm.ImageExists(ctx, imageName)
-			if checkErr != nil {
-				createErr = checkErr
-				return fmt.Errorf("failed to check if image exists: %w", createErr)
-			}
-			if !imageExists {
-				createErr = fmt.Errorf("backing image not found: %s (pool: %s). Import it with 'foundry image import'", imageName, imagePool)
-				return createErr
-			}
-
-			// Get the filesystem path to the image volume
-			backingVolume, createErr = sm.GetImagePath(ctx, imageName)
-			if createErr != nil {
-				return fmt.Errorf("failed to get image path: %w", createErr)
-			}
-			log.Printf("Using backing image (volume): %s", backingVolume)
-		}
-	}
-
-	// Step 4: Create boot disk volume
-	log.Printf("Creating boot disk volume (%dGB)...", vm.Spec.BootDisk.SizeGB)
-	bootSpec := storage.VolumeSpec{
-		Name:          getBootVolumeName(vm),
-		Type:          storage.VolumeTypeBoot,
-		Format:        storage.VolumeFormatQCOW2,
-		CapacityGB:    uint64(vm.Spec.BootDisk.SizeGB),
-		BackingVolume: backingVolume,
-	}
-	if createErr = sm.CreateVolume(ctx, getStoragePool(vm), bootSpec); createErr != nil {
-		return fmt.Errorf("failed to create boot volume: %w", createErr)
 	}
-	storageCreated = true
 
-	// Step 5: Create data disk volumes
-	for _, dataDisk := range vm.Spec.DataDisks {
-		log.Printf("Creating data disk volume %s (%dGB)...", dataDisk.Device, dataDisk.SizeGB)
-		dataSpec := storage.VolumeSpec{
-			Name:       getDataVolumeName(vm, dataDisk.Device),
-			Type:       storage.VolumeTypeData,
-			Format:     storage.VolumeFormatQCOW2,
-			CapacityGB: uint64(dataDisk.SizeGB),
-		}
-		if createErr = sm.CreateVolume(ctx, getStoragePool(vm), dataSpec); createErr != nil {
-			return fmt.Errorf("failed to create data volume %s: %w", dataDisk.Device, createErr)
-		}
+	// Steps 3-5: Create the boot and data disk volumes
+	storageCreated, createErr = createDisks(ctx, vm, sm)
+	if createErr != nil {
+		status.MarkStorageFailed(vm, createErr)
+		return createErr
 	}
+	status.MarkStorageProvisioned(vm)
 
 	// Step 6: Generate and create cloud-init ISO volume (if configured)
-	if vm.Spec.CloudInit != nil {
-		log.Printf("Generating cloud-init ISO...")
-		var isoData []byte
-		isoData, createErr = cloudinit.GenerateISO(vm)
-		if createErr != nil {
-			return fmt.Errorf("failed to generate cloud-init ISO: %w", createErr)
-		}
-
-		log.Printf("Creating cloud-init ISO volume...")
-		// Calculate ISO size in bytes and round up to nearest MB for capacity
-		isoSizeBytes := uint64(len(isoData))
-		isoSizeMB := (isoSizeBytes + 1024*1024 - 1) / (1024 * 1024) // Round up
-		isoSizeGB := (isoSizeMB + 1024 - 1) / 1024                  // Round up to nearest GB
-		if isoSizeGB == 0 {
-			isoSizeGB = 1 // Minimum 1 GB for small ISOs
-		}
-
-		cloudInitSpec := storage.VolumeSpec{
-			Name:       getCloudInitVolumeName(vm),
-			Type:       storage.VolumeTypeCloudInit,
-			Format:     storage.VolumeFormatRaw,
-			CapacityGB: isoSizeGB,
-		}
-		if createErr = sm.CreateVolume(ctx, getStoragePool(vm), cloudInitSpec); createErr != nil {
-			return fmt.Errorf("failed to create cloud-init volume: %w", createErr)
-		}
-
-		log.Printf("Writing cloud-init data to volume...")
-		if createErr = sm.WriteVolumeData(ctx, getStoragePool(vm), getCloudInitVolumeName(vm), isoData); createErr != nil {
-			return fmt.Errorf("failed to write cloud-init data: %w", createErr)
+	if vm.HasCloudInitISO() {
+		if createErr = createCloudInitVolume(ctx, vm, sm); createErr != nil {
+			status.MarkCloudInitFailed(vm, createErr)
+			return createErr
 		}
+		status.MarkCloudInitReady(vm)
+	} else if vm.Spec.CloudInit != nil {
+		logger.Info("Skipping cloud-init ISO (seed served over HTTP)", "vm", vm.Name, "url", vm.GetCloudInitSeedURL())
+		status.MarkCloudInitServed(vm, vm.GetCloudInitSeedURL())
 	} else {
-		log.Printf("Skipping cloud-init (not configured)")
+		logger.Info("Skipping cloud-init (not configured)", "vm", vm.Name)
 	}
 
 	// Step 9: Generate domain XML
-	log.Printf("Generating domain XML...")
+	logger.Debug("Generating domain XML", "vm", vm.Name)
 	var domainXML string
 	domainXML, createErr = foundrylibvirt.GenerateDomainXML(vm)
 	if createErr != nil {
@@ -279,38 +343,204 @@ func createFromConfigWithDeps(ctx context.Context, vm *v1alpha1.VirtualMachine,
 	}
 
 	// Step 10: Define domain in libvirt
-	log.Printf("Defining domain in libvirt...")
+	logger.Info("Defining domain in libvirt", "vm", vm.Name)
 	var domain libvirt.Domain
+	endDefine := timing.Start("define domain")
 	domain, createErr = lv.DomainDefineXML(domainXML)
+	endDefine()
 	if createErr != nil {
 		return fmt.Errorf("failed to define domain: %w", createErr)
 	}
 	domainDefined = true
+	status.MarkNetworkConfigured(vm)
+	emitProgress(ctx, DomainDefined{VM: vm.Name, UUID: uuid.UUID(domain.UUID).String()})
 
 	// Step 11: Set autostart
 	autostartValue := 1
-	if vm.Spec.Autostart != nil && !*vm.Spec.Autostart {
+	if !libvirtAutostart(vm) {
 		autostartValue = 0
 	}
-	log.Printf("Setting autostart to %d...", autostartValue)
+	logger.Debug("Setting autostart", "vm", vm.Name, "autostart", autostartValue)
 	if createErr = lv.DomainSetAutostart(domain, int32(autostartValue)); createErr != nil {
 		return fmt.Errorf("failed to set autostart: %w", createErr)
 	}
 
 	// Step 12: Start VM
-	log.Printf("Starting VM...")
-	if createErr = lv.DomainCreate(domain); createErr != nil {
+	logger.Info("Starting VM", "vm", vm.Name)
+	endStart := timing.Start("start domain")
+	createErr = lv.DomainCreate(domain)
+	endStart()
+	if createErr != nil {
 		return fmt.Errorf("failed to start domain: %w", createErr)
 	}
+	emitProgress(ctx, Started{VM: vm.Name})
 
-	// Step 13: Store VM metadata in libvirt domain
-	log.Printf("Storing VM metadata...")
+	// Step 13: Store VM metadata in libvirt domain, with the status of the
+	// now running VM
+	setStatus(vm, domain, domainStateRunning)
+	vm.UpdateObservedGeneration()
+	logger.Debug("Storing VM metadata", "vm", vm.Name)
 	if createErr = mc.Store(domain, vm); createErr != nil {
-		log.Printf("Warning: failed to store VM metadata: %v", createErr)
+		logger.Warn("Failed to store VM metadata", "vm", vm.Name, "error", createErr)
 		// Don't fail the creation if metadata storage fails - VM is already running
 	}
 
-	log.Printf("VM '%s' created successfully!", vm.Name)
+	for i := range vm.Spec.NetworkInterfaces {
+		warnLinuxBridgeVLAN(ctx, vm, &vm.Spec.NetworkInterfaces[i])
+	}
+
+	history.Record(ctx, vm.Name, history.TypeCreated, "")
+	logger.Info("VM created", "vm", vm.Name)
+	return nil
+}
+
+// createDiskVolumes creates the boot disk volume, backed by the configured
+// image, and empty data disk volumes.
+func createDiskVolumes(ctx context.Context, vm *v1alpha1.VirtualMachine, sm storageManager) (bool, error) {
+	logger := logging.FromContext(ctx)
+
+	bootSpec, err := bootVolumeSpec(ctx, vm, sm)
+	if err != nil {
+		return false, err
+	}
+
+	// Create boot disk volume
+	logger.Info("Creating boot disk volume", "vm", vm.Name, "sizeGB", vm.Spec.BootDisk.SizeGB)
+	if err := sm.CreateVolume(ctx, getStoragePool(vm), bootSpec); err != nil {
+		return false, fmt.Errorf("failed to create boot volume: %w", err)
+	}
+	emitProgress(ctx, VolumeCreated{VM: vm.Name, Pool: getStoragePool(vm), Volume: bootSpec.Name})
+
+	// Create data disk volumes
+	for _, dataDisk := range vm.Spec.DataDisks {
+		logger.Info("Creating data disk volume", "vm", vm.Name, "device", dataDisk.Device, "sizeGB", dataDisk.SizeGB)
+		if err := sm.CreateVolume(ctx, getStoragePool(vm), dataVolumeSpec(vm, dataDisk)); err != nil {
+			return true, fmt.Errorf("failed to create data volume %s: %w", dataDisk.Device, err)
+		}
+		emitProgress(ctx, VolumeCreated{VM: vm.Name, Pool: getStoragePool(vm), Volume: getDataVolumeName(vm, dataDisk.Device)})
+	}
+
+	return true, nil
+}
+
+// bootVolumeSpec returns the spec of the boot disk volume, backed by the
+// configured image after checking that it exists. Raw boot disks cannot have
+// a backing image, so they are created as a copy of it instead.
+func bootVolumeSpec(ctx context.Context, vm *v1alpha1.VirtualMachine, sm storageManager) (storage.VolumeSpec, error) {
+	logger := logging.FromContext(ctx)
+
+	// Parse image reference and get backing image path (if specified)
+	var backingVolume string
+	if vm.Spec.BootDisk.Image != "" && !vm.Spec.BootDisk.Empty {
+		imagePool, imageName, isFilePath, err := parseImageReference(vm.Spec.BootDisk)
+		if err != nil {
+			return storage.VolumeSpec{}, fmt.Errorf("failed to parse image reference: %w", err)
+		}
+
+		if isFilePath {
+			// File path - use as-is for backward compatibility
+			backingVolume = vm.Spec.BootDisk.Image
+			logger.Debug("Using backing image file", "image", backingVolume)
+		} else {
+			// Pool-based image - verify it exists and get path
+			logger.Debug("Checking if backing image exists", "pool", imagePool, "image", imageName)
+			imageExists, err := sm.ImageExists(ctx, imageName)
+			if err != nil {
+				return storage.VolumeSpec{}, fmt.Errorf("failed to check if image exists: %w", err)
+			}
+			if !imageExists {
+				return storage.VolumeSpec{}, fmt.Errorf("backing image not found: %s (pool: %s). Import it with 'foundry image import'", imageName, imagePool)
+			}
+
+			// Get the filesystem path to the image volume
+			backingVolume, err = sm.GetImagePath(ctx, imageName)
+			if err != nil {
+				return storage.VolumeSpec{}, fmt.Errorf("failed to get image path: %w", err)
+			}
+			logger.Debug("Using backing image volume", "image", backingVolume)
+
+			recordImageMetadata(ctx, vm, sm, imageName)
+			recordBootImage(ctx, vm, sm, imageName, backingVolume)
+		}
+	}
+
+	spec := storage.VolumeSpec{
+		Name:       getBootVolumeName(vm),
+		Type:       storage.VolumeTypeBoot,
+		Format:     getDiskFormat(vm),
+		CapacityGB: uint64(vm.Spec.BootDisk.SizeGB),
+	}
+	if spec.Format == storage.VolumeFormatRaw {
+		spec.SourceVolume = backingVolume
+	} else {
+		spec.BackingVolume = backingVolume
+	}
+	return spec, nil
+}
+
+// recordImageMetadata annotates the VM with the default login user and OS
+// variant recorded for its boot image, unless the annotations are already
+// set. They are only conveniences, so failing to read them is not an error.
+func recordImageMetadata(ctx context.Context, vm *v1alpha1.VirtualMachine, sm storageManager, imageName string) {
+	if vm.GetDefaultUser() != "" && vm.GetOSVariant() != "" {
+		return
+	}
+	meta, err := sm.GetImageMetadata(ctx, imageName)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Failed to read image metadata", "image", imageName, "error", err)
+		return
+	}
+	for key, value := range map[string]string{
+		v1alpha1.AnnotationDefaultUser: meta.DefaultUser,
+		v1alpha1.AnnotationOSVariant:   meta.OSVariant,
+	} {
+		if value == "" || vm.Annotations[key] != "" {
+			continue
+		}
+		if vm.Annotations == nil {
+			vm.Annotations = make(map[string]string)
+		}
+		vm.Annotations[key] = value
+	}
+}
+
+// dataVolumeSpec returns the spec of an empty data disk volume.
+func dataVolumeSpec(vm *v1alpha1.VirtualMachine, disk v1alpha1.DataDiskSpec) storage.VolumeSpec {
+	return storage.VolumeSpec{
+		Name:       getDataVolumeName(vm, disk.Device),
+		Type:       storage.VolumeTypeData,
+		Format:     getDiskFormat(vm),
+		CapacityGB: uint64(disk.SizeGB),
+	}
+}
+
+// createCloudInitVolume generates the cloud-init ISO of a VM and writes it
+// to a new volume.
+func createCloudInitVolume(ctx context.Context, vm *v1alpha1.VirtualMachine, sm storageManager) error {
+	logger := logging.FromContext(ctx)
+
+	logger.Debug("Generating cloud-init ISO", "vm", vm.Name)
+	isoData, err := cloudinit.GenerateISO(vm)
+	if err != nil {
+		return fmt.Errorf("failed to generate cloud-init ISO: %w", err)
+	}
+
+	logger.Info("Creating cloud-init ISO volume", "vm", vm.Name)
+	cloudInitSpec := storage.VolumeSpec{
+		Name:       getCloudInitVolumeName(vm),
+		Type:       storage.VolumeTypeCloudInit,
+		Format:     storage.VolumeFormatRaw,
+		CapacityGB: cloudInitCapacityGB(len(isoData)),
+	}
+	if err := sm.CreateVolume(ctx, getStoragePool(vm), cloudInitSpec); err != nil {
+		return fmt.Errorf("failed to create cloud-init volume: %w", err)
+	}
+	emitProgress(ctx, VolumeCreated{VM: vm.Name, Pool: getStoragePool(vm), Volume: cloudInitSpec.Name})
+
+	logger.Debug("Writing cloud-init data to volume", "vm", vm.Name)
+	if err := sm.WriteVolumeData(ctx, getStoragePool(vm), getCloudInitVolumeName(vm), isoData); err != nil {
+		return fmt.Errorf("failed to write cloud-init data: %w", err)
+	}
 	return nil
 }
 
@@ -320,55 +550,57 @@ func createFromConfigWithDeps(ctx context.Context, vm *v1alpha1.VirtualMachine,
 // This is best-effort: it logs errors but continues trying to clean up
 // as much as possible. It never returns an error.
 func cleanupWithDeps(ctx context.Context, vm *v1alpha1.VirtualMachine, sm storageManager, lv LibvirtClient, domainDefined, storageCreated bool) {
-	log.Printf("Cleaning up after failed VM creation...")
+	logger := logging.FromContext(ctx)
+
+	logger.Info("Cleaning up after failed VM creation", "vm", vm.Name)
 
 	// Clean up libvirt domain if it was defined
 	if domainDefined && lv != nil {
-		log.Printf("Undefining domain '%s'...", vm.Name)
+		logger.Info("Undefining domain", "vm", vm.Name)
 		domain, err := lv.DomainLookupByName(vm.Name)
 		if err != nil {
-			log.Printf("Warning: failed to lookup domain for cleanup: %v", err)
+			logger.Warn("Failed to look up domain for cleanup", "vm", vm.Name, "error", err)
 		} else {
 			// Try to destroy (force stop) if running
 			if err := lv.DomainDestroy(domain); err != nil {
 				// Ignore error - domain might not be running
-				log.Printf("Note: domain was not running (this is normal): %v", err)
+				logger.Debug("Domain was not running (this is normal)", "vm", vm.Name, "error", err)
 			}
 
 			// Undefine the domain
 			if err := lv.DomainUndefine(domain); err != nil {
-				log.Printf("Warning: failed to undefine domain: %v", err)
+				logger.Warn("Failed to undefine domain", "vm", vm.Name, "error", err)
 			} else {
-				log.Printf("Domain undefined successfully")
+				logger.Info("Domain undefined", "vm", vm.Name)
 			}
 		}
 	}
 
 	// Clean up storage volumes if any were created
 	if storageCreated && sm != nil {
-		log.Printf("Removing VM storage volumes...")
+		logger.Info("Removing VM storage volumes", "vm", vm.Name)
 
 		// Delete boot volume
 		if err := sm.DeleteVolume(ctx, getStoragePool(vm), getBootVolumeName(vm)); err != nil {
-			log.Printf("Warning: failed to delete boot volume: %v", err)
+			logger.Warn("Failed to delete boot volume", "vm", vm.Name, "error", err)
 		}
 
 		// Delete data volumes
 		for _, dataDisk := range vm.Spec.DataDisks {
 			if err := sm.DeleteVolume(ctx, getStoragePool(vm), getDataVolumeName(vm, dataDisk.Device)); err != nil {
-				log.Printf("Warning: failed to delete data volume %s: %v", dataDisk.Device, err)
+				logger.Warn("Failed to delete data volume", "vm", vm.Name, "device", dataDisk.Device, "error", err)
 			}
 		}
 
 		// Delete cloud-init ISO volume
-		if vm.Spec.CloudInit != nil {
+		if vm.HasCloudInitISO() {
 			if err := sm.DeleteVolume(ctx, getStoragePool(vm), getCloudInitVolumeName(vm)); err != nil {
-				log.Printf("Warning: failed to delete cloud-init volume: %v", err)
+				logger.Warn("Failed to delete cloud-init volume", "vm", vm.Name, "error", err)
 			}
 		}
 
-		log.Printf("Storage cleanup complete")
+		logger.Debug("Storage cleanup complete", "vm", vm.Name)
 	}
 
-	log.Printf("Cleanup complete")
+	logger.Info("Cleanup complete", "vm", vm.Name)
 }
@@ -7,8 +7,11 @@ import (
 	"testing"
 
 	"github.com/digitalocean/go-libvirt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/metrics"
+	"github.com/jbweber/foundry/internal/status"
 	"github.com/jbweber/foundry/internal/storage"
 )
 
@@ -97,6 +100,19 @@ func TestCreateFromConfigWithDeps_Success(t *testing.T) {
 			if len(sm.createVolumeCalls) == 0 {
 				t.Error("expected at least boot volume to be created")
 			}
+
+			// Verify the status stored with the spec
+			if tt.vm.Status.Phase != v1alpha1.VMPhaseRunning || len(tt.vm.Status.MACAddresses) != len(tt.vm.Spec.NetworkInterfaces) {
+				t.Errorf("stored status = %+v, want Running with the interface MACs", tt.vm.Status)
+			}
+			for _, cond := range []string{v1alpha1.ConditionReady, v1alpha1.ConditionStorageProvisioned, v1alpha1.ConditionNetworkConfigured} {
+				if !status.IsConditionTrue(tt.vm, cond) {
+					t.Errorf("condition %s = %+v, want True", cond, status.GetCondition(tt.vm, cond))
+				}
+			}
+			if wantCloudInit := tt.vm.Spec.CloudInit != nil; status.IsConditionTrue(tt.vm, v1alpha1.ConditionCloudInitReady) != wantCloudInit {
+				t.Errorf("CloudInitReady = %+v, want True only with cloud-init", status.GetCondition(tt.vm, v1alpha1.ConditionCloudInitReady))
+			}
 		})
 	}
 }
@@ -220,6 +236,10 @@ func TestCreateFromConfigWithDeps_StorageFailures(t *testing.T) {
 			if len(lv.domainDefineXMLCalls) > 0 {
 				t.Error("unexpected domain define on storage failure")
 			}
+
+			if !status.IsConditionFalse(tt.vm, v1alpha1.ConditionStorageProvisioned) || tt.vm.Status.Phase != v1alpha1.VMPhaseFailed {
+				t.Errorf("status = %+v, want StorageProvisioned False and phase Failed", tt.vm.Status)
+			}
 		})
 	}
 }
@@ -655,6 +675,38 @@ func TestCreateFromConfigWithDeps_DataDiskFailure(t *testing.T) {
 	}
 }
 
+// TestCreateFromConfigWithDeps_Metrics tests that creations, failures and
+// cleanups are counted
+func TestCreateFromConfigWithDeps_Metrics(t *testing.T) {
+	ctx := context.Background()
+	creates := testutil.ToFloat64(metrics.VMCreates)
+	failures := testutil.ToFloat64(metrics.VMCreateFailures)
+	cleanups := testutil.ToFloat64(metrics.CleanupAttempts)
+
+	lv := newMockLibvirtClient()
+	if err := createFromConfigWithDeps(ctx, testVMConfig(), lv, newMockStorageManager(), newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+
+	lv = newMockLibvirtClient()
+	lv.domainDefineXMLFunc = func(xml string) (libvirt.Domain, error) {
+		return libvirt.Domain{}, errors.New("define failed")
+	}
+	if err := createFromConfigWithDeps(ctx, testVMConfig(), lv, newMockStorageManager(), newMockMetadataClient(lv)); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	if got := testutil.ToFloat64(metrics.VMCreates) - creates; got != 2 {
+		t.Errorf("creates = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(metrics.VMCreateFailures) - failures; got != 1 {
+		t.Errorf("failures = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.CleanupAttempts) - cleanups; got != 1 {
+		t.Errorf("cleanup attempts = %v, want 1", got)
+	}
+}
+
 // TestCreateFromConfigWithDeps_CloudInitFailures tests cloud-init related failures
 func TestCreateFromConfigWithDeps_CloudInitFailures(t *testing.T) {
 	tests := []struct {
@@ -780,6 +832,110 @@ func TestCreateFromConfigWithDeps_ImagePathHandling(t *testing.T) {
 	}
 }
 
+func TestCreateFromConfigWithDeps_RecordsImageMetadata(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		metaErr     error
+		want        string
+		wantOS      string
+	}{
+		{name: "from image metadata", want: "fedora", wantOS: "fedora43"},
+		{name: "annotation wins", annotations: map[string]string{v1alpha1.AnnotationDefaultUser: "admin"}, want: "admin", wantOS: "fedora43"},
+		{name: "metadata unreadable", metaErr: errors.New("download failed"), want: "", wantOS: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := testVMConfig()
+			vm.Spec.BootDisk.Image = "fedora-43.qcow2"
+			vm.Spec.BootDisk.Empty = false
+			vm.Annotations = tt.annotations
+
+			lv := newMockLibvirtClient()
+			sm := newMockStorageManager()
+			sm.getImageMetadataFunc = func(ctx context.Context, imageName string) (*storage.ImageMetadata, error) {
+				if imageName != "fedora-43.qcow2" {
+					t.Errorf("metadata read for image %q", imageName)
+				}
+				return &storage.ImageMetadata{DefaultUser: "fedora", OSVariant: "fedora43"}, tt.metaErr
+			}
+
+			if err := createFromConfigWithDeps(context.Background(), vm, lv, sm, newMockMetadataClient(lv)); err != nil {
+				t.Fatalf("createFromConfigWithDeps() error = %v", err)
+			}
+			if got := vm.GetDefaultUser(); got != tt.want {
+				t.Errorf("default user = %q, want %q", got, tt.want)
+			}
+			if got := vm.GetOSVariant(); got != tt.wantOS {
+				t.Errorf("OS variant = %q, want %q", got, tt.wantOS)
+			}
+		})
+	}
+}
+
+func TestCreateFromConfigWithDeps_CloudInitHTTPTransport(t *testing.T) {
+	vm := testVMConfigWithCloudInit()
+	vm.Spec.CloudInit.Transport = v1alpha1.CloudInitTransportHTTP
+	vm.Spec.CloudInit.SeedURL = "http://169.254.169.254:8775"
+	lv := newMockLibvirtClient()
+	sm := newMockStorageManager()
+
+	if err := createFromConfigWithDeps(context.Background(), vm, lv, sm, newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("createFromConfigWithDeps() error = %v", err)
+	}
+	for _, spec := range sm.createVolumeCalls {
+		if spec.Type == storage.VolumeTypeCloudInit {
+			t.Errorf("cloud-init ISO volume %s created with the http transport", spec.Name)
+		}
+	}
+	if len(lv.domainDefineXMLCalls) == 0 {
+		t.Fatal("domain not defined")
+	}
+	xml := lv.domainDefineXMLCalls[0]
+	if !strings.Contains(xml, "ds=nocloud-net;s=http://169.254.169.254:8775/test-vm/") {
+		t.Errorf("domain XML does not pass the seed URL in the SMBIOS serial:\n%s", xml)
+	}
+	if strings.Contains(xml, `device="cdrom"`) {
+		t.Errorf("domain XML has a cdrom with the http transport:\n%s", xml)
+	}
+}
+
+func TestCreateFromConfigWithDeps_RawDisks(t *testing.T) {
+	vm := testVMConfig()
+	vm.Spec.StoragePool = "vg-vms"
+	vm.Spec.BootDisk.Format = "raw"
+	vm.Spec.BootDisk.Empty = false
+	vm.Spec.BootDisk.Image = "fedora-43.qcow2"
+	vm.Spec.DataDisks = []v1alpha1.DataDiskSpec{{Device: "vdb", SizeGB: 10}}
+	lv := newMockLibvirtClient()
+	sm := newMockStorageManager()
+
+	if err := createFromConfigWithDeps(context.Background(), vm, lv, sm, newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("createFromConfigWithDeps() error = %v", err)
+	}
+	for _, spec := range sm.createVolumeCalls {
+		if spec.Type == storage.VolumeTypeCloudInit {
+			continue
+		}
+		if spec.Format != storage.VolumeFormatRaw {
+			t.Errorf("volume %s format = %s, want raw", spec.Name, spec.Format)
+		}
+		if spec.BackingVolume != "" {
+			t.Errorf("raw volume %s has backing volume %s", spec.Name, spec.BackingVolume)
+		}
+		if spec.Type == storage.VolumeTypeBoot && spec.SourceVolume == "" {
+			t.Error("raw boot volume is not copied from the image")
+		}
+	}
+	if len(lv.domainDefineXMLCalls) == 0 {
+		t.Fatal("domain not defined")
+	}
+	if xml := lv.domainDefineXMLCalls[0]; strings.Contains(xml, `type="qcow2"`) {
+		t.Errorf("domain XML has a qcow2 disk driver for raw disks:\n%s", xml)
+	}
+}
+
 // TestCreateFromConfigWithDeps_VolumeExistsCheckError tests error during volume exists check
 func TestCreateFromConfigWithDeps_VolumeExistsCheckError(t *testing.T) {
 	ctx := context.Background()
@@ -935,3 +1091,134 @@ func TestCreateFromConfigWithDeps_AutostartVariations(t *testing.T) {
 		})
 	}
 }
+
+// TestCreateFromConfigWithDeps_GenerateName tests that a name is generated
+// from metadata.generateName, skipping names already taken by a domain
+func TestCreateFromConfigWithDeps_GenerateName(t *testing.T) {
+	ctx := context.Background()
+	lv := newMockLibvirtClient()
+	sm := newMockStorageManager()
+
+	vm := testVMConfig()
+	vm.Name = ""
+	vm.GenerateName = "ci-"
+
+	// The first generated name collides with an existing domain
+	var lookups []string
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		lookups = append(lookups, name)
+		if len(lookups) == 1 || len(lv.domainDefineXMLCalls) > 0 {
+			return libvirt.Domain{Name: name}, nil
+		}
+		return libvirt.Domain{}, errors.New("domain not found")
+	}
+
+	if err := createFromConfigWithDeps(ctx, vm, lv, sm, newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+
+	if !strings.HasPrefix(vm.Name, "ci-") || len(vm.Name) != len("ci-")+5 {
+		t.Errorf("vm.Name = %q, want ci- followed by a 5 character suffix", vm.Name)
+	}
+	if vm.Name == lookups[0] {
+		t.Errorf("vm.Name = %q, want a name other than the colliding one", vm.Name)
+	}
+	if got := sm.createVolumeCalls[0].Name; got != vm.Name+"_boot.qcow2" {
+		t.Errorf("boot volume = %q, want %q", got, vm.Name+"_boot.qcow2")
+	}
+}
+
+// TestCreateFromConfigWithDeps_GenerateNameExhausted tests that creation fails
+// without creating anything when no unused name can be generated
+func TestCreateFromConfigWithDeps_GenerateNameExhausted(t *testing.T) {
+	ctx := context.Background()
+	lv := newMockLibvirtClient()
+	sm := newMockStorageManager()
+	sm.volumeExistsFunc = func(ctx context.Context, poolName, volumeName string) (bool, error) {
+		return true, nil
+	}
+
+	vm := testVMConfig()
+	vm.Name = ""
+	vm.GenerateName = "ci-"
+
+	err := createFromConfigWithDeps(ctx, vm, lv, sm, newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "failed to generate a unique name") {
+		t.Fatalf("expected unique name error, got: %v", err)
+	}
+	if len(sm.createVolumeCalls) > 0 || len(sm.deleteVolumeCalls) > 0 {
+		t.Error("expected no storage operations")
+	}
+}
+
+// TestCreateFromConfigWithDeps_SetsCreationTimestamp tests that the creation
+// time, which TTLs count from, is recorded
+func TestCreateFromConfigWithDeps_SetsCreationTimestamp(t *testing.T) {
+	lv := newMockLibvirtClient()
+	vm := testVMConfig()
+
+	if err := createFromConfigWithDeps(context.Background(), vm, lv, newMockStorageManager(), newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+	if vm.CreationTimestamp.IsZero() {
+		t.Error("expected creationTimestamp to be set")
+	}
+}
+
+func TestCreateFromConfigWithDeps_DHCPInterfaceGetsMAC(t *testing.T) {
+	lv := newMockLibvirtClient()
+	vm := testVMConfig()
+	vm.Spec.NetworkInterfaces = []v1alpha1.NetworkInterfaceSpec{{Bridge: "br0", DHCP: true}}
+
+	if err := createFromConfigWithDeps(context.Background(), vm, lv, newMockStorageManager(), newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+
+	mac := vm.Spec.NetworkInterfaces[0].MACAddress
+	if !strings.HasPrefix(mac, "be:ee:") {
+		t.Fatalf("expected a generated MAC address, got %q", mac)
+	}
+	if len(lv.domainDefineXMLCalls) != 1 || !strings.Contains(lv.domainDefineXMLCalls[0], mac) {
+		t.Errorf("expected domain XML to use MAC %s", mac)
+	}
+}
+
+func TestCreateFromConfigWithDeps_SRIOVInterfaceGetsVFAddress(t *testing.T) {
+	lv := newMockLibvirtClient()
+	lv.nodeDevices = map[string]string{
+		"net_enp1s0f0": `<device><name>net_enp1s0f0</name><parent>pci_0000_01_00_0</parent>` +
+			`<capability type='net'><interface>enp1s0f0</interface></capability></device>`,
+		"pci_0000_01_00_0": `<device><name>pci_0000_01_00_0</name><capability type='pci'>` +
+			`<domain>0</domain><bus>1</bus><slot>0</slot><function>0</function>` +
+			`<capability type='virt_functions'>` +
+			`<address domain='0x0000' bus='0x01' slot='0x10' function='0x0'/>` +
+			`<address domain='0x0000' bus='0x01' slot='0x10' function='0x2'/>` +
+			`</capability></capability></device>`,
+	}
+	vm := testVMConfig()
+	vm.Spec.NetworkInterfaces = append(vm.Spec.NetworkInterfaces,
+		v1alpha1.NetworkInterfaceSpec{DHCP: true, SRIOV: &v1alpha1.SRIOVSpec{PF: "enp1s0f0", VF: 1}})
+
+	if err := createFromConfigWithDeps(context.Background(), vm, lv, newMockStorageManager(), newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+
+	if got := vm.Spec.NetworkInterfaces[1].SRIOV.PCIAddress; got != "0000:01:10.2" {
+		t.Errorf("recorded VF address = %q, want 0000:01:10.2", got)
+	}
+	if len(lv.domainDefineXMLCalls) != 1 || !strings.Contains(lv.domainDefineXMLCalls[0], `slot="0x10" function="0x2"`) {
+		t.Errorf("expected domain XML to pass VF 0000:01:10.2 through")
+	}
+
+	// A VF that does not exist fails before anything is created
+	lv = newMockLibvirtClient()
+	vm = testVMConfig()
+	vm.Spec.NetworkInterfaces[0] = v1alpha1.NetworkInterfaceSpec{DHCP: true, SRIOV: &v1alpha1.SRIOVSpec{PF: "enp1s0f0"}}
+	err := createFromConfigWithDeps(context.Background(), vm, lv, newMockStorageManager(), newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "failed to find VF 0 of enp1s0f0") {
+		t.Errorf("error = %v, want the VF lookup to fail", err)
+	}
+	if len(lv.domainDefineXMLCalls) != 0 {
+		t.Error("expected no domain to be defined")
+	}
+}
@@ -4,14 +4,15 @@ package vm
 import (
 	"context"
 	"fmt"
-	"log"
-	"strings"
 	"time"
 
 	"github.com/digitalocean/go-libvirt"
 
+	"github.com/jbweber/foundry/internal/history"
 	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
 	"github.com/jbweber/foundry/internal/storage"
+	"github.com/jbweber/foundry/internal/timing"
 )
 
 const (
@@ -20,7 +21,9 @@ const (
 
 	// Domain states (from libvirt VIR_DOMAIN_* constants)
 	domainStateRunning = 1
+	domainStatePaused  = 3
 	domainStateShutoff = 5
+	domainStateCrashed = 6
 )
 
 // Destroy destroys a VM by name.
@@ -32,50 +35,102 @@ const (
 //  4. Force destroy if still running
 //  5. Undefine domain (with NVRAM cleanup for UEFI VMs)
 //  6. Delete all storage volumes from pool
+//  7. Verify nothing was left behind (domain, volumes, tap interfaces)
 //
 // Volume cleanup is best-effort - if volumes can't be deleted, warnings are logged
-// but the operation continues.
+// but the operation continues. The returned report lists anything that survived;
+// with opts.ForceClean, leftover volumes and tap interfaces are removed and the
+// report reflects the state after that second pass. ForceClean also works for a
+// VM whose domain is already gone, removing only its leftover volumes.
+//
+// Tap interfaces are only checked when connected to the local hypervisor.
 //
 // Returns an error if the VM doesn't exist or if critical libvirt operations fail.
-func Destroy(ctx context.Context, vmName string) error {
+func Destroy(ctx context.Context, vmName string, opts DestroyOptions) (*DestroyReport, error) {
+	logger := logging.FromContext(ctx)
+
 	// Connect to libvirt
-	log.Printf("Connecting to libvirt...")
+	logger.Debug("Connecting to libvirt")
 	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
 	if err != nil {
-		return fmt.Errorf("failed to connect to libvirt: %w", err)
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
 	}
 	defer func() {
 		if err := LibvirtClient.Close(); err != nil {
-			log.Printf("Warning: failed to close libvirt connection: %v", err)
+			logger.Warn("Failed to close libvirt connection", "error", err)
 		}
 	}()
 
 	// Create storage manager
-	log.Printf("Initializing storage manager...")
+	logger.Debug("Initializing storage manager")
 	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
 
 	// Ensure default pools exist (needed for volume listing)
-	log.Printf("Ensuring default storage pools exist...")
+	logger.Debug("Ensuring default storage pools exist")
 	if err := storageMgr.EnsureDefaultPools(ctx); err != nil {
-		return fmt.Errorf("failed to ensure default pools: %w", err)
+		return nil, fmt.Errorf("failed to ensure default pools: %w", err)
 	}
 
 	// Delegate to internal function with dependencies
-	return destroyWithDeps(ctx, vmName, LibvirtClient.Libvirt(), storageMgr)
+	// Tap interfaces live on the hypervisor, so they can only be checked
+	// when it is the local host
+	links := localLinks()
+	if links == nil {
+		logger.Info("Remote connection, tap interface verification will be skipped")
+	}
+
+	return destroyAndVerifyWithDeps(ctx, vmName, opts, LibvirtClient.Libvirt(), storageMgr, links)
+}
+
+// destroyAndVerifyWithDeps destroys a VM and verifies the result with injected
+// dependencies, optionally force-cleaning anything left behind.
+// A nil links skips tap interface verification.
+func destroyAndVerifyWithDeps(ctx context.Context, vmName string, opts DestroyOptions, lv LibvirtClient, sm storageManager, links hostLinks) (*DestroyReport, error) {
+	logger := logging.FromContext(ctx)
+
+	// Record tap names while the domain definition still exists
+	var interfaces []string
+	domain, lookupErr := lv.DomainLookupByName(vmName)
+	if lookupErr == nil {
+		var err error
+		interfaces, err = domainInterfaceNames(lv, domain)
+		if err != nil {
+			logger.Warn("Failed to read interfaces, skipping tap verification", "error", err)
+		}
+	}
+
+	if lookupErr != nil && opts.ForceClean {
+		// The domain is already gone (e.g., an earlier destroy left volumes
+		// behind) - only clean up what remains
+		logger.Info("VM not found, cleaning up leftovers only", "vm", vmName)
+	} else if err := destroyWithDeps(ctx, vmName, lv, sm); err != nil {
+		return nil, err
+	} else {
+		history.Record(ctx, vmName, history.TypeDestroyed, "")
+	}
+
+	report := verifyDestroyedWithDeps(ctx, vmName, interfaces, lv, sm, links)
+	if report.Clean() || !opts.ForceClean {
+		return report, nil
+	}
+
+	return forceCleanWithDeps(ctx, report, lv, sm, links)
 }
 
 // destroyWithDeps destroys a VM with injected dependencies.
 // This allows for testing by accepting interfaces instead of concrete types.
 func destroyWithDeps(ctx context.Context, vmName string, lv LibvirtClient, sm storageManager) error {
+	logger := logging.FromContext(ctx)
+
 	// Step 1: Check if VM exists
-	log.Printf("Looking up VM '%s'...", vmName)
+	logger.Debug("Looking up VM", "vm", vmName)
 	domain, err := lv.DomainLookupByName(vmName)
 	if err != nil {
 		return fmt.Errorf("VM '%s' not found: %w", vmName, err)
 	}
 
 	// Step 2: Get VM state
-	log.Printf("Checking VM state...")
+	logger.Debug("Checking VM state", "vm", vmName)
 	state, _, err := lv.DomainGetState(domain, 0)
 	if err != nil {
 		return fmt.Errorf("failed to get VM state: %w", err)
@@ -84,13 +139,14 @@ func destroyWithDeps(ctx context.Context, vmName string, lv LibvirtClient, sm st
 	// Step 3: Graceful shutdown if running
 	needsForceDestroy := false
 	if state == domainStateRunning {
-		log.Printf("VM is running, attempting graceful shutdown...")
+		logger.Info("VM is running, attempting graceful shutdown", "vm", vmName)
+		endShutdown := timing.Start("shut down domain")
 		if err := lv.DomainShutdown(domain); err != nil {
-			log.Printf("Warning: graceful shutdown failed: %v", err)
+			logger.Warn("Graceful shutdown failed", "vm", vmName, "error", err)
 			needsForceDestroy = true
 		} else {
 			// Wait for shutdown with timeout
-			log.Printf("Waiting up to %v for graceful shutdown...", shutdownTimeout)
+			logger.Info("Waiting for graceful shutdown", "vm", vmName, "timeout", shutdownTimeout)
 			shutdownCtx, cancel := context.WithTimeout(ctx, shutdownTimeout)
 			defer cancel()
 
@@ -103,22 +159,23 @@ func destroyWithDeps(ctx context.Context, vmName string, lv LibvirtClient, sm st
 				select {
 				case <-shutdownCtx.Done():
 					// Timeout - will force destroy below
-					log.Printf("Graceful shutdown timed out")
+					logger.Warn("Graceful shutdown timed out", "vm", vmName)
 					needsForceDestroy = true
 					shutdownSucceeded = true // exit loop
 				case <-ticker.C:
 					currentState, _, err := lv.DomainGetState(domain, 0)
 					if err != nil {
-						log.Printf("Warning: failed to check shutdown state: %v", err)
+						logger.Warn("Failed to check shutdown state", "vm", vmName, "error", err)
 						needsForceDestroy = true
 						shutdownSucceeded = true // exit loop
 					} else if currentState == domainStateShutoff {
-						log.Printf("VM shut down gracefully")
+						logger.Info("VM shut down gracefully", "vm", vmName)
 						shutdownSucceeded = true // exit loop
 					}
 				}
 			}
 		}
+		endShutdown()
 	}
 
 	// Step 4: Force destroy if still running
@@ -126,50 +183,43 @@ func destroyWithDeps(ctx context.Context, vmName string, lv LibvirtClient, sm st
 		// Check state one more time
 		currentState, _, err := lv.DomainGetState(domain, 0)
 		if err != nil {
-			log.Printf("Warning: failed to check state before destroy: %v", err)
+			logger.Warn("Failed to check state before destroy", "vm", vmName, "error", err)
 		}
 		if err == nil && currentState == domainStateRunning {
-			log.Printf("Force destroying VM...")
+			logger.Info("Force destroying VM", "vm", vmName)
 			if err := lv.DomainDestroy(domain); err != nil {
-				log.Printf("Warning: force destroy failed: %v", err)
+				logger.Warn("Force destroy failed", "vm", vmName, "error", err)
 			}
 		}
 	}
 
-	// Step 5: Undefine domain with NVRAM cleanup
-	log.Printf("Undefining domain...")
-	if err := lv.DomainUndefineFlags(domain, libvirt.DomainUndefineNvram); err != nil {
+	// Step 5: Undefine domain with NVRAM and snapshot metadata cleanup
+	// (snapshot data lives in the volumes deleted below)
+	logger.Info("Undefining domain", "vm", vmName)
+	endUndefine := timing.Start("undefine domain")
+	err = lv.DomainUndefineFlags(domain, libvirt.DomainUndefineNvram|libvirt.DomainUndefineSnapshotsMetadata)
+	endUndefine()
+	if err != nil {
+		// The domain stays, so its stored status should say it is stopped
+		recordStatus(ctx, lv, domain)
 		return fmt.Errorf("failed to undefine domain: %w", err)
 	}
 
 	// Step 6: Delete storage volumes
 	// We search for all volumes with the VM name prefix in both default pools
-	log.Printf("Cleaning up storage volumes...")
-	pools := []string{"foundry-vms", "foundry-images"}
+	logger.Debug("Cleaning up storage volumes", "vm", vmName)
 	deletedCount := 0
 
-	for _, poolName := range pools {
-		volumes, err := sm.ListVolumes(ctx, poolName)
-		if err != nil {
-			log.Printf("Warning: failed to list volumes in pool %s: %v", poolName, err)
-			continue
-		}
-
-		// Find volumes that belong to this VM (prefix match: "{vmName}_")
-		vmPrefix := vmName + "_"
-		for _, vol := range volumes {
-			if strings.HasPrefix(vol.Name, vmPrefix) {
-				log.Printf("Deleting volume %s from pool %s...", vol.Name, poolName)
-				if err := sm.DeleteVolume(ctx, poolName, vol.Name); err != nil {
-					log.Printf("Warning: failed to delete volume %s: %v", vol.Name, err)
-				} else {
-					deletedCount++
-				}
-			}
+	for _, vol := range findVMVolumes(ctx, sm, vmName) {
+		logger.Info("Deleting volume", "pool", vol.Pool, "volume", vol.Name)
+		if err := sm.DeleteVolume(ctx, vol.Pool, vol.Name); err != nil {
+			logger.Warn("Failed to delete volume", "pool", vol.Pool, "volume", vol.Name, "error", err)
+		} else {
+			deletedCount++
 		}
 	}
 
-	log.Printf("VM '%s' destroyed successfully (%d volumes deleted)", vmName, deletedCount)
+	logger.Info("VM destroyed", "vm", vmName, "volumesDeleted", deletedCount)
 	return nil
 }
 
@@ -75,6 +75,12 @@ func TestDestroyWithDeps_RunningVM_GracefulShutdown(t *testing.T) {
 		return []storage.VolumeInfo{}, nil
 	}
 
+	var undefineFlags libvirt.DomainUndefineFlagsValues
+	lv.domainUndefineFlagsFunc = func(dom libvirt.Domain, flags libvirt.DomainUndefineFlagsValues) error {
+		undefineFlags = flags
+		return nil
+	}
+
 	// Execute
 	err := destroyWithDeps(ctx, "test-vm", lv, sm)
 
@@ -83,6 +89,11 @@ func TestDestroyWithDeps_RunningVM_GracefulShutdown(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
+	// NVRAM and snapshot metadata must be removed or undefine fails
+	if want := libvirt.DomainUndefineNvram | libvirt.DomainUndefineSnapshotsMetadata; undefineFlags != want {
+		t.Errorf("undefine flags = %d, want %d", undefineFlags, want)
+	}
+
 	// Verify workflow
 	if len(lv.domainLookupByNameCalls) != 1 {
 		t.Errorf("expected 1 domain lookup, got %d", len(lv.domainLookupByNameCalls))
@@ -0,0 +1,706 @@
+// Package vm provides high-level VM management operations.
+package vm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"libvirt.org/go/libvirtxml"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/history"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/status"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// blockJobPollInterval is how often block job progress is polled while
+// waiting for the completion event.
+const blockJobPollInterval = 1 * time.Second
+
+// BlockJobProgress reports the progress of a running block job.
+type BlockJobProgress struct {
+	// Device is the disk target device (e.g., "vda").
+	Device string
+
+	// Current is the amount of work completed (libvirt units, usually bytes).
+	Current uint64
+
+	// End is the total amount of work (same units as Current).
+	End uint64
+}
+
+// Percent returns the completion percentage (0-100).
+func (p BlockJobProgress) Percent() float64 {
+	if p.End == 0 {
+		return 0
+	}
+	return float64(p.Current) / float64(p.End) * 100
+}
+
+// FlattenDisk collapses the backing chain of a running VM's disk into a
+// standalone image using a libvirt block pull.
+//
+// The VM must be running: block pull is performed by QEMU while the guest keeps
+// using the disk. Block commit is intentionally not used because it would write
+// the overlay's data into the base image, which is shared by every VM created
+// from it.
+//
+// If progress is non-nil it is called periodically with the job's progress.
+// Completion is detected via libvirt block job events, with polling as a
+// fallback. Cancelling ctx aborts the block job.
+//
+// Returns nil without starting a job if the disk has no backing file.
+func FlattenDisk(ctx context.Context, vmName, device string, progress func(BlockJobProgress)) error {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	return flattenDiskWithDeps(ctx, vmName, device, progress, LibvirtClient.Libvirt())
+}
+
+// flattenDiskWithDeps flattens a disk with injected dependencies.
+// This allows for testing by accepting interfaces instead of concrete types.
+func flattenDiskWithDeps(ctx context.Context, vmName, device string, progress func(BlockJobProgress), lv LibvirtClient) error {
+	logger := logging.FromContext(ctx)
+
+	// Step 1: Look up the domain
+	domain, err := lv.DomainLookupByName(vmName)
+	if err != nil {
+		return fmt.Errorf("VM '%s' not found: %w", vmName, err)
+	}
+
+	// Step 2: Block jobs need a running QEMU process
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		return fmt.Errorf("failed to get VM state: %w", err)
+	}
+	if state != domainStateRunning {
+		return fmt.Errorf("VM '%s' must be running to flatten a disk (state: %s)", vmName, stateToString(state))
+	}
+
+	// Step 3: Find the disk and check that it actually has a backing chain
+	disk, err := findDomainDisk(lv, domain, device)
+	if err != nil {
+		return err
+	}
+	if !hasBackingChain(disk) {
+		logger.Info("Disk has no backing file, nothing to flatten", "vm", vmName, "device", device)
+		return nil
+	}
+
+	// Step 4: Subscribe to block job events before starting the job so the
+	// completion event cannot be missed
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events, err := lv.SubscribeEvents(jobCtx, libvirt.DomainEventIDBlockJob, libvirt.OptDomain{domain})
+	if err != nil {
+		logger.Warn("Failed to subscribe to block job events, falling back to polling", "error", err)
+		events = nil
+	}
+
+	// Step 5: Start the block pull
+	logger.Info("Starting block pull", "vm", vmName, "device", device)
+	if err := lv.DomainBlockPull(domain, device, 0, 0); err != nil {
+		return fmt.Errorf("failed to start block pull on %s: %w", device, err)
+	}
+
+	// Step 6: Wait for completion
+	if err := waitForBlockJob(ctx, lv, domain, device, libvirt.DomainBlockJobTypePull, events, progress); err != nil {
+		return err
+	}
+
+	logger.Info("Disk flattened", "vm", vmName, "device", device)
+	return nil
+}
+
+// FlattenVM collapses the backing chains of all of a VM's disks, so that it
+// no longer depends on its base image: the image can then be deleted or
+// replaced, and the VM's volumes copied to another host on their own. It
+// returns the devices that were flattened; disks without a backing file are
+// left alone.
+//
+// Running VMs are flattened with a block pull per disk (see FlattenDisk),
+// stopped VMs by copying their volumes (see storage.Manager.FlattenVolume).
+// Once the boot disk is flattened, the recorded boot image annotations are
+// removed, since the VM no longer needs the image to start.
+//
+// If progress is non-nil it is called periodically with block job progress.
+// Cancelling ctx aborts a running block job.
+func FlattenVM(ctx context.Context, vmName string, progress func(BlockJobProgress)) ([]string, error) {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	return flattenVMWithDeps(ctx, vmName, progress, LibvirtClient.Libvirt(), storageMgr, metaClient)
+}
+
+// flattenVMWithDeps flattens a VM's disks with injected dependencies.
+// This allows for testing by accepting interfaces instead of concrete types.
+func flattenVMWithDeps(ctx context.Context, vmName string, progress func(BlockJobProgress), lv LibvirtClient, sm storageManager, mc *metadata.Client) ([]string, error) {
+	logger := logging.FromContext(ctx)
+
+	// Step 1: Look up the domain and its stored spec
+	domain, err := lv.DomainLookupByName(vmName)
+	if err != nil {
+		return nil, fmt.Errorf("VM '%s' not found: %w", vmName, err)
+	}
+
+	vm, err := mc.Load(domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", vmName, err)
+	}
+
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VM state: %w", err)
+	}
+
+	devices := []string{"vda"}
+	for _, disk := range vm.Spec.DataDisks {
+		devices = append(devices, disk.Device)
+	}
+
+	// Step 2: Flatten each disk, live or through its volume
+	var flattened []string
+	for _, device := range devices {
+		if state == domainStateRunning {
+			disk, err := findDomainDisk(lv, domain, device)
+			if err != nil {
+				return flattened, err
+			}
+			if !hasBackingChain(disk) {
+				continue
+			}
+			if err := flattenDiskWithDeps(ctx, vmName, device, progress, lv); err != nil {
+				return flattened, fmt.Errorf("failed to flatten disk %s: %w", device, err)
+			}
+		} else {
+			_, volumeName, _, err := diskSpecForDevice(vm, device)
+			if err != nil {
+				return flattened, err
+			}
+			logger.Info("Flattening volume", "vm", vmName, "volume", volumeName)
+			ok, err := sm.FlattenVolume(ctx, getStoragePool(vm), volumeName)
+			if err != nil {
+				return flattened, fmt.Errorf("failed to flatten disk %s: %w", device, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		flattened = append(flattened, device)
+	}
+
+	// Step 3: The VM no longer needs its boot image to start
+	_, hasBootImage := vm.Annotations[v1alpha1.AnnotationBootImagePath]
+	if len(flattened) > 0 && flattened[0] == "vda" && hasBootImage {
+		delete(vm.Annotations, v1alpha1.AnnotationBootImagePath)
+		delete(vm.Annotations, v1alpha1.AnnotationBootImageFingerprint)
+		if err := mc.Store(domain, vm); err != nil {
+			return flattened, fmt.Errorf("disks flattened but failed to update stored spec: %w", err)
+		}
+	}
+
+	logger.Info("VM flattened", "vm", vmName, "disks", len(flattened))
+	return flattened, nil
+}
+
+// ResizeDisk grows a VM's boot or data disk to sizeGB.
+//
+// The device is the disk's target (vda for the boot disk, or a data disk
+// device from the spec). Running VMs are resized live with a block resize so
+// the guest sees the new size immediately; stopped VMs have their volume
+// resized directly. Shrinking is refused.
+//
+// The stored spec is updated with the new size and its generation bumped.
+// The guest's partitions and filesystems are not grown.
+func ResizeDisk(ctx context.Context, vmName, device string, sizeGB int) error {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	return resizeDiskWithDeps(ctx, vmName, device, sizeGB, LibvirtClient.Libvirt(), storageMgr, metaClient)
+}
+
+// resizeDiskWithDeps resizes a disk with injected dependencies.
+// This allows for testing by accepting interfaces instead of concrete types.
+func resizeDiskWithDeps(ctx context.Context, vmName, device string, sizeGB int, lv LibvirtClient, sm storageManager, mc *metadata.Client) error {
+	logger := logging.FromContext(ctx)
+
+	if sizeGB <= 0 {
+		return fmt.Errorf("invalid size %dGB", sizeGB)
+	}
+
+	// Step 1: Look up the domain and its stored spec
+	domain, err := lv.DomainLookupByName(vmName)
+	if err != nil {
+		return fmt.Errorf("VM '%s' not found: %w", vmName, err)
+	}
+
+	vm, err := mc.Load(domain)
+	if err != nil {
+		return fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", vmName, err)
+	}
+
+	// Step 2: Resolve the device to its spec entry and volume
+	currentGB, volumeName, setSize, err := diskSpecForDevice(vm, device)
+	if err != nil {
+		return err
+	}
+	if sizeGB < currentGB {
+		return fmt.Errorf("cannot shrink disk %s from %dGB to %dGB", device, currentGB, sizeGB)
+	}
+	if sizeGB == currentGB {
+		logger.Info("Disk is already at the requested size, nothing to do", "vm", vmName, "device", device, "sizeGB", sizeGB)
+		return nil
+	}
+
+	// Step 3: Resize live through QEMU, or the volume itself when stopped
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		return fmt.Errorf("failed to get VM state: %w", err)
+	}
+
+	if state == domainStateRunning {
+		logger.Info("Resizing disk of running VM", "vm", vmName, "device", device, "sizeGB", sizeGB)
+		sizeBytes := uint64(sizeGB) * 1024 * 1024 * 1024
+		if err := lv.DomainBlockResize(domain, device, sizeBytes, libvirt.DomainBlockResizeBytes); err != nil {
+			return fmt.Errorf("failed to resize disk %s: %w", device, err)
+		}
+	} else {
+		logger.Info("Resizing volume", "vm", vmName, "volume", volumeName, "sizeGB", sizeGB)
+		if err := sm.ResizeVolume(ctx, getStoragePool(vm), volumeName, uint64(sizeGB)); err != nil {
+			return fmt.Errorf("failed to resize disk %s: %w", device, err)
+		}
+	}
+
+	// Step 4: Record the new size in the stored spec
+	setSize(sizeGB)
+	vm.Generation++
+	vm.UpdateObservedGeneration()
+	status.SetCondition(vm, v1alpha1.ConditionStorageProvisioned, v1alpha1.ConditionTrue, "DiskResized", fmt.Sprintf("Disk %s resized to %dGB", device, sizeGB))
+	if err := mc.Store(domain, vm); err != nil {
+		return fmt.Errorf("disk resized but failed to update stored spec: %w", err)
+	}
+
+	logger.Info("Disk resized", "vm", vmName, "device", device, "sizeGB", sizeGB)
+	return nil
+}
+
+// diskDetachTimeout is how long DetachDisk waits for the guest of a running
+// VM to release a disk before giving up on deleting its volume.
+const diskDetachTimeout = 30 * time.Second
+
+// AttachDisk adds an empty data disk of sizeGB to a VM at device (e.g., vdc).
+//
+// The data volume is created and the disk is added to the VM's persistent
+// definition; a running VM gets the disk hotplugged so the guest sees it
+// immediately. The disk is added to the stored spec and its generation
+// bumped.
+func AttachDisk(ctx context.Context, vmName, device string, sizeGB int) error {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	return attachDiskWithDeps(ctx, vmName, device, sizeGB, LibvirtClient.Libvirt(), storageMgr, metaClient)
+}
+
+// attachDiskWithDeps attaches a data disk with injected dependencies.
+// This allows for testing by accepting interfaces instead of concrete types.
+func attachDiskWithDeps(ctx context.Context, vmName, device string, sizeGB int, lv LibvirtClient, sm storageManager, mc *metadata.Client) error {
+	logger := logging.FromContext(ctx)
+
+	if sizeGB <= 0 {
+		return fmt.Errorf("invalid size %dGB", sizeGB)
+	}
+	if !strings.HasPrefix(device, "vd") || device == "vda" {
+		return fmt.Errorf("invalid device %q: data disks use virtio devices after vda (vdb, vdc, ...)", device)
+	}
+
+	// Step 1: Look up the domain and its stored spec
+	domain, err := lv.DomainLookupByName(vmName)
+	if err != nil {
+		return fmt.Errorf("VM '%s' not found: %w", vmName, err)
+	}
+
+	vm, err := mc.Load(domain)
+	if err != nil {
+		return fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", vmName, err)
+	}
+	if _, _, _, err := diskSpecForDevice(vm, device); err == nil {
+		return fmt.Errorf("VM '%s' already has a disk %s", vmName, device)
+	}
+	if _, err := findDomainDisk(lv, domain, device); err == nil {
+		return fmt.Errorf("device %s of VM '%s' is already in use", device, vmName)
+	}
+
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		return fmt.Errorf("failed to get VM state: %w", err)
+	}
+
+	// Step 2: Generate the disk XML the way a create would
+	disk := v1alpha1.DataDiskSpec{Device: device, SizeGB: sizeGB}
+	vm.Spec.DataDisks = append(vm.Spec.DataDisks, disk)
+	diskXML, err := generatedDiskXML(vm, device)
+	if err != nil {
+		return err
+	}
+
+	// Step 3: Create the volume
+	pool := getStoragePool(vm)
+	volumeName := getDataVolumeName(vm, device)
+	logger.Info("Creating data volume", "vm", vmName, "volume", volumeName, "sizeGB", sizeGB)
+	if err := sm.CreateVolume(ctx, pool, dataVolumeSpec(vm, disk)); err != nil {
+		return fmt.Errorf("failed to create data volume: %w", err)
+	}
+
+	// Step 4: Attach it to the definition, and to the guest if it is running
+	flags := libvirt.DomainAffectConfig
+	if state == domainStateRunning {
+		flags |= libvirt.DomainAffectLive
+	}
+	logger.Info("Attaching data disk", "vm", vmName, "device", device)
+	if err := lv.DomainAttachDeviceFlags(domain, diskXML, uint32(flags)); err != nil {
+		if delErr := sm.DeleteVolume(ctx, pool, volumeName); delErr != nil {
+			logger.Warn("Failed to delete data volume", "vm", vmName, "volume", volumeName, "error", delErr)
+		}
+		return fmt.Errorf("failed to attach disk %s: %w", device, err)
+	}
+
+	// Step 5: Record the disk in the stored spec
+	vm.Generation++
+	vm.UpdateObservedGeneration()
+	status.SetCondition(vm, v1alpha1.ConditionStorageProvisioned, v1alpha1.ConditionTrue, "DiskAttached", fmt.Sprintf("Data disk %s attached", device))
+	if err := mc.Store(domain, vm); err != nil {
+		return fmt.Errorf("disk attached but failed to update stored spec: %w", err)
+	}
+
+	history.Record(ctx, vmName, history.TypeDiskAttached, fmt.Sprintf("Data disk %s (%dGB) attached", device, sizeGB))
+	logger.Info("Disk attached", "vm", vmName, "device", device, "sizeGB", sizeGB)
+	return nil
+}
+
+// DetachDisk removes a data disk from a VM and deletes its volume.
+//
+// The disk is removed from the VM's persistent definition and unplugged from
+// a running VM. The guest has to release the disk before its volume can be
+// deleted; if it does not within 30 seconds the volume is kept and an error
+// returned. The disk is removed from the stored spec and its generation
+// bumped.
+func DetachDisk(ctx context.Context, vmName, device string) error {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	return detachDiskWithDeps(ctx, vmName, device, diskDetachTimeout, LibvirtClient.Libvirt(), storageMgr, metaClient)
+}
+
+// detachDiskWithDeps detaches a data disk with injected dependencies, waiting
+// up to timeout for a running guest to release it.
+func detachDiskWithDeps(ctx context.Context, vmName, device string, timeout time.Duration, lv LibvirtClient, sm storageManager, mc *metadata.Client) error {
+	logger := logging.FromContext(ctx)
+
+	// Step 1: Look up the domain and its stored spec
+	domain, err := lv.DomainLookupByName(vmName)
+	if err != nil {
+		return fmt.Errorf("VM '%s' not found: %w", vmName, err)
+	}
+
+	vm, err := mc.Load(domain)
+	if err != nil {
+		return fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", vmName, err)
+	}
+
+	index := -1
+	for i, disk := range vm.Spec.DataDisks {
+		if disk.Device == device {
+			index = i
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("data disk %s not found in VM '%s' spec", device, vmName)
+	}
+	volumeName := getDataVolumeName(vm, device)
+
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		return fmt.Errorf("failed to get VM state: %w", err)
+	}
+	running := state == domainStateRunning
+
+	// Step 2: Detach it from the definition, and from the guest if it is running
+	disk, err := findDomainDisk(lv, domain, device)
+	if err != nil {
+		logger.Info("Disk is not attached, only removing it from the spec", "vm", vmName, "device", device)
+	} else {
+		diskXML, err := disk.Marshal()
+		if err != nil {
+			return fmt.Errorf("failed to marshal disk XML: %w", err)
+		}
+		flags := libvirt.DomainAffectConfig
+		if running {
+			flags |= libvirt.DomainAffectLive
+		}
+		logger.Info("Detaching data disk", "vm", vmName, "device", device)
+		if err := lv.DomainDetachDeviceFlags(domain, diskXML, uint32(flags)); err != nil {
+			return fmt.Errorf("failed to detach disk %s: %w", device, err)
+		}
+	}
+
+	// Step 3: Remove the disk from the stored spec
+	vm.Spec.DataDisks = append(vm.Spec.DataDisks[:index], vm.Spec.DataDisks[index+1:]...)
+	vm.Generation++
+	vm.UpdateObservedGeneration()
+	status.SetCondition(vm, v1alpha1.ConditionStorageProvisioned, v1alpha1.ConditionTrue, "DiskDetached", fmt.Sprintf("Data disk %s detached", device))
+	if err := mc.Store(domain, vm); err != nil {
+		return fmt.Errorf("disk detached but failed to update stored spec: %w", err)
+	}
+
+	// Step 4: Delete the volume once the guest has let go of it
+	if running {
+		released, err := waitForDiskDetach(ctx, lv, domain, device, timeout)
+		if err != nil {
+			return err
+		}
+		if !released {
+			return fmt.Errorf("disk %s was removed from VM '%s' but the guest has not released it yet; its volume %s was kept", device, vmName, volumeName)
+		}
+	}
+
+	logger.Info("Deleting data volume", "vm", vmName, "volume", volumeName)
+	if err := sm.DeleteVolume(ctx, getStoragePool(vm), volumeName); err != nil {
+		return fmt.Errorf("disk detached but failed to delete its volume: %w", err)
+	}
+
+	history.Record(ctx, vmName, history.TypeDiskDetached, fmt.Sprintf("Data disk %s detached and its volume deleted", device))
+	logger.Info("Disk detached", "vm", vmName, "device", device)
+	return nil
+}
+
+// waitForDiskDetach waits up to timeout for device to disappear from the
+// running domain and reports whether it did.
+func waitForDiskDetach(ctx context.Context, lv LibvirtClient, domain libvirt.Domain, device string, timeout time.Duration) (bool, error) {
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(blockJobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if diskDetached(lv, domain, device) {
+			return true, nil
+		}
+		if !time.Now().Before(deadline) {
+			return false, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// generatedDiskXML returns the XML foundry generates for the disk at device
+// of vm.
+func generatedDiskXML(vm *v1alpha1.VirtualMachine, device string) (string, error) {
+	domainXML, err := foundrylibvirt.GenerateDomainXML(vm)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate domain XML: %w", err)
+	}
+
+	var domainDef libvirtxml.Domain
+	if err := domainDef.Unmarshal(domainXML); err != nil {
+		return "", fmt.Errorf("failed to parse generated domain XML: %w", err)
+	}
+	return domainDiskXML(&domainDef, device)
+}
+
+// diskSpecForDevice finds the boot or data disk for device in the VM spec.
+// It returns the disk's size, its volume name and a function that updates the
+// size in the spec.
+func diskSpecForDevice(vm *v1alpha1.VirtualMachine, device string) (int, string, func(int), error) {
+	if device == "vda" {
+		return vm.Spec.BootDisk.SizeGB, getBootVolumeName(vm), func(size int) { vm.Spec.BootDisk.SizeGB = size }, nil
+	}
+
+	for i := range vm.Spec.DataDisks {
+		disk := &vm.Spec.DataDisks[i]
+		if disk.Device == device {
+			return disk.SizeGB, getDataVolumeName(vm, device), func(size int) { disk.SizeGB = size }, nil
+		}
+	}
+
+	return 0, "", nil, fmt.Errorf("disk %s not found in VM '%s' spec (only vda and data disks can be resized)", device, vm.Name)
+}
+
+// waitForBlockJob waits for the block job of type jobType on device to
+// finish. An active commit never finishes on its own: it is waited for until
+// it is ready to pivot.
+//
+// Block job events signal completion or failure; polling DomainGetBlockJobInfo
+// reports progress and detects completion if no event arrives (e.g., when
+// the event subscription failed or the stream was closed).
+func waitForBlockJob(ctx context.Context, lv LibvirtClient, domain libvirt.Domain, device string, jobType libvirt.DomainBlockJobType, events <-chan interface{}, progress func(BlockJobProgress)) error {
+	logger := logging.FromContext(ctx)
+
+	activeCommit := jobType == libvirt.DomainBlockJobTypeActiveCommit
+	ticker := time.NewTicker(blockJobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Aborting block job", "device", device)
+			if err := lv.DomainBlockJobAbort(domain, device, 0); err != nil {
+				logger.Warn("Failed to abort block job", "device", device, "error", err)
+			}
+			return fmt.Errorf("block job on %s cancelled: %w", device, ctx.Err())
+
+		case ev, ok := <-events:
+			if !ok {
+				// Stream closed - keep going on polling alone
+				events = nil
+				continue
+			}
+			msg, isBlockJob := ev.(*libvirt.DomainEventCallbackBlockJobMsg)
+			if !isBlockJob || msg.Msg.Dom.Name != domain.Name || msg.Msg.Type != int32(jobType) {
+				continue
+			}
+			switch libvirt.ConnectDomainEventBlockJobStatus(msg.Msg.Status) {
+			case libvirt.DomainBlockJobCompleted:
+				return nil
+			case libvirt.DomainBlockJobFailed:
+				return fmt.Errorf("block job on %s failed", device)
+			case libvirt.DomainBlockJobCanceled:
+				return fmt.Errorf("block job on %s was cancelled", device)
+			case libvirt.DomainBlockJobReady:
+				if activeCommit {
+					return nil
+				}
+			}
+
+		case <-ticker.C:
+			found, _, _, cur, end, err := lv.DomainGetBlockJobInfo(domain, device, 0)
+			if err != nil {
+				return fmt.Errorf("failed to get block job info for %s: %w", device, err)
+			}
+			if found == 0 {
+				// Job no longer exists - it finished between events
+				return nil
+			}
+			if progress != nil {
+				progress(BlockJobProgress{Device: device, Current: cur, End: end})
+			}
+			if activeCommit && end > 0 && cur == end {
+				return nil
+			}
+		}
+	}
+}
+
+// findDomainDisk returns the disk attached at the given target device.
+// The live XML is used so that backing chain information is included.
+func findDomainDisk(lv LibvirtClient, domain libvirt.Domain, device string) (*libvirtxml.DomainDisk, error) {
+	xmlDesc, err := lv.DomainGetXMLDesc(domain, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain XML: %w", err)
+	}
+
+	var domainDef libvirtxml.Domain
+	if err := domainDef.Unmarshal(xmlDesc); err != nil {
+		return nil, fmt.Errorf("failed to parse domain XML: %w", err)
+	}
+
+	if domainDef.Devices != nil {
+		for i := range domainDef.Devices.Disks {
+			disk := &domainDef.Devices.Disks[i]
+			if disk.Target != nil && disk.Target.Dev == device {
+				return disk, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("disk %s not found on VM '%s'", device, domain.Name)
+}
+
+// hasBackingChain reports whether a disk has at least one backing file.
+// Libvirt terminates the chain with an empty <backingStore/> element, which
+// libvirtxml decodes as a source with no concrete type set, so a backing store
+// only counts if its source points at something.
+func hasBackingChain(disk *libvirtxml.DomainDisk) bool {
+	if disk.BackingStore == nil || disk.BackingStore.Source == nil {
+		return false
+	}
+	src := disk.BackingStore.Source
+	return src.File != nil || src.Block != nil || src.Network != nil || src.Volume != nil
+}
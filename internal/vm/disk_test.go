@@ -0,0 +1,543 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/status"
+)
+
+// domainXMLWithBackingChain is a live domain XML where vda has a backing file.
+const domainXMLWithBackingChain = `<domain type='kvm'>
+  <name>test-vm</name>
+  <devices>
+    <disk type='file' device='disk'>
+      <driver name='qemu' type='qcow2'/>
+      <source file='/var/lib/libvirt/images/foundry/vms/test-vm_boot.qcow2'/>
+      <backingStore type='file'>
+        <format type='qcow2'/>
+        <source file='/var/lib/libvirt/images/foundry/images/fedora-43.qcow2'/>
+        <backingStore/>
+      </backingStore>
+      <target dev='vda' bus='virtio'/>
+    </disk>
+    <disk type='file' device='disk'>
+      <driver name='qemu' type='qcow2'/>
+      <source file='/var/lib/libvirt/images/foundry/vms/test-vm_data-vdb.qcow2'/>
+      <backingStore/>
+      <target dev='vdb' bus='virtio'/>
+    </disk>
+  </devices>
+</domain>`
+
+// newFlattenMock returns a mock with a running domain that has a backing chain.
+func newFlattenMock() *mockLibvirtClient {
+	lv := newMockLibvirtClient()
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		return libvirt.Domain{Name: name}, nil
+	}
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		return domainXMLWithBackingChain, nil
+	}
+	return lv
+}
+
+// blockJobEvents returns a subscribe func delivering a single block job event.
+func blockJobEvents(status libvirt.ConnectDomainEventBlockJobStatus) func(context.Context, libvirt.DomainEventID, libvirt.OptDomain) (<-chan interface{}, error) {
+	return func(ctx context.Context, eventID libvirt.DomainEventID, dom libvirt.OptDomain) (<-chan interface{}, error) {
+		ch := make(chan interface{}, 1)
+		ch <- &libvirt.DomainEventCallbackBlockJobMsg{
+			Msg: libvirt.DomainEventBlockJobMsg{
+				Dom:    libvirt.Domain{Name: "test-vm"},
+				Path:   "/var/lib/libvirt/images/foundry/vms/test-vm_boot.qcow2",
+				Type:   int32(libvirt.DomainBlockJobTypePull),
+				Status: int32(status),
+			},
+		}
+		return ch, nil
+	}
+}
+
+func TestFlattenDiskWithDeps_CompletedEvent(t *testing.T) {
+	lv := newFlattenMock()
+	lv.subscribeEventsFunc = blockJobEvents(libvirt.DomainBlockJobCompleted)
+
+	err := flattenDiskWithDeps(context.Background(), "test-vm", "vda", nil, lv)
+	if err != nil {
+		t.Fatalf("flattenDiskWithDeps() error = %v", err)
+	}
+	if len(lv.domainBlockPullCalls) != 1 || lv.domainBlockPullCalls[0] != "vda" {
+		t.Errorf("expected block pull on vda, got %v", lv.domainBlockPullCalls)
+	}
+	if len(lv.subscribeEventsCalls) != 1 || lv.subscribeEventsCalls[0] != libvirt.DomainEventIDBlockJob {
+		t.Errorf("expected block job event subscription, got %v", lv.subscribeEventsCalls)
+	}
+}
+
+func TestFlattenDiskWithDeps_FailedEvent(t *testing.T) {
+	lv := newFlattenMock()
+	lv.subscribeEventsFunc = blockJobEvents(libvirt.DomainBlockJobFailed)
+
+	err := flattenDiskWithDeps(context.Background(), "test-vm", "vda", nil, lv)
+	if err == nil || !strings.Contains(err.Error(), "failed") {
+		t.Fatalf("expected block job failure, got %v", err)
+	}
+}
+
+func TestFlattenDiskWithDeps_PollingFallback(t *testing.T) {
+	lv := newFlattenMock()
+	lv.subscribeEventsFunc = func(ctx context.Context, eventID libvirt.DomainEventID, dom libvirt.OptDomain) (<-chan interface{}, error) {
+		return nil, errors.New("events not supported")
+	}
+	polls := 0
+	lv.domainGetBlockJobInfoFunc = func(dom libvirt.Domain, path string, flags uint32) (int32, int32, uint64, uint64, uint64, error) {
+		polls++
+		if polls == 1 {
+			return 1, int32(libvirt.DomainBlockJobTypePull), 0, 50, 100, nil
+		}
+		return 0, 0, 0, 0, 0, nil
+	}
+
+	var reports []BlockJobProgress
+	err := flattenDiskWithDeps(context.Background(), "test-vm", "vda", func(p BlockJobProgress) {
+		reports = append(reports, p)
+	}, lv)
+	if err != nil {
+		t.Fatalf("flattenDiskWithDeps() error = %v", err)
+	}
+	if len(reports) != 1 || reports[0].Percent() != 50 {
+		t.Errorf("expected one 50%% progress report, got %v", reports)
+	}
+}
+
+func TestFlattenDiskWithDeps_Cancelled(t *testing.T) {
+	lv := newFlattenMock()
+	lv.domainGetBlockJobInfoFunc = func(dom libvirt.Domain, path string, flags uint32) (int32, int32, uint64, uint64, uint64, error) {
+		return 1, int32(libvirt.DomainBlockJobTypePull), 0, 10, 100, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := flattenDiskWithDeps(ctx, "test-vm", "vda", nil, lv)
+	if err == nil || !strings.Contains(err.Error(), "cancelled") {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+	if len(lv.domainBlockJobAbortCalls) != 1 {
+		t.Errorf("expected block job abort, got %d calls", len(lv.domainBlockJobAbortCalls))
+	}
+}
+
+func TestFlattenDiskWithDeps_NoBackingChain(t *testing.T) {
+	lv := newFlattenMock()
+
+	if err := flattenDiskWithDeps(context.Background(), "test-vm", "vdb", nil, lv); err != nil {
+		t.Fatalf("flattenDiskWithDeps() error = %v", err)
+	}
+	if len(lv.domainBlockPullCalls) != 0 {
+		t.Errorf("expected no block pull for standalone disk, got %v", lv.domainBlockPullCalls)
+	}
+}
+
+func TestFlattenDiskWithDeps_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		device      string
+		setupMock   func(*mockLibvirtClient)
+		expectError string
+	}{
+		{
+			name:   "VM not running",
+			device: "vda",
+			setupMock: func(lv *mockLibvirtClient) {
+				lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+					return domainStateShutoff, 0, nil
+				}
+			},
+			expectError: "must be running",
+		},
+		{
+			name:        "disk not found",
+			device:      "vdz",
+			setupMock:   func(lv *mockLibvirtClient) {},
+			expectError: "disk vdz not found",
+		},
+		{
+			name:   "block pull fails",
+			device: "vda",
+			setupMock: func(lv *mockLibvirtClient) {
+				lv.domainBlockPullFunc = func(dom libvirt.Domain, path string, bandwidth uint64, flags libvirt.DomainBlockPullFlags) error {
+					return errors.New("operation not supported")
+				}
+			},
+			expectError: "failed to start block pull",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lv := newFlattenMock()
+			tt.setupMock(lv)
+
+			err := flattenDiskWithDeps(context.Background(), "test-vm", tt.device, nil, lv)
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Fatalf("expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+// flattenedVM returns a stored VM with boot image annotations.
+func flattenedVM() *v1alpha1.VirtualMachine {
+	vm := testVMConfig()
+	vm.Annotations = map[string]string{
+		v1alpha1.AnnotationBootImagePath:        testImagePath,
+		v1alpha1.AnnotationBootImageFingerprint: "sha256:fedora-43.qcow2",
+	}
+	return vm
+}
+
+func TestFlattenVMWithDeps_Running(t *testing.T) {
+	lv, sm := newApplyMocks(t, flattenedVM())
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		return domainXMLWithBackingChain, nil
+	}
+	lv.subscribeEventsFunc = blockJobEvents(libvirt.DomainBlockJobCompleted)
+
+	flattened, err := flattenVMWithDeps(context.Background(), "test-vm", nil, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("flattenVMWithDeps() error = %v", err)
+	}
+	if strings.Join(flattened, ",") != "vda" {
+		t.Errorf("flattened = %v, want [vda]", flattened)
+	}
+	if len(lv.domainBlockPullCalls) != 1 || lv.domainBlockPullCalls[0] != "vda" {
+		t.Errorf("expected block pull on vda, got %v", lv.domainBlockPullCalls)
+	}
+	if len(sm.flattenVolumeCalls) != 0 {
+		t.Errorf("volumes of a running VM must not be flattened directly, got %v", sm.flattenVolumeCalls)
+	}
+
+	loaded, err := newMockMetadataClient(lv).Load(libvirt.Domain{Name: "test-vm"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	for _, key := range []string{v1alpha1.AnnotationBootImagePath, v1alpha1.AnnotationBootImageFingerprint} {
+		if _, ok := loaded.Annotations[key]; ok {
+			t.Errorf("annotation %s not removed after flattening the boot disk", key)
+		}
+	}
+}
+
+func TestFlattenVMWithDeps_Stopped(t *testing.T) {
+	stored := flattenedVM()
+	stored.Spec.DataDisks = testVMConfigWithDataDisks().Spec.DataDisks
+	lv, sm := newApplyMocks(t, stored)
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateShutoff, 0, nil
+	}
+	sm.flattenVolumeFunc = func(ctx context.Context, poolName, volumeName string) (bool, error) {
+		return volumeName == "test-vm_data-vdc.qcow2", nil
+	}
+
+	flattened, err := flattenVMWithDeps(context.Background(), "test-vm", nil, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("flattenVMWithDeps() error = %v", err)
+	}
+	if strings.Join(flattened, ",") != "vdc" {
+		t.Errorf("flattened = %v, want [vdc]", flattened)
+	}
+	want := "foundry-vms/test-vm_boot.qcow2 foundry-vms/test-vm_data-vdb.qcow2 foundry-vms/test-vm_data-vdc.qcow2"
+	if got := strings.Join(sm.flattenVolumeCalls, " "); got != want {
+		t.Errorf("FlattenVolume calls = %s, want %s", got, want)
+	}
+	if len(lv.domainBlockPullCalls) != 0 {
+		t.Errorf("expected no block pull for a stopped VM, got %v", lv.domainBlockPullCalls)
+	}
+
+	// The boot disk still has its backing image, so the annotations stay
+	loaded, err := newMockMetadataClient(lv).Load(libvirt.Domain{Name: "test-vm"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Annotations[v1alpha1.AnnotationBootImagePath] != testImagePath {
+		t.Error("boot image annotation removed although the boot disk was not flattened")
+	}
+}
+
+func TestResizeDiskWithDeps_RunningUsesBlockResize(t *testing.T) {
+	stored := testVMConfigWithDataDisks()
+	stored.Generation = 1
+	lv, sm := newApplyMocks(t, stored)
+
+	var resizedTo uint64
+	lv.domainBlockResizeFunc = func(dom libvirt.Domain, disk string, size uint64, flags libvirt.DomainBlockResizeFlags) error {
+		resizedTo = size
+		return nil
+	}
+
+	if err := resizeDiskWithDeps(context.Background(), "test-vm", "vdb", 80, lv, sm, newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("resizeDiskWithDeps() error = %v", err)
+	}
+
+	if len(lv.domainBlockResizeCalls) != 1 || lv.domainBlockResizeCalls[0] != "vdb" {
+		t.Errorf("DomainBlockResize calls = %v, want [vdb]", lv.domainBlockResizeCalls)
+	}
+	if resizedTo != 80*1024*1024*1024 {
+		t.Errorf("resized to %d bytes, want 80GiB", resizedTo)
+	}
+	if len(sm.resizeVolumeCalls) != 0 {
+		t.Errorf("volume of a running VM must not be resized directly, got %v", sm.resizeVolumeCalls)
+	}
+
+	loaded, err := newMockMetadataClient(lv).Load(libvirt.Domain{Name: "test-vm"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Spec.DataDisks[0].SizeGB != 80 {
+		t.Errorf("stored vdb size = %d, want 80", loaded.Spec.DataDisks[0].SizeGB)
+	}
+	if loaded.Generation != 2 || loaded.Status.ObservedGeneration != 2 {
+		t.Errorf("stored generation = %d, observedGeneration = %d, want 2/2", loaded.Generation, loaded.Status.ObservedGeneration)
+	}
+}
+
+func TestResizeDiskWithDeps_StoppedResizesVolume(t *testing.T) {
+	lv, sm := newApplyMocks(t, testVMConfig())
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateShutoff, 0, nil
+	}
+
+	if err := resizeDiskWithDeps(context.Background(), "test-vm", "vda", 40, lv, sm, newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("resizeDiskWithDeps() error = %v", err)
+	}
+
+	if len(sm.resizeVolumeCalls) != 1 || sm.resizeVolumeCalls[0] != "foundry-vms/test-vm_boot.qcow2" {
+		t.Errorf("ResizeVolume calls = %v, want [foundry-vms/test-vm_boot.qcow2]", sm.resizeVolumeCalls)
+	}
+	if len(lv.domainBlockResizeCalls) != 0 {
+		t.Errorf("expected no block resize for a stopped VM, got %v", lv.domainBlockResizeCalls)
+	}
+}
+
+func TestResizeDiskWithDeps_Rejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		device  string
+		sizeGB  int
+		wantErr string
+	}{
+		{"shrink", "vda", 10, "cannot shrink"},
+		{"unknown device", "vdz", 100, "not found"},
+		{"cdrom", "sda", 100, "not found"},
+		{"zero size", "vda", 0, "invalid size"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lv, sm := newApplyMocks(t, testVMConfig())
+
+			err := resizeDiskWithDeps(context.Background(), "test-vm", tt.device, tt.sizeGB, lv, sm, newMockMetadataClient(lv))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			if len(lv.domainBlockResizeCalls) != 0 || len(sm.resizeVolumeCalls) != 0 || len(lv.domainSetMetadataCalls) != 0 {
+				t.Error("nothing must be changed when the resize is rejected")
+			}
+		})
+	}
+}
+
+func TestResizeDiskWithDeps_SameSizeIsNoop(t *testing.T) {
+	lv, sm := newApplyMocks(t, testVMConfig())
+
+	if err := resizeDiskWithDeps(context.Background(), "test-vm", "vda", 20, lv, sm, newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("resizeDiskWithDeps() error = %v", err)
+	}
+	if len(lv.domainBlockResizeCalls) != 0 || len(lv.domainSetMetadataCalls) != 0 {
+		t.Error("expected no changes when the size is unchanged")
+	}
+}
+
+func TestAttachDiskWithDeps_Running(t *testing.T) {
+	stored := testVMConfig()
+	stored.Generation = 1
+	lv, sm := newApplyMocks(t, stored)
+
+	var attachFlags uint32
+	lv.domainAttachDeviceFunc = func(dom libvirt.Domain, xml string, flags uint32) error {
+		attachFlags = flags
+		return nil
+	}
+
+	if err := attachDiskWithDeps(context.Background(), "test-vm", "vdc", 30, lv, sm, newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("attachDiskWithDeps() error = %v", err)
+	}
+
+	if len(sm.createVolumeCalls) != 1 || sm.createVolumeCalls[0].Name != "test-vm_data-vdc.qcow2" || sm.createVolumeCalls[0].CapacityGB != 30 {
+		t.Errorf("created volumes = %+v, want test-vm_data-vdc.qcow2 of 30GB", sm.createVolumeCalls)
+	}
+	if len(lv.domainAttachDeviceCalls) != 1 || !strings.Contains(lv.domainAttachDeviceCalls[0], "test-vm_data-vdc.qcow2") || !strings.Contains(lv.domainAttachDeviceCalls[0], `dev="vdc"`) {
+		t.Errorf("attached XML = %v, want the vdc volume", lv.domainAttachDeviceCalls)
+	}
+	if want := uint32(libvirt.DomainAffectConfig | libvirt.DomainAffectLive); attachFlags != want {
+		t.Errorf("attach flags = %d, want config+live (%d)", attachFlags, want)
+	}
+
+	loaded, err := newMockMetadataClient(lv).Load(libvirt.Domain{Name: "test-vm"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(loaded.Spec.DataDisks) != 1 || loaded.Spec.DataDisks[0].Device != "vdc" || loaded.Spec.DataDisks[0].SizeGB != 30 {
+		t.Errorf("stored data disks = %+v, want vdc of 30GB", loaded.Spec.DataDisks)
+	}
+	if loaded.Generation != 2 {
+		t.Errorf("stored generation = %d, want 2", loaded.Generation)
+	}
+	if cond := status.GetCondition(loaded, v1alpha1.ConditionStorageProvisioned); cond == nil || cond.Reason != "DiskAttached" || cond.ObservedGeneration != 2 {
+		t.Errorf("StorageProvisioned = %+v, want DiskAttached at generation 2", cond)
+	}
+}
+
+func TestAttachDiskWithDeps_StoppedOnlyChangesConfig(t *testing.T) {
+	lv, sm := newApplyMocks(t, testVMConfig())
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateShutoff, 0, nil
+	}
+	var attachFlags uint32
+	lv.domainAttachDeviceFunc = func(dom libvirt.Domain, xml string, flags uint32) error {
+		attachFlags = flags
+		return nil
+	}
+
+	if err := attachDiskWithDeps(context.Background(), "test-vm", "vdb", 10, lv, sm, newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("attachDiskWithDeps() error = %v", err)
+	}
+	if attachFlags != uint32(libvirt.DomainAffectConfig) {
+		t.Errorf("attach flags = %d, want config only", attachFlags)
+	}
+}
+
+func TestAttachDiskWithDeps_AttachFailureDeletesVolume(t *testing.T) {
+	lv, sm := newApplyMocks(t, testVMConfig())
+	lv.domainAttachDeviceFunc = func(dom libvirt.Domain, xml string, flags uint32) error {
+		return errors.New("no free PCI slot")
+	}
+
+	err := attachDiskWithDeps(context.Background(), "test-vm", "vdb", 10, lv, sm, newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "no free PCI slot") {
+		t.Fatalf("error = %v, want attach failure", err)
+	}
+	if len(sm.deleteVolumeCalls) != 1 || sm.deleteVolumeCalls[0] != "foundry-vms/test-vm_data-vdb.qcow2" {
+		t.Errorf("deleted volumes = %v, want the new volume cleaned up", sm.deleteVolumeCalls)
+	}
+	if len(lv.domainSetMetadataCalls) != 0 {
+		t.Error("expected the stored spec to be left alone")
+	}
+}
+
+func TestAttachDiskWithDeps_Rejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		device  string
+		sizeGB  int
+		wantErr string
+	}{
+		{"boot disk", "vda", 10, "invalid device"},
+		{"not virtio", "sdb", 10, "invalid device"},
+		{"zero size", "vdc", 0, "invalid size"},
+		{"existing data disk", "vdb", 10, "already has a disk vdb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lv, sm := newApplyMocks(t, testVMConfigWithDataDisks())
+
+			err := attachDiskWithDeps(context.Background(), "test-vm", tt.device, tt.sizeGB, lv, sm, newMockMetadataClient(lv))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			if len(sm.createVolumeCalls) != 0 || len(lv.domainAttachDeviceCalls) != 0 {
+				t.Error("nothing must be changed when the attach is rejected")
+			}
+		})
+	}
+}
+
+// newDetachMocks returns mocks for a VM with data disk vdb whose guest
+// releases vdb once it is detached.
+func newDetachMocks(t *testing.T) (*mockLibvirtClient, *mockStorageManager) {
+	t.Helper()
+	lv, sm := newApplyMocks(t, testVMConfigWithDataDisks())
+	detached := false
+	lv.domainDetachDeviceFunc = func(dom libvirt.Domain, xml string, flags uint32) error {
+		detached = true
+		return nil
+	}
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		if detached {
+			return "<domain type='kvm'><name>test-vm</name></domain>", nil
+		}
+		return domainXMLWithBackingChain, nil
+	}
+	return lv, sm
+}
+
+func TestDetachDiskWithDeps(t *testing.T) {
+	lv, sm := newDetachMocks(t)
+
+	if err := detachDiskWithDeps(context.Background(), "test-vm", "vdb", time.Second, lv, sm, newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("detachDiskWithDeps() error = %v", err)
+	}
+
+	if len(lv.domainDetachDeviceCalls) != 1 || !strings.Contains(lv.domainDetachDeviceCalls[0], "test-vm_data-vdb.qcow2") {
+		t.Errorf("detached XML = %v, want vdb", lv.domainDetachDeviceCalls)
+	}
+	if len(sm.deleteVolumeCalls) != 1 || sm.deleteVolumeCalls[0] != "foundry-vms/test-vm_data-vdb.qcow2" {
+		t.Errorf("deleted volumes = %v, want the vdb volume", sm.deleteVolumeCalls)
+	}
+
+	loaded, err := newMockMetadataClient(lv).Load(libvirt.Domain{Name: "test-vm"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	for _, disk := range loaded.Spec.DataDisks {
+		if disk.Device == "vdb" {
+			t.Errorf("stored data disks = %+v, want vdb removed", loaded.Spec.DataDisks)
+		}
+	}
+}
+
+func TestDetachDiskWithDeps_KeepsVolumeUntilReleased(t *testing.T) {
+	lv, sm := newDetachMocks(t)
+	// The guest never releases the disk
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		return domainXMLWithBackingChain, nil
+	}
+
+	err := detachDiskWithDeps(context.Background(), "test-vm", "vdb", 0, lv, sm, newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "has not released it") {
+		t.Fatalf("error = %v, want not released", err)
+	}
+	if len(sm.deleteVolumeCalls) != 0 {
+		t.Errorf("deleted volumes = %v, want the volume kept", sm.deleteVolumeCalls)
+	}
+}
+
+func TestDetachDiskWithDeps_UnknownDisk(t *testing.T) {
+	lv, sm := newDetachMocks(t)
+
+	err := detachDiskWithDeps(context.Background(), "test-vm", "vda", time.Second, lv, sm, newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("error = %v, want not found", err)
+	}
+	if len(lv.domainDetachDeviceCalls) != 0 {
+		t.Error("expected the boot disk not to be detached")
+	}
+}
@@ -0,0 +1,126 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/digitalocean/go-libvirt"
+	"libvirt.org/go/libvirtxml"
+
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+)
+
+// DisplayInfo describes how to connect to the display of a VM.
+type DisplayInfo struct {
+	// Type is the display protocol, vnc or spice.
+	Type string
+
+	// Host and Port are where a client connects.
+	Host string
+	Port int
+
+	// URI is the connection URI for remote viewers, e.g. vnc://hv1:5900.
+	URI string
+
+	// PasswordRequired is set if the display asks for a password.
+	PasswordRequired bool
+
+	// TunnelVia is set to the hypervisor host if the display only listens on
+	// its loopback address, so clients need an SSH tunnel to reach it.
+	TunnelVia string
+}
+
+// Display returns how to connect to the display of a running VM. With a remote
+// connection the display is reached on the hypervisor's host name.
+func Display(ctx context.Context, name string) (*DisplayInfo, error) {
+	client, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			logging.FromContext(ctx).Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	return displayWithDeps(name, foundrylibvirt.RemoteHost(""), client.Libvirt())
+}
+
+// displayWithDeps returns the display of a VM with injected dependencies.
+// hypervisorHost is the host name of a remote hypervisor, or empty for a
+// local one.
+func displayWithDeps(name, hypervisorHost string, lv LibvirtClient) (*DisplayInfo, error) {
+	domain, err := lv.DomainLookupByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find VM %s: %w", name, err)
+	}
+
+	// The live XML has the port libvirt assigned
+	xmlDesc, err := lv.DomainGetXMLDesc(domain, libvirt.DomainXMLSecure)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain XML: %w", err)
+	}
+	var domainDef libvirtxml.Domain
+	if err := domainDef.Unmarshal(xmlDesc); err != nil {
+		return nil, fmt.Errorf("failed to parse domain XML: %w", err)
+	}
+
+	var info *DisplayInfo
+	var listen string
+	if domainDef.Devices != nil {
+		for _, graphic := range domainDef.Devices.Graphics {
+			switch {
+			case graphic.VNC != nil:
+				info = &DisplayInfo{Type: "vnc", Port: graphic.VNC.Port, PasswordRequired: graphic.VNC.Passwd != ""}
+				listen = graphicListen(graphic.VNC.Listen, graphic.VNC.Listeners)
+			case graphic.Spice != nil:
+				info = &DisplayInfo{Type: "spice", Port: graphic.Spice.Port, PasswordRequired: graphic.Spice.Passwd != ""}
+				listen = graphicListen(graphic.Spice.Listen, graphic.Spice.Listeners)
+			default:
+				continue
+			}
+			break
+		}
+	}
+	if info == nil {
+		return nil, fmt.Errorf("VM %s has no display (set spec.graphics)", name)
+	}
+	if info.Port <= 0 {
+		return nil, fmt.Errorf("VM %s is not running; its display port is assigned when it starts", name)
+	}
+
+	ip := net.ParseIP(listen)
+	switch {
+	case listen == "" || ip != nil && ip.IsUnspecified():
+		// Listening on every address: reachable wherever the hypervisor is
+		info.Host = hypervisorHost
+		if info.Host == "" {
+			info.Host = "localhost"
+		}
+	case ip != nil && ip.IsLoopback() && hypervisorHost != "":
+		info.Host = listen
+		info.TunnelVia = hypervisorHost
+	default:
+		info.Host = listen
+	}
+
+	info.URI = fmt.Sprintf("%s://%s", info.Type, net.JoinHostPort(info.Host, strconv.Itoa(info.Port)))
+	return info, nil
+}
+
+// graphicListen returns the address a display listens on from its listen
+// attribute or first address listener.
+func graphicListen(listen string, listeners []libvirtxml.DomainGraphicListener) string {
+	if listen != "" {
+		return listen
+	}
+	for _, l := range listeners {
+		if l.Address != nil {
+			return l.Address.Address
+		}
+	}
+	return ""
+}
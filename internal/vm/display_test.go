@@ -0,0 +1,83 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+)
+
+func newDisplayMock(graphics string) *mockLibvirtClient {
+	lv := newMockLibvirtClient()
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		return libvirt.Domain{Name: name}, nil
+	}
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		return "<domain type='kvm'><name>" + dom.Name + "</name><devices>" + graphics + "</devices></domain>", nil
+	}
+	return lv
+}
+
+func TestDisplayWithDeps(t *testing.T) {
+	tests := []struct {
+		name           string
+		graphics       string
+		hypervisorHost string
+		want           DisplayInfo
+	}{
+		{
+			name:     "local vnc on loopback",
+			graphics: `<graphics type='vnc' port='5901' autoport='yes' listen='127.0.0.1'><listen type='address' address='127.0.0.1'/></graphics>`,
+			want:     DisplayInfo{Type: "vnc", Host: "127.0.0.1", Port: 5901, URI: "vnc://127.0.0.1:5901"},
+		},
+		{
+			name:           "remote vnc on loopback needs a tunnel",
+			graphics:       `<graphics type='vnc' port='5901' autoport='yes' passwd='s3cret'><listen type='address' address='127.0.0.1'/></graphics>`,
+			hypervisorHost: "hv1",
+			want:           DisplayInfo{Type: "vnc", Host: "127.0.0.1", Port: 5901, URI: "vnc://127.0.0.1:5901", PasswordRequired: true, TunnelVia: "hv1"},
+		},
+		{
+			name:           "remote spice on every address",
+			graphics:       `<graphics type='spice' port='5930' autoport='no' listen='0.0.0.0'><listen type='address' address='0.0.0.0'/></graphics>`,
+			hypervisorHost: "hv1",
+			want:           DisplayInfo{Type: "spice", Host: "hv1", Port: 5930, URI: "spice://hv1:5930"},
+		},
+		{
+			name:     "specific address",
+			graphics: `<graphics type='vnc' port='5900' listen='fd00::10'/>`,
+			want:     DisplayInfo{Type: "vnc", Host: "fd00::10", Port: 5900, URI: "vnc://[fd00::10]:5900"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := displayWithDeps("test-vm", tt.hypervisorHost, newDisplayMock(tt.graphics))
+			if err != nil {
+				t.Fatalf("displayWithDeps() error = %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("displayWithDeps() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplayWithDeps_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		graphics string
+		wantErr  string
+	}{
+		{name: "headless", graphics: "", wantErr: "has no display"},
+		{name: "not running", graphics: `<graphics type='vnc' port='-1' autoport='yes'/>`, wantErr: "is not running"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := displayWithDeps("test-vm", "", newDisplayMock(tt.graphics))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("displayWithDeps() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
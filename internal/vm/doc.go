@@ -6,6 +6,7 @@
 //
 // The main operations are:
 //   - Create: Create a new VM from a configuration file
+//   - Plan: Show what Create would generate, without touching libvirt
 //   - Destroy: Shut down and remove a VM (not yet implemented)
 //   - List: List all VMs and their status (not yet implemented)
 //
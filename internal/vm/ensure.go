@@ -0,0 +1,64 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+)
+
+// ErrSpecDiffers is returned (wrapped, with the differences) by Create with
+// Ensure when the VM already exists with a different spec.
+var ErrSpecDiffers = errors.New("VM already exists with a different spec")
+
+// Ensure makes Create idempotent: if the VM already exists with the same
+// spec, nothing is done and the result reports it as Existed. If it exists
+// with a different spec, an error wrapping ErrSpecDiffers lists the
+// differences instead of changing the VM (that is what Apply is for).
+func Ensure() CreateOption {
+	return func(o *createOptions) {
+		o.ensure = true
+	}
+}
+
+// existsUnchanged reports whether vm already exists with the same spec. It
+// returns false if the VM does not exist, and an error wrapping
+// ErrSpecDiffers if it exists with a different spec.
+func existsUnchanged(ctx context.Context, vm *v1alpha1.VirtualMachine, lv LibvirtClient, mc *metadata.Client) (bool, error) {
+	// A generated name never matches an existing VM, so there is nothing to
+	// compare against
+	if vm.Name == "" && vm.GenerateName != "" {
+		return false, fmt.Errorf("metadata.generateName cannot be used to ensure a VM exists; set metadata.name")
+	}
+
+	domain, err := lv.DomainLookupByName(vm.Name)
+	if err != nil {
+		return false, nil
+	}
+
+	current, err := mc.Load(domain)
+	if err != nil {
+		return false, fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", vm.Name, err)
+	}
+
+	// Compare the way apply does, so that what creation filled in (MAC
+	// addresses, annotations) is not reported as a difference
+	desired := vm.DeepCopy()
+	inheritMACAddresses(current, desired)
+	inheritAnnotations(current, desired)
+	changes := diffSpec(current, desired)
+	if len(changes) > 0 {
+		lines := make([]string, len(changes))
+		for i, change := range changes {
+			lines[i] = change.String()
+		}
+		return false, fmt.Errorf("%w: VM '%s' (update it with 'foundry apply'):\n  %s", ErrSpecDiffers, vm.Name, strings.Join(lines, "\n  "))
+	}
+
+	logging.FromContext(ctx).Info("VM already exists with the same spec", "vm", vm.Name)
+	return true, nil
+}
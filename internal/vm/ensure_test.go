@@ -0,0 +1,61 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExistsUnchanged(t *testing.T) {
+	// Stored as created: with the naming strategy annotations and MACs
+	stored := testVMConfigWithCloudInit()
+	if err := assignMACAddresses(stored); err != nil {
+		t.Fatal(err)
+	}
+	lv, _ := newApplyMocks(t, stored)
+
+	existed, err := existsUnchanged(context.Background(), testVMConfigWithCloudInit(), lv, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("existsUnchanged() error = %v", err)
+	}
+	if !existed {
+		t.Error("existsUnchanged() = false, want true for the same spec")
+	}
+}
+
+func TestExistsUnchanged_Differs(t *testing.T) {
+	lv, _ := newApplyMocks(t, testVMConfig())
+
+	desired := testVMConfig()
+	desired.Spec.VCPUs = 4
+	desired.Spec.BootDisk.SizeGB = 40
+
+	_, err := existsUnchanged(context.Background(), desired, lv, newMockMetadataClient(lv))
+	if !errors.Is(err, ErrSpecDiffers) {
+		t.Fatalf("existsUnchanged() error = %v, want ErrSpecDiffers", err)
+	}
+	for _, want := range []string{"spec.vcpus: 2 -> 4", "spec.bootDisk: (current) -> (changed)"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error = %q, want it to contain %q", err, want)
+		}
+	}
+	if len(lv.domainDefineXMLCalls) != 0 || len(lv.domainSetMetadataCalls) != 0 {
+		t.Error("expected the existing VM to be left alone")
+	}
+}
+
+func TestExistsUnchanged_Missing(t *testing.T) {
+	lv := newMockLibvirtClient()
+
+	existed, err := existsUnchanged(context.Background(), testVMConfig(), lv, newMockMetadataClient(lv))
+	if err != nil || existed {
+		t.Errorf("existsUnchanged() = %v, %v, want false, nil so the VM is created", existed, err)
+	}
+
+	generated := testVMConfig()
+	generated.Name, generated.GenerateName = "", "ci-"
+	if _, err := existsUnchanged(context.Background(), generated, lv, newMockMetadataClient(lv)); err == nil {
+		t.Error("existsUnchanged() error = nil, want generateName to be rejected")
+	}
+}
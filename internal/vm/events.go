@@ -0,0 +1,175 @@
+// Package vm provides high-level VM management operations.
+package vm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+)
+
+// watchRetryInterval is how long WatchLifecycle waits before reconnecting
+// after losing the libvirt connection.
+const watchRetryInterval = 5 * time.Second
+
+// LifecycleEventType is the kind of VM state change reported by WatchLifecycle.
+type LifecycleEventType string
+
+const (
+	// LifecycleCreated is reported when a new domain is defined.
+	LifecycleCreated LifecycleEventType = "created"
+
+	// LifecycleDestroyed is reported when a domain is undefined.
+	LifecycleDestroyed LifecycleEventType = "destroyed"
+
+	// LifecycleStarted is reported when a domain starts running.
+	LifecycleStarted LifecycleEventType = "started"
+
+	// LifecycleStopped is reported when a domain stops (shutdown, destroy, save, migration).
+	LifecycleStopped LifecycleEventType = "stopped"
+
+	// LifecycleCrashed is reported when a domain's guest or QEMU process crashes.
+	LifecycleCrashed LifecycleEventType = "crashed"
+)
+
+// LifecycleEvent is a VM state change.
+type LifecycleEvent struct {
+	// VMName is the name of the domain.
+	VMName string
+
+	// Type is the kind of change.
+	Type LifecycleEventType
+
+	// Reason is libvirt's detail for the change (e.g., "shutdown", "destroyed").
+	Reason string
+
+	// Time is when foundry received the event.
+	Time time.Time
+}
+
+// WatchLifecycle calls fn for every VM lifecycle event on the hypervisor
+// until ctx is cancelled.
+//
+// If the libvirt connection is lost, WatchLifecycle reconnects and resumes;
+// events that happen while disconnected are not reported.
+func WatchLifecycle(ctx context.Context, fn func(LifecycleEvent)) error {
+	for {
+		err := watchLifecycleOnce(ctx, fn)
+		if ctx.Err() != nil {
+			return nil
+		}
+		logging.FromContext(ctx).Warn("Lifecycle event watch interrupted, reconnecting", "retryIn", watchRetryInterval, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watchRetryInterval):
+		}
+	}
+}
+
+// watchLifecycleOnce watches lifecycle events over a single libvirt connection.
+func watchLifecycleOnce(ctx context.Context, fn func(LifecycleEvent)) error {
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logging.FromContext(ctx).Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	return watchLifecycleWithDeps(ctx, LibvirtClient.Libvirt(), fn)
+}
+
+// watchLifecycleWithDeps watches lifecycle events with injected dependencies.
+// It returns nil when ctx is cancelled and an error if the event stream ends.
+func watchLifecycleWithDeps(ctx context.Context, lv LibvirtClient, fn func(LifecycleEvent)) error {
+	events, err := lv.SubscribeEvents(ctx, libvirt.DomainEventIDLifecycle, libvirt.OptDomain{})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to lifecycle events: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-events:
+			if !ok {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("lifecycle event stream closed")
+			}
+			msg, isLifecycle := ev.(*libvirt.DomainEventCallbackLifecycleMsg)
+			if !isLifecycle {
+				continue
+			}
+			if event, ok := toLifecycleEvent(msg.Msg); ok {
+				fn(event)
+			}
+		}
+	}
+}
+
+// toLifecycleEvent maps a libvirt lifecycle event to a LifecycleEvent.
+// Events that foundry does not report (suspend, resume, definition updates)
+// return false.
+func toLifecycleEvent(msg libvirt.DomainEventLifecycleMsg) (LifecycleEvent, bool) {
+	event := LifecycleEvent{
+		VMName: msg.Dom.Name,
+		Time:   time.Now(),
+	}
+
+	switch libvirt.DomainEventType(msg.Event) {
+	case libvirt.DomainEventDefined:
+		if libvirt.DomainEventDefinedDetailType(msg.Detail) != libvirt.DomainEventDefinedAdded {
+			return LifecycleEvent{}, false
+		}
+		event.Type = LifecycleCreated
+	case libvirt.DomainEventUndefined:
+		event.Type = LifecycleDestroyed
+	case libvirt.DomainEventStarted:
+		event.Type = LifecycleStarted
+	case libvirt.DomainEventStopped:
+		event.Type = LifecycleStopped
+		event.Reason = stoppedReason(libvirt.DomainEventStoppedDetailType(msg.Detail))
+		if detail := libvirt.DomainEventStoppedDetailType(msg.Detail); detail == libvirt.DomainEventStoppedCrashed || detail == libvirt.DomainEventStoppedFailed {
+			event.Type = LifecycleCrashed
+		}
+	case libvirt.DomainEventCrashed:
+		event.Type = LifecycleCrashed
+		event.Reason = "panicked"
+	default:
+		return LifecycleEvent{}, false
+	}
+
+	return event, true
+}
+
+// stoppedReason describes why a domain stopped.
+func stoppedReason(detail libvirt.DomainEventStoppedDetailType) string {
+	switch detail {
+	case libvirt.DomainEventStoppedShutdown:
+		return "shutdown"
+	case libvirt.DomainEventStoppedDestroyed:
+		return "destroyed"
+	case libvirt.DomainEventStoppedCrashed:
+		return "crashed"
+	case libvirt.DomainEventStoppedMigrated:
+		return "migrated"
+	case libvirt.DomainEventStoppedSaved:
+		return "saved"
+	case libvirt.DomainEventStoppedFailed:
+		return "failed"
+	case libvirt.DomainEventStoppedFromSnapshot:
+		return "from-snapshot"
+	default:
+		return "unknown"
+	}
+}
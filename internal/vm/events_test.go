@@ -0,0 +1,108 @@
+package vm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+)
+
+func lifecycleMsg(name string, event libvirt.DomainEventType, detail int32) *libvirt.DomainEventCallbackLifecycleMsg {
+	return &libvirt.DomainEventCallbackLifecycleMsg{
+		Msg: libvirt.DomainEventLifecycleMsg{
+			Dom:    libvirt.Domain{Name: name},
+			Event:  int32(event),
+			Detail: detail,
+		},
+	}
+}
+
+func TestToLifecycleEvent(t *testing.T) {
+	tests := []struct {
+		name       string
+		event      libvirt.DomainEventType
+		detail     int32
+		wantType   LifecycleEventType
+		wantReason string
+		wantOK     bool
+	}{
+		{"defined", libvirt.DomainEventDefined, int32(libvirt.DomainEventDefinedAdded), LifecycleCreated, "", true},
+		{"redefined", libvirt.DomainEventDefined, int32(libvirt.DomainEventDefinedUpdated), "", "", false},
+		{"undefined", libvirt.DomainEventUndefined, 0, LifecycleDestroyed, "", true},
+		{"started", libvirt.DomainEventStarted, 0, LifecycleStarted, "", true},
+		{"shutdown", libvirt.DomainEventStopped, int32(libvirt.DomainEventStoppedShutdown), LifecycleStopped, "shutdown", true},
+		{"destroyed", libvirt.DomainEventStopped, int32(libvirt.DomainEventStoppedDestroyed), LifecycleStopped, "destroyed", true},
+		{"qemu crashed", libvirt.DomainEventStopped, int32(libvirt.DomainEventStoppedCrashed), LifecycleCrashed, "crashed", true},
+		{"guest panicked", libvirt.DomainEventCrashed, 0, LifecycleCrashed, "panicked", true},
+		{"suspended", libvirt.DomainEventSuspended, 0, "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := toLifecycleEvent(lifecycleMsg("test-vm", tt.event, tt.detail).Msg)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if got.VMName != "test-vm" || got.Type != tt.wantType || got.Reason != tt.wantReason {
+				t.Errorf("event = %+v, want type %q reason %q", got, tt.wantType, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestWatchLifecycleWithDeps(t *testing.T) {
+	lv := newMockLibvirtClient()
+	events := make(chan interface{}, 3)
+	events <- lifecycleMsg("a", libvirt.DomainEventStarted, 0)
+	events <- lifecycleMsg("a", libvirt.DomainEventSuspended, 0) // not reported
+	events <- lifecycleMsg("b", libvirt.DomainEventUndefined, 0)
+	close(events)
+	lv.subscribeEventsFunc = func(ctx context.Context, eventID libvirt.DomainEventID, dom libvirt.OptDomain) (<-chan interface{}, error) {
+		if eventID != libvirt.DomainEventIDLifecycle {
+			t.Errorf("eventID = %v, want lifecycle", eventID)
+		}
+		return events, nil
+	}
+
+	var got []LifecycleEvent
+	err := watchLifecycleWithDeps(context.Background(), lv, func(ev LifecycleEvent) {
+		got = append(got, ev)
+	})
+	if err == nil {
+		t.Error("expected an error when the event stream closes")
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(got), got)
+	}
+	if got[0].VMName != "a" || got[0].Type != LifecycleStarted {
+		t.Errorf("event 0 = %+v", got[0])
+	}
+	if got[1].VMName != "b" || got[1].Type != LifecycleDestroyed {
+		t.Errorf("event 1 = %+v", got[1])
+	}
+}
+
+func TestWatchLifecycleWithDeps_StopsOnCancel(t *testing.T) {
+	lv := newMockLibvirtClient()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLifecycleWithDeps(ctx, lv, func(LifecycleEvent) {})
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected nil error on cancel, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watch did not stop after cancel")
+	}
+}
@@ -0,0 +1,370 @@
+package vm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/digitalocean/go-libvirt"
+	"go.yaml.in/yaml/v3"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// hostAnnotations are annotations recorded by foundry that only hold on the
+// host (or for the resource) a VM was created on.
+var hostAnnotations = []string{
+	v1alpha1.AnnotationBootImagePath,
+	v1alpha1.AnnotationBootImageFingerprint,
+	v1alpha1.AnnotationResourceUID,
+}
+
+// ExportSpec returns a copy of a VM suitable for saving as a config file and
+// re-applying, on this or another host: the apiVersion and kind, name,
+// labels, annotations and spec, without status, the metadata populated by
+// foundry (uid, generation, creation timestamp) or the annotations that only
+// hold on this host, such as the recorded boot image. MAC addresses and the
+// naming strategy annotations are kept, so interfaces keep their MACs and
+// names.
+//
+// VMs without a stored spec (domains not created by foundry) cannot be
+// exported.
+func ExportSpec(vm *v1alpha1.VirtualMachine) (*v1alpha1.VirtualMachine, error) {
+	if vm.Spec.VCPUs == 0 {
+		return nil, fmt.Errorf("VM '%s' has no stored spec to export (not managed by foundry?)", vm.Name)
+	}
+
+	copied := vm.DeepCopy()
+	exported := &v1alpha1.VirtualMachine{
+		ObjectMeta: v1alpha1.ObjectMeta{
+			Name:        copied.Name,
+			Labels:      copied.Labels,
+			Annotations: copied.Annotations,
+		},
+		Spec: copied.Spec,
+	}
+	v1alpha1.SetDefaultAPIVersion(exported)
+
+	for _, key := range hostAnnotations {
+		delete(exported.Annotations, key)
+	}
+	if len(exported.Annotations) == 0 {
+		exported.Annotations = nil
+	}
+	return exported, nil
+}
+
+// ExportFormat is the layout VM exports are written in.
+type ExportFormat string
+
+const (
+	// ExportFormatDir writes the exported files into a new directory.
+	ExportFormatDir ExportFormat = "dir"
+	// ExportFormatOVA writes the exported files into a tar archive.
+	ExportFormatOVA ExportFormat = "ova"
+)
+
+// Files written by ExportVM, next to the VM's disk images.
+const (
+	ExportSpecFile   = "vm.yaml"    // Spec ready to re-apply, see ExportSpec
+	ExportDomainFile = "domain.xml" // Inactive libvirt domain XML
+)
+
+// ExportOptions controls how ExportVM writes a VM.
+type ExportOptions struct {
+	Format   ExportFormat // Layout of the export (default dir)
+	Compress bool         // gzip the disk images (adds a .gz suffix)
+	Sparse   bool         // write blocks of zeros in disk images as holes
+}
+
+// ExportResult describes a VM export.
+type ExportResult struct {
+	Path  string         // Directory or archive written
+	Files []ExportedFile // Files of the export, in the order written
+}
+
+// ExportedFile is a file of a VM export.
+type ExportedFile struct {
+	Name   string // File name within the export
+	Volume string // Volume the file was copied from, empty for the spec and domain XML
+	Size   int64  // Size in bytes
+}
+
+// ExportVM writes a stopped VM's spec (see ExportSpec), its inactive domain
+// XML and a copy of each of its volumes (boot, data disks and cloud-init ISO)
+// to dest, as a new directory or a tar archive. Disk images with a backing
+// file are exported flattened, so the export does not depend on the VM's
+// base image. The VM's spec and disk images are enough to recreate it on
+// another host: import the boot disk as an image, or copy the volumes into
+// the storage pool, and apply the spec.
+//
+// dest must not exist. The VM must be shut off, so its disks are consistent.
+func ExportVM(ctx context.Context, vmName, dest string, opts ExportOptions) (*ExportResult, error) {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	return exportVMWithDeps(ctx, vmName, dest, opts, LibvirtClient.Libvirt(), storageMgr, metaClient)
+}
+
+// exportVMWithDeps exports a VM with injected dependencies.
+// This allows for testing by accepting interfaces instead of concrete types.
+func exportVMWithDeps(ctx context.Context, vmName, dest string, opts ExportOptions, lv LibvirtClient, sm storageManager, mc *metadata.Client) (*ExportResult, error) {
+	switch opts.Format {
+	case "":
+		opts.Format = ExportFormatDir
+	case ExportFormatDir, ExportFormatOVA:
+	default:
+		return nil, fmt.Errorf("unsupported export format %q (must be %s or %s)", opts.Format, ExportFormatDir, ExportFormatOVA)
+	}
+
+	// Step 1: Look up the domain and its stored spec
+	domain, err := lv.DomainLookupByName(vmName)
+	if err != nil {
+		return nil, fmt.Errorf("VM '%s' not found: %w", vmName, err)
+	}
+
+	vm, err := mc.Load(domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", vmName, err)
+	}
+	spec, err := ExportSpec(vm)
+	if err != nil {
+		return nil, err
+	}
+
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VM state: %w", err)
+	}
+	if state != domainStateShutoff && state != domainStateCrashed {
+		return nil, fmt.Errorf("VM '%s' must be shut off to be exported", vmName)
+	}
+
+	domainXML, err := lv.DomainGetXMLDesc(domain, libvirt.DomainXMLInactive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain XML: %w", err)
+	}
+
+	// Step 2: Write the files into the export directory, or a staging
+	// directory for archives
+	dir := dest
+	if opts.Format == ExportFormatOVA {
+		if _, err := os.Stat(dest); err == nil {
+			return nil, fmt.Errorf("%s already exists", dest)
+		}
+		dir, err = os.MkdirTemp(filepath.Dir(dest), "."+filepath.Base(dest)+"-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create staging directory: %w", err)
+		}
+		defer func() { _ = os.RemoveAll(dir) }()
+	} else if err := os.Mkdir(dest, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	files, err := writeExportFiles(ctx, dir, vm, spec, domainXML, opts, sm)
+	if err != nil {
+		if opts.Format == ExportFormatDir {
+			_ = os.RemoveAll(dest)
+		}
+		return nil, err
+	}
+
+	// Step 3: Archive the staged files
+	if opts.Format == ExportFormatOVA {
+		if err := writeExportArchive(dest, dir, files); err != nil {
+			_ = os.Remove(dest)
+			return nil, err
+		}
+	}
+
+	logging.FromContext(ctx).Info("VM exported", "vm", vmName, "path", dest)
+	return &ExportResult{Path: dest, Files: files}, nil
+}
+
+// writeExportFiles writes the spec, domain XML and volumes of vm into dir.
+func writeExportFiles(ctx context.Context, dir string, vm, spec *v1alpha1.VirtualMachine, domainXML string, opts ExportOptions, sm storageManager) ([]ExportedFile, error) {
+	specData, err := yaml.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal spec: %w", err)
+	}
+
+	var files []ExportedFile
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{ExportSpecFile, specData},
+		{ExportDomainFile, []byte(domainXML)},
+	} {
+		if err := os.WriteFile(filepath.Join(dir, file.name), file.data, 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+		files = append(files, ExportedFile{Name: file.name, Size: int64(len(file.data))})
+	}
+
+	// The boot and data disks, and the cloud-init ISO if the VM has one
+	volumes := []string{getBootVolumeName(vm)}
+	for _, disk := range vm.Spec.DataDisks {
+		volumes = append(volumes, getDataVolumeName(vm, disk.Device))
+	}
+	pool := getStoragePool(vm)
+	if exists, err := sm.VolumeExists(ctx, pool, getCloudInitVolumeName(vm)); err == nil && exists {
+		volumes = append(volumes, getCloudInitVolumeName(vm))
+	}
+
+	for _, volume := range volumes {
+		logging.FromContext(ctx).Info("Exporting volume", "volume", volume)
+		name := volume
+		if opts.Compress {
+			name += ".gz"
+		}
+		size, err := writeVolumeFile(ctx, filepath.Join(dir, name), pool, volume, opts, sm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export volume %s: %w", volume, err)
+		}
+		files = append(files, ExportedFile{Name: name, Volume: volume, Size: size})
+	}
+
+	return files, nil
+}
+
+// writeVolumeFile downloads a volume into a new file at path, compressed or
+// sparse as opts asks, and returns the file's size.
+func writeVolumeFile(ctx context.Context, path, pool, volume string, opts ExportOptions, sm storageManager) (int64, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var w io.WriteCloser = nopWriteCloser{f}
+	switch {
+	case opts.Compress:
+		w = gzip.NewWriter(f)
+	case opts.Sparse:
+		w = &sparseWriter{f: f}
+	}
+
+	if err := sm.ExportVolume(ctx, pool, volume, w); err != nil {
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// writeExportArchive writes the files of an export staged in dir to a new
+// tar archive at dest.
+func writeExportArchive(dest, dir string, files []ExportedFile) error {
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	tw := tar.NewWriter(f)
+	for _, file := range files {
+		if err := addArchiveFile(tw, filepath.Join(dir, file.Name)); err != nil {
+			return fmt.Errorf("failed to archive %s: %w", file.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return f.Close()
+}
+
+// addArchiveFile adds the file at path to an archive, by its base name.
+func addArchiveFile(tw *tar.Writer, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, src)
+	return err
+}
+
+// nopWriteCloser is a file written through directly, closed by its owner.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// sparseBlockSize is the size of the blocks sparseWriter checks for zeros.
+const sparseBlockSize = 4096
+
+var zeroBlock [sparseBlockSize]byte
+
+// sparseWriter writes to a file, seeking over blocks of zeros instead of
+// writing them so that they become holes. Close sets the file's size, which
+// a trailing hole would not.
+type sparseWriter struct {
+	f      *os.File
+	offset int64
+}
+
+func (w *sparseWriter) Write(p []byte) (int, error) {
+	for written := 0; written < len(p); {
+		block := p[written:min(written+sparseBlockSize, len(p))]
+		if bytes.Equal(block, zeroBlock[:len(block)]) {
+			if _, err := w.f.Seek(int64(len(block)), io.SeekCurrent); err != nil {
+				return written, err
+			}
+		} else if _, err := w.f.Write(block); err != nil {
+			return written, err
+		}
+		written += len(block)
+		w.offset += int64(len(block))
+	}
+	return len(p), nil
+}
+
+func (w *sparseWriter) Close() error {
+	return w.f.Truncate(w.offset)
+}
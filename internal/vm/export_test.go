@@ -0,0 +1,272 @@
+package vm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+	"go.yaml.in/yaml/v3"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/loader"
+)
+
+func TestExportSpec_RoundTrip(t *testing.T) {
+	// Stored specs were loaded, with the loader's defaults filled in
+	config := testVMConfigWithCloudInit()
+	v1alpha1.SetDefaultAPIVersion(config)
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		t.Fatalf("failed to marshal config: %v", err)
+	}
+	stored, err := loader.LoadFromYAML(context.Background(), data)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	stored.UID = "3f0c6a9e-4c1e-4ab1-9a51-6f1f3d1b2a10"
+	stored.Generation = 3
+	stored.Labels = map[string]string{"tier": "web"}
+	stored.Annotations = map[string]string{
+		v1alpha1.AnnotationOwner:                "alice",
+		v1alpha1.AnnotationMACStrategy:          "ip-derived",
+		v1alpha1.AnnotationBootImagePath:        "/var/lib/libvirt/images/fedora-43.qcow2",
+		v1alpha1.AnnotationBootImageFingerprint: "sha256:abc",
+		v1alpha1.AnnotationResourceUID:          "7d1e",
+	}
+	stored.Status.Phase = v1alpha1.VMPhaseRunning
+	stored.Status.DomainUUID = "b7f1c3e2-0000-4000-8000-000000000001"
+
+	exported, err := ExportSpec(stored)
+	if err != nil {
+		t.Fatalf("ExportSpec() error = %v", err)
+	}
+	if exported.APIVersion != v1alpha1.GroupName+"/"+v1alpha1.Version || exported.Kind != v1alpha1.VirtualMachineKind {
+		t.Errorf("exported type = %s %s", exported.APIVersion, exported.Kind)
+	}
+	if exported.UID != "" || exported.Generation != 0 || exported.Status.Phase != "" || exported.Status.DomainUUID != "" {
+		t.Errorf("exported VM keeps populated fields: %+v", exported)
+	}
+	for _, key := range hostAnnotations {
+		if _, ok := exported.Annotations[key]; ok {
+			t.Errorf("exported VM keeps host annotation %s", key)
+		}
+	}
+	if exported.Annotations[v1alpha1.AnnotationOwner] != "alice" || exported.Annotations[v1alpha1.AnnotationMACStrategy] != "ip-derived" {
+		t.Errorf("exported annotations = %v, want user and naming annotations kept", exported.Annotations)
+	}
+	if _, ok := stored.Annotations[v1alpha1.AnnotationBootImagePath]; !ok {
+		t.Error("ExportSpec() modified the stored VM")
+	}
+
+	data, err = yaml.Marshal(exported)
+	if err != nil {
+		t.Fatalf("failed to marshal exported VM: %v", err)
+	}
+	if strings.Contains(string(data), "status:") {
+		t.Errorf("exported YAML has a status:\n%s", data)
+	}
+	loaded, err := loader.LoadFromYAML(context.Background(), data)
+	if err != nil {
+		t.Fatalf("exported YAML does not load: %v\n%s", err, data)
+	}
+	if changes := diffSpec(stored, loaded); len(changes) != 0 {
+		t.Errorf("re-applying the exported YAML changes %v", changes)
+	}
+}
+
+func TestExportSpec_NoStoredSpec(t *testing.T) {
+	unmanaged := &v1alpha1.VirtualMachine{ObjectMeta: v1alpha1.ObjectMeta{Name: "legacy"}}
+	if _, err := ExportSpec(unmanaged); err == nil || !strings.Contains(err.Error(), "no stored spec") {
+		t.Errorf("ExportSpec() error = %v, want no stored spec", err)
+	}
+}
+
+// newExportMocks returns mocks with a stopped VM with two data disks and a
+// cloud-init ISO.
+func newExportMocks(t *testing.T) (*mockLibvirtClient, *mockStorageManager) {
+	t.Helper()
+	lv, sm := newApplyMocks(t, testVMConfigWithDataDisks())
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateShutoff, 0, nil
+	}
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		return "<domain type='kvm'><name>test-vm</name></domain>", nil
+	}
+	sm.volumeExistsFunc = func(ctx context.Context, poolName, volumeName string) (bool, error) {
+		return volumeName == "test-vm_cloudinit.iso", nil
+	}
+	return lv, sm
+}
+
+func TestExportVMWithDeps_Dir(t *testing.T) {
+	lv, sm := newExportMocks(t)
+	dest := filepath.Join(t.TempDir(), "test-vm")
+
+	result, err := exportVMWithDeps(context.Background(), "test-vm", dest, ExportOptions{}, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("exportVMWithDeps() error = %v", err)
+	}
+
+	var names []string
+	for _, file := range result.Files {
+		names = append(names, file.Name)
+	}
+	want := "vm.yaml domain.xml test-vm_boot.qcow2 test-vm_data-vdb.qcow2 test-vm_data-vdc.qcow2 test-vm_cloudinit.iso"
+	if strings.Join(names, " ") != want {
+		t.Errorf("exported files = %v, want %s", names, want)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dest, "test-vm_data-vdb.qcow2"))
+	if err != nil || string(data) != "test-vm_data-vdb.qcow2" {
+		t.Errorf("exported disk = %q, %v", data, err)
+	}
+	specData, err := os.ReadFile(filepath.Join(dest, ExportSpecFile))
+	if err != nil {
+		t.Fatalf("failed to read exported spec: %v", err)
+	}
+	spec, err := loader.LoadFromYAML(context.Background(), specData)
+	if err != nil {
+		t.Fatalf("exported spec does not load: %v", err)
+	}
+	if spec.Name != "test-vm" || len(spec.Spec.DataDisks) != 2 {
+		t.Errorf("exported spec = %+v", spec)
+	}
+
+	// Exports hold guest disks and cloud-init secrets
+	for _, name := range append([]string{"."}, names...) {
+		info, err := os.Stat(filepath.Join(dest, name))
+		if err != nil || info.Mode().Perm()&0o077 != 0 {
+			t.Errorf("%s: %v, %v, want no group or other access", name, info, err)
+		}
+	}
+
+	// An existing export is never overwritten
+	if _, err := exportVMWithDeps(context.Background(), "test-vm", dest, ExportOptions{}, lv, sm, newMockMetadataClient(lv)); err == nil {
+		t.Error("expected error exporting into an existing directory")
+	}
+}
+
+func TestExportVMWithDeps_CompressedOVA(t *testing.T) {
+	lv, sm := newExportMocks(t)
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "test-vm.ova")
+
+	opts := ExportOptions{Format: ExportFormatOVA, Compress: true}
+	if _, err := exportVMWithDeps(context.Background(), "test-vm", dest, opts, lv, sm, newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("exportVMWithDeps() error = %v", err)
+	}
+
+	f, err := os.Open(dest)
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+	if info, err := f.Stat(); err != nil || info.Mode().Perm()&0o077 != 0 {
+		t.Errorf("archive: %v, %v, want no group or other access", info, err)
+	}
+
+	contents := make(map[string][]byte)
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read archive: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		contents[header.Name] = data
+	}
+	if len(contents) != 6 {
+		t.Errorf("archive has %d files, want 6", len(contents))
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(contents["test-vm_boot.qcow2.gz"]))
+	if err != nil {
+		t.Fatalf("boot disk is not compressed: %v", err)
+	}
+	if data, _ := io.ReadAll(gz); string(data) != "test-vm_boot.qcow2" {
+		t.Errorf("decompressed boot disk = %q", data)
+	}
+
+	// Only the archive is left behind
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("export left %d entries in the destination directory, want 1", len(entries))
+	}
+}
+
+func TestExportVMWithDeps_Rejects(t *testing.T) {
+	t.Run("running VM", func(t *testing.T) {
+		lv, sm := newApplyMocks(t, testVMConfig())
+		dest := filepath.Join(t.TempDir(), "test-vm")
+		_, err := exportVMWithDeps(context.Background(), "test-vm", dest, ExportOptions{}, lv, sm, newMockMetadataClient(lv))
+		if err == nil || !strings.Contains(err.Error(), "shut off") {
+			t.Errorf("exportVMWithDeps() error = %v, want shut off", err)
+		}
+		if _, err := os.Stat(dest); err == nil {
+			t.Error("export directory created for a rejected export")
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		lv, sm := newExportMocks(t)
+		_, err := exportVMWithDeps(context.Background(), "test-vm", t.TempDir(), ExportOptions{Format: "zip"}, lv, sm, newMockMetadataClient(lv))
+		if err == nil || !strings.Contains(err.Error(), "unsupported export format") {
+			t.Errorf("exportVMWithDeps() error = %v, want unsupported format", err)
+		}
+	})
+
+	t.Run("volume failure removes the export", func(t *testing.T) {
+		lv, sm := newExportMocks(t)
+		sm.exportVolumeFunc = func(ctx context.Context, poolName, volumeName string, w io.Writer) error {
+			return errors.New("download failed")
+		}
+		dest := filepath.Join(t.TempDir(), "test-vm")
+		if _, err := exportVMWithDeps(context.Background(), "test-vm", dest, ExportOptions{}, lv, sm, newMockMetadataClient(lv)); err == nil {
+			t.Fatal("expected error")
+		}
+		if _, err := os.Stat(dest); err == nil {
+			t.Error("partial export left behind")
+		}
+	})
+}
+
+func TestSparseWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.raw")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Data, a hole, more data and a trailing hole, written in odd sizes
+	data := make([]byte, 5*sparseBlockSize)
+	copy(data, "boot sector")
+	copy(data[3*sparseBlockSize:], "filesystem")
+	w := &sparseWriter{f: f}
+	for _, chunk := range [][]byte{data[:1000], data[1000 : 3*sparseBlockSize+7], data[3*sparseBlockSize+7:]} {
+		if n, err := w.Write(chunk); err != nil || n != len(chunk) {
+			t.Fatalf("Write() = %d, %v", n, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	_ = f.Close()
+
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, data) {
+		t.Errorf("sparse file contents differ from the data written (len %d, want %d)", len(written), len(data))
+	}
+}
@@ -0,0 +1,268 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/google/uuid"
+
+	"github.com/jbweber/foundry/internal/journal"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metrics"
+	"github.com/jbweber/foundry/internal/process"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// RolledBack describes an incomplete creation rolled back by GC.
+type RolledBack struct {
+	// VM is the name of the VM whose creation was interrupted.
+	VM string
+
+	// Removed lists the resources that were removed. Resources already
+	// gone are not listed.
+	Removed []journal.Resource
+}
+
+// GC rolls back VM creations that were interrupted (e.g., foundry was killed
+// or the host crashed) before they finished or cleaned up after themselves.
+//
+// Every creation journals the volumes and domain it creates (see the journal
+// package) until the VM is started. Journals whose process is no longer
+// running are replayed in reverse: the domain is destroyed and undefined and
+// the volumes are deleted. Creations still in progress are left alone, as
+// are those journaled on another libvirt connection than the default one.
+// If a domain of the same name but another UUID than the journaled one was
+// defined since, the VM was created again and owns the names of the
+// journaled resources: they are left alone and the journal is dropped.
+//
+// Creations that cannot be rolled back keep their journal, so GC can be run
+// again, and are reported in the returned error; the others are still rolled
+// back.
+func GC(ctx context.Context) ([]RolledBack, error) {
+	logger := logging.FromContext(ctx)
+
+	dir, err := journal.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+
+	return gcWithDeps(ctx, dir, foundrylibvirt.DefaultURI(), LibvirtClient.Libvirt(), storageMgr, process.Running)
+}
+
+// gcWithDeps rolls back the incomplete creations journaled in dir on the
+// libvirt connection uri, which lv is connected to, with injected
+// dependencies. running reports whether a process of this host is still
+// running.
+func gcWithDeps(ctx context.Context, dir, uri string, lv LibvirtClient, sm storageManager, running func(pid int) bool) ([]RolledBack, error) {
+	logger := logging.FromContext(ctx)
+
+	entries, err := journal.List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+
+	var (
+		rolledBack []RolledBack
+		errs       []error
+	)
+	for _, entry := range entries {
+		if entry.URI != uri {
+			logger.Debug("Creation on another connection, skipping", "vm", entry.VM, "uri", entry.URI)
+			continue
+		}
+		if entry.Hostname == hostname && running(entry.PID) {
+			logger.Debug("Creation still in progress, skipping", "vm", entry.VM, "pid", entry.PID)
+			continue
+		}
+
+		replaced, err := domainReplaced(lv, entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to roll back creation of VM '%s': %w", entry.VM, err))
+			continue
+		}
+		if replaced {
+			logger.Warn("VM was created again since its creation was interrupted, leaving its resources alone", "vm", entry.VM)
+			if err := journal.Remove(dir, entry.VM); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		logger.Info("Rolling back incomplete creation", "vm", entry.VM, "startedAt", entry.StartedAt)
+		removed, err := rollBack(ctx, entry, lv, sm)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to roll back creation of VM '%s': %w", entry.VM, err))
+			continue
+		}
+		if err := journal.Remove(dir, entry.VM); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rolledBack = append(rolledBack, RolledBack{VM: entry.VM, Removed: removed})
+	}
+
+	return rolledBack, errors.Join(errs...)
+}
+
+// domainReplaced reports whether the domain journaled by entry was replaced
+// by a domain of the same name with another UUID. Entries without a domain,
+// or journaled without its UUID, are never replaced.
+func domainReplaced(lv LibvirtClient, entry journal.Entry) (bool, error) {
+	for _, r := range entry.Resources {
+		if r.Kind != journal.KindDomain || r.UUID == "" {
+			continue
+		}
+		domain, err := lv.DomainLookupByName(r.Name)
+		if hasLibvirtCode(err, libvirt.ErrNoDomain) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to look up domain: %w", err)
+		}
+		return uuid.UUID(domain.UUID).String() != r.UUID, nil
+	}
+	return false, nil
+}
+
+// rollBack removes the resources of a journal entry, newest first, and
+// returns those it removed.
+func rollBack(ctx context.Context, entry journal.Entry, lv LibvirtClient, sm storageManager) ([]journal.Resource, error) {
+	logger := logging.FromContext(ctx)
+	metrics.CleanupAttempts.Inc()
+
+	var (
+		removed []journal.Resource
+		errs    []error
+	)
+	for i := len(entry.Resources) - 1; i >= 0; i-- {
+		r := entry.Resources[i]
+		var (
+			existed bool
+			err     error
+		)
+		switch r.Kind {
+		case journal.KindDomain:
+			existed, err = rollBackDomain(lv, r.Name)
+		case journal.KindVolume:
+			existed, err = rollBackVolume(ctx, sm, r.Pool, r.Name)
+		default:
+			err = fmt.Errorf("unknown resource kind %q", r.Kind)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r, err))
+			continue
+		}
+		if existed {
+			logger.Info("Removed leftover resource", "vm", entry.VM, "resource", r.String())
+			removed = append(removed, r)
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+// rollBackDomain force-stops and undefines a domain. It reports false if the
+// domain does not exist.
+func rollBackDomain(lv LibvirtClient, name string) (bool, error) {
+	domain, err := lv.DomainLookupByName(name)
+	if hasLibvirtCode(err, libvirt.ErrNoDomain) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up domain: %w", err)
+	}
+
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		return false, fmt.Errorf("failed to get domain state: %w", err)
+	}
+	if state == domainStateRunning {
+		if err := lv.DomainDestroy(domain); err != nil {
+			return false, fmt.Errorf("failed to destroy domain: %w", err)
+		}
+	}
+	if err := lv.DomainUndefineFlags(domain, libvirt.DomainUndefineNvram|libvirt.DomainUndefineSnapshotsMetadata); err != nil {
+		return false, fmt.Errorf("failed to undefine domain: %w", err)
+	}
+	return true, nil
+}
+
+// rollBackVolume deletes a volume. It reports false if the volume does not
+// exist.
+func rollBackVolume(ctx context.Context, sm storageManager, pool, name string) (bool, error) {
+	exists, err := sm.VolumeExists(ctx, pool, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to check volume: %w", err)
+	}
+	if !exists {
+		return false, nil
+	}
+	if err := sm.DeleteVolume(ctx, pool, name); err != nil {
+		return false, fmt.Errorf("failed to delete volume: %w", err)
+	}
+	return true, nil
+}
+
+type journalKey struct{}
+
+// startJournal returns a copy of ctx that journals the resources created by
+// the creation it is passed to, and a function removing the journal once the
+// creation has returned. Failing to journal never fails a creation: it only
+// loses the ability to roll it back after a crash.
+func startJournal(ctx context.Context) (context.Context, func()) {
+	logger := logging.FromContext(ctx)
+
+	dir, err := journal.DefaultDir()
+	if err != nil {
+		logger.Warn("Not journaling creation", "error", err)
+		return ctx, func() {}
+	}
+	j := journal.New(dir, foundrylibvirt.DefaultURI())
+	return context.WithValue(ctx, journalKey{}, j), func() {
+		if err := j.Close(); err != nil {
+			logger.Warn("Failed to remove creation journal", "error", err)
+		}
+	}
+}
+
+// journalEvent records the resource a creation step created in the journal
+// of ctx, if it has one. Once the VM is started the creation is complete and
+// must never be rolled back, so its journal is removed.
+func journalEvent(ctx context.Context, ev CreateEvent) {
+	j, ok := ctx.Value(journalKey{}).(*journal.Journal)
+	if !ok {
+		return
+	}
+
+	var err error
+	switch ev := ev.(type) {
+	case VolumeCreated:
+		err = j.Record(ev.VM, journal.Resource{Kind: journal.KindVolume, Pool: ev.Pool, Name: ev.Volume})
+	case DomainDefined:
+		err = j.Record(ev.VM, journal.Resource{Kind: journal.KindDomain, Name: ev.VM, UUID: ev.UUID})
+	case Started:
+		err = j.Close()
+	}
+	if err != nil {
+		logging.FromContext(ctx).Warn("Failed to update creation journal", "error", err)
+	}
+}
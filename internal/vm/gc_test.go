@@ -0,0 +1,173 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/google/uuid"
+
+	"github.com/jbweber/foundry/internal/journal"
+)
+
+func TestGCWithDeps(t *testing.T) {
+	dir := t.TempDir()
+	hostname, _ := os.Hostname()
+
+	boot := journal.Resource{Kind: journal.KindVolume, Pool: "foundry-vms", Name: "web-1_boot.qcow2"}
+	cloudInit := journal.Resource{Kind: journal.KindVolume, Pool: "foundry-vms", Name: "web-1_cloudinit.iso"}
+	domainUUID := uuid.MustParse("8f2c8a51-4e59-4a9e-9d3c-2d5b0f1e7a10")
+	domain := journal.Resource{Kind: journal.KindDomain, Name: "web-1", UUID: domainUUID.String()}
+	for _, entry := range []*journal.Entry{
+		// Killed after defining the domain
+		{VM: "web-1", PID: 100, Hostname: hostname, Resources: []journal.Resource{boot, cloudInit, domain}},
+		// Still being created
+		{VM: "web-2", PID: 200, Hostname: hostname, Resources: []journal.Resource{
+			{Kind: journal.KindVolume, Pool: "foundry-vms", Name: "web-2_boot.qcow2"},
+		}},
+	} {
+		if err := journal.Save(dir, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lv := newMockLibvirtClient()
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		return libvirt.Domain{Name: name, UUID: libvirt.UUID(domainUUID)}, nil
+	}
+	sm := newMockStorageManager()
+	sm.volumeExistsFunc = func(ctx context.Context, pool, volume string) (bool, error) {
+		// The cloud-init volume was never written
+		return volume != cloudInit.Name, nil
+	}
+	running := func(pid int) bool { return pid == 200 }
+
+	rolledBack, err := gcWithDeps(context.Background(), dir, "", lv, sm, running)
+	if err != nil {
+		t.Fatalf("gcWithDeps() error = %v", err)
+	}
+
+	want := []RolledBack{{VM: "web-1", Removed: []journal.Resource{domain, boot}}}
+	if !reflect.DeepEqual(rolledBack, want) {
+		t.Errorf("rolledBack = %+v, want %+v", rolledBack, want)
+	}
+	if len(lv.domainDestroyCalls) != 1 || len(lv.domainUndefineFlagsCalls) != 1 {
+		t.Errorf("domain destroyed %d and undefined %d times, want once", len(lv.domainDestroyCalls), len(lv.domainUndefineFlagsCalls))
+	}
+	if !reflect.DeepEqual(sm.deleteVolumeCalls, []string{"foundry-vms/web-1_boot.qcow2"}) {
+		t.Errorf("deleted volumes %v, want only the boot volume of web-1", sm.deleteVolumeCalls)
+	}
+
+	entries, _ := journal.List(dir)
+	if len(entries) != 1 || entries[0].VM != "web-2" {
+		t.Errorf("journals left = %+v, want only the one in progress", entries)
+	}
+}
+
+func TestGCWithDeps_KeepsJournalOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	entry := &journal.Entry{VM: "web-1", PID: 100, Resources: []journal.Resource{
+		{Kind: journal.KindVolume, Pool: "foundry-vms", Name: "web-1_boot.qcow2"},
+	}}
+	if err := journal.Save(dir, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	lv := newMockLibvirtClient()
+	sm := newMockStorageManager()
+	sm.volumeExistsFunc = func(ctx context.Context, pool, volume string) (bool, error) { return true, nil }
+	sm.deleteVolumeFunc = func(ctx context.Context, pool, volume string) error { return errors.New("volume is busy") }
+
+	rolledBack, err := gcWithDeps(context.Background(), dir, "", lv, sm, func(int) bool { return false })
+	if err == nil || len(rolledBack) != 0 {
+		t.Fatalf("gcWithDeps() = %+v, %v, want an error", rolledBack, err)
+	}
+	if entries, _ := journal.List(dir); len(entries) != 1 {
+		t.Errorf("journals left = %+v, want the journal kept for a retry", entries)
+	}
+}
+
+func TestGCWithDeps_OtherVM(t *testing.T) {
+	dir := t.TempDir()
+	resources := []journal.Resource{
+		{Kind: journal.KindVolume, Pool: "foundry-vms", Name: "web-1_boot.qcow2"},
+		{Kind: journal.KindDomain, Name: "web-1", UUID: "8f2c8a51-4e59-4a9e-9d3c-2d5b0f1e7a10"},
+	}
+	for _, entry := range []*journal.Entry{
+		// Killed while creating web-1 on another hypervisor
+		{VM: "web-1", PID: 100, URI: "qemu+ssh://hv2/system", Resources: resources},
+		// Killed after defining web-2, which was created again since
+		{VM: "web-2", PID: 100, Resources: []journal.Resource{
+			{Kind: journal.KindVolume, Pool: "foundry-vms", Name: "web-2_boot.qcow2"},
+			{Kind: journal.KindDomain, Name: "web-2", UUID: "8f2c8a51-4e59-4a9e-9d3c-2d5b0f1e7a10"},
+		}},
+	} {
+		if err := journal.Save(dir, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both names belong to VMs of this connection with other UUIDs
+	lv := newMockLibvirtClient()
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		return libvirt.Domain{Name: name, UUID: libvirt.UUID(uuid.MustParse("0b7e3f0c-93a4-4c3e-8f51-6a2d9e4b1c27"))}, nil
+	}
+	sm := newMockStorageManager()
+	sm.volumeExistsFunc = func(ctx context.Context, pool, volume string) (bool, error) { return true, nil }
+
+	rolledBack, err := gcWithDeps(context.Background(), dir, "", lv, sm, func(int) bool { return false })
+	if err != nil || len(rolledBack) != 0 {
+		t.Fatalf("gcWithDeps() = %+v, %v, want nothing rolled back", rolledBack, err)
+	}
+	if len(lv.domainDestroyCalls) != 0 || len(lv.domainUndefineFlagsCalls) != 0 || len(sm.deleteVolumeCalls) != 0 {
+		t.Errorf("gcWithDeps() removed resources of other VMs: destroyed %d, undefined %d, deleted %v",
+			len(lv.domainDestroyCalls), len(lv.domainUndefineFlagsCalls), sm.deleteVolumeCalls)
+	}
+
+	// The journal of the other connection is kept for a GC on it
+	entries, _ := journal.List(dir)
+	if len(entries) != 1 || entries[0].VM != "web-1" {
+		t.Errorf("journals left = %+v, want only the one of the other connection", entries)
+	}
+}
+
+func TestCreateJournal(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(journal.EnvVar, dir)
+
+	lv := newMockLibvirtClient()
+	domainUUID := uuid.MustParse("8f2c8a51-4e59-4a9e-9d3c-2d5b0f1e7a10")
+	lv.domainDefineXMLFunc = func(xml string) (libvirt.Domain, error) {
+		return libvirt.Domain{Name: "test-vm", UUID: libvirt.UUID(domainUUID)}, nil
+	}
+	var journaled []journal.Resource
+	lv.domainCreateFunc = func(libvirt.Domain) error {
+		// Everything created so far is journaled by the time the VM starts
+		entries, _ := journal.List(dir)
+		if len(entries) == 1 {
+			journaled = entries[0].Resources
+		}
+		return nil
+	}
+
+	ctx, endJournal := startJournal(context.Background())
+	err := createFromConfigWithDeps(ctx, testVMConfig(), lv, newMockStorageManager(), newMockMetadataClient(lv))
+	endJournal()
+	if err != nil {
+		t.Fatalf("createFromConfigWithDeps() error = %v", err)
+	}
+
+	want := []journal.Resource{
+		{Kind: journal.KindVolume, Pool: "foundry-vms", Name: "test-vm_boot.qcow2"},
+		{Kind: journal.KindDomain, Name: "test-vm", UUID: domainUUID.String()},
+	}
+	if !reflect.DeepEqual(journaled, want) {
+		t.Errorf("journaled = %+v, want %+v", journaled, want)
+	}
+	if entries, _ := journal.List(dir); len(entries) != 0 {
+		t.Errorf("journals left = %+v, want none after a successful creation", entries)
+	}
+}
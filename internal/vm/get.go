@@ -0,0 +1,49 @@
+// Package vm provides high-level VM management operations.
+package vm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+)
+
+// Get retrieves a single VM by name.
+//
+// The VirtualMachine spec is loaded from the domain's Foundry metadata and
+// merged with live status from libvirt: phase, Ready condition, domain UUID,
+// and the addresses, MAC addresses and interface names of the configured NICs.
+//
+// Domains without Foundry metadata are returned as a minimal VirtualMachine
+// containing only the name and live status.
+func Get(ctx context.Context, name string) (*v1alpha1.VirtualMachine, error) {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	return getWithDeps(ctx, name, LibvirtClient.Libvirt())
+}
+
+// getWithDeps retrieves a VM with injected dependencies.
+// This allows for testing by accepting interfaces instead of concrete types.
+func getWithDeps(ctx context.Context, name string, lv LibvirtClient) (*v1alpha1.VirtualMachine, error) {
+	// Look up domain by name
+	domain, err := lv.DomainLookupByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find VM %s: %w", name, err)
+	}
+
+	// Get VM with populated status
+	return getVirtualMachine(ctx, lv, domain)
+}
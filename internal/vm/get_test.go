@@ -0,0 +1,160 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+	"go.yaml.in/yaml/v3"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/metadata"
+)
+
+// storedMetadataXML wraps a VM as the metadata XML returned by libvirt.
+func storedMetadataXML(t *testing.T, vm *v1alpha1.VirtualMachine) string {
+	t.Helper()
+	data, err := yaml.Marshal(vm)
+	if err != nil {
+		t.Fatalf("failed to marshal VM: %v", err)
+	}
+	return fmt.Sprintf(`<metadata xmlns="%s">%s</metadata>`, metadata.MetadataNamespace, string(data))
+}
+
+func TestGetWithDeps_MergesLiveStatus(t *testing.T) {
+	stored := testVMConfigWithCloudInit()
+	stored.APIVersion = "foundry.cofront.xyz/v1alpha1"
+	stored.Kind = "VirtualMachine"
+	// Stale status from the stored copy must be replaced, not appended to
+	stored.Status.Addresses = []v1alpha1.VMAddress{{Type: "InternalIP", Address: "192.0.2.1"}}
+
+	lv := newMockLibvirtClient()
+	domainUUID := libvirt.UUID{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		return libvirt.Domain{Name: name, UUID: domainUUID}, nil
+	}
+	lv.domainGetMetadataFunc = func(dom libvirt.Domain, typ int32, uri libvirt.OptString, flags libvirt.DomainModificationImpact) (string, error) {
+		return storedMetadataXML(t, stored), nil
+	}
+
+	vm, err := getWithDeps(context.Background(), "test-vm", lv)
+	if err != nil {
+		t.Fatalf("getWithDeps() error = %v", err)
+	}
+
+	if vm.Spec.VCPUs != stored.Spec.VCPUs {
+		t.Errorf("VCPUs = %d, want %d", vm.Spec.VCPUs, stored.Spec.VCPUs)
+	}
+	if vm.Status.Phase != v1alpha1.VMPhaseRunning {
+		t.Errorf("Phase = %s, want Running", vm.Status.Phase)
+	}
+	if vm.Status.DomainUUID != "12345678-9abc-def0-1234-56789abcdef0" {
+		t.Errorf("DomainUUID = %q", vm.Status.DomainUUID)
+	}
+
+	wantAddresses := []v1alpha1.VMAddress{
+		{Type: "InternalIP", Address: "10.0.0.10"},
+		{Type: "Hostname", Address: "test-vm.example.com"},
+	}
+	if len(vm.Status.Addresses) != len(wantAddresses) {
+		t.Fatalf("Addresses = %v, want %v", vm.Status.Addresses, wantAddresses)
+	}
+	for i, want := range wantAddresses {
+		if vm.Status.Addresses[i] != want {
+			t.Errorf("Addresses[%d] = %v, want %v", i, vm.Status.Addresses[i], want)
+		}
+	}
+
+	if got := vm.Status.MACAddresses; len(got) != 1 || got[0] != "be:ef:0a:00:00:0a" {
+		t.Errorf("MACAddresses = %v", got)
+	}
+	if got := vm.Status.InterfaceNames; len(got) != 1 || got[0] != "vm0a00000a" {
+		t.Errorf("InterfaceNames = %v", got)
+	}
+}
+
+func TestGetWithDeps_DiscoversLiveAddresses(t *testing.T) {
+	stored := testVMConfigWithCloudInit()
+	stored.APIVersion = "foundry.cofront.xyz/v1alpha1"
+	stored.Kind = "VirtualMachine"
+	stored.Spec.NetworkInterfaces = append(stored.Spec.NetworkInterfaces,
+		v1alpha1.NetworkInterfaceSpec{DHCP: true, Network: "default", MACAddress: "52:54:00:12:34:56"})
+
+	lv := newMockLibvirtClient()
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		return libvirt.Domain{Name: name}, nil
+	}
+	lv.domainGetMetadataFunc = func(dom libvirt.Domain, typ int32, uri libvirt.OptString, flags libvirt.DomainModificationImpact) (string, error) {
+		return storedMetadataXML(t, stored), nil
+	}
+	lv.interfaceAddressesFunc = func(dom libvirt.Domain, source uint32) ([]libvirt.DomainInterface, error) {
+		switch libvirt.DomainInterfaceAddressesSource(source) {
+		case libvirt.DomainInterfaceAddressesSrcAgent:
+			return nil, fmt.Errorf("guest agent is not configured")
+		case libvirt.DomainInterfaceAddressesSrcLease:
+			return []libvirt.DomainInterface{{
+				Hwaddr: libvirt.OptString{"52:54:00:12:34:56"},
+				Addrs:  []libvirt.DomainIPAddr{{Addr: "192.168.122.50", Prefix: 24}},
+			}}, nil
+		default:
+			// The static address seen in the ARP table is not listed twice
+			return []libvirt.DomainInterface{{
+				Hwaddr: libvirt.OptString{"be:ef:0a:00:00:0a"},
+				Addrs:  []libvirt.DomainIPAddr{{Addr: "10.0.0.10"}},
+			}}, nil
+		}
+	}
+
+	vm, err := getWithDeps(context.Background(), "test-vm", lv)
+	if err != nil {
+		t.Fatalf("getWithDeps() error = %v", err)
+	}
+
+	wantAddresses := []v1alpha1.VMAddress{
+		{Type: "InternalIP", Address: "10.0.0.10"},
+		{Type: "InternalIP", Address: "192.168.122.50"},
+		{Type: "Hostname", Address: "test-vm.example.com"},
+	}
+	if !reflect.DeepEqual(vm.Status.Addresses, wantAddresses) {
+		t.Errorf("Addresses = %v, want %v", vm.Status.Addresses, wantAddresses)
+	}
+}
+
+func TestGetWithDeps_NoMetadata(t *testing.T) {
+	lv := newMockLibvirtClient()
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		return libvirt.Domain{Name: name}, nil
+	}
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return 5, 0, nil // shutoff
+	}
+
+	vm, err := getWithDeps(context.Background(), "legacy-vm", lv)
+	if err != nil {
+		t.Fatalf("getWithDeps() error = %v", err)
+	}
+	if vm.Name != "legacy-vm" {
+		t.Errorf("Name = %q, want legacy-vm", vm.Name)
+	}
+	if vm.Status.Phase != v1alpha1.VMPhaseStopped {
+		t.Errorf("Phase = %s, want Stopped", vm.Status.Phase)
+	}
+	if len(vm.Status.Addresses) != 0 {
+		t.Errorf("expected no addresses, got %v", vm.Status.Addresses)
+	}
+}
+
+func TestGetWithDeps_NotFound(t *testing.T) {
+	lv := newMockLibvirtClient()
+
+	_, err := getWithDeps(context.Background(), "missing", lv)
+	if err == nil {
+		t.Fatal("expected error for missing VM")
+	}
+	if !strings.Contains(err.Error(), "failed to find VM missing") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
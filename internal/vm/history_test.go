@@ -0,0 +1,73 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/internal/history"
+)
+
+// TestMain keeps the events recorded by the tests out of the real history.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "foundry-events-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	_ = os.Setenv(history.EnvVar, dir)
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestPowerHistory(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(history.EnvVar, dir)
+
+	lv := newPowerMock(domainStateShutoff)
+	running := false
+	lv.domainCreateFunc = func(dom libvirt.Domain) error {
+		running = true
+		return nil
+	}
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		if running {
+			return domainStateRunning, 0, nil
+		}
+		return domainStateShutoff, 0, nil
+	}
+	lv.domainDestroyFunc = func(dom libvirt.Domain) error {
+		running = false
+		return nil
+	}
+
+	ctx := context.Background()
+	if err := startWithDeps(ctx, "test-vm", lv, newMockStorageManager(), newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("startWithDeps() error = %v", err)
+	}
+	// Starting a running VM does nothing and is not recorded
+	if err := startWithDeps(ctx, "test-vm", lv, newMockStorageManager(), newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("startWithDeps() error = %v", err)
+	}
+	if err := stopWithDeps(ctx, "test-vm", StopOptions{Force: true}, time.Millisecond, lv); err != nil {
+		t.Fatalf("stopWithDeps() error = %v", err)
+	}
+
+	events, err := history.List(dir, history.Connection(), "test-vm")
+	if err != nil {
+		t.Fatalf("history.List() error = %v", err)
+	}
+	var got []string
+	for _, ev := range events {
+		got = append(got, ev.Type+" "+ev.Message)
+	}
+	want := []string{"Started ", "Stopped Forced off"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
@@ -2,6 +2,7 @@ package vm
 
 import (
 	"context"
+	"io"
 
 	"github.com/digitalocean/go-libvirt"
 
@@ -82,6 +83,89 @@ type LibvirtClient interface {
 
 	// DomainGetMetadata retrieves custom metadata from a domain
 	DomainGetMetadata(dom libvirt.Domain, typ int32, uri libvirt.OptString, flags libvirt.DomainModificationImpact) (string, error)
+
+	// DomainGetXMLDesc gets the domain XML
+	DomainGetXMLDesc(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error)
+
+	// DomainBlockPull starts a block pull job that flattens a disk's backing chain
+	DomainBlockPull(dom libvirt.Domain, path string, bandwidth uint64, flags libvirt.DomainBlockPullFlags) error
+
+	// DomainGetBlockJobInfo gets the progress of a running block job
+	DomainGetBlockJobInfo(dom libvirt.Domain, path string, flags uint32) (found int32, jobType int32, bandwidth uint64, cur uint64, end uint64, err error)
+
+	// DomainBlockJobAbort cancels a running block job
+	DomainBlockJobAbort(dom libvirt.Domain, path string, flags libvirt.DomainBlockJobAbortFlags) error
+
+	// DomainBlockResize grows a disk of a running domain (size in bytes with DomainBlockResizeBytes)
+	DomainBlockResize(dom libvirt.Domain, disk string, size uint64, flags libvirt.DomainBlockResizeFlags) error
+
+	// DomainSetVcpusFlags changes the number of vCPUs of a domain
+	DomainSetVcpusFlags(dom libvirt.Domain, nvcpus uint32, flags uint32) error
+
+	// DomainSetMemoryFlags changes the memory of a domain (in KiB)
+	DomainSetMemoryFlags(dom libvirt.Domain, memory uint64, flags uint32) error
+
+	// DomainSetBlockIOTune sets the I/O limits of a disk of a domain
+	DomainSetBlockIOTune(dom libvirt.Domain, disk string, params []libvirt.TypedParam, flags uint32) error
+
+	// DomainSetInterfaceParameters sets the traffic shaping of an interface
+	// of a domain, identified by its MAC address or host interface name
+	DomainSetInterfaceParameters(dom libvirt.Domain, device string, params []libvirt.TypedParam, flags uint32) error
+
+	// DomainAttachDeviceFlags attaches a device described by XML to a domain
+	DomainAttachDeviceFlags(dom libvirt.Domain, xml string, flags uint32) error
+
+	// DomainDetachDeviceFlags detaches a device described by XML from a domain
+	DomainDetachDeviceFlags(dom libvirt.Domain, xml string, flags uint32) error
+
+	// DomainBlockCommit starts a block commit job that merges a disk's overlay into its backing file
+	DomainBlockCommit(dom libvirt.Domain, disk string, base libvirt.OptString, top libvirt.OptString, bandwidth uint64, flags libvirt.DomainBlockCommitFlags) error
+
+	// DomainSnapshotNum counts the snapshots of a domain matching flags
+	DomainSnapshotNum(dom libvirt.Domain, flags uint32) (int32, error)
+
+	// DomainSnapshotCreateXML creates a snapshot of a domain from XML
+	DomainSnapshotCreateXML(dom libvirt.Domain, xmlDesc string, flags uint32) (libvirt.DomainSnapshot, error)
+
+	// DomainMigratePerform3Params migrates a domain to another host; with
+	// MigratePeer2peer the source daemon connects to dconnuri itself
+	DomainMigratePerform3Params(dom libvirt.Domain, dconnuri libvirt.OptString, params []libvirt.TypedParam, cookieIn []byte, flags libvirt.DomainMigrateFlags) ([]byte, error)
+
+	// DomainAbortJob aborts the running job (e.g., a migration) of a domain
+	DomainAbortJob(dom libvirt.Domain) error
+
+	// QEMUDomainAgentCommand runs a QEMU guest agent command (JSON) in a domain
+	QEMUDomainAgentCommand(dom libvirt.Domain, cmd string, timeout int32, flags uint32) (libvirt.OptString, error)
+
+	// DomainInterfaceAddresses returns the interface addresses of a running
+	// domain from the guest agent, DHCP leases or the ARP table
+	DomainInterfaceAddresses(dom libvirt.Domain, source uint32, flags uint32) ([]libvirt.DomainInterface, error)
+
+	// SubscribeEvents subscribes to domain events of the given type
+	SubscribeEvents(ctx context.Context, eventID libvirt.DomainEventID, dom libvirt.OptDomain) (<-chan interface{}, error)
+
+	// NodeGetInfo gets the host's CPU and memory (in KiB) capacity
+	NodeGetInfo() (model [32]int8, memory uint64, cpus int32, mhz int32, nodes int32, sockets int32, cores int32, threads int32, err error)
+
+	// ConnectGetDomainCapabilities describes the devices and features the
+	// host's hypervisor supports for domains
+	ConnectGetDomainCapabilities(emulatorbin libvirt.OptString, arch libvirt.OptString, machine libvirt.OptString, virttype libvirt.OptString, flags libvirt.ConnectGetDomainCapabilitiesFlags) (string, error)
+
+	// InterfaceLookupByName looks up a host network interface by name
+	InterfaceLookupByName(name string) (libvirt.Interface, error)
+
+	// NetworkLookupByName looks up a libvirt network by name
+	NetworkLookupByName(name string) (libvirt.Network, error)
+
+	// NetworkIsActive reports whether a libvirt network is running
+	NetworkIsActive(net libvirt.Network) (int32, error)
+
+	// ConnectListAllNodeDevices lists the host's devices, e.g. to find the
+	// virtual functions of SR-IOV network devices
+	ConnectListAllNodeDevices(NeedResults int32, Flags uint32) ([]libvirt.NodeDevice, uint32, error)
+
+	// NodeDeviceGetXMLDesc gets the XML definition of a host device
+	NodeDeviceGetXMLDesc(Name string, Flags uint32) (string, error)
 }
 
 // storageManager defines the storage operations needed for VM management.
@@ -99,18 +183,51 @@ type storageManager interface {
 	// CreateVolume creates a new volume in a pool
 	CreateVolume(ctx context.Context, poolName string, spec storage.VolumeSpec) error
 
+	// CloneVolume creates a volume holding a full copy of another volume
+	CloneVolume(ctx context.Context, poolName string, spec storage.VolumeSpec, sourcePool, sourceName string) error
+
 	// DeleteVolume deletes a volume from a pool
 	DeleteVolume(ctx context.Context, poolName, volumeName string) error
 
+	// FlattenVolume collapses a volume's backing chain into the volume
+	FlattenVolume(ctx context.Context, poolName, volumeName string) (bool, error)
+
+	// ExportVolume writes the contents of a volume, without backing file, to w
+	ExportVolume(ctx context.Context, poolName, volumeName string, w io.Writer) error
+
+	// ResizeVolume grows a volume to the given capacity
+	ResizeVolume(ctx context.Context, poolName, volumeName string, capacityGB uint64) error
+
+	// GetVolumePath returns the filesystem path to a volume
+	GetVolumePath(ctx context.Context, poolName, volumeName string) (string, error)
+
+	// GetVolumeInfoByPath returns the volume at a path, in whichever pool holds it
+	GetVolumeInfoByPath(ctx context.Context, path string) (*storage.VolumeInfo, error)
+
 	// GetImagePath returns the filesystem path to an image volume
 	GetImagePath(ctx context.Context, imageName string) (string, error)
 
 	// ImageExists checks if an image exists in the foundry-images pool
 	ImageExists(ctx context.Context, imageName string) (bool, error)
 
+	// GetImageMetadata returns the metadata recorded for an image
+	GetImageMetadata(ctx context.Context, imageName string) (*storage.ImageMetadata, error)
+
+	// ImageFingerprint returns a fingerprint identifying the content of an image
+	ImageFingerprint(ctx context.Context, imageName string) (string, error)
+
+	// UploadVolume replaces the contents of a volume with length bytes read from r
+	UploadVolume(ctx context.Context, poolName, volumeName string, r io.Reader, length uint64) error
+
+	// RefreshPool rescans a pool for volumes created outside the storage API
+	RefreshPool(ctx context.Context, name string) error
+
 	// WriteVolumeData writes data to a volume (for cloud-init ISOs)
 	WriteVolumeData(ctx context.Context, poolName, volumeName string, data []byte) error
 
 	// ListVolumes lists all volumes in a pool
 	ListVolumes(ctx context.Context, poolName string) ([]storage.VolumeInfo, error)
+
+	// GetPoolInfo returns the state, capacity and free space of a pool
+	GetPoolInfo(ctx context.Context, name string) (*storage.PoolInfo, error)
 }
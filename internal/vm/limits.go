@@ -0,0 +1,202 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/naming"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// LimitsOptions selects the limits SetLimits changes. The limits given
+// replace those of the disk or interface; zero values remove them.
+type LimitsOptions struct {
+	// Disk is the device (vda, vdb, ...) whose I/O limits are set to IOTune.
+	Disk   string
+	IOTune v1alpha1.DiskIOTuneSpec
+
+	// NIC is the IP address, MAC address or interface name of the network
+	// interface whose traffic shaping is set to Bandwidth.
+	NIC       string
+	Bandwidth v1alpha1.BandwidthSpec
+}
+
+// SetLimits changes the I/O limits of a disk and the traffic shaping of a
+// network interface of an existing VM without a configuration file.
+//
+// The change is made like Apply with only these fields edited: the stored spec
+// and persistent definition are updated, and a running VM has the limits
+// changed live.
+func SetLimits(ctx context.Context, name string, opts LimitsOptions) (*ApplyResult, error) {
+	client, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			logging.FromContext(ctx).Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(client.Libvirt())
+	metaClient := metadata.NewClient(client.Libvirt())
+
+	return setLimitsWithDeps(ctx, name, opts, client.Libvirt(), storageMgr, metaClient)
+}
+
+// setLimitsWithDeps changes the limits of a VM with injected dependencies.
+func setLimitsWithDeps(ctx context.Context, name string, opts LimitsOptions, lv LibvirtClient, sm storageManager, mc *metadata.Client) (*ApplyResult, error) {
+	if opts.Disk == "" && opts.NIC == "" {
+		return nil, fmt.Errorf("nothing to change: select a disk or a network interface")
+	}
+
+	domain, err := lv.DomainLookupByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find VM %s: %w", name, err)
+	}
+	current, err := mc.Load(domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", name, err)
+	}
+
+	desired := current.DeepCopy()
+	if opts.Disk != "" {
+		tuning, err := diskTuningForDevice(desired, opts.Disk)
+		if err != nil {
+			return nil, err
+		}
+		tuning.IOTune = nil
+		if opts.IOTune != (v1alpha1.DiskIOTuneSpec{}) {
+			ioTune := opts.IOTune
+			tuning.IOTune = &ioTune
+		}
+	}
+	if opts.NIC != "" {
+		i, _, err := findSpecInterface(desired, opts.NIC)
+		if err != nil {
+			return nil, err
+		}
+		desired.Spec.NetworkInterfaces[i].Bandwidth = nil
+		if opts.Bandwidth.Inbound != nil || opts.Bandwidth.Outbound != nil {
+			desired.Spec.NetworkInterfaces[i].Bandwidth = opts.Bandwidth.DeepCopy()
+		}
+	}
+	if err := validateUpdatedSpec(ctx, desired); err != nil {
+		return nil, err
+	}
+
+	return applyWithDeps(ctx, desired, lv, sm, mc)
+}
+
+// diskTuningForDevice finds the bus and driver options of the boot or data
+// disk at device in the VM spec.
+func diskTuningForDevice(vm *v1alpha1.VirtualMachine, device string) (*v1alpha1.DiskTuningSpec, error) {
+	if device == "vda" {
+		return &vm.Spec.BootDisk.DiskTuningSpec, nil
+	}
+	for i := range vm.Spec.DataDisks {
+		if vm.Spec.DataDisks[i].Device == device {
+			return &vm.Spec.DataDisks[i].DiskTuningSpec, nil
+		}
+	}
+	return nil, fmt.Errorf("disk %s not found in VM '%s' spec", device, vm.Name)
+}
+
+// setLiveLimits changes the I/O limits of the disks and the traffic shaping
+// of the interfaces of a running domain that differ between current and
+// desired. Returns false if any of them could not be changed live.
+func setLiveLimits(ctx context.Context, lv LibvirtClient, domain libvirt.Domain, current, desired *v1alpha1.VirtualMachine) bool {
+	logger := logging.FromContext(ctx)
+	ok := true
+
+	setIOTune := func(device string, have, want *v1alpha1.DiskIOTuneSpec) {
+		if reflect.DeepEqual(have, want) {
+			return
+		}
+		logger.Info("Setting disk I/O limits", "vm", desired.Name, "device", device)
+		if err := lv.DomainSetBlockIOTune(domain, device, ioTuneParams(want), uint32(libvirt.DomainAffectLive)); err != nil {
+			logger.Warn("Failed to set disk I/O limits live (takes effect after restart)", "vm", desired.Name, "device", device, "error", err)
+			ok = false
+		}
+	}
+	setIOTune("vda", current.Spec.BootDisk.IOTune, desired.Spec.BootDisk.IOTune)
+	for _, want := range desired.Spec.DataDisks {
+		for _, have := range current.Spec.DataDisks {
+			if have.Device == want.Device {
+				setIOTune(want.Device, have.IOTune, want.IOTune)
+			}
+		}
+	}
+
+	// Interfaces that changed otherwise are not the same device any more
+	if !reflect.DeepEqual(withoutBandwidth(current.Spec.NetworkInterfaces), withoutBandwidth(desired.Spec.NetworkInterfaces)) {
+		return ok
+	}
+	for i, iface := range desired.Spec.NetworkInterfaces {
+		if reflect.DeepEqual(current.Spec.NetworkInterfaces[i].Bandwidth, iface.Bandwidth) {
+			continue
+		}
+		mac, err := naming.InterfaceMAC(iface.IP, iface.IPv6, iface.MACAddress)
+		if err == nil {
+			logger.Info("Setting interface bandwidth", "vm", desired.Name, "mac", mac)
+			err = lv.DomainSetInterfaceParameters(domain, mac, bandwidthParams(iface.Bandwidth), uint32(libvirt.DomainAffectLive))
+		}
+		if err != nil {
+			logger.Warn("Failed to set interface bandwidth live (takes effect after restart)", "vm", desired.Name, "interface", i, "error", err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// ioTuneParams returns the typed parameters setting a disk's I/O limits;
+// every limit is set so that removed limits are cleared.
+func ioTuneParams(ioTune *v1alpha1.DiskIOTuneSpec) []libvirt.TypedParam {
+	if ioTune == nil {
+		ioTune = &v1alpha1.DiskIOTuneSpec{}
+	}
+	param := func(field string, value int) libvirt.TypedParam {
+		return libvirt.TypedParam{Field: field, Value: *libvirt.NewTypedParamValueUllong(uint64(value))}
+	}
+	return []libvirt.TypedParam{
+		param("total_iops_sec", ioTune.TotalIOPS),
+		param("read_iops_sec", ioTune.ReadIOPS),
+		param("write_iops_sec", ioTune.WriteIOPS),
+		param("total_bytes_sec", ioTune.TotalBytesPerSec),
+		param("read_bytes_sec", ioTune.ReadBytesPerSec),
+		param("write_bytes_sec", ioTune.WriteBytesPerSec),
+	}
+}
+
+// bandwidthParams returns the typed parameters setting an interface's
+// traffic shaping; an average of zero removes the limit of a direction.
+func bandwidthParams(bandwidth *v1alpha1.BandwidthSpec) []libvirt.TypedParam {
+	var params []libvirt.TypedParam
+	add := func(direction string, limit *v1alpha1.BandwidthLimitSpec) {
+		if limit == nil {
+			limit = &v1alpha1.BandwidthLimitSpec{}
+		}
+		for _, p := range []struct {
+			name  string
+			value int
+		}{{"average", limit.Average}, {"peak", limit.Peak}, {"burst", limit.Burst}} {
+			params = append(params, libvirt.TypedParam{
+				Field: direction + "." + p.name,
+				Value: *libvirt.NewTypedParamValueUint(uint32(p.value)),
+			})
+		}
+	}
+	if bandwidth == nil {
+		bandwidth = &v1alpha1.BandwidthSpec{}
+	}
+	add("inbound", bandwidth.Inbound)
+	add("outbound", bandwidth.Outbound)
+	return params
+}
@@ -0,0 +1,113 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+func TestSetLimitsWithDeps(t *testing.T) {
+	stored := testVMConfig()
+	stored.Spec.DataDisks = []v1alpha1.DataDiskSpec{{Device: "vdb", SizeGB: 10}}
+	lv, sm := newApplyMocks(t, stored)
+
+	var ioTuneParams, ifaceParams []libvirt.TypedParam
+	lv.domainSetBlockIOTuneFunc = func(dom libvirt.Domain, disk string, params []libvirt.TypedParam) error {
+		ioTuneParams = params
+		return nil
+	}
+	lv.domainSetIfaceParamsFunc = func(dom libvirt.Domain, device string, params []libvirt.TypedParam) error {
+		ifaceParams = params
+		return nil
+	}
+
+	opts := LimitsOptions{
+		Disk:      "vdb",
+		IOTune:    v1alpha1.DiskIOTuneSpec{TotalIOPS: 500},
+		NIC:       "10.0.0.10",
+		Bandwidth: v1alpha1.BandwidthSpec{Outbound: &v1alpha1.BandwidthLimitSpec{Average: 1024}},
+	}
+	result, err := setLimitsWithDeps(context.Background(), "test-vm", opts, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("setLimitsWithDeps() error = %v", err)
+	}
+	if len(result.Changes) != 2 || result.RestartRequired {
+		t.Errorf("result = %+v, want two live changes", result)
+	}
+
+	// The limits are changed on the running VM
+	if len(lv.domainSetBlockIOTuneCalls) != 1 || lv.domainSetBlockIOTuneCalls[0] != "vdb" {
+		t.Errorf("DomainSetBlockIOTune calls = %v, want [vdb]", lv.domainSetBlockIOTuneCalls)
+	}
+	if len(ioTuneParams) != 6 || ioTuneParams[0].Field != "total_iops_sec" || ioTuneParams[0].Value.I != uint64(500) {
+		t.Errorf("I/O tune params = %+v, want total_iops_sec 500 first", ioTuneParams)
+	}
+	if len(lv.domainSetIfaceParamsCalls) != 1 || lv.domainSetIfaceParamsCalls[0] != "be:ef:0a:00:00:0a" {
+		t.Errorf("DomainSetInterfaceParameters calls = %v, want the interface's MAC", lv.domainSetIfaceParamsCalls)
+	}
+	if len(ifaceParams) != 6 || ifaceParams[3].Field != "outbound.average" || ifaceParams[3].Value.I != uint32(1024) {
+		t.Errorf("interface params = %+v, want outbound.average 1024", ifaceParams)
+	}
+
+	// And stored in the spec and domain definition
+	loaded, err := newMockMetadataClient(lv).Load(libvirt.Domain{Name: "test-vm"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if ioTune := loaded.Spec.DataDisks[0].IOTune; ioTune == nil || ioTune.TotalIOPS != 500 {
+		t.Errorf("stored I/O limits = %+v, want totalIOPS 500", ioTune)
+	}
+	if bw := loaded.Spec.NetworkInterfaces[0].Bandwidth; bw == nil || bw.Outbound == nil || bw.Outbound.Average != 1024 {
+		t.Errorf("stored bandwidth = %+v, want outbound average 1024", bw)
+	}
+	defined := lv.domainDefineXMLCalls[0]
+	if !strings.Contains(defined, "<total_iops_sec>500</total_iops_sec>") || !strings.Contains(defined, `<outbound average="1024">`) {
+		t.Errorf("redefined domain = %s, want the limits", defined)
+	}
+}
+
+func TestSetLimitsWithDeps_LiveFailure(t *testing.T) {
+	lv, sm := newApplyMocks(t, testVMConfig())
+	lv.domainSetBlockIOTuneFunc = func(dom libvirt.Domain, disk string, params []libvirt.TypedParam) error {
+		return errors.New("unsupported")
+	}
+
+	opts := LimitsOptions{Disk: "vda", IOTune: v1alpha1.DiskIOTuneSpec{ReadBytesPerSec: 1 << 20}}
+	result, err := setLimitsWithDeps(context.Background(), "test-vm", opts, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("setLimitsWithDeps() error = %v", err)
+	}
+	if !result.RestartRequired {
+		t.Error("expected RestartRequired when the limits cannot be changed live")
+	}
+}
+
+func TestSetLimitsWithDeps_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    LimitsOptions
+		wantErr string
+	}{
+		{name: "nothing selected", wantErr: "nothing to change"},
+		{name: "unknown disk", opts: LimitsOptions{Disk: "vdz"}, wantErr: "disk vdz not found"},
+		{name: "unknown interface", opts: LimitsOptions{NIC: "10.9.9.9"}, wantErr: "no network interface"},
+		{name: "invalid limits", opts: LimitsOptions{Disk: "vda", IOTune: v1alpha1.DiskIOTuneSpec{TotalIOPS: 10, ReadIOPS: 5}}, wantErr: "cannot be combined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lv, sm := newApplyMocks(t, testVMConfig())
+			_, err := setLimitsWithDeps(context.Background(), "test-vm", tt.opts, lv, sm, newMockMetadataClient(lv))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("setLimitsWithDeps() error = %v, want %q", err, tt.wantErr)
+			}
+			if len(lv.domainDefineXMLCalls) != 0 {
+				t.Error("nothing must be changed on error")
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+//go:build linux
+
+package vm
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+)
+
+// localLinks returns the network interfaces of the hypervisor, or nil if it
+// is not the local host.
+func localLinks() hostLinks {
+	if foundrylibvirt.IsRemote("") {
+		return nil
+	}
+	return systemLinks{}
+}
+
+// systemLinks implements hostLinks for the local host.
+type systemLinks struct{}
+
+func (systemLinks) LinkExists(name string) (bool, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return false, fmt.Errorf("failed to list network interfaces: %w", err)
+	}
+	for _, iface := range ifaces {
+		if iface.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (systemLinks) DeleteLink(name string) error {
+	out, err := exec.Command("ip", "link", "delete", name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ip link delete %s: %w: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
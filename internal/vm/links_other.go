@@ -0,0 +1,9 @@
+//go:build !linux
+
+package vm
+
+// localLinks returns nil: outside Linux the hypervisor is never the local
+// host, so its tap interfaces cannot be checked.
+func localLinks() hostLinks {
+	return nil
+}
@@ -4,15 +4,19 @@ package vm
 import (
 	"context"
 	"fmt"
-	"log"
+	"net"
 	"os"
 	"text/tabwriter"
 
 	"github.com/digitalocean/go-libvirt"
+	"github.com/google/uuid"
 
 	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/inspect"
 	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
 	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/naming"
 	"github.com/jbweber/foundry/internal/status"
 )
 
@@ -29,15 +33,17 @@ type VMInfo struct {
 //
 // Returns a slice of VMInfo structs containing details about each VM.
 func List(ctx context.Context) ([]VMInfo, error) {
+	logger := logging.FromContext(ctx)
+
 	// Connect to libvirt
-	log.Printf("Connecting to libvirt...")
+	logger.Debug("Connecting to libvirt")
 	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
 	}
 	defer func() {
 		if err := LibvirtClient.Close(); err != nil {
-			log.Printf("Warning: failed to close libvirt connection: %v", err)
+			logger.Warn("Failed to close libvirt connection", "error", err)
 		}
 	}()
 
@@ -47,7 +53,9 @@ func List(ctx context.Context) ([]VMInfo, error) {
 
 // listWithDeps lists VMs with injected dependencies.
 // This allows for testing by accepting interfaces instead of concrete types.
-func listWithDeps(_ context.Context, lv LibvirtClient) ([]VMInfo, error) {
+func listWithDeps(ctx context.Context, lv LibvirtClient) ([]VMInfo, error) {
+	logger := logging.FromContext(ctx)
+
 	// List all domains (running and stopped)
 	// NeedResults: 1 means populate the domains slice
 	// Flags: 0 means all domains (active and inactive)
@@ -64,9 +72,9 @@ func listWithDeps(_ context.Context, lv LibvirtClient) ([]VMInfo, error) {
 	// Collect info for each domain
 	vms := make([]VMInfo, 0, len(domains))
 	for _, domain := range domains {
-		info, err := getDomainInfo(lv, domain)
+		info, err := getDomainInfo(ctx, lv, domain)
 		if err != nil {
-			log.Printf("Warning: failed to get info for domain %s: %v", domain.Name, err)
+			logger.Warn("Failed to get domain info", "domain", domain.Name, "error", err)
 			continue
 		}
 		vms = append(vms, info)
@@ -76,7 +84,9 @@ func listWithDeps(_ context.Context, lv LibvirtClient) ([]VMInfo, error) {
 }
 
 // getDomainInfo gets detailed information about a single domain.
-func getDomainInfo(lv LibvirtClient, domain libvirt.Domain) (VMInfo, error) {
+func getDomainInfo(ctx context.Context, lv LibvirtClient, domain libvirt.Domain) (VMInfo, error) {
+	logger := logging.FromContext(ctx)
+
 	// Get domain state
 	state, _, err := lv.DomainGetState(domain, 0)
 	if err != nil {
@@ -92,13 +102,13 @@ func getDomainInfo(lv LibvirtClient, domain libvirt.Domain) (VMInfo, error) {
 	// Get autostart status
 	autostart, err := lv.DomainGetAutostart(domain)
 	if err != nil {
-		log.Printf("Warning: failed to get autostart for %s: %v", domain.Name, err)
+		logger.Warn("Failed to get autostart", "domain", domain.Name, "error", err)
 		autostart = 0
 	}
 
 	// Sanity check: state from GetState and GetInfo should match
 	if int32(stateVal) != state {
-		log.Printf("Warning: state mismatch for %s: GetState=%d, GetInfo=%d", domain.Name, state, stateVal)
+		logger.Warn("Domain state mismatch", "domain", domain.Name, "getState", state, "getInfo", stateVal)
 	}
 
 	// Convert memory from KiB to MiB
@@ -167,15 +177,17 @@ func PrintVMs(vms []VMInfo) {
 // ListVMs lists all VMs and returns them as v1alpha1.VirtualMachine objects
 // with their spec loaded from metadata and status populated from libvirt state.
 func ListVMs(ctx context.Context) ([]*v1alpha1.VirtualMachine, error) {
+	logger := logging.FromContext(ctx)
+
 	// Connect to libvirt
-	log.Printf("Connecting to libvirt...")
+	logger.Debug("Connecting to libvirt")
 	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
 	}
 	defer func() {
 		if err := LibvirtClient.Close(); err != nil {
-			log.Printf("Warning: failed to close libvirt connection: %v", err)
+			logger.Warn("Failed to close libvirt connection", "error", err)
 		}
 	}()
 
@@ -183,7 +195,9 @@ func ListVMs(ctx context.Context) ([]*v1alpha1.VirtualMachine, error) {
 }
 
 // listVMsWithDeps lists VMs with injected dependencies.
-func listVMsWithDeps(_ context.Context, lv LibvirtClient) ([]*v1alpha1.VirtualMachine, error) {
+func listVMsWithDeps(ctx context.Context, lv LibvirtClient) ([]*v1alpha1.VirtualMachine, error) {
+	logger := logging.FromContext(ctx)
+
 	// List all domains (running and stopped)
 	domains, _, err := lv.ConnectListAllDomains(1, 0)
 	if err != nil {
@@ -198,16 +212,9 @@ func listVMsWithDeps(_ context.Context, lv LibvirtClient) ([]*v1alpha1.VirtualMa
 	// Collect VirtualMachine objects for each domain
 	vms := make([]*v1alpha1.VirtualMachine, 0, len(domains))
 	for _, domain := range domains {
-		// Convert interface to *libvirt.Libvirt for metadata operations
-		libvirtPtr, ok := lv.(*libvirt.Libvirt)
-		if !ok {
-			log.Printf("Warning: cannot convert LibvirtClient to *libvirt.Libvirt")
-			continue
-		}
-
-		vm, err := getVirtualMachine(libvirtPtr, domain)
+		vm, err := getVirtualMachine(ctx, lv, domain)
 		if err != nil {
-			log.Printf("Warning: failed to get VM info for domain %s: %v", domain.Name, err)
+			logger.Warn("Failed to get VM info", "domain", domain.Name, "error", err)
 			continue
 		}
 		vms = append(vms, vm)
@@ -218,14 +225,14 @@ func listVMsWithDeps(_ context.Context, lv LibvirtClient) ([]*v1alpha1.VirtualMa
 
 // getVirtualMachine loads a VirtualMachine from libvirt metadata and populates
 // its status from the current domain state.
-func getVirtualMachine(lv *libvirt.Libvirt, domain libvirt.Domain) (*v1alpha1.VirtualMachine, error) {
+func getVirtualMachine(ctx context.Context, lv LibvirtClient, domain libvirt.Domain) (*v1alpha1.VirtualMachine, error) {
 	// Try to load metadata first
 	metaClient := metadata.NewClient(lv)
 	vm, err := metaClient.Load(domain)
 	if err != nil {
 		// If metadata doesn't exist, create a minimal VM object
 		// This handles VMs not created by Foundry
-		log.Printf("Warning: no Foundry metadata for %s, creating minimal VM object", domain.Name)
+		logging.FromContext(ctx).Warn("No Foundry metadata, creating minimal VM object", "domain", domain.Name)
 		vm = &v1alpha1.VirtualMachine{
 			ObjectMeta: v1alpha1.ObjectMeta{
 				Name: domain.Name,
@@ -236,7 +243,7 @@ func getVirtualMachine(lv *libvirt.Libvirt, domain libvirt.Domain) (*v1alpha1.Vi
 	}
 
 	// Populate status from current domain state
-	if err := populateStatus(lv, domain, vm); err != nil {
+	if err := populateStatus(ctx, lv, domain, vm); err != nil {
 		return nil, fmt.Errorf("failed to populate status: %w", err)
 	}
 
@@ -244,16 +251,28 @@ func getVirtualMachine(lv *libvirt.Libvirt, domain libvirt.Domain) (*v1alpha1.Vi
 }
 
 // populateStatus updates the VM status based on current libvirt domain state.
-func populateStatus(lv *libvirt.Libvirt, domain libvirt.Domain, vm *v1alpha1.VirtualMachine) error {
+func populateStatus(ctx context.Context, lv LibvirtClient, domain libvirt.Domain, vm *v1alpha1.VirtualMachine) error {
 	// Get domain state
 	state, _, err := lv.DomainGetState(domain, 0)
 	if err != nil {
 		return fmt.Errorf("failed to get domain state: %w", err)
 	}
 
+	setStatus(vm, domain, state)
+
+	// Add the addresses the running VM actually has, e.g. from DHCP
+	if state == domainStateRunning {
+		populateLiveAddresses(ctx, lv, domain, vm)
+	}
+
+	return nil
+}
+
+// setStatus sets the phase, Ready condition, domain UUID and network status
+// of vm for a domain in the given libvirt state.
+func setStatus(vm *v1alpha1.VirtualMachine, domain libvirt.Domain, state int32) {
 	// Map libvirt state to VM phase
-	phase := mapStateToPhase(state)
-	vm.Status.Phase = phase
+	vm.Status.Phase = mapStateToPhase(state)
 
 	// Update Ready condition based on state
 	readyStatus := v1alpha1.ConditionFalse
@@ -268,54 +287,88 @@ func populateStatus(lv *libvirt.Libvirt, domain libvirt.Domain, vm *v1alpha1.Vir
 
 	status.SetCondition(vm, v1alpha1.ConditionReady, readyStatus, reason, message)
 
-	// TODO: Populate addresses from network interfaces
-	// For now, this would require parsing the domain XML or querying the guest agent
-	// We'll add this in a future enhancement
+	// Domain UUID comes straight from libvirt
+	vm.SetDomainUUID(uuid.UUID(domain.UUID).String())
 
-	return nil
+	// Addresses, MACs and interface names are derived from the stored spec
+	populateNetworkStatus(vm)
 }
 
-// mapStateToPhase maps libvirt domain state to VirtualMachine phase.
-func mapStateToPhase(state int32) v1alpha1.VMPhase {
-	switch state {
-	case 0: // no state
-		return v1alpha1.VMPhasePending
-	case 1: // running
-		return v1alpha1.VMPhaseRunning
-	case 2, 3: // blocked, paused
-		return v1alpha1.VMPhaseRunning // Still counts as running
-	case 4: // shutdown (in progress)
-		return v1alpha1.VMPhaseStopping
-	case 5: // shutoff
-		return v1alpha1.VMPhaseStopped
-	case 6: // crashed
-		return v1alpha1.VMPhaseFailed
-	case 7: // pmsuspended
-		return v1alpha1.VMPhaseRunning
-	default:
-		return v1alpha1.VMPhasePending // Use Pending for unknown states
+// populateLiveAddresses adds the addresses discovered on the VM's interfaces
+// by the guest agent, DHCP leases or the ARP table that the spec does not
+// already list. Discovery is best effort: guests without an agent on bridged
+// networks may report nothing until the host has talked to them.
+func populateLiveAddresses(ctx context.Context, lv LibvirtClient, domain libvirt.Domain, vm *v1alpha1.VirtualMachine) {
+	addresses, err := inspect.Addresses(lv, domain, vm.Status.MACAddresses)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Failed to discover addresses", "domain", domain.Name, "error", err)
+		return
 	}
-}
 
-// GetVM retrieves a single VM by name.
-func GetVM(ctx context.Context, name string) (*v1alpha1.VirtualMachine, error) {
-	// Connect to libvirt
-	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	// Keep IPs ahead of the hostname, the first address is the one shown by list
+	var ips, others []v1alpha1.VMAddress
+	known := make(map[string]bool, len(vm.Status.Addresses))
+	for _, addr := range vm.Status.Addresses {
+		known[addr.Address] = true
+		if addr.Type == "InternalIP" {
+			ips = append(ips, addr)
+		} else {
+			others = append(others, addr)
+		}
 	}
-	defer func() {
-		if err := LibvirtClient.Close(); err != nil {
-			log.Printf("Warning: failed to close libvirt connection: %v", err)
+	for _, addr := range addresses {
+		if !known[addr.IP] {
+			known[addr.IP] = true
+			ips = append(ips, v1alpha1.VMAddress{Type: "InternalIP", Address: addr.IP})
 		}
-	}()
+	}
+	vm.Status.Addresses = append(ips, others...)
+}
 
-	// Look up domain by name
-	domain, err := LibvirtClient.Libvirt().DomainLookupByName(name)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find VM %s: %w", name, err)
+// populateNetworkStatus fills in the network-related status fields from the spec.
+//
+// Static IPs are reported as InternalIP addresses and the FQDN (if configured)
+// as a Hostname address. MAC addresses and tap interface names are calculated
+// the same way as during domain XML generation. Any previously stored values
+// are replaced so repeated loads never accumulate duplicates.
+func populateNetworkStatus(vm *v1alpha1.VirtualMachine) {
+	vm.Status.Addresses = nil
+	var macs, ifaceNames []string
+
+	for _, iface := range vm.Spec.NetworkInterfaces {
+		// DHCP addresses are assigned by the network and not known here
+		if iface.IP != "" {
+			addr := iface.IP
+			if ip, _, err := net.ParseCIDR(iface.IP); err == nil {
+				addr = ip.String()
+			}
+			vm.AddAddress("InternalIP", addr)
+		}
+		if iface.IPv6 != "" {
+			addr := iface.IPv6
+			if ip, _, err := net.ParseCIDR(iface.IPv6); err == nil {
+				addr = ip.String()
+			}
+			vm.AddAddress("InternalIP", addr)
+		}
+
+		if mac, err := naming.InterfaceMAC(iface.IP, iface.IPv6, iface.MACAddress); err == nil {
+			macs = append(macs, mac)
+		}
+		if name, err := naming.InterfaceNameWithStrategy(namingStrategy(vm).InterfaceName, iface.IP, iface.IPv6, iface.MACAddress); err == nil {
+			ifaceNames = append(ifaceNames, name)
+		}
 	}
 
-	// Get VM with populated status
-	return getVirtualMachine(LibvirtClient.Libvirt(), domain)
+	if vm.Spec.CloudInit != nil && vm.Spec.CloudInit.FQDN != "" {
+		vm.AddAddress("Hostname", vm.Spec.CloudInit.FQDN)
+	}
+
+	vm.SetMACAddresses(macs)
+	vm.SetInterfaceNames(ifaceNames)
+}
+
+// mapStateToPhase maps libvirt domain state to VirtualMachine phase.
+func mapStateToPhase(state int32) v1alpha1.VMPhase {
+	return status.PhaseForDomainState(state)
 }
@@ -3,9 +3,11 @@ package vm
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/digitalocean/go-libvirt"
+	"github.com/jbweber/foundry/api/v1alpha1"
 )
 
 func TestListWithDeps_NoDomains(t *testing.T) {
@@ -363,3 +365,54 @@ func TestPrintVMs(t *testing.T) {
 		})
 	}
 }
+
+func TestPopulateNetworkStatus_DHCP(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		Spec: v1alpha1.VirtualMachineSpec{
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{IP: "10.0.0.5/24", Gateway: "10.0.0.1", Bridge: "br0"},
+				{Bridge: "br1", DHCP: true, MACAddress: "be:ee:0a:0b:0c:0d"},
+			},
+		},
+	}
+
+	populateNetworkStatus(vm)
+
+	if len(vm.Status.Addresses) != 1 || vm.Status.Addresses[0].Address != "10.0.0.5" {
+		t.Errorf("Addresses = %v, want only the static address", vm.Status.Addresses)
+	}
+	wantMACs := []string{"be:ef:0a:00:00:05", "be:ee:0a:0b:0c:0d"}
+	if got := vm.GetMACAddresses(); !reflect.DeepEqual(got, wantMACs) {
+		t.Errorf("MACAddresses = %v, want %v", got, wantMACs)
+	}
+	wantNames := []string{"vm0a000005", "vm0a0b0c0d"}
+	if got := vm.GetInterfaceNames(); !reflect.DeepEqual(got, wantNames) {
+		t.Errorf("InterfaceNames = %v, want %v", got, wantNames)
+	}
+}
+
+func TestPopulateNetworkStatus_IPv6(t *testing.T) {
+	vm := &v1alpha1.VirtualMachine{
+		Spec: v1alpha1.VirtualMachineSpec{
+			NetworkInterfaces: []v1alpha1.NetworkInterfaceSpec{
+				{IP: "10.0.0.5/24", Gateway: "10.0.0.1", IPv6: "2001:db8::5/64", Bridge: "br0"},
+				{IPv6: "2001:db8::10/64", Bridge: "br1"},
+			},
+		},
+	}
+
+	populateNetworkStatus(vm)
+
+	var addrs []string
+	for _, a := range vm.Status.Addresses {
+		addrs = append(addrs, a.Address)
+	}
+	wantAddrs := []string{"10.0.0.5", "2001:db8::5", "2001:db8::10"}
+	if !reflect.DeepEqual(addrs, wantAddrs) {
+		t.Errorf("Addresses = %v, want %v", addrs, wantAddrs)
+	}
+	wantMACs := []string{"be:ef:0a:00:00:05", "be:e6:9b:26:2f:e9"}
+	if got := vm.GetMACAddresses(); !reflect.DeepEqual(got, wantMACs) {
+		t.Errorf("MACAddresses = %v, want %v", got, wantMACs)
+	}
+}
@@ -0,0 +1,323 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// MigrateOptions controls how MigrateVM moves a VM to another host.
+type MigrateOptions struct {
+	To            string // Connection URI of the destination hypervisor (e.g., qemu+ssh://hv2/system)
+	SharedStorage bool   // Both hosts see the VM's volumes at the same paths, so they are not copied
+	Bandwidth     uint64 // Maximum migration bandwidth in MiB/s (0 is libvirt's default)
+}
+
+// MigrateResult describes a migration done by MigrateVM.
+type MigrateResult struct {
+	Live    bool     // The VM was running and kept running during the migration
+	Volumes []string // Volumes copied to the destination (none with shared storage)
+}
+
+// MigrateVM moves a VM to the hypervisor at opts.To.
+//
+// A running (or paused) VM is live migrated with peer-to-peer migration: the
+// source libvirt daemon connects to opts.To itself, so the URI must work from
+// the source host. Without shared storage, libvirt copies the disks while the
+// VM runs, into volumes foundry creates on the destination first.
+//
+// A stopped VM is migrated offline: without shared storage its volumes are
+// copied, flattened, to the destination, then the domain is defined there.
+//
+// Either way the stored spec is written on the destination, autostart is set
+// there, and the VM is undefined on the source and, unless the storage is
+// shared, its volumes are deleted. VMs with snapshots cannot be migrated.
+func MigrateVM(ctx context.Context, vmName string, opts MigrateOptions) (*MigrateResult, error) {
+	logger := logging.FromContext(ctx)
+
+	if opts.To == "" {
+		return nil, fmt.Errorf("no destination to migrate to")
+	}
+
+	// Connect to both hypervisors
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	logger.Debug("Connecting to destination", "uri", opts.To)
+	destClient, err := foundrylibvirt.ConnectWithContext(ctx, opts.To, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to destination: %w", err)
+	}
+	defer func() {
+		if err := destClient.Close(); err != nil {
+			logger.Warn("Failed to close destination connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+	destStorageMgr := storage.NewManager(destClient.Libvirt())
+	destMetaClient := metadata.NewClient(destClient.Libvirt())
+
+	return migrateVMWithDeps(ctx, vmName, opts, LibvirtClient.Libvirt(), storageMgr, metaClient, destClient.Libvirt(), destStorageMgr, destMetaClient)
+}
+
+// migrateVMWithDeps migrates a VM with injected dependencies for the source
+// (lv, sm, mc) and destination (dlv, dsm, dmc) hypervisors.
+// This allows for testing by accepting interfaces instead of concrete types.
+func migrateVMWithDeps(ctx context.Context, vmName string, opts MigrateOptions, lv LibvirtClient, sm storageManager, mc *metadata.Client, dlv LibvirtClient, dsm storageManager, dmc *metadata.Client) (*MigrateResult, error) {
+	logger := logging.FromContext(ctx)
+
+	// Step 1: Look up the VM and check it can move
+	domain, err := lv.DomainLookupByName(vmName)
+	if err != nil {
+		return nil, fmt.Errorf("VM '%s' not found: %w", vmName, err)
+	}
+	vm, err := mc.Load(domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", vmName, err)
+	}
+
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VM state: %w", err)
+	}
+	var live bool
+	switch state {
+	case domainStateShutoff, domainStateCrashed:
+	case domainStateRunning, domainStatePaused:
+		live = true
+	default:
+		return nil, fmt.Errorf("VM '%s' cannot be migrated while %s", vmName, stateToString(state))
+	}
+
+	snapshots, err := lv.DomainSnapshotNum(domain, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count snapshots: %w", err)
+	}
+	if snapshots > 0 {
+		return nil, fmt.Errorf("VM '%s' has %d snapshot(s), which cannot be migrated; delete them first", vmName, snapshots)
+	}
+
+	if _, err := dlv.DomainLookupByName(vmName); err == nil {
+		return nil, fmt.Errorf("VM '%s' already exists on the destination", vmName)
+	}
+	if err := dsm.EnsureDefaultPools(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ensure storage pools on the destination: %w", err)
+	}
+
+	// Step 2: Check the destination sees the volumes, or has room for copies
+	pool := getStoragePool(vm)
+	disks := backupDisks(ctx, vm, sm)
+	for _, disk := range disks {
+		path, err := sm.GetVolumePath(ctx, pool, disk.Volume)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get path of volume %s: %w", disk.Volume, err)
+		}
+		if opts.SharedStorage {
+			if _, err := dsm.GetVolumeInfoByPath(ctx, path); err != nil {
+				return nil, fmt.Errorf("volume %s is not visible on the destination; is the storage shared? %w", path, err)
+			}
+			continue
+		}
+		exists, err := dsm.VolumeExists(ctx, pool, disk.Volume)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check volume %s on the destination: %w", disk.Volume, err)
+		}
+		if exists {
+			return nil, fmt.Errorf("volume %s/%s already exists on the destination (pass --shared-storage if the hosts share their storage)", pool, disk.Volume)
+		}
+	}
+
+	domainXML, err := lv.DomainGetXMLDesc(domain, libvirt.DomainXMLInactive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain XML: %w", err)
+	}
+
+	// Step 3: Create the volumes on the destination, removing them again on
+	// failure. Libvirt fills the disks of a running VM; the volumes of a
+	// stopped VM and the read-only cloud-init ISO are copied here.
+	result := &MigrateResult{Live: live}
+	var created []string
+	cleanup := func() {
+		// A failed call may still have moved the VM: keep what it uses
+		if _, err := dlv.DomainLookupByName(vmName); err == nil {
+			return
+		}
+		for _, volume := range created {
+			if err := dsm.DeleteVolume(ctx, pool, volume); err != nil {
+				logger.Warn("Failed to delete volume on the destination", "pool", pool, "volume", volume, "error", err)
+			}
+		}
+	}
+	if !opts.SharedStorage {
+		for _, disk := range disks {
+			spec, err := restoredVolumeSpec(vm, disk)
+			if err != nil {
+				cleanup()
+				return nil, err
+			}
+
+			logger.Info("Creating volume on the destination", "vm", vmName, "volume", disk.Volume)
+			if err := dsm.CreateVolume(ctx, pool, spec); err != nil {
+				cleanup()
+				return nil, fmt.Errorf("failed to create volume %s on the destination: %w", disk.Volume, err)
+			}
+			created = append(created, disk.Volume)
+
+			if err := fillMigratedVolume(ctx, pool, disk.Volume, !live || disk.Device == "", sm, dsm); err != nil {
+				cleanup()
+				return nil, err
+			}
+		}
+		result.Volumes = created
+
+		// Flattened copies no longer need the boot image
+		delete(vm.Annotations, v1alpha1.AnnotationBootImagePath)
+		delete(vm.Annotations, v1alpha1.AnnotationBootImageFingerprint)
+	}
+
+	// Step 4: Move the domain
+	var destDomain libvirt.Domain
+	if live {
+		destDomain, err = migrateLive(ctx, vmName, domain, opts, lv, dlv)
+	} else {
+		logger.Info("Defining domain on the destination", "vm", vmName)
+		destDomain, err = dlv.DomainDefineXML(domainXML)
+		if err != nil {
+			err = fmt.Errorf("failed to define domain on the destination: %w", err)
+		}
+	}
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	// Step 5: Store the spec and autostart on the destination
+	autostart := int32(0)
+	if libvirtAutostart(vm) {
+		autostart = 1
+	}
+	if err := dlv.DomainSetAutostart(destDomain, autostart); err != nil {
+		logger.Warn("Failed to set autostart on the destination", "vm", vmName, "error", err)
+	}
+	if err := dmc.Store(destDomain, vm); err != nil {
+		return nil, fmt.Errorf("VM migrated but failed to store VM metadata on the destination: %w", err)
+	}
+
+	// Step 6: Clean up the source. Live migration already undefined it.
+	if !live {
+		logger.Info("Undefining domain on the source", "vm", vmName)
+		if err := lv.DomainUndefineFlags(domain, libvirt.DomainUndefineNvram|libvirt.DomainUndefineSnapshotsMetadata); err != nil {
+			return nil, fmt.Errorf("VM migrated but failed to undefine it on the source: %w", err)
+		}
+	}
+	if !opts.SharedStorage {
+		for _, disk := range disks {
+			logger.Info("Deleting volume from the source", "vm", vmName, "volume", disk.Volume)
+			if err := sm.DeleteVolume(ctx, pool, disk.Volume); err != nil {
+				logger.Warn("Failed to delete volume on the source", "pool", pool, "volume", disk.Volume, "error", err)
+			}
+		}
+	}
+
+	logger.Info("VM migrated", "vm", vmName, "uri", opts.To)
+	return result, nil
+}
+
+// fillMigratedVolume checks that a volume created on the destination is at
+// the path the domain XML uses, and copies the source volume's contents into
+// it when withData is set.
+func fillMigratedVolume(ctx context.Context, pool, volume string, withData bool, sm, dsm storageManager) error {
+	// The domain XML refers to volumes by path
+	path, err := sm.GetVolumePath(ctx, pool, volume)
+	if err != nil {
+		return fmt.Errorf("failed to get path of volume %s: %w", volume, err)
+	}
+	destPath, err := dsm.GetVolumePath(ctx, pool, volume)
+	if err != nil {
+		return fmt.Errorf("failed to get path of volume %s on the destination: %w", volume, err)
+	}
+	if destPath != path {
+		return fmt.Errorf("volume %s is at %s on the destination but %s on the source; pool %s must use the same directory on both hosts", volume, destPath, path, pool)
+	}
+
+	if !withData {
+		return nil
+	}
+	logging.FromContext(ctx).Info("Copying volume", "pool", pool, "volume", volume)
+	err = pipeVolume(
+		func(dst io.Writer) error { return sm.ExportVolume(ctx, pool, volume, dst) },
+		// A length of 0 uploads everything exported
+		func(src io.Reader) error { return dsm.UploadVolume(ctx, pool, volume, src, 0) },
+	)
+	if err != nil {
+		return fmt.Errorf("failed to copy volume %s: %w", volume, err)
+	}
+	return nil
+}
+
+// migrateLive live migrates a running domain to the destination with
+// peer-to-peer migration, copying its writable disks unless the storage is
+// shared, and returns the domain on the destination. Cancelling ctx aborts
+// the migration.
+func migrateLive(ctx context.Context, vmName string, domain libvirt.Domain, opts MigrateOptions, lv, dlv LibvirtClient) (libvirt.Domain, error) {
+	logger := logging.FromContext(ctx)
+
+	flags := libvirt.MigrateLive | libvirt.MigratePeer2peer | libvirt.MigratePersistDest |
+		libvirt.MigrateUndefineSource | libvirt.MigrateAbortOnError
+	if !opts.SharedStorage {
+		flags |= libvirt.MigrateNonSharedDisk
+	}
+	var params []libvirt.TypedParam
+	if opts.Bandwidth > 0 {
+		params = append(params, libvirt.TypedParam{
+			Field: libvirt.MigrateParamBandwidth,
+			Value: *libvirt.NewTypedParamValueUllong(opts.Bandwidth),
+		})
+	}
+
+	logger.Info("Live migrating VM", "vm", vmName, "uri", opts.To)
+	done := make(chan error, 1)
+	go func() {
+		_, err := lv.DomainMigratePerform3Params(domain, libvirt.OptString{opts.To}, params, nil, flags)
+		done <- err
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		logger.Info("Aborting migration", "vm", vmName)
+		if abortErr := lv.DomainAbortJob(domain); abortErr != nil {
+			logger.Warn("Failed to abort migration", "vm", vmName, "error", abortErr)
+		}
+		err = errors.Join(ctx.Err(), <-done)
+	}
+	if err != nil {
+		return libvirt.Domain{}, fmt.Errorf("failed to migrate VM: %w", err)
+	}
+
+	destDomain, err := dlv.DomainLookupByName(vmName)
+	if err != nil {
+		return libvirt.Domain{}, fmt.Errorf("VM migrated but not found on the destination: %w", err)
+	}
+	return destDomain, nil
+}
@@ -0,0 +1,284 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// newMigrateMocks returns the mocks of a migration: the stopped test-vm of
+// newExportMocks, recorded with a boot image, on the source and an empty
+// destination where the VM appears once defined or migrated.
+func newMigrateMocks(t *testing.T) (lv *mockLibvirtClient, sm *mockStorageManager, dlv *mockLibvirtClient, dsm *mockStorageManager) {
+	t.Helper()
+	lv, sm = newExportMocks(t)
+	stored := testVMConfigWithDataDisks()
+	stored.Annotations = map[string]string{v1alpha1.AnnotationBootImagePath: "/images/base.qcow2", "owner": "ops"}
+	metadataXML := storedMetadataXML(t, stored)
+	lv.domainGetMetadataFunc = func(dom libvirt.Domain, typ int32, uri libvirt.OptString, flags libvirt.DomainModificationImpact) (string, error) {
+		return metadataXML, nil
+	}
+
+	dlv = newMockLibvirtClient()
+	migrated := false
+	lv.domainMigrateFunc = func(dom libvirt.Domain, dconnuri string, flags libvirt.DomainMigrateFlags) error {
+		migrated = true
+		return nil
+	}
+	dlv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		if migrated || len(dlv.domainDefineXMLCalls) > 0 {
+			return libvirt.Domain{Name: name}, nil
+		}
+		return libvirt.Domain{}, fmt.Errorf("domain not found: %s", name)
+	}
+	destXML := ""
+	dlv.domainSetMetadataFunc = func(dom libvirt.Domain, typ int32, md libvirt.OptString, key libvirt.OptString, uri libvirt.OptString, flags libvirt.DomainModificationImpact) error {
+		destXML = md[0]
+		return nil
+	}
+	dlv.domainGetMetadataFunc = func(dom libvirt.Domain, typ int32, uri libvirt.OptString, flags libvirt.DomainModificationImpact) (string, error) {
+		if destXML == "" {
+			return "", errors.New("no metadata found")
+		}
+		return destXML, nil
+	}
+	return lv, sm, dlv, newMockStorageManager()
+}
+
+// migrate runs migrateVMWithDeps on the mocks.
+func migrate(ctx context.Context, opts MigrateOptions, lv *mockLibvirtClient, sm *mockStorageManager, dlv *mockLibvirtClient, dsm *mockStorageManager) (*MigrateResult, error) {
+	opts.To = "qemu+ssh://hv2/system"
+	return migrateVMWithDeps(ctx, "test-vm", opts, lv, sm, newMockMetadataClient(lv), dlv, dsm, newMockMetadataClient(dlv))
+}
+
+const migratedVolumes = "test-vm_boot.qcow2 test-vm_data-vdb.qcow2 test-vm_data-vdc.qcow2 test-vm_cloudinit.iso"
+
+func TestMigrateVMWithDeps_Offline(t *testing.T) {
+	lv, sm, dlv, dsm := newMigrateMocks(t)
+	uploaded := make(map[string]string)
+	dsm.uploadVolumeFunc = func(ctx context.Context, poolName, volumeName string, r io.Reader, length uint64) error {
+		data, err := io.ReadAll(r)
+		uploaded[volumeName] = string(data)
+		return err
+	}
+
+	result, err := migrate(context.Background(), MigrateOptions{}, lv, sm, dlv, dsm)
+	if err != nil {
+		t.Fatalf("migrateVMWithDeps() error = %v", err)
+	}
+	if result.Live || strings.Join(result.Volumes, " ") != migratedVolumes {
+		t.Errorf("result = %+v", result)
+	}
+
+	// Every volume is copied, then the domain is defined on the destination
+	if len(dsm.createVolumeCalls) != 4 || len(uploaded) != 4 || uploaded["test-vm_data-vdb.qcow2"] != "test-vm_data-vdb.qcow2" {
+		t.Errorf("created %v, uploaded %v", dsm.createVolumeCalls, uploaded)
+	}
+	if len(lv.domainMigrateCalls) != 0 || len(dlv.domainDefineXMLCalls) != 1 {
+		t.Errorf("%d migrations, %d definitions on the destination", len(lv.domainMigrateCalls), len(dlv.domainDefineXMLCalls))
+	}
+
+	stored, err := newMockMetadataClient(dlv).Load(libvirt.Domain{Name: "test-vm"})
+	if err != nil {
+		t.Fatalf("no spec stored on the destination: %v", err)
+	}
+	if _, ok := stored.Annotations[v1alpha1.AnnotationBootImagePath]; ok || stored.Annotations["owner"] != "ops" {
+		t.Errorf("stored annotations = %v, want the boot image dropped", stored.Annotations)
+	}
+
+	// The source is cleaned up
+	if len(lv.domainUndefineFlagsCalls) != 1 {
+		t.Error("VM not undefined on the source")
+	}
+	if len(sm.deleteVolumeCalls) != 4 {
+		t.Errorf("source DeleteVolume calls = %v", sm.deleteVolumeCalls)
+	}
+}
+
+func TestMigrateVMWithDeps_Live(t *testing.T) {
+	lv, sm, dlv, dsm := newMigrateMocks(t)
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateRunning, 0, nil
+	}
+	var uploaded []string
+	dsm.uploadVolumeFunc = func(ctx context.Context, poolName, volumeName string, r io.Reader, length uint64) error {
+		uploaded = append(uploaded, volumeName)
+		_, err := io.Copy(io.Discard, r)
+		return err
+	}
+
+	result, err := migrate(context.Background(), MigrateOptions{}, lv, sm, dlv, dsm)
+	if err != nil {
+		t.Fatalf("migrateVMWithDeps() error = %v", err)
+	}
+	if !result.Live {
+		t.Error("expected a live migration")
+	}
+
+	// Libvirt copies the disks; only the read-only ISO is uploaded
+	if len(dsm.createVolumeCalls) != 4 || strings.Join(uploaded, " ") != "test-vm_cloudinit.iso" {
+		t.Errorf("created %d volumes, uploaded %v", len(dsm.createVolumeCalls), uploaded)
+	}
+	if len(lv.domainMigrateCalls) != 1 {
+		t.Fatalf("%d migrations, want 1", len(lv.domainMigrateCalls))
+	}
+	flags := lv.domainMigrateCalls[0]
+	want := libvirt.MigrateLive | libvirt.MigratePeer2peer | libvirt.MigratePersistDest | libvirt.MigrateUndefineSource | libvirt.MigrateNonSharedDisk
+	if flags&want != want {
+		t.Errorf("migration flags = %v, want %v", flags, want)
+	}
+	if _, err := newMockMetadataClient(dlv).Load(libvirt.Domain{Name: "test-vm"}); err != nil {
+		t.Errorf("no spec stored on the destination: %v", err)
+	}
+
+	// Libvirt undefines the source; foundry deletes its volumes
+	if len(lv.domainUndefineFlagsCalls) != 0 || len(sm.deleteVolumeCalls) != 4 {
+		t.Errorf("%d undefines, source DeleteVolume calls = %v", len(lv.domainUndefineFlagsCalls), sm.deleteVolumeCalls)
+	}
+}
+
+func TestMigrateVMWithDeps_SharedStorage(t *testing.T) {
+	lv, sm, dlv, dsm := newMigrateMocks(t)
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateRunning, 0, nil
+	}
+	dsm.getVolumeInfoByPathFunc = func(ctx context.Context, path string) (*storage.VolumeInfo, error) {
+		return &storage.VolumeInfo{Path: path}, nil
+	}
+
+	result, err := migrate(context.Background(), MigrateOptions{SharedStorage: true}, lv, sm, dlv, dsm)
+	if err != nil {
+		t.Fatalf("migrateVMWithDeps() error = %v", err)
+	}
+	if len(result.Volumes) != 0 || len(dsm.createVolumeCalls) != 0 || len(sm.deleteVolumeCalls) != 0 {
+		t.Errorf("volumes copied or deleted with shared storage: %+v, %v", result, sm.deleteVolumeCalls)
+	}
+	if flags := lv.domainMigrateCalls[0]; flags&libvirt.MigrateNonSharedDisk != 0 {
+		t.Errorf("migration flags = %v, want no disk copy", flags)
+	}
+
+	stored, err := newMockMetadataClient(dlv).Load(libvirt.Domain{Name: "test-vm"})
+	if err != nil || stored.Annotations[v1alpha1.AnnotationBootImagePath] == "" {
+		t.Errorf("stored spec = %+v, %v; want the boot image kept", stored, err)
+	}
+}
+
+func TestMigrateVMWithDeps_Refused(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    MigrateOptions
+		setup   func(lv *mockLibvirtClient, dlv *mockLibvirtClient, dsm *mockStorageManager)
+		wantErr string
+	}{
+		{
+			name: "snapshots",
+			setup: func(lv *mockLibvirtClient, dlv *mockLibvirtClient, dsm *mockStorageManager) {
+				lv.domainSnapshotNumFunc = func(dom libvirt.Domain, flags uint32) (int32, error) {
+					return 2, nil
+				}
+			},
+			wantErr: "2 snapshot(s)",
+		},
+		{
+			name: "exists on destination",
+			setup: func(lv *mockLibvirtClient, dlv *mockLibvirtClient, dsm *mockStorageManager) {
+				dlv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+					return libvirt.Domain{Name: name}, nil
+				}
+			},
+			wantErr: "already exists on the destination",
+		},
+		{
+			name: "volume on destination",
+			setup: func(lv *mockLibvirtClient, dlv *mockLibvirtClient, dsm *mockStorageManager) {
+				dsm.volumeExistsFunc = func(ctx context.Context, poolName, volumeName string) (bool, error) {
+					return volumeName == "test-vm_data-vdc.qcow2", nil
+				}
+			},
+			wantErr: "--shared-storage",
+		},
+		{
+			name:    "storage not shared",
+			opts:    MigrateOptions{SharedStorage: true},
+			setup:   func(lv *mockLibvirtClient, dlv *mockLibvirtClient, dsm *mockStorageManager) {},
+			wantErr: "not visible on the destination",
+		},
+		{
+			name: "pool paths differ",
+			setup: func(lv *mockLibvirtClient, dlv *mockLibvirtClient, dsm *mockStorageManager) {
+				dsm.getVolumePathFunc = func(ctx context.Context, poolName, volumeName string) (string, error) {
+					return "/srv/vms/" + volumeName, nil
+				}
+			},
+			wantErr: "same directory on both hosts",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lv, sm, dlv, dsm := newMigrateMocks(t)
+			tt.setup(lv, dlv, dsm)
+
+			_, err := migrate(context.Background(), tt.opts, lv, sm, dlv, dsm)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			if len(lv.domainUndefineFlagsCalls) != 0 || len(sm.deleteVolumeCalls) != 0 {
+				t.Error("source changed by a refused migration")
+			}
+		})
+	}
+}
+
+func TestMigrateVMWithDeps_FailureCleansUp(t *testing.T) {
+	lv, sm, dlv, dsm := newMigrateMocks(t)
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateRunning, 0, nil
+	}
+	lv.domainMigrateFunc = func(dom libvirt.Domain, dconnuri string, flags libvirt.DomainMigrateFlags) error {
+		return errors.New("unsupported CPU")
+	}
+
+	if _, err := migrate(context.Background(), MigrateOptions{}, lv, sm, dlv, dsm); err == nil || !strings.Contains(err.Error(), "unsupported CPU") {
+		t.Fatalf("error = %v, want the migration error", err)
+	}
+	if len(dsm.deleteVolumeCalls) != 4 {
+		t.Errorf("destination DeleteVolume calls = %v, want the created volumes", dsm.deleteVolumeCalls)
+	}
+	if len(sm.deleteVolumeCalls) != 0 {
+		t.Errorf("source volumes deleted after a failed migration: %v", sm.deleteVolumeCalls)
+	}
+}
+
+func TestMigrateVMWithDeps_Cancelled(t *testing.T) {
+	lv, sm, dlv, dsm := newMigrateMocks(t)
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateRunning, 0, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	aborted := make(chan struct{})
+	lv.domainMigrateFunc = func(dom libvirt.Domain, dconnuri string, flags libvirt.DomainMigrateFlags) error {
+		cancel()
+		<-aborted
+		return errors.New("migration job: canceled by client")
+	}
+	lv.domainAbortJobFunc = func(dom libvirt.Domain) error {
+		close(aborted)
+		return nil
+	}
+
+	if _, err := migrate(ctx, MigrateOptions{}, lv, sm, dlv, dsm); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+	if len(lv.domainAbortJobCalls) != 1 {
+		t.Errorf("%d DomainAbortJob calls, want 1", len(lv.domainAbortJobCalls))
+	}
+}
@@ -3,6 +3,7 @@ package vm
 import (
 	"context"
 	"fmt"
+	"io"
 	"sync"
 
 	"github.com/digitalocean/go-libvirt"
@@ -30,6 +31,31 @@ type mockLibvirtClient struct {
 	domainUndefineFunc        func(dom libvirt.Domain) error
 	domainSetMetadataFunc     func(dom libvirt.Domain, typ int32, metadata libvirt.OptString, key libvirt.OptString, uri libvirt.OptString, flags libvirt.DomainModificationImpact) error
 	domainGetMetadataFunc     func(dom libvirt.Domain, typ int32, uri libvirt.OptString, flags libvirt.DomainModificationImpact) (string, error)
+	domainGetXMLDescFunc      func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error)
+	domainBlockPullFunc       func(dom libvirt.Domain, path string, bandwidth uint64, flags libvirt.DomainBlockPullFlags) error
+	domainGetBlockJobInfoFunc func(dom libvirt.Domain, path string, flags uint32) (int32, int32, uint64, uint64, uint64, error)
+	domainBlockJobAbortFunc   func(dom libvirt.Domain, path string, flags libvirt.DomainBlockJobAbortFlags) error
+	domainBlockResizeFunc     func(dom libvirt.Domain, disk string, size uint64, flags libvirt.DomainBlockResizeFlags) error
+	domainSetVcpusFlagsFunc   func(dom libvirt.Domain, nvcpus uint32, flags uint32) error
+	domainSetMemoryFlagsFunc  func(dom libvirt.Domain, memory uint64, flags uint32) error
+	domainSetBlockIOTuneFunc  func(dom libvirt.Domain, disk string, params []libvirt.TypedParam) error
+	domainSetIfaceParamsFunc  func(dom libvirt.Domain, device string, params []libvirt.TypedParam) error
+	domainAttachDeviceFunc    func(dom libvirt.Domain, xml string, flags uint32) error
+	domainDetachDeviceFunc    func(dom libvirt.Domain, xml string, flags uint32) error
+	domainSnapshotNumFunc     func(dom libvirt.Domain, flags uint32) (int32, error)
+	domainSnapshotCreateFunc  func(dom libvirt.Domain, xml string, flags uint32) (libvirt.DomainSnapshot, error)
+	domainBlockCommitFunc     func(dom libvirt.Domain, disk string, flags libvirt.DomainBlockCommitFlags) error
+	domainMigrateFunc         func(dom libvirt.Domain, dconnuri string, flags libvirt.DomainMigrateFlags) error
+	domainAbortJobFunc        func(dom libvirt.Domain) error
+	agentCommandFunc          func(dom libvirt.Domain, cmd string) (string, error)
+	interfaceAddressesFunc    func(dom libvirt.Domain, source uint32) ([]libvirt.DomainInterface, error)
+	subscribeEventsFunc       func(ctx context.Context, eventID libvirt.DomainEventID, dom libvirt.OptDomain) (<-chan interface{}, error)
+	nodeGetInfoFunc           func() (memoryKiB uint64, cpus int32, err error)
+	domainCapabilitiesFunc    func() (string, error)
+	interfaceLookupFunc       func(name string) (libvirt.Interface, error)
+	networkLookupFunc         func(name string) (libvirt.Network, error)
+	networkIsActiveFunc       func(net libvirt.Network) (int32, error)
+	nodeDevices               map[string]string // node device XML by name
 
 	// Call tracking
 	connectListAllDomainsCalls int
@@ -46,6 +72,25 @@ type mockLibvirtClient struct {
 	domainUndefineCalls        []libvirt.Domain
 	domainSetMetadataCalls     []libvirt.Domain
 	domainGetMetadataCalls     []libvirt.Domain
+	domainGetXMLDescCalls      []libvirt.Domain
+	domainBlockPullCalls       []string // disk paths
+	domainGetBlockJobInfoCalls []string // disk paths
+	domainBlockJobAbortCalls   []string // disk paths
+	domainBlockResizeCalls     []string // disk paths
+	domainBlockCommitCalls     []string // disk paths
+	domainSnapshotCreateCalls  []string // snapshot XML
+	domainMigrateCalls         []libvirt.DomainMigrateFlags
+	domainAbortJobCalls        []libvirt.Domain
+	domainSetVcpusFlagsCalls   []uint32 // vCPU counts
+	domainSetMemoryFlagsCalls  []uint64 // memory in KiB
+	domainSetBlockIOTuneCalls  []string // disk targets
+	domainSetIfaceParamsCalls  []string // interface MAC addresses
+	domainAttachDeviceCalls    []string // device XML
+	domainDetachDeviceCalls    []string // device XML
+	agentCommandCalls          []string // agent command JSON
+	subscribeEventsCalls       []libvirt.DomainEventID
+	interfaceLookupCalls       []string
+	networkLookupCalls         []string
 }
 
 // newMockLibvirtClient creates a new mock libvirt client with default behavior.
@@ -128,6 +173,115 @@ func newMockLibvirtClient() *mockLibvirtClient {
 		return "", fmt.Errorf("no metadata found")
 	}
 
+	// Default: minimal domain XML
+	m.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		return fmt.Sprintf("<domain type='kvm'><name>%s</name></domain>", dom.Name), nil
+	}
+
+	// Default: block pull succeeds
+	m.domainBlockPullFunc = func(dom libvirt.Domain, path string, bandwidth uint64, flags libvirt.DomainBlockPullFlags) error {
+		return nil
+	}
+
+	// Default: no block job running
+	m.domainGetBlockJobInfoFunc = func(dom libvirt.Domain, path string, flags uint32) (int32, int32, uint64, uint64, uint64, error) {
+		return 0, 0, 0, 0, 0, nil
+	}
+
+	// Default: abort succeeds
+	m.domainBlockJobAbortFunc = func(dom libvirt.Domain, path string, flags libvirt.DomainBlockJobAbortFlags) error {
+		return nil
+	}
+
+	// Default: block resize succeeds
+	m.domainBlockResizeFunc = func(dom libvirt.Domain, disk string, size uint64, flags libvirt.DomainBlockResizeFlags) error {
+		return nil
+	}
+
+	// Default: live resource changes succeed
+	m.domainSetVcpusFlagsFunc = func(dom libvirt.Domain, nvcpus uint32, flags uint32) error {
+		return nil
+	}
+	m.domainSetMemoryFlagsFunc = func(dom libvirt.Domain, memory uint64, flags uint32) error {
+		return nil
+	}
+	m.domainSetBlockIOTuneFunc = func(dom libvirt.Domain, disk string, params []libvirt.TypedParam) error {
+		return nil
+	}
+	m.domainSetIfaceParamsFunc = func(dom libvirt.Domain, device string, params []libvirt.TypedParam) error {
+		return nil
+	}
+
+	// Default: device hotplug succeeds
+	m.domainAttachDeviceFunc = func(dom libvirt.Domain, xml string, flags uint32) error {
+		return nil
+	}
+	m.domainDetachDeviceFunc = func(dom libvirt.Domain, xml string, flags uint32) error {
+		return nil
+	}
+
+	// Default: no snapshots
+	m.domainSnapshotNumFunc = func(dom libvirt.Domain, flags uint32) (int32, error) {
+		return 0, nil
+	}
+
+	// Default: snapshots and block commits succeed
+	m.domainSnapshotCreateFunc = func(dom libvirt.Domain, xml string, flags uint32) (libvirt.DomainSnapshot, error) {
+		return libvirt.DomainSnapshot{Dom: dom}, nil
+	}
+	m.domainBlockCommitFunc = func(dom libvirt.Domain, disk string, flags libvirt.DomainBlockCommitFlags) error {
+		return nil
+	}
+	m.domainMigrateFunc = func(dom libvirt.Domain, dconnuri string, flags libvirt.DomainMigrateFlags) error {
+		return nil
+	}
+	m.domainAbortJobFunc = func(dom libvirt.Domain) error {
+		return nil
+	}
+
+	// Default: no guest agent
+	m.agentCommandFunc = func(dom libvirt.Domain, cmd string) (string, error) {
+		return "", fmt.Errorf("guest agent is not configured")
+	}
+
+	// Default: no address source knows the domain
+	m.interfaceAddressesFunc = func(dom libvirt.Domain, source uint32) ([]libvirt.DomainInterface, error) {
+		return nil, nil
+	}
+
+	// Default: event stream that never delivers anything and closes with ctx
+	m.subscribeEventsFunc = func(ctx context.Context, eventID libvirt.DomainEventID, dom libvirt.OptDomain) (<-chan interface{}, error) {
+		ch := make(chan interface{})
+		go func() {
+			<-ctx.Done()
+			close(ch)
+		}()
+		return ch, nil
+	}
+
+	// Default: a host with 64 CPUs and 256 GiB of memory
+	m.nodeGetInfoFunc = func() (uint64, int32, error) {
+		return 256 << 20, 64, nil
+	}
+
+	// Default: the hypervisor emulates TPMs with swtpm
+	m.domainCapabilitiesFunc = func() (string, error) {
+		return `<domainCapabilities><devices><tpm supported="yes">` +
+			`<enum name="backendModel"><value>passthrough</value><value>emulator</value></enum>` +
+			`</tpm></devices></domainCapabilities>`, nil
+	}
+
+	// Default: every bridge and network exists and is active
+	m.interfaceLookupFunc = func(name string) (libvirt.Interface, error) {
+		return libvirt.Interface{Name: name}, nil
+	}
+	m.networkLookupFunc = func(name string) (libvirt.Network, error) {
+		return libvirt.Network{Name: name}, nil
+	}
+	m.networkIsActiveFunc = func(net libvirt.Network) (int32, error) {
+		return 1, nil
+	}
+
 	return m
 }
 
@@ -229,27 +383,235 @@ func (m *mockLibvirtClient) DomainGetMetadata(dom libvirt.Domain, typ int32, uri
 	return m.domainGetMetadataFunc(dom, typ, uri, flags)
 }
 
+func (m *mockLibvirtClient) DomainGetXMLDesc(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.domainGetXMLDescCalls = append(m.domainGetXMLDescCalls, dom)
+	return m.domainGetXMLDescFunc(dom, flags)
+}
+
+func (m *mockLibvirtClient) DomainBlockPull(dom libvirt.Domain, path string, bandwidth uint64, flags libvirt.DomainBlockPullFlags) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.domainBlockPullCalls = append(m.domainBlockPullCalls, path)
+	return m.domainBlockPullFunc(dom, path, bandwidth, flags)
+}
+
+func (m *mockLibvirtClient) DomainGetBlockJobInfo(dom libvirt.Domain, path string, flags uint32) (int32, int32, uint64, uint64, uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.domainGetBlockJobInfoCalls = append(m.domainGetBlockJobInfoCalls, path)
+	return m.domainGetBlockJobInfoFunc(dom, path, flags)
+}
+
+func (m *mockLibvirtClient) DomainBlockJobAbort(dom libvirt.Domain, path string, flags libvirt.DomainBlockJobAbortFlags) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.domainBlockJobAbortCalls = append(m.domainBlockJobAbortCalls, path)
+	return m.domainBlockJobAbortFunc(dom, path, flags)
+}
+
+func (m *mockLibvirtClient) DomainBlockResize(dom libvirt.Domain, disk string, size uint64, flags libvirt.DomainBlockResizeFlags) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.domainBlockResizeCalls = append(m.domainBlockResizeCalls, disk)
+	return m.domainBlockResizeFunc(dom, disk, size, flags)
+}
+
+func (m *mockLibvirtClient) DomainSnapshotNum(dom libvirt.Domain, flags uint32) (int32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.domainSnapshotNumFunc(dom, flags)
+}
+
+func (m *mockLibvirtClient) DomainSnapshotCreateXML(dom libvirt.Domain, xmlDesc string, flags uint32) (libvirt.DomainSnapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.domainSnapshotCreateCalls = append(m.domainSnapshotCreateCalls, xmlDesc)
+	return m.domainSnapshotCreateFunc(dom, xmlDesc, flags)
+}
+
+func (m *mockLibvirtClient) DomainBlockCommit(dom libvirt.Domain, disk string, base libvirt.OptString, top libvirt.OptString, bandwidth uint64, flags libvirt.DomainBlockCommitFlags) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.domainBlockCommitCalls = append(m.domainBlockCommitCalls, disk)
+	return m.domainBlockCommitFunc(dom, disk, flags)
+}
+
+func (m *mockLibvirtClient) DomainMigratePerform3Params(dom libvirt.Domain, dconnuri libvirt.OptString, params []libvirt.TypedParam, cookieIn []byte, flags libvirt.DomainMigrateFlags) ([]byte, error) {
+	m.mu.Lock()
+	m.domainMigrateCalls = append(m.domainMigrateCalls, flags)
+	fn := m.domainMigrateFunc
+	m.mu.Unlock()
+	// Not under the lock: a migration may block until aborted
+	return nil, fn(dom, dconnuri[0], flags)
+}
+
+func (m *mockLibvirtClient) DomainAbortJob(dom libvirt.Domain) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.domainAbortJobCalls = append(m.domainAbortJobCalls, dom)
+	return m.domainAbortJobFunc(dom)
+}
+
+func (m *mockLibvirtClient) DomainSetVcpusFlags(dom libvirt.Domain, nvcpus uint32, flags uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.domainSetVcpusFlagsCalls = append(m.domainSetVcpusFlagsCalls, nvcpus)
+	return m.domainSetVcpusFlagsFunc(dom, nvcpus, flags)
+}
+
+func (m *mockLibvirtClient) DomainSetMemoryFlags(dom libvirt.Domain, memory uint64, flags uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.domainSetMemoryFlagsCalls = append(m.domainSetMemoryFlagsCalls, memory)
+	return m.domainSetMemoryFlagsFunc(dom, memory, flags)
+}
+
+func (m *mockLibvirtClient) DomainSetBlockIOTune(dom libvirt.Domain, disk string, params []libvirt.TypedParam, flags uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.domainSetBlockIOTuneCalls = append(m.domainSetBlockIOTuneCalls, disk)
+	return m.domainSetBlockIOTuneFunc(dom, disk, params)
+}
+
+func (m *mockLibvirtClient) DomainSetInterfaceParameters(dom libvirt.Domain, device string, params []libvirt.TypedParam, flags uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.domainSetIfaceParamsCalls = append(m.domainSetIfaceParamsCalls, device)
+	return m.domainSetIfaceParamsFunc(dom, device, params)
+}
+
+func (m *mockLibvirtClient) DomainAttachDeviceFlags(dom libvirt.Domain, xml string, flags uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.domainAttachDeviceCalls = append(m.domainAttachDeviceCalls, xml)
+	return m.domainAttachDeviceFunc(dom, xml, flags)
+}
+
+func (m *mockLibvirtClient) DomainDetachDeviceFlags(dom libvirt.Domain, xml string, flags uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.domainDetachDeviceCalls = append(m.domainDetachDeviceCalls, xml)
+	return m.domainDetachDeviceFunc(dom, xml, flags)
+}
+
+func (m *mockLibvirtClient) QEMUDomainAgentCommand(dom libvirt.Domain, cmd string, timeout int32, flags uint32) (libvirt.OptString, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.agentCommandCalls = append(m.agentCommandCalls, cmd)
+	result, err := m.agentCommandFunc(dom, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return libvirt.OptString{result}, nil
+}
+
+func (m *mockLibvirtClient) DomainInterfaceAddresses(dom libvirt.Domain, source uint32, flags uint32) ([]libvirt.DomainInterface, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.interfaceAddressesFunc(dom, source)
+}
+
+func (m *mockLibvirtClient) SubscribeEvents(ctx context.Context, eventID libvirt.DomainEventID, dom libvirt.OptDomain) (<-chan interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscribeEventsCalls = append(m.subscribeEventsCalls, eventID)
+	return m.subscribeEventsFunc(ctx, eventID, dom)
+}
+
+func (m *mockLibvirtClient) NodeGetInfo() ([32]int8, uint64, int32, int32, int32, int32, int32, int32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	memory, cpus, err := m.nodeGetInfoFunc()
+	return [32]int8{}, memory, cpus, 0, 0, 0, 0, 0, err
+}
+
+func (m *mockLibvirtClient) ConnectGetDomainCapabilities(emulatorbin libvirt.OptString, arch libvirt.OptString, machine libvirt.OptString, virttype libvirt.OptString, flags libvirt.ConnectGetDomainCapabilitiesFlags) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.domainCapabilitiesFunc()
+}
+
+func (m *mockLibvirtClient) InterfaceLookupByName(name string) (libvirt.Interface, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.interfaceLookupCalls = append(m.interfaceLookupCalls, name)
+	return m.interfaceLookupFunc(name)
+}
+
+func (m *mockLibvirtClient) NetworkLookupByName(name string) (libvirt.Network, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.networkLookupCalls = append(m.networkLookupCalls, name)
+	return m.networkLookupFunc(name)
+}
+
+func (m *mockLibvirtClient) NetworkIsActive(net libvirt.Network) (int32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.networkIsActiveFunc(net)
+}
+
+func (m *mockLibvirtClient) ConnectListAllNodeDevices(NeedResults int32, Flags uint32) ([]libvirt.NodeDevice, uint32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var devices []libvirt.NodeDevice
+	for name := range m.nodeDevices {
+		devices = append(devices, libvirt.NodeDevice{Name: name})
+	}
+	return devices, uint32(len(devices)), nil
+}
+
+func (m *mockLibvirtClient) NodeDeviceGetXMLDesc(Name string, Flags uint32) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	xml, ok := m.nodeDevices[Name]
+	if !ok {
+		return "", fmt.Errorf("no device %s", Name)
+	}
+	return xml, nil
+}
+
 // mockStorageManager is a mock implementation of the storageManager interface for testing.
 type mockStorageManager struct {
 	mu sync.Mutex
 
 	// Configurable behavior
-	ensureDefaultPoolsFunc func(ctx context.Context) error
-	volumeExistsFunc       func(ctx context.Context, poolName, volumeName string) (bool, error)
-	createVolumeFunc       func(ctx context.Context, poolName string, spec storage.VolumeSpec) error
-	deleteVolumeFunc       func(ctx context.Context, poolName, volumeName string) error
-	getImagePathFunc       func(ctx context.Context, imageName string) (string, error)
-	imageExistsFunc        func(ctx context.Context, imageName string) (bool, error)
-	writeVolumeDataFunc    func(ctx context.Context, poolName, volumeName string, data []byte) error
-	listVolumesFunc        func(ctx context.Context, poolName string) ([]storage.VolumeInfo, error)
+	ensureDefaultPoolsFunc  func(ctx context.Context) error
+	volumeExistsFunc        func(ctx context.Context, poolName, volumeName string) (bool, error)
+	createVolumeFunc        func(ctx context.Context, poolName string, spec storage.VolumeSpec) error
+	cloneVolumeFunc         func(ctx context.Context, poolName string, spec storage.VolumeSpec, sourcePool, sourceName string) error
+	deleteVolumeFunc        func(ctx context.Context, poolName, volumeName string) error
+	flattenVolumeFunc       func(ctx context.Context, poolName, volumeName string) (bool, error)
+	exportVolumeFunc        func(ctx context.Context, poolName, volumeName string, w io.Writer) error
+	getVolumeInfoByPathFunc func(ctx context.Context, path string) (*storage.VolumeInfo, error)
+	resizeVolumeFunc        func(ctx context.Context, poolName, volumeName string, capacityGB uint64) error
+	getVolumePathFunc       func(ctx context.Context, poolName, volumeName string) (string, error)
+	getImagePathFunc        func(ctx context.Context, imageName string) (string, error)
+	imageExistsFunc         func(ctx context.Context, imageName string) (bool, error)
+	getImageMetadataFunc    func(ctx context.Context, imageName string) (*storage.ImageMetadata, error)
+	imageFingerprintFunc    func(ctx context.Context, imageName string) (string, error)
+	uploadVolumeFunc        func(ctx context.Context, poolName, volumeName string, r io.Reader, length uint64) error
+	refreshPoolFunc         func(ctx context.Context, name string) error
+	writeVolumeDataFunc     func(ctx context.Context, poolName, volumeName string, data []byte) error
+	listVolumesFunc         func(ctx context.Context, poolName string) ([]storage.VolumeInfo, error)
+	getPoolInfoFunc         func(ctx context.Context, name string) (*storage.PoolInfo, error)
 
 	// Call tracking
 	ensureDefaultPoolsCalls int
 	volumeExistsCalls       []string // format: "pool/volume"
 	createVolumeCalls       []storage.VolumeSpec
+	cloneVolumeCalls        []string // format: "pool/source -> pool/volume"
 	deleteVolumeCalls       []string // format: "pool/volume"
+	flattenVolumeCalls      []string // format: "pool/volume"
+	exportVolumeCalls       []string // format: "pool/volume"
+	resizeVolumeCalls       []string // format: "pool/volume"
+	getVolumePathCalls      []string // format: "pool/volume"
 	getImagePathCalls       []string
 	imageExistsCalls        []string
+	uploadVolumeCalls       []string // format: "pool/volume"
+	refreshPoolCalls        []string // pool names
 	writeVolumeDataCalls    []string // format: "pool/volume"
 	listVolumesCalls        []string // pool names
 }
@@ -269,10 +631,35 @@ func newMockStorageManager() *mockStorageManager {
 		createVolumeFunc: func(ctx context.Context, poolName string, spec storage.VolumeSpec) error {
 			return nil
 		},
+		// Default: clone succeeds
+		cloneVolumeFunc: func(ctx context.Context, poolName string, spec storage.VolumeSpec, sourcePool, sourceName string) error {
+			return nil
+		},
 		// Default: delete succeeds
 		deleteVolumeFunc: func(ctx context.Context, poolName, volumeName string) error {
 			return nil
 		},
+		// Default: volumes have no backing chain
+		flattenVolumeFunc: func(ctx context.Context, poolName, volumeName string) (bool, error) {
+			return false, nil
+		},
+		// Default: paths are not volumes
+		getVolumeInfoByPathFunc: func(ctx context.Context, path string) (*storage.VolumeInfo, error) {
+			return nil, fmt.Errorf("no storage pool volume at %s", path)
+		},
+		// Default: volumes hold their own name
+		exportVolumeFunc: func(ctx context.Context, poolName, volumeName string, w io.Writer) error {
+			_, err := w.Write([]byte(volumeName))
+			return err
+		},
+		// Default: resize succeeds
+		resizeVolumeFunc: func(ctx context.Context, poolName, volumeName string, capacityGB uint64) error {
+			return nil
+		},
+		// Default: volumes live under the pool directory
+		getVolumePathFunc: func(ctx context.Context, poolName, volumeName string) (string, error) {
+			return "/var/lib/libvirt/images/foundry/" + poolName + "/" + volumeName, nil
+		},
 		// Default: image exists with path
 		getImagePathFunc: func(ctx context.Context, imageName string) (string, error) {
 			return "/var/lib/libvirt/images/foundry/foundry-images/" + imageName, nil
@@ -281,6 +668,23 @@ func newMockStorageManager() *mockStorageManager {
 		imageExistsFunc: func(ctx context.Context, imageName string) (bool, error) {
 			return true, nil
 		},
+		// Default: no image metadata recorded
+		getImageMetadataFunc: func(ctx context.Context, imageName string) (*storage.ImageMetadata, error) {
+			return &storage.ImageMetadata{}, nil
+		},
+		// Default: the fingerprint is derived from the image name
+		imageFingerprintFunc: func(ctx context.Context, imageName string) (string, error) {
+			return "sha256:" + imageName, nil
+		},
+		// Default: upload reads the data and succeeds
+		uploadVolumeFunc: func(ctx context.Context, poolName, volumeName string, r io.Reader, length uint64) error {
+			_, err := io.Copy(io.Discard, r)
+			return err
+		},
+		// Default: refresh succeeds
+		refreshPoolFunc: func(ctx context.Context, name string) error {
+			return nil
+		},
 		// Default: write succeeds
 		writeVolumeDataFunc: func(ctx context.Context, poolName, volumeName string, data []byte) error {
 			return nil
@@ -289,6 +693,10 @@ func newMockStorageManager() *mockStorageManager {
 		listVolumesFunc: func(ctx context.Context, poolName string) ([]storage.VolumeInfo, error) {
 			return []storage.VolumeInfo{}, nil
 		},
+		// Default: pools are running with 1 TiB free
+		getPoolInfoFunc: func(ctx context.Context, name string) (*storage.PoolInfo, error) {
+			return &storage.PoolInfo{Name: name, State: "running", Capacity: 2 << 40, Available: 1 << 40}, nil
+		},
 	}
 }
 
@@ -313,6 +721,33 @@ func (m *mockStorageManager) CreateVolume(ctx context.Context, poolName string,
 	return m.createVolumeFunc(ctx, poolName, spec)
 }
 
+func (m *mockStorageManager) CloneVolume(ctx context.Context, poolName string, spec storage.VolumeSpec, sourcePool, sourceName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cloneVolumeCalls = append(m.cloneVolumeCalls, sourcePool+"/"+sourceName+" -> "+poolName+"/"+spec.Name)
+	return m.cloneVolumeFunc(ctx, poolName, spec, sourcePool, sourceName)
+}
+
+func (m *mockStorageManager) FlattenVolume(ctx context.Context, poolName, volumeName string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.flattenVolumeCalls = append(m.flattenVolumeCalls, poolName+"/"+volumeName)
+	return m.flattenVolumeFunc(ctx, poolName, volumeName)
+}
+
+func (m *mockStorageManager) ExportVolume(ctx context.Context, poolName, volumeName string, w io.Writer) error {
+	m.mu.Lock()
+	m.exportVolumeCalls = append(m.exportVolumeCalls, poolName+"/"+volumeName)
+	m.mu.Unlock()
+	return m.exportVolumeFunc(ctx, poolName, volumeName, w)
+}
+
+func (m *mockStorageManager) GetVolumeInfoByPath(ctx context.Context, path string) (*storage.VolumeInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.getVolumeInfoByPathFunc(ctx, path)
+}
+
 func (m *mockStorageManager) DeleteVolume(ctx context.Context, poolName, volumeName string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -320,6 +755,20 @@ func (m *mockStorageManager) DeleteVolume(ctx context.Context, poolName, volumeN
 	return m.deleteVolumeFunc(ctx, poolName, volumeName)
 }
 
+func (m *mockStorageManager) ResizeVolume(ctx context.Context, poolName, volumeName string, capacityGB uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resizeVolumeCalls = append(m.resizeVolumeCalls, poolName+"/"+volumeName)
+	return m.resizeVolumeFunc(ctx, poolName, volumeName, capacityGB)
+}
+
+func (m *mockStorageManager) GetVolumePath(ctx context.Context, poolName, volumeName string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.getVolumePathCalls = append(m.getVolumePathCalls, poolName+"/"+volumeName)
+	return m.getVolumePathFunc(ctx, poolName, volumeName)
+}
+
 func (m *mockStorageManager) GetImagePath(ctx context.Context, imageName string) (string, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -334,6 +783,32 @@ func (m *mockStorageManager) ImageExists(ctx context.Context, imageName string)
 	return m.imageExistsFunc(ctx, imageName)
 }
 
+func (m *mockStorageManager) GetImageMetadata(ctx context.Context, imageName string) (*storage.ImageMetadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.getImageMetadataFunc(ctx, imageName)
+}
+
+func (m *mockStorageManager) ImageFingerprint(ctx context.Context, imageName string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.imageFingerprintFunc(ctx, imageName)
+}
+
+func (m *mockStorageManager) UploadVolume(ctx context.Context, poolName, volumeName string, r io.Reader, length uint64) error {
+	m.mu.Lock()
+	m.uploadVolumeCalls = append(m.uploadVolumeCalls, poolName+"/"+volumeName)
+	m.mu.Unlock()
+	return m.uploadVolumeFunc(ctx, poolName, volumeName, r, length)
+}
+
+func (m *mockStorageManager) RefreshPool(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refreshPoolCalls = append(m.refreshPoolCalls, name)
+	return m.refreshPoolFunc(ctx, name)
+}
+
 func (m *mockStorageManager) WriteVolumeData(ctx context.Context, poolName, volumeName string, data []byte) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -348,8 +823,54 @@ func (m *mockStorageManager) ListVolumes(ctx context.Context, poolName string) (
 	return m.listVolumesFunc(ctx, poolName)
 }
 
+func (m *mockStorageManager) GetPoolInfo(ctx context.Context, name string) (*storage.PoolInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.getPoolInfoFunc(ctx, name)
+}
+
 // newMockMetadataClient creates a mock metadata.Client for testing.
 // Uses metadata.NewClient with our mock which implements metadata.LibvirtClient.
 func newMockMetadataClient(lv *mockLibvirtClient) *metadata.Client {
 	return metadata.NewClient(lv)
 }
+
+// mockHostLinks is a mock implementation of the hostLinks interface for testing.
+type mockHostLinks struct {
+	mu sync.Mutex
+
+	// links holds the interfaces that currently exist on the "host"
+	links map[string]bool
+
+	// deleteLinkErr is returned by DeleteLink when set
+	deleteLinkErr error
+
+	// Call tracking
+	deleteLinkCalls []string
+}
+
+// newMockHostLinks creates a mock host with the given interfaces present.
+func newMockHostLinks(names ...string) *mockHostLinks {
+	m := &mockHostLinks{links: make(map[string]bool)}
+	for _, name := range names {
+		m.links[name] = true
+	}
+	return m
+}
+
+func (m *mockHostLinks) LinkExists(name string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.links[name], nil
+}
+
+func (m *mockHostLinks) DeleteLink(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteLinkCalls = append(m.deleteLinkCalls, name)
+	if m.deleteLinkErr != nil {
+		return m.deleteLinkErr
+	}
+	delete(m.links, name)
+	return nil
+}
@@ -0,0 +1,404 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/digitalocean/go-libvirt"
+	"go.yaml.in/yaml/v3"
+	"libvirt.org/go/libvirtxml"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/cloudinit"
+	"github.com/jbweber/foundry/internal/host"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/loader"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/naming"
+	"github.com/jbweber/foundry/internal/status"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// AttachedNIC identifies a network interface added by AttachNIC.
+type AttachedNIC struct {
+	// MACAddress is the interface's MAC address.
+	MACAddress string
+
+	// InterfaceName is the host tap interface name.
+	InterfaceName string
+}
+
+// AttachNIC adds a network interface to a VM.
+//
+// The interface is validated like a spec.networkInterfaces entry; its MAC
+// address and tap name are derived from its IP (or generated for DHCP). It is
+// added to the VM's persistent definition, and hotplugged into a running VM.
+// The interface is added to the stored spec, its generation bumped, and the
+// cloud-init network-config rewritten so the guest configures it on boot.
+func AttachNIC(ctx context.Context, vmName string, iface v1alpha1.NetworkInterfaceSpec) (*AttachedNIC, error) {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	return attachNICWithDeps(ctx, vmName, iface, LibvirtClient.Libvirt(), storageMgr, metaClient)
+}
+
+// attachNICWithDeps attaches a network interface with injected dependencies.
+// This allows for testing by accepting interfaces instead of concrete types.
+func attachNICWithDeps(ctx context.Context, vmName string, iface v1alpha1.NetworkInterfaceSpec, lv LibvirtClient, sm storageManager, mc *metadata.Client) (*AttachedNIC, error) {
+	logger := logging.FromContext(ctx)
+
+	// Step 1: Look up the domain and its stored spec
+	domain, err := lv.DomainLookupByName(vmName)
+	if err != nil {
+		return nil, fmt.Errorf("VM '%s' not found: %w", vmName, err)
+	}
+
+	vm, err := mc.Load(domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", vmName, err)
+	}
+
+	// Step 2: Add the interface to the spec and validate it like a config
+	if err := assignMACAddress(namingStrategy(vm), &iface); err != nil {
+		return nil, err
+	}
+	vm.Spec.NetworkInterfaces = append(vm.Spec.NetworkInterfaces, iface)
+	if err := validateUpdatedSpec(ctx, vm); err != nil {
+		return nil, err
+	}
+	if err := resolveVFAddress(lv, &vm.Spec.NetworkInterfaces[len(vm.Spec.NetworkInterfaces)-1]); err != nil {
+		return nil, err
+	}
+
+	mac, err := naming.InterfaceMAC(iface.IP, iface.IPv6, iface.MACAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate MAC address: %w", err)
+	}
+	ifaceName, err := naming.InterfaceNameWithStrategy(namingStrategy(vm).InterfaceName, iface.IP, iface.IPv6, iface.MACAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate interface name: %w", err)
+	}
+	if _, err := findDomainInterface(lv, domain, mac); err == nil {
+		return nil, fmt.Errorf("VM '%s' already has an interface with MAC address %s", vmName, mac)
+	}
+
+	// Step 3: Generate the interface XML the way a create would
+	ifaceXML, err := generatedInterfaceXML(vm, mac)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 4: Attach it to the definition, and to the guest if it is running
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VM state: %w", err)
+	}
+	flags := libvirt.DomainAffectConfig
+	if state == domainStateRunning {
+		flags |= libvirt.DomainAffectLive
+	}
+	logger.Info("Attaching network interface", "vm", vmName, "interface", ifaceName, "mac", mac)
+	if err := lv.DomainAttachDeviceFlags(domain, ifaceXML, uint32(flags)); err != nil {
+		return nil, fmt.Errorf("failed to attach network interface: %w", err)
+	}
+
+	// Step 5: Record the interface in the stored spec and cloud-init
+	if err := storeNICChange(ctx, domain, vm, sm, mc); err != nil {
+		return nil, fmt.Errorf("network interface attached but %w", err)
+	}
+
+	warnLinuxBridgeVLAN(ctx, vm, &iface)
+
+	logger.Info("Network interface attached", "vm", vmName, "interface", ifaceName)
+	return &AttachedNIC{MACAddress: mac, InterfaceName: ifaceName}, nil
+}
+
+// DetachNIC removes a network interface from a VM. The interface is
+// identified by its IP address (with or without prefix length), MAC address
+// or tap interface name.
+//
+// The interface is removed from the VM's persistent definition and unplugged
+// from a running VM. It is removed from the stored spec, its generation
+// bumped, and the cloud-init network-config rewritten. A VM's last interface
+// cannot be detached.
+func DetachNIC(ctx context.Context, vmName, id string) error {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	return detachNICWithDeps(ctx, vmName, id, LibvirtClient.Libvirt(), storageMgr, metaClient)
+}
+
+// detachNICWithDeps detaches a network interface with injected dependencies.
+// This allows for testing by accepting interfaces instead of concrete types.
+func detachNICWithDeps(ctx context.Context, vmName, id string, lv LibvirtClient, sm storageManager, mc *metadata.Client) error {
+	logger := logging.FromContext(ctx)
+
+	// Step 1: Look up the domain and its stored spec
+	domain, err := lv.DomainLookupByName(vmName)
+	if err != nil {
+		return fmt.Errorf("VM '%s' not found: %w", vmName, err)
+	}
+
+	vm, err := mc.Load(domain)
+	if err != nil {
+		return fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", vmName, err)
+	}
+
+	index, mac, err := findSpecInterface(vm, id)
+	if err != nil {
+		return err
+	}
+	if len(vm.Spec.NetworkInterfaces) == 1 {
+		return fmt.Errorf("cannot detach the only network interface of VM '%s'", vmName)
+	}
+
+	// Step 2: Detach it from the definition, and from the guest if it is running
+	iface, err := findDomainInterface(lv, domain, mac)
+	if err != nil {
+		logger.Info("Interface is not attached, only removing it from the spec", "vm", vmName, "mac", mac)
+	} else {
+		ifaceXML, err := iface.Marshal()
+		if err != nil {
+			return fmt.Errorf("failed to marshal interface XML: %w", err)
+		}
+		state, _, err := lv.DomainGetState(domain, 0)
+		if err != nil {
+			return fmt.Errorf("failed to get VM state: %w", err)
+		}
+		flags := libvirt.DomainAffectConfig
+		if state == domainStateRunning {
+			flags |= libvirt.DomainAffectLive
+		}
+		logger.Info("Detaching network interface", "vm", vmName, "mac", mac)
+		if err := lv.DomainDetachDeviceFlags(domain, ifaceXML, uint32(flags)); err != nil {
+			return fmt.Errorf("failed to detach network interface %s: %w", mac, err)
+		}
+	}
+
+	// Step 3: Remove the interface from the stored spec and cloud-init
+	vm.Spec.NetworkInterfaces = append(vm.Spec.NetworkInterfaces[:index], vm.Spec.NetworkInterfaces[index+1:]...)
+	if err := storeNICChange(ctx, domain, vm, sm, mc); err != nil {
+		return fmt.Errorf("network interface detached but %w", err)
+	}
+
+	logger.Info("Network interface detached", "vm", vmName, "mac", mac)
+	return nil
+}
+
+// storeNICChange records a changed set of network interfaces: the stored
+// spec is updated and its generation bumped, and the cloud-init ISO is
+// rewritten with the new network-config.
+func storeNICChange(ctx context.Context, domain libvirt.Domain, vm *v1alpha1.VirtualMachine, sm storageManager, mc *metadata.Client) error {
+	vm.Generation++
+	vm.UpdateObservedGeneration()
+	status.SetCondition(vm, v1alpha1.ConditionNetworkConfigured, v1alpha1.ConditionTrue, "InterfacesChanged",
+		fmt.Sprintf("%d network interface(s) configured", len(vm.Spec.NetworkInterfaces)))
+
+	// The seed server always serves the current spec
+	if !vm.HasCloudInitISO() {
+		if err := mc.Store(domain, vm); err != nil {
+			return fmt.Errorf("failed to update stored spec: %w", err)
+		}
+		return nil
+	}
+
+	logging.FromContext(ctx).Info("Regenerating cloud-init ISO", "vm", vm.Name)
+	isoErr := writeCloudInitISO(ctx, vm, sm)
+	if isoErr != nil {
+		status.MarkCloudInitFailed(vm, isoErr)
+	} else {
+		status.SetCondition(vm, v1alpha1.ConditionCloudInitReady, v1alpha1.ConditionTrue, "CloudInitRegenerated", "Cloud-init ISO rewritten with the new network-config")
+	}
+	if err := mc.Store(domain, vm); err != nil {
+		return fmt.Errorf("failed to update stored spec: %w", err)
+	}
+	return isoErr
+}
+
+// writeCloudInitISO rewrites the cloud-init ISO volume of vm from its spec.
+func writeCloudInitISO(ctx context.Context, vm *v1alpha1.VirtualMachine, sm storageManager) error {
+	isoData, err := cloudinit.GenerateISO(vm)
+	if err != nil {
+		return fmt.Errorf("failed to generate cloud-init ISO: %w", err)
+	}
+	if err := sm.WriteVolumeData(ctx, getStoragePool(vm), getCloudInitVolumeName(vm), isoData); err != nil {
+		return fmt.Errorf("failed to write cloud-init data: %w", err)
+	}
+	return nil
+}
+
+// validateUpdatedSpec validates a changed stored spec like a config file.
+func validateUpdatedSpec(ctx context.Context, vm *v1alpha1.VirtualMachine) error {
+	check := vm.DeepCopy()
+	check.Status = v1alpha1.VirtualMachineStatus{}
+	v1alpha1.SetDefaultAPIVersion(check)
+
+	data, err := yaml.Marshal(check)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spec: %w", err)
+	}
+	if _, err := loader.LoadFromYAML(ctx, data); err != nil {
+		return fmt.Errorf("invalid spec: %w", err)
+	}
+	return nil
+}
+
+// findSpecInterface finds the network interface identified by id, an IP
+// address, MAC address or tap interface name, in the VM spec. It returns the
+// interface's index and MAC address.
+func findSpecInterface(vm *v1alpha1.VirtualMachine, id string) (int, string, error) {
+	for i, iface := range vm.Spec.NetworkInterfaces {
+		mac, err := naming.InterfaceMAC(iface.IP, iface.IPv6, iface.MACAddress)
+		if err != nil {
+			return 0, "", fmt.Errorf("failed to calculate MAC address for interface %d: %w", i, err)
+		}
+		name, _ := naming.InterfaceNameWithStrategy(namingStrategy(vm).InterfaceName, iface.IP, iface.IPv6, iface.MACAddress)
+
+		if strings.EqualFold(id, mac) || id == name || sameIP(id, iface.IP) || sameIP(id, iface.IPv6) {
+			return i, mac, nil
+		}
+	}
+	return 0, "", fmt.Errorf("no network interface %q in VM '%s' spec (use its IP, MAC address or interface name)", id, vm.Name)
+}
+
+// sameIP reports whether id is the address of cidr, with or without its
+// prefix length.
+func sameIP(id, cidr string) bool {
+	if cidr == "" {
+		return false
+	}
+	ip, _, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	if idIP, _, err := net.ParseCIDR(id); err == nil {
+		return idIP.Equal(ip)
+	}
+	idIP := net.ParseIP(id)
+	return idIP != nil && idIP.Equal(ip)
+}
+
+// resolveVFAddresses records the PCI addresses of the SR-IOV VFs of a new
+// VM's interfaces, so the VM keeps its VFs for its lifetime.
+func resolveVFAddresses(vm *v1alpha1.VirtualMachine, lv LibvirtClient) error {
+	for i := range vm.Spec.NetworkInterfaces {
+		if err := resolveVFAddress(lv, &vm.Spec.NetworkInterfaces[i]); err != nil {
+			return fmt.Errorf("spec.networkInterfaces[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// resolveVFAddress records the PCI address of the SR-IOV VF of an interface
+// that does not configure one.
+func resolveVFAddress(lv LibvirtClient, iface *v1alpha1.NetworkInterfaceSpec) error {
+	if iface.SRIOV == nil || iface.SRIOV.PCIAddress != "" {
+		return nil
+	}
+	address, err := host.VFAddress(lv, iface.SRIOV.PF, iface.SRIOV.VF)
+	if err != nil {
+		return fmt.Errorf("failed to find VF %d of %s: %w", iface.SRIOV.VF, iface.SRIOV.PF, err)
+	}
+	iface.SRIOV.PCIAddress = address
+	return nil
+}
+
+// warnLinuxBridgeVLAN tells how to put an interface on a Linux bridge in its
+// VLAN: libvirt only tags the traffic of openvswitch bridges, so the bridge
+// needs VLAN filtering and the interface's tap device a VLAN membership,
+// which is lost whenever the VM stops.
+func warnLinuxBridgeVLAN(ctx context.Context, vm *v1alpha1.VirtualMachine, iface *v1alpha1.NetworkInterfaceSpec) {
+	if iface.VLAN == 0 || iface.Bridge == "" || iface.GetBridgeType() != v1alpha1.BridgeTypeLinux {
+		return
+	}
+	tap, err := naming.InterfaceNameWithStrategy(namingStrategy(vm).InterfaceName, iface.IP, iface.IPv6, iface.MACAddress)
+	if err != nil {
+		return
+	}
+	logging.FromContext(ctx).Warn("VLAN is not applied on Linux bridges; set up VLAN filtering on the host each time the VM starts",
+		"vm", vm.Name, "bridge", iface.Bridge, "vlan", iface.VLAN,
+		"commands", fmt.Sprintf("ip link set %s type bridge vlan_filtering 1; bridge vlan add dev %s vid %d pvid untagged",
+			iface.Bridge, tap, iface.VLAN))
+}
+
+// generatedInterfaceXML returns the XML foundry generates for the interface
+// with MAC address mac of vm.
+func generatedInterfaceXML(vm *v1alpha1.VirtualMachine, mac string) (string, error) {
+	domainXML, err := foundrylibvirt.GenerateDomainXML(vm)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate domain XML: %w", err)
+	}
+
+	var domainDef libvirtxml.Domain
+	if err := domainDef.Unmarshal(domainXML); err != nil {
+		return "", fmt.Errorf("failed to parse generated domain XML: %w", err)
+	}
+	if iface := domainInterface(&domainDef, mac); iface != nil {
+		return iface.Marshal()
+	}
+	return "", fmt.Errorf("interface %s not found in domain definition", mac)
+}
+
+// findDomainInterface returns the interface with MAC address mac of the
+// running domain (or its definition if it is stopped).
+func findDomainInterface(lv LibvirtClient, domain libvirt.Domain, mac string) (*libvirtxml.DomainInterface, error) {
+	xmlDesc, err := lv.DomainGetXMLDesc(domain, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain XML: %w", err)
+	}
+
+	var domainDef libvirtxml.Domain
+	if err := domainDef.Unmarshal(xmlDesc); err != nil {
+		return nil, fmt.Errorf("failed to parse domain XML: %w", err)
+	}
+	if iface := domainInterface(&domainDef, mac); iface != nil {
+		return iface, nil
+	}
+	return nil, fmt.Errorf("interface %s not found on VM '%s'", mac, domain.Name)
+}
+
+// domainInterface returns the interface with MAC address mac of a domain
+// definition, or nil.
+func domainInterface(domainDef *libvirtxml.Domain, mac string) *libvirtxml.DomainInterface {
+	if domainDef.Devices == nil {
+		return nil
+	}
+	for i := range domainDef.Devices.Interfaces {
+		iface := &domainDef.Devices.Interfaces[i]
+		if iface.MAC != nil && strings.EqualFold(iface.MAC.Address, mac) {
+			return iface
+		}
+	}
+	return nil
+}
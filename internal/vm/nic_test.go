@@ -0,0 +1,237 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/naming"
+	"github.com/jbweber/foundry/internal/status"
+)
+
+// twoNICConfig returns a VM config with cloud-init and a second interface.
+func twoNICConfig() *v1alpha1.VirtualMachine {
+	vm := testVMConfigWithCloudInit()
+	vm.Spec.NetworkInterfaces = append(vm.Spec.NetworkInterfaces, v1alpha1.NetworkInterfaceSpec{
+		Bridge:  "br1",
+		IP:      "10.1.0.20/24",
+		Gateway: "10.1.0.1",
+	})
+	return vm
+}
+
+func TestAttachNICWithDeps_Running(t *testing.T) {
+	stored := testVMConfigWithCloudInit()
+	stored.Generation = 1
+	lv, sm := newApplyMocks(t, stored)
+
+	var attachFlags uint32
+	lv.domainAttachDeviceFunc = func(dom libvirt.Domain, xml string, flags uint32) error {
+		attachFlags = flags
+		return nil
+	}
+
+	iface := v1alpha1.NetworkInterfaceSpec{Bridge: "br1", IP: "10.1.0.20/24", Gateway: "10.1.0.1"}
+	nic, err := attachNICWithDeps(context.Background(), "test-vm", iface, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("attachNICWithDeps() error = %v", err)
+	}
+
+	wantMAC, _ := naming.MACFromIP("10.1.0.20/24")
+	wantName, _ := naming.InterfaceNameFromIP("10.1.0.20/24")
+	if nic.MACAddress != wantMAC || nic.InterfaceName != wantName {
+		t.Errorf("attached NIC = %+v, want %s/%s", nic, wantMAC, wantName)
+	}
+	if len(lv.domainAttachDeviceCalls) != 1 {
+		t.Fatalf("attach calls = %d, want 1", len(lv.domainAttachDeviceCalls))
+	}
+	for _, want := range []string{wantMAC, wantName, `bridge="br1"`, `type="virtio"`} {
+		if !strings.Contains(lv.domainAttachDeviceCalls[0], want) {
+			t.Errorf("attached XML missing %q:\n%s", want, lv.domainAttachDeviceCalls[0])
+		}
+	}
+	if want := uint32(libvirt.DomainAffectConfig | libvirt.DomainAffectLive); attachFlags != want {
+		t.Errorf("attach flags = %d, want config+live (%d)", attachFlags, want)
+	}
+
+	loaded, err := newMockMetadataClient(lv).Load(libvirt.Domain{Name: "test-vm"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(loaded.Spec.NetworkInterfaces) != 2 || loaded.Spec.NetworkInterfaces[1].IP != "10.1.0.20/24" {
+		t.Errorf("stored interfaces = %+v, want the new interface appended", loaded.Spec.NetworkInterfaces)
+	}
+	if loaded.Generation != 2 {
+		t.Errorf("stored generation = %d, want 2", loaded.Generation)
+	}
+
+	wantISO := "foundry-vms/" + getCloudInitVolumeName(stored)
+	if len(sm.writeVolumeDataCalls) != 1 || sm.writeVolumeDataCalls[0] != wantISO {
+		t.Errorf("written volumes = %v, want the cloud-init ISO %s", sm.writeVolumeDataCalls, wantISO)
+	}
+	for _, cond := range []string{v1alpha1.ConditionNetworkConfigured, v1alpha1.ConditionCloudInitReady} {
+		if !status.IsConditionTrue(loaded, cond) {
+			t.Errorf("condition %s = %+v, want True", cond, status.GetCondition(loaded, cond))
+		}
+	}
+}
+
+func TestAttachNICWithDeps_StoppedOnlyChangesConfig(t *testing.T) {
+	lv, sm := newApplyMocks(t, testVMConfig())
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateShutoff, 0, nil
+	}
+	var attachFlags uint32
+	lv.domainAttachDeviceFunc = func(dom libvirt.Domain, xml string, flags uint32) error {
+		attachFlags = flags
+		return nil
+	}
+
+	iface := v1alpha1.NetworkInterfaceSpec{Network: "default", DHCP: true}
+	nic, err := attachNICWithDeps(context.Background(), "test-vm", iface, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("attachNICWithDeps() error = %v", err)
+	}
+	if attachFlags != uint32(libvirt.DomainAffectConfig) {
+		t.Errorf("attach flags = %d, want config only", attachFlags)
+	}
+	if nic.MACAddress == "" {
+		t.Error("DHCP interface got no MAC address")
+	}
+	// Without cloud-init there is no ISO to rewrite
+	if len(sm.writeVolumeDataCalls) != 0 {
+		t.Errorf("written volumes = %v, want none", sm.writeVolumeDataCalls)
+	}
+
+	loaded, err := newMockMetadataClient(lv).Load(libvirt.Domain{Name: "test-vm"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := loaded.Spec.NetworkInterfaces[1].MACAddress; got != nic.MACAddress {
+		t.Errorf("stored MAC = %q, want the generated %q", got, nic.MACAddress)
+	}
+}
+
+func TestAttachNICWithDeps_VLAN(t *testing.T) {
+	lv, sm := newApplyMocks(t, testVMConfigWithCloudInit())
+	var logs bytes.Buffer
+	ctx := logging.NewContext(context.Background(), slog.New(slog.NewTextHandler(&logs, nil)))
+
+	// openvswitch bridges tag the traffic
+	iface := v1alpha1.NetworkInterfaceSpec{Bridge: "ovsbr0", BridgeType: "openvswitch", VLAN: 100, IP: "10.1.0.20/24", Gateway: "10.1.0.1"}
+	if _, err := attachNICWithDeps(ctx, "test-vm", iface, lv, sm, newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("attachNICWithDeps() error = %v", err)
+	}
+	for _, want := range []string{`<tag id="100">`, `<virtualport type="openvswitch">`} {
+		if !strings.Contains(lv.domainAttachDeviceCalls[0], want) {
+			t.Errorf("attached XML missing %q:\n%s", want, lv.domainAttachDeviceCalls[0])
+		}
+	}
+	if strings.Contains(logs.String(), "vlan_filtering") {
+		t.Errorf("unexpected VLAN filtering guidance for an openvswitch bridge: %s", logs.String())
+	}
+
+	// Linux bridges are left to the host, with instructions
+	iface = v1alpha1.NetworkInterfaceSpec{Bridge: "br1", VLAN: 200, IP: "10.2.0.20/24", Gateway: "10.2.0.1"}
+	if _, err := attachNICWithDeps(ctx, "test-vm", iface, lv, sm, newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("attachNICWithDeps() error = %v", err)
+	}
+	if strings.Contains(lv.domainAttachDeviceCalls[1], "<vlan>") {
+		t.Errorf("attached XML tags a Linux bridge interface:\n%s", lv.domainAttachDeviceCalls[1])
+	}
+	tap, _ := naming.InterfaceNameFromIP("10.2.0.20/24")
+	if want := fmt.Sprintf("bridge vlan add dev %s vid 200 pvid untagged", tap); !strings.Contains(logs.String(), want) {
+		t.Errorf("logs = %s, want guidance containing %q", logs.String(), want)
+	}
+}
+
+func TestAttachNICWithDeps_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		iface   v1alpha1.NetworkInterfaceSpec
+		wantErr string
+	}{
+		{"missing gateway", v1alpha1.NetworkInterfaceSpec{Bridge: "br1", IP: "10.1.0.20/24"}, "gateway is required"},
+		{"duplicate IP", v1alpha1.NetworkInterfaceSpec{Bridge: "br1", IP: "10.0.0.10/24", Gateway: "10.0.0.1"}, "duplicated"},
+		{"no bridge or network", v1alpha1.NetworkInterfaceSpec{IP: "10.1.0.20/24", Gateway: "10.1.0.1"}, "one of bridge, network, macvtap or sriov"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lv, sm := newApplyMocks(t, testVMConfig())
+
+			_, err := attachNICWithDeps(context.Background(), "test-vm", tt.iface, lv, sm, newMockMetadataClient(lv))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			if len(lv.domainAttachDeviceCalls) != 0 || len(lv.domainSetMetadataCalls) != 0 {
+				t.Error("invalid interface was attached or stored")
+			}
+		})
+	}
+}
+
+func TestDetachNICWithDeps(t *testing.T) {
+	stored := twoNICConfig()
+	mac, _ := naming.MACFromIP("10.1.0.20/24")
+
+	for _, id := range []string{"10.1.0.20", "10.1.0.20/24", strings.ToUpper(mac), "vm0a010014"} {
+		t.Run(id, func(t *testing.T) {
+			lv, sm := newApplyMocks(t, stored)
+			lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+				return fmt.Sprintf(`<domain type="kvm"><name>test-vm</name><devices><interface type="bridge"><mac address="%s"/><source bridge="br1"/></interface></devices></domain>`, mac), nil
+			}
+
+			if err := detachNICWithDeps(context.Background(), "test-vm", id, lv, sm, newMockMetadataClient(lv)); err != nil {
+				t.Fatalf("detachNICWithDeps() error = %v", err)
+			}
+			if len(lv.domainDetachDeviceCalls) != 1 || !strings.Contains(lv.domainDetachDeviceCalls[0], mac) {
+				t.Errorf("detached XML = %v, want the interface with %s", lv.domainDetachDeviceCalls, mac)
+			}
+
+			loaded, err := newMockMetadataClient(lv).Load(libvirt.Domain{Name: "test-vm"})
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if len(loaded.Spec.NetworkInterfaces) != 1 || loaded.Spec.NetworkInterfaces[0].IP != "10.0.0.10/24" {
+				t.Errorf("stored interfaces = %+v, want only the first", loaded.Spec.NetworkInterfaces)
+			}
+			if len(sm.writeVolumeDataCalls) != 1 {
+				t.Errorf("written volumes = %v, want the cloud-init ISO", sm.writeVolumeDataCalls)
+			}
+		})
+	}
+}
+
+func TestDetachNICWithDeps_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		stored  *v1alpha1.VirtualMachine
+		id      string
+		wantErr string
+	}{
+		{"unknown interface", twoNICConfig(), "10.9.9.9", "no network interface"},
+		{"last interface", testVMConfig(), "10.0.0.10", "only network interface"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lv, sm := newApplyMocks(t, tt.stored)
+
+			err := detachNICWithDeps(context.Background(), "test-vm", tt.id, lv, sm, newMockMetadataClient(lv))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			if len(lv.domainDetachDeviceCalls) != 0 {
+				t.Error("interface was detached")
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/cloudinit"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/loader"
+	"github.com/jbweber/foundry/internal/naming"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// CreatePlan describes the artifacts Create would generate for a
+// configuration.
+type CreatePlan struct {
+	// VMName is the name the VM would get. When the configuration uses
+	// metadata.generateName this is an example; Create generates its own
+	// name and checks it for collisions.
+	VMName string
+
+	// DomainXML is the libvirt domain definition.
+	DomainXML string
+
+	// UserData, MetaData and NetworkConfig are the cloud-init files written
+	// to the cloud-init ISO, in the format of its datasource (meta_data.json
+	// and network_data.json for a config drive). They are empty if cloud-init
+	// is not configured.
+	UserData      string
+	MetaData      string
+	NetworkConfig string
+
+	// Volumes are the storage volumes that would be created, in order.
+	Volumes []PlannedVolume
+}
+
+// PlannedVolume is a storage volume that Create would create.
+type PlannedVolume struct {
+	// Pool is the storage pool the volume would be created in.
+	Pool string
+
+	// Spec is the volume specification. For boot disks backed by a pool
+	// image, BackingVolume (or SourceVolume, for raw boot disks) holds the
+	// image reference ("pool:image") rather than a path, since resolving it
+	// requires libvirt.
+	Spec storage.VolumeSpec
+}
+
+// Plan loads and validates a YAML configuration file and returns what Create
+// would generate for it, without connecting to libvirt.
+func Plan(ctx context.Context, configPath string) (*CreatePlan, error) {
+	vm, err := loader.LoadFromFile(ctx, configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	return PlanFromConfig(vm)
+}
+
+// PlanFromConfig returns what Create would generate for an already-loaded
+// configuration. See Plan().
+//
+// The configuration is not modified.
+func PlanFromConfig(config *v1alpha1.VirtualMachine) (*CreatePlan, error) {
+	vm := config.DeepCopy()
+	if vm.Name == "" && vm.GenerateName != "" {
+		vm.Name = naming.GenerateName(vm.GenerateName)
+	}
+	if err := assignMACAddresses(vm); err != nil {
+		return nil, err
+	}
+
+	plan := &CreatePlan{VMName: vm.Name}
+	pool := getStoragePool(vm)
+
+	// Boot disk, backed by the configured image if any
+	bootSpec := storage.VolumeSpec{
+		Name:       getBootVolumeName(vm),
+		Type:       storage.VolumeTypeBoot,
+		Format:     getDiskFormat(vm),
+		CapacityGB: uint64(vm.Spec.BootDisk.SizeGB),
+	}
+	if vm.Spec.BootDisk.Image != "" && !vm.Spec.BootDisk.Empty {
+		imagePool, imageName, isFilePath, err := parseImageReference(vm.Spec.BootDisk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse image reference: %w", err)
+		}
+		image := imagePool + ":" + imageName
+		if isFilePath {
+			image = vm.Spec.BootDisk.Image
+		}
+		if bootSpec.Format == storage.VolumeFormatRaw {
+			bootSpec.SourceVolume = image
+		} else {
+			bootSpec.BackingVolume = image
+		}
+	}
+	plan.Volumes = append(plan.Volumes, PlannedVolume{Pool: pool, Spec: bootSpec})
+
+	for _, dataDisk := range vm.Spec.DataDisks {
+		plan.Volumes = append(plan.Volumes, PlannedVolume{Pool: pool, Spec: storage.VolumeSpec{
+			Name:       getDataVolumeName(vm, dataDisk.Device),
+			Type:       storage.VolumeTypeData,
+			Format:     getDiskFormat(vm),
+			CapacityGB: uint64(dataDisk.SizeGB),
+		}})
+	}
+
+	if vm.Spec.CloudInit != nil {
+		var err error
+		if plan.UserData, err = cloudinit.GenerateUserData(vm); err != nil {
+			return nil, fmt.Errorf("failed to generate user-data: %w", err)
+		}
+		if vm.GetCloudInitDatasource() == v1alpha1.CloudInitDatasourceConfigDrive {
+			if plan.MetaData, err = cloudinit.GenerateConfigDriveMetaData(vm); err != nil {
+				return nil, fmt.Errorf("failed to generate meta_data.json: %w", err)
+			}
+			if plan.NetworkConfig, err = cloudinit.GenerateConfigDriveNetworkData(vm); err != nil {
+				return nil, fmt.Errorf("failed to generate network_data.json: %w", err)
+			}
+		} else {
+			if plan.MetaData, err = cloudinit.GenerateMetaData(vm); err != nil {
+				return nil, fmt.Errorf("failed to generate meta-data: %w", err)
+			}
+			if plan.NetworkConfig, err = cloudinit.GenerateNetworkConfig(vm); err != nil {
+				return nil, fmt.Errorf("failed to generate network-config: %w", err)
+			}
+		}
+	}
+
+	if vm.HasCloudInitISO() {
+		isoData, err := cloudinit.GenerateISO(vm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate cloud-init ISO: %w", err)
+		}
+		plan.Volumes = append(plan.Volumes, PlannedVolume{Pool: pool, Spec: storage.VolumeSpec{
+			Name:       getCloudInitVolumeName(vm),
+			Type:       storage.VolumeTypeCloudInit,
+			Format:     storage.VolumeFormatRaw,
+			CapacityGB: cloudInitCapacityGB(len(isoData)),
+		}})
+	}
+
+	domainXML, err := foundrylibvirt.GenerateDomainXML(vm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate domain XML: %w", err)
+	}
+	plan.DomainXML = domainXML
+
+	return plan, nil
+}
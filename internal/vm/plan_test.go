@@ -0,0 +1,94 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+func TestPlanFromConfig(t *testing.T) {
+	vm := testVMConfigWithCloudInit()
+	vm.Spec.BootDisk.Empty = false
+	vm.Spec.BootDisk.Image = "fedora-43.qcow2"
+	vm.Spec.DataDisks = testVMConfigWithDataDisks().Spec.DataDisks
+
+	plan, err := PlanFromConfig(vm)
+	if err != nil {
+		t.Fatalf("PlanFromConfig() error = %v", err)
+	}
+
+	if plan.VMName != "test-vm" {
+		t.Errorf("VMName = %q, want test-vm", plan.VMName)
+	}
+
+	wantVolumes := []struct {
+		name    string
+		format  storage.VolumeFormat
+		size    uint64
+		backing string
+	}{
+		{"test-vm_boot.qcow2", storage.VolumeFormatQCOW2, 20, "foundry-images:fedora-43.qcow2"},
+		{"test-vm_data-vdb.qcow2", storage.VolumeFormatQCOW2, 50, ""},
+		{"test-vm_data-vdc.qcow2", storage.VolumeFormatQCOW2, 100, ""},
+		{"test-vm_cloudinit.iso", storage.VolumeFormatRaw, 1, ""},
+	}
+	if len(plan.Volumes) != len(wantVolumes) {
+		t.Fatalf("got %d volumes, want %d: %+v", len(plan.Volumes), len(wantVolumes), plan.Volumes)
+	}
+	for i, want := range wantVolumes {
+		got := plan.Volumes[i]
+		if got.Pool != "foundry-vms" || got.Spec.Name != want.name || got.Spec.Format != want.format ||
+			got.Spec.CapacityGB != want.size || got.Spec.BackingVolume != want.backing {
+			t.Errorf("volume %d = %+v, want %+v", i, got, want)
+		}
+	}
+
+	if !strings.Contains(plan.DomainXML, "<name>test-vm</name>") {
+		t.Errorf("DomainXML missing VM name:\n%s", plan.DomainXML)
+	}
+	if !strings.Contains(plan.UserData, "#cloud-config") {
+		t.Errorf("UserData = %q, want cloud-config", plan.UserData)
+	}
+	if !strings.Contains(plan.MetaData, "test-vm") {
+		t.Errorf("MetaData = %q, want instance metadata", plan.MetaData)
+	}
+	if !strings.Contains(plan.NetworkConfig, "10.0.0.10/24") {
+		t.Errorf("NetworkConfig = %q, want interface address", plan.NetworkConfig)
+	}
+}
+
+func TestPlanFromConfig_NoCloudInit(t *testing.T) {
+	plan, err := PlanFromConfig(testVMConfig())
+	if err != nil {
+		t.Fatalf("PlanFromConfig() error = %v", err)
+	}
+
+	if plan.UserData != "" || plan.MetaData != "" || plan.NetworkConfig != "" {
+		t.Error("expected no cloud-init files")
+	}
+	if len(plan.Volumes) != 1 || plan.Volumes[0].Spec.BackingVolume != "" {
+		t.Errorf("Volumes = %+v, want a single empty boot volume", plan.Volumes)
+	}
+}
+
+func TestPlanFromConfig_GenerateName(t *testing.T) {
+	vm := testVMConfig()
+	vm.Name = ""
+	vm.GenerateName = "ci-"
+
+	plan, err := PlanFromConfig(vm)
+	if err != nil {
+		t.Fatalf("PlanFromConfig() error = %v", err)
+	}
+
+	if !strings.HasPrefix(plan.VMName, "ci-") {
+		t.Errorf("VMName = %q, want ci- prefix", plan.VMName)
+	}
+	if plan.Volumes[0].Spec.Name != plan.VMName+"_boot.qcow2" {
+		t.Errorf("boot volume = %q, want it named after %q", plan.Volumes[0].Spec.Name, plan.VMName)
+	}
+	if vm.Name != "" {
+		t.Errorf("config was modified: Name = %q", vm.Name)
+	}
+}
@@ -0,0 +1,184 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/internal/history"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// DefaultStopTimeout is how long Stop waits for a VM to shut down gracefully
+// before forcing it off.
+const DefaultStopTimeout = 2 * time.Minute
+
+// StopOptions configures Stop.
+type StopOptions struct {
+	// Force powers the VM off immediately instead of asking the guest to
+	// shut down.
+	Force bool
+
+	// Timeout is how long the guest is given to shut down before it is
+	// forced off. Defaults to DefaultStopTimeout.
+	Timeout time.Duration
+}
+
+// IsNotFound reports whether err was caused by a VM that does not exist.
+func IsNotFound(err error) bool {
+	return libvirt.IsNotFound(err)
+}
+
+// Start starts a stopped VM. Starting a VM that is already running does
+// nothing. A VM whose boot image was moved or replaced since it was created
+// is not started.
+func Start(ctx context.Context, name string) error {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	return startWithDeps(ctx, name, LibvirtClient.Libvirt(), storageMgr, metaClient)
+}
+
+// startWithDeps starts a VM with injected dependencies.
+func startWithDeps(ctx context.Context, name string, lv LibvirtClient, sm storageManager, mc *metadata.Client) error {
+	logger := logging.FromContext(ctx)
+
+	domain, err := lv.DomainLookupByName(name)
+	if err != nil {
+		return fmt.Errorf("VM '%s' not found: %w", name, err)
+	}
+
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		return fmt.Errorf("failed to get VM state: %w", err)
+	}
+	if state == domainStateRunning {
+		return nil
+	}
+
+	// Domains foundry does not manage are started unchecked
+	if vm, err := mc.Load(domain); err == nil {
+		if err := verifyBootImage(ctx, vm, sm); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Starting VM", "vm", name)
+	if err := lv.DomainCreate(domain); err != nil {
+		return fmt.Errorf("failed to start VM '%s': %w", name, err)
+	}
+	recordStatus(ctx, lv, domain)
+	history.Record(ctx, name, history.TypeStarted, "")
+	return nil
+}
+
+// Stop shuts a VM down and waits until it is off. The guest is asked to shut
+// down and forced off if it is still running after opts.Timeout; with
+// opts.Force it is forced off right away. Stopping a VM that is not running
+// does nothing.
+func Stop(ctx context.Context, name string, opts StopOptions) error {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	return stopWithDeps(ctx, name, opts, shutdownPollInterval, LibvirtClient.Libvirt())
+}
+
+// stopWithDeps stops a VM with injected dependencies, checking its state
+// every poll.
+func stopWithDeps(ctx context.Context, name string, opts StopOptions, poll time.Duration, lv LibvirtClient) error {
+	logger := logging.FromContext(ctx)
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultStopTimeout
+	}
+
+	domain, err := lv.DomainLookupByName(name)
+	if err != nil {
+		return fmt.Errorf("VM '%s' not found: %w", name, err)
+	}
+
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		return fmt.Errorf("failed to get VM state: %w", err)
+	}
+	if state == domainStateShutoff || state == domainStateCrashed {
+		return nil
+	}
+
+	if !opts.Force {
+		logger.Info("Shutting down VM", "vm", name, "timeout", opts.Timeout)
+		if err := lv.DomainShutdown(domain); err != nil {
+			logger.Warn("Graceful shutdown failed, forcing VM off", "vm", name, "error", err)
+		} else if stopped, err := waitForShutoff(ctx, lv, domain, opts.Timeout, poll); err != nil {
+			return err
+		} else if stopped {
+			recordStatus(ctx, lv, domain)
+			history.Record(ctx, name, history.TypeStopped, "Shut down")
+			return nil
+		} else {
+			logger.Warn("VM did not shut down in time, forcing it off", "vm", name, "timeout", opts.Timeout)
+		}
+	}
+
+	if err := lv.DomainDestroy(domain); err != nil {
+		return fmt.Errorf("failed to force off VM '%s': %w", name, err)
+	}
+	recordStatus(ctx, lv, domain)
+	history.Record(ctx, name, history.TypeStopped, "Forced off")
+	return nil
+}
+
+// waitForShutoff waits up to timeout for domain to stop running and reports
+// whether it did.
+func waitForShutoff(ctx context.Context, lv LibvirtClient, domain libvirt.Domain, timeout, poll time.Duration) (bool, error) {
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	for {
+		state, _, err := lv.DomainGetState(domain, 0)
+		if err != nil {
+			return false, fmt.Errorf("failed to get VM state: %w", err)
+		}
+		if state == domainStateShutoff || state == domainStateCrashed {
+			return true, nil
+		}
+		if !time.Now().Before(deadline) {
+			return false, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+)
+
+// newPowerMock returns a libvirt mock holding the VM "test-vm" in state.
+func newPowerMock(state int32) *mockLibvirtClient {
+	lv := newMockLibvirtClient()
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		if name != "test-vm" {
+			return libvirt.Domain{}, libvirt.Error{Code: uint32(libvirt.ErrNoDomain), Message: "domain not found"}
+		}
+		return libvirt.Domain{Name: name}, nil
+	}
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return state, 0, nil
+	}
+	return lv
+}
+
+func TestStartWithDeps(t *testing.T) {
+	tests := []struct {
+		name        string
+		state       int32
+		wantStarted bool
+	}{
+		{name: "stopped", state: domainStateShutoff, wantStarted: true},
+		{name: "crashed", state: domainStateCrashed, wantStarted: true},
+		{name: "already running", state: domainStateRunning, wantStarted: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lv := newPowerMock(tt.state)
+			if err := startWithDeps(context.Background(), "test-vm", lv, newMockStorageManager(), newMockMetadataClient(lv)); err != nil {
+				t.Fatalf("startWithDeps() error = %v", err)
+			}
+			if started := len(lv.domainCreateCalls) == 1; started != tt.wantStarted {
+				t.Errorf("started = %v, want %v", started, tt.wantStarted)
+			}
+		})
+	}
+}
+
+func TestStartWithDeps_NotFound(t *testing.T) {
+	lv := newPowerMock(domainStateShutoff)
+	err := startWithDeps(context.Background(), "missing", lv, newMockStorageManager(), newMockMetadataClient(lv))
+	if !IsNotFound(err) {
+		t.Errorf("startWithDeps() error = %v, want not found", err)
+	}
+}
+
+func TestStopWithDeps_Graceful(t *testing.T) {
+	lv := newPowerMock(domainStateRunning)
+	shutdown := false
+	lv.domainShutdownFunc = func(dom libvirt.Domain) error {
+		shutdown = true
+		return nil
+	}
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		if shutdown {
+			return domainStateShutoff, 0, nil
+		}
+		return domainStateRunning, 0, nil
+	}
+
+	if err := stopWithDeps(context.Background(), "test-vm", StopOptions{}, time.Millisecond, lv); err != nil {
+		t.Fatalf("stopWithDeps() error = %v", err)
+	}
+	if len(lv.domainShutdownCalls) != 1 {
+		t.Error("expected a graceful shutdown")
+	}
+	if len(lv.domainDestroyCalls) != 0 {
+		t.Error("expected a VM that shut down not to be forced off")
+	}
+}
+
+func TestStopWithDeps_ForcesOffAfterTimeout(t *testing.T) {
+	lv := newPowerMock(domainStateRunning)
+
+	opts := StopOptions{Timeout: 5 * time.Millisecond}
+	if err := stopWithDeps(context.Background(), "test-vm", opts, time.Millisecond, lv); err != nil {
+		t.Fatalf("stopWithDeps() error = %v", err)
+	}
+	if len(lv.domainShutdownCalls) != 1 || len(lv.domainDestroyCalls) != 1 {
+		t.Errorf("shutdown calls = %d, destroy calls = %d, want 1 and 1", len(lv.domainShutdownCalls), len(lv.domainDestroyCalls))
+	}
+}
+
+func TestStopWithDeps_Force(t *testing.T) {
+	lv := newPowerMock(domainStateRunning)
+
+	if err := stopWithDeps(context.Background(), "test-vm", StopOptions{Force: true}, time.Millisecond, lv); err != nil {
+		t.Fatalf("stopWithDeps() error = %v", err)
+	}
+	if len(lv.domainShutdownCalls) != 0 || len(lv.domainDestroyCalls) != 1 {
+		t.Errorf("shutdown calls = %d, destroy calls = %d, want 0 and 1", len(lv.domainShutdownCalls), len(lv.domainDestroyCalls))
+	}
+}
+
+func TestStopWithDeps_AlreadyStopped(t *testing.T) {
+	lv := newPowerMock(domainStateShutoff)
+
+	if err := stopWithDeps(context.Background(), "test-vm", StopOptions{}, time.Millisecond, lv); err != nil {
+		t.Fatalf("stopWithDeps() error = %v", err)
+	}
+	if len(lv.domainShutdownCalls) != 0 || len(lv.domainDestroyCalls) != 0 {
+		t.Error("expected a stopped VM to be left alone")
+	}
+}
+
+func TestStopWithDeps_Cancelled(t *testing.T) {
+	lv := newPowerMock(domainStateRunning)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := stopWithDeps(ctx, "test-vm", StopOptions{Timeout: time.Hour}, time.Hour, lv)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("stopWithDeps() error = %v, want context.Canceled", err)
+	}
+}
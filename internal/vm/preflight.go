@@ -0,0 +1,181 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/digitalocean/go-libvirt"
+	"libvirt.org/go/libvirtxml"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/logging"
+)
+
+// ErrPreflight is returned (wrapped, with the problems found) when a VM
+// cannot be created on this host as configured.
+var ErrPreflight = errors.New("preflight checks failed")
+
+// SkipPreflight creates the VM without first checking that its bridges and
+// networks exist and that the host has room for it. Use it to overcommit
+// thin-provisioned pools or host resources on purpose.
+func SkipPreflight() CreateOption {
+	return func(o *createOptions) {
+		o.skipPreflight = true
+	}
+}
+
+// preflight checks that the host can run vm before anything is created, so
+// that a missing bridge or a full pool fails fast instead of after the
+// volumes and domain are in place. Every problem found is reported at once.
+//
+// Checks that cannot be made (e.g., libvirt's interface driver is not
+// running) are skipped rather than failing the creation.
+func preflight(ctx context.Context, vm *v1alpha1.VirtualMachine, lv LibvirtClient, sm storageManager) error {
+	logging.FromContext(ctx).Debug("Running preflight checks", "vm", vm.Name)
+
+	var problems []string
+	problems = append(problems, checkNetworks(ctx, vm, lv)...)
+	problems = append(problems, checkPoolSpace(ctx, vm, sm)...)
+	problems = append(problems, checkHostCapacity(ctx, vm, lv)...)
+	problems = append(problems, checkTPM(ctx, vm, lv)...)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrPreflight, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// checkNetworks checks that the bridge, libvirt network or macvtap device of
+// each interface exists, and that networks are active. SR-IOV VFs are checked
+// when their addresses are looked up.
+func checkNetworks(ctx context.Context, vm *v1alpha1.VirtualMachine, lv LibvirtClient) []string {
+	logger := logging.FromContext(ctx)
+
+	var problems []string
+	for _, iface := range vm.Spec.NetworkInterfaces {
+		switch {
+		case iface.Bridge != "":
+			_, err := lv.InterfaceLookupByName(iface.Bridge)
+			if hasLibvirtCode(err, libvirt.ErrNoInterface) {
+				problems = append(problems, fmt.Sprintf("bridge %s does not exist on the host", iface.Bridge))
+			} else if err != nil {
+				logger.Debug("Skipping bridge check", "bridge", iface.Bridge, "error", err)
+			}
+
+		case iface.Macvtap != nil:
+			_, err := lv.InterfaceLookupByName(iface.Macvtap.Device)
+			if hasLibvirtCode(err, libvirt.ErrNoInterface) {
+				problems = append(problems, fmt.Sprintf("network device %s does not exist on the host", iface.Macvtap.Device))
+			} else if err != nil {
+				logger.Debug("Skipping macvtap device check", "device", iface.Macvtap.Device, "error", err)
+			}
+
+		case iface.Network != "":
+			network, err := lv.NetworkLookupByName(iface.Network)
+			if hasLibvirtCode(err, libvirt.ErrNoNetwork) {
+				problems = append(problems, fmt.Sprintf("network %s is not defined (see 'virsh net-list --all')", iface.Network))
+				continue
+			} else if err != nil {
+				logger.Debug("Skipping network check", "network", iface.Network, "error", err)
+				continue
+			}
+			active, err := lv.NetworkIsActive(network)
+			if err != nil {
+				logger.Debug("Skipping network check", "network", iface.Network, "error", err)
+			} else if active == 0 {
+				problems = append(problems, fmt.Sprintf("network %s is not active (start it with 'virsh net-start %s')", iface.Network, iface.Network))
+			}
+		}
+	}
+	return problems
+}
+
+// checkPoolSpace checks that the VM's pool has room for the full capacity
+// of its volumes. Volumes are thin-provisioned, so this is the space they
+// may grow to rather than what they use when created.
+func checkPoolSpace(ctx context.Context, vm *v1alpha1.VirtualMachine, sm storageManager) []string {
+	pool := getStoragePool(vm)
+	info, err := sm.GetPoolInfo(ctx, pool)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to get pool %s: %v", pool, err)}
+	}
+	if info.State != "running" {
+		return []string{fmt.Sprintf("pool %s is %s", pool, info.State)}
+	}
+
+	requiredGB := uint64(vm.Spec.BootDisk.SizeGB)
+	for _, disk := range vm.Spec.DataDisks {
+		requiredGB += uint64(disk.SizeGB)
+	}
+	if vm.HasCloudInitISO() {
+		requiredGB += cloudInitCapacityGB(0)
+	}
+
+	if requiredGB<<30 > info.Available {
+		return []string{fmt.Sprintf("pool %s has %.1f GB free, the VM's volumes need up to %d GB", pool, info.AvailableGB(), requiredGB)}
+	}
+	return nil
+}
+
+// checkHostCapacity checks that the VM's vCPUs and memory fit on the host.
+func checkHostCapacity(ctx context.Context, vm *v1alpha1.VirtualMachine, lv LibvirtClient) []string {
+	_, memoryKiB, cpus, _, _, _, _, _, err := lv.NodeGetInfo()
+	if err != nil {
+		logging.FromContext(ctx).Debug("Skipping host capacity check", "error", err)
+		return nil
+	}
+
+	var problems []string
+	if vm.Spec.VCPUs > int(cpus) {
+		problems = append(problems, fmt.Sprintf("%d vCPUs requested, the host has %d CPUs", vm.Spec.VCPUs, cpus))
+	}
+	if memoryMiB := uint64(vm.GetMemoryMiB()); memoryMiB > memoryKiB/1024 {
+		problems = append(problems, fmt.Sprintf("%d MiB of memory requested, the host has %d MiB", memoryMiB, memoryKiB/1024))
+	}
+	return problems
+}
+
+// checkTPM checks that the hypervisor can emulate the VM's TPM, which needs
+// swtpm installed on the host. libvirt only offers the emulator backend in
+// its domain capabilities when it finds swtpm.
+func checkTPM(ctx context.Context, vm *v1alpha1.VirtualMachine, lv LibvirtClient) []string {
+	if !vm.Spec.TPM {
+		return nil
+	}
+	logger := logging.FromContext(ctx)
+
+	capsXML, err := lv.ConnectGetDomainCapabilities(nil, nil, nil, libvirt.OptString{"kvm"}, 0)
+	if err != nil {
+		logger.Debug("Skipping TPM check", "error", err)
+		return nil
+	}
+	var caps libvirtxml.DomainCaps
+	if err := caps.Unmarshal(capsXML); err != nil {
+		logger.Debug("Skipping TPM check", "error", err)
+		return nil
+	}
+	if caps.Devices == nil || caps.Devices.TPM == nil {
+		// Older libvirt does not report TPM support
+		logger.Debug("Skipping TPM check", "reason", "TPM support not reported")
+		return nil
+	}
+
+	tpm := caps.Devices.TPM
+	if tpm.Supported == "yes" {
+		for _, enum := range tpm.Enums {
+			if enum.Name == "backendModel" && slices.Contains(enum.Values, "emulator") {
+				return nil
+			}
+		}
+	}
+	return []string{"spec.tpm needs swtpm, which is not installed on the host (install the swtpm package)"}
+}
+
+// hasLibvirtCode reports whether err is a libvirt error with the given code.
+func hasLibvirtCode(err error, code libvirt.ErrorNumber) bool {
+	var lerr libvirt.Error
+	return errors.As(err, &lerr) && lerr.Code == uint32(code)
+}
@@ -0,0 +1,122 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+func TestCreate_PreflightFailures(t *testing.T) {
+	vm := testVMConfigWithDataDisks()
+	vm.Spec.VCPUs = 16
+	vm.Spec.NetworkInterfaces = append(vm.Spec.NetworkInterfaces,
+		v1alpha1.NetworkInterfaceSpec{Network: "isolated"},
+		v1alpha1.NetworkInterfaceSpec{Network: "stopped"},
+		v1alpha1.NetworkInterfaceSpec{DHCP: true, Macvtap: &v1alpha1.MacvtapSpec{Device: "eno9"}},
+	)
+
+	lv := newMockLibvirtClient()
+	lv.interfaceLookupFunc = func(name string) (libvirt.Interface, error) {
+		return libvirt.Interface{}, libvirt.Error{Code: uint32(libvirt.ErrNoInterface), Message: "interface not found"}
+	}
+	lv.networkLookupFunc = func(name string) (libvirt.Network, error) {
+		if name == "isolated" {
+			return libvirt.Network{}, libvirt.Error{Code: uint32(libvirt.ErrNoNetwork), Message: "network not found"}
+		}
+		return libvirt.Network{Name: name}, nil
+	}
+	lv.networkIsActiveFunc = func(libvirt.Network) (int32, error) { return 0, nil }
+	lv.nodeGetInfoFunc = func() (uint64, int32, error) { return 1 << 20, 8, nil } // 1 GiB, 8 CPUs
+	sm := newMockStorageManager()
+	sm.getPoolInfoFunc = func(ctx context.Context, name string) (*storage.PoolInfo, error) {
+		return &storage.PoolInfo{Name: name, State: "running", Available: 10 << 30}, nil
+	}
+
+	err := createFromConfigWithDeps(context.Background(), vm, lv, sm, newMockMetadataClient(lv))
+	if !errors.Is(err, ErrPreflight) {
+		t.Fatalf("createFromConfigWithDeps() error = %v, want ErrPreflight", err)
+	}
+	for _, want := range []string{
+		"bridge br0 does not exist",
+		"network isolated is not defined",
+		"network stopped is not active",
+		"network device eno9 does not exist",
+		"pool foundry-vms has 10.0 GB free, the VM's volumes need up to 170 GB",
+		"16 vCPUs requested, the host has 8 CPUs",
+		"2048 MiB of memory requested, the host has 1024 MiB",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error = %q, want it to contain %q", err, want)
+		}
+	}
+
+	if len(sm.createVolumeCalls) != 0 || len(lv.domainDefineXMLCalls) != 0 {
+		t.Errorf("created %d volumes and %d domains, want nothing created", len(sm.createVolumeCalls), len(lv.domainDefineXMLCalls))
+	}
+}
+
+func TestCreate_PreflightSkipsUncheckable(t *testing.T) {
+	lv := newMockLibvirtClient()
+	// The interface driver is not running: bridges cannot be checked
+	lv.interfaceLookupFunc = func(name string) (libvirt.Interface, error) {
+		return libvirt.Interface{}, libvirt.Error{Code: uint32(libvirt.ErrNoSupport), Message: "no interface driver"}
+	}
+	lv.nodeGetInfoFunc = func() (uint64, int32, error) { return 0, 0, errors.New("not supported") }
+
+	if err := createFromConfigWithDeps(context.Background(), testVMConfig(), lv, newMockStorageManager(), newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("createFromConfigWithDeps() error = %v", err)
+	}
+}
+
+func TestCreate_SkipPreflight(t *testing.T) {
+	lv := newMockLibvirtClient()
+	lv.interfaceLookupFunc = func(name string) (libvirt.Interface, error) {
+		return libvirt.Interface{}, libvirt.Error{Code: uint32(libvirt.ErrNoInterface)}
+	}
+	sm := newMockStorageManager()
+
+	ctx := withCreateOptions(context.Background(), []CreateOption{SkipPreflight()})
+	if err := createFromConfigWithDeps(ctx, testVMConfig(), lv, sm, newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("createFromConfigWithDeps() error = %v", err)
+	}
+	if len(lv.interfaceLookupCalls) != 0 {
+		t.Errorf("bridges looked up %v, want no preflight checks", lv.interfaceLookupCalls)
+	}
+}
+
+func TestCreate_PreflightTPM(t *testing.T) {
+	tests := []struct {
+		name    string
+		caps    string
+		capsErr error
+		wantErr bool
+	}{
+		{name: "swtpm installed", caps: `<domainCapabilities><devices><tpm supported="yes"><enum name="backendModel"><value>emulator</value></enum></tpm></devices></domainCapabilities>`},
+		{name: "swtpm missing", caps: `<domainCapabilities><devices><tpm supported="yes"><enum name="backendModel"><value>passthrough</value></enum></tpm></devices></domainCapabilities>`, wantErr: true},
+		{name: "tpm unsupported", caps: `<domainCapabilities><devices><tpm supported="no"/></devices></domainCapabilities>`, wantErr: true},
+		{name: "not reported", caps: `<domainCapabilities><devices></devices></domainCapabilities>`},
+		{name: "capabilities unavailable", capsErr: errors.New("not supported")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := testVMConfig()
+			vm.Spec.TPM = true
+			lv := newMockLibvirtClient()
+			lv.domainCapabilitiesFunc = func() (string, error) { return tt.caps, tt.capsErr }
+
+			err := createFromConfigWithDeps(context.Background(), vm, lv, newMockStorageManager(), newMockMetadataClient(lv))
+			if tt.wantErr && (!errors.Is(err, ErrPreflight) || !strings.Contains(err.Error(), "swtpm")) {
+				t.Errorf("createFromConfigWithDeps() error = %v, want a swtpm preflight failure", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("createFromConfigWithDeps() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package vm
+
+import (
+	"context"
+)
+
+// CreateEvent is a step of VM creation, reported to the channel given with
+// WithProgress. It is one of VolumeCreated, DomainDefined, Started or
+// CleanupStarted.
+type CreateEvent interface {
+	createEvent()
+}
+
+// VolumeCreated reports that a volume of the VM (a boot, data or cloud-init
+// ISO volume) was created.
+type VolumeCreated struct {
+	VM     string
+	Pool   string
+	Volume string
+}
+
+// DomainDefined reports that the VM's domain was defined in libvirt, with
+// the UUID UUID.
+type DomainDefined struct {
+	VM   string
+	UUID string
+}
+
+// Started reports that the VM was started. It is the last event of a
+// successful creation.
+type Started struct {
+	VM string
+}
+
+// CleanupStarted reports that creation failed with Err and that the
+// resources created so far are being removed. It is the last event of a
+// failed creation.
+type CleanupStarted struct {
+	VM  string
+	Err error
+}
+
+func (VolumeCreated) createEvent()  {}
+func (DomainDefined) createEvent()  {}
+func (Started) createEvent()        {}
+func (CleanupStarted) createEvent() {}
+
+// CreateOption configures Create and CreateFromConfig.
+type CreateOption func(*createOptions)
+
+type createOptions struct {
+	progress      chan<- CreateEvent
+	skipPreflight bool
+	ensure        bool
+}
+
+// WithProgress reports the steps of the creation to ch as they complete.
+//
+// Sends block until ch is read or the creation's context is done, after
+// which events are dropped; a buffered channel keeps a slow reader from
+// delaying the creation. ch is not closed: Create has sent its last event
+// when it returns.
+func WithProgress(ch chan<- CreateEvent) CreateOption {
+	return func(o *createOptions) {
+		o.progress = ch
+	}
+}
+
+type createOptionsKey struct{}
+
+// withCreateOptions returns a copy of ctx carrying opts. The options travel
+// in the context so the steps shared with apply and clone honor them without
+// threading them through every helper.
+func withCreateOptions(ctx context.Context, opts []CreateOption) context.Context {
+	if len(opts) == 0 {
+		return ctx
+	}
+	o := &createOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return context.WithValue(ctx, createOptionsKey{}, o)
+}
+
+// createOptionsFrom returns the options carried by ctx, or the zero options.
+func createOptionsFrom(ctx context.Context) *createOptions {
+	if o, ok := ctx.Value(createOptionsKey{}).(*createOptions); ok {
+		return o
+	}
+	return &createOptions{}
+}
+
+// emitProgress records ev in the creation journal and sends it to the
+// progress channel of ctx, if it has them.
+func emitProgress(ctx context.Context, ev CreateEvent) {
+	journalEvent(ctx, ev)
+
+	ch := createOptionsFrom(ctx).progress
+	if ch == nil {
+		return
+	}
+	select {
+	case ch <- ev:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,96 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/google/uuid"
+)
+
+// collectProgress runs create with a progress channel and returns the events
+// it sent.
+func collectProgress(t *testing.T, create func(ctx context.Context) error) ([]CreateEvent, error) {
+	t.Helper()
+	ch := make(chan CreateEvent)
+	done := make(chan []CreateEvent)
+	go func() {
+		var events []CreateEvent
+		for ev := range ch {
+			events = append(events, ev)
+		}
+		done <- events
+	}()
+
+	ctx := withCreateOptions(context.Background(), []CreateOption{WithProgress(ch)})
+	err := create(ctx)
+	close(ch)
+	return <-done, err
+}
+
+func TestCreateProgress(t *testing.T) {
+	vm := testVMConfigWithCloudInit()
+	vm.Spec.DataDisks = testVMConfigWithDataDisks().Spec.DataDisks
+	lv := newMockLibvirtClient()
+	domainUUID := uuid.MustParse("8f2c8a51-4e59-4a9e-9d3c-2d5b0f1e7a10")
+	lv.domainDefineXMLFunc = func(xml string) (libvirt.Domain, error) {
+		return libvirt.Domain{Name: "test-vm", UUID: libvirt.UUID(domainUUID)}, nil
+	}
+
+	events, err := collectProgress(t, func(ctx context.Context) error {
+		return createFromConfigWithDeps(ctx, vm, lv, newMockStorageManager(), newMockMetadataClient(lv))
+	})
+	if err != nil {
+		t.Fatalf("createFromConfigWithDeps() error = %v", err)
+	}
+
+	want := []CreateEvent{
+		VolumeCreated{VM: "test-vm", Pool: "foundry-vms", Volume: "test-vm_boot.qcow2"},
+		VolumeCreated{VM: "test-vm", Pool: "foundry-vms", Volume: "test-vm_data-vdb.qcow2"},
+		VolumeCreated{VM: "test-vm", Pool: "foundry-vms", Volume: "test-vm_data-vdc.qcow2"},
+		VolumeCreated{VM: "test-vm", Pool: "foundry-vms", Volume: "test-vm_cloudinit.iso"},
+		DomainDefined{VM: "test-vm", UUID: domainUUID.String()},
+		Started{VM: "test-vm"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+}
+
+func TestCreateProgress_Failure(t *testing.T) {
+	lv := newMockLibvirtClient()
+	startErr := errors.New("no free memory")
+	lv.domainCreateFunc = func(libvirt.Domain) error { return startErr }
+
+	events, err := collectProgress(t, func(ctx context.Context) error {
+		return createFromConfigWithDeps(ctx, testVMConfig(), lv, newMockStorageManager(), newMockMetadataClient(lv))
+	})
+	if !errors.Is(err, startErr) {
+		t.Fatalf("createFromConfigWithDeps() error = %v, want %v", err, startErr)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("events = %+v, want volume, define and cleanup", events)
+	}
+	if _, ok := events[1].(DomainDefined); !ok {
+		t.Errorf("events[1] = %+v, want DomainDefined", events[1])
+	}
+	cleanup, ok := events[2].(CleanupStarted)
+	if !ok || cleanup.VM != "test-vm" || !errors.Is(cleanup.Err, startErr) {
+		t.Errorf("events[2] = %+v, want CleanupStarted with the start error", events[2])
+	}
+}
+
+func TestCreateProgress_Cancelled(t *testing.T) {
+	// Nobody reads the channel: sends give up once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx = withCreateOptions(ctx, []CreateOption{WithProgress(make(chan CreateEvent))})
+
+	lv := newMockLibvirtClient()
+	if err := createFromConfigWithDeps(ctx, testVMConfig(), lv, newMockStorageManager(), newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("createFromConfigWithDeps() error = %v", err)
+	}
+}
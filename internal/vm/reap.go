@@ -0,0 +1,107 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// ReapedVM describes a VM destroyed by Reap.
+type ReapedVM struct {
+	// Name is the name of the destroyed VM.
+	Name string
+
+	// Reason explains why the VM was destroyed.
+	Reason string
+}
+
+// Reap destroys VMs that are no longer wanted, including their storage:
+//   - VMs whose spec.ttl has expired, counted from their creation
+//   - ephemeral VMs (spec.ephemeral) that have shut down or crashed
+//
+// VMs that cannot be destroyed are skipped and reported in the returned error;
+// the others are still reaped.
+func Reap(ctx context.Context) ([]ReapedVM, error) {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+
+	return reapWithDeps(ctx, time.Now(), LibvirtClient.Libvirt(), storageMgr, localLinks())
+}
+
+// reapWithDeps reaps VMs with injected dependencies, using now as the current
+// time.
+func reapWithDeps(ctx context.Context, now time.Time, lv LibvirtClient, sm storageManager, links hostLinks) ([]ReapedVM, error) {
+	logger := logging.FromContext(ctx)
+
+	vms, err := listVMsWithDeps(ctx, lv)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		reaped []ReapedVM
+		errs   []error
+	)
+	for _, vm := range vms {
+		reason := reapReason(ctx, vm, now)
+		if reason == "" {
+			continue
+		}
+
+		logger.Info("Reaping VM", "vm", vm.Name, "reason", reason)
+		report, err := destroyAndVerifyWithDeps(ctx, vm.Name, DestroyOptions{ForceClean: true}, lv, sm, links)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to reap VM '%s': %w", vm.Name, err))
+			continue
+		}
+		if !report.Clean() {
+			logger.Warn("VM was destroyed but left resources behind", "vm", vm.Name)
+		}
+		reaped = append(reaped, ReapedVM{Name: vm.Name, Reason: reason})
+	}
+
+	return reaped, errors.Join(errs...)
+}
+
+// reapReason returns why vm should be reaped at time now, or "" if it should
+// be kept. Its status must be populated.
+func reapReason(ctx context.Context, vm *v1alpha1.VirtualMachine, now time.Time) string {
+	if vm.Spec.TTL != nil {
+		if vm.CreationTimestamp.IsZero() {
+			// Without a creation time the expiry is unknown; never guess
+			logging.FromContext(ctx).Warn("VM has a TTL but no creation timestamp, not reaping it", "vm", vm.Name)
+		} else if !now.Before(vm.CreationTimestamp.Add(vm.Spec.TTL.Duration)) {
+			return fmt.Sprintf("TTL of %s expired", vm.Spec.TTL.Duration)
+		}
+	}
+
+	if vm.Spec.Ephemeral {
+		switch vm.Status.Phase {
+		case v1alpha1.VMPhaseStopped:
+			return "ephemeral VM shut down"
+		case v1alpha1.VMPhaseFailed:
+			return "ephemeral VM crashed"
+		}
+	}
+
+	return ""
+}
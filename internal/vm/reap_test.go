@@ -0,0 +1,154 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+func TestReapReason(t *testing.T) {
+	now := time.Date(2025, 11, 3, 12, 0, 0, 0, time.UTC)
+	ttl := func(d time.Duration) *v1alpha1.Duration { return &v1alpha1.Duration{Duration: d} }
+
+	tests := []struct {
+		name      string
+		created   time.Time
+		ttl       *v1alpha1.Duration
+		ephemeral bool
+		phase     v1alpha1.VMPhase
+		want      string
+	}{
+		{name: "no ttl", created: now.Add(-48 * time.Hour), phase: v1alpha1.VMPhaseRunning},
+		{name: "ttl not expired", created: now.Add(-time.Hour), ttl: ttl(2 * time.Hour), phase: v1alpha1.VMPhaseRunning},
+		{name: "ttl expired", created: now.Add(-3 * time.Hour), ttl: ttl(2 * time.Hour), phase: v1alpha1.VMPhaseRunning, want: "TTL of 2h0m0s expired"},
+		{name: "ttl expires exactly now", created: now.Add(-2 * time.Hour), ttl: ttl(2 * time.Hour), phase: v1alpha1.VMPhaseRunning, want: "TTL of 2h0m0s expired"},
+		{name: "ttl without creation time", ttl: ttl(time.Minute), phase: v1alpha1.VMPhaseRunning},
+		{name: "ephemeral running", created: now, ephemeral: true, phase: v1alpha1.VMPhaseRunning},
+		{name: "ephemeral stopped", created: now, ephemeral: true, phase: v1alpha1.VMPhaseStopped, want: "ephemeral VM shut down"},
+		{name: "ephemeral crashed", created: now, ephemeral: true, phase: v1alpha1.VMPhaseFailed, want: "ephemeral VM crashed"},
+		{name: "stopped but not ephemeral", created: now, phase: v1alpha1.VMPhaseStopped},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := testVMConfig()
+			vm.CreationTimestamp = v1alpha1.Time{Time: tt.created}
+			vm.Spec.TTL = tt.ttl
+			vm.Spec.Ephemeral = tt.ephemeral
+			vm.Status.Phase = tt.phase
+
+			if got := reapReason(context.Background(), vm, now); got != tt.want {
+				t.Errorf("reapReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReapWithDeps(t *testing.T) {
+	now := time.Now()
+
+	expired := testVMConfig()
+	expired.Name = "expired"
+	expired.CreationTimestamp = v1alpha1.Time{Time: now.Add(-3 * time.Hour)}
+	expired.Spec.TTL = &v1alpha1.Duration{Duration: time.Hour}
+
+	fresh := testVMConfig()
+	fresh.Name = "fresh"
+	fresh.CreationTimestamp = v1alpha1.Time{Time: now.Add(-10 * time.Minute)}
+	fresh.Spec.TTL = &v1alpha1.Duration{Duration: time.Hour}
+
+	ephemeral := testVMConfig()
+	ephemeral.Name = "ephemeral"
+	ephemeral.Spec.Ephemeral = true
+
+	stored := map[string]string{
+		"expired":   storedMetadataXML(t, expired),
+		"fresh":     storedMetadataXML(t, fresh),
+		"ephemeral": storedMetadataXML(t, ephemeral),
+	}
+	undefined := make(map[string]bool)
+
+	lv := newMockLibvirtClient()
+	lv.connectListAllDomainsFunc = func(needResults int32, flags libvirt.ConnectListAllDomainsFlags) ([]libvirt.Domain, uint32, error) {
+		return []libvirt.Domain{{Name: "expired"}, {Name: "fresh"}, {Name: "ephemeral"}}, 3, nil
+	}
+	lv.domainGetMetadataFunc = func(dom libvirt.Domain, typ int32, uri libvirt.OptString, flags libvirt.DomainModificationImpact) (string, error) {
+		return stored[dom.Name], nil
+	}
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		if undefined[name] {
+			return libvirt.Domain{}, fmt.Errorf("domain not found: %s", name)
+		}
+		return libvirt.Domain{Name: name}, nil
+	}
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateShutoff, 0, nil
+	}
+	lv.domainUndefineFlagsFunc = func(dom libvirt.Domain, flags libvirt.DomainUndefineFlagsValues) error {
+		undefined[dom.Name] = true
+		return nil
+	}
+	sm := newMockStorageManager()
+
+	reaped, err := reapWithDeps(context.Background(), now, lv, sm, nil)
+	if err != nil {
+		t.Fatalf("reapWithDeps() error = %v", err)
+	}
+
+	want := []ReapedVM{
+		{Name: "expired", Reason: "TTL of 1h0m0s expired"},
+		{Name: "ephemeral", Reason: "ephemeral VM shut down"},
+	}
+	if len(reaped) != len(want) {
+		t.Fatalf("reaped %+v, want %+v", reaped, want)
+	}
+	for i := range want {
+		if reaped[i] != want[i] {
+			t.Errorf("reaped[%d] = %+v, want %+v", i, reaped[i], want[i])
+		}
+	}
+	if undefined["fresh"] {
+		t.Error("VM with an unexpired TTL was destroyed")
+	}
+}
+
+func TestReapWithDeps_ContinuesAfterFailure(t *testing.T) {
+	now := time.Now()
+	expired := testVMConfig()
+	expired.CreationTimestamp = v1alpha1.Time{Time: now.Add(-3 * time.Hour)}
+	expired.Spec.TTL = &v1alpha1.Duration{Duration: time.Hour}
+	metadataXML := storedMetadataXML(t, expired)
+
+	lv := newMockLibvirtClient()
+	lv.connectListAllDomainsFunc = func(needResults int32, flags libvirt.ConnectListAllDomainsFlags) ([]libvirt.Domain, uint32, error) {
+		return []libvirt.Domain{{Name: "stuck"}, {Name: "test-vm"}}, 2, nil
+	}
+	lv.domainGetMetadataFunc = func(dom libvirt.Domain, typ int32, uri libvirt.OptString, flags libvirt.DomainModificationImpact) (string, error) {
+		return metadataXML, nil
+	}
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		return libvirt.Domain{Name: name}, nil
+	}
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateShutoff, 0, nil
+	}
+	lv.domainUndefineFlagsFunc = func(dom libvirt.Domain, flags libvirt.DomainUndefineFlagsValues) error {
+		return fmt.Errorf("permission denied")
+	}
+
+	reaped, err := reapWithDeps(context.Background(), now, lv, newMockStorageManager(), nil)
+	if err == nil {
+		t.Fatal("expected error for VMs that could not be destroyed")
+	}
+	if len(reaped) != 0 {
+		t.Errorf("reaped %+v, want none", reaped)
+	}
+	if len(lv.domainUndefineFlagsCalls) != 2 {
+		t.Errorf("expected both VMs to be attempted, got %d undefine calls", len(lv.domainUndefineFlagsCalls))
+	}
+}
@@ -0,0 +1,281 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/loader"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/status"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// ReconcileAction describes a change Reconcile made to a VM.
+type ReconcileAction struct {
+	// VMName is the name of the reconciled VM.
+	VMName string
+
+	// Action describes what was done, e.g. "created" or "started".
+	Action string
+}
+
+// Reconcile brings the VMs defined in dir to their desired state. dir is a
+// YAML file or directory as accepted by 'foundry apply'. For each VM:
+//   - a missing VM is created
+//   - changes to its spec are applied like 'foundry apply'
+//   - missing boot, data disk and cloud-init volumes of a shut off VM are
+//     recreated (a running VM may still hold a deleted volume open)
+//   - a shut off or crashed VM with autostart enabled is started
+//   - the phase and observed generation in its stored status are updated
+//
+// VMs not defined in dir are left alone. A VM that cannot be reconciled is
+// skipped and reported in the returned error; the others are still
+// reconciled.
+func Reconcile(ctx context.Context, dir string) ([]ReconcileAction, error) {
+	logger := logging.FromContext(ctx)
+
+	docs, err := loader.LoadAll(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Connect to libvirt
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	if err := storageMgr.EnsureDefaultPools(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ensure default pools: %w", err)
+	}
+
+	return reconcileWithDeps(ctx, docs, LibvirtClient.Libvirt(), storageMgr, metaClient)
+}
+
+// ReconcileVM brings a single VM to its desired state like Reconcile and
+// returns what was done, e.g. for a VirtualMachine resource watched by the
+// Kubernetes controller.
+func ReconcileVM(ctx context.Context, desired *v1alpha1.VirtualMachine) ([]string, error) {
+	logger := logging.FromContext(ctx)
+
+	if desired.Name == "" {
+		return nil, fmt.Errorf("metadata.generateName cannot be reconciled; set metadata.name")
+	}
+
+	// Connect to libvirt
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	if err := storageMgr.EnsureDefaultPools(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ensure default pools: %w", err)
+	}
+
+	return reconcileVM(ctx, desired, LibvirtClient.Libvirt(), storageMgr, metaClient)
+}
+
+// reconcileWithDeps reconciles the loaded VMs with injected dependencies.
+func reconcileWithDeps(ctx context.Context, docs []loader.Document, lv LibvirtClient, sm storageManager, mc *metadata.Client) ([]ReconcileAction, error) {
+	var (
+		actions []ReconcileAction
+		errs    []error
+	)
+	for _, doc := range docs {
+		if doc.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", doc.Source, doc.Err))
+			continue
+		}
+		if doc.VM.Name == "" {
+			errs = append(errs, fmt.Errorf("%s: metadata.generateName cannot be reconciled; set metadata.name", doc.Source))
+			continue
+		}
+
+		done, err := reconcileVM(ctx, doc.VM, lv, sm, mc)
+		for _, action := range done {
+			actions = append(actions, ReconcileAction{VMName: doc.VM.Name, Action: action})
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to reconcile VM '%s': %w", doc.VM.Name, err))
+		}
+	}
+
+	return actions, errors.Join(errs...)
+}
+
+// reconcileVM brings one VM to its desired state and returns what it did.
+func reconcileVM(ctx context.Context, desired *v1alpha1.VirtualMachine, lv LibvirtClient, sm storageManager, mc *metadata.Client) ([]string, error) {
+	logger := logging.FromContext(ctx)
+
+	var actions []string
+
+	domain, err := lv.DomainLookupByName(desired.Name)
+	if err != nil {
+		logger.Info("Reconcile: VM is missing, creating it", "vm", desired.Name)
+		if _, err := applyWithDeps(ctx, desired, lv, sm, mc); err != nil {
+			return nil, err
+		}
+		return []string{"created"}, nil
+	}
+
+	current, err := mc.Load(domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stored spec (not managed by foundry?): %w", err)
+	}
+
+	// Apply only when something changed; apply bumps the generation
+	wanted := desired.DeepCopy()
+	inheritMACAddresses(current, wanted)
+	inheritAnnotations(current, wanted)
+	if len(diffSpec(current, wanted)) > 0 {
+		logger.Info("Reconcile: VM differs from its config, applying it", "vm", desired.Name)
+		result, err := applyWithDeps(ctx, desired, lv, sm, mc)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, fmt.Sprintf("updated (generation %d)", result.Generation))
+
+		if current, err = mc.Load(domain); err != nil {
+			return actions, fmt.Errorf("failed to reload stored spec: %w", err)
+		}
+	}
+
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		return actions, fmt.Errorf("failed to get VM state: %w", err)
+	}
+	stopped := state == domainStateShutoff || state == domainStateCrashed
+
+	if stopped {
+		recreated, err := recreateMissingVolumes(ctx, current, sm)
+		actions = append(actions, recreated...)
+		if err != nil {
+			return actions, err
+		}
+		// A recreated boot disk records the image backing it
+		if len(recreated) > 0 {
+			status.SetCondition(current, v1alpha1.ConditionStorageProvisioned, v1alpha1.ConditionTrue, "VolumesRecreated",
+				"Missing volumes recreated: "+strings.Join(recreated, ", "))
+			if err := mc.Store(domain, current); err != nil {
+				return actions, fmt.Errorf("failed to store spec: %w", err)
+			}
+		}
+	}
+
+	// Ephemeral VMs that stopped are left for the reaper
+	if stopped && autostartEnabled(current) && !current.Spec.Ephemeral {
+		if err := verifyBootImage(ctx, current, sm); err != nil {
+			return actions, err
+		}
+		logger.Info("Reconcile: starting VM", "vm", current.Name)
+		if err := lv.DomainCreate(domain); err != nil {
+			return actions, fmt.Errorf("failed to start VM: %w", err)
+		}
+		actions = append(actions, "started")
+	}
+
+	if err := updateStoredStatus(ctx, lv, domain, current, mc); err != nil {
+		return actions, err
+	}
+	return actions, nil
+}
+
+// recreateMissingVolumes creates the boot, data disk and cloud-init volumes
+// of a VM that no longer exist. The boot disk is recreated from its image,
+// so everything the guest had written to it is gone.
+func recreateMissingVolumes(ctx context.Context, vm *v1alpha1.VirtualMachine, sm storageManager) ([]string, error) {
+	logger := logging.FromContext(ctx)
+
+	pool := getStoragePool(vm)
+	var actions []string
+
+	exists, err := sm.VolumeExists(ctx, pool, getBootVolumeName(vm))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check boot volume: %w", err)
+	}
+	if !exists {
+		logger.Info("Reconcile: boot volume is missing, recreating it", "vm", vm.Name)
+		bootSpec, err := bootVolumeSpec(ctx, vm, sm)
+		if err != nil {
+			return actions, err
+		}
+		if err := sm.CreateVolume(ctx, pool, bootSpec); err != nil {
+			return actions, fmt.Errorf("failed to create boot volume: %w", err)
+		}
+		actions = append(actions, "recreated boot volume")
+	}
+
+	for _, disk := range vm.Spec.DataDisks {
+		exists, err := sm.VolumeExists(ctx, pool, getDataVolumeName(vm, disk.Device))
+		if err != nil {
+			return actions, fmt.Errorf("failed to check data volume %s: %w", disk.Device, err)
+		}
+		if exists {
+			continue
+		}
+		logger.Info("Reconcile: data volume is missing, recreating it", "vm", vm.Name, "device", disk.Device)
+		if err := sm.CreateVolume(ctx, pool, dataVolumeSpec(vm, disk)); err != nil {
+			return actions, fmt.Errorf("failed to create data volume %s: %w", disk.Device, err)
+		}
+		actions = append(actions, "recreated data volume "+disk.Device)
+	}
+
+	if vm.HasCloudInitISO() {
+		exists, err := sm.VolumeExists(ctx, pool, getCloudInitVolumeName(vm))
+		if err != nil {
+			return actions, fmt.Errorf("failed to check cloud-init volume: %w", err)
+		}
+		if !exists {
+			logger.Info("Reconcile: cloud-init volume is missing, recreating it", "vm", vm.Name)
+			if err := createCloudInitVolume(ctx, vm, sm); err != nil {
+				return actions, err
+			}
+			actions = append(actions, "recreated cloud-init volume")
+		}
+	}
+
+	return actions, nil
+}
+
+// updateStoredStatus records the VM's current phase and observed generation
+// in its stored metadata. The metadata is only rewritten if either changed.
+func updateStoredStatus(ctx context.Context, lv LibvirtClient, domain libvirt.Domain, vm *v1alpha1.VirtualMachine, mc *metadata.Client) error {
+	phase := vm.Status.Phase
+	observed := vm.Status.ObservedGeneration
+
+	if err := populateStatus(ctx, lv, domain, vm); err != nil {
+		return err
+	}
+	vm.UpdateObservedGeneration()
+	if vm.Status.Phase == phase && vm.Status.ObservedGeneration == observed {
+		return nil
+	}
+
+	if err := mc.Store(domain, vm); err != nil {
+		return fmt.Errorf("failed to store status: %w", err)
+	}
+	return nil
+}
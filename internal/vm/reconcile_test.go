@@ -0,0 +1,164 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/loader"
+)
+
+// reconciledActions returns the actions of a reconcile as "vm: action".
+func reconciledActions(actions []ReconcileAction) []string {
+	var out []string
+	for _, a := range actions {
+		out = append(out, a.VMName+": "+a.Action)
+	}
+	return out
+}
+
+func TestReconcileWithDeps_UpToDate(t *testing.T) {
+	stored := testVMConfig()
+	stored.Generation = 2
+	stored.Status.ObservedGeneration = 2
+	stored.Status.Phase = v1alpha1.VMPhaseRunning
+	lv, sm := newApplyMocks(t, stored)
+
+	docs := []loader.Document{{Source: "vm.yaml", VM: testVMConfig()}}
+	actions, err := reconcileWithDeps(context.Background(), docs, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("reconcileWithDeps() error = %v", err)
+	}
+	if len(actions) != 0 {
+		t.Errorf("actions = %v, want none", reconciledActions(actions))
+	}
+	if len(lv.domainDefineXMLCalls) != 0 || len(lv.domainCreateCalls) != 0 || len(lv.domainSetMetadataCalls) != 0 {
+		t.Error("expected an up to date VM to be left alone")
+	}
+}
+
+func TestReconcileWithDeps_CreatesMissingVM(t *testing.T) {
+	lv := newMockLibvirtClient()
+	sm := newMockStorageManager()
+
+	docs := []loader.Document{{Source: "vm.yaml", VM: testVMConfig()}}
+	actions, err := reconcileWithDeps(context.Background(), docs, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("reconcileWithDeps() error = %v", err)
+	}
+	if got := reconciledActions(actions); !reflect.DeepEqual(got, []string{"test-vm: created"}) {
+		t.Errorf("actions = %v", got)
+	}
+}
+
+func TestReconcileWithDeps_AppliesChanges(t *testing.T) {
+	stored := testVMConfig()
+	stored.Generation = 1
+	lv, sm := newApplyMocks(t, stored)
+
+	desired := testVMConfig()
+	desired.Spec.VCPUs = stored.Spec.VCPUs + 2
+
+	docs := []loader.Document{{Source: "vm.yaml", VM: desired}}
+	actions, err := reconcileWithDeps(context.Background(), docs, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("reconcileWithDeps() error = %v", err)
+	}
+	if got := reconciledActions(actions); !reflect.DeepEqual(got, []string{"test-vm: updated (generation 2)"}) {
+		t.Errorf("actions = %v", got)
+	}
+}
+
+func TestReconcileWithDeps_StoppedVM(t *testing.T) {
+	stored := testVMConfigWithDataDisks()
+	stored.Generation = 1
+	stored.Status.ObservedGeneration = 1
+	lv, sm := newApplyMocks(t, stored)
+	mc := newMockMetadataClient(lv)
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return domainStateShutoff, 0, nil
+	}
+	sm.volumeExistsFunc = func(ctx context.Context, poolName, volumeName string) (bool, error) {
+		return volumeName != "test-vm_data-vdb.qcow2", nil
+	}
+
+	docs := []loader.Document{{Source: "vm.yaml", VM: testVMConfigWithDataDisks()}}
+	actions, err := reconcileWithDeps(context.Background(), docs, lv, sm, mc)
+	if err != nil {
+		t.Fatalf("reconcileWithDeps() error = %v", err)
+	}
+
+	want := []string{"test-vm: recreated data volume vdb", "test-vm: started"}
+	if got := reconciledActions(actions); !reflect.DeepEqual(got, want) {
+		t.Errorf("actions = %v, want %v", got, want)
+	}
+	if len(sm.createVolumeCalls) != 1 || sm.createVolumeCalls[0].Name != "test-vm_data-vdb.qcow2" || sm.createVolumeCalls[0].CapacityGB != 50 {
+		t.Errorf("created volumes = %+v, want empty vdb", sm.createVolumeCalls)
+	}
+
+	// The stored status reflects the observed state
+	reloaded, err := mc.Load(libvirt.Domain{Name: "test-vm"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if reloaded.Status.Phase != v1alpha1.VMPhaseStopped {
+		t.Errorf("stored phase = %q, want Stopped", reloaded.Status.Phase)
+	}
+}
+
+func TestReconcileWithDeps_KeepsStoppedVMs(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		name   string
+		modify func(vm *v1alpha1.VirtualMachine)
+	}{
+		{name: "autostart disabled", modify: func(vm *v1alpha1.VirtualMachine) { vm.Spec.Autostart = &disabled }},
+		{name: "ephemeral", modify: func(vm *v1alpha1.VirtualMachine) { vm.Spec.Ephemeral = true }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := testVMConfig()
+			tt.modify(stored)
+			lv, sm := newApplyMocks(t, stored)
+			lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+				return domainStateShutoff, 0, nil
+			}
+			sm.volumeExistsFunc = func(ctx context.Context, poolName, volumeName string) (bool, error) {
+				return true, nil
+			}
+
+			desired := testVMConfig()
+			tt.modify(desired)
+			docs := []loader.Document{{Source: "vm.yaml", VM: desired}}
+			if _, err := reconcileWithDeps(context.Background(), docs, lv, sm, newMockMetadataClient(lv)); err != nil {
+				t.Fatalf("reconcileWithDeps() error = %v", err)
+			}
+			if len(lv.domainCreateCalls) != 0 {
+				t.Error("expected VM not to be started")
+			}
+		})
+	}
+}
+
+func TestReconcileWithDeps_ContinuesOnError(t *testing.T) {
+	lv := newMockLibvirtClient()
+	sm := newMockStorageManager()
+
+	docs := []loader.Document{
+		{Source: "bad.yaml", Err: errors.New("validation failed: spec.vcpus must be greater than 0")},
+		{Source: "vm.yaml", VM: testVMConfig()},
+	}
+	actions, err := reconcileWithDeps(context.Background(), docs, lv, sm, newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "bad.yaml: validation failed") {
+		t.Errorf("reconcileWithDeps() error = %v, want bad.yaml error", err)
+	}
+	if got := reconciledActions(actions); !reflect.DeepEqual(got, []string{"test-vm: created"}) {
+		t.Errorf("actions = %v, want the valid VM created", got)
+	}
+}
@@ -0,0 +1,185 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// SetResources changes the vCPUs and memory of an existing VM without a
+// configuration file. A vcpus or memoryGiB of 0 keeps the current value.
+//
+// The change is made like Apply with only these fields edited: the stored spec
+// and persistent definition are updated, and a running VM is changed live
+// (hotplugging vCPUs and ballooning memory) when the new values are within the
+// maxVCPUs and maxMemoryGiB it booted with. Otherwise the result reports that
+// a restart is required.
+func SetResources(ctx context.Context, name string, vcpus, memoryGiB int) (*ApplyResult, error) {
+	client, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			logging.FromContext(ctx).Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(client.Libvirt())
+	metaClient := metadata.NewClient(client.Libvirt())
+
+	return setResourcesWithDeps(ctx, name, vcpus, memoryGiB, client.Libvirt(), storageMgr, metaClient)
+}
+
+// setResourcesWithDeps changes the vCPUs and memory of a VM with injected
+// dependencies.
+func setResourcesWithDeps(ctx context.Context, name string, vcpus, memoryGiB int, lv LibvirtClient, sm storageManager, mc *metadata.Client) (*ApplyResult, error) {
+	if vcpus < 0 || memoryGiB < 0 {
+		return nil, fmt.Errorf("vCPUs and memory must be greater than 0")
+	}
+	if vcpus == 0 && memoryGiB == 0 {
+		return nil, fmt.Errorf("nothing to change: set the vCPUs or the memory")
+	}
+
+	domain, err := lv.DomainLookupByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find VM %s: %w", name, err)
+	}
+	current, err := mc.Load(domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", name, err)
+	}
+
+	desired := current.DeepCopy()
+	if vcpus != 0 {
+		if desired.Spec.MaxVCPUs != 0 && vcpus > desired.Spec.MaxVCPUs {
+			return nil, fmt.Errorf("%d vCPUs exceed spec.maxVCPUs (%d); raise it with 'foundry apply'", vcpus, desired.Spec.MaxVCPUs)
+		}
+		desired.Spec.VCPUs = vcpus
+	}
+	if memoryGiB != 0 {
+		if desired.Spec.MaxMemoryGiB != 0 && memoryGiB > desired.Spec.MaxMemoryGiB {
+			return nil, fmt.Errorf("%dGiB of memory exceeds spec.maxMemoryGiB (%d); raise it with 'foundry apply'", memoryGiB, desired.Spec.MaxMemoryGiB)
+		}
+		desired.Spec.MemoryGiB = memoryGiB
+		desired.Spec.MemoryMiB = 0
+	}
+
+	return applyWithDeps(ctx, desired, lv, sm, mc)
+}
+
+// ResizeOptions controls how Resize changes a VM.
+type ResizeOptions struct {
+	// VCPUs and MemoryGiB are the new values; 0 keeps the current one.
+	VCPUs     int
+	MemoryGiB int
+
+	// Restart restarts a running VM when the change cannot be made live.
+	Restart bool
+
+	// ConfirmRestart is asked whether to restart a running VM when the
+	// change cannot be made live and Restart is not set. Nil means no.
+	ConfirmRestart func() bool
+
+	// Stop controls how the VM is shut down for a restart.
+	Stop StopOptions
+}
+
+// ResizeResult is the outcome of Resize.
+type ResizeResult struct {
+	*ApplyResult
+
+	// Restarted is true if the VM was restarted to apply the change.
+	Restarted bool
+}
+
+// Resize changes the vCPUs and memory of a VM, live when it is running and
+// the new values are within its maxVCPUs and maxMemoryGiB. Otherwise the new
+// values are persisted and, if allowed by opts, the VM is shut down and
+// started again with them.
+//
+// Unlike SetResources, values beyond the maximums raise the maximums, since
+// they take effect at the next boot along with the new values.
+func Resize(ctx context.Context, name string, opts ResizeOptions) (*ResizeResult, error) {
+	client, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			logging.FromContext(ctx).Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(client.Libvirt())
+	metaClient := metadata.NewClient(client.Libvirt())
+
+	return resizeWithDeps(ctx, name, opts, shutdownPollInterval, client.Libvirt(), storageMgr, metaClient)
+}
+
+// resizeWithDeps resizes a VM with injected dependencies, checking its state
+// every poll while it shuts down.
+func resizeWithDeps(ctx context.Context, name string, opts ResizeOptions, poll time.Duration, lv LibvirtClient, sm storageManager, mc *metadata.Client) (*ResizeResult, error) {
+	logger := logging.FromContext(ctx)
+
+	if opts.VCPUs < 0 || opts.MemoryGiB < 0 {
+		return nil, fmt.Errorf("vCPUs and memory must be greater than 0")
+	}
+	if opts.VCPUs == 0 && opts.MemoryGiB == 0 {
+		return nil, fmt.Errorf("nothing to change: set the vCPUs or the memory")
+	}
+
+	domain, err := lv.DomainLookupByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find VM %s: %w", name, err)
+	}
+	current, err := mc.Load(domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", name, err)
+	}
+
+	desired := current.DeepCopy()
+	if opts.VCPUs != 0 {
+		desired.Spec.VCPUs = opts.VCPUs
+		if desired.Spec.MaxVCPUs != 0 && opts.VCPUs > desired.Spec.MaxVCPUs {
+			desired.Spec.MaxVCPUs = opts.VCPUs
+		}
+	}
+	if opts.MemoryGiB != 0 {
+		desired.Spec.MemoryGiB = opts.MemoryGiB
+		desired.Spec.MemoryMiB = 0
+		if desired.Spec.MaxMemoryGiB != 0 && opts.MemoryGiB > desired.Spec.MaxMemoryGiB {
+			desired.Spec.MaxMemoryGiB = opts.MemoryGiB
+		}
+	}
+
+	applied, err := applyWithDeps(ctx, desired, lv, sm, mc)
+	if err != nil {
+		return nil, err
+	}
+	result := &ResizeResult{ApplyResult: applied}
+	if !applied.RestartRequired {
+		return result, nil
+	}
+
+	// Only a running VM can need a restart
+	if !opts.Restart && (opts.ConfirmRestart == nil || !opts.ConfirmRestart()) {
+		return result, nil
+	}
+
+	logger.Info("Restarting VM to apply the new resources", "vm", name)
+	if err := stopWithDeps(ctx, name, opts.Stop, poll, lv); err != nil {
+		return nil, fmt.Errorf("failed to stop VM '%s' for the resize: %w", name, err)
+	}
+	if err := startWithDeps(ctx, name, lv, sm, mc); err != nil {
+		return nil, fmt.Errorf("failed to start VM '%s' after the resize: %w", name, err)
+	}
+	result.RestartRequired = false
+	result.Restarted = true
+	return result, nil
+}
@@ -0,0 +1,190 @@
+package vm
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+func TestSetResourcesWithDeps_Hotplug(t *testing.T) {
+	stored := testVMConfig()
+	stored.Spec.MaxVCPUs = 8
+	stored.Spec.MaxMemoryGiB = 16
+	lv, sm := newApplyMocks(t, stored)
+
+	result, err := setResourcesWithDeps(context.Background(), "test-vm", 4, 8, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("setResourcesWithDeps() error = %v", err)
+	}
+	if len(result.Changes) != 2 {
+		t.Errorf("Changes = %v, want vcpus and memory", result.Changes)
+	}
+	if result.RestartRequired {
+		t.Error("changes within the maximums must not require a restart")
+	}
+	if len(lv.domainSetVcpusFlagsCalls) != 1 || lv.domainSetVcpusFlagsCalls[0] != 4 {
+		t.Errorf("DomainSetVcpusFlags calls = %v, want [4]", lv.domainSetVcpusFlagsCalls)
+	}
+	if len(lv.domainSetMemoryFlagsCalls) != 1 || lv.domainSetMemoryFlagsCalls[0] != 8*1024*1024 {
+		t.Errorf("DomainSetMemoryFlags calls = %v, want [%d]", lv.domainSetMemoryFlagsCalls, 8*1024*1024)
+	}
+
+	loaded, err := newMockMetadataClient(lv).Load(libvirt.Domain{Name: "test-vm"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Spec.VCPUs != 4 || loaded.Spec.MemoryGiB != 8 || loaded.Spec.MaxVCPUs != 8 {
+		t.Errorf("stored spec = %+v, want 4 vCPUs and 8GiB within the maximums", loaded.Spec)
+	}
+}
+
+func TestSetResourcesWithDeps_BeyondMaximum(t *testing.T) {
+	// Without maximums an increase is only persisted
+	stored := testVMConfig()
+	lv, sm := newApplyMocks(t, stored)
+
+	result, err := setResourcesWithDeps(context.Background(), "test-vm", 4, 0, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("setResourcesWithDeps() error = %v", err)
+	}
+	if !result.RestartRequired {
+		t.Error("expected RestartRequired for vCPUs beyond the boot-time maximum")
+	}
+	if len(lv.domainSetVcpusFlagsCalls) != 0 {
+		t.Errorf("DomainSetVcpusFlags calls = %v, want none", lv.domainSetVcpusFlagsCalls)
+	}
+
+	// Explicit maximums are limits
+	stored.Spec.MaxVCPUs = 4
+	lv, sm = newApplyMocks(t, stored)
+	_, err = setResourcesWithDeps(context.Background(), "test-vm", 6, 0, lv, sm, newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "spec.maxVCPUs") {
+		t.Errorf("setResourcesWithDeps() error = %v, want spec.maxVCPUs error", err)
+	}
+}
+
+func TestSetResourcesWithDeps_NothingToChange(t *testing.T) {
+	lv, sm := newApplyMocks(t, testVMConfig())
+
+	_, err := setResourcesWithDeps(context.Background(), "test-vm", 0, 0, lv, sm, newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "nothing to change") {
+		t.Errorf("setResourcesWithDeps() error = %v, want nothing to change", err)
+	}
+}
+
+// newResizeMocks returns apply mocks for a running VM that stops when asked
+// to shut down and runs again when started.
+func newResizeMocks(t *testing.T, stored *v1alpha1.VirtualMachine) (*mockLibvirtClient, *mockStorageManager) {
+	t.Helper()
+
+	lv, sm := newApplyMocks(t, stored)
+	state := int32(domainStateRunning)
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return state, 0, nil
+	}
+	lv.domainShutdownFunc = func(dom libvirt.Domain) error {
+		state = domainStateShutoff
+		return nil
+	}
+	lv.domainCreateFunc = func(dom libvirt.Domain) error {
+		state = domainStateRunning
+		return nil
+	}
+	return lv, sm
+}
+
+func TestResizeWithDeps_Live(t *testing.T) {
+	stored := testVMConfig()
+	stored.Spec.MaxVCPUs = 8
+	lv, sm := newResizeMocks(t, stored)
+
+	opts := ResizeOptions{VCPUs: 4, Restart: true}
+	result, err := resizeWithDeps(context.Background(), "test-vm", opts, time.Millisecond, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("resizeWithDeps() error = %v", err)
+	}
+	if result.RestartRequired || result.Restarted {
+		t.Errorf("RestartRequired = %v, Restarted = %v, want a live change", result.RestartRequired, result.Restarted)
+	}
+	if len(lv.domainSetVcpusFlagsCalls) != 1 {
+		t.Errorf("DomainSetVcpusFlags calls = %v, want one", lv.domainSetVcpusFlagsCalls)
+	}
+	if len(lv.domainShutdownCalls) != 0 || len(lv.domainCreateCalls) != 0 {
+		t.Error("a live change must not restart the VM")
+	}
+}
+
+func TestResizeWithDeps_Restart(t *testing.T) {
+	stored := testVMConfig()
+	stored.Spec.MaxVCPUs = 4
+	lv, sm := newResizeMocks(t, stored)
+	mc := newMockMetadataClient(lv)
+
+	opts := ResizeOptions{VCPUs: 8, MemoryGiB: 16, Restart: true}
+	result, err := resizeWithDeps(context.Background(), "test-vm", opts, time.Millisecond, lv, sm, mc)
+	if err != nil {
+		t.Fatalf("resizeWithDeps() error = %v", err)
+	}
+	if !result.Restarted || result.RestartRequired {
+		t.Errorf("Restarted = %v, RestartRequired = %v, want restarted", result.Restarted, result.RestartRequired)
+	}
+	if len(lv.domainShutdownCalls) != 1 || len(lv.domainCreateCalls) != 1 {
+		t.Errorf("shutdown calls = %d, create calls = %d, want one each", len(lv.domainShutdownCalls), len(lv.domainCreateCalls))
+	}
+
+	loaded, err := mc.Load(libvirt.Domain{Name: "test-vm"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Spec.VCPUs != 8 || loaded.Spec.MaxVCPUs != 8 || loaded.Spec.MemoryGiB != 16 {
+		t.Errorf("stored spec = %+v, want 8 vCPUs (maximum raised) and 16GiB", loaded.Spec)
+	}
+	if loaded.Generation != result.Generation || loaded.Status.ObservedGeneration != result.Generation {
+		t.Errorf("generation = %d, observedGeneration = %d, want both %d", loaded.Generation, loaded.Status.ObservedGeneration, result.Generation)
+	}
+}
+
+func TestResizeWithDeps_RestartDeclined(t *testing.T) {
+	lv, sm := newResizeMocks(t, testVMConfig())
+
+	asked := false
+	opts := ResizeOptions{VCPUs: 4, ConfirmRestart: func() bool {
+		asked = true
+		return false
+	}}
+	result, err := resizeWithDeps(context.Background(), "test-vm", opts, time.Millisecond, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("resizeWithDeps() error = %v", err)
+	}
+	if !asked {
+		t.Error("expected to be asked whether to restart")
+	}
+	if !result.RestartRequired || result.Restarted {
+		t.Errorf("RestartRequired = %v, Restarted = %v, want a pending restart", result.RestartRequired, result.Restarted)
+	}
+	if len(lv.domainShutdownCalls) != 0 {
+		t.Error("a declined restart must not stop the VM")
+	}
+}
+
+func TestResizeWithDeps_Stopped(t *testing.T) {
+	lv, sm := newResizeMocks(t, testVMConfig())
+	lv.domainGetStateFunc = newPowerMock(domainStateShutoff).domainGetStateFunc
+
+	opts := ResizeOptions{VCPUs: 4, Restart: true}
+	result, err := resizeWithDeps(context.Background(), "test-vm", opts, time.Millisecond, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("resizeWithDeps() error = %v", err)
+	}
+	if result.RestartRequired || result.Restarted {
+		t.Errorf("RestartRequired = %v, Restarted = %v, want the change made offline", result.RestartRequired, result.Restarted)
+	}
+	if len(lv.domainCreateCalls) != 0 {
+		t.Error("a stopped VM must stay stopped")
+	}
+}
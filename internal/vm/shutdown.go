@@ -0,0 +1,163 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+)
+
+// shutdownPollInterval is how often ShutdownAll checks whether the VMs have
+// shut down.
+const shutdownPollInterval = time.Second
+
+// ShutdownResult describes how a VM was stopped by ShutdownAll.
+type ShutdownResult struct {
+	// Name is the name of the VM.
+	Name string
+
+	// Timeout is how long the VM was given to shut down.
+	Timeout time.Duration
+
+	// Elapsed is how long the VM took to stop.
+	Elapsed time.Duration
+
+	// Forced is true if the VM did not shut down in time and was forced off.
+	Forced bool
+
+	// Err is set if the VM could not be stopped.
+	Err error
+}
+
+// ShutdownAll gracefully shuts down all running foundry VMs at once, e.g.
+// before the hypervisor reboots. Each VM gets timeout to shut down, or the
+// duration in its shutdown-timeout annotation; VMs still running after that
+// are forced off. Domains not created by foundry are left alone.
+//
+// The returned error lists the VMs that could not be stopped.
+func ShutdownAll(ctx context.Context, timeout time.Duration) ([]ShutdownResult, error) {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	return shutdownAllWithDeps(ctx, timeout, shutdownPollInterval, LibvirtClient.Libvirt(), metaClient)
+}
+
+// shutdownAllWithDeps shuts down all running foundry VMs with injected
+// dependencies, checking their state every poll.
+func shutdownAllWithDeps(ctx context.Context, timeout, poll time.Duration, lv LibvirtClient, mc *metadata.Client) ([]ShutdownResult, error) {
+	logger := logging.FromContext(ctx)
+
+	domains, _, err := lv.ConnectListAllDomains(1, libvirt.ConnectListDomainsActive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list running domains: %w", err)
+	}
+
+	// Ask every VM to shut down first so they all shut down in parallel
+	start := time.Now()
+	var (
+		results []ShutdownResult
+		pending []int
+		doms    []libvirt.Domain
+	)
+	for _, domain := range domains {
+		vm, err := mc.Load(domain)
+		if err != nil {
+			logger.Info("Skipping domain not managed by foundry", "domain", domain.Name)
+			continue
+		}
+
+		result := ShutdownResult{Name: domain.Name, Timeout: shutdownTimeoutFor(ctx, vm, timeout)}
+		logger.Info("Shutting down VM", "vm", domain.Name, "timeout", result.Timeout)
+		if err := lv.DomainShutdown(domain); err != nil {
+			logger.Warn("Graceful shutdown failed, forcing VM off", "vm", domain.Name, "error", err)
+			result.Timeout = 0
+		}
+		results = append(results, result)
+		doms = append(doms, domain)
+		pending = append(pending, len(results)-1)
+	}
+
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	for len(pending) > 0 {
+		elapsed := time.Since(start)
+		var still []int
+		for _, i := range pending {
+			result := &results[i]
+			state, _, err := lv.DomainGetState(doms[i], 0)
+			switch {
+			case err != nil:
+				result.Err = fmt.Errorf("failed to get state: %w", err)
+			case state == domainStateShutoff || state == domainStateCrashed:
+				result.Elapsed = elapsed
+				logger.Info("VM shut down", "vm", result.Name, "elapsed", elapsed.Round(time.Second))
+			case elapsed >= result.Timeout:
+				logger.Warn("VM did not shut down in time, forcing it off", "vm", result.Name, "timeout", result.Timeout)
+				result.Forced = true
+				result.Elapsed = elapsed
+				if err := lv.DomainDestroy(doms[i]); err != nil {
+					result.Err = fmt.Errorf("failed to force off: %w", err)
+				}
+			default:
+				still = append(still, i)
+			}
+		}
+		pending = still
+		if len(pending) == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			for _, i := range pending {
+				results[i].Err = ctx.Err()
+			}
+			pending = nil
+		case <-ticker.C:
+		}
+	}
+
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("VM '%s': %w", result.Name, result.Err))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// shutdownTimeoutFor returns how long vm is given to shut down: the duration
+// in its shutdown-timeout annotation, or def if it has none or it is invalid.
+func shutdownTimeoutFor(ctx context.Context, vm *v1alpha1.VirtualMachine, def time.Duration) time.Duration {
+	value, ok := vm.Annotations[v1alpha1.AnnotationShutdownTimeout]
+	if !ok {
+		return def
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		logging.FromContext(ctx).Warn("Invalid shutdown timeout annotation, using the default", "vm", vm.Name, "annotation", v1alpha1.AnnotationShutdownTimeout, "value", value, "timeout", def)
+		return def
+	}
+	return timeout
+}
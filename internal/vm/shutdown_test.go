@@ -0,0 +1,109 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+func TestShutdownAllWithDeps(t *testing.T) {
+	fast := testVMConfig()
+	fast.Name = "fast"
+	slow := testVMConfig()
+	slow.Name = "slow"
+	slow.Annotations = map[string]string{v1alpha1.AnnotationShutdownTimeout: "0s"}
+	stored := map[string]string{
+		"fast": storedMetadataXML(t, fast),
+		"slow": storedMetadataXML(t, slow),
+	}
+
+	lv := newMockLibvirtClient()
+	lv.connectListAllDomainsFunc = func(needResults int32, flags libvirt.ConnectListAllDomainsFlags) ([]libvirt.Domain, uint32, error) {
+		return []libvirt.Domain{{Name: "fast"}, {Name: "slow"}, {Name: "foreign"}}, 3, nil
+	}
+	lv.domainGetMetadataFunc = func(dom libvirt.Domain, typ int32, uri libvirt.OptString, flags libvirt.DomainModificationImpact) (string, error) {
+		if md, ok := stored[dom.Name]; ok {
+			return md, nil
+		}
+		return "", errors.New("metadata not found")
+	}
+	shutdown := map[string]bool{}
+	lv.domainShutdownFunc = func(dom libvirt.Domain) error {
+		shutdown[dom.Name] = true
+		return nil
+	}
+	// Only "fast" honors the shutdown request
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		if dom.Name == "fast" && shutdown["fast"] {
+			return domainStateShutoff, 0, nil
+		}
+		return domainStateRunning, 0, nil
+	}
+
+	results, err := shutdownAllWithDeps(context.Background(), time.Hour, time.Millisecond, lv, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("shutdownAllWithDeps() error = %v", err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("results = %+v, want fast and slow only", results)
+	}
+	if results[0].Name != "fast" || results[0].Forced || results[0].Timeout != time.Hour {
+		t.Errorf("fast = %+v, want graceful shutdown with the default timeout", results[0])
+	}
+	if results[1].Name != "slow" || !results[1].Forced || results[1].Timeout != 0 {
+		t.Errorf("slow = %+v, want forced off after its annotated timeout", results[1])
+	}
+	if shutdown["foreign"] {
+		t.Error("domain without foundry metadata was shut down")
+	}
+	if len(lv.domainDestroyCalls) != 1 || lv.domainDestroyCalls[0].Name != "slow" {
+		t.Errorf("DomainDestroy calls = %v, want [slow]", lv.domainDestroyCalls)
+	}
+}
+
+func TestShutdownAllWithDeps_ForceFails(t *testing.T) {
+	vm := testVMConfig()
+	lv, _ := newApplyMocks(t, vm)
+	lv.connectListAllDomainsFunc = func(needResults int32, flags libvirt.ConnectListAllDomainsFlags) ([]libvirt.Domain, uint32, error) {
+		return []libvirt.Domain{{Name: vm.Name}}, 1, nil
+	}
+	lv.domainDestroyFunc = func(dom libvirt.Domain) error {
+		return errors.New("destroy failed")
+	}
+
+	results, err := shutdownAllWithDeps(context.Background(), 0, time.Millisecond, lv, newMockMetadataClient(lv))
+	if err == nil {
+		t.Fatal("expected error when a VM cannot be forced off")
+	}
+	if len(results) != 1 || results[0].Err == nil {
+		t.Errorf("results = %+v, want the error recorded", results)
+	}
+}
+
+func TestShutdownTimeoutFor(t *testing.T) {
+	tests := []struct {
+		annotation string
+		want       time.Duration
+	}{
+		{annotation: "", want: 2 * time.Minute},
+		{annotation: "300s", want: 5 * time.Minute},
+		{annotation: "soon", want: 2 * time.Minute},
+		{annotation: "-1s", want: 2 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		vm := testVMConfig()
+		if tt.annotation != "" {
+			vm.Annotations = map[string]string{v1alpha1.AnnotationShutdownTimeout: tt.annotation}
+		}
+		if got := shutdownTimeoutFor(context.Background(), vm, 2*time.Minute); got != tt.want {
+			t.Errorf("shutdownTimeoutFor(%q) = %v, want %v", tt.annotation, got, tt.want)
+		}
+	}
+}
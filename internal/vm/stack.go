@@ -0,0 +1,222 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// StackUpOptions configures StackUp.
+type StackUpOptions struct {
+	// Prune destroys the VMs of the stack that are no longer in it, e.g.
+	// after its name range was shortened.
+	Prune bool
+}
+
+// StackResult is the result of bringing a stack up.
+type StackResult struct {
+	// Applied are the results of applying each VM, in stack order.
+	Applied []*ApplyResult
+
+	// Pruned are the VMs destroyed because they left the stack.
+	Pruned []string
+}
+
+// StackUp creates or updates the VMs of a stack, as loaded by
+// loader.LoadStackFromFile.
+//
+// Bringing a stack up is all or nothing for the VMs it creates: before any
+// change, every existing VM of the same name must belong to the stack, and
+// if a VM fails to apply, the VMs this run created are destroyed again. VMs
+// that already existed keep the changes applied to them.
+func StackUp(ctx context.Context, stack string, vms []*v1alpha1.VirtualMachine, opts StackUpOptions) (*StackResult, error) {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	logger.Debug("Ensuring default storage pools exist")
+	if err := storageMgr.EnsureDefaultPools(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ensure default pools: %w", err)
+	}
+
+	// Journal what is created so a crash mid-creation can be rolled back
+	ctx, endJournal := startJournal(ctx)
+	defer endJournal()
+
+	return stackUpWithDeps(ctx, stack, vms, opts, LibvirtClient.Libvirt(), storageMgr, metaClient)
+}
+
+// stackUpWithDeps brings a stack up with injected dependencies.
+func stackUpWithDeps(ctx context.Context, stack string, vms []*v1alpha1.VirtualMachine, opts StackUpOptions, lv LibvirtClient, sm storageManager, mc *metadata.Client) (*StackResult, error) {
+	logger := logging.FromContext(ctx)
+
+	// Refuse to take over VMs that are not part of the stack before
+	// changing anything
+	for _, vm := range vms {
+		domain, err := lv.DomainLookupByName(vm.Name)
+		if err != nil {
+			continue
+		}
+		current, err := mc.Load(domain)
+		if err != nil {
+			return nil, fmt.Errorf("VM %s already exists and is not managed by foundry", vm.Name)
+		}
+		if owner := current.Labels[v1alpha1.LabelStack]; owner != stack {
+			if owner == "" {
+				return nil, fmt.Errorf("VM %s already exists and is not part of stack %s", vm.Name, stack)
+			}
+			return nil, fmt.Errorf("VM %s already exists and is part of stack %s", vm.Name, owner)
+		}
+	}
+
+	result := &StackResult{}
+	for _, vm := range vms {
+		logger.Info("Applying stack VM", "stack", stack, "vm", vm.Name)
+		applied, err := applyWithDeps(ctx, vm, lv, sm, mc)
+		if err != nil {
+			rollbackStack(ctx, result.Applied, lv, sm)
+			return nil, fmt.Errorf("failed to apply VM %s: %w", vm.Name, err)
+		}
+		result.Applied = append(result.Applied, applied)
+	}
+
+	if !opts.Prune {
+		return result, nil
+	}
+
+	members, err := stackMembers(ctx, stack, lv, mc)
+	if err != nil {
+		return result, err
+	}
+	for _, name := range members {
+		if slices.ContainsFunc(vms, func(vm *v1alpha1.VirtualMachine) bool { return vm.Name == name }) {
+			continue
+		}
+		logger.Info("Pruning VM no longer in stack", "stack", stack, "vm", name)
+		if err := destroyWithDeps(ctx, name, lv, sm); err != nil {
+			return result, fmt.Errorf("failed to prune VM %s: %w", name, err)
+		}
+		result.Pruned = append(result.Pruned, name)
+	}
+
+	return result, nil
+}
+
+// rollbackStack destroys the VMs a failed stack up created, newest first.
+// Rollback is best effort; VMs that cannot be destroyed are logged.
+func rollbackStack(ctx context.Context, applied []*ApplyResult, lv LibvirtClient, sm storageManager) {
+	logger := logging.FromContext(ctx)
+
+	for _, result := range slices.Backward(applied) {
+		if !result.Created {
+			continue
+		}
+		logger.Info("Rolling back stack VM", "vm", result.VMName)
+		if err := destroyWithDeps(ctx, result.VMName, lv, sm); err != nil {
+			logger.Warn("Failed to roll back stack VM", "vm", result.VMName, "error", err)
+		}
+	}
+}
+
+// StackDown destroys every VM of a stack, i.e. every VM labeled with its
+// name. A VM that fails to destroy does not stop the others; the returned
+// error lists it. Returns the names of the destroyed VMs.
+func StackDown(ctx context.Context, stack string) ([]string, error) {
+	logger := logging.FromContext(ctx)
+
+	// Connect to libvirt
+	logger.Debug("Connecting to libvirt")
+	LibvirtClient, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := LibvirtClient.Close(); err != nil {
+			logger.Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	storageMgr := storage.NewManager(LibvirtClient.Libvirt())
+	metaClient := metadata.NewClient(LibvirtClient.Libvirt())
+
+	logger.Debug("Ensuring default storage pools exist")
+	if err := storageMgr.EnsureDefaultPools(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ensure default pools: %w", err)
+	}
+
+	return stackDownWithDeps(ctx, stack, LibvirtClient.Libvirt(), storageMgr, metaClient)
+}
+
+// stackDownWithDeps destroys the VMs of a stack with injected dependencies.
+func stackDownWithDeps(ctx context.Context, stack string, lv LibvirtClient, sm storageManager, mc *metadata.Client) ([]string, error) {
+	logger := logging.FromContext(ctx)
+
+	members, err := stackMembers(ctx, stack, lv, mc)
+	if err != nil {
+		return nil, err
+	}
+
+	var destroyed, failed []string
+	for _, name := range slices.Backward(members) {
+		logger.Info("Destroying stack VM", "stack", stack, "vm", name)
+		if err := destroyWithDeps(ctx, name, lv, sm); err != nil {
+			logger.Error("Failed to destroy stack VM", "vm", name, "error", err)
+			failed = append(failed, name)
+			continue
+		}
+		destroyed = append(destroyed, name)
+	}
+
+	if len(failed) > 0 {
+		return destroyed, fmt.Errorf("failed to destroy %d of %d VM(s) of stack %s: %v", len(failed), len(members), stack, failed)
+	}
+	return destroyed, nil
+}
+
+// stackMembers returns the names of the VMs labeled as part of a stack, in
+// name order.
+func stackMembers(ctx context.Context, stack string, lv LibvirtClient, mc *metadata.Client) ([]string, error) {
+	logger := logging.FromContext(ctx)
+
+	domains, _, err := lv.ConnectListAllDomains(1, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domains: %w", err)
+	}
+
+	var members []string
+	for _, domain := range domains {
+		if !mc.Exists(domain) {
+			continue
+		}
+		vm, err := mc.Load(domain)
+		if err != nil {
+			logger.Warn("Failed to load VM metadata", "domain", domain.Name, "error", err)
+			continue
+		}
+		if vm.Labels[v1alpha1.LabelStack] == stack {
+			members = append(members, domain.Name)
+		}
+	}
+
+	slices.Sort(members)
+	return members, nil
+}
@@ -0,0 +1,233 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+// newStackMocks returns mocks of a hypervisor that keeps the domains
+// defined on it, with their metadata and state, keyed by name.
+func newStackMocks(t *testing.T, existing ...*v1alpha1.VirtualMachine) (*mockLibvirtClient, *mockStorageManager, map[string]string) {
+	t.Helper()
+
+	domainName := regexp.MustCompile(`<name>([^<]+)</name>`)
+	domains := make(map[string]string)
+	states := make(map[string]int32)
+	for _, vm := range existing {
+		domains[vm.Name] = storedMetadataXML(t, vm)
+		states[vm.Name] = domainStateRunning
+	}
+
+	lv := newMockLibvirtClient()
+	lv.connectListAllDomainsFunc = func(needResults int32, flags libvirt.ConnectListAllDomainsFlags) ([]libvirt.Domain, uint32, error) {
+		var list []libvirt.Domain
+		for name := range domains {
+			list = append(list, libvirt.Domain{Name: name})
+		}
+		return list, uint32(len(list)), nil
+	}
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		if _, ok := domains[name]; !ok {
+			return libvirt.Domain{}, fmt.Errorf("domain not found: %s", name)
+		}
+		return libvirt.Domain{Name: name}, nil
+	}
+	lv.domainDefineXMLFunc = func(xml string) (libvirt.Domain, error) {
+		name := domainName.FindStringSubmatch(xml)[1]
+		if _, ok := domains[name]; !ok {
+			domains[name] = ""
+			states[name] = domainStateShutoff
+		}
+		return libvirt.Domain{Name: name}, nil
+	}
+	lv.domainUndefineFlagsFunc = func(dom libvirt.Domain, flags libvirt.DomainUndefineFlagsValues) error {
+		delete(domains, dom.Name)
+		return nil
+	}
+	lv.domainUndefineFunc = func(dom libvirt.Domain) error {
+		delete(domains, dom.Name)
+		return nil
+	}
+	lv.domainGetMetadataFunc = func(dom libvirt.Domain, typ int32, uri libvirt.OptString, flags libvirt.DomainModificationImpact) (string, error) {
+		if domains[dom.Name] == "" {
+			return "", fmt.Errorf("no metadata found")
+		}
+		return domains[dom.Name], nil
+	}
+	lv.domainSetMetadataFunc = func(dom libvirt.Domain, typ int32, md libvirt.OptString, key libvirt.OptString, uri libvirt.OptString, flags libvirt.DomainModificationImpact) error {
+		if len(md) > 0 {
+			domains[dom.Name] = md[0]
+		}
+		return nil
+	}
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		return states[dom.Name], 0, nil
+	}
+	lv.domainCreateFunc = func(dom libvirt.Domain) error {
+		states[dom.Name] = domainStateRunning
+		return nil
+	}
+	lv.domainShutdownFunc = func(dom libvirt.Domain) error {
+		states[dom.Name] = domainStateShutoff
+		return nil
+	}
+
+	return lv, newMockStorageManager(), domains
+}
+
+// testStackVMs returns the VMs of a stack, named <stack>-01 and so on.
+func testStackVMs(stack string, n int) []*v1alpha1.VirtualMachine {
+	vms := make([]*v1alpha1.VirtualMachine, n)
+	for i := range vms {
+		vm := testVMConfig()
+		vm.Name = fmt.Sprintf("%s-%02d", stack, i+1)
+		vm.Labels = map[string]string{v1alpha1.LabelStack: stack}
+		vm.Spec.NetworkInterfaces[0].IP = fmt.Sprintf("10.0.0.%d/24", 10+i)
+		vms[i] = vm
+	}
+	return vms
+}
+
+// domainNames returns the sorted names of the domains.
+func domainNames(domains map[string]string) []string {
+	var names []string
+	for name := range domains {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestStackUpWithDeps_CreatesVMs(t *testing.T) {
+	lv, sm, domains := newStackMocks(t)
+
+	result, err := stackUpWithDeps(context.Background(), "web", testStackVMs("web", 3), StackUpOptions{}, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("stackUpWithDeps() error = %v", err)
+	}
+	if len(result.Applied) != 3 {
+		t.Fatalf("Applied = %d results, want 3", len(result.Applied))
+	}
+	for _, applied := range result.Applied {
+		if !applied.Created {
+			t.Errorf("VM %s was not created", applied.VMName)
+		}
+	}
+	if got := strings.Join(domainNames(domains), ","); got != "web-01,web-02,web-03" {
+		t.Errorf("domains = %s, want web-01,web-02,web-03", got)
+	}
+}
+
+func TestStackUpWithDeps_RollsBackCreatedVMs(t *testing.T) {
+	existing := testStackVMs("web", 1)[0]
+	lv, sm, domains := newStackMocks(t, existing)
+	createDomain := lv.domainCreateFunc
+	lv.domainCreateFunc = func(dom libvirt.Domain) error {
+		if dom.Name == "web-03" {
+			return fmt.Errorf("out of memory")
+		}
+		return createDomain(dom)
+	}
+
+	_, err := stackUpWithDeps(context.Background(), "web", testStackVMs("web", 3), StackUpOptions{}, lv, sm, newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "failed to apply VM web-03") {
+		t.Fatalf("stackUpWithDeps() error = %v, want web-03 to fail", err)
+	}
+
+	// web-02 was created by this run and is rolled back; web-01 existed
+	// before and is kept
+	if got := strings.Join(domainNames(domains), ","); got != "web-01" {
+		t.Errorf("domains = %s, want only web-01", got)
+	}
+}
+
+func TestStackUpWithDeps_RefusesForeignVMs(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		wantErr string
+	}{
+		{"unlabeled", nil, "VM web-02 already exists and is not part of stack web"},
+		{"other stack", map[string]string{v1alpha1.LabelStack: "api"}, "VM web-02 already exists and is part of stack api"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			foreign := testVMConfig()
+			foreign.Name = "web-02"
+			foreign.Labels = tt.labels
+			lv, sm, domains := newStackMocks(t, foreign)
+
+			_, err := stackUpWithDeps(context.Background(), "web", testStackVMs("web", 3), StackUpOptions{}, lv, sm, newMockMetadataClient(lv))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("stackUpWithDeps() error = %v, want %q", err, tt.wantErr)
+			}
+			if len(lv.domainDefineXMLCalls) != 0 || len(domains) != 1 {
+				t.Error("expected no changes before the check")
+			}
+		})
+	}
+}
+
+func TestStackUpWithDeps_Prune(t *testing.T) {
+	other := testStackVMs("api", 1)[0]
+	lv, sm, domains := newStackMocks(t, append(testStackVMs("web", 3), other)...)
+
+	result, err := stackUpWithDeps(context.Background(), "web", testStackVMs("web", 2), StackUpOptions{Prune: true}, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("stackUpWithDeps() error = %v", err)
+	}
+	if !slices.Equal(result.Pruned, []string{"web-03"}) {
+		t.Errorf("Pruned = %v, want [web-03]", result.Pruned)
+	}
+	if got := strings.Join(domainNames(domains), ","); got != "api-01,web-01,web-02" {
+		t.Errorf("domains = %s, want api-01,web-01,web-02", got)
+	}
+}
+
+func TestStackDownWithDeps(t *testing.T) {
+	unlabeled := testVMConfig()
+	unlabeled.Name = "web-04"
+	vms := append(testStackVMs("web", 3), testStackVMs("api", 1)[0], unlabeled)
+	lv, sm, domains := newStackMocks(t, vms...)
+
+	destroyed, err := stackDownWithDeps(context.Background(), "web", lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("stackDownWithDeps() error = %v", err)
+	}
+	if !slices.Equal(destroyed, []string{"web-03", "web-02", "web-01"}) {
+		t.Errorf("destroyed = %v, want web-03, web-02, web-01", destroyed)
+	}
+	if got := strings.Join(domainNames(domains), ","); got != "api-01,web-04" {
+		t.Errorf("domains = %s, want api-01,web-04", got)
+	}
+}
+
+func TestStackDownWithDeps_ContinuesPastFailures(t *testing.T) {
+	lv, sm, domains := newStackMocks(t, testStackVMs("web", 3)...)
+	undefine := lv.domainUndefineFlagsFunc
+	lv.domainUndefineFlagsFunc = func(dom libvirt.Domain, flags libvirt.DomainUndefineFlagsValues) error {
+		if dom.Name == "web-02" {
+			return fmt.Errorf("permission denied")
+		}
+		return undefine(dom, flags)
+	}
+
+	destroyed, err := stackDownWithDeps(context.Background(), "web", lv, sm, newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "failed to destroy 1 of 3 VM(s) of stack web: [web-02]") {
+		t.Fatalf("stackDownWithDeps() error = %v", err)
+	}
+	if !slices.Equal(destroyed, []string{"web-03", "web-01"}) {
+		t.Errorf("destroyed = %v, want web-03, web-01", destroyed)
+	}
+	if got := strings.Join(domainNames(domains), ","); got != "web-02" {
+		t.Errorf("domains = %s, want web-02", got)
+	}
+}
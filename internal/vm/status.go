@@ -0,0 +1,39 @@
+package vm
+
+import (
+	"context"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+)
+
+// recordStatus stores the current status of a domain in its foundry
+// metadata, so that the phase and the transition times of its conditions
+// persist between commands. Domains foundry does not manage are left alone.
+//
+// Recording is best effort: the operation that changed the domain's state has
+// already succeeded, so failures are only logged.
+func recordStatus(ctx context.Context, lv LibvirtClient, domain libvirt.Domain) {
+	logger := logging.FromContext(ctx)
+
+	mc := metadata.NewClient(lv)
+	if !mc.Exists(domain) {
+		return
+	}
+
+	state, _, err := lv.DomainGetState(domain, 0)
+	if err != nil {
+		logger.Warn("Failed to get VM state for its status", "vm", domain.Name, "error", err)
+		return
+	}
+
+	err = mc.UpdateStatus(domain, func(vm *v1alpha1.VirtualMachine) {
+		setStatus(vm, domain, state)
+	})
+	if err != nil {
+		logger.Warn("Failed to store VM status", "vm", domain.Name, "error", err)
+	}
+}
@@ -0,0 +1,63 @@
+package vm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/status"
+)
+
+func TestRecordStatus_StartAndStop(t *testing.T) {
+	stored := testVMConfig()
+	stored.Generation = 3
+	lv, sm := newResizeMocks(t, stored)
+	mc := newMockMetadataClient(lv)
+	domain := libvirt.Domain{Name: "test-vm"}
+
+	if err := stopWithDeps(context.Background(), "test-vm", StopOptions{}, time.Millisecond, lv); err != nil {
+		t.Fatalf("stopWithDeps() error = %v", err)
+	}
+	loaded, err := mc.Load(domain)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Status.Phase != v1alpha1.VMPhaseStopped || !status.IsConditionFalse(loaded, v1alpha1.ConditionReady) {
+		t.Errorf("status after stop = %+v, want Stopped and not Ready", loaded.Status)
+	}
+	if loaded.Generation != 3 {
+		t.Errorf("Generation = %d, recording status must not change it", loaded.Generation)
+	}
+	stoppedAt := status.GetCondition(loaded, v1alpha1.ConditionReady).LastTransitionTime
+
+	if err := startWithDeps(context.Background(), "test-vm", lv, sm, mc); err != nil {
+		t.Fatalf("startWithDeps() error = %v", err)
+	}
+	loaded, err = mc.Load(domain)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Status.Phase != v1alpha1.VMPhaseRunning || !status.IsConditionTrue(loaded, v1alpha1.ConditionReady) {
+		t.Errorf("status after start = %+v, want Running and Ready", loaded.Status)
+	}
+	if len(loaded.Status.MACAddresses) != 1 {
+		t.Errorf("MACAddresses = %v, want the interface's MAC", loaded.Status.MACAddresses)
+	}
+	if ready := status.GetCondition(loaded, v1alpha1.ConditionReady); ready.LastTransitionTime.Before(stoppedAt.Time) {
+		t.Errorf("Ready transition time %v is before the stop at %v", ready.LastTransitionTime, stoppedAt)
+	}
+}
+
+func TestRecordStatus_UnmanagedDomain(t *testing.T) {
+	lv := newPowerMock(domainStateRunning)
+
+	if err := stopWithDeps(context.Background(), "test-vm", StopOptions{Force: true}, time.Millisecond, lv); err != nil {
+		t.Fatalf("stopWithDeps() error = %v", err)
+	}
+	if len(lv.domainSetMetadataCalls) != 0 {
+		t.Errorf("DomainSetMetadata calls = %d, want none for a domain without foundry metadata", len(lv.domainSetMetadataCalls))
+	}
+}
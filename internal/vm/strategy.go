@@ -0,0 +1,70 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/naming"
+)
+
+// namingStrategy returns the naming strategy recorded on the VM. VMs that
+// don't record one (created by older versions) use the ip-derived defaults.
+func namingStrategy(vm *v1alpha1.VirtualMachine) naming.Strategy {
+	strategy := naming.Strategy{
+		MAC:           naming.MACStrategy(vm.Annotations[v1alpha1.AnnotationMACStrategy]),
+		OUI:           vm.Annotations[v1alpha1.AnnotationMACOUI],
+		InterfaceName: naming.InterfaceNameStrategy(vm.Annotations[v1alpha1.AnnotationInterfaceNameStrategy]),
+	}
+	return strategy.WithDefaults()
+}
+
+// recordNamingStrategy records the default naming strategy on a new VM,
+// unless it already records one (e.g. copied from the VM it was cloned
+// from), so the VM keeps deriving the same MACs and interface names if the
+// default changes.
+func recordNamingStrategy(vm *v1alpha1.VirtualMachine) {
+	if vm.Annotations == nil {
+		vm.Annotations = make(map[string]string)
+	}
+	strategy := naming.DefaultStrategy()
+	if _, ok := vm.Annotations[v1alpha1.AnnotationMACStrategy]; !ok {
+		vm.Annotations[v1alpha1.AnnotationMACStrategy] = string(strategy.MAC)
+		if strategy.OUI != "" {
+			vm.Annotations[v1alpha1.AnnotationMACOUI] = strategy.OUI
+		}
+	}
+	if _, ok := vm.Annotations[v1alpha1.AnnotationInterfaceNameStrategy]; !ok {
+		vm.Annotations[v1alpha1.AnnotationInterfaceNameStrategy] = string(strategy.InterfaceName)
+	}
+}
+
+// assignMACAddresses records the naming strategy of a new VM and the MAC
+// addresses it generates for interfaces that don't configure one: random
+// ones for DHCP interfaces, which have no IP to derive them from, and every
+// interface's under the random-persisted and oui-prefixed strategies. They
+// are stored with the rest of the spec so the VM keeps them for its
+// lifetime.
+func assignMACAddresses(vm *v1alpha1.VirtualMachine) error {
+	recordNamingStrategy(vm)
+	strategy := namingStrategy(vm)
+	for i := range vm.Spec.NetworkInterfaces {
+		if err := assignMACAddress(strategy, &vm.Spec.NetworkInterfaces[i]); err != nil {
+			return fmt.Errorf("spec.networkInterfaces[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// assignMACAddress records the MAC address strategy generates for an
+// interface that does not configure one.
+func assignMACAddress(strategy naming.Strategy, iface *v1alpha1.NetworkInterfaceSpec) error {
+	if iface.MACAddress != "" {
+		return nil
+	}
+	mac, err := strategy.GenerateMAC(iface.IP, iface.IPv6, iface.DHCP)
+	if err != nil {
+		return fmt.Errorf("failed to generate MAC address: %w", err)
+	}
+	iface.MACAddress = mac
+	return nil
+}
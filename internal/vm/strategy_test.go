@@ -0,0 +1,118 @@
+package vm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	"github.com/jbweber/foundry/internal/naming"
+)
+
+// useNamingStrategy sets the default naming strategy for the test.
+func useNamingStrategy(t *testing.T, strategy naming.Strategy) {
+	t.Helper()
+	naming.SetDefaultStrategy(strategy)
+	t.Cleanup(func() { naming.SetDefaultStrategy(naming.Strategy{}) })
+}
+
+func TestCreateFromConfigWithDeps_RecordsDefaultNamingStrategy(t *testing.T) {
+	vm := testVMConfig()
+	lv := newMockLibvirtClient()
+
+	if err := createFromConfigWithDeps(context.Background(), vm, lv, newMockStorageManager(), newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("createFromConfigWithDeps() error = %v", err)
+	}
+	if got := vm.Annotations[v1alpha1.AnnotationMACStrategy]; got != string(naming.MACStrategyIPDerived) {
+		t.Errorf("MAC strategy = %q, want ip-derived", got)
+	}
+	if got := vm.Annotations[v1alpha1.AnnotationInterfaceNameStrategy]; got != string(naming.InterfaceNameStrategyIPDerived) {
+		t.Errorf("interface name strategy = %q, want ip-derived", got)
+	}
+	if _, ok := vm.Annotations[v1alpha1.AnnotationMACOUI]; ok {
+		t.Error("OUI recorded for the ip-derived strategy")
+	}
+	// Static interfaces keep deriving their MAC from the IP
+	if got := vm.Spec.NetworkInterfaces[0].MACAddress; got != "" {
+		t.Errorf("MACAddress = %q, want none recorded", got)
+	}
+}
+
+func TestCreateFromConfigWithDeps_OUIPrefixedStrategy(t *testing.T) {
+	useNamingStrategy(t, naming.Strategy{
+		MAC:           naming.MACStrategyOUIPrefixed,
+		OUI:           "52:54:00",
+		InterfaceName: naming.InterfaceNameStrategyMACDerived,
+	})
+	vm := testVMConfig()
+	lv := newMockLibvirtClient()
+
+	if err := createFromConfigWithDeps(context.Background(), vm, lv, newMockStorageManager(), newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("createFromConfigWithDeps() error = %v", err)
+	}
+	if got := vm.Spec.NetworkInterfaces[0].MACAddress; got != "52:54:00:00:00:0a" {
+		t.Errorf("MACAddress = %q, want 52:54:00:00:00:0a", got)
+	}
+	if got := vm.Annotations[v1alpha1.AnnotationMACOUI]; got != "52:54:00" {
+		t.Errorf("OUI annotation = %q", got)
+	}
+	if len(lv.domainDefineXMLCalls) == 0 {
+		t.Fatal("domain not defined")
+	}
+	xml := lv.domainDefineXMLCalls[0]
+	if !strings.Contains(xml, "52:54:00:00:00:0a") || !strings.Contains(xml, `dev="vm0000000a"`) {
+		t.Errorf("domain XML does not use the generated MAC and MAC-derived name:\n%s", xml)
+	}
+}
+
+func TestCreateFromConfigWithDeps_KeepsRecordedNamingStrategy(t *testing.T) {
+	useNamingStrategy(t, naming.Strategy{MAC: naming.MACStrategyRandomPersisted})
+	vm := testVMConfig()
+	vm.Annotations = map[string]string{
+		v1alpha1.AnnotationMACStrategy:           string(naming.MACStrategyIPDerived),
+		v1alpha1.AnnotationInterfaceNameStrategy: string(naming.InterfaceNameStrategyIPDerived),
+	}
+	lv := newMockLibvirtClient()
+
+	if err := createFromConfigWithDeps(context.Background(), vm, lv, newMockStorageManager(), newMockMetadataClient(lv)); err != nil {
+		t.Fatalf("createFromConfigWithDeps() error = %v", err)
+	}
+	if got := vm.Annotations[v1alpha1.AnnotationMACStrategy]; got != string(naming.MACStrategyIPDerived) {
+		t.Errorf("MAC strategy = %q, want the recorded ip-derived", got)
+	}
+	if got := vm.Spec.NetworkInterfaces[0].MACAddress; got != "" {
+		t.Errorf("MACAddress = %q, want none recorded", got)
+	}
+}
+
+func TestCreateFromConfigWithDeps_InvalidRecordedStrategy(t *testing.T) {
+	vm := testVMConfig()
+	vm.Annotations = map[string]string{v1alpha1.AnnotationMACStrategy: string(naming.MACStrategyOUIPrefixed)}
+	lv := newMockLibvirtClient()
+
+	err := createFromConfigWithDeps(context.Background(), vm, lv, newMockStorageManager(), newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "OUI is required") {
+		t.Errorf("createFromConfigWithDeps() error = %v, want missing OUI", err)
+	}
+}
+
+func TestApplyWithDeps_KeepsStrategyGeneratedMAC(t *testing.T) {
+	// The strategy of the stored VM applies, not the current default
+	useNamingStrategy(t, naming.Strategy{})
+	stored := testVMConfig()
+	stored.Annotations = map[string]string{v1alpha1.AnnotationMACStrategy: string(naming.MACStrategyRandomPersisted)}
+	stored.Spec.NetworkInterfaces[0].MACAddress = "be:ee:12:34:56:78"
+	lv, sm := newApplyMocks(t, stored)
+
+	desired := testVMConfig()
+	result, err := applyWithDeps(context.Background(), desired, lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyWithDeps() error = %v", err)
+	}
+	if len(result.Changes) != 0 {
+		t.Errorf("expected no changes, got %v", result.Changes)
+	}
+	if got := desired.Spec.NetworkInterfaces[0].MACAddress; got != "be:ee:12:34:56:78" {
+		t.Errorf("MACAddress = %q, want the stored one", got)
+	}
+}
@@ -0,0 +1,138 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+
+	"libvirt.org/go/libvirtxml"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+// DiskVolume is a disk attached to a VM and the storage volume behind it.
+type DiskVolume struct {
+	// Device is the disk's target device, e.g. vda.
+	Device string `json:"device" yaml:"device"`
+
+	// Bus is the bus the disk is attached to, e.g. virtio or sata.
+	Bus string `json:"bus" yaml:"bus"`
+
+	// VolumeInfo describes the volume. Its Type is boot, data or cloudinit
+	// for the disks of the stored spec and empty for disks attached outside
+	// foundry; only Path is set for files outside every storage pool.
+	storage.VolumeInfo `yaml:",inline"`
+
+	// BackingVolume is the backing file as pool/volume, if it is a volume.
+	BackingVolume string `json:"backingVolume,omitempty" yaml:"backingVolume,omitempty"`
+}
+
+// ListVolumes returns the disks of a VM, in the order of its domain XML,
+// with the pools and volumes holding them, their capacity and allocation and
+// backing files. For a running VM this includes hot-plugged disks.
+func ListVolumes(ctx context.Context, vmName string) ([]DiskVolume, error) {
+	client, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			logging.FromContext(ctx).Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	return listVolumesWithDeps(ctx, vmName, client.Libvirt(), storage.NewManager(client.Libvirt()), metadata.NewClient(client.Libvirt()))
+}
+
+// listVolumesWithDeps returns the disks of a VM with injected dependencies.
+func listVolumesWithDeps(ctx context.Context, vmName string, lv LibvirtClient, sm storageManager, mc *metadata.Client) ([]DiskVolume, error) {
+	domain, err := lv.DomainLookupByName(vmName)
+	if err != nil {
+		return nil, fmt.Errorf("VM '%s' not found: %w", vmName, err)
+	}
+
+	vm, err := mc.Load(domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", vmName, err)
+	}
+
+	xmlDesc, err := lv.DomainGetXMLDesc(domain, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain XML: %w", err)
+	}
+	var domainDef libvirtxml.Domain
+	if err := domainDef.Unmarshal(xmlDesc); err != nil {
+		return nil, fmt.Errorf("failed to parse domain XML: %w", err)
+	}
+	if domainDef.Devices == nil {
+		return nil, nil
+	}
+
+	types := volumeTypes(vm)
+	var volumes []DiskVolume
+	for _, disk := range domainDef.Devices.Disks {
+		if disk.Target == nil {
+			continue
+		}
+		volume := DiskVolume{Device: disk.Target.Dev, Bus: disk.Target.Bus}
+
+		path, err := diskSourcePath(ctx, &disk, sm)
+		if err != nil {
+			return nil, fmt.Errorf("disk %s: %w", volume.Device, err)
+		}
+		volume.Path = path
+
+		// Files outside every pool are listed by path alone
+		if path != "" {
+			if info, err := sm.GetVolumeInfoByPath(ctx, path); err == nil {
+				volume.VolumeInfo = *info
+			}
+		}
+		if volume.Name != "" && volume.Pool == getStoragePool(vm) {
+			volume.Type = types[volume.Name]
+		}
+		if volume.Backing != "" {
+			if backing, err := sm.GetVolumeInfoByPath(ctx, volume.Backing); err == nil {
+				volume.BackingVolume = backing.Pool + "/" + backing.Name
+			}
+		}
+
+		volumes = append(volumes, volume)
+	}
+	return volumes, nil
+}
+
+// volumeTypes maps the names of the volumes foundry creates for vm to their
+// types.
+func volumeTypes(vm *v1alpha1.VirtualMachine) map[string]storage.VolumeType {
+	types := map[string]storage.VolumeType{
+		getBootVolumeName(vm):      storage.VolumeTypeBoot,
+		getCloudInitVolumeName(vm): storage.VolumeTypeCloudInit,
+	}
+	for _, disk := range vm.Spec.DataDisks {
+		types[getDataVolumeName(vm, disk.Device)] = storage.VolumeTypeData
+	}
+	return types
+}
+
+// diskSourcePath returns the path of the file or block device behind a
+// disk, resolving pool volumes to their path. Disks without a source, such
+// as empty CD-ROM drives, have no path.
+func diskSourcePath(ctx context.Context, disk *libvirtxml.DomainDisk, sm storageManager) (string, error) {
+	src := disk.Source
+	switch {
+	case src == nil:
+		return "", nil
+	case src.File != nil:
+		return src.File.File, nil
+	case src.Block != nil:
+		return src.Block.Dev, nil
+	case src.Volume != nil:
+		return sm.GetVolumePath(ctx, src.Volume.Pool, src.Volume.Volume)
+	default:
+		return "", nil
+	}
+}
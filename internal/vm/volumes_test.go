@@ -0,0 +1,74 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/internal/storage"
+)
+
+func TestListVolumesWithDeps(t *testing.T) {
+	stored := testVMConfigWithDataDisks()
+	lv, sm := newApplyMocks(t, stored)
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		return `<domain type='kvm'><name>test-vm</name><devices>
+  <disk type='volume' device='disk'><source pool='foundry-vms' volume='test-vm_boot.qcow2'/><target dev='vda' bus='virtio'/></disk>
+  <disk type='volume' device='disk'><source pool='foundry-vms' volume='test-vm_data-vdb.qcow2'/><target dev='vdb' bus='scsi'/></disk>
+  <disk type='file' device='disk'><source file='/srv/scratch.img'/><target dev='vdd' bus='virtio'/></disk>
+  <disk type='file' device='cdrom'><target dev='sdb' bus='sata'/></disk>
+</devices></domain>`, nil
+	}
+
+	const vmsDir = "/var/lib/libvirt/images/foundry/foundry-vms/"
+	const imagePath = "/var/lib/libvirt/images/foundry/foundry-images/fedora-43.qcow2"
+	volumes := map[string]*storage.VolumeInfo{
+		vmsDir + "test-vm_boot.qcow2":     {Name: "test-vm_boot.qcow2", Pool: "foundry-vms", Format: storage.VolumeFormatQCOW2, Capacity: 20 * gib, Allocation: 2 * gib, Backing: imagePath},
+		vmsDir + "test-vm_data-vdb.qcow2": {Name: "test-vm_data-vdb.qcow2", Pool: "foundry-vms", Format: storage.VolumeFormatQCOW2, Capacity: 50 * gib},
+		imagePath:                         {Name: "fedora-43.qcow2", Pool: "foundry-images", Format: storage.VolumeFormatQCOW2},
+	}
+	sm.getVolumeInfoByPathFunc = func(ctx context.Context, path string) (*storage.VolumeInfo, error) {
+		info, ok := volumes[path]
+		if !ok {
+			return nil, fmt.Errorf("no storage pool volume at %s", path)
+		}
+		found := *info
+		found.Path = path
+		return &found, nil
+	}
+
+	got, err := listVolumesWithDeps(context.Background(), "test-vm", lv, sm, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("listVolumesWithDeps() error = %v", err)
+	}
+	if len(got) != 4 {
+		t.Fatalf("listVolumesWithDeps() returned %d disks, want 4: %+v", len(got), got)
+	}
+
+	boot := got[0]
+	if boot.Device != "vda" || boot.Bus != "virtio" || boot.Type != storage.VolumeTypeBoot ||
+		boot.Capacity != 20*gib || boot.Allocation != 2*gib || boot.BackingVolume != "foundry-images/fedora-43.qcow2" {
+		t.Errorf("boot disk = %+v", boot)
+	}
+	if data := got[1]; data.Device != "vdb" || data.Bus != "scsi" || data.Type != storage.VolumeTypeData || data.BackingVolume != "" {
+		t.Errorf("data disk = %+v", data)
+	}
+	if outside := got[2]; outside.Path != "/srv/scratch.img" || outside.Pool != "" || outside.Type != "" {
+		t.Errorf("disk outside the pools = %+v", outside)
+	}
+	if cdrom := got[3]; cdrom.Device != "sdb" || cdrom.Path != "" {
+		t.Errorf("empty CD-ROM = %+v", cdrom)
+	}
+}
+
+func TestListVolumesWithDeps_NotFound(t *testing.T) {
+	lv := newMockLibvirtClient()
+
+	_, err := listVolumesWithDeps(context.Background(), "missing", lv, newMockStorageManager(), newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "VM 'missing' not found") {
+		t.Errorf("listVolumesWithDeps() error = %v, want not found", err)
+	}
+}
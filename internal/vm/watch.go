@@ -0,0 +1,143 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+)
+
+// watchPollInterval is how often WatchVMs lists the VMs between lifecycle
+// events, to pick up changes libvirt sends no event for, such as addresses
+// leased over DHCP, and all changes if events are unavailable.
+const watchPollInterval = 5 * time.Second
+
+// WatchEventType is the kind of change reported by WatchVMs.
+type WatchEventType string
+
+const (
+	// WatchAdded is reported for every VM when the watch starts and for VMs
+	// defined later.
+	WatchAdded WatchEventType = "ADDED"
+
+	// WatchModified is reported when a VM's phase, addresses or stored spec
+	// change.
+	WatchModified WatchEventType = "MODIFIED"
+
+	// WatchDeleted is reported when a VM is undefined, with its last state.
+	WatchDeleted WatchEventType = "DELETED"
+)
+
+// WatchEvent is a change to a VM.
+type WatchEvent struct {
+	Type WatchEventType
+	VM   *v1alpha1.VirtualMachine
+}
+
+// WatchVMs calls fn with every VM, as ListVMs returns them, and then with
+// the changes to them until ctx is cancelled. Each call holds the changes
+// found by one listing; the first, which adds every VM, is made even if
+// there are none. Lifecycle events trigger an immediate update; the VMs are
+// also listed periodically, which is all that is left if the hypervisor
+// cannot deliver events.
+func WatchVMs(ctx context.Context, fn func([]WatchEvent)) error {
+	client, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			logging.FromContext(ctx).Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	return watchVMsWithDeps(ctx, client.Libvirt(), watchPollInterval, fn)
+}
+
+// watchVMsWithDeps watches VMs with injected dependencies. It returns nil
+// when ctx is cancelled and an error if the VMs cannot be listed.
+func watchVMsWithDeps(ctx context.Context, lv LibvirtClient, poll time.Duration, fn func([]WatchEvent)) error {
+	logger := logging.FromContext(ctx)
+
+	events, err := lv.SubscribeEvents(ctx, libvirt.DomainEventIDLifecycle, libvirt.OptDomain{})
+	if err != nil {
+		logger.Warn("Lifecycle events unavailable, polling for changes", "interval", poll, "error", err)
+		events = nil
+	}
+
+	known := make(map[string]*v1alpha1.VirtualMachine)
+	update := func(first bool) error {
+		vms, err := listVMsWithDeps(ctx, lv)
+		if err != nil {
+			return err
+		}
+		var changes []WatchEvent
+		seen := make(map[string]bool, len(vms))
+		for _, vm := range vms {
+			seen[vm.Name] = true
+			previous, ok := known[vm.Name]
+			known[vm.Name] = vm
+			switch {
+			case !ok:
+				changes = append(changes, WatchEvent{Type: WatchAdded, VM: vm})
+			case watchFingerprint(previous) != watchFingerprint(vm):
+				changes = append(changes, WatchEvent{Type: WatchModified, VM: vm})
+			}
+		}
+		for name, vm := range known {
+			if !seen[name] {
+				delete(known, name)
+				changes = append(changes, WatchEvent{Type: WatchDeleted, VM: vm})
+			}
+		}
+		if first || len(changes) > 0 {
+			fn(changes)
+		}
+		return nil
+	}
+
+	if err := update(true); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-events:
+			if !ok {
+				if ctx.Err() != nil {
+					return nil
+				}
+				logger.Warn("Lifecycle event stream closed, polling for changes", "interval", poll)
+				events = nil
+				continue
+			}
+		case <-ticker.C:
+		}
+		if err := update(false); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// watchFingerprint summarizes what WatchVMs reports changes of: the phase,
+// the addresses and the generation of the stored spec.
+func watchFingerprint(vm *v1alpha1.VirtualMachine) string {
+	addresses := make([]string, 0, len(vm.Status.Addresses))
+	for _, addr := range vm.Status.Addresses {
+		addresses = append(addresses, addr.Address)
+	}
+	return fmt.Sprintf("%s|%d|%s", vm.Status.Phase, vm.Generation, strings.Join(addresses, ","))
+}
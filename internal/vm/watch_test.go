@@ -0,0 +1,135 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+)
+
+// newWatchMocks serves shut off domains whose states can be changed by the
+// watch callback through the returned map.
+func newWatchMocks(names ...string) (*mockLibvirtClient, map[string]int32) {
+	states := make(map[string]int32)
+	for _, name := range names {
+		states[name] = 5 // shutoff
+	}
+
+	lv := newMockLibvirtClient()
+	lv.connectListAllDomainsFunc = func(needResults int32, flags libvirt.ConnectListAllDomainsFlags) ([]libvirt.Domain, uint32, error) {
+		var domains []libvirt.Domain
+		for _, name := range names {
+			if _, ok := states[name]; ok {
+				domains = append(domains, libvirt.Domain{Name: name})
+			}
+		}
+		return domains, uint32(len(domains)), nil
+	}
+	lv.domainGetStateFunc = func(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+		state, ok := states[dom.Name]
+		if !ok {
+			return 0, 0, fmt.Errorf("domain not found: %s", dom.Name)
+		}
+		return state, 0, nil
+	}
+	return lv, states
+}
+
+func TestWatchVMsWithDeps(t *testing.T) {
+	lv, states := newWatchMocks("a", "b")
+	events := make(chan interface{}, 1)
+	lv.subscribeEventsFunc = func(ctx context.Context, eventID libvirt.DomainEventID, dom libvirt.OptDomain) (<-chan interface{}, error) {
+		return events, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got []string
+	err := watchVMsWithDeps(ctx, lv, time.Hour, func(changes []WatchEvent) {
+		var batch []string
+		for _, ev := range changes {
+			batch = append(batch, fmt.Sprintf("%s %s %s", ev.Type, ev.VM.Name, ev.VM.Status.Phase))
+		}
+		got = append(got, strings.Join(batch, ", "))
+		switch len(got) {
+		case 1:
+			// a crashes and b is undefined
+			states["a"] = 6
+			delete(states, "b")
+			events <- lifecycleMsg("a", libvirt.DomainEventCrashed, 0)
+		case 2:
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatalf("watchVMsWithDeps() error = %v", err)
+	}
+
+	want := []string{
+		"ADDED a Stopped, ADDED b Stopped",
+		"MODIFIED a Failed, DELETED b Stopped",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
+
+func TestWatchVMsWithDeps_PollsWithoutEvents(t *testing.T) {
+	lv, states := newWatchMocks("a")
+	lv.subscribeEventsFunc = func(ctx context.Context, eventID libvirt.DomainEventID, dom libvirt.OptDomain) (<-chan interface{}, error) {
+		return nil, fmt.Errorf("events not supported")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var got []WatchEvent
+	err := watchVMsWithDeps(ctx, lv, 10*time.Millisecond, func(changes []WatchEvent) {
+		got = append(got, changes...)
+		if len(got) == 1 {
+			states["a"] = 6
+		} else {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatalf("watchVMsWithDeps() error = %v", err)
+	}
+	if len(got) != 2 || got[1].Type != WatchModified || got[1].VM.Status.Phase != v1alpha1.VMPhaseFailed {
+		t.Errorf("events = %+v, want ADDED then MODIFIED to Failed", got)
+	}
+}
+
+func TestWatchVMsWithDeps_NoVMs(t *testing.T) {
+	lv := newMockLibvirtClient()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	err := watchVMsWithDeps(ctx, lv, time.Hour, func(changes []WatchEvent) {
+		calls++
+		if len(changes) != 0 {
+			t.Errorf("changes = %+v, want none", changes)
+		}
+		cancel()
+	})
+	if err != nil || calls != 1 {
+		t.Errorf("watchVMsWithDeps() = %v after %d calls, want the first call without VMs", err, calls)
+	}
+}
+
+func TestWatchVMsWithDeps_ListError(t *testing.T) {
+	lv := newMockLibvirtClient()
+	lv.connectListAllDomainsFunc = func(needResults int32, flags libvirt.ConnectListAllDomainsFlags) ([]libvirt.Domain, uint32, error) {
+		return nil, 0, fmt.Errorf("connection lost")
+	}
+
+	err := watchVMsWithDeps(context.Background(), lv, time.Hour, func([]WatchEvent) {})
+	if err == nil {
+		t.Error("expected an error when the VMs cannot be listed")
+	}
+}
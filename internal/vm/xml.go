@@ -0,0 +1,97 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/digitalocean/go-libvirt"
+
+	"github.com/jbweber/foundry/api/v1alpha1"
+	foundrylibvirt "github.com/jbweber/foundry/internal/libvirt"
+	"github.com/jbweber/foundry/internal/logging"
+	"github.com/jbweber/foundry/internal/metadata"
+)
+
+// DomainXML returns the libvirt domain XML of a VM. For a running VM this is
+// the live definition, with the devices and ports libvirt assigned at boot;
+// with inactive it is the persistent definition used for the next boot.
+func DomainXML(ctx context.Context, name string, inactive bool) (string, error) {
+	client, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			logging.FromContext(ctx).Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	return domainXMLWithDeps(name, inactive, client.Libvirt())
+}
+
+// domainXMLWithDeps returns the domain XML of a VM with injected
+// dependencies.
+func domainXMLWithDeps(name string, inactive bool, lv LibvirtClient) (string, error) {
+	domain, err := lv.DomainLookupByName(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to find VM %s: %w", name, err)
+	}
+
+	var flags libvirt.DomainXMLFlags
+	if inactive {
+		flags = libvirt.DomainXMLInactive
+	}
+	xmlDesc, err := lv.DomainGetXMLDesc(domain, flags)
+	if err != nil {
+		return "", fmt.Errorf("failed to get domain XML: %w", err)
+	}
+	return xmlDesc, nil
+}
+
+// ApplyXML returns the domain XML that Apply would submit to libvirt for a
+// configuration, without changing anything: the definition of a new VM, or
+// the redefinition of an existing one. Like Apply, an existing VM keeps its
+// UUID, MAC addresses and metadata.
+func ApplyXML(ctx context.Context, config *v1alpha1.VirtualMachine) (string, error) {
+	client, err := foundrylibvirt.ConnectWithContext(ctx, "", 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to libvirt: %w", err)
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			logging.FromContext(ctx).Warn("Failed to close libvirt connection", "error", err)
+		}
+	}()
+
+	return applyXMLWithDeps(config, client.Libvirt(), metadata.NewClient(client.Libvirt()))
+}
+
+// applyXMLWithDeps returns the domain XML Apply would submit with injected
+// dependencies. The configuration is not modified.
+func applyXMLWithDeps(config *v1alpha1.VirtualMachine, lv LibvirtClient, mc *metadata.Client) (string, error) {
+	if config.Name == "" && config.GenerateName != "" {
+		return "", fmt.Errorf("metadata.generateName cannot be used with apply; use 'foundry create'")
+	}
+
+	domain, err := lv.DomainLookupByName(config.Name)
+	if err != nil {
+		plan, err := PlanFromConfig(config)
+		if err != nil {
+			return "", err
+		}
+		return plan.DomainXML, nil
+	}
+
+	current, err := mc.Load(domain)
+	if err != nil {
+		return "", fmt.Errorf("failed to load stored spec for VM '%s' (not managed by foundry?): %w", config.Name, err)
+	}
+
+	desired := config.DeepCopy()
+	inheritMACAddresses(current, desired)
+	inheritVFAddresses(current, desired)
+	inheritAnnotations(current, desired)
+
+	_, domainXML, err := redefinedDomain(lv, domain, desired)
+	return domainXML, err
+}
@@ -0,0 +1,103 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+)
+
+func TestDomainXMLWithDeps(t *testing.T) {
+	lv := newMockLibvirtClient()
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		return libvirt.Domain{Name: name}, nil
+	}
+	var gotFlags []libvirt.DomainXMLFlags
+	lv.domainGetXMLDescFunc = func(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+		gotFlags = append(gotFlags, flags)
+		return "<domain type='kvm'><name>" + dom.Name + "</name></domain>", nil
+	}
+
+	got, err := domainXMLWithDeps("test-vm", false, lv)
+	if err != nil {
+		t.Fatalf("domainXMLWithDeps() error = %v", err)
+	}
+	if got != "<domain type='kvm'><name>test-vm</name></domain>" {
+		t.Errorf("domainXMLWithDeps() = %q", got)
+	}
+
+	if _, err := domainXMLWithDeps("test-vm", true, lv); err != nil {
+		t.Fatalf("domainXMLWithDeps() error = %v", err)
+	}
+	if len(gotFlags) != 2 || gotFlags[0] != 0 || gotFlags[1] != libvirt.DomainXMLInactive {
+		t.Errorf("flags = %v, want [0 %v]", gotFlags, libvirt.DomainXMLInactive)
+	}
+}
+
+func TestDomainXMLWithDeps_NotFound(t *testing.T) {
+	lv := newMockLibvirtClient()
+
+	_, err := domainXMLWithDeps("missing", false, lv)
+	if err == nil || !strings.Contains(err.Error(), "failed to find VM missing") {
+		t.Errorf("domainXMLWithDeps() error = %v, want not found", err)
+	}
+}
+
+func TestApplyXMLWithDeps_NewVM(t *testing.T) {
+	lv := newMockLibvirtClient()
+	config := testVMConfig()
+
+	got, err := applyXMLWithDeps(config, lv, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyXMLWithDeps() error = %v", err)
+	}
+	if !strings.Contains(got, "<name>test-vm</name>") {
+		t.Errorf("applyXMLWithDeps() = %s, want the definition of test-vm", got)
+	}
+	if len(lv.domainDefineXMLCalls) != 0 {
+		t.Errorf("expected nothing to be defined, got %d DomainDefineXML calls", len(lv.domainDefineXMLCalls))
+	}
+	if config.Spec.NetworkInterfaces[0].MACAddress != "" {
+		t.Error("expected the configuration to be left unmodified")
+	}
+}
+
+func TestApplyXMLWithDeps_ExistingVM(t *testing.T) {
+	stored := testVMConfig()
+	lv, _ := newApplyMocks(t, stored)
+	domainUUID := libvirt.UUID{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}
+	lv.domainLookupByNameFunc = func(name string) (libvirt.Domain, error) {
+		return libvirt.Domain{Name: name, UUID: domainUUID}, nil
+	}
+
+	desired := testVMConfig()
+	desired.Spec.VCPUs = 8
+
+	got, err := applyXMLWithDeps(desired, lv, newMockMetadataClient(lv))
+	if err != nil {
+		t.Fatalf("applyXMLWithDeps() error = %v", err)
+	}
+	for _, want := range []string{
+		"<uuid>12345678-9abc-def0-1234-56789abcdef0</uuid>",
+		">8</vcpu>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("applyXMLWithDeps() = %s, want it to contain %s", got, want)
+		}
+	}
+	if len(lv.domainDefineXMLCalls) != 0 {
+		t.Errorf("expected nothing to be redefined, got %d DomainDefineXML calls", len(lv.domainDefineXMLCalls))
+	}
+}
+
+func TestApplyXMLWithDeps_GenerateName(t *testing.T) {
+	lv := newMockLibvirtClient()
+	config := testVMConfig()
+	config.Name = ""
+	config.GenerateName = "web-"
+
+	_, err := applyXMLWithDeps(config, lv, newMockMetadataClient(lv))
+	if err == nil || !strings.Contains(err.Error(), "generateName cannot be used with apply") {
+		t.Errorf("applyXMLWithDeps() error = %v, want generateName error", err)
+	}
+}
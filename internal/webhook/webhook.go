@@ -0,0 +1,350 @@
+// Package webhook delivers VM lifecycle notifications from daemon mode to
+// HTTP endpoints, with retries and HMAC-SHA256 request signatures.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"go.yaml.in/yaml/v3"
+)
+
+// HTTP headers set on every delivery.
+const (
+	// HeaderEvent carries the event type (e.g., "started").
+	HeaderEvent = "X-Foundry-Event"
+
+	// HeaderDelivery carries a unique ID per event, identical across retries.
+	HeaderDelivery = "X-Foundry-Delivery"
+
+	// HeaderSignature carries "sha256=<hex HMAC of the body>" when the
+	// endpoint has a secret.
+	HeaderSignature = "X-Foundry-Signature"
+)
+
+// Defaults for Options.
+const (
+	DefaultMaxAttempts    = 5
+	DefaultInitialBackoff = 1 * time.Second
+	DefaultQueueSize      = 100
+
+	// maxBackoff caps the exponential backoff between attempts.
+	maxBackoff = 1 * time.Minute
+
+	// requestTimeout bounds a single delivery attempt.
+	requestTimeout = 10 * time.Second
+)
+
+// Event is the JSON payload POSTed to endpoints.
+type Event struct {
+	// ID uniquely identifies the event; it is also sent as HeaderDelivery.
+	ID string `json:"id"`
+
+	// Type is the kind of change: created, destroyed, started, stopped or crashed.
+	Type string `json:"type"`
+
+	// VM is the name of the VM.
+	VM string `json:"vm"`
+
+	// Reason is an optional detail (e.g., "shutdown" for a stopped VM).
+	Reason string `json:"reason,omitempty"`
+
+	// Host is the hostname of the hypervisor running foundry.
+	Host string `json:"host,omitempty"`
+
+	// Timestamp is when the change was observed.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Endpoint is a webhook receiver.
+type Endpoint struct {
+	// Name identifies the endpoint in logs.
+	Name string `yaml:"name"`
+
+	// URL is the http(s) URL events are POSTed to.
+	URL string `yaml:"url"`
+
+	// Secret, if set, is the HMAC-SHA256 key used to sign request bodies.
+	Secret string `yaml:"secret,omitempty"`
+
+	// Events limits deliveries to these event types. Empty means all.
+	Events []string `yaml:"events,omitempty"`
+}
+
+// Wants reports whether the endpoint subscribes to the event type.
+func (e Endpoint) Wants(eventType string) bool {
+	return len(e.Events) == 0 || slices.Contains(e.Events, eventType)
+}
+
+// Config is the daemon's webhook configuration file.
+//
+// Example:
+//
+//	endpoints:
+//	  - name: chatops
+//	    url: https://hooks.example.com/foundry
+//	    secret: 9b2e4d...
+//	    events: [crashed, stopped]
+type Config struct {
+	Endpoints []Endpoint `yaml:"endpoints"`
+}
+
+// eventTypes are the event types endpoints may subscribe to.
+var eventTypes = []string{"created", "destroyed", "started", "stopped", "crashed"}
+
+// LoadConfig reads and validates a webhook config file. Because it may hold
+// signing secrets, the file must not be readable by group or others.
+func LoadConfig(path string) (*Config, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat webhook config: %w", err)
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("webhook config %s must not be accessible by group or others (mode %04o, want 0600)", path, info.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook config: %w", err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook config: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid webhook config: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// Validate checks endpoints for missing names, bad URLs and unknown event types.
+func (c *Config) Validate() error {
+	if len(c.Endpoints) == 0 {
+		return errors.New("at least one endpoint must be configured")
+	}
+
+	names := make(map[string]bool)
+	for i, ep := range c.Endpoints {
+		if ep.Name == "" {
+			return fmt.Errorf("endpoints[%d]: name is required", i)
+		}
+		if names[ep.Name] {
+			return fmt.Errorf("endpoints[%d]: duplicate name %q", i, ep.Name)
+		}
+		names[ep.Name] = true
+
+		u, err := url.Parse(ep.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("endpoint %q: url must be an http(s) URL (got %q)", ep.Name, ep.URL)
+		}
+
+		for _, typ := range ep.Events {
+			if !slices.Contains(eventTypes, typ) {
+				return fmt.Errorf("endpoint %q: unknown event type %q", ep.Name, typ)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Options configures a Notifier.
+type Options struct {
+	// HTTPClient sends deliveries. Defaults to a client with a 10s timeout.
+	HTTPClient *http.Client
+
+	// MaxAttempts is the number of delivery attempts per event and endpoint.
+	// Defaults to DefaultMaxAttempts.
+	MaxAttempts int
+
+	// InitialBackoff is the wait before the first retry; it doubles for each
+	// further retry up to one minute. Defaults to DefaultInitialBackoff.
+	InitialBackoff time.Duration
+
+	// QueueSize is the number of undelivered events buffered per endpoint
+	// before new events are dropped. Defaults to DefaultQueueSize.
+	QueueSize int
+
+	// Logger receives dropped and failed deliveries. Defaults to
+	// slog.Default().
+	Logger *slog.Logger
+}
+
+// Notifier delivers events to the configured endpoints.
+//
+// Each endpoint has its own queue and worker so a slow or failing receiver
+// does not delay deliveries to the others. Events to one endpoint are
+// delivered in order.
+type Notifier struct {
+	opts    Options
+	workers []*worker
+}
+
+// worker delivers events to a single endpoint.
+type worker struct {
+	endpoint Endpoint
+	queue    chan Event
+}
+
+// New creates a Notifier for cfg. Call Run to start delivering.
+func New(cfg *Config, opts Options) *Notifier {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: requestTimeout}
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = DefaultInitialBackoff
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	n := &Notifier{opts: opts}
+	for _, ep := range cfg.Endpoints {
+		n.workers = append(n.workers, &worker{
+			endpoint: ep,
+			queue:    make(chan Event, opts.QueueSize),
+		})
+	}
+	return n
+}
+
+// Notify queues an event for delivery to every endpoint subscribed to its
+// type. It never blocks: if an endpoint's queue is full the event is dropped
+// for that endpoint and a warning is logged. ID and Timestamp are filled in
+// if empty.
+func (n *Notifier) Notify(ev Event) {
+	if ev.ID == "" {
+		ev.ID = uuid.New().String()
+	}
+	if ev.Timestamp.IsZero() {
+		ev.Timestamp = time.Now()
+	}
+
+	for _, w := range n.workers {
+		if !w.endpoint.Wants(ev.Type) {
+			continue
+		}
+		select {
+		case w.queue <- ev:
+		default:
+			n.opts.Logger.Warn("Webhook queue full, dropping event", "webhook", w.endpoint.Name, "event", ev.Type, "vm", ev.VM)
+		}
+	}
+}
+
+// Run delivers queued events until ctx is cancelled.
+func (n *Notifier) Run(ctx context.Context) {
+	done := make(chan struct{})
+	for _, w := range n.workers {
+		go func(w *worker) {
+			defer func() { done <- struct{}{} }()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case ev := <-w.queue:
+					if err := n.deliver(ctx, w.endpoint, ev); err != nil {
+						n.opts.Logger.Warn("Failed to deliver webhook event", "webhook", w.endpoint.Name, "event", ev.Type, "vm", ev.VM, "error", err)
+					}
+				}
+			}
+		}(w)
+	}
+
+	for range n.workers {
+		<-done
+	}
+}
+
+// deliver POSTs ev to endpoint, retrying with exponential backoff on network
+// errors, 429 and 5xx responses.
+func (n *Notifier) deliver(ctx context.Context, endpoint Endpoint, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	backoff := n.opts.InitialBackoff
+	var lastErr error
+	for attempt := 1; attempt <= n.opts.MaxAttempts; attempt++ {
+		retry, err := n.post(ctx, endpoint, ev, body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry || attempt == n.opts.MaxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+
+	return lastErr
+}
+
+// post makes a single delivery attempt. It reports whether a failed attempt
+// is worth retrying.
+func (n *Notifier) post(ctx context.Context, endpoint Endpoint, ev Event, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "foundry-webhook")
+	req.Header.Set(HeaderEvent, ev.Type)
+	req.Header.Set(HeaderDelivery, ev.ID)
+	if endpoint.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(endpoint.Secret, body))
+	}
+
+	resp, err := n.opts.HTTPClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_ = resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("endpoint returned %s", resp.Status)
+	default:
+		return false, fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+}
+
+// Sign returns the HeaderSignature value for body: "sha256=" followed by the
+// hex-encoded HMAC-SHA256 of body keyed with secret. Receivers should compute
+// the same value and compare it in constant time.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
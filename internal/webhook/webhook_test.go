@@ -0,0 +1,225 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string, mode os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "webhooks.yaml")
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `endpoints:
+  - name: chatops
+    url: https://hooks.example.com/foundry
+    secret: s3cret
+    events: [crashed, stopped]
+`, 0600)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if len(cfg.Endpoints) != 1 || cfg.Endpoints[0].Secret != "s3cret" {
+		t.Errorf("Endpoints = %+v", cfg.Endpoints)
+	}
+	if !cfg.Endpoints[0].Wants("crashed") || cfg.Endpoints[0].Wants("started") {
+		t.Error("event filter not applied")
+	}
+}
+
+func TestLoadConfig_RejectsLoosePermissions(t *testing.T) {
+	path := writeConfig(t, "endpoints: []\n", 0644)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "0600") {
+		t.Errorf("expected permissions error, got %v", err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"no endpoints", Config{}, "at least one endpoint"},
+		{"missing name", Config{Endpoints: []Endpoint{{URL: "https://x"}}}, "name is required"},
+		{"duplicate name", Config{Endpoints: []Endpoint{{Name: "a", URL: "https://x"}, {Name: "a", URL: "https://y"}}}, "duplicate"},
+		{"bad url", Config{Endpoints: []Endpoint{{Name: "a", URL: "ftp://x"}}}, "http(s) URL"},
+		{"unknown event", Config{Endpoints: []Endpoint{{Name: "a", URL: "https://x", Events: []string{"rebooted"}}}}, "unknown event type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	// Reference value from: printf '{"a":1}' | openssl dgst -sha256 -hmac secret
+	got := Sign("secret", []byte(`{"a":1}`))
+	want := "sha256=aa9e2e3575f5d7098b6caccd790888c36d5fdb63342a73bada2d6a51747a8494"
+	if got != want {
+		t.Errorf("Sign() = %q, want %q", got, want)
+	}
+}
+
+// runNotifier starts n and returns a function that stops it.
+func runNotifier(t *testing.T, n *Notifier) func() {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		n.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestNotifier_DeliversSignedEvents(t *testing.T) {
+	type delivery struct {
+		header http.Header
+		body   []byte
+	}
+	received := make(chan delivery, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- delivery{header: r.Header.Clone(), body: body}
+	}))
+	defer srv.Close()
+
+	cfg := &Config{Endpoints: []Endpoint{{Name: "test", URL: srv.URL, Secret: "s3cret"}}}
+	n := New(cfg, Options{})
+	stop := runNotifier(t, n)
+	defer stop()
+
+	n.Notify(Event{Type: "started", VM: "web-1"})
+
+	select {
+	case d := <-received:
+		var ev Event
+		if err := json.Unmarshal(d.body, &ev); err != nil {
+			t.Fatalf("invalid JSON payload: %v", err)
+		}
+		if ev.Type != "started" || ev.VM != "web-1" || ev.ID == "" || ev.Timestamp.IsZero() {
+			t.Errorf("payload = %+v", ev)
+		}
+		if got := d.header.Get(HeaderSignature); got != Sign("s3cret", d.body) {
+			t.Errorf("signature = %q, want %q", got, Sign("s3cret", d.body))
+		}
+		if d.header.Get(HeaderEvent) != "started" || d.header.Get(HeaderDelivery) != ev.ID {
+			t.Errorf("headers = %v", d.header)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("event was not delivered")
+	}
+}
+
+func TestNotifier_RetriesServerErrors(t *testing.T) {
+	var attempts atomic.Int32
+	delivered := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		close(delivered)
+	}))
+	defer srv.Close()
+
+	cfg := &Config{Endpoints: []Endpoint{{Name: "test", URL: srv.URL}}}
+	n := New(cfg, Options{InitialBackoff: time.Millisecond})
+	stop := runNotifier(t, n)
+	defer stop()
+
+	n.Notify(Event{Type: "crashed", VM: "web-1"})
+
+	select {
+	case <-delivered:
+		if got := attempts.Load(); got != 3 {
+			t.Errorf("attempts = %d, want 3", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("event was not delivered after retries (attempts: %d)", attempts.Load())
+	}
+}
+
+func TestNotifier_DoesNotRetryClientErrors(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	n := New(&Config{Endpoints: []Endpoint{{Name: "test", URL: srv.URL}}}, Options{InitialBackoff: time.Millisecond})
+	err := n.deliver(context.Background(), n.workers[0].endpoint, Event{Type: "started", VM: "web-1"})
+	if err == nil {
+		t.Fatal("expected error for 400 response")
+	}
+	if got := attempts.Load(); got != 1 {
+		t.Errorf("attempts = %d, want 1", got)
+	}
+}
+
+func TestNotifier_FiltersEvents(t *testing.T) {
+	var mu sync.Mutex
+	var types []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		types = append(types, r.Header.Get(HeaderEvent))
+	}))
+	defer srv.Close()
+
+	cfg := &Config{Endpoints: []Endpoint{{Name: "crashes", URL: srv.URL, Events: []string{"crashed"}}}}
+	n := New(cfg, Options{})
+
+	n.Notify(Event{Type: "started", VM: "web-1"})
+	n.Notify(Event{Type: "crashed", VM: "web-1"})
+
+	if got := len(n.workers[0].queue); got != 1 {
+		t.Fatalf("queued %d events, want 1", got)
+	}
+
+	stop := runNotifier(t, n)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		count := len(types)
+		mu.Unlock()
+		if count > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(types) != 1 || types[0] != "crashed" {
+		t.Errorf("delivered %v, want [crashed]", types)
+	}
+}